@@ -9,6 +9,7 @@ import (
 	"github.com/adityaadpandey/sfu-go/internals/config"
 	"github.com/adityaadpandey/sfu-go/internals/sfu"
 	"github.com/adityaadpandey/sfu-go/internals/utils"
+	"github.com/adityaadpandey/sfu-go/internals/version"
 	"go.uber.org/zap"
 )
 
@@ -20,9 +21,18 @@ func main() {
 	if err := utils.InitLogger(cfg.Logging.Level, cfg.Logging.Format); err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
+	if cfg.Logging.RingSize > 0 {
+		utils.AttachLogRing(utils.NewLogRing(cfg.Logging.RingSize, cfg.Logging.RingWindow))
+	}
 
 	logger := utils.GetLogger()
-	logger.Info("Starting SFU server")
+	logger.Info("Starting SFU server",
+		zap.String("version", version.Version),
+		zap.String("commit", version.Commit),
+		zap.String("buildDate", version.BuildDate),
+		zap.String("goVersion", version.GoVersion()),
+		zap.String("configFingerprint", cfg.Fingerprint()),
+	)
 
 	// Create SFU instance
 	sfuServer, err := sfu.NewSFU(cfg)
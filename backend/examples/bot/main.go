@@ -0,0 +1,132 @@
+// Command bot is an example participant built on pkg/client. It joins a room,
+// publishes a silent audio track, logs room events and reports how many RTP
+// packets it receives on each forwarded track. With -observer it joins hidden
+// and only receives.
+//
+//	go run ./examples/bot -url ws://localhost:8080/ws -room demo
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// opusSilence is a single 20ms Opus frame of silence.
+var opusSilence = []byte{0xf8, 0xff, 0xfe}
+
+func main() {
+	url := flag.String("url", "ws://localhost:8080/ws", "SFU signaling URL")
+	roomID := flag.String("room", "demo", "room to join")
+	userID := flag.String("user", "bot-"+time.Now().Format("150405"), "user ID")
+	name := flag.String("name", "Example Bot", "display name")
+	token := flag.String("token", "", "bearer token for the signaling handshake")
+	invite := flag.String("invite", "", "room invite token")
+	observer := flag.Bool("observer", false, "join as a hidden, receive-only observer (needs an observer invite)")
+	flag.Parse()
+
+	c, err := client.Connect(*url, *token, client.Options{
+		UserID:        *userID,
+		Name:          *name,
+		AutoReconnect: true,
+		Handlers: client.Handlers{
+			OnPeerJoined: func(p signaling.PeerInfo) { log.Printf("peer joined: %s (%s)", p.Name, p.PeerID) },
+			OnPeerLeft:   func(p signaling.PeerInfo) { log.Printf("peer left: %s (%s)", p.Name, p.PeerID) },
+			OnTrackPublished: func(t signaling.TrackInfo) {
+				log.Printf("track published: %s %s by %s", t.TrackID, t.Kind, t.PeerID)
+			},
+			OnDominantSpeaker: func(m signaling.DominantSpeakerMessage) { log.Printf("dominant speaker: %s", m.NewPeerID) },
+			OnError:           func(err *client.ServerError) { log.Printf("server error: %v", err) },
+			OnRoomClosed:      func(m signaling.RoomClosedMessage) { log.Printf("room %s closed: %s", m.RoomID, m.Reason) },
+			OnDisconnected:    func(err error) { log.Printf("disconnected: %v", err) },
+			OnResumed:         func(r signaling.JoinResponse) { log.Printf("resumed as %s (resumed=%v)", r.PeerID, r.Resumed) },
+		},
+	})
+	if err != nil {
+		log.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	sess, err := c.JoinRoom(ctx, *roomID, client.JoinOptions{
+		InviteToken: *invite,
+		Observer:    *observer,
+		OnTrack: func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+			go countPackets(track)
+		},
+		OnData: func(data []byte) { log.Printf("data: %s", data) },
+	})
+	cancel()
+	if err != nil {
+		log.Fatalf("join: %v", err)
+	}
+	log.Printf("joined %s as peer %s", *roomID, sess.PeerID())
+
+	if *observer {
+		waitForSignal()
+		return
+	}
+
+	audio, err := client.NewSampleTrack(webrtc.MimeTypeOpus, "audio-"+*userID, *userID)
+	if err != nil {
+		log.Fatalf("create track: %v", err)
+	}
+	if _, err := sess.PublishTrack(audio); err != nil {
+		log.Fatalf("publish: %v", err)
+	}
+	go writeSilence(audio)
+
+	waitForSignal()
+}
+
+func waitForSignal() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+	log.Printf("leaving")
+}
+
+func writeSilence(track *webrtc.TrackLocalStaticSample) {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := track.WriteSample(media.Sample{Data: opusSilence, Duration: 20 * time.Millisecond}); err != nil {
+			return
+		}
+	}
+}
+
+func countPackets(track *webrtc.TrackRemote) {
+	var packets atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				log.Printf("track %s (%s): %d packets", track.ID(), track.Kind(), packets.Load())
+			}
+		}
+	}()
+	defer close(done)
+
+	for {
+		if _, _, err := track.ReadRTP(); err != nil {
+			return
+		}
+		packets.Add(1)
+	}
+}
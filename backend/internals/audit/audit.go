@@ -0,0 +1,214 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Result values recorded on audit events
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultDenied  = "denied"
+)
+
+// Event is a single audited administrative or moderation action.
+type Event struct {
+	Time       time.Time         `json:"time"`
+	InstanceID string            `json:"instance_id,omitempty"`
+	Actor      string            `json:"actor"`
+	Action     string            `json:"action"`
+	RoomID     string            `json:"room_id,omitempty"`
+	PeerID     string            `json:"peer_id,omitempty"`
+	Result     string            `json:"result"`
+	Detail     map[string]string `json:"detail,omitempty"`
+}
+
+// Options configures where audit events are written.
+type Options struct {
+	FilePath       string // JSON lines file; empty disables the file sink
+	RingSize       int    // events kept in memory for Query
+	RedisStream    string // Redis Stream key; empty disables the stream sink
+	RedisStreamMax int64  // approximate MAXLEN for the stream
+	InstanceID     string
+}
+
+// Logger records audit events. Log never blocks the caller: events are
+// handed to a background writer, and events that cannot be written (queue
+// full, sink errors) are counted in metrics instead.
+type Logger struct {
+	opts   Options
+	file   *os.File
+	redis  *redis.Client
+	logger *zap.Logger
+
+	// mu guards sends on events against Close closing it
+	mu     sync.RWMutex
+	closed bool
+	events chan Event
+	done   chan struct{}
+
+	ring     []Event
+	ringNext int
+	ringFull bool
+	ringMu   sync.RWMutex
+
+	closeOnce sync.Once
+}
+
+// NewLogger opens the configured sinks and starts the background writer.
+// redisClient may be nil, in which case the stream sink is disabled.
+func NewLogger(opts Options, redisClient *redis.Client, logger *zap.Logger) (*Logger, error) {
+	l := &Logger{
+		opts:   opts,
+		logger: logger,
+		events: make(chan Event, 256),
+		done:   make(chan struct{}),
+	}
+	if opts.RingSize > 0 {
+		l.ring = make([]Event, opts.RingSize)
+	}
+
+	if opts.FilePath != "" {
+		f, err := os.OpenFile(opts.FilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+		if err != nil {
+			return nil, err
+		}
+		l.file = f
+	}
+
+	if opts.RedisStream != "" && redisClient != nil {
+		l.redis = redisClient
+	}
+
+	go l.run()
+	return l, nil
+}
+
+// Log records an event. It is safe to call on a nil Logger.
+func (l *Logger) Log(event Event) {
+	if l == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.InstanceID == "" {
+		event.InstanceID = l.opts.InstanceID
+	}
+
+	l.remember(event)
+	appmetrics.RecordAuditEvent(event.Action, event.Result)
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		appmetrics.RecordAuditWriteFailure("closed")
+		return
+	}
+	select {
+	case l.events <- event:
+	default:
+		appmetrics.RecordAuditWriteFailure("queue")
+	}
+}
+
+// Query returns the most recent events from the in-memory buffer, newest
+// first, optionally filtered by room. limit <= 0 returns everything buffered.
+func (l *Logger) Query(roomID string, limit int) []Event {
+	if l == nil {
+		return nil
+	}
+	l.ringMu.RLock()
+	defer l.ringMu.RUnlock()
+
+	n := l.ringNext
+	if l.ringFull {
+		n = len(l.ring)
+	}
+
+	result := make([]Event, 0)
+	for i := 0; i < n; i++ {
+		idx := (l.ringNext - 1 - i + len(l.ring)) % len(l.ring)
+		ev := l.ring[idx]
+		if roomID != "" && ev.RoomID != roomID {
+			continue
+		}
+		result = append(result, ev)
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+	return result
+}
+
+// Close flushes queued events and closes the sinks. Events logged after
+// Close are only kept in memory for Query.
+func (l *Logger) Close() {
+	if l == nil {
+		return
+	}
+	l.closeOnce.Do(func() {
+		l.mu.Lock()
+		l.closed = true
+		close(l.events)
+		l.mu.Unlock()
+		<-l.done
+		if l.file != nil {
+			l.file.Close()
+		}
+	})
+}
+
+func (l *Logger) remember(event Event) {
+	if len(l.ring) == 0 {
+		return
+	}
+	l.ringMu.Lock()
+	l.ring[l.ringNext] = event
+	l.ringNext = (l.ringNext + 1) % len(l.ring)
+	if l.ringNext == 0 {
+		l.ringFull = true
+	}
+	l.ringMu.Unlock()
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+	for event := range l.events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			appmetrics.RecordAuditWriteFailure("encode")
+			continue
+		}
+
+		if l.file != nil {
+			if _, err := l.file.Write(append(data, '\n')); err != nil {
+				appmetrics.RecordAuditWriteFailure("file")
+				l.logger.Warn("Failed to write audit event", zap.Error(err))
+			}
+		}
+
+		if l.redis != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			err := l.redis.XAdd(ctx, &redis.XAddArgs{
+				Stream: l.opts.RedisStream,
+				MaxLen: l.opts.RedisStreamMax,
+				Approx: l.opts.RedisStreamMax > 0,
+				Values: map[string]interface{}{"event": data},
+			}).Err()
+			cancel()
+			if err != nil {
+				appmetrics.RecordAuditWriteFailure("redis")
+				l.logger.Warn("Failed to publish audit event", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package audit
+
+import (
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestLogAfterClose(t *testing.T) {
+	l, err := NewLogger(Options{RingSize: 4}, nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Log(Event{Actor: "admin", Action: "room.delete", Result: ResultSuccess})
+			}
+		}()
+	}
+	l.Close()
+	wg.Wait()
+
+	l.Log(Event{Actor: "admin", Action: "room.delete", Result: ResultSuccess})
+	if got := len(l.Query("", 0)); got != 4 {
+		t.Fatalf("Query returned %d events, want the ring's 4", got)
+	}
+}
@@ -0,0 +1,96 @@
+package authz
+
+import "context"
+
+// An Authorizer decides who may join a room and what they may publish and
+// subscribe to. The SFU consults it on every join, before accepting each
+// published track, and before forwarding each track to a subscriber, so
+// deployments can plug in their own permission model. Implementations must
+// be safe for concurrent use and should answer quickly: publish and
+// subscribe checks run on the media setup path.
+//
+// An error means no decision could be made. The SFU then refuses the
+// action; an implementation that prefers to fail open returns Allow()
+// instead.
+type Authorizer interface {
+	AuthorizeJoin(ctx context.Context, req JoinRequest) (Decision, error)
+	AuthorizePublish(ctx context.Context, peer Peer, kind string) (Decision, error)
+	AuthorizeSubscribe(ctx context.Context, peer Peer, trackHandle string) (Decision, error)
+}
+
+// Actions, as sent to HTTP callbacks and recorded in metrics
+const (
+	ActionJoin      = "join"
+	ActionPublish   = "publish"
+	ActionSubscribe = "subscribe"
+)
+
+// JoinRequest describes a join to authorize.
+type JoinRequest struct {
+	RoomID string `json:"roomId"`
+	UserID string `json:"userId"`
+	Name   string `json:"name,omitempty"`
+	// Bearer token of the signaling connection, if the client sent one
+	Token string `json:"token,omitempty"`
+	// Role bound by the invite the client redeemed, if any
+	Role     string                 `json:"role,omitempty"`
+	Observer bool                   `json:"observer,omitempty"`
+	Resumed  bool                   `json:"resumed,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Peer describes a peer that has joined, for publish and subscribe checks.
+type Peer struct {
+	RoomID string `json:"roomId"`
+	UserID string `json:"userId"`
+	PeerID string `json:"peerId"`
+	Role   string `json:"role,omitempty"`
+	// Token the peer joined with; never sent to HTTP callbacks
+	Token string `json:"-"`
+}
+
+// Decision is an Authorizer's answer. A join decision may also carry
+// constraints the SFU applies to the peer; they are ignored on publish
+// and subscribe decisions.
+type Decision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"` // why it was denied, sent to the client
+
+	// Role replaces the invite role, if set
+	Role string `json:"role,omitempty"`
+	// Most tracks the peer may publish at once (0 = no per-peer limit)
+	MaxTracks int `json:"maxTracks,omitempty"`
+	// Force the peer's media through TURN
+	RelayOnly bool `json:"relayOnly,omitempty"`
+	// Make the user the room's host
+	Host bool `json:"host,omitempty"`
+	// Unix time after which the peer may no longer publish and is
+	// downgraded to a viewer (0 = no limit)
+	PublishUntil int64 `json:"publishUntil,omitempty"`
+}
+
+// Allow returns a decision that allows the action with no constraints.
+func Allow() Decision {
+	return Decision{Allow: true}
+}
+
+// Deny returns a decision that refuses the action for reason.
+func Deny(reason string) Decision {
+	return Decision{Reason: reason}
+}
+
+// AllowAll allows everything. It is the default, leaving access to invites
+// and the room settings.
+type AllowAll struct{}
+
+func (AllowAll) AuthorizeJoin(context.Context, JoinRequest) (Decision, error) {
+	return Allow(), nil
+}
+
+func (AllowAll) AuthorizePublish(context.Context, Peer, string) (Decision, error) {
+	return Allow(), nil
+}
+
+func (AllowAll) AuthorizeSubscribe(context.Context, Peer, string) (Decision, error) {
+	return Allow(), nil
+}
@@ -0,0 +1,211 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HTTPCallback asks a deployment's own service. Each check is POSTed to
+// the URL as a callbackRequest and answered with a Decision in a 2xx JSON
+// body. Transport errors and 5xx answers are retried; if no answer arrives
+// within the retries the callback fails closed (an error, so the SFU
+// refuses) or, with FailOpen, allows. A 4xx answer or a body that is not a
+// Decision is an answer, and denies whatever FailOpen says. Decisions are
+// cached per request for CacheTTL, so reconnects and fan-out to many
+// subscribers cost one call.
+
+// HTTPCallbackOptions configures HTTPCallback.
+type HTTPCallbackOptions struct {
+	URL          string
+	Header       http.Header   // sent with every request, e.g. Authorization
+	Timeout      time.Duration // per attempt
+	Retries      int           // further attempts after a failure
+	RetryBackoff time.Duration // doubled after every retry
+	FailOpen     bool          // allow when the service cannot be reached
+	CacheTTL     time.Duration // 0 disables caching
+	CacheSize    int           // most cached answers; default 10000
+	Client       *http.Client  // default http.DefaultClient
+}
+
+// errUnreachable marks a failure that gave no answer: a transport error or
+// a 5xx, once the retries have run out.
+var errUnreachable = errors.New("authorization service unreachable")
+
+// Reasons given for denials by a callback that answered without a Decision.
+const (
+	ReasonCallbackRefused = "authorization_refused"
+	ReasonCallbackInvalid = "authorization_invalid"
+)
+
+// callbackRequest is the body POSTed to the callback URL. Only the field
+// for the action is set.
+type callbackRequest struct {
+	Action string       `json:"action"`
+	Join   *JoinRequest `json:"join,omitempty"`
+	Peer   *Peer        `json:"peer,omitempty"`
+	Kind   string       `json:"kind,omitempty"`
+	Track  string       `json:"track,omitempty"`
+}
+
+// HTTPCallback is an Authorizer backed by an HTTP service.
+type HTTPCallback struct {
+	opts HTTPCallbackOptions
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedDecision
+}
+
+type cachedDecision struct {
+	decision Decision
+	expires  time.Time
+}
+
+// NewHTTPCallback returns an HTTPCallback authorizer.
+func NewHTTPCallback(opts HTTPCallbackOptions) (*HTTPCallback, error) {
+	if opts.URL == "" {
+		return nil, errors.New("http authorizer: URL is required")
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = 10000
+	}
+	return &HTTPCallback{opts: opts, cache: make(map[[sha256.Size]byte]cachedDecision)}, nil
+}
+
+func (h *HTTPCallback) AuthorizeJoin(ctx context.Context, req JoinRequest) (Decision, error) {
+	return h.authorize(ctx, callbackRequest{Action: ActionJoin, Join: &req})
+}
+
+func (h *HTTPCallback) AuthorizePublish(ctx context.Context, peer Peer, kind string) (Decision, error) {
+	return h.authorize(ctx, callbackRequest{Action: ActionPublish, Peer: &peer, Kind: kind})
+}
+
+func (h *HTTPCallback) AuthorizeSubscribe(ctx context.Context, peer Peer, trackHandle string) (Decision, error) {
+	return h.authorize(ctx, callbackRequest{Action: ActionSubscribe, Peer: &peer, Track: trackHandle})
+}
+
+func (h *HTTPCallback) authorize(ctx context.Context, req callbackRequest) (Decision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Decision{}, err
+	}
+	key := sha256.Sum256(body)
+	if d, ok := h.cached(key); ok {
+		return d, nil
+	}
+
+	d, err := h.call(ctx, body)
+	if err != nil {
+		if h.opts.FailOpen && errors.Is(err, errUnreachable) {
+			return Allow(), nil
+		}
+		return Decision{}, err
+	}
+	h.store(key, d)
+	return d, nil
+}
+
+// call POSTs body, retrying transport errors and 5xx answers.
+func (h *HTTPCallback) call(ctx context.Context, body []byte) (Decision, error) {
+	backoff := h.opts.RetryBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		var d Decision
+		var retry bool
+		d, retry, err = h.post(ctx, body)
+		if err == nil {
+			return d, nil
+		}
+		if !retry || attempt >= h.opts.Retries {
+			return Decision{}, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return Decision{}, err
+		}
+		backoff *= 2
+	}
+}
+
+// post makes one attempt and reports whether a failure may be retried. A
+// 4xx answer or an undecodable body is a denial, not a failure.
+func (h *HTTPCallback) post(ctx context.Context, body []byte) (Decision, bool, error) {
+	if h.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.opts.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, false, err
+	}
+	for k, v := range h.opts.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.opts.Client.Do(req)
+	if err != nil {
+		return Decision{}, true, fmt.Errorf("%w: %w", errUnreachable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return Decision{}, true, fmt.Errorf("%w: status %d", errUnreachable, resp.StatusCode)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return Deny(ReasonCallbackRefused), false, nil
+	}
+
+	var d Decision
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&d); err != nil {
+		return Deny(ReasonCallbackInvalid), false, nil
+	}
+	return d, false, nil
+}
+
+func (h *HTTPCallback) cached(key [sha256.Size]byte) (Decision, bool) {
+	if h.opts.CacheTTL <= 0 {
+		return Decision{}, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.cache[key]
+	if !ok || time.Now().After(c.expires) {
+		return Decision{}, false
+	}
+	return c.decision, true
+}
+
+func (h *HTTPCallback) store(key [sha256.Size]byte, d Decision) {
+	if h.opts.CacheTTL <= 0 {
+		return
+	}
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.cache) >= h.opts.CacheSize {
+		for k, c := range h.cache {
+			if now.After(c.expires) {
+				delete(h.cache, k)
+			}
+		}
+		// Still full of live answers: start over rather than grow
+		if len(h.cache) >= h.opts.CacheSize {
+			clear(h.cache)
+		}
+	}
+	h.cache[key] = cachedDecision{decision: d, expires: now.Add(h.opts.CacheTTL)}
+}
@@ -0,0 +1,202 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// callbackServer answers each call with the next of answers, repeating the
+// last, and counts the calls.
+func callbackServer(t *testing.T, answers ...func(w http.ResponseWriter)) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req callbackRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode callback request: %v", err)
+		}
+		n := int(calls.Add(1)) - 1
+		answers[min(n, len(answers)-1)](w)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func status(code int) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) { w.WriteHeader(code) }
+}
+
+func decision(d Decision) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) { json.NewEncoder(w).Encode(d) }
+}
+
+func body(s string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) { w.Write([]byte(s)) }
+}
+
+func newCallback(t *testing.T, opts HTTPCallbackOptions) *HTTPCallback {
+	t.Helper()
+	h, err := NewHTTPCallback(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+var testJoin = JoinRequest{RoomID: "room", UserID: "alice"}
+
+func TestHTTPCallbackRetriesServerErrors(t *testing.T) {
+	srv, calls := callbackServer(t,
+		status(http.StatusBadGateway),
+		status(http.StatusServiceUnavailable),
+		decision(Decision{Allow: true, Role: "host"}),
+	)
+	h := newCallback(t, HTTPCallbackOptions{URL: srv.URL, Retries: 2, RetryBackoff: time.Millisecond})
+
+	d, err := h.AuthorizeJoin(context.Background(), testJoin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Allow || d.Role != "host" {
+		t.Fatalf("decision = %+v, want the third answer", d)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("%d calls, want 3", n)
+	}
+}
+
+func TestHTTPCallbackGivesUpAfterRetries(t *testing.T) {
+	srv, calls := callbackServer(t, status(http.StatusInternalServerError))
+
+	closed := newCallback(t, HTTPCallbackOptions{URL: srv.URL, Retries: 1, RetryBackoff: time.Millisecond})
+	if _, err := closed.AuthorizeJoin(context.Background(), testJoin); err == nil {
+		t.Fatal("fail-closed callback returned no error for an unreachable service")
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("%d calls, want 2", n)
+	}
+
+	open := newCallback(t, HTTPCallbackOptions{URL: srv.URL, Retries: 1, RetryBackoff: time.Millisecond, FailOpen: true})
+	d, err := open.AuthorizeJoin(context.Background(), testJoin)
+	if err != nil || !d.Allow {
+		t.Fatalf("fail-open callback = %+v, %v; want allowed", d, err)
+	}
+}
+
+func TestHTTPCallbackFailsOpenOnTransportError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	h := newCallback(t, HTTPCallbackOptions{URL: url, FailOpen: true})
+	d, err := h.AuthorizeJoin(context.Background(), testJoin)
+	if err != nil || !d.Allow {
+		t.Fatalf("decision = %+v, %v; want allowed", d, err)
+	}
+}
+
+func TestHTTPCallbackDeniesAnswersWithoutDecision(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		answer func(w http.ResponseWriter)
+		reason string
+	}{
+		{"forbidden", status(http.StatusForbidden), ReasonCallbackRefused},
+		{"too many requests", status(http.StatusTooManyRequests), ReasonCallbackRefused},
+		{"broken body", body("{not json"), ReasonCallbackInvalid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, calls := callbackServer(t, tc.answer)
+			h := newCallback(t, HTTPCallbackOptions{URL: srv.URL, Retries: 3, RetryBackoff: time.Millisecond, FailOpen: true})
+
+			d, err := h.AuthorizeJoin(context.Background(), testJoin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Allow || d.Reason != tc.reason {
+				t.Fatalf("decision = %+v, want denied with %q", d, tc.reason)
+			}
+			if n := calls.Load(); n != 1 {
+				t.Fatalf("%d calls, want 1: answers are not retried", n)
+			}
+		})
+	}
+}
+
+func TestHTTPCallbackCachesPerRequest(t *testing.T) {
+	srv, calls := callbackServer(t, decision(Decision{Allow: true}))
+	h := newCallback(t, HTTPCallbackOptions{URL: srv.URL, CacheTTL: time.Minute})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := h.AuthorizeJoin(ctx, testJoin); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("%d calls for one request, want 1", n)
+	}
+
+	other := testJoin
+	other.UserID = "bob"
+	if _, err := h.AuthorizeJoin(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.AuthorizePublish(ctx, Peer{RoomID: "room", UserID: "alice", PeerID: "p"}, "audio"); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("%d calls for three distinct requests, want 3", n)
+	}
+}
+
+func TestHTTPCallbackCacheExpires(t *testing.T) {
+	srv, calls := callbackServer(t, decision(Decision{Allow: true}), decision(Decision{Reason: "banned"}))
+	h := newCallback(t, HTTPCallbackOptions{URL: srv.URL, CacheTTL: 20 * time.Millisecond})
+	ctx := context.Background()
+
+	if d, _ := h.AuthorizeJoin(ctx, testJoin); !d.Allow {
+		t.Fatal("first answer not allowed")
+	}
+	time.Sleep(40 * time.Millisecond)
+	d, err := h.AuthorizeJoin(ctx, testJoin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Allow || d.Reason != "banned" || calls.Load() != 2 {
+		t.Fatalf("decision after expiry = %+v after %d calls, want the second answer", d, calls.Load())
+	}
+}
+
+func TestHTTPCallbackDoesNotCacheFailures(t *testing.T) {
+	srv, calls := callbackServer(t, status(http.StatusInternalServerError), decision(Decision{Allow: true}))
+	h := newCallback(t, HTTPCallbackOptions{URL: srv.URL, CacheTTL: time.Minute, FailOpen: true})
+	ctx := context.Background()
+
+	h.AuthorizeJoin(ctx, testJoin) // fails open, not cached
+	d, err := h.AuthorizeJoin(ctx, testJoin)
+	if err != nil || !d.Allow || calls.Load() != 2 {
+		t.Fatalf("decision = %+v, %v after %d calls; want the service asked again", d, err, calls.Load())
+	}
+}
+
+func TestHTTPCallbackOmitsPeerToken(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		json.NewEncoder(w).Encode(Allow())
+	}))
+	defer srv.Close()
+
+	h := newCallback(t, HTTPCallbackOptions{URL: srv.URL})
+	h.AuthorizeSubscribe(context.Background(), Peer{RoomID: "room", UserID: "alice", Token: "secret"}, "t_1")
+	peer, _ := got["peer"].(map[string]interface{})
+	if _, ok := peer["token"]; ok || got["track"] != "t_1" || got["action"] != ActionSubscribe {
+		t.Fatalf("callback request = %v", got)
+	}
+}
@@ -0,0 +1,188 @@
+package authz
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// JWTClaims authorizes from the claims of an HS256-signed JWT, sent as the
+// bearer token of the signaling connection. The token must name the user
+// (sub) and the room (room, or "*" for any), and is only checked for expiry
+// at join: a call outlives the token it started with.
+//
+// Optional claims: role, canPublish and canSubscribe (default true),
+// publishKinds (e.g. ["audio"]), maxTracks, relayOnly, host and
+// publishUntil (Unix seconds).
+
+var (
+	ErrMissingToken = errors.New("missing token")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// Claims are the JWT claims JWTClaims understands.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+
+	Room         string   `json:"room"`
+	Role         string   `json:"role,omitempty"`
+	CanPublish   *bool    `json:"canPublish,omitempty"`
+	CanSubscribe *bool    `json:"canSubscribe,omitempty"`
+	PublishKinds []string `json:"publishKinds,omitempty"`
+	MaxTracks    int      `json:"maxTracks,omitempty"`
+	RelayOnly    bool     `json:"relayOnly,omitempty"`
+	Host         bool     `json:"host,omitempty"`
+	PublishUntil int64    `json:"publishUntil,omitempty"`
+}
+
+// audience is the aud claim, which may be a string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// JWTOptions configures JWTClaims.
+type JWTOptions struct {
+	Secret   []byte // HMAC key; required
+	Issuer   string // required iss, if set
+	Audience string // required in aud, if set
+	Leeway   time.Duration
+}
+
+// JWTClaims is an Authorizer backed by signed token claims.
+type JWTClaims struct {
+	opts JWTOptions
+}
+
+// NewJWTClaims returns a JWTClaims authorizer.
+func NewJWTClaims(opts JWTOptions) (*JWTClaims, error) {
+	if len(opts.Secret) == 0 {
+		return nil, errors.New("jwt authorizer: secret is required")
+	}
+	return &JWTClaims{opts: opts}, nil
+}
+
+func (j *JWTClaims) AuthorizeJoin(_ context.Context, req JoinRequest) (Decision, error) {
+	claims, err := j.Parse(req.Token, true)
+	if err != nil {
+		return Deny(err.Error()), nil
+	}
+	if claims.Subject != req.UserID {
+		return Deny("token is for another user"), nil
+	}
+	if claims.Room != "*" && claims.Room != req.RoomID {
+		return Deny("token is for another room"), nil
+	}
+	return Decision{
+		Allow:        true,
+		Role:         claims.Role,
+		MaxTracks:    claims.MaxTracks,
+		RelayOnly:    claims.RelayOnly,
+		Host:         claims.Host,
+		PublishUntil: claims.PublishUntil,
+	}, nil
+}
+
+func (j *JWTClaims) AuthorizePublish(_ context.Context, peer Peer, kind string) (Decision, error) {
+	claims, err := j.Parse(peer.Token, false)
+	if err != nil {
+		return Deny(err.Error()), nil
+	}
+	if claims.CanPublish != nil && !*claims.CanPublish {
+		return Deny("token does not allow publishing"), nil
+	}
+	if len(claims.PublishKinds) > 0 && !slices.Contains(claims.PublishKinds, kind) {
+		return Deny("token does not allow publishing " + kind), nil
+	}
+	return Allow(), nil
+}
+
+func (j *JWTClaims) AuthorizeSubscribe(_ context.Context, peer Peer, _ string) (Decision, error) {
+	claims, err := j.Parse(peer.Token, false)
+	if err != nil {
+		return Deny(err.Error()), nil
+	}
+	if claims.CanSubscribe != nil && !*claims.CanSubscribe {
+		return Deny("token does not allow subscribing"), nil
+	}
+	return Allow(), nil
+}
+
+// Parse verifies token and returns its claims. With checkTime the token
+// must also be within its validity window.
+func (j *JWTClaims) Parse(token string, checkTime bool) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	mac := hmac.New(sha256.New, j.opts.Secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if j.opts.Issuer != "" && claims.Issuer != j.opts.Issuer {
+		return nil, ErrInvalidToken
+	}
+	if j.opts.Audience != "" && !slices.Contains(claims.Audience, j.opts.Audience) {
+		return nil, ErrInvalidToken
+	}
+	if checkTime {
+		now := time.Now()
+		if claims.ExpiresAt != 0 && now.After(time.Unix(claims.ExpiresAt, 0).Add(j.opts.Leeway)) {
+			return nil, ErrTokenExpired
+		}
+		if claims.NotBefore != 0 && now.Add(j.opts.Leeway).Before(time.Unix(claims.NotBefore, 0)) {
+			return nil, ErrInvalidToken
+		}
+	}
+	return &claims, nil
+}
+
+func decodeSegment(segment string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,217 @@
+// Package capture writes RTP packets tapped from the forwarding path to pcap
+// or rtpdump files, so that media a participant sent or received can be
+// analyzed offline.
+package capture
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// Format is the file format of a capture.
+type Format string
+
+const (
+	// FormatPcap writes each packet in a fake IPv4/UDP datagram, one UDP
+	// source port per SSRC, so that Wireshark can decode it as RTP.
+	FormatPcap Format = "pcap"
+	// FormatRTPDump writes the rtpplay format of rtptools.
+	FormatRTPDump Format = "rtpdump"
+)
+
+// ParseFormat returns the format named s; empty is pcap.
+func ParseFormat(s string) (Format, bool) {
+	switch Format(s) {
+	case "", FormatPcap:
+		return FormatPcap, true
+	case FormatRTPDump:
+		return FormatRTPDump, true
+	}
+	return "", false
+}
+
+// Ext returns the file extension of the format.
+func (f Format) Ext() string {
+	return "." + string(f)
+}
+
+// Reasons a capture stopped
+const (
+	StopDuration  = "duration"
+	StopMaxBytes  = "max_bytes"
+	StopRequested = "requested"
+	StopError     = "error"
+)
+
+// queueSize is how many packets a capture may fall behind the forwarding
+// path before it drops them.
+const queueSize = 1024
+
+// Options bound a capture. It stops after Duration or once the file would
+// exceed MaxBytes, whichever comes first.
+type Options struct {
+	Format   Format
+	Duration time.Duration
+	MaxBytes int64
+	// Outbound captures are written as sent by the SFU rather than to it
+	Outbound bool
+}
+
+// Stats describe a capture's progress.
+type Stats struct {
+	Packets    int64      `json:"packets"`
+	Bytes      int64      `json:"bytes"`   // written to the file
+	Dropped    int64      `json:"dropped"` // the writer fell behind
+	StopReason string     `json:"stopReason,omitempty"`
+	StoppedAt  *time.Time `json:"stoppedAt,omitempty"`
+}
+
+type packet struct {
+	at   time.Time
+	data []byte
+}
+
+// Capture writes one capture file. Write may be called from the forwarding
+// path: it never blocks, and packets are written by a background goroutine.
+type Capture struct {
+	opts    Options
+	file    *os.File
+	enc     encoder
+	packets chan packet
+	stopCh  chan struct{}
+	done    chan struct{}
+
+	stopped  atomic.Bool
+	dropped  atomic.Int64
+	stopOnce sync.Once
+
+	mu     sync.Mutex
+	stats  Stats
+	reason string
+}
+
+// Start creates the file at path and starts capturing.
+func Start(path string, opts Options) (*Capture, error) {
+	if opts.Duration <= 0 || opts.MaxBytes <= 0 {
+		return nil, errors.New("capture needs a duration and a byte limit")
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	c := &Capture{
+		opts:    opts,
+		file:    f,
+		packets: make(chan packet, queueSize),
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if opts.Format == FormatRTPDump {
+		c.enc = &rtpdumpEncoder{outbound: opts.Outbound}
+	} else {
+		c.enc = &pcapEncoder{outbound: opts.Outbound, ports: make(map[uint32]uint16)}
+	}
+	go c.run()
+	return c, nil
+}
+
+// Write queues pkt. pkt is marshaled before Write returns and not retained.
+func (c *Capture) Write(pkt *rtp.Packet) {
+	if c.stopped.Load() {
+		return
+	}
+	data, err := pkt.Marshal()
+	if err != nil {
+		return
+	}
+	select {
+	case c.packets <- packet{at: time.Now(), data: data}:
+	default:
+		c.dropped.Add(1)
+	}
+}
+
+// Stop ends the capture with reason; only the first reason is kept. The
+// file is complete once Done is closed.
+func (c *Capture) Stop(reason string) {
+	c.stopOnce.Do(func() {
+		c.mu.Lock()
+		c.reason = reason
+		c.mu.Unlock()
+		c.stopped.Store(true)
+		close(c.stopCh)
+	})
+}
+
+// Done is closed once the capture has stopped and its file is closed.
+func (c *Capture) Done() <-chan struct{} {
+	return c.done
+}
+
+// Stats returns the capture's progress.
+func (c *Capture) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Dropped = c.dropped.Load()
+	return stats
+}
+
+func (c *Capture) run() {
+	defer close(c.done)
+	timer := time.NewTimer(c.opts.Duration)
+	defer timer.Stop()
+
+	w := bufio.NewWriter(c.file)
+	var written int64
+	write := func(b []byte) error {
+		n, err := w.Write(b)
+		written += int64(n)
+		return err
+	}
+
+	err := write(c.enc.header(time.Now()))
+	for err == nil {
+		select {
+		case <-timer.C:
+			c.Stop(StopDuration)
+		case <-c.stopCh:
+		case p := <-c.packets:
+			record := c.enc.record(p.at, p.data)
+			if written+int64(len(record)) > c.opts.MaxBytes {
+				c.Stop(StopMaxBytes)
+				continue
+			}
+			if err = write(record); err == nil {
+				c.mu.Lock()
+				c.stats.Packets++
+				c.stats.Bytes = written
+				c.mu.Unlock()
+			}
+			continue
+		}
+		break
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := c.file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		c.Stop(StopError)
+	}
+
+	c.mu.Lock()
+	c.stats.Bytes = written
+	c.stats.StopReason = c.reason
+	stoppedAt := time.Now()
+	c.stats.StoppedAt = &stoppedAt
+	c.mu.Unlock()
+}
@@ -0,0 +1,260 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+func rtpPacket(ssrc uint32, seq uint16, size int) *rtp.Packet {
+	return &rtp.Packet{
+		Header:  rtp.Header{Version: 2, PayloadType: 96, SequenceNumber: seq, Timestamp: uint32(seq) * 3000, SSRC: ssrc},
+		Payload: bytes.Repeat([]byte{0xab}, size),
+	}
+}
+
+// capture writes pkts to a new capture with opts, stops it and returns the
+// file and the capture's stats.
+func capture(t *testing.T, opts Options, pkts ...*rtp.Packet) ([]byte, Stats) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "c"+opts.Format.Ext())
+	c, err := Start(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkt := range pkts {
+		c.Write(pkt)
+	}
+	// The writer drains the queue before a requested stop is seen
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Stats().Packets+c.Stats().Dropped < int64(len(pkts)) && c.Stats().StopReason == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	c.Stop(StopRequested)
+	<-c.Done()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, c.Stats()
+}
+
+// pcapRecord is one packet of a pcap file with the headers it was wrapped
+// in.
+type pcapRecord struct {
+	src, dst         [4]byte
+	srcPort, dstPort uint16
+	rtp              rtp.Packet
+}
+
+func parsePcap(t *testing.T, data []byte) []pcapRecord {
+	t.Helper()
+	if len(data) < 24 || binary.LittleEndian.Uint32(data) != 0xa1b2c3d4 || binary.LittleEndian.Uint32(data[20:]) != linkTypeRaw {
+		t.Fatalf("bad pcap header %x", data[:min(len(data), 24)])
+	}
+	var records []pcapRecord
+	for rest := data[24:]; len(rest) > 0; {
+		if len(rest) < 16 {
+			t.Fatalf("truncated record header: %d bytes", len(rest))
+		}
+		incl, orig := binary.LittleEndian.Uint32(rest[8:]), binary.LittleEndian.Uint32(rest[12:])
+		if incl != orig || len(rest) < 16+int(incl) {
+			t.Fatalf("record of %d/%d bytes with %d left", incl, orig, len(rest)-16)
+		}
+		ip := rest[16 : 16+incl]
+		rest = rest[16+incl:]
+
+		if ip[0] != 0x45 || ip[9] != ipProtocolUDP || int(binary.BigEndian.Uint16(ip[2:])) != len(ip) {
+			t.Fatalf("bad IPv4 header %x", ip[:ipv4HeaderLen])
+		}
+		if ipv4Checksum(ip[:ipv4HeaderLen]) != 0 {
+			t.Fatal("IPv4 header checksum does not verify")
+		}
+		udp := ip[ipv4HeaderLen:]
+		if int(binary.BigEndian.Uint16(udp[4:])) != len(udp) {
+			t.Fatalf("UDP length %d, datagram %d", binary.BigEndian.Uint16(udp[4:]), len(udp))
+		}
+		var r pcapRecord
+		copy(r.src[:], ip[12:16])
+		copy(r.dst[:], ip[16:20])
+		r.srcPort, r.dstPort = binary.BigEndian.Uint16(udp), binary.BigEndian.Uint16(udp[2:])
+		if err := r.rtp.Unmarshal(udp[udpHeaderLen:]); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestPcap(t *testing.T) {
+	for _, outbound := range []bool{false, true} {
+		data, stats := capture(t, Options{Format: FormatPcap, Duration: time.Minute, MaxBytes: 1 << 20, Outbound: outbound},
+			rtpPacket(1111, 1, 100), rtpPacket(2222, 1, 50), rtpPacket(1111, 2, 100))
+		records := parsePcap(t, data)
+		if len(records) != 3 || stats.Packets != 3 || stats.Bytes != int64(len(data)) || stats.StopReason != StopRequested {
+			t.Fatalf("%d records, stats %+v for a %d byte file", len(records), stats, len(data))
+		}
+
+		// One flow per SSRC between the participant and the SFU, the
+		// direction following the capture's
+		ports := map[uint32]uint16{}
+		for i, r := range records {
+			peerPort, src, dst := r.srcPort, participantAddr, sfuAddr
+			if outbound {
+				peerPort, src, dst = r.dstPort, sfuAddr, participantAddr
+			}
+			if r.src != src || r.dst != dst {
+				t.Fatalf("outbound %v: record %d from %v to %v", outbound, i, r.src, r.dst)
+			}
+			if p, ok := ports[r.rtp.SSRC]; ok && p != peerPort {
+				t.Fatalf("SSRC %d moved from port %d to %d", r.rtp.SSRC, p, peerPort)
+			}
+			ports[r.rtp.SSRC] = peerPort
+		}
+		if len(ports) != 2 || ports[1111] == ports[2222] {
+			t.Fatalf("SSRCs on ports %v, want one each", ports)
+		}
+		if r := records[2].rtp; r.SequenceNumber != 2 || len(r.Payload) != 100 || r.Payload[99] != 0xab {
+			t.Fatalf("third packet %+v", r.Header)
+		}
+	}
+}
+
+func TestRTPDump(t *testing.T) {
+	start := time.Now()
+	data, stats := capture(t, Options{Format: FormatRTPDump, Duration: time.Minute, MaxBytes: 1 << 20},
+		rtpPacket(1111, 7, 20), rtpPacket(1111, 8, 30))
+	line, rest, ok := bytes.Cut(data, []byte("\n"))
+	if !ok || string(line) != "#!rtpplay1.0 10.0.0.2/5004" || len(rest) < rtpdumpHdrLen {
+		t.Fatalf("rtpdump starts %q", data[:min(len(data), 40)])
+	}
+	if sec := int64(binary.BigEndian.Uint32(rest)); sec < start.Unix()-1 || sec > start.Unix()+1 {
+		t.Fatalf("start time %d, want about %d", sec, start.Unix())
+	}
+	if !bytes.Equal(rest[8:12], participantAddr[:]) {
+		t.Fatalf("source %v", rest[8:12])
+	}
+	rest = rest[rtpdumpHdrLen:]
+	var seqs []uint16
+	for len(rest) > 0 {
+		length, plen := int(binary.BigEndian.Uint16(rest)), int(binary.BigEndian.Uint16(rest[2:]))
+		if length != plen+rtpdumpPktHdr || len(rest) < length {
+			t.Fatalf("record length %d for %d bytes of RTP, %d left", length, plen, len(rest))
+		}
+		var pkt rtp.Packet
+		if err := pkt.Unmarshal(rest[rtpdumpPktHdr:length]); err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, pkt.SequenceNumber)
+		rest = rest[length:]
+	}
+	if len(seqs) != 2 || seqs[0] != 7 || seqs[1] != 8 || stats.Bytes != int64(len(data)) {
+		t.Fatalf("sequence numbers %v, stats %+v", seqs, stats)
+	}
+}
+
+func TestCaptureLimits(t *testing.T) {
+	// The byte cap stops the capture without exceeding it
+	const maxBytes = 24 + 3*(16+20+8+12+100)
+	pkts := make([]*rtp.Packet, 10)
+	for i := range pkts {
+		pkts[i] = rtpPacket(1, uint16(i), 100)
+	}
+	data, stats := capture(t, Options{Format: FormatPcap, Duration: time.Minute, MaxBytes: maxBytes}, pkts...)
+	if len(data) != maxBytes || stats.Packets != 3 || stats.StopReason != StopMaxBytes || stats.StoppedAt == nil {
+		t.Fatalf("%d bytes written, stats %+v", len(data), stats)
+	}
+	if len(parsePcap(t, data)) != 3 {
+		t.Fatal("the capped file does not parse")
+	}
+
+	// The duration stops it on its own
+	path := filepath.Join(t.TempDir(), "d.pcap")
+	c, err := Start(path, Options{Format: FormatPcap, Duration: 50 * time.Millisecond, MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("capture outlived its duration")
+	}
+	c.Write(rtpPacket(1, 1, 10))
+	if s := c.Stats(); s.StopReason != StopDuration || s.Packets != 0 || s.Bytes != 24 {
+		t.Fatalf("stats after the duration %+v", s)
+	}
+	c.Stop(StopRequested)
+	if c.Stats().StopReason != StopDuration {
+		t.Fatal("a later stop replaced the reason")
+	}
+
+	// Captures need bounds, and never overwrite a file
+	if _, err := Start(filepath.Join(t.TempDir(), "x.pcap"), Options{Duration: time.Second}); err == nil {
+		t.Fatal("started without a byte cap")
+	}
+	if _, err := Start(path, Options{Duration: time.Second, MaxBytes: 1}); err == nil {
+		t.Fatal("overwrote an existing capture")
+	}
+}
+
+func TestWriteDoesNotBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "q.pcap")
+	c, err := Start(path, Options{Format: FormatPcap, Duration: time.Minute, MaxBytes: 1 << 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { c.Stop(StopRequested); <-c.Done() }()
+
+	// Many times the queue is written faster than the file; what the
+	// writer misses is counted, never waited for
+	const n = 20 * queueSize
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		c.Write(rtpPacket(1, uint16(i), 1000))
+	}
+	elapsed := time.Since(start)
+	deadline := time.Now().Add(5 * time.Second)
+	for s := c.Stats(); s.Packets+s.Dropped < n; s = c.Stats() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d written and %d dropped of %d", s.Packets, s.Dropped, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Logf("%d writes in %v, %d dropped", n, elapsed, c.Stats().Dropped)
+}
+
+func TestWriteCountsDropsWhenFull(t *testing.T) {
+	// No writer drains this one, so its queue fills and stays full
+	c := &Capture{packets: make(chan packet, 2)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			c.Write(rtpPacket(1, uint16(i), 100))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write blocked on a full queue")
+	}
+	if s := c.Stats(); len(c.packets) != 2 || s.Dropped != 3 {
+		t.Fatalf("%d queued and %d dropped of 5", len(c.packets), s.Dropped)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"": FormatPcap, "pcap": FormatPcap, "rtpdump": FormatRTPDump} {
+		if got, ok := ParseFormat(in); !ok || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v", in, got, ok)
+		}
+	}
+	if _, ok := ParseFormat("pcapng"); ok {
+		t.Error("pcapng accepted")
+	}
+}
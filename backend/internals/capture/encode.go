@@ -0,0 +1,140 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Captured packets are attributed to fixed private addresses: the
+// participant on one side and the SFU on the other.
+var (
+	participantAddr = [4]byte{10, 0, 0, 1}
+	sfuAddr         = [4]byte{10, 0, 0, 2}
+)
+
+const (
+	sfuPort        = 5004
+	firstPeerPort  = 10000
+	pcapSnapLen    = 65535
+	linkTypeRaw    = 101 // LINKTYPE_RAW: records start with the IP header
+	ipv4HeaderLen  = 20
+	udpHeaderLen   = 8
+	rtpdumpHdrLen  = 16
+	rtpdumpPktHdr  = 8
+	ipProtocolUDP  = 17
+	defaultIPv4TTL = 64
+)
+
+type encoder interface {
+	header(start time.Time) []byte
+	record(at time.Time, rtp []byte) []byte
+}
+
+// pcapEncoder wraps packets in IPv4/UDP headers. Each SSRC gets its own
+// participant-side port, so streams are told apart like separate flows.
+type pcapEncoder struct {
+	outbound bool
+	ports    map[uint32]uint16 // SSRC -> port
+}
+
+func (e *pcapEncoder) header(time.Time) []byte {
+	b := make([]byte, 24)
+	binary.LittleEndian.PutUint32(b[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(b[4:], 2)
+	binary.LittleEndian.PutUint16(b[6:], 4)
+	binary.LittleEndian.PutUint32(b[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(b[20:], linkTypeRaw)
+	return b
+}
+
+func (e *pcapEncoder) port(rtp []byte) uint16 {
+	var ssrc uint32
+	if len(rtp) >= 12 {
+		ssrc = binary.BigEndian.Uint32(rtp[8:12])
+	}
+	p, ok := e.ports[ssrc]
+	if !ok {
+		p = uint16(firstPeerPort + 2*len(e.ports))
+		e.ports[ssrc] = p
+	}
+	return p
+}
+
+func (e *pcapEncoder) record(at time.Time, rtp []byte) []byte {
+	ipLen := ipv4HeaderLen + udpHeaderLen + len(rtp)
+	b := make([]byte, 16+ipLen)
+	binary.LittleEndian.PutUint32(b[0:], uint32(at.Unix()))
+	binary.LittleEndian.PutUint32(b[4:], uint32(at.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(b[8:], uint32(ipLen))
+	binary.LittleEndian.PutUint32(b[12:], uint32(ipLen))
+
+	src, dst := participantAddr, sfuAddr
+	srcPort, dstPort := e.port(rtp), uint16(sfuPort)
+	if e.outbound {
+		src, dst = dst, src
+		srcPort, dstPort = dstPort, srcPort
+	}
+
+	ip := b[16:]
+	ip[0] = 0x45 // version 4, 5 words
+	binary.BigEndian.PutUint16(ip[2:], uint16(ipLen))
+	ip[8] = defaultIPv4TTL
+	ip[9] = ipProtocolUDP
+	copy(ip[12:16], src[:])
+	copy(ip[16:20], dst[:])
+	binary.BigEndian.PutUint16(ip[10:], ipv4Checksum(ip[:ipv4HeaderLen]))
+
+	udp := ip[ipv4HeaderLen:]
+	binary.BigEndian.PutUint16(udp[0:], srcPort)
+	binary.BigEndian.PutUint16(udp[2:], dstPort)
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpHeaderLen+len(rtp)))
+	// A zero UDP checksum means none over IPv4
+	copy(udp[udpHeaderLen:], rtp)
+	return b
+}
+
+func ipv4Checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+// rtpdumpEncoder writes the rtptools rtpdump format: a text line naming the
+// destination, a binary file header and each packet behind its length and
+// its offset from the start in milliseconds.
+type rtpdumpEncoder struct {
+	outbound bool
+	start    time.Time
+}
+
+func (e *rtpdumpEncoder) header(start time.Time) []byte {
+	e.start = start
+	src, dst := participantAddr, sfuAddr
+	if e.outbound {
+		src, dst = dst, src
+	}
+	line := fmt.Sprintf("#!rtpplay1.0 %d.%d.%d.%d/%d\n", dst[0], dst[1], dst[2], dst[3], sfuPort)
+	b := make([]byte, len(line)+rtpdumpHdrLen)
+	copy(b, line)
+	hdr := b[len(line):]
+	binary.BigEndian.PutUint32(hdr[0:], uint32(start.Unix()))
+	binary.BigEndian.PutUint32(hdr[4:], uint32(start.Nanosecond()/1000))
+	copy(hdr[8:12], src[:])
+	binary.BigEndian.PutUint16(hdr[12:], sfuPort)
+	return b
+}
+
+func (e *rtpdumpEncoder) record(at time.Time, rtp []byte) []byte {
+	b := make([]byte, rtpdumpPktHdr+len(rtp))
+	binary.BigEndian.PutUint16(b[0:], uint16(len(b)))
+	binary.BigEndian.PutUint16(b[2:], uint16(len(rtp)))
+	binary.BigEndian.PutUint32(b[4:], uint32(at.Sub(e.start).Milliseconds()))
+	copy(b[rtpdumpPktHdr:], rtp)
+	return b
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CodecConfig is one codec of the media engine, set through SFU_CODECS as a
+// JSON array. When any are configured they replace the default codecs.
+type CodecConfig struct {
+	MimeType    string `json:"mimeType" yaml:"mime_type"`
+	ClockRate   uint32 `json:"clockRate" yaml:"clock_rate"`
+	Channels    uint16 `json:"channels,omitempty" yaml:"channels"`
+	Fmtp        string `json:"fmtp,omitempty" yaml:"fmtp"`
+	// Required; a pointer so an omitted one is not taken for PCMU's 0
+	PayloadType *uint8 `json:"payloadType" yaml:"payload_type"`
+	// Each "type" or "type parameter", e.g. "nack pli"
+	RTCPFeedback []string `json:"rtcpFeedback,omitempty" yaml:"rtcp_feedback"`
+}
+
+// knownCodecs are the MIME types a configured codec may have, in their
+// canonical spelling.
+var knownCodecs = []string{
+	"video/VP8", "video/VP9", "video/H264", "video/H265", "video/AV1",
+	"video/rtx", "video/ulpfec", "video/red",
+	"audio/opus", "audio/G722", "audio/PCMU", "audio/PCMA",
+	"audio/telephone-event", "audio/red",
+}
+
+// canonicalCodec returns the canonical spelling of mimeType, or "" if it is
+// not a known codec.
+func canonicalCodec(mimeType string) string {
+	for _, known := range knownCodecs {
+		if strings.EqualFold(known, mimeType) {
+			return known
+		}
+	}
+	return ""
+}
+
+// Kind returns "audio" or "video".
+func (c CodecConfig) Kind() string {
+	kind, _, _ := strings.Cut(c.MimeType, "/")
+	return kind
+}
+
+// Media reports whether the codec carries media of its own rather than
+// retransmissions, redundancy or events.
+func (c CodecConfig) Media() bool {
+	switch strings.ToLower(c.MimeType) {
+	case "video/rtx", "video/ulpfec", "video/red", "audio/red", "audio/telephone-event":
+		return false
+	}
+	return true
+}
+
+// codecsFromEnv reads SFU_CODECS. An error is kept for Validate, so a bad
+// list fails startup rather than falling back to the defaults.
+func codecsFromEnv() ([]CodecConfig, error) {
+	raw := getEnv("SFU_CODECS", "")
+	if raw == "" {
+		return nil, nil
+	}
+	var codecs []CodecConfig
+	if err := json.Unmarshal([]byte(raw), &codecs); err != nil {
+		return nil, fmt.Errorf("SFU_CODECS: %w", err)
+	}
+	return codecs, nil
+}
+
+// validateCodecs checks the configured codecs and puts their MIME types in
+// canonical spelling.
+func validateCodecs(codecs []CodecConfig) error {
+	byPayloadType := make(map[uint8]int, len(codecs))
+	for i := range codecs {
+		c := &codecs[i]
+		name := fmt.Sprintf("codec %d (%s)", i, c.MimeType)
+
+		canonical := canonicalCodec(c.MimeType)
+		if canonical == "" {
+			return fmt.Errorf("%s: unknown mime type, must be one of %s", name, strings.Join(knownCodecs, ", "))
+		}
+		c.MimeType = canonical
+		if c.ClockRate == 0 {
+			return fmt.Errorf("%s: clockRate is required", name)
+		}
+		if c.PayloadType == nil {
+			return fmt.Errorf("%s: payloadType is required", name)
+		}
+		pt := *c.PayloadType
+		if pt > 127 {
+			return fmt.Errorf("%s: payloadType %d is out of range 0-127", name, pt)
+		}
+		if j, taken := byPayloadType[pt]; taken {
+			return fmt.Errorf("%s: payloadType %d is already assigned to codec %d (%s)",
+				name, pt, j, codecs[j].MimeType)
+		}
+		byPayloadType[pt] = i
+		for _, fb := range c.RTCPFeedback {
+			if strings.TrimSpace(fb) == "" {
+				return fmt.Errorf("%s: empty rtcpFeedback entry", name)
+			}
+		}
+		if err := validateFmtp(*c); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	// A retransmission codec names the codec it repairs in apt
+	for i, c := range codecs {
+		if c.MimeType != "video/rtx" {
+			continue
+		}
+		name := fmt.Sprintf("codec %d (%s)", i, c.MimeType)
+		apt, ok := fmtpParam(c.Fmtp, "apt")
+		if !ok {
+			return fmt.Errorf("%s: fmtp must name the repaired payload type as apt=<payloadType>", name)
+		}
+		pt, err := strconv.Atoi(apt)
+		if err != nil {
+			return fmt.Errorf("%s: invalid apt %q", name, apt)
+		}
+		j, ok := byPayloadType[uint8(pt)]
+		if pt < 0 || pt > 127 || !ok || !codecs[j].Media() || codecs[j].Kind() != "video" {
+			return fmt.Errorf("%s: apt=%d is not the payload type of a configured video codec", name, pt)
+		}
+	}
+
+	for _, c := range codecs {
+		if c.Media() {
+			return nil
+		}
+	}
+	return errors.New("no audio or video codec configured")
+}
+
+// h264Profiles and h264Levels are the profile_idc and level_idc values an
+// H264 profile-level-id may carry (RFC 6184 section 8.1).
+var (
+	h264Profiles = map[uint64]bool{0x42: true, 0x4d: true, 0x58: true, 0x64: true, 0x6e: true, 0x7a: true, 0xf4: true}
+	h264Levels   = map[uint64]bool{
+		9: true, 10: true, 11: true, 12: true, 13: true, 20: true, 21: true, 22: true,
+		30: true, 31: true, 32: true, 40: true, 41: true, 42: true, 50: true, 51: true, 52: true,
+	}
+)
+
+// validateFmtp checks the fmtp parameters media engines match H264 and VP9
+// codecs by. H264 must name its profile-level-id.
+func validateFmtp(c CodecConfig) error {
+	switch c.MimeType {
+	case "video/H264":
+		plid, ok := fmtpParam(c.Fmtp, "profile-level-id")
+		if !ok {
+			return errors.New("fmtp must give the profile-level-id")
+		}
+		v, err := strconv.ParseUint(plid, 16, 32)
+		if err != nil || len(plid) != 6 || !h264Profiles[v>>16] || !h264Levels[v&0xff] {
+			return fmt.Errorf("invalid profile-level-id %q, want 6 hex digits of a known profile and level", plid)
+		}
+		if mode, ok := fmtpParam(c.Fmtp, "packetization-mode"); ok && mode != "0" && mode != "1" {
+			return fmt.Errorf("invalid packetization-mode %q, want 0 or 1", mode)
+		}
+	case "video/VP9":
+		if id, ok := fmtpParam(c.Fmtp, "profile-id"); ok {
+			if n, err := strconv.Atoi(id); err != nil || n < 0 || n > 3 {
+				return fmt.Errorf("invalid profile-id %q, want 0 to 3", id)
+			}
+		}
+	}
+	return nil
+}
+
+// fmtpParam returns the value of key in an fmtp line.
+func fmtpParam(fmtp, key string) (string, bool) {
+	for _, param := range strings.Split(fmtp, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok && strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
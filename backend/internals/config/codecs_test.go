@@ -0,0 +1,93 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// h264Codecs is the README's list: H264 with its retransmissions, and Opus.
+const h264Codecs = `[
+	{"mimeType": "video/h264", "clockRate": 90000, "payloadType": 102,
+	 "fmtp": "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+	 "rtcpFeedback": ["goog-remb", "ccm fir", "nack", "nack pli"]},
+	{"mimeType": "video/rtx", "clockRate": 90000, "payloadType": 103, "fmtp": "apt=102"},
+	{"mimeType": "audio/opus", "clockRate": 48000, "channels": 2, "payloadType": 111,
+	 "fmtp": "minptime=10;useinbandfec=1;stereo=1;maxaveragebitrate=128000"}
+]`
+
+func TestValidateCodecs(t *testing.T) {
+	var codecs []CodecConfig
+	if err := json.Unmarshal([]byte(h264Codecs), &codecs); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateCodecs(codecs); err != nil {
+		t.Fatal(err)
+	}
+	if codecs[0].MimeType != "video/H264" {
+		t.Fatalf("MIME type kept as %q", codecs[0].MimeType)
+	}
+
+	for _, tc := range []struct {
+		name, codecs, want string
+	}{
+		{"no payload type", `[{"mimeType": "audio/opus", "clockRate": 48000}]`, "payloadType is required"},
+		{"payload type 0", `[{"mimeType": "audio/PCMU", "clockRate": 8000, "payloadType": 0}]`, ""},
+		{"payload type out of range", `[{"mimeType": "audio/opus", "clockRate": 48000, "payloadType": 128}]`, "out of range"},
+		{"payload type twice", `[{"mimeType": "audio/opus", "clockRate": 48000, "payloadType": 111},
+			{"mimeType": "audio/G722", "clockRate": 8000, "payloadType": 111}]`, "already assigned to codec 0"},
+		{"unknown codec", `[{"mimeType": "video/MPV", "clockRate": 90000, "payloadType": 96}]`, "unknown mime type"},
+		{"no clock rate", `[{"mimeType": "video/VP8", "payloadType": 96}]`, "clockRate is required"},
+		{"H264 without profile", `[{"mimeType": "video/H264", "clockRate": 90000, "payloadType": 102, "fmtp": "packetization-mode=1"}]`, "profile-level-id"},
+		{"H264 profile too short", `[{"mimeType": "video/H264", "clockRate": 90000, "payloadType": 102, "fmtp": "profile-level-id=42e0"}]`, "invalid profile-level-id"},
+		{"H264 profile not hex", `[{"mimeType": "video/H264", "clockRate": 90000, "payloadType": 102, "fmtp": "profile-level-id=zze01f"}]`, "invalid profile-level-id"},
+		{"H264 unknown profile", `[{"mimeType": "video/H264", "clockRate": 90000, "payloadType": 102, "fmtp": "profile-level-id=43e01f"}]`, "invalid profile-level-id"},
+		{"H264 unknown level", `[{"mimeType": "video/H264", "clockRate": 90000, "payloadType": 102, "fmtp": "profile-level-id=42e0ff"}]`, "invalid profile-level-id"},
+		{"H264 high profile", `[{"mimeType": "video/H264", "clockRate": 90000, "payloadType": 102, "fmtp": "profile-level-id=640032;packetization-mode=0"}]`, ""},
+		{"H264 interleaved", `[{"mimeType": "video/H264", "clockRate": 90000, "payloadType": 102, "fmtp": "profile-level-id=42e01f;packetization-mode=2"}]`, "packetization-mode"},
+		{"VP9 profile", `[{"mimeType": "video/VP9", "clockRate": 90000, "payloadType": 98, "fmtp": "profile-id=2"}]`, ""},
+		{"VP9 unknown profile", `[{"mimeType": "video/VP9", "clockRate": 90000, "payloadType": 98, "fmtp": "profile-id=4"}]`, "invalid profile-id"},
+		{"VP9 profile not a number", `[{"mimeType": "video/VP9", "clockRate": 90000, "payloadType": 98, "fmtp": "profile-id=high"}]`, "invalid profile-id"},
+		{"DTMF events", `[{"mimeType": "audio/opus", "clockRate": 48000, "payloadType": 111},
+			{"mimeType": "audio/telephone-event", "clockRate": 48000, "payloadType": 110, "fmtp": "0-15"}]`, ""},
+		{"rtx without apt", `[{"mimeType": "video/VP8", "clockRate": 90000, "payloadType": 96},
+			{"mimeType": "video/rtx", "clockRate": 90000, "payloadType": 97}]`, "apt=<payloadType>"},
+		{"rtx of audio", `[{"mimeType": "audio/opus", "clockRate": 48000, "payloadType": 111},
+			{"mimeType": "video/rtx", "clockRate": 90000, "payloadType": 97, "fmtp": "apt=111"}]`, "not the payload type of a configured video codec"},
+		{"repair only", `[{"mimeType": "video/red", "clockRate": 90000, "payloadType": 63}]`, "no audio or video codec"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var codecs []CodecConfig
+			if err := json.Unmarshal([]byte(tc.codecs), &codecs); err != nil {
+				t.Fatal(err)
+			}
+			err := validateCodecs(codecs)
+			switch {
+			case tc.want == "" && err != nil:
+				t.Fatalf("rejected: %v", err)
+			case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+				t.Fatalf("error %v, want one about %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestCodecsFromEnv(t *testing.T) {
+	t.Setenv("SFU_CODECS", h264Codecs)
+	if err := LoadConfig().Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A list that does not parse, or does not validate, fails startup
+	// rather than falling back to the defaults
+	for _, bad := range []string{
+		`[{"mimeType": "video/H264",`,
+		`[{"mimeType": "video/H264", "clockRate": 90000, "fmtp": "profile-level-id=42e01f"}]`,
+	} {
+		t.Setenv("SFU_CODECS", bad)
+		cfg := LoadConfig()
+		if err := cfg.Validate(); err == nil || !strings.HasPrefix(err.Error(), "SFU_CODECS: ") {
+			t.Fatalf("%s: error %v", bad, err)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,6 +15,10 @@ type Config struct {
 	Metrics MetricsConfig `yaml:"metrics"`
 	Logging LoggingConfig `yaml:"logging"`
 	Media   MediaConfig   `yaml:"media"`
+	Audit   AuditConfig   `yaml:"audit"`
+	Webhook WebhookConfig `yaml:"webhook"`
+	Capture CaptureConfig `yaml:"capture"`
+	Authz   AuthzConfig   `yaml:"authz"`
 }
 
 type ServerConfig struct {
@@ -24,6 +30,44 @@ type ServerConfig struct {
 	MaxPeersPerRoom int           `yaml:"max_peers_per_room"`
 	AllowedOrigins  []string      `yaml:"allowed_origins"`
 	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// Hidden observers per room, counted apart from MaxPeersPerRoom (0 = unlimited)
+	MaxObserversPerRoom int `yaml:"max_observers_per_room"`
+	// Required as X-API-Key or bearer token by admin-only endpoints such as
+	// /api/stats; empty leaves them open like the rest of the REST API
+	AdminKey string `yaml:"admin_key"`
+	// Bounds the Redis work done for a single signaling message
+	MessageTimeout time.Duration `yaml:"message_timeout"`
+	// Shutdown deadline announced when draining starts without one, and the
+	// instance URL clients are pointed at, if any
+	DrainTimeout      time.Duration `yaml:"drain_timeout"`
+	DrainAlternateURL string        `yaml:"drain_alternate_url"`
+	// Largest JSON body the REST API reads (0 = unlimited)
+	APIMaxBodyBytes int64 `yaml:"api_max_body_bytes"`
+	// Also send the snake_case field names the invite and audit responses
+	// used before schema version 2, for clients not yet moved to camelCase
+	LegacyFieldNames bool `yaml:"legacy_field_names"`
+	// Prefix every route is served under, e.g. /sfu behind a proxy that
+	// passes it on; empty serves them at the root
+	BasePath string `yaml:"base_path"`
+	// Routes of the signaling WebSocket and the probes, under BasePath
+	WSPath     string `yaml:"ws_path"`
+	HealthPath string `yaml:"health_path"`
+	ReadyPath  string `yaml:"ready_path"`
+	// Build the URLs given to clients from X-Forwarded-Proto and
+	// X-Forwarded-Host, and take client IPs from X-Forwarded-For; only
+	// safe behind a proxy that sets them
+	TrustProxyHeaders bool `yaml:"trust_proxy_headers"`
+	// Proxies in front of the instance that append to X-Forwarded-For;
+	// with TrustProxyHeaders the client IP is the entry the outermost one
+	// appended, this many from the right
+	TrustedProxyHops int `yaml:"trusted_proxy_hops"`
+	// Region the instance runs in; with one set, joins and room creations
+	// are routed between regions through the instance registry
+	Region string `yaml:"region"`
+	// Base URL clients reach this instance at, e.g.
+	// https://sfu-eu1.example.com/sfu, handed to clients sent here from
+	// another instance
+	AdvertiseURL string `yaml:"advertise_url"`
 }
 
 type WebRTCConfig struct {
@@ -31,6 +75,23 @@ type WebRTCConfig struct {
 	UDPPortRange PortRange   `yaml:"udp_port_range"`
 	TCPPortRange PortRange   `yaml:"tcp_port_range"`
 	PublicIP     string      `yaml:"public_ip"`
+
+	// Shared secret of the TURN servers' REST API authentication (coturn's
+	// static-auth-secret). When set, TURN credentials are minted per user
+	// and expire after TURNCredentialTTL instead of being shared.
+	TURNSecret        string        `yaml:"turn_secret,omitempty"`
+	TURNCredentialTTL time.Duration `yaml:"turn_credential_ttl"`
+
+	// Health checks of ICE servers (0 interval disables them)
+	ICEHealthInterval  time.Duration `yaml:"ice_health_interval"`
+	ICEHealthTimeout   time.Duration `yaml:"ice_health_timeout"`
+	ICEHealthDownAfter int           `yaml:"ice_health_down_after"`
+
+	// Marking of outbound media packets: a DSCP code point by name (EF,
+	// AF41, ...) or number, empty to send unmarked, and on Linux the
+	// sockets' SO_PRIORITY (0 leaves it alone)
+	DSCP           string `yaml:"dscp,omitempty"`
+	SocketPriority int    `yaml:"socket_priority"`
 }
 
 type ICEServer struct {
@@ -48,17 +109,106 @@ type RedisConfig struct {
 	Addr     string `yaml:"addr"`
 	Password string `yaml:"password"`
 	DB       int    `yaml:"db"`
+
+	// Refuse to start when Redis cannot be reached. Otherwise the instance
+	// runs without persistence and keeps retrying, backing off up to
+	// ReconnectMaxBackoff between attempts.
+	Required            bool          `yaml:"required"`
+	ReconnectMaxBackoff time.Duration `yaml:"reconnect_max_backoff"`
+
+	// Cluster room directory: each instance refreshes its rooms' summaries on
+	// this interval; entries expire after three missed heartbeats.
+	RoomHeartbeatInterval time.Duration `yaml:"room_heartbeat_interval"`
 }
 
 type MetricsConfig struct {
 	Enabled bool   `yaml:"enabled"`
 	Port    int    `yaml:"port"`
 	Path    string `yaml:"path"`
+	// Export the per-room gauges, sfu_room_peers and
+	// sfu_room_renegotiations_pending, labeled by room ID; off by default
+	// because every room adds time series.
+	RoomPeers bool `yaml:"room_peers"`
+	// Optional protection of the metrics path
+	Auth MetricsAuthConfig `yaml:"auth"`
+}
+
+// MetricsAuthConfig protects the metrics path with a bearer token and/or
+// basic auth; a scrape passes if it satisfies either. Both empty disables it.
+type MetricsAuthConfig struct {
+	BearerToken string `yaml:"bearer_token"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+}
+
+// AuditConfig controls the audit trail of administrative and moderation
+// actions, kept separate from the debug log.
+type AuditConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	FilePath       string `yaml:"file_path"`        // JSON lines; empty disables
+	RingSize       int    `yaml:"ring_size"`        // events kept for GET /api/audit
+	RedisStream    string `yaml:"redis_stream"`     // empty disables the stream sink
+	RedisStreamMax int64  `yaml:"redis_stream_max"` // approximate stream MAXLEN
+
+	// Call summaries are also written to Redis under
+	// CallSummaryPrefix<roomID>:<start unix ms> for CallSummaryTTL. An empty
+	// prefix leaves them in the audit trail only
+	CallSummaryPrefix string        `yaml:"call_summary_prefix"`
+	CallSummaryTTL    time.Duration `yaml:"call_summary_ttl"`
+}
+
+// WebhookConfig sends room events to an HTTP endpoint. With Durable they go
+// through a Redis Stream, StreamPrefix<instance ID>, so none are lost while
+// the endpoint or the instance is down.
+type WebhookConfig struct {
+	URL       string        `yaml:"url"` // empty disables webhooks
+	Secret    string        `yaml:"secret"`
+	Timeout   time.Duration `yaml:"timeout"`
+	QueueSize int           `yaml:"queue_size"`
+	RetryMax  time.Duration `yaml:"retry_max"`
+	// Attempts per event before it is given up on
+	MaxAttempts int `yaml:"max_attempts"`
+
+	Durable      bool   `yaml:"durable"`
+	StreamPrefix string `yaml:"stream_prefix"`
+	StreamMax    int64  `yaml:"stream_max"` // approximate stream MAXLEN
+}
+
+// CaptureConfig controls debug packet captures started through the admin
+// API. Captures are refused while Dir is empty.
+type CaptureConfig struct {
+	Dir         string        `yaml:"dir"`
+	MaxDuration time.Duration `yaml:"max_duration"` // also the default duration
+	MaxBytes    int64         `yaml:"max_bytes"`    // also the default size cap
+}
+
+// AuthzConfig selects the authorizer consulted on joins, publishes and
+// subscribes: "allow-all" (the default), "jwt" or "http".
+type AuthzConfig struct {
+	Mode string `yaml:"mode"`
+
+	// jwt: HS256 tokens signed with JWTSecret, with iss and aud checked if set
+	JWTSecret   string `yaml:"jwt_secret,omitempty"`
+	JWTIssuer   string `yaml:"jwt_issuer"`
+	JWTAudience string `yaml:"jwt_audience"`
+
+	// http: decisions POSTed to CallbackURL, with CallbackToken as a bearer
+	// token if set
+	CallbackURL      string        `yaml:"callback_url"`
+	CallbackToken    string        `yaml:"callback_token,omitempty"`
+	CallbackTimeout  time.Duration `yaml:"callback_timeout"`
+	CallbackRetries  int           `yaml:"callback_retries"`
+	CallbackFailOpen bool          `yaml:"callback_fail_open"`
+	CallbackCacheTTL time.Duration `yaml:"callback_cache_ttl"`
 }
 
 type LoggingConfig struct {
 	Level  string `yaml:"level"`
 	Format string `yaml:"format"`
+	// Entries of every level kept in memory for /debug/logs, and for how
+	// long; 0 entries disables it
+	RingSize   int           `yaml:"ring_size"`
+	RingWindow time.Duration `yaml:"ring_window"`
 }
 
 type MediaConfig struct {
@@ -73,26 +223,196 @@ type MediaConfig struct {
 	WSPongTimeout        time.Duration `yaml:"ws_pong_timeout"`
 	WSPingInterval       time.Duration `yaml:"ws_ping_interval"`
 	WSHubPingInterval    time.Duration `yaml:"ws_hub_ping_interval"`
-	RateLimitPerSec      float64       `yaml:"rate_limit_per_sec"`
-	RateLimitBurst       int           `yaml:"rate_limit_burst"`
+	// Connections that have not joined a room within WSJoinTimeout are
+	// closed (0 = never), and at most WSMaxUnjoined may wait (0 = no cap)
+	WSJoinTimeout time.Duration `yaml:"ws_join_timeout"`
+	WSMaxUnjoined int           `yaml:"ws_max_unjoined"`
+	// A connection silent for WSDrowsyAfter (0 = never) is marked drowsy
+	// and closed WSDrowsyGrace later unless it speaks again. WSDrowsyAfter
+	// should stay under the 60s pong timeout
+	WSDrowsyAfter time.Duration `yaml:"ws_drowsy_after"`
+	WSDrowsyGrace time.Duration `yaml:"ws_drowsy_grace"`
+	// Further rooms a connection may be in at once through memberships
+	// (0 = none)
+	WSMaxMemberships int `yaml:"ws_max_memberships"`
+	// Per-client signaling rate limits by message class (0 = unlimited).
+	// RateLimitPerSec and RateLimitBurst apply to media signaling
+	RateLimitPerSec        float64 `yaml:"rate_limit_per_sec"`
+	RateLimitBurst         int     `yaml:"rate_limit_burst"`
+	RateLimitControlPerSec float64 `yaml:"rate_limit_control_per_sec"`
+	RateLimitControlBurst  int     `yaml:"rate_limit_control_burst"`
+	RateLimitChattyPerSec  float64 `yaml:"rate_limit_chatty_per_sec"`
+	RateLimitChattyBurst   int     `yaml:"rate_limit_chatty_burst"`
+	// Rate limits shared by all instances through Redis, checked before the
+	// per-client ones: joins per user and per client IP, and room creations
+	// per client IP, each per DistRateLimitWindow (0 = unlimited). A key
+	// over its limit is refused locally for up to DistRateLimitNegativeCache
+	// without asking Redis again. While Redis fails, attempts are let
+	// through with DistRateLimitFailOpen and refused otherwise
+	DistRateLimitWindow        time.Duration `yaml:"dist_rate_limit_window"`
+	DistRateLimitJoinsPerUser  int           `yaml:"dist_rate_limit_joins_per_user"`
+	DistRateLimitJoinsPerIP    int           `yaml:"dist_rate_limit_joins_per_ip"`
+	DistRateLimitCreatesPerIP  int           `yaml:"dist_rate_limit_creates_per_ip"`
+	DistRateLimitNegativeCache time.Duration `yaml:"dist_rate_limit_negative_cache"`
+	DistRateLimitFailOpen      bool          `yaml:"dist_rate_limit_fail_open"`
 	MaxRoomIDLength      int           `yaml:"max_room_id_length"`
 	MaxUserIDLength      int           `yaml:"max_user_id_length"`
+	// Longest display name, in characters, accepted by update-name
+	MaxNameLength int `yaml:"max_name_length"`
 
-	// Simulcast
-	SimulcastEnabled bool `yaml:"simulcast_enabled"`
+	// Simulcast. Publishers are told they may pause a layer no subscriber
+	// has used for SimulcastLayerIdleWindow; 0 disables this
+	SimulcastEnabled         bool          `yaml:"simulcast_enabled"`
+	SimulcastLayerIdleWindow time.Duration `yaml:"simulcast_layer_idle_window"`
+	// Accept Safari/WebKit publishers: extra H264 profiles, defaulted H264
+	// fmtp parameters and, with simulcast, SSRC-group simulcast
+	WebKitCompat bool `yaml:"webkit_compat"`
+	// Codecs, when set, fully define the media engine in place of the
+	// defaults and WebKit's extra profiles, and the codecs rooms accept
+	Codecs    []CodecConfig `yaml:"codecs"`
+	codecsErr error
 
 	// Dominant speaker detection
 	SpeakerDetectionInterval time.Duration `yaml:"speaker_detection_interval"`
+	// Audio activity score above which a peer counts as speaking, for both
+	// dominant speaker selection and talk time
+	SpeakerActivityThreshold float64 `yaml:"speaker_activity_threshold"`
+
+	// Stats. RoomQualityEvents sends moderators a room-quality summary
+	// whenever the number of participants at a quality level changes.
+	StatsInterval     time.Duration `yaml:"stats_interval"`
+	RoomQualityEvents bool          `yaml:"room_quality_events"`
+
+	// Tracks with at least ParallelFanOutThreshold subscribers (0 = never)
+	// clone and dispatch packets on ParallelFanOutShards workers
+	// (0 = GOMAXPROCS) instead of one
+	ParallelFanOutThreshold int `yaml:"parallel_fan_out_threshold"`
+	ParallelFanOutShards    int `yaml:"parallel_fan_out_shards"`
+	// A joining peer's existing tracks are attached on JoinAttachWorkers
+	// goroutines; those not started within JoinAttachTimeout (0 = no limit)
+	// follow the answer in a renegotiation
+	JoinAttachWorkers int           `yaml:"join_attach_workers"`
+	JoinAttachTimeout time.Duration `yaml:"join_attach_timeout"`
 
-	// Stats
-	StatsInterval time.Duration `yaml:"stats_interval"`
+	// Hard cap on a publisher's inbound bitrate over all its tracks
+	// (0 = off). Over the cap for BitratePolicingDelay, the publisher is
+	// policed; still over BitratePolicingRemoveAfter later, its busiest
+	// track is removed (0 = never).
+	PublisherMaxBitrateKbps    int           `yaml:"publisher_max_bitrate_kbps"`
+	BitratePolicingDelay       time.Duration `yaml:"bitrate_policing_delay"`
+	BitratePolicingRemoveAfter time.Duration `yaml:"bitrate_policing_remove_after"`
+
+	// Broadcast rooms: the share of viewers whose quality stats are
+	// reported, unless a room sets its own, and how often viewer counts
+	// are sent in place of individual peer-joined/peer-left events
+	BroadcastViewerStatsPercent int           `yaml:"broadcast_viewer_stats_percent"`
+	BroadcastCountInterval      time.Duration `yaml:"broadcast_count_interval"`
 
 	// Session management
 	SessionTTL    time.Duration `yaml:"session_ttl"`
 	AutoSubscribe bool          `yaml:"auto_subscribe"`
+
+	// How long a peer whose media connection dropped is kept before removal;
+	// clamped to SessionTTL. HoldTracksDuringGrace also holds failed connections
+	PeerDisconnectGrace   time.Duration `yaml:"peer_disconnect_grace"`
+	HoldTracksDuringGrace bool          `yaml:"hold_tracks_during_grace"`
+	// ICE restarts per peer, client- or server-initiated: at most
+	// ICERestartMax per ICERestartWindow (0 = unlimited), waiting a cooldown
+	// after each that doubles up to ICERestartMaxCooldown until one recovers
+	ICERestartMax         int           `yaml:"ice_restart_max"`
+	ICERestartWindow      time.Duration `yaml:"ice_restart_window"`
+	ICERestartCooldown    time.Duration `yaml:"ice_restart_cooldown"`
+	ICERestartMaxCooldown time.Duration `yaml:"ice_restart_max_cooldown"`
+	// Rooms whose peers have all been disconnected this long go dormant
+	// until one is back (0 = never)
+	DormantRoomAfter time.Duration `yaml:"dormant_room_after"`
+	// Other peers are told a peer's media connection dropped once it has
+	// been down this long (0 = at once)
+	ConnectionStateDebounce time.Duration `yaml:"connection_state_debounce"`
+
+	// Track admission control (0 = unlimited)
+	MaxTracksPerRoom     int `yaml:"max_tracks_per_room"`
+	MaxTracksPerInstance int `yaml:"max_tracks_per_instance"`
+	// Expected tracks per joining peer used to reject joins up front; 0 disables
+	JoinTrackProjection int `yaml:"join_track_projection"`
+
+	// Invite links
+	InviteDefaultTTL time.Duration `yaml:"invite_default_ttl"`
+	InviteMaxTTL     time.Duration `yaml:"invite_max_ttl"`
+
+	// Join admission queue (0 = unlimited concurrent joins)
+	MaxConcurrentJoins        int           `yaml:"max_concurrent_joins"`
+	MaxConcurrentJoinsPerRoom int           `yaml:"max_concurrent_joins_per_room"`
+	JoinQueueSize             int           `yaml:"join_queue_size"`
+	JoinQueueTimeout          time.Duration `yaml:"join_queue_timeout"`
+	JoinRetryAfter            time.Duration `yaml:"join_retry_after"`
+
+	// Minimum spacing between client keyframe requests for the same track
+	KeyframeRequestInterval time.Duration `yaml:"keyframe_request_interval"`
+
+	// One packet in LatencySampleEvery of each track is timed through the
+	// SFU and, with abs-send-time, from its publisher (0 = off)
+	LatencySampleEvery int `yaml:"latency_sample_every"`
+
+	// Data channel broadcasts: messages retained for late joiners, and the
+	// per-peer queue used until a peer's channel opens
+	DataChannelHistorySize int           `yaml:"data_channel_history_size"`
+	DataChannelQueueSize   int           `yaml:"data_channel_queue_size"`
+	DataChannelQueueTTL    time.Duration `yaml:"data_channel_queue_ttl"`
+
+	// How long to wait for ICE gathering before answering a client that
+	// cannot trickle; whatever was gathered by then is sent
+	NonTrickleGatherTimeout time.Duration `yaml:"non_trickle_gather_timeout"`
+
+	// How long a negotiated incoming track may go without its first packet
+	// before the publisher is told it is stalled; 0 disables the check
+	TrackStallTimeout time.Duration `yaml:"track_stall_timeout"`
+
+	// Longest a push-to-talk unmute lasts in rooms that don't set their own
+	PushToTalkMaxDuration time.Duration `yaml:"push_to_talk_max_duration"`
+
+	// A peer media is forwarded to that sends no receiver reports, publishes
+	// nothing and is silent on signaling for IdlePeerTimeout is warned, then
+	// disconnected after IdlePeerGrace; a zero timeout disables reaping
+	IdlePeerTimeout time.Duration `yaml:"idle_peer_timeout"`
+	IdlePeerGrace   time.Duration `yaml:"idle_peer_grace"`
+
+	// Remaining times at which a room created with a maximum duration warns
+	// its participants
+	RoomTimeWarnings []time.Duration `yaml:"room_time_warnings"`
+
+	// Direct connections between the two participants of a room: whether
+	// rooms created by a join allow them, and the limits on the signaling
+	// the SFU relays between the two
+	P2PAllowed         bool `yaml:"p2p_allowed"`
+	P2PRelayMaxBytes   int  `yaml:"p2p_relay_max_bytes"`
+	P2PRelayRatePerSec int  `yaml:"p2p_relay_rate_per_sec"`
+
+	// Whether rooms keep a reconnecting participant's peer ID by default;
+	// rooms may override it in their settings
+	StablePeerIDs bool `yaml:"stable_peer_ids"`
+
+	// Whether rooms let a publisher monitor one of its own tracks by
+	// default; rooms may override it in their settings
+	SelfMonitor bool `yaml:"self_monitor"`
+
+	// Targeted relays between participants: the largest data a relay
+	// message may carry and the most peers it may name
+	RelayMaxBytes   int `yaml:"relay_max_bytes"`
+	RelayMaxTargets int `yaml:"relay_max_targets"`
+
+	// Live room streams: the most a room may have open at once, and how
+	// often an idle stream gets a heartbeat comment
+	LiveMaxConsumers      int           `yaml:"live_max_consumers"`
+	LiveHeartbeatInterval time.Duration `yaml:"live_heartbeat_interval"`
+
+	// Debugging: cross-check each room's peer, user and track maps after
+	// every join and leave and log any disagreement
+	CheckRoomConsistency bool `yaml:"check_room_consistency"`
 }
 
 func LoadConfig() *Config {
+	codecs, codecsErr := codecsFromEnv()
 	return &Config{
 		Server: ServerConfig{
 			Host:            getEnv("SFU_HOST", "0.0.0.0"),
@@ -103,28 +423,103 @@ func LoadConfig() *Config {
 			MaxPeersPerRoom: getEnvInt("SFU_MAX_PEERS_PER_ROOM", 100),
 			AllowedOrigins:  []string{"*"},
 			ShutdownTimeout: time.Duration(getEnvInt("SFU_SHUTDOWN_TIMEOUT", 10)) * time.Second,
+
+			MaxObserversPerRoom: getEnvInt("SFU_MAX_OBSERVERS_PER_ROOM", 10),
+			AdminKey:            getEnv("SFU_ADMIN_KEY", ""),
+			MessageTimeout:      time.Duration(getEnvInt("SFU_MESSAGE_TIMEOUT", 5)) * time.Second,
+			DrainTimeout:        time.Duration(getEnvInt("SFU_DRAIN_TIMEOUT_SEC", 300)) * time.Second,
+			DrainAlternateURL:   getEnv("SFU_DRAIN_ALTERNATE_URL", ""),
+			APIMaxBodyBytes:     int64(getEnvInt("SFU_API_MAX_BODY_BYTES", 1<<20)),
+			LegacyFieldNames:    getEnvBool("SFU_API_LEGACY_FIELD_NAMES", true),
+			BasePath:            getEnv("SFU_BASE_PATH", ""),
+			WSPath:              getEnv("SFU_WS_PATH", "/ws"),
+			HealthPath:          getEnv("SFU_HEALTH_PATH", "/health"),
+			ReadyPath:           getEnv("SFU_READY_PATH", "/ready"),
+			TrustProxyHeaders:   getEnvBool("SFU_TRUST_PROXY_HEADERS", false),
+			TrustedProxyHops:    getEnvInt("SFU_TRUSTED_PROXY_HOPS", 1),
+			Region:              getEnv("SFU_REGION", ""),
+			AdvertiseURL:        getEnv("SFU_ADVERTISE_URL", ""),
 		},
 		WebRTC: WebRTCConfig{
-			ICEServers: []ICEServer{
-				{URLs: []string{"stun:stun.l.google.com:19302"}},
-			},
+			ICEServers:   iceServersFromEnv(),
 			UDPPortRange: PortRange{Min: 10000, Max: 20000},
 			TCPPortRange: PortRange{Min: 20001, Max: 30000},
 			PublicIP:     getEnv("SFU_PUBLIC_IP", ""),
+
+			TURNSecret:        getEnv("SFU_TURN_SECRET", ""),
+			TURNCredentialTTL: time.Duration(getEnvInt("SFU_TURN_CREDENTIAL_TTL_SEC", 86400)) * time.Second,
+
+			ICEHealthInterval:  time.Duration(getEnvInt("SFU_ICE_HEALTH_INTERVAL_SEC", 30)) * time.Second,
+			ICEHealthTimeout:   time.Duration(getEnvInt("SFU_ICE_HEALTH_TIMEOUT_MS", 2000)) * time.Millisecond,
+			ICEHealthDownAfter: getEnvInt("SFU_ICE_HEALTH_DOWN_AFTER", 2),
+
+			DSCP:           getEnv("SFU_DSCP", ""),
+			SocketPriority: getEnvInt("SFU_SOCKET_PRIORITY", 0),
 		},
 		Redis: RedisConfig{
 			Addr:     getEnv("REDIS_ADDR", "localhost:6379"),
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       getEnvInt("REDIS_DB", 0),
+
+			Required:            getEnvBool("REDIS_REQUIRED", false),
+			ReconnectMaxBackoff: time.Duration(getEnvInt("REDIS_RECONNECT_MAX_BACKOFF_SEC", 60)) * time.Second,
+
+			RoomHeartbeatInterval: time.Duration(getEnvInt("SFU_ROOM_HEARTBEAT_INTERVAL_SEC", 10)) * time.Second,
 		},
 		Metrics: MetricsConfig{
 			Enabled: getEnvBool("METRICS_ENABLED", true),
 			Port:    getEnvInt("METRICS_PORT", 9090),
 			Path:    getEnv("METRICS_PATH", "/metrics"),
+
+			RoomPeers: getEnvBool("METRICS_ROOM_PEERS", false),
+			Auth: MetricsAuthConfig{
+				BearerToken: getEnv("METRICS_AUTH_TOKEN", ""),
+				Username:    getEnv("METRICS_AUTH_USERNAME", ""),
+				Password:    getEnv("METRICS_AUTH_PASSWORD", ""),
+			},
 		},
 		Logging: LoggingConfig{
-			Level:  getEnv("LOG_LEVEL", "info"),
-			Format: getEnv("LOG_FORMAT", "json"),
+			Level:      getEnv("LOG_LEVEL", "info"),
+			Format:     getEnv("LOG_FORMAT", "json"),
+			RingSize:   getEnvInt("LOG_RING_SIZE", 20000),
+			RingWindow: time.Duration(getEnvInt("LOG_RING_WINDOW_SEC", 120)) * time.Second,
+		},
+		Audit: AuditConfig{
+			Enabled:           getEnvBool("SFU_AUDIT_ENABLED", true),
+			FilePath:          getEnv("SFU_AUDIT_FILE", ""),
+			RingSize:          getEnvInt("SFU_AUDIT_RING_SIZE", 1000),
+			RedisStream:       getEnv("SFU_AUDIT_REDIS_STREAM", ""),
+			RedisStreamMax:    int64(getEnvInt("SFU_AUDIT_REDIS_STREAM_MAX", 100000)),
+			CallSummaryPrefix: getEnv("SFU_CALL_SUMMARY_PREFIX", ""),
+			CallSummaryTTL:    time.Duration(getEnvInt("SFU_CALL_SUMMARY_TTL_SEC", 7*24*3600)) * time.Second,
+		},
+		Webhook: WebhookConfig{
+			URL:          getEnv("SFU_WEBHOOK_URL", ""),
+			Secret:       getEnv("SFU_WEBHOOK_SECRET", ""),
+			Timeout:      time.Duration(getEnvInt("SFU_WEBHOOK_TIMEOUT_MS", 5000)) * time.Millisecond,
+			QueueSize:    getEnvInt("SFU_WEBHOOK_QUEUE_SIZE", 1024),
+			RetryMax:     time.Duration(getEnvInt("SFU_WEBHOOK_RETRY_MAX_SEC", 60)) * time.Second,
+			MaxAttempts:  getEnvInt("SFU_WEBHOOK_MAX_ATTEMPTS", 10),
+			Durable:      getEnvBool("SFU_WEBHOOK_DURABLE", false),
+			StreamPrefix: getEnv("SFU_WEBHOOK_STREAM_PREFIX", "webhook:events:"),
+			StreamMax:    int64(getEnvInt("SFU_WEBHOOK_STREAM_MAX", 100000)),
+		},
+		Capture: CaptureConfig{
+			Dir:         getEnv("SFU_CAPTURE_DIR", ""),
+			MaxDuration: time.Duration(getEnvInt("SFU_CAPTURE_MAX_DURATION_SEC", 300)) * time.Second,
+			MaxBytes:    int64(getEnvInt("SFU_CAPTURE_MAX_BYTES", 100<<20)),
+		},
+		Authz: AuthzConfig{
+			Mode:             getEnv("SFU_AUTHZ_MODE", "allow-all"),
+			JWTSecret:        getEnv("SFU_AUTHZ_JWT_SECRET", ""),
+			JWTIssuer:        getEnv("SFU_AUTHZ_JWT_ISSUER", ""),
+			JWTAudience:      getEnv("SFU_AUTHZ_JWT_AUDIENCE", ""),
+			CallbackURL:      getEnv("SFU_AUTHZ_CALLBACK_URL", ""),
+			CallbackToken:    getEnv("SFU_AUTHZ_CALLBACK_TOKEN", ""),
+			CallbackTimeout:  time.Duration(getEnvInt("SFU_AUTHZ_CALLBACK_TIMEOUT_MS", 2000)) * time.Millisecond,
+			CallbackRetries:  getEnvInt("SFU_AUTHZ_CALLBACK_RETRIES", 1),
+			CallbackFailOpen: getEnvBool("SFU_AUTHZ_CALLBACK_FAIL_OPEN", false),
+			CallbackCacheTTL: time.Duration(getEnvInt("SFU_AUTHZ_CALLBACK_CACHE_SEC", 30)) * time.Second,
 		},
 		Media: MediaConfig{
 			MaxVideoBitrate:    getEnvInt("SFU_MAX_VIDEO_BITRATE", 2000000),
@@ -138,19 +533,141 @@ func LoadConfig() *Config {
 			WSPongTimeout:      time.Duration(getEnvInt("SFU_WS_PONG_TIMEOUT", 60)) * time.Second,
 			WSPingInterval:     time.Duration(getEnvInt("SFU_WS_PING_INTERVAL", 54)) * time.Second,
 			WSHubPingInterval:  time.Duration(getEnvInt("SFU_WS_HUB_PING_INTERVAL", 30)) * time.Second,
+			WSJoinTimeout:      time.Duration(getEnvInt("SFU_WS_JOIN_TIMEOUT_SEC", 30)) * time.Second,
+			WSMaxUnjoined:      getEnvInt("SFU_WS_MAX_UNJOINED", 1000),
+			WSDrowsyAfter:      time.Duration(getEnvInt("SFU_WS_DROWSY_AFTER_SEC", 35)) * time.Second,
+			WSDrowsyGrace:      time.Duration(getEnvInt("SFU_WS_DROWSY_GRACE_SEC", 60)) * time.Second,
+			WSMaxMemberships:   getEnvInt("SFU_WS_MAX_MEMBERSHIPS", 4),
 			RateLimitPerSec:    float64(getEnvInt("SFU_RATE_LIMIT_PER_SEC", 20)),
 			RateLimitBurst:     getEnvInt("SFU_RATE_LIMIT_BURST", 40),
+			RateLimitControlPerSec: float64(getEnvInt("SFU_RATE_LIMIT_CONTROL_PER_SEC", 5)),
+			RateLimitControlBurst:  getEnvInt("SFU_RATE_LIMIT_CONTROL_BURST", 10),
+			RateLimitChattyPerSec:  float64(getEnvInt("SFU_RATE_LIMIT_CHATTY_PER_SEC", 100)),
+			RateLimitChattyBurst:   getEnvInt("SFU_RATE_LIMIT_CHATTY_BURST", 200),
+			DistRateLimitWindow:        time.Duration(getEnvInt("SFU_DIST_RATE_LIMIT_WINDOW_SEC", 60)) * time.Second,
+			DistRateLimitJoinsPerUser:  getEnvInt("SFU_DIST_RATE_LIMIT_JOINS_PER_USER", 0),
+			DistRateLimitJoinsPerIP:    getEnvInt("SFU_DIST_RATE_LIMIT_JOINS_PER_IP", 0),
+			DistRateLimitCreatesPerIP:  getEnvInt("SFU_DIST_RATE_LIMIT_CREATES_PER_IP", 0),
+			DistRateLimitNegativeCache: time.Duration(getEnvInt("SFU_DIST_RATE_LIMIT_NEGATIVE_CACHE_MS", 2000)) * time.Millisecond,
+			DistRateLimitFailOpen:      getEnvBool("SFU_DIST_RATE_LIMIT_FAIL_OPEN", true),
 			MaxRoomIDLength:          getEnvInt("SFU_MAX_ROOM_ID_LENGTH", 128),
 			MaxUserIDLength:          getEnvInt("SFU_MAX_USER_ID_LENGTH", 128),
+			MaxNameLength:            getEnvInt("SFU_MAX_NAME_LENGTH", 64),
 			SimulcastEnabled:         getEnvBool("SFU_SIMULCAST_ENABLED", false),
+			SimulcastLayerIdleWindow: time.Duration(getEnvInt("SFU_SIMULCAST_LAYER_IDLE_SEC", 10)) * time.Second,
+			WebKitCompat:             getEnvBool("SFU_WEBKIT_COMPAT", true),
+			Codecs:                   codecs,
+			codecsErr:                codecsErr,
 			SpeakerDetectionInterval: time.Duration(getEnvInt("SFU_SPEAKER_DETECTION_INTERVAL_MS", 200)) * time.Millisecond,
+			SpeakerActivityThreshold: float64(getEnvInt("SFU_SPEAKER_ACTIVITY_THRESHOLD", 5)),
 			StatsInterval:            time.Duration(getEnvInt("SFU_STATS_INTERVAL_MS", 3000)) * time.Millisecond,
+			RoomQualityEvents:        getEnvBool("SFU_ROOM_QUALITY_EVENTS", false),
+			ParallelFanOutThreshold:  getEnvInt("SFU_PARALLEL_FANOUT_THRESHOLD", 0),
+			ParallelFanOutShards:     getEnvInt("SFU_PARALLEL_FANOUT_SHARDS", 0),
+			JoinAttachWorkers:        getEnvInt("SFU_JOIN_ATTACH_WORKERS", 8),
+			JoinAttachTimeout:        time.Duration(getEnvInt("SFU_JOIN_ATTACH_TIMEOUT_MS", 500)) * time.Millisecond,
+			PublisherMaxBitrateKbps:    getEnvInt("SFU_PUBLISHER_MAX_BITRATE_KBPS", 0),
+			BitratePolicingDelay:       time.Duration(getEnvInt("SFU_BITRATE_POLICING_DELAY_MS", 3000)) * time.Millisecond,
+			BitratePolicingRemoveAfter: time.Duration(getEnvInt("SFU_BITRATE_POLICING_REMOVE_SEC", 15)) * time.Second,
+			BroadcastViewerStatsPercent: getEnvInt("SFU_BROADCAST_VIEWER_STATS_PERCENT", 10),
+			BroadcastCountInterval:      time.Duration(getEnvInt("SFU_BROADCAST_COUNT_INTERVAL_SEC", 5)) * time.Second,
 			SessionTTL:               time.Duration(getEnvInt("SFU_SESSION_TTL_SEC", 120)) * time.Second, // 2 minutes for reconnection
 			AutoSubscribe:            getEnvBool("SFU_AUTO_SUBSCRIBE", true),
+			PeerDisconnectGrace:      time.Duration(getEnvInt("SFU_PEER_DISCONNECT_GRACE_MS", 7000)) * time.Millisecond,
+			HoldTracksDuringGrace:    getEnvBool("SFU_HOLD_TRACKS_DURING_GRACE", false),
+			ICERestartMax:            getEnvInt("SFU_ICE_RESTART_MAX", 5),
+			ICERestartWindow:         time.Duration(getEnvInt("SFU_ICE_RESTART_WINDOW_SEC", 120)) * time.Second,
+			ICERestartCooldown:       time.Duration(getEnvInt("SFU_ICE_RESTART_COOLDOWN_MS", 1000)) * time.Millisecond,
+			ICERestartMaxCooldown:    time.Duration(getEnvInt("SFU_ICE_RESTART_MAX_COOLDOWN_MS", 30000)) * time.Millisecond,
+			DormantRoomAfter:         time.Duration(getEnvInt("SFU_DORMANT_ROOM_AFTER_SEC", 60)) * time.Second,
+			ConnectionStateDebounce:  time.Duration(getEnvInt("SFU_CONNECTION_STATE_DEBOUNCE_MS", 1000)) * time.Millisecond,
+			MaxTracksPerRoom:         getEnvInt("SFU_MAX_TRACKS_PER_ROOM", 0),
+			MaxTracksPerInstance:     getEnvInt("SFU_MAX_TRACKS_PER_INSTANCE", 0),
+			JoinTrackProjection:      getEnvInt("SFU_JOIN_TRACK_PROJECTION", 0),
+			InviteDefaultTTL:         time.Duration(getEnvInt("SFU_INVITE_DEFAULT_TTL_SEC", 3600)) * time.Second,
+			InviteMaxTTL:             time.Duration(getEnvInt("SFU_INVITE_MAX_TTL_SEC", 7*24*3600)) * time.Second,
+			MaxConcurrentJoins:        getEnvInt("SFU_MAX_CONCURRENT_JOINS", 32),
+			MaxConcurrentJoinsPerRoom: getEnvInt("SFU_MAX_CONCURRENT_JOINS_PER_ROOM", 8),
+			JoinQueueSize:             getEnvInt("SFU_JOIN_QUEUE_SIZE", 1000),
+			JoinQueueTimeout:          time.Duration(getEnvInt("SFU_JOIN_QUEUE_TIMEOUT_SEC", 30)) * time.Second,
+			JoinRetryAfter:            time.Duration(getEnvInt("SFU_JOIN_RETRY_AFTER_MS", 2000)) * time.Millisecond,
+			KeyframeRequestInterval:   time.Duration(getEnvInt("SFU_KEYFRAME_REQUEST_INTERVAL_MS", 1000)) * time.Millisecond,
+			LatencySampleEvery:        getEnvInt("SFU_LATENCY_SAMPLE_EVERY", 100),
+			DataChannelHistorySize:    getEnvInt("SFU_DATA_CHANNEL_HISTORY_SIZE", 50),
+			DataChannelQueueSize:      getEnvInt("SFU_DATA_CHANNEL_QUEUE_SIZE", 64),
+			DataChannelQueueTTL:       time.Duration(getEnvInt("SFU_DATA_CHANNEL_QUEUE_TTL_SEC", 30)) * time.Second,
+			NonTrickleGatherTimeout:   time.Duration(getEnvInt("SFU_NON_TRICKLE_GATHER_TIMEOUT_MS", 3000)) * time.Millisecond,
+			TrackStallTimeout:         time.Duration(getEnvInt("SFU_TRACK_STALL_TIMEOUT_MS", 5000)) * time.Millisecond,
+			PushToTalkMaxDuration:     time.Duration(getEnvInt("SFU_PUSH_TO_TALK_MAX_MS", 30000)) * time.Millisecond,
+			IdlePeerTimeout:           time.Duration(getEnvInt("SFU_IDLE_PEER_TIMEOUT_SEC", 300)) * time.Second,
+			IdlePeerGrace:             time.Duration(getEnvInt("SFU_IDLE_PEER_GRACE_SEC", 60)) * time.Second,
+			RoomTimeWarnings:          getEnvSeconds("SFU_ROOM_TIME_WARNINGS_SEC", "600,60"),
+			P2PAllowed:                getEnvBool("SFU_P2P_ALLOWED", false),
+			P2PRelayMaxBytes:          getEnvInt("SFU_P2P_RELAY_MAX_BYTES", 16384),
+			P2PRelayRatePerSec:        getEnvInt("SFU_P2P_RELAY_RATE_PER_SEC", 20),
+			StablePeerIDs:             getEnvBool("SFU_STABLE_PEER_IDS", false),
+			SelfMonitor:               getEnvBool("SFU_SELF_MONITOR", false),
+			RelayMaxBytes:             getEnvInt("SFU_RELAY_MAX_BYTES", 4096),
+			RelayMaxTargets:           getEnvInt("SFU_RELAY_MAX_TARGETS", 16),
+			LiveMaxConsumers:          getEnvInt("SFU_LIVE_MAX_CONSUMERS", 4),
+			LiveHeartbeatInterval:     time.Duration(getEnvInt("SFU_LIVE_HEARTBEAT_SEC", 15)) * time.Second,
+			CheckRoomConsistency:      getEnvBool("SFU_DEBUG_ROOM_CONSISTENCY", false),
 		},
 	}
 }
 
+// iceServersFromEnv builds the STUN server and the optional TURN server from
+// SFU_STUN_URLS and SFU_TURN_URLS (comma separated), with the TURN
+// credentials in SFU_TURN_USERNAME and SFU_TURN_CREDENTIAL.
+// Validate reports configuration that cannot be started with.
+func (c *Config) Validate() error {
+	if c.Media.codecsErr != nil {
+		return c.Media.codecsErr
+	}
+	if len(c.Media.Codecs) > 0 {
+		if err := validateCodecs(c.Media.Codecs); err != nil {
+			return fmt.Errorf("SFU_CODECS: %w", err)
+		}
+	}
+	return nil
+}
+
+func iceServersFromEnv() []ICEServer {
+	servers := []ICEServer{
+		{URLs: splitList(getEnv("SFU_STUN_URLS", "stun:stun.l.google.com:19302"))},
+	}
+	if turnURLs := splitList(getEnv("SFU_TURN_URLS", "")); len(turnURLs) > 0 {
+		servers = append(servers, ICEServer{
+			URLs:       turnURLs,
+			Username:   getEnv("SFU_TURN_USERNAME", ""),
+			Credential: getEnv("SFU_TURN_CREDENTIAL", ""),
+		})
+	}
+	return servers
+}
+
+func splitList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// getEnvSeconds reads a comma-separated list of whole seconds, skipping
+// entries that are not positive integers.
+func getEnvSeconds(key, defaultValue string) []time.Duration {
+	var out []time.Duration
+	for _, item := range splitList(getEnv(key, defaultValue)) {
+		if sec, err := strconv.Atoi(item); err == nil && sec > 0 {
+			out = append(out, time.Duration(sec)*time.Second)
+		}
+	}
+	return out
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
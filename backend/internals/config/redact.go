@@ -0,0 +1,54 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// redactedValue replaces a secret that is set. Unset secrets stay empty so
+// the redacted config still shows whether one is configured.
+const redactedValue = "[redacted]"
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// Redacted returns a copy of the effective configuration with every secret
+// replaced: the admin key, the Redis password, the TURN credentials and
+// secret, the metrics auth token and password, and the authorizer's JWT
+// secret and callback token, and the webhook secret. New secret fields must
+// be added here.
+func (c *Config) Redacted() Config {
+	out := *c
+	out.Server.AdminKey = redact(c.Server.AdminKey)
+	out.Redis.Password = redact(c.Redis.Password)
+	out.WebRTC.TURNSecret = redact(c.WebRTC.TURNSecret)
+	out.Metrics.Auth.BearerToken = redact(c.Metrics.Auth.BearerToken)
+	out.Metrics.Auth.Password = redact(c.Metrics.Auth.Password)
+	out.Authz.JWTSecret = redact(c.Authz.JWTSecret)
+	out.Authz.CallbackToken = redact(c.Authz.CallbackToken)
+	out.Webhook.Secret = redact(c.Webhook.Secret)
+
+	out.WebRTC.ICEServers = make([]ICEServer, len(c.WebRTC.ICEServers))
+	for i, server := range c.WebRTC.ICEServers {
+		server.Credential = redact(server.Credential)
+		out.WebRTC.ICEServers[i] = server
+	}
+	return out
+}
+
+// Fingerprint is a short stable hash of the redacted configuration, so
+// instances running with different settings can be told apart without
+// exposing them. Changing a secret's value does not change it.
+func (c *Config) Fingerprint() string {
+	data, err := json.Marshal(c.Redacted())
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
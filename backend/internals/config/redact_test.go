@@ -0,0 +1,105 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// secretField matches the names of fields holding secrets.
+var secretField = regexp.MustCompile(`Secret|Password|Token|Key$|Credential`)
+
+// setSecrets sets every secret string field under v, including those of
+// slice elements, to "secret:" and its name, adding an element to empty
+// slices of structs. It returns the values set.
+func setSecrets(v reflect.Value, name string) []string {
+	var set []string
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.IsExported() {
+				set = append(set, setSecrets(v.Field(i), name+"."+f.Name)...)
+			}
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			break
+		}
+		if v.Len() == 0 {
+			v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		}
+		for i := 0; i < v.Len(); i++ {
+			set = append(set, setSecrets(v.Index(i), name)...)
+		}
+	case reflect.String:
+		if secretField.MatchString(name[strings.LastIndex(name, ".")+1:]) {
+			v.SetString("secret:" + name)
+			set = append(set, v.String())
+		}
+	}
+	return set
+}
+
+func TestRedacted(t *testing.T) {
+	var c Config
+	secrets := setSecrets(reflect.ValueOf(&c).Elem(), "Config")
+	if len(secrets) < 9 {
+		t.Fatalf("found %d secret fields: %v", len(secrets), secrets)
+	}
+
+	data, err := json.Marshal(c.Redacted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range secrets {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("%s not redacted; add it to Config.Redacted", strings.TrimPrefix(secret, "secret:"))
+		}
+	}
+	if got := strings.Count(string(data), redactedValue); got != len(secrets) {
+		t.Errorf("%d values redacted, want %d", got, len(secrets))
+	}
+	if c.WebRTC.ICEServers[0].Credential == redactedValue {
+		t.Error("Redacted changed the original's ICE servers")
+	}
+}
+
+func TestRedactedKeepsUnsetSecretsEmpty(t *testing.T) {
+	c := Config{WebRTC: WebRTCConfig{ICEServers: []ICEServer{{URLs: []string{"stun:stun.example.com"}}}}}
+	r := c.Redacted()
+	if r.Server.AdminKey != "" || r.Redis.Password != "" || r.WebRTC.ICEServers[0].Credential != "" {
+		t.Fatalf("unset secrets redacted: %+v", r)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	base := Config{
+		Server: ServerConfig{Port: 8080, AdminKey: "one"},
+		Redis:  RedisConfig{Password: "one"},
+	}
+	fp := base.Fingerprint()
+	if len(fp) != 16 {
+		t.Fatalf("fingerprint %q, want 16 hex digits", fp)
+	}
+
+	rotated := base
+	rotated.Server.AdminKey = "two"
+	rotated.Redis.Password = "two"
+	if got := rotated.Fingerprint(); got != fp {
+		t.Errorf("rotating secrets changed the fingerprint: %s, was %s", got, fp)
+	}
+
+	unset := base
+	unset.Server.AdminKey = ""
+	if got := unset.Fingerprint(); got == fp {
+		t.Error("unsetting a secret kept the fingerprint")
+	}
+
+	moved := base
+	moved.Server.Port = 8081
+	if got := moved.Fingerprint(); got == fp {
+		t.Error("changing a setting kept the fingerprint")
+	}
+}
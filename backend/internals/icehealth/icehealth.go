@@ -0,0 +1,345 @@
+// Package icehealth probes the configured STUN/TURN servers so the ICE
+// configuration handed to clients can skip servers that are down.
+package icehealth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/pion/logging"
+	"github.com/pion/stun"
+	"github.com/pion/turn/v2"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+var errTimeout = errors.New("timed out")
+
+// Options configures a Checker.
+type Options struct {
+	Interval  time.Duration // between check rounds
+	Timeout   time.Duration // per probe
+	DownAfter int           // consecutive failures before a server is omitted
+}
+
+// URLStatus is the latest probe result for one ICE server URL.
+type URLStatus struct {
+	URL                 string    `json:"url"`
+	Up                  bool      `json:"up"`
+	RTTMs               float64   `json:"rttMs,omitempty"`
+	Method              string    `json:"method"` // binding or allocate
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LastChecked         time.Time `json:"lastChecked"`
+	LastError           string    `json:"lastError,omitempty"`
+}
+
+// Checker periodically probes ICE servers off the signaling path. STUN URLs
+// and TURN URLs without credentials get a STUN binding request; TURN URLs
+// over UDP with credentials get a full allocation. TURN over TCP/TLS falls
+// back to a binding request on that transport.
+type Checker struct {
+	servers []webrtc.ICEServer
+	opts    Options
+	logger  *zap.Logger
+
+	mu     sync.RWMutex
+	status map[string]*URLStatus
+}
+
+// NewChecker creates a checker for servers. Nothing is probed until Start.
+func NewChecker(servers []webrtc.ICEServer, opts Options, logger *zap.Logger) *Checker {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	if opts.DownAfter <= 0 {
+		opts.DownAfter = 2
+	}
+	return &Checker{
+		servers: servers,
+		opts:    opts,
+		logger:  logger,
+		status:  make(map[string]*URLStatus),
+	}
+}
+
+// Start runs a check round immediately and then every Interval until ctx is
+// cancelled.
+func (c *Checker) Start(ctx context.Context) {
+	go func() {
+		c.checkAll(ctx)
+		ticker := time.NewTicker(c.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.checkAll(ctx)
+			}
+		}
+	}()
+}
+
+func (c *Checker) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	// A URL listed by several servers is probed once, so a round counts as
+	// one failure for it
+	probed := make(map[string]bool)
+	for _, server := range c.servers {
+		username, credential := server.Username, ""
+		if s, ok := server.Credential.(string); ok {
+			credential = s
+		}
+		for _, raw := range server.URLs {
+			if probed[raw] {
+				continue
+			}
+			probed[raw] = true
+			wg.Add(1)
+			go func(raw string) {
+				defer wg.Done()
+				method, rtt, err := c.probe(raw, username, credential)
+				if ctx.Err() != nil {
+					return
+				}
+				c.record(raw, method, rtt, err)
+			}(raw)
+		}
+	}
+	wg.Wait()
+}
+
+// record stores a probe result, logging up/down transitions.
+func (c *Checker) record(raw, method string, rtt time.Duration, err error) {
+	c.mu.Lock()
+	st, seen := c.status[raw]
+	if !seen {
+		st = &URLStatus{URL: raw, Up: true}
+		c.status[raw] = st
+	}
+	wasUp := st.Up
+	st.Method = method
+	st.LastChecked = time.Now()
+	if err == nil {
+		st.Up = true
+		st.RTTMs = float64(rtt) / float64(time.Millisecond)
+		st.ConsecutiveFailures = 0
+		st.LastError = ""
+	} else {
+		st.Up = false
+		st.RTTMs = 0
+		st.ConsecutiveFailures++
+		st.LastError = err.Error()
+	}
+	up, failures := st.Up, st.ConsecutiveFailures
+	c.mu.Unlock()
+
+	appmetrics.SetICEServerHealth(raw, up, rtt)
+
+	switch {
+	case wasUp && !up:
+		c.logger.Warn("ICE server down",
+			zap.String("url", raw),
+			zap.String("method", method),
+			zap.Error(err),
+		)
+	case !wasUp && up:
+		c.logger.Warn("ICE server recovered",
+			zap.String("url", raw),
+			zap.Duration("rtt", rtt),
+			zap.Int("failedChecks", failures),
+		)
+	}
+}
+
+// Statuses returns the latest result for every probed URL, sorted by URL.
+func (c *Checker) Statuses() []URLStatus {
+	c.mu.RLock()
+	out := make([]URLStatus, 0, len(c.status))
+	for _, st := range c.status {
+		out = append(out, *st)
+	}
+	c.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].URL < out[j].URL })
+	return out
+}
+
+// ICEServers returns the servers to hand to clients: healthy servers first,
+// fastest first, and servers whose every URL has failed DownAfter checks in a
+// row left out. URLs that are down are dropped from servers that still have a
+// working one. If every server is down the full list is returned, since a
+// stale server is better than none.
+func (c *Checker) ICEServers() []webrtc.ICEServer {
+	type ranked struct {
+		server webrtc.ICEServer
+		rtt    float64
+	}
+
+	c.mu.RLock()
+	list := make([]ranked, 0, len(c.servers))
+	for _, server := range c.servers {
+		urls := make([]string, 0, len(server.URLs))
+		best := -1.0
+		for _, raw := range server.URLs {
+			st, ok := c.status[raw]
+			if ok && st.ConsecutiveFailures >= c.opts.DownAfter {
+				continue
+			}
+			urls = append(urls, raw)
+			// Unchecked or briefly failing URLs rank behind measured ones
+			rtt := float64(c.opts.Timeout / time.Millisecond)
+			if ok && st.Up {
+				rtt = st.RTTMs
+			}
+			if best < 0 || rtt < best {
+				best = rtt
+			}
+		}
+		if len(urls) == 0 {
+			continue
+		}
+		server.URLs = urls
+		list = append(list, ranked{server: server, rtt: best})
+	}
+	c.mu.RUnlock()
+
+	if len(list) == 0 {
+		return append([]webrtc.ICEServer(nil), c.servers...)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].rtt < list[j].rtt })
+
+	out := make([]webrtc.ICEServer, len(list))
+	for i, r := range list {
+		out[i] = r.server
+	}
+	return out
+}
+
+// probe checks one URL and reports the method used.
+func (c *Checker) probe(raw, username, credential string) (string, time.Duration, error) {
+	uri, err := stun.ParseURI(raw)
+	if err != nil {
+		return "binding", 0, fmt.Errorf("invalid url: %w", err)
+	}
+	addr := net.JoinHostPort(uri.Host, strconv.Itoa(uri.Port))
+	secure := uri.Scheme == stun.SchemeTypeSTUNS || uri.Scheme == stun.SchemeTypeTURNS
+
+	if uri.Scheme == stun.SchemeTypeTURN && uri.Proto == stun.ProtoTypeUDP && username != "" {
+		rtt, err := allocate(addr, username, credential, c.opts.Timeout)
+		return "allocate", rtt, err
+	}
+
+	network := "udp"
+	if uri.Proto == stun.ProtoTypeTCP || secure {
+		network = "tcp"
+	}
+	rtt, err := binding(network, addr, uri.Host, secure, c.opts.Timeout)
+	return "binding", rtt, err
+}
+
+// binding sends a STUN binding request and waits for the success response.
+func binding(network, addr, host string, secure bool, timeout time.Duration) (time.Duration, error) {
+	deadline := time.Now().Add(timeout)
+	dialer := net.Dialer{Deadline: deadline}
+
+	var conn net.Conn
+	var err error
+	if secure {
+		conn, err = tls.DialWithDialer(&dialer, network, addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial(network, addr)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+
+	req, err := stun.Build(stun.TransactionID, stun.BindingRequest, stun.Fingerprint)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	if _, err := conn.Write(req.Raw); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				return 0, errTimeout
+			}
+			return 0, err
+		}
+		res := &stun.Message{Raw: append([]byte(nil), buf[:n]...)}
+		if err := res.Decode(); err != nil || res.TransactionID != req.TransactionID {
+			continue
+		}
+		if res.Type != stun.BindingSuccess {
+			return 0, fmt.Errorf("unexpected response %s", res.Type)
+		}
+		return time.Since(start), nil
+	}
+}
+
+// allocate performs a TURN allocation over UDP and releases it.
+func allocate(addr, username, credential string, timeout time.Duration) (time.Duration, error) {
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	loggerFactory := logging.NewDefaultLoggerFactory()
+	loggerFactory.DefaultLogLevel = logging.LogLevelDisabled
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: addr,
+		TURNServerAddr: addr,
+		Username:       username,
+		Password:       credential,
+		RTO:            timeout / 4,
+		Conn:           conn,
+		LoggerFactory:  loggerFactory,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+	if err := client.Listen(); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		relay, err := client.Allocate()
+		if err == nil {
+			relay.Close()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return 0, err
+		}
+		return time.Since(start), nil
+	case <-time.After(timeout):
+		// Closing the client (deferred) unblocks Allocate
+		return 0, errTimeout
+	}
+}
@@ -0,0 +1,153 @@
+package icehealth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pion/turn/v2"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// stubServer runs a local TURN server, which also answers STUN binding
+// requests, taking user/pass. It returns its host:port.
+func stubServer(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := turn.NewServer(turn.ServerConfig{
+		Realm: "sfu.test",
+		AuthHandler: func(username, realm string, _ net.Addr) ([]byte, bool) {
+			if username != "user" {
+				return nil, false
+			}
+			return turn.GenerateAuthKey(username, realm, "pass"), true
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn: conn,
+			RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP("127.0.0.1"),
+				Address:      "127.0.0.1",
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return conn.LocalAddr().String()
+}
+
+// deadAddr is a UDP address nothing answers on.
+func deadAddr(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+	return addr
+}
+
+func urls(servers []webrtc.ICEServer) [][]string {
+	out := make([][]string, len(servers))
+	for i, s := range servers {
+		out[i] = s.URLs
+	}
+	return out
+}
+
+func TestCheckerOrdersAndOmitsServers(t *testing.T) {
+	live, dead := stubServer(t), deadAddr(t)
+	stunLive := "stun:" + live
+	turnLive := "turn:" + live + "?transport=udp"
+	stunDead := "stun:" + dead
+	turnBadAuth := "turn:" + stubServer(t) + "?transport=udp"
+	servers := []webrtc.ICEServer{
+		{URLs: []string{stunDead}},
+		{URLs: []string{turnLive}, Username: "user", Credential: "pass"},
+		{URLs: []string{stunDead, stunLive}},
+		{URLs: []string{turnBadAuth}, Username: "user", Credential: "wrong"},
+	}
+	core, logs := observer.New(zapcore.WarnLevel)
+	c := NewChecker(servers, Options{Timeout: 300 * time.Millisecond, DownAfter: 2}, zap.New(core))
+
+	c.checkAll(context.Background())
+	byURL := make(map[string]URLStatus)
+	for _, st := range c.Statuses() {
+		byURL[st.URL] = st
+	}
+	for url, want := range map[string]struct {
+		up     bool
+		method string
+	}{
+		stunLive:    {true, "binding"},
+		turnLive:    {true, "allocate"},
+		stunDead:    {false, "binding"},
+		turnBadAuth: {false, "allocate"},
+	} {
+		st := byURL[url]
+		if st.Up != want.up || st.Method != want.method {
+			t.Errorf("%s: up %v by %s (%s), want up %v by %s", url, st.Up, st.Method, st.LastError, want.up, want.method)
+		}
+		if st.Up && st.RTTMs <= 0 {
+			t.Errorf("%s: no RTT", url)
+		}
+	}
+
+	// One failure is not enough to drop a URL, but it ranks behind
+	// measured ones
+	got := urls(c.ICEServers())
+	if len(got) != 4 || got[len(got)-1][0] == turnLive || got[len(got)-1][0] == stunLive {
+		t.Fatalf("after one round: %v", got)
+	}
+
+	c.checkAll(context.Background())
+	want := [][]string{{turnLive}, {stunLive}}
+	if got := urls(c.ICEServers()); !reflect.DeepEqual(got, want) && !reflect.DeepEqual(got, [][]string{{stunLive}, {turnLive}}) {
+		t.Fatalf("after two rounds: %v, want %v in some order", got, want)
+	}
+	if n := logs.FilterMessage("ICE server down").Len(); n != 2 {
+		t.Fatalf("%d down transitions logged, want 2", n)
+	}
+}
+
+func TestCheckerWithEveryServerDown(t *testing.T) {
+	servers := []webrtc.ICEServer{{URLs: []string{"stun:" + deadAddr(t)}}, {URLs: []string{"stun:" + deadAddr(t)}}}
+	c := NewChecker(servers, Options{Timeout: 200 * time.Millisecond, DownAfter: 1}, zap.NewNop())
+	c.checkAll(context.Background())
+	// A stale server is better than none
+	if got := c.ICEServers(); !reflect.DeepEqual(got, servers) {
+		t.Fatalf("ICEServers() = %v, want the full list", got)
+	}
+}
+
+func TestCheckerRecovery(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	c := NewChecker(nil, Options{DownAfter: 2}, zap.New(core))
+	const url = "stun:stun.example.test:3478"
+	c.record(url, "binding", 0, fmt.Errorf("refused"))
+	c.record(url, "binding", 0, fmt.Errorf("refused"))
+	c.record(url, "binding", 15*time.Millisecond, nil)
+
+	st := c.Statuses()[0]
+	if !st.Up || st.ConsecutiveFailures != 0 || st.LastError != "" || st.RTTMs != 15 {
+		t.Fatalf("after recovering: %+v", st)
+	}
+	var msgs []string
+	for _, e := range logs.All() {
+		msgs = append(msgs, e.Message)
+	}
+	if !reflect.DeepEqual(msgs, []string{"ICE server down", "ICE server recovered"}) {
+		t.Fatalf("logged %v", msgs)
+	}
+}
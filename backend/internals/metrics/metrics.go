@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -17,6 +19,11 @@ var (
 		Help: "Total number of ICE restarts",
 	})
 
+	ICERestartAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_ice_restart_attempts_total",
+		Help: "ICE restarts by who asked for them and how they ended (recovered, failed, budget-exhausted)",
+	}, []string{"initiator", "outcome"})
+
 	SessionRecoveriesTotal = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "sfu_session_recoveries_total",
 		Help: "Total successful session recoveries",
@@ -55,6 +62,11 @@ var (
 		Help: "Total Picture Loss Indication requests",
 	})
 
+	FIRRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_fir_requests_total",
+		Help: "Full Intra Requests received from subscribers or sent to publishers",
+	}, []string{"direction"})
+
 	NACKRequestsTotal = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "sfu_nack_requests_total",
 		Help: "Total Negative Acknowledgement requests",
@@ -71,6 +83,133 @@ var (
 		Help: "Total subscription changes",
 	}, []string{"action"})
 
+	// Admission control
+	AdmissionRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_admission_rejections_total",
+		Help: "Total tracks, joins and subscriptions rejected by admission control",
+	}, []string{"kind", "reason"})
+
+	// Join admission
+	JoinLatencyMs = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "sfu_join_latency_ms",
+		Help:    "Time from join request to join completion, including queueing",
+		Buckets: []float64{10, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000},
+	})
+
+	JoinAnswerSDPBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sfu_join_answer_sdp_bytes",
+		Help:    "Size of the answer to a peer's first offer, by subscription mode (auto or manual)",
+		Buckets: prometheus.ExponentialBuckets(1024, 2, 8),
+	}, []string{"mode"})
+
+	JoinAnswerLatencyMs = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sfu_join_answer_latency_ms",
+		Help:    "Time from receiving a peer's first offer to sending the answer, by subscription mode",
+		Buckets: []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500},
+	}, []string{"mode"})
+
+	JoinAttachLatencyMs = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "sfu_join_attach_latency_ms",
+		Help:    "Time spent attaching a room's existing tracks to a peer before its first answer",
+		Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500},
+	})
+
+	JoinAttachDeferredTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sfu_join_attach_deferred_total",
+		Help: "Existing tracks left out of a first answer by the attach deadline and added by renegotiation",
+	})
+
+	JoinQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "sfu_join_queue_depth",
+		Help: "Number of joins waiting for admission",
+	})
+
+	// Renegotiation
+	RenegotiationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_renegotiations_total",
+		Help: "Renegotiations requested from clients, by reason",
+	}, []string{"reason"})
+
+	RenegotiationDurationMs = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sfu_renegotiation_duration_ms",
+		Help:    "Time from a renegotiate request to the answer to the client's offer, by reason and by how the offer was matched (id or next_offer)",
+		Buckets: []float64{25, 50, 100, 250, 500, 1000, 2500, 5000, 10000},
+	}, []string{"reason", "correlation"})
+
+	RoomRenegotiationsPending = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sfu_room_renegotiations_pending",
+		Help: "Renegotiations waiting on the throttle in each room (only exported when metrics.room_peers is enabled)",
+	}, []string{"room"})
+
+	// Simulcast layer usage
+	LayersSuggestedOffTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_simulcast_layers_suggested_off_total",
+		Help: "Simulcast layers publishers were told they may pause because no subscriber used them, by RID",
+	}, []string{"rid"})
+
+	LayerReenableLatencyMs = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "sfu_simulcast_layer_reenable_latency_ms",
+		Help:    "Time from asking a publisher to resume a paused simulcast layer to its first packet",
+		Buckets: []float64{50, 100, 250, 500, 1000, 2500, 5000, 10000},
+	})
+
+	// Subscriber write failures (see room/writeerrors.go)
+	SubscriberWriteErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_subscriber_write_errors_total",
+		Help: "Failed writes to subscribers' tracks, by kind and class (closed, congestion or other)",
+	}, []string{"kind", "class"})
+
+	// Publisher bitrate policing
+	BitratePolicingTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_bitrate_policing_total",
+		Help: "Publishers policed for exceeding the bitrate cap and what was done, by action",
+	}, []string{"action"})
+
+	BitratePolicedPacketsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_bitrate_policed_packets_total",
+		Help: "Packets dropped while policing a publisher, by reason (budget or layer)",
+	}, []string{"reason"})
+
+	// Room capacity
+	RoomsRemaining = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "sfu_rooms_remaining",
+		Help: "Rooms this instance can still create before reaching its room limit",
+	})
+
+	DormantRooms = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "sfu_dormant_rooms",
+		Help: "Rooms asleep because every peer has been disconnected for the dormancy threshold",
+	})
+
+	RoomCreationRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_room_creation_rejections_total",
+		Help: "Room creations rejected because the instance is at its room limit",
+	}, []string{"source"})
+
+	RoomCreateConflictsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_room_create_conflicts_total",
+		Help: "Room creations that found the room being created or hosted on another instance",
+	}, []string{"outcome"})
+
+	// Invites
+	InvitesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_invites_total",
+		Help: "Total invite operations",
+	}, []string{"action"})
+
+	// Sampled packet latency (see room/latency.go), by kind only
+	ForwardingDelayMs = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sfu_forwarding_delay_ms",
+		Help:    "Delay of sampled packets from read to write to a subscriber in milliseconds",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 25, 50},
+	}, []string{"kind"})
+
+	InboundDelayMs = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sfu_inbound_delay_ms",
+		Help:    "Delay of sampled packets from the publisher (abs-send-time) above its clock baseline in milliseconds",
+		Buckets: []float64{1, 5, 10, 20, 50, 100, 200, 500, 1000},
+	}, []string{"kind"})
+
 	// Redis health
 	RedisLatencyMs = promauto.NewHistogram(prometheus.HistogramOpts{
 		Name:    "sfu_redis_latency_ms",
@@ -100,6 +239,54 @@ var (
 		Help: "Estimated memory usage per peer",
 	}, []string{"peer"})
 
+	RoomPeers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sfu_room_peers",
+		Help: "Number of peers in each room (only exported when metrics.room_peers is enabled)",
+	}, []string{"room"})
+
+	RoomQualityPeers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sfu_room_quality_peers",
+		Help: "Participants in each room by connection quality level (only exported when metrics.room_peers is enabled)",
+	}, []string{"room", "level"})
+
+	RoomPoorQualityPercent = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sfu_room_poor_quality_percent",
+		Help: "Percentage of each room's participants with poor or critical connection quality (only exported when metrics.room_peers is enabled)",
+	}, []string{"room"})
+
+	// Entries in long-lived maps, sampled periodically so leaks show up
+	MapEntries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sfu_map_entries",
+		Help: "Entries in internal maps that grow with connections, peers and sessions",
+	}, []string{"map"})
+
+	UnjoinedClosedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_ws_unjoined_closed_total",
+		Help: "WebSocket connections closed or refused for not joining a room",
+	}, []string{"reason"})
+
+	PeerDetachTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_peer_detach_total",
+		Help: "Peers kept after their signaling connection dropped, by outcome",
+	}, []string{"outcome"})
+
+	// Build and configuration of this instance; always 1
+	BuildInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sfu_build_info",
+		Help: "Build version, commit, date, Go version and config fingerprint of this instance",
+	}, []string{"version", "commit", "build_date", "go_version", "config_fingerprint"})
+
+	// ICE server health (see internals/icehealth)
+	ICEServerUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sfu_ice_server_up",
+		Help: "Whether the last health check of an ICE server URL succeeded",
+	}, []string{"url"})
+
+	ICEServerRTT = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sfu_ice_server_rtt_seconds",
+		Help: "Round-trip time of the last successful ICE server health check",
+	}, []string{"url"})
+
 	// Sessions
 	ActiveSessions = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "sfu_active_sessions_total",
@@ -110,6 +297,81 @@ var (
 		Name: "sfu_suspended_sessions_total",
 		Help: "Number of suspended sessions",
 	})
+
+	IdlePeersReapedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sfu_idle_peers_reaped_total",
+		Help: "Peers disconnected for consuming no forwarded media",
+	})
+
+	DrowsyClientsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_ws_drowsy_total",
+		Help: "WebSocket connections going silent (drowsy) and waking again",
+	}, []string{"state"})
+
+	// Cross-instance pub/sub
+	PubSubReconnectsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sfu_pubsub_reconnects_total",
+		Help: "Redis room channel subscriptions re-established after a connection loss",
+	})
+
+	PubSubDroppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sfu_pubsub_dropped_messages_total",
+		Help: "Cross-instance messages dropped because local delivery was behind",
+	})
+
+	// Signaling
+	RateLimitRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_rate_limit_rejections_total",
+		Help: "Signaling messages dropped for exceeding a client's rate limit, by message class",
+	}, []string{"class"})
+
+	DistRateLimitRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_distributed_rate_limit_rejections_total",
+		Help: "Joins and room creations refused by a rate limit shared through Redis, by operation and key class",
+	}, []string{"operation", "key"})
+
+	DistRateLimitErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_distributed_rate_limit_errors_total",
+		Help: "Distributed rate limit checks that failed to reach Redis, by operation",
+	}, []string{"operation"})
+
+	SignalingBytesSentTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_signaling_bytes_sent_total",
+		Help: "Bytes of signaling messages written to clients, by message type",
+	}, []string{"type"})
+
+	// Audit
+	AuditEventsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_audit_events_total",
+		Help: "Audited administrative actions by action and result",
+	}, []string{"action", "result"})
+
+	AuditWriteFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_audit_write_failures_total",
+		Help: "Audit events that could not be written, by sink",
+	}, []string{"sink"})
+
+	// Webhook delivery (see webhook/webhook.go)
+	WebhookDeliveriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_webhook_deliveries_total",
+		Help: "Webhook delivery attempts, by result (delivered or failed)",
+	}, []string{"result"})
+
+	WebhookDroppedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_webhook_dropped_total",
+		Help: "Webhook events given up on, by reason",
+	}, []string{"reason"})
+
+	WebhookPendingEvents = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "sfu_webhook_pending_events",
+		Help: "Events in the durable webhook stream not yet acknowledged by the sink",
+	})
+
+	// Authorization
+	AuthzDecisionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sfu_authz_decisions_total",
+		Help: "Authorizer decisions by action and result (allowed, denied or error)",
+	}, []string{"action", "result"})
 )
 
 // Helper functions
@@ -122,6 +384,31 @@ func RecordICERestart() {
 	ICERestartsTotal.Inc()
 }
 
+// RecordICERestartAttempt counts an ICE restart asked for by initiator by
+// its outcome: "recovered", "failed" or "budget-exhausted".
+func RecordICERestartAttempt(initiator, outcome string) {
+	ICERestartAttemptsTotal.WithLabelValues(initiator, outcome).Inc()
+}
+
+// RecordForwardingDelay observes a sampled packet's delay through the SFU.
+func RecordForwardingDelay(kind string, d time.Duration) {
+	ForwardingDelayMs.WithLabelValues(kind).Observe(float64(d) / float64(time.Millisecond))
+}
+
+// RecordInboundDelay observes a sampled packet's delay from its publisher.
+func RecordInboundDelay(kind string, d time.Duration) {
+	InboundDelayMs.WithLabelValues(kind).Observe(float64(d) / float64(time.Millisecond))
+}
+
+// RecordDrowsyClient counts a connection becoming drowsy, or waking.
+func RecordDrowsyClient(drowsy bool) {
+	state := "awake"
+	if drowsy {
+		state = "drowsy"
+	}
+	DrowsyClientsTotal.WithLabelValues(state).Inc()
+}
+
 func RecordSessionRecovery(success bool) {
 	if success {
 		SessionRecoveriesTotal.Inc()
@@ -134,10 +421,177 @@ func RecordSubscription(action string) {
 	SubscriptionChangesTotal.WithLabelValues(action).Inc()
 }
 
+func ObserveJoinAnswer(mode string, sdpBytes int, d time.Duration) {
+	JoinAnswerSDPBytes.WithLabelValues(mode).Observe(float64(sdpBytes))
+	JoinAnswerLatencyMs.WithLabelValues(mode).Observe(float64(d.Milliseconds()))
+}
+
+// ObserveJoinAttach records how long a joining peer's existing tracks took
+// to attach and how many were deferred past the deadline.
+func ObserveJoinAttach(d time.Duration, deferred int) {
+	JoinAttachLatencyMs.Observe(float64(d.Milliseconds()))
+	JoinAttachDeferredTotal.Add(float64(deferred))
+}
+
+func RecordAdmissionRejection(kind, reason string) {
+	AdmissionRejectionsTotal.WithLabelValues(kind, reason).Inc()
+}
+
+func RecordRoomCreationRejected(source string) {
+	RoomCreationRejectionsTotal.WithLabelValues(source).Inc()
+}
+
+func RecordRoomCreateConflict(outcome string) {
+	RoomCreateConflictsTotal.WithLabelValues(outcome).Inc()
+}
+
+func RecordInvite(action string) {
+	InvitesTotal.WithLabelValues(action).Inc()
+}
+
+func RecordRoomDormant(dormant bool) {
+	if dormant {
+		DormantRooms.Inc()
+	} else {
+		DormantRooms.Dec()
+	}
+}
+
+func SetRoomPeers(roomID string, peers int) {
+	RoomPeers.WithLabelValues(roomID).Set(float64(peers))
+}
+
+func DeleteRoomPeers(roomID string) {
+	RoomPeers.DeleteLabelValues(roomID)
+}
+
+func SetRoomQuality(roomID string, levels map[string]int, poorPercent float64) {
+	for level, n := range levels {
+		RoomQualityPeers.WithLabelValues(roomID, level).Set(float64(n))
+	}
+	RoomPoorQualityPercent.WithLabelValues(roomID).Set(poorPercent)
+}
+
+func DeleteRoomQuality(roomID string) {
+	RoomQualityPeers.DeletePartialMatch(prometheus.Labels{"room": roomID})
+	RoomPoorQualityPercent.DeleteLabelValues(roomID)
+}
+
+func RecordRenegotiation(reason string) {
+	RenegotiationsTotal.WithLabelValues(reason).Inc()
+}
+
+func ObserveRenegotiation(reason, correlation string, d time.Duration) {
+	RenegotiationDurationMs.WithLabelValues(reason, correlation).Observe(float64(d.Milliseconds()))
+}
+
+func SetRenegotiationsPending(roomID string, pending int) {
+	RoomRenegotiationsPending.WithLabelValues(roomID).Set(float64(pending))
+}
+
+func DeleteRenegotiationsPending(roomID string) {
+	RoomRenegotiationsPending.DeleteLabelValues(roomID)
+}
+
+func RecordLayerSuggestedOff(rid string) {
+	LayersSuggestedOffTotal.WithLabelValues(rid).Inc()
+}
+
+func ObserveLayerReenable(d time.Duration) {
+	LayerReenableLatencyMs.Observe(float64(d.Milliseconds()))
+}
+
+func RecordBitratePolicing(action string) {
+	BitratePolicingTotal.WithLabelValues(action).Inc()
+}
+
+// RecordSubscriberWriteError counts a failed write to a subscriber's track.
+func RecordSubscriberWriteError(kind, class string) {
+	SubscriberWriteErrorsTotal.WithLabelValues(kind, class).Inc()
+}
+
+func RecordPolicedPacket(reason string) {
+	BitratePolicedPacketsTotal.WithLabelValues(reason).Inc()
+}
+
+func SetBuildInfo(version, commit, buildDate, goVersion, configFingerprint string) {
+	BuildInfo.Reset()
+	BuildInfo.WithLabelValues(version, commit, buildDate, goVersion, configFingerprint).Set(1)
+}
+
+func SetICEServerHealth(url string, up bool, rtt time.Duration) {
+	if up {
+		ICEServerUp.WithLabelValues(url).Set(1)
+		ICEServerRTT.WithLabelValues(url).Set(rtt.Seconds())
+	} else {
+		ICEServerUp.WithLabelValues(url).Set(0)
+	}
+}
+
+func SetMapEntries(name string, n int) {
+	MapEntries.WithLabelValues(name).Set(float64(n))
+}
+
+func RecordUnjoinedClosed(reason string) {
+	UnjoinedClosedTotal.WithLabelValues(reason).Inc()
+}
+
+func RecordPeerDetach(outcome string) {
+	PeerDetachTotal.WithLabelValues(outcome).Inc()
+}
+
+func RecordPubSubReconnect() {
+	PubSubReconnectsTotal.Inc()
+}
+
+func RecordPubSubDropped() {
+	PubSubDroppedTotal.Inc()
+}
+
+func RecordRateLimitRejection(class string) {
+	RateLimitRejectionsTotal.WithLabelValues(class).Inc()
+}
+
+func RecordDistRateLimitRejection(operation, key string) {
+	DistRateLimitRejectionsTotal.WithLabelValues(operation, key).Inc()
+}
+
+func RecordDistRateLimitError(operation string) {
+	DistRateLimitErrorsTotal.WithLabelValues(operation).Inc()
+}
+
+func RecordSignalingSent(msgType string, bytes int) {
+	SignalingBytesSentTotal.WithLabelValues(msgType).Add(float64(bytes))
+}
+
+func RecordAuditEvent(action, result string) {
+	AuditEventsTotal.WithLabelValues(action, result).Inc()
+}
+
+func RecordAuditWriteFailure(sink string) {
+	AuditWriteFailuresTotal.WithLabelValues(sink).Inc()
+}
+
+func RecordWebhookDelivery(result string) {
+	WebhookDeliveriesTotal.WithLabelValues(result).Inc()
+}
+
+func RecordWebhookDropped(reason string) {
+	WebhookDroppedTotal.WithLabelValues(reason).Inc()
+}
+
+func RecordAuthzDecision(action, result string) {
+	AuthzDecisionsTotal.WithLabelValues(action, result).Inc()
+}
+
 func RecordPLI() {
 	PLIRequestsTotal.Inc()
 }
 
+func RecordFIR(direction string) {
+	FIRRequestsTotal.WithLabelValues(direction).Inc()
+}
+
 func RecordNACK() {
 	NACKRequestsTotal.Inc()
 }
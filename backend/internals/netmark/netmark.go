@@ -0,0 +1,174 @@
+// Package netmark marks the media sockets ICE opens with a DSCP code point
+// and, on Linux, a socket priority, so managed networks can prioritize
+// media over bulk traffic.
+package netmark
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pion/transport/v2"
+	"github.com/pion/transport/v2/stdnet"
+	"go.uber.org/zap"
+)
+
+// dscpNames are the named per-hop behaviours, RFC 4594.
+var dscpNames = map[string]int{
+	"DEFAULT": 0, "BE": 0,
+	"CS0": 0, "CS1": 8, "CS2": 16, "CS3": 24, "CS4": 32, "CS5": 40, "CS6": 48, "CS7": 56,
+	"AF11": 10, "AF12": 12, "AF13": 14,
+	"AF21": 18, "AF22": 20, "AF23": 22,
+	"AF31": 26, "AF32": 28, "AF33": 30,
+	"AF41": 34, "AF42": 36, "AF43": 38,
+	"EF": 46,
+}
+
+// ParseDSCP parses a DSCP code point given by name (EF, AF41, CS5, ...) or
+// as a number from 0 to 63.
+func ParseDSCP(value string) (int, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if v, ok := dscpNames[value]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 0 || v > 63 {
+		return 0, fmt.Errorf("invalid DSCP value %q: want a name such as EF or AF41, or 0-63", value)
+	}
+	return v, nil
+}
+
+// Status reports whether marking is configured and working, as shown on
+// /health.
+type Status struct {
+	Enabled  bool   `json:"enabled"`
+	DSCP     int    `json:"dscp"`
+	Priority int    `json:"priority,omitempty"`
+	Active   bool   `json:"active"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Net is the standard network with every UDP socket it opens marked. It is
+// handed to pion's SettingEngine in place of the default.
+type Net struct {
+	*stdnet.Net
+
+	tos      int // DSCP shifted into the traffic class byte
+	priority int // SO_PRIORITY, 0 to leave it alone
+	logger   *zap.Logger
+
+	mu     sync.Mutex
+	status Status
+	warned bool
+}
+
+var _ transport.Net = (*Net)(nil)
+
+// New returns a Net marking sockets with dscp and priority. Whether the
+// platform lets the options be set is probed on a throwaway socket; if it
+// does not, the failure is logged and reported by Status, and sockets are
+// opened unmarked.
+func New(dscp, priority int, logger *zap.Logger) (*Net, error) {
+	std, err := stdnet.NewNet()
+	if err != nil {
+		return nil, err
+	}
+	n := &Net{
+		Net:      std,
+		tos:      dscp << 2,
+		priority: priority,
+		logger:   logger,
+		status:   Status{Enabled: true, DSCP: dscp, Priority: priority},
+	}
+
+	probe, err := net.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer probe.Close()
+	if err := n.mark(probe); err != nil {
+		n.status.Error = err.Error()
+		logger.Warn("Media packets will not be marked",
+			zap.Int("dscp", dscp),
+			zap.Int("priority", priority),
+			zap.Error(err),
+		)
+		return n, nil
+	}
+	n.status.Active = true
+	logger.Info("Marking media packets",
+		zap.Int("dscp", dscp),
+		zap.Int("priority", priority),
+	)
+	return n, nil
+}
+
+// Status returns the current marking status.
+func (n *Net) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.status
+}
+
+// ListenUDP opens a UDP socket and marks it.
+func (n *Net) ListenUDP(network string, locAddr *net.UDPAddr) (transport.UDPConn, error) {
+	conn, err := n.Net.ListenUDP(network, locAddr)
+	if err == nil {
+		n.markConn(conn)
+	}
+	return conn, err
+}
+
+// ListenPacket opens a packet socket and marks it if it is UDP.
+func (n *Net) ListenPacket(network string, address string) (net.PacketConn, error) {
+	conn, err := n.Net.ListenPacket(network, address)
+	if err == nil {
+		n.markConn(conn)
+	}
+	return conn, err
+}
+
+// markConn marks conn unless probing found marking unavailable. A failure
+// is never fatal: the socket is used unmarked and the first one is logged.
+func (n *Net) markConn(conn any) {
+	n.mu.Lock()
+	active := n.status.Active
+	n.mu.Unlock()
+	if !active {
+		return
+	}
+	err := n.mark(conn)
+	if err == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.status.Error = err.Error()
+	if !n.warned {
+		n.warned = true
+		n.logger.Warn("Failed to mark a media socket", zap.Error(err))
+	}
+}
+
+// mark sets the traffic class and priority of conn's socket.
+func (n *Net) mark(conn any) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("%T has no socket to mark", conn)
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		sockErr = setSockopts(fd, n.tos, n.priority)
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,67 @@
+package netmark
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// sockopt reads an integer option of conn's socket.
+func sockopt(t *testing.T, conn any, level, opt int) int {
+	t.Helper()
+	raw, err := conn.(syscall.Conn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v int
+	var optErr error
+	if err := raw.Control(func(fd uintptr) { v, optErr = syscall.GetsockoptInt(int(fd), level, opt) }); err != nil {
+		t.Fatal(err)
+	}
+	if optErr != nil {
+		t.Fatal(optErr)
+	}
+	return v
+}
+
+func TestMarksSockets(t *testing.T) {
+	n, err := New(46, 5, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := n.Status(); !status.Enabled || !status.Active || status.Error != "" || status.DSCP != 46 {
+		t.Fatalf("status %+v", status)
+	}
+
+	v4, err := n.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v4.Close()
+	if tos := sockopt(t, v4, syscall.IPPROTO_IP, syscall.IP_TOS); tos != 46<<2 {
+		t.Fatalf("IPv4 socket TOS %#x, want %#x", tos, 46<<2)
+	}
+	if prio := sockopt(t, v4, syscall.SOL_SOCKET, syscall.SO_PRIORITY); prio != 5 {
+		t.Fatalf("SO_PRIORITY %d", prio)
+	}
+
+	packet, err := n.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packet.Close()
+	if tos := sockopt(t, packet, syscall.IPPROTO_IP, syscall.IP_TOS); tos != 46<<2 {
+		t.Fatalf("packet socket TOS %#x", tos)
+	}
+
+	v6, err := n.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skipf("no IPv6: %v", err)
+	}
+	defer v6.Close()
+	if tclass := sockopt(t, v6, syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS); tclass != 46<<2 {
+		t.Fatalf("IPv6 socket traffic class %#x", tclass)
+	}
+}
@@ -0,0 +1,27 @@
+package netmark
+
+import "testing"
+
+func TestParseDSCP(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  int
+		ok    bool
+	}{
+		{"EF", 46, true},
+		{" af41 ", 34, true},
+		{"CS5", 40, true},
+		{"BE", 0, true},
+		{"0", 0, true},
+		{"63", 63, true},
+		{"64", 0, false},
+		{"-1", 0, false},
+		{"AF44", 0, false},
+		{"", 0, false},
+	} {
+		got, err := ParseDSCP(tc.value)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("ParseDSCP(%q) = %d, %v", tc.value, got, err)
+		}
+	}
+}
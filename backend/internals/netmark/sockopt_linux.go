@@ -0,0 +1,25 @@
+package netmark
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// setSockopts sets the traffic class of an IPv4 or IPv6 socket to tos,
+// and its SO_PRIORITY when priority is set. A dual-stack IPv6 socket
+// takes both IP_TOS, for IPv4-mapped peers, and IPV6_TCLASS; a socket
+// only has to accept one of them.
+func setSockopts(fd uintptr, tos, priority int) error {
+	errV4 := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+	errV6 := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos)
+	if errV4 != nil && errV6 != nil {
+		return fmt.Errorf("set traffic class: %w", errV4)
+	}
+	if priority > 0 {
+		// Priorities above 6 need CAP_NET_ADMIN
+		if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PRIORITY, priority); err != nil {
+			return fmt.Errorf("set SO_PRIORITY: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package netmark
+
+import "errors"
+
+var errUnsupported = errors.New("not supported on this platform")
+
+// setSockopts is only implemented on Linux; elsewhere media is sent
+// unmarked.
+func setSockopts(fd uintptr, tos, priority int) error {
+	return errUnsupported
+}
@@ -0,0 +1,116 @@
+package peer
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// pendingDataMessage is a data channel message held until the peer's channel
+// opens.
+type pendingDataMessage struct {
+	seq      uint64
+	data     []byte
+	queuedAt time.Time
+}
+
+// SetDataChannelQueue bounds how many messages are held for a peer whose data
+// channel is not open yet, and how long they stay deliverable.
+func (p *Peer) SetDataChannelQueue(maxMessages int, ttl time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pendingDataMax = maxMessages
+	p.pendingDataTTL = ttl
+}
+
+// SendOrQueueDataChannelMessage sends message if the data channel is open and
+// otherwise queues it (dropping the oldest queued message when full). It
+// reports whether the message was sent immediately.
+func (p *Peer) SendOrQueueDataChannelMessage(seq uint64, message []byte) (bool, error) {
+	return p.sendOrQueueData(seq, message, false)
+}
+
+// HoldDataChannelMessage queues message even if the data channel is open,
+// for a peer that has not been sent the room history yet, so that it follows
+// the replay rather than racing it. Without a queue it is sent as usual.
+func (p *Peer) HoldDataChannelMessage(seq uint64, message []byte) (bool, error) {
+	return p.sendOrQueueData(seq, message, true)
+}
+
+func (p *Peer) sendOrQueueData(seq uint64, message []byte, hold bool) (bool, error) {
+	p.mu.Lock()
+	dc := p.DataChannel
+	open := dc != nil && dc.ReadyState() == webrtc.DataChannelStateOpen
+	if !open || (hold && p.pendingDataMax > 0) {
+		if p.pendingDataMax <= 0 {
+			p.mu.Unlock()
+			return false, ErrDataChannelNotOpen
+		}
+		if len(p.pendingData) >= p.pendingDataMax {
+			p.pendingData = p.pendingData[1:]
+		}
+		p.pendingData = append(p.pendingData, pendingDataMessage{
+			seq:      seq,
+			data:     message,
+			queuedAt: time.Now(),
+		})
+		p.mu.Unlock()
+		return false, nil
+	}
+	p.mu.Unlock()
+
+	if err := dc.Send(message); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// FlushPendingData sends queued messages that have not expired, skipping any
+// whose sequence number skip reports as already delivered. It returns the
+// number of messages sent.
+func (p *Peer) FlushPendingData(skip func(seq uint64) bool) int {
+	p.mu.Lock()
+	dc := p.DataChannel
+	pending := p.pendingData
+	p.pendingData = nil
+	ttl := p.pendingDataTTL
+	p.mu.Unlock()
+
+	if dc == nil {
+		return 0
+	}
+
+	sent := 0
+	now := time.Now()
+	for _, msg := range pending {
+		if ttl > 0 && now.Sub(msg.queuedAt) > ttl {
+			continue
+		}
+		if skip != nil && skip(msg.seq) {
+			continue
+		}
+		if err := dc.Send(msg.data); err != nil {
+			p.logger.Debug("Failed to flush queued data channel message",
+				zap.String("peerID", p.ID),
+				zap.Error(err),
+			)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// watchDataChannelOpen fires OnDataChannelOpen once dc is open.
+func (p *Peer) watchDataChannelOpen(dc *webrtc.DataChannel) {
+	fire := func() {
+		if p.OnDataChannelOpen != nil {
+			p.OnDataChannelOpen(p, dc)
+		}
+	}
+	dc.OnOpen(fire)
+	if dc.ReadyState() == webrtc.DataChannelStateOpen {
+		fire()
+	}
+}
@@ -0,0 +1,202 @@
+package peer
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// A peer on hopeless connectivity would otherwise restart ICE over and over,
+// each attempt costing signaling and a round of connectivity checks. Every
+// restart, whether the client asked for it or the SFU started it, draws on
+// one budget: at most MaxRestarts per rolling Window, and after each
+// restart that has not yet recovered the connection a cooldown that doubles
+// up to MaxCooldown. A peer that runs out has to reconnect from scratch.
+//
+// The cooldown is aware of the link's signal strength, as measured by the
+// packet loss behind GetConnectionQuality: a restart taken while the
+// connection is critical is followed by one doubling more, since a link
+// that bad seldom recovers at the next attempt.
+
+// Who asked for an ICE restart.
+const (
+	ICERestartByClient = "client"
+	ICERestartByServer = "server"
+	ICERestartByAdmin  = "admin" // an operator, through the admin API
+)
+
+var (
+	// ErrICERestartCooldown refuses a restart asked for during the cooldown
+	// after the previous one.
+	ErrICERestartCooldown = errors.New("ICE restart cooling down")
+	// ErrICERestartBudgetExhausted refuses any further restart of the peer.
+	ErrICERestartBudgetExhausted = errors.New("ICE restart budget exhausted")
+)
+
+// ICERestartBudget limits how often a peer's ICE is restarted.
+type ICERestartBudget struct {
+	MaxRestarts int // per Window; 0 = unlimited
+	Window      time.Duration
+	Cooldown    time.Duration // after the first restart without recovery
+	MaxCooldown time.Duration // 0 = no cap
+}
+
+// ICERestartState is a peer's standing against its restart budget.
+type ICERestartState struct {
+	// Restarts within the budget's window
+	Recent int `json:"recent"`
+	// Restarts since the connection last recovered
+	Consecutive int        `json:"consecutive"`
+	NextAllowed *time.Time `json:"nextAllowed,omitempty"`
+	Exhausted   bool       `json:"exhausted,omitempty"`
+	// Who asked for the restart still waiting for its outcome
+	Pending string `json:"pending,omitempty"`
+	// Connection quality when the last restart was taken
+	Quality string `json:"quality,omitempty"`
+}
+
+// iceRestarts is the budget state of a peer.
+type iceRestarts struct {
+	mu          sync.Mutex
+	budget      ICERestartBudget
+	attempts    []time.Time // within the window, oldest first
+	last        time.Time
+	consecutive int
+	exhausted   bool
+	pending     string
+	quality     string // connection quality at the last restart
+}
+
+// cooldown returns the wait after the consecutive-th restart in a row:
+// Cooldown, doubled for every restart before it, up to MaxCooldown.
+func (b ICERestartBudget) cooldown(consecutive int) time.Duration {
+	if consecutive <= 0 || b.Cooldown <= 0 {
+		return 0
+	}
+	d := b.Cooldown
+	for i := 1; i < consecutive; i++ {
+		if b.MaxCooldown > 0 && d >= b.MaxCooldown {
+			break
+		}
+		d *= 2
+	}
+	if b.MaxCooldown > 0 && d > b.MaxCooldown {
+		d = b.MaxCooldown
+	}
+	return d
+}
+
+// pruneLocked drops the attempts that have left the window ending at now.
+func (s *iceRestarts) pruneLocked(now time.Time) {
+	if s.budget.Window <= 0 {
+		s.attempts = s.attempts[:0]
+		return
+	}
+	i := 0
+	for i < len(s.attempts) && now.Sub(s.attempts[i]) >= s.budget.Window {
+		i++
+	}
+	s.attempts = append(s.attempts[:0], s.attempts[i:]...)
+}
+
+// nextAllowedLocked returns when the cooldown after the last restart ends.
+func (s *iceRestarts) nextAllowedLocked() time.Time {
+	if s.consecutive == 0 {
+		return time.Time{}
+	}
+	steps := s.consecutive
+	if s.quality == "critical" {
+		steps++
+	}
+	return s.last.Add(s.budget.cooldown(steps))
+}
+
+// take counts a restart at now, on a connection of the given quality. A
+// restart during the cooldown is refused with the time left; one over the
+// window's limit exhausts the budget.
+func (s *iceRestarts) take(now time.Time, quality string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exhausted {
+		return 0, ErrICERestartBudgetExhausted
+	}
+	s.pruneLocked(now)
+	if s.budget.MaxRestarts > 0 && len(s.attempts) >= s.budget.MaxRestarts {
+		s.exhausted = true
+		return 0, ErrICERestartBudgetExhausted
+	}
+	if wait := s.nextAllowedLocked().Sub(now); wait > 0 {
+		return wait, ErrICERestartCooldown
+	}
+	s.attempts = append(s.attempts, now)
+	s.last = now
+	s.consecutive++
+	s.quality = quality
+	return 0, nil
+}
+
+// state returns the budget state as of now.
+func (s *iceRestarts) state(now time.Time) ICERestartState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	st := ICERestartState{
+		Recent:      len(s.attempts),
+		Consecutive: s.consecutive,
+		Exhausted:   s.exhausted,
+		Pending:     s.pending,
+		Quality:     s.quality,
+	}
+	if next := s.nextAllowedLocked(); next.After(now) && !s.exhausted {
+		st.NextAllowed = &next
+	}
+	return st
+}
+
+// SetICERestartBudget sets the limits on the peer's ICE restarts.
+func (p *Peer) SetICERestartBudget(budget ICERestartBudget) {
+	p.iceRestarts.mu.Lock()
+	defer p.iceRestarts.mu.Unlock()
+	p.iceRestarts.budget = budget
+}
+
+// BeginICERestart draws a restart asked for by initiator from the peer's
+// budget. It returns ErrICERestartCooldown with how long until one is
+// allowed, or ErrICERestartBudgetExhausted. Once allowed, the restart is
+// pending until the connection recovers or fails, or EndICERestart.
+func (p *Peer) BeginICERestart(initiator string) (time.Duration, error) {
+	var quality string
+	if q := p.GetConnectionQuality(); q != nil {
+		quality = q.Level
+	}
+	wait, err := p.iceRestarts.take(time.Now(), quality)
+	if err != nil {
+		return wait, err
+	}
+	p.iceRestarts.mu.Lock()
+	p.iceRestarts.pending = initiator
+	p.iceRestarts.mu.Unlock()
+	return 0, nil
+}
+
+// EndICERestart ends the pending restart, if any, and fires
+// OnICERestartEnded. Recovery also ends the cooldown doubling.
+func (p *Peer) EndICERestart(recovered bool) {
+	s := &p.iceRestarts
+	s.mu.Lock()
+	initiator := s.pending
+	s.pending = ""
+	if recovered {
+		s.consecutive = 0
+	}
+	s.mu.Unlock()
+
+	if initiator != "" && p.OnICERestartEnded != nil {
+		p.OnICERestartEnded(p, initiator, recovered)
+	}
+}
+
+// ICERestarts returns the peer's standing against its restart budget.
+func (p *Peer) ICERestarts() ICERestartState {
+	return p.iceRestarts.state(time.Now())
+}
@@ -0,0 +1,163 @@
+package peer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestICERestartCooldown(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		budget ICERestartBudget
+		want   []time.Duration // after the 0th, 1st, ... restart in a row
+	}{
+		{
+			name:   "doubling up to the cap",
+			budget: ICERestartBudget{Cooldown: time.Second, MaxCooldown: 8 * time.Second},
+			want:   []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second},
+		},
+		{
+			name:   "cap off the doubling",
+			budget: ICERestartBudget{Cooldown: time.Second, MaxCooldown: 3 * time.Second},
+			want:   []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second},
+		},
+		{
+			name:   "cap below the cooldown",
+			budget: ICERestartBudget{Cooldown: 5 * time.Second, MaxCooldown: 2 * time.Second},
+			want:   []time.Duration{0, 2 * time.Second, 2 * time.Second},
+		},
+		{
+			name:   "no cap",
+			budget: ICERestartBudget{Cooldown: time.Second},
+			want:   []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second},
+		},
+		{
+			name:   "no cooldown",
+			budget: ICERestartBudget{MaxCooldown: time.Minute},
+			want:   []time.Duration{0, 0, 0},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for consecutive, want := range tc.want {
+				if got := tc.budget.cooldown(consecutive); got != want {
+					t.Fatalf("cooldown after %d restarts: %v, want %v", consecutive, got, want)
+				}
+			}
+		})
+	}
+}
+
+// restartClock takes restarts from s at offsets from a fixed start.
+type restartClock struct {
+	s     *iceRestarts
+	start time.Time
+}
+
+func (c restartClock) take(t *testing.T, at time.Duration, quality string, wantWait time.Duration, wantErr error) {
+	t.Helper()
+	wait, err := c.s.take(c.start.Add(at), quality)
+	if !errors.Is(err, wantErr) || wait != wantWait {
+		t.Fatalf("restart at %v: wait %v, %v; want %v, %v", at, wait, err, wantWait, wantErr)
+	}
+}
+
+func TestICERestartBudget(t *testing.T) {
+	c := restartClock{
+		s: &iceRestarts{budget: ICERestartBudget{
+			MaxRestarts: 3, Window: time.Minute, Cooldown: time.Second, MaxCooldown: 4 * time.Second,
+		}},
+		start: time.Unix(1_700_000_000, 0),
+	}
+
+	// Each restart in a row doubles the wait before the next; a refused
+	// one does not count
+	c.take(t, 0, "good", 0, nil)
+	c.take(t, 500*time.Millisecond, "good", 500*time.Millisecond, ErrICERestartCooldown)
+	c.take(t, time.Second, "good", 0, nil)
+	c.take(t, 2500*time.Millisecond, "good", 500*time.Millisecond, ErrICERestartCooldown)
+	st := c.s.state(c.start.Add(2500 * time.Millisecond))
+	if st.Recent != 2 || st.Consecutive != 2 || st.NextAllowed == nil || !st.NextAllowed.Equal(c.start.Add(3*time.Second)) {
+		t.Fatalf("state %+v", st)
+	}
+	c.take(t, 3*time.Second, "good", 0, nil)
+
+	// A fourth within the window exhausts the budget, for good
+	c.take(t, 10*time.Second, "good", 0, ErrICERestartBudgetExhausted)
+	c.take(t, 2*time.Minute, "good", 0, ErrICERestartBudgetExhausted)
+	if st := c.s.state(c.start.Add(2 * time.Minute)); !st.Exhausted || st.NextAllowed != nil || st.Recent != 0 {
+		t.Fatalf("state %+v", st)
+	}
+}
+
+func TestICERestartWindow(t *testing.T) {
+	c := restartClock{
+		s:     &iceRestarts{budget: ICERestartBudget{MaxRestarts: 2, Window: 10 * time.Second}},
+		start: time.Unix(1_700_000_000, 0),
+	}
+	c.take(t, 0, "", 0, nil)
+	c.take(t, time.Second, "", 0, nil)
+	// The first restart leaves the window as the third is taken
+	c.take(t, 10*time.Second, "", 0, nil)
+	if st := c.s.state(c.start.Add(10 * time.Second)); st.Recent != 2 || st.Exhausted {
+		t.Fatalf("state %+v", st)
+	}
+	c.take(t, 10500*time.Millisecond, "", 0, ErrICERestartBudgetExhausted)
+}
+
+func TestICERestartCriticalLink(t *testing.T) {
+	c := restartClock{
+		s:     &iceRestarts{budget: ICERestartBudget{Cooldown: time.Second, MaxCooldown: 8 * time.Second}},
+		start: time.Unix(1_700_000_000, 0),
+	}
+
+	// On a critical link the cooldown doubles once more
+	c.take(t, 0, "critical", 0, nil)
+	c.take(t, time.Second, "critical", time.Second, ErrICERestartCooldown)
+	c.take(t, 2*time.Second, "critical", 0, nil)
+	c.take(t, 4*time.Second, "poor", 2*time.Second, ErrICERestartCooldown)
+	if st := c.s.state(c.start.Add(4 * time.Second)); st.Quality != "critical" || !st.NextAllowed.Equal(c.start.Add(6*time.Second)) {
+		t.Fatalf("state %+v", st)
+	}
+	// and back to the plain doubling once a restart is taken on a better one
+	c.take(t, 6*time.Second, "poor", 0, nil)
+	c.take(t, 9*time.Second, "poor", time.Second, ErrICERestartCooldown)
+	c.take(t, 10*time.Second, "poor", 0, nil)
+}
+
+func TestICERestartRecovery(t *testing.T) {
+	p := NewPeer("room-1", "alice", "", zap.NewNop())
+	p.SetICERestartBudget(ICERestartBudget{Cooldown: time.Second})
+	var ended []bool
+	p.OnICERestartEnded = func(_ *Peer, initiator string, recovered bool) {
+		if initiator != ICERestartByServer {
+			t.Errorf("restart ended for %q", initiator)
+		}
+		ended = append(ended, recovered)
+	}
+
+	if _, err := p.BeginICERestart(ICERestartByServer); err != nil {
+		t.Fatal(err)
+	}
+	if st := p.ICERestarts(); st.Pending != ICERestartByServer || st.Consecutive != 1 {
+		t.Fatalf("state %+v", st)
+	}
+	if wait, err := p.BeginICERestart(ICERestartByClient); !errors.Is(err, ErrICERestartCooldown) || wait <= 0 || wait > time.Second {
+		t.Fatalf("restart during the cooldown: %v, %v", wait, err)
+	}
+
+	// Recovery ends the doubling, and the cooldown with it
+	p.EndICERestart(true)
+	p.EndICERestart(true)
+	if st := p.ICERestarts(); st.Pending != "" || st.Consecutive != 0 || st.NextAllowed != nil {
+		t.Fatalf("state %+v", st)
+	}
+	if len(ended) != 1 || !ended[0] {
+		t.Fatalf("restart ended %v, want once, recovered", ended)
+	}
+	if _, err := p.BeginICERestart(ICERestartByClient); err != nil {
+		t.Fatal(err)
+	}
+}
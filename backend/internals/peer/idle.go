@@ -0,0 +1,74 @@
+package peer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// activity holds the timestamps idle detection works from, as unix
+// nanoseconds. They are written from the media path, so they are atomics
+// rather than guarded by mu.
+type activity struct {
+	reportAt   atomic.Int64 // last RTCP receiver report from the peer
+	sentAt     atomic.Int64 // last RTP forwarded to the peer
+	receivedAt atomic.Int64 // last RTP on the peer's own tracks
+	idleSince  atomic.Int64 // when the peer was found idle; 0 when it is not
+}
+
+func loadTime(v *atomic.Int64) time.Time {
+	if n := v.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// TouchReceiverReport records an RTCP receiver report for media sent to the peer.
+func (p *Peer) TouchReceiverReport() {
+	p.activity.reportAt.Store(time.Now().UnixNano())
+}
+
+// TouchMediaSent records RTP forwarded to the peer.
+func (p *Peer) TouchMediaSent() {
+	p.activity.sentAt.Store(time.Now().UnixNano())
+}
+
+// TouchMediaReceived records RTP arriving on one of the peer's tracks.
+func (p *Peer) TouchMediaReceived() {
+	p.activity.receivedAt.Store(time.Now().UnixNano())
+}
+
+// Idle reports whether media is being forwarded to the peer while, for at
+// least timeout, it has sent no receiver reports, published no media of its
+// own and had no signaling activity (lastSignal). A peer nothing is
+// forwarded to is never idle: it holds no bandwidth.
+func (p *Peer) Idle(now, lastSignal time.Time, timeout time.Duration) bool {
+	if now.Sub(loadTime(&p.activity.sentAt)) >= timeout {
+		return false
+	}
+	last := lastSignal
+	for _, t := range []time.Time{loadTime(&p.activity.reportAt), loadTime(&p.activity.receivedAt)} {
+		if t.After(last) {
+			last = t
+		}
+	}
+	return now.Sub(last) >= timeout
+}
+
+// MarkIdle records that the peer was found idle at now. It returns when the
+// peer first became idle, and whether that was this call.
+func (p *Peer) MarkIdle(now time.Time) (time.Time, bool) {
+	if p.activity.idleSince.CompareAndSwap(0, now.UnixNano()) {
+		return now, true
+	}
+	return loadTime(&p.activity.idleSince), false
+}
+
+// ClearIdle ends the peer's idle state and reports whether it was idle.
+func (p *Peer) ClearIdle() bool {
+	return p.activity.idleSince.Swap(0) != 0
+}
+
+// IdleSince returns when the peer became idle, or the zero time if it is not.
+func (p *Peer) IdleSince() time.Time {
+	return loadTime(&p.activity.idleSince)
+}
@@ -0,0 +1,114 @@
+package peer
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestIdle(t *testing.T) {
+	const timeout = time.Minute
+	start := time.Now()
+	at := func(v *atomic.Int64, d time.Duration) { v.Store(start.Add(d).UnixNano()) }
+
+	for _, tc := range []struct {
+		name       string
+		setup      func(p *Peer)
+		lastSignal time.Duration
+		now        time.Duration
+		want       bool
+	}{
+		{
+			name: "new peer",
+			setup: func(p *Peer) {
+				p.TouchReceiverReport()
+				at(&p.activity.sentAt, timeout-time.Second)
+			},
+			now: timeout - time.Second,
+		},
+		{
+			name:  "nothing forwarded",
+			setup: func(p *Peer) {},
+			now:   2 * timeout,
+		},
+		{
+			name:  "forwarding stopped",
+			setup: func(p *Peer) { at(&p.activity.sentAt, 0) },
+			now:   timeout,
+		},
+		{
+			name:  "consuming without reports",
+			setup: func(p *Peer) { at(&p.activity.sentAt, timeout) },
+			now:   timeout,
+			want:  true,
+		},
+		{
+			name: "receiver report",
+			setup: func(p *Peer) {
+				at(&p.activity.sentAt, timeout)
+				at(&p.activity.reportAt, time.Second)
+			},
+			now: timeout,
+		},
+		{
+			name: "old receiver report",
+			setup: func(p *Peer) {
+				at(&p.activity.sentAt, 2*timeout)
+				at(&p.activity.reportAt, time.Second)
+			},
+			now:  timeout + time.Second,
+			want: true,
+		},
+		{
+			name: "publishing",
+			setup: func(p *Peer) {
+				at(&p.activity.sentAt, timeout)
+				at(&p.activity.receivedAt, time.Second)
+			},
+			now: timeout,
+		},
+		{
+			name:       "signaling",
+			setup:      func(p *Peer) { at(&p.activity.sentAt, timeout) },
+			lastSignal: time.Second,
+			now:        timeout,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewPeer("room-1", "alice", "Alice", zap.NewNop())
+			// Cases start from no report, rather than the one of NewPeer
+			p.activity.reportAt.Store(0)
+			tc.setup(p)
+			if got := p.Idle(start.Add(tc.now), start.Add(tc.lastSignal), timeout); got != tc.want {
+				t.Fatalf("Idle = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMarkIdle(t *testing.T) {
+	p := NewPeer("room-1", "alice", "Alice", zap.NewNop())
+	start := time.Now()
+	if !p.IdleSince().IsZero() || p.ClearIdle() {
+		t.Fatal("a new peer is idle")
+	}
+
+	since, newly := p.MarkIdle(start)
+	if !newly || !since.Equal(start) {
+		t.Fatalf("first MarkIdle = %v, %v", since, newly)
+	}
+	// Later checks keep the time it became idle, which the grace runs from
+	since, newly = p.MarkIdle(start.Add(time.Minute))
+	if newly || !since.Equal(start) || !p.IdleSince().Equal(start) {
+		t.Fatalf("second MarkIdle = %v, %v", since, newly)
+	}
+
+	if !p.ClearIdle() || !p.IdleSince().IsZero() {
+		t.Fatal("ClearIdle did not end the idle state")
+	}
+	if _, newly := p.MarkIdle(start.Add(2 * time.Minute)); !newly {
+		t.Fatal("becoming idle again is not reported as new")
+	}
+}
@@ -0,0 +1,36 @@
+package peer
+
+// MediaState is what a participant reports about its own devices. The mic
+// state is also enforced: audio from a peer whose mic is disabled is not
+// forwarded.
+type MediaState struct {
+	MicEnabled    bool `json:"micEnabled"`
+	CameraEnabled bool `json:"cameraEnabled"`
+	ScreenEnabled bool `json:"screenEnabled"`
+}
+
+// defaultMediaState matches a new session's media state.
+var defaultMediaState = MediaState{MicEnabled: true, CameraEnabled: true}
+
+// GetMediaState returns the peer's current media state.
+func (p *Peer) GetMediaState() MediaState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.mediaState
+}
+
+// UpdateMediaState applies update to the peer's media state and returns the
+// result. Mic changes take effect on the next forwarded packet.
+func (p *Peer) UpdateMediaState(update func(*MediaState)) MediaState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	update(&p.mediaState)
+	p.micMuted.Store(!p.mediaState.MicEnabled)
+	return p.mediaState
+}
+
+// MicMuted reports whether the peer's audio is being withheld. It is read on
+// every forwarded audio packet, so it does not take the peer lock.
+func (p *Peer) MicMuted() bool {
+	return p.micMuted.Load()
+}
@@ -1,8 +1,12 @@
 package peer
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -40,7 +44,27 @@ type Peer struct {
 	ID          string                 `json:"id"`
 	RoomID      string                 `json:"roomId"`
 	UserID      string                 `json:"userId"`
-	Name        string                 `json:"name"`
+	Name        string                 `json:"name"` // may change during the call; read with GetName
+	Observer    bool                   `json:"observer,omitempty"` // hidden, receive-only; set before joining
+	// Viewer is an audience member of a broadcast room: receive-only and
+	// counted rather than announced; set before joining
+	Viewer bool `json:"viewer,omitempty"`
+	// ManualSubscribe peers receive only the tracks they subscribe to,
+	// rather than everything published in the room; set before joining
+	ManualSubscribe bool `json:"manualSubscribe,omitempty"`
+	// MaxTracks caps the tracks the peer may publish at once (0 = no
+	// per-peer cap); set before joining
+	MaxTracks int `json:"maxTracks,omitempty"`
+	// AuthToken is the token the peer joined with, for the authorizer's
+	// publish and subscribe checks; set before joining
+	AuthToken   string                 `json:"-"`
+	// Resumed is set when the peer replaces one of the same session, whose
+	// client is told what each forwarded m-line carries after its first
+	// answer; set before joining
+	Resumed     bool                   `json:"-"`
+	// Reconnected is set when the peer took over the ID of the user's
+	// previous peer (see room.ReplacePeer)
+	Reconnected bool                   `json:"-"`
 	Connection  *webrtc.PeerConnection `json:"-"`
 	DataChannel *webrtc.DataChannel    `json:"-"`
 
@@ -53,6 +77,15 @@ type Peer struct {
 	pendingCandidates []webrtc.ICECandidateInit
 	remoteDescSet     bool
 
+	// Codecs of the last remote description by lower-cased MIME type; nil
+	// until one has been applied
+	remoteCodecs map[string][]webrtc.RTPCodecCapability
+
+	// Data channel messages held until the channel opens
+	pendingData    []pendingDataMessage
+	pendingDataMax int
+	pendingDataTTL time.Duration
+
 	// State management
 	Connected bool                   `json:"connected"`
 	LastSeen  time.Time              `json:"lastSeen"`
@@ -62,42 +95,133 @@ type Peer struct {
 	mu              sync.RWMutex
 	disconnectedOnce sync.Once
 
+	// Serializes adding and releasing forwarding senders, which pick their
+	// transceiver from Pion's view of the descriptions (see transceiver.go)
+	sendersMu sync.Mutex
+
 	// Perfect negotiation state (server is impolite)
 	makingOffer      bool
 	ignoreOffer      bool
 	isSettingRemote  bool
 	inRenegotiation  bool // SFU is currently renegotiating with this peer
+	negotiated       bool // first offer/answer exchange has completed
+	noTrickle        bool // client needs every candidate in the SDP
 
 	// Network and bandwidth management
 	networkCondition NetworkCondition
 	bandwidthLimit   uint32 // bits per second, 0 = unlimited
 
+	// Why the peer is being removed, announced with peer-left
+	leaveReason string
+
+	// Publishing window (see publishwindow.go): when it ends, the timer
+	// that ends it, and whether it has ended
+	publishUntil   time.Time
+	publishTimer   *time.Timer
+	publishRevoked atomic.Bool
+
+	// Reported device state; micMuted mirrors !mediaState.MicEnabled for
+	// the forwarding path
+	mediaState MediaState
+	micMuted   atomic.Bool
+
+	// Media and RTCP activity for idle detection
+	activity activity
+
+	// When the PeerConnection last became connected; zero while it is not
+	connectedAt time.Time
+
+	// Negotiated incoming tracks that have not produced RTP yet
+	trackStalls map[string]*trackStall
+
+	// FIR command sequence numbers per media SSRC
+	firSeqNums map[uint32]uint8
+
+	// SSRC-group simulcast and other WebKit quirks (see webkit.go)
+	webkit webkitState
+
+	// ICE restart budget (see icerestart.go)
+	iceRestarts iceRestarts
+
 	logger          *zap.Logger
 
+	// How long a dropped connection may take to recover before the peer is
+	// removed; holdOnFailure extends the grace to the failed state so an ICE
+	// restart can still recover it.
+	disconnectGrace time.Duration
+	holdOnFailure   bool
+
+	// Cancelled by Close; everything started on the peer's behalf stops with it
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	// Callbacks
 	OnTrackAdded              func(*Peer, *webrtc.TrackRemote, *webrtc.RTPReceiver)
 	OnTrackRemoved            func(*Peer, string)
 	OnDataChannel             func(*Peer, *webrtc.DataChannel)
+	OnDataChannelOpen         func(*Peer, *webrtc.DataChannel)
 	OnDisconnected            func(*Peer)
+	OnConnectionInterrupted   func(*Peer) // connection dropped, grace period started
+	OnConnectionRestored      func(*Peer) // connection recovered within the grace
+	OnNegotiated              func(*Peer) // first offer/answer exchange completed, see MarkNegotiated
 	OnICECandidateGenerated   func(*Peer, *webrtc.ICECandidate)
 	OnNetworkConditionChanged func(*Peer, NetworkCondition)
+	OnTrackStalled            func(p *Peer, trackID, kind string, stalled bool) // see WatchIncomingTracks
+	OnICERestartEnded         func(p *Peer, initiator string, recovered bool)   // see BeginICERestart
+	OnConnectionStateNotify   func(*Peer, webrtc.PeerConnectionState)           // every connection state change
 }
 
 func NewPeer(roomID, userID, name string, logger *zap.Logger) *Peer {
-	return &Peer{
-		ID:                uuid.New().String(),
+	return NewPeerWithID(uuid.New().String(), roomID, userID, name, logger)
+}
+
+// NewPeerWithID creates a peer with a given ID rather than a random one, as
+// when a reconnect keeps its peer ID.
+func NewPeerWithID(id, roomID, userID, name string, logger *zap.Logger) *Peer {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Peer{
+		ID:                id,
 		RoomID:            roomID,
 		UserID:            userID,
 		Name:              name,
 		LocalTracks:       make(map[string]*webrtc.TrackLocalStaticRTP),
 		RemoteTracks:      make(map[string]*webrtc.TrackRemote),
 		TrackInfos:        make(map[string]*TrackInfo),
+		trackStalls:       make(map[string]*trackStall),
+		mediaState:        defaultMediaState,
 		pendingCandidates: make([]webrtc.ICECandidateInit, 0),
 		Connected:         false,
 		LastSeen:          time.Now(),
 		Metadata:          make(map[string]interface{}),
 		logger:            logger,
+		disconnectGrace:   defaultDisconnectGrace,
+		ctx:               ctx,
+		cancel:            cancel,
 	}
+	// A new peer gets a full idle timeout before its first report is due
+	p.TouchReceiverReport()
+	return p
+}
+
+// defaultDisconnectGrace applies when SetDisconnectGrace is not called.
+const defaultDisconnectGrace = 7 * time.Second
+
+// SetDisconnectGrace sets how long a dropped connection may take to recover
+// before OnDisconnected fires. With holdOnFailure, a failed connection gets
+// the same grace instead of being torn down immediately.
+func (p *Peer) SetDisconnectGrace(grace time.Duration, holdOnFailure bool) {
+	if grace <= 0 {
+		grace = defaultDisconnectGrace
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.disconnectGrace = grace
+	p.holdOnFailure = holdOnFailure
+}
+
+// Context is cancelled when the peer is closed.
+func (p *Peer) Context() context.Context {
+	return p.ctx
 }
 
 func (p *Peer) CreatePeerConnection(api *webrtc.API, config webrtc.Configuration) error {
@@ -124,39 +248,7 @@ func (p *Peer) CreatePeerConnection(api *webrtc.API, config webrtc.Configuration
 }
 
 func (p *Peer) setupPeerConnectionHandlers() {
-	p.Connection.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
-		p.mu.Lock()
-		trackID := track.ID()
-		p.RemoteTracks[trackID] = track
-
-		mediaType := MediaTypeAudio
-		if track.Kind() == webrtc.RTPCodecTypeVideo {
-			if track.StreamID() == "screen" {
-				mediaType = MediaTypeScreen
-			} else {
-				mediaType = MediaTypeVideo
-			}
-		}
-
-		p.TrackInfos[trackID] = &TrackInfo{
-			ID:        trackID,
-			Kind:      track.Kind().String(),
-			MediaType: mediaType,
-			Label:     track.StreamID(),
-			Enabled:   true,
-		}
-		p.mu.Unlock()
-
-		p.logger.Info("Track added",
-			zap.String("peerID", p.ID),
-			zap.String("trackID", trackID),
-			zap.String("kind", track.Kind().String()),
-		)
-
-		if p.OnTrackAdded != nil {
-			p.OnTrackAdded(p, track, receiver)
-		}
-	})
+	p.Connection.OnTrack(p.handleTrack)
 
 	p.Connection.OnDataChannel(func(dc *webrtc.DataChannel) {
 		p.mu.Lock()
@@ -171,21 +263,33 @@ func (p *Peer) setupPeerConnectionHandlers() {
 		if p.OnDataChannel != nil {
 			p.OnDataChannel(p, dc)
 		}
+		p.watchDataChannelOpen(dc)
 	})
 
 	var disconnectTimer *time.Timer
+	var interrupted bool // connection dropped after being established; guarded by timerMu
 	var timerMu sync.Mutex
 	p.Connection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		p.mu.Lock()
 		wasConnected := p.Connected
 		p.Connected = state == webrtc.PeerConnectionStateConnected
 		p.LastSeen = time.Now()
+		if !p.Connected {
+			p.connectedAt = time.Time{}
+		} else if !wasConnected {
+			p.connectedAt = p.LastSeen
+		}
+		grace := p.disconnectGrace
+		holdOnFailure := p.holdOnFailure
 		p.mu.Unlock()
 
 		p.logger.Info("Connection state changed",
 			zap.String("peerID", p.ID),
 			zap.String("state", state.String()),
 		)
+		if p.OnConnectionStateNotify != nil {
+			p.OnConnectionStateNotify(p, state)
+		}
 
 		// Cancel pending disconnect timer if connection recovers
 		if state == webrtc.PeerConnectionStateConnected {
@@ -194,17 +298,30 @@ func (p *Peer) setupPeerConnectionHandlers() {
 				disconnectTimer.Stop()
 				disconnectTimer = nil
 			}
+			restored := interrupted
+			interrupted = false
 			timerMu.Unlock()
+
+			p.EndICERestart(true)
+
+			if restored && p.OnConnectionRestored != nil {
+				p.OnConnectionRestored(p)
+			}
 			return
 		}
 
-		if !wasConnected || p.OnDisconnected == nil {
+		if p.OnDisconnected == nil {
 			return
 		}
 
-		if state == webrtc.PeerConnectionStateFailed ||
-			state == webrtc.PeerConnectionStateClosed {
-			timerMu.Lock()
+		timerMu.Lock()
+		if !wasConnected && !interrupted {
+			timerMu.Unlock()
+			return
+		}
+
+		if state == webrtc.PeerConnectionStateClosed ||
+			(state == webrtc.PeerConnectionStateFailed && !holdOnFailure) {
 			if disconnectTimer != nil {
 				disconnectTimer.Stop()
 				disconnectTimer = nil
@@ -216,29 +333,43 @@ func (p *Peer) setupPeerConnectionHandlers() {
 					zap.String("peerID", p.ID),
 					zap.String("state", state.String()),
 				)
+				p.EndICERestart(false)
 				p.OnDisconnected(p)
 			})
-		} else if state == webrtc.PeerConnectionStateDisconnected {
-			// ICE disconnected is often transient — give it time to recover
-			timerMu.Lock()
-			if disconnectTimer == nil {
-				disconnectTimer = time.AfterFunc(7*time.Second, func() {
-					p.mu.RLock()
-					stillDisconnected := !p.Connected
-					p.mu.RUnlock()
-					if stillDisconnected {
-						p.disconnectedOnce.Do(func() {
-							p.logger.Info("Peer stayed disconnected, removing",
-								zap.String("peerID", p.ID),
-							)
-							if p.OnDisconnected != nil {
-								p.OnDisconnected(p)
-							}
-						})
-					}
-				})
-			}
+			return
+		}
+
+		if state != webrtc.PeerConnectionStateDisconnected &&
+			state != webrtc.PeerConnectionStateFailed {
 			timerMu.Unlock()
+			return
+		}
+
+		// ICE disconnected is often transient, and a failed connection can
+		// still be recovered by an ICE restart — give it time to recover
+		first := !interrupted
+		interrupted = true
+		if disconnectTimer == nil {
+			disconnectTimer = time.AfterFunc(grace, func() {
+				p.mu.RLock()
+				stillDisconnected := !p.Connected
+				p.mu.RUnlock()
+				if stillDisconnected {
+					p.disconnectedOnce.Do(func() {
+						p.logger.Info("Peer stayed disconnected, removing",
+							zap.String("peerID", p.ID),
+							zap.Duration("grace", grace),
+						)
+						p.EndICERestart(false)
+						p.OnDisconnected(p)
+					})
+				}
+			})
+		}
+		timerMu.Unlock()
+
+		if first && p.OnConnectionInterrupted != nil {
+			p.OnConnectionInterrupted(p)
 		}
 	})
 
@@ -259,13 +390,69 @@ func (p *Peer) setupPeerConnectionHandlers() {
 	})
 }
 
+// handleTrack records an incoming track, or simulcast layer of one, and
+// announces it through OnTrackAdded.
+func (p *Peer) handleTrack(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+	layer := p.RemoteLayer(track)
+	trackID := layer.TrackID
+
+	p.mu.Lock()
+	p.RemoteTracks[trackID] = track
+	wasStalled := p.clearTrackStall(trackID)
+
+	mediaType := MediaTypeAudio
+	if track.Kind() == webrtc.RTPCodecTypeVideo {
+		if layer.StreamID == "screen" {
+			mediaType = MediaTypeScreen
+		} else {
+			mediaType = MediaTypeVideo
+		}
+	}
+
+	p.TrackInfos[trackID] = &TrackInfo{
+		ID:        trackID,
+		Kind:      track.Kind().String(),
+		MediaType: mediaType,
+		Label:     layer.StreamID,
+		Enabled:   true,
+	}
+	p.mu.Unlock()
+
+	p.logger.Info("Track added",
+		zap.String("peerID", p.ID),
+		zap.String("trackID", trackID),
+		zap.String("kind", track.Kind().String()),
+		zap.String("rid", layer.RID),
+	)
+
+	if wasStalled {
+		p.logger.Info("Stalled track started producing RTP",
+			zap.String("peerID", p.ID),
+			zap.String("trackID", trackID),
+		)
+		if p.OnTrackStalled != nil {
+			p.OnTrackStalled(p, trackID, track.Kind().String(), false)
+		}
+	}
+
+	if p.OnTrackAdded != nil {
+		p.OnTrackAdded(p, track, receiver)
+	}
+}
+
+// AddTrack attaches a forwarded track. A free transceiver of the same kind
+// the client receives on (a client-provided recvonly slot, or one freed by
+// ReleaseSender and since renegotiated) is reused before a new sendonly one
+// is created, which keeps the m-line count stable across churn.
 func (p *Peer) AddTrack(track *webrtc.TrackLocalStaticRTP) (*webrtc.RTPSender, error) {
 	p.mu.Lock()
 	pc := p.Connection
 	p.mu.Unlock()
 
 	// Call pion API without holding the lock to avoid deadlocks with OnTrack callbacks
-	sender, err := pc.AddTrack(track)
+	p.sendersMu.Lock()
+	sender, err := addForwardingSender(pc, track)
+	p.sendersMu.Unlock()
 	if err != nil {
 		return nil, err
 	}
@@ -277,13 +464,60 @@ func (p *Peer) AddTrack(track *webrtc.TrackLocalStaticRTP) (*webrtc.RTPSender, e
 	return sender, nil
 }
 
-func (p *Peer) RemoveTrack(trackID string) error {
+// ReleaseSender stops a forwarded track's sender while keeping its transceiver
+// (and therefore its m-line) in place. The transceiver turns recvonly or
+// inactive and becomes reusable by AddTrack, so the next offer from the client
+// still lines up with our local description. If the client no longer
+// receives on the m-line, nothing can be forwarded on it again, so the
+// transceiver is stopped instead and stays in place as inactive.
+func (p *Peer) ReleaseSender(sender *webrtc.RTPSender) error {
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	pc := p.Connection
+	if track := sender.Track(); track != nil {
+		delete(p.LocalTracks, track.ID())
+	}
+	p.mu.Unlock()
+
+	if pc == nil {
+		return nil
+	}
+	p.sendersMu.Lock()
+	defer p.sendersMu.Unlock()
+	for _, t := range pc.GetTransceivers() {
+		if t.Sender() != sender {
+			continue
+		}
+		if t.Mid() != "" && !clientReceives(pc, t) {
+			return t.Stop()
+		}
+		break
+	}
+	return pc.RemoveTrack(sender)
+}
+
+// RollbackRemoteDescription abandons a remote offer that could not be
+// applied, returning the signaling state to stable.
+func (p *Peer) RollbackRemoteDescription() error {
+	p.mu.RLock()
+	pc := p.Connection
+	p.mu.RUnlock()
 
+	if pc == nil {
+		return fmt.Errorf("peer connection not initialized")
+	}
+	if pc.SignalingState() == webrtc.SignalingStateStable {
+		return nil
+	}
+	return pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeRollback})
+}
+
+func (p *Peer) RemoveTrack(trackID string) error {
+	p.mu.Lock()
 	delete(p.LocalTracks, trackID)
 	delete(p.TrackInfos, trackID)
+	p.mu.Unlock()
 
+	// Called unlocked: the room takes its own lock to detach the track
 	if p.OnTrackRemoved != nil {
 		p.OnTrackRemoved(p, trackID)
 	}
@@ -291,6 +525,16 @@ func (p *Peer) RemoveTrack(trackID string) error {
 	return nil
 }
 
+// ForgetTrack drops a published track the room no longer reads, without
+// reporting it removed: the room replaced it with another of the peer's
+// tracks.
+func (p *Peer) ForgetTrack(trackID string) {
+	p.mu.Lock()
+	delete(p.RemoteTracks, trackID)
+	delete(p.TrackInfos, trackID)
+	p.mu.Unlock()
+}
+
 func (p *Peer) GetTrackInfo(trackID string) (*TrackInfo, bool) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -322,6 +566,20 @@ func (p *Peer) SendDataChannelMessage(message []byte) error {
 	return dc.Send(message)
 }
 
+// GetName returns the peer's display name.
+func (p *Peer) GetName() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.Name
+}
+
+// SetName changes the peer's display name during the call.
+func (p *Peer) SetName(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Name = name
+}
+
 func (p *Peer) SetMetadata(key string, value interface{}) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -344,6 +602,32 @@ func (p *Peer) IsConnected() bool {
 	return p.Connected
 }
 
+// ICETransportPolicy returns the candidate policy the PeerConnection was
+// created with.
+func (p *Peer) ICETransportPolicy() webrtc.ICETransportPolicy {
+	if p.Connection == nil {
+		return webrtc.ICETransportPolicyAll
+	}
+	return p.Connection.GetConfiguration().ICETransportPolicy
+}
+
+// SelectedCandidatePair returns the ICE candidate pair the PeerConnection
+// sends on, or nil until one is selected.
+func (p *Peer) SelectedCandidatePair() *webrtc.ICECandidatePair {
+	if p.Connection == nil {
+		return nil
+	}
+	dtls := p.Connection.SCTP().Transport()
+	if dtls == nil {
+		return nil
+	}
+	pair, err := dtls.ICETransport().GetSelectedCandidatePair()
+	if err != nil {
+		return nil
+	}
+	return pair
+}
+
 // AddICECandidate queues the candidate if remote description isn't set yet,
 // otherwise adds it directly.
 func (p *Peer) AddICECandidate(candidate webrtc.ICECandidateInit) error {
@@ -372,8 +656,13 @@ func (p *Peer) SetRemoteDescription(desc webrtc.SessionDescription) error {
 		return err
 	}
 
+	codecs := parseCodecs(desc)
+
 	p.mu.Lock()
 	p.remoteDescSet = true
+	if codecs != nil {
+		p.remoteCodecs = codecs
+	}
 	pending := make([]webrtc.ICECandidateInit, len(p.pendingCandidates))
 	copy(pending, p.pendingCandidates)
 	p.pendingCandidates = p.pendingCandidates[:0]
@@ -391,6 +680,78 @@ func (p *Peer) SetRemoteDescription(desc webrtc.SessionDescription) error {
 	return nil
 }
 
+// SupportsCodec reports whether the peer's SDP offered mimeType (e.g.
+// "video/H264"). Before any remote description it assumes support.
+func (p *Peer) SupportsCodec(mimeType string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.remoteCodecs == nil {
+		return true
+	}
+	return len(p.remoteCodecs[strings.ToLower(mimeType)]) > 0
+}
+
+// RemoteCodecs returns the clock rates, channels and fmtp lines the peer's
+// SDP listed for mimeType, one per payload type. known is false before any
+// remote description.
+func (p *Peer) RemoteCodecs(mimeType string) (codecs []webrtc.RTPCodecCapability, known bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.remoteCodecs == nil {
+		return nil, false
+	}
+	return append([]webrtc.RTPCodecCapability(nil), p.remoteCodecs[strings.ToLower(mimeType)]...), true
+}
+
+// parseCodecs collects the codecs listed in an offer or answer's rtpmap
+// attributes, with the fmtp of their payload types.
+func parseCodecs(desc webrtc.SessionDescription) map[string][]webrtc.RTPCodecCapability {
+	if desc.Type != webrtc.SDPTypeOffer && desc.Type != webrtc.SDPTypeAnswer {
+		return nil
+	}
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		return nil
+	}
+	codecs := make(map[string][]webrtc.RTPCodecCapability)
+	for _, md := range parsed.MediaDescriptions {
+		fmtps := make(map[string]string)
+		for _, attr := range md.Attributes {
+			if attr.Key != "fmtp" {
+				continue
+			}
+			// "<payload type> <parameters>"
+			if pt, params, ok := strings.Cut(attr.Value, " "); ok {
+				fmtps[pt] = strings.TrimSpace(params)
+			}
+		}
+		for _, attr := range md.Attributes {
+			if attr.Key != "rtpmap" {
+				continue
+			}
+			// "<payload type> <encoding name>/<clock rate>[/<channels>]"
+			fields := strings.Fields(attr.Value)
+			if len(fields) < 2 {
+				continue
+			}
+			encoding := strings.Split(fields[1], "/")
+			mimeType := md.MediaName.Media + "/" + encoding[0]
+			codec := webrtc.RTPCodecCapability{MimeType: mimeType, SDPFmtpLine: fmtps[fields[0]]}
+			if len(encoding) > 1 {
+				rate, _ := strconv.ParseUint(encoding[1], 10, 32)
+				codec.ClockRate = uint32(rate)
+			}
+			if len(encoding) > 2 {
+				channels, _ := strconv.ParseUint(encoding[2], 10, 16)
+				codec.Channels = uint16(channels)
+			}
+			key := strings.ToLower(mimeType)
+			codecs[key] = append(codecs[key], codec)
+		}
+	}
+	return codecs
+}
+
 // --- Perfect Negotiation (Server = Impolite) ---
 
 // ShouldIgnoreOffer returns true if we should ignore incoming offer (we're mid-negotiation)
@@ -476,12 +837,33 @@ func (p *Peer) RequestICERestart() (*webrtc.SessionDescription, error) {
 	return &offer, nil
 }
 
+// PendingOffer returns the SFU's offer still waiting for an answer, such as
+// an ICE restart whose signaling connection dropped, or nil.
+func (p *Peer) PendingOffer() *webrtc.SessionDescription {
+	p.mu.RLock()
+	pc := p.Connection
+	p.mu.RUnlock()
+
+	if pc == nil || pc.SignalingState() != webrtc.SignalingStateHaveLocalOffer {
+		return nil
+	}
+	return pc.PendingLocalDescription()
+}
+
 func (p *Peer) Close() error {
+	p.cancel()
+
 	p.mu.Lock()
 	pc := p.Connection
 	p.LocalTracks = make(map[string]*webrtc.TrackLocalStaticRTP)
 	p.RemoteTracks = make(map[string]*webrtc.TrackRemote)
 	p.TrackInfos = make(map[string]*TrackInfo)
+	for trackID := range p.trackStalls {
+		p.clearTrackStall(trackID)
+	}
+	if p.publishTimer != nil {
+		p.publishTimer.Stop()
+	}
 	p.mu.Unlock()
 
 	if pc != nil {
@@ -507,6 +889,47 @@ func (p *Peer) SetInRenegotiation(v bool) {
 	p.inRenegotiation = v
 }
 
+// MarkNegotiated records that an offer/answer exchange has completed, its
+// answer sent, and calls OnNegotiated the first time. It is not detected
+// from the signaling state: pion reports stable before the answer is out,
+// and tracks attached from OnNegotiated would then ask for a renegotiation
+// ahead of it.
+func (p *Peer) MarkNegotiated() {
+	p.mu.Lock()
+	first := !p.negotiated
+	p.negotiated = true
+	p.mu.Unlock()
+
+	if first {
+		p.logger.Debug("Initial negotiation completed", zap.String("peerID", p.ID))
+		if p.OnNegotiated != nil {
+			p.OnNegotiated(p)
+		}
+	}
+}
+
+// HasNegotiated reports whether the first offer/answer exchange has completed.
+func (p *Peer) HasNegotiated() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.negotiated
+}
+
+// DisableTrickle marks the client as unable to trickle ICE. It applies to
+// every later negotiation with this peer.
+func (p *Peer) DisableTrickle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.noTrickle = true
+}
+
+// TrickleDisabled reports whether candidates must be sent inside the SDP.
+func (p *Peer) TrickleDisabled() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.noTrickle
+}
+
 // IsInRenegotiation returns whether SFU is currently renegotiating
 func (p *Peer) IsInRenegotiation() bool {
 	p.mu.RLock()
@@ -556,6 +979,20 @@ func (p *Peer) GetBandwidthLimit() uint32 {
 	return p.bandwidthLimit
 }
 
+// SetLeaveReason records why the peer is about to be removed.
+func (p *Peer) SetLeaveReason(reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.leaveReason = reason
+}
+
+// LeaveReason returns the reason set by SetLeaveReason, if any.
+func (p *Peer) LeaveReason() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.leaveReason
+}
+
 func (p *Peer) SendPLI(ssrc uint32) error {
 	p.mu.RLock()
 	pc := p.Connection
@@ -572,12 +1009,49 @@ func (p *Peer) SendPLI(ssrc uint32) error {
 	return pc.WriteRTCP(pli)
 }
 
+// SendFIR sends a Full Intra Request for ssrc. Unlike PLI, FIR carries a
+// command sequence number that must advance for every new request to the same
+// source, otherwise the sender treats it as a retransmission and ignores it.
+func (p *Peer) SendFIR(ssrc uint32) error {
+	p.mu.Lock()
+	pc := p.Connection
+	if p.firSeqNums == nil {
+		p.firSeqNums = make(map[uint32]uint8)
+	}
+	seq := p.firSeqNums[ssrc]
+	p.firSeqNums[ssrc] = seq + 1
+	p.mu.Unlock()
+
+	if pc == nil {
+		return fmt.Errorf("peer connection not initialized")
+	}
+
+	return pc.WriteRTCP([]rtcp.Packet{newFIR(ssrc, seq)})
+}
+
+// newFIR builds a Full Intra Request for ssrc with the given command
+// sequence number.
+func newFIR(ssrc uint32, seq uint8) *rtcp.FullIntraRequest {
+	return &rtcp.FullIntraRequest{
+		MediaSSRC: ssrc,
+		FIR:       []rtcp.FIREntry{{SSRC: ssrc, SequenceNumber: seq}},
+	}
+}
+
 // ConnectionQuality holds quality metrics for this peer's connection.
 type ConnectionQuality struct {
 	Level      string  `json:"level"`
 	PacketLoss float64 `json:"packetLoss"`
 }
 
+// ConnectedSince returns when the PeerConnection last became connected, or
+// the zero time while it is not connected.
+func (p *Peer) ConnectedSince() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.connectedAt
+}
+
 // GetConnectionQuality computes connection quality from WebRTC stats.
 func (p *Peer) GetConnectionQuality() *ConnectionQuality {
 	p.mu.RLock()
@@ -0,0 +1,60 @@
+package peer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/pion/rtcp"
+	"go.uber.org/zap"
+)
+
+func TestNewFIR(t *testing.T) {
+	data, err := newFIR(0x11223344, 7).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 5104 4.3.1: a payload-specific feedback message, FMT 4, with one
+	// FCI entry of the requested SSRC and the command sequence number
+	if len(data) != 20 {
+		t.Fatalf("FIR is %d bytes, want 20", len(data))
+	}
+	if data[0] != 0x84 || data[1] != 206 || binary.BigEndian.Uint16(data[2:]) != 4 {
+		t.Fatalf("header % x, want V=2 FMT=4 PT=206 length=4", data[:4])
+	}
+	if !bytes.Equal(data[12:], []byte{0x11, 0x22, 0x33, 0x44, 7, 0, 0, 0}) {
+		t.Fatalf("FCI % x", data[12:])
+	}
+
+	pkts, err := rtcp.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fir, ok := pkts[0].(*rtcp.FullIntraRequest)
+	if !ok || len(fir.FIR) != 1 || fir.FIR[0].SSRC != 0x11223344 || fir.FIR[0].SequenceNumber != 7 {
+		t.Fatalf("parsed %#v", pkts[0])
+	}
+}
+
+func TestSendFIRSequenceNumbers(t *testing.T) {
+	p := NewPeer("room-1", "alice", "Alice", zap.NewNop())
+	defer p.Close()
+
+	// Each source counts its own requests, and the count wraps
+	for i := 0; i < 3; i++ {
+		p.SendFIR(1)
+	}
+	p.SendFIR(2)
+	p.mu.Lock()
+	p.firSeqNums[3] = 255
+	p.mu.Unlock()
+	p.SendFIR(3)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ssrc, want := range map[uint32]uint8{1: 3, 2: 1, 3: 0} {
+		if got := p.firSeqNums[ssrc]; got != want {
+			t.Errorf("SSRC %d: next sequence number %d, want %d", ssrc, got, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package peer
+
+import "time"
+
+// A guest may be allowed to publish only until a deadline, from its token or
+// invite, after which it stays in the call as a viewer. The peer owns the
+// timer, which stops when the peer closes. The deadline is absolute, so a
+// peer replacing a resumed session's is given the time that is left, not a
+// new window.
+
+// SetPublishDeadline arranges for onExpire to run once at deadline, replacing
+// any earlier deadline. A deadline already past marks the peer revoked at
+// once without calling onExpire: there is nothing it published yet.
+func (p *Peer) SetPublishDeadline(deadline time.Time, onExpire func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.publishTimer != nil {
+		p.publishTimer.Stop()
+		p.publishTimer = nil
+	}
+	p.publishUntil = deadline
+	if p.ctx.Err() != nil {
+		return
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		p.publishRevoked.Store(true)
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(remaining, func() {
+		p.mu.Lock()
+		current := p.publishTimer == timer && p.ctx.Err() == nil
+		if current {
+			p.publishTimer = nil
+		}
+		p.mu.Unlock()
+		if current && p.RevokePublish() {
+			onExpire()
+		}
+	})
+	p.publishTimer = timer
+}
+
+// PublishDeadline returns when the peer's publishing window ends, or the zero
+// time if it has none.
+func (p *Peer) PublishDeadline() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.publishUntil
+}
+
+// RevokePublish ends the peer's right to publish. It reports whether the
+// right was still held.
+func (p *Peer) RevokePublish() bool {
+	return p.publishRevoked.CompareAndSwap(false, true)
+}
+
+// PublishRevoked reports whether the peer may no longer publish.
+func (p *Peer) PublishRevoked() bool {
+	return p.publishRevoked.Load()
+}
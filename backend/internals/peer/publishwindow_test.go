@@ -0,0 +1,48 @@
+package peer
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestPublishDeadline(t *testing.T) {
+	// The window ends once, at the latest deadline set
+	p := NewPeer("room-1", "guest", "", zap.NewNop())
+	defer p.Close()
+	var expired atomic.Int32
+	onExpire := func() { expired.Add(1) }
+	p.SetPublishDeadline(time.Now().Add(20*time.Millisecond), onExpire)
+	deadline := time.Now().Add(60 * time.Millisecond)
+	p.SetPublishDeadline(deadline, onExpire)
+	time.Sleep(40 * time.Millisecond)
+	if expired.Load() != 0 || p.PublishRevoked() {
+		t.Fatal("the replaced deadline ended the window")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if expired.Load() != 1 || !p.PublishRevoked() || !p.PublishDeadline().Equal(deadline) {
+		t.Fatalf("%d expiries, revoked %v, deadline %v", expired.Load(), p.PublishRevoked(), p.PublishDeadline())
+	}
+	if p.RevokePublish() {
+		t.Fatal("revoked twice")
+	}
+
+	// A deadline already past revokes at once, with nothing to remove
+	past := NewPeer("room-1", "guest", "", zap.NewNop())
+	defer past.Close()
+	past.SetPublishDeadline(time.Now().Add(-time.Second), onExpire)
+	if !past.PublishRevoked() {
+		t.Fatal("a past deadline left publishing allowed")
+	}
+
+	// Leaving stops the timer
+	left := NewPeer("room-1", "guest", "", zap.NewNop())
+	left.SetPublishDeadline(time.Now().Add(20*time.Millisecond), onExpire)
+	left.Close()
+	time.Sleep(50 * time.Millisecond)
+	if expired.Load() != 1 || left.PublishRevoked() {
+		t.Fatalf("window of a closed peer ended: %d expiries", expired.Load())
+	}
+}
@@ -0,0 +1,154 @@
+package peer
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// Pion fires OnTrack on a track's first packet, so a published track that
+// never produces RTP (a camera the OS refused to open, a muted-at-source
+// microphone) is otherwise invisible. Tracks are watched from the moment
+// their m-line is negotiated until OnTrack fires for any of their layers.
+
+// StalledTrack is a negotiated incoming track that has not produced RTP
+// within the stall window.
+type StalledTrack struct {
+	TrackID string    `json:"trackId"`
+	Kind    string    `json:"kind"`
+	Since   time.Time `json:"since"` // when the track was negotiated
+}
+
+type trackStall struct {
+	kind    string
+	since   time.Time
+	timer   *time.Timer
+	stalled bool
+}
+
+// WatchIncomingTracks starts the stall window for every track the client
+// has negotiated to send that has not produced RTP yet. It is called after
+// each offer/answer exchange; tracks already being watched keep their
+// original window. A window of zero disables detection.
+func (p *Peer) WatchIncomingTracks(window time.Duration) {
+	if window <= 0 || p.Connection == nil {
+		return
+	}
+	for _, tr := range p.Connection.GetTransceivers() {
+		if !receivesMedia(tr) {
+			continue
+		}
+		// Simulcast layers share the track ID, so each base track is
+		// watched once and cleared by whichever layer arrives first
+		trackID := incomingTrackID(tr)
+		if trackID == "" {
+			continue
+		}
+		p.watchTrack(trackID, tr.Kind().String(), window)
+	}
+}
+
+// incomingTrackID returns the ID of the track the client sends on tr, which
+// a simulcast track's layers share. Receiver.Track is nil for those, as the
+// receiver has a track per layer.
+func incomingTrackID(tr *webrtc.RTPTransceiver) string {
+	for _, track := range tr.Receiver().Tracks() {
+		if track.ID() != "" {
+			return track.ID()
+		}
+	}
+	return ""
+}
+
+// receivesMedia reports whether the client sends on tr's m-line.
+func receivesMedia(tr *webrtc.RTPTransceiver) bool {
+	if tr.Receiver() == nil {
+		return false
+	}
+	dir := tr.Direction()
+	return dir == webrtc.RTPTransceiverDirectionRecvonly || dir == webrtc.RTPTransceiverDirectionSendrecv
+}
+
+func (p *Peer) watchTrack(trackID, kind string, window time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx.Err() != nil {
+		return
+	}
+	if _, flowing := p.RemoteTracks[trackID]; flowing {
+		return
+	}
+	if _, watching := p.trackStalls[trackID]; watching {
+		return
+	}
+	st := &trackStall{kind: kind, since: time.Now()}
+	st.timer = time.AfterFunc(window, func() { p.markTrackStalled(trackID, st) })
+	p.trackStalls[trackID] = st
+}
+
+func (p *Peer) markTrackStalled(trackID string, st *trackStall) {
+	p.mu.Lock()
+	if p.ctx.Err() != nil || p.trackStalls[trackID] != st {
+		p.mu.Unlock()
+		return
+	}
+	if !p.stillReceiving(trackID) {
+		// Renegotiated away before it ever produced anything
+		delete(p.trackStalls, trackID)
+		p.mu.Unlock()
+		return
+	}
+	st.stalled = true
+	p.mu.Unlock()
+
+	p.logger.Warn("Published track has produced no RTP",
+		zap.String("peerID", p.ID),
+		zap.String("userID", p.UserID),
+		zap.String("trackID", trackID),
+		zap.String("kind", st.kind),
+		zap.Duration("waited", time.Since(st.since)),
+	)
+	if p.OnTrackStalled != nil {
+		p.OnTrackStalled(p, trackID, st.kind, true)
+	}
+}
+
+// stillReceiving reports whether trackID is still negotiated as incoming.
+func (p *Peer) stillReceiving(trackID string) bool {
+	for _, tr := range p.Connection.GetTransceivers() {
+		if !receivesMedia(tr) {
+			continue
+		}
+		if incomingTrackID(tr) == trackID {
+			return true
+		}
+	}
+	return false
+}
+
+// clearTrackStall ends the stall window for trackID and reports whether the
+// track had already been reported stalled.
+// MUST be called with p.mu held.
+func (p *Peer) clearTrackStall(trackID string) bool {
+	st, ok := p.trackStalls[trackID]
+	if !ok {
+		return false
+	}
+	st.timer.Stop()
+	delete(p.trackStalls, trackID)
+	return st.stalled
+}
+
+// StalledTracks returns the peer's tracks that are currently stalled.
+func (p *Peer) StalledTracks() []StalledTrack {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var out []StalledTrack
+	for trackID, st := range p.trackStalls {
+		if st.stalled {
+			out = append(out, StalledTrack{TrackID: trackID, Kind: st.kind, Since: st.since})
+		}
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package peer
+
+import "github.com/pion/webrtc/v3"
+
+// Forwarded tracks only ever flow from the SFU to the client, so a
+// transceiver created for one is sendonly: a sendrecv one carries a receiver
+// the SFU never uses. Pion's AddTrack, which reuses free m-lines, creates
+// sendrecv transceivers and picks the first transceiver it considers free,
+// including a publisher's m-line the client only sends on. Attaching a track
+// there would turn the SFU's answer sendrecv against a sendonly offer, which
+// browsers reject, so the pick is predicted and AddTrack only used when it
+// lands on an m-line the client receives on. Pion cannot be steered past
+// such an m-line, so a client that publishes sendonly gets forwarded tracks
+// on new m-lines once its first one precedes the free receive slots.
+
+// addForwardingSender attaches track to a free transceiver the client
+// receives on, or else to a new sendonly one.
+func addForwardingSender(pc *webrtc.PeerConnection, track *webrtc.TrackLocalStaticRTP) (*webrtc.RTPSender, error) {
+	if t := reusableTransceiver(pc, track.Kind()); t != nil && clientReceives(pc, t) {
+		return pc.AddTrack(track)
+	}
+
+	t, err := pc.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionSendonly,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.Sender(), nil
+}
+
+// reusableTransceiver returns the transceiver Pion's AddTrack would attach a
+// track of kind to, or nil if it would create a new one.
+func reusableTransceiver(pc *webrtc.PeerConnection, kind webrtc.RTPCodecType) *webrtc.RTPTransceiver {
+	remote := mediaDirections(pc.RemoteDescription())
+	// The direction each transceiver last settled on, as Pion records it
+	// when an offer/answer exchange completes
+	var settled map[string]webrtc.RTPTransceiverDirection
+	if local := pc.CurrentLocalDescription(); local != nil && local.Type == webrtc.SDPTypeAnswer {
+		settled = mediaDirections(local)
+	} else {
+		settled = make(map[string]webrtc.RTPTransceiverDirection)
+		for mid, dir := range mediaDirections(pc.CurrentRemoteDescription()) {
+			settled[mid] = dir.Revers()
+		}
+	}
+
+	for _, t := range pc.GetTransceivers() {
+		if t.Kind() != kind || t.Sender() != nil {
+			continue
+		}
+		mid, dir := t.Mid(), t.Direction()
+		// Stopped when the client set the m-line inactive
+		if dir == webrtc.RTPTransceiverDirectionInactive && remote[mid] == webrtc.RTPTransceiverDirectionInactive {
+			continue
+		}
+		// Released by ReleaseSender and not renegotiated since
+		if s := settled[mid]; dir != webrtc.RTPTransceiverDirectionSendonly &&
+			(s == webrtc.RTPTransceiverDirectionSendrecv || s == webrtc.RTPTransceiverDirectionSendonly) {
+			continue
+		}
+		return t
+	}
+	return nil
+}
+
+// clientReceives reports whether the client's latest description receives
+// on t's m-line.
+func clientReceives(pc *webrtc.PeerConnection, t *webrtc.RTPTransceiver) bool {
+	dir := mediaDirections(pc.RemoteDescription())[t.Mid()]
+	return dir == webrtc.RTPTransceiverDirectionSendrecv || dir == webrtc.RTPTransceiverDirectionRecvonly
+}
+
+// mediaDirections maps the mids of desc's media sections to the direction
+// the section declares. desc is the PeerConnection's own, which pion reads
+// concurrently, so a copy is parsed.
+func mediaDirections(desc *webrtc.SessionDescription) map[string]webrtc.RTPTransceiverDirection {
+	dirs := make(map[string]webrtc.RTPTransceiverDirection)
+	if desc == nil {
+		return dirs
+	}
+	parsed, err := (&webrtc.SessionDescription{Type: desc.Type, SDP: desc.SDP}).Unmarshal()
+	if err != nil {
+		return dirs
+	}
+	for _, media := range parsed.MediaDescriptions {
+		mid, ok := media.Attribute("mid")
+		if !ok {
+			continue
+		}
+		dirs[mid] = webrtc.RTPTransceiverDirectionSendrecv
+		for _, attr := range media.Attributes {
+			if dir := webrtc.NewRTPTransceiverDirection(attr.Key); dir != webrtc.RTPTransceiverDirection(webrtc.Unknown) {
+				dirs[mid] = dir
+				break
+			}
+		}
+	}
+	return dirs
+}
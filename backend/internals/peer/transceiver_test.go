@@ -0,0 +1,311 @@
+package peer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// subscriberTest is a subscriber's peer on the SFU side and the client
+// negotiating with it, which offers as browsers do: it adds receive
+// transceivers until it has as many as the tracks it is told it will get.
+type subscriberTest struct {
+	peer   *Peer
+	client *webrtc.PeerConnection
+}
+
+func newSubscriberTest(t *testing.T) *subscriberTest {
+	t.Helper()
+	p := NewPeer("room-1", "subscriber", "Subscriber", zap.NewNop())
+	if err := p.CreatePeerConnection(nil, webrtc.Configuration{}); err != nil {
+		t.Fatal(err)
+	}
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		p.Close()
+	})
+	return &subscriberTest{peer: p, client: client}
+}
+
+// receiving counts the client's transceivers of kind that receive.
+func (st *subscriberTest) receiving(kind webrtc.RTPCodecType) int {
+	n := 0
+	for _, t := range st.client.GetTransceivers() {
+		if t.Kind() == kind && t.Direction() == webrtc.RTPTransceiverDirectionRecvonly {
+			n++
+		}
+	}
+	return n
+}
+
+// renegotiate runs an offer/answer exchange started by the client, which
+// first makes sure it can receive audio and video tracks, and returns the
+// SFU's answer.
+func (st *subscriberTest) renegotiate(t *testing.T, audio, video int) string {
+	t.Helper()
+	for kind, want := range map[webrtc.RTPCodecType]int{webrtc.RTPCodecTypeAudio: audio, webrtc.RTPCodecTypeVideo: video} {
+		for st.receiving(kind) < want {
+			if _, err := st.client.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{
+				Direction: webrtc.RTPTransceiverDirectionRecvonly,
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	offer, err := st.client.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.client.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.peer.SetRemoteDescription(offer); err != nil {
+		t.Fatalf("SFU refused the client's offer: %v", err)
+	}
+	answer, err := st.peer.Connection.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.peer.Connection.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.client.SetRemoteDescription(answer); err != nil {
+		t.Fatalf("client refused the SFU's answer: %v", err)
+	}
+	return answer.SDP
+}
+
+// publish forwards an audio and a video track of publisher to the
+// subscriber.
+func (st *subscriberTest) publish(t *testing.T, publisher string) []*webrtc.RTPSender {
+	t.Helper()
+	var senders []*webrtc.RTPSender
+	for _, codec := range []webrtc.RTPCodecCapability{
+		{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2},
+		{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+	} {
+		kind := strings.Split(codec.MimeType, "/")[0]
+		track, err := webrtc.NewTrackLocalStaticRTP(codec, publisher+"-"+kind, publisher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sender, err := st.peer.AddTrack(track)
+		if err != nil {
+			t.Fatal(err)
+		}
+		senders = append(senders, sender)
+	}
+	return senders
+}
+
+func (st *subscriberTest) release(t *testing.T, senders []*webrtc.RTPSender) {
+	t.Helper()
+	for _, sender := range senders {
+		if err := st.peer.ReleaseSender(sender); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// mlines counts the media sections of sdp.
+func mlines(sdp string) int {
+	return strings.Count(sdp, "\nm=")
+}
+
+func TestPublisherChurnKeepsMLinesAligned(t *testing.T) {
+	st := newSubscriberTest(t)
+	st.renegotiate(t, 1, 1)
+
+	for i := 0; i < 20; i++ {
+		publisher := fmt.Sprintf("publisher-%d", i)
+
+		senders := st.publish(t, publisher)
+		answer := st.renegotiate(t, 1, 1)
+		if !strings.Contains(answer, "a=msid:"+publisher+" "+publisher+"-audio") ||
+			!strings.Contains(answer, "a=msid:"+publisher+" "+publisher+"-video") {
+			t.Fatalf("cycle %d: answer does not carry %s's tracks:\n%s", i, publisher, answer)
+		}
+		if got := strings.Count(answer, "a=sendonly"); got != 2 {
+			t.Fatalf("cycle %d: %d m-lines sending, want 2", i, got)
+		}
+
+		st.release(t, senders)
+		if len(st.peer.LocalTracks) != 0 {
+			t.Fatalf("cycle %d: local tracks %v left after release", i, st.peer.LocalTracks)
+		}
+		answer = st.renegotiate(t, 0, 0)
+		if strings.Contains(answer, "a=msid:"+publisher) || strings.Contains(answer, "a=sendonly") {
+			t.Fatalf("cycle %d: answer still sends %s's tracks:\n%s", i, publisher, answer)
+		}
+
+		// The freed m-lines are reused, so neither side grows
+		if got := mlines(answer); got != 2 {
+			t.Fatalf("cycle %d: %d m-lines, want 2", i, got)
+		}
+		if n, m := len(st.client.GetTransceivers()), len(st.peer.Connection.GetTransceivers()); n != 2 || m != 2 {
+			t.Fatalf("cycle %d: client has %d transceivers and the SFU %d, want 2", i, n, m)
+		}
+	}
+}
+
+func TestReleaseSenderStopsRejectedTransceiver(t *testing.T) {
+	st := newSubscriberTest(t)
+	st.renegotiate(t, 1, 1)
+	senders := st.publish(t, "publisher-0")
+	st.renegotiate(t, 1, 1)
+
+	// The client stops receiving video, which sets its m-line inactive
+	for _, tr := range st.client.GetTransceivers() {
+		if tr.Kind() == webrtc.RTPCodecTypeVideo {
+			if err := tr.Stop(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	st.renegotiate(t, 1, 0)
+
+	st.release(t, senders)
+	var video *webrtc.RTPTransceiver
+	for _, tr := range st.peer.Connection.GetTransceivers() {
+		if tr.Kind() == webrtc.RTPCodecTypeVideo {
+			video = tr
+		}
+	}
+	if video.Direction() != webrtc.RTPTransceiverDirectionInactive || video.Sender() == nil {
+		t.Fatalf("rejected transceiver %s with sender %v, want stopped", video.Direction(), video.Sender())
+	}
+	st.renegotiate(t, 0, 0)
+
+	// The next video track goes on a new m-line; the audio m-line is reused
+	st.publish(t, "publisher-1")
+	answer := st.renegotiate(t, 1, 1)
+	if got := mlines(answer); got != 3 {
+		t.Fatalf("%d m-lines, want 3:\n%s", got, answer)
+	}
+	if !strings.Contains(answer, "a=msid:publisher-1 publisher-1-video") {
+		t.Fatalf("answer does not carry the new video track:\n%s", answer)
+	}
+}
+
+// directionCounts counts the media sections of sdp by the direction they
+// declare.
+func directionCounts(sdp string) map[webrtc.RTPTransceiverDirection]int {
+	counts := make(map[webrtc.RTPTransceiverDirection]int)
+	for _, dir := range mediaDirections(&webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdp}) {
+		counts[dir]++
+	}
+	return counts
+}
+
+func TestForwardedTracksOfferedSendonly(t *testing.T) {
+	const publishers = 5
+	// offer forwards every publisher's tracks to a new subscriber, adding
+	// them with add, and returns the SFU's offer once the client accepted
+	// it, with the number of receivers the SFU set up
+	offer := func(t *testing.T, add func(*subscriberTest, *webrtc.TrackLocalStaticRTP) error) (string, int) {
+		st := newSubscriberTest(t)
+		for i := 0; i < publishers; i++ {
+			for _, codec := range []webrtc.RTPCodecCapability{
+				{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2},
+				{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+			} {
+				publisher := fmt.Sprintf("publisher-%d", i)
+				track, err := webrtc.NewTrackLocalStaticRTP(codec, publisher+"-"+strings.Split(codec.MimeType, "/")[0], publisher)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := add(st, track); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		o, err := st.peer.Connection.CreateOffer(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := st.peer.Connection.SetLocalDescription(o); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.client.SetRemoteDescription(o); err != nil {
+			t.Fatal(err)
+		}
+		answer, err := st.client.CreateAnswer(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := st.client.SetLocalDescription(answer); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.peer.SetRemoteDescription(answer); err != nil {
+			t.Fatalf("SFU refused the client's answer: %v", err)
+		}
+		if got := directionCounts(answer.SDP)[webrtc.RTPTransceiverDirectionRecvonly]; got != 2*publishers {
+			t.Fatalf("client receives on %d m-lines, want %d:\n%s", got, 2*publishers, answer.SDP)
+		}
+		receivers := 0
+		for _, tr := range st.peer.Connection.GetTransceivers() {
+			if tr.Receiver() != nil {
+				receivers++
+			}
+		}
+		return o.SDP, receivers
+	}
+
+	// Pion's AddTrack would give every forwarded track a receiver it never
+	// uses; the SDP hardly differs, only in the direction each m-line declares
+	before, unused := offer(t, func(st *subscriberTest, track *webrtc.TrackLocalStaticRTP) error {
+		_, err := st.peer.Connection.AddTrack(track)
+		return err
+	})
+	after, receivers := offer(t, func(st *subscriberTest, track *webrtc.TrackLocalStaticRTP) error {
+		_, err := st.peer.AddTrack(track)
+		return err
+	})
+	t.Logf("offer for %d forwarded tracks: %d bytes and %d receivers with sendrecv transceivers, %d bytes and %d receivers with sendonly",
+		2*publishers, len(before), unused, len(after), receivers)
+
+	if dirs := directionCounts(after); dirs[webrtc.RTPTransceiverDirectionSendonly] != 2*publishers || len(dirs) != 1 {
+		t.Fatalf("forwarded m-lines offered as %v, want all sendonly", dirs)
+	}
+	if receivers != 0 {
+		t.Fatalf("%d receivers set up for forwarded tracks", receivers)
+	}
+}
+
+func TestPublisherMLinesAnsweredRecvonly(t *testing.T) {
+	st := newSubscriberTest(t)
+	for _, codec := range []webrtc.RTPCodecCapability{
+		{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2},
+		{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+	} {
+		track, err := webrtc.NewTrackLocalStaticRTP(codec, "own-"+strings.Split(codec.MimeType, "/")[0], "own")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := st.client.AddTransceiverFromTrack(track, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionSendonly,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	answer := st.renegotiate(t, 0, 0)
+	if dirs := directionCounts(answer); dirs[webrtc.RTPTransceiverDirectionRecvonly] != 2 || len(dirs) != 1 {
+		t.Fatalf("publisher m-lines answered %v, want recvonly:\n%s", dirs, answer)
+	}
+
+	// Tracks forwarded to the publisher stay off its own m-lines
+	st.publish(t, "publisher-0")
+	answer = st.renegotiate(t, 1, 1)
+	dirs := directionCounts(answer)
+	if dirs[webrtc.RTPTransceiverDirectionRecvonly] != 2 || dirs[webrtc.RTPTransceiverDirectionSendonly] != 2 || len(dirs) != 2 {
+		t.Fatalf("m-lines answered %v, want 2 recvonly and 2 sendonly:\n%s", dirs, answer)
+	}
+}
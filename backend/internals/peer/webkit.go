@@ -0,0 +1,310 @@
+package peer
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// Safari and other WebKit browsers publish in two ways Pion does not take
+// as is. Their H264 fmtp lines may leave out packetization-mode or
+// profile-level-id, which RFC 6184 defaults to 0 and 42000a but Pion
+// refuses to match. And some versions simulcast by listing one SSRC per
+// layer in an a=ssrc-group:SIM line instead of announcing RIDs, while Pion
+// starts a receiver for the first SSRC of an m-line only.
+//
+// An m-line with a SIM group is therefore hidden from Pion in the first
+// offer that carries it: its SSRC lines are removed, and the peer starts
+// the receiver itself, with one encoding per SSRC, once DTLS is up. The
+// layers get synthetic RIDs by their order in the group, lowest first.
+// Later offers go to Pion untouched, which keeps the receiver because its
+// SSRCs are declared, and fills in the tracks' IDs. Until then the IDs come
+// from the offer. RTX is not set up for such layers: Pion can only pair a
+// repair stream with a receiver's layers by RID.
+
+// How a simulcast publisher identifies its layers.
+const (
+	SimulcastModeRID  = "rid"        // a=rid and the RTP stream ID extension
+	SimulcastModeSSRC = "ssrc-group" // a=ssrc-group:SIM, layers by SSRC order
+)
+
+// ssrcLayerRIDs are the synthetic RIDs of SSRC-group layers, lowest first.
+var ssrcLayerRIDs = []string{"q", "h", "f"}
+
+// dtlsWaitTimeout bounds how long hidden receivers wait for DTLS.
+const dtlsWaitTimeout = 30 * time.Second
+
+// RemoteLayer identifies an incoming track and, for simulcast, its layer.
+type RemoteLayer struct {
+	TrackID  string
+	StreamID string
+	RID      string // "" for a track without layers
+	Mode     string // SimulcastModeRID or SimulcastModeSSRC when RID is set
+}
+
+// ssrcSimulcast is an m-line that simulcasts through an SSRC group.
+type ssrcSimulcast struct {
+	mid      string
+	streamID string
+	trackID  string
+	ssrcs    []uint32 // lowest layer first
+}
+
+type ssrcLayer struct {
+	trackID  string
+	streamID string
+	rid      string
+}
+
+// webkitState is the peer's view of its WebKit-style publishing.
+type webkitState struct {
+	layers  map[uint32]ssrcLayer // SSRC -> layer, for every SIM group seen
+	started map[string]bool      // mids whose receivers the peer started
+	pending []ssrcSimulcast      // hidden by the last offer, not yet started
+}
+
+// AdaptWebKitOffer prepares an offer for Pion: it spells out defaulted H264
+// parameters and, with simulcast set, hides m-lines that newly simulcast
+// through SSRC groups. StartSSRCSimulcast must be called once the returned
+// offer has been applied.
+func (p *Peer) AdaptWebKitOffer(offer webrtc.SessionDescription, simulcast bool) webrtc.SessionDescription {
+	parsed, err := offer.Unmarshal()
+	if err != nil {
+		return offer
+	}
+	changed := normalizeH264Fmtp(parsed)
+
+	var hidden []ssrcSimulcast
+	if simulcast {
+		groups := parseSSRCSimulcast(parsed)
+		p.mu.Lock()
+		if p.webkit.layers == nil {
+			p.webkit.layers = make(map[uint32]ssrcLayer)
+			p.webkit.started = make(map[string]bool)
+		}
+		for _, g := range groups {
+			for i, ssrc := range g.ssrcs {
+				p.webkit.layers[ssrc] = ssrcLayer{trackID: g.trackID, streamID: g.streamID, rid: ssrcLayerRIDs[i]}
+			}
+			if !p.webkit.started[g.mid] {
+				hidden = append(hidden, g)
+			}
+		}
+		p.webkit.pending = hidden
+		p.mu.Unlock()
+	}
+	for _, g := range hidden {
+		hideSSRCs(parsed, g.mid)
+		changed = true
+	}
+	if !changed {
+		return offer
+	}
+
+	raw, err := parsed.Marshal()
+	if err != nil {
+		return offer
+	}
+	if len(hidden) > 0 {
+		p.logger.Info("Publisher simulcasts through SSRC groups",
+			zap.String("peerID", p.ID),
+			zap.Int("mlines", len(hidden)),
+		)
+	}
+	return webrtc.SessionDescription{Type: offer.Type, SDP: string(raw)}
+}
+
+// StartSSRCSimulcast starts the receivers the last AdaptWebKitOffer hid
+// from Pion once DTLS is up. Each layer is announced through OnTrackAdded
+// when its first packet arrives.
+func (p *Peer) StartSSRCSimulcast() {
+	p.mu.Lock()
+	pending := p.webkit.pending
+	p.webkit.pending = nil
+	for _, g := range pending {
+		p.webkit.started[g.mid] = true
+	}
+	p.mu.Unlock()
+
+	if len(pending) > 0 {
+		go p.receiveSSRCSimulcast(pending)
+	}
+}
+
+func (p *Peer) receiveSSRCSimulcast(groups []ssrcSimulcast) {
+	for _, g := range groups {
+		var receiver *webrtc.RTPReceiver
+		for _, tr := range p.Connection.GetTransceivers() {
+			if tr.Mid() == g.mid {
+				receiver = tr.Receiver()
+				break
+			}
+		}
+		if receiver == nil || !p.awaitDTLS(receiver) {
+			p.logger.Warn("No receiver for SSRC-group simulcast",
+				zap.String("peerID", p.ID),
+				zap.String("mid", g.mid),
+			)
+			continue
+		}
+
+		params := webrtc.RTPReceiveParameters{}
+		for _, ssrc := range g.ssrcs {
+			params.Encodings = append(params.Encodings, webrtc.RTPDecodingParameters{
+				RTPCodingParameters: webrtc.RTPCodingParameters{SSRC: webrtc.SSRC(ssrc)},
+			})
+		}
+		if err := receiver.Receive(params); err != nil {
+			p.logger.Warn("Failed to start SSRC-group simulcast receiver",
+				zap.String("peerID", p.ID),
+				zap.String("mid", g.mid),
+				zap.Error(err),
+			)
+			continue
+		}
+		for _, track := range receiver.Tracks() {
+			go p.announceLayer(track, receiver)
+		}
+	}
+}
+
+// awaitDTLS waits until receiver's DTLS transport is connected, the peer
+// is closed or dtlsWaitTimeout passes.
+func (p *Peer) awaitDTLS(receiver *webrtc.RTPReceiver) bool {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(dtlsWaitTimeout)
+	for {
+		if t := receiver.Transport(); t != nil && t.State() == webrtc.DTLSTransportStateConnected {
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return false
+		case <-p.ctx.Done():
+			return false
+		}
+	}
+}
+
+// announceLayer hands a hidden receiver's track to the OnTrack path once
+// its first packet, which binds the track's codec, has been read. The
+// packet itself is dropped; a keyframe is requested for every subscriber.
+func (p *Peer) announceLayer(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+	if _, _, err := track.ReadRTP(); err != nil {
+		return
+	}
+	p.handleTrack(track, receiver)
+}
+
+// RemoteLayer returns the identity of an incoming track, with the layer it
+// carries when the publisher simulcasts.
+func (p *Peer) RemoteLayer(track *webrtc.TrackRemote) RemoteLayer {
+	layer := RemoteLayer{TrackID: track.ID(), StreamID: track.StreamID(), RID: track.RID()}
+	if layer.RID != "" {
+		layer.Mode = SimulcastModeRID
+		return layer
+	}
+
+	p.mu.RLock()
+	sl, ok := p.webkit.layers[uint32(track.SSRC())]
+	p.mu.RUnlock()
+	if ok {
+		layer.RID, layer.Mode = sl.rid, SimulcastModeSSRC
+		if layer.TrackID == "" {
+			layer.TrackID, layer.StreamID = sl.trackID, sl.streamID
+		}
+	}
+	return layer
+}
+
+// parseSSRCSimulcast returns the m-lines of an offer that simulcast
+// through an SSRC group of up to three layers.
+func parseSSRCSimulcast(parsed *sdp.SessionDescription) []ssrcSimulcast {
+	var groups []ssrcSimulcast
+	for _, md := range parsed.MediaDescriptions {
+		mid, ok := md.Attribute("mid")
+		if !ok || md.MediaName.Media != "video" {
+			continue
+		}
+		g := ssrcSimulcast{mid: mid}
+		for _, attr := range md.Attributes {
+			fields := strings.Fields(attr.Value)
+			switch {
+			case attr.Key == "ssrc-group" && len(fields) > 2 && fields[0] == "SIM":
+				g.ssrcs = g.ssrcs[:0]
+				for _, f := range fields[1:] {
+					ssrc, err := strconv.ParseUint(f, 10, 32)
+					if err != nil {
+						g.ssrcs = nil
+						break
+					}
+					g.ssrcs = append(g.ssrcs, uint32(ssrc))
+				}
+			case attr.Key == "msid" && len(fields) == 2:
+				g.streamID, g.trackID = fields[0], fields[1]
+			case attr.Key == "ssrc" && len(fields) == 3 && strings.HasPrefix(fields[1], "msid:") && g.trackID == "":
+				g.streamID, g.trackID = strings.TrimPrefix(fields[1], "msid:"), fields[2]
+			}
+		}
+		if len(g.ssrcs) > 1 && len(g.ssrcs) <= len(ssrcLayerRIDs) && g.trackID != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// hideSSRCs removes the SSRC attributes of the m-line mid.
+func hideSSRCs(parsed *sdp.SessionDescription, mid string) {
+	for _, md := range parsed.MediaDescriptions {
+		if v, _ := md.Attribute("mid"); v != mid {
+			continue
+		}
+		attrs := md.Attributes[:0]
+		for _, attr := range md.Attributes {
+			if attr.Key != "ssrc" && attr.Key != "ssrc-group" {
+				attrs = append(attrs, attr)
+			}
+		}
+		md.Attributes = attrs
+	}
+}
+
+// normalizeH264Fmtp adds the RFC 6184 defaults of packetization-mode and
+// profile-level-id to H264 fmtp lines that leave them out. It reports
+// whether any line changed.
+func normalizeH264Fmtp(parsed *sdp.SessionDescription) bool {
+	changed := false
+	for _, md := range parsed.MediaDescriptions {
+		h264 := make(map[string]bool)
+		for _, attr := range md.Attributes {
+			// "<payload type> <encoding name>/<clock rate>"
+			if fields := strings.Fields(attr.Value); attr.Key == "rtpmap" && len(fields) == 2 &&
+				strings.EqualFold(strings.SplitN(fields[1], "/", 2)[0], "H264") {
+				h264[fields[0]] = true
+			}
+		}
+		for i, attr := range md.Attributes {
+			pt, params, ok := strings.Cut(attr.Value, " ")
+			if attr.Key != "fmtp" || !ok || !h264[pt] {
+				continue
+			}
+			if !strings.Contains(params, "packetization-mode=") {
+				params += ";packetization-mode=0"
+			}
+			if !strings.Contains(params, "profile-level-id=") {
+				params += ";profile-level-id=42000a"
+			}
+			if value := pt + " " + params; value != attr.Value {
+				md.Attributes[i].Value = value
+				changed = true
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,162 @@
+package peer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// safariOffer reads an offer from testdata. The files keep LF line endings;
+// SDP wants CRLF.
+func safariOffer(t *testing.T, name string) webrtc.SessionDescription {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: strings.ReplaceAll(string(data), "\n", "\r\n")}
+}
+
+// fmtpLines returns the fmtp parameters of the m-line mid by payload type.
+func fmtpLines(t *testing.T, desc webrtc.SessionDescription, mid string) map[string]string {
+	t.Helper()
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := mediaSection(t, parsed, mid)
+	fmtp := make(map[string]string)
+	for _, attr := range md.Attributes {
+		if pt, params, ok := strings.Cut(attr.Value, " "); attr.Key == "fmtp" && ok {
+			fmtp[pt] = params
+		}
+	}
+	return fmtp
+}
+
+func mediaSection(t *testing.T, parsed *sdp.SessionDescription, mid string) *sdp.MediaDescription {
+	t.Helper()
+	for _, md := range parsed.MediaDescriptions {
+		if v, _ := md.Attribute("mid"); v == mid {
+			return md
+		}
+	}
+	t.Fatalf("no m-line %s", mid)
+	return nil
+}
+
+// answer applies offer to a new peer and returns its answer.
+func answer(t *testing.T, p *Peer, offer webrtc.SessionDescription) webrtc.SessionDescription {
+	t.Helper()
+	if err := p.CreatePeerConnection(nil, webrtc.Configuration{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	if err := p.Connection.SetRemoteDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	ans, err := p.Connection.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ans
+}
+
+func TestAdaptSafariH264Offer(t *testing.T) {
+	offer := safariOffer(t, "safari-h264-offer.sdp")
+	p := NewPeer("room-1", "safari", "Safari", zap.NewNop())
+	adapted := p.AdaptWebKitOffer(offer, false)
+
+	before, after := fmtpLines(t, offer, "1"), fmtpLines(t, adapted, "1")
+	for pt, want := range map[string]string{
+		// Complete lines are left alone
+		"96": "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=640c1f",
+		"98": "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+		// Safari's packetization-mode 0 entry leaves the mode out
+		"100": "level-asymmetry-allowed=1;profile-level-id=42e01f;packetization-mode=0",
+		"104": "level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=42000a",
+		// Not H264
+		"97":  "apt=96",
+		"125": "apt=127",
+	} {
+		if after[pt] != want {
+			t.Errorf("fmtp %s: %q became %q, want %q", pt, before[pt], after[pt], want)
+		}
+	}
+	if a, b := fmtpLines(t, offer, "0"), fmtpLines(t, adapted, "0"); a["111"] != b["111"] || a["63"] != b["63"] {
+		t.Errorf("audio fmtp changed: %v became %v", a, b)
+	}
+
+	// Pion now takes the mode 0 entry
+	ans := answer(t, p, adapted)
+	if !strings.Contains(ans.SDP, "a=rtpmap:100 H264/90000") {
+		t.Fatalf("answer leaves out the packetization-mode 0 H264:\n%s", ans.SDP)
+	}
+}
+
+func TestAdaptSafariSSRCSimulcastOffer(t *testing.T) {
+	offer := safariOffer(t, "safari-ssrc-simulcast-offer.sdp")
+	p := NewPeer("room-1", "safari", "Safari", zap.NewNop())
+	adapted := p.AdaptWebKitOffer(offer, true)
+
+	parsed, err := adapted.Unmarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, attr := range mediaSection(t, parsed, "1").Attributes {
+		if attr.Key == "ssrc" || attr.Key == "ssrc-group" {
+			t.Fatalf("simulcast m-line still declares a=%s:%s", attr.Key, attr.Value)
+		}
+	}
+	if _, ok := mediaSection(t, parsed, "0").Attribute("ssrc"); !ok {
+		t.Fatal("audio m-line lost its SSRCs")
+	}
+	if after := fmtpLines(t, adapted, "1"); after["98"] != "level-asymmetry-allowed=1;profile-level-id=42e01f;packetization-mode=0" {
+		t.Fatalf("fmtp 98 is %q", after["98"])
+	}
+
+	const trackID = "e2a95d07-1c4b-4f38-96d2-7b0f8e3a5c41"
+	const streamID = "0e6d2b4f-93a1-4c57-8b0e-d52f7a1c3e96"
+	p.mu.RLock()
+	pending := p.webkit.pending
+	layers := p.webkit.layers
+	p.mu.RUnlock()
+	if len(pending) != 1 || pending[0].mid != "1" || pending[0].trackID != trackID || pending[0].streamID != streamID {
+		t.Fatalf("pending %+v, want the video m-line", pending)
+	}
+	// The SIM group lists the layers lowest first; the FID repair SSRCs
+	// are not layers
+	for ssrc, rid := range map[uint32]string{3169274082: "q", 2716530498: "h", 906153274: "f"} {
+		if l := layers[ssrc]; l.rid != rid || l.trackID != trackID {
+			t.Errorf("SSRC %d is layer %+v, want %s of %s", ssrc, l, rid, trackID)
+		}
+	}
+	if len(layers) != 3 {
+		t.Errorf("%d layers, want 3", len(layers))
+	}
+
+	// Pion accepts the rewritten offer
+	ans := answer(t, p, adapted)
+	if !strings.Contains(ans.SDP, "a=mid:1") || !strings.Contains(ans.SDP, "H264/90000") {
+		t.Fatalf("answer does not take the video:\n%s", ans.SDP)
+	}
+
+	// Once its receiver was started the m-line goes to Pion as it is
+	p.mu.Lock()
+	p.webkit.started["1"] = true
+	p.webkit.pending = nil
+	p.mu.Unlock()
+	later := p.AdaptWebKitOffer(offer, true)
+	again, err := later.Unmarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mediaSection(t, again, "1").Attribute("ssrc-group"); !ok {
+		t.Fatal("SSRCs hidden from a later offer")
+	}
+}
@@ -0,0 +1,157 @@
+package room
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+// A joining peer's answer carries every track already published in the
+// room, so its first offer waits for all of them to be attached. Each
+// attachment is independent, and they run on up to attachWorkers goroutines.
+// Once attachTimeout has passed no more are started: those left are queued
+// like tracks published during the first negotiation (see pending.go), so
+// the answer goes out with what was attached and the rest follows in one
+// renegotiation. Jobs start in publish order, so with one worker the
+// m-lines follow it; either way SubscriptionSnapshot reports the order the
+// client sees.
+
+// attachJob is one existing track, or codec group, to attach.
+type attachJob struct {
+	mt *MediaTrack
+	g  *codecGroup
+
+	// Ordering: when the track, or the group's first alternative, was
+	// published, then its handle
+	createdAt time.Time
+	handle    string
+}
+
+// SetJoinAttach sets how many of a joining peer's existing tracks are
+// attached at once (1 or less = one at a time) and how long attaching may
+// take before the rest is deferred (0 = no limit).
+func (r *Room) SetJoinAttach(workers int, timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attachWorkers = workers
+	r.attachTimeout = timeout
+}
+
+// AddExistingTracksToPeer attaches every track published in the room to a
+// peer before its first answer, without triggering renegotiation, and
+// returns how many were attached.
+func (r *Room) AddExistingTracksToPeer(newPeer *peer.Peer) int {
+	start := time.Now()
+	// Everything queued so far is in MediaTracks and gets attached below
+	r.resetPendingForwards(newPeer)
+
+	r.mu.RLock()
+	jobs := make([]attachJob, 0, len(r.MediaTracks))
+	groups := make(map[*codecGroup]int) // group -> index in jobs
+	for _, track := range r.MediaTracks {
+		if track.PeerID == newPeer.ID {
+			continue
+		}
+		if g := track.group; g != nil {
+			if i, ok := groups[g]; ok {
+				if track.CreatedAt.Before(jobs[i].createdAt) {
+					jobs[i].createdAt = track.CreatedAt
+				}
+				continue
+			}
+			groups[g] = len(jobs)
+			jobs = append(jobs, attachJob{g: g, createdAt: track.CreatedAt, handle: g.Handle})
+			continue
+		}
+		jobs = append(jobs, attachJob{mt: track, createdAt: track.CreatedAt, handle: track.Handle})
+	}
+	workers, timeout := r.attachWorkers, r.attachTimeout
+	r.mu.RUnlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].createdAt.Equal(jobs[j].createdAt) {
+			return jobs[i].createdAt.Before(jobs[j].createdAt)
+		}
+		return jobs[i].handle < jobs[j].handle
+	})
+
+	workers = max(1, min(workers, len(jobs)))
+	var next, added, deferred atomic.Int32
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(jobs) {
+					return
+				}
+				if timeout > 0 && time.Since(start) >= timeout {
+					r.deferAttach(jobs[i], newPeer)
+					deferred.Add(1)
+					continue
+				}
+				if r.attach(jobs[i], newPeer) {
+					added.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	appmetrics.ObserveJoinAttach(elapsed, int(deferred.Load()))
+	if deferred.Load() > 0 {
+		r.logger.Warn("Deferred existing tracks past the attach deadline",
+			zap.String("newPeerID", newPeer.ID),
+			zap.Int32("attached", added.Load()),
+			zap.Int32("deferred", deferred.Load()),
+			zap.Duration("elapsed", elapsed),
+		)
+	} else if added.Load() > 0 {
+		r.logger.Info("Added existing tracks to new peer before answer",
+			zap.String("newPeerID", newPeer.ID),
+			zap.Int32("trackCount", added.Load()),
+			zap.Duration("elapsed", elapsed),
+		)
+		// PLI will be sent automatically by smartPLI via the needsPLI flag
+	}
+	return int(added.Load())
+}
+
+// attach forwards job to target straight away and reports whether it was
+// attached.
+func (r *Room) attach(job attachJob, target *peer.Peer) bool {
+	if job.g != nil {
+		return r.forwardGroupToPeer(job.g, target, true)
+	}
+	if !r.admitSubscriber(job.mt, target) {
+		return false
+	}
+	r.logger.Info("Adding existing track to new peer",
+		zap.String("newPeerID", target.ID),
+		zap.String("trackID", job.mt.ID),
+		zap.String("kind", job.mt.Kind),
+		zap.String("fromPeer", job.mt.PeerID),
+	)
+	return r.forwardTrackToPeerDirect(job.mt, target)
+}
+
+// deferAttach leaves job for after target's first negotiation, or for the
+// per-track retry path if that has already completed.
+func (r *Room) deferAttach(job attachJob, target *peer.Peer) {
+	if r.queueForward(job.mt, job.g, target) {
+		return
+	}
+	if job.g != nil {
+		go r.forwardGroupToPeer(job.g, target, false)
+		return
+	}
+	go r.forwardTrackToPeer(job.mt, target)
+}
@@ -0,0 +1,113 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// Audio is forwarded as the publisher sent it; nothing is transcoded. A
+// subscriber whose SDP lists the publisher's audio codec only with other
+// channels, such as a stereo Opus receiver of a mono publisher, decodes it
+// fine and adjusts its playout from the clockRate and channels in the track
+// summary. One that lists the codec only at another clock rate would play
+// it broken, so the track is not forwarded to it and the subscription is
+// refused with ErrCodecMismatch.
+
+// ErrCodecMismatch is matched by a *CodecMismatchError.
+var ErrCodecMismatch = errors.New("codec mismatch")
+
+// CodecMismatchError says why an audio track was not forwarded to a
+// subscriber.
+type CodecMismatchError struct {
+	TrackID   string // the track's handle
+	Published webrtc.RTPCodecCapability
+	// What the subscriber's SDP listed for the codec
+	Negotiated []webrtc.RTPCodecCapability
+}
+
+func (e *CodecMismatchError) Error() string {
+	rates := make([]string, 0, len(e.Negotiated))
+	for _, c := range e.Negotiated {
+		rates = append(rates, fmt.Sprintf("%d", c.ClockRate))
+	}
+	return fmt.Sprintf("codec mismatch: %s is sent at %d Hz, the subscriber negotiated %s Hz",
+		e.Published.MimeType, e.Published.ClockRate, strings.Join(rates, ", "))
+}
+
+func (e *CodecMismatchError) Is(target error) bool {
+	return target == ErrCodecMismatch
+}
+
+// checkAudioCodec returns a *CodecMismatchError if p would play mt's audio
+// broken. A subscriber that has not negotiated yet, or did not list the
+// codec at all, is left to the normal binding.
+func (r *Room) checkAudioCodec(mt *MediaTrack, p *peer.Peer) error {
+	if mt.Kind != "audio" || mt.Track == nil {
+		return nil
+	}
+	published := mt.Track.Codec().RTPCodecCapability
+	negotiated, known := p.RemoteCodecs(published.MimeType)
+	if !known || len(negotiated) == 0 || published.ClockRate == 0 {
+		return nil
+	}
+
+	switch compareAudioCodec(published, negotiated) {
+	case audioChannelsDiffer:
+		r.logger.Debug("Forwarding audio to a subscriber that negotiated other channels",
+			zap.String("peerID", p.ID),
+			zap.String("track", mt.Handle),
+			zap.Uint16("channels", audioChannels(published, "sprop-stereo")),
+		)
+	case audioMismatch:
+		return &CodecMismatchError{TrackID: mt.Handle, Published: published, Negotiated: negotiated}
+	}
+	return nil
+}
+
+// How a subscriber's negotiated audio codec compares to the published one.
+const (
+	audioMatch = iota
+	audioChannelsDiffer
+	audioMismatch
+)
+
+// compareAudioCodec compares the published audio codec with the entries a
+// subscriber's SDP listed for it.
+func compareAudioCodec(published webrtc.RTPCodecCapability, negotiated []webrtc.RTPCodecCapability) int {
+	result := audioMismatch
+	for _, c := range negotiated {
+		if c.ClockRate != published.ClockRate {
+			continue
+		}
+		if audioChannels(c, "stereo") == audioChannels(published, "sprop-stereo") {
+			return audioMatch
+		}
+		result = audioChannelsDiffer
+	}
+	return result
+}
+
+// audioChannels is the number of channels codec carries. Opus is always
+// negotiated as two channels; param of its fmtp says whether it is stereo,
+// sprop-stereo for what a publisher sends and stereo for what a subscriber
+// prefers to receive.
+func audioChannels(codec webrtc.RTPCodecCapability, param string) uint16 {
+	if !strings.EqualFold(codec.MimeType, webrtc.MimeTypeOpus) {
+		return max(codec.Channels, 1)
+	}
+	for _, kv := range strings.Split(codec.SDPFmtpLine, ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(kv), "=")
+		if strings.EqualFold(key, param) {
+			if value == "1" {
+				return 2
+			}
+			return 1
+		}
+	}
+	return 1
+}
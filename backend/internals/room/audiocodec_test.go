@@ -0,0 +1,84 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// opus returns an Opus capability at clockRate with fmtp.
+func opus(clockRate uint32, fmtp string) webrtc.RTPCodecCapability {
+	return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: clockRate, Channels: 2, SDPFmtpLine: fmtp}
+}
+
+func TestAudioChannels(t *testing.T) {
+	for _, tc := range []struct {
+		codec webrtc.RTPCodecCapability
+		param string
+		want  uint16
+	}{
+		{opus(48000, "minptime=10;useinbandfec=1"), "sprop-stereo", 1},
+		{opus(48000, "minptime=10;sprop-stereo=1"), "sprop-stereo", 2},
+		{opus(48000, "sprop-stereo=0"), "sprop-stereo", 1},
+		{opus(48000, "minptime=10; STEREO=1"), "stereo", 2},
+		{opus(48000, "sprop-stereo=1"), "stereo", 1},
+		{opus(48000, ""), "stereo", 1},
+		{webrtc.RTPCodecCapability{MimeType: "audio/opus", ClockRate: 48000, Channels: 2, SDPFmtpLine: "stereo=1"}, "stereo", 2},
+		{webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypePCMU, ClockRate: 8000}, "stereo", 1},
+		{webrtc.RTPCodecCapability{MimeType: "audio/L16", ClockRate: 44100, Channels: 2}, "stereo", 2},
+	} {
+		if got := audioChannels(tc.codec, tc.param); got != tc.want {
+			t.Errorf("audioChannels(%s %q, %s) = %d, want %d", tc.codec.MimeType, tc.codec.SDPFmtpLine, tc.param, got, tc.want)
+		}
+	}
+}
+
+func TestCompareAudioCodec(t *testing.T) {
+	mono := opus(48000, "minptime=10;useinbandfec=1")
+	stereo := opus(48000, "minptime=10;useinbandfec=1;sprop-stereo=1")
+
+	for _, tc := range []struct {
+		name       string
+		published  webrtc.RTPCodecCapability
+		negotiated []webrtc.RTPCodecCapability
+		want       int
+	}{
+		{"mono to mono", mono, []webrtc.RTPCodecCapability{opus(48000, "useinbandfec=1")}, audioMatch},
+		{"stereo to stereo", stereo, []webrtc.RTPCodecCapability{opus(48000, "stereo=1")}, audioMatch},
+		{"mono to stereo", mono, []webrtc.RTPCodecCapability{opus(48000, "stereo=1")}, audioChannelsDiffer},
+		{"stereo to mono", stereo, []webrtc.RTPCodecCapability{opus(48000, "")}, audioChannelsDiffer},
+		{"matching entry among others", stereo, []webrtc.RTPCodecCapability{opus(48000, ""), opus(48000, "stereo=1")}, audioMatch},
+		{"other clock rate", mono, []webrtc.RTPCodecCapability{opus(16000, "")}, audioMismatch},
+		{"other clock rate beside other channels", mono, []webrtc.RTPCodecCapability{opus(16000, ""), opus(48000, "stereo=1")}, audioChannelsDiffer},
+		{"nothing negotiated", mono, nil, audioMismatch},
+		{
+			"pcmu",
+			webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypePCMU, ClockRate: 8000},
+			[]webrtc.RTPCodecCapability{{MimeType: webrtc.MimeTypePCMU, ClockRate: 8000, Channels: 1}},
+			audioMatch,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := compareAudioCodec(tc.published, tc.negotiated); got != tc.want {
+				t.Fatalf("compareAudioCodec = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCodecMismatchError(t *testing.T) {
+	var err error = &CodecMismatchError{
+		TrackID:    "t1",
+		Published:  opus(48000, ""),
+		Negotiated: []webrtc.RTPCodecCapability{opus(16000, ""), opus(24000, "")},
+	}
+	if !errors.Is(fmt.Errorf("subscribe: %w", err), ErrCodecMismatch) {
+		t.Fatal("wrapped CodecMismatchError does not match ErrCodecMismatch")
+	}
+	want := "codec mismatch: audio/opus is sent at 48000 Hz, the subscriber negotiated 16000, 24000 Hz"
+	if got := err.Error(); got != want {
+		t.Fatalf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+package room
+
+import (
+	"hash/fnv"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+)
+
+// Broadcast rooms serve one or a few presenters to many viewers. Only peers
+// joined with a publishing role may send tracks; everyone else joins as a
+// viewer (see peer.Peer.Viewer), whose tracks are rejected. As viewers never
+// publish, their joins and leaves never renegotiate the presenters. Dominant
+// speaker detection is not run, and only a stable sample of viewers report
+// quality stats.
+
+// RoomModeBroadcast is the RoomSettings.Mode of a broadcast room.
+const RoomModeBroadcast = "broadcast"
+
+// RejectPublisherRoleRequired is the reason a viewer's track, or that of a
+// peer whose publishing window has ended, is rejected.
+const RejectPublisherRoleRequired = "publisher_role_required"
+
+// IsBroadcast reports whether the room is in broadcast mode.
+func (r *Room) IsBroadcast() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.Settings.Mode == RoomModeBroadcast
+}
+
+// SetViewerStatsSample sets the share of viewers, in percent, whose quality
+// stats are reported in a broadcast room that does not set its own.
+func (r *Room) SetViewerStatsSample(percent int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.viewerStatsPercent = percent
+}
+
+// reportsQuality reports whether p's quality stats are sent. A viewer is in
+// the sample or not for as long as it stays, so the sampled viewers keep
+// reporting steadily rather than a different few each round.
+func (r *Room) reportsQuality(p *peer.Peer) bool {
+	if !p.Viewer {
+		return true
+	}
+	r.mu.RLock()
+	percent := r.Settings.ViewerStatsSamplePercent
+	if percent == 0 {
+		percent = r.viewerStatsPercent
+	}
+	r.mu.RUnlock()
+
+	if percent >= 100 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(p.ID))
+	return int(h.Sum32()%100) < percent
+}
+
+// AnnouncesViewers reports whether viewers' joins and leaves are announced
+// individually rather than only counted. It takes no lock, so it is safe in
+// callbacks that run under the room lock.
+func (r *Room) AnnouncesViewers() bool {
+	return r.viewerEvents.Load()
+}
+
+// ParticipantCounts returns how many publishers and viewers are in the room.
+// Observers are hidden and counted in neither.
+func (r *Room) ParticipantCounts() (publishers, viewers int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, p := range r.Peers {
+		switch {
+		case p.Observer:
+		case p.Viewer:
+			viewers++
+		default:
+			publishers++
+		}
+	}
+	return publishers, viewers
+}
@@ -0,0 +1,239 @@
+package room
+
+import (
+	"maps"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+)
+
+// A room accumulates what the summary of its call needs as it goes: every
+// join and leave, a participant-seconds integral for the average size, the
+// quality levels of every stats tick and a count of errors by kind. When
+// the room closes, FinishCallSummary turns them into one CallSummary. The
+// call starts with the first participant to join; a room nobody joined has
+// no summary.
+
+// Error kinds counted in CallSummary.Errors
+const (
+	CallErrorTrackRejected         = "track_rejected"
+	CallErrorConnectionInterrupted = "connection_interrupted"
+	CallErrorConnectionLost        = "connection_lost"
+)
+
+// CallSummary describes a room's call once it has ended.
+type CallSummary struct {
+	RoomID           string            `json:"roomId"`
+	Name             string            `json:"name"`
+	StartedAt        time.Time         `json:"startedAt"`
+	EndedAt          time.Time         `json:"endedAt"`
+	DurationSec      float64           `json:"durationSec"`
+	PeakParticipants int               `json:"peakParticipants"`
+	AvgParticipants  float64           `json:"avgParticipants"`
+	BytesForwarded   uint64            `json:"bytesForwarded"`
+	PacketsForwarded uint64            `json:"packetsForwarded"`
+	Participants     []CallParticipant `json:"participants"`
+	Quality          CallQuality       `json:"quality"`
+	RecordingEnabled bool              `json:"recordingEnabled"`
+	Recordings       []string          `json:"recordings,omitempty"` // set by the caller
+	Errors           map[string]int    `json:"errors"`
+	CloseReason      string            `json:"closeReason,omitempty"` // set by the caller
+}
+
+// CallParticipant is one user's attendance. A user who rejoined has one
+// session per connection.
+type CallParticipant struct {
+	UserID      string        `json:"userId"`
+	Name        string        `json:"name"`
+	Observer    bool          `json:"observer,omitempty"`
+	TalkTimeSec float64       `json:"talkTimeSec"`
+	Sessions    []CallSession `json:"sessions"`
+}
+
+// CallSession is the time one peer of a user spent in the room.
+type CallSession struct {
+	PeerID   string    `json:"peerId"`
+	JoinedAt time.Time `json:"joinedAt"`
+	LeftAt   time.Time `json:"leftAt"`
+}
+
+// CallQuality is the distribution of participant quality levels over every
+// stats tick of the call.
+type CallQuality struct {
+	Samples int                `json:"samples"` // participant quality readings
+	Levels  map[string]float64 `json:"levels"`  // percent of samples per level
+}
+
+// callStats is what a room records toward its call summary.
+type callStats struct {
+	mu           sync.Mutex
+	startedAt    time.Time
+	participants int // current, observers excluded
+	peak         int
+	lastChange   time.Time
+	peerSeconds  float64 // participants integrated over time
+	attendance   map[string]*CallParticipant
+	open         map[string]int // peerID -> index of its open session
+	levels       map[string]int
+	samples      int
+	errors       map[string]int
+	finished     atomic.Bool
+}
+
+// advance integrates the participant count up to now.
+// MUST be called with cs.mu held.
+func (cs *callStats) advance(now time.Time) {
+	if !cs.lastChange.IsZero() {
+		cs.peerSeconds += float64(cs.participants) * now.Sub(cs.lastChange).Seconds()
+	}
+	cs.lastChange = now
+}
+
+// recordJoin opens a session for p.
+func (r *Room) recordJoin(p *peer.Peer, now time.Time) {
+	cs := &r.call
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.attendance == nil {
+		cs.attendance = make(map[string]*CallParticipant)
+		cs.open = make(map[string]int)
+	}
+	if !p.Observer {
+		if cs.startedAt.IsZero() {
+			cs.startedAt = now
+		}
+		cs.advance(now)
+		cs.participants++
+		cs.peak = max(cs.peak, cs.participants)
+	}
+	part, ok := cs.attendance[p.UserID]
+	if !ok {
+		part = &CallParticipant{UserID: p.UserID, Name: p.GetName(), Observer: p.Observer}
+		cs.attendance[p.UserID] = part
+	}
+	part.Observer = part.Observer && p.Observer
+	cs.open[p.ID] = len(part.Sessions)
+	part.Sessions = append(part.Sessions, CallSession{PeerID: p.ID, JoinedAt: now})
+}
+
+// recordLeave closes p's session.
+func (r *Room) recordLeave(p *peer.Peer, now time.Time) {
+	cs := &r.call
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	i, ok := cs.open[p.ID]
+	if !ok {
+		return
+	}
+	delete(cs.open, p.ID)
+	cs.attendance[p.UserID].Sessions[i].LeftAt = now
+	if !p.Observer {
+		cs.advance(now)
+		cs.participants--
+	}
+}
+
+// recordQualitySamples counts the levels of one stats tick.
+func (r *Room) recordQualitySamples(samples []peerQualitySample) {
+	if len(samples) == 0 {
+		return
+	}
+	cs := &r.call
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.levels == nil {
+		cs.levels = make(map[string]int, len(qualityLevels))
+	}
+	for _, q := range samples {
+		cs.levels[q.Level]++
+		cs.samples++
+	}
+}
+
+// countCallError counts an error of kind toward the call summary.
+func (r *Room) countCallError(kind string) {
+	cs := &r.call
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.errors == nil {
+		cs.errors = make(map[string]int)
+	}
+	cs.errors[kind]++
+}
+
+// FinishCallSummary returns the summary of the room's call, closing the
+// sessions of anyone still in it. Only the first call after the room was
+// closed gets it; later ones, and rooms nobody joined, get false.
+func (r *Room) FinishCallSummary() (CallSummary, bool) {
+	r.mu.RLock()
+	closed := r.State == RoomStateClosed
+	name, recording := r.Name, r.Settings != nil && r.Settings.RecordingEnabled
+	r.mu.RUnlock()
+	if !closed || !r.call.finished.CompareAndSwap(false, true) {
+		return CallSummary{}, false
+	}
+
+	talkTime := r.TalkTimes()
+	forwarded := r.GetForwardingStats()
+	now := time.Now()
+
+	cs := &r.call
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.startedAt.IsZero() {
+		return CallSummary{}, false
+	}
+	cs.advance(now)
+
+	summary := CallSummary{
+		RoomID:           r.ID,
+		Name:             name,
+		StartedAt:        cs.startedAt,
+		EndedAt:          now,
+		DurationSec:      now.Sub(cs.startedAt).Seconds(),
+		PeakParticipants: cs.peak,
+		BytesForwarded:   forwarded.BytesTotal,
+		PacketsForwarded: forwarded.PacketsTotal,
+		Participants:     make([]CallParticipant, 0, len(cs.attendance)),
+		Quality:          CallQuality{Samples: cs.samples, Levels: make(map[string]float64, len(qualityLevels))},
+		RecordingEnabled: recording,
+		Errors:           maps.Clone(cs.errors),
+	}
+	if summary.DurationSec > 0 {
+		summary.AvgParticipants = cs.peerSeconds / summary.DurationSec
+	}
+	for _, level := range qualityLevels {
+		summary.Quality.Levels[level] = 0
+		if cs.samples > 0 {
+			summary.Quality.Levels[level] = float64(cs.levels[level]) / float64(cs.samples) * 100
+		}
+	}
+	if summary.Errors == nil {
+		summary.Errors = make(map[string]int)
+	}
+
+	for _, part := range cs.attendance {
+		p := *part
+		p.Sessions = append([]CallSession(nil), part.Sessions...)
+		for i := range p.Sessions {
+			if p.Sessions[i].LeftAt.IsZero() {
+				p.Sessions[i].LeftAt = now
+			}
+		}
+		p.TalkTimeSec = talkTime[p.UserID].Seconds()
+		summary.Participants = append(summary.Participants, p)
+	}
+	sort.Slice(summary.Participants, func(i, j int) bool {
+		a, b := summary.Participants[i], summary.Participants[j]
+		if !a.Sessions[0].JoinedAt.Equal(b.Sessions[0].JoinedAt) {
+			return a.Sessions[0].JoinedAt.Before(b.Sessions[0].JoinedAt)
+		}
+		return a.UserID < b.UserID
+	})
+	return summary, true
+}
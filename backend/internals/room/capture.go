@@ -0,0 +1,141 @@
+package room
+
+import (
+	"errors"
+
+	"github.com/pion/rtp"
+)
+
+// A packet tap copies the packets of a track for debug captures: inbound,
+// as read from the publisher before anything is dropped, or outbound, as
+// written toward one subscriber. A track has at most one tap at a time.
+// Taps run on the forwarding goroutines, so they must not block.
+
+var (
+	ErrTrackCaptured    = errors.New("track is already being captured")
+	ErrNothingToTap     = errors.New("no tracks match the capture")
+	ErrNotSubscribed    = errors.New("peer is not subscribed to the track")
+	ErrSubscriberNeeded = errors.New("outbound captures need the subscribing peer")
+)
+
+// PacketTap receives tapped packets. It must not block, modify pkt or keep
+// it after returning.
+type PacketTap func(pkt *rtp.Packet)
+
+// trackTap is installed on a tapped track, and on the subscriber for
+// outbound taps.
+type trackTap struct {
+	fn         PacketTap
+	subscriber string // "" = inbound
+}
+
+// tapInbound passes a packet read from the publisher to mt's tap, if any.
+func (mt *MediaTrack) tapInbound(pkt *rtp.Packet) {
+	if t := mt.tap.Load(); t != nil && t.subscriber == "" {
+		t.fn(pkt)
+	}
+}
+
+// Tap installs fn on the tracks selected by ref (a track handle) and
+// peerID. Inbound, ref selects one track and peerID all tracks the peer
+// publishes. Outbound, peerID is the subscriber and ref optionally narrows
+// its subscriptions to one track. It returns the handles of the tapped
+// tracks and a function that removes the taps.
+func (r *Room) Tap(ref, peerID string, outbound bool, fn PacketTap) ([]string, func(), error) {
+	if outbound && peerID == "" {
+		return nil, nil, ErrSubscriberNeeded
+	}
+
+	r.mu.RLock()
+	var tracks []*MediaTrack
+	if ref != "" {
+		mt, ok := r.resolveTrackLocked(ref)
+		if !ok || (!outbound && peerID != "" && mt.PeerID != peerID) {
+			r.mu.RUnlock()
+			return nil, nil, ErrTrackNotFound
+		}
+		tracks = append(tracks, mt)
+	} else {
+		for _, mt := range r.MediaTracks {
+			if outbound {
+				mt.mu.RLock()
+				_, subscribed := mt.Subscribers[peerID]
+				mt.mu.RUnlock()
+				if subscribed {
+					tracks = append(tracks, mt)
+				}
+			} else if mt.PeerID == peerID {
+				tracks = append(tracks, mt)
+			}
+		}
+	}
+	r.mu.RUnlock()
+	if len(tracks) == 0 {
+		return nil, nil, ErrNothingToTap
+	}
+
+	t := &trackTap{fn: fn}
+	if outbound {
+		t.subscriber = peerID
+	}
+	var installed []*MediaTrack
+	untap := func() {
+		for _, mt := range installed {
+			mt.untap(t)
+		}
+	}
+	handles := make([]string, 0, len(tracks))
+	for _, mt := range tracks {
+		if err := mt.installTap(t); err != nil {
+			untap()
+			return nil, nil, err
+		}
+		installed = append(installed, mt)
+		handles = append(handles, mt.Handle)
+	}
+	return handles, untap, nil
+}
+
+func (mt *MediaTrack) installTap(t *trackTap) error {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	var sub *SubscriberState
+	if t.subscriber != "" {
+		if sub = mt.Subscribers[t.subscriber]; sub == nil {
+			return ErrNotSubscribed
+		}
+	}
+	if !mt.tap.CompareAndSwap(nil, t) {
+		return ErrTrackCaptured
+	}
+	if sub != nil {
+		sub.tap.Store(outboundTap(sub, t.fn))
+	}
+	return nil
+}
+
+func (mt *MediaTrack) untap(t *trackTap) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	if !mt.tap.CompareAndSwap(t, nil) {
+		return
+	}
+	if sub := mt.Subscribers[t.subscriber]; sub != nil {
+		sub.tap.Store(nil)
+	}
+}
+
+// outboundTap wraps fn to see packets with the SSRC the subscriber receives
+// them with, which the local track only sets while writing.
+func outboundTap(sub *SubscriberState, fn PacketTap) *PacketTap {
+	var ssrc uint32
+	if encodings := sub.Sender.GetParameters().Encodings; len(encodings) > 0 {
+		ssrc = uint32(encodings[0].SSRC)
+	}
+	wrapped := PacketTap(func(pkt *rtp.Packet) {
+		out := *pkt
+		out.SSRC = ssrc
+		fn(&out)
+	})
+	return &wrapped
+}
@@ -0,0 +1,246 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/capture"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// subscribeSender subscribes peerID to mt through a real RTP sender, as
+// outbound taps read the SSRC the subscriber receives from it.
+func subscribeSender(t *testing.T, mt *MediaTrack, peerID string) *SubscriberState {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	local, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, mt.ID, "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := pc.AddTrack(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := &SubscriberState{PeerID: peerID, LocalTrack: local, Sender: sender, kind: mt.Kind, cancel: func() {}}
+	mt.mu.Lock()
+	mt.Subscribers[peerID] = sub
+	mt.mu.Unlock()
+	return sub
+}
+
+func TestTap(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	cam := addTrack(r, "cam", "alice", "video")
+	mic := addTrack(r, "mic", "alice", "audio")
+	other := addTrack(r, "bob-cam", "bob", "video")
+	var tapped atomic.Int32
+	count := func(*rtp.Packet) { tapped.Add(1) }
+
+	// A track by handle, or all a publisher's tracks
+	handles, untapCam, err := r.Tap(cam.Handle, "alice", false, count)
+	if err != nil || len(handles) != 1 || handles[0] != cam.Handle {
+		t.Fatalf("tap of the camera: %v, %v", handles, err)
+	}
+	cam.tapInbound(rtpPacket(1))
+	mic.tapInbound(rtpPacket(1))
+	if tapped.Load() != 1 {
+		t.Fatalf("%d packets tapped, want the camera's", tapped.Load())
+	}
+
+	// One capture per track; a refused tap leaves nothing installed
+	if _, _, err := r.Tap("", "alice", false, count); !errors.Is(err, ErrTrackCaptured) {
+		t.Fatalf("second tap of the camera: %v", err)
+	}
+	if _, untap, err := r.Tap(mic.Handle, "", false, count); err != nil {
+		t.Fatalf("mic still tapped after a refused capture: %v", err)
+	} else {
+		untap()
+	}
+	untapCam()
+	handles, untapAll, err := r.Tap("", "alice", false, count)
+	if err != nil || len(handles) != 2 {
+		t.Fatalf("tap of alice after untapping: %v, %v", handles, err)
+	}
+	untapAll()
+	untapAll() // a second call is harmless
+
+	for _, tc := range []struct {
+		name     string
+		ref      string
+		peerID   string
+		outbound bool
+		want     error
+	}{
+		{"another publisher's track", other.Handle, "alice", false, ErrTrackNotFound},
+		{"unknown track", "nope", "", false, ErrTrackNotFound},
+		{"peer without tracks", "", "carol", false, ErrNothingToTap},
+		{"outbound without a subscriber", cam.Handle, "", true, ErrSubscriberNeeded},
+		{"outbound to a non-subscriber", cam.Handle, "carol", true, ErrNotSubscribed},
+		{"outbound to a peer without subscriptions", "", "carol", true, ErrNothingToTap},
+	} {
+		if _, _, err := r.Tap(tc.ref, tc.peerID, tc.outbound, count); !errors.Is(err, tc.want) {
+			t.Errorf("%s: %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestOutboundTap(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	cam := addTrack(r, "cam", "alice", "video")
+	mic := addTrack(r, "mic", "alice", "audio")
+	carol := subscribeSender(t, cam, "carol")
+	dave := subscribeSender(t, mic, "dave")
+
+	var got []*rtp.Packet
+	handles, untap, err := r.Tap("", "carol", true, func(pkt *rtp.Packet) {
+		out := *pkt
+		got = append(got, &out)
+	})
+	if err != nil || len(handles) != 1 || handles[0] != cam.Handle {
+		t.Fatalf("outbound tap of carol: %v, %v", handles, err)
+	}
+	if dave.tap.Load() != nil {
+		t.Fatal("another subscriber was tapped")
+	}
+
+	// Packets go out with the subscriber's SSRC; inbound sees nothing
+	cam.tapInbound(rtpPacket(1))
+	in := rtpPacket(2)
+	(*carol.tap.Load())(in)
+	want := uint32(carol.Sender.GetParameters().Encodings[0].SSRC)
+	if len(got) != 1 || got[0].SSRC != want || got[0].SequenceNumber != 2 {
+		t.Fatalf("tapped %v, want packet 2 with SSRC %d", got, want)
+	}
+	if in.SSRC != 1234 {
+		t.Fatal("the tap changed the forwarded packet")
+	}
+
+	untap()
+	if carol.tap.Load() != nil || cam.tap.Load() != nil {
+		t.Fatal("tap left installed")
+	}
+}
+
+func rtpPacket(seq uint16) *rtp.Packet {
+	return &rtp.Packet{
+		Header:  rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 960, SSRC: 1234},
+		Payload: make([]byte, 160),
+	}
+}
+
+// Starting and stopping a capture while a track forwards to its subscribers
+// costs the forwarding path no more than a small bound per packet, and
+// every subscriber still gets every packet in order.
+func TestCaptureDoesNotPerturbForwarding(t *testing.T) {
+	const (
+		subscribers = 20
+		phase       = 2000
+	)
+	ft := newFanOutTest(t, 0, 0)
+	ft.mt.PeerID = "alice"
+	ft.r.mu.Lock()
+	ft.mt.Handle = ft.r.newTrackHandle()
+	ft.r.MediaTracks[ft.mt.ID] = ft.mt
+	ft.r.trackHandles[ft.mt.Handle] = ft.mt.ID
+	ft.r.mu.Unlock()
+	seqs := make([]*sequence, subscribers)
+	for i := range seqs {
+		seqs[i] = &sequence{}
+		ft.subscribe(t, fmt.Sprintf("peer-%d", i), seqs[i].tap)
+	}
+
+	// One packet through the read loop's inbound tap and the fan-out
+	var seq uint16
+	var forwarded atomic.Int32
+	forward := func() time.Duration {
+		defer forwarded.Add(1)
+		seq++
+		pkt := rtpPacket(seq)
+		start := time.Now()
+		ft.mt.tapInbound(pkt)
+		ft.r.fanOut(ft.mt, fanOutItem{packet: pkt})
+		return time.Since(start)
+	}
+	// Packets are paced, so the capture starts and stops among them
+	run := func(n int) []time.Duration {
+		d := make([]time.Duration, n)
+		for i := range d {
+			start := time.Now()
+			d[i] = forward()
+			for time.Since(start) < 50*time.Microsecond {
+			}
+		}
+		sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+		return d
+	}
+	quantile := func(d []time.Duration, q float64) time.Duration { return d[int(q*float64(len(d)-1))] }
+
+	run(phase) // warm up
+	before := run(phase)
+
+	// The capture is started a quarter into the next phase and stopped at
+	// three quarters, from another goroutine as the API does
+	c, err := capture.Start(filepath.Join(t.TempDir(), "c.pcap"), capture.Options{Format: capture.FormatPcap, Duration: time.Minute, MaxBytes: 1 << 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := forwarded.Load()
+	reach := func(n int) {
+		for forwarded.Load()-base < int32(n) {
+			time.Sleep(50 * time.Microsecond)
+		}
+	}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		reach(phase / 4)
+		_, untap, err := ft.r.Tap("", "alice", false, c.Write)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		reach(3 * phase / 4)
+		untap()
+		c.Stop(capture.StopRequested)
+	}()
+	during := run(phase)
+	<-stopped
+	<-c.Done()
+	after := run(phase)
+
+	for _, q := range []float64{0.5, 0.99} {
+		b, d, a := quantile(before, q), quantile(during, q), quantile(after, q)
+		t.Logf("p%.0f per packet: %v before, %v capturing, %v after", q*100, b, d, a)
+	}
+	// The bounds are wall-clock, so they only hold on a quiet, uninstrumented
+	// run; that a tap never waits on the writer is TestWriteCountsDropsWhenFull
+	if !testing.Short() && !raceEnabled {
+		if d, b := quantile(during, 0.5), quantile(before, 0.5); d > b+100*time.Microsecond {
+			t.Fatalf("capturing raised the median forwarding time from %v to %v", b, d)
+		}
+		if d, b := quantile(during, 0.99), quantile(before, 0.99); d > b+time.Millisecond {
+			t.Fatalf("capturing raised the p99 forwarding time from %v to %v", b, d)
+		}
+	}
+	if stats := c.Stats(); stats.Packets == 0 || stats.Packets+stats.Dropped >= phase {
+		t.Fatalf("captured %d packets and dropped %d of the phase's %d", stats.Packets, stats.Dropped, phase)
+	}
+	for i, s := range seqs {
+		if last, n := s.check(t, fmt.Sprintf("peer-%d", i)); n != 4*phase || last != seq {
+			t.Fatalf("peer-%d got %d packets up to %d, want %d up to %d", i, n, last, 4*phase, seq)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package room
+
+// A room starts closing when its owner calls BeginClose, ahead of tearing
+// down what it keeps about the room, or at the latest in Close. From then on
+// the room emits no events: each callback emission point and timer body
+// checks silenced, so nothing arrives after the owner has announced the
+// room closed. Close runs once however often it is called, and returns only
+// after the room's background loops have exited.
+
+// BeginClose silences the room's events ahead of Close.
+func (r *Room) BeginClose() {
+	r.closing.Store(true)
+}
+
+// Closing reports whether the room has begun closing.
+func (r *Room) Closing() bool {
+	return r.closing.Load()
+}
+
+// silenced reports whether the room's events are suppressed.
+func (r *Room) silenced() bool {
+	return r.closing.Load()
+}
+
+// goLoopLocked runs loop as one of the background loops Close waits for,
+// unless the room has closed. MUST be called with r.mu held, which orders
+// the loop's start before Close's wait. Because Close waits for them, a
+// loop must never reach Close, directly or through a callback it fires:
+// the room would wait on the loop closing it. The time limit, whose
+// OnTimeLimitReached closes the room, runs outside the loops for that
+// reason.
+func (r *Room) goLoopLocked(loop func()) {
+	if r.closed.Load() {
+		return
+	}
+	r.loops.Add(1)
+	go func() {
+		defer r.loops.Done()
+		loop()
+	}()
+}
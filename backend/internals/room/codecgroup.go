@@ -0,0 +1,354 @@
+package room
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+// Codec alternative groups let a publisher send one source in several codecs
+// (e.g. VP8 and H264) without the SFU forwarding every copy to everyone. The
+// publisher declares the alternatives before publishing them; each subscriber
+// then receives exactly one, the first in the publisher's order that the
+// subscriber's SDP supports. Subscribers see the group handle as the track ID
+// and use it in layer-switch and keyframe requests, whichever alternative
+// they actually receive. Nothing is transcoded.
+
+const groupHandlePrefix = "g_"
+
+type codecGroup struct {
+	Handle string
+	PeerID string
+	order  []string // declared WebRTC track IDs, publisher's preference first
+
+	// mu guards members and chosen; it is never held while taking another lock
+	mu      sync.Mutex
+	members map[string]*MediaTrack // WebRTC track ID -> published alternative
+	chosen  map[string]string      // subscriber peer ID -> WebRTC track ID it receives
+	// Manually subscribing peers that asked for the group
+	subscribers map[string]bool
+
+	// fwdMu serialises forwarding decisions for the group. Lock order:
+	// fwdMu, then r.mu, then mu.
+	fwdMu sync.Mutex
+}
+
+func groupKey(peerID, trackID string) string {
+	return peerID + "/" + trackID
+}
+
+// codecs returns the MIME types of the published alternatives in preference
+// order.
+func (g *codecGroup) codecs() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := make([]string, 0, len(g.members))
+	for _, id := range g.order {
+		if mt, ok := g.members[id]; ok {
+			out = append(out, mt.Track.Codec().MimeType)
+		}
+	}
+	return out
+}
+
+// subscribed reports whether a manually subscribing peer asked for g.
+func (g *codecGroup) subscribed(peerID string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.subscribers[peerID]
+}
+
+// pick returns the alternative target should receive, or nil if it supports
+// none of the published ones.
+func (g *codecGroup) pick(target *peer.Peer) *MediaTrack {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, id := range g.order {
+		if mt, ok := g.members[id]; ok && target.SupportsCodec(mt.Track.Codec().MimeType) {
+			return mt
+		}
+	}
+	return nil
+}
+
+// DeclareCodecAlternatives registers the publisher's WebRTC track IDs as
+// codec alternatives of one source and returns the group handle. The tracks
+// must not be published yet, otherwise they would already have been
+// forwarded to everyone.
+func (r *Room) DeclareCodecAlternatives(p *peer.Peer, trackIDs []string) (string, error) {
+	if len(trackIDs) < 2 {
+		return "", fmt.Errorf("at least two alternatives are required")
+	}
+	seen := make(map[string]bool, len(trackIDs))
+	for _, id := range trackIDs {
+		if id == "" || seen[id] {
+			return "", fmt.Errorf("invalid or duplicate track ID: %q", id)
+		}
+		seen[id] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.Peers[p.ID]; !ok {
+		return "", ErrPeerNotFound
+	}
+	for _, id := range trackIDs {
+		if _, exists := r.MediaTracks[id]; exists {
+			return "", fmt.Errorf("track %s is already published; declare alternatives before publishing", id)
+		}
+		if _, grouped := r.groupByTrack[groupKey(p.ID, id)]; grouped {
+			return "", fmt.Errorf("track %s is already in a codec group", id)
+		}
+	}
+
+	g := &codecGroup{
+		Handle:  r.newGroupHandle(),
+		PeerID:  p.ID,
+		order:   append([]string(nil), trackIDs...),
+		members: make(map[string]*MediaTrack, len(trackIDs)),
+		chosen:  make(map[string]string),
+
+		subscribers: make(map[string]bool),
+	}
+	r.codecGroups[g.Handle] = g
+	for _, id := range trackIDs {
+		r.groupByTrack[groupKey(p.ID, id)] = g
+	}
+
+	r.logger.Info("Codec alternatives declared",
+		zap.String("roomID", r.ID),
+		zap.String("peerID", p.ID),
+		zap.String("group", g.Handle),
+		zap.Strings("trackIDs", trackIDs),
+	)
+	return g.Handle, nil
+}
+
+// newGroupHandle allocates a group handle unique within the room.
+// MUST be called with r.mu held (write lock).
+func (r *Room) newGroupHandle() string {
+	for {
+		b := make([]byte, 4)
+		rand.Read(b)
+		handle := groupHandlePrefix + hex.EncodeToString(b)
+		if _, taken := r.codecGroups[handle]; !taken {
+			return handle
+		}
+	}
+}
+
+// joinCodecGroup attaches a newly published track to its declared group.
+// MUST be called with r.mu held (write lock), before the track is forwarded.
+func (r *Room) joinCodecGroup(mt *MediaTrack) {
+	g, ok := r.groupByTrack[groupKey(mt.PeerID, mt.ID)]
+	if !ok {
+		return
+	}
+	mt.group = g
+	g.mu.Lock()
+	g.members[mt.ID] = mt
+	g.mu.Unlock()
+}
+
+// GroupHandle returns the handle of the track's codec group, or "".
+func (mt *MediaTrack) GroupHandle() string {
+	if mt.group == nil {
+		return ""
+	}
+	return mt.group.Handle
+}
+
+// ResolveTrackFor is ResolveTrack that also accepts a group handle, resolving
+// it to the alternative peerID receives (or the preferred published one).
+func (r *Room) ResolveTrackFor(ref, peerID string) (*MediaTrack, bool) {
+	r.mu.RLock()
+	g, isGroup := r.codecGroups[ref]
+	r.mu.RUnlock()
+	if !isGroup {
+		return r.ResolveTrack(ref)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if mt, ok := g.members[g.chosen[peerID]]; ok {
+		return mt, true
+	}
+	for _, id := range g.order {
+		if mt, ok := g.members[id]; ok {
+			return mt, true
+		}
+	}
+	return nil, false
+}
+
+// forwardGroupToOtherPeers re-evaluates the alternative every other peer
+// should receive after the group changed. Manually subscribing peers only
+// take part once they have subscribed to the group.
+func (r *Room) forwardGroupToOtherPeers(g *codecGroup, excludePeerID string) {
+	r.mu.RLock()
+	peers := make([]*peer.Peer, 0, len(r.Peers))
+	for _, p := range r.Peers {
+		if p.ID == excludePeerID || p.Connection == nil {
+			continue
+		}
+		if p.ManualSubscribe && !g.subscribed(p.ID) {
+			continue
+		}
+		peers = append(peers, p)
+	}
+	r.mu.RUnlock()
+
+	for _, p := range peers {
+		go r.forwardGroupToPeer(g, p, false)
+	}
+}
+
+// forwardGroupToPeer makes sure target receives its preferred alternative,
+// replacing a less preferred one it may already have. With direct, the track
+// is only attached (for callers that answer the peer's offer themselves);
+// otherwise renegotiation is triggered. Reports whether a track was attached.
+func (r *Room) forwardGroupToPeer(g *codecGroup, target *peer.Peer, direct bool) bool {
+	if !direct && r.queueForward(nil, g, target) {
+		return false
+	}
+
+	g.fwdMu.Lock()
+	defer g.fwdMu.Unlock()
+
+	pick := g.pick(target)
+	if pick != nil && !r.admitSubscriber(pick, target) {
+		return false
+	}
+	g.mu.Lock()
+	current := g.members[g.chosen[target.ID]]
+	if pick == nil || pick == current {
+		g.mu.Unlock()
+		if pick == nil {
+			r.logger.Debug("Subscriber supports no published codec alternative",
+				zap.String("group", g.Handle),
+				zap.String("peerID", target.ID),
+			)
+		}
+		return false
+	}
+	g.chosen[target.ID] = pick.ID
+	g.mu.Unlock()
+
+	if current != nil {
+		r.stopForwarding(current, target)
+	}
+
+	r.logger.Debug("Forwarding codec alternative",
+		zap.String("group", g.Handle),
+		zap.String("peerID", target.ID),
+		zap.String("codec", pick.Track.Codec().MimeType),
+	)
+
+	if direct {
+		return r.forwardTrackToPeerDirect(pick, target)
+	}
+	r.forwardTrackToPeer(pick, target)
+	return true
+}
+
+// stopForwarding detaches mt from target, freeing the transceiver for reuse.
+// Reports whether target was receiving mt.
+func (r *Room) stopForwarding(mt *MediaTrack, target *peer.Peer) bool {
+	mt.mu.Lock()
+	sub, ok := mt.Subscribers[target.ID]
+	if ok {
+		delete(mt.Subscribers, target.ID)
+		delete(mt.LocalTracks, target.ID)
+		mt.rebuildSnapshot()
+	}
+	mt.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	sub.stop()
+	if err := target.ReleaseSender(sub.Sender); err != nil {
+		sub.Sender.Stop()
+	}
+	r.waitSubscribers([]*SubscriberState{sub})
+	return true
+}
+
+// leaveCodecGroup detaches a removed track from its group. Subscribers that
+// were receiving it fall back to another alternative; the group is dropped
+// once none of its declared tracks remain.
+func (r *Room) leaveCodecGroup(mt *MediaTrack) {
+	g := mt.group
+	if g == nil {
+		return
+	}
+
+	r.mu.Lock()
+	delete(r.groupByTrack, groupKey(g.PeerID, mt.ID))
+	g.mu.Lock()
+	delete(g.members, mt.ID)
+	var orphaned []string
+	for peerID, id := range g.chosen {
+		if id == mt.ID {
+			orphaned = append(orphaned, peerID)
+			delete(g.chosen, peerID)
+		}
+	}
+	remaining := len(g.members)
+	g.mu.Unlock()
+
+	declared := false
+	for _, id := range g.order {
+		if r.groupByTrack[groupKey(g.PeerID, id)] == g {
+			declared = true
+			break
+		}
+	}
+	if !declared {
+		delete(r.codecGroups, g.Handle)
+	}
+	targets := make([]*peer.Peer, 0, len(orphaned))
+	for _, peerID := range orphaned {
+		if p, ok := r.Peers[peerID]; ok {
+			targets = append(targets, p)
+		}
+	}
+	r.mu.Unlock()
+
+	if remaining == 0 {
+		return
+	}
+	for _, p := range targets {
+		go r.forwardGroupToPeer(g, p, false)
+	}
+}
+
+// dropPeerCodecGroups removes the groups peerID declared and forgets which
+// alternatives it was receiving.
+func (r *Room) dropPeerCodecGroups(peerID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dropPeerCodecGroupsLocked(peerID)
+}
+
+// dropPeerCodecGroupsLocked is dropPeerCodecGroups with r.mu held.
+func (r *Room) dropPeerCodecGroupsLocked(peerID string) {
+	for handle, g := range r.codecGroups {
+		if g.PeerID == peerID {
+			for _, id := range g.order {
+				delete(r.groupByTrack, groupKey(peerID, id))
+			}
+			delete(r.codecGroups, handle)
+			continue
+		}
+		g.mu.Lock()
+		delete(g.chosen, peerID)
+		delete(g.subscribers, peerID)
+		g.mu.Unlock()
+	}
+}
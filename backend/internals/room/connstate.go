@@ -0,0 +1,185 @@
+package room
+
+import (
+	"sync"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/webrtc/v3"
+)
+
+// Other participants learn that a peer's media connection dropped while it
+// is still in the room, not only once the grace ends and the peer leaves,
+// so UIs can show it as reconnecting. A connected peer that goes
+// disconnected or failed is reported through OnPeerConnectionState once
+// the state has lasted the debounce, so a blip that recovers at once is
+// never reported; its recovery is reported right away. The report stands
+// for late joiners until then (see PeerConnectionState).
+
+// Default for SetConnectionStateDebounce.
+const defaultConnStateDebounce = time.Second
+
+// PeerConnectionChange is a reported change of a peer's media connection.
+type PeerConnectionChange struct {
+	State string    // "disconnected", "failed" or, on recovery, "connected"
+	Since time.Time // when the peer entered State
+	// For "connected", how long the connection was down
+	Outage time.Duration
+}
+
+// connStates holds the room's peers' connection reports.
+type connStates struct {
+	mu       sync.Mutex
+	byPeer   map[string]*peerConnState
+	debounce time.Duration
+	set      bool // debounce configured
+}
+
+// peerConnState is one peer's media connection as last seen and reported.
+type peerConnState struct {
+	peer      *peer.Peer
+	connected bool // has been connected; earlier states are never reported
+	state     webrtc.PeerConnectionState
+	since     time.Time
+	downSince time.Time // start of the current outage
+	reported  string    // degraded state last reported, "" when none
+	timer     *time.Timer
+	gen       uint64 // bumped whenever timer is replaced or cancelled
+}
+
+// cancelTimer stops a pending report. MUST be called with connStates.mu
+// held.
+func (st *peerConnState) cancelTimer() {
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	st.gen++
+}
+
+// SetConnectionStateDebounce sets how long a peer's connection must stay
+// disconnected or failed before it is reported; 0 reports it at once.
+func (r *Room) SetConnectionStateDebounce(d time.Duration) {
+	c := &r.connState
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.debounce = d
+	c.set = true
+}
+
+// handlePeerConnectionState follows p's connection state.
+func (r *Room) handlePeerConnectionState(p *peer.Peer, state webrtc.PeerConnectionState) {
+	if !r.isCurrentPeer(p) {
+		return
+	}
+	c := &r.connState
+	c.mu.Lock()
+	if c.byPeer == nil {
+		c.byPeer = make(map[string]*peerConnState)
+	}
+	st := c.byPeer[p.ID]
+	if st == nil || st.peer != p {
+		st = &peerConnState{peer: p}
+		c.byPeer[p.ID] = st
+	}
+
+	now := time.Now()
+	var change *PeerConnectionChange
+	switch state {
+	case webrtc.PeerConnectionStateConnected:
+		st.connected = true
+		st.cancelTimer()
+		if st.reported != "" {
+			change = &PeerConnectionChange{State: state.String(), Since: now, Outage: now.Sub(st.downSince)}
+		}
+		st.state, st.since = state, now
+		st.reported, st.downSince = "", time.Time{}
+
+	case webrtc.PeerConnectionStateDisconnected, webrtc.PeerConnectionStateFailed:
+		if !st.connected || st.state == state {
+			break
+		}
+		if st.downSince.IsZero() {
+			st.downSince = now
+		}
+		st.state, st.since = state, now
+		debounce := defaultConnStateDebounce
+		if c.set {
+			debounce = c.debounce
+		}
+		switch {
+		case st.reported != "" || debounce <= 0:
+			// Already reported as down, or no debounce: report the new state now
+			st.cancelTimer()
+			st.reported = state.String()
+			change = &PeerConnectionChange{State: st.reported, Since: now}
+		case st.timer == nil:
+			st.gen++
+			gen := st.gen
+			st.timer = time.AfterFunc(debounce, func() { r.reportConnStateAfterDebounce(st, gen) })
+		}
+	}
+	c.mu.Unlock()
+
+	if change != nil {
+		r.notifyConnState(p, *change)
+	}
+}
+
+// reportConnStateAfterDebounce reports st's degraded state once it has
+// lasted the debounce, unless it recovered or was dropped meanwhile.
+func (r *Room) reportConnStateAfterDebounce(st *peerConnState, gen uint64) {
+	c := &r.connState
+	c.mu.Lock()
+	if c.byPeer[st.peer.ID] != st || st.gen != gen {
+		c.mu.Unlock()
+		return
+	}
+	st.timer = nil
+	st.reported = st.state.String()
+	change := PeerConnectionChange{State: st.reported, Since: st.since}
+	c.mu.Unlock()
+
+	r.notifyConnState(st.peer, change)
+}
+
+func (r *Room) notifyConnState(p *peer.Peer, change PeerConnectionChange) {
+	if r.OnPeerConnectionState != nil && !r.silenced() && r.isCurrentPeer(p) {
+		r.OnPeerConnectionState(r, p, change)
+	}
+}
+
+// PeerConnectionState returns the reported state of the peer's connection
+// while it is reported as down.
+func (r *Room) PeerConnectionState(peerID string) (PeerConnectionChange, bool) {
+	c := &r.connState
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.byPeer[peerID]
+	if st == nil || st.reported == "" {
+		return PeerConnectionChange{}, false
+	}
+	return PeerConnectionChange{State: st.reported, Since: st.since}, true
+}
+
+// dropConnState forgets p's connection reports.
+func (r *Room) dropConnState(p *peer.Peer) {
+	c := &r.connState
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if st, ok := c.byPeer[p.ID]; ok && st.peer == p {
+		st.cancelTimer()
+		delete(c.byPeer, p.ID)
+	}
+}
+
+// dropConnStates forgets every peer's connection reports.
+func (r *Room) dropConnStates() {
+	c := &r.connState
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, st := range c.byPeer {
+		st.cancelTimer()
+	}
+	c.byPeer = nil
+}
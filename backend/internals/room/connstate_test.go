@@ -0,0 +1,123 @@
+package room
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// connStateReports collects the room's connection reports.
+func connStateReports(r *Room) chan PeerConnectionChange {
+	reports := make(chan PeerConnectionChange, 16)
+	r.OnPeerConnectionState = func(_ *Room, _ *peer.Peer, change PeerConnectionChange) {
+		reports <- change
+	}
+	return reports
+}
+
+func expectConnReport(t *testing.T, reports chan PeerConnectionChange, within time.Duration) PeerConnectionChange {
+	t.Helper()
+	select {
+	case change := <-reports:
+		return change
+	case <-time.After(within):
+		t.Fatal("no connection state reported")
+		return PeerConnectionChange{}
+	}
+}
+
+func expectNoConnReport(t *testing.T, reports chan PeerConnectionChange, within time.Duration) {
+	t.Helper()
+	select {
+	case change := <-reports:
+		t.Fatalf("reported %+v", change)
+	case <-time.After(within):
+	}
+}
+
+func TestPeerConnectionStateDebounce(t *testing.T) {
+	const debounce = 100 * time.Millisecond
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	r.SetConnectionStateDebounce(debounce)
+	reports := connStateReports(r)
+	p := joinAs(t, r, "alice", nil)
+
+	// A connection that never came up is not reported as down
+	r.handlePeerConnectionState(p, webrtc.PeerConnectionStateConnecting)
+	r.handlePeerConnectionState(p, webrtc.PeerConnectionStateFailed)
+	expectNoConnReport(t, reports, 2*debounce)
+
+	// A blip that recovers within the debounce is never reported
+	r.handlePeerConnectionState(p, webrtc.PeerConnectionStateConnected)
+	r.handlePeerConnectionState(p, webrtc.PeerConnectionStateDisconnected)
+	time.Sleep(debounce / 5)
+	r.handlePeerConnectionState(p, webrtc.PeerConnectionStateConnected)
+	expectNoConnReport(t, reports, 2*debounce)
+	if _, ok := r.PeerConnectionState(p.ID); ok {
+		t.Fatal("a blip stands as a report")
+	}
+
+	// One that lasts is reported once the debounce is up, with when it began
+	down := time.Now()
+	r.handlePeerConnectionState(p, webrtc.PeerConnectionStateDisconnected)
+	r.handlePeerConnectionState(p, webrtc.PeerConnectionStateDisconnected)
+	expectNoConnReport(t, reports, debounce/2)
+	change := expectConnReport(t, reports, time.Second)
+	if change.State != "disconnected" || change.Since.Before(down) || time.Since(down) < debounce {
+		t.Fatalf("reported %+v %v after the drop", change, time.Since(down))
+	}
+	expectNoConnReport(t, reports, debounce)
+	if standing, ok := r.PeerConnectionState(p.ID); !ok || standing.State != "disconnected" {
+		t.Fatalf("standing report %+v, %v", standing, ok)
+	}
+
+	// Once reported, a worse state is reported at once
+	r.handlePeerConnectionState(p, webrtc.PeerConnectionStateFailed)
+	if change := expectConnReport(t, reports, debounce/2); change.State != "failed" {
+		t.Fatalf("reported %+v, want failed", change)
+	}
+
+	// and so is the recovery, with how long the connection was down
+	r.handlePeerConnectionState(p, webrtc.PeerConnectionStateConnected)
+	change = expectConnReport(t, reports, debounce/2)
+	if change.State != "connected" || change.Outage < debounce || change.Outage > time.Since(down) {
+		t.Fatalf("recovery reported %+v %v after the drop", change, time.Since(down))
+	}
+	if standing, ok := r.PeerConnectionState(p.ID); ok {
+		t.Fatalf("recovered peer still reported %+v", standing)
+	}
+	expectNoConnReport(t, reports, 2*debounce)
+}
+
+func TestPeerConnectionStateDebounceCancelled(t *testing.T) {
+	const debounce = 100 * time.Millisecond
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	r.SetConnectionStateDebounce(debounce)
+	reports := connStateReports(r)
+
+	// A peer that leaves during the debounce is not reported
+	alice := joinAs(t, r, "alice", nil)
+	r.handlePeerConnectionState(alice, webrtc.PeerConnectionStateConnected)
+	r.handlePeerConnectionState(alice, webrtc.PeerConnectionStateFailed)
+	if err := r.RemovePeer(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectNoConnReport(t, reports, 2*debounce)
+	// nor is a state change after it left
+	r.handlePeerConnectionState(alice, webrtc.PeerConnectionStateConnected)
+	expectNoConnReport(t, reports, debounce)
+
+	// Without a debounce a drop is reported at once
+	r.SetConnectionStateDebounce(0)
+	bob := joinAs(t, r, "bob", nil)
+	r.handlePeerConnectionState(bob, webrtc.PeerConnectionStateConnected)
+	r.handlePeerConnectionState(bob, webrtc.PeerConnectionStateDisconnected)
+	if change := expectConnReport(t, reports, debounce/2); change.State != "disconnected" {
+		t.Fatalf("reported %+v, want disconnected", change)
+	}
+}
@@ -0,0 +1,169 @@
+package room
+
+import (
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// DataMessage is a data channel broadcast retained in the room history.
+type DataMessage struct {
+	Seq    uint64
+	From   string // excluded sender, never replayed back to it
+	Data   []byte
+	SentAt time.Time
+}
+
+// PeerDelivery is the outcome of a broadcast for a single peer.
+type PeerDelivery struct {
+	PeerID string `json:"peerId"`
+	Sent   bool   `json:"sent"`
+	Queued bool   `json:"queued"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BroadcastResult summarises a data channel broadcast. Sent counts successful
+// DataChannel.Send calls; Queued counts peers whose channel was not open yet.
+type BroadcastResult struct {
+	Seq    uint64         `json:"seq"`
+	Sent   int            `json:"sent"`
+	Queued int            `json:"queued"`
+	Failed int            `json:"failed"`
+	Peers  []PeerDelivery `json:"peers"`
+}
+
+// SetDataChannelOptions configures how many broadcasts are retained for late
+// joiners and how messages are queued for peers whose channel is not open.
+func (r *Room) SetDataChannelOptions(historySize, queueSize int, queueTTL time.Duration) {
+	r.dataMu.Lock()
+	defer r.dataMu.Unlock()
+	r.dataHistorySize = historySize
+	r.dataQueueSize = queueSize
+	r.dataQueueTTL = queueTTL
+	if len(r.dataHistory) > historySize {
+		r.dataHistory = r.dataHistory[len(r.dataHistory)-historySize:]
+	}
+}
+
+// NextDataSeq reserves the sequence number for the next broadcast, so callers
+// can embed it in the message envelope before calling BroadcastMessage.
+func (r *Room) NextDataSeq() uint64 {
+	r.dataMu.Lock()
+	defer r.dataMu.Unlock()
+	r.dataSeq++
+	return r.dataSeq
+}
+
+// BroadcastMessage sends message over the data channel of every peer except
+// excludePeerID, queueing it for peers whose channel has not opened yet, and
+// records it in the room history. seq should come from NextDataSeq.
+func (r *Room) BroadcastMessage(seq uint64, message []byte, excludePeerID string) *BroadcastResult {
+	r.mu.RLock()
+	peers := make([]*peer.Peer, 0, len(r.Peers))
+	for _, p := range r.Peers {
+		if p.ID != excludePeerID {
+			peers = append(peers, p)
+		}
+	}
+	r.mu.RUnlock()
+
+	r.dataMu.Lock()
+	// Peers whose channel has not been through handlePeerDataChannelOpen get
+	// the message after their replay, even if the channel is already open
+	held := make(map[string]bool)
+	for _, p := range peers {
+		if !r.dataReplayed[p.ID] {
+			held[p.ID] = true
+		}
+	}
+	if r.dataHistorySize > 0 {
+		if len(r.dataHistory) >= r.dataHistorySize {
+			r.dataHistory = r.dataHistory[1:]
+		}
+		r.dataHistory = append(r.dataHistory, DataMessage{
+			Seq:    seq,
+			From:   excludePeerID,
+			Data:   message,
+			SentAt: time.Now(),
+		})
+	}
+	r.dataMu.Unlock()
+
+	result := &BroadcastResult{Seq: seq, Peers: make([]PeerDelivery, 0, len(peers))}
+	for _, p := range peers {
+		delivery := PeerDelivery{PeerID: p.ID}
+		send := p.SendOrQueueDataChannelMessage
+		if held[p.ID] {
+			send = p.HoldDataChannelMessage
+		}
+		sent, err := send(seq, message)
+		switch {
+		case err != nil:
+			delivery.Error = err.Error()
+			result.Failed++
+			r.logger.Debug("Failed to send message to peer",
+				zap.String("peerID", p.ID),
+				zap.Error(err),
+			)
+		case sent:
+			delivery.Sent = true
+			result.Sent++
+		default:
+			delivery.Queued = true
+			result.Queued++
+		}
+		result.Peers = append(result.Peers, delivery)
+	}
+	return result
+}
+
+// GetDataHistory returns a copy of the retained broadcasts, oldest first.
+func (r *Room) GetDataHistory() []DataMessage {
+	r.dataMu.Lock()
+	defer r.dataMu.Unlock()
+	history := make([]DataMessage, len(r.dataHistory))
+	copy(history, r.dataHistory)
+	return history
+}
+
+// handlePeerDataChannelOpen replays the room history to a peer the first time
+// its data channel opens, then flushes anything queued for it that the replay
+// did not already cover.
+func (r *Room) handlePeerDataChannelOpen(p *peer.Peer, dc *webrtc.DataChannel) {
+	r.dataMu.Lock()
+	if r.dataReplayed[p.ID] {
+		r.dataMu.Unlock()
+		p.FlushPendingData(nil)
+		return
+	}
+	r.dataReplayed[p.ID] = true
+	history := make([]DataMessage, len(r.dataHistory))
+	copy(history, r.dataHistory)
+	r.dataMu.Unlock()
+
+	replayed := make(map[uint64]bool, len(history))
+	for _, msg := range history {
+		if msg.From == p.ID {
+			continue
+		}
+		if err := dc.Send(msg.Data); err != nil {
+			r.logger.Debug("Failed to replay data channel history",
+				zap.String("peerID", p.ID),
+				zap.Error(err),
+			)
+			break
+		}
+		replayed[msg.Seq] = true
+	}
+
+	flushed := p.FlushPendingData(func(seq uint64) bool { return replayed[seq] })
+	if len(replayed) > 0 || flushed > 0 {
+		r.logger.Debug("Delivered data channel backlog",
+			zap.String("peerID", p.ID),
+			zap.Int("replayed", len(replayed)),
+			zap.Int("flushed", flushed),
+		)
+	}
+}
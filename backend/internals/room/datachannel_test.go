@@ -0,0 +1,179 @@
+package room
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// dataClient is the browser end of a peer's data channel.
+type dataClient struct {
+	mu       sync.Mutex
+	received []string
+}
+
+func (c *dataClient) get() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.received...)
+}
+
+// connectData opens a data channel from a new client to p, whose connection
+// it creates, and records what the client receives. The two connect over l,
+// or over the host's network when l is nil.
+func connectData(t *testing.T, p *peer.Peer, l *link) *dataClient {
+	t.Helper()
+	serverAPI, clientAPI := webrtc.NewAPI(), webrtc.NewAPI()
+	if l != nil {
+		serverAPI, clientAPI = l.server, l.client
+	}
+	if err := p.CreatePeerConnection(serverAPI, webrtc.Configuration{}); err != nil {
+		t.Fatal(err)
+	}
+	pc, err := clientAPI.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	c := &dataClient{}
+	dc, err := pc.CreateDataChannel("sfu-data", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		c.mu.Lock()
+		c.received = append(c.received, string(msg.Data))
+		c.mu.Unlock()
+	})
+
+	// The client's offer carries its candidates; the peer's trickle in as
+	// they would over signaling
+	p.OnICECandidateGenerated = func(_ *peer.Peer, candidate *webrtc.ICECandidate) {
+		if candidate != nil {
+			pc.AddICECandidate(candidate.ToJSON())
+		}
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	if err := p.Connection.SetRemoteDescription(*pc.LocalDescription()); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := p.Connection.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetRemoteDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Connection.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func broadcast(r *Room, data, from string) *BroadcastResult {
+	return r.BroadcastMessage(r.NextDataSeq(), []byte(data), from)
+}
+
+func expectReceived(t *testing.T, c *dataClient, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for len(c.get()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Nothing is delivered twice
+	time.Sleep(100 * time.Millisecond)
+	if got := c.get(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("received %v, want %v", got, want)
+	}
+}
+
+func TestDataChannelHistoryReplay(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	r.SetDataChannelOptions(3, 10, time.Minute)
+
+	// Only the last three are kept, and bob's own is not replayed to him
+	for i := 1; i <= 3; i++ {
+		broadcast(r, fmt.Sprintf("m%d", i), "")
+	}
+	broadcast(r, "m4", "bob-peer")
+
+	bob := peer.NewPeer(r.ID, "bob", "", zap.NewNop())
+	bob.ID = "bob-peer"
+	if err := r.AddPeer(bob); err != nil {
+		t.Fatal(err)
+	}
+	// Until his channel opens bob's messages wait in his queue; this one is
+	// in the history too and must arrive once
+	if res := broadcast(r, "m5", ""); res.Queued != 1 || res.Sent != 0 {
+		t.Fatalf("broadcast before open: %+v", res)
+	}
+	if n := len(r.GetDataHistory()); n != 3 {
+		t.Fatalf("%d messages in the history, want 3", n)
+	}
+
+	c := connectData(t, bob, nil)
+	expectReceived(t, c, "m3", "m5")
+
+	if res := broadcast(r, "m6", ""); res.Sent != 1 {
+		t.Fatalf("broadcast after open: %+v", res)
+	}
+	expectReceived(t, c, "m3", "m5", "m6")
+}
+
+func TestDataChannelQueueFlush(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	// Without a history the queue alone covers the wait, up to its bound
+	r.SetDataChannelOptions(0, 2, time.Minute)
+
+	bob := peer.NewPeer(r.ID, "bob", "", zap.NewNop())
+	if err := r.AddPeer(bob); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		broadcast(r, fmt.Sprintf("m%d", i), "")
+	}
+	c := connectData(t, bob, nil)
+	expectReceived(t, c, "m2", "m3")
+}
+
+func TestDataChannelBroadcastWhileOpening(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	r.SetDataChannelOptions(10, 10, time.Minute)
+	broadcast(r, "before", "")
+
+	bob := peer.NewPeer(r.ID, "bob", "", zap.NewNop())
+	if err := r.AddPeer(bob); err != nil {
+		t.Fatal(err)
+	}
+	// One lands once the channel exists but before it is open, the other
+	// once it is open but before the history has been replayed
+	bob.OnDataChannel = func(*peer.Peer, *webrtc.DataChannel) {
+		broadcast(r, "connecting", "")
+	}
+	replay := bob.OnDataChannelOpen
+	bob.OnDataChannelOpen = func(p *peer.Peer, dc *webrtc.DataChannel) {
+		broadcast(r, "open", "")
+		replay(p, dc)
+	}
+
+	c := connectData(t, bob, nil)
+	expectReceived(t, c, "before", "connecting", "open")
+}
@@ -0,0 +1,53 @@
+package room
+
+import "sync"
+
+// A room's broadcasts start from different goroutines: the join, the peer
+// callbacks, the speaker loop. Sent as they come, a client could see a
+// peer's track before the peer itself. Dispatch puts them in one order,
+// numbered by the room's sequence, and delivers them in it.
+
+// dispatcher is the room's broadcast queue.
+type dispatcher struct {
+	mu      sync.Mutex
+	seq     uint64
+	queue   []dispatchItem
+	running bool // a Dispatch call is delivering the queue
+}
+
+type dispatchItem struct {
+	seq     uint64
+	deliver func(seq uint64)
+}
+
+// Dispatch runs deliver with the room's next broadcast sequence number,
+// after every deliver of earlier calls. If no other call is delivering,
+// this one delivers before it returns, along with whatever is queued behind
+// it meanwhile; otherwise deliver is left to that call. deliver must not
+// take the room's lock, as Dispatch may be called with it held. Nothing is
+// delivered once the room has begun closing.
+func (r *Room) Dispatch(deliver func(seq uint64)) {
+	if r.silenced() {
+		return
+	}
+	d := &r.dispatch
+	d.mu.Lock()
+	d.seq++
+	d.queue = append(d.queue, dispatchItem{seq: d.seq, deliver: deliver})
+	if d.running {
+		d.mu.Unlock()
+		return
+	}
+	d.running = true
+	for len(d.queue) > 0 {
+		item := d.queue[0]
+		d.queue[0] = dispatchItem{}
+		d.queue = d.queue[1:]
+		d.mu.Unlock()
+		item.deliver(item.seq)
+		d.mu.Lock()
+	}
+	d.queue = nil
+	d.running = false
+	d.mu.Unlock()
+}
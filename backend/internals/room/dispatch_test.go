@@ -0,0 +1,95 @@
+package room
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+func TestDispatchOrder(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+
+	var mu sync.Mutex
+	var delivered []uint64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				r.Dispatch(func(seq uint64) {
+					mu.Lock()
+					delivered = append(delivered, seq)
+					mu.Unlock()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if len(delivered) != 1000 {
+		t.Fatalf("%d delivered, want 1000", len(delivered))
+	}
+	for i, seq := range delivered {
+		if seq != uint64(i+1) {
+			t.Fatalf("delivery %d numbered %d", i, seq)
+		}
+	}
+}
+
+func TestDispatchUnderRoomLock(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+
+	// Peer callbacks run with the room locked; with no other call
+	// delivering, a dispatch from one is delivered before it returns
+	var joined []uint64
+	r.OnPeerJoined = func(*Room, *peer.Peer) {
+		r.Dispatch(func(seq uint64) { joined = append(joined, seq) })
+	}
+	joinAs(t, r, "alice", nil)
+	if len(joined) != 1 || joined[0] != 1 {
+		t.Fatalf("peer-joined delivered as %v", joined)
+	}
+
+	// While another call delivers, a dispatch under the lock is queued and
+	// returns at once, to be delivered by that call after its own
+	release := make(chan struct{})
+	first := make(chan uint64, 1)
+	second := make(chan uint64, 1)
+	started := make(chan struct{})
+	go r.Dispatch(func(seq uint64) {
+		close(started)
+		<-release
+		first <- seq
+	})
+	<-started
+	queued := make(chan struct{})
+	go func() {
+		r.mu.Lock()
+		r.Dispatch(func(seq uint64) { second <- seq })
+		r.mu.Unlock()
+		close(queued)
+	}()
+	select {
+	case <-queued:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Dispatch under the room lock blocked behind a running delivery")
+	}
+	select {
+	case seq := <-second:
+		t.Fatalf("delivered as %d ahead of the running delivery", seq)
+	default:
+	}
+	close(release)
+	if a, b := <-first, <-second; a != 2 || b != 3 {
+		t.Fatalf("delivered as %d then %d, want 2 then 3", a, b)
+	}
+
+	// Nothing is delivered once the room begins closing
+	r.BeginClose()
+	r.Dispatch(func(seq uint64) { t.Fatalf("delivered %d while closing", seq) })
+}
@@ -0,0 +1,150 @@
+package room
+
+import (
+	"context"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+// Peers are kept through a disconnect grace and sessions are suspended for
+// a resume, so a room can hold only peers whose connections are all down.
+// Once that has lasted the dormancy threshold the room goes dormant: its
+// stats and speaker loops stop and its tracks, which carry nothing, are
+// removed along with their forwarding. The room itself, its peers and its
+// settings stay so that a resume can find it. The first peer to join or
+// get its connection back wakes the room and restarts the loops.
+
+// RoomStateDormant is the state of a room whose peers are all disconnected.
+const RoomStateDormant RoomState = "dormant"
+
+// dormancy is the room's sleep state and its background loops.
+// Guarded by r.mu.
+type dormancy struct {
+	idleSince time.Time // every peer disconnected since; zero otherwise
+	since     time.Time // dormant since
+
+	// Stats and speaker loops run on loops until the room goes dormant
+	loops          context.Context
+	stopLoops      context.CancelFunc
+	speakerStarted bool
+	statsStarted   bool
+}
+
+// loopsContextLocked returns the context the room's loops run on.
+// MUST be called with r.mu held.
+func (r *Room) loopsContextLocked() context.Context {
+	if r.dormancy.loops == nil {
+		r.dormancy.loops, r.dormancy.stopLoops = context.WithCancel(r.ctx)
+	}
+	return r.dormancy.loops
+}
+
+// setStateLocked moves the room to state, keeping the dormant-rooms gauge
+// in step. MUST be called with r.mu held.
+func (r *Room) setStateLocked(state RoomState) {
+	if r.State == state {
+		return
+	}
+	if r.State == RoomStateDormant {
+		appmetrics.RecordRoomDormant(false)
+	} else if state == RoomStateDormant {
+		appmetrics.RecordRoomDormant(true)
+	}
+	r.State = state
+}
+
+// IsDormant reports whether the room is asleep.
+func (r *Room) IsDormant() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.State == RoomStateDormant
+}
+
+// CheckDormant puts the room to sleep if every peer in it has been
+// disconnected for at least after, and reports whether it did. It is
+// called periodically; the first call that finds every peer disconnected
+// starts the clock.
+func (r *Room) CheckDormant(now time.Time, after time.Duration) bool {
+	r.mu.Lock()
+	if r.State != RoomStateActive || len(r.Peers) == 0 || r.anyPeerConnectedLocked() {
+		r.dormancy.idleSince = time.Time{}
+		r.mu.Unlock()
+		return false
+	}
+	if r.dormancy.idleSince.IsZero() {
+		r.dormancy.idleSince = now
+	}
+	if now.Sub(r.dormancy.idleSince) < after {
+		r.mu.Unlock()
+		return false
+	}
+
+	r.setStateLocked(RoomStateDormant)
+	r.dormancy.since = now
+	if r.dormancy.stopLoops != nil {
+		r.dormancy.stopLoops()
+		r.dormancy.loops, r.dormancy.stopLoops = nil, nil
+	}
+	type published struct {
+		p  *peer.Peer
+		mt *MediaTrack
+	}
+	tracks := make([]published, 0, len(r.MediaTracks))
+	for _, mt := range r.MediaTracks {
+		if p, ok := r.Peers[mt.PeerID]; ok {
+			tracks = append(tracks, published{p, mt})
+		}
+	}
+	peers := len(r.Peers)
+	idle := now.Sub(r.dormancy.idleSince)
+	r.mu.Unlock()
+
+	for _, t := range tracks {
+		r.removeTrack(t.p, t.mt)
+	}
+	r.logger.Info("Room dormant",
+		zap.String("roomID", r.ID),
+		zap.Int("peers", peers),
+		zap.Int("tracksRemoved", len(tracks)),
+		zap.Duration("disconnectedFor", idle),
+	)
+	return true
+}
+
+// anyPeerConnectedLocked reports whether any peer's connection is up.
+// MUST be called with r.mu held.
+func (r *Room) anyPeerConnectedLocked() bool {
+	for _, p := range r.Peers {
+		if p.IsConnected() {
+			return true
+		}
+	}
+	return false
+}
+
+// wakeLocked brings a dormant room back and restarts its loops.
+// MUST be called with r.mu held.
+func (r *Room) wakeLocked(reason string) {
+	r.dormancy.idleSince = time.Time{}
+	if r.State != RoomStateDormant {
+		return
+	}
+	r.setStateLocked(RoomStateActive)
+	ctx := r.loopsContextLocked()
+	if r.dormancy.speakerStarted {
+		interval := r.speakerDetectionInterval
+		r.goLoopLocked(func() { r.runDominantSpeakerDetection(ctx, interval) })
+	}
+	if r.dormancy.statsStarted {
+		interval := r.statsInterval
+		r.goLoopLocked(func() { r.runStatsCollection(ctx, interval) })
+	}
+	r.logger.Info("Room woke up",
+		zap.String("roomID", r.ID),
+		zap.String("reason", reason),
+		zap.Duration("dormantFor", time.Since(r.dormancy.since)),
+	)
+}
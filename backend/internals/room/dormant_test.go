@@ -0,0 +1,142 @@
+package room
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+// dormantTest is a room running its stats and speaker loops every 10ms,
+// with its peers' connections never up.
+type dormantTest struct {
+	r       *Room
+	samples atomic.Int64 // stats ticks
+	removed atomic.Int64 // tracks removed
+}
+
+func newDormantTest(t *testing.T) *dormantTest {
+	dt := &dormantTest{r: NewRoom("room-1", 10, zap.NewNop())}
+	t.Cleanup(func() { dt.r.Close() })
+	dt.r.SetStatsInterval(10 * time.Millisecond)
+	dt.r.SetSpeakerDetectionInterval(10 * time.Millisecond)
+	dt.r.SetLiveSampling(true)
+	dt.r.OnLiveSample = func(*Room, LiveSample) { dt.samples.Add(1) }
+	dt.r.OnTrackRemoved = func(*Room, *peer.Peer, *MediaTrack) { dt.removed.Add(1) }
+	dt.r.StartStatsCollection()
+	dt.r.StartDominantSpeakerDetection()
+	return dt
+}
+
+func (dt *dormantTest) join(t *testing.T, userID string) *peer.Peer {
+	p := peer.NewPeer(dt.r.ID, userID, "", zap.NewNop())
+	if err := dt.r.AddPeer(p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// loopsRunning reports whether the stats loop ticks within 200ms, and the
+// speaker loop picks up speaker as the dominant one over everyone heard
+// before.
+func (dt *dormantTest) loopsRunning(speaker *peer.Peer) (stats, speakers bool) {
+	dt.r.audioLevelsMu.Lock()
+	dt.r.audioLevels = make(map[string]*AudioLevel)
+	dt.r.audioLevelsMu.Unlock()
+	before := dt.samples.Load()
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		dt.r.trackAudioActivity(speaker.ID, speaker.UserID)
+		time.Sleep(5 * time.Millisecond)
+	}
+	return dt.samples.Load() > before, dt.r.GetDominantSpeaker() == speaker.ID
+}
+
+func TestDormantRoom(t *testing.T) {
+	dt := newDormantTest(t)
+	alice, bob := dt.join(t, "alice"), dt.join(t, "bob")
+	addTrack(dt.r, "alice-mic", alice.ID, "audio")
+	dormant := func() float64 { return testutil.ToFloat64(appmetrics.DormantRooms) }
+	gauge := dormant()
+
+	// The first check finds everyone disconnected and starts the clock
+	now := time.Now()
+	for _, after := range []time.Duration{0, 30 * time.Second} {
+		if dt.r.CheckDormant(now.Add(after), time.Minute) {
+			t.Fatalf("dormant %v after the first check", after)
+		}
+	}
+	if !dt.r.CheckDormant(now.Add(time.Minute), time.Minute) || !dt.r.IsDormant() {
+		t.Fatal("not dormant a minute after everyone disconnected")
+	}
+	if dormant() != gauge+1 {
+		t.Fatalf("dormant rooms gauge %v, want %v", dormant(), gauge+1)
+	}
+
+	// Asleep, the loops stop and the tracks are gone but the peers stay
+	if stats, speakers := dt.loopsRunning(alice); stats || speakers {
+		t.Fatalf("loops of a dormant room still running: stats %v, speakers %v", stats, speakers)
+	}
+	if dt.r.GetTrackCount() != 0 || dt.removed.Load() != 1 || dt.r.GetPeerCount() != 2 {
+		t.Fatalf("%d tracks (%d removed) and %d peers in a dormant room", dt.r.GetTrackCount(), dt.removed.Load(), dt.r.GetPeerCount())
+	}
+	if dt.r.CheckDormant(now.Add(time.Hour), time.Minute) || dormant() != gauge+1 {
+		t.Fatalf("dormant room put to sleep again, gauge %v", dormant())
+	}
+
+	// Alice resuming, which replaces her peer, wakes it
+	if err := dt.r.RemovePeer(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !dt.r.IsDormant() {
+		t.Fatal("woken by a peer leaving")
+	}
+	aliceAgain := dt.join(t, "alice")
+	if dt.r.IsDormant() || dormant() != gauge {
+		t.Fatalf("dormant %v after a join, gauge %v", dt.r.IsDormant(), dormant())
+	}
+	if stats, speakers := dt.loopsRunning(aliceAgain); !stats || !speakers {
+		t.Fatalf("loops after waking: stats %v, speakers %v", stats, speakers)
+	}
+
+	// The clock starts over, and a connection coming back wakes the room
+	// too
+	if dt.r.CheckDormant(now.Add(2*time.Hour), time.Minute) {
+		t.Fatal("dormant on the first check after waking")
+	}
+	if !dt.r.CheckDormant(now.Add(2*time.Hour+time.Minute), time.Minute) {
+		t.Fatal("not dormant a minute later")
+	}
+	dt.r.handlePeerRestored(bob)
+	if dt.r.IsDormant() {
+		t.Fatal("still dormant after a connection was restored")
+	}
+	if stats, speakers := dt.loopsRunning(bob); !stats || !speakers {
+		t.Fatalf("loops after waking: stats %v, speakers %v", stats, speakers)
+	}
+
+	// Closing a dormant room takes it off the gauge
+	dt.r.CheckDormant(now.Add(3*time.Hour), time.Minute)
+	dt.r.CheckDormant(now.Add(3*time.Hour+time.Minute), time.Minute)
+	if !dt.r.IsDormant() {
+		t.Fatal("not dormant before closing")
+	}
+	dt.r.Close()
+	if dormant() != gauge {
+		t.Fatalf("dormant rooms gauge %v after closing, want %v", dormant(), gauge)
+	}
+}
+
+// An empty room is left to the cleanup loop rather than put to sleep.
+func TestEmptyRoomNotDormant(t *testing.T) {
+	dt := newDormantTest(t)
+	now := time.Now()
+	dt.r.CheckDormant(now, 0)
+	if dt.r.CheckDormant(now.Add(time.Hour), 0) || dt.r.IsDormant() {
+		t.Fatal("empty room went dormant")
+	}
+}
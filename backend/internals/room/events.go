@@ -0,0 +1,94 @@
+package room
+
+import (
+	"sync"
+	"time"
+)
+
+// A room keeps its most recent events (joins, leaves and reconnects, tracks
+// coming and going, host, spotlight and mute-all changes) in a small ring
+// for live dashboards, and passes each to OnEvent for webhooks; the
+// dominant speaker, which changes too often to log, is in each live sample
+// instead. Events are numbered, so a reader asks for those after the last
+// one it saw; older events are overwritten.
+
+// eventRingSize is how many events a room keeps.
+const eventRingSize = 64
+
+// Types of RoomEvent
+const (
+	EventPeerJoined          = "peer-joined"
+	EventPeerLeft            = "peer-left"
+	EventTrackPublished      = "track-published"
+	EventTrackRemoved        = "track-removed"
+	EventTrackRejected       = "track-rejected"
+	EventHostChanged         = "host-changed"
+	EventPeerReconnected     = "peer-reconnected"
+	EventSpotlightChanged    = "spotlight-changed"
+	EventMuteAll             = "mute-all"
+	EventLockChanged         = "lock-changed"
+	EventRenegotiationForced = "renegotiation-forced"
+	EventICERestartForced    = "ice-restart-forced"
+)
+
+// RoomEvent is one entry of a room's event ring.
+type RoomEvent struct {
+	Seq     uint64    `json:"seq"`
+	Type    string    `json:"type"`
+	PeerID  string    `json:"peerId,omitempty"`
+	UserID  string    `json:"userId,omitempty"`
+	TrackID string    `json:"trackId,omitempty"`
+	Detail  string    `json:"detail,omitempty"` // e.g. a rejection reason
+	At      time.Time `json:"at"`
+}
+
+// eventRing holds the room's last eventRingSize events.
+type eventRing struct {
+	mu     sync.Mutex
+	events [eventRingSize]RoomEvent
+	last   uint64 // Seq of the newest event, 0 before the first
+}
+
+// recordEvent numbers ev, adds it to the ring and passes it to OnEvent.
+func (r *Room) recordEvent(ev RoomEvent) {
+	e := &r.events
+	e.mu.Lock()
+	e.last++
+	ev.Seq = e.last
+	if ev.At.IsZero() {
+		ev.At = time.Now()
+	}
+	e.events[e.last%eventRingSize] = ev
+	e.mu.Unlock()
+
+	if r.OnEvent != nil && !r.silenced() {
+		r.OnEvent(r, ev)
+	}
+}
+
+// lastEventSeq returns the number of the room's newest event.
+func (r *Room) lastEventSeq() uint64 {
+	r.events.mu.Lock()
+	defer r.events.mu.Unlock()
+	return r.events.last
+}
+
+// EventsSince returns the room's events numbered after seq that are still
+// in the ring, oldest first, and the number of the newest event.
+func (r *Room) EventsSince(seq uint64) ([]RoomEvent, uint64) {
+	e := &r.events
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	first := seq + 1
+	if e.last >= eventRingSize && first <= e.last-eventRingSize {
+		first = e.last - eventRingSize + 1
+	}
+	if first > e.last {
+		return nil, e.last
+	}
+	events := make([]RoomEvent, 0, e.last-first+1)
+	for n := first; n <= e.last; n++ {
+		events = append(events, e.events[n%eventRingSize])
+	}
+	return events, e.last
+}
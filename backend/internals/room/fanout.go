@@ -0,0 +1,139 @@
+package room
+
+import (
+	"hash/fnv"
+	"runtime"
+
+	"github.com/pion/rtp"
+	"go.uber.org/zap"
+)
+
+// Fan-out normally delivers every packet to every subscriber on the track's
+// reader goroutine (see pipeline.go for how each path delivers). Above
+// fanOutThreshold subscribers that loop is spread over shard workers: each
+// subscriber is hashed to one shard for the life of the track, so joins and
+// leaves never move a subscriber between workers and its packets stay in
+// order. A track stays sharded once it has crossed the threshold, since
+// falling back to the inline loop while shards still hold packets would
+// reorder them.
+
+// fanOutQueueSize is how many packets a shard worker may fall behind before
+// it drops them, like a subscriber's own write buffer.
+const fanOutQueueSize = 128
+
+// fanOutItem is one packet handed to the shard workers. A layered packet
+// only goes to subscribers on rid.
+type fanOutItem struct {
+	packet  *rtp.Packet
+	rid     string
+	layered bool
+	readAt  int64 // unix nanos of a sampled packet's read (see latency.go), else 0
+}
+
+// fanOutShards are a track's shard workers, one queue each.
+type fanOutShards struct {
+	queues []chan fanOutItem
+}
+
+// shardSnapshot is the subscriber snapshot split by shard.
+type shardSnapshot [][]*SubscriberState
+
+// SetParallelFanOut enables sharded fan-out for tracks with at least
+// threshold subscribers, over shards workers (0 = GOMAXPROCS). A zero
+// threshold disables it.
+func (r *Room) SetParallelFanOut(threshold, shards int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fanOutThreshold = threshold
+	r.fanOutShardCount = shards
+}
+
+func shardOf(peerID string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(peerID))
+	return int(h.Sum32() % uint32(n))
+}
+
+// rebuildShardsLocked splits the subscribers by shard. MUST be called with
+// mt.mu held.
+func (mt *MediaTrack) rebuildShardsLocked() {
+	sh := mt.shards.Load()
+	if sh == nil {
+		return
+	}
+	snap := make(shardSnapshot, len(sh.queues))
+	for _, sub := range mt.Subscribers {
+		i := shardOf(sub.PeerID, len(snap))
+		snap[i] = append(snap[i], sub)
+	}
+	mt.shardSnap.Store(snap)
+}
+
+// startShards switches mt to sharded fan-out.
+func (r *Room) startShards(mt *MediaTrack) *fanOutShards {
+	r.mu.RLock()
+	n := r.fanOutShardCount
+	r.mu.RUnlock()
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	if sh := mt.shards.Load(); sh != nil {
+		return sh
+	}
+	sh := &fanOutShards{queues: make([]chan fanOutItem, n)}
+	for i := range sh.queues {
+		sh.queues[i] = make(chan fanOutItem, fanOutQueueSize)
+	}
+	mt.shards.Store(sh)
+	mt.rebuildShardsLocked()
+	for i, q := range sh.queues {
+		go mt.runShard(i, q)
+	}
+
+	r.logger.Info("Parallel fan-out enabled",
+		zap.String("trackID", mt.ID),
+		zap.Int("subscribers", len(mt.Subscribers)),
+		zap.Int("shards", n),
+	)
+	return sh
+}
+
+// runShard delivers queued packets to the subscribers of shard i.
+func (mt *MediaTrack) runShard(i int, queue chan fanOutItem) {
+	for {
+		select {
+		case <-mt.ctx.Done():
+			return
+		case item := <-queue:
+			snap, _ := mt.shardSnap.Load().(shardSnapshot)
+			if i < len(snap) {
+				mt.path.deliver(snap[i], item)
+			}
+		}
+	}
+}
+
+// fanOut dispatches a packet read from mt along its path. The packet is
+// only read, never modified or pooled, so shard workers can share it.
+func (r *Room) fanOut(mt *MediaTrack, item fanOutItem) {
+	sh := mt.shards.Load()
+	if sh == nil {
+		snap := mt.getSnapshot()
+		if mt.fanOutThreshold <= 0 || len(snap) < mt.fanOutThreshold {
+			mt.path.deliver(snap, item)
+			return
+		}
+		sh = r.startShards(mt)
+	}
+
+	for _, q := range sh.queues {
+		select {
+		case q <- item:
+		default:
+			// shard is behind — drop for its subscribers only
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package room
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// fanOutTest is an audio track of a room that shards fan-out at threshold
+// subscribers, fed by the test instead of a publisher.
+type fanOutTest struct {
+	r  *Room
+	mt *MediaTrack
+}
+
+func newFanOutTest(tb testing.TB, threshold, shards int) *fanOutTest {
+	tb.Helper()
+	r := NewRoom("room-1", 0, zap.NewNop())
+	r.SetParallelFanOut(threshold, shards)
+	ctx, cancel := context.WithCancel(context.Background())
+	tb.Cleanup(cancel)
+	mt := &MediaTrack{
+		ID:              "track-1",
+		Kind:            "audio",
+		Subscribers:     make(map[string]*SubscriberState),
+		fanOutThreshold: threshold,
+		path:            audioPath,
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+	return &fanOutTest{r: r, mt: mt}
+}
+
+// subscribe adds a subscriber that hands what it is sent to tap.
+func (ft *fanOutTest) subscribe(tb testing.TB, peerID string, tap PacketTap) {
+	tb.Helper()
+	local, err := webrtc.NewTrackLocalStaticRTP(opus(48000, ""), "track-1", "publisher")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sub := &SubscriberState{PeerID: peerID, LocalTrack: local, kind: "audio"}
+	sub.tap.Store(&tap)
+
+	ft.mt.mu.Lock()
+	defer ft.mt.mu.Unlock()
+	ft.mt.Subscribers[peerID] = sub
+	ft.mt.rebuildSnapshot()
+}
+
+func (ft *fanOutTest) unsubscribe(peerID string) {
+	ft.mt.mu.Lock()
+	defer ft.mt.mu.Unlock()
+	delete(ft.mt.Subscribers, peerID)
+	ft.mt.rebuildSnapshot()
+}
+
+func (ft *fanOutTest) send(seq uint16) {
+	ft.r.fanOut(ft.mt, fanOutItem{packet: &rtp.Packet{
+		Header:  rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 960},
+		Payload: []byte{0xf8, 0xff, 0xfe},
+	}})
+}
+
+// idle reports whether the shard workers have taken every queued packet.
+func (ft *fanOutTest) idle() bool {
+	sh := ft.mt.shards.Load()
+	if sh == nil {
+		return true
+	}
+	for _, q := range sh.queues {
+		if len(q) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// sequence records the sequence numbers a subscriber is sent.
+type sequence struct {
+	mu   sync.Mutex
+	seqs []uint16
+}
+
+func (s *sequence) tap(pkt *rtp.Packet) {
+	s.mu.Lock()
+	s.seqs = append(s.seqs, pkt.SequenceNumber)
+	s.mu.Unlock()
+}
+
+// check fails unless the recorded sequence numbers only go up, and returns
+// the last.
+func (s *sequence) check(t *testing.T, peerID string) (last uint16, n int) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 1; i < len(s.seqs); i++ {
+		if s.seqs[i] <= s.seqs[i-1] {
+			t.Fatalf("%s got packet %d after %d", peerID, s.seqs[i], s.seqs[i-1])
+		}
+	}
+	if len(s.seqs) == 0 {
+		return 0, 0
+	}
+	return s.seqs[len(s.seqs)-1], len(s.seqs)
+}
+
+func TestFanOutOrderAcrossShardingThreshold(t *testing.T) {
+	const (
+		threshold = 8
+		packets   = 2000
+	)
+	ft := newFanOutTest(t, threshold, 4)
+
+	// These stay subscribed throughout; the others join and leave around
+	// them, taking the track across the threshold
+	steady := make(map[string]*sequence)
+	for i := 0; i < threshold/2; i++ {
+		id := fmt.Sprintf("steady-%d", i)
+		steady[id] = &sequence{}
+		ft.subscribe(t, id, steady[id].tap)
+	}
+
+	var (
+		churned   sync.Map
+		churnDone = make(chan struct{})
+		stop      = make(chan struct{})
+	)
+	go func() {
+		defer close(churnDone)
+		for round := 0; ; round++ {
+			for i := 0; i < threshold; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				id := fmt.Sprintf("churn-%d-%d", round, i)
+				seq := &sequence{}
+				churned.Store(id, seq)
+				ft.subscribe(t, id, seq.tap)
+				runtime.Gosched()
+			}
+			for i := 0; i < threshold; i++ {
+				ft.unsubscribe(fmt.Sprintf("churn-%d-%d", round, i))
+				runtime.Gosched()
+			}
+		}
+	}()
+
+	for seq := uint16(1); seq < packets; seq++ {
+		ft.send(seq)
+		if seq%64 == 0 {
+			time.Sleep(time.Millisecond) // let the shards keep up
+		}
+	}
+	close(stop)
+	<-churnDone
+	if ft.mt.shards.Load() == nil {
+		t.Fatal("track never switched to sharded fan-out")
+	}
+
+	// The last packet goes out once the shards have caught up, so none
+	// drops it
+	deadline := time.Now().Add(5 * time.Second)
+	for !ft.idle() {
+		if time.Now().After(deadline) {
+			t.Fatal("shards never caught up")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ft.send(packets)
+
+	for id, seq := range steady {
+		for {
+			last, n := seq.check(t, id)
+			if last == packets {
+				if n < packets/2 {
+					t.Fatalf("%s got %d of %d packets", id, n, packets)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s never got the last packet; last was %d", id, last)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	churned.Range(func(id, seq any) bool {
+		seq.(*sequence).check(t, id.(string))
+		return true
+	})
+}
+
+// BenchmarkFanOut times delivering one packet to every subscriber, inline
+// and over shard workers.
+func BenchmarkFanOut(b *testing.B) {
+	for _, mode := range []struct {
+		name      string
+		threshold int
+	}{
+		{"inline", 0},
+		{"sharded", 1},
+	} {
+		for _, n := range []int{10, 50, 200} {
+			b.Run(fmt.Sprintf("%s/subscribers=%d", mode.name, n), func(b *testing.B) {
+				ft := newFanOutTest(b, mode.threshold, 0)
+				var delivered atomic.Int64
+				for i := 0; i < n; i++ {
+					ft.subscribe(b, fmt.Sprintf("peer-%d", i), func(*rtp.Packet) { delivered.Add(1) })
+				}
+				ft.send(0) // switches the sharded track over
+				for delivered.Load() < int64(n) {
+					runtime.Gosched()
+				}
+
+				b.ResetTimer()
+				start := time.Now()
+				for i := 1; i <= b.N; i++ {
+					ft.send(uint16(i))
+					for delivered.Load() < int64((i+1)*n) {
+						runtime.Gosched()
+					}
+				}
+				elapsed := time.Since(start)
+				b.ReportMetric(float64(b.N*n)/elapsed.Seconds(), "writes/s")
+			})
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package room
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// forwardStats counts media written to subscribers. Writers only touch the
+// atomics; the bitrate is derived on the stats interval.
+type forwardStats struct {
+	bytes   atomic.Uint64
+	packets atomic.Uint64
+
+	mu        sync.Mutex
+	lastBytes uint64
+	lastAt    time.Time
+	bitrate   uint64 // bits per second over the last interval
+}
+
+func (fs *forwardStats) add(n int) {
+	fs.bytes.Add(uint64(n))
+	fs.packets.Add(1)
+}
+
+// sample recomputes the bitrate from the bytes written since the last call.
+func (fs *forwardStats) sample(now time.Time) {
+	total := fs.bytes.Load()
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.lastAt.IsZero() {
+		if elapsed := now.Sub(fs.lastAt).Seconds(); elapsed > 0 {
+			fs.bitrate = uint64(float64(total-fs.lastBytes) * 8 / elapsed)
+		}
+	}
+	fs.lastBytes = total
+	fs.lastAt = now
+}
+
+// ForwardingStats summarises the media a room has forwarded to subscribers.
+type ForwardingStats struct {
+	BytesTotal   uint64 `json:"bytesTotal"`
+	PacketsTotal uint64 `json:"packetsTotal"`
+	BitrateBps   uint64 `json:"bitrateBps"` // over the last stats interval
+}
+
+// GetForwardingStats returns the room's forwarded media totals.
+func (r *Room) GetForwardingStats() ForwardingStats {
+	r.forwarded.mu.Lock()
+	bitrate := r.forwarded.bitrate
+	r.forwarded.mu.Unlock()
+	return ForwardingStats{
+		BytesTotal:   r.forwarded.bytes.Load(),
+		PacketsTotal: r.forwarded.packets.Load(),
+		BitrateBps:   bitrate,
+	}
+}
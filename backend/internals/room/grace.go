@@ -0,0 +1,91 @@
+package room
+
+import (
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+// While a publisher's connection is interrupted its tracks stay registered,
+// subscriptions included, and subscribers are told the tracks are paused. If
+// the connection recovers within the grace (ICE reconnects on its own or the
+// client restarts ICE), forwarding resumes on the same transceivers without
+// renegotiation. Renegotiations needed meanwhile, because subscriptions
+// changed, are held and sent as one once the connection is back.
+
+// SetDisconnectGrace configures the grace applied to peers added afterwards.
+// With holdOnFailure, a failed connection is also held for the grace so an ICE
+// restart can recover it.
+func (r *Room) SetDisconnectGrace(grace time.Duration, holdOnFailure bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.disconnectGrace = grace
+	r.holdOnFailure = holdOnFailure
+}
+
+func (r *Room) handlePeerInterrupted(p *peer.Peer) {
+	if !r.isCurrentPeer(p) {
+		return
+	}
+	r.logger.Info("Peer connection interrupted, holding tracks",
+		zap.String("roomID", r.ID),
+		zap.String("peerID", p.ID),
+	)
+	r.countCallError(CallErrorConnectionInterrupted)
+	r.setPeerTracksPaused(p, true)
+	r.setRenegotiationInterrupted(p, true)
+}
+
+func (r *Room) handlePeerRestored(p *peer.Peer) {
+	if !r.isCurrentPeer(p) {
+		return
+	}
+	r.logger.Info("Peer connection restored within grace",
+		zap.String("roomID", r.ID),
+		zap.String("peerID", p.ID),
+	)
+	r.mu.Lock()
+	r.wakeLocked("connection_restored")
+	r.mu.Unlock()
+	r.setPeerTracksPaused(p, false)
+	r.setRenegotiationInterrupted(p, false)
+}
+
+// SetPeerDetached holds p's renegotiations while its signaling connection is
+// gone and the SFU keeps the peer for a reconnect. Media is unaffected.
+// Clearing it sends anything held as one resume.
+func (r *Room) SetPeerDetached(p *peer.Peer, detached bool) {
+	r.setRenegotiationDetached(p, detached)
+}
+
+// setPeerTracksPaused marks every track published by p as paused or resumed
+// and reports the change. Resumed tracks get a keyframe request so
+// subscribers recover from the frozen frame quickly.
+func (r *Room) setPeerTracksPaused(p *peer.Peer, paused bool) {
+	r.mu.RLock()
+	var tracks []*MediaTrack
+	for _, mt := range r.MediaTracks {
+		if mt.PeerID == p.ID {
+			tracks = append(tracks, mt)
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, mt := range tracks {
+		if mt.paused.Swap(paused) == paused {
+			continue
+		}
+		if !paused {
+			mt.needsPLI.Store(true)
+		}
+		if r.OnTrackPaused != nil && !r.silenced() {
+			r.OnTrackPaused(r, p, mt, paused)
+		}
+	}
+}
+
+// IsPaused reports whether the track's publisher is currently disconnected.
+func (mt *MediaTrack) IsPaused() bool {
+	return mt.paused.Load()
+}
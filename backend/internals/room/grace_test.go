@@ -0,0 +1,159 @@
+package room
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/logging"
+	"github.com/pion/transport/v2/vnet"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// link is a virtual network between a server and a client API whose packets
+// can be cut off and let through again.
+type link struct {
+	server, client *webrtc.API
+	cut            atomic.Bool
+}
+
+func newLink(t *testing.T) *link {
+	t.Helper()
+	router, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          "10.0.0.0/24",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &link{}
+	router.AddChunkFilter(func(vnet.Chunk) bool { return !l.cut.Load() })
+
+	api := func(ip string) *webrtc.API {
+		n, err := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{ip}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := router.AddNet(n); err != nil {
+			t.Fatal(err)
+		}
+		var se webrtc.SettingEngine
+		se.SetVNet(n)
+		// Disconnected quickly, and failed only well after the grace
+		se.SetICETimeouts(300*time.Millisecond, 30*time.Second, 100*time.Millisecond)
+		return webrtc.NewAPI(webrtc.WithSettingEngine(se))
+	}
+	l.server, l.client = api("10.0.0.1"), api("10.0.0.2")
+	if err := router.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { router.Stop() })
+	return l
+}
+
+// graceTest is a publisher whose connection runs over a link, with the
+// room's pause notifications and its removal recorded.
+type graceTest struct {
+	r       *Room
+	p       *peer.Peer
+	link    *link
+	track   *MediaTrack
+	removed chan struct{}
+
+	mu     sync.Mutex
+	paused []bool
+}
+
+func newGraceTest(t *testing.T, grace time.Duration) *graceTest {
+	gt := &graceTest{
+		r:       NewRoom("room-1", 10, zap.NewNop()),
+		link:    newLink(t),
+		removed: make(chan struct{}),
+	}
+	t.Cleanup(func() { gt.r.Close() })
+	gt.r.SetDisconnectGrace(grace, false)
+	gt.r.OnTrackPaused = func(_ *Room, _ *peer.Peer, _ *MediaTrack, paused bool) {
+		gt.mu.Lock()
+		gt.paused = append(gt.paused, paused)
+		gt.mu.Unlock()
+	}
+	gt.r.OnPeerLeft = func(*Room, *peer.Peer) { close(gt.removed) }
+
+	gt.p = peer.NewPeer(gt.r.ID, "alice", "", zap.NewNop())
+	if err := gt.r.AddPeer(gt.p); err != nil {
+		t.Fatal(err)
+	}
+	gt.track = addTrack(gt.r, "alice-vp8", gt.p.ID, "video")
+
+	connectData(t, gt.p, gt.link)
+	gt.waitConnected(t, true)
+	return gt
+}
+
+func (gt *graceTest) waitConnected(t *testing.T, connected bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for gt.p.IsConnected() != connected {
+		if time.Now().After(deadline) {
+			t.Fatalf("peer connected is not %v", connected)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (gt *graceTest) pauses() []bool {
+	gt.mu.Lock()
+	defer gt.mu.Unlock()
+	return append([]bool(nil), gt.paused...)
+}
+
+func TestDisconnectRecoveredWithinGrace(t *testing.T) {
+	gt := newGraceTest(t, 3*time.Second)
+
+	gt.link.cut.Store(true)
+	gt.waitConnected(t, false)
+	if !gt.track.IsPaused() {
+		t.Fatal("track not paused while its publisher is disconnected")
+	}
+
+	// The connection comes back on its own before the grace runs out
+	gt.link.cut.Store(false)
+	gt.waitConnected(t, true)
+	select {
+	case <-gt.removed:
+		t.Fatal("peer removed although it recovered within the grace")
+	case <-time.After(3500 * time.Millisecond):
+	}
+	if gt.track.IsPaused() || !gt.track.needsPLI.Load() {
+		t.Fatal("track not resumed with a keyframe request")
+	}
+	if got := gt.pauses(); len(got) != 2 || !got[0] || got[1] {
+		t.Fatalf("pause notifications %v, want paused then resumed", got)
+	}
+	if _, ok := gt.r.GetPeer(gt.p.ID); !ok || gt.r.GetTrackCount() != 1 {
+		t.Fatal("the peer or its track is gone")
+	}
+}
+
+func TestDisconnectOutlastingGrace(t *testing.T) {
+	const grace = 500 * time.Millisecond
+	gt := newGraceTest(t, grace)
+
+	cut := time.Now()
+	gt.link.cut.Store(true)
+	gt.waitConnected(t, false)
+	select {
+	case <-gt.removed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("peer not removed after the grace")
+	}
+	if held := time.Since(cut); held < grace {
+		t.Fatalf("peer removed after %v, before the %v grace", held, grace)
+	}
+	if gt.r.GetTrackCount() != 0 {
+		t.Fatal("the track outlived its publisher")
+	}
+}
@@ -0,0 +1,178 @@
+package room
+
+import (
+	"sort"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+// A room has at most one host, a user ID, that moderation can be anchored
+// to when roles are not handed out. The host is named when the room is
+// created through the API or restored from its snapshot, granted by the
+// authorizer, or else is the first participant to join. When the host's
+// peer leaves, the participant present the longest takes over. Observers
+// and broadcast viewers are never picked. A user whose peer is evicted
+// because it is rejoining keeps the host role and its place in line.
+// Changes are reported to OnHostChanged with the room locked, like
+// OnPeerJoined, so they are announced in order with joins and leaves.
+
+// Why the host changed, as passed to OnHostChanged
+const (
+	HostChangeFirstJoin = "first-join" // the first participant became host
+	HostChangeHostLeft  = "host-left"  // the host left; the longest present took over
+	HostChangeTransfer  = "transfer"   // the host or an admin named a new host
+	HostChangeGranted   = "granted"    // the authorizer made a joining user host
+)
+
+// HostChange describes a change of host. PeerID is the new host's peer,
+// empty if the host is not in the room; UserID is empty if the room was
+// left without a host.
+type HostChange struct {
+	UserID   string
+	PeerID   string
+	Previous string
+	Reason   string
+}
+
+// hostState is the room's host and the order participants arrived in.
+// Guarded by r.mu.
+type hostState struct {
+	userID  string
+	present map[string]time.Time // participant userID -> present since
+}
+
+// canHost reports whether p may be host.
+func canHost(p *peer.Peer) bool {
+	return !p.Observer && !p.Viewer
+}
+
+// Host returns the user ID of the room's host, or "" if it has none.
+func (r *Room) Host() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.host.userID
+}
+
+// IsHost reports whether userID is the room's host.
+func (r *Room) IsHost(userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return userID != "" && r.host.userID == userID
+}
+
+// HostPeerID returns the peer of the room's host, or "" if the host is not
+// in the room.
+func (r *Room) HostPeerID() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.hostPeerIDLocked()
+}
+
+// RestoreHost names the host of a room that is not registered yet, without
+// announcing it.
+func (r *Room) RestoreHost(userID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.host.userID = userID
+}
+
+// SetHost makes userID the host for reason and announces the change. The
+// user does not have to be in the room, but if it is it must be a
+// participant. It reports whether the host changed.
+func (r *Room) SetHost(userID, reason string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.Peers[r.peersByUser[userID]]; ok && !canHost(p) {
+		return false, ErrCannotHost
+	}
+	change, changed := r.setHostLocked(userID, reason)
+	if changed && r.OnHostChanged != nil && !r.silenced() {
+		r.OnHostChanged(r, change)
+	}
+	return changed, nil
+}
+
+// setHostLocked moves the host role to userID.
+// MUST be called with r.mu held (write lock).
+func (r *Room) setHostLocked(userID, reason string) (HostChange, bool) {
+	if r.host.userID == userID {
+		return HostChange{}, false
+	}
+	change := HostChange{UserID: userID, Previous: r.host.userID, Reason: reason}
+	r.host.userID = userID
+	change.PeerID = r.hostPeerIDLocked()
+	r.recordEvent(RoomEvent{Type: EventHostChanged, PeerID: change.PeerID, UserID: userID, Detail: reason})
+
+	r.logger.Info("Room host changed",
+		zap.String("roomID", r.ID),
+		zap.String("host", userID),
+		zap.String("previous", change.Previous),
+		zap.String("reason", reason),
+	)
+	return change, true
+}
+
+// hostPeerIDLocked returns the host's peer ID, if it is in the room.
+// MUST be called with r.mu held.
+func (r *Room) hostPeerIDLocked() string {
+	if r.host.userID == "" {
+		return ""
+	}
+	if id := r.peersByUser[r.host.userID]; r.Peers[id] != nil {
+		return id
+	}
+	return ""
+}
+
+// hostJoinedLocked records p as present and makes it host if the room has
+// none. MUST be called with r.mu held (write lock).
+func (r *Room) hostJoinedLocked(p *peer.Peer, now time.Time) (HostChange, bool) {
+	if !canHost(p) {
+		return HostChange{}, false
+	}
+	if r.host.present == nil {
+		r.host.present = make(map[string]time.Time)
+	}
+	if _, ok := r.host.present[p.UserID]; !ok {
+		r.host.present[p.UserID] = now
+	}
+	if r.host.userID == "" {
+		return r.setHostLocked(p.UserID, HostChangeFirstJoin)
+	}
+	return HostChange{}, false
+}
+
+// hostLeftLocked forgets p's presence and, if p's user was host, hands the
+// role to the participant present the longest. Ties go to the lowest user
+// ID. With rejoining set the user keeps both for its next peer.
+// MUST be called with r.mu held (write lock).
+func (r *Room) hostLeftLocked(p *peer.Peer, rejoining bool) (HostChange, bool) {
+	if rejoining {
+		return HostChange{}, false
+	}
+	delete(r.host.present, p.UserID)
+	if r.host.userID != p.UserID {
+		return HostChange{}, false
+	}
+
+	candidates := make([]string, 0, len(r.host.present))
+	for userID := range r.host.present {
+		if _, ok := r.Peers[r.peersByUser[userID]]; ok {
+			candidates = append(candidates, userID)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := r.host.present[candidates[i]], r.host.present[candidates[j]]
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return candidates[i] < candidates[j]
+	})
+	next := ""
+	if len(candidates) > 0 {
+		next = candidates[0]
+	}
+	return r.setHostLocked(next, HostChangeHostLeft)
+}
@@ -0,0 +1,150 @@
+package room
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+// hostChanges records a room's host changes as "user (reason)".
+type hostChanges struct {
+	mu      sync.Mutex
+	changes []string
+}
+
+func (h *hostChanges) watch(r *Room) {
+	r.OnHostChanged = func(_ *Room, change HostChange) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.changes = append(h.changes, change.UserID+" ("+change.Reason+")")
+	}
+}
+
+// take returns the changes recorded since the last call.
+func (h *hostChanges) take() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	changes := h.changes
+	h.changes = nil
+	return changes
+}
+
+func joinAs(t *testing.T, r *Room, userID string, configure func(*peer.Peer)) *peer.Peer {
+	t.Helper()
+	p := peer.NewPeer(r.ID, userID, "", zap.NewNop())
+	if configure != nil {
+		configure(p)
+	}
+	if err := r.AddPeer(p); err != nil {
+		t.Fatal(err)
+	}
+	// Arrivals in the same instant would be ordered by user ID instead
+	time.Sleep(time.Millisecond)
+	return p
+}
+
+func expectHost(t *testing.T, r *Room, h *hostChanges, host string, changes ...string) {
+	t.Helper()
+	got := h.take()
+	if r.Host() != host || len(got) != len(changes) {
+		t.Fatalf("host %q after %v, want %q after %v", r.Host(), got, host, changes)
+	}
+	for i := range changes {
+		if got[i] != changes[i] {
+			t.Fatalf("host changes %v, want %v", got, changes)
+		}
+	}
+}
+
+func TestHostHandoverOrder(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	var h hostChanges
+	h.watch(r)
+
+	// Observers and viewers are never host; the first participant is
+	joinAs(t, r, "observer", func(p *peer.Peer) { p.Observer = true })
+	joinAs(t, r, "viewer", func(p *peer.Peer) { p.Viewer = true })
+	expectHost(t, r, &h, "")
+	alice := joinAs(t, r, "alice", nil)
+	expectHost(t, r, &h, "alice", "alice (first-join)")
+	if r.HostPeerID() != alice.ID || !r.IsHost("alice") || r.IsHost("") {
+		t.Fatalf("host peer %q", r.HostPeerID())
+	}
+	bob := joinAs(t, r, "bob", nil)
+	carol := joinAs(t, r, "carol", nil)
+	joinAs(t, r, "dave", nil)
+
+	// Bob rejoining keeps his place ahead of carol
+	if err := r.EvictPeer(bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	bob = joinAs(t, r, "bob", nil)
+	expectHost(t, r, &h, "alice")
+
+	// The host leaving hands over to the participant present the longest
+	if err := r.RemovePeer(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectHost(t, r, &h, "bob", "bob (host-left)")
+	if r.HostPeerID() != bob.ID {
+		t.Fatalf("host peer %q, want bob's", r.HostPeerID())
+	}
+
+	// Alice comes back at the end of the line; a participant other than
+	// the host leaving changes nothing
+	joinAs(t, r, "alice", nil)
+	if err := r.RemovePeer(carol.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectHost(t, r, &h, "bob")
+	if err := r.RemovePeer(bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectHost(t, r, &h, "dave", "dave (host-left)")
+
+	// Transfers are checked and announced; the last participant leaving
+	// leaves the room without a host
+	observer, _ := r.GetPeerByUserID("observer")
+	if _, err := r.SetHost(observer.UserID, HostChangeTransfer); !errors.Is(err, ErrCannotHost) {
+		t.Fatalf("observer made host: %v", err)
+	}
+	if changed, err := r.SetHost("alice", HostChangeTransfer); !changed || err != nil {
+		t.Fatalf("transfer to alice: %v, %v", changed, err)
+	}
+	if changed, _ := r.SetHost("alice", HostChangeTransfer); changed {
+		t.Fatal("transfer to the host changed it")
+	}
+	expectHost(t, r, &h, "alice", "alice (transfer)")
+	dave, _ := r.GetPeerByUserID("dave")
+	aliceAgain, _ := r.GetPeerByUserID("alice")
+	for _, p := range []*peer.Peer{dave, aliceAgain} {
+		if err := r.RemovePeer(p.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectHost(t, r, &h, "", " (host-left)")
+}
+
+// A host named before anyone joins is kept, even while it is away.
+func TestRestoredHost(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	var h hostChanges
+	h.watch(r)
+	r.RestoreHost("host")
+	joinAs(t, r, "alice", nil)
+	expectHost(t, r, &h, "host")
+	if r.HostPeerID() != "" {
+		t.Fatalf("absent host has peer %q", r.HostPeerID())
+	}
+	host := joinAs(t, r, "host", nil)
+	if r.HostPeerID() != host.ID {
+		t.Fatalf("host peer %q", r.HostPeerID())
+	}
+	expectHost(t, r, &h, "host")
+}
@@ -0,0 +1,118 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+)
+
+// ErrKeyframeRateLimited is returned when a keyframe was already requested
+// for the track within the room's keyframe request interval.
+var ErrKeyframeRateLimited = errors.New("keyframe requested too recently")
+
+// SetKeyframeRequestInterval sets the minimum spacing between client-initiated
+// keyframe requests for the same track.
+func (r *Room) SetKeyframeRequestInterval(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keyframeInterval = d
+}
+
+// RequestKeyframe asks the publisher of the referenced track for a keyframe,
+// using FIR instead of PLI when fir is set.
+func (r *Room) RequestKeyframe(ref string, fir bool) error {
+	mt, ok := r.ResolveTrack(ref)
+	if !ok {
+		return fmt.Errorf("track not found: %s", ref)
+	}
+	if mt.Kind != webrtc.RTPCodecTypeVideo.String() {
+		return fmt.Errorf("track is not video")
+	}
+
+	r.mu.RLock()
+	interval := r.keyframeInterval
+	r.mu.RUnlock()
+
+	if !mt.allowKeyframeRequest(time.Now(), interval) {
+		return ErrKeyframeRateLimited
+	}
+
+	r.sendKeyframeRequest(mt, fir)
+	return nil
+}
+
+// allowKeyframeRequest reports whether a client keyframe request may be sent
+// at now, recording it if so.
+func (mt *MediaTrack) allowKeyframeRequest(now time.Time, interval time.Duration) bool {
+	for {
+		last := mt.lastKeyframeRequest.Load()
+		if last != 0 && now.Sub(time.Unix(0, last)) < interval {
+			return false
+		}
+		if mt.lastKeyframeRequest.CompareAndSwap(last, now.UnixNano()) {
+			return true
+		}
+	}
+}
+
+// sendKeyframeRequest sends a PLI (or FIR) to the track's publisher for every
+// simulcast layer, or for the track itself.
+func (r *Room) sendKeyframeRequest(mt *MediaTrack, fir bool) {
+	r.mu.RLock()
+	sourcePeer, exists := r.Peers[mt.PeerID]
+	r.mu.RUnlock()
+	if !exists || sourcePeer == nil {
+		return
+	}
+
+	send := func(ssrc uint32) {
+		if fir {
+			sourcePeer.SendFIR(ssrc)
+			appmetrics.RecordFIR("sent")
+		} else {
+			sourcePeer.SendPLI(ssrc)
+			appmetrics.RecordPLI()
+		}
+	}
+
+	if mt.IsSimulcast {
+		mt.mu.RLock()
+		for _, layer := range mt.Layers {
+			send(uint32(layer.Track.SSRC()))
+		}
+		mt.mu.RUnlock()
+	} else {
+		send(uint32(mt.source().track.SSRC()))
+	}
+}
+
+// readSubscriberRTCP consumes RTCP from a subscriber's sender, which must be
+// drained so pion's buffer doesn't stall, and turns PLI and FIR into a
+// keyframe request toward the publisher. Receiver reports count as activity
+// of the subscriber.
+func readSubscriberRTCP(mt *MediaTrack, sender *webrtc.RTPSender, subscriber *peer.Peer) {
+	for {
+		pkts, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, pkt := range pkts {
+			switch pkt.(type) {
+			case *rtcp.PictureLossIndication:
+				mt.needsPLI.Store(true)
+			case *rtcp.FullIntraRequest:
+				appmetrics.RecordFIR("received")
+				mt.needsPLI.Store(true)
+			case *rtcp.ReceiverReport:
+				if subscriber != nil {
+					subscriber.TouchReceiverReport()
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package room
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestAllowKeyframeRequest(t *testing.T) {
+	const interval = time.Second
+	mt := &MediaTrack{}
+	start := time.Unix(1000, 0)
+
+	for _, tc := range []struct {
+		after time.Duration
+		want  bool
+	}{
+		{0, true},
+		{interval / 2, false},
+		{interval - time.Nanosecond, false},
+		{interval, true},
+		{interval + interval/2, false},
+		{3 * interval, true},
+	} {
+		if got := mt.allowKeyframeRequest(start.Add(tc.after), interval); got != tc.want {
+			t.Errorf("request at +%v allowed = %v, want %v", tc.after, got, tc.want)
+		}
+	}
+}
+
+func TestAllowKeyframeRequestConcurrent(t *testing.T) {
+	mt := &MediaTrack{}
+	now := time.Now()
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int32
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if mt.allowKeyframeRequest(now, time.Second) {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := allowed.Load(); n != 1 {
+		t.Fatalf("%d of 50 simultaneous requests allowed, want 1", n)
+	}
+}
+
+func TestRequestKeyframe(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	r.SetKeyframeRequestInterval(50 * time.Millisecond)
+	r.mu.Lock()
+	r.MediaTracks["video-1"] = &MediaTrack{ID: "video-1", Kind: "video", PeerID: "gone"}
+	r.MediaTracks["audio-1"] = &MediaTrack{ID: "audio-1", Kind: "audio", PeerID: "gone"}
+	r.trackHandles["v"] = "video-1"
+	r.trackHandles["a"] = "audio-1"
+	r.mu.Unlock()
+
+	if err := r.RequestKeyframe("v", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RequestKeyframe("v", true); !errors.Is(err, ErrKeyframeRateLimited) {
+		t.Fatalf("second request: err = %v, want %v", err, ErrKeyframeRateLimited)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := r.RequestKeyframe("v", true); err != nil {
+		t.Fatalf("request after the interval: %v", err)
+	}
+
+	if err := r.RequestKeyframe("a", false); err == nil {
+		t.Fatal("keyframe requested for an audio track")
+	}
+	if err := r.RequestKeyframe("missing", false); err == nil {
+		t.Fatal("keyframe requested for an unknown track")
+	}
+}
@@ -0,0 +1,195 @@
+package room
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+)
+
+// One packet in every latencySampleEvery a track reads is timed: its read is
+// stamped, and each subscriber's write of it observes the forwarding delay
+// since. When the publisher sends abs-send-time, the sampled packet's delay
+// from the publisher is observed too. Its clock is not the SFU's, so that
+// delay is measured above a baseline: the lowest offset between the two
+// clocks seen so far, allowed to creep up for clock drift. The read loop
+// keeps its sampler, and a packet not sampled costs a counter increment.
+
+const (
+	// absSendTimeMask keeps abs-send-time's 24 bits: seconds in 6.18 fixed
+	// point, wrapping every 64s.
+	absSendTimeMask = 1<<24 - 1
+	// clockDriftPerSample is how far the baseline may rise per sample, about
+	// 1ms, so it follows a publisher clock running slow.
+	clockDriftPerSample = 1 << 18 / 1000
+	// delaySamplesKept is how many recent forwarding delays per kind the
+	// quantiles are taken over.
+	delaySamplesKept = 1024
+)
+
+// SetLatencySampling times one packet in every of each track's packets; 0
+// turns it off. Tracks already forwarding keep their sampling. The forwarding
+// delays are kept in delays, which rooms may share, as well as observed in
+// the metrics; nil keeps them only in the metrics.
+func (r *Room) SetLatencySampling(every int, delays *DelaySamples) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencySampleEvery = every
+	r.forwardingDelays.Store(delays)
+}
+
+// latencySampler picks and times the packets of one read loop.
+type latencySampler struct {
+	every int
+	n     int
+	kind  string
+
+	absSendTimeID uint8 // 0 = not negotiated
+	baseline      uint32
+	haveBaseline  bool
+}
+
+// newLatencySampler returns the sampler of a read loop of mt.
+func (r *Room) newLatencySampler(mt *MediaTrack) *latencySampler {
+	r.mu.RLock()
+	every := r.latencySampleEvery
+	r.mu.RUnlock()
+	s := &latencySampler{every: every, kind: mt.path.name}
+	if every > 0 && mt.Receiver != nil {
+		for _, ext := range mt.Receiver.GetParameters().HeaderExtensions {
+			if ext.URI == sdp.ABSSendTimeURI {
+				s.absSendTimeID = uint8(ext.ID)
+			}
+		}
+	}
+	return s
+}
+
+// sample returns the read time, in unix nanoseconds, of a packet picked for
+// timing, or 0.
+func (s *latencySampler) sample(pkt *rtp.Packet) int64 {
+	if s.every <= 0 {
+		return 0
+	}
+	if s.n++; s.n < s.every {
+		return 0
+	}
+	s.n = 0
+	now := time.Now()
+	if s.absSendTimeID != 0 {
+		if ext := pkt.GetExtension(s.absSendTimeID); len(ext) == 3 {
+			sent := uint32(ext[0])<<16 | uint32(ext[1])<<8 | uint32(ext[2])
+			appmetrics.RecordInboundDelay(s.kind, s.inboundDelay(now, sent))
+		}
+	}
+	return now.UnixNano()
+}
+
+// inboundDelay returns the delay of a packet sent at the publisher's
+// abs-send-time sent and read at now, above the clocks' baseline offset.
+func (s *latencySampler) inboundDelay(now time.Time, sent uint32) time.Duration {
+	offset := (absSendTime(now) - sent) & absSendTimeMask
+	// Sign-extend the 24-bit difference from the baseline
+	above := int32((offset-s.baseline)&absSendTimeMask<<8) >> 8
+	switch {
+	case !s.haveBaseline || above < 0:
+		s.baseline, s.haveBaseline, above = offset, true, 0
+	case above < clockDriftPerSample:
+		s.baseline = offset
+	default:
+		s.baseline = (s.baseline + clockDriftPerSample) & absSendTimeMask
+	}
+	return time.Duration(int64(above) * int64(time.Second) >> 18)
+}
+
+// absSendTime returns t as an abs-send-time. The seconds and the fraction
+// are shifted apart, as the nanoseconds since the epoch shifted by 18 do not
+// fit in 64 bits.
+func absSendTime(t time.Time) uint32 {
+	frac := uint32(uint64(t.Nanosecond()) << 18 / uint64(time.Second))
+	return (uint32(t.Unix())<<18 | frac) & absSendTimeMask
+}
+
+// observeForwarding records the delay from a sampled packet's read at readAt
+// to its write to the subscriber.
+func (sub *SubscriberState) observeForwarding(readAt int64) {
+	d := time.Duration(time.Now().UnixNano() - readAt)
+	appmetrics.RecordForwardingDelay(sub.kind, d)
+	if sub.delays != nil {
+		sub.delays.add(sub.kind, d)
+	}
+}
+
+// DelayQuantiles summarizes recent forwarding delays of one kind.
+type DelayQuantiles struct {
+	P50Ms   float64 `json:"p50Ms"`
+	P99Ms   float64 `json:"p99Ms"`
+	Samples int     `json:"samples"`
+}
+
+// DelaySamples keeps the latest forwarding delays of each kind, of the rooms
+// given it by SetLatencySampling.
+type DelaySamples struct {
+	mu    sync.Mutex
+	kinds map[string]*delayRing
+}
+
+type delayRing struct {
+	samples []time.Duration
+	next    int
+}
+
+// NewDelaySamples returns an empty DelaySamples.
+func NewDelaySamples() *DelaySamples {
+	return &DelaySamples{kinds: make(map[string]*delayRing)}
+}
+
+func (d *DelaySamples) add(kind string, delay time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ring := d.kinds[kind]
+	if ring == nil {
+		ring = &delayRing{samples: make([]time.Duration, 0, delaySamplesKept)}
+		d.kinds[kind] = ring
+	}
+	if len(ring.samples) < delaySamplesKept {
+		ring.samples = append(ring.samples, delay)
+		return
+	}
+	ring.samples[ring.next] = delay
+	ring.next = (ring.next + 1) % delaySamplesKept
+}
+
+// Quantiles returns the median and 99th percentile of the recent sampled
+// forwarding delays by kind, audio or video.
+func (d *DelaySamples) Quantiles() map[string]DelayQuantiles {
+	d.mu.Lock()
+	sorted := make(map[string][]time.Duration, len(d.kinds))
+	for kind, ring := range d.kinds {
+		sorted[kind] = slices.Clone(ring.samples)
+	}
+	d.mu.Unlock()
+
+	out := make(map[string]DelayQuantiles, len(sorted))
+	for kind, samples := range sorted {
+		slices.Sort(samples)
+		out[kind] = DelayQuantiles{
+			P50Ms:   quantileMs(samples, 0.50),
+			P99Ms:   quantileMs(samples, 0.99),
+			Samples: len(samples),
+		}
+	}
+	return out
+}
+
+// quantileMs returns the q quantile of sorted samples in milliseconds.
+func quantileMs(sorted []time.Duration, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(q * float64(len(sorted)-1))
+	return float64(sorted[i]) / float64(time.Millisecond)
+}
@@ -0,0 +1,149 @@
+package room
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// nearly reports whether got is want, to abs-send-time's resolution.
+func nearly(got, want time.Duration) bool {
+	d := got - want
+	return d > -50*time.Microsecond && d < 50*time.Microsecond
+}
+
+// inbound has s observe a packet read at at that spent transit on its way.
+func inbound(s *latencySampler, at time.Time, transit time.Duration) time.Duration {
+	return s.inboundDelay(at, absSendTime(at.Add(-transit)))
+}
+
+func TestAbsSendTime(t *testing.T) {
+	for _, tc := range []struct {
+		at   time.Time
+		want uint32
+	}{
+		{time.Unix(0, 0), 0},
+		{time.Unix(0, 500*int64(time.Millisecond)), 1 << 17},
+		{time.Unix(63, 0), 63 << 18},
+		{time.Unix(64, 0), 0},
+		// Today's times in nanoseconds overflow once shifted by 18
+		{time.Unix(1_800_000_001, 250*int64(time.Millisecond)), 1<<18 | 1<<16},
+	} {
+		if got := absSendTime(tc.at); got != tc.want {
+			t.Errorf("%v: %#x, want %#x", tc.at, got, tc.want)
+		}
+	}
+}
+
+func TestInboundDelayBaseline(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	s := &latencySampler{kind: "video"}
+	for i, step := range []struct {
+		at, transit, want time.Duration
+	}{
+		// The first packet sets the baseline, whatever its transit
+		{0, 30 * time.Millisecond, 0},
+		{20 * time.Millisecond, 30 * time.Millisecond, 0},
+		// A slower one is measured above it
+		{40 * time.Millisecond, 50 * time.Millisecond, 20 * time.Millisecond},
+		// A faster one lowers it
+		{60 * time.Millisecond, 10 * time.Millisecond, 0},
+		{80 * time.Millisecond, 30 * time.Millisecond, 20 * time.Millisecond},
+	} {
+		if got := inbound(s, now.Add(step.at), step.transit); !nearly(got, step.want) {
+			t.Fatalf("packet %d: delay %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+// A publisher clock running slow looks like a transit that keeps growing:
+// the baseline follows it about 1ms a sample, so the delay wears off.
+func TestInboundDelayClockDrift(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	s := &latencySampler{kind: "video"}
+	inbound(s, now, 0)
+	var delays []time.Duration
+	for i := 1; i <= 20; i++ {
+		d := inbound(s, now.Add(time.Duration(i)*20*time.Millisecond), 10*time.Millisecond)
+		delays = append(delays, d)
+		if d == 0 {
+			break
+		}
+	}
+	if !nearly(delays[0], 10*time.Millisecond) {
+		t.Fatalf("first delay %v, want 10ms", delays[0])
+	}
+	for i := 1; i < len(delays); i++ {
+		step := delays[i-1] - delays[i]
+		if delays[i] != 0 && !nearly(step, time.Millisecond) {
+			t.Fatalf("delays %v do not wear off by 1ms a sample", delays)
+		}
+	}
+	if last := delays[len(delays)-1]; last != 0 || len(delays) < 11 {
+		t.Fatalf("delays %v, want them to wear off to 0 in 11 or more samples", delays)
+	}
+}
+
+// abs-send-time wraps every 64s, and its 24-bit offsets wrap too.
+func TestInboundDelayWraps(t *testing.T) {
+	// 10ms before the wrap; 1_800_000_000 is a multiple of 64
+	beforeWrap := time.Unix(1_800_000_063, 990*int64(time.Millisecond))
+	s := &latencySampler{kind: "video"}
+	for i, step := range []struct {
+		at, transit, want time.Duration
+	}{
+		{0, 30 * time.Millisecond, 0},
+		// Read after the wrap, sent before it
+		{20 * time.Millisecond, 30 * time.Millisecond, 0},
+		// Both after it
+		{60 * time.Millisecond, 45 * time.Millisecond, 15 * time.Millisecond},
+	} {
+		if got := inbound(s, beforeWrap.Add(step.at), step.transit); !nearly(got, step.want) {
+			t.Fatalf("packet %d: delay %v, want %v", i, got, step.want)
+		}
+	}
+
+	// A baseline offset of 0 less a millisecond wraps to the top of the
+	// range, and is taken as lower, not 64s higher
+	now := time.Unix(1_800_000_000, 0)
+	s = &latencySampler{kind: "video"}
+	inbound(s, now, 0)
+	if got := inbound(s, now.Add(20*time.Millisecond), -time.Millisecond); got != 0 {
+		t.Fatalf("delay %v below the baseline", got)
+	}
+	if got := inbound(s, now.Add(40*time.Millisecond), 0); !nearly(got, time.Millisecond) {
+		t.Fatalf("delay %v above the lowered baseline, want 1ms", got)
+	}
+}
+
+// BenchmarkLatencySampling times fan-out with sampling off, at the default
+// of one packet in 100, and on every packet, to show what timing costs the
+// fan-out.
+func BenchmarkLatencySampling(b *testing.B) {
+	for _, path := range []*forwardPath{audioPath, videoPath} {
+		for _, every := range []int{0, 100, 1} {
+			b.Run(fmt.Sprintf("%s/every=%d", path.name, every), func(b *testing.B) {
+				const subscribers = 50
+				pt := newPathTest(b, path, subscribers, b.N)
+				delays := NewDelaySamples()
+				for _, sub := range pt.mt.getSnapshot() {
+					sub.delays = delays
+				}
+				sampler := &latencySampler{every: every, kind: path.name}
+				pkt := &rtp.Packet{Header: rtp.Header{Version: 2, SSRC: 1234}, Payload: make([]byte, 160)}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					pkt.SequenceNumber = uint16(i)
+					pt.r.fanOut(pt.mt, fanOutItem{packet: pkt, readAt: sampler.sample(pkt)})
+					for pt.delivered.Load() < int64((i+1)*subscribers) {
+						runtime.Gosched()
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package room
+
+import (
+	"slices"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"go.uber.org/zap"
+)
+
+// Publishers send every simulcast layer even when no subscriber is on it.
+// Each stats tick the room works out which layers of each simulcast track
+// are in use; a layer nobody has been on for layerIdleWindow is reported to
+// the publisher as not needed, so it can pause that encoding. The lowest
+// layer is always needed so new subscribers have something to start on.
+//
+// A subscriber that asks for a paused layer is held on the best layer still
+// running, the publisher is told to resume it, and the subscriber is moved
+// once the layer's packets arrive again.
+
+// layerUse is a simulcast track's layer bookkeeping. Guarded by the track's
+// mu.
+type layerUse struct {
+	lastUsed map[string]time.Time // RID -> last time a subscriber was on it
+	off      map[string]bool      // layers the publisher was told to pause
+	resuming map[string]time.Time // paused layers asked back, and when
+	held     map[string]string    // subscriber peer ID -> layer it waits for
+	sent     []string             // needed RIDs last reported to the publisher
+}
+
+func (u *layerUse) init() {
+	if u.lastUsed == nil {
+		u.lastUsed = make(map[string]time.Time)
+		u.off = make(map[string]bool)
+		u.resuming = make(map[string]time.Time)
+		u.held = make(map[string]string)
+	}
+}
+
+// SetLayerIdleWindow sets how long a simulcast layer must go unused before
+// its publisher is told it may pause it. 0 disables layer reporting.
+func (r *Room) SetLayerIdleWindow(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.layerIdleWindow = d
+}
+
+// sortedLayersLocked returns mt's RIDs from lowest to highest quality.
+// MUST be called with mt.mu held.
+func (mt *MediaTrack) sortedLayersLocked() []string {
+	rids := make([]string, 0, len(mt.Layers))
+	for rid := range mt.Layers {
+		rids = append(rids, rid)
+	}
+	sortLayers(rids)
+	return rids
+}
+
+// wantedLayerLocked is the layer a subscriber asked for, which differs from
+// CurrentRID while it is held for a resuming layer. MUST be called with
+// mt.mu held.
+func (mt *MediaTrack) wantedLayerLocked(sub *SubscriberState) string {
+	if rid, ok := mt.layerUse.held[sub.PeerID]; ok {
+		return rid
+	}
+	return sub.CurrentRID
+}
+
+// routeToLayerLocked puts sub on rid, or, if rid is paused or not yet
+// flowing again, on the best running layer below it until it is. It returns
+// whether the publisher must be told about a resumed layer. MUST be called
+// with mt.mu held.
+func (r *Room) routeToLayerLocked(mt *MediaTrack, sub *SubscriberState, rid string) bool {
+	u := &mt.layerUse
+	delete(u.held, sub.PeerID)
+	if !u.off[rid] && u.resuming[rid].IsZero() {
+		sub.CurrentRID = rid
+		return false
+	}
+
+	rids := mt.sortedLayersLocked()
+	if len(rids) == 0 {
+		sub.CurrentRID = rid
+		return false
+	}
+	fallback := rids[0]
+	for _, candidate := range rids {
+		if candidate == rid {
+			break
+		}
+		if !u.off[candidate] && u.resuming[candidate].IsZero() {
+			fallback = candidate
+		}
+	}
+	sub.CurrentRID = fallback
+	u.held[sub.PeerID] = rid
+	u.lastUsed[rid] = time.Now()
+
+	if !u.off[rid] {
+		return false
+	}
+	delete(u.off, rid)
+	u.resuming[rid] = time.Now()
+	if layer, ok := mt.Layers[rid]; ok {
+		layer.resuming.Store(true)
+	}
+	return true
+}
+
+// neededLayersLocked recomputes which of mt's layers are needed at now and
+// marks the rest off. It returns the needed and paused RIDs and whether they
+// differ from what the publisher was last told. MUST be called with mt.mu
+// held.
+func (r *Room) neededLayersLocked(mt *MediaTrack, now time.Time, window time.Duration) ([]string, []string, bool) {
+	u := &mt.layerUse
+	for peerID, rid := range u.held {
+		if _, ok := mt.Subscribers[peerID]; !ok {
+			delete(u.held, peerID)
+			continue
+		}
+		u.lastUsed[rid] = now
+	}
+	for _, sub := range mt.Subscribers {
+		u.lastUsed[sub.CurrentRID] = now
+	}
+
+	rids := mt.sortedLayersLocked()
+	needed := make([]string, 0, len(rids))
+	paused := make([]string, 0)
+	for i, rid := range rids {
+		last, seen := u.lastUsed[rid]
+		if !seen {
+			// Give a new layer a full window before suggesting it off
+			u.lastUsed[rid], last = now, now
+		}
+		if i == 0 || !u.resuming[rid].IsZero() || now.Sub(last) < window {
+			needed = append(needed, rid)
+			continue
+		}
+		if !u.off[rid] {
+			u.off[rid] = true
+			appmetrics.RecordLayerSuggestedOff(rid)
+		}
+		paused = append(paused, rid)
+	}
+
+	// Publishers start with every layer on, so there is nothing to say
+	// until a layer is first suggested off
+	changed := !slices.Equal(needed, u.sent) && (u.sent != nil || len(paused) > 0)
+	u.sent = needed
+	return needed, paused, changed
+}
+
+// checkLayerUse reports changed layer needs of every simulcast track to its
+// publisher.
+func (r *Room) checkLayerUse(now time.Time) {
+	r.mu.RLock()
+	window := r.layerIdleWindow
+	tracks := make([]*MediaTrack, 0)
+	if window > 0 {
+		for _, mt := range r.MediaTracks {
+			if mt.IsSimulcast {
+				tracks = append(tracks, mt)
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, mt := range tracks {
+		mt.mu.Lock()
+		mt.layerUse.init()
+		needed, paused, changed := r.neededLayersLocked(mt, now, window)
+		mt.mu.Unlock()
+		if changed {
+			r.notifyLayersInUse(mt, needed, paused)
+		}
+	}
+}
+
+// requestLayerResume tells mt's publisher about a paused layer a subscriber
+// now needs, without waiting for the next tick.
+func (r *Room) requestLayerResume(mt *MediaTrack) {
+	r.mu.RLock()
+	window := r.layerIdleWindow
+	r.mu.RUnlock()
+
+	mt.mu.Lock()
+	needed, paused, changed := r.neededLayersLocked(mt, time.Now(), window)
+	mt.mu.Unlock()
+	if changed {
+		r.notifyLayersInUse(mt, needed, paused)
+	}
+}
+
+func (r *Room) notifyLayersInUse(mt *MediaTrack, needed, paused []string) {
+	publisher, ok := r.GetPeer(mt.PeerID)
+	if !ok {
+		return
+	}
+	r.logger.Debug("Simulcast layers in use changed",
+		zap.String("trackID", mt.Handle),
+		zap.Strings("needed", needed),
+		zap.Strings("paused", paused),
+	)
+	if r.OnLayersInUse != nil && !r.silenced() {
+		r.OnLayersInUse(r, publisher, mt, needed, paused)
+	}
+}
+
+// layerResumed is called on the first packet of a layer the publisher was
+// asked to resume. Subscribers held for it are moved onto it.
+func (r *Room) layerResumed(mt *MediaTrack, rid string) {
+	mt.mu.Lock()
+	requested := mt.layerUse.resuming[rid]
+	delete(mt.layerUse.resuming, rid)
+	moved := 0
+	for peerID, want := range mt.layerUse.held {
+		if want != rid {
+			continue
+		}
+		delete(mt.layerUse.held, peerID)
+		if sub, ok := mt.Subscribers[peerID]; ok {
+			sub.CurrentRID = rid
+			moved++
+		}
+	}
+	layer := mt.Layers[rid]
+	mt.mu.Unlock()
+
+	if !requested.IsZero() {
+		appmetrics.ObserveLayerReenable(time.Since(requested))
+	}
+	r.logger.Debug("Simulcast layer resumed",
+		zap.String("trackID", mt.Handle),
+		zap.String("rid", rid),
+		zap.Int("subscribersMoved", moved),
+	)
+
+	if moved > 0 && layer != nil {
+		if publisher, ok := r.GetPeer(mt.PeerID); ok {
+			publisher.SendPLI(uint32(layer.Track.SSRC()))
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package room
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+type layersInUse struct {
+	needed, paused []string
+}
+
+// histogramCount returns the number of observations h has made.
+func histogramCount(t *testing.T, h prometheus.Histogram) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestLayersInUse(t *testing.T) {
+	const window = time.Minute
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	r.SetLayerIdleWindow(window)
+	reports := make(chan layersInUse, 8)
+	r.OnLayersInUse = func(_ *Room, _ *peer.Peer, _ *MediaTrack, needed, paused []string) {
+		reports <- layersInUse{needed, paused}
+	}
+	expect := func(want *layersInUse) {
+		t.Helper()
+		select {
+		case got := <-reports:
+			if want == nil {
+				t.Fatalf("layers-in-use %v, want none", got)
+			}
+			if !reflect.DeepEqual(got, *want) {
+				t.Fatalf("layers-in-use %v, want %v", got, *want)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if want != nil {
+				t.Fatalf("no layers-in-use, want %v", *want)
+			}
+		}
+	}
+	suggestedOff := func(rid string) float64 {
+		return testutil.ToFloat64(appmetrics.LayersSuggestedOffTotal.WithLabelValues(rid))
+	}
+
+	publisher := peer.NewPeer(r.ID, "alice", "", zap.NewNop())
+	if err := r.AddPeer(publisher); err != nil {
+		t.Fatal(err)
+	}
+	mt := addTrack(r, "cam", publisher.ID, "video", qhf...)
+	mt.Layers["f"].Track = &webrtc.TrackRemote{}
+	mt.mu.Lock()
+	for _, id := range []string{"bob", "carol"} {
+		mt.Subscribers[id] = &SubscriberState{PeerID: id, CurrentRID: "q"}
+	}
+	mt.mu.Unlock()
+	// These subscribers forward nothing, so they have nothing to stop
+	defer func() {
+		mt.mu.Lock()
+		clear(mt.Subscribers)
+		mt.mu.Unlock()
+	}()
+	offH, offF := suggestedOff("h"), suggestedOff("f")
+
+	// Layers get a full window before they are suggested off, and nothing is
+	// said while every layer is needed. The ticks are in the past, as layer
+	// switches are timed now.
+	now := time.Now().Add(-10 * window)
+	r.checkLayerUse(now)
+	expect(nil)
+	r.checkLayerUse(now.Add(window / 2))
+	expect(nil)
+	r.checkLayerUse(now.Add(window))
+	expect(&layersInUse{[]string{"q"}, []string{"h", "f"}})
+	r.checkLayerUse(now.Add(2 * window))
+	expect(nil)
+	if h, f := suggestedOff("h")-offH, suggestedOff("f")-offF; h != 1 || f != 1 {
+		t.Fatalf("layers suggested off %v times for h and %v for f, want once", h, f)
+	}
+
+	// A switch to a paused layer is held on the best running one, and the
+	// publisher told at once
+	if err := r.switchSubscriberLayer(mt, "bob", "f"); err != nil {
+		t.Fatal(err)
+	}
+	expect(&layersInUse{[]string{"q", "f"}, []string{"h"}})
+	mt.mu.Lock()
+	current, wanted := mt.Subscribers["bob"].CurrentRID, mt.wantedLayerLocked(mt.Subscribers["bob"])
+	mt.mu.Unlock()
+	if current != "q" || wanted != "f" {
+		t.Fatalf("bob on %s waiting for %s, want q waiting for f", current, wanted)
+	}
+	if !mt.Layers["f"].resuming.Load() {
+		t.Fatal("f not marked as resuming")
+	}
+
+	// Its first packet moves the subscriber and times the re-enable
+	before := histogramCount(t, appmetrics.LayerReenableLatencyMs)
+	r.layerResumed(mt, "f")
+	mt.mu.Lock()
+	current = mt.Subscribers["bob"].CurrentRID
+	mt.mu.Unlock()
+	if current != "f" {
+		t.Fatalf("bob on %s after f resumed", current)
+	}
+	if n := histogramCount(t, appmetrics.LayerReenableLatencyMs) - before; n != 1 {
+		t.Fatalf("%d re-enables timed", n)
+	}
+	r.checkLayerUse(time.Now())
+	expect(nil)
+
+	// Once its last subscriber leaves the layer goes off again
+	mt.mu.Lock()
+	delete(mt.Subscribers, "bob")
+	mt.mu.Unlock()
+	r.checkLayerUse(time.Now().Add(window))
+	expect(&layersInUse{[]string{"q"}, []string{"h", "f"}})
+	if f := suggestedOff("f") - offF; f != 2 {
+		t.Fatalf("f suggested off %v times, want twice", f)
+	}
+
+	// The lowest layer stays on with nobody watching
+	mt.mu.Lock()
+	delete(mt.Subscribers, "carol")
+	mt.mu.Unlock()
+	r.checkLayerUse(time.Now().Add(3 * window))
+	expect(nil)
+}
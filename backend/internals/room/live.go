@@ -0,0 +1,61 @@
+package room
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// While a live dashboard watches a room, each stats tick also hands
+// OnLiveSample a compact sample of the room, assembled from what the tick
+// collected anyway: the quality of every peer it read, the forwarded
+// bitrate it sampled, the dominant speaker and the events recorded since
+// the previous sample. Nothing extra is measured for it.
+
+// LiveSample is a room's state on one stats tick, for live dashboards.
+type LiveSample struct {
+	RoomID              string      `json:"roomId"`
+	At                  time.Time   `json:"at"`
+	PeerCount           int         `json:"peerCount"` // participants, observers excluded
+	Peers               []LivePeer  `json:"peers"`
+	DominantSpeaker     string      `json:"dominantSpeaker,omitempty"`
+	ForwardedBitrateBps uint64      `json:"forwardedBitrateBps"`
+	Events              []RoomEvent `json:"events,omitempty"` // since the previous sample
+}
+
+// LivePeer is the quality of one peer in a LiveSample.
+type LivePeer struct {
+	PeerID string `json:"peerId"`
+	PeerQuality
+}
+
+// liveState is whether the room is sampled for OnLiveSample, and the last
+// event the previous sample carried.
+type liveState struct {
+	enabled   atomic.Bool
+	eventsSeq atomic.Uint64
+}
+
+// SetLiveSampling turns the samples passed to OnLiveSample on or off. A
+// sample carries the events recorded after sampling was turned on.
+func (r *Room) SetLiveSampling(on bool) {
+	if on && !r.live.enabled.Load() {
+		r.live.eventsSeq.Store(r.lastEventSeq())
+	}
+	r.live.enabled.Store(on)
+}
+
+// liveSample assembles the sample of a stats tick from the peers it read.
+func (r *Room) liveSample(now time.Time, peerCount int, peers []LivePeer) LiveSample {
+	sample := LiveSample{
+		RoomID:              r.ID,
+		At:                  now,
+		PeerCount:           peerCount,
+		Peers:               peers,
+		DominantSpeaker:     r.GetDominantSpeaker(),
+		ForwardedBitrateBps: r.GetForwardingStats().BitrateBps,
+	}
+	events, last := r.EventsSince(r.live.eventsSeq.Load())
+	sample.Events = events
+	r.live.eventsSeq.Store(last)
+	return sample
+}
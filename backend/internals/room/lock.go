@@ -0,0 +1,55 @@
+package room
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// A host can lock a room once everyone has arrived. The room only keeps
+// the lock; who may still join a locked room is up to the caller.
+
+// RoomLock is a room's lock.
+type RoomLock struct {
+	By    string    `json:"by,omitempty"` // the user or API actor that locked the room
+	Since time.Time `json:"since"`
+}
+
+// SetLock puts l in force, or unlocks the room when l is nil.
+func (r *Room) SetLock(l *RoomLock) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if l != nil {
+		c := *l
+		l = &c
+	}
+	r.lock = l
+
+	detail := "unlocked"
+	if l != nil {
+		detail = "locked"
+	}
+	r.recordEvent(RoomEvent{Type: EventLockChanged, Detail: detail})
+	r.logger.Info("Room lock changed",
+		zap.String("roomID", r.ID),
+		zap.String("state", detail),
+	)
+}
+
+// GetLock returns a copy of the room's lock, or nil if it is unlocked.
+func (r *Room) GetLock() *RoomLock {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.lock == nil {
+		return nil
+	}
+	c := *r.lock
+	return &c
+}
+
+// IsLocked reports whether the room is locked.
+func (r *Room) IsLocked() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lock != nil
+}
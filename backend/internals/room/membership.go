@@ -0,0 +1,72 @@
+package room
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrPeerNotFound = errors.New("peer not found in room")
+	ErrUserInRoom   = errors.New("user already has a peer in room")
+	ErrCannotHost   = errors.New("observers and viewers cannot be host")
+)
+
+// memberCountsLocked counts participants and observers. Both are derived
+// from Peers rather than kept as counters, so they cannot drift from it.
+// MUST be called with r.mu held.
+func (r *Room) memberCountsLocked() (participants, observers int) {
+	for _, p := range r.Peers {
+		if p.Observer {
+			observers++
+		} else {
+			participants++
+		}
+	}
+	return participants, observers
+}
+
+// SetConsistencyChecks enables checkConsistencyLocked after every membership
+// change. It walks every peer and track, so it is meant for debugging.
+func (r *Room) SetConsistencyChecks(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.consistencyChecks = enabled
+}
+
+// checkConsistencyLocked logs every disagreement between Peers, peersByUser,
+// MediaTracks and trackHandles. MUST be called with r.mu held.
+func (r *Room) checkConsistencyLocked(op string) {
+	if !r.consistencyChecks {
+		return
+	}
+
+	report := func(msg string, fields ...zap.Field) {
+		r.logger.Error("Room state inconsistent: "+msg,
+			append([]zap.Field{zap.String("roomID", r.ID), zap.String("op", op)}, fields...)...)
+	}
+
+	for userID, peerID := range r.peersByUser {
+		p, ok := r.Peers[peerID]
+		if !ok {
+			report("user mapped to missing peer", zap.String("userID", userID), zap.String("peerID", peerID))
+		} else if p.UserID != userID {
+			report("user mapped to another user's peer", zap.String("userID", userID), zap.String("peerID", peerID))
+		}
+	}
+	for peerID, p := range r.Peers {
+		if r.peersByUser[p.UserID] != peerID {
+			report("peer unreachable by user", zap.String("userID", p.UserID), zap.String("peerID", peerID))
+		}
+	}
+	for trackID, mt := range r.MediaTracks {
+		if _, ok := r.Peers[mt.PeerID]; !ok {
+			report("track of missing peer", zap.String("trackID", trackID), zap.String("peerID", mt.PeerID))
+		}
+	}
+	for handle, trackID := range r.trackHandles {
+		if _, ok := r.MediaTracks[trackID]; !ok {
+			report("handle of missing track", zap.String("handle", handle), zap.String("trackID", trackID))
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMembershipUnderConcurrentRejoins(t *testing.T) {
+	const (
+		users   = 4
+		workers = 8
+		rounds  = 40
+	)
+	core, logs := observer.New(zapcore.ErrorLevel)
+	r := NewRoom("room-1", users*workers, zap.New(core))
+	defer r.Close()
+	r.SetConsistencyChecks(true)
+
+	var (
+		wg      sync.WaitGroup
+		added   atomic.Int64
+		removed atomic.Int64
+		errs    = make(chan error, users*workers)
+	)
+	remove := func(err error) {
+		switch {
+		case err == nil:
+			removed.Add(1)
+		case !errors.Is(err, ErrPeerNotFound):
+			errs <- err
+		}
+	}
+	for u := 0; u < users; u++ {
+		userID := fmt.Sprintf("user-%d", u)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < rounds; i++ {
+					// A join evicts the user's current peer, racing the other
+					// joins and the disconnects of the peers it replaces
+					p := peer.NewPeer(r.ID, userID, "", zap.NewNop())
+					for {
+						if old, ok := r.GetPeerByUserID(userID); ok {
+							remove(r.EvictPeer(old.ID))
+						}
+						err := r.AddPeer(p)
+						if errors.Is(err, ErrUserInRoom) {
+							continue
+						}
+						if err != nil {
+							errs <- err
+							return
+						}
+						added.Add(1)
+						break
+					}
+					if (i+w)%2 == 0 {
+						// The disconnect and a stale one for the same peer
+						var both sync.WaitGroup
+						for j := 0; j < 2; j++ {
+							both.Add(1)
+							go func() {
+								defer both.Done()
+								remove(r.RemovePeerIfCurrent(p))
+							}()
+						}
+						both.Wait()
+						if err := r.RemovePeer(p.ID); !errors.Is(err, ErrPeerNotFound) {
+							errs <- fmt.Errorf("removing a removed peer: err = %v, want %v", err, ErrPeerNotFound)
+						}
+					}
+				}
+			}(w)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	r.mu.RLock()
+	peers, byUser := len(r.Peers), len(r.peersByUser)
+	r.mu.RUnlock()
+	if n := r.GetPeerCount(); n != peers || byUser != peers || peers > users {
+		t.Fatalf("peer count %d, %d peers, %d users mapped; want equal and at most %d", n, peers, byUser, users)
+	}
+	if remaining := added.Load() - removed.Load(); remaining != int64(peers) {
+		t.Fatalf("%d added and %d removed, but %d peers remain", added.Load(), removed.Load(), peers)
+	}
+	for _, e := range logs.All() {
+		t.Errorf("%s %v", e.Message, e.ContextMap())
+	}
+}
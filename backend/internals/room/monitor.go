@@ -0,0 +1,47 @@
+package room
+
+import (
+	"errors"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+)
+
+// In a room with RoomSettings.SelfMonitor a publisher may subscribe to one
+// of its own tracks by handle. The SFU then forwards what it received back
+// to the publisher through the normal subscriber path, under the stream ID
+// MonitorStreamID, so a client can show what the SFU actually gets. Codec
+// group handles are not monitored; the member tracks are. Talk time and the
+// dominant speaker are taken from the publisher's inbound audio, so the
+// echoed audio is never counted twice.
+
+// MonitorStreamID is the stream ID of a track forwarded back to its own
+// publisher.
+const MonitorStreamID = "monitor"
+
+// ErrMonitorLimit is returned when a publisher already monitors another of
+// its tracks.
+var ErrMonitorLimit = errors.New("already monitoring another own track")
+
+// isMonitor reports whether forwarding mt to peerID echoes it back to its
+// publisher.
+func isMonitor(mt *MediaTrack, peerID string) bool {
+	return mt.PeerID != "" && mt.PeerID == peerID
+}
+
+// admitMonitor checks that p monitors no own track other than mt.
+func (r *Room) admitMonitor(mt *MediaTrack, p *peer.Peer) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, other := range r.MediaTracks {
+		if other == mt || other.PeerID != p.ID {
+			continue
+		}
+		other.mu.RLock()
+		_, monitored := other.Subscribers[p.ID]
+		other.mu.RUnlock()
+		if monitored {
+			return ErrMonitorLimit
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package room
+
+import (
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// A host can mute everyone at once. The SFU mutes the mic of every
+// participant but the exempt users, and the room remembers the mute-all
+// until it is lifted, so a participant joining meanwhile starts muted too.
+// Participants may unmute themselves again unless the mute-all is hard.
+
+// MuteAll is a room's mute-all.
+type MuteAll struct {
+	Hard   bool      `json:"hard"`             // participants cannot unmute themselves
+	Exempt []string  `json:"exempt,omitempty"` // user IDs left unmuted
+	By     string    `json:"by,omitempty"`     // the user or API actor that muted all
+	Since  time.Time `json:"since"`
+}
+
+// Exempts reports whether m leaves userID unmuted.
+func (m *MuteAll) Exempts(userID string) bool {
+	return slices.Contains(m.Exempt, userID)
+}
+
+// SetMuteAll puts m in force, replacing any mute-all, or lifts it when m is
+// nil. Muting the participants is up to the caller.
+func (r *Room) SetMuteAll(m *MuteAll) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m != nil {
+		c := *m
+		c.Exempt = slices.Clone(m.Exempt)
+		m = &c
+	}
+	r.muteAll = m
+
+	detail := "lifted"
+	if m != nil && m.Hard {
+		detail = "hard"
+	} else if m != nil {
+		detail = "soft"
+	}
+	r.recordEvent(RoomEvent{Type: EventMuteAll, Detail: detail})
+	r.logger.Info("Room mute-all changed",
+		zap.String("roomID", r.ID),
+		zap.String("state", detail),
+	)
+}
+
+// GetMuteAll returns a copy of the room's mute-all, or nil if none is in
+// force.
+func (r *Room) GetMuteAll() *MuteAll {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.muteAll == nil {
+		return nil
+	}
+	c := *r.muteAll
+	c.Exempt = slices.Clone(r.muteAll.Exempt)
+	return &c
+}
+
+// MutedByMuteAll reports whether a mute-all in force applies to userID,
+// and if so whether it is hard.
+func (r *Room) MutedByMuteAll(userID string) (muted, hard bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.muteAll == nil || r.muteAll.Exempts(userID) {
+		return false, false
+	}
+	return true, r.muteAll.Hard
+}
@@ -0,0 +1,38 @@
+package room
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestMuteAllExempts(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+
+	if muted, _ := r.MutedByMuteAll("alice"); muted || r.GetMuteAll() != nil {
+		t.Fatal("muted without a mute-all")
+	}
+	exempt := []string{"host"}
+	r.SetMuteAll(&MuteAll{Hard: true, Exempt: exempt, By: "host"})
+	exempt[0] = "alice" // the room keeps its own copy
+	if muted, hard := r.MutedByMuteAll("alice"); !muted || !hard {
+		t.Fatalf("alice muted %v, hard %v", muted, hard)
+	}
+	if muted, _ := r.MutedByMuteAll("host"); muted {
+		t.Fatal("the exempt host muted")
+	}
+	r.GetMuteAll().Exempt[0] = "alice"
+	if muted, _ := r.MutedByMuteAll("alice"); !muted {
+		t.Fatal("a copy of the mute-all changed it")
+	}
+
+	r.SetMuteAll(&MuteAll{})
+	if muted, hard := r.MutedByMuteAll("alice"); !muted || hard {
+		t.Fatalf("soft mute-all: alice muted %v, hard %v", muted, hard)
+	}
+	r.SetMuteAll(nil)
+	if muted, _ := r.MutedByMuteAll("alice"); muted || r.GetMuteAll() != nil {
+		t.Fatal("muted after the mute-all was lifted")
+	}
+}
@@ -0,0 +1,68 @@
+package room
+
+import (
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+)
+
+// A renegotiate tells the client what it will receive once the exchange
+// completes, so it can have enough receive transceivers of each kind before
+// it offers. Counting the senders on the PeerConnection gets this wrong:
+// tracks still in the pending-forward queue have no sender yet, and senders
+// of removed tracks stay behind to keep the m-lines aligned.
+
+// NegotiationHint is what a peer receives after its next negotiation.
+type NegotiationHint struct {
+	TrackCount int
+	AudioCount int
+	VideoCount int
+	// Handles of the tracks without a negotiated m-line yet
+	NewTracks []string
+}
+
+// NegotiationHint counts the tracks forwarded to p, one per subscription
+// however many layers it has, and those queued for p.
+func (r *Room) NegotiationHint(p *peer.Peer) NegotiationHint {
+	var hint NegotiationHint
+	add := func(kind, handle string, negotiated bool) {
+		hint.TrackCount++
+		if kind == "audio" {
+			hint.AudioCount++
+		} else {
+			hint.VideoCount++
+		}
+		if !negotiated {
+			hint.NewTracks = append(hint.NewTracks, handle)
+		}
+	}
+
+	for _, info := range r.SubscriptionSnapshot(p) {
+		add(info.Kind, info.TrackID, info.Mid != "")
+	}
+
+	r.pendingMu.Lock()
+	q := r.pendingForwards[p.ID]
+	var tracks []*MediaTrack
+	var groups []*codecGroup
+	if q != nil {
+		tracks = append(tracks, q.tracks...)
+		groups = append(groups, q.groups...)
+	}
+	r.pendingMu.Unlock()
+	for _, mt := range tracks {
+		add(mt.Kind, mt.Handle, false)
+	}
+	for _, g := range groups {
+		add(g.kind(), g.Handle, false)
+	}
+	return hint
+}
+
+// kind returns the kind of g's alternatives.
+func (g *codecGroup) kind() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, mt := range g.members {
+		return mt.Kind
+	}
+	return "video"
+}
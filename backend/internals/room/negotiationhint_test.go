@@ -0,0 +1,97 @@
+package room
+
+import (
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// subscribeOn subscribes p to mt through a sender on p's own connection, as
+// forwarding does.
+func subscribeOn(t *testing.T, mt *MediaTrack, p *peer.Peer) {
+	t.Helper()
+	mime := webrtc.MimeTypeVP8
+	if mt.Kind == "audio" {
+		mime = webrtc.MimeTypeOpus
+	}
+	local, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: mime}, mt.ID, "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := p.Connection.AddTrack(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mt.mu.Lock()
+	mt.Subscribers[p.ID] = &SubscriberState{PeerID: p.ID, LocalTrack: local, Sender: sender, kind: mt.Kind, cancel: func() {}}
+	mt.mu.Unlock()
+}
+
+func expectHint(t *testing.T, r *Room, p *peer.Peer, audio, video int, newTracks ...string) {
+	t.Helper()
+	hint := r.NegotiationHint(p)
+	if hint.TrackCount != audio+video || hint.AudioCount != audio || hint.VideoCount != video || len(hint.NewTracks) != len(newTracks) {
+		t.Fatalf("hint %+v, want %d audio, %d video and new %v", hint, audio, video, newTracks)
+	}
+	for i := range newTracks {
+		if hint.NewTracks[i] != newTracks[i] {
+			t.Fatalf("new tracks %v, want %v", hint.NewTracks, newTracks)
+		}
+	}
+}
+
+func TestNegotiationHint(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	bob := joinAs(t, r, "bob", func(p *peer.Peer) { p.Connection = pc })
+	alice := joinAs(t, r, "alice", nil)
+	mic := addTrack(r, "mic", alice.ID, "audio")
+	cam := addTrack(r, "cam", alice.ID, "video", "q", "h", "f")
+	screen := addTrack(r, "screen", alice.ID, "video")
+	group := &codecGroup{
+		Handle:  "grp",
+		PeerID:  alice.ID,
+		members: map[string]*MediaTrack{"cam-vp9": addTrack(r, "cam-vp9", alice.ID, "video")},
+	}
+
+	// Tracks queued during bob's first negotiation have no sender yet. A
+	// codec group counts once, and queueing a track twice does not count it
+	// twice
+	for _, mt := range []*MediaTrack{mic, cam, cam} {
+		r.queueForward(mt, nil, bob)
+	}
+	r.queueForward(nil, group, bob)
+	expectHint(t, r, bob, 1, 2, mic.Handle, cam.Handle, group.Handle)
+
+	// Attached, they stay new until an exchange gives them m-lines. The
+	// simulcast camera is one track for all its layers
+	r.dropPendingForwards(bob.ID)
+	subscribeOn(t, mic, bob)
+	subscribeOn(t, cam, bob)
+	expectHint(t, r, bob, 1, 1, mic.Handle, cam.Handle)
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	expectHint(t, r, bob, 1, 1)
+	subscribeOn(t, screen, bob)
+	expectHint(t, r, bob, 1, 2, screen.Handle)
+
+	// Removed tracks leave their transceivers behind but are not counted
+	r.removeTrack(alice, mic)
+	r.removeTrack(alice, screen)
+	if n := len(pc.GetTransceivers()); n != 3 {
+		t.Fatalf("%d transceivers after the removals, want all 3 kept", n)
+	}
+	expectHint(t, r, bob, 0, 1)
+}
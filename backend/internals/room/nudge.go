@@ -0,0 +1,26 @@
+package room
+
+import "github.com/adityaadpandey/sfu-go/internals/peer"
+
+// An operator can nudge a stuck peer through the admin API with a forced
+// renegotiation or ICE restart. Both are recorded in the event ring so they
+// show on the room's timeline next to whatever they were meant to fix.
+
+// ForceRenegotiation renegotiates p at once, bypassing the throttle. It
+// reports whether the request was handed to OnRenegotiateNeeded; while p's
+// renegotiations are held, for an interrupted connection or a missing
+// signaling connection, it waits for the resume instead.
+func (r *Room) ForceRenegotiation(p *peer.Peer) bool {
+	sent := r.renegotiate(p, RenegotiateAdmin, true)
+	detail := "sent"
+	if !sent {
+		detail = "held"
+	}
+	r.recordEvent(RoomEvent{Type: EventRenegotiationForced, PeerID: p.ID, UserID: p.UserID, Detail: detail})
+	return sent
+}
+
+// RecordICERestart records an operator's ICE restart of p and its outcome.
+func (r *Room) RecordICERestart(p *peer.Peer, outcome string) {
+	r.recordEvent(RoomEvent{Type: EventICERestartForced, PeerID: p.ID, UserID: p.UserID, Detail: outcome})
+}
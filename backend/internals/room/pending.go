@@ -0,0 +1,169 @@
+package room
+
+import (
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+// Tracks published while a subscriber is still in its initial offer/answer
+// exchange are not attached straight away: an AddTrack plus renegotiate in
+// the middle of that exchange confuses clients and loses media. They are
+// queued instead and attached in one batch once the exchange completes, so
+// the subscriber sees a single renegotiation however many tracks arrived.
+
+// pendingForwards is a subscriber's queue. A peer has one from AddPeer until
+// its first negotiation completes or it leaves.
+type pendingForwards struct {
+	tracks []*MediaTrack
+	groups []*codecGroup
+}
+
+// initPendingForwards opens the queue for a newly added peer.
+// MUST be called with r.mu held (write lock).
+func (r *Room) initPendingForwards(p *peer.Peer) {
+	if p.HasNegotiated() {
+		return
+	}
+	r.pendingMu.Lock()
+	r.pendingForwards[p.ID] = &pendingForwards{}
+	r.pendingMu.Unlock()
+}
+
+// queueForward holds mt (or its codec group) for target if target has not
+// finished its first negotiation. Reports whether it was queued.
+func (r *Room) queueForward(mt *MediaTrack, g *codecGroup, target *peer.Peer) bool {
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+
+	q, ok := r.pendingForwards[target.ID]
+	if !ok {
+		return false
+	}
+	if g != nil {
+		for _, queued := range q.groups {
+			if queued == g {
+				return true
+			}
+		}
+		q.groups = append(q.groups, g)
+	} else {
+		for _, queued := range q.tracks {
+			if queued == mt {
+				return true
+			}
+		}
+		q.tracks = append(q.tracks, mt)
+	}
+
+	r.logger.Debug("Queued track until initial negotiation completes",
+		zap.String("peerID", target.ID),
+		zap.Int("queued", len(q.tracks)+len(q.groups)),
+	)
+	return true
+}
+
+// unqueueForward removes mt (or its codec group) from target's queue.
+func (r *Room) unqueueForward(mt *MediaTrack, g *codecGroup, target *peer.Peer) {
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+
+	q, ok := r.pendingForwards[target.ID]
+	if !ok {
+		return
+	}
+	for i, queued := range q.groups {
+		if g != nil && queued == g {
+			q.groups = append(q.groups[:i], q.groups[i+1:]...)
+			return
+		}
+	}
+	for i, queued := range q.tracks {
+		if mt != nil && queued == mt {
+			q.tracks = append(q.tracks[:i], q.tracks[i+1:]...)
+			return
+		}
+	}
+}
+
+// resetPendingForwards empties target's queue without closing it. Called by
+// AddExistingTracksToPeer, which attaches everything published so far itself.
+func (r *Room) resetPendingForwards(target *peer.Peer) {
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+	if q, ok := r.pendingForwards[target.ID]; ok {
+		q.tracks, q.groups = nil, nil
+	}
+}
+
+// dropPendingForwards discards a departed peer's queue.
+func (r *Room) dropPendingForwards(peerID string) {
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+	delete(r.pendingForwards, peerID)
+}
+
+// handlePeerNegotiated closes p's queue and attaches what it held, followed
+// by a single renegotiation.
+func (r *Room) handlePeerNegotiated(p *peer.Peer) {
+	r.pendingMu.Lock()
+	q, ok := r.pendingForwards[p.ID]
+	delete(r.pendingForwards, p.ID)
+	r.pendingMu.Unlock()
+	if !ok || len(q.tracks)+len(q.groups) == 0 {
+		return
+	}
+
+	r.mu.RLock()
+	member := r.Peers[p.ID] == p
+	groups := q.groups[:0]
+	for _, g := range q.groups {
+		if r.codecGroups[g.Handle] == g {
+			groups = append(groups, g)
+		}
+	}
+	r.mu.RUnlock()
+	if !member {
+		return
+	}
+
+	added := 0
+	var failed []*MediaTrack
+	for _, g := range groups {
+		if r.forwardGroupToPeer(g, p, true) {
+			added++
+		}
+	}
+	for _, mt := range q.tracks {
+		if mt.ctx.Err() != nil {
+			continue // unpublished while queued
+		}
+		if !r.admitSubscriber(mt, p) {
+			continue
+		}
+		if r.forwardTrackToPeerDirect(mt, p) {
+			added++
+			continue
+		}
+		mt.mu.RLock()
+		_, subscribed := mt.Subscribers[p.ID]
+		mt.mu.RUnlock()
+		if !subscribed {
+			failed = append(failed, mt)
+		}
+	}
+
+	r.logger.Info("Flushed tracks queued during initial negotiation",
+		zap.String("roomID", r.ID),
+		zap.String("peerID", p.ID),
+		zap.Int("queued", len(q.tracks)+len(q.groups)),
+		zap.Int("added", added),
+	)
+
+	if added > 0 {
+		r.triggerRenegotiation(p, RenegotiateTrackChange)
+	}
+	// Fall back to the per-track retry path for anything that did not attach
+	for _, mt := range failed {
+		go r.forwardTrackToPeer(mt, p)
+	}
+}
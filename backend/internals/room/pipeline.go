@@ -0,0 +1,210 @@
+package room
+
+import (
+	"io"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// A track's packets take one of two paths from the publisher to its
+// subscribers, chosen from the track's kind when it is created:
+//
+//   - audio: read, inbound tap, policing count, mute check, fan-out, speaker
+//     activity. Fan-out writes each packet straight to every subscriber's
+//     local track on the reader goroutine (or its shard worker), with no
+//     clone, write buffer or writer goroutine in between. Audio packets are
+//     small and frequent, and every hop adds scheduling delay.
+//   - video: read, inbound tap, policing with keyframe detection, fan-out,
+//     then a clone per subscriber queued to its writer goroutine. The queue
+//     absorbs keyframe bursts and keeps a slow subscriber from stalling the
+//     others. Simulcast tracks fan out per layer (startLayerFanOut) and
+//     deliver the same way.
+//
+// On both paths a source that replaced another (see replace.go) has its
+// sequence numbers and timestamps rewritten as it is read, and a sample of
+// packets is timed from read to write (see latency.go).
+//
+// A new per-packet stage goes in the loop of the path it serves, in
+// forwardAudio or forwardVideo. Work that touches every packet of every
+// kind belongs in both, and should be cheap enough for audio; anything that
+// buffers or parses payloads belongs in the video path only.
+
+// forwardPath is how a track's packets are delivered to its subscribers.
+type forwardPath struct {
+	name string
+	// queued paths give each subscriber a write buffer and writer goroutine
+	queued  bool
+	deliver func(subs []*SubscriberState, item fanOutItem)
+}
+
+var (
+	audioPath = &forwardPath{name: "audio", deliver: deliverDirect}
+	videoPath = &forwardPath{name: "video", queued: true, deliver: deliverQueued}
+)
+
+// pathFor returns the forwarding path of a track of kind.
+func pathFor(kind webrtc.RTPCodecType) *forwardPath {
+	if kind == webrtc.RTPCodecTypeAudio {
+		return audioPath
+	}
+	return videoPath
+}
+
+// deliverDirect writes a packet to every subscriber that should receive it
+// on the calling goroutine. WriteRTP copies the packet, so it is not cloned.
+func deliverDirect(subs []*SubscriberState, item fanOutItem) {
+	for _, sub := range subs {
+		if item.layered && sub.CurrentRID != item.rid {
+			continue
+		}
+		if item.readAt != 0 {
+			sub.observeForwarding(item.readAt)
+		}
+		if err := sub.LocalTrack.WriteRTP(item.packet); err == nil {
+			sub.sent(item.packet)
+		} else {
+			sub.writeFailed(err)
+		}
+	}
+}
+
+// deliverQueued clones a packet into the write buffer of every subscriber
+// that should receive it, dropping it for subscribers whose buffer is full.
+func deliverQueued(subs []*SubscriberState, item fanOutItem) {
+	for _, sub := range subs {
+		if item.layered && sub.CurrentRID != item.rid {
+			continue
+		}
+		clone := clonePacket(item.packet)
+		select {
+		case sub.writeCh <- queuedPacket{packet: clone, readAt: item.readAt}:
+			// dispatched — subscriber writer will return to pool
+		default:
+			// buffer full — drop for this subscriber only
+			returnPacket(clone)
+		}
+	}
+}
+
+// queuedPacket is a packet in a subscriber's write buffer, with the read
+// time of a sampled packet.
+type queuedPacket struct {
+	packet *rtp.Packet
+	readAt int64
+}
+
+// sent does the bookkeeping for a packet written to the subscriber.
+func (sub *SubscriberState) sent(pkt *rtp.Packet) {
+	if tap := sub.tap.Load(); tap != nil {
+		(*tap)(pkt)
+	}
+	if sub.stats != nil {
+		sub.stats.add(pkt.MarshalSize())
+	}
+	if sub.Peer != nil {
+		sub.Peer.TouchMediaSent()
+	}
+}
+
+// readRTP reads src's next packet, rewritten to continue the sequence of the
+// source it replaced, if any. It returns nil when the loop should stop: the
+// source was cancelled, or ended (io.EOF) as reported by ended.
+func readRTP(src *trackSource) (pkt *rtp.Packet, ended bool) {
+	for {
+		select {
+		case <-src.ctx.Done():
+			return nil, false
+		default:
+		}
+		packet, _, err := src.track.ReadRTP()
+		if err == nil {
+			src.rewrite(packet)
+			return packet, false
+		}
+		if err == io.EOF {
+			return nil, true
+		}
+		select {
+		case <-src.ctx.Done():
+			return nil, false
+		default:
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// forwardAudio runs the audio path until src stops. It returns the packets
+// forwarded and whether the publisher ended src.
+func (r *Room) forwardAudio(mt *MediaTrack, src *trackSource, publisher *peer.Peer, policing *trackPolicing) (int, bool) {
+	var userID string
+	if publisher != nil {
+		userID = publisher.UserID
+	}
+	packets := 0
+	sampler := r.newLatencySampler(mt)
+	for {
+		packet, ended := readRTP(src)
+		if packet == nil {
+			return packets, ended
+		}
+		readAt := sampler.sample(packet)
+
+		mt.tapInbound(packet)
+		if policing != nil && !policing.forward(packet) {
+			continue
+		}
+		if publisher != nil {
+			publisher.TouchMediaReceived()
+			// A muted publisher's audio is read and dropped, so it neither
+			// reaches subscribers nor counts as speaking
+			if publisher.MicMuted() {
+				continue
+			}
+		}
+
+		r.fanOut(mt, fanOutItem{packet: packet, readAt: readAt})
+		packets++
+		r.trackAudioActivity(mt.PeerID, userID)
+	}
+}
+
+// forwardVideo runs the video path until src stops or the track is upgraded
+// to simulcast. It returns the packets forwarded and whether the publisher
+// ended src.
+func (r *Room) forwardVideo(mt *MediaTrack, src *trackSource, publisher *peer.Peer, policing *trackPolicing) (int, bool) {
+	packets := 0
+	sampler := r.newLatencySampler(mt)
+	for {
+		// If this track was upgraded to simulcast, stop the non-simulcast
+		// fan-out so the per-layer fan-outs take over exclusively.
+		if mt.IsSimulcast {
+			r.logger.Debug("Fan-out yielding to simulcast layer fan-outs",
+				zap.String("trackID", mt.ID),
+			)
+			return packets, false
+		}
+
+		packet, ended := readRTP(src)
+		if packet == nil {
+			return packets, ended
+		}
+		readAt := sampler.sample(packet)
+
+		mt.tapInbound(packet)
+		if policing != nil && !policing.forward(packet) {
+			continue
+		}
+		if publisher != nil {
+			publisher.TouchMediaReceived()
+		}
+
+		// Lock-free read of subscriber list via atomic snapshot; each
+		// subscriber gets its own clone
+		r.fanOut(mt, fanOutItem{packet: packet, readAt: readAt})
+		packets++
+	}
+}
@@ -0,0 +1,176 @@
+package room
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// pathTest is a track on path with subscribers that record, for every
+// packet they are sent, how long after the harness stamped it that was.
+type pathTest struct {
+	*fanOutTest
+	delivered atomic.Int64
+	latencies [][]time.Duration // by subscriber, each appended by one goroutine
+}
+
+func newPathTest(tb testing.TB, path *forwardPath, subscribers, packets int) *pathTest {
+	tb.Helper()
+	pt := &pathTest{fanOutTest: newFanOutTest(tb, 0, 0)}
+	pt.mt.path = path
+	pt.mt.Kind = path.name
+	pt.latencies = make([][]time.Duration, subscribers)
+	for i := range pt.latencies {
+		pt.latencies[i] = make([]time.Duration, 0, packets)
+		i := i
+		pt.subscribe(tb, fmt.Sprintf("peer-%d", i), func(pkt *rtp.Packet) {
+			stamped := int64(binary.BigEndian.Uint64(pkt.Payload))
+			pt.latencies[i] = append(pt.latencies[i], time.Duration(time.Now().UnixNano()-stamped))
+			pt.delivered.Add(1)
+		})
+	}
+	if path.queued {
+		pt.mt.mu.Lock()
+		for _, sub := range pt.mt.Subscribers {
+			sub.ctx, sub.cancel = context.WithCancel(pt.mt.ctx)
+			sub.writeCh = make(chan queuedPacket, 60)
+			startSubscriberWriter(sub)
+		}
+		pt.mt.mu.Unlock()
+		tb.Cleanup(func() {
+			for _, sub := range pt.mt.getSnapshot() {
+				sub.cancel()
+				sub.wg.Wait()
+			}
+		})
+	}
+	return pt
+}
+
+// forward fans out a packet stamped with the time it is handed to the
+// path, as the read loop does once it has read it, and returns it.
+func (pt *pathTest) forward(seq uint16) *rtp.Packet {
+	payload := make([]byte, 160)
+	binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+	pkt := &rtp.Packet{
+		Header:  rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 960, SSRC: 1234},
+		Payload: payload,
+	}
+	pt.r.fanOut(pt.mt, fanOutItem{packet: pkt})
+	return pkt
+}
+
+// hops returns the per-subscriber latencies recorded so far, sorted.
+func (pt *pathTest) hops() []time.Duration {
+	var all []time.Duration
+	for _, l := range pt.latencies {
+		all = append(all, l...)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	return all
+}
+
+func TestPathForKind(t *testing.T) {
+	if pathFor(webrtc.RTPCodecTypeAudio) != audioPath || pathFor(webrtc.RTPCodecTypeVideo) != videoPath {
+		t.Fatal("tracks not given the path of their kind")
+	}
+	if audioPath.queued || !videoPath.queued {
+		t.Fatal("audio is queued or video is not")
+	}
+}
+
+// The audio path delivers on the fan-out's own goroutine, without a copy,
+// and within a small budget per hop; video goes through each subscriber's
+// queue as a copy of its own.
+func TestAudioPathLatency(t *testing.T) {
+	const (
+		subscribers = 10
+		packets     = 2000
+		// Per hop, from the read loop handing a packet over to the write to
+		// the last subscriber
+		budgetP50 = 50 * time.Microsecond
+		budgetP99 = time.Millisecond
+	)
+	audio := newPathTest(t, audioPath, subscribers, packets)
+	var last *rtp.Packet
+	audio.subscribe(t, "observer", func(pkt *rtp.Packet) { last = pkt })
+	for i := 0; i < packets; i++ {
+		pkt := audio.forward(uint16(i))
+		if n := audio.delivered.Load(); n != int64((i+1)*subscribers) {
+			t.Fatalf("%d deliveries once packet %d was fanned out, want them all", n, i)
+		}
+		if last != pkt {
+			t.Fatalf("audio packet %d copied on its way to a subscriber", i)
+		}
+	}
+	hops := audio.hops()
+	p50, p99 := hops[len(hops)/2], hops[len(hops)*99/100]
+	t.Logf("audio: p50 %v, p99 %v per hop with %d subscribers", p50, p99, subscribers)
+	if p50 > budgetP50 || p99 > budgetP99 {
+		t.Fatalf("audio hop p50 %v, p99 %v over the budget of %v, %v", p50, p99, budgetP50, budgetP99)
+	}
+
+	// Video is delivered later, each subscriber with its own copy
+	video := newPathTest(t, videoPath, subscribers, packets)
+	var copies [subscribers]*rtp.Packet
+	video.forward(0)
+	deadline := time.Now().Add(5 * time.Second)
+	for video.delivered.Load() < subscribers {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d video deliveries", video.delivered.Load())
+		}
+		runtime.Gosched()
+	}
+	var got atomic.Int32
+	for i, sub := range video.mt.getSnapshot() {
+		i := i
+		tap := PacketTap(func(pkt *rtp.Packet) { copies[i] = pkt; got.Add(1) })
+		sub.tap.Store(&tap)
+	}
+	pkt := video.forward(1)
+	for got.Load() < subscribers {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d video deliveries of the second packet", got.Load())
+		}
+		runtime.Gosched()
+	}
+	for i, c := range copies {
+		if c == pkt || (i > 0 && c == copies[0]) {
+			t.Fatal("video subscribers share a packet")
+		}
+	}
+}
+
+// BenchmarkForwardPath measures the cost per packet of each path: the
+// fan-out's own time as ns/op, and the time each subscriber got the packet
+// after it was handed over.
+func BenchmarkForwardPath(b *testing.B) {
+	for _, path := range []*forwardPath{audioPath, videoPath} {
+		for _, n := range []int{1, 10, 50} {
+			b.Run(fmt.Sprintf("%s/subscribers=%d", path.name, n), func(b *testing.B) {
+				pt := newPathTest(b, path, n, b.N)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					pt.forward(uint16(i))
+					// One packet in flight, as the read loop has
+					for pt.delivered.Load() < int64((i+1)*n) {
+						runtime.Gosched()
+					}
+				}
+				b.StopTimer()
+				hops := pt.hops()
+				b.ReportMetric(float64(hops[len(hops)/2].Nanoseconds()), "p50-hop-ns")
+				b.ReportMetric(float64(hops[len(hops)*99/100].Nanoseconds()), "p99-hop-ns")
+			})
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package room
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// Congestion feedback only asks a publisher to slow down; a broken or
+// malicious one can keep sending far more than anyone needs. With a bitrate
+// cap set, each publisher's inbound rate over all its tracks is measured in
+// the fan-out and checked every policingInterval. Once it has stayed above
+// the cap for policingDelay the publisher is policed: upper simulcast layers
+// are dropped and every subscriber is served from the lowest one, and
+// packets beyond the cap are dropped unless they carry a keyframe or audio.
+// The publisher is warned through OnBitratePolicing. If it is still over the
+// cap policingRemoveAfter later, its busiest track is removed and rejected
+// with RejectBitrateCapExceeded. Policing ends as soon as a check finds the
+// rate back under the cap.
+
+const policingInterval = time.Second
+
+// policingBurst is how far ahead of the cap a policed publisher may send.
+const policingBurst = 250 * time.Millisecond
+
+// RejectBitrateCapExceeded is the reason a track removed for keeping its
+// publisher over the bitrate cap is rejected with.
+const RejectBitrateCapExceeded = "bitrate_cap_exceeded"
+
+// BitratePolicing is what OnBitratePolicing reports to a publisher.
+type BitratePolicing struct {
+	Policing    bool
+	BitrateKbps int
+	CapKbps     int
+	RemoveIn    time.Duration // until the busiest track is removed; 0 = never
+}
+
+// bitratePolicer measures and polices one publisher.
+type bitratePolicer struct {
+	capBytes float64 // per second
+	policing atomic.Bool
+
+	mu           sync.Mutex
+	tracks       map[string]*atomic.Uint64 // track ID -> bytes since the last check
+	tokens       float64                   // forwarding budget while policing, in bytes
+	refilled     time.Time
+	overSince    time.Time // when the rate went over the cap; zero while under
+	policedSince time.Time // when policing started or last removed a track
+}
+
+// spend takes size bytes from the budget, going into debt when force is set,
+// and reports whether the packet fits.
+func (b *bitratePolicer) spend(size int, force bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	burst := b.capBytes * policingBurst.Seconds()
+	b.tokens = min(b.tokens+now.Sub(b.refilled).Seconds()*b.capBytes, burst)
+	b.refilled = now
+	if b.tokens < float64(size) && !force {
+		return false
+	}
+	// A large keyframe may not starve the track for more than a second
+	b.tokens = max(b.tokens-float64(size), -b.capBytes)
+	return true
+}
+
+// trackPolicing is one fan-out loop's view of its publisher's policer.
+type trackPolicing struct {
+	policer *bitratePolicer
+	bytes   *atomic.Uint64
+	mt      *MediaTrack
+	rid     string // the simulcast layer read, if any
+	audio   bool
+	codec   string
+	kf      keyframeTracker
+}
+
+// newTrackPolicing returns the policing of a fan-out loop reading track, mt
+// itself or its layer rid, from publisher, or nil when no cap is set.
+func (r *Room) newTrackPolicing(publisher *peer.Peer, mt *MediaTrack, rid string, track *webrtc.TrackRemote) *trackPolicing {
+	if publisher == nil {
+		return nil
+	}
+	r.policingMu.Lock()
+	defer r.policingMu.Unlock()
+	if r.bitrateCap <= 0 {
+		return nil
+	}
+	b, ok := r.policers[publisher.ID]
+	if !ok {
+		b = &bitratePolicer{
+			capBytes: float64(r.bitrateCap) / 8,
+			tracks:   make(map[string]*atomic.Uint64),
+		}
+		r.policers[publisher.ID] = b
+	}
+
+	b.mu.Lock()
+	counter, ok := b.tracks[mt.ID]
+	if !ok {
+		counter = new(atomic.Uint64)
+		b.tracks[mt.ID] = counter
+	}
+	b.mu.Unlock()
+
+	return &trackPolicing{
+		policer: b,
+		bytes:   counter,
+		mt:      mt,
+		rid:     rid,
+		audio:   mt.Kind == "audio",
+		codec:   track.Codec().MimeType,
+	}
+}
+
+// active reports whether the publisher is being policed.
+func (t *trackPolicing) active() bool {
+	return t.policer.policing.Load()
+}
+
+// forward counts pkt toward the publisher's rate and reports whether it may
+// be forwarded.
+func (t *trackPolicing) forward(pkt *rtp.Packet) bool {
+	size := pkt.MarshalSize()
+	t.bytes.Add(uint64(size))
+	if !t.policer.policing.Load() {
+		return true
+	}
+	if t.rid != "" && t.rid != t.mt.lowestLayer() {
+		appmetrics.RecordPolicedPacket("layer")
+		return false
+	}
+	keyframe := !t.audio && t.kf.observe(t.codec, pkt)
+	if t.policer.spend(size, t.audio || keyframe) {
+		return true
+	}
+	appmetrics.RecordPolicedPacket("budget")
+	return false
+}
+
+// lowestLayer returns the RID of mt's lowest simulcast layer.
+func (mt *MediaTrack) lowestLayer() string {
+	mt.mu.RLock()
+	defer mt.mu.RUnlock()
+	rids := mt.sortedLayersLocked()
+	if len(rids) == 0 {
+		return ""
+	}
+	return rids[0]
+}
+
+// SetBitratePolicing caps each publisher's inbound bitrate at capKbps
+// (0 = off), policing publishers over it for delay and removing their
+// busiest track after removeAfter of policing (0 = never).
+func (r *Room) SetBitratePolicing(capKbps int, delay, removeAfter time.Duration) {
+	r.policingMu.Lock()
+	r.bitrateCap = capKbps * 1000
+	r.policingDelay = delay
+	r.policingRemoveAfter = removeAfter
+	start := r.bitrateCap > 0 && r.policers == nil
+	if start {
+		r.policers = make(map[string]*bitratePolicer)
+	}
+	r.policingMu.Unlock()
+
+	if start {
+		r.mu.Lock()
+		r.goLoopLocked(r.runPolicing)
+		r.mu.Unlock()
+	}
+}
+
+func (r *Room) runPolicing() {
+	ticker := time.NewTicker(policingInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.checkBitrates(now, now.Sub(last))
+			last = now
+		}
+	}
+}
+
+// policingAction is what a bitrate check decided for one publisher.
+type policingAction int
+
+const (
+	policingNone policingAction = iota
+	policingEngage
+	policingRelease
+	policingRemove
+)
+
+// checkBitrates measures every publisher's rate over the elapsed interval
+// and starts, ends or escalates policing.
+func (r *Room) checkBitrates(now time.Time, elapsed time.Duration) {
+	r.policingMu.Lock()
+	capBits := r.bitrateCap
+	delay, removeAfter := r.policingDelay, r.policingRemoveAfter
+	policers := make(map[string]*bitratePolicer, len(r.policers))
+	for peerID, b := range r.policers {
+		policers[peerID] = b
+	}
+	r.policingMu.Unlock()
+	if capBits <= 0 || elapsed <= 0 {
+		return
+	}
+
+	for peerID, b := range policers {
+		p, ok := r.GetPeer(peerID)
+		if !ok {
+			r.policingMu.Lock()
+			delete(r.policers, peerID)
+			r.policingMu.Unlock()
+			continue
+		}
+
+		bitrate, busiest := r.sampleBitrate(b, elapsed)
+		action := b.decide(now, bitrate > capBits, delay, removeAfter)
+		state := BitratePolicing{BitrateKbps: bitrate / 1000, CapKbps: capBits / 1000}
+		switch action {
+		case policingEngage:
+			state.Policing, state.RemoveIn = true, removeAfter
+			r.logger.Warn("Publisher over bitrate cap, policing",
+				zap.String("roomID", r.ID),
+				zap.String("peerID", p.ID),
+				zap.String("userID", p.UserID),
+				zap.Int("bitrateKbps", state.BitrateKbps),
+				zap.Int("capKbps", state.CapKbps),
+			)
+			appmetrics.RecordBitratePolicing("engaged")
+			r.requestPolicedKeyframes(p.ID)
+		case policingRelease:
+			r.logger.Info("Publisher back under bitrate cap, policing ended",
+				zap.String("roomID", r.ID),
+				zap.String("peerID", p.ID),
+				zap.Int("bitrateKbps", state.BitrateKbps),
+			)
+			appmetrics.RecordBitratePolicing("released")
+			r.requestPolicedKeyframes(p.ID)
+		case policingRemove:
+			if busiest == nil {
+				continue
+			}
+			r.logger.Warn("Removing track of publisher over bitrate cap",
+				zap.String("roomID", r.ID),
+				zap.String("peerID", p.ID),
+				zap.String("userID", p.UserID),
+				zap.String("trackID", busiest.Handle),
+				zap.Int("bitrateKbps", state.BitrateKbps),
+				zap.Int("capKbps", state.CapKbps),
+			)
+			appmetrics.RecordBitratePolicing("track_removed")
+			r.removeTrack(p, busiest)
+			r.rejectTrack(p, busiest.ID, RejectBitrateCapExceeded)
+			continue
+		default:
+			continue
+		}
+		if r.OnBitratePolicing != nil && !r.silenced() {
+			r.OnBitratePolicing(r, p, state)
+		}
+	}
+}
+
+// sampleBitrate returns b's publisher's rate over elapsed, in bits per
+// second, and its busiest track, resetting the counters. Counters of
+// removed tracks are dropped.
+func (r *Room) sampleBitrate(b *bitratePolicer, elapsed time.Duration) (int, *MediaTrack) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var total, most uint64
+	var busiest *MediaTrack
+	for trackID, counter := range b.tracks {
+		n := counter.Swap(0)
+		total += n
+		r.mu.RLock()
+		mt, ok := r.MediaTracks[trackID]
+		r.mu.RUnlock()
+		if !ok {
+			delete(b.tracks, trackID)
+			continue
+		}
+		if n > most {
+			most, busiest = n, mt
+		}
+	}
+	return int(float64(total*8) / elapsed.Seconds()), busiest
+}
+
+// decide moves b's policing state on given whether the publisher is over the
+// cap at now.
+func (b *bitratePolicer) decide(now time.Time, over bool, delay, removeAfter time.Duration) policingAction {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	policing := b.policing.Load()
+	switch {
+	case !over:
+		b.overSince = time.Time{}
+		if policing {
+			b.policing.Store(false)
+			return policingRelease
+		}
+	case !policing:
+		if b.overSince.IsZero() {
+			b.overSince = now
+		}
+		if now.Sub(b.overSince) >= delay {
+			b.policedSince = now
+			b.tokens, b.refilled = 0, now
+			b.policing.Store(true)
+			return policingEngage
+		}
+	case removeAfter > 0 && now.Sub(b.policedSince) >= removeAfter:
+		b.policedSince = now
+		return policingRemove
+	}
+	return policingNone
+}
+
+// requestPolicedKeyframes asks for keyframes on peerID's simulcast tracks,
+// whose subscribers move between layers when policing starts or ends.
+func (r *Room) requestPolicedKeyframes(peerID string) {
+	r.mu.RLock()
+	var tracks []*MediaTrack
+	for _, mt := range r.MediaTracks {
+		if mt.PeerID == peerID && mt.IsSimulcast {
+			tracks = append(tracks, mt)
+		}
+	}
+	r.mu.RUnlock()
+	for _, mt := range tracks {
+		r.sendKeyframeRequest(mt, false)
+	}
+}
+
+// removeTrack stops forwarding one of p's tracks and detaches it from every
+// subscriber, as if p had unpublished it.
+func (r *Room) removeTrack(p *peer.Peer, mt *MediaTrack) {
+	r.mu.Lock()
+	if _, ok := r.MediaTracks[mt.ID]; !ok {
+		r.mu.Unlock()
+		return
+	}
+	if mt.cancel != nil {
+		mt.cancel()
+	}
+	affected := make(map[string]*peer.Peer)
+	var stopped []*SubscriberState
+	mt.mu.Lock()
+	for subPeerID, sub := range mt.Subscribers {
+		sub.stop()
+		if subPeer, ok := r.Peers[subPeerID]; ok {
+			// Keep the transceiver so the subscriber's m-lines stay aligned
+			if err := subPeer.ReleaseSender(sub.Sender); err != nil {
+				sub.Sender.Stop()
+			}
+			affected[subPeerID] = subPeer
+		} else {
+			sub.Sender.Stop()
+		}
+		stopped = append(stopped, sub)
+	}
+	mt.mu.Unlock()
+	delete(r.MediaTracks, mt.ID)
+	delete(r.trackHandles, mt.Handle)
+	r.forgetSourcesLocked(mt)
+	r.mu.Unlock()
+
+	r.waitSubscribers(stopped)
+	r.dropPriorities("", []*MediaTrack{mt})
+	r.dropReceivePreferences("", []*MediaTrack{mt})
+	r.leaveCodecGroup(mt)
+	r.recordEvent(RoomEvent{Type: EventTrackRemoved, PeerID: p.ID, UserID: p.UserID, TrackID: mt.Handle})
+	if r.OnTrackRemoved != nil && !r.silenced() {
+		r.OnTrackRemoved(r, p, mt)
+	}
+	for _, subPeer := range affected {
+		r.triggerRenegotiation(subPeer, RenegotiateTrackRemoved)
+	}
+}
+
+// keyframeTracker recognizes the packets of keyframes in one RTP stream:
+// the first packet is recognized from the payload, the rest by sharing its
+// timestamp.
+type keyframeTracker struct {
+	timestamp uint32
+	valid     bool
+}
+
+func (k *keyframeTracker) observe(codec string, pkt *rtp.Packet) bool {
+	if isKeyframeStart(codec, pkt.Payload) {
+		k.timestamp, k.valid = pkt.Timestamp, true
+		return true
+	}
+	return k.valid && pkt.Timestamp == k.timestamp
+}
+
+// isKeyframeStart reports whether payload begins a keyframe of the given
+// codec. Unknown codecs never do.
+func isKeyframeStart(codec string, payload []byte) bool {
+	if len(payload) == 0 {
+		return false
+	}
+	switch strings.ToLower(codec) {
+	case "video/vp8":
+		return vp8KeyframeStart(payload)
+	case "video/vp9":
+		// Start of a frame (B) that is not inter-predicted (P)
+		return payload[0]&0x08 != 0 && payload[0]&0x40 == 0
+	case "video/h264":
+		return h264HasKeyframe(payload)
+	}
+	return false
+}
+
+func vp8KeyframeStart(payload []byte) bool {
+	// Payload descriptor: X, S and PartID in the first byte
+	if payload[0]&0x10 == 0 || payload[0]&0x0f != 0 {
+		return false
+	}
+	i := 1
+	if payload[0]&0x80 != 0 {
+		if len(payload) < 2 {
+			return false
+		}
+		ext := payload[1]
+		i = 2
+		if ext&0x80 != 0 { // PictureID, one or two bytes
+			if len(payload) <= i {
+				return false
+			}
+			if payload[i]&0x80 != 0 {
+				i++
+			}
+			i++
+		}
+		if ext&0x40 != 0 { // TL0PICIDX
+			i++
+		}
+		if ext&0x30 != 0 { // TID/KEYIDX
+			i++
+		}
+	}
+	// The frame tag's inverse key frame flag
+	return len(payload) > i && payload[i]&0x01 == 0
+}
+
+func h264HasKeyframe(payload []byte) bool {
+	const (
+		nalIDR   = 5
+		nalSPS   = 7
+		nalSTAPA = 24
+		nalFUA   = 28
+	)
+	switch nal := payload[0] & 0x1f; nal {
+	case nalIDR, nalSPS:
+		return true
+	case nalSTAPA:
+		for i := 1; i+2 < len(payload); {
+			size := int(payload[i])<<8 | int(payload[i+1])
+			if t := payload[i+2] & 0x1f; t == nalIDR || t == nalSPS {
+				return true
+			}
+			i += 2 + size
+		}
+	case nalFUA:
+		// The fragment that starts an IDR slice
+		return len(payload) > 1 && payload[1]&0x80 != 0 && payload[1]&0x1f == nalIDR
+	}
+	return false
+}
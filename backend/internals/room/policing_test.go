@@ -0,0 +1,418 @@
+package room
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+// policingEvents records what a room reported about policing.
+type policingEvents struct {
+	mu       sync.Mutex
+	states   []BitratePolicing
+	rejected []string
+	removed  []string
+}
+
+func (e *policingEvents) watch(r *Room) {
+	r.OnBitratePolicing = func(_ *Room, _ *peer.Peer, s BitratePolicing) {
+		e.mu.Lock()
+		e.states = append(e.states, s)
+		e.mu.Unlock()
+	}
+	r.OnTrackRejected = func(_ *Room, _ *peer.Peer, trackID, reason string) {
+		e.mu.Lock()
+		e.rejected = append(e.rejected, trackID+" "+reason)
+		e.mu.Unlock()
+	}
+	r.OnTrackRemoved = func(_ *Room, _ *peer.Peer, mt *MediaTrack) {
+		e.mu.Lock()
+		e.removed = append(e.removed, mt.ID)
+		e.mu.Unlock()
+	}
+}
+
+func (e *policingEvents) last() (BitratePolicing, int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.states) == 0 {
+		return BitratePolicing{}, 0
+	}
+	return e.states[len(e.states)-1], len(e.states)
+}
+
+// packet is a delta frame of size bytes on the wire.
+func packet(size int, ts uint32) *rtp.Packet {
+	return &rtp.Packet{Header: rtp.Header{Version: 2, Timestamp: ts}, Payload: make([]byte, size-12)}
+}
+
+// feed passes bytes worth of 1000-byte packets through tp and returns how
+// many bytes were let through.
+func feed(tp *trackPolicing, bytes int) int {
+	forwarded := 0
+	for i := 0; i < bytes/1000; i++ {
+		if tp.forward(packet(1000, uint32(i))) {
+			forwarded += 1000
+		}
+	}
+	return forwarded
+}
+
+func trackIDs(r *Room) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var ids []string
+	for id := range r.MediaTracks {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func policingCount(action string) float64 {
+	return testutil.ToFloat64(appmetrics.BitratePolicingTotal.WithLabelValues(action))
+}
+
+func policedPackets(reason string) float64 {
+	return testutil.ToFloat64(appmetrics.BitratePolicedPacketsTotal.WithLabelValues(reason))
+}
+
+// policedRoom returns a room with alice publishing cam and mic under a
+// 1 Mbps cap, without the policing loop: the test drives checkBitrates.
+func policedRoom(t *testing.T, delay, removeAfter time.Duration) (*Room, *peer.Peer, *trackPolicing, *trackPolicing) {
+	t.Helper()
+	r := NewRoom("room-1", 10, zap.NewNop())
+	t.Cleanup(func() { r.Close() })
+	r.policingMu.Lock()
+	r.bitrateCap, r.policingDelay, r.policingRemoveAfter = 1_000_000, delay, removeAfter
+	r.policers = make(map[string]*bitratePolicer)
+	r.policingMu.Unlock()
+
+	alice := peer.NewPeer(r.ID, "alice", "", zap.NewNop())
+	if err := r.AddPeer(alice); err != nil {
+		t.Fatal(err)
+	}
+	cam := r.newTrackPolicing(alice, addTrack(r, "cam", alice.ID, "video"), "", &webrtc.TrackRemote{})
+	mic := r.newTrackPolicing(alice, addTrack(r, "mic", alice.ID, "audio"), "", &webrtc.TrackRemote{})
+	if cam == nil || mic == nil || cam.policer != mic.policer {
+		t.Fatal("tracks of one publisher do not share a policer")
+	}
+	return r, alice, cam, mic
+}
+
+func TestBitratePolicingEngagesAndReleases(t *testing.T) {
+	r, alice, cam, mic := policedRoom(t, 2*time.Second, 5*time.Second)
+	var events policingEvents
+	events.watch(r)
+	engaged, released := policingCount("engaged"), policingCount("released")
+	start := time.Now()
+	check := func(at time.Duration) { r.checkBitrates(start.Add(at), time.Second) }
+
+	// 2 Mbps is let through until it has lasted the delay
+	for _, at := range []time.Duration{0, time.Second} {
+		if n := feed(cam, 250_000); n != 250_000 {
+			t.Fatalf("%d of 250000 bytes forwarded before policing", n)
+		}
+		check(at)
+		if _, n := events.last(); n != 0 || cam.active() {
+			t.Fatalf("policing engaged %v into the overage", at)
+		}
+	}
+	feed(cam, 240_000)
+	feed(mic, 10_000)
+	check(2 * time.Second)
+	state, _ := events.last()
+	if !cam.active() || state != (BitratePolicing{Policing: true, BitrateKbps: 2000, CapKbps: 1000, RemoveIn: 5 * time.Second}) {
+		t.Fatalf("after 2s over the cap: policing %v, reported %+v", cam.active(), state)
+	}
+	if policingCount("engaged")-engaged != 1 {
+		t.Fatal("engaging not counted")
+	}
+
+	// Policed, video beyond the budget is dropped and audio never is
+	budget := policedPackets("budget")
+	if cam.forward(packet(1000, 1)) {
+		t.Fatal("a delta frame with no budget left was forwarded")
+	}
+	if policedPackets("budget")-budget != 1 {
+		t.Fatal("the dropped packet was not counted")
+	}
+	for i := 0; i < 50; i++ {
+		if !mic.forward(packet(200, uint32(i))) {
+			t.Fatal("audio was dropped")
+		}
+	}
+
+	// Back under the cap, policing ends and packets flow again
+	cam.bytes.Store(0)
+	mic.bytes.Store(0)
+	feed(cam, 100_000)
+	check(3 * time.Second)
+	state, n := events.last()
+	if cam.active() || state.Policing || n != 2 || state.BitrateKbps > 1000 {
+		t.Fatalf("under the cap: policing %v, reported %+v", cam.active(), state)
+	}
+	if policingCount("released")-released != 1 {
+		t.Fatal("release not counted")
+	}
+	if got := feed(cam, 250_000); got != 250_000 {
+		t.Fatalf("%d of 250000 bytes forwarded after policing ended", got)
+	}
+	if _, ok := r.GetPeer(alice.ID); !ok || len(trackIDs(r)) != 2 {
+		t.Fatal("policing removed something without removeAfter elapsing")
+	}
+
+	// A new overage waits out the delay again
+	for _, at := range []time.Duration{4 * time.Second, 5 * time.Second, 6 * time.Second} {
+		feed(cam, 250_000)
+		check(at)
+		if want := at == 6*time.Second; cam.active() != want {
+			t.Fatalf("policing %v at %v, want %v", cam.active(), at, want)
+		}
+	}
+}
+
+func TestBitratePolicingRemovesBusiestTrack(t *testing.T) {
+	r, alice, cam, mic := policedRoom(t, 0, 3*time.Second)
+	var events policingEvents
+	events.watch(r)
+	removals := policingCount("track_removed")
+	start := time.Now()
+
+	// Over the cap from the first check, until removeAfter has passed
+	for i := 0; i <= 3; i++ {
+		feed(cam, 300_000)
+		feed(mic, 20_000)
+		r.checkBitrates(start.Add(time.Duration(i)*time.Second), time.Second)
+		if i < 3 && len(trackIDs(r)) != 2 {
+			t.Fatalf("a track was removed %ds into policing", i)
+		}
+	}
+	events.mu.Lock()
+	rejected, removed := events.rejected, events.removed
+	events.mu.Unlock()
+	if len(rejected) != 1 || rejected[0] != "cam "+RejectBitrateCapExceeded || len(removed) != 1 || removed[0] != "cam" {
+		t.Fatalf("rejected %v, removed %v; want cam", rejected, removed)
+	}
+	if tracks := trackIDs(r); len(tracks) != 1 || tracks[0] != "mic" {
+		t.Fatalf("tracks left %v, want the mic", tracks)
+	}
+	if policingCount("track_removed")-removals != 1 {
+		t.Fatal("removal not counted")
+	}
+
+	// The removed track's counter goes, and a departed publisher's policer
+	r.checkBitrates(start.Add(4*time.Second), time.Second)
+	cam.policer.mu.Lock()
+	_, counted := cam.policer.tracks["cam"]
+	cam.policer.mu.Unlock()
+	if counted {
+		t.Fatal("the removed track is still measured")
+	}
+	r.RemovePeer(alice.ID)
+	r.checkBitrates(start.Add(5*time.Second), time.Second)
+	r.policingMu.Lock()
+	defer r.policingMu.Unlock()
+	if len(r.policers) != 0 {
+		t.Fatal("the policer outlived its publisher")
+	}
+}
+
+func TestPolicedSimulcastKeepsLowestLayer(t *testing.T) {
+	r, alice, _, _ := policedRoom(t, 0, 0)
+	mt := addTrack(r, "screen", alice.ID, "video", "q", "h", "f")
+	layers := make(map[string]*trackPolicing)
+	for _, rid := range []string{"q", "h", "f"} {
+		mt.Layers[rid].Track = &webrtc.TrackRemote{}
+		layers[rid] = r.newTrackPolicing(alice, mt, rid, mt.Layers[rid].Track)
+	}
+	feed(layers["f"], 500_000)
+	r.checkBitrates(time.Now(), time.Second)
+	if !layers["q"].active() {
+		t.Fatal("not policing at 4 Mbps")
+	}
+	dropped := policedPackets("layer")
+	layers["q"].policer.mu.Lock()
+	layers["q"].policer.refilled = time.Now().Add(-time.Second)
+	layers["q"].policer.mu.Unlock()
+	if layers["f"].forward(packet(1000, 1)) || layers["h"].forward(packet(1000, 1)) {
+		t.Fatal("an upper layer was forwarded while policing")
+	}
+	if !layers["q"].forward(packet(1000, 1)) {
+		t.Fatal("the lowest layer was dropped with budget left")
+	}
+	if policedPackets("layer")-dropped != 2 {
+		t.Fatal("dropped layers not counted")
+	}
+}
+
+func TestPolicingBudget(t *testing.T) {
+	b := &bitratePolicer{capBytes: 100_000}
+	now := time.Now()
+	b.refilled = now
+
+	if b.spend(1000, false) {
+		t.Fatal("spent an empty budget")
+	}
+	// 20ms at the cap refills 2000 bytes
+	b.refilled = time.Now().Add(-20 * time.Millisecond)
+	if !b.spend(1000, false) || !b.spend(1000, false) || b.spend(1000, false) {
+		t.Fatal("budget does not follow the cap")
+	}
+	// Idle time banks no more than the burst
+	b.refilled = time.Now().Add(-time.Minute)
+	b.spend(0, false)
+	if max := b.capBytes * policingBurst.Seconds(); b.tokens > max {
+		t.Fatalf("%v bytes banked, burst is %v", b.tokens, max)
+	}
+	// A forced keyframe goes into debt, at most a second of the cap
+	if !b.spend(1_000_000, true) || b.tokens < -b.capBytes {
+		t.Fatalf("forced spend left %v bytes", b.tokens)
+	}
+	if b.spend(1, false) {
+		t.Fatal("spent while in debt")
+	}
+}
+
+func TestPolicingLetsKeyframesThrough(t *testing.T) {
+	r, _, cam, _ := policedRoom(t, 0, 0)
+	cam.codec = webrtc.MimeTypeVP8
+	feed(cam, 300_000)
+	r.checkBitrates(time.Now(), time.Second)
+	if !cam.active() {
+		t.Fatal("not policing")
+	}
+	key := packet(1000, 90_000)
+	key.Payload[0], key.Payload[1] = 0x10, 0x00 // S=1, keyframe
+	rest := packet(1000, 90_000)
+	if !cam.forward(key) || !cam.forward(rest) {
+		t.Fatal("a keyframe was dropped")
+	}
+	if cam.forward(packet(1000, 93_000)) {
+		t.Fatal("the frame after the keyframe was forwarded in debt")
+	}
+}
+
+func TestKeyframeStart(t *testing.T) {
+	for _, tc := range []struct {
+		codec   string
+		payload []byte
+		want    bool
+	}{
+		{"video/VP8", []byte{0x10, 0x00}, true},
+		{"video/VP8", []byte{0x10, 0x01}, false},                                           // inter frame
+		{"video/VP8", []byte{0x00, 0x00}, false},                                           // not the start of a partition
+		{"video/VP8", []byte{0x90, 0x80, 0x81, 0x02, 0x00}, true},                          // two-byte PictureID
+		{"video/VP8", []byte{0x90, 0xe0, 0x05, 0x01, 0x20, 0x00}, true},                    // PictureID, TL0PICIDX, TID
+		{"video/VP8", []byte{0x90, 0x80, 0x81}, false},                                     // truncated
+		{"video/VP9", []byte{0x08}, true},                                                  // B set, P clear
+		{"video/VP9", []byte{0x48}, false},                                                 // inter-predicted
+		{"video/H264", []byte{0x65}, true},                                                 // IDR
+		{"video/H264", []byte{0x67}, true},                                                 // SPS
+		{"video/H264", []byte{0x41}, false},                                                // non-IDR slice
+		{"video/H264", []byte{0x78, 0x00, 0x02, 0x09, 0x10, 0x00, 0x02, 0x67, 0x42}, true}, // STAP-A with SPS
+		{"video/H264", []byte{0x7c, 0x85}, true},                                           // FU-A starting an IDR
+		{"video/H264", []byte{0x7c, 0x05}, false},                                          // FU-A continuing it
+		{"video/AV1", []byte{0x10}, false},
+		{"video/VP8", nil, false},
+	} {
+		if got := isKeyframeStart(tc.codec, tc.payload); got != tc.want {
+			t.Errorf("%s %x: keyframe %v, want %v", tc.codec, tc.payload, got, tc.want)
+		}
+	}
+}
+
+// A publisher sending twice the cap is policed down to it within the
+// policing loop's checks, and let go once it slows down.
+func TestBitratePolicingLoop(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs for seconds")
+	}
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	var events policingEvents
+	events.watch(r)
+	r.SetBitratePolicing(800, 0, 0)
+	alice := peer.NewPeer(r.ID, "alice", "", zap.NewNop())
+	if err := r.AddPeer(alice); err != nil {
+		t.Fatal(err)
+	}
+	cam := r.newTrackPolicing(alice, addTrack(r, "cam", alice.ID, "video"), "", &webrtc.TrackRemote{})
+
+	// A synthetic source pacing 1000-byte packets at rate bits per second
+	var mu sync.Mutex
+	rate := 1_600_000
+	var sent, forwarded int
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		owed := 0.0
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			mu.Lock()
+			owed += float64(rate) / 8 * 0.005
+			for ; owed >= 1000; owed -= 1000 {
+				sent += 1000
+				if cam.forward(packet(1000, uint32(sent))) {
+					forwarded += 1000
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+	defer func() { close(stop); <-done }()
+
+	wait := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	wait("policing to engage", func() bool { s, _ := events.last(); return s.Policing })
+	if s, _ := events.last(); s.CapKbps != 800 || s.BitrateKbps < 1200 {
+		t.Fatalf("engaged with %+v", s)
+	}
+
+	// Policed, about the cap gets through
+	mu.Lock()
+	sent, forwarded = 0, 0
+	mu.Unlock()
+	window := time.Now()
+	time.Sleep(500 * time.Millisecond)
+	mu.Lock()
+	elapsed := time.Since(window).Seconds()
+	sentKbps, forwardedKbps := float64(sent*8)/elapsed/1000, float64(forwarded*8)/elapsed/1000
+	rate = 200_000
+	mu.Unlock()
+	if s, _ := events.last(); s.Policing && forwardedKbps > 800*1.2 {
+		t.Fatalf("%.0f of %.0f kbps forwarded while policed at 800", forwardedKbps, sentKbps)
+	}
+
+	wait("policing to be released", func() bool { s, n := events.last(); return n >= 2 && !s.Policing })
+	mu.Lock()
+	sent, forwarded = 0, 0
+	mu.Unlock()
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if forwarded != sent {
+		t.Fatalf("%d of %d bytes forwarded after release", forwarded, sent)
+	}
+}
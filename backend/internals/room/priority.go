@@ -0,0 +1,396 @@
+package room
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+)
+
+// Track priorities let a room steer simulcast layer selection for every
+// subscriber, e.g. keep a webinar presenter on the top layer while attendee
+// thumbnails stay on the lowest one. A priority is keyed by publisher peer ID
+// (covering all of its tracks) or by track handle, which takes precedence.
+// Positive values are favoured, negative values demoted, and 0 clears the
+// entry.
+//
+// Priorities decide the default layer of new subscriptions and, for
+// subscribers with a bandwidth limit, the order in which the layer allocator
+// hands out upgrades: higher tiers are fully upgraded before lower ones get
+// anything above their lowest layer, so under a shrinking budget the lowest
+// tiers are the first to be downgraded.
+
+// nominalLayerBitrates estimates the bitrate of common simulcast RIDs for
+// budget allocation.
+var nominalLayerBitrates = map[string]uint64{
+	"q": 150_000,
+	"h": 500_000,
+	"f": 1_500_000,
+}
+
+// defaultLayerBitrate is assumed for RIDs without a nominal bitrate.
+const defaultLayerBitrate = 500_000
+
+func layerBitrate(rid string) uint64 {
+	if bps, ok := nominalLayerBitrates[rid]; ok {
+		return bps
+	}
+	return defaultLayerBitrate
+}
+
+// sortLayers orders RIDs from lowest to highest quality.
+func sortLayers(rids []string) {
+	sort.Slice(rids, func(i, j int) bool {
+		bi, bj := layerBitrate(rids[i]), layerBitrate(rids[j])
+		if bi != bj {
+			return bi < bj
+		}
+		return rids[i] < rids[j]
+	})
+}
+
+// layerCandidate is one simulcast track competing for a subscriber's budget.
+type layerCandidate struct {
+	Handle   string
+	Priority int
+	Layers   []string // lowest to highest quality
+}
+
+// allocateLayers picks a layer for each candidate within budget bits per
+// second (0 = unlimited). Every candidate gets at least its lowest layer;
+// upgrades go one step at a time, round-robin within a priority tier, and
+// the next lower tier only gets any once a tier is on its top layers.
+func allocateLayers(budget uint64, candidates []layerCandidate) map[string]string {
+	result := make(map[string]string, len(candidates))
+	if len(candidates) == 0 {
+		return result
+	}
+
+	cands := make([]layerCandidate, len(candidates))
+	copy(cands, candidates)
+	sort.SliceStable(cands, func(i, j int) bool {
+		if cands[i].Priority != cands[j].Priority {
+			return cands[i].Priority > cands[j].Priority
+		}
+		return cands[i].Handle < cands[j].Handle
+	})
+
+	level := make([]int, len(cands))
+	var used uint64
+	for _, c := range cands {
+		if len(c.Layers) > 0 {
+			used += layerBitrate(c.Layers[0])
+		}
+	}
+
+tiers:
+	for start := 0; start < len(cands); {
+		end := start
+		for end < len(cands) && cands[end].Priority == cands[start].Priority {
+			end++
+		}
+		for upgraded := true; upgraded; {
+			upgraded = false
+			for i := start; i < end; i++ {
+				layers := cands[i].Layers
+				if level[i]+1 >= len(layers) {
+					continue
+				}
+				cost := layerBitrate(layers[level[i]+1]) - layerBitrate(layers[level[i]])
+				if budget > 0 && used+cost > budget {
+					continue
+				}
+				level[i]++
+				used += cost
+				upgraded = true
+			}
+		}
+		// What a tier short of its top layers leaves over is not handed
+		// down, or a lower tier could gain a layer as the budget shrinks
+		for i := start; i < end; i++ {
+			if level[i]+1 < len(cands[i].Layers) {
+				break tiers
+			}
+		}
+		start = end
+	}
+
+	for i, c := range cands {
+		if len(c.Layers) > 0 {
+			result[c.Handle] = c.Layers[level[i]]
+		}
+	}
+	return result
+}
+
+// SetTrackPriorities updates the room's priorities. Keys must name a peer in
+// the room or a track handle (raw track IDs are accepted and normalised). With
+// replace, entries not in priorities are cleared. Returns the resulting map.
+func (r *Room) SetTrackPriorities(priorities map[string]int, replace bool) (map[string]int, error) {
+	r.mu.RLock()
+	resolved := make(map[string]int, len(priorities))
+	for key, prio := range priorities {
+		if _, ok := r.Peers[key]; ok {
+			resolved[key] = prio
+			continue
+		}
+		mt, ok := r.resolveTrackLocked(key)
+		if !ok {
+			r.mu.RUnlock()
+			return nil, fmt.Errorf("unknown peer or track: %s", key)
+		}
+		resolved[mt.Handle] = prio
+	}
+	r.mu.RUnlock()
+
+	r.prioMu.Lock()
+	if replace || r.priorities == nil {
+		r.priorities = make(map[string]int, len(resolved))
+	}
+	for key, prio := range resolved {
+		if prio == 0 {
+			delete(r.priorities, key)
+		} else {
+			r.priorities[key] = prio
+		}
+	}
+	r.prioMu.Unlock()
+
+	r.ReallocateLayers()
+	return r.GetTrackPriorities(), nil
+}
+
+// GetTrackPriorities returns a copy of the room's priorities.
+func (r *Room) GetTrackPriorities() map[string]int {
+	r.prioMu.RLock()
+	defer r.prioMu.RUnlock()
+	out := make(map[string]int, len(r.priorities))
+	for key, prio := range r.priorities {
+		out[key] = prio
+	}
+	return out
+}
+
+// UserPriorities returns the room's peer priorities keyed by the peers' user
+// IDs, including restored ones whose user has not rejoined yet. Track handle
+// entries are left out: a handle does not outlive its track.
+func (r *Room) UserPriorities() map[string]int {
+	r.mu.RLock()
+	users := make(map[string]string, len(r.Peers))
+	for id, p := range r.Peers {
+		users[id] = p.UserID
+	}
+	r.mu.RUnlock()
+
+	r.prioMu.RLock()
+	defer r.prioMu.RUnlock()
+	out := make(map[string]int, len(r.userPriorities))
+	for userID, prio := range r.userPriorities {
+		out[userID] = prio
+	}
+	for key, prio := range r.priorities {
+		if userID, ok := users[key]; ok {
+			out[userID] = prio
+		}
+	}
+	return out
+}
+
+// RestoreUserPriorities sets priorities by user ID for a room recreated from
+// a snapshot. Each becomes the priority of the user's peer when it joins.
+func (r *Room) RestoreUserPriorities(byUser map[string]int) {
+	r.prioMu.Lock()
+	defer r.prioMu.Unlock()
+	r.userPriorities = make(map[string]int, len(byUser))
+	for userID, prio := range byUser {
+		if prio != 0 {
+			r.userPriorities[userID] = prio
+		}
+	}
+}
+
+// applyUserPriority moves a restored priority of p's user onto p.
+// MUST be called with r.mu held.
+func (r *Room) applyUserPriority(p *peer.Peer) {
+	r.prioMu.Lock()
+	defer r.prioMu.Unlock()
+	prio, ok := r.userPriorities[p.UserID]
+	if !ok {
+		return
+	}
+	delete(r.userPriorities, p.UserID)
+	if r.priorities == nil {
+		r.priorities = make(map[string]int)
+	}
+	r.priorities[p.ID] = prio
+}
+
+// trackPriority returns the effective priority of mt. The spotlighted
+// participant's video outranks any set priority (see spotlight.go).
+func (r *Room) trackPriority(mt *MediaTrack) int {
+	r.prioMu.RLock()
+	defer r.prioMu.RUnlock()
+	if mt.PeerID != "" && mt.PeerID == r.spotlight.peerID && mt.Kind == "video" {
+		return SpotlightPriority
+	}
+	if prio, ok := r.priorities[mt.Handle]; ok {
+		return prio
+	}
+	return r.priorities[mt.PeerID]
+}
+
+// dropPriorities clears entries for a departed peer and its tracks and
+// reallocates layers if anything changed.
+func (r *Room) dropPriorities(peerID string, tracks []*MediaTrack) {
+	r.prioMu.Lock()
+	n := len(r.priorities)
+	delete(r.priorities, peerID)
+	for _, mt := range tracks {
+		delete(r.priorities, mt.Handle)
+	}
+	changed := len(r.priorities) != n
+	r.prioMu.Unlock()
+
+	if changed {
+		r.ReallocateLayers()
+	}
+}
+
+// defaultLayer picks the layer peerID's new subscription to mt starts on,
+// among those within its receive preference: the top layer for favoured
+// tracks, the lowest for demoted ones, and otherwise "h" when available.
+func (r *Room) defaultLayer(mt *MediaTrack, peerID string) string {
+	mt.mu.RLock()
+	rids := make([]string, 0, len(mt.Layers))
+	for rid := range mt.Layers {
+		rids = append(rids, rid)
+	}
+	mt.mu.RUnlock()
+	if len(rids) == 0 {
+		return "h"
+	}
+	sortLayers(rids)
+
+	switch prio := r.trackPriority(mt); {
+	case prio > 0:
+		return rids[len(rids)-1]
+	case prio < 0:
+		return rids[0]
+	}
+	for _, rid := range rids {
+		if rid == "h" {
+			return rid
+		}
+	}
+	return rids[0]
+}
+
+// ReallocateLayers re-runs layer selection for every peer in the room.
+func (r *Room) ReallocateLayers() {
+	r.mu.RLock()
+	peerIDs := make([]string, 0, len(r.Peers))
+	for id := range r.Peers {
+		peerIDs = append(peerIDs, id)
+	}
+	r.mu.RUnlock()
+
+	for _, id := range peerIDs {
+		r.AllocateLayers(id)
+	}
+}
+
+// AllocateLayers selects simulcast layers for everything peerID receives and
+// switches the ones that changed, returning handle -> new RID. Subscribers
+// with a bandwidth limit are allocated within it by priority; without one,
+// only prioritised tracks are moved (favoured up, demoted down) so manual
+// layer switches on other tracks are left alone. Congested subscriptions
+// rank below everything else, so they are the first to be downgraded, and
+// no track is given a layer above the subscriber's receive preference.
+func (r *Room) AllocateLayers(peerID string) map[string]string {
+	r.mu.RLock()
+	p, ok := r.Peers[peerID]
+	tracks := make([]*MediaTrack, 0, len(r.MediaTracks))
+	for _, mt := range r.MediaTracks {
+		if mt.IsSimulcast && mt.PeerID != peerID {
+			tracks = append(tracks, mt)
+		}
+	}
+	r.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	budget := uint64(p.GetBandwidthLimit())
+
+	byHandle := make(map[string]*MediaTrack, len(tracks))
+	current := make(map[string]string, len(tracks))
+	candidates := make([]layerCandidate, 0, len(tracks))
+	overCap := make(map[string]string)
+	for _, mt := range tracks {
+		mt.mu.RLock()
+		sub, subscribed := mt.Subscribers[peerID]
+		rids := make([]string, 0, len(mt.Layers))
+		for rid, layer := range mt.Layers {
+			if layer.Active {
+				rids = append(rids, rid)
+			}
+		}
+		congested := false
+		if subscribed {
+			current[mt.Handle] = mt.wantedLayerLocked(sub)
+			congested = sub.Congested()
+		}
+		mt.mu.RUnlock()
+		if !subscribed || len(rids) == 0 {
+			continue
+		}
+
+		prio := r.trackPriority(mt)
+		if congested {
+			prio = congestedPriority
+		}
+		sortLayers(rids)
+		pref, capped := r.receivePreference(peerID, mt)
+		if capped {
+			rids = capLayers(rids, pref)
+		}
+		if budget == 0 && prio == 0 {
+			// Left alone unless above the subscriber's cap, then moved to
+			// the best layer within it
+			if capped && !layerFits(pref, current[mt.Handle]) {
+				byHandle[mt.Handle] = mt
+				overCap[mt.Handle] = rids[len(rids)-1]
+			}
+			continue
+		}
+		byHandle[mt.Handle] = mt
+		candidates = append(candidates, layerCandidate{Handle: mt.Handle, Priority: prio, Layers: rids})
+	}
+
+	var target map[string]string
+	if budget > 0 {
+		target = allocateLayers(budget, candidates)
+	} else {
+		target = make(map[string]string, len(candidates))
+		for _, c := range candidates {
+			if c.Priority > 0 {
+				target[c.Handle] = c.Layers[len(c.Layers)-1]
+			} else {
+				target[c.Handle] = c.Layers[0]
+			}
+		}
+	}
+	for handle, rid := range overCap {
+		target[handle] = rid
+	}
+
+	changed := make(map[string]string)
+	for handle, rid := range target {
+		if current[handle] == rid {
+			continue
+		}
+		if err := r.switchSubscriberLayer(byHandle[handle], peerID, rid); err == nil {
+			changed[handle] = rid
+		}
+	}
+	return changed
+}
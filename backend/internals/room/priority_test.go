@@ -0,0 +1,161 @@
+package room
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+var qhf = []string{"q", "h", "f"}
+
+func TestAllocateLayers(t *testing.T) {
+	webinar := []layerCandidate{
+		{Handle: "attendee-1", Priority: 0, Layers: qhf},
+		{Handle: "presenter", Priority: 10, Layers: qhf},
+		{Handle: "attendee-2", Priority: -1, Layers: qhf},
+	}
+	const lowest = 3 * 150_000 // every track on q
+
+	for _, tc := range []struct {
+		name       string
+		budget     uint64
+		candidates []layerCandidate
+		want       map[string]string
+	}{
+		{"unlimited", 0, webinar, map[string]string{"presenter": "f", "attendee-1": "f", "attendee-2": "f"}},
+		{"below the lowest layers", 100_000, webinar, map[string]string{"presenter": "q", "attendee-1": "q", "attendee-2": "q"}},
+		{"lowest layers only", lowest, webinar, map[string]string{"presenter": "q", "attendee-1": "q", "attendee-2": "q"}},
+		{"presenter half way", lowest + 350_000, webinar, map[string]string{"presenter": "h", "attendee-1": "q", "attendee-2": "q"}},
+		{"presenter short of f", lowest + 1_349_999, webinar, map[string]string{"presenter": "h", "attendee-1": "q", "attendee-2": "q"}},
+		{"presenter on f", lowest + 1_350_000, webinar, map[string]string{"presenter": "f", "attendee-1": "q", "attendee-2": "q"}},
+		{"next tier upgraded", lowest + 1_700_000, webinar, map[string]string{"presenter": "f", "attendee-1": "h", "attendee-2": "q"}},
+		{"next tier short of f", lowest + 2_699_999, webinar, map[string]string{"presenter": "f", "attendee-1": "h", "attendee-2": "q"}},
+		{"demoted tier last", lowest + 3_050_000, webinar, map[string]string{"presenter": "f", "attendee-1": "f", "attendee-2": "h"}},
+		{
+			// A tier is upgraded a step at a time, in handle order
+			"round robin in a tier", 300_000 + 350_000,
+			[]layerCandidate{{Handle: "b", Layers: qhf}, {Handle: "a", Layers: qhf}},
+			map[string]string{"a": "h", "b": "q"},
+		},
+		{
+			"both a step up", 300_000 + 700_000,
+			[]layerCandidate{{Handle: "b", Layers: qhf}, {Handle: "a", Layers: qhf}},
+			map[string]string{"a": "h", "b": "h"},
+		},
+		{
+			"no layers", 0,
+			[]layerCandidate{{Handle: "a", Layers: []string{"q", "h"}}, {Handle: "none"}},
+			map[string]string{"a": "h"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := allocateLayers(tc.budget, tc.candidates); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("allocateLayers(%d) = %v, want %v", tc.budget, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAllocateLayersShrinkingBudget(t *testing.T) {
+	candidates := []layerCandidate{
+		{Handle: "high", Priority: 5, Layers: qhf},
+		{Handle: "mid", Priority: 0, Layers: qhf},
+		{Handle: "low", Priority: -5, Layers: qhf},
+	}
+	rank := map[string]int{"q": 0, "h": 1, "f": 2}
+	prev := map[string]string{"high": "f", "mid": "f", "low": "f"}
+	for budget := uint64(5_000_000); budget >= 450_000; budget -= 50_000 {
+		got := allocateLayers(budget, candidates)
+		// A tier only gives up layers once every tier below it is at its
+		// lowest layer
+		for i, c := range candidates {
+			if got[c.Handle] == "f" {
+				continue
+			}
+			for _, lower := range candidates[i+1:] {
+				if got[lower.Handle] != "q" {
+					t.Fatalf("budget %d: %s on %s while %s is on %s", budget, c.Handle, got[c.Handle], lower.Handle, got[lower.Handle])
+				}
+			}
+		}
+		// Less budget never upgrades anything
+		for handle, rid := range got {
+			if rank[rid] > rank[prev[handle]] {
+				t.Fatalf("budget %d: %s went up from %s to %s", budget, handle, prev[handle], rid)
+			}
+		}
+		prev = got
+	}
+	if fmt.Sprint(prev) != fmt.Sprint(map[string]string{"high": "q", "mid": "q", "low": "q"}) {
+		t.Fatalf("at the lowest budget: %v", prev)
+	}
+}
+
+func TestTrackPriorities(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	presenter := peer.NewPeer(r.ID, "presenter", "", zap.NewNop())
+	attendee := peer.NewPeer(r.ID, "attendee", "", zap.NewNop())
+	for _, p := range []*peer.Peer{presenter, attendee} {
+		if err := r.AddPeer(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stage := addTrack(r, "stage-cam", presenter.ID, "video", qhf...)
+	thumb := addTrack(r, "attendee-cam", attendee.ID, "video", qhf...)
+
+	// A peer covers its tracks; a raw track ID is stored by handle
+	got, err := r.SetTrackPriorities(map[string]int{presenter.ID: 10, "attendee-cam": -1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{presenter.ID: 10, thumb.Handle: -1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("priorities %v, want %v", got, want)
+	}
+	if l := r.defaultLayer(stage, "viewer"); l != "f" {
+		t.Errorf("presenter's default layer %s, want f", l)
+	}
+	if l := r.defaultLayer(thumb, "viewer"); l != "q" {
+		t.Errorf("attendee's default layer %s, want q", l)
+	}
+
+	// A handle outranks its peer's entry
+	if _, err := r.SetTrackPriorities(map[string]int{stage.Handle: -5}, false); err != nil {
+		t.Fatal(err)
+	}
+	if prio := r.trackPriority(stage); prio != -5 {
+		t.Errorf("stage priority %d, want the handle's -5", prio)
+	}
+
+	if _, err := r.SetTrackPriorities(map[string]int{"nobody": 1, stage.Handle: 0}, false); err == nil {
+		t.Fatal("unknown key accepted")
+	}
+	if got := r.GetTrackPriorities(); len(got) != 3 {
+		t.Fatalf("a rejected update changed the priorities: %v", got)
+	}
+
+	// 0 clears an entry, replace clears the rest
+	if got, _ := r.SetTrackPriorities(map[string]int{stage.Handle: 0}, false); len(got) != 2 {
+		t.Fatalf("after clearing the handle: %v", got)
+	}
+	if got, _ := r.SetTrackPriorities(map[string]int{attendee.ID: 3}, true); !reflect.DeepEqual(got, map[string]int{attendee.ID: 3}) {
+		t.Fatalf("after replace: %v", got)
+	}
+
+	// The entries go with the peer
+	if _, err := r.SetTrackPriorities(map[string]int{"attendee-cam": 2}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RemovePeer(attendee.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.GetTrackPriorities(); len(got) != 0 {
+		t.Fatalf("priorities %v outlived the attendee", got)
+	}
+	if l := r.defaultLayer(stage, "viewer"); l != "h" {
+		t.Errorf("default layer without a priority %s, want h", l)
+	}
+}
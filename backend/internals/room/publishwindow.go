@@ -0,0 +1,36 @@
+package room
+
+import (
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+// StopPublishing removes every track p publishes, as if p had unpublished
+// them, and has tracks it publishes from now on rejected with
+// RejectPublisherRoleRequired. It returns the removed tracks' handles.
+func (r *Room) StopPublishing(p *peer.Peer) []string {
+	p.RevokePublish()
+
+	r.mu.RLock()
+	var tracks []*MediaTrack
+	for _, mt := range r.MediaTracks {
+		if mt.PeerID == p.ID {
+			tracks = append(tracks, mt)
+		}
+	}
+	r.mu.RUnlock()
+
+	removed := make([]string, 0, len(tracks))
+	for _, mt := range tracks {
+		removed = append(removed, mt.Handle)
+		r.removeTrack(p, mt)
+	}
+	if len(removed) > 0 {
+		r.logger.Info("Stopped peer publishing",
+			zap.String("roomID", r.ID),
+			zap.String("peerID", p.ID),
+			zap.Int("tracks", len(removed)),
+		)
+	}
+	return removed
+}
@@ -0,0 +1,98 @@
+package room
+
+import (
+	"maps"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+)
+
+// Every stats tick condenses the per-peer quality of the room into one
+// summary for dashboards. Only the peers that report quality are sampled, so
+// a broadcast room's summary covers its sampled viewers. Observers are left
+// out, as are peers connected for less than qualityWarmup, whose loss is
+// measured over too few packets to mean anything.
+
+const qualityWarmup = 5 * time.Second
+
+var qualityLevels = []string{"excellent", "good", "poor", "critical"}
+
+// QualitySummary is the connection quality of a room's participants.
+type QualitySummary struct {
+	Peers           int            `json:"peers"`         // participants counted
+	Levels          map[string]int `json:"levels"`        // participants per quality level
+	PoorPercent     float64        `json:"poorPercent"`   // share at poor or critical
+	AvgPacketLoss   float64        `json:"avgPacketLoss"` // percentage
+	WorstPeerID     string         `json:"worstPeerId,omitempty"`
+	WorstPacketLoss float64        `json:"worstPacketLoss"` // percentage
+	UpdatedAt       time.Time      `json:"updatedAt"`
+}
+
+// peerQualitySample is the quality of one counted participant.
+type peerQualitySample struct {
+	peerID string
+	PeerQuality
+}
+
+func summarizeQuality(samples []peerQualitySample, now time.Time) QualitySummary {
+	s := QualitySummary{Levels: make(map[string]int, len(qualityLevels)), UpdatedAt: now}
+	for _, level := range qualityLevels {
+		s.Levels[level] = 0
+	}
+
+	var totalLoss float64
+	for _, q := range samples {
+		s.Peers++
+		s.Levels[q.Level]++
+		totalLoss += q.PacketLoss
+		if q.PacketLoss > s.WorstPacketLoss {
+			s.WorstPeerID, s.WorstPacketLoss = q.peerID, q.PacketLoss
+		}
+	}
+	if s.Peers > 0 {
+		s.AvgPacketLoss = totalLoss / float64(s.Peers)
+		s.PoorPercent = float64(s.Levels["poor"]+s.Levels["critical"]) / float64(s.Peers) * 100
+	}
+	return s
+}
+
+// countsQuality reports whether p belongs in the room's quality summary.
+func countsQuality(p *peer.Peer, now time.Time) bool {
+	if p.Observer {
+		return false
+	}
+	since := p.ConnectedSince()
+	return !since.IsZero() && now.Sub(since) >= qualityWarmup
+}
+
+// updateQualitySummary replaces the room's summary with one of samples and
+// calls OnQualitySummary when the number of peers at a level changed.
+func (r *Room) updateQualitySummary(samples []peerQualitySample) {
+	summary := summarizeQuality(samples, time.Now())
+	r.recordQualitySamples(samples)
+
+	r.mu.Lock()
+	changed := !maps.Equal(r.quality.Levels, summary.Levels)
+	r.quality = summary
+	r.mu.Unlock()
+
+	r.renegotiationMu.Lock()
+	if r.roomMetrics {
+		appmetrics.SetRoomQuality(r.ID, summary.Levels, summary.PoorPercent)
+	}
+	r.renegotiationMu.Unlock()
+
+	if changed && r.OnQualitySummary != nil && !r.silenced() {
+		r.OnQualitySummary(r, summary)
+	}
+}
+
+// GetQualitySummary returns the room's latest quality summary.
+func (r *Room) GetQualitySummary() QualitySummary {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	summary := r.quality
+	summary.Levels = maps.Clone(summary.Levels)
+	return summary
+}
@@ -0,0 +1,152 @@
+package room
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func sample(peerID, level string, loss float64) peerQualitySample {
+	return peerQualitySample{peerID: peerID, PeerQuality: PeerQuality{Level: level, PacketLoss: loss}}
+}
+
+func TestSummarizeQuality(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		name    string
+		samples []peerQualitySample
+		want    QualitySummary
+	}{
+		{
+			name: "empty",
+			want: QualitySummary{Levels: map[string]int{"excellent": 0, "good": 0, "poor": 0, "critical": 0}},
+		},
+		{
+			name: "mixed",
+			samples: []peerQualitySample{
+				sample("a", "excellent", 0),
+				sample("b", "good", 2),
+				sample("c", "poor", 6),
+				sample("d", "critical", 20),
+				sample("e", "poor", 8),
+			},
+			want: QualitySummary{
+				Peers:           5,
+				Levels:          map[string]int{"excellent": 1, "good": 1, "poor": 2, "critical": 1},
+				PoorPercent:     60,
+				AvgPacketLoss:   7.2,
+				WorstPeerID:     "d",
+				WorstPacketLoss: 20,
+			},
+		},
+		{
+			name:    "no loss",
+			samples: []peerQualitySample{sample("a", "excellent", 0), sample("b", "excellent", 0)},
+			want: QualitySummary{
+				Peers:  2,
+				Levels: map[string]int{"excellent": 2, "good": 0, "poor": 0, "critical": 0},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := summarizeQuality(tc.samples, now)
+			tc.want.UpdatedAt = now
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("summary %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCountsQuality(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	link := newLink(t)
+	connected := func(userID string, observer bool) *peer.Peer {
+		p := peer.NewPeer(r.ID, userID, "", zap.NewNop())
+		p.Observer = observer
+		if err := r.AddPeer(p); err != nil {
+			t.Fatal(err)
+		}
+		connectData(t, p, link)
+		deadline := time.Now().Add(10 * time.Second)
+		for !p.IsConnected() {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s did not connect", userID)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return p
+	}
+	alice, hidden := connected("alice", false), connected("observer", true)
+	pending := peer.NewPeer(r.ID, "bob", "", zap.NewNop())
+
+	// Peers are counted once connected for the warm-up, observers never
+	now := time.Now()
+	for _, tc := range []struct {
+		p    *peer.Peer
+		at   time.Time
+		want bool
+	}{
+		{alice, now, false},
+		{alice, alice.ConnectedSince().Add(qualityWarmup), true},
+		{hidden, hidden.ConnectedSince().Add(qualityWarmup), false},
+		{pending, now.Add(qualityWarmup), false},
+	} {
+		if got := countsQuality(tc.p, tc.at); got != tc.want {
+			t.Errorf("%s counted %v %v after connecting, want %v", tc.p.UserID, got, tc.at.Sub(tc.p.ConnectedSince()), tc.want)
+		}
+	}
+}
+
+func TestQualitySummaryUpdates(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	r.SetRoomMetrics(true)
+	var summaries []QualitySummary
+	r.OnQualitySummary = func(_ *Room, s QualitySummary) { summaries = append(summaries, s) }
+	gauge := func(level string) float64 {
+		return testutil.ToFloat64(appmetrics.RoomQualityPeers.WithLabelValues(r.ID, level))
+	}
+
+	r.updateQualitySummary([]peerQualitySample{sample("a", "good", 1), sample("b", "poor", 6)})
+	got := r.GetQualitySummary()
+	if got.Peers != 2 || got.PoorPercent != 50 || got.WorstPeerID != "b" {
+		t.Fatalf("summary %+v", got)
+	}
+	if stats := r.GetStats().Quality; !reflect.DeepEqual(stats, got) {
+		t.Fatalf("room stats carry %+v, want %+v", stats, got)
+	}
+	if gauge("good") != 1 || gauge("poor") != 1 || gauge("critical") != 0 ||
+		testutil.ToFloat64(appmetrics.RoomPoorQualityPercent.WithLabelValues(r.ID)) != 50 {
+		t.Fatal("gauges do not match the summary")
+	}
+
+	// A summary goes out only when the counts per level change
+	r.updateQualitySummary([]peerQualitySample{sample("a", "good", 2), sample("b", "poor", 7)})
+	r.updateQualitySummary([]peerQualitySample{sample("a", "good", 1), sample("b", "critical", 12)})
+	if len(summaries) != 2 || summaries[1].Levels["critical"] != 1 || summaries[1].WorstPacketLoss != 12 {
+		t.Fatalf("summaries sent %+v, want the first and the one with b critical", summaries)
+	}
+	if gauge("poor") != 0 || gauge("critical") != 1 {
+		t.Fatal("gauges did not follow b to critical")
+	}
+
+	// The summary is not a view of the room's state
+	got = r.GetQualitySummary()
+	got.Levels["good"] = 99
+	if r.GetQualitySummary().Levels["good"] != 1 {
+		t.Fatal("a caller changed the room's summary")
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(appmetrics.RoomQualityPeers) + testutil.CollectAndCount(appmetrics.RoomPoorQualityPercent); n != 0 {
+		t.Fatalf("%d quality series after the room closed", n)
+	}
+}
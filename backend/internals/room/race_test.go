@@ -0,0 +1,7 @@
+//go:build race
+
+package room
+
+// raceEnabled is set when built with -race, which slows every packet too
+// much for timing bounds to mean anything.
+const raceEnabled = true
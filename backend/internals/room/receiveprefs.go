@@ -0,0 +1,189 @@
+package room
+
+import (
+	"fmt"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// A subscriber may cap what it receives of each track with a receive
+// preference, so a client showing a track as a 160x90 thumbnail is not sent
+// 720p whatever its bandwidth. Preferences are kept per subscriber by track
+// or codec group handle. Every way a layer is picked, the default of a new
+// subscription, a layer-switch and AllocateLayers, skips layers whose
+// nominal format exceeds the preference, falling back to the lowest layer
+// when none fits. A track that is not simulcast cannot be scaled down here,
+// so its preference is only kept and reported.
+
+// ReceivePreference caps the layers a subscriber receives of a track.
+type ReceivePreference = signaling.ReceivePreference
+
+// layerFormat is the picture a simulcast layer carries.
+type layerFormat struct {
+	width, height, framerate int
+}
+
+// nominalLayerFormats estimates the format of common simulcast RIDs, as
+// nominalLayerBitrates does their bitrate. Layers of other RIDs fit any
+// preference.
+var nominalLayerFormats = map[string]layerFormat{
+	"q": {320, 180, 30},
+	"h": {640, 360, 30},
+	"f": {1280, 720, 30},
+}
+
+// layerFits reports whether layer rid is within pref.
+func layerFits(pref ReceivePreference, rid string) bool {
+	f, ok := nominalLayerFormats[rid]
+	if !ok {
+		return true
+	}
+	return (pref.MaxWidth <= 0 || f.width <= pref.MaxWidth) &&
+		(pref.MaxHeight <= 0 || f.height <= pref.MaxHeight) &&
+		(pref.MaxFramerate <= 0 || f.framerate <= pref.MaxFramerate)
+}
+
+// capLayers returns the layers of rids, sorted lowest first, that fit pref,
+// or just the lowest when none does.
+func capLayers(rids []string, pref ReceivePreference) []string {
+	if pref.IsZero() || len(rids) == 0 {
+		return rids
+	}
+	capped := make([]string, 0, len(rids))
+	for _, rid := range rids {
+		if layerFits(pref, rid) {
+			capped = append(capped, rid)
+		}
+	}
+	if len(capped) == 0 {
+		capped = append(capped, rids[0])
+	}
+	return capped
+}
+
+// capLayer returns rid, or the best layer of mt below it that fits
+// peerID's preference for mt.
+func (r *Room) capLayer(mt *MediaTrack, peerID, rid string) string {
+	pref, ok := r.receivePreference(peerID, mt)
+	if !ok || layerFits(pref, rid) {
+		return rid
+	}
+	mt.mu.RLock()
+	rids := make([]string, 0, len(mt.Layers))
+	for id := range mt.Layers {
+		rids = append(rids, id)
+	}
+	mt.mu.RUnlock()
+	sortLayers(rids)
+
+	best := ""
+	for _, id := range rids {
+		if id == rid {
+			break
+		}
+		if best == "" || layerFits(pref, id) {
+			best = id
+		}
+	}
+	if best == "" {
+		return rid
+	}
+	return best
+}
+
+// receivePreference returns peerID's preference for mt, set on its handle
+// or on its codec group's.
+func (r *Room) receivePreference(peerID string, mt *MediaTrack) (ReceivePreference, bool) {
+	r.prioMu.RLock()
+	defer r.prioMu.RUnlock()
+	prefs := r.receivePrefs[peerID]
+	if pref, ok := prefs[mt.Handle]; ok {
+		return pref, true
+	}
+	if mt.group != nil {
+		pref, ok := prefs[mt.group.Handle]
+		return pref, ok
+	}
+	return ReceivePreference{}, false
+}
+
+// SetReceivePreferences updates p's receive preferences. Keys must name a
+// track or codec group (raw track IDs are normalised); a zero preference
+// clears the entry and, with replace, entries not in prefs are cleared.
+// Layers p receives are moved within the new caps. Returns the resulting
+// preferences.
+func (r *Room) SetReceivePreferences(p *peer.Peer, prefs map[string]ReceivePreference, replace bool) (map[string]ReceivePreference, error) {
+	r.mu.RLock()
+	resolved := make(map[string]ReceivePreference, len(prefs))
+	for key, pref := range prefs {
+		if pref.MaxWidth < 0 || pref.MaxHeight < 0 || pref.MaxFramerate < 0 {
+			r.mu.RUnlock()
+			return nil, fmt.Errorf("negative limit for %s", key)
+		}
+		if g, ok := r.codecGroups[key]; ok {
+			resolved[g.Handle] = pref
+			continue
+		}
+		mt, ok := r.resolveTrackLocked(key)
+		if !ok {
+			r.mu.RUnlock()
+			return nil, fmt.Errorf("unknown track: %s", key)
+		}
+		handle := mt.Handle
+		if mt.group != nil {
+			handle = mt.group.Handle
+		}
+		resolved[handle] = pref
+	}
+	r.mu.RUnlock()
+
+	r.prioMu.Lock()
+	if r.receivePrefs == nil {
+		r.receivePrefs = make(map[string]map[string]ReceivePreference)
+	}
+	current := r.receivePrefs[p.ID]
+	if replace || current == nil {
+		current = make(map[string]ReceivePreference, len(resolved))
+	}
+	for handle, pref := range resolved {
+		if pref.IsZero() {
+			delete(current, handle)
+		} else {
+			current[handle] = pref
+		}
+	}
+	if len(current) == 0 {
+		delete(r.receivePrefs, p.ID)
+	} else {
+		r.receivePrefs[p.ID] = current
+	}
+	r.prioMu.Unlock()
+
+	r.AllocateLayers(p.ID)
+	return r.ReceivePreferences(p.ID), nil
+}
+
+// ReceivePreferences returns a copy of peerID's receive preferences.
+func (r *Room) ReceivePreferences(peerID string) map[string]ReceivePreference {
+	r.prioMu.RLock()
+	defer r.prioMu.RUnlock()
+	out := make(map[string]ReceivePreference, len(r.receivePrefs[peerID]))
+	for handle, pref := range r.receivePrefs[peerID] {
+		out[handle] = pref
+	}
+	return out
+}
+
+// dropReceivePreferences forgets a departed peer's preferences and every
+// peer's preferences for its tracks.
+func (r *Room) dropReceivePreferences(peerID string, tracks []*MediaTrack) {
+	r.prioMu.Lock()
+	defer r.prioMu.Unlock()
+	delete(r.receivePrefs, peerID)
+	for _, prefs := range r.receivePrefs {
+		for _, mt := range tracks {
+			delete(prefs, mt.Handle)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package room
+
+import (
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestReceivePreferencesWithBandwidthLimit(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	viewer := joinAs(t, r, "viewer", nil)
+	// The publishers are not in the room, so no keyframe is asked of them
+	stage := addTrack(r, "stage-cam", "presenter", "video", qhf...)
+	thumb := addTrack(r, "attendee-cam", "attendee", "video", qhf...)
+	for _, mt := range []*MediaTrack{stage, thumb} {
+		mt.Subscribers[viewer.ID] = &SubscriberState{PeerID: viewer.ID, CurrentRID: "q", kind: "video", cancel: func() {}}
+	}
+	if _, err := r.SetTrackPriorities(map[string]int{stage.Handle: 10}, false); err != nil {
+		t.Fatal(err)
+	}
+	expect := func(what string, want map[string]string) {
+		t.Helper()
+		got := make(map[string]string)
+		for _, mt := range []*MediaTrack{stage, thumb} {
+			mt.mu.RLock()
+			got[mt.ID] = mt.Subscribers[viewer.ID].CurrentRID
+			mt.mu.RUnlock()
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: layers %v, want %v", what, got, want)
+		}
+	}
+	prefer := func(prefs map[string]ReceivePreference) {
+		t.Helper()
+		if _, err := r.SetReceivePreferences(viewer, prefs, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Enough for the stage on f, the rest on q
+	viewer.SetBandwidthLimit(2*150_000 + 1_350_000)
+	r.AllocateLayers(viewer.ID)
+	expect("uncapped", map[string]string{"stage-cam": "f", "attendee-cam": "q"})
+
+	// Capped at 360p, the stage takes h and leaves the attendee's camera
+	// enough for h too
+	prefer(map[string]ReceivePreference{stage.Handle: {MaxHeight: 360}})
+	expect("stage at 360p", map[string]string{"stage-cam": "h", "attendee-cam": "h"})
+
+	// Width and frame rate caps combine; no layer fits 15fps, so the lowest
+	// is kept
+	prefer(map[string]ReceivePreference{
+		stage.Handle: {MaxWidth: 640, MaxFramerate: 30},
+		thumb.Handle: {MaxFramerate: 15},
+	})
+	expect("stage at 640 wide, attendee at 15fps", map[string]string{"stage-cam": "h", "attendee-cam": "q"})
+
+	// A cap above every layer leaves the budget to decide
+	prefer(map[string]ReceivePreference{stage.Handle: {MaxWidth: 1920, MaxHeight: 1080, MaxFramerate: 60}})
+	expect("stage capped above f", map[string]string{"stage-cam": "f", "attendee-cam": "q"})
+
+	// A cap never raises a layer the budget does not allow
+	viewer.SetBandwidthLimit(2*150_000 + 350_000)
+	r.AllocateLayers(viewer.ID)
+	expect("less budget", map[string]string{"stage-cam": "h", "attendee-cam": "q"})
+	prefer(map[string]ReceivePreference{stage.Handle: {MaxHeight: 180}})
+	expect("stage at 180p", map[string]string{"stage-cam": "q", "attendee-cam": "h"})
+
+	// Without a limit, a track without priority is left where it is unless
+	// it is above its cap
+	viewer.SetBandwidthLimit(0)
+	prefer(nil)
+	if err := r.switchSubscriberLayer(thumb, viewer.ID, "f"); err != nil {
+		t.Fatal(err)
+	}
+	expect("unlimited", map[string]string{"stage-cam": "f", "attendee-cam": "f"})
+	prefer(map[string]ReceivePreference{thumb.Handle: {MaxHeight: 360, MaxFramerate: 30}})
+	expect("attendee at 360p, unlimited", map[string]string{"stage-cam": "f", "attendee-cam": "h"})
+	prefer(map[string]ReceivePreference{stage.Handle: {MaxFramerate: 24}})
+	expect("stage at 24fps, unlimited", map[string]string{"stage-cam": "q", "attendee-cam": "h"})
+}
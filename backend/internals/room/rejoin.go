@@ -0,0 +1,101 @@
+package room
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+// With stable peer IDs a reconnecting participant comes back under the ID
+// it had, so its new peer replaces the old one in place rather than leaving
+// and joining: the room never lacks the ID, subscriptions to the old peer's
+// tracks end with them, and the new peer's own subscriptions are keyed as
+// the old ones were. Callbacks of the old peer that arrive afterwards find
+// it replaced and are ignored.
+
+// ReplacePeer puts p in old's place. p must have old's peer and user ID.
+// old's tracks and subscriptions end as on a leave, but the user keeps its
+// host role and the peer its priority. OnPeerReplaced fires instead of
+// OnPeerLeft and OnPeerJoined. It returns ErrPeerNotFound if old is no
+// longer in the room.
+func (r *Room) ReplacePeer(old, p *peer.Peer) error {
+	if p.ID != old.ID || p.UserID != old.UserID {
+		return fmt.Errorf("replacement peer must keep the peer and user ID")
+	}
+	r.mu.Lock()
+	if r.State == RoomStateClosed {
+		r.mu.Unlock()
+		return fmt.Errorf("room is closed")
+	}
+	if r.Peers[old.ID] != old {
+		r.mu.Unlock()
+		return ErrPeerNotFound
+	}
+
+	affectedPeers, removedTracks, stoppedSubs := r.removePeerTracks(old.ID)
+	delete(r.replacements, old.ID)
+	r.dropPeerCodecGroupsLocked(old.ID)
+	r.dropPendingForwards(old.ID)
+
+	r.wirePeerLocked(p)
+	r.Peers[p.ID] = p
+	r.initPendingForwards(p)
+	now := time.Now()
+	r.UpdatedAt = now
+	r.recordLeave(old, now)
+	r.recordJoin(p, now)
+	r.recordEvent(RoomEvent{Type: EventPeerReconnected, PeerID: p.ID, UserID: p.UserID, At: now})
+	r.checkConsistencyLocked("replace")
+
+	r.logger.Info("Peer replaced by reconnect",
+		zap.String("roomID", r.ID),
+		zap.String("peerID", p.ID),
+		zap.Int("removedTracks", len(removedTracks)),
+	)
+
+	if r.OnPeerReplaced != nil && !r.silenced() {
+		r.OnPeerReplaced(r, old, p)
+	}
+	r.mu.Unlock()
+
+	r.waitSubscribers(stoppedSubs)
+
+	r.audioLevelsMu.Lock()
+	delete(r.audioLevels, old.ID)
+	if r.dominantSpeaker == old.ID {
+		r.dominantSpeaker = ""
+	}
+	r.audioLevelsMu.Unlock()
+
+	r.dataMu.Lock()
+	delete(r.dataReplayed, old.ID)
+	r.dataMu.Unlock()
+
+	r.dropRenegotiationStateOf(old)
+	r.dropConnState(old)
+	// The peer's own priority stays with its ID
+	r.dropPriorities("", removedTracks)
+	r.dropReceivePreferences("", removedTracks)
+
+	for _, mt := range removedTracks {
+		r.recordEvent(RoomEvent{Type: EventTrackRemoved, PeerID: old.ID, UserID: old.UserID, TrackID: mt.Handle})
+		if r.OnTrackRemoved != nil && !r.silenced() {
+			r.OnTrackRemoved(r, old, mt)
+		}
+	}
+	for _, ap := range affectedPeers {
+		r.triggerRenegotiation(ap, RenegotiatePeerLeft)
+	}
+
+	old.Close()
+	return nil
+}
+
+// isCurrentPeer reports whether p is still the room's peer under its ID.
+func (r *Room) isCurrentPeer(p *peer.Peer) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.Peers[p.ID] == p
+}
@@ -0,0 +1,239 @@
+package room
+
+import (
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+)
+
+// Reasons passed to OnRenegotiateNeeded.
+const (
+	RenegotiateTrackChange  = "track_change"  // tracks were attached to the peer
+	RenegotiateScheduled    = "scheduled"     // coalesced requests, sent after the throttle delay
+	RenegotiateRetry        = "retry"         // attaching a track failed; the client should add transceivers
+	RenegotiatePeerLeft     = "peer-left"     // a publisher left and its tracks were removed
+	RenegotiateResume       = "resume"        // requests held while the connection was interrupted
+	RenegotiateTrackRemoved = "track-removed" // the SFU removed a track (see policing.go)
+	RenegotiateAdmin        = "admin"         // an operator forced it (see nudge.go)
+)
+
+// renegotiationState is the per-peer renegotiation throttle. It lives exactly
+// as long as the peer's membership in the room: it is only created for
+// current members and is dropped together with the peer in RemovePeer, or
+// wholesale in Close.
+type renegotiationState struct {
+	peer  *peer.Peer
+	last  time.Time
+	timer *time.Timer
+	gen   uint64 // bumped whenever a pending timer is scheduled or cancelled
+
+	// While the connection is interrupted, or the peer has no signaling
+	// connection, requests are held and sent as a single resume once both
+	// are back.
+	interrupted bool
+	detached    bool
+	deferred    bool
+}
+
+// held reports whether renegotiations must wait for a resume.
+func (st *renegotiationState) held() bool {
+	return st.interrupted || st.detached
+}
+
+// cancelTimer stops a pending renegotiation so its callback becomes a no-op.
+// MUST be called with r.renegotiationMu held.
+func (st *renegotiationState) cancelTimer() {
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	st.gen++
+}
+
+// SetRoomMetrics enables the per-room renegotiation gauge, which is off by
+// default because every room adds a time series.
+func (r *Room) SetRoomMetrics(enabled bool) {
+	r.renegotiationMu.Lock()
+	defer r.renegotiationMu.Unlock()
+	r.roomMetrics = enabled
+}
+
+// reportPendingRenegotiations publishes how many renegotiations are waiting
+// on the throttle. MUST be called with r.renegotiationMu held.
+func (r *Room) reportPendingRenegotiations() {
+	if !r.roomMetrics {
+		return
+	}
+	pending := 0
+	for _, st := range r.renegotiation {
+		if st.timer != nil {
+			pending++
+		}
+	}
+	appmetrics.SetRenegotiationsPending(r.ID, pending)
+}
+
+// RenegotiationStates returns the number of peers with throttle state.
+func (r *Room) RenegotiationStates() int {
+	r.renegotiationMu.Lock()
+	defer r.renegotiationMu.Unlock()
+	return len(r.renegotiation)
+}
+
+// dropRenegotiationState tears down a peer's throttle state.
+func (r *Room) dropRenegotiationState(peerID string) {
+	r.renegotiationMu.Lock()
+	defer r.renegotiationMu.Unlock()
+	if st, ok := r.renegotiation[peerID]; ok {
+		st.cancelTimer()
+		delete(r.renegotiation, peerID)
+		r.reportPendingRenegotiations()
+	}
+}
+
+// dropRenegotiationStateOf drops the throttle state of p, leaving that of a
+// peer that replaced it under its ID.
+func (r *Room) dropRenegotiationStateOf(p *peer.Peer) {
+	r.renegotiationMu.Lock()
+	defer r.renegotiationMu.Unlock()
+	if st, ok := r.renegotiation[p.ID]; ok && st.peer == p {
+		st.cancelTimer()
+		delete(r.renegotiation, p.ID)
+		r.reportPendingRenegotiations()
+	}
+}
+
+// renegotiationStateFor returns targetPeer's throttle state, creating it if
+// targetPeer is still a member. MUST be called with r.renegotiationMu held.
+func (r *Room) renegotiationStateFor(targetPeer *peer.Peer) *renegotiationState {
+	st, exists := r.renegotiation[targetPeer.ID]
+	if exists && st.peer == targetPeer {
+		return st
+	}
+	// Only track peers that are still members, so state is never created
+	// after RemovePeer has dropped it.
+	r.mu.RLock()
+	member := r.Peers[targetPeer.ID] == targetPeer
+	r.mu.RUnlock()
+	if !member {
+		return nil
+	}
+	st = &renegotiationState{peer: targetPeer}
+	r.renegotiation[targetPeer.ID] = st
+	return st
+}
+
+// triggerRenegotiation asks for targetPeer to be renegotiated, coalescing
+// requests that arrive within renegotiationDelay of the previous one into a
+// single scheduled renegotiation.
+func (r *Room) triggerRenegotiation(targetPeer *peer.Peer, reason string) {
+	r.renegotiate(targetPeer, reason, false)
+}
+
+// renegotiate is triggerRenegotiation; with force the throttle is bypassed
+// and a scheduled renegotiation is sent at once instead. Held requests stay
+// held either way. It reports whether OnRenegotiateNeeded was called.
+func (r *Room) renegotiate(targetPeer *peer.Peer, reason string, force bool) bool {
+	r.renegotiationMu.Lock()
+
+	if r.ctx.Err() != nil || r.silenced() {
+		r.renegotiationMu.Unlock()
+		return false
+	}
+
+	st := r.renegotiationStateFor(targetPeer)
+	if st == nil {
+		r.renegotiationMu.Unlock()
+		return false
+	}
+
+	if st.held() {
+		st.deferred = true
+		r.renegotiationMu.Unlock()
+		return false
+	}
+
+	if force && st.timer != nil {
+		st.cancelTimer()
+		r.reportPendingRenegotiations()
+	}
+	if st.timer != nil {
+		r.renegotiationMu.Unlock()
+		return false
+	}
+
+	delay := r.renegotiationDelay
+	if !force && !st.last.IsZero() && time.Since(st.last) < delay {
+		wait := delay - time.Since(st.last)
+		st.gen++
+		gen := st.gen
+		peerID := targetPeer.ID
+		st.timer = time.AfterFunc(wait, func() {
+			r.renegotiationMu.Lock()
+			current := r.renegotiation[peerID] == st && st.gen == gen && r.ctx.Err() == nil
+			if current {
+				st.timer = nil
+				if st.held() {
+					st.deferred = true
+					current = false
+				} else {
+					st.last = time.Now()
+				}
+				r.reportPendingRenegotiations()
+			}
+			r.renegotiationMu.Unlock()
+
+			if current && r.OnRenegotiateNeeded != nil && !r.silenced() {
+				r.OnRenegotiateNeeded(st.peer, RenegotiateScheduled)
+			}
+		})
+		r.reportPendingRenegotiations()
+		r.renegotiationMu.Unlock()
+		return false
+	}
+
+	st.last = time.Now()
+	r.renegotiationMu.Unlock()
+
+	if r.OnRenegotiateNeeded == nil || r.silenced() {
+		return false
+	}
+	r.OnRenegotiateNeeded(targetPeer, reason)
+	return true
+}
+
+// setRenegotiationInterrupted holds p's renegotiations while its connection
+// is interrupted. On restore, anything requested meanwhile is sent at once
+// as a resume.
+func (r *Room) setRenegotiationInterrupted(p *peer.Peer, interrupted bool) {
+	r.setRenegotiationHold(p, func(st *renegotiationState) { st.interrupted = interrupted })
+}
+
+// setRenegotiationDetached holds p's renegotiations while it has no signaling
+// connection to deliver them on.
+func (r *Room) setRenegotiationDetached(p *peer.Peer, detached bool) {
+	r.setRenegotiationHold(p, func(st *renegotiationState) { st.detached = detached })
+}
+
+// setRenegotiationHold applies set to p's throttle state and sends the held
+// requests as a resume once nothing holds them any more.
+func (r *Room) setRenegotiationHold(p *peer.Peer, set func(*renegotiationState)) {
+	r.renegotiationMu.Lock()
+	st := r.renegotiationStateFor(p)
+	if st == nil || r.ctx.Err() != nil {
+		r.renegotiationMu.Unlock()
+		return
+	}
+	set(st)
+	resume := !st.held() && st.deferred
+	if resume {
+		st.deferred = false
+		st.last = time.Now()
+	}
+	r.renegotiationMu.Unlock()
+
+	if resume && r.OnRenegotiateNeeded != nil && !r.silenced() {
+		r.OnRenegotiateNeeded(p, RenegotiateResume)
+	}
+}
@@ -0,0 +1,166 @@
+package room
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestCloseWithPendingRenegotiations(t *testing.T) {
+	const (
+		peers = 48
+		delay = 100 * time.Millisecond
+	)
+	r := NewRoom("room-1", peers, zap.NewNop())
+	r.SetRenegotiationDelay(delay)
+	var scheduled atomic.Int64
+	r.OnRenegotiateNeeded = func(p *peer.Peer, reason string) {
+		if reason == RenegotiateScheduled {
+			scheduled.Add(1)
+		}
+	}
+
+	members := make([]*peer.Peer, peers)
+	for i := range members {
+		members[i] = peer.NewPeer(r.ID, fmt.Sprintf("user-%d", i), "", zap.NewNop())
+		if err := r.AddPeer(members[i]); err != nil {
+			t.Fatal(err)
+		}
+		// The first goes out at once and the second waits on the throttle
+		r.triggerRenegotiation(members[i], RenegotiateTrackChange)
+		r.triggerRenegotiation(members[i], RenegotiateTrackChange)
+	}
+	r.renegotiationMu.Lock()
+	pending := 0
+	for _, st := range r.renegotiation {
+		if st.timer != nil {
+			pending++
+		}
+	}
+	r.renegotiationMu.Unlock()
+	if pending != peers {
+		t.Fatalf("%d renegotiations pending, want %d", pending, peers)
+	}
+
+	// Peers churn and ask for more while the room closes
+	var wg sync.WaitGroup
+	for i, p := range members {
+		wg.Add(1)
+		go func(i int, p *peer.Peer) {
+			defer wg.Done()
+			r.triggerRenegotiation(p, RenegotiatePeerLeft)
+			if i%2 == 0 {
+				r.RemovePeer(p.ID)
+			}
+			r.setRenegotiationInterrupted(p, true)
+			r.setRenegotiationInterrupted(p, false)
+		}(i, p)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	// A callback that had passed its checks as Close began may still land
+	// just after it; none may come once the throttle delay has passed
+	time.Sleep(10 * time.Millisecond)
+	settled := scheduled.Load()
+	time.Sleep(2 * delay)
+	if n := scheduled.Load(); n != settled {
+		t.Fatalf("%d scheduled renegotiations after the room closed", n-settled)
+	}
+	if n := r.RenegotiationStates(); n != 0 {
+		t.Fatalf("%d peers keep throttle state after close", n)
+	}
+}
+
+func TestRemovePeerDropsRenegotiationState(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	r.SetRenegotiationDelay(time.Hour)
+	var calls atomic.Int64
+	r.OnRenegotiateNeeded = func(*peer.Peer, string) { calls.Add(1) }
+
+	p := peer.NewPeer(r.ID, "alice", "Alice", zap.NewNop())
+	if err := r.AddPeer(p); err != nil {
+		t.Fatal(err)
+	}
+	r.triggerRenegotiation(p, RenegotiateTrackChange)
+	r.triggerRenegotiation(p, RenegotiateTrackChange)
+	if err := r.RemovePeer(p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.RenegotiationStates(); n != 0 {
+		t.Fatalf("%d peers keep throttle state after leaving", n)
+	}
+
+	// A peer that has left gets no state back
+	r.triggerRenegotiation(p, RenegotiateTrackChange)
+	if n := r.RenegotiationStates(); n != 0 {
+		t.Fatalf("%d peers have throttle state after a late request", n)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("%d renegotiations, want only the first", n)
+	}
+}
+
+func TestPendingRenegotiationsGauge(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	r := NewRoom("room-1", 10, zap.NewNop())
+	r.SetRenegotiationDelay(delay)
+	r.SetRoomMetrics(true)
+	var scheduled atomic.Int64
+	r.OnRenegotiateNeeded = func(p *peer.Peer, reason string) {
+		if reason == RenegotiateScheduled {
+			scheduled.Add(1)
+		}
+	}
+	pending := func() float64 {
+		return testutil.ToFloat64(appmetrics.RoomRenegotiationsPending.WithLabelValues(r.ID))
+	}
+
+	var members []*peer.Peer
+	for _, user := range []string{"alice", "bob"} {
+		p := peer.NewPeer(r.ID, user, "", zap.NewNop())
+		if err := r.AddPeer(p); err != nil {
+			t.Fatal(err)
+		}
+		r.triggerRenegotiation(p, RenegotiateTrackChange)
+		r.triggerRenegotiation(p, RenegotiateTrackChange)
+		r.triggerRenegotiation(p, RenegotiateTrackChange)
+		members = append(members, p)
+	}
+	if got := pending(); got != 2 {
+		t.Fatalf("%v renegotiations pending, want one per peer", got)
+	}
+
+	// A departing peer's timer goes with it; the other's fires
+	if err := r.RemovePeer(members[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := pending(); got != 1 {
+		t.Fatalf("%v renegotiations pending after a peer left", got)
+	}
+	deadline := time.Now().Add(5 * delay)
+	for pending() != 0 || scheduled.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v renegotiations pending, %d sent, after the delay", pending(), scheduled.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The room's series goes when it closes
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(appmetrics.RoomRenegotiationsPending); n != 0 {
+		t.Fatalf("%d pending renegotiation series after the room closed", n)
+	}
+}
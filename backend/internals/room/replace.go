@@ -0,0 +1,229 @@
+package room
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// A client switching cameras typically ends one track and starts another.
+// Published as is, that is a track-removed and a track-published: every
+// subscriber renegotiates and loses the video meanwhile. A client that
+// declares the new track as the replacement of a published one
+// (DeclareReplacement) has it feed the existing MediaTrack instead. Its
+// subscribers keep their senders and local tracks, the new source's packets
+// are rewritten to continue the old one's sequence numbers and timestamps,
+// and a keyframe is requested right away. The old source is dropped
+// without a track-removed.
+//
+// Within one renegotiation the old source usually ends before the new one
+// sends its first packet, so a track whose source ends while a replacement
+// is declared for it waits sourceReplaceTimeout for it. Without a
+// declaration, or once the declared track is gone, tracks are added and
+// removed as usual.
+
+// sourceReplaceTimeout is how long a track whose source ended waits for its
+// declared replacement before it is removed.
+const sourceReplaceTimeout = 5 * time.Second
+
+// trackSource is a publisher stream feeding a media track.
+type trackSource struct {
+	id     string // the publisher's track ID
+	track  *webrtc.TrackRemote
+	ctx    context.Context // ends when the source is replaced or the track removed
+	cancel context.CancelFunc
+
+	// prev is the source this one replaced until the first packet sets the
+	// offsets that continue its stream. Only the reader goroutine uses them.
+	prev      *trackSource
+	seqOffset uint16
+	tsOffset  uint32
+
+	// The last packet read, after rewriting, for the next replacement
+	lastSeqTS atomic.Uint64 // sequence number << 32 | timestamp
+	lastAt    atomic.Int64  // unix nanoseconds, 0 before the first packet
+}
+
+func newTrackSource(parent context.Context, id string, track *webrtc.TrackRemote, prev *trackSource) *trackSource {
+	ctx, cancel := context.WithCancel(parent)
+	return &trackSource{id: id, track: track, ctx: ctx, cancel: cancel, prev: prev}
+}
+
+// rewrite applies the source's offsets to pkt and records it as the last
+// packet read.
+func (src *trackSource) rewrite(pkt *rtp.Packet) {
+	if src.prev != nil {
+		src.rebase(pkt)
+	}
+	pkt.SequenceNumber += src.seqOffset
+	pkt.Timestamp += src.tsOffset
+	src.lastSeqTS.Store(uint64(pkt.SequenceNumber)<<32 | uint64(pkt.Timestamp))
+	src.lastAt.Store(time.Now().UnixNano())
+}
+
+// rebase sets the offsets that make pkt, the source's first packet, follow
+// the last packet of the source it replaced, advancing the timestamp by the
+// time that passed in between.
+func (src *trackSource) rebase(pkt *rtp.Packet) {
+	prev := src.prev
+	src.prev = nil
+	at := prev.lastAt.Load()
+	if at == 0 {
+		return
+	}
+	last := prev.lastSeqTS.Load()
+	ticks := uint32(time.Since(time.Unix(0, at)).Seconds() * float64(src.track.Codec().ClockRate))
+	if ticks == 0 {
+		ticks = 1
+	}
+	src.seqOffset = uint16(last>>32) + 1 - pkt.SequenceNumber
+	src.tsOffset = uint32(last) + ticks - pkt.Timestamp
+}
+
+// source returns the stream currently feeding mt.
+func (mt *MediaTrack) source() *trackSource {
+	return mt.src.Load()
+}
+
+// DeclareReplacement announces that p's track newTrackID, not yet
+// published, replaces p's published track ref (its handle or raw track
+// ID). It returns the handle the replacement will be forwarded under.
+func (r *Room) DeclareReplacement(p *peer.Peer, newTrackID, ref string) (string, error) {
+	if newTrackID == "" {
+		return "", fmt.Errorf("invalid track ID: %q", newTrackID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.Peers[p.ID]; !ok {
+		return "", ErrPeerNotFound
+	}
+	mt, ok := r.resolveTrackLocked(ref)
+	if !ok || mt.PeerID != p.ID {
+		return "", ErrTrackNotFound
+	}
+	if mt.IsSimulcast {
+		return "", fmt.Errorf("simulcast track %s cannot be replaced", mt.Handle)
+	}
+	if _, published := r.sourceTrackLocked(newTrackID); published {
+		return "", fmt.Errorf("track %s is already published", newTrackID)
+	}
+
+	if r.replacements[p.ID] == nil {
+		r.replacements[p.ID] = make(map[string]string)
+	}
+	r.replacements[p.ID][newTrackID] = mt.ID
+	return mt.Handle, nil
+}
+
+// sourceTrackLocked returns the track a publisher's track ID feeds: its own
+// or, for a replacement, the one it replaced.
+// MUST be called with r.mu held.
+func (r *Room) sourceTrackLocked(trackID string) (*MediaTrack, bool) {
+	if id, ok := r.sourceIDs[trackID]; ok {
+		trackID = id
+	}
+	mt, ok := r.MediaTracks[trackID]
+	return mt, ok
+}
+
+// replaceSource makes track feed the track it was declared to replace, and
+// reports whether it did. False leaves track to be published as usual.
+func (r *Room) replaceSource(p *peer.Peer, track *webrtc.TrackRemote) bool {
+	r.mu.Lock()
+	id, declared := r.replacements[p.ID][track.ID()]
+	if !declared {
+		r.mu.Unlock()
+		return false
+	}
+	delete(r.replacements[p.ID], track.ID())
+	mt, ok := r.MediaTracks[id]
+	if !ok || mt.PeerID != p.ID || mt.IsSimulcast || track.RID() != "" ||
+		mt.Kind != track.Kind().String() || !sameCodec(mt.Track.Codec(), track.Codec()) {
+		r.mu.Unlock()
+		r.logger.Debug("Replacement track published on its own",
+			zap.String("peerID", p.ID),
+			zap.String("trackID", track.ID()),
+			zap.Bool("replacedExists", ok),
+		)
+		return false
+	}
+
+	old := mt.source()
+	src := newTrackSource(mt.ctx, track.ID(), track, old)
+	mt.src.Store(src)
+	delete(r.sourceIDs, old.id)
+	if src.id != mt.ID {
+		r.sourceIDs[src.id] = mt.ID
+	}
+	r.mu.Unlock()
+
+	old.cancel()
+	p.ForgetTrack(old.id)
+	go r.forwardSource(mt, src)
+	if mt.Kind == "video" {
+		p.SendPLI(uint32(track.SSRC()))
+	}
+
+	r.logger.Info("Track source replaced",
+		zap.String("peerID", p.ID),
+		zap.String("handle", mt.Handle),
+		zap.String("from", old.id),
+		zap.String("to", src.id),
+	)
+	return true
+}
+
+func sameCodec(a, b webrtc.RTPCodecParameters) bool {
+	return strings.EqualFold(a.MimeType, b.MimeType) && a.ClockRate == b.ClockRate
+}
+
+// awaitReplacement keeps mt, whose source src ended, for
+// sourceReplaceTimeout if a replacement is declared for it, and reports
+// whether it did. If none has arrived by then the track is removed.
+func (r *Room) awaitReplacement(p *peer.Peer, mt *MediaTrack, src *trackSource) bool {
+	r.mu.RLock()
+	pending := false
+	for _, id := range r.replacements[p.ID] {
+		if id == mt.ID {
+			pending = true
+			break
+		}
+	}
+	r.mu.RUnlock()
+	if !pending {
+		return false
+	}
+
+	r.logger.Debug("Track source ended, awaiting its replacement",
+		zap.String("peerID", p.ID),
+		zap.String("handle", mt.Handle),
+		zap.String("trackID", src.id),
+	)
+	time.AfterFunc(sourceReplaceTimeout, func() {
+		if mt.source() == src {
+			p.RemoveTrack(src.id)
+		}
+	})
+	return true
+}
+
+// forgetSourcesLocked drops the source alias and pending replacements of
+// mt, which is being removed.
+// MUST be called with r.mu held.
+func (r *Room) forgetSourcesLocked(mt *MediaTrack) {
+	delete(r.sourceIDs, mt.source().id)
+	for newID, id := range r.replacements[mt.PeerID] {
+		if id == mt.ID {
+			delete(r.replacements[mt.PeerID], newID)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
 	"github.com/adityaadpandey/sfu-go/internals/peer"
 	"github.com/google/uuid"
 	"github.com/pion/rtp"
@@ -68,6 +69,9 @@ type SimulcastLayer struct {
 	RID    string
 	Track  *webrtc.TrackRemote
 	Active bool
+
+	// Set while the publisher is asked to resume this layer (see layeruse.go)
+	resuming atomic.Bool
 }
 
 // subscriberSnapshot is an immutable slice used for lock-free fan-out reads.
@@ -77,20 +81,79 @@ type subscriberSnapshot []*SubscriberState
 // SubscriberState tracks per-subscriber forwarding state for a media track.
 type SubscriberState struct {
 	PeerID     string
+	Peer       *peer.Peer // the subscribing peer
 	Sender     *webrtc.RTPSender
 	LocalTrack *webrtc.TrackLocalStaticRTP
 	CurrentRID string // which simulcast layer this subscriber receives ("" = non-simulcast)
 
 	// Non-blocking write buffer: fan-out pushes packets here; a dedicated
 	// writer goroutine drains them. If full, packet is dropped for THIS
-	// subscriber only — never blocking the fan-out for others.
-	writeCh chan *rtp.Packet
+	// subscriber only — never blocking the fan-out for others. Nil on the
+	// audio path, which writes directly.
+	writeCh chan queuedPacket
 	ctx     context.Context
 	cancel  context.CancelFunc
+
+	// unlink detaches ctx from the subscribing peer's lifetime.
+	unlink func() bool
+	// stats receives what the writer forwards
+	stats *forwardStats
+	// delays receives the forwarding delays of sampled packets, if not nil
+	delays *DelaySamples
+	// wg tracks the writer and RTCP drain goroutines.
+	wg sync.WaitGroup
+	// tap sees written packets during an outbound capture (see capture.go)
+	tap atomic.Pointer[PacketTap]
+
+	// Write error handling (see writeerrors.go). kind labels the metrics.
+	kind             string
+	closed           atomic.Bool
+	writeErrors      atomic.Uint64
+	lastWriteError   atomic.Int64 // unix nanoseconds
+	otherErrorLogged atomic.Bool
+	onClosed         func()
+	onCongested      func()
+	onOtherError     func(error)
+}
+
+// stop cancels the subscriber's goroutines. The RTCP drain only returns once
+// the sender is stopped, so callers must also stop or release Sender.
+func (sub *SubscriberState) stop() {
+	sub.cancel()
+	if sub.unlink != nil {
+		sub.unlink()
+	}
+}
+
+// subscriberStopTimeout bounds how long peer removal waits for subscriber
+// goroutines to exit.
+const subscriberStopTimeout = 2 * time.Second
+
+// waitSubscribers waits for stopped subscribers' goroutines to return.
+func (r *Room) waitSubscribers(subs []*SubscriberState) {
+	if len(subs) == 0 {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		for _, sub := range subs {
+			sub.wg.Wait()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(subscriberStopTimeout):
+		r.logger.Warn("Subscriber goroutines still running after stop",
+			zap.String("roomID", r.ID),
+			zap.Int("subscribers", len(subs)),
+		)
+	}
 }
 
 // AudioLevel tracks speaking activity for a peer.
 type AudioLevel struct {
+	UserID     string
 	Score      float64
 	LastPacket time.Time
 	PacketRate float64 // packets per second (EMA)
@@ -109,22 +172,66 @@ type Room struct {
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 	MaxPeers  int       `json:"maxPeers"`
+	// The region of the instance the room was created on, if set
+	Region string `json:"region,omitempty"`
 
 	// Peer management
 	Peers       map[string]*peer.Peer `json:"-"`
 	peersByUser map[string]string
-	peerCount   int
+
+	// Log membership inconsistencies after every change (see membership.go)
+	consistencyChecks bool
+
+	// Connection loss handling for peers added to the room (see grace.go)
+	disconnectGrace time.Duration
+	holdOnFailure   bool
+
+	// Hidden observers (recorders, dashboards)
+	maxObservers int // 0 = unlimited
 
 	// Media management
-	MediaTracks map[string]*MediaTrack `json:"-"`
+	MediaTracks  map[string]*MediaTrack `json:"-"`
+	trackHandles map[string]string      // handle -> MediaTrack.ID
+
+	// Track replacement (see replace.go)
+	sourceIDs    map[string]string            // replacement source track ID -> MediaTrack.ID
+	replacements map[string]map[string]string // peerID -> declared new track ID -> MediaTrack.ID
+
+	// Codec alternative groups (see codecgroup.go)
+	codecGroups  map[string]*codecGroup // group handle -> group
+	groupByTrack map[string]*codecGroup // groupKey(peerID, trackID) -> group
+
+	// Forwards held until a subscriber's first negotiation (see pending.go)
+	pendingForwards map[string]*pendingForwards // peerID -> queue
+	pendingMu       sync.Mutex
+
+	// Serializes subscription batches (see subscribe.go)
+	subscribeMu sync.Mutex
 
 	// Settings
 	Settings *RoomSettings `json:"settings"`
 
+	// Layer priorities by peer ID or track handle (see priority.go), and
+	// receive preferences by subscriber peer ID, then handle (see
+	// receiveprefs.go)
+	priorities     map[string]int
+	userPriorities map[string]int // restored, by user ID, until the user's peer joins
+	receivePrefs   map[string]map[string]ReceivePreference
+	spotlight      spotlightState // see spotlight.go
+	prioMu         sync.RWMutex
+
 	// Context for lifecycle
 	ctx    context.Context
 	cancel context.CancelFunc
 
+	// Shutdown (see closing.go)
+	closing atomic.Bool
+	closed  atomic.Bool
+	loops   sync.WaitGroup // speaker detection, stats and policing loops
+
+	// Ordered broadcasts (see dispatch.go)
+	dispatch dispatcher
+
 	// Allowed codecs
 	AllowedCodecs map[string]bool
 
@@ -135,38 +242,108 @@ type Room struct {
 	// Callbacks
 	OnPeerJoined            func(*Room, *peer.Peer)
 	OnPeerLeft              func(*Room, *peer.Peer)
+	OnPeerReplaced          func(*Room, *peer.Peer, *peer.Peer) // old and new peer of a reconnect; see ReplacePeer
 	OnTrackAdded            func(*Room, *peer.Peer, *MediaTrack)
-	OnTrackRemoved          func(*Room, *peer.Peer, string)
+	OnTrackRemoved          func(*Room, *peer.Peer, *MediaTrack)
 	OnRenegotiateNeeded     func(*peer.Peer, string)
 	OnDominantSpeakerChanged func(roomID, oldPeerID, newPeerID string)
-	OnQualityStats          func(peerID string, quality *PeerQuality)
+	OnQualityStats          func(*Room, *peer.Peer, *PeerQuality)
+	OnTrackRejected         func(*Room, *peer.Peer, string, string) // peer, trackID, reason
+	OnTrackPaused           func(*Room, *peer.Peer, *MediaTrack, bool) // paused or resumed
+	OnLayersInUse           func(*Room, *peer.Peer, *MediaTrack, []string, []string) // publisher, track, needed and paused RIDs
+	OnQualitySummary        func(*Room, QualitySummary) // the per-level counts changed
+	OnBitratePolicing       func(*Room, *peer.Peer, BitratePolicing) // policing of a publisher started or ended
+	OnTimeLimitWarning      func(*Room, TimeLimit) // a warning point before the time limit passed
+	OnTimeLimitReached      func(*Room)            // the time limit ran out; the owner closes the room
+	OnHostChanged           func(*Room, HostChange)
+	OnSpotlightChanged      func(*Room, SpotlightChange)
+	OnPeerConnectionState   func(*Room, *peer.Peer, PeerConnectionChange)
+	OnCodecMismatch         func(*Room, *peer.Peer, *CodecMismatchError) // a track was not forwarded to the peer
+	OnLiveSample            func(*Room, LiveSample) // a stats tick while live sampling is on
+	OnEvent                 func(*Room, RoomEvent)  // an event was recorded; must not block
+
+	// AdmitTrack is consulted before a new track is accepted so the owner can
+	// enforce limits that span rooms. Returning a non-empty reason rejects it.
+	AdmitTrack func(*Room, *peer.Peer, *webrtc.TrackRemote) string
+	// AdmitSubscriber is consulted before a track is forwarded to a peer,
+	// whether the peer subscribed to it or receives it automatically.
+	// Returning false leaves the peer without the track.
+	AdmitSubscriber func(*Room, *peer.Peer, *MediaTrack) bool
 
 	// Renegotiation throttling
-	renegotiationTimers map[string]*time.Timer
-	lastRenegotiation   map[string]time.Time
+	renegotiation       map[string]*renegotiationState // peerID -> throttle state
 	renegotiationDelay  time.Duration
 	renegotiationMu     sync.Mutex
+	roomMetrics         bool // export the per-room gauges
 
 	// Dominant speaker
 	audioLevels      map[string]*AudioLevel
 	dominantSpeaker  string
+	speakerThreshold float64
+	talkTime         map[string]time.Duration // userID -> time spent speaking
+	lastSpeakerTick  time.Time
 	audioLevelsMu    sync.Mutex
 
 	// Stats
+	forwarded                forwardStats
 	statsInterval            time.Duration
 	speakerDetectionInterval time.Duration
+	quality                  QualitySummary // see quality.go
+	events                   eventRing      // see events.go
+	live                     liveState      // see live.go
+	dormancy                 dormancy       // see dormant.go
+	host                     hostState      // see host.go
+	muteAll                  *MuteAll       // see muteall.go
+	lock                     *RoomLock      // see lock.go
+	connState                connStates     // see connstate.go
+	call                     callStats      // see callsummary.go
 
 	// Configurable limits
 	maxRTPErrors     int
 	simulcastEnabled bool
+	layerIdleWindow  time.Duration // 0 = don't report unused simulcast layers
+	fanOutThreshold  int           // subscribers before fan-out is sharded, 0 = never
+	fanOutShardCount int           // 0 = GOMAXPROCS
+	attachWorkers    int           // existing tracks attached at once for a joining peer (see attach.go)
+	attachTimeout    time.Duration // 0 = no limit
+	maxTracks        int // 0 = unlimited
+	keyframeInterval time.Duration
+	// One packet in this many is timed (see latency.go); 0 = none
+	latencySampleEvery int
+	forwardingDelays   atomic.Pointer[DelaySamples] // nil = metrics only
+
+	// Publisher bitrate cap (see policing.go)
+	bitrateCap          int // bits per second, 0 = off
+	policingDelay       time.Duration
+	policingRemoveAfter time.Duration
+	policers            map[string]*bitratePolicer // peerID -> policer
+	policingMu          sync.Mutex
+
+	// Maximum duration (see timelimit.go)
+	timeLimit timeLimit
+
+	// Broadcast mode (see broadcast.go): the default share of viewers
+	// reporting quality, and Settings.ViewerEvents for lock-free reads
+	viewerStatsPercent int
+	viewerEvents       atomic.Bool
+
+	// Data channel broadcasts
+	dataSeq         uint64
+	dataHistory     []DataMessage
+	dataHistorySize int
+	dataQueueSize   int
+	dataQueueTTL    time.Duration
+	dataReplayed    map[string]bool // peers that have received the history
+	dataMu          sync.Mutex
 }
 
 type MediaTrack struct {
 	ID          string                        `json:"id"`
+	Handle      string                        `json:"handle"` // SFU-assigned, client-facing track ID
 	PeerID      string                        `json:"peerId"`
 	Kind        string                        `json:"kind"`
 	MediaType   peer.MediaType                `json:"mediaType"`
-	Track       *webrtc.TrackRemote           `json:"-"`
+	Track       *webrtc.TrackRemote           `json:"-"` // the first source; see source()
 	Receiver    *webrtc.RTPReceiver           `json:"-"`
 	Subscribers map[string]*SubscriberState   `json:"-"`
 	LocalTracks map[string]*webrtc.TrackLocalStaticRTP `json:"-"`
@@ -177,6 +354,13 @@ type MediaTrack struct {
 	// Updated atomically whenever Subscribers changes.
 	subscriberSnap atomic.Value // stores subscriberSnapshot
 
+	// Sharded fan-out for large subscriber counts (see fanout.go)
+	shards          atomic.Pointer[fanOutShards]
+	shardSnap       atomic.Value // stores shardSnapshot
+	fanOutThreshold int          // the room's, when the track was added
+	path            *forwardPath // how packets reach subscribers, by kind
+	src             atomic.Pointer[trackSource]
+
 	ctx           context.Context
 	cancel        context.CancelFunc
 	fanOutStarted bool
@@ -184,10 +368,28 @@ type MediaTrack struct {
 	// Simulcast
 	Layers     map[string]*SimulcastLayer `json:"-"` // RID -> layer
 	IsSimulcast bool                      `json:"isSimulcast"`
+	// How the publisher identifies layers: peer.SimulcastModeRID or
+	// peer.SimulcastModeSSRC (synthetic RIDs, see simulcast.go)
+	SimulcastMode string `json:"simulcastMode,omitempty"`
 	BaseTrackID string                    `json:"baseTrackId"` // grouping key: StreamID+Kind
 
 	// PLI tracking — only fire PLI on new-join or packet loss, not blindly
 	needsPLI     atomic.Bool
+
+	// Unix nanos of the last client-initiated keyframe request
+	lastKeyframeRequest atomic.Int64
+
+	// Publisher's connection is interrupted (see grace.go)
+	paused atomic.Bool
+
+	// Codec alternative group this track belongs to, if any (see codecgroup.go)
+	group *codecGroup
+
+	// Which simulcast layers subscribers need (see layeruse.go)
+	layerUse layerUse
+
+	// Debug capture of the track, if any (see capture.go)
+	tap atomic.Pointer[trackTap]
 }
 
 type RoomSettings struct {
@@ -197,6 +399,49 @@ type RoomSettings struct {
 	RecordingEnabled   bool `json:"recordingEnabled"`
 	MaxVideoBitrate    int  `json:"maxVideoBitrate"`
 	MaxAudioBitrate    int  `json:"maxAudioBitrate"`
+
+	// Participants join muted and stay muted until they unmute; with
+	// UnmuteRequiresApproval only a moderator can unmute them
+	MuteOnEntry            bool `json:"muteOnEntry"`
+	UnmuteRequiresApproval bool `json:"unmuteRequiresApproval"`
+	// Unmutes revert after PushToTalkMaxMs (the server default when 0)
+	PushToTalk      bool `json:"pushToTalk"`
+	PushToTalkMaxMs int  `json:"pushToTalkMaxMs,omitempty"`
+
+	// Mode is "" or RoomModeBroadcast, fixed when the room is created.
+	// Broadcast rooms report quality for ViewerStatsSamplePercent of viewers
+	// (the server default when 0) and count viewers instead of announcing
+	// them unless ViewerEvents is set
+	Mode                     string `json:"mode,omitempty"`
+	ViewerStatsSamplePercent int    `json:"viewerStatsSamplePercent,omitempty"`
+	ViewerEvents             bool   `json:"viewerEvents,omitempty"`
+
+	// A room with exactly two participants lets them connect directly,
+	// using the SFU only to relay their signaling (unless recording)
+	P2PAllowed bool `json:"p2pAllowed,omitempty"`
+
+	// A reconnecting participant keeps its peer ID for as long as its
+	// session lives, instead of getting a new one
+	StablePeerIDs bool `json:"stablePeerIds,omitempty"`
+
+	// A publisher may subscribe to one of its own tracks to see what the
+	// SFU receives (see monitor.go)
+	SelfMonitor bool `json:"selfMonitor,omitempty"`
+
+	// Filled in by GetSettings; priorities are managed with SetTrackPriorities
+	TrackPriorities map[string]int `json:"trackPriorities,omitempty"`
+}
+
+// DefaultSettings returns the settings a new room starts with.
+func DefaultSettings() *RoomSettings {
+	return &RoomSettings{
+		AudioEnabled:       true,
+		VideoEnabled:       true,
+		ScreenShareEnabled: true,
+		RecordingEnabled:   false,
+		MaxVideoBitrate:    2000000,
+		MaxAudioBitrate:    128000,
+	}
 }
 
 // rebuildSnapshot replaces the atomic subscriber snapshot from the map.
@@ -207,6 +452,7 @@ func (mt *MediaTrack) rebuildSnapshot() {
 		snap = append(snap, sub)
 	}
 	mt.subscriberSnap.Store(snap)
+	mt.rebuildShardsLocked()
 }
 
 // getSnapshot returns the current subscriber snapshot lock-free.
@@ -223,22 +469,42 @@ func (mt *MediaTrack) getSnapshot() subscriberSnapshot {
 // to the pool for reuse. If the channel is full, packets are dropped for this
 // subscriber only, never blocking the fan-out loop.
 func startSubscriberWriter(sub *SubscriberState) {
+	sub.wg.Add(1)
 	go func() {
+		defer sub.wg.Done()
 		for {
 			select {
 			case <-sub.ctx.Done():
 				return
-			case pkt, ok := <-sub.writeCh:
+			case qp, ok := <-sub.writeCh:
 				if !ok {
 					return
 				}
-				sub.LocalTrack.WriteRTP(pkt)
-				returnPacket(pkt) // Return cloned packet to pool
+				if qp.readAt != 0 {
+					sub.observeForwarding(qp.readAt)
+				}
+				if err := sub.LocalTrack.WriteRTP(qp.packet); err == nil {
+					sub.sent(qp.packet)
+				} else {
+					sub.writeFailed(err)
+				}
+				returnPacket(qp.packet) // Return cloned packet to pool
 			}
 		}
 	}()
 }
 
+// startRTCPDrain reads the subscriber's RTCP feedback until its sender is
+// stopped. ReadRTCP cannot select on ctx, so stopping the sender is what ends
+// it.
+func startRTCPDrain(sub *SubscriberState, mt *MediaTrack) {
+	sub.wg.Add(1)
+	go func() {
+		defer sub.wg.Done()
+		readSubscriberRTCP(mt, sub.Sender, sub.Peer)
+	}()
+}
+
 func NewRoom(name string, maxPeers int, logger *zap.Logger) *Room {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Room{
@@ -250,27 +516,29 @@ func NewRoom(name string, maxPeers int, logger *zap.Logger) *Room {
 		MaxPeers:    maxPeers,
 		Peers:       make(map[string]*peer.Peer),
 		peersByUser: make(map[string]string),
-		peerCount:   0,
 		MediaTracks: make(map[string]*MediaTrack),
-		Settings: &RoomSettings{
-			AudioEnabled:       true,
-			VideoEnabled:       true,
-			ScreenShareEnabled: true,
-			RecordingEnabled:   false,
-			MaxVideoBitrate:    2000000,
-			MaxAudioBitrate:    128000,
-		},
+		trackHandles: make(map[string]string),
+		sourceIDs:    make(map[string]string),
+		replacements: make(map[string]map[string]string),
+		codecGroups:  make(map[string]*codecGroup),
+		groupByTrack: make(map[string]*codecGroup),
+		pendingForwards: make(map[string]*pendingForwards),
+		dataReplayed: make(map[string]bool),
+		Settings:    DefaultSettings(),
 		ctx:                 ctx,
 		cancel:              cancel,
 		AllowedCodecs:       defaultAllowedCodecs,
-		renegotiationTimers: make(map[string]*time.Timer),
-		lastRenegotiation:   make(map[string]time.Time),
+		renegotiation:       make(map[string]*renegotiationState),
 		renegotiationDelay:  150 * time.Millisecond,
+		keyframeInterval:    time.Second,
 		maxRTPErrors:        50,
 		simulcastEnabled:    false,
 		audioLevels:         make(map[string]*AudioLevel),
+		speakerThreshold:    defaultSpeakerThreshold,
+		talkTime:            make(map[string]time.Duration),
 		statsInterval:       3 * time.Second,
 		speakerDetectionInterval: 200 * time.Millisecond,
+		quality:             summarizeQuality(nil, time.Now()),
 		logger:              logger,
 	}
 }
@@ -287,6 +555,37 @@ func (r *Room) SetMaxRTPErrors(n int) {
 	r.maxRTPErrors = n
 }
 
+func (r *Room) SetMaxTracks(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxTracks = n
+}
+
+func (r *Room) SetMaxObservers(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxObservers = n
+}
+
+func (r *Room) GetObserverCount() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, observers := r.memberCountsLocked()
+	return observers
+}
+
+func (r *Room) GetMaxTracks() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.maxTracks
+}
+
+func (r *Room) GetTrackCount() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.MediaTracks)
+}
+
 func (r *Room) SetSimulcastEnabled(v bool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -308,7 +607,8 @@ func (r *Room) SetSpeakerDetectionInterval(d time.Duration) {
 func (r *Room) GetPeerCount() int {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	return r.peerCount
+	participants, _ := r.memberCountsLocked()
+	return participants
 }
 
 func (r *Room) AddPeer(p *peer.Peer) error {
@@ -321,56 +621,130 @@ func (r *Room) AddPeer(p *peer.Peer) error {
 	if r.State == RoomStateInactive {
 		r.State = RoomStateActive
 	}
-	if r.peerCount >= r.MaxPeers {
+	r.wakeLocked("peer_joined")
+	participants, observers := r.memberCountsLocked()
+	if p.Observer {
+		if r.maxObservers > 0 && observers >= r.maxObservers {
+			return fmt.Errorf("room observer limit reached")
+		}
+	} else if participants >= r.MaxPeers {
 		return fmt.Errorf("room is full")
 	}
 	if _, exists := r.Peers[p.ID]; exists {
 		return fmt.Errorf("peer already exists in room")
 	}
+	// A user has one peer per room; a second concurrent join for the same
+	// user loses instead of orphaning the first peer.
+	if _, exists := r.Peers[r.peersByUser[p.UserID]]; exists {
+		return ErrUserInRoom
+	}
 
-	p.OnTrackAdded = r.handlePeerTrackAdded
-	p.OnTrackRemoved = r.handlePeerTrackRemoved
-	p.OnDisconnected = r.handlePeerDisconnected
-
+	r.wirePeerLocked(p)
 	r.Peers[p.ID] = p
 	r.peersByUser[p.UserID] = p.ID
-	r.peerCount++
+	r.applyUserPriority(p)
+	r.spotlightJoinedLocked(p)
+	r.initPendingForwards(p)
+	if p.Observer {
+		observers++
+	} else {
+		participants++
+	}
 	r.UpdatedAt = time.Now()
+	r.recordJoin(p, r.UpdatedAt)
+	r.recordEvent(RoomEvent{Type: EventPeerJoined, PeerID: p.ID, UserID: p.UserID, At: r.UpdatedAt})
+	hostChange, hostChanged := r.hostJoinedLocked(p, r.UpdatedAt)
+	r.checkConsistencyLocked("add")
 
 	r.logger.Info("Peer joined room",
 		zap.String("roomID", r.ID),
 		zap.String("peerID", p.ID),
 		zap.String("userName", p.Name),
-		zap.Int("peerCount", r.peerCount),
+		zap.Bool("observer", p.Observer),
+		zap.Int("peerCount", participants),
 	)
 
-	if r.OnPeerJoined != nil {
+	if r.OnPeerJoined != nil && !r.silenced() {
 		r.OnPeerJoined(r, p)
 	}
+	if hostChanged && r.OnHostChanged != nil && !r.silenced() {
+		r.OnHostChanged(r, hostChange)
+	}
 
 	return nil
 }
 
+// wirePeerLocked hands p's events to the room. MUST be called with r.mu
+// held.
+func (r *Room) wirePeerLocked(p *peer.Peer) {
+	p.OnTrackAdded = r.handlePeerTrackAdded
+	p.OnTrackRemoved = r.handlePeerTrackRemoved
+	p.OnDisconnected = r.handlePeerDisconnected
+	p.OnDataChannelOpen = r.handlePeerDataChannelOpen
+	p.OnConnectionInterrupted = r.handlePeerInterrupted
+	p.OnConnectionRestored = r.handlePeerRestored
+	p.OnNegotiated = r.handlePeerNegotiated
+	p.OnConnectionStateNotify = r.handlePeerConnectionState
+	p.SetDisconnectGrace(r.disconnectGrace, r.holdOnFailure)
+
+	r.dataMu.Lock()
+	p.SetDataChannelQueue(r.dataQueueSize, r.dataQueueTTL)
+	r.dataMu.Unlock()
+}
+
+// RemovePeer removes a peer and its tracks. It is idempotent: the eviction
+// of a rejoining user and the disconnect of its old connection may both
+// remove the same peer, and whichever comes second gets ErrPeerNotFound and
+// changes nothing.
 func (r *Room) RemovePeer(peerID string) error {
+	return r.removePeer(peerID, nil, false)
+}
+
+// EvictPeer removes the peer of a user who is rejoining. Unlike RemovePeer
+// it leaves the user's host role, spotlight and place in line for the peer
+// that replaces it.
+func (r *Room) EvictPeer(peerID string) error {
+	return r.removePeer(peerID, nil, true)
+}
+
+// RemovePeerIfCurrent removes p unless a reconnect has replaced it under
+// its ID (see ReplacePeer), for callers that hold a peer that may be stale.
+func (r *Room) RemovePeerIfCurrent(p *peer.Peer) error {
+	return r.removePeer(p.ID, p, false)
+}
+
+// removePeer removes peerID; with only set, only if peerID is still that
+// peer.
+func (r *Room) removePeer(peerID string, only *peer.Peer, rejoining bool) error {
 	r.mu.Lock()
 
 	p, exists := r.Peers[peerID]
-	if !exists {
+	if !exists || (only != nil && p != only) {
 		r.mu.Unlock()
-		return fmt.Errorf("peer not found in room")
+		return ErrPeerNotFound
 	}
 
-	affectedPeers := r.removePeerTracks(peerID)
+	affectedPeers, removedTracks, stoppedSubs := r.removePeerTracks(peerID)
 
 	delete(r.Peers, peerID)
-	delete(r.peersByUser, p.UserID)
-	r.peerCount--
+	var hostChange HostChange
+	var spotlightChange SpotlightChange
+	hostChanged, spotlightChanged := false, false
+	if r.peersByUser[p.UserID] == peerID {
+		delete(r.peersByUser, p.UserID)
+		hostChange, hostChanged = r.hostLeftLocked(p, rejoining)
+		spotlightChange, spotlightChanged = r.spotlightLeftLocked(p, rejoining)
+	}
+	delete(r.replacements, peerID)
 	r.UpdatedAt = time.Now()
-	peerCount := r.peerCount
+	r.recordLeave(p, r.UpdatedAt)
+	r.recordEvent(RoomEvent{Type: EventPeerLeft, PeerID: p.ID, UserID: p.UserID, At: r.UpdatedAt})
+	peerCount, observers := r.memberCountsLocked()
 
-	if peerCount == 0 {
-		r.State = RoomStateInactive
+	if peerCount == 0 && observers == 0 {
+		r.setStateLocked(RoomStateInactive)
 	}
+	r.checkConsistencyLocked("remove")
 
 	r.logger.Info("Peer left room",
 		zap.String("roomID", r.ID),
@@ -378,12 +752,21 @@ func (r *Room) RemovePeer(peerID string) error {
 		zap.Int("peerCount", peerCount),
 	)
 
-	if r.OnPeerLeft != nil {
+	if r.OnPeerLeft != nil && !r.silenced() {
 		r.OnPeerLeft(r, p)
 	}
+	if hostChanged && r.OnHostChanged != nil && !r.silenced() {
+		r.OnHostChanged(r, hostChange)
+	}
+	if spotlightChanged && r.OnSpotlightChanged != nil && !r.silenced() {
+		r.OnSpotlightChanged(r, spotlightChange)
+	}
 
 	r.mu.Unlock()
 
+	// Forwarding goroutines tied to the peer must be gone before it is closed.
+	r.waitSubscribers(stoppedSubs)
+
 	// Clean up audio levels
 	r.audioLevelsMu.Lock()
 	delete(r.audioLevels, peerID)
@@ -392,17 +775,26 @@ func (r *Room) RemovePeer(peerID string) error {
 	}
 	r.audioLevelsMu.Unlock()
 
-	// Stop renegotiation timers
-	r.renegotiationMu.Lock()
-	if timer, ok := r.renegotiationTimers[peerID]; ok {
-		timer.Stop()
-		delete(r.renegotiationTimers, peerID)
+	r.dataMu.Lock()
+	delete(r.dataReplayed, peerID)
+	r.dataMu.Unlock()
+
+	r.dropRenegotiationState(peerID)
+	r.dropConnState(p)
+	r.dropPendingForwards(peerID)
+	r.dropPriorities(peerID, removedTracks)
+	r.dropReceivePreferences(peerID, removedTracks)
+	r.dropPeerCodecGroups(peerID)
+
+	for _, mt := range removedTracks {
+		r.recordEvent(RoomEvent{Type: EventTrackRemoved, PeerID: p.ID, UserID: p.UserID, TrackID: mt.Handle})
+		if r.OnTrackRemoved != nil && !r.silenced() {
+			r.OnTrackRemoved(r, p, mt)
+		}
 	}
-	delete(r.lastRenegotiation, peerID)
-	r.renegotiationMu.Unlock()
 
 	for _, ap := range affectedPeers {
-		r.triggerRenegotiation(ap)
+		r.triggerRenegotiation(ap, RenegotiatePeerLeft)
 	}
 
 	p.Close()
@@ -439,28 +831,6 @@ func (r *Room) GetAllPeers() []*peer.Peer {
 	return peers
 }
 
-func (r *Room) BroadcastMessage(message []byte, excludePeerID string) {
-	r.mu.RLock()
-	peers := make([]*peer.Peer, 0, len(r.Peers))
-	for _, p := range r.Peers {
-		if p.ID != excludePeerID && p.IsConnected() {
-			peers = append(peers, p)
-		}
-	}
-	r.mu.RUnlock()
-
-	for _, p := range peers {
-		go func(pr *peer.Peer) {
-			if err := pr.SendDataChannelMessage(message); err != nil {
-				r.logger.Debug("Failed to send message to peer",
-					zap.String("peerID", pr.ID),
-					zap.Error(err),
-				)
-			}
-		}(p)
-	}
-}
-
 func (r *Room) handlePeerTrackAdded(p *peer.Peer, track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
 	codecMime := track.Codec().MimeType
 	if !r.isCodecAllowed(codecMime) {
@@ -471,28 +841,69 @@ func (r *Room) handlePeerTrackAdded(p *peer.Peer, track *webrtc.TrackRemote, rec
 		return
 	}
 
-	baseTrackID := track.StreamID() + ":" + track.Kind().String()
+	// Observers are receive-only; a published track would reveal them.
+	if p.Observer {
+		r.rejectTrack(p, track.ID(), "observer_cannot_publish")
+		return
+	}
+	if p.Viewer || p.PublishRevoked() {
+		r.rejectTrack(p, track.ID(), RejectPublisherRoleRequired)
+		return
+	}
+
+	if r.replaceSource(p, track) {
+		return
+	}
+
+	layer := p.RemoteLayer(track)
+	if !r.simulcastEnabled {
+		layer.RID, layer.Mode = "", ""
+	}
+	baseTrackID := layer.StreamID + ":" + track.Kind().String()
+
+	r.mu.RLock()
+	_, duplicate := r.sourceTrackLocked(layer.TrackID)
+	r.mu.RUnlock()
+
+	// AdmitTrack may inspect other rooms, so it runs without r.mu held.
+	if r.AdmitTrack != nil && !duplicate {
+		if reason := r.AdmitTrack(r, p, track); reason != "" {
+			r.rejectTrack(p, layer.TrackID, reason)
+			return
+		}
+	}
 
 	r.mu.Lock()
 
 	// ---- Handle duplicate OnTrack for same track ID ----
-	// Pion may fire OnTrack multiple times for the same track ID (e.g. once
-	// with RID="" then again with RID="h"). Just ignore duplicates.
-	if _, ok := r.MediaTracks[track.ID()]; ok {
+	// Pion fires OnTrack once per simulcast layer, all with the same track
+	// ID; later layers join the track (see simulcast.go). Other duplicates
+	// are ignored.
+	if mt, ok := r.sourceTrackLocked(layer.TrackID); ok {
+		added := r.addLayerLocked(mt, p, track, layer)
 		r.mu.Unlock()
+		if added {
+			go r.startLayerFanOut(mt, layer.RID)
+			return
+		}
 		r.logger.Debug("Ignoring duplicate OnTrack",
 			zap.String("peerID", p.ID),
-			zap.String("trackID", track.ID()),
-			zap.String("rid", track.RID()),
+			zap.String("trackID", layer.TrackID),
+			zap.String("rid", layer.RID),
 		)
 		return
 	}
 
-	// ---- Non-simulcast track ----
+	if r.maxTracks > 0 && len(r.MediaTracks) >= r.maxTracks {
+		r.mu.Unlock()
+		r.rejectTrack(p, layer.TrackID, "room_track_limit")
+		return
+	}
+
 	trackCtx, trackCancel := context.WithCancel(r.ctx)
 
 	mediaTrack := &MediaTrack{
-		ID:            track.ID(),
+		ID:            layer.TrackID,
 		PeerID:        p.ID,
 		Kind:          track.Kind().String(),
 		Track:         track,
@@ -506,10 +917,19 @@ func (r *Room) handlePeerTrackAdded(p *peer.Peer, track *webrtc.TrackRemote, rec
 		IsSimulcast:   false,
 		BaseTrackID:   baseTrackID,
 		Layers:        make(map[string]*SimulcastLayer),
+
+		fanOutThreshold: r.fanOutThreshold,
+		path:            pathFor(track.Kind()),
+	}
+	mediaTrack.src.Store(newTrackSource(trackCtx, layer.TrackID, track, nil))
+	if layer.RID != "" {
+		mediaTrack.IsSimulcast = true
+		mediaTrack.SimulcastMode = layer.Mode
+		mediaTrack.Layers[layer.RID] = &SimulcastLayer{RID: layer.RID, Track: track, Active: true}
 	}
 
 	if track.Kind() == webrtc.RTPCodecTypeVideo {
-		if track.StreamID() == "screen" {
+		if layer.StreamID == "screen" {
 			mediaTrack.MediaType = peer.MediaTypeScreen
 		} else {
 			mediaTrack.MediaType = peer.MediaTypeVideo
@@ -518,26 +938,56 @@ func (r *Room) handlePeerTrackAdded(p *peer.Peer, track *webrtc.TrackRemote, rec
 		mediaTrack.MediaType = peer.MediaTypeAudio
 	}
 
-	r.MediaTracks[track.ID()] = mediaTrack
+	mediaTrack.Handle = r.newTrackHandle()
+	r.MediaTracks[layer.TrackID] = mediaTrack
+	r.trackHandles[mediaTrack.Handle] = layer.TrackID
+	r.joinCodecGroup(mediaTrack)
 	r.mu.Unlock()
 
 	r.logger.Debug("Track added to room",
 		zap.String("peerID", p.ID),
-		zap.String("trackID", track.ID()),
+		zap.String("trackID", layer.TrackID),
+		zap.String("handle", mediaTrack.Handle),
 		zap.String("kind", track.Kind().String()),
+		zap.String("rid", layer.RID),
 	)
 
-	if r.OnTrackAdded != nil {
+	r.recordEvent(RoomEvent{Type: EventTrackPublished, PeerID: p.ID, UserID: p.UserID, TrackID: mediaTrack.Handle})
+	if r.OnTrackAdded != nil && !r.silenced() {
 		r.OnTrackAdded(r, p, mediaTrack)
 	}
 
-	go r.startFanOutForwarding(mediaTrack)
-	go r.forwardTrackToOtherPeers(mediaTrack, p.ID)
+	if mediaTrack.IsSimulcast {
+		go r.startLayerFanOut(mediaTrack, layer.RID)
+	} else {
+		go r.startFanOutForwarding(mediaTrack)
+	}
+	if mediaTrack.group != nil {
+		go r.forwardGroupToOtherPeers(mediaTrack.group, p.ID)
+	} else {
+		go r.forwardTrackToOtherPeers(mediaTrack, p.ID)
+	}
 	if mediaTrack.Kind == "video" {
 		go r.smartPLI(mediaTrack)
 	}
 }
 
+// rejectTrack refuses a published track: it is never forwarded and the owner
+// is notified so the client can stop sending it.
+func (r *Room) rejectTrack(p *peer.Peer, trackID, reason string) {
+	r.logger.Warn("Rejected track by admission control",
+		zap.String("roomID", r.ID),
+		zap.String("peerID", p.ID),
+		zap.String("trackID", trackID),
+		zap.String("reason", reason),
+	)
+	r.countCallError(CallErrorTrackRejected)
+	r.recordEvent(RoomEvent{Type: EventTrackRejected, PeerID: p.ID, UserID: p.UserID, TrackID: trackID, Detail: reason})
+	if r.OnTrackRejected != nil && !r.silenced() {
+		r.OnTrackRejected(r, p, trackID, reason)
+	}
+}
+
 func (r *Room) isCodecAllowed(mimeType string) bool {
 	if len(r.AllowedCodecs) == 0 {
 		return true
@@ -551,66 +1001,30 @@ func (r *Room) isCodecAllowed(mimeType string) bool {
 }
 
 func (r *Room) handlePeerTrackRemoved(p *peer.Peer, trackID string) {
-	r.mu.Lock()
-	mt, exists := r.MediaTracks[trackID]
-	if exists {
-		if mt.cancel != nil {
-			mt.cancel()
-		}
-		delete(r.MediaTracks, trackID)
-	}
-	r.mu.Unlock()
-
-	if r.OnTrackRemoved != nil {
-		r.OnTrackRemoved(r, p, trackID)
-	}
-}
-
-func (r *Room) handlePeerDisconnected(p *peer.Peer) {
-	r.RemovePeer(p.ID)
-}
-
-// AddExistingTracksToPeer adds all existing tracks to a new peer's connection
-// synchronously, WITHOUT triggering renegotiation.
-func (r *Room) AddExistingTracksToPeer(newPeer *peer.Peer) int {
 	r.mu.RLock()
-	tracks := make([]*MediaTrack, 0)
-	for _, track := range r.MediaTracks {
-		if track.PeerID != newPeer.ID {
-			tracks = append(tracks, track)
-		}
-	}
+	mt, exists := r.sourceTrackLocked(trackID)
 	r.mu.RUnlock()
 
-	added := 0
-	for _, mediaTrack := range tracks {
-		r.logger.Info("Adding existing track to new peer",
-			zap.String("newPeerID", newPeer.ID),
-			zap.String("trackID", mediaTrack.ID),
-			zap.String("kind", mediaTrack.Kind),
-			zap.String("fromPeer", mediaTrack.PeerID),
-		)
-		if r.forwardTrackToPeerDirect(mediaTrack, newPeer) {
-			added++
-		}
+	// Only the current source speaks for the track; a replaced one is gone,
+	// as is a peer replaced by a reconnect
+	if exists && mt.PeerID == p.ID && mt.source().id == trackID && r.isCurrentPeer(p) {
+		r.removeTrack(p, mt)
 	}
+}
 
-	if added > 0 {
-		r.logger.Info("Added existing tracks to new peer before answer",
-			zap.String("newPeerID", newPeer.ID),
-			zap.Int("trackCount", added),
-		)
-		// PLI will be sent automatically by smartPLI via the needsPLI flag
+func (r *Room) handlePeerDisconnected(p *peer.Peer) {
+	if !r.isCurrentPeer(p) {
+		return // replaced by a reconnect
 	}
-
-	return added
+	r.countCallError(CallErrorConnectionLost)
+	r.RemovePeerIfCurrent(p)
 }
 
 func (r *Room) forwardTrackToOtherPeers(mediaTrack *MediaTrack, excludePeerID string) {
 	r.mu.RLock()
 	peers := make([]*peer.Peer, 0)
 	for _, p := range r.Peers {
-		if p.ID != excludePeerID && p.Connection != nil {
+		if p.ID != excludePeerID && p.Connection != nil && !p.ManualSubscribe {
 			peers = append(peers, p)
 		}
 	}
@@ -629,8 +1043,15 @@ func (r *Room) forwardTrackToOtherPeers(mediaTrack *MediaTrack, excludePeerID st
 }
 
 func (r *Room) forwardTrackToPeer(mediaTrack *MediaTrack, targetPeer *peer.Peer) {
+	if r.queueForward(mediaTrack, nil, targetPeer) {
+		return
+	}
+	if !r.admitSubscriber(mediaTrack, targetPeer) {
+		return
+	}
+
 	if r.forwardTrackToPeerDirect(mediaTrack, targetPeer) {
-		r.triggerRenegotiation(targetPeer)
+		r.triggerRenegotiation(targetPeer, RenegotiateTrackChange)
 		// PLI will be sent automatically by smartPLI via the needsPLI flag
 		return
 	}
@@ -641,10 +1062,17 @@ func (r *Room) forwardTrackToPeer(mediaTrack *MediaTrack, targetPeer *peer.Peer)
 		zap.String("trackID", mediaTrack.ID),
 		zap.String("toPeer", targetPeer.ID),
 	)
-	r.triggerRenegotiation(targetPeer)
+	r.triggerRenegotiation(targetPeer, RenegotiateRetry)
 
 	go func() {
-		time.Sleep(2 * time.Second) // wait for renegotiation round-trip
+		// Wait for the renegotiation round-trip
+		select {
+		case <-time.After(2 * time.Second):
+		case <-targetPeer.Context().Done():
+			return
+		case <-r.ctx.Done():
+			return
+		}
 		r.mu.RLock()
 		_, stillExists := r.Peers[targetPeer.ID]
 		r.mu.RUnlock()
@@ -652,7 +1080,7 @@ func (r *Room) forwardTrackToPeer(mediaTrack *MediaTrack, targetPeer *peer.Peer)
 			return
 		}
 		if r.forwardTrackToPeerDirect(mediaTrack, targetPeer) {
-			r.triggerRenegotiation(targetPeer)
+			r.triggerRenegotiation(targetPeer, RenegotiateTrackChange)
 		}
 	}()
 }
@@ -670,10 +1098,19 @@ func (r *Room) forwardTrackToPeerDirect(mediaTrack *MediaTrack, targetPeer *peer
 		return false
 	}
 
+	// Alternatives of a codec group all appear under the group handle
+	localID := mediaTrack.Handle
+	if mediaTrack.group != nil {
+		localID = mediaTrack.group.Handle
+	}
+	streamID := mediaTrack.PeerID
+	if isMonitor(mediaTrack, targetPeer.ID) {
+		streamID = MonitorStreamID
+	}
 	localTrack, err := webrtc.NewTrackLocalStaticRTP(
-		webrtc.RTPCodecCapability{MimeType: mediaTrack.Track.Codec().MimeType},
-		mediaTrack.ID+"_to_"+targetPeer.ID,
-		mediaTrack.PeerID,
+		forwardCapability(mediaTrack.Track.Codec()),
+		localID,
+		streamID,
 	)
 	if err != nil {
 		r.logger.Error("Failed to create local track",
@@ -693,53 +1130,59 @@ func (r *Room) forwardTrackToPeerDirect(mediaTrack *MediaTrack, targetPeer *peer
 		return false
 	}
 
-	// Drain RTCP from sender so Pion's internal buffer doesn't fill up and stall
-	go func() {
-		buf := make([]byte, 1500)
-		for {
-			if _, _, err := sender.Read(buf); err != nil {
-				return
-			}
-		}
-	}()
-
 	// Determine default RID for simulcast subscribers
 	defaultRID := ""
 	if mediaTrack.IsSimulcast {
-		defaultRID = "h" // default to highest quality
-		mediaTrack.mu.RLock()
-		if _, ok := mediaTrack.Layers["h"]; !ok {
-			for rid := range mediaTrack.Layers {
-				defaultRID = rid
-				break
-			}
-		}
-		mediaTrack.mu.RUnlock()
+		defaultRID = r.defaultLayer(mediaTrack, targetPeer.ID)
 	}
 
 	subCtx, subCancel := context.WithCancel(mediaTrack.ctx)
 	sub := &SubscriberState{
 		PeerID:     targetPeer.ID,
+		Peer:       targetPeer,
 		Sender:     sender,
 		LocalTrack: localTrack,
 		CurrentRID: defaultRID,
-		writeCh:    make(chan *rtp.Packet, 60), // ~60 packets ≈ 1s video at 60fps
 		ctx:        subCtx,
 		cancel:     subCancel,
+		stats:      &r.forwarded,
+		delays:     r.forwardingDelays.Load(),
+		kind:       mediaTrack.path.name,
 	}
+	// The subscription also ends when the subscribing peer is closed.
+	sub.unlink = context.AfterFunc(targetPeer.Context(), subCancel)
+	r.watchWrites(mediaTrack, sub)
 
-	// Start dedicated writer goroutine for this subscriber
-	startSubscriberWriter(sub)
+	// Start dedicated writer (queued paths only) and RTCP drain goroutines
+	// for this subscriber
+	if mediaTrack.path.queued {
+		sub.writeCh = make(chan queuedPacket, 60) // ~60 packets ≈ 1s video at 60fps
+		startSubscriberWriter(sub)
+	}
+	startRTCPDrain(sub, mediaTrack)
 
 	mediaTrack.mu.Lock()
+	resume := false
+	if mediaTrack.IsSimulcast {
+		mediaTrack.layerUse.init()
+		resume = r.routeToLayerLocked(mediaTrack, sub, defaultRID)
+	}
 	mediaTrack.Subscribers[targetPeer.ID] = sub
 	mediaTrack.LocalTracks[targetPeer.ID] = localTrack
 	mediaTrack.rebuildSnapshot()
 	mediaTrack.mu.Unlock()
+	if resume {
+		go r.requestLayerResume(mediaTrack)
+	}
 
 	// Signal that a new subscriber needs a keyframe
 	mediaTrack.needsPLI.Store(true)
 
+	// Fit the new layer into the subscriber's bandwidth budget
+	if mediaTrack.IsSimulcast && targetPeer.GetBandwidthLimit() > 0 {
+		go r.AllocateLayers(targetPeer.ID)
+	}
+
 	r.logger.Debug("Track forwarded",
 		zap.String("trackID", mediaTrack.ID),
 		zap.String("kind", mediaTrack.Kind),
@@ -762,21 +1205,7 @@ func (r *Room) smartPLI(mediaTrack *MediaTrack) {
 	defer safetyTicker.Stop()
 
 	sendPLI := func() {
-		r.mu.RLock()
-		sourcePeer, exists := r.Peers[mediaTrack.PeerID]
-		r.mu.RUnlock()
-		if !exists || sourcePeer == nil {
-			return
-		}
-		if mediaTrack.IsSimulcast {
-			mediaTrack.mu.RLock()
-			for _, layer := range mediaTrack.Layers {
-				sourcePeer.SendPLI(uint32(layer.Track.SSRC()))
-			}
-			mediaTrack.mu.RUnlock()
-		} else {
-			sourcePeer.SendPLI(uint32(mediaTrack.Track.SSRC()))
-		}
+		r.sendKeyframeRequest(mediaTrack, false)
 	}
 
 	for {
@@ -793,11 +1222,11 @@ func (r *Room) smartPLI(mediaTrack *MediaTrack) {
 	}
 }
 
-// startFanOutForwarding reads RTP from a non-simulcast track and dispatches
-// packets to per-subscriber write channels. The fan-out loop is fully lock-free
-// (uses atomic snapshot). Per-subscriber channels decouple slow receivers from
-// the hot loop — if a subscriber's buffer is full the packet is dropped for
-// that subscriber only, never blocking anyone else.
+// startFanOutForwarding reads RTP from a non-simulcast track and runs it
+// down the track's forwarding path (see pipeline.go): audio is written to
+// subscribers directly, video through per-subscriber write channels that
+// decouple slow receivers from the hot loop. The fan-out loop is fully
+// lock-free (uses atomic snapshot).
 func (r *Room) startFanOutForwarding(mediaTrack *MediaTrack) {
 	mediaTrack.mu.Lock()
 	if mediaTrack.fanOutStarted {
@@ -807,70 +1236,45 @@ func (r *Room) startFanOutForwarding(mediaTrack *MediaTrack) {
 	mediaTrack.fanOutStarted = true
 	mediaTrack.mu.Unlock()
 
+	r.forwardSource(mediaTrack, mediaTrack.source())
+}
+
+// forwardSource forwards src, one of the sources feeding mediaTrack, until it
+// ends or is replaced.
+func (r *Room) forwardSource(mediaTrack *MediaTrack, src *trackSource) {
 	r.logger.Debug("Starting fan-out forwarding",
 		zap.String("trackID", mediaTrack.ID),
+		zap.String("sourceID", src.id),
 		zap.String("kind", mediaTrack.Kind),
 	)
 
-	isAudio := mediaTrack.Kind == "audio"
-	packetCount := 0
-
-	for {
-		select {
-		case <-mediaTrack.ctx.Done():
-			goto done
-		default:
-		}
-
-		// If this track was upgraded to simulcast, stop the non-simulcast
-		// fan-out so the per-layer fan-outs take over exclusively.
-		if mediaTrack.IsSimulcast {
-			r.logger.Debug("Fan-out yielding to simulcast layer fan-outs",
-				zap.String("trackID", mediaTrack.ID),
-			)
-			goto done
-		}
-
-		packet, _, err := mediaTrack.Track.ReadRTP()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			select {
-			case <-mediaTrack.ctx.Done():
-				goto done
-			default:
-			}
-			time.Sleep(5 * time.Millisecond)
-			continue
-		}
-
-		// Lock-free read of subscriber list via atomic snapshot
-		// Clone each packet before dispatching to prevent data races
-		snap := mediaTrack.getSnapshot()
-		for _, sub := range snap {
-			clone := clonePacket(packet)
-			select {
-			case sub.writeCh <- clone:
-				// dispatched — subscriber writer will return to pool
-			default:
-				// subscriber's buffer is full — drop for THIS peer only
-				returnPacket(clone) // Return unused clone to pool
-			}
-		}
-
-		packetCount++
+	publisher, _ := r.GetPeer(mediaTrack.PeerID)
+	policing := r.newTrackPolicing(publisher, mediaTrack, "", src.track)
 
-		if isAudio {
-			r.trackAudioActivity(mediaTrack.PeerID)
-		}
+	var packetCount int
+	var ended bool
+	if mediaTrack.path == audioPath {
+		packetCount, ended = r.forwardAudio(mediaTrack, src, publisher, policing)
+	} else {
+		packetCount, ended = r.forwardVideo(mediaTrack, src, publisher, policing)
 	}
 
-done:
 	r.logger.Debug("Fan-out stopped",
 		zap.String("trackID", mediaTrack.ID),
+		zap.String("sourceID", src.id),
+		zap.String("path", mediaTrack.path.name),
 		zap.Int("packets", packetCount),
 	)
+
+	// The publisher stopped sending the track, e.g. it was removed from its
+	// PeerConnection: unpublish it rather than keep a ghost in the room,
+	// unless a declared replacement is on its way
+	if !ended || publisher == nil || mediaTrack.source() != src {
+		return
+	}
+	if !r.awaitReplacement(publisher, mediaTrack, src) {
+		publisher.RemoveTrack(src.id)
+	}
 }
 
 // startLayerFanOut reads RTP from a specific simulcast layer and writes only to
@@ -887,6 +1291,9 @@ func (r *Room) startLayerFanOut(mediaTrack *MediaTrack, rid string) {
 		zap.String("trackID", mediaTrack.ID),
 		zap.String("rid", rid),
 	)
+	publisher, _ := r.GetPeer(mediaTrack.PeerID)
+	policing := r.newTrackPolicing(publisher, mediaTrack, rid, layer.Track)
+	sampler := r.newLatencySampler(mediaTrack)
 
 	for {
 		select {
@@ -909,29 +1316,35 @@ func (r *Room) startLayerFanOut(mediaTrack *MediaTrack, rid string) {
 			time.Sleep(5 * time.Millisecond)
 			continue
 		}
+		readAt := sampler.sample(packet)
+		mediaTrack.tapInbound(packet)
+		if publisher != nil {
+			publisher.TouchMediaReceived()
+		}
+		if layer.resuming.Load() && layer.resuming.CompareAndSwap(true, false) {
+			go r.layerResumed(mediaTrack, rid)
+		}
 
-		// Lock-free read; clone and dispatch to per-subscriber buffer
-		snap := mediaTrack.getSnapshot()
-		for _, sub := range snap {
-			if sub.CurrentRID == rid {
-				clone := clonePacket(packet)
-				select {
-				case sub.writeCh <- clone:
-					// dispatched — subscriber writer will return to pool
-				default:
-					// buffer full — drop for this subscriber only
-					returnPacket(clone)
-				}
+		// A policed publisher's subscribers all get its lowest layer, the
+		// only one that gets past policing
+		layered := true
+		if policing != nil {
+			if !policing.forward(packet) {
+				continue
 			}
+			layered = !policing.active()
 		}
+
+		// Lock-free read; clone and dispatch to subscribers on this layer
+		r.fanOut(mediaTrack, fanOutItem{packet: packet, rid: rid, layered: layered, readAt: readAt})
 	}
 }
 
-// SwitchLayer changes which simulcast layer a subscriber receives.
+// SwitchLayer changes which simulcast layer a subscriber receives, keeping
+// within its receive preference. mediaTrackID may be a track handle or a
+// deprecated raw track ID.
 func (r *Room) SwitchLayer(mediaTrackID, subscriberPeerID, targetRID string) error {
-	r.mu.RLock()
-	mt, exists := r.MediaTracks[mediaTrackID]
-	r.mu.RUnlock()
+	mt, exists := r.ResolveTrack(mediaTrackID)
 
 	if !exists {
 		return fmt.Errorf("track not found: %s", mediaTrackID)
@@ -940,6 +1353,10 @@ func (r *Room) SwitchLayer(mediaTrackID, subscriberPeerID, targetRID string) err
 		return fmt.Errorf("track is not simulcast")
 	}
 
+	return r.switchSubscriberLayer(mt, subscriberPeerID, r.capLayer(mt, subscriberPeerID, targetRID))
+}
+
+func (r *Room) switchSubscriberLayer(mt *MediaTrack, subscriberPeerID, targetRID string) error {
 	mt.mu.Lock()
 	defer mt.mu.Unlock()
 
@@ -952,10 +1369,22 @@ func (r *Room) SwitchLayer(mediaTrackID, subscriberPeerID, targetRID string) err
 		return fmt.Errorf("subscriber not found: %s", subscriberPeerID)
 	}
 
-	sub.CurrentRID = targetRID
+	mt.layerUse.init()
+	if r.routeToLayerLocked(mt, sub, targetRID) {
+		go r.requestLayerResume(mt)
+	}
+	if sub.CurrentRID != targetRID {
+		r.logger.Info("Layer switch held until the layer resumes",
+			zap.String("trackID", mt.Handle),
+			zap.String("subscriber", subscriberPeerID),
+			zap.String("layer", targetRID),
+			zap.String("current", sub.CurrentRID),
+		)
+		return nil
+	}
 
 	r.logger.Info("Layer switched",
-		zap.String("trackID", mediaTrackID),
+		zap.String("trackID", mt.Handle),
 		zap.String("subscriber", subscriberPeerID),
 		zap.String("layer", targetRID),
 	)
@@ -983,9 +1412,7 @@ func (r *Room) SwitchLayer(mediaTrackID, subscriberPeerID, targetRID string) err
 
 // GetAvailableLayers returns the RIDs available for a simulcast track.
 func (r *Room) GetAvailableLayers(mediaTrackID string) []string {
-	r.mu.RLock()
-	mt, exists := r.MediaTracks[mediaTrackID]
-	r.mu.RUnlock()
+	mt, exists := r.ResolveTrack(mediaTrackID)
 
 	if !exists || !mt.IsSimulcast {
 		return nil
@@ -1004,9 +1431,13 @@ func (r *Room) GetAvailableLayers(mediaTrackID string) []string {
 }
 
 // removePeerTracks removes all tracks owned by peerID and cleans up subscriptions.
-func (r *Room) removePeerTracks(peerID string) []*peer.Peer {
+// It returns the subscribers that need renegotiation, the removed tracks, and
+// the stopped subscriptions whose goroutines the caller should wait for.
+func (r *Room) removePeerTracks(peerID string) ([]*peer.Peer, []*MediaTrack, []*SubscriberState) {
 	tracksToRemove := make([]string, 0)
+	removed := make([]*MediaTrack, 0)
 	affectedPeerSet := make(map[string]*peer.Peer)
+	var stopped []*SubscriberState
 
 	for trackID, mediaTrack := range r.MediaTracks {
 		if mediaTrack.PeerID == peerID {
@@ -1016,26 +1447,34 @@ func (r *Room) removePeerTracks(peerID string) []*peer.Peer {
 
 			mediaTrack.mu.Lock()
 			for subPeerID, sub := range mediaTrack.Subscribers {
-				sub.cancel() // stop subscriber writer goroutine
+				sub.stop()
 				if subPeer, ok := r.Peers[subPeerID]; ok {
-					if subPeer.Connection != nil {
-						if err := subPeer.Connection.RemoveTrack(sub.Sender); err != nil {
-							r.logger.Debug("Failed to remove track from subscriber",
-								zap.String("subPeer", subPeerID),
-								zap.Error(err),
-							)
-						}
+					// Keep the transceiver so the subscriber's m-lines stay aligned
+					if err := subPeer.ReleaseSender(sub.Sender); err != nil {
+						r.logger.Debug("Failed to remove track from subscriber",
+							zap.String("subPeer", subPeerID),
+							zap.Error(err),
+						)
+						sub.Sender.Stop()
 					}
 					affectedPeerSet[subPeerID] = subPeer
+				} else {
+					sub.Sender.Stop()
 				}
+				stopped = append(stopped, sub)
 			}
 			mediaTrack.mu.Unlock()
 
 			tracksToRemove = append(tracksToRemove, trackID)
+			removed = append(removed, mediaTrack)
 		} else {
 			mediaTrack.mu.Lock()
 			if sub, ok := mediaTrack.Subscribers[peerID]; ok {
-				sub.cancel() // stop subscriber writer goroutine
+				// The sender belongs to the leaving peer, whose
+				// PeerConnection is closed right after.
+				sub.stop()
+				sub.Sender.Stop()
+				stopped = append(stopped, sub)
 			}
 			delete(mediaTrack.Subscribers, peerID)
 			delete(mediaTrack.LocalTracks, peerID)
@@ -1045,6 +1484,10 @@ func (r *Room) removePeerTracks(peerID string) []*peer.Peer {
 	}
 
 	for _, trackID := range tracksToRemove {
+		if mt, ok := r.MediaTracks[trackID]; ok {
+			delete(r.trackHandles, mt.Handle)
+			r.forgetSourcesLocked(mt)
+		}
 		delete(r.MediaTracks, trackID)
 	}
 
@@ -1054,18 +1497,18 @@ func (r *Room) removePeerTracks(peerID string) []*peer.Peer {
 	for _, p := range affectedPeerSet {
 		affected = append(affected, p)
 	}
-	return affected
+	return affected, removed, stopped
 }
 
 // --- Dominant speaker detection ---
 
-func (r *Room) trackAudioActivity(peerID string) {
+func (r *Room) trackAudioActivity(peerID, userID string) {
 	r.audioLevelsMu.Lock()
 	defer r.audioLevelsMu.Unlock()
 
 	level, ok := r.audioLevels[peerID]
 	if !ok {
-		level = &AudioLevel{}
+		level = &AudioLevel{UserID: userID}
 		r.audioLevels[peerID] = level
 	}
 
@@ -1086,26 +1529,31 @@ func (r *Room) trackAudioActivity(peerID string) {
 }
 
 // StartDominantSpeakerDetection runs a goroutine that periodically computes the dominant speaker.
+// It stops while the room is dormant (see dormant.go).
 func (r *Room) StartDominantSpeakerDetection() {
-	go func() {
-		r.mu.RLock()
-		interval := r.speakerDetectionInterval
-		r.mu.RUnlock()
-		if interval <= 0 {
-			interval = 200 * time.Millisecond
-		}
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
+	r.mu.Lock()
+	r.dormancy.speakerStarted = true
+	ctx := r.loopsContextLocked()
+	interval := r.speakerDetectionInterval
+	r.goLoopLocked(func() { r.runDominantSpeakerDetection(ctx, interval) })
+	r.mu.Unlock()
+}
 
-		for {
-			select {
-			case <-r.ctx.Done():
-				return
-			case <-ticker.C:
-				r.computeDominantSpeaker()
-			}
+func (r *Room) runDominantSpeakerDetection(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 200 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.computeDominantSpeaker()
 		}
-	}()
+	}
 }
 
 func (r *Room) computeDominantSpeaker() {
@@ -1128,8 +1576,10 @@ func (r *Room) computeDominantSpeaker() {
 		}
 	}
 
+	r.accumulateTalkTime(now)
+
 	// Minimum threshold to be considered "speaking"
-	if bestScore < 5.0 {
+	if bestScore < r.speakerThreshold {
 		bestPeer = ""
 	}
 
@@ -1137,7 +1587,7 @@ func (r *Room) computeDominantSpeaker() {
 	r.dominantSpeaker = bestPeer
 	r.audioLevelsMu.Unlock()
 
-	if oldSpeaker != bestPeer && r.OnDominantSpeakerChanged != nil {
+	if oldSpeaker != bestPeer && r.OnDominantSpeakerChanged != nil && !r.silenced() {
 		r.OnDominantSpeakerChanged(r.ID, oldSpeaker, bestPeer)
 	}
 }
@@ -1151,29 +1601,37 @@ func (r *Room) GetDominantSpeaker() string {
 // --- Stats ---
 
 // StartStatsCollection runs a goroutine that periodically collects and broadcasts stats.
+// It stops while the room is dormant (see dormant.go).
 func (r *Room) StartStatsCollection() {
-	go func() {
-		r.mu.RLock()
-		interval := r.statsInterval
-		r.mu.RUnlock()
-		if interval <= 0 {
-			interval = 3 * time.Second
-		}
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
+	r.mu.Lock()
+	r.dormancy.statsStarted = true
+	ctx := r.loopsContextLocked()
+	interval := r.statsInterval
+	r.goLoopLocked(func() { r.runStatsCollection(ctx, interval) })
+	r.mu.Unlock()
+}
 
-		for {
-			select {
-			case <-r.ctx.Done():
-				return
-			case <-ticker.C:
-				r.collectAndBroadcastStats()
-			}
+func (r *Room) runStatsCollection(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 3 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.collectAndBroadcastStats()
 		}
-	}()
+	}
 }
 
 func (r *Room) collectAndBroadcastStats() {
+	r.forwarded.sample(time.Now())
+	r.checkLayerUse(time.Now())
+
 	r.mu.RLock()
 	peers := make([]*peer.Peer, 0, len(r.Peers))
 	for _, p := range r.Peers {
@@ -1181,14 +1639,39 @@ func (r *Room) collectAndBroadcastStats() {
 	}
 	r.mu.RUnlock()
 
+	now := time.Now()
+	live := r.live.enabled.Load() && r.OnLiveSample != nil && !r.silenced()
+	var samples []peerQualitySample
+	var livePeers []LivePeer
+	peerCount := 0
 	for _, p := range peers {
+		if !p.Observer {
+			peerCount++
+		}
+		if !r.reportsQuality(p) {
+			continue
+		}
 		quality := p.GetConnectionQuality()
-		if quality != nil && r.OnQualityStats != nil {
-			r.OnQualityStats(p.ID, &PeerQuality{
-				Level:      quality.Level,
-				PacketLoss: quality.PacketLoss,
-			})
+		if quality == nil {
+			continue
 		}
+		pq := PeerQuality{
+			Level:      quality.Level,
+			PacketLoss: quality.PacketLoss,
+		}
+		if r.OnQualityStats != nil && !r.silenced() {
+			r.OnQualityStats(r, p, &pq)
+		}
+		if countsQuality(p, now) {
+			samples = append(samples, peerQualitySample{peerID: p.ID, PeerQuality: pq})
+		}
+		if live {
+			livePeers = append(livePeers, LivePeer{PeerID: p.ID, PeerQuality: pq})
+		}
+	}
+	r.updateQualitySummary(samples)
+	if live {
+		r.OnLiveSample(r, r.liveSample(now, peerCount, livePeers))
 	}
 }
 
@@ -1198,34 +1681,109 @@ func (r *Room) UpdateSettings(settings *RoomSettings) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.Settings = settings
+	r.viewerEvents.Store(settings.ViewerEvents)
 	r.UpdatedAt = time.Now()
 }
 
-func (r *Room) GetStats() map[string]interface{} {
+// GetSettings returns a copy of the room's settings including its track
+// priorities.
+func (r *Room) GetSettings() RoomSettings {
+	r.mu.RLock()
+	settings := *r.Settings
+	r.mu.RUnlock()
+	settings.TrackPriorities = r.GetTrackPriorities()
+	return settings
+}
+
+// RoomStats is a room as the REST API describes it.
+type RoomStats struct {
+	ID            string         `json:"id"`
+	Name          string         `json:"name"`
+	State         RoomState      `json:"state"`
+	PeerCount     int            `json:"peerCount"`
+	ObserverCount *int           `json:"observerCount,omitempty"` // nil where observers are hidden
+	TrackCount    int            `json:"trackCount"`
+	MaxTracks     int            `json:"maxTracks"`
+	HostUserID    string         `json:"hostUserId"`
+	Locked        bool           `json:"locked"`
+	Quality       QualitySummary `json:"quality"`
+	Region        string         `json:"region,omitempty"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+	// Only for rooms with a time limit
+	*TimeLimitStats
+}
+
+// TimeLimitStats is the time limit part of RoomStats.
+type TimeLimitStats struct {
+	MaxDurationSec   int       `json:"maxDurationSec"`
+	EndsAt           time.Time `json:"endsAt"`
+	TimeRemainingSec int       `json:"timeRemainingSec"`
+}
+
+func (r *Room) GetStats() RoomStats {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	return map[string]interface{}{
-		"id":         r.ID,
-		"name":       r.Name,
-		"state":      r.State,
-		"peerCount":  r.peerCount,
-		"trackCount": len(r.MediaTracks),
-		"createdAt":  r.CreatedAt,
-		"updatedAt":  r.UpdatedAt,
+	participants, observers := r.memberCountsLocked()
+	stats := RoomStats{
+		ID:            r.ID,
+		Name:          r.Name,
+		State:         r.State,
+		PeerCount:     participants,
+		ObserverCount: &observers,
+		TrackCount:    len(r.MediaTracks),
+		MaxTracks:     r.maxTracks,
+		HostUserID:    r.host.userID,
+		Locked:        r.lock != nil,
+		Quality:       r.quality,
+		Region:        r.Region,
+		CreatedAt:     r.CreatedAt,
+		UpdatedAt:     r.UpdatedAt,
+	}
+	if limit, ok := r.GetTimeLimit(); ok {
+		stats.TimeLimitStats = &TimeLimitStats{
+			MaxDurationSec:   int(limit.MaxDuration / time.Second),
+			EndsAt:           limit.Deadline,
+			TimeRemainingSec: int(limit.Remaining() / time.Second),
+		}
 	}
+	return stats
+}
+
+func (r *Room) GetUpdatedAt() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.UpdatedAt
 }
 
 func (r *Room) IsEmpty() bool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	return r.peerCount == 0
+	return len(r.Peers) == 0
 }
 
+// Close closes the room's peers and stops its loops. Calls after the first
+// do nothing.
 func (r *Room) Close() error {
+	r.closing.Store(true)
+	if !r.closed.CompareAndSwap(false, true) {
+		return nil
+	}
 	r.mu.Lock()
-	r.State = RoomStateClosed
+	r.setStateLocked(RoomStateClosed)
 	r.cancel()
 
+	var stopped []*SubscriberState
+	for _, mt := range r.MediaTracks {
+		mt.mu.Lock()
+		for _, sub := range mt.Subscribers {
+			sub.stop()
+			stopped = append(stopped, sub)
+		}
+		mt.mu.Unlock()
+	}
+
+	// Closing the PeerConnections stops every sender and ends the RTCP drains.
 	for _, p := range r.Peers {
 		p.Close()
 	}
@@ -1233,64 +1791,33 @@ func (r *Room) Close() error {
 	r.Peers = make(map[string]*peer.Peer)
 	r.peersByUser = make(map[string]string)
 	r.MediaTracks = make(map[string]*MediaTrack)
-	r.peerCount = 0
+	r.trackHandles = make(map[string]string)
 	r.mu.Unlock()
 
-	r.renegotiationMu.Lock()
-	for id, timer := range r.renegotiationTimers {
-		timer.Stop()
-		delete(r.renegotiationTimers, id)
-	}
-	r.renegotiationMu.Unlock()
+	r.waitSubscribers(stopped)
+	r.loops.Wait()
 
-	return nil
-}
-
-func (r *Room) triggerRenegotiation(targetPeer *peer.Peer) {
 	r.renegotiationMu.Lock()
-	defer r.renegotiationMu.Unlock()
-
-	if _, hasPending := r.renegotiationTimers[targetPeer.ID]; hasPending {
-		return
+	for _, st := range r.renegotiation {
+		st.cancelTimer()
 	}
-
-	lastTime, exists := r.lastRenegotiation[targetPeer.ID]
-	delay := r.renegotiationDelay
-
-	if exists && time.Since(lastTime) < delay {
-		wait := delay - time.Since(lastTime)
-
-		peerID := targetPeer.ID
-		timer := time.AfterFunc(wait, func() {
-			r.renegotiationMu.Lock()
-			delete(r.renegotiationTimers, peerID)
-			r.lastRenegotiation[peerID] = time.Now()
-			r.renegotiationMu.Unlock()
-
-			r.mu.RLock()
-			_, stillExists := r.Peers[peerID]
-			r.mu.RUnlock()
-
-			if !stillExists {
-				return
-			}
-
-			if r.OnRenegotiateNeeded != nil {
-				r.OnRenegotiateNeeded(targetPeer, "scheduled")
-			}
-		})
-		r.renegotiationTimers[peerID] = timer
-		return
+	r.renegotiation = make(map[string]*renegotiationState)
+	r.dropConnStates()
+	if r.roomMetrics {
+		appmetrics.DeleteRenegotiationsPending(r.ID)
+		appmetrics.DeleteRoomQuality(r.ID)
 	}
+	r.renegotiationMu.Unlock()
 
-	r.lastRenegotiation[targetPeer.ID] = time.Now()
+	r.pendingMu.Lock()
+	r.pendingForwards = make(map[string]*pendingForwards)
+	r.pendingMu.Unlock()
 
-	if r.OnRenegotiateNeeded != nil {
-		r.OnRenegotiateNeeded(targetPeer, "track_change")
-	}
+	return nil
 }
 
-// GetSimulcastTracks returns all simulcast media tracks with their available layers.
+// GetSimulcastTracks returns all simulcast media tracks, keyed by track handle,
+// with their available layers.
 func (r *Room) GetSimulcastTracks() map[string][]string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -1304,7 +1831,7 @@ func (r *Room) GetSimulcastTracks() map[string][]string {
 				rids = append(rids, rid)
 			}
 			mt.mu.RUnlock()
-			result[mt.ID] = rids
+			result[mt.Handle] = rids
 		}
 	}
 	return result
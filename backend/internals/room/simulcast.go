@@ -0,0 +1,61 @@
+package room
+
+import (
+	"strings"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// A simulcast track is created by the first of its layers to arrive; the
+// others join it as they come. Publishers that announce RIDs have their
+// layers keyed by those. WebKit publishers that simulcast through an SSRC
+// group get synthetic RIDs, "q", "h" and "f" by SSRC order, from the peer
+// (see peer/webkit.go), so layer selection treats both alike.
+// MediaTrack.SimulcastMode records which kind the publisher is.
+
+// addLayerLocked adds the layer carried by track to mt and reports whether
+// it did. It refuses tracks that are not a new layer of mt.
+// MUST be called with r.mu held.
+func (r *Room) addLayerLocked(mt *MediaTrack, p *peer.Peer, track *webrtc.TrackRemote, layer peer.RemoteLayer) bool {
+	if layer.RID == "" || mt.PeerID != p.ID {
+		return false
+	}
+
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	if !mt.IsSimulcast || mt.SimulcastMode != layer.Mode {
+		return false
+	}
+	if _, ok := mt.Layers[layer.RID]; ok {
+		return false
+	}
+	mt.Layers[layer.RID] = &SimulcastLayer{RID: layer.RID, Track: track, Active: true}
+
+	r.logger.Debug("Simulcast layer added",
+		zap.String("trackID", mt.Handle),
+		zap.String("rid", layer.RID),
+		zap.String("mode", layer.Mode),
+		zap.Uint32("ssrc", uint32(track.SSRC())),
+	)
+	return true
+}
+
+// forwardCapability is the codec a forwarded copy of a track is bound
+// with. H264 keeps the publisher's fmtp, so each subscriber is bound to the
+// payload type with the same packetization mode and profile if it
+// negotiated one, and to any H264 payload type otherwise. Audio keeps the
+// publisher's whole codec, clock rate and channels included (see
+// audiocodec.go).
+func forwardCapability(codec webrtc.RTPCodecParameters) webrtc.RTPCodecCapability {
+	if strings.HasPrefix(strings.ToLower(codec.MimeType), "audio/") {
+		return codec.RTPCodecCapability
+	}
+	capability := webrtc.RTPCodecCapability{MimeType: codec.MimeType}
+	if strings.EqualFold(codec.MimeType, webrtc.MimeTypeH264) {
+		capability.ClockRate = codec.ClockRate
+		capability.SDPFmtpLine = codec.SDPFmtpLine
+	}
+	return capability
+}
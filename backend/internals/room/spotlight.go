@@ -0,0 +1,143 @@
+package room
+
+import (
+	"errors"
+	"math"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+// A host can spotlight one participant so every client switches to a layout
+// around them. The spotlight pins the participant's video above any layer
+// priority: subscribers start and stay on its top layer, and it is the last
+// to be downgraded under a bandwidth limit. It belongs to the user, like the
+// host role, so it survives a rejoin, and is cleared when the user's peer
+// leaves. Changes are reported to OnSpotlightChanged with the room locked,
+// so they are announced in order with joins and leaves.
+
+// SpotlightPriority is the effective priority of the spotlighted
+// participant's video tracks.
+const SpotlightPriority = math.MaxInt32
+
+// Why the spotlight changed, as passed to OnSpotlightChanged
+const (
+	SpotlightSet      = "set"       // a host spotlighted a participant
+	SpotlightCleared  = "cleared"   // a host cleared the spotlight
+	SpotlightPeerLeft = "peer-left" // the spotlighted participant left
+)
+
+// ErrCannotSpotlight is returned for spotlighting an observer or a viewer.
+var ErrCannotSpotlight = errors.New("observers and viewers cannot be spotlighted")
+
+// SpotlightChange describes a change of spotlight. UserID is empty when the
+// spotlight was cleared; PeerID is empty while the user is not in the room.
+type SpotlightChange struct {
+	UserID   string
+	PeerID   string
+	Previous string
+	Reason   string
+}
+
+// spotlightState is the spotlighted user and its peer in the room. Guarded
+// by r.prioMu, as it is read with the priorities.
+type spotlightState struct {
+	userID string
+	peerID string
+}
+
+// Spotlight returns the spotlighted user and its peer, both empty if there
+// is no spotlight. The peer is empty while the user is not in the room.
+func (r *Room) Spotlight() (userID, peerID string) {
+	r.prioMu.RLock()
+	defer r.prioMu.RUnlock()
+	return r.spotlight.userID, r.spotlight.peerID
+}
+
+// RestoreSpotlight spotlights userID in a room that is not registered yet,
+// without announcing it. The user's peer gets it when it joins.
+func (r *Room) RestoreSpotlight(userID string) {
+	r.prioMu.Lock()
+	defer r.prioMu.Unlock()
+	r.spotlight = spotlightState{userID: userID}
+}
+
+// SetSpotlight spotlights the participant with peerID, or clears the
+// spotlight when peerID is empty, and announces the change. It reports
+// whether the spotlight changed.
+func (r *Room) SetSpotlight(peerID string) (bool, error) {
+	r.mu.Lock()
+	userID, reason := "", SpotlightCleared
+	if peerID != "" {
+		p, ok := r.Peers[peerID]
+		if !ok {
+			r.mu.Unlock()
+			return false, ErrPeerNotFound
+		}
+		if !canHost(p) {
+			r.mu.Unlock()
+			return false, ErrCannotSpotlight
+		}
+		userID, reason = p.UserID, SpotlightSet
+	}
+	change, changed := r.setSpotlightLocked(userID, peerID, reason)
+	if changed && r.OnSpotlightChanged != nil && !r.silenced() {
+		r.OnSpotlightChanged(r, change)
+	}
+	r.mu.Unlock()
+
+	if changed {
+		r.ReallocateLayers()
+	}
+	return changed, nil
+}
+
+// setSpotlightLocked moves the spotlight to userID and its peer.
+// MUST be called with r.mu held (write lock).
+func (r *Room) setSpotlightLocked(userID, peerID, reason string) (SpotlightChange, bool) {
+	r.prioMu.Lock()
+	previous := r.spotlight.userID
+	if previous == userID {
+		r.prioMu.Unlock()
+		return SpotlightChange{}, false
+	}
+	r.spotlight = spotlightState{userID: userID, peerID: peerID}
+	r.prioMu.Unlock()
+
+	r.recordEvent(RoomEvent{Type: EventSpotlightChanged, PeerID: peerID, UserID: userID, Detail: reason})
+	r.logger.Info("Room spotlight changed",
+		zap.String("roomID", r.ID),
+		zap.String("userID", userID),
+		zap.String("previous", previous),
+		zap.String("reason", reason),
+	)
+	return SpotlightChange{UserID: userID, PeerID: peerID, Previous: previous, Reason: reason}, true
+}
+
+// spotlightJoinedLocked gives the spotlight of p's user to p.
+// MUST be called with r.mu held.
+func (r *Room) spotlightJoinedLocked(p *peer.Peer) {
+	r.prioMu.Lock()
+	defer r.prioMu.Unlock()
+	if r.spotlight.userID == p.UserID {
+		r.spotlight.peerID = p.ID
+	}
+}
+
+// spotlightLeftLocked clears the spotlight if p had it. With rejoining set
+// the user keeps it for its next peer.
+// MUST be called with r.mu held (write lock).
+func (r *Room) spotlightLeftLocked(p *peer.Peer, rejoining bool) (SpotlightChange, bool) {
+	r.prioMu.Lock()
+	if r.spotlight.peerID != p.ID {
+		r.prioMu.Unlock()
+		return SpotlightChange{}, false
+	}
+	if rejoining {
+		r.spotlight.peerID = ""
+		r.prioMu.Unlock()
+		return SpotlightChange{}, false
+	}
+	r.prioMu.Unlock()
+	return r.setSpotlightLocked("", "", SpotlightPeerLeft)
+}
@@ -0,0 +1,113 @@
+package room
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+func TestSpotlight(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	var mu sync.Mutex
+	var changes []SpotlightChange
+	r.OnSpotlightChanged = func(_ *Room, change SpotlightChange) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, change)
+	}
+	take := func() []SpotlightChange {
+		mu.Lock()
+		defer mu.Unlock()
+		c := changes
+		changes = nil
+		return c
+	}
+
+	alice := joinAs(t, r, "alice", nil)
+	bob := joinAs(t, r, "bob", nil)
+	observer := joinAs(t, r, "observer", func(p *peer.Peer) { p.Observer = true })
+	aliceVideo := addTrack(r, "alice-video", alice.ID, "video")
+	aliceAudio := addTrack(r, "alice-audio", alice.ID, "audio")
+	bobVideo := addTrack(r, "bob-video", bob.ID, "video")
+
+	// Only participants in the room can be spotlighted
+	if _, err := r.SetSpotlight("nobody"); !errors.Is(err, ErrPeerNotFound) {
+		t.Fatalf("spotlighting an unknown peer: %v", err)
+	}
+	if _, err := r.SetSpotlight(observer.ID); !errors.Is(err, ErrCannotSpotlight) {
+		t.Fatalf("spotlighting an observer: %v", err)
+	}
+
+	// The spotlighted participant's video outranks every other track, its
+	// audio does not
+	if changed, err := r.SetSpotlight(alice.ID); err != nil || !changed {
+		t.Fatalf("spotlighting alice: %v, %v", changed, err)
+	}
+	if got := take(); len(got) != 1 || got[0] != (SpotlightChange{UserID: "alice", PeerID: alice.ID, Reason: SpotlightSet}) {
+		t.Fatalf("announced %+v", got)
+	}
+	if changed, _ := r.SetSpotlight(alice.ID); changed {
+		t.Fatal("spotlighting alice again changed the spotlight")
+	}
+	if len(take()) != 0 {
+		t.Fatal("spotlighting alice again was announced")
+	}
+	if r.trackPriority(aliceVideo) != SpotlightPriority {
+		t.Fatal("alice's video not pinned")
+	}
+	if r.trackPriority(aliceAudio) == SpotlightPriority || r.trackPriority(bobVideo) == SpotlightPriority {
+		t.Fatal("a track other than alice's video pinned")
+	}
+
+	// Rejoining, alice keeps it for her next peer
+	if err := r.EvictPeer(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if user, peerID := r.Spotlight(); user != "alice" || peerID != "" {
+		t.Fatalf("spotlight %q, %q while alice rejoins", user, peerID)
+	}
+	alice = joinAs(t, r, "alice", nil)
+	if user, peerID := r.Spotlight(); user != "alice" || peerID != alice.ID {
+		t.Fatalf("spotlight %q, %q after alice rejoined", user, peerID)
+	}
+	if len(take()) != 0 {
+		t.Fatal("the rejoin was announced")
+	}
+
+	// Moving it names the previous user; leaving clears it
+	if _, err := r.SetSpotlight(bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := take(); len(got) != 1 || got[0].Previous != "alice" || got[0].UserID != "bob" {
+		t.Fatalf("announced %+v", got)
+	}
+	if r.trackPriority(bobVideo) != SpotlightPriority {
+		t.Fatal("bob's video not pinned")
+	}
+	if err := r.RemovePeer(bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := take(); len(got) != 1 || got[0] != (SpotlightChange{Previous: "bob", Reason: SpotlightPeerLeft}) {
+		t.Fatalf("bob leaving announced as %+v", got)
+	}
+	if user, _ := r.Spotlight(); user != "" {
+		t.Fatalf("%s still spotlighted", user)
+	}
+
+	// A restored spotlight waits for its user without being announced
+	r.RestoreSpotlight("carol")
+	carol := joinAs(t, r, "carol", nil)
+	if user, peerID := r.Spotlight(); user != "carol" || peerID != carol.ID {
+		t.Fatalf("spotlight %q, %q after carol joined", user, peerID)
+	}
+	if _, err := r.SetSpotlight(""); err != nil {
+		t.Fatal(err)
+	}
+	if got := take(); len(got) != 1 || got[0] != (SpotlightChange{Previous: "carol", Reason: SpotlightCleared}) {
+		t.Fatalf("clearing announced as %+v", got)
+	}
+}
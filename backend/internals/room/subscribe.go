@@ -0,0 +1,252 @@
+package room
+
+import (
+	"errors"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"go.uber.org/zap"
+)
+
+// Peers in manual subscription mode are left out when tracks are fanned out
+// and get nothing in their first answer; they learn about tracks from
+// room-state and track-published and pick the ones they want. Subscribing
+// goes through the same forwarding path as automatic fan-out, so a track
+// asked for during the first negotiation is queued until it completes.
+//
+// Changes arrive in batches (a client switching layouts may drop twenty
+// tracks and add one): a batch is applied in one pass, removals first so
+// their transceivers can be reused, and followed by a single renegotiation.
+
+var (
+	ErrTrackNotFound      = errors.New("track not found")
+	ErrOwnTrack           = errors.New("cannot subscribe to own track")
+	ErrSubscriptionDenied = errors.New("subscription not authorized")
+)
+
+// SubscriptionResult reports a batch of subscription changes. Refs that were
+// rejected, for instance because the track was unpublished mid-request, are
+// left out of Subscribed and Unsubscribed and changed nothing.
+type SubscriptionResult struct {
+	Subscribed   []string
+	Unsubscribed []string
+	Rejected     map[string]error
+}
+
+func (res *SubscriptionResult) reject(ref string, err error) {
+	if res.Rejected == nil {
+		res.Rejected = make(map[string]error)
+	}
+	res.Rejected[ref] = err
+}
+
+// resolveSubscription maps a track or group handle (or a raw track ID) to
+// the track or, for codec alternatives, the group a subscription refers to.
+// A publisher's own track resolves to the track itself, as a monitor, in
+// rooms that allow it.
+func (r *Room) resolveSubscription(p *peer.Peer, ref string) (*MediaTrack, *codecGroup, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.Peers[p.ID] != p {
+		return nil, nil, ErrPeerNotFound
+	}
+	if g, ok := r.codecGroups[ref]; ok {
+		if g.PeerID == p.ID {
+			return nil, nil, ErrOwnTrack
+		}
+		return nil, g, nil
+	}
+	mt, ok := r.resolveTrackLocked(ref)
+	if !ok {
+		return nil, nil, ErrTrackNotFound
+	}
+	if mt.PeerID == p.ID {
+		if !r.Settings.SelfMonitor {
+			return nil, nil, ErrOwnTrack
+		}
+		return mt, nil, nil
+	}
+	if mt.group != nil {
+		return nil, mt.group, nil
+	}
+	return mt, nil, nil
+}
+
+// Subscribe starts forwarding the track or codec group ref to p.
+func (r *Room) Subscribe(p *peer.Peer, ref string) error {
+	res := r.UpdateSubscriptions(p, []string{ref}, nil)
+	return res.Rejected[ref]
+}
+
+// Unsubscribe stops forwarding the track or codec group ref to p, including
+// a forward still queued behind p's first negotiation.
+func (r *Room) Unsubscribe(p *peer.Peer, ref string) error {
+	res := r.UpdateSubscriptions(p, nil, []string{ref})
+	return res.Rejected[ref]
+}
+
+// UpdateSubscriptions applies a batch of subscription changes for p and asks
+// p to renegotiate once if any transceiver changed. Batches are serialized
+// per room so two batches for the same peer cannot interleave.
+func (r *Room) UpdateSubscriptions(p *peer.Peer, subscribe, unsubscribe []string) SubscriptionResult {
+	r.subscribeMu.Lock()
+	defer r.subscribeMu.Unlock()
+
+	var res SubscriptionResult
+	changed := false
+	for _, ref := range unsubscribe {
+		stopped, err := r.unsubscribeOne(p, ref)
+		if err != nil {
+			res.reject(ref, err)
+			continue
+		}
+		changed = changed || stopped
+		res.Unsubscribed = append(res.Unsubscribed, ref)
+	}
+
+	var retry []*MediaTrack
+	for _, ref := range subscribe {
+		attached, failed, err := r.subscribeOne(p, ref)
+		if err != nil {
+			res.reject(ref, err)
+			continue
+		}
+		changed = changed || attached
+		if failed != nil {
+			retry = append(retry, failed)
+		}
+		res.Subscribed = append(res.Subscribed, ref)
+	}
+
+	r.logger.Debug("Subscriptions updated",
+		zap.String("peerID", p.ID),
+		zap.Int("subscribed", len(res.Subscribed)),
+		zap.Int("unsubscribed", len(res.Unsubscribed)),
+		zap.Int("rejected", len(res.Rejected)),
+		zap.Bool("renegotiate", changed),
+	)
+
+	if changed {
+		r.triggerRenegotiation(p, RenegotiateTrackChange)
+	}
+	// Tracks that could not be attached take the per-track retry path,
+	// which renegotiates on its own
+	for _, mt := range retry {
+		go r.forwardTrackToPeer(mt, p)
+	}
+	return res
+}
+
+// subscribeOne attaches ref to p without renegotiating. It reports whether a
+// transceiver was added, and returns a track whose attach failed so the
+// caller can retry it.
+func (r *Room) subscribeOne(p *peer.Peer, ref string) (bool, *MediaTrack, error) {
+	mt, g, err := r.resolveSubscription(p, ref)
+	if err != nil {
+		return false, nil, err
+	}
+	if mt != nil && isMonitor(mt, p.ID) {
+		if err := r.admitMonitor(mt, p); err != nil {
+			return false, nil, err
+		}
+	}
+	admitted := mt
+	if g != nil {
+		admitted = g.pick(p)
+	}
+	if admitted != nil {
+		if err := r.admitSubscription(admitted, p); err != nil {
+			return false, nil, err
+		}
+	}
+
+	if g != nil {
+		g.mu.Lock()
+		g.subscribers[p.ID] = true
+		g.mu.Unlock()
+		if r.queueForward(nil, g, p) {
+			return false, nil, nil
+		}
+		return r.forwardGroupToPeer(g, p, true), nil, nil
+	}
+
+	if mt.ctx.Err() != nil {
+		return false, nil, ErrTrackNotFound // unpublished mid-request
+	}
+	if r.queueForward(mt, nil, p) {
+		return false, nil, nil
+	}
+	if r.forwardTrackToPeerDirect(mt, p) {
+		return true, nil, nil
+	}
+	mt.mu.RLock()
+	_, subscribed := mt.Subscribers[p.ID]
+	mt.mu.RUnlock()
+	if subscribed {
+		return false, nil, nil
+	}
+	return false, mt, nil
+}
+
+// admitSubscriber reports whether mt may be forwarded to p. A codec
+// mismatch is reported through OnCodecMismatch, since no request of p's is
+// there to answer.
+func (r *Room) admitSubscriber(mt *MediaTrack, p *peer.Peer) bool {
+	err := r.admitSubscription(mt, p)
+	var mismatch *CodecMismatchError
+	if errors.As(err, &mismatch) && r.OnCodecMismatch != nil {
+		r.OnCodecMismatch(r, p, mismatch)
+	}
+	return err == nil
+}
+
+// admitSubscription returns why mt may not be forwarded to p, if it may not.
+func (r *Room) admitSubscription(mt *MediaTrack, p *peer.Peer) error {
+	err := r.checkAudioCodec(mt, p)
+	if err == nil && r.AdmitSubscriber != nil && !r.AdmitSubscriber(r, p, mt) {
+		err = ErrSubscriptionDenied
+	}
+	if err != nil {
+		r.logger.Debug("Subscription refused",
+			zap.String("peerID", p.ID),
+			zap.String("track", mt.Handle),
+			zap.Error(err),
+		)
+	}
+	return err
+}
+
+// unsubscribeOne detaches ref from p without renegotiating, and reports
+// whether a transceiver was released.
+func (r *Room) unsubscribeOne(p *peer.Peer, ref string) (bool, error) {
+	mt, g, err := r.resolveSubscription(p, ref)
+	if err != nil {
+		return false, err
+	}
+
+	r.unqueueForward(mt, g, p)
+
+	stopped := false
+	if g != nil {
+		g.fwdMu.Lock()
+		g.mu.Lock()
+		delete(g.subscribers, p.ID)
+		current := g.members[g.chosen[p.ID]]
+		delete(g.chosen, p.ID)
+		g.mu.Unlock()
+		if current != nil {
+			stopped = r.stopForwarding(current, p)
+		}
+		g.fwdMu.Unlock()
+	} else {
+		stopped = r.stopForwarding(mt, p)
+	}
+
+	if stopped {
+		r.logger.Debug("Track unsubscribed",
+			zap.String("peerID", p.ID),
+			zap.String("track", ref),
+		)
+	}
+	return stopped, nil
+}
@@ -0,0 +1,71 @@
+package room
+
+import (
+	"sort"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/pion/webrtc/v3"
+)
+
+// A client coming back with a new PeerConnection, or with the old one after
+// a reattach, sees the forwarded tracks on m-lines in whatever order they
+// were attached. The subscription snapshot tells it which publisher and
+// track each m-line carries. It is read off the peer's transceivers, so its
+// order is the SDP's however the tracks were attached; existing tracks are
+// also attached in publish order (see AddExistingTracksToPeer).
+
+// SubscriptionSnapshot lists the tracks forwarded to p in the order of p's
+// transceivers. A forward whose m-line is not negotiated yet has no mid.
+func (r *Room) SubscriptionSnapshot(p *peer.Peer) []signaling.SubscriptionInfo {
+	r.mu.RLock()
+	tracks := make([]*MediaTrack, 0, len(r.MediaTracks))
+	for _, mt := range r.MediaTracks {
+		if mt.PeerID != p.ID {
+			tracks = append(tracks, mt)
+		}
+	}
+	r.mu.RUnlock()
+
+	bySender := make(map[*webrtc.RTPSender]signaling.SubscriptionInfo)
+	for _, mt := range tracks {
+		mt.mu.RLock()
+		sub, ok := mt.Subscribers[p.ID]
+		if ok {
+			info := signaling.SubscriptionInfo{
+				PeerID:    mt.PeerID,
+				TrackID:   mt.Handle,
+				Kind:      mt.Kind,
+				MediaType: string(mt.MediaType),
+			}
+			if mt.group != nil {
+				info.TrackID = mt.group.Handle
+			}
+			if mt.IsSimulcast {
+				info.Layer = mt.wantedLayerLocked(sub)
+			}
+			bySender[sub.Sender] = info
+		}
+		mt.mu.RUnlock()
+	}
+
+	snapshot := make([]signaling.SubscriptionInfo, 0, len(bySender))
+	if p.Connection != nil {
+		for _, t := range p.Connection.GetTransceivers() {
+			sender := t.Sender()
+			info, ok := bySender[sender]
+			if sender == nil || !ok {
+				continue
+			}
+			info.Mid = t.Mid()
+			snapshot = append(snapshot, info)
+			delete(bySender, sender)
+		}
+	}
+	pending := make([]signaling.SubscriptionInfo, 0, len(bySender))
+	for _, info := range bySender {
+		pending = append(pending, info)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].TrackID < pending[j].TrackID })
+	return append(snapshot, pending...)
+}
@@ -0,0 +1,64 @@
+package room
+
+import "time"
+
+// defaultSpeakerThreshold is the audio activity score above which a peer
+// counts as speaking.
+const defaultSpeakerThreshold = 5.0
+
+// SetSpeakerActivityThreshold sets the score above which a peer counts as
+// speaking, for dominant speaker selection and talk time alike.
+func (r *Room) SetSpeakerActivityThreshold(t float64) {
+	r.audioLevelsMu.Lock()
+	defer r.audioLevelsMu.Unlock()
+	r.speakerThreshold = t
+}
+
+// accumulateTalkTime credits the time since the previous detection tick to
+// every peer whose score is above the speaking threshold. Talk time is kept
+// per userID so it survives the peer leaving or reconnecting.
+// MUST be called with r.audioLevelsMu held.
+func (r *Room) accumulateTalkTime(now time.Time) {
+	last := r.lastSpeakerTick
+	r.lastSpeakerTick = now
+	if last.IsZero() {
+		return
+	}
+	tick := now.Sub(last)
+	if tick <= 0 {
+		return
+	}
+	for _, level := range r.audioLevels {
+		if level.UserID != "" && level.Score >= r.speakerThreshold {
+			r.talkTime[level.UserID] += tick
+		}
+	}
+}
+
+// TalkTime returns how long userID has spent speaking in this room.
+func (r *Room) TalkTime(userID string) time.Duration {
+	r.audioLevelsMu.Lock()
+	defer r.audioLevelsMu.Unlock()
+	return r.talkTime[userID]
+}
+
+// TalkTimes returns the talk time of every user who has spoken in the room.
+func (r *Room) TalkTimes() map[string]time.Duration {
+	r.audioLevelsMu.Lock()
+	defer r.audioLevelsMu.Unlock()
+	out := make(map[string]time.Duration, len(r.talkTime))
+	for userID, d := range r.talkTime {
+		out[userID] = d
+	}
+	return out
+}
+
+// RestoreTalkTime seeds userID's talk time from a resumed session. The
+// room's own count wins if it is already larger.
+func (r *Room) RestoreTalkTime(userID string, d time.Duration) {
+	r.audioLevelsMu.Lock()
+	defer r.audioLevelsMu.Unlock()
+	if d > r.talkTime[userID] {
+		r.talkTime[userID] = d
+	}
+}
@@ -0,0 +1,90 @@
+package room
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestTalkTimeFromActivityPattern(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	r.SetSpeakerActivityThreshold(10)
+
+	// Scores at each 200ms detection tick; carol's would count at the
+	// default threshold, and the unnamed peer is never credited
+	patterns := map[string][]float64{
+		"alice": {0, 30, 30, 30, 30, 2, 2, 30},
+		"bob":   {0, 0, 0, 12, 12, 12, 0, 0},
+		"carol": {8, 8, 8, 8, 8, 8, 8, 8},
+		"":      {50, 50, 50, 50, 50, 50, 50, 50},
+	}
+	start := time.Now()
+	for tick := 0; tick < 8; tick++ {
+		r.audioLevelsMu.Lock()
+		for userID, scores := range patterns {
+			r.audioLevels["peer-"+userID] = &AudioLevel{UserID: userID, Score: scores[tick]}
+		}
+		r.accumulateTalkTime(start.Add(time.Duration(tick) * 200 * time.Millisecond))
+		r.audioLevelsMu.Unlock()
+	}
+
+	want := map[string]time.Duration{"alice": time.Second, "bob": 600 * time.Millisecond}
+	if got := r.TalkTimes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("talk time %v, want %v", got, want)
+	}
+
+	// A resumed session's count only ever raises the room's
+	r.RestoreTalkTime("alice", 500*time.Millisecond)
+	r.RestoreTalkTime("bob", 2*time.Second)
+	r.RestoreTalkTime("dave", 3*time.Second)
+	if got := r.TalkTime("alice"); got != time.Second {
+		t.Errorf("alice %v after restoring less, want 1s", got)
+	}
+	if got := r.TalkTime("bob"); got != 2*time.Second {
+		t.Errorf("bob %v after restoring more, want 2s", got)
+	}
+	if got := r.TalkTime("dave"); got != 3*time.Second {
+		t.Errorf("dave %v, want the restored 3s", got)
+	}
+}
+
+func TestTalkTimeFromPackets(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+
+	// alice talks for 600ms, a packet every 20ms, while bob's DTX sends
+	// comfort noise every 400ms; both then go quiet
+	const talk = 600 * time.Millisecond
+	start := time.Now()
+	for i := 0; time.Since(start) < talk; i++ {
+		r.trackAudioActivity("peer-alice", "alice")
+		if i%20 == 0 {
+			r.trackAudioActivity("peer-bob", "bob")
+		}
+		if i%5 == 0 {
+			r.computeDominantSpeaker()
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if speaker := r.GetDominantSpeaker(); speaker != "peer-alice" {
+		t.Fatalf("dominant speaker %q while alice talks", speaker)
+	}
+	for quiet := time.Now(); time.Since(quiet) < 1500*time.Millisecond; time.Sleep(100 * time.Millisecond) {
+		r.computeDominantSpeaker()
+	}
+	if speaker := r.GetDominantSpeaker(); speaker != "" {
+		t.Fatalf("dominant speaker %q after everyone went quiet", speaker)
+	}
+
+	// Speech is credited until the score decays below the threshold,
+	// which takes under a second of silence
+	if got := r.TalkTime("alice"); got < talk-200*time.Millisecond || got > talk+time.Second {
+		t.Errorf("alice talked for %v, want about %v", got, talk)
+	}
+	if got := r.TalkTime("bob"); got != 0 {
+		t.Errorf("comfort noise credited as %v of talk time", got)
+	}
+}
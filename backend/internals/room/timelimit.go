@@ -0,0 +1,151 @@
+package room
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// A room may be given a maximum duration, such as the meeting length of a
+// paid plan, counted from when it is set. OnTimeLimitWarning fires as the
+// remaining time passes each warning point and OnTimeLimitReached once it
+// runs out; the owner then closes the room. The timer runs on the room
+// context, so it stops when the room closes and keeps running while the
+// room stands empty. Extending the limit moves the deadline and rearms the
+// warnings that are ahead of it again.
+
+// ErrNoTimeLimit is returned when extending a room without a time limit.
+var ErrNoTimeLimit = errors.New("room has no time limit")
+
+// TimeLimit describes a room's time limit.
+type TimeLimit struct {
+	MaxDuration time.Duration // as set, before extensions
+	Deadline    time.Time
+}
+
+// Remaining returns the time left before the deadline, never negative.
+func (tl TimeLimit) Remaining() time.Duration {
+	return max(time.Until(tl.Deadline), 0)
+}
+
+type timeLimit struct {
+	mu          sync.Mutex
+	maxDuration time.Duration
+	deadline    time.Time       // zero = no limit
+	warnings    []time.Duration // remaining times to warn at, longest first
+	next        int             // index of the next warning to give
+	changed     chan struct{}   // closed and replaced when deadline moves
+}
+
+// SetTimeLimit limits the room to maxDuration from now, warning as the
+// remaining time passes each of warnings. Warnings beyond maxDuration are
+// never given.
+func (r *Room) SetTimeLimit(maxDuration time.Duration, warnings []time.Duration) {
+	if maxDuration <= 0 {
+		return
+	}
+	tl := &r.timeLimit
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	started := !tl.deadline.IsZero()
+	tl.maxDuration = maxDuration
+	tl.warnings = append([]time.Duration(nil), warnings...)
+	sort.Slice(tl.warnings, func(i, j int) bool { return tl.warnings[i] > tl.warnings[j] })
+	tl.moveDeadlineLocked(time.Now().Add(maxDuration))
+	if !started {
+		// Not one of the loops Close waits for (see goLoopLocked)
+		go r.runTimeLimit()
+	}
+}
+
+// ExtendTimeLimit moves the deadline by d and returns the new limit.
+func (r *Room) ExtendTimeLimit(d time.Duration) (TimeLimit, error) {
+	tl := &r.timeLimit
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	if tl.deadline.IsZero() {
+		return TimeLimit{}, ErrNoTimeLimit
+	}
+	tl.moveDeadlineLocked(tl.deadline.Add(d))
+	return TimeLimit{MaxDuration: tl.maxDuration, Deadline: tl.deadline}, nil
+}
+
+// GetTimeLimit returns the room's time limit, if it has one.
+func (r *Room) GetTimeLimit() (TimeLimit, bool) {
+	tl := &r.timeLimit
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	if tl.deadline.IsZero() {
+		return TimeLimit{}, false
+	}
+	return TimeLimit{MaxDuration: tl.maxDuration, Deadline: tl.deadline}, true
+}
+
+// moveDeadlineLocked sets the deadline and skips the warnings it is already
+// past. MUST be called with tl.mu held.
+func (tl *timeLimit) moveDeadlineLocked(deadline time.Time) {
+	tl.deadline = deadline
+	remaining := time.Until(deadline)
+	tl.next = 0
+	for tl.next < len(tl.warnings) && tl.warnings[tl.next] >= remaining {
+		tl.next++
+	}
+	if tl.changed != nil {
+		close(tl.changed)
+	}
+	tl.changed = make(chan struct{})
+}
+
+func (r *Room) runTimeLimit() {
+	tl := &r.timeLimit
+	for {
+		tl.mu.Lock()
+		deadline, changed := tl.deadline, tl.changed
+		wait := time.Until(deadline)
+		warning := tl.next < len(tl.warnings)
+		if warning {
+			wait -= tl.warnings[tl.next]
+		}
+		tl.mu.Unlock()
+
+		timer := time.NewTimer(max(wait, 0))
+		select {
+		case <-r.ctx.Done():
+			timer.Stop()
+			return
+		case <-changed:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+
+		tl.mu.Lock()
+		if tl.changed != changed {
+			tl.mu.Unlock()
+			continue
+		}
+		if warning {
+			tl.next++
+		}
+		limit := TimeLimit{MaxDuration: tl.maxDuration, Deadline: tl.deadline}
+		tl.mu.Unlock()
+
+		if warning {
+			if r.OnTimeLimitWarning != nil && !r.silenced() {
+				r.OnTimeLimitWarning(r, limit)
+			}
+			continue
+		}
+		r.logger.Info("Room reached its time limit",
+			zap.String("roomID", r.ID),
+			zap.Duration("maxDuration", limit.MaxDuration),
+		)
+		if r.OnTimeLimitReached != nil && !r.silenced() {
+			r.OnTimeLimitReached(r)
+		}
+		return
+	}
+}
@@ -0,0 +1,90 @@
+package room
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// timeLimitEvents records a room's time limit callbacks as the remaining
+// time at each warning, and -1 when the limit is reached.
+type timeLimitEvents struct {
+	mu     sync.Mutex
+	events []time.Duration
+}
+
+func (e *timeLimitEvents) watch(r *Room) {
+	r.OnTimeLimitWarning = func(_ *Room, limit TimeLimit) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.events = append(e.events, limit.Remaining())
+	}
+	r.OnTimeLimitReached = func(*Room) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.events = append(e.events, -1)
+	}
+}
+
+func (e *timeLimitEvents) get() []time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]time.Duration(nil), e.events...)
+}
+
+func TestTimeLimit(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+	var events timeLimitEvents
+	events.watch(r)
+	if _, err := r.ExtendTimeLimit(time.Second); !errors.Is(err, ErrNoTimeLimit) {
+		t.Fatalf("extending without a limit: %v", err)
+	}
+	r.SetTimeLimit(0, nil)
+	if _, ok := r.GetTimeLimit(); ok {
+		t.Fatal("a zero duration set a limit")
+	}
+
+	// Warnings come nearest last, those beyond the limit never; the empty
+	// room runs to its end
+	start := time.Now()
+	r.SetTimeLimit(300*time.Millisecond, []time.Duration{100 * time.Millisecond, time.Hour, 200 * time.Millisecond})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(events.get()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := events.get()
+	if len(got) != 3 || got[0] > 200*time.Millisecond || got[0] <= 100*time.Millisecond || got[1] > 100*time.Millisecond || got[2] != -1 {
+		t.Fatalf("events %v, want warnings at 200ms and 100ms then the end", got)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Fatalf("limit reached after %v", elapsed)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := len(events.get()); n != 3 {
+		t.Fatalf("%d events after the end", n)
+	}
+}
+
+func TestTimeLimitExtendAndClose(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	var events timeLimitEvents
+	events.watch(r)
+	r.SetTimeLimit(100*time.Millisecond, []time.Duration{time.Hour})
+	limit, err := r.ExtendTimeLimit(200 * time.Millisecond)
+	if err != nil || limit.MaxDuration != 100*time.Millisecond || limit.Remaining() <= 200*time.Millisecond {
+		t.Fatalf("extended to %+v, %v", limit, err)
+	}
+
+	// The original end passes without an event, and closing the room
+	// stops the timer before the new one
+	time.Sleep(150 * time.Millisecond)
+	r.Close()
+	time.Sleep(250 * time.Millisecond)
+	if got := events.get(); len(got) != 0 {
+		t.Fatalf("events %v for a room closed before its limit", got)
+	}
+}
@@ -0,0 +1,135 @@
+package room
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// Track handles are short, SFU-assigned identifiers for published tracks.
+// They are used in every client-facing message and REST response, and they
+// are also the track ID subscribers see on their own transceivers, so a
+// client never has to translate between the publisher's WebRTC track ID and
+// the forwarded copy.
+//
+// Deprecated addressing: the publisher's raw WebRTC track ID (MediaTrack.ID)
+// and the legacy "<trackID>_to_<peerID>" forwarded ID are still accepted by
+// ResolveTrack for one release.
+
+const trackHandlePrefix = "t_"
+
+// legacyForwardSeparator joined the publisher track ID and subscriber peer ID
+// in forwarded track IDs before handles existed.
+const legacyForwardSeparator = "_to_"
+
+// TrackSummary is the client-facing description of a published track.
+type TrackSummary = signaling.TrackInfo
+
+// Summary returns the client-facing description of the track.
+func (mt *MediaTrack) Summary() TrackSummary {
+	mt.mu.RLock()
+	summary := TrackSummary{
+		TrackID:       mt.Handle,
+		RawTrackID:    mt.source().id,
+		PeerID:        mt.PeerID,
+		Kind:          mt.Kind,
+		MediaType:     string(mt.MediaType),
+		IsSimulcast:   mt.IsSimulcast,
+		SimulcastMode: mt.SimulcastMode,
+		Paused:        mt.paused.Load(),
+		Codec:         mt.Track.Codec().MimeType,
+	}
+	mt.mu.RUnlock()
+
+	if mt.Kind == "audio" {
+		codec := mt.Track.Codec().RTPCodecCapability
+		summary.ClockRate = codec.ClockRate
+		summary.Channels = audioChannels(codec, "sprop-stereo")
+	}
+	if mt.group != nil {
+		summary.GroupID = mt.group.Handle
+		summary.Codecs = mt.group.codecs()
+	}
+	return summary
+}
+
+// newTrackHandle allocates a handle that is unique within the room.
+// MUST be called with r.mu held (write lock).
+func (r *Room) newTrackHandle() string {
+	for {
+		b := make([]byte, 4)
+		rand.Read(b)
+		handle := trackHandlePrefix + hex.EncodeToString(b)
+		if _, taken := r.trackHandles[handle]; !taken {
+			return handle
+		}
+	}
+}
+
+// ResolveTrack maps a client-supplied track reference to a media track. The
+// reference may be a track handle or, for backwards compatibility, the
+// publisher's raw track ID or a legacy forwarded track ID.
+func (r *Room) ResolveTrack(ref string) (*MediaTrack, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.resolveTrackLocked(ref)
+}
+
+// resolveTrackLocked is ResolveTrack for callers already holding r.mu.
+func (r *Room) resolveTrackLocked(ref string) (*MediaTrack, bool) {
+	if id, ok := r.trackHandles[ref]; ok {
+		mt, exists := r.MediaTracks[id]
+		return mt, exists
+	}
+	if mt, ok := r.sourceTrackLocked(ref); ok {
+		return mt, true
+	}
+	if idx := strings.LastIndex(ref, legacyForwardSeparator); idx > 0 {
+		if mt, ok := r.sourceTrackLocked(ref[:idx]); ok {
+			return mt, true
+		}
+	}
+	return nil, false
+}
+
+// HasTrackRef reports whether ref still names something a peer can
+// subscribe to: a published track or a declared codec group.
+func (r *Room) HasTrackRef(ref string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.codecGroups[ref]; ok {
+		return true
+	}
+	_, ok := r.resolveTrackLocked(ref)
+	return ok
+}
+
+// TrackHandle returns the handle for a raw publisher track ID, including
+// that of a track's replacement source.
+func (r *Room) TrackHandle(rawTrackID string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	mt, ok := r.sourceTrackLocked(rawTrackID)
+	if !ok {
+		return "", false
+	}
+	return mt.Handle, true
+}
+
+// GetTrackList returns summaries of every published track in the room.
+func (r *Room) GetTrackList() []TrackSummary {
+	r.mu.RLock()
+	tracks := make([]*MediaTrack, 0, len(r.MediaTracks))
+	for _, mt := range r.MediaTracks {
+		tracks = append(tracks, mt)
+	}
+	r.mu.RUnlock()
+
+	list := make([]TrackSummary, 0, len(tracks))
+	for _, mt := range tracks {
+		list = append(list, mt.Summary())
+	}
+	return list
+}
@@ -0,0 +1,81 @@
+package room
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// addTrack registers a track published by peerID without media behind it,
+// with the simulcast layers rids when there are any.
+func addTrack(r *Room, id, peerID, kind string, rids ...string) *MediaTrack {
+	mt := &MediaTrack{
+		ID:          id,
+		PeerID:      peerID,
+		Kind:        kind,
+		Subscribers: make(map[string]*SubscriberState),
+		Layers:      make(map[string]*SimulcastLayer),
+		IsSimulcast: len(rids) > 0,
+	}
+	for _, rid := range rids {
+		mt.Layers[rid] = &SimulcastLayer{RID: rid, Active: true}
+	}
+	mt.src.Store(newTrackSource(context.Background(), id, nil, nil))
+	r.mu.Lock()
+	mt.Handle = r.newTrackHandle()
+	r.MediaTracks[id] = mt
+	r.trackHandles[mt.Handle] = id
+	r.mu.Unlock()
+	return mt
+}
+
+func TestResolveTrackByHandleAndRawID(t *testing.T) {
+	r := NewRoom("room-1", 10, zap.NewNop())
+	defer r.Close()
+
+	r.mu.Lock()
+	camera := &MediaTrack{ID: "cam-raw", PeerID: "alice-peer", Kind: "video"}
+	camera.Handle = r.newTrackHandle()
+	mic := &MediaTrack{ID: "mic-raw", PeerID: "alice-peer", Kind: "audio"}
+	mic.Handle = r.newTrackHandle()
+	for _, mt := range []*MediaTrack{camera, mic} {
+		r.MediaTracks[mt.ID] = mt
+		r.trackHandles[mt.Handle] = mt.ID
+	}
+	r.mu.Unlock()
+	if camera.Handle == mic.Handle || len(camera.Handle) != len(trackHandlePrefix)+8 {
+		t.Fatalf("handles %q and %q", camera.Handle, mic.Handle)
+	}
+
+	for _, tc := range []struct {
+		ref  string
+		want *MediaTrack
+	}{
+		{camera.Handle, camera},
+		{mic.Handle, mic},
+		// Deprecated: the publisher's track ID and the old forwarded ID
+		{"cam-raw", camera},
+		{"mic-raw", mic},
+		{"cam-raw_to_bob-peer", camera},
+		{"mic-raw_to_x_to_y", nil},
+		{"_to_bob-peer", nil},
+		{"unknown", nil},
+		{"", nil},
+	} {
+		mt, ok := r.ResolveTrack(tc.ref)
+		if mt != tc.want || ok != (tc.want != nil) {
+			t.Errorf("ResolveTrack(%q) = %v, %v; want %v", tc.ref, mt, ok, tc.want)
+		}
+		if has := r.HasTrackRef(tc.ref); has != (tc.want != nil) {
+			t.Errorf("HasTrackRef(%q) = %v", tc.ref, has)
+		}
+	}
+
+	if h, ok := r.TrackHandle("cam-raw"); !ok || h != camera.Handle {
+		t.Fatalf("TrackHandle(cam-raw) = %q, %v; want %q", h, ok, camera.Handle)
+	}
+	if _, ok := r.TrackHandle(camera.Handle); ok {
+		t.Fatal("TrackHandle resolved a handle as a raw ID")
+	}
+}
@@ -0,0 +1,154 @@
+package room
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"syscall"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"go.uber.org/zap"
+)
+
+// A failed WriteRTP to a subscriber's local track is one of three things. A
+// closed pipe means the sender or its transport is gone and every later
+// write fails the same way, so the subscription is dropped at once and the
+// subscriber renegotiated. A send buffer that is out of space (ENOBUFS from
+// the UDP socket) is congestion: it is counted on the subscription, which
+// the layer allocator then downgrades first (see AllocateLayers) until
+// congestionHold passes without errors. Anything else, such as an
+// unreachable network or a failed encryption, says nothing about the
+// subscriber's bandwidth, so a lower layer would not help: it is counted in
+// the metrics and its first occurrence logged, and the subscription is
+// left alone. A successful write does no extra work.
+
+// congestionHold is how long a subscription counts as congested after its
+// last congestion write error.
+const congestionHold = 10 * time.Second
+
+// congestedPriority ranks congested subscriptions below every other track
+// in layer allocation.
+const congestedPriority = math.MinInt32
+
+// Classes of WriteRTP errors, as labelled in the metrics
+const (
+	writeErrorClosed     = "closed"
+	writeErrorCongestion = "congestion"
+	writeErrorOther      = "other"
+)
+
+// writeErrorClass classifies a WriteRTP error. pion reports a closed ICE
+// transport as io.ErrClosedPipe; a closed socket is net.ErrClosed.
+func writeErrorClass(err error) string {
+	switch {
+	case errors.Is(err, io.ErrClosedPipe), errors.Is(err, net.ErrClosed):
+		return writeErrorClosed
+	case errors.Is(err, syscall.ENOBUFS):
+		return writeErrorCongestion
+	}
+	return writeErrorOther
+}
+
+// writeFailed handles a WriteRTP error for sub.
+func (sub *SubscriberState) writeFailed(err error) {
+	class := writeErrorClass(err)
+	appmetrics.RecordSubscriberWriteError(sub.kind, class)
+	switch class {
+	case writeErrorClosed:
+		if sub.closed.CompareAndSwap(false, true) && sub.onClosed != nil {
+			sub.onClosed()
+		}
+	case writeErrorCongestion:
+		sub.writeErrors.Add(1)
+		now := time.Now().UnixNano()
+		if last := sub.lastWriteError.Swap(now); now-last > int64(congestionHold) && sub.onCongested != nil {
+			sub.onCongested()
+		}
+	default:
+		if sub.otherErrorLogged.CompareAndSwap(false, true) && sub.onOtherError != nil {
+			sub.onOtherError(err)
+		}
+	}
+}
+
+// Congested reports whether the subscription had a congestion write error
+// within congestionHold.
+func (sub *SubscriberState) Congested() bool {
+	last := sub.lastWriteError.Load()
+	return last != 0 && time.Now().UnixNano()-last <= int64(congestionHold)
+}
+
+// WriteErrors is the number of congestion write errors the subscription
+// has had.
+func (sub *SubscriberState) WriteErrors() uint64 {
+	return sub.writeErrors.Load()
+}
+
+// watchWrites gives sub the handlers for its write errors.
+func (r *Room) watchWrites(mt *MediaTrack, sub *SubscriberState) {
+	sub.onClosed = func() { go r.dropClosedSubscriber(mt, sub) }
+	sub.onCongested = func() { go r.subscriberCongested(mt, sub) }
+	sub.onOtherError = func(err error) {
+		r.logger.Warn("Write to subscriber failed",
+			zap.String("trackID", mt.ID),
+			zap.String("peerID", sub.PeerID),
+			zap.Error(err),
+		)
+	}
+}
+
+// dropClosedSubscriber stops forwarding mt to a subscriber whose writes
+// fail with a closed pipe, and renegotiates it if it is still in the room.
+func (r *Room) dropClosedSubscriber(mt *MediaTrack, sub *SubscriberState) {
+	mt.mu.RLock()
+	current := mt.Subscribers[sub.PeerID] == sub
+	mt.mu.RUnlock()
+	if !current || sub.Peer == nil {
+		return
+	}
+
+	if g := mt.group; g != nil {
+		g.fwdMu.Lock()
+		defer g.fwdMu.Unlock()
+		g.mu.Lock()
+		if g.chosen[sub.PeerID] == mt.ID {
+			delete(g.chosen, sub.PeerID)
+		}
+		g.mu.Unlock()
+	}
+	if !r.stopForwarding(mt, sub.Peer) {
+		return
+	}
+	r.logger.Info("Dropped subscriber with a closed sender",
+		zap.String("trackID", mt.ID),
+		zap.String("peerID", sub.PeerID),
+	)
+
+	r.mu.RLock()
+	p, ok := r.Peers[sub.PeerID]
+	r.mu.RUnlock()
+	if ok && p == sub.Peer {
+		r.triggerRenegotiation(p, RenegotiateTrackRemoved)
+	}
+}
+
+// subscriberCongested reallocates the layers of a subscriber that became
+// congested, and again once the congestion may have cleared.
+func (r *Room) subscriberCongested(mt *MediaTrack, sub *SubscriberState) {
+	r.logger.Debug("Subscriber congested",
+		zap.String("trackID", mt.ID),
+		zap.String("peerID", sub.PeerID),
+		zap.Uint64("writeErrors", sub.WriteErrors()),
+	)
+	if !mt.IsSimulcast {
+		return
+	}
+	r.AllocateLayers(sub.PeerID)
+	time.AfterFunc(congestionHold+time.Second, func() {
+		if sub.ctx.Err() == nil && !sub.Congested() {
+			r.AllocateLayers(sub.PeerID)
+		}
+	})
+}
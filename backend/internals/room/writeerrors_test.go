@@ -0,0 +1,174 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// failingBinding binds a local track to a write stream whose every write
+// fails with err, as the transport of a negotiated sender would.
+type failingBinding struct{ err error }
+
+func (b failingBinding) CodecParameters() []webrtc.RTPCodecParameters {
+	return []webrtc.RTPCodecParameters{{RTPCodecCapability: opus(48000, ""), PayloadType: 111}}
+}
+func (b failingBinding) HeaderExtensions() []webrtc.RTPHeaderExtensionParameter { return nil }
+func (b failingBinding) SSRC() webrtc.SSRC                                      { return 1 }
+func (b failingBinding) WriteStream() webrtc.TrackLocalWriter                   { return b }
+func (b failingBinding) ID() string                                             { return "failing" }
+func (b failingBinding) RTCPReader() interceptor.RTCPReader                     { return nil }
+func (b failingBinding) WriteRTP(*rtp.Header, []byte) (int, error)              { return 0, b.err }
+func (b failingBinding) Write([]byte) (int, error)                              { return 0, b.err }
+
+// joinConnected joins userID with a connection to add senders to.
+func joinConnected(t *testing.T, r *Room, userID string) *peer.Peer {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return joinAs(t, r, userID, func(p *peer.Peer) { p.Connection = pc })
+}
+
+// subscribeFailing subscribes p to mt through a sender whose writes fail
+// with err.
+func subscribeFailing(t *testing.T, r *Room, mt *MediaTrack, p *peer.Peer, err error) *SubscriberState {
+	t.Helper()
+	local, lerr := webrtc.NewTrackLocalStaticRTP(opus(48000, ""), mt.ID, "stream")
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+	sender, serr := p.Connection.AddTrack(local)
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if _, berr := local.Bind(failingBinding{err}); berr != nil {
+		t.Fatal(berr)
+	}
+	sub := &SubscriberState{PeerID: p.ID, Peer: p, LocalTrack: local, Sender: sender, kind: mt.Kind}
+	sub.ctx, sub.cancel = context.WithCancel(context.Background())
+	t.Cleanup(sub.cancel)
+	r.watchWrites(mt, sub)
+	mt.mu.Lock()
+	mt.Subscribers[p.ID] = sub
+	mt.rebuildSnapshot()
+	mt.mu.Unlock()
+	return sub
+}
+
+func writeErrorCount(class string) float64 {
+	return testutil.ToFloat64(appmetrics.SubscriberWriteErrorsTotal.WithLabelValues("audio", class))
+}
+
+func TestSubscriberWriteErrors(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	r := NewRoom("room-1", 10, zap.New(core))
+	defer r.Close()
+	removed := make(chan string, 4)
+	r.OnRenegotiateNeeded = func(p *peer.Peer, reason string) {
+		if reason == RenegotiateTrackRemoved {
+			removed <- p.UserID
+		}
+	}
+	publisher := joinAs(t, r, "publisher", nil)
+	mt := addTrack(r, "audio-1", publisher.ID, "audio")
+
+	// A closed transport drops the subscription and renegotiates it away
+	closedPeer := joinConnected(t, r, "closed")
+	closed := subscribeFailing(t, r, mt, closedPeer, io.ErrClosedPipe)
+	// A full socket buffer marks it congested
+	congestedPeer := joinConnected(t, r, "congested")
+	congested := subscribeFailing(t, r, mt, congestedPeer,
+		&net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendto", syscall.ENOBUFS)})
+	// Any other failure is only counted and logged
+	failingPeer := joinConnected(t, r, "failing")
+	failingErr := &net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendto", syscall.ENETUNREACH)}
+	failing := subscribeFailing(t, r, mt, failingPeer, failingErr)
+
+	before := map[string]float64{}
+	for _, class := range []string{writeErrorClosed, writeErrorCongestion, writeErrorOther} {
+		before[class] = writeErrorCount(class)
+	}
+	for seq := uint16(0); seq < 3; seq++ {
+		deliverDirect(mt.getSnapshot(), fanOutItem{packet: &rtp.Packet{
+			Header:  rtp.Header{Version: 2, SequenceNumber: seq, Timestamp: uint32(seq) * 960},
+			Payload: []byte{0xf8, 0xff, 0xfe},
+		}})
+	}
+
+	select {
+	case user := <-removed:
+		if user != "closed" {
+			t.Fatalf("%s renegotiated for a removed track", user)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the closed subscriber was not renegotiated")
+	}
+	mt.mu.RLock()
+	_, closedKept := mt.Subscribers[closedPeer.ID]
+	_, congestedKept := mt.Subscribers[congestedPeer.ID]
+	_, failingKept := mt.Subscribers[failingPeer.ID]
+	mt.mu.RUnlock()
+	if closedKept || !congestedKept || !failingKept {
+		t.Fatalf("subscribers kept: closed %v, congested %v, failing %v", closedKept, congestedKept, failingKept)
+	}
+	if closed.ctx.Err() == nil {
+		t.Fatal("the closed subscription was not stopped")
+	}
+
+	// Every failed write is counted; a closed subscription fails only until
+	// it is dropped, as its packets may already be on their way
+	if got := writeErrorCount(writeErrorClosed) - before[writeErrorClosed]; got < 1 {
+		t.Fatalf("%v closed writes counted", got)
+	}
+	if got := writeErrorCount(writeErrorCongestion) - before[writeErrorCongestion]; got != 3 {
+		t.Fatalf("%v congestion writes counted, want 3", got)
+	}
+	if got := writeErrorCount(writeErrorOther) - before[writeErrorOther]; got != 3 {
+		t.Fatalf("%v other writes counted, want 3", got)
+	}
+
+	if !congested.Congested() || congested.WriteErrors() != 3 {
+		t.Fatalf("congested subscription: congested %v after %d errors", congested.Congested(), congested.WriteErrors())
+	}
+	if failing.Congested() || failing.WriteErrors() != 0 {
+		t.Fatalf("failing subscription: congested %v after %d errors", failing.Congested(), failing.WriteErrors())
+	}
+	warnings := logs.FilterMessage("Write to subscriber failed").All()
+	if len(warnings) != 1 || warnings[0].ContextMap()["error"] != failingErr.Error() {
+		t.Fatalf("logged %+v, want the first other error once", warnings)
+	}
+}
+
+func TestWriteErrorClass(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{io.ErrClosedPipe, writeErrorClosed},
+		{net.ErrClosed, writeErrorClosed},
+		{&net.OpError{Op: "write", Err: os.NewSyscallError("sendto", syscall.ENOBUFS)}, writeErrorCongestion},
+		{&net.OpError{Op: "write", Err: os.NewSyscallError("sendto", syscall.ECONNREFUSED)}, writeErrorOther},
+		{errors.New("failed to encrypt"), writeErrorOther},
+	} {
+		if got := writeErrorClass(tc.err); got != tc.want {
+			t.Errorf("%v: %s, want %s", tc.err, got, tc.want)
+		}
+	}
+}
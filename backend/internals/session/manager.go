@@ -1,7 +1,9 @@
 package session
 
 import (
+	"context"
 	"fmt"
+	"maps"
 	"sync"
 	"time"
 
@@ -37,7 +39,7 @@ func userRoomKey(userID, roomID string) string {
 }
 
 // CreateSession creates a new session or reactivates a suspended one
-func (m *Manager) CreateSession(userID, roomID, name string) (*Session, error) {
+func (m *Manager) CreateSession(ctx context.Context, userID, roomID, name string) (*Session, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -53,7 +55,7 @@ func (m *Manager) CreateSession(userID, roomID, name string) (*Session, error) {
 				session.Name = name // Update name in case it changed
 
 				// Persist reactivated session
-				if err := m.stateManager.SetSession(session.ToStateData()); err != nil {
+				if err := m.stateManager.SetSession(ctx, session.ToStateData()); err != nil {
 					m.logger.Error("Failed to persist reactivated session",
 						zap.String("session_id", session.ID),
 						zap.Error(err),
@@ -89,7 +91,7 @@ func (m *Manager) CreateSession(userID, roomID, name string) (*Session, error) {
 	m.tokens[session.Token] = session.ID
 
 	// Persist to state manager
-	if err := m.stateManager.SetSession(session.ToStateData()); err != nil {
+	if err := m.stateManager.SetSession(ctx, session.ToStateData()); err != nil {
 		m.logger.Error("Failed to persist new session",
 			zap.String("session_id", session.ID),
 			zap.Error(err),
@@ -107,7 +109,7 @@ func (m *Manager) CreateSession(userID, roomID, name string) (*Session, error) {
 }
 
 // GetSession retrieves a session by ID, checking local cache first then state manager
-func (m *Manager) GetSession(sessionID string) (*Session, error) {
+func (m *Manager) GetSession(ctx context.Context, sessionID string) (*Session, error) {
 	m.mu.RLock()
 	if session, ok := m.sessions[sessionID]; ok {
 		m.mu.RUnlock()
@@ -116,7 +118,7 @@ func (m *Manager) GetSession(sessionID string) (*Session, error) {
 	m.mu.RUnlock()
 
 	// Fallback to state manager
-	data, err := m.stateManager.GetSession(sessionID)
+	data, err := m.stateManager.GetSession(ctx, sessionID)
 	if err != nil {
 		return nil, err
 	}
@@ -142,8 +144,10 @@ func (m *Manager) GetSession(sessionID string) (*Session, error) {
 	return session, nil
 }
 
-// ResumeSession verifies token and reactivates a suspended session
-func (m *Manager) ResumeSession(sessionID, token string) (*Session, error) {
+// ResumeSession verifies token and reactivates a suspended session. The
+// session must be userID's in roomID: a token taken from one room never
+// resumes into another, and a session that does not match is left as is.
+func (m *Manager) ResumeSession(ctx context.Context, sessionID, token, roomID, userID string) (*Session, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -157,6 +161,9 @@ func (m *Manager) ResumeSession(sessionID, token string) (*Session, error) {
 	if !ok {
 		return nil, fmt.Errorf("session not found")
 	}
+	if session.RoomID != roomID || session.UserID != userID {
+		return nil, fmt.Errorf("session belongs to another room or user")
+	}
 
 	if !session.Suspended {
 		return session, nil // Already active
@@ -172,7 +179,7 @@ func (m *Manager) ResumeSession(sessionID, token string) (*Session, error) {
 	m.tokens[session.Token] = session.ID
 
 	// Persist changes
-	if err := m.stateManager.SetSession(session.ToStateData()); err != nil {
+	if err := m.stateManager.SetSession(ctx, session.ToStateData()); err != nil {
 		m.logger.Error("Failed to persist resumed session",
 			zap.String("session_id", session.ID),
 			zap.Error(err),
@@ -189,14 +196,14 @@ func (m *Manager) ResumeSession(sessionID, token string) (*Session, error) {
 }
 
 // SuspendSession marks a session as suspended for potential reconnection
-func (m *Manager) SuspendSession(sessionID string) error {
+func (m *Manager) SuspendSession(ctx context.Context, sessionID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	session, ok := m.sessions[sessionID]
 	if !ok {
 		// Try to get from state manager
-		data, err := m.stateManager.GetSession(sessionID)
+		data, err := m.stateManager.GetSession(ctx, sessionID)
 		if err != nil {
 			return err
 		}
@@ -211,7 +218,7 @@ func (m *Manager) SuspendSession(sessionID string) error {
 	session.LastSeen = time.Now()
 
 	// Persist suspended state with TTL
-	if err := m.stateManager.SuspendSession(sessionID); err != nil {
+	if err := m.stateManager.SuspendSession(ctx, session.ToStateData()); err != nil {
 		m.logger.Error("Failed to persist suspended session",
 			zap.String("session_id", sessionID),
 			zap.Error(err),
@@ -229,7 +236,7 @@ func (m *Manager) SuspendSession(sessionID string) error {
 }
 
 // DeleteSession permanently removes a session
-func (m *Manager) DeleteSession(sessionID string) error {
+func (m *Manager) DeleteSession(ctx context.Context, sessionID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -243,7 +250,7 @@ func (m *Manager) DeleteSession(sessionID string) error {
 	}
 
 	// Remove from state manager
-	if err := m.stateManager.DeleteSession(sessionID); err != nil {
+	if err := m.stateManager.DeleteSession(ctx, sessionID); err != nil {
 		m.logger.Error("Failed to delete session from state",
 			zap.String("session_id", sessionID),
 			zap.Error(err),
@@ -259,7 +266,7 @@ func (m *Manager) DeleteSession(sessionID string) error {
 }
 
 // UpdatePeerID updates the peer ID after a reconnect
-func (m *Manager) UpdatePeerID(sessionID, peerID string) error {
+func (m *Manager) UpdatePeerID(ctx context.Context, sessionID, peerID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -272,7 +279,7 @@ func (m *Manager) UpdatePeerID(sessionID, peerID string) error {
 	session.LastSeen = time.Now()
 
 	// Persist update
-	if err := m.stateManager.SetSession(session.ToStateData()); err != nil {
+	if err := m.stateManager.SetSession(ctx, session.ToStateData()); err != nil {
 		m.logger.Error("Failed to persist peer ID update",
 			zap.String("session_id", sessionID),
 			zap.String("peer_id", peerID),
@@ -289,10 +296,163 @@ func (m *Manager) UpdatePeerID(sessionID, peerID string) error {
 	return nil
 }
 
+// SetObserver records that the session was authorized to join as a hidden
+// observer.
+func (m *Manager) SetObserver(ctx context.Context, sessionID string, observer bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	session.Observer = observer
+
+	if err := m.stateManager.SetSession(ctx, session.ToStateData()); err != nil {
+		m.logger.Error("Failed to persist observer flag",
+			zap.String("session_id", sessionID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// SetRelayOnly records that the session's peers must only use relay
+// candidates.
+func (m *Manager) SetRelayOnly(ctx context.Context, sessionID string, relayOnly bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	session.RelayOnly = relayOnly
+
+	if err := m.stateManager.SetSession(ctx, session.ToStateData()); err != nil {
+		m.logger.Error("Failed to persist relay-only flag",
+			zap.String("session_id", sessionID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// SetReceivePreferences records the session's receive preferences.
+func (m *Manager) SetReceivePreferences(ctx context.Context, sessionID string, prefs map[string]state.ReceivePreference) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	session.ReceivePreferences = maps.Clone(prefs)
+
+	if err := m.stateManager.SetSession(ctx, session.ToStateData()); err != nil {
+		m.logger.Error("Failed to persist receive preferences",
+			zap.String("session_id", sessionID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// SetPublishUntil records when the session's publishing window ends.
+func (m *Manager) SetPublishUntil(ctx context.Context, sessionID string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	session.PublishUntil = until
+
+	if err := m.stateManager.SetSession(ctx, session.ToStateData()); err != nil {
+		m.logger.Error("Failed to persist publish window",
+			zap.String("session_id", sessionID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// UpdateName records a display name change made during the call. A resumed
+// session whose join names no one keeps it.
+func (m *Manager) UpdateName(ctx context.Context, sessionID, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	session.Name = name
+
+	if err := m.stateManager.SetSession(ctx, session.ToStateData()); err != nil {
+		m.logger.Error("Failed to persist name update",
+			zap.String("session_id", sessionID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// Sizes returns the number of sessions and the sizes of the user and token
+// indexes over them.
+func (m *Manager) Sizes() (sessions, users, tokens int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.sessions), len(m.userSessions), len(m.tokens)
+}
+
+// CloseRoomSessions ends this instance's sessions for a room that is being
+// closed. With suspend they stay resumable for the session TTL, recording
+// each user's entry in talkTime; otherwise they are deleted.
+func (m *Manager) CloseRoomSessions(ctx context.Context, roomID string, suspend bool, talkTime map[string]time.Duration) int {
+	m.mu.Lock()
+	var ids []string
+	for id, session := range m.sessions {
+		if session.RoomID != roomID {
+			continue
+		}
+		if suspend {
+			if session.Suspended {
+				continue
+			}
+			if d := talkTime[session.UserID]; d > session.TalkTime {
+				session.TalkTime = d
+			}
+		}
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+
+	for _, id := range ids {
+		if suspend {
+			m.SuspendSession(ctx, id)
+		} else {
+			m.DeleteSession(ctx, id)
+		}
+	}
+	return len(ids)
+}
+
 // GetRoomSessions returns all active sessions in a room
-func (m *Manager) GetRoomSessions(roomID string) ([]*Session, error) {
+func (m *Manager) GetRoomSessions(ctx context.Context, roomID string) ([]*Session, error) {
 	// Get from state manager (source of truth for room membership)
-	stateData, err := m.stateManager.GetRoomSessions(roomID)
+	stateData, err := m.stateManager.GetRoomSessions(ctx, roomID)
 	if err != nil {
 		return nil, err
 	}
@@ -321,6 +481,25 @@ func (m *Manager) GetRoomSessions(roomID string) ([]*Session, error) {
 	return sessions, nil
 }
 
+// SuspendedUntil returns when the last suspended session for roomID stops
+// being resumable, or the zero time if none is.
+func (m *Manager) SuspendedUntil(roomID string, ttl time.Duration) time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var until time.Time
+	for _, session := range m.sessions {
+		if session.RoomID != roomID || !session.Suspended {
+			continue
+		}
+		if expiry := session.LastSeen.Add(ttl); expiry.After(now) && expiry.After(until) {
+			until = expiry
+		}
+	}
+	return until
+}
+
 // CleanupExpiredSessions removes sessions that have been suspended past the TTL
 func (m *Manager) CleanupExpiredSessions(ttl time.Duration) int {
 	m.mu.Lock()
@@ -360,7 +539,7 @@ func (m *Manager) CleanupExpiredSessions(ttl time.Duration) int {
 }
 
 // UpdateMediaState updates the media state of a session
-func (m *Manager) UpdateMediaState(sessionID string, mediaState state.MediaState) error {
+func (m *Manager) UpdateMediaState(ctx context.Context, sessionID string, mediaState state.MediaState) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -373,7 +552,7 @@ func (m *Manager) UpdateMediaState(sessionID string, mediaState state.MediaState
 	session.LastSeen = time.Now()
 
 	// Persist update
-	if err := m.stateManager.SetSession(session.ToStateData()); err != nil {
+	if err := m.stateManager.SetSession(ctx, session.ToStateData()); err != nil {
 		m.logger.Error("Failed to persist media state update",
 			zap.String("session_id", sessionID),
 			zap.Error(err),
@@ -384,8 +563,94 @@ func (m *Manager) UpdateMediaState(sessionID string, mediaState state.MediaState
 	return nil
 }
 
-// UpdateSubscriptions updates the subscriptions of a session
-func (m *Manager) UpdateSubscriptions(sessionID string, subscriptions map[string]bool) error {
+// UserSessionID returns the ID of userID's session in roomID, or "" if it has
+// none.
+func (m *Manager) UserSessionID(userID, roomID string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.userSessions[userRoomKey(userID, roomID)]
+}
+
+// UpdateSubscriptions replaces the subscriptions of a session. The session
+// keeps a copy, so the caller may go on changing subscriptions.
+func (m *Manager) UpdateSubscriptions(ctx context.Context, sessionID string, subscriptions map[string]bool) error {
+	return m.changeSubscriptions(ctx, sessionID, func(session *Session) {
+		session.SetSubscriptions(subscriptions)
+	})
+}
+
+// SetSubscribed records a subscription of a session to trackID, or its
+// removal.
+func (m *Manager) SetSubscribed(ctx context.Context, sessionID, trackID string, subscribed bool) error {
+	return m.changeSubscriptions(ctx, sessionID, func(session *Session) {
+		if subscribed {
+			session.Subscribe(trackID)
+		} else {
+			session.Unsubscribe(trackID)
+		}
+	})
+}
+
+// ChangeSubscriptions records the subscriptions a session gained and lost
+// in one write.
+func (m *Manager) ChangeSubscriptions(ctx context.Context, sessionID string, subscribed, unsubscribed []string) error {
+	if len(subscribed) == 0 && len(unsubscribed) == 0 {
+		return nil
+	}
+	return m.changeSubscriptions(ctx, sessionID, func(session *Session) {
+		session.updateSubscriptions(func(subs map[string]bool) {
+			for _, trackID := range unsubscribed {
+				delete(subs, trackID)
+			}
+			for _, trackID := range subscribed {
+				subs[trackID] = true
+			}
+		})
+	})
+}
+
+// PruneSubscriptions drops trackIDs, which no longer exist, from the
+// subscriptions of every session in roomID. The affected sessions are
+// persisted together. It returns how many sessions changed.
+func (m *Manager) PruneSubscriptions(ctx context.Context, roomID string, trackIDs ...string) int {
+	if len(trackIDs) == 0 {
+		return 0
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var changed []*state.SessionData
+	for _, session := range m.sessions {
+		if session.RoomID != roomID {
+			continue
+		}
+		subs := session.Subscriptions()
+		stale := false
+		for _, trackID := range trackIDs {
+			if _, ok := subs[trackID]; ok {
+				delete(subs, trackID)
+				stale = true
+			}
+		}
+		if !stale {
+			continue
+		}
+		session.SetSubscriptions(subs)
+		changed = append(changed, session.ToStateData())
+	}
+
+	if err := m.stateManager.SetSessions(ctx, changed); err != nil {
+		m.logger.Error("Failed to persist pruned subscriptions",
+			zap.String("room_id", roomID),
+			zap.Int("sessions", len(changed)),
+			zap.Error(err),
+		)
+	}
+	return len(changed)
+}
+
+func (m *Manager) changeSubscriptions(ctx context.Context, sessionID string, change func(*Session)) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -394,11 +659,11 @@ func (m *Manager) UpdateSubscriptions(sessionID string, subscriptions map[string
 		return fmt.Errorf("session not found: %s", sessionID)
 	}
 
-	session.Subscriptions = subscriptions
+	change(session)
 	session.LastSeen = time.Now()
 
 	// Persist update
-	if err := m.stateManager.SetSession(session.ToStateData()); err != nil {
+	if err := m.stateManager.SetSession(ctx, session.ToStateData()); err != nil {
 		m.logger.Error("Failed to persist subscriptions update",
 			zap.String("session_id", sessionID),
 			zap.Error(err),
@@ -409,8 +674,19 @@ func (m *Manager) UpdateSubscriptions(sessionID string, subscriptions map[string
 	return nil
 }
 
+// SetTalkTime records how long the session's user has spoken in its room.
+// It is persisted with the session's next write, normally its suspension.
+func (m *Manager) SetTalkTime(sessionID string, talkTime time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session, ok := m.sessions[sessionID]; ok {
+		session.TalkTime = talkTime
+	}
+}
+
 // GetSessionByToken retrieves a session by its resume token
-func (m *Manager) GetSessionByToken(token string) (*Session, error) {
+func (m *Manager) GetSessionByToken(ctx context.Context, token string) (*Session, error) {
 	m.mu.RLock()
 	sessionID, exists := m.tokens[token]
 	m.mu.RUnlock()
@@ -419,12 +695,12 @@ func (m *Manager) GetSessionByToken(token string) (*Session, error) {
 		return nil, fmt.Errorf("invalid token")
 	}
 
-	return m.GetSession(sessionID)
+	return m.GetSession(ctx, sessionID)
 }
 
 // RecoverSessions loads sessions from state manager on startup
-func (m *Manager) RecoverSessions() error {
-	sessions, err := m.stateManager.RecoverSessions()
+func (m *Manager) RecoverSessions(ctx context.Context) error {
+	sessions, err := m.stateManager.RecoverSessions(ctx)
 	if err != nil {
 		return err
 	}
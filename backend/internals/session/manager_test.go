@@ -0,0 +1,226 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"github.com/alicebob/miniredis/v2"
+	"go.uber.org/zap"
+)
+
+func TestTalkTimeSurvivesSuspension(t *testing.T) {
+	mr := miniredis.RunT(t)
+	sm, err := state.NewManager(mr.Addr(), "", 0, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+	ctx := context.Background()
+
+	m := NewManager(sm, zap.NewNop())
+	sess, err := m.CreateSession(ctx, "alice", "room-1", "Alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const talked = 42*time.Second + 300*time.Millisecond
+	m.SetTalkTime(sess.ID, talked)
+	if err := m.SuspendSession(ctx, sess.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another instance picks the session up from Redis
+	recovered := NewManager(sm, zap.NewNop())
+	if err := recovered.RecoverSessions(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got, err := recovered.GetSession(ctx, sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TalkTime != talked {
+		t.Fatalf("recovered talk time %v, want %v", got.TalkTime, talked)
+	}
+
+	resumed, err := m.ResumeSession(ctx, sess.ID, sess.Token, sess.RoomID, sess.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.TalkTime != talked {
+		t.Fatalf("resumed talk time %v, want %v", resumed.TalkTime, talked)
+	}
+}
+
+// newManager returns a Manager over a state manager on a miniredis of its
+// own.
+func newManager(t *testing.T) (*Manager, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	sm, err := state.NewManager(mr.Addr(), "", 0, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sm.Close() })
+	return NewManager(sm, zap.NewNop()), mr
+}
+
+// storedSubscriptions returns the subscriptions of sessionID as persisted
+// in Redis.
+func storedSubscriptions(t *testing.T, mr *miniredis.Miniredis, sessionID string) map[string]bool {
+	t.Helper()
+	data, err := mr.Get(state.SessionKey(sessionID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored state.SessionData
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		t.Fatalf("corrupt session in Redis: %v: %s", err, data)
+	}
+	return stored.Subscriptions
+}
+
+func TestSubscriptionsAreCopied(t *testing.T) {
+	m, _ := newManager(t)
+	ctx := context.Background()
+	sess, err := m.CreateSession(ctx, "alice", "room-1", "Alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The caller's map, a returned one and persisted data are all copies
+	mine := map[string]bool{"t_1": true}
+	if err := m.UpdateSubscriptions(ctx, sess.ID, mine); err != nil {
+		t.Fatal(err)
+	}
+	mine["t_2"] = true
+	got := sess.Subscriptions()
+	got["t_3"] = true
+	data := sess.ToStateData()
+	data.Subscriptions["t_4"] = true
+	if subs := sess.Subscriptions(); len(subs) != 1 || !subs["t_1"] {
+		t.Fatalf("session subscriptions %v, want only t_1", subs)
+	}
+
+	restored := FromStateData(data)
+	data.Subscriptions["t_5"] = true
+	if subs := restored.Subscriptions(); len(subs) != 2 || subs["t_5"] {
+		t.Fatalf("restored subscriptions %v", subs)
+	}
+
+	if err := m.SetSubscribed(ctx, sess.ID, "t_2", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ChangeSubscriptions(ctx, sess.ID, []string{"t_6"}, []string{"t_1"}); err != nil {
+		t.Fatal(err)
+	}
+	if subs := sess.Subscriptions(); len(subs) != 2 || !subs["t_2"] || !subs["t_6"] {
+		t.Fatalf("subscriptions after changes %v", subs)
+	}
+	if got["t_1"] != true || len(got) != 2 {
+		t.Fatal("a map returned earlier changed with the session")
+	}
+}
+
+// Subscriptions change from many goroutines, one of them still writing to
+// the map it handed over, while the sessions are read, pruned and
+// persisted. Run with -race.
+func TestConcurrentSubscriptionChanges(t *testing.T) {
+	m, mr := newManager(t)
+	ctx := context.Background()
+	var sessions []*Session
+	for _, user := range []string{"alice", "bob", "carol"} {
+		sess, err := m.CreateSession(ctx, user, "room-1", user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, sess)
+	}
+
+	const rounds = 200
+	var wg sync.WaitGroup
+	run := func(fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				fn(i)
+			}
+		}()
+	}
+	for _, sess := range sessions {
+		id := sess.ID
+		mine := make(map[string]bool)
+		run(func(i int) {
+			mine[fmt.Sprintf("t_%d", i%10)] = i%2 == 0
+			m.UpdateSubscriptions(ctx, id, mine)
+			mine[fmt.Sprintf("t_%d", i%7)] = true // after the hand-over
+		})
+		run(func(i int) { m.SetSubscribed(ctx, id, fmt.Sprintf("t_%d", i%5), i%3 != 0) })
+		run(func(i int) { m.ChangeSubscriptions(ctx, id, []string{"t_a"}, []string{fmt.Sprintf("t_%d", i%4)}) })
+	}
+	run(func(i int) { m.PruneSubscriptions(ctx, "room-1", fmt.Sprintf("t_%d", i%10)) })
+	run(func(int) {
+		all, err := m.GetRoomSessions(ctx, "room-1")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, sess := range all {
+			for range sess.Subscriptions() {
+			}
+			sess.ToStateData()
+		}
+	})
+	wg.Wait()
+
+	// Once the writes settle, Redis holds each session's last state intact
+	for _, sess := range sessions {
+		if err := m.UpdateSubscriptions(ctx, sess.ID, map[string]bool{"t_final": true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for _, sess := range sessions {
+		for {
+			subs := storedSubscriptions(t, mr, sess.ID)
+			if len(subs) == 1 && subs["t_final"] {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s stored with %v", sess.UserID, subs)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestResumeSessionOfAnotherRoom(t *testing.T) {
+	m, _ := newManager(t)
+	ctx := context.Background()
+	sess, err := m.CreateSession(ctx, "alice", "room-2", "Alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SuspendSession(ctx, sess.ID); err != nil {
+		t.Fatal(err)
+	}
+	token := sess.Token
+
+	// A session resumes only for its own user and room, and one that does
+	// not match is left suspended with its token
+	for _, tc := range []struct{ roomID, userID string }{{"room-1", "alice"}, {"room-2", "mallory"}} {
+		if _, err := m.ResumeSession(ctx, sess.ID, token, tc.roomID, tc.userID); err == nil {
+			t.Fatalf("resumed as %s in %s", tc.userID, tc.roomID)
+		}
+	}
+	if !sess.Suspended || sess.Token != token {
+		t.Fatal("a refused resume changed the session")
+	}
+	if _, err := m.ResumeSession(ctx, sess.ID, token, "room-2", "alice"); err != nil {
+		t.Fatal(err)
+	}
+}
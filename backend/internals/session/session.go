@@ -3,6 +3,8 @@ package session
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"maps"
+	"sync"
 	"time"
 
 	"github.com/adityaadpandey/sfu-go/internals/state"
@@ -17,12 +19,37 @@ type Session struct {
 	Name   string
 	PeerID string // Current peer ID (changes on reconnect)
 
-	MediaState    state.MediaState
-	Subscriptions map[string]bool // trackID -> subscribed
+	MediaState state.MediaState
+
+	// trackID -> subscribed. The map is never changed in place: every
+	// change swaps in a new one under subMu, so a map being persisted or
+	// read by a caller stays as it was.
+	subscriptions map[string]bool
+	subMu         sync.RWMutex
 
 	CreatedAt time.Time
 	LastSeen  time.Time
 	Suspended bool
+
+	// Observer is set once an observer join was authorized, so a resumed
+	// session can rejoin hidden without presenting the invite again.
+	Observer bool
+
+	// RelayOnly is set once the participant joined relay-only, so a resumed
+	// session keeps the policy even without the invite that required it.
+	RelayOnly bool
+
+	// TalkTime carries the user's speaking time across reconnects.
+	TalkTime time.Duration
+
+	// PublishUntil is when the participant's publishing window ends, set
+	// at the first join that limited it, so a resumed session gets the
+	// time that is left rather than a new window.
+	PublishUntil time.Time
+
+	// ReceivePreferences are the participant's receive caps by track or
+	// codec group handle, reapplied when a resumed session rejoins.
+	ReceivePreferences map[string]state.ReceivePreference
 }
 
 // NewSession creates a new session for a user joining a room
@@ -38,25 +65,74 @@ func NewSession(userID, roomID, name string) *Session {
 			CameraEnabled: true,
 			ScreenEnabled: false,
 		},
-		Subscriptions: make(map[string]bool),
+		subscriptions: make(map[string]bool),
 		CreatedAt:     time.Now(),
 		LastSeen:      time.Now(),
 		Suspended:     false,
 	}
 }
 
+// Subscriptions returns a copy of the session's subscriptions.
+func (s *Session) Subscriptions() map[string]bool {
+	s.subMu.RLock()
+	defer s.subMu.RUnlock()
+	return maps.Clone(s.subscriptions)
+}
+
+// SetSubscriptions replaces the session's subscriptions with a copy of
+// subscriptions.
+func (s *Session) SetSubscriptions(subscriptions map[string]bool) {
+	subscriptions = maps.Clone(subscriptions)
+	if subscriptions == nil {
+		subscriptions = make(map[string]bool)
+	}
+	s.subMu.Lock()
+	s.subscriptions = subscriptions
+	s.subMu.Unlock()
+}
+
+// Subscribe records a subscription to trackID.
+func (s *Session) Subscribe(trackID string) {
+	s.updateSubscriptions(func(subs map[string]bool) { subs[trackID] = true })
+}
+
+// Unsubscribe removes the subscription to trackID.
+func (s *Session) Unsubscribe(trackID string) {
+	s.updateSubscriptions(func(subs map[string]bool) { delete(subs, trackID) })
+}
+
+// updateSubscriptions applies change to a copy of the subscriptions and
+// swaps it in.
+func (s *Session) updateSubscriptions(change func(map[string]bool)) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	subs := maps.Clone(s.subscriptions)
+	if subs == nil {
+		subs = make(map[string]bool)
+	}
+	change(subs)
+	s.subscriptions = subs
+}
+
 // ToStateData converts Session to state.SessionData for persistence
 func (s *Session) ToStateData() *state.SessionData {
 	return &state.SessionData{
 		ID:            s.ID,
 		UserID:        s.UserID,
+		PeerID:        s.PeerID,
 		RoomID:        s.RoomID,
 		Name:          s.Name,
 		MediaState:    s.MediaState,
-		Subscriptions: s.Subscriptions,
+		Subscriptions: s.Subscriptions(),
 		CreatedAt:     s.CreatedAt,
 		LastSeen:      s.LastSeen,
 		Suspended:     s.Suspended,
+		Observer:      s.Observer,
+		RelayOnly:     s.RelayOnly,
+		TalkTimeMs:    s.TalkTime.Milliseconds(),
+		PublishUntil:  s.PublishUntil,
+
+		ReceivePreferences: maps.Clone(s.ReceivePreferences),
 	}
 }
 
@@ -66,13 +142,20 @@ func FromStateData(data *state.SessionData) *Session {
 	return &Session{
 		ID:            data.ID,
 		UserID:        data.UserID,
+		PeerID:        data.PeerID,
 		RoomID:        data.RoomID,
 		Name:          data.Name,
 		MediaState:    data.MediaState,
-		Subscriptions: data.Subscriptions,
+		subscriptions: maps.Clone(data.Subscriptions),
 		CreatedAt:     data.CreatedAt,
 		LastSeen:      data.LastSeen,
 		Suspended:     data.Suspended,
+		Observer:      data.Observer,
+		RelayOnly:     data.RelayOnly,
+		TalkTime:      time.Duration(data.TalkTimeMs) * time.Millisecond,
+		PublishUntil:  data.PublishUntil,
+
+		ReceivePreferences: maps.Clone(data.ReceivePreferences),
 	}
 }
 
@@ -0,0 +1,136 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+// trackRejections collects the track-rejected messages a client is sent.
+type trackRejections struct {
+	mu      sync.Mutex
+	reasons []string
+}
+
+func (tr *trackRejections) handlers() client.Handlers {
+	return client.Handlers{OnMessage: func(m signaling.Message) {
+		if m.Type != signaling.MessageTypeTrackRejected {
+			return
+		}
+		var rejected signaling.TrackRejectedMessage
+		if json.Unmarshal(m.Data, &rejected) == nil {
+			tr.mu.Lock()
+			tr.reasons = append(tr.reasons, rejected.Reason)
+			tr.mu.Unlock()
+		}
+	}}
+}
+
+func (tr *trackRejections) get() []string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return append([]string(nil), tr.reasons...)
+}
+
+// trackCount is the number of tracks published in roomID.
+func (ts *testServer) trackCount(roomID string) int {
+	rm := ts.lookupRoom(roomID)
+	if rm == nil {
+		return 0
+	}
+	return rm.GetTrackCount()
+}
+
+// expectTrackLimit checks that, with limit tracks published, the last
+// publisher had exactly one track rejected for reason.
+func expectTrackLimit(t *testing.T, ts *testServer, rejections *trackRejections, reason string, limit int, roomIDs ...string) {
+	t.Helper()
+	total := func() int {
+		n := 0
+		for _, id := range roomIDs {
+			n += ts.trackCount(id)
+		}
+		return n
+	}
+	eventually(t, "the track over the limit to be rejected", func() bool { return len(rejections.get()) > 0 })
+	eventually(t, "the tracks up to the limit", func() bool { return total() == limit })
+	// Nothing more arrives later
+	time.Sleep(200 * time.Millisecond)
+	if got := rejections.get(); len(got) != 1 || got[0] != reason {
+		t.Fatalf("rejections %v, want one %s", got, reason)
+	}
+	if n := total(); n != limit {
+		t.Fatalf("%d tracks published, want %d", n, limit)
+	}
+}
+
+func TestRoomTrackLimit(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.MaxTracksPerRoom = 3
+	})
+
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	publish(t, alice, "alice")
+	eventually(t, "alice's tracks", func() bool { return ts.trackCount("room-1") == 2 })
+
+	// Bob's first track is the room's third and the second its fourth
+	var rejections trackRejections
+	bob := ts.join(t, "bob", "room-1", rejections.handlers(), client.JoinOptions{})
+	publish(t, bob, "bob")
+	expectTrackLimit(t, ts, &rejections, "room_track_limit", 3, "room-1")
+}
+
+func TestInstanceTrackLimit(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.MaxTracksPerInstance = 3
+	})
+
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	publish(t, alice, "alice")
+	eventually(t, "alice's tracks", func() bool { return ts.trackCount("room-1") == 2 })
+
+	// The cap counts every room
+	var rejections trackRejections
+	bob := ts.join(t, "bob", "room-2", rejections.handlers(), client.JoinOptions{})
+	publish(t, bob, "bob")
+	expectTrackLimit(t, ts, &rejections, "instance_track_limit", 3, "room-1", "room-2")
+
+	var health struct {
+		Tracks      int               `json:"tracks"`
+		TrackLimits healthTrackLimits `json:"trackLimits"`
+	}
+	ts.api(t, http.MethodGet, ts.config.Server.HealthPath, "", "", &health)
+	if health.Tracks != 3 || health.TrackLimits.PerInstance != 3 {
+		t.Fatalf("health reports %d tracks with limits %+v", health.Tracks, health.TrackLimits)
+	}
+}
+
+func TestJoinTrackProjection(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.MaxTracksPerRoom = 4
+		cfg.Media.JoinTrackProjection = 2
+	})
+
+	// Two peers project to the four tracks the room takes
+	ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := ts.connect(t, "carol", client.Handlers{}).JoinRoom(ctx, "room-1", client.JoinOptions{})
+	var serverErr *client.ServerError
+	if !errors.As(err, &serverErr) || serverErr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("third join: err = %v, want a 503", err)
+	}
+
+	// A user who is already in the room adds nothing
+	ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{})
+}
@@ -0,0 +1,120 @@
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// Every REST error is a JSON envelope,
+// {"error":{"code":"not_found","message":"Room not found","details":...}},
+// with the HTTP status giving the class of failure and code the cause.
+
+// apiError is the body of the REST error envelope.
+type apiError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// apiErrorCodes maps statuses to the code used when a handler gives none.
+var apiErrorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusInternalServerError:   "internal",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusInsufficientStorage:   "insufficient_storage",
+}
+
+// writeAPIError answers with the error envelope, the code derived from
+// status.
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIErrorCode(w, status, "", message, nil)
+}
+
+// writeAPIErrorCode answers with the error envelope. An empty code is
+// derived from status.
+func writeAPIErrorCode(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	if code == "" {
+		code = apiErrorCodes[status]
+	}
+	if code == "" {
+		code = "error"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error apiError `json:"error"`
+	}{apiError{Code: code, Message: message, Details: details}})
+}
+
+// writeMethodNotAllowed answers 405 with the methods the endpoint takes.
+func writeMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeAPIErrorCode(w, http.StatusMethodNotAllowed, "", "Method not allowed",
+		map[string][]string{"allowed": allowed})
+}
+
+// retryDetails is what a signaling error adds to the REST envelope.
+type retryDetails struct {
+	Retryable         bool   `json:"retryable,omitempty"`
+	RetryAfterMs      int64  `json:"retryAfterMs,omitempty"`
+	AlternateInstance string `json:"alternateInstance,omitempty"`
+	AlternateURL      string `json:"alternateUrl,omitempty"`
+	Region            string `json:"region,omitempty"`
+}
+
+// writeSignalingError answers with a signaling error body in the envelope,
+// its reason as the code.
+func writeSignalingError(w http.ResponseWriter, body signaling.ErrorMessage) {
+	var details interface{}
+	if body.Retryable || body.AlternateInstance != "" || body.AlternateURL != "" {
+		details = retryDetails{
+			Retryable:         body.Retryable,
+			RetryAfterMs:      body.RetryAfterMs,
+			AlternateInstance: body.AlternateInstance,
+			AlternateURL:      body.AlternateURL,
+			Region:            body.Region,
+		}
+	}
+	writeAPIErrorCode(w, body.Code, body.Reason, body.Message, details)
+}
+
+// decodeJSONBody decodes r's body into v. The body must be JSON and at most
+// Server.APIMaxBodyBytes; otherwise the request is answered with 415, 413 or
+// 400 and false is returned.
+func (s *SFU) decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		writeAPIError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return false
+	}
+	if limit := s.config.Server.APIMaxBodyBytes; limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeAPIErrorCode(w, http.StatusRequestEntityTooLarge, "", "Request body too large",
+				map[string]int64{"limitBytes": tooLarge.Limit})
+			return false
+		}
+		writeAPIErrorCode(w, http.StatusBadRequest, "", "Invalid request body",
+			map[string]string{"reason": err.Error()})
+		return false
+	}
+	return true
+}
+
+// handleAPINotFound answers requests for /api paths that do not exist.
+func (s *SFU) handleAPINotFound(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, "Not found")
+}
@@ -0,0 +1,274 @@
+package sfu
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+)
+
+// rawAPI sends a REST request with contentType and the admin key, and
+// returns the response with its body read.
+func (ts *testServer) rawAPI(t *testing.T, method, path, contentType, body string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.http.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("X-API-Key", testAdminKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+func TestAPIErrorEnvelope(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Server.APIMaxBodyBytes = 256
+	})
+	if code := ts.api(t, http.MethodPost, "/api/rooms", `{"id":"room-1","maxPeers":10}`, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("POST room: %d", code)
+	}
+
+	for _, tc := range []struct {
+		name, method, path, contentType, body string
+		status                                int
+		code                                  string
+	}{
+		{"malformed body", http.MethodPost, "/api/rooms", "application/json", `{"id":`, http.StatusBadRequest, "bad_request"},
+		{"bad listing filter", http.MethodGet, "/api/rooms?minPeers=many", "", "", http.StatusBadRequest, "bad_request"},
+		{"no admin key", http.MethodGet, "/api/stats", "", "", http.StatusUnauthorized, "unauthorized"},
+		{"unknown room", http.MethodGet, "/api/rooms/nope", "", "", http.StatusNotFound, "not_found"},
+		{"unknown path", http.MethodGet, "/api/nothing", "", "", http.StatusNotFound, "not_found"},
+		{"wrong method", http.MethodPut, "/api/rooms", "", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"conflicting room", http.MethodPost, "/api/rooms", "application/json", `{"id":"room-1","maxPeers":20}`, http.StatusConflict, "conflict"},
+		{"body too large", http.MethodPost, "/api/rooms", "application/json", `{"id":"` + strings.Repeat("a", 512) + `"}`, http.StatusRequestEntityTooLarge, "payload_too_large"},
+		{"not JSON", http.MethodPost, "/api/rooms", "text/plain", `{"id":"room-2"}`, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.http.URL+tc.path, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			if tc.status != http.StatusUnauthorized {
+				req.Header.Set("X-API-Key", testAdminKey)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectEnvelope(t, resp, data, tc.status, tc.code)
+			if tc.status == http.StatusMethodNotAllowed && resp.Header.Get("Allow") == "" {
+				t.Fatal("405 without an Allow header")
+			}
+		})
+	}
+
+	// A store failure is a 500 in the same envelope
+	ts.redis.SetError("boom")
+	resp, data := ts.rawAPI(t, http.MethodPost, "/api/rooms/room-1/invites", "application/json", `{}`)
+	ts.redis.SetError("")
+	expectEnvelope(t, resp, data, http.StatusInternalServerError, "internal")
+}
+
+// expectEnvelope fails unless resp is a JSON error envelope, and nothing
+// else, with status and code.
+func expectEnvelope(t *testing.T, resp *http.Response, data []byte, status int, code string) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("status %d, want %d: %s", resp.StatusCode, status, data)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type %q: %s", ct, data)
+	}
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		t.Fatalf("%v: %s", err, data)
+	}
+	if _, ok := envelope["error"]; !ok || len(envelope) != 1 {
+		t.Fatalf("not an error envelope: %s", data)
+	}
+	var body apiError
+	if err := json.Unmarshal(envelope["error"], &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != code || body.Message == "" {
+		t.Fatalf("error %+v, want code %s and a message", body, code)
+	}
+}
+
+var pathTemplateParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+func TestOpenAPIDocument(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	resp, data := ts.rawAPI(t, http.MethodGet, "/api/openapi.json", "", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("GET openapi.json: %d, %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.") {
+		t.Fatalf("openapi version %q", v)
+	}
+	info, _ := doc["info"].(map[string]interface{})
+	if info["title"] == "" || info["version"] == "" {
+		t.Fatalf("info %v lacks a title or version", info)
+	}
+
+	// Every reference resolves within the document
+	var walk func(where string, v interface{})
+	walk = func(where string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				if resolve(doc, ref) == nil {
+					t.Errorf("%s: dangling reference %s", where, ref)
+				}
+			}
+			for k, child := range v {
+				walk(where+"/"+k, child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(where, child)
+			}
+		}
+	}
+	walk("#", doc)
+
+	methods := map[string]bool{"get": true, "put": true, "post": true, "delete": true, "patch": true}
+	paths, _ := doc["paths"].(map[string]interface{})
+	for _, want := range []string{"/api/rooms", "/api/rooms/{id}/peers", "/api/rooms/{id}/invites", "/api/recordings/{recordingId}", "/api/stats"} {
+		if _, ok := paths[want]; !ok {
+			t.Errorf("%s is not documented", want)
+		}
+	}
+	for path, item := range paths {
+		for method, op := range item.(map[string]interface{}) {
+			if !methods[method] {
+				t.Errorf("%s: unknown method %s", path, method)
+				continue
+			}
+			op := op.(map[string]interface{})
+			where := strings.ToUpper(method) + " " + path
+
+			// Path parameters are declared, and only those
+			declared := map[string]bool{}
+			params, _ := op["parameters"].([]interface{})
+			for _, p := range params {
+				p := p.(map[string]interface{})
+				if p["in"] == "path" {
+					if p["required"] != true {
+						t.Errorf("%s: path parameter %v is not required", where, p["name"])
+					}
+					declared[p["name"].(string)] = true
+				}
+			}
+			var inPath []string
+			for _, m := range pathTemplateParam.FindAllStringSubmatch(path, -1) {
+				inPath = append(inPath, m[1])
+				if !declared[m[1]] {
+					t.Errorf("%s: {%s} is not declared", where, m[1])
+				}
+			}
+			if len(inPath) != len(declared) {
+				t.Errorf("%s: declares %v, path has %v", where, declared, inPath)
+			}
+
+			responses, _ := op["responses"].(map[string]interface{})
+			if len(responses) == 0 {
+				t.Errorf("%s: no responses", where)
+			}
+			for status, r := range responses {
+				r := r.(map[string]interface{})
+				if _, ok := r["$ref"]; !ok && r["description"] == nil {
+					t.Errorf("%s: %s response has no description", where, status)
+				}
+			}
+			if _, ok := responses["405"]; !ok {
+				t.Errorf("%s: 405 is not documented", where)
+			}
+			security, _ := op["security"].([]interface{})
+			for _, req := range security {
+				for scheme := range req.(map[string]interface{}) {
+					if resolve(doc, "#/components/securitySchemes/"+scheme) == nil {
+						t.Errorf("%s: unknown security scheme %s", where, scheme)
+					}
+				}
+			}
+		}
+	}
+
+	// Every documented read is routed to a handler of its own
+	for path, item := range paths {
+		if _, ok := item.(map[string]interface{})["get"]; !ok || path == "/api/openapi.json" {
+			continue
+		}
+		resp, data := ts.rawAPI(t, http.MethodGet, pathTemplateParam.ReplaceAllString(path, "x"), "", "")
+		if resp.StatusCode == http.StatusMethodNotAllowed || strings.Contains(string(data), `"message":"Not found"`) {
+			t.Errorf("GET %s is documented but not served: %d %s", path, resp.StatusCode, data)
+		}
+	}
+
+	// The document served is the one built at startup
+	if !reflect.DeepEqual(doc, roundTrip(t, ts.buildOpenAPI())) {
+		t.Fatal("served document differs from buildOpenAPI")
+	}
+}
+
+// resolve follows a local JSON pointer reference in doc, returning nil when
+// it does not resolve.
+func resolve(doc map[string]interface{}, ref string) interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	var v interface{} = doc
+	for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if v, ok = m[key]; !ok {
+			return nil
+		}
+	}
+	return v
+}
+
+func roundTrip(t *testing.T, v interface{}) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package sfu
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// distinctTracks records the IDs of the tracks a session receives packets
+// on.
+type distinctTracks struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+func (dt *distinctTracks) onTrack(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+	for {
+		if _, _, err := track.ReadRTP(); err != nil {
+			return
+		}
+		dt.mu.Lock()
+		dt.ids[track.ID()] = true
+		dt.mu.Unlock()
+	}
+}
+
+func (dt *distinctTracks) count() int {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	return len(dt.ids)
+}
+
+// attachLatencies returns how many joins have recorded the time their
+// existing tracks took to attach.
+func attachLatencies(t *testing.T) (uint64, float64) {
+	t.Helper()
+	var m dto.Metric
+	if err := appmetrics.JoinAttachLatencyMs.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+// A subscriber joining a room of 40 tracks gets every one of them, however
+// the attachments are spread over workers or cut short by the deadline, and
+// the deadline bounds how long attaching holds up the answer.
+func TestJoinAttachManyTracks(t *testing.T) {
+	const tracks = 40
+	for _, tc := range []struct {
+		name     string
+		workers  int
+		timeout  time.Duration
+		deferred bool
+	}{
+		{"one at a time", 1, 0, false},
+		{"parallel", 8, 0, false},
+		{"past the deadline", 8, 5 * time.Millisecond, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t, nil, func(cfg *config.Config) {
+				cfg.Media.JoinAttachWorkers = tc.workers
+				cfg.Media.JoinAttachTimeout = tc.timeout
+			})
+			alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+			for i := 0; i < tracks; i++ {
+				track, err := client.NewSampleTrack(webrtc.MimeTypeVP8, fmt.Sprintf("alice-cam-%d", i), "alice")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := alice.PublishTrack(track); err != nil {
+					t.Fatal(err)
+				}
+				sendVideo(t, track)
+			}
+			rm := ts.lookupRoom("room-1")
+			eventually(t, "alice's tracks", func() bool { return rm.GetTrackCount() == tracks })
+
+			deferredBefore := testutil.ToFloat64(appmetrics.JoinAttachDeferredTotal)
+			attachesBefore, msBefore := attachLatencies(t)
+			received := &distinctTracks{ids: make(map[string]bool)}
+			start := time.Now()
+			ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{RecvVideo: tracks, OnTrack: received.onTrack})
+			t.Logf("bob's join answered after %v", time.Since(start))
+
+			deferred := testutil.ToFloat64(appmetrics.JoinAttachDeferredTotal) - deferredBefore
+			if tc.deferred != (deferred > 0) {
+				t.Fatalf("%v tracks deferred", deferred)
+			}
+			attaches, ms := attachLatencies(t)
+			if attaches-attachesBefore != 1 {
+				t.Fatalf("%d attach latencies recorded for one join", attaches-attachesBefore)
+			}
+			t.Logf("attaching took %vms", ms-msBefore)
+			// Only attachments started before the deadline run past it
+			if tc.timeout > 0 && ms-msBefore > float64(tc.timeout.Milliseconds())+50 {
+				t.Fatalf("attaching took %vms with a deadline of %v", ms-msBefore, tc.timeout)
+			}
+			deadline := time.Now().Add(10 * time.Second)
+			for received.count() < tracks && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if n := received.count(); n != tracks {
+				t.Fatalf("bob received %d of %d tracks", n, tracks)
+			}
+		})
+	}
+}
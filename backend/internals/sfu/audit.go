@@ -0,0 +1,192 @@
+package sfu
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/authz"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// Audited actions
+const (
+	auditRoomCreate     = "room.create"
+	auditRoomDelete     = "room.delete"
+	auditInviteCreate   = "invite.create"
+	auditInviteRevoke   = "invite.revoke"
+	auditRoomBroadcast  = "room.broadcast"
+	auditRoomPriorities = "room.priorities"
+	auditRoomTalkTime   = "room.talk_time"
+	auditRoomClose      = "room.close"
+	auditRoomSummary    = "room.call_summary"
+	auditRoomSettings   = "room.settings"
+	auditRoomTimeLimit  = "room.time_limit"
+	auditRoomHost       = "room.host"
+	auditRoomMuteAll    = "room.mute_all"
+	auditRoomSpotlight  = "room.spotlight"
+	auditRoomLock       = "room.lock"
+	auditPeerMic        = "peer.mic"
+	auditPeerRename     = "peer.rename"
+	auditPeerNegotiate  = "peer.renegotiate"
+	auditPeerICERestart = "peer.ice_restart"
+	auditServerDrain    = "server.drain"
+	auditCaptureStart   = "capture.start"
+	auditCaptureStop    = "capture.stop"
+	auditCaptureDelete  = "capture.delete"
+	auditWebhookTrim    = "webhook.trim"
+)
+
+// requestActor identifies who issued an admin request: the JWT subject when
+// the bearer token is a JWT the configured authorizer verifies, otherwise a
+// fingerprint of the API key or token, falling back to the remote address.
+// Tokens are never recorded verbatim.
+func (s *SFU) requestActor(r *http.Request) string {
+	token := r.Header.Get("X-API-Key")
+	if token == "" {
+		token = bearerToken(r)
+	}
+
+	if token != "" {
+		if j, ok := s.authorizer.(*authz.JWTClaims); ok {
+			if claims, err := j.Parse(token, false); err == nil && claims.Subject != "" {
+				return "jwt:" + claims.Subject
+			}
+		}
+		sum := sha256.Sum256([]byte(token))
+		return "key:" + hex.EncodeToString(sum[:6])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "anonymous@" + host
+}
+
+// clientActor identifies the user behind a signaling connection.
+func clientActor(client *signaling.Client) string {
+	return "user:" + client.UserID
+}
+
+// auditRequest records an admin REST action.
+func (s *SFU) auditRequest(r *http.Request, action, roomID, result string, detail map[string]string) {
+	s.auditLogger.Log(audit.Event{
+		Actor:  s.requestActor(r),
+		Action: action,
+		RoomID: roomID,
+		Result: result,
+		Detail: detail,
+	})
+}
+
+// auditPeerRequest records an admin REST action on one peer.
+func (s *SFU) auditPeerRequest(r *http.Request, action, roomID, peerID, result string, detail map[string]string) {
+	s.auditLogger.Log(audit.Event{
+		Actor:  s.requestActor(r),
+		Action: action,
+		RoomID: roomID,
+		PeerID: peerID,
+		Result: result,
+		Detail: detail,
+	})
+}
+
+// auditClient records a moderation action issued over signaling.
+func (s *SFU) auditClient(client *signaling.Client, action, peerID, result string, detail map[string]string) {
+	s.auditLogger.Log(audit.Event{
+		Actor:  clientActor(client),
+		Action: action,
+		RoomID: client.RoomID(),
+		PeerID: peerID,
+		Result: result,
+		Detail: detail,
+	})
+}
+
+// auditEventResponse is an audit event as the REST API returns it.
+type auditEventResponse struct {
+	Time       time.Time         `json:"time"`
+	InstanceID string            `json:"instanceId,omitempty"`
+	Actor      string            `json:"actor"`
+	Action     string            `json:"action"`
+	RoomID     string            `json:"roomId,omitempty"`
+	PeerID     string            `json:"peerId,omitempty"`
+	Result     string            `json:"result"`
+	Detail     map[string]string `json:"detail,omitempty"`
+	// Only with Server.LegacyFieldNames
+	*legacyAuditFields
+}
+
+// legacyAuditFields are the names audit events had in the REST API before
+// schema version 2. The file and stream sinks keep them.
+type legacyAuditFields struct {
+	InstanceID string `json:"instance_id,omitempty"`
+	RoomID     string `json:"room_id,omitempty"`
+	PeerID     string `json:"peer_id,omitempty"`
+}
+
+// auditEventsResponse is the body of GET /api/audit.
+type auditEventsResponse struct {
+	Events []auditEventResponse `json:"events"`
+	Total  int                  `json:"total"`
+}
+
+// auditEventResponse returns ev as the REST API presents it.
+func (s *SFU) auditEventResponse(ev audit.Event) auditEventResponse {
+	resp := auditEventResponse{
+		Time:       ev.Time,
+		InstanceID: ev.InstanceID,
+		Actor:      ev.Actor,
+		Action:     ev.Action,
+		RoomID:     ev.RoomID,
+		PeerID:     ev.PeerID,
+		Result:     ev.Result,
+		Detail:     ev.Detail,
+	}
+	if s.config.Server.LegacyFieldNames {
+		resp.legacyAuditFields = &legacyAuditFields{
+			InstanceID: ev.InstanceID,
+			RoomID:     ev.RoomID,
+			PeerID:     ev.PeerID,
+		}
+	}
+	return resp
+}
+
+// handleAuditAPI serves GET /api/audit?roomId=...&limit=... from the local
+// in-memory buffer, newest first.
+func (s *SFU) handleAuditAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if s.auditLogger == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "Audit logging is disabled")
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeAPIError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	events := s.auditLogger.Query(r.URL.Query().Get("roomId"), limit)
+	resp := auditEventsResponse{Events: make([]auditEventResponse, 0, len(events)), Total: len(events)}
+	for _, ev := range events {
+		resp.Events = append(resp.Events, s.auditEventResponse(ev))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
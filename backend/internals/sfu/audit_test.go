@@ -0,0 +1,100 @@
+package sfu
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/authz"
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"go.uber.org/zap"
+)
+
+// signJWT returns an HS256 token for payload signed with secret.
+func signJWT(secret, payload string) string {
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestRequestActor(t *testing.T) {
+	jwt, err := authz.NewJWTClaims(authz.JWTOptions{Secret: []byte("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified := signJWT("secret", `{"sub":"alice"}`)
+	forged := signJWT("other", `{"sub":"alice"}`)
+
+	for _, tc := range []struct {
+		name       string
+		authorizer authz.Authorizer
+		header     string
+		value      string
+		want       string
+	}{
+		{"verified jwt", jwt, "Authorization", "Bearer " + verified, "jwt:alice"},
+		{"lower-case scheme", jwt, "Authorization", "bearer " + verified, "jwt:alice"},
+		{"forged jwt", jwt, "Authorization", "Bearer " + forged, "key:"},
+		{"jwt without a jwt authorizer", authz.AllowAll{}, "Authorization", "Bearer " + verified, "key:"},
+		{"api key", jwt, "X-API-Key", "admin-key", "key:"},
+		{"nothing", jwt, "", "", "anonymous@192.0.2.1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &SFU{authorizer: tc.authorizer}
+			r := httptest.NewRequest(http.MethodGet, "/api/rooms", nil)
+			r.RemoteAddr = "192.0.2.1:4242"
+			if tc.header != "" {
+				r.Header.Set(tc.header, tc.value)
+			}
+			got := s.requestActor(r)
+			if !strings.HasPrefix(got, tc.want) || strings.Contains(got, "secret") {
+				t.Fatalf("actor = %q, want %q...", got, tc.want)
+			}
+			if tc.want == "key:" && (got == "key:" || strings.Contains(got, tc.value)) {
+				t.Fatalf("actor = %q, want a fingerprint", got)
+			}
+		})
+	}
+}
+
+func TestAuditAPIRequiresAdminKey(t *testing.T) {
+	logger, err := audit.NewLogger(audit.Options{RingSize: 8}, nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	s := &SFU{
+		config:      &config.Config{Server: config.ServerConfig{AdminKey: "admin-key"}},
+		auditLogger: logger,
+	}
+	handler := s.requireAdminKey(s.handleAuditAPI)
+
+	for key, want := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "admin-key": http.StatusOK} {
+		r := httptest.NewRequest(http.MethodGet, "/api/audit", nil)
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != want {
+			t.Errorf("key %q: status %d, want %d", key, w.Code, want)
+		}
+	}
+}
+
+func TestRoomMessagesRequireAdminKey(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	ts.joinScripted(t, "alice", "room-1")
+	for key, want := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, testAdminKey: http.StatusOK} {
+		if code := ts.api(t, http.MethodPost, "/api/rooms/room-1/messages", `{"payload":{"text":"hi"}}`, key, nil); code != want {
+			t.Errorf("key %q: status %d, want %d", key, code, want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package sfu
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/adityaadpandey/sfu-go/internals/authz"
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// Joins, published tracks and forwarded tracks are checked with an
+// authz.Authorizer on top of invites and room settings. The built-in ones
+// are chosen with Authz.Mode; programs embedding the SFU may plug in their
+// own with SetAuthorizer. A join decision's constraints are applied to the
+// peer: its role replaces the invite's, relayOnly forces TURN and
+// maxTracks caps what the peer may publish.
+
+// Reasons of tracks refused by the authorizer or the peer's track cap
+const (
+	rejectNotAuthorized    = "not_authorized"
+	rejectAuthzUnavailable = "authorization_unavailable"
+	rejectPeerTrackLimit   = "peer_track_limit"
+)
+
+// Results recorded in sfu_authz_decisions_total
+const (
+	authzResultAllowed = "allowed"
+	authzResultDenied  = "denied"
+	authzResultError   = "error"
+)
+
+// newAuthorizer builds the authorizer selected by cfg.Mode.
+func newAuthorizer(cfg config.AuthzConfig) (authz.Authorizer, error) {
+	switch cfg.Mode {
+	case "", "allow-all":
+		return authz.AllowAll{}, nil
+	case "jwt":
+		return authz.NewJWTClaims(authz.JWTOptions{
+			Secret:   []byte(cfg.JWTSecret),
+			Issuer:   cfg.JWTIssuer,
+			Audience: cfg.JWTAudience,
+		})
+	case "http":
+		header := http.Header{}
+		if cfg.CallbackToken != "" {
+			header.Set("Authorization", "Bearer "+cfg.CallbackToken)
+		}
+		return authz.NewHTTPCallback(authz.HTTPCallbackOptions{
+			URL:          cfg.CallbackURL,
+			Header:       header,
+			Timeout:      cfg.CallbackTimeout,
+			Retries:      cfg.CallbackRetries,
+			RetryBackoff: cfg.CallbackTimeout / 4,
+			FailOpen:     cfg.CallbackFailOpen,
+			CacheTTL:     cfg.CallbackCacheTTL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown authz mode %q", cfg.Mode)
+	}
+}
+
+// SetAuthorizer replaces the configured authorizer. It must be called
+// before Start; nil allows everything.
+func (s *SFU) SetAuthorizer(a authz.Authorizer) {
+	if a == nil {
+		a = authz.AllowAll{}
+	}
+	s.authorizer = a
+}
+
+// allowsAll reports whether authorization is off, so the checks and their
+// metrics can be skipped.
+func (s *SFU) allowsAll() bool {
+	_, ok := s.authorizer.(authz.AllowAll)
+	return ok
+}
+
+// handshakeToken returns the bearer token of a WebSocket handshake. Browsers
+// cannot set headers on a WebSocket, so ?token= is accepted as well.
+func handshakeToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return r.URL.Query().Get("token")
+}
+
+// authorizeJoin asks the authorizer whether client may join. On refusal
+// the client is told why and false is returned.
+func (s *SFU) authorizeJoin(ctx context.Context, client *signaling.Client, req authz.JoinRequest) (authz.Decision, bool) {
+	if s.allowsAll() {
+		return authz.Allow(), true
+	}
+	d, err := s.authorizer.AuthorizeJoin(ctx, req)
+	recordAuthz(authz.ActionJoin, d, err)
+	if err != nil {
+		s.logger.Warn("Join authorization failed",
+			zap.String("roomID", req.RoomID),
+			zap.String("userID", req.UserID),
+			zap.Error(err),
+		)
+		client.SendRetryableError(503, "Authorization unavailable", s.config.Media.JoinRetryAfter)
+		return authz.Decision{}, false
+	}
+	if !d.Allow {
+		message := "Not authorized to join"
+		if d.Reason != "" {
+			message += ": " + d.Reason
+		}
+		client.SendErrorMessage(signaling.ErrorMessage{
+			Code:    403,
+			Message: message,
+			Reason:  signaling.ErrorReasonNotAuthorized,
+		})
+		return authz.Decision{}, false
+	}
+	return d, true
+}
+
+// authorizePublish returns why p may not publish a track of kind, or ""
+// if it may.
+func (s *SFU) authorizePublish(rm *room.Room, p *peer.Peer, kind string) string {
+	if p.MaxTracks > 0 {
+		published := 0
+		for _, t := range rm.GetTrackList() {
+			if t.PeerID == p.ID {
+				published++
+			}
+		}
+		if published >= p.MaxTracks {
+			return rejectPeerTrackLimit
+		}
+	}
+	if s.allowsAll() {
+		return ""
+	}
+
+	ctx, cancel := s.messageContext()
+	defer cancel()
+	d, err := s.authorizer.AuthorizePublish(ctx, authzPeer(p), kind)
+	recordAuthz(authz.ActionPublish, d, err)
+	switch {
+	case err != nil:
+		s.logger.Warn("Publish authorization failed", zap.String("peerID", p.ID), zap.Error(err))
+		return rejectAuthzUnavailable
+	case !d.Allow:
+		return rejectNotAuthorized
+	}
+	return ""
+}
+
+// admitSubscriber asks the authorizer whether mt may be forwarded to p. A
+// codec alternative is checked by its group's handle, the one clients see.
+func (s *SFU) admitSubscriber(rm *room.Room, p *peer.Peer, mt *room.MediaTrack) bool {
+	if s.allowsAll() {
+		return true
+	}
+	summary := mt.Summary()
+	handle := summary.TrackID
+	if summary.GroupID != "" {
+		handle = summary.GroupID
+	}
+
+	ctx, cancel := s.messageContext()
+	defer cancel()
+	d, err := s.authorizer.AuthorizeSubscribe(ctx, authzPeer(p), handle)
+	recordAuthz(authz.ActionSubscribe, d, err)
+	if err != nil {
+		s.logger.Warn("Subscribe authorization failed", zap.String("peerID", p.ID), zap.Error(err))
+		return false
+	}
+	return d.Allow
+}
+
+func authzPeer(p *peer.Peer) authz.Peer {
+	return authz.Peer{RoomID: p.RoomID, UserID: p.UserID, PeerID: p.ID, Role: peerRole(p), Token: p.AuthToken}
+}
+
+func recordAuthz(action string, d authz.Decision, err error) {
+	switch {
+	case err != nil:
+		appmetrics.RecordAuthzDecision(action, authzResultError)
+	case d.Allow:
+		appmetrics.RecordAuthzDecision(action, authzResultAllowed)
+	default:
+		appmetrics.RecordAuthzDecision(action, authzResultDenied)
+	}
+}
@@ -0,0 +1,82 @@
+package sfu
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// rolePublisher is the invite role allowed to send tracks in a broadcast
+// room. Moderators and admins may publish as well; everyone else joins as a
+// viewer.
+const rolePublisher = "publisher"
+
+func canPublish(role string) bool {
+	return role == rolePublisher || canModerate(role)
+}
+
+// announcesPeer reports whether p's joins and leaves are sent to the room.
+// Observers are invisible; broadcast viewers are only counted unless the
+// room asks for individual events.
+func announcesPeer(rm *room.Room, p *peer.Peer) bool {
+	if p.Observer {
+		return false
+	}
+	return !p.Viewer || rm.AnnouncesViewers()
+}
+
+// participantCountLoop sends each broadcast room its publisher and viewer
+// counts whenever they have changed since the last tick.
+func (s *SFU) participantCountLoop() {
+	interval := s.config.Media.BroadcastCountInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	sent := make(map[string]signaling.ParticipantCountMessage)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.roomsMu.RLock()
+		rooms := make(map[string]*room.Room, len(s.rooms))
+		for id, rm := range s.rooms {
+			rooms[id] = rm
+		}
+		s.roomsMu.RUnlock()
+
+		for id := range sent {
+			if _, ok := rooms[id]; !ok {
+				delete(sent, id)
+			}
+		}
+		for id, rm := range rooms {
+			if !rm.IsBroadcast() {
+				continue
+			}
+			var counts signaling.ParticipantCountMessage
+			counts.Publishers, counts.Viewers = rm.ParticipantCounts()
+			if prev, ok := sent[id]; ok && prev == counts {
+				continue
+			}
+			sent[id] = counts
+
+			data, err := json.Marshal(counts)
+			if err != nil {
+				continue
+			}
+			msg := signaling.Message{Type: signaling.MessageTypeParticipantCount, Data: data, Timestamp: time.Now()}
+			for _, client := range s.signalingHub.GetClientsByRoom(id) {
+				client.SendMessage(msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package sfu
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+// createInvite returns the token of a new invite to roomID with role.
+func (ts *testServer) createInvite(t *testing.T, roomID, role string) string {
+	t.Helper()
+	var invite struct {
+		Token string `json:"token"`
+	}
+	if code := ts.api(t, http.MethodPost, "/api/rooms/"+roomID+"/invites", `{"role":"`+role+`"}`, testAdminKey, &invite); code != http.StatusCreated {
+		t.Fatalf("create invite: status %d", code)
+	}
+	return invite.Token
+}
+
+// messageCounts tallies signaling messages by type.
+type messageCounts struct {
+	mu     sync.Mutex
+	counts map[signaling.MessageType]int
+}
+
+func (mc *messageCounts) add(typ signaling.MessageType) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.counts == nil {
+		mc.counts = make(map[signaling.MessageType]int)
+	}
+	mc.counts[typ]++
+}
+
+// drain counts what sc receives from now on.
+func (mc *messageCounts) drain(sc *scriptedClient) {
+	go func() {
+		for m := range sc.messages {
+			mc.add(m.Type)
+		}
+	}()
+}
+
+func (mc *messageCounts) get(types ...signaling.MessageType) int {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	n := 0
+	for typ, count := range mc.counts {
+		if len(types) == 0 {
+			n += count
+		}
+		for _, want := range types {
+			if typ == want {
+				n += count
+			}
+		}
+	}
+	return n
+}
+
+func TestBroadcastRoom(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.BroadcastCountInterval = 100 * time.Millisecond
+	})
+	if code := ts.api(t, http.MethodPost, "/api/rooms", `{"id":"room-1","settings":{"mode":"broadcast"}}`, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("POST room: %d", code)
+	}
+
+	var (
+		renegotiations atomic.Int64
+		seen           messageLog
+	)
+	counts := make(chan signaling.ParticipantCountMessage, 16)
+	presenter := ts.join(t, "presenter", "room-1", client.Handlers{
+		OnParticipantCount: func(m signaling.ParticipantCountMessage) { counts <- m },
+		OnMessage: func(m signaling.Message) {
+			seen.record(m)
+			if m.Type == signaling.MessageTypeRenegotiate {
+				renegotiations.Add(1)
+			}
+		},
+	}, client.JoinOptions{InviteToken: ts.createInvite(t, "room-1", rolePublisher)})
+	if presenter.Info().Viewer {
+		t.Fatal("the presenter joined as a viewer")
+	}
+	publish(t, presenter, "presenter")
+	expectCount := func(publishers, viewers int) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case m := <-counts:
+				if m.Publishers == publishers && m.Viewers == viewers {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("no participant-count of %d publishers and %d viewers", publishers, viewers)
+			}
+		}
+	}
+	expectCount(1, 0)
+	before := settled(&renegotiations, time.Second)
+
+	// Viewers get the presenter's tracks, and may not publish
+	var rejections trackRejections
+	received := newTrackCounter()
+	bob := ts.join(t, "bob", "room-1", rejections.handlers(), client.JoinOptions{OnTrack: received.onTrack})
+	if !bob.Info().Viewer {
+		t.Fatal("bob's join response does not mark a viewer")
+	}
+	eventually(t, "bob to receive the presenter", func() bool { return received.receiving(presenter.PeerID()) })
+	publish(t, bob, "bob")
+	eventually(t, "bob's tracks to be rejected", func() bool { return len(rejections.get()) == 2 })
+	for _, reason := range rejections.get() {
+		if reason != room.RejectPublisherRoleRequired {
+			t.Fatalf("bob's track rejected for %s", reason)
+		}
+	}
+	ts.join(t, "carol", "room-1", client.Handlers{}, client.JoinOptions{})
+	expectCount(1, 2)
+
+	// The presenter is neither renegotiated nor told of each viewer
+	if n := settled(&renegotiations, time.Second) - before; n != 0 {
+		t.Fatalf("%d renegotiations of the presenter for viewers joining", n)
+	}
+	if got := seen.mentioning("bob"); len(got) != 0 {
+		t.Fatalf("the presenter was sent %v about bob", got)
+	}
+
+	// The mode is fixed once the room exists
+	if code := ts.api(t, http.MethodPatch, "/api/rooms/room-1/settings", `{"mode":""}`, testAdminKey, nil); code != http.StatusBadRequest {
+		t.Fatalf("PATCH mode: %d, want 400", code)
+	}
+}
+
+func TestBroadcastSignalingLoad(t *testing.T) {
+	const viewers = 100
+	run := func(t *testing.T, settings string) *messageCounts {
+		ts := newTestServer(t, nil, func(cfg *config.Config) {
+			cfg.Media.BroadcastCountInterval = 100 * time.Millisecond
+			cfg.Media.StatsInterval = time.Second
+		})
+		if code := ts.api(t, http.MethodPost, "/api/rooms", `{"id":"room-1","maxPeers":200,"settings":`+settings+`}`, testAdminKey, nil); code != http.StatusOK {
+			t.Fatalf("POST room: %d", code)
+		}
+		received := &messageCounts{}
+		presenter := ts.dialScripted(t, "presenter")
+		presenter.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{
+			RoomID: "room-1", UserID: "presenter", Name: "presenter", InviteToken: ts.createInvite(t, "room-1", rolePublisher),
+		})
+		presenter.readUntil(t, signaling.MessageTypeJoin)
+		received.drain(presenter)
+
+		scripted := make([]*scriptedClient, viewers)
+		for i := range scripted {
+			scripted[i] = ts.joinScripted(t, fmt.Sprintf("viewer-%d", i), "room-1")
+			received.drain(scripted[i])
+		}
+		time.Sleep(500 * time.Millisecond)
+		for _, sc := range scripted {
+			sc.pipeline(t, signaling.MessageTypeLeave, struct{}{})
+		}
+		// Each leave is announced to those still in a normal room, which
+		// takes far longer under -race than eventually's deadline
+		eventuallyWithin(t, "the viewers to leave", viewers*200*time.Millisecond, func() bool {
+			return len(ts.lookupRoom("room-1").GetAllPeers()) == 1
+		})
+		time.Sleep(500 * time.Millisecond)
+		return received
+	}
+
+	normal := run(t, `{}`)
+	broadcast := run(t, `{"mode":"broadcast"}`)
+	peerEvents := []signaling.MessageType{signaling.MessageTypePeerJoined, signaling.MessageTypePeerLeft}
+	t.Logf("normal room: %d messages, %d peer events, %d quality-stats",
+		normal.get(), normal.get(peerEvents...), normal.get(signaling.MessageTypeQualityStats))
+	t.Logf("broadcast room: %d messages, %d participant-counts, %d quality-stats",
+		broadcast.get(), broadcast.get(signaling.MessageTypeParticipantCount), broadcast.get(signaling.MessageTypeQualityStats))
+
+	// Every viewer hears of every later viewer in a normal room
+	if n := normal.get(peerEvents...); n < viewers*(viewers-1)/2 {
+		t.Fatalf("%d peer events in a normal room", n)
+	}
+	if n := broadcast.get(peerEvents...); n != 0 {
+		t.Fatalf("%d peer events in a broadcast room", n)
+	}
+	if broadcast.get(signaling.MessageTypeParticipantCount) == 0 {
+		t.Fatal("no participant-count in a broadcast room")
+	}
+	if n, m := broadcast.get(), normal.get(); n*10 > m {
+		t.Fatalf("%d messages in a broadcast room, %d in a normal one", n, m)
+	}
+}
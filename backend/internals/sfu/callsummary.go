@@ -0,0 +1,82 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"go.uber.org/zap"
+)
+
+// recordCallSummary emits the summary of the call in a room that has just
+// been closed as a room.call_summary audit event, and writes it to Redis
+// when Audit.CallSummaryPrefix is set, so a billing job can collect it even
+// if it missed the event. The room hands the summary out once, so a room
+// closed from several paths is summarized once.
+func (s *SFU) recordCallSummary(ctx context.Context, rm *room.Room, reason string) {
+	summary, ok := rm.FinishCallSummary()
+	if !ok {
+		return
+	}
+	summary.CloseReason = reason
+	summary.Recordings = s.roomCaptureIDs(rm.ID, summary.StartedAt)
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		s.logger.Error("Failed to marshal call summary", zap.String("roomID", rm.ID), zap.Error(err))
+		return
+	}
+
+	s.auditLogger.Log(audit.Event{
+		Actor:  "system",
+		Action: auditRoomSummary,
+		RoomID: rm.ID,
+		Result: audit.ResultSuccess,
+		Detail: map[string]string{
+			"durationSec":      strconv.FormatFloat(summary.DurationSec, 'f', 1, 64),
+			"peakParticipants": strconv.Itoa(summary.PeakParticipants),
+			"bytesForwarded":   strconv.FormatUint(summary.BytesForwarded, 10),
+			"summary":          string(data),
+		},
+	})
+
+	prefix := s.config.Audit.CallSummaryPrefix
+	if prefix == "" || s.stateManager.Load() == nil {
+		return
+	}
+	key := state.CallSummaryKey(prefix, rm.ID, summary.StartedAt)
+	if err := s.stateManager.Load().SetCallSummary(ctx, key, data, s.config.Audit.CallSummaryTTL); err != nil {
+		s.logger.Warn("Failed to store call summary",
+			zap.String("roomID", rm.ID),
+			zap.String("key", key),
+			zap.Error(err),
+		)
+	}
+}
+
+// roomCaptureIDs returns the IDs of the captures this instance started in a
+// room since a time, oldest first. Earlier ones belong to an earlier call.
+func (s *SFU) roomCaptureIDs(roomID string, since time.Time) []string {
+	s.captures.mu.Lock()
+	defer s.captures.mu.Unlock()
+
+	var captures []captureInfo
+	for _, cs := range s.captures.byID {
+		if cs.info.RoomID == roomID && !cs.info.StartedAt.Before(since) {
+			captures = append(captures, cs.info)
+		}
+	}
+	sort.Slice(captures, func(i, j int) bool {
+		return captureTime(captures[i]).Before(captureTime(captures[j]))
+	})
+	ids := make([]string, len(captures))
+	for i, info := range captures {
+		ids[i] = info.ID
+	}
+	return ids
+}
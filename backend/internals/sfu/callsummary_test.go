@@ -0,0 +1,95 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+func TestCallSummaryOfTwoParticipantCall(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Audit.CallSummaryPrefix = "sfu:call:"
+	})
+
+	received := newTrackCounter()
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{Name: "Alice"})
+	publish(t, alice, "alice")
+	bob := ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{Name: "Bob", OnTrack: received.onTrack})
+	eventually(t, "bob to receive alice's tracks", func() bool { return received.receiving(alice.PeerID()) })
+	if err := bob.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "bob to leave", func() bool {
+		rm := ts.lookupRoom("room-1")
+		return rm != nil && len(rm.GetAllPeers()) == 1
+	})
+	if code := ts.api(t, http.MethodDelete, "/api/rooms/room-1", "", testAdminKey, nil); code != http.StatusNoContent {
+		t.Fatalf("closing the room: %d", code)
+	}
+
+	var keys []string
+	for _, key := range ts.redis.Keys() {
+		if strings.HasPrefix(key, "sfu:call:") {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) != 1 {
+		t.Fatalf("call summaries stored under %v, want one", keys)
+	}
+	if ttl := ts.redis.TTL(keys[0]); ttl <= 0 || ttl > ts.config.Audit.CallSummaryTTL {
+		t.Fatalf("call summary TTL %v, want up to %v", ttl, ts.config.Audit.CallSummaryTTL)
+	}
+	data, err := ts.redis.Get(keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary room.CallSummary
+	if err := json.Unmarshal([]byte(data), &summary); err != nil {
+		t.Fatal(err)
+	}
+
+	// What depends on timing is checked here and then fixed, so the golden
+	// file pins the rest
+	if len(summary.Participants) != 2 {
+		t.Fatalf("participants %+v, want alice and bob", summary.Participants)
+	}
+	a, b := summary.Participants[0].Sessions, summary.Participants[1].Sessions
+	if len(a) != 1 || len(b) != 1 {
+		t.Fatalf("sessions %+v and %+v, want one each", a, b)
+	}
+	order := []time.Time{summary.StartedAt, a[0].JoinedAt, b[0].JoinedAt, b[0].LeftAt, a[0].LeftAt, summary.EndedAt}
+	for i := 1; i < len(order); i++ {
+		if order[i].Before(order[i-1]) {
+			t.Fatalf("call times out of order: %v", order)
+		}
+	}
+	if a[0].PeerID != alice.PeerID() || b[0].PeerID != bob.PeerID() {
+		t.Fatalf("sessions of peers %s and %s", a[0].PeerID, b[0].PeerID)
+	}
+	if summary.DurationSec <= 0 || summary.AvgParticipants <= 1 || summary.AvgParticipants >= 2 {
+		t.Fatalf("duration %vs with %v participants on average", summary.DurationSec, summary.AvgParticipants)
+	}
+	if summary.BytesForwarded == 0 || summary.PacketsForwarded == 0 {
+		t.Fatal("nothing forwarded during the call")
+	}
+	summary.StartedAt, summary.EndedAt = goldenTime, goldenTime.Add(5*time.Minute)
+	a[0] = room.CallSession{PeerID: "alice-peer", JoinedAt: goldenTime, LeftAt: goldenTime.Add(5 * time.Minute)}
+	b[0] = room.CallSession{PeerID: "bob-peer", JoinedAt: goldenTime.Add(time.Minute), LeftAt: goldenTime.Add(4 * time.Minute)}
+	summary.DurationSec, summary.AvgParticipants = 300, 1.6
+	summary.BytesForwarded, summary.PacketsForwarded = 0, 0
+	for i := range summary.Participants {
+		summary.Participants[i].TalkTimeSec = 0
+	}
+	summary.Quality.Samples = 0
+	for level := range summary.Quality.Levels {
+		summary.Quality.Levels[level] = 0
+	}
+
+	checkGolden(t, "CallSummary.two-participants", summary)
+}
@@ -0,0 +1,127 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// ErrMaxRoomsReached is returned when creating a room would exceed
+// Server.MaxRooms.
+var ErrMaxRoomsReached = errors.New("instance room limit reached")
+
+// roomsRemaining reports how many more rooms this instance may create.
+// MUST be called with s.roomsMu held.
+func (s *SFU) roomsRemaining() int {
+	remaining := s.config.Server.MaxRooms - len(s.rooms)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// atRoomCapacity reports whether the instance cannot create another room.
+func (s *SFU) atRoomCapacity() bool {
+	s.roomsMu.RLock()
+	defer s.roomsMu.RUnlock()
+	return s.roomsRemaining() == 0
+}
+
+// alternateInstance returns the cluster instance already hosting roomID, if
+// it is not this one.
+func (s *SFU) alternateInstance(ctx context.Context, roomID string) string {
+	if s.stateManager.Load() == nil {
+		return ""
+	}
+	summary, err := s.stateManager.Load().GetRoomSummary(ctx, roomID)
+	if err != nil || summary == nil || summary.InstanceID == s.instanceID() {
+		return ""
+	}
+	return summary.InstanceID
+}
+
+// capacityError describes a rejected room creation. The same body is sent
+// over signaling and REST.
+func (s *SFU) capacityError(ctx context.Context, roomID string, code int) signaling.ErrorMessage {
+	return signaling.ErrorMessage{
+		Code:              code,
+		Message:           "Server is at its room limit",
+		Retryable:         true,
+		RetryAfterMs:      s.config.Media.JoinRetryAfter.Milliseconds(),
+		Reason:            signaling.ErrorReasonCapacityExceeded,
+		AlternateInstance: s.alternateInstance(ctx, roomID),
+	}
+}
+
+// rejectRoomCreation records a room creation refused at the cap.
+func (s *SFU) rejectRoomCreation(roomID, source string) {
+	appmetrics.RecordRoomCreationRejected(source)
+	s.logger.Warn("Room creation rejected, instance at room limit",
+		zap.String("roomID", roomID),
+		zap.String("source", source),
+		zap.Int("maxRooms", s.config.Server.MaxRooms),
+	)
+}
+
+// sendCapacityError tells a joining client the room could not be created.
+func (s *SFU) sendCapacityError(ctx context.Context, client *signaling.Client, roomID string) {
+	s.rejectRoomCreation(roomID, "join")
+	client.SendErrorMessage(s.capacityError(ctx, roomID, http.StatusServiceUnavailable))
+}
+
+// writeCapacityError answers a REST room creation refused at the cap with
+// 507 Insufficient Storage, code capacity_exceeded, with retry hints as details.
+func (s *SFU) writeCapacityError(w http.ResponseWriter, r *http.Request, roomID string) {
+	s.rejectRoomCreation(roomID, "api")
+	body := s.capacityError(r.Context(), roomID, http.StatusInsufficientStorage)
+	if retryAfter := s.config.Media.JoinRetryAfter; retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+	}
+	writeSignalingError(w, body)
+}
+
+// readiness is the body of the readiness probe. Reason says why the
+// instance is not ready, when it is one the API knows.
+type readiness struct {
+	Ready          bool   `json:"ready"`
+	Rooms          int    `json:"rooms"`
+	MaxRooms       int    `json:"maxRooms"`
+	RoomsRemaining int    `json:"roomsRemaining"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// handleReady is the readiness probe: 503 while the instance cannot take new
+// rooms, at its room limit or draining, so load balancers route new rooms
+// elsewhere. Existing rooms keep working; use /health for liveness.
+func (s *SFU) handleReady(w http.ResponseWriter, r *http.Request) {
+	s.roomsMu.RLock()
+	rooms, remaining := len(s.rooms), s.roomsRemaining()
+	s.roomsMu.RUnlock()
+
+	draining := s.draining() != nil
+	ready := remaining > 0 && !draining && s.ctx.Err() == nil
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	resp := readiness{
+		Ready:          ready,
+		Rooms:          rooms,
+		MaxRooms:       s.config.Server.MaxRooms,
+		RoomsRemaining: remaining,
+	}
+	switch {
+	case draining:
+		resp.Reason = signaling.ErrorReasonDraining
+	case remaining == 0:
+		resp.Reason = signaling.ErrorReasonCapacityExceeded
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,124 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// ready fetches the readiness probe.
+func (ts *testServer) ready(t *testing.T) (int, readiness) {
+	t.Helper()
+	resp, err := http.Get(ts.http.URL + "/ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body readiness
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestRoomLimit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	limited := func(cfg *config.Config) {
+		cfg.Server.MaxRooms = 1
+		cfg.Media.JoinRetryAfter = 1500 * time.Millisecond
+	}
+	t.Setenv("INSTANCE_ID", "sfu-a")
+	ts := newTestServer(t, mr, limited)
+	t.Setenv("INSTANCE_ID", "sfu-b")
+	other := newTestServer(t, mr, nil)
+	rejected := func(source string) float64 {
+		return testutil.ToFloat64(appmetrics.RoomCreationRejectionsTotal.WithLabelValues(source))
+	}
+	joinsBefore, apiBefore := rejected("join"), rejected("api")
+
+	if code, body := ts.ready(t); code != http.StatusOK || !body.Ready || body.RoomsRemaining != 1 {
+		t.Fatalf("ready before any room: %d %+v", code, body)
+	}
+	ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	if remaining := testutil.ToFloat64(appmetrics.RoomsRemaining); remaining != 0 {
+		t.Fatalf("sfu_rooms_remaining %v at the limit", remaining)
+	}
+	code, body := ts.ready(t)
+	if code != http.StatusServiceUnavailable || body.Ready || body.Reason != signaling.ErrorReasonCapacityExceeded || body.Rooms != 1 || body.MaxRooms != 1 {
+		t.Fatalf("ready at the limit: %d %+v", code, body)
+	}
+
+	// A join that needs a new room is told to retry, elsewhere if another
+	// instance already hosts it
+	other.join(t, "carol", "room-2", client.Handlers{}, client.JoinOptions{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	eventually(t, "room-2 in the cluster directory", func() bool {
+		summary, err := ts.stateManager.Load().GetRoomSummary(ctx, "room-2")
+		return err == nil && summary != nil
+	})
+	_, err := ts.connect(t, "bob", client.Handlers{}).JoinRoom(ctx, "room-2", client.JoinOptions{})
+	var serverErr *client.ServerError
+	if !errors.As(err, &serverErr) {
+		t.Fatalf("join past the limit: %v", err)
+	}
+	if e := serverErr.ErrorMessage; e.Code != http.StatusServiceUnavailable || e.Reason != signaling.ErrorReasonCapacityExceeded ||
+		!e.Retryable || e.RetryAfterMs != 1500 || e.AlternateInstance != other.instanceID() {
+		t.Fatalf("join past the limit: %+v", e)
+	}
+	if got := rejected("join") - joinsBefore; got != 1 {
+		t.Fatalf("%v join rejections counted", got)
+	}
+	// Joining the room the instance has is still fine
+	ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{})
+
+	req, err := http.NewRequest(http.MethodPost, ts.http.URL+"/api/rooms", strings.NewReader(`{"id":"room-3"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", testAdminKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var envelope struct {
+		Error struct {
+			Code    string       `json:"code"`
+			Details retryDetails `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusInsufficientStorage || resp.Header.Get("Retry-After") != "2" ||
+		envelope.Error.Code != signaling.ErrorReasonCapacityExceeded || !envelope.Error.Details.Retryable {
+		t.Fatalf("POST past the limit: %d, Retry-After %q, %+v", resp.StatusCode, resp.Header.Get("Retry-After"), envelope.Error)
+	}
+	if got := rejected("api") - apiBefore; got != 1 {
+		t.Fatalf("%v API rejections counted", got)
+	}
+	if ts.lookupRoom("room-3") != nil {
+		t.Fatal("room created past the limit")
+	}
+
+	// Freeing the room makes the instance ready again
+	if code := ts.api(t, http.MethodDelete, "/api/rooms/room-1", "", testAdminKey, nil); code != http.StatusNoContent {
+		t.Fatalf("DELETE room: %d", code)
+	}
+	if code, body := ts.ready(t); code != http.StatusOK || body.RoomsRemaining != 1 {
+		t.Fatalf("ready after the delete: %d %+v", code, body)
+	}
+}
@@ -0,0 +1,422 @@
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/capture"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Debug captures record the RTP of a track or peer to a file in
+// Capture.Dir for support escalations: inbound as the publisher sent it, or
+// outbound as forwarded to one subscriber. A track is captured by at most
+// one capture at a time. Captures stop after their duration or byte cap and
+// are listed, downloaded and deleted under /api/captures.
+
+const (
+	captureInbound  = "inbound"
+	captureOutbound = "outbound"
+)
+
+// captureRequest is the body of POST /api/rooms/{id}/capture.
+type captureRequest struct {
+	PeerID      string `json:"peerId,omitempty"`      // publisher, or the subscriber of an outbound capture
+	TrackHandle string `json:"trackHandle,omitempty"` // one track instead of all of the peer's
+	Direction   string `json:"direction,omitempty"`   // inbound (default) or outbound
+	DurationSec int    `json:"durationSec,omitempty"` // default and limit Capture.MaxDuration
+	MaxBytes    int64  `json:"maxBytes,omitempty"`    // default and limit Capture.MaxBytes
+	Format      string `json:"format,omitempty"`      // pcap (default) or rtpdump
+}
+
+// captureInfo describes a capture in the API.
+type captureInfo struct {
+	ID        string     `json:"id"`
+	RoomID    string     `json:"roomId,omitempty"`
+	PeerID    string     `json:"peerId,omitempty"`
+	Tracks    []string   `json:"tracks,omitempty"` // handles
+	Direction string     `json:"direction,omitempty"`
+	Format    string     `json:"format"`
+	Active    bool       `json:"active"`
+	StartedAt *time.Time `json:"startedAt,omitempty"` // unknown for files of earlier runs
+	capture.Stats
+}
+
+// capturesResponse is the body of GET /api/captures.
+type capturesResponse struct {
+	Captures []captureInfo `json:"captures"`
+	Total    int           `json:"total"`
+}
+
+// captureSession is a capture started by this instance.
+type captureSession struct {
+	info  captureInfo
+	path  string
+	c     *capture.Capture
+	untap func()
+	ended chan struct{} // closed once the stop is recorded
+
+	mu  sync.Mutex
+	rec recordingState // see recording.go
+}
+
+func (cs *captureSession) snapshot() captureInfo {
+	info := cs.info
+	info.Stats = cs.c.Stats()
+	select {
+	case <-cs.c.Done():
+	default:
+		info.Active = true
+	}
+	return info
+}
+
+// captureSessions are the captures started since the instance started.
+type captureSessions struct {
+	byID map[string]*captureSession
+	mu   sync.Mutex
+}
+
+// handleRoomCaptureAPI serves POST /api/rooms/{id}/capture.
+func (s *SFU) handleRoomCaptureAPI(w http.ResponseWriter, r *http.Request, roomID string) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	cfg := s.config.Capture
+	if cfg.Dir == "" {
+		writeAPIError(w, http.StatusServiceUnavailable, "Captures are disabled")
+		return
+	}
+	var req captureRequest
+	if !s.decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	format, ok := capture.ParseFormat(req.Format)
+	if !ok {
+		writeAPIError(w, http.StatusBadRequest, "Invalid format")
+		return
+	}
+	if req.Direction == "" {
+		req.Direction = captureInbound
+	}
+	if req.Direction != captureInbound && req.Direction != captureOutbound {
+		writeAPIError(w, http.StatusBadRequest, "Invalid direction")
+		return
+	}
+	if req.PeerID == "" && req.TrackHandle == "" {
+		writeAPIError(w, http.StatusBadRequest, "peerId or trackHandle is required")
+		return
+	}
+	duration := time.Duration(req.DurationSec) * time.Second
+	if req.DurationSec < 0 || req.MaxBytes < 0 || duration > cfg.MaxDuration || req.MaxBytes > cfg.MaxBytes {
+		writeAPIError(w, http.StatusBadRequest, "durationSec and maxBytes must be within the configured limits")
+		return
+	}
+	if duration == 0 {
+		duration = cfg.MaxDuration
+	}
+	maxBytes := req.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = cfg.MaxBytes
+	}
+
+	s.roomsMu.RLock()
+	rm, exists := s.rooms[roomID]
+	s.roomsMu.RUnlock()
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	detail := map[string]string{
+		"peerId":      req.PeerID,
+		"trackHandle": req.TrackHandle,
+		"direction":   req.Direction,
+		"format":      string(format),
+	}
+	fail := func(status int, message string, err error) {
+		detail["reason"] = err.Error()
+		s.auditRequest(r, auditCaptureStart, roomID, audit.ResultFailure, detail)
+		writeAPIError(w, status, message)
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		fail(http.StatusInternalServerError, "Failed to create capture directory", err)
+		return
+	}
+	id := uuid.New().String()
+	path := filepath.Join(cfg.Dir, id+format.Ext())
+	c, err := capture.Start(path, capture.Options{
+		Format:   format,
+		Duration: duration,
+		MaxBytes: maxBytes,
+		Outbound: req.Direction == captureOutbound,
+	})
+	if err != nil {
+		fail(http.StatusInternalServerError, "Failed to start capture", err)
+		return
+	}
+
+	handles, untap, err := rm.Tap(req.TrackHandle, req.PeerID, req.Direction == captureOutbound, c.Write)
+	if err != nil {
+		c.Stop(capture.StopError)
+		<-c.Done()
+		os.Remove(path)
+		switch {
+		case errors.Is(err, room.ErrTrackCaptured):
+			fail(http.StatusConflict, "A track is already being captured", err)
+		case errors.Is(err, room.ErrSubscriberNeeded):
+			fail(http.StatusBadRequest, "Outbound captures need peerId", err)
+		default:
+			fail(http.StatusNotFound, "No matching tracks", err)
+		}
+		return
+	}
+
+	now := time.Now()
+	cs := &captureSession{
+		info: captureInfo{
+			ID:        id,
+			RoomID:    roomID,
+			PeerID:    req.PeerID,
+			Tracks:    handles,
+			Direction: req.Direction,
+			Format:    string(format),
+			StartedAt: &now,
+		},
+		path:  path,
+		c:     c,
+		untap: untap,
+		ended: make(chan struct{}),
+		rec:   recordingState{participants: []string{}},
+	}
+	s.captures.mu.Lock()
+	s.captures.byID[id] = cs
+	s.captures.mu.Unlock()
+	location := s.publicURL(r, "/api/captures/"+id, false)
+	s.startRecording(cs, rm, location)
+	go s.awaitCapture(cs)
+
+	detail["captureId"] = id
+	detail["tracks"] = strings.Join(handles, ",")
+	detail["durationSec"] = strconv.Itoa(int(duration / time.Second))
+	detail["maxBytes"] = strconv.FormatInt(maxBytes, 10)
+	s.auditRequest(r, auditCaptureStart, roomID, audit.ResultSuccess, detail)
+	s.logger.Info("Capture started",
+		zap.String("captureID", id),
+		zap.String("roomID", roomID),
+		zap.String("peerID", req.PeerID),
+		zap.Strings("tracks", handles),
+		zap.String("direction", req.Direction),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(cs.snapshot())
+}
+
+// awaitCapture removes a capture's taps once it stops and records why.
+func (s *SFU) awaitCapture(cs *captureSession) {
+	defer close(cs.ended)
+	<-cs.c.Done()
+	cs.untap()
+	s.finishRecording(cs)
+
+	info := cs.snapshot()
+	s.logger.Info("Capture stopped",
+		zap.String("captureID", info.ID),
+		zap.String("reason", info.StopReason),
+		zap.Int64("packets", info.Packets),
+		zap.Int64("bytes", info.Bytes),
+		zap.Int64("dropped", info.Dropped),
+	)
+	result := audit.ResultSuccess
+	if info.StopReason == capture.StopError {
+		result = audit.ResultFailure
+	}
+	s.auditLogger.Log(audit.Event{
+		Actor:  "system",
+		Action: auditCaptureStop,
+		RoomID: info.RoomID,
+		PeerID: info.PeerID,
+		Result: result,
+		Detail: map[string]string{
+			"captureId": info.ID,
+			"reason":    info.StopReason,
+			"packets":   strconv.FormatInt(info.Packets, 10),
+			"bytes":     strconv.FormatInt(info.Bytes, 10),
+			"dropped":   strconv.FormatInt(info.Dropped, 10),
+		},
+	})
+}
+
+// stopCaptures stops every running capture and waits for the files to be
+// complete and the stops audited, for shutdown.
+func (s *SFU) stopCaptures() {
+	s.captures.mu.Lock()
+	running := make([]*captureSession, 0, len(s.captures.byID))
+	for _, cs := range s.captures.byID {
+		running = append(running, cs)
+	}
+	s.captures.mu.Unlock()
+	for _, cs := range running {
+		cs.c.Stop(capture.StopRequested)
+		<-cs.ended
+	}
+}
+
+// handleCapturesAPI serves GET /api/captures, listing the captures in
+// Capture.Dir newest first, and GET or DELETE /api/captures/{id} to
+// download or delete one. Deleting a running capture stops it first.
+func (s *SFU) handleCapturesAPI(w http.ResponseWriter, r *http.Request) {
+	dir := s.config.Capture.Dir
+	if dir == "" {
+		writeAPIError(w, http.StatusServiceUnavailable, "Captures are disabled")
+		return
+	}
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/captures"), "/")
+	if id == "" {
+		if r.Method != http.MethodGet {
+			writeMethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		captures := s.listCaptures(dir, r.URL.Query().Get("roomId"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(capturesResponse{Captures: captures, Total: len(captures)})
+		return
+	}
+
+	info, path, ok := s.findCapture(dir, id)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "Capture not found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if info.Active {
+			writeAPIError(w, http.StatusConflict, "Capture is still running")
+			return
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "Capture not found")
+			return
+		}
+		defer f.Close()
+		contentType := "application/octet-stream"
+		if info.Format == string(capture.FormatPcap) {
+			contentType = "application/vnd.tcpdump.pcap"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filepath.Base(path)+`"`)
+		http.ServeContent(w, r, filepath.Base(path), *info.StoppedAt, f)
+	case http.MethodDelete:
+		s.captures.mu.Lock()
+		cs := s.captures.byID[id]
+		delete(s.captures.byID, id)
+		s.captures.mu.Unlock()
+		if cs != nil {
+			cs.c.Stop(capture.StopRequested)
+			<-cs.c.Done()
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			s.auditRequest(r, auditCaptureDelete, info.RoomID, audit.ResultFailure, map[string]string{"captureId": id, "reason": err.Error()})
+			writeAPIError(w, http.StatusInternalServerError, "Failed to delete capture")
+			return
+		}
+		s.auditRequest(r, auditCaptureDelete, info.RoomID, audit.ResultSuccess, map[string]string{"captureId": id})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
+
+// findCapture returns the capture id, started by this instance or left in
+// dir by an earlier one, and its file.
+func (s *SFU) findCapture(dir, id string) (captureInfo, string, bool) {
+	s.captures.mu.Lock()
+	cs := s.captures.byID[id]
+	s.captures.mu.Unlock()
+	if cs != nil {
+		return cs.snapshot(), cs.path, true
+	}
+	// Only IDs this instance generates name files it serves
+	if _, err := uuid.Parse(id); err != nil {
+		return captureInfo{}, "", false
+	}
+	for _, format := range []capture.Format{capture.FormatPcap, capture.FormatRTPDump} {
+		path := filepath.Join(dir, id+format.Ext())
+		if fi, err := os.Stat(path); err == nil {
+			return fileCaptureInfo(id, format, fi), path, true
+		}
+	}
+	return captureInfo{}, "", false
+}
+
+func fileCaptureInfo(id string, format capture.Format, fi os.FileInfo) captureInfo {
+	modTime := fi.ModTime()
+	return captureInfo{
+		ID:     id,
+		Format: string(format),
+		Stats:  capture.Stats{Bytes: fi.Size(), StoppedAt: &modTime},
+	}
+}
+
+// listCaptures returns the captures in dir, newest first, only those of
+// roomID if given. Files left by earlier runs have no room.
+func (s *SFU) listCaptures(dir, roomID string) []captureInfo {
+	captures := make([]captureInfo, 0)
+	seen := make(map[string]bool)
+
+	s.captures.mu.Lock()
+	for id, cs := range s.captures.byID {
+		seen[id] = true
+		if roomID == "" || cs.info.RoomID == roomID {
+			captures = append(captures, cs.snapshot())
+		}
+	}
+	s.captures.mu.Unlock()
+
+	if entries, err := os.ReadDir(dir); err == nil && roomID == "" {
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			format, ok := capture.ParseFormat(strings.TrimPrefix(ext, "."))
+			id := strings.TrimSuffix(entry.Name(), ext)
+			if !ok || ext == "" || seen[id] {
+				continue
+			}
+			if _, err := uuid.Parse(id); err != nil {
+				continue
+			}
+			if fi, err := entry.Info(); err == nil {
+				captures = append(captures, fileCaptureInfo(id, format, fi))
+			}
+		}
+	}
+
+	sort.Slice(captures, func(i, j int) bool {
+		return captureTime(captures[i]).After(captureTime(captures[j]))
+	})
+	return captures
+}
+
+func captureTime(info captureInfo) time.Time {
+	if info.StartedAt != nil {
+		return *info.StartedAt
+	}
+	return *info.StoppedAt
+}
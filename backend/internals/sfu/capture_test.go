@@ -0,0 +1,196 @@
+package sfu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/capture"
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+// startCapture posts body to roomID's capture route, returning the status
+// and the capture it started.
+func (ts *testServer) startCapture(t *testing.T, roomID, body string) (int, captureInfo) {
+	t.Helper()
+	var info captureInfo
+	status := ts.api(t, http.MethodPost, "/api/rooms/"+roomID+"/capture", body, testAdminKey, &info)
+	return status, info
+}
+
+// captureStops returns the reasons of the capture.stop audit events of
+// roomID, by capture.
+func (ts *testServer) captureStops(roomID string) map[string]string {
+	stops := make(map[string]string)
+	for _, ev := range ts.auditLogger.Query(roomID, 0) {
+		if ev.Action == auditCaptureStop && ev.Actor == "system" {
+			stops[ev.Detail["captureId"]] = ev.Detail["reason"]
+		}
+	}
+	return stops
+}
+
+func TestCaptureAPI(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Capture.Dir = t.TempDir()
+		cfg.Capture.MaxDuration = 30 * time.Second
+		cfg.Capture.MaxBytes = 1 << 20
+	})
+	aliceSess := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	publish(t, aliceSess, "alice")
+	received := newTrackCounter()
+	ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{OnTrack: received.onTrack})
+	eventually(t, "bob to receive alice's tracks", func() bool { return received.receiving(aliceSess.PeerID()) })
+	_, alice := ts.getRoomAndPeer("room-1", "alice")
+	_, bob := ts.getRoomAndPeer("room-1", "bob")
+
+	// An inbound capture of alice's tracks runs until its duration
+	status, inbound := ts.startCapture(t, "room-1", `{"peerId":"`+alice.ID+`","durationSec":1}`)
+	if status != http.StatusCreated || len(inbound.Tracks) != 2 || !inbound.Active || inbound.Format != "pcap" {
+		t.Fatalf("inbound capture: %d %+v", status, inbound)
+	}
+	if status, _ := ts.startCapture(t, "room-1", `{"trackHandle":"`+inbound.Tracks[0]+`"}`); status != http.StatusConflict {
+		t.Fatalf("capturing a captured track: %d", status)
+	}
+	if status := ts.api(t, http.MethodGet, "/api/captures/"+inbound.ID, "", testAdminKey, nil); status != http.StatusConflict {
+		t.Fatalf("download of a running capture: %d", status)
+	}
+
+	// A track is captured once at a time, whichever the direction
+	outboundBody := `{"peerId":"` + bob.ID + `","direction":"outbound","maxBytes":2000,"format":"rtpdump"}`
+	if status, _ := ts.startCapture(t, "room-1", outboundBody); status != http.StatusConflict {
+		t.Fatalf("outbound capture of a captured track: %d", status)
+	}
+	eventually(t, "the inbound capture to stop", func() bool { return ts.captureStops("room-1")[inbound.ID] != "" })
+
+	// An outbound capture of what bob receives, stopped by its byte cap
+	status, outbound := ts.startCapture(t, "room-1", outboundBody)
+	if status != http.StatusCreated || len(outbound.Tracks) != 2 || outbound.Direction != "outbound" {
+		t.Fatalf("outbound capture: %d %+v", status, outbound)
+	}
+	eventually(t, "the outbound capture to stop", func() bool { return ts.captureStops("room-1")[outbound.ID] != "" })
+	if stops := ts.captureStops("room-1"); stops[inbound.ID] != capture.StopDuration || stops[outbound.ID] != capture.StopMaxBytes {
+		t.Fatalf("stop reasons %v", stops)
+	}
+	var list capturesResponse
+	if status := ts.api(t, http.MethodGet, "/api/captures?roomId=room-1", "", testAdminKey, &list); status != http.StatusOK || list.Total != 2 {
+		t.Fatalf("listing: %d %+v", status, list)
+	}
+	packets := make(map[string]int64)
+	for _, info := range list.Captures {
+		if info.Active || info.Packets == 0 || info.StoppedAt == nil {
+			t.Fatalf("stopped capture listed as %+v", info)
+		}
+		packets[info.ID] = info.Packets
+	}
+
+	// The pcap downloads with its packets and the capture's size
+	data, contentType := download(t, ts, inbound.ID)
+	if contentType != "application/vnd.tcpdump.pcap" || len(data) < 24 || binary.LittleEndian.Uint32(data) != 0xa1b2c3d4 {
+		t.Fatalf("download of %d bytes as %q", len(data), contentType)
+	}
+	if records := pcapRecords(data); records == 0 || int64(records) != packets[inbound.ID] {
+		t.Fatalf("%d records, %d packets captured", records, packets[inbound.ID])
+	}
+	if data, _ := download(t, ts, outbound.ID); len(data) > 2000 || !strings.HasPrefix(string(data), "#!rtpplay1.0 ") {
+		t.Fatalf("rtpdump of %d bytes", len(data))
+	}
+
+	// Deleting removes the file and is audited
+	if status := ts.api(t, http.MethodDelete, "/api/captures/"+inbound.ID, "", testAdminKey, nil); status != http.StatusNoContent {
+		t.Fatalf("delete: %d", status)
+	}
+	if _, err := os.Stat(filepath.Join(ts.config.Capture.Dir, inbound.ID+".pcap")); !os.IsNotExist(err) {
+		t.Fatalf("file left after delete: %v", err)
+	}
+	if status := ts.api(t, http.MethodGet, "/api/captures/"+inbound.ID, "", testAdminKey, nil); status != http.StatusNotFound {
+		t.Fatalf("download after delete: %d", status)
+	}
+	var started, deleted int
+	for _, ev := range ts.auditLogger.Query("room-1", 0) {
+		switch {
+		case ev.Action == auditCaptureStart && ev.Result == audit.ResultSuccess:
+			started++
+		case ev.Action == auditCaptureDelete && ev.Detail["captureId"] == inbound.ID:
+			deleted++
+		}
+	}
+	if started != 2 || deleted != 1 {
+		t.Fatalf("audited %d starts and %d deletes", started, deleted)
+	}
+
+	for _, tc := range []struct {
+		name, room, body string
+		status           int
+	}{
+		{"no peer or track", "room-1", `{}`, http.StatusBadRequest},
+		{"bad direction", "room-1", `{"peerId":"` + alice.ID + `","direction":"sideways"}`, http.StatusBadRequest},
+		{"bad format", "room-1", `{"peerId":"` + alice.ID + `","format":"pcapng"}`, http.StatusBadRequest},
+		{"over the duration limit", "room-1", `{"peerId":"` + alice.ID + `","durationSec":31}`, http.StatusBadRequest},
+		{"over the byte limit", "room-1", fmt.Sprintf(`{"peerId":%q,"maxBytes":%d}`, alice.ID, 2<<20), http.StatusBadRequest},
+		{"outbound by track alone", "room-1", `{"trackHandle":"` + inbound.Tracks[0] + `","direction":"outbound"}`, http.StatusBadRequest},
+		{"unknown room", "room-2", `{"peerId":"` + alice.ID + `"}`, http.StatusNotFound},
+		{"unknown peer", "room-1", `{"peerId":"nobody"}`, http.StatusNotFound},
+	} {
+		if status, _ := ts.startCapture(t, tc.room, tc.body); status != tc.status {
+			t.Errorf("%s: %d, want %d", tc.name, status, tc.status)
+		}
+	}
+	if status := ts.api(t, http.MethodPost, "/api/rooms/room-1/capture", `{"peerId":"`+alice.ID+`"}`, "", nil); status != http.StatusUnauthorized {
+		t.Fatalf("capture without the admin key: %d", status)
+	}
+	if entries, _ := os.ReadDir(ts.config.Capture.Dir); len(entries) != 1 {
+		t.Fatalf("%d files in the capture directory, want the rtpdump's", len(entries))
+	}
+}
+
+func TestCaptureDisabled(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) { cfg.Capture.Dir = "" })
+	ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	if status, _ := ts.startCapture(t, "room-1", `{"peerId":"alice"}`); status != http.StatusServiceUnavailable {
+		t.Fatalf("capture while disabled: %d", status)
+	}
+	if status := ts.api(t, http.MethodGet, "/api/captures", "", testAdminKey, nil); status != http.StatusServiceUnavailable {
+		t.Fatalf("listing while disabled: %d", status)
+	}
+}
+
+func download(t *testing.T, ts *testServer, id string) ([]byte, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.http.URL+"/api/captures/"+id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Key", testAdminKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("download of %s: %d %v", id, resp.StatusCode, err)
+	}
+	return data, resp.Header.Get("Content-Type")
+}
+
+// pcapRecords counts the records of a pcap file, or returns -1 if they do
+// not add up to it.
+func pcapRecords(data []byte) int {
+	n := 0
+	for rest := data[24:]; len(rest) > 0; n++ {
+		if len(rest) < 16 || len(rest) < 16+int(binary.LittleEndian.Uint32(rest[8:])) {
+			return -1
+		}
+		rest = rest[16+binary.LittleEndian.Uint32(rest[8:]):]
+	}
+	return n
+}
@@ -0,0 +1,208 @@
+package sfu
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"go.uber.org/zap"
+)
+
+// instanceID returns this instance's cluster identifier, or "" when running
+// without Redis.
+func (s *SFU) instanceID() string {
+	if s.pubsubManager.Load() == nil {
+		return ""
+	}
+	return s.pubsubManager.Load().GetInstanceID()
+}
+
+// subscribeRoomChannel listens on a local room's pub/sub channel for
+// messages other instances address to its clients, such as relays.
+func (s *SFU) subscribeRoomChannel(roomID string) {
+	if pm := s.pubsubManager.Load(); pm != nil {
+		pm.SubscribeToRoom(roomID)
+	}
+}
+
+// unsubscribeRoomChannel stops listening once the room is closed here.
+func (s *SFU) unsubscribeRoomChannel(roomID string) {
+	if pm := s.pubsubManager.Load(); pm != nil {
+		pm.UnsubscribeFromRoom(roomID)
+	}
+}
+
+func (s *SFU) roomSummaryTTL() time.Duration {
+	return 3 * s.config.Redis.RoomHeartbeatInterval
+}
+
+// publishRoomSummary refreshes the cluster-visible summary of a local room.
+// Publishes run in the background after joins and leaves, so one may come
+// after the room was closed; it is dropped unless rm is still hosted here,
+// checked under summaryMu so removeRoomSummary cannot run in between.
+// Stop waits on summaryMu too, so without a deadline of its own a publish is
+// bounded like a signaling message.
+func (s *SFU) publishRoomSummary(ctx context.Context, roomID string, rm *room.Room) {
+	if s.stateManager.Load() == nil || rm == nil {
+		return
+	}
+	if _, ok := ctx.Deadline(); !ok && s.config.Server.MessageTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.Server.MessageTimeout)
+		defer cancel()
+	}
+	s.summaryMu.Lock()
+	defer s.summaryMu.Unlock()
+	if s.lookupRoom(roomID) != rm {
+		return
+	}
+
+	summary := &state.RoomSummary{
+		RoomID:     roomID,
+		Name:       rm.Name,
+		InstanceID: s.instanceID(),
+		Region:     s.config.Server.Region,
+		PeerCount:  rm.GetPeerCount(),
+		CreatedAt:  rm.CreatedAt,
+		UpdatedAt:  rm.GetUpdatedAt(),
+	}
+
+	if err := s.stateManager.Load().SetRoomSummary(ctx, summary, s.roomSummaryTTL()); err != nil {
+		s.logger.Debug("Failed to publish room summary",
+			zap.String("roomID", roomID),
+			zap.Error(err),
+		)
+	}
+}
+
+// removeRoomSummary drops a room from the cluster directory once this
+// instance stops hosting it. Callers take the room out of s.rooms first.
+func (s *SFU) removeRoomSummary(ctx context.Context, roomID string) {
+	if s.stateManager.Load() == nil {
+		return
+	}
+	s.summaryMu.Lock()
+	defer s.summaryMu.Unlock()
+	if err := s.stateManager.Load().DeleteRoomSummary(ctx, roomID, s.instanceID()); err != nil {
+		s.logger.Debug("Failed to remove room summary",
+			zap.String("roomID", roomID),
+			zap.Error(err),
+		)
+	}
+}
+
+// roomHeartbeatLoop periodically refreshes the summaries of every local room so
+// their TTL never lapses while the instance is alive.
+func (s *SFU) roomHeartbeatLoop() {
+	interval := s.config.Redis.RoomHeartbeatInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if s.stateManager.Load() == nil {
+				continue
+			}
+			s.roomsMu.RLock()
+			rooms := make(map[string]*room.Room, len(s.rooms))
+			for id, rm := range s.rooms {
+				rooms[id] = rm
+			}
+			s.roomsMu.RUnlock()
+
+			for id, rm := range rooms {
+				s.publishRoomSummary(s.ctx, id, rm)
+				s.saveRoomSnapshot(s.ctx, rm)
+			}
+			s.registerInstance(s.ctx)
+		}
+	}
+}
+
+// clusterRoom is a room of this instance in the cluster room listing.
+type clusterRoom struct {
+	room.RoomStats
+	InstanceID string `json:"instanceId"`
+	Local      bool   `json:"local"`
+}
+
+// remoteRoom is a room of another instance in the cluster room listing,
+// known only from its summary in Redis.
+type remoteRoom struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	InstanceID string    `json:"instanceId"`
+	PeerCount  int       `json:"peerCount"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	Local      bool      `json:"local"`
+}
+
+// handleClusterRoomsAPI lists rooms across every SFU instance: local rooms are
+// reported live, remote rooms come from the Redis directory.
+func (s *SFU) handleClusterRoomsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	lq, err := parseListQuery(r.URL.Query(), true, "createdAt", "peerCount")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	localInstance := s.instanceID()
+
+	local := s.roomSnapshot()
+	rooms := make([]listEntry, 0, len(local))
+	seen := make(map[string]bool, len(local))
+	for _, rm := range local {
+		stats := s.visibleRoomStats(r, rm)
+		rooms = append(rooms, roomListEntry(clusterRoom{
+			RoomStats:  stats,
+			InstanceID: localInstance,
+			Local:      true,
+		}, stats))
+		seen[rm.ID] = true
+	}
+
+	if s.stateManager.Load() != nil {
+		summaries, err := s.stateManager.Load().ListRoomSummaries(r.Context())
+		if err != nil {
+			s.logger.Warn("Failed to list cluster rooms", zap.Error(err))
+		}
+		for _, summary := range summaries {
+			if seen[summary.RoomID] {
+				continue
+			}
+			seen[summary.RoomID] = true
+			// Remote rooms have no state to filter by
+			remote := remoteRoom{
+				ID:         summary.RoomID,
+				Name:       summary.Name,
+				InstanceID: summary.InstanceID,
+				PeerCount:  summary.PeerCount,
+				CreatedAt:  summary.CreatedAt,
+				UpdatedAt:  summary.UpdatedAt,
+				Local:      summary.InstanceID == localInstance,
+			}
+			rooms = append(rooms, roomListEntry(remote, room.RoomStats{
+				ID:        remote.ID,
+				Name:      remote.Name,
+				PeerCount: remote.PeerCount,
+				CreatedAt: remote.CreatedAt,
+			}))
+		}
+	}
+
+	writeListPage(w, "rooms", lq.page(rooms), map[string]interface{}{"instanceId": localInstance})
+}
@@ -0,0 +1,102 @@
+package sfu
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// listedRoom is a room of the GET /api/cluster/rooms listing.
+type listedRoom struct {
+	ID         string `json:"id"`
+	InstanceID string `json:"instanceId"`
+	PeerCount  int    `json:"peerCount"`
+	Local      bool   `json:"local"`
+}
+
+// clusterRooms lists the cluster's rooms as ts sees them, by room ID.
+func clusterRooms(t *testing.T, ts *testServer) map[string]listedRoom {
+	t.Helper()
+	var listing struct {
+		InstanceID string       `json:"instanceId"`
+		Rooms      []listedRoom `json:"rooms"`
+	}
+	if code := ts.api(t, http.MethodGet, "/api/cluster/rooms", "", "", &listing); code != http.StatusOK {
+		t.Fatalf("cluster rooms: status %d", code)
+	}
+	if listing.InstanceID != ts.instanceID() {
+		t.Fatalf("listing from instance %q, want %q", listing.InstanceID, ts.instanceID())
+	}
+	rooms := make(map[string]listedRoom)
+	for _, rm := range listing.Rooms {
+		rooms[rm.ID] = rm
+	}
+	return rooms
+}
+
+func TestClusterRoomsAcrossInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	t.Setenv("INSTANCE_ID", "sfu-a")
+	a := newTestServer(t, mr, nil)
+	t.Setenv("INSTANCE_ID", "sfu-b")
+	b := newTestServer(t, mr, nil)
+
+	a.join(t, "alice", "room-a", client.Handlers{}, client.JoinOptions{})
+	b.join(t, "bob", "room-b", client.Handlers{}, client.JoinOptions{})
+	carol := b.join(t, "carol", "room-b", client.Handlers{}, client.JoinOptions{})
+
+	for _, tc := range []struct {
+		from  *testServer
+		name  string
+		local string
+	}{{a, "a", "room-a"}, {b, "b", "room-b"}} {
+		var rooms map[string]listedRoom
+		eventually(t, "both rooms with their peers in the listing of "+tc.name, func() bool {
+			rooms = clusterRooms(t, tc.from)
+			return len(rooms) == 2 && rooms["room-b"].PeerCount == 2
+		})
+		for id, owner := range map[string]*testServer{"room-a": a, "room-b": b} {
+			rm := rooms[id]
+			if rm.InstanceID != owner.instanceID() || rm.Local != (id == tc.local) {
+				t.Fatalf("%s listed by %s as %+v", id, tc.name, rm)
+			}
+		}
+		if got := rooms["room-a"].PeerCount; got != 1 {
+			t.Fatalf("room-a has %d peers in the listing of %s, want 1", got, tc.name)
+		}
+	}
+
+	// A leave is seen across the cluster
+	if err := carol.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "carol's leave in a's listing", func() bool {
+		return clusterRooms(t, a)["room-b"].PeerCount == 1
+	})
+
+	// Once b closes room-b it leaves the listing of a
+	if code := b.api(t, http.MethodDelete, "/api/rooms/room-b", "", testAdminKey, nil); code != http.StatusNoContent {
+		t.Fatalf("delete room-b: status %d", code)
+	}
+	if _, listed := clusterRooms(t, a)["room-b"]; listed {
+		t.Fatal("closed room still in the cluster listing")
+	}
+}
+
+func TestLatePublishDoesNotRestoreClosedRoom(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	rm := ts.lookupRoom("room-1")
+
+	if code := ts.api(t, http.MethodDelete, "/api/rooms/room-1", "", testAdminKey, nil); code != http.StatusNoContent {
+		t.Fatalf("delete: status %d", code)
+	}
+	// A publish queued by the last leave runs after the room is gone
+	ts.publishRoomSummary(context.Background(), "room-1", rm)
+	if summary, err := ts.stateManager.Load().GetRoomSummary(context.Background(), "room-1"); err != nil || summary != nil {
+		t.Fatalf("summary of the closed room: %+v, %v", summary, err)
+	}
+}
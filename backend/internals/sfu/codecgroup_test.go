@@ -0,0 +1,172 @@
+package sfu
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// h264OnlyAPI negotiates Opus and H264 but no VP8, like Safari configured
+// to prefer hardware decoding.
+func h264OnlyAPI(t *testing.T) *webrtc.API {
+	t.Helper()
+	me := &webrtc.MediaEngine{}
+	for _, c := range []struct {
+		params webrtc.RTPCodecParameters
+		kind   webrtc.RTPCodecType
+	}{
+		{webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2},
+			PayloadType:        111,
+		}, webrtc.RTPCodecTypeAudio},
+		{webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:    webrtc.MimeTypeH264,
+				ClockRate:   90000,
+				SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+			},
+			PayloadType: 102,
+		}, webrtc.RTPCodecTypeVideo},
+	} {
+		if err := me.RegisterCodec(c.params, c.kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return webrtc.NewAPI(webrtc.WithMediaEngine(me))
+}
+
+// videoReceiver records the video tracks a session is forwarded.
+type videoReceiver struct {
+	mu     sync.Mutex
+	tracks map[string]string // track ID -> codec
+}
+
+func (vr *videoReceiver) onTrack(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+	if track.Kind() != webrtc.RTPCodecTypeVideo {
+		return
+	}
+	vr.mu.Lock()
+	if vr.tracks == nil {
+		vr.tracks = make(map[string]string)
+	}
+	vr.tracks[track.ID()] = track.Codec().MimeType
+	vr.mu.Unlock()
+}
+
+func (vr *videoReceiver) get() map[string]string {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	out := make(map[string]string, len(vr.tracks))
+	for id, codec := range vr.tracks {
+		out[id] = codec
+	}
+	return out
+}
+
+func TestCodecAlternatives(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	group, err := alice.DeclareCodecAlternatives(ctx, "cam-vp8", "cam-h264")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tracks []*webrtc.TrackLocalStaticSample
+	for _, alt := range []struct{ mime, id string }{{webrtc.MimeTypeVP8, "cam-vp8"}, {webrtc.MimeTypeH264, "cam-h264"}} {
+		track, err := client.NewSampleTrack(alt.mime, alt.id, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := alice.PublishTrack(track); err != nil {
+			t.Fatal(err)
+		}
+		tracks = append(tracks, track)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, track := range tracks {
+					track.WriteSample(media.Sample{Data: []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88}, Duration: 20 * time.Millisecond})
+				}
+			}
+		}
+	}()
+	rm := ts.lookupRoom("room-1")
+	eventually(t, "both alternatives", func() bool { return rm.GetTrackCount() == 2 })
+
+	// Each subscriber gets the first alternative it can decode, under the
+	// group ID
+	var bob, carol videoReceiver
+	var (
+		mu        sync.Mutex
+		published []signaling.TrackInfo
+	)
+	ts.join(t, "bob", "room-1", client.Handlers{
+		OnRoomState: func(state signaling.RoomStateMessage) {
+			mu.Lock()
+			published = append(published, state.Tracks...)
+			mu.Unlock()
+		},
+	}, client.JoinOptions{OnTrack: bob.onTrack})
+	ts.join(t, "carol", "room-1", client.Handlers{}, client.JoinOptions{API: h264OnlyAPI(t), OnTrack: carol.onTrack})
+	eventually(t, "a video track for each subscriber", func() bool {
+		return len(bob.get()) > 0 && len(carol.get()) > 0
+	})
+	time.Sleep(300 * time.Millisecond)
+	if got := bob.get(); len(got) != 1 || got[group] != webrtc.MimeTypeVP8 {
+		t.Errorf("bob receives %v, want %s as VP8 only", got, group)
+	}
+	if got := carol.get(); len(got) != 1 || got[group] != webrtc.MimeTypeH264 {
+		t.Errorf("carol receives %v, want %s as H264 only", got, group)
+	}
+
+	mu.Lock()
+	videos := 0
+	for _, info := range published {
+		if info.Kind != "video" {
+			continue
+		}
+		videos++
+		if info.GroupID != group || len(info.Codecs) != 2 || info.Codecs[0] != webrtc.MimeTypeVP8 || info.Codecs[1] != webrtc.MimeTypeH264 {
+			t.Errorf("room-state lists %+v, want group %s with VP8 then H264", info, group)
+		}
+	}
+	if videos != 2 {
+		t.Errorf("room-state lists %d video tracks, want both alternatives", videos)
+	}
+	mu.Unlock()
+
+	// The group handle stands for what each subscriber receives
+	_, bobPeer := ts.getRoomAndPeer("room-1", "bob")
+	_, carolPeer := ts.getRoomAndPeer("room-1", "carol")
+	if mt, ok := rm.ResolveTrackFor(group, bobPeer.ID); !ok || mt.ID != "cam-vp8" {
+		t.Errorf("group resolves to %v for bob", mt)
+	}
+	if mt, ok := rm.ResolveTrackFor(group, carolPeer.ID); !ok || mt.ID != "cam-h264" {
+		t.Errorf("group resolves to %v for carol", mt)
+	}
+
+	// The group goes with its publisher
+	if err := alice.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "alice's tracks to go", func() bool { return rm.GetTrackCount() == 0 })
+	if _, ok := rm.ResolveTrackFor(group, bobPeer.ID); ok {
+		t.Fatal("group outlived its publisher")
+	}
+}
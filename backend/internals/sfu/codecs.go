@@ -0,0 +1,72 @@
+package sfu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// registerCodecs fills the media engine: with the configured codecs when
+// there are any, otherwise with Pion's defaults and, for WebKit
+// compatibility, Safari's extra H264 profiles. The configured codecs have
+// been validated by config.Validate.
+func (s *SFU) registerCodecs(m *webrtc.MediaEngine) error {
+	if len(s.config.Media.Codecs) == 0 {
+		if err := m.RegisterDefaultCodecs(); err != nil {
+			return fmt.Errorf("failed to register default codecs: %w", err)
+		}
+		if s.config.Media.WebKitCompat {
+			s.registerWebKitCodecs(m)
+		}
+		return nil
+	}
+
+	for i, c := range s.config.Media.Codecs {
+		feedback := make([]webrtc.RTCPFeedback, 0, len(c.RTCPFeedback))
+		for _, fb := range c.RTCPFeedback {
+			typ, param, _ := strings.Cut(strings.TrimSpace(fb), " ")
+			feedback = append(feedback, webrtc.RTCPFeedback{Type: typ, Parameter: strings.TrimSpace(param)})
+		}
+		kind := webrtc.RTPCodecTypeAudio
+		if c.Kind() == "video" {
+			kind = webrtc.RTPCodecTypeVideo
+		}
+		codec := webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType:     c.MimeType,
+				ClockRate:    c.ClockRate,
+				Channels:     c.Channels,
+				SDPFmtpLine:  c.Fmtp,
+				RTCPFeedback: feedback,
+			},
+			PayloadType: webrtc.PayloadType(*c.PayloadType),
+		}
+		if err := m.RegisterCodec(codec, kind); err != nil {
+			return fmt.Errorf("failed to register codec %d (%s): %w", i, c.MimeType, err)
+		}
+	}
+	return nil
+}
+
+// codecsAllowed returns the codecs rooms accept tracks in: the media codecs
+// of the configured list, or else the configured allowed video and audio
+// codecs.
+func (s *SFU) codecsAllowed() map[string]bool {
+	allowed := make(map[string]bool)
+	if len(s.config.Media.Codecs) > 0 {
+		for _, c := range s.config.Media.Codecs {
+			if c.Media() {
+				allowed[c.MimeType] = true
+			}
+		}
+		return allowed
+	}
+	for _, codec := range s.config.Media.AllowedVideoCodecs {
+		allowed[codec] = true
+	}
+	for _, codec := range s.config.Media.AllowedAudioCodecs {
+		allowed[codec] = true
+	}
+	return allowed
+}
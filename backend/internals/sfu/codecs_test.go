@@ -0,0 +1,147 @@
+package sfu
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+// h264Only configures the SFU with H264, its retransmissions and Opus.
+func h264Only(t *testing.T) func(*config.Config) {
+	var codecs []config.CodecConfig
+	if err := json.Unmarshal([]byte(`[
+		{"mimeType": "video/H264", "clockRate": 90000, "payloadType": 102,
+		 "fmtp": "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+		 "rtcpFeedback": ["nack", "nack pli"]},
+		{"mimeType": "video/rtx", "clockRate": 90000, "payloadType": 103, "fmtp": "apt=102"},
+		{"mimeType": "audio/opus", "clockRate": 48000, "channels": 2, "payloadType": 111,
+		 "fmtp": "minptime=10;useinbandfec=1"}
+	]`), &codecs); err != nil {
+		t.Fatal(err)
+	}
+	return func(cfg *config.Config) { cfg.Media.Codecs = codecs }
+}
+
+// mediaLines parses desc into its m-lines' formats and their rtpmap, fmtp
+// and rtcp-fb attributes, by kind.
+func mediaLines(t *testing.T, desc string) map[string][]string {
+	t.Helper()
+	var parsed sdp.SessionDescription
+	if err := parsed.Unmarshal([]byte(desc)); err != nil {
+		t.Fatal(err)
+	}
+	lines := make(map[string][]string)
+	for _, md := range parsed.MediaDescriptions {
+		kind := md.MediaName.Media
+		lines[kind] = append(lines[kind], "m="+strings.Join(md.MediaName.Formats, " "))
+		for _, attr := range md.Attributes {
+			switch attr.Key {
+			case "rtpmap", "fmtp", "rtcp-fb":
+				lines[kind] = append(lines[kind], attr.Key+":"+attr.Value)
+			}
+		}
+	}
+	return lines
+}
+
+func TestConfiguredCodecsInSDP(t *testing.T) {
+	ts := newTestServer(t, nil, h264Only(t))
+
+	// What the SFU offers is the list, with its payload types and fmtp
+	m := &webrtc.MediaEngine{}
+	if err := ts.registerCodecs(m); err != nil {
+		t.Fatal(err)
+	}
+	pc, err := webrtc.NewAPI(webrtc.WithMediaEngine(m)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		if _, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionSendonly}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"video": {
+			"m=102 103",
+			"rtpmap:102 H264/90000",
+			"fmtp:102 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+			"rtcp-fb:102 nack ",
+			"rtcp-fb:102 nack pli",
+			"rtpmap:103 rtx/90000",
+			"fmtp:103 apt=102",
+		},
+		"audio": {
+			"m=111",
+			"rtpmap:111 opus/48000/2",
+			"fmtp:111 minptime=10;useinbandfec=1",
+		},
+	}
+	if got := mediaLines(t, offer.SDP); !reflect.DeepEqual(got, want) {
+		t.Fatalf("offered\n%q\nwant\n%q", got, want)
+	}
+
+	// A browser offering its defaults gets back only what the list has
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		if _, err := client.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	browserOffer, err := client.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := ts.dialScripted(t, "alice")
+	sc.pipeline(t,
+		signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "alice"},
+		signaling.MessageTypeOffer, signaling.OfferMessage{SDP: browserOffer.SDP, Type: "offer"},
+	)
+	var answer signaling.AnswerMessage
+	for _, msg := range sc.readUntil(t, signaling.MessageTypeAnswer) {
+		if msg.Type == signaling.MessageTypeAnswer {
+			if err := json.Unmarshal(msg.Data, &answer); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	answered := make(map[string]bool)
+	for kind, lines := range mediaLines(t, answer.SDP) {
+		for _, line := range lines {
+			if !strings.HasPrefix(line, "rtpmap:") {
+				continue
+			}
+			codec, _, _ := strings.Cut(line[strings.Index(line, " ")+1:], "/")
+			if codec != "H264" && codec != "rtx" && codec != "opus" {
+				t.Fatalf("answered %s with %s", kind, codec)
+			}
+			answered[codec] = true
+		}
+	}
+	if !answered["H264"] || !answered["opus"] {
+		t.Fatalf("answered with %v", answered)
+	}
+}
+
+func TestBadCodecsFailStartup(t *testing.T) {
+	cfg := config.LoadConfig()
+	cfg.Media.Codecs = []config.CodecConfig{{MimeType: "video/H264", ClockRate: 90000}}
+	if _, err := NewSFU(cfg); err == nil || !strings.Contains(err.Error(), "payloadType is required") {
+		t.Fatalf("started with a codec without a payload type: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package sfu
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// handlePeerConnectionState tells the room that a peer's media connection
+// dropped or came back (see room/connstate.go). Observers and broadcast
+// viewers are never announced, so neither is their connection.
+func (s *SFU) handlePeerConnectionState(rm *room.Room, p *peer.Peer, change room.PeerConnectionChange) {
+	if !announcesPeer(rm, p) {
+		return
+	}
+	data, err := json.Marshal(peerConnectionStateMessage(p, change))
+	if err != nil {
+		s.logger.Error("Failed to marshal peer-connection-state", zap.Error(err))
+		return
+	}
+	msg := signaling.Message{Type: signaling.MessageTypePeerConnectionState, Data: data, Timestamp: time.Now()}
+	s.broadcastToRoom(rm, msg, func(other *signaling.Client) bool {
+		return other.UserID != p.UserID
+	})
+}
+
+func peerConnectionStateMessage(p *peer.Peer, change room.PeerConnectionChange) signaling.PeerConnectionStateMessage {
+	return signaling.PeerConnectionStateMessage{
+		PeerID:     p.ID,
+		State:      change.State,
+		Since:      change.Since,
+		DurationMs: time.Since(change.Since).Milliseconds(),
+		OutageMs:   change.Outage.Milliseconds(),
+	}
+}
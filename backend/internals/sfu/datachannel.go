@@ -0,0 +1,139 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// maxDataBroadcastSize bounds a single broadcast payload; SCTP messages above
+// 16 KiB are not reliably interoperable across browsers.
+const maxDataBroadcastSize = 16 * 1024
+
+// dataEnvelope is what peers receive on their data channel for a broadcast.
+type dataEnvelope struct {
+	Seq       uint64          `json:"seq"`
+	From      string          `json:"from,omitempty"` // sender peer ID, empty for server messages
+	Payload   json.RawMessage `json:"payload"`
+	Timestamp time.Time       `json:"timestamp"`
+	ClientTS  int64           `json:"clientTs,omitempty"` // sender's clock, when it provided one
+}
+
+// broadcastData wraps payload in an envelope and fans it out to the room.
+// clientTS is the sender's timestamp for the message, 0 if it gave none.
+func (s *SFU) broadcastData(rm *room.Room, fromPeerID string, payload json.RawMessage, clientTS int64, excludeSelf bool) (*room.BroadcastResult, error) {
+	seq := rm.NextDataSeq()
+	data, err := json.Marshal(dataEnvelope{
+		Seq:       seq,
+		From:      fromPeerID,
+		Payload:   payload,
+		Timestamp: time.Now(),
+		ClientTS:  clientTS,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exclude := ""
+	if excludeSelf {
+		exclude = fromPeerID
+	}
+	return rm.BroadcastMessage(seq, data, exclude), nil
+}
+
+func (s *SFU) handleDataBroadcastMessage(client *signaling.Client, message signaling.Message, msg signaling.DataBroadcastMessage) {
+	if len(msg.Payload) > maxDataBroadcastSize {
+		client.SendError(413, "Data broadcast payload too large")
+		return
+	}
+
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if p == nil {
+		client.SendError(404, "Peer not found")
+		return
+	}
+
+	result, err := s.broadcastData(rm, p.ID, msg.Payload, message.ClientTS, msg.ExcludeSelf)
+	if err != nil {
+		client.SendError(500, "Failed to broadcast message")
+		return
+	}
+
+	data, err := json.Marshal(signaling.DataBroadcastAckMessage{
+		Seq:    result.Seq,
+		Sent:   result.Sent,
+		Queued: result.Queued,
+		Failed: result.Failed,
+	})
+	if err != nil {
+		return
+	}
+
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypeDataBroadcast, Data: data, Timestamp: time.Now(), ClientTS: message.ClientTS,
+	})
+}
+
+// roomMessageRequest is the body of POST /api/rooms/{id}/messages.
+type roomMessageRequest struct {
+	Payload json.RawMessage `json:"payload"`
+}
+
+// handleRoomMessagesAPI serves POST /api/rooms/{id}/messages, injecting a
+// server-originated broadcast and returning per-peer delivery results.
+func (s *SFU) handleRoomMessagesAPI(w http.ResponseWriter, r *http.Request, roomID string) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req roomMessageRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxDataBroadcastSize*2)
+	if !s.decodeJSONBody(w, r, &req) {
+		return
+	}
+	if len(req.Payload) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "payload is required")
+		return
+	}
+	if len(req.Payload) > maxDataBroadcastSize {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, "Payload too large")
+		return
+	}
+
+	s.roomsMu.RLock()
+	rm, exists := s.rooms[roomID]
+	s.roomsMu.RUnlock()
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	result, err := s.broadcastData(rm, "", req.Payload, 0, false)
+	if err != nil {
+		s.auditRequest(r, auditRoomBroadcast, roomID, audit.ResultFailure, nil)
+		writeAPIError(w, http.StatusInternalServerError, "Failed to broadcast message")
+		return
+	}
+
+	s.auditRequest(r, auditRoomBroadcast, roomID, audit.ResultSuccess, map[string]string{
+		"seq":  strconv.FormatUint(result.Seq, 10),
+		"sent": strconv.Itoa(result.Sent),
+	})
+
+	s.logger.Debug("Data broadcast injected via API",
+		zap.String("roomID", roomID),
+		zap.Uint64("seq", result.Seq),
+		zap.Int("sent", result.Sent),
+		zap.Int("queued", result.Queued),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,58 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/utils"
+)
+
+// debugLogsResponse is the body of GET /debug/logs.
+type debugLogsResponse struct {
+	Entries []utils.LogEntry `json:"entries"`
+	Total   int              `json:"total"`
+}
+
+// handleDebugLogs serves GET /debug/logs: the recent entries of the
+// in-memory log ring (see utils/logring.go), debug level included, filtered
+// by roomId, peerId and sinceSec, oldest first.
+func (s *SFU) handleDebugLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	ring := utils.DebugRing
+	if ring == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "The log ring is disabled")
+		return
+	}
+
+	query := r.URL.Query()
+	filter := utils.LogFilter{
+		RoomID: query.Get("roomId"),
+		PeerID: query.Get("peerId"),
+		Limit:  1000,
+	}
+	if v := query.Get("sinceSec"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeAPIError(w, http.StatusBadRequest, "Invalid sinceSec")
+			return
+		}
+		filter.Since = time.Now().Add(-time.Duration(n) * time.Second)
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeAPIError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		filter.Limit = n
+	}
+
+	entries := ring.Query(filter)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(debugLogsResponse{Entries: entries, Total: len(entries)})
+}
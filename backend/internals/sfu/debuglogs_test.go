@@ -0,0 +1,63 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/utils"
+	"go.uber.org/zap"
+)
+
+func TestDebugLogsAPI(t *testing.T) {
+	previous := utils.DebugRing
+	defer func() { utils.DebugRing = previous }()
+	s := &SFU{}
+
+	utils.DebugRing = nil
+	w := httptest.NewRecorder()
+	s.handleDebugLogs(w, httptest.NewRequest(http.MethodGet, "/debug/logs", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("without a ring: status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	utils.DebugRing = utils.NewLogRing(64, time.Minute)
+	logger := zap.New(utils.DebugRing.Core())
+	logger.Debug("joined", zap.String("roomID", "r1"), zap.String("peerID", "p1"))
+	logger.Debug("joined", zap.String("roomID", "r1"), zap.String("peerID", "p2"))
+	logger.Info("joined", zap.String("roomID", "r2"), zap.String("peerID", "p3"))
+
+	for _, tc := range []struct {
+		query  string
+		status int
+		total  int
+	}{
+		{"", http.StatusOK, 3},
+		{"?roomId=r1", http.StatusOK, 2},
+		{"?roomId=r1&peerId=p2", http.StatusOK, 1},
+		{"?peerId=p4", http.StatusOK, 0},
+		{"?limit=1", http.StatusOK, 1},
+		{"?sinceSec=60", http.StatusOK, 3},
+		{"?limit=0", http.StatusBadRequest, 0},
+		{"?sinceSec=soon", http.StatusBadRequest, 0},
+	} {
+		w := httptest.NewRecorder()
+		s.handleDebugLogs(w, httptest.NewRequest(http.MethodGet, "/debug/logs"+tc.query, nil))
+		if w.Code != tc.status {
+			t.Errorf("%q: status %d, want %d", tc.query, w.Code, tc.status)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+		var body debugLogsResponse
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Total != tc.total || len(body.Entries) != tc.total {
+			t.Errorf("%q: %d entries (total %d), want %d", tc.query, len(body.Entries), body.Total, tc.total)
+		}
+	}
+}
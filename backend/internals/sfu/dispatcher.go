@@ -0,0 +1,157 @@
+package sfu
+
+import (
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// Signaling messages are routed by type through a dispatcher. Each type has
+// one handler, registered in newSignalingDispatcher; handlers that take a
+// payload are wrapped with typed, which decodes and validates it before the
+// handler runs. Middleware wraps the whole dispatch, so it also sees
+// messages of unknown types. Handlers reach the rest of the SFU through
+// RoomService and SessionService (see services.go), which tests replace
+// with fakes.
+
+// messageHandler handles one signaling message from client.
+type messageHandler func(client *signaling.Client, message signaling.Message)
+
+// messageMiddleware wraps a handler, running before (and possibly instead
+// of) it.
+type messageMiddleware func(next messageHandler) messageHandler
+
+// dispatcher routes signaling messages to the handler registered for their
+// type. It is set up before the first client connects and read-only after.
+type dispatcher struct {
+	handlers   map[signaling.MessageType]messageHandler
+	middleware []messageMiddleware
+	logger     *zap.Logger
+	chain      messageHandler
+}
+
+func newDispatcher(logger *zap.Logger) *dispatcher {
+	d := &dispatcher{
+		handlers: make(map[signaling.MessageType]messageHandler),
+		logger:   logger,
+	}
+	d.chain = d.route
+	return d
+}
+
+// handle registers h for the given message types.
+func (d *dispatcher) handle(h messageHandler, types ...signaling.MessageType) {
+	for _, t := range types {
+		d.handlers[t] = h
+	}
+}
+
+// use appends middleware. The first added runs first.
+func (d *dispatcher) use(mw ...messageMiddleware) {
+	d.middleware = append(d.middleware, mw...)
+	chain := messageHandler(d.route)
+	for i := len(d.middleware) - 1; i >= 0; i-- {
+		chain = d.middleware[i](chain)
+	}
+	d.chain = chain
+}
+
+// dispatch runs message through the middleware and its type's handler.
+func (d *dispatcher) dispatch(client *signaling.Client, message signaling.Message) {
+	d.chain(client, message)
+}
+
+func (d *dispatcher) route(client *signaling.Client, message signaling.Message) {
+	h, ok := d.handlers[message.Type]
+	if !ok {
+		d.logger.Debug("Unknown message type", zap.String("type", string(message.Type)))
+		return
+	}
+	h(client, message)
+}
+
+// typed adapts a handler of payload T. The message data is decoded into T
+// and checked with valid, if given; a message failing either is answered
+// with a 400 carrying invalid.
+func typed[T any](invalid string, valid func(*T) bool, fn func(*signaling.Client, signaling.Message, T)) messageHandler {
+	return func(client *signaling.Client, message signaling.Message) {
+		var payload T
+		if err := unmarshalMessageData(message.Data, &payload); err != nil || (valid != nil && !valid(&payload)) {
+			client.SendError(400, invalid)
+			return
+		}
+		fn(client, message, payload)
+	}
+}
+
+// untyped adapts a handler that takes no payload.
+func untyped(fn func(*signaling.Client)) messageHandler {
+	return func(client *signaling.Client, _ signaling.Message) {
+		fn(client)
+	}
+}
+
+// countMessages counts every message received, known type or not.
+func (s *SFU) countMessages(next messageHandler) messageHandler {
+	return func(client *signaling.Client, message signaling.Message) {
+		s.metrics.MessagesReceived.Inc()
+		next(client, message)
+	}
+}
+
+// newSignalingDispatcher returns the dispatcher of the SFU's signaling
+// messages.
+func (s *SFU) newSignalingDispatcher() *dispatcher {
+	d := newDispatcher(s.logger)
+	d.use(s.countMessages, s.limitDistributedJoins, s.rateLimitMessages, s.runJoins, s.routeMemberships)
+
+	d.handle(typed("Invalid join message format", nil, s.handleJoinMessage), signaling.MessageTypeJoin)
+	d.handle(untyped(s.handleLeaveMessage), signaling.MessageTypeLeave)
+	d.handle(typed("Invalid offer message format", nil, s.handleOfferMessage), signaling.MessageTypeOffer)
+	d.handle(typed("Invalid answer message format", nil, s.handleAnswerMessage), signaling.MessageTypeAnswer)
+	d.handle(typed("Invalid ICE candidate message format", nil, s.handleICECandidateMessage), signaling.MessageTypeICECandidate)
+	d.handle(untyped(s.handleICERestartRequest), signaling.MessageTypeICERestartRequest)
+	d.handle(untyped(s.handleIsAllowRenegotiationMessage), signaling.MessageTypeIsAllowRenegotiation)
+
+	d.handle(typed("Invalid layer-switch message", nil, s.handleLayerSwitchMessage), signaling.MessageTypeLayerSwitch)
+	d.handle(typed("Invalid request-keyframe message",
+		func(m *signaling.RequestKeyframeMessage) bool { return m.TrackID != "" },
+		s.handleRequestKeyframeMessage), signaling.MessageTypeRequestKeyframe)
+	d.handle(typed("Invalid bandwidth limit message", nil, s.handleSetBandwidthLimitMessage), signaling.MessageTypeSetBandwidthLimit)
+	d.handle(typed("Invalid publish-intent message",
+		func(m *signaling.PublishIntentMessage) bool { return len(m.Alternatives) > 0 || len(m.Replaces) > 0 },
+		s.handlePublishIntentMessage), signaling.MessageTypePublishIntent)
+
+	d.handle(typed("Invalid media-state message", nil, s.handleMediaStateMessage), signaling.MessageTypeMediaState)
+	d.handle(typed("Invalid update-name message", nil, s.handleUpdateNameMessage), signaling.MessageTypeUpdateName)
+	d.handle(typed("Invalid transfer-host message",
+		func(m *signaling.TransferHostMessage) bool { return m.PeerID != "" },
+		s.handleTransferHostMessage), signaling.MessageTypeTransferHost)
+	d.handle(typed("Invalid mute-all message", nil, s.handleMuteAllMessage), signaling.MessageTypeMuteAll)
+	d.handle(typed("Invalid spotlight message", nil, s.handleSpotlightMessage), signaling.MessageTypeSpotlight)
+	d.handle(typed("Invalid lock-room message", nil, s.handleLockRoomMessage), signaling.MessageTypeLockRoom)
+	d.handle(typed("Invalid set-track-priorities message",
+		func(m *signaling.TrackPrioritiesMessage) bool { return m.Priorities != nil },
+		s.handleSetTrackPrioritiesMessage), signaling.MessageTypeSetTrackPriorities)
+	d.handle(typed("Invalid set-receive-preferences message",
+		func(m *signaling.ReceivePreferencesMessage) bool { return m.Preferences != nil || m.Replace },
+		s.handleSetReceivePreferencesMessage), signaling.MessageTypeSetReceivePreferences)
+	d.handle(typed("Invalid data broadcast message",
+		func(m *signaling.DataBroadcastMessage) bool { return len(m.Payload) > 0 },
+		s.handleDataBroadcastMessage), signaling.MessageTypeDataBroadcast)
+	d.handle(s.handleP2PRelayMessage, signaling.MessageTypeP2PRelay)
+	d.handle(typed("Invalid relay message",
+		func(m *signaling.RelayMessage) bool { return len(m.Data) > 0 },
+		s.handleRelayMessage), signaling.MessageTypeRelay)
+	d.handle(typed("Invalid subscribe message",
+		func(m *signaling.SubscribeMessage) bool {
+			return len(m.TrackIDs)+len(m.Subscribe)+len(m.Unsubscribe) > 0
+		},
+		s.handleSubscribeMessage), signaling.MessageTypeSubscribe, signaling.MessageTypeUnsubscribe)
+	d.handle(typed("Invalid extend-time-limit message",
+		func(m *signaling.ExtendTimeLimitMessage) bool { return m.ExtendSec > 0 },
+		s.handleExtendTimeLimitMessage), signaling.MessageTypeExtendTimeLimit)
+
+	d.handle(s.handlePingMessage, signaling.MessageTypePing)
+	d.handle(func(*signaling.Client, signaling.Message) {}, signaling.MessageTypePong)
+	return d
+}
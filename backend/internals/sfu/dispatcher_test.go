@@ -0,0 +1,356 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// fakeRooms is a RoomService over rooms held in memory.
+type fakeRooms struct {
+	rooms     map[string]*room.Room
+	locks     []bool
+	renames   []string
+	announced []string
+}
+
+func (f *fakeRooms) RoomAndPeer(roomID, userID string) (*room.Room, *peer.Peer) {
+	rm := f.rooms[roomID]
+	if rm == nil {
+		return nil, nil
+	}
+	p, _ := rm.GetPeerByUserID(userID)
+	return rm, p
+}
+
+func (f *fakeRooms) LockRoom(_ context.Context, rm *room.Room, locked bool, by string) {
+	f.locks = append(f.locks, locked)
+}
+
+func (f *fakeRooms) RenamePeer(rm *room.Room, p *peer.Peer, name string) string {
+	previous := p.GetName()
+	p.SetName(name)
+	f.renames = append(f.renames, name)
+	return previous
+}
+
+func (f *fakeRooms) AnnounceTimeLimit(rm *room.Room, limit room.TimeLimit, reason string) {
+	f.announced = append(f.announced, reason)
+}
+
+// fakeSessions is a SessionService recording what it is asked.
+type fakeSessions struct {
+	left    []string
+	audited []string // action:result
+}
+
+func (f *fakeSessions) Leave(client *signaling.Client) {
+	f.left = append(f.left, client.UserID)
+}
+
+func (f *fakeSessions) Audit(client *signaling.Client, action, peerID, result string, detail map[string]string) {
+	f.audited = append(f.audited, action+":"+result)
+}
+
+func (f *fakeSessions) MessageContext() (context.Context, context.CancelFunc) {
+	return context.WithCancel(context.Background())
+}
+
+// handlerTest is an SFU whose signaling handlers run against fakes, with a
+// room holding a host and a participant.
+type handlerTest struct {
+	s        *SFU
+	rooms    *fakeRooms
+	sessions *fakeSessions
+	room     *room.Room
+	hub      *signaling.Hub
+	host     *signaling.Client
+	guest    *signaling.Client
+	guestID  string
+}
+
+func newHandlerTest(t *testing.T) *handlerTest {
+	t.Helper()
+	logger := zap.NewNop()
+	rm := room.NewRoom("test", 10, logger)
+	t.Cleanup(func() { rm.Close() })
+
+	ht := &handlerTest{
+		rooms:    &fakeRooms{rooms: map[string]*room.Room{rm.ID: rm}},
+		sessions: &fakeSessions{},
+		room:     rm,
+	}
+	ht.hub = signaling.NewHub(logger)
+	for _, userID := range []string{"host", "guest"} {
+		p := peer.NewPeer(rm.ID, userID, userID, logger)
+		if err := rm.AddPeer(p); err != nil {
+			t.Fatal(err)
+		}
+		client := signaling.NewClient("conn-"+userID, userID, userID, nil, logger)
+		ht.hub.SetRoom(client, rm.ID, p.ID)
+		if userID == "host" {
+			ht.host = client
+		} else {
+			ht.guest, ht.guestID = client, p.ID
+		}
+	}
+	if _, err := rm.SetHost("host", room.HostChangeTransfer); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Media.MaxNameLength = 64
+	ht.s = &SFU{config: cfg, logger: logger, roomService: ht.rooms, sessionService: ht.sessions}
+	ht.s.dispatcher = ht.s.newSignalingDispatcher()
+	return ht
+}
+
+// send dispatches a message of type typ with data from client.
+func (ht *handlerTest) send(t *testing.T, client *signaling.Client, typ signaling.MessageType, data interface{}) {
+	t.Helper()
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.s.dispatcher.route(client, signaling.Message{Type: typ, Data: raw, Timestamp: time.Now()})
+}
+
+// sentError returns the code of the error sent to client, 0 if none.
+func sentError(t *testing.T, client *signaling.Client) (int, string) {
+	t.Helper()
+	for {
+		select {
+		case m := <-client.Send:
+			if m.Type != signaling.MessageTypeError {
+				continue
+			}
+			var e signaling.ErrorMessage
+			if err := json.Unmarshal(m.Data, &e); err != nil {
+				t.Fatal(err)
+			}
+			return e.Code, e.Message
+		default:
+			return 0, ""
+		}
+	}
+}
+
+func TestDispatcherMiddlewareOrder(t *testing.T) {
+	d := newDispatcher(zap.NewNop())
+	var calls []string
+	record := func(name string) messageMiddleware {
+		return func(next messageHandler) messageHandler {
+			return func(client *signaling.Client, message signaling.Message) {
+				calls = append(calls, name)
+				next(client, message)
+			}
+		}
+	}
+	d.handle(func(*signaling.Client, signaling.Message) { calls = append(calls, "handler") }, signaling.MessageTypePing)
+	d.use(record("first"), record("second"))
+	d.use(record("third"))
+
+	d.dispatch(nil, signaling.Message{Type: signaling.MessageTypePing})
+	if got := strings.Join(calls, ","); got != "first,second,third,handler" {
+		t.Fatalf("calls = %s", got)
+	}
+}
+
+func TestDispatcherMiddlewareCanStop(t *testing.T) {
+	d := newDispatcher(zap.NewNop())
+	handled := false
+	d.handle(func(*signaling.Client, signaling.Message) { handled = true }, signaling.MessageTypePing)
+	d.use(func(next messageHandler) messageHandler {
+		return func(*signaling.Client, signaling.Message) {}
+	})
+	d.dispatch(nil, signaling.Message{Type: signaling.MessageTypePing})
+	if handled {
+		t.Fatal("handler ran although the middleware stopped the message")
+	}
+}
+
+func TestDispatcherUnknownType(t *testing.T) {
+	d := newDispatcher(zap.NewNop())
+	var seen []signaling.MessageType
+	handled := 0
+	d.handle(func(*signaling.Client, signaling.Message) { handled++ }, signaling.MessageTypeSubscribe, signaling.MessageTypeUnsubscribe)
+	d.use(func(next messageHandler) messageHandler {
+		return func(client *signaling.Client, message signaling.Message) {
+			seen = append(seen, message.Type)
+			next(client, message)
+		}
+	})
+
+	for _, typ := range []signaling.MessageType{"no-such-type", signaling.MessageTypeSubscribe, signaling.MessageTypeUnsubscribe} {
+		d.dispatch(nil, signaling.Message{Type: typ})
+	}
+	if len(seen) != 3 {
+		t.Fatalf("middleware saw %v, want every message", seen)
+	}
+	if handled != 2 {
+		t.Fatalf("handled %d messages, want 2", handled)
+	}
+}
+
+func TestTyped(t *testing.T) {
+	logger := zap.NewNop()
+	var got []signaling.RequestKeyframeMessage
+	h := typed("Invalid request-keyframe message",
+		func(m *signaling.RequestKeyframeMessage) bool { return m.TrackID != "" },
+		func(_ *signaling.Client, _ signaling.Message, m signaling.RequestKeyframeMessage) {
+			got = append(got, m)
+		})
+
+	for _, tc := range []struct {
+		name string
+		data string
+		want int // error code, 0 for handled
+	}{
+		{"valid", `{"trackId":"t1"}`, 0},
+		{"encoded as a string", `"{\"trackId\":\"t2\"}"`, 0},
+		{"not JSON", `{`, 400},
+		{"wrong type", `{"trackId":5}`, 400},
+		{"fails validation", `{}`, 400},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := signaling.NewClient("c", "u", "n", nil, logger)
+			before := len(got)
+			h(client, signaling.Message{Type: signaling.MessageTypeRequestKeyframe, Data: json.RawMessage(tc.data)})
+			code, msg := sentError(t, client)
+			if code != tc.want {
+				t.Fatalf("error %d %q, want %d", code, msg, tc.want)
+			}
+			if tc.want != 0 && (len(got) != before || msg != "Invalid request-keyframe message") {
+				t.Fatalf("invalid payload reached the handler or got message %q", msg)
+			}
+			if tc.want == 0 && len(got) != before+1 {
+				t.Fatal("valid payload did not reach the handler")
+			}
+		})
+	}
+}
+
+func TestSignalingDispatcherRejectsInvalidPayloads(t *testing.T) {
+	ht := newHandlerTest(t)
+	for typ, data := range map[signaling.MessageType]string{
+		signaling.MessageTypeTransferHost:    `{}`,
+		signaling.MessageTypeExtendTimeLimit: `{"extendSec":0}`,
+		signaling.MessageTypeSubscribe:       `{}`,
+		signaling.MessageTypeLockRoom:        `[]`,
+	} {
+		ht.s.dispatcher.route(ht.host, signaling.Message{Type: typ, Data: json.RawMessage(data)})
+		if code, _ := sentError(t, ht.host); code != 400 {
+			t.Errorf("%s: error %d, want 400", typ, code)
+		}
+	}
+	if len(ht.rooms.locks)+len(ht.sessions.audited) > 0 {
+		t.Fatal("an invalid payload reached a handler")
+	}
+}
+
+func TestLockRoomHandler(t *testing.T) {
+	ht := newHandlerTest(t)
+
+	ht.send(t, ht.guest, signaling.MessageTypeLockRoom, signaling.LockRoomMessage{Locked: true})
+	if code, _ := sentError(t, ht.guest); code != 403 {
+		t.Fatalf("guest: error %d, want 403", code)
+	}
+	ht.send(t, ht.host, signaling.MessageTypeLockRoom, signaling.LockRoomMessage{Locked: true})
+	if code, msg := sentError(t, ht.host); code != 0 {
+		t.Fatalf("host: error %d %s", code, msg)
+	}
+	if len(ht.rooms.locks) != 1 || !ht.rooms.locks[0] {
+		t.Fatalf("locks = %v, want one lock", ht.rooms.locks)
+	}
+	want := []string{auditRoomLock + ":" + audit.ResultDenied, auditRoomLock + ":" + audit.ResultSuccess}
+	if strings.Join(ht.sessions.audited, " ") != strings.Join(want, " ") {
+		t.Fatalf("audited %v, want %v", ht.sessions.audited, want)
+	}
+
+	outsider := signaling.NewClient("conn-x", "outsider", "x", nil, zap.NewNop())
+	ht.hub.SetRoom(outsider, ht.room.ID, "")
+	ht.send(t, outsider, signaling.MessageTypeLockRoom, signaling.LockRoomMessage{Locked: false})
+	if code, _ := sentError(t, outsider); code != 404 {
+		t.Fatalf("outsider: error %d, want 404", code)
+	}
+}
+
+func TestSpotlightHandler(t *testing.T) {
+	ht := newHandlerTest(t)
+
+	ht.send(t, ht.host, signaling.MessageTypeSpotlight, signaling.SpotlightMessage{PeerID: "no-such-peer"})
+	if code, _ := sentError(t, ht.host); code != 404 {
+		t.Fatalf("unknown peer: error %d, want 404", code)
+	}
+	ht.send(t, ht.host, signaling.MessageTypeSpotlight, signaling.SpotlightMessage{PeerID: ht.guestID})
+	if userID, _ := ht.room.Spotlight(); userID != "guest" {
+		t.Fatalf("spotlight = %q, want guest", userID)
+	}
+	ht.send(t, ht.guest, signaling.MessageTypeSpotlight, signaling.SpotlightMessage{})
+	if code, _ := sentError(t, ht.guest); code != 403 {
+		t.Fatalf("guest: error %d, want 403", code)
+	}
+}
+
+func TestTransferHostHandler(t *testing.T) {
+	ht := newHandlerTest(t)
+
+	ht.send(t, ht.guest, signaling.MessageTypeTransferHost, signaling.TransferHostMessage{PeerID: ht.guestID})
+	if code, _ := sentError(t, ht.guest); code != 403 {
+		t.Fatalf("guest: error %d, want 403", code)
+	}
+	ht.send(t, ht.host, signaling.MessageTypeTransferHost, signaling.TransferHostMessage{PeerID: ht.guestID})
+	if !ht.room.IsHost("guest") {
+		t.Fatal("host role not transferred")
+	}
+}
+
+func TestExtendTimeLimitHandler(t *testing.T) {
+	ht := newHandlerTest(t)
+
+	ht.send(t, ht.host, signaling.MessageTypeExtendTimeLimit, signaling.ExtendTimeLimitMessage{ExtendSec: 60})
+	if code, _ := sentError(t, ht.host); code != 409 {
+		t.Fatalf("no time limit: error %d, want 409", code)
+	}
+	ht.room.SetTimeLimit(time.Hour, nil)
+	ht.send(t, ht.host, signaling.MessageTypeExtendTimeLimit, signaling.ExtendTimeLimitMessage{ExtendSec: 60})
+	if len(ht.rooms.announced) != 1 || ht.rooms.announced[0] != signaling.TimeLimitExtended {
+		t.Fatalf("announced %v", ht.rooms.announced)
+	}
+}
+
+func TestUpdateNameHandler(t *testing.T) {
+	ht := newHandlerTest(t)
+
+	ht.send(t, ht.guest, signaling.MessageTypeUpdateName, signaling.UpdateNameMessage{Name: "   "})
+	if code, _ := sentError(t, ht.guest); code != 400 {
+		t.Fatalf("blank name: error %d, want 400", code)
+	}
+	ht.send(t, ht.guest, signaling.MessageTypeUpdateName, signaling.UpdateNameMessage{Name: "  Guest  "})
+	if len(ht.rooms.renames) != 1 || ht.rooms.renames[0] != "Guest" {
+		t.Fatalf("renames = %v, want the trimmed name", ht.rooms.renames)
+	}
+}
+
+func TestLeaveHandler(t *testing.T) {
+	ht := newHandlerTest(t)
+
+	unjoined := signaling.NewClient("conn-u", "unjoined", "u", nil, zap.NewNop())
+	ht.s.dispatcher.route(unjoined, signaling.Message{Type: signaling.MessageTypeLeave})
+	ht.s.dispatcher.route(ht.guest, signaling.Message{Type: signaling.MessageTypeLeave})
+	if len(ht.sessions.left) != 1 || ht.sessions.left[0] != "guest" {
+		t.Fatalf("left = %v, want only the joined client", ht.sessions.left)
+	}
+	if !ht.guest.Left() || unjoined.Left() {
+		t.Fatal("leave not recorded on the joined client only")
+	}
+}
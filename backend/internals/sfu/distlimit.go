@@ -0,0 +1,161 @@
+package sfu
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// The per-client limiters (see ratelimit.go) know nothing of other
+// connections or instances, so joins from rotating connections across the
+// cluster pass them all. Joins and room creations are therefore also
+// counted in Redis, by user and by client IP, through sliding windows every
+// instance shares. A key found over its limit is refused locally for a
+// moment, so an attack does not cost a Redis round trip per attempt.
+
+const (
+	distOpJoin       = "join"
+	distOpCreateRoom = "create-room"
+)
+
+// distNegativeCacheMax is how many refused keys are remembered before
+// expired ones are swept.
+const distNegativeCacheMax = 10000
+
+// distRefusals are the keys refused recently, with when to ask Redis again.
+type distRefusals struct {
+	until map[string]time.Time
+	mu    sync.Mutex
+}
+
+// distKey is one rate limit an attempt counts against.
+type distKey struct {
+	class string // "user" or "ip"
+	id    string
+	limit int
+}
+
+// allowDistributed counts an attempt at op against the shared limits of
+// userID and ip. If one is exceeded it returns false and how long until
+// attempts are accepted again.
+func (s *SFU) allowDistributed(op, userID, ip string) (bool, time.Duration) {
+	sm := s.stateManager.Load()
+	if sm == nil {
+		return true, 0
+	}
+	cfg := s.config.Media
+	var keys []distKey
+	switch op {
+	case distOpJoin:
+		keys = []distKey{{"user", userID, cfg.DistRateLimitJoinsPerUser}, {"ip", ip, cfg.DistRateLimitJoinsPerIP}}
+	case distOpCreateRoom:
+		keys = []distKey{{"ip", ip, cfg.DistRateLimitCreatesPerIP}}
+	}
+
+	now := time.Now()
+	for _, k := range keys {
+		if k.limit <= 0 || k.id == "" {
+			continue
+		}
+		key := op + ":" + k.class + ":" + k.id
+		if retryAfter := s.refusedFor(key, now); retryAfter > 0 {
+			appmetrics.RecordDistRateLimitRejection(op, k.class)
+			return false, retryAfter
+		}
+
+		ctx, cancel := s.messageContext()
+		ok, retryAfter, err := sm.HitRateLimit(ctx, key, k.limit, cfg.DistRateLimitWindow, now)
+		cancel()
+		if err != nil {
+			appmetrics.RecordDistRateLimitError(op)
+			s.logger.Debug("Distributed rate limit check failed",
+				zap.String("operation", op),
+				zap.Bool("failOpen", cfg.DistRateLimitFailOpen),
+				zap.Error(err),
+			)
+			if cfg.DistRateLimitFailOpen {
+				continue
+			}
+			return false, time.Second
+		}
+		if !ok {
+			s.refuse(key, now.Add(min(retryAfter, cfg.DistRateLimitNegativeCache)))
+			appmetrics.RecordDistRateLimitRejection(op, k.class)
+			return false, retryAfter
+		}
+	}
+	return true, 0
+}
+
+// refusedFor returns how much longer key is refused without asking Redis.
+func (s *SFU) refusedFor(key string, now time.Time) time.Duration {
+	s.distRefusals.mu.Lock()
+	defer s.distRefusals.mu.Unlock()
+	until, ok := s.distRefusals.until[key]
+	if !ok {
+		return 0
+	}
+	if !now.Before(until) {
+		delete(s.distRefusals.until, key)
+		return 0
+	}
+	return until.Sub(now)
+}
+
+// refuse remembers that key is refused until until.
+func (s *SFU) refuse(key string, until time.Time) {
+	s.distRefusals.mu.Lock()
+	defer s.distRefusals.mu.Unlock()
+	if len(s.distRefusals.until) >= distNegativeCacheMax {
+		now := time.Now()
+		for k, t := range s.distRefusals.until {
+			if !now.Before(t) {
+				delete(s.distRefusals.until, k)
+			}
+		}
+	}
+	s.distRefusals.until[key] = until
+}
+
+// limitDistributedJoins refuses joins over the shared per-user and per-IP
+// limits, ahead of the client's own rate limits.
+func (s *SFU) limitDistributedJoins(next messageHandler) messageHandler {
+	return func(client *signaling.Client, message signaling.Message) {
+		if message.Type != signaling.MessageTypeJoin {
+			next(client, message)
+			return
+		}
+		userID := client.UserID
+		var join joinRequest
+		if unmarshalMessageData(message.Data, &join) == nil && join.UserID != "" {
+			userID = join.UserID
+		}
+		if ok, retryAfter := s.allowDistributed(distOpJoin, userID, client.RemoteIP); !ok {
+			client.SendErrorMessage(signaling.ErrorMessage{
+				Code:         429,
+				Message:      "Too many join attempts",
+				Retryable:    true,
+				RetryAfterMs: max(retryAfter.Milliseconds(), 1),
+				Reason:       signaling.ErrorReasonRateLimited,
+			})
+			return
+		}
+		next(client, message)
+	}
+}
+
+// allowRoomCreation checks a POST /api/rooms against the shared per-IP
+// limit, answering 429 if it is exceeded.
+func (s *SFU) allowRoomCreation(w http.ResponseWriter, r *http.Request) bool {
+	ok, retryAfter := s.allowDistributed(distOpCreateRoom, "", s.requestIP(r))
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+		writeAPIError(w, http.StatusTooManyRequests, "Too many room creations")
+	}
+	return ok
+}
@@ -0,0 +1,167 @@
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// ErrDraining is returned when a room would be created while the instance is
+// draining.
+var ErrDraining = errors.New("instance is draining")
+
+// drainState is an announced shutdown. Rooms already hosted here keep
+// working until Deadline; no new rooms are created.
+type drainState struct {
+	Deadline     time.Time `json:"deadline"`
+	AlternateURL string    `json:"alternateUrl,omitempty"`
+	StartedAt    time.Time `json:"startedAt"`
+}
+
+// draining returns the current drain, or nil when the instance is not
+// draining.
+func (s *SFU) draining() *drainState {
+	return s.drain.Load()
+}
+
+// drainRequest is the optional body of POST /drain.
+type drainRequest struct {
+	DeadlineSeconds int    `json:"deadlineSeconds,omitempty"`
+	AlternateURL    string `json:"alternateUrl,omitempty"`
+}
+
+// handleDrain serves /drain. POST starts draining, or moves the deadline of
+// a drain already in progress, and tells every connected client; DELETE
+// cancels it; GET reports it.
+func (s *SFU) handleDrain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req drainRequest
+		if r.ContentLength != 0 {
+			if !s.decodeJSONBody(w, r, &req) {
+				return
+			}
+			if req.DeadlineSeconds < 0 {
+				writeAPIError(w, http.StatusBadRequest, "deadlineSeconds must not be negative")
+				return
+			}
+		}
+		s.startDrain(r, req)
+	case http.MethodDelete:
+		if s.drain.Swap(nil) != nil {
+			s.logger.Info("Drain cancelled")
+			s.auditRequest(r, auditServerDrain, "", audit.ResultSuccess, map[string]string{"cancelled": "true"})
+		}
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.drainStatus())
+}
+
+func (s *SFU) startDrain(r *http.Request, req drainRequest) {
+	timeout := s.config.Server.DrainTimeout
+	if req.DeadlineSeconds > 0 {
+		timeout = time.Duration(req.DeadlineSeconds) * time.Second
+	}
+	alternate := req.AlternateURL
+	if alternate == "" {
+		alternate = s.config.Server.DrainAlternateURL
+	}
+
+	now := time.Now()
+	d := &drainState{Deadline: now.Add(timeout), AlternateURL: alternate, StartedAt: now}
+	if prev := s.draining(); prev != nil {
+		d.StartedAt = prev.StartedAt
+	}
+	s.drain.Store(d)
+
+	msg, ok := drainingMessage(d)
+	if ok {
+		s.signalingHub.BroadcastMessage(msg)
+	}
+
+	s.logger.Warn("Draining instance",
+		zap.Time("deadline", d.Deadline),
+		zap.String("alternateURL", d.AlternateURL),
+	)
+	s.auditRequest(r, auditServerDrain, "", audit.ResultSuccess, map[string]string{
+		"deadline":     d.Deadline.Format(time.RFC3339),
+		"alternateUrl": d.AlternateURL,
+	})
+}
+
+// drainStatusResponse is the body of /drain and the drain section of
+// /health.
+type drainStatusResponse struct {
+	Draining bool `json:"draining"`
+	// Only while draining
+	*drainStatusDetail
+}
+
+type drainStatusDetail struct {
+	StartedAt    time.Time `json:"startedAt"`
+	Deadline     time.Time `json:"deadline"`
+	RemainingMs  int64     `json:"remainingMs"`
+	AlternateURL string    `json:"alternateUrl"`
+}
+
+// drainStatus is the drain section of /drain and /health.
+func (s *SFU) drainStatus() drainStatusResponse {
+	d := s.draining()
+	if d == nil {
+		return drainStatusResponse{}
+	}
+	return drainStatusResponse{Draining: true, drainStatusDetail: &drainStatusDetail{
+		StartedAt:    d.StartedAt,
+		Deadline:     d.Deadline,
+		RemainingMs:  max(time.Until(d.Deadline).Milliseconds(), 0),
+		AlternateURL: d.AlternateURL,
+	}}
+}
+
+// sendDraining tells a client that joined during a drain about it.
+func (s *SFU) sendDraining(client *signaling.Client) {
+	if d := s.draining(); d != nil {
+		if msg, ok := drainingMessage(d); ok {
+			client.SendMessage(msg)
+		}
+	}
+}
+
+func drainingMessage(d *drainState) (signaling.Message, bool) {
+	data, err := json.Marshal(signaling.DrainingMessage{Deadline: d.Deadline, AlternateURL: d.AlternateURL})
+	if err != nil {
+		return signaling.Message{}, false
+	}
+	return signaling.Message{Type: signaling.MessageTypeDraining, Data: data, Timestamp: time.Now()}, true
+}
+
+// drainingError describes a room creation refused during a drain. The same
+// body is sent over signaling and REST.
+func (s *SFU) drainingError() signaling.ErrorMessage {
+	body := signaling.ErrorMessage{
+		Code:      http.StatusServiceUnavailable,
+		Message:   "Server is draining and not creating rooms",
+		Retryable: true,
+		Reason:    signaling.ErrorReasonDraining,
+	}
+	if d := s.draining(); d != nil {
+		body.AlternateURL = d.AlternateURL
+	}
+	return body
+}
+
+// writeDrainingError answers a REST room creation refused during a drain.
+// There is no Retry-After: this instance will not take the room later.
+func (s *SFU) writeDrainingError(w http.ResponseWriter) {
+	writeSignalingError(w, s.drainingError())
+}
@@ -0,0 +1,161 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+const alternateURL = "wss://sfu-b.example.com/ws"
+
+// drainStatus is drainStatusResponse as clients read it.
+type drainStatus struct {
+	Draining     bool      `json:"draining"`
+	StartedAt    time.Time `json:"startedAt"`
+	Deadline     time.Time `json:"deadline"`
+	RemainingMs  int64     `json:"remainingMs"`
+	AlternateURL string    `json:"alternateUrl"`
+}
+
+// drainHealth fetches the drain section of /health.
+func (ts *testServer) drainHealth(t *testing.T) drainStatus {
+	t.Helper()
+	var health struct {
+		Drain drainStatus `json:"drain"`
+	}
+	if code := ts.api(t, http.MethodGet, "/health", "", "", &health); code != http.StatusOK {
+		t.Fatalf("GET /health: %d", code)
+	}
+	return health.Drain
+}
+
+func receiveDraining(t *testing.T, ch <-chan signaling.DrainingMessage, deadline time.Time) {
+	t.Helper()
+	select {
+	case m := <-ch:
+		if !m.Deadline.Equal(deadline) || m.AlternateURL != alternateURL {
+			t.Fatalf("draining %+v, want deadline %v on %s", m, deadline, alternateURL)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no draining message")
+	}
+}
+
+func TestDrainAnnounced(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	onDraining := func(ch chan signaling.DrainingMessage) client.Handlers {
+		return client.Handlers{OnDraining: func(m signaling.DrainingMessage) { ch <- m }}
+	}
+	inRoom := make(chan signaling.DrainingMessage, 4)
+	ts.join(t, "alice", "room-1", onDraining(inRoom), client.JoinOptions{})
+	// Connections that have not joined a room hear of it too
+	lobby := make(chan signaling.DrainingMessage, 4)
+	ts.connect(t, "bob", onDraining(lobby))
+	if d := ts.drainHealth(t); d != (drainStatus{}) {
+		t.Fatalf("drain in /health before draining: %+v", d)
+	}
+
+	var status drainStatus
+	body := `{"deadlineSeconds":60,"alternateUrl":"` + alternateURL + `"}`
+	if code := ts.api(t, http.MethodPost, "/drain", body, testAdminKey, &status); code != http.StatusOK {
+		t.Fatalf("POST /drain: %d", code)
+	}
+	if !status.Draining || time.Until(status.Deadline) < 59*time.Second || time.Until(status.Deadline) > time.Minute {
+		t.Fatalf("drain status %+v", status)
+	}
+	receiveDraining(t, inRoom, status.Deadline)
+	receiveDraining(t, lobby, status.Deadline)
+
+	health := ts.drainHealth(t)
+	if !health.Draining || !health.Deadline.Equal(status.Deadline) || health.AlternateURL != alternateURL || health.RemainingMs <= 0 {
+		t.Fatalf("drain in /health: %+v", health)
+	}
+	if code, body := ts.ready(t); code != http.StatusServiceUnavailable || body.Reason != signaling.ErrorReasonDraining {
+		t.Fatalf("ready while draining: %d %+v", code, body)
+	}
+
+	// A client joining a room hosted here is let in and told
+	late := make(chan signaling.DrainingMessage, 4)
+	ts.join(t, "carol", "room-1", onDraining(late), client.JoinOptions{})
+	receiveDraining(t, late, status.Deadline)
+
+	// Posting again moves the deadline of the same drain
+	var moved drainStatus
+	body = `{"deadlineSeconds":10,"alternateUrl":"` + alternateURL + `"}`
+	if code := ts.api(t, http.MethodPost, "/drain", body, testAdminKey, &moved); code != http.StatusOK {
+		t.Fatalf("POST /drain again: %d", code)
+	}
+	if !moved.StartedAt.Equal(status.StartedAt) || !moved.Deadline.Before(status.Deadline) {
+		t.Fatalf("drain moved to %+v from %+v", moved, status)
+	}
+	receiveDraining(t, inRoom, moved.Deadline)
+
+	if code := ts.api(t, http.MethodDelete, "/drain", "", testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("DELETE /drain: %d", code)
+	}
+	if d := ts.drainHealth(t); d.Draining {
+		t.Fatalf("drain in /health after cancelling: %+v", d)
+	}
+	if code, _ := ts.ready(t); code != http.StatusOK {
+		t.Fatalf("ready after cancelling: %d", code)
+	}
+}
+
+func TestDrainRefusesRoomCreation(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	if code := ts.api(t, http.MethodPost, "/drain", `{"alternateUrl":"`+alternateURL+`"}`, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("POST /drain: %d", code)
+	}
+
+	// Over REST
+	req, err := http.NewRequest(http.MethodPost, ts.http.URL+"/api/rooms", strings.NewReader(`{"id":"room-2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", testAdminKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var envelope struct {
+		Error struct {
+			Code    string       `json:"code"`
+			Details retryDetails `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "" ||
+		envelope.Error.Code != signaling.ErrorReasonDraining || envelope.Error.Details.AlternateURL != alternateURL {
+		t.Fatalf("POST room while draining: %d, Retry-After %q, %+v", resp.StatusCode, resp.Header.Get("Retry-After"), envelope.Error)
+	}
+
+	// By a join
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = ts.connect(t, "bob", client.Handlers{}).JoinRoom(ctx, "room-2", client.JoinOptions{})
+	var serverErr *client.ServerError
+	if !errors.As(err, &serverErr) {
+		t.Fatalf("join of a new room while draining: %v", err)
+	}
+	if e := serverErr.ErrorMessage; e.Code != http.StatusServiceUnavailable || e.Reason != signaling.ErrorReasonDraining || e.AlternateURL != alternateURL {
+		t.Fatalf("join of a new room while draining: %+v", e)
+	}
+	if ts.lookupRoom("room-2") != nil {
+		t.Fatal("room created while draining")
+	}
+
+	// The room hosted here still takes joins
+	ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{})
+}
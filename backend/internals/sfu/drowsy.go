@@ -0,0 +1,37 @@
+package sfu
+
+import (
+	"encoding/json"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// handleClientDrowsy tells the rooms of a connection, and of its
+// memberships, that its peers have gone drowsy or woken. The peers stay in
+// their rooms; a connection that does not wake is closed and goes through
+// the normal disconnect.
+func (s *SFU) handleClientDrowsy(client *signaling.Client, drowsy bool, disconnectIn time.Duration) {
+	appmetrics.RecordDrowsyClient(drowsy)
+	for _, c := range append([]*signaling.Client{client}, client.Memberships()...) {
+		rm, p := s.getRoomAndPeer(c.RoomID(), c.UserID)
+		if p == nil || p.ID != c.PeerID() || !announcesPeer(rm, p) {
+			continue
+		}
+		data, err := json.Marshal(signaling.PeerDrowsyMessage{
+			PeerID:         p.ID,
+			Drowsy:         drowsy,
+			DisconnectInMs: disconnectIn.Milliseconds(),
+		})
+		if err != nil {
+			s.logger.Error("Failed to marshal peer-drowsy", zap.Error(err))
+			continue
+		}
+		msg := signaling.Message{Type: signaling.MessageTypePeerDrowsy, Data: data, Timestamp: time.Now()}
+		s.broadcastToRoom(rm, msg, func(other *signaling.Client) bool {
+			return other.UserID != p.UserID
+		})
+	}
+}
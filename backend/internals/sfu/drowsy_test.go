@@ -0,0 +1,133 @@
+package sfu
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// keepTalking pings from sc until the test ends, so it never goes drowsy,
+// and passes on the peer-drowsy messages it receives.
+func keepTalking(t *testing.T, sc *scriptedClient) <-chan signaling.PeerDrowsyMessage {
+	drowsy := make(chan signaling.PeerDrowsyMessage, 16)
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if sc.ws.WriteJSON(signaling.Message{Type: signaling.MessageTypePing}) != nil {
+					return
+				}
+			}
+		}
+	}()
+	go func() {
+		for m := range sc.messages {
+			var msg signaling.PeerDrowsyMessage
+			if m.Type == signaling.MessageTypePeerDrowsy && json.Unmarshal(m.Data, &msg) == nil {
+				drowsy <- msg
+			}
+		}
+	}()
+	return drowsy
+}
+
+func expectPeerDrowsy(t *testing.T, drowsy <-chan signaling.PeerDrowsyMessage, peerID string, want bool) signaling.PeerDrowsyMessage {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-drowsy:
+			if msg.PeerID != peerID {
+				continue
+			}
+			if msg.Drowsy != want {
+				t.Fatalf("peer-drowsy %+v, want drowsy %v", msg, want)
+			}
+			return msg
+		case <-deadline:
+			t.Fatalf("no peer-drowsy %v for %s", want, peerID)
+		}
+	}
+}
+
+// A backgrounded tab goes silent for about 40 seconds, past the 35 second
+// threshold but within the grace, and comes back. Scaled down here.
+func TestDrowsyClientResumes(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.WSDrowsyAfter = 300 * time.Millisecond
+		cfg.Media.WSDrowsyGrace = 2 * time.Second
+	})
+	watcher := ts.joinScripted(t, "watcher", "room-1")
+	drowsy := keepTalking(t, watcher)
+	sleeper := ts.joinScripted(t, "sleeper", "room-1")
+	_, p := ts.getRoomAndPeer("room-1", "sleeper")
+
+	// Silent past the threshold, the sleeper's peer is announced drowsy and
+	// stays in the room
+	msg := expectPeerDrowsy(t, drowsy, p.ID, true)
+	if msg.DisconnectInMs <= 0 {
+		t.Fatalf("peer-drowsy %+v without the time left", msg)
+	}
+	var sleeperClient *signaling.Client
+	for _, c := range ts.signalingHub.GetClientsByRoom("room-1") {
+		if c.UserID == "sleeper" {
+			sleeperClient = c
+		}
+	}
+	if sleeperClient == nil || !sleeperClient.Drowsy() {
+		t.Fatal("the sleeper's connection is not drowsy")
+	}
+
+	// Meanwhile the room goes on: a peer joins, which is held for the
+	// sleeper, and the dominant speaker changes, which is discarded
+	drain(sleeper)
+	carol := ts.joinScripted(t, "carol", "room-1")
+	keepTalking(t, carol)
+	ts.handleDominantSpeakerChanged("room-1", "", p.ID)
+	time.Sleep(200 * time.Millisecond)
+	if held := drain(sleeper); len(held) != 0 {
+		t.Fatalf("%d messages sent to the drowsy sleeper", len(held))
+	}
+
+	// The next message wakes it: what was held comes first, and the room
+	// hears it is back
+	if err := sleeper.ws.WriteJSON(signaling.Message{Type: signaling.MessageTypePing}); err != nil {
+		t.Fatal(err)
+	}
+	var types []signaling.MessageType
+	for _, m := range sleeper.readUntil(t, signaling.MessageTypePong) {
+		types = append(types, m.Type)
+	}
+	if len(types) != 2 || types[0] != signaling.MessageTypePeerJoined {
+		t.Fatalf("woke to %v, want the held peer-joined then the pong", types)
+	}
+	expectPeerDrowsy(t, drowsy, p.ID, false)
+	if sleeperClient.Drowsy() {
+		t.Fatal("still drowsy after speaking")
+	}
+	if _, still := ts.getRoomAndPeer("room-1", "sleeper"); still != p {
+		t.Fatal("the sleeper's peer left the room")
+	}
+}
+
+// drain returns what sc has received so far.
+func drain(sc *scriptedClient) []signaling.Message {
+	var messages []signaling.Message
+	for {
+		select {
+		case m := <-sc.messages:
+			messages = append(messages, m)
+		default:
+			return messages
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// layerSwitchRequest is the payload of a layer-switch message.
+type layerSwitchRequest struct {
+	TrackID   string `json:"trackId"`
+	TargetRID string `json:"targetRid"`
+}
+
+func (s *SFU) handleLayerSwitchMessage(client *signaling.Client, message signaling.Message, msg layerSwitchRequest) {
+
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+
+	mt, ok := rm.ResolveTrackFor(msg.TrackID, p.ID)
+	if !ok {
+		client.SendError(404, "Track not found")
+		return
+	}
+	if mt.Handle != msg.TrackID && mt.GroupHandle() != msg.TrackID {
+		s.logger.Debug("Deprecated raw track ID used in layer-switch",
+			zap.String("trackRef", msg.TrackID),
+			zap.String("handle", mt.Handle),
+		)
+	}
+
+	if err := rm.SwitchLayer(mt.Handle, p.ID, msg.TargetRID); err != nil {
+		client.SendError(400, err.Error())
+		return
+	}
+	subKey := mt.Handle
+	if group := mt.GroupHandle(); group != "" {
+		subKey = group
+	}
+	s.subscriptionMgr.SetLayer(p.ID, subKey, msg.TargetRID)
+}
+
+func (s *SFU) handleRequestKeyframeMessage(client *signaling.Client, message signaling.Message, msg signaling.RequestKeyframeMessage) {
+
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+
+	ref := msg.TrackID
+	if mt, ok := rm.ResolveTrackFor(ref, p.ID); ok {
+		ref = mt.Handle
+	}
+	if err := rm.RequestKeyframe(ref, msg.FIR); err != nil {
+		if errors.Is(err, room.ErrKeyframeRateLimited) {
+			client.SendRetryableError(429, err.Error(), s.config.Media.KeyframeRequestInterval)
+			return
+		}
+		client.SendError(400, err.Error())
+		return
+	}
+}
+
+// handlePublishIntentMessage registers codec alternatives the client is about
+// to publish, so each subscriber receives only one of them, and tracks that
+// replace published ones.
+func (s *SFU) handlePublishIntentMessage(client *signaling.Client, message signaling.Message, msg signaling.PublishIntentMessage) {
+
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+
+	resp := signaling.PublishIntentResponse{Groups: make([]signaling.CodecGroupInfo, 0, len(msg.Alternatives))}
+	for _, trackIDs := range msg.Alternatives {
+		groupID, err := rm.DeclareCodecAlternatives(p, trackIDs)
+		if err != nil {
+			client.SendError(400, err.Error())
+			return
+		}
+		resp.Groups = append(resp.Groups, signaling.CodecGroupInfo{GroupID: groupID, TrackIDs: trackIDs})
+	}
+	for trackID, ref := range msg.Replaces {
+		handle, err := rm.DeclareReplacement(p, trackID, ref)
+		if err != nil {
+			client.SendError(400, err.Error())
+			return
+		}
+		if resp.Replaces == nil {
+			resp.Replaces = make(map[string]string, len(msg.Replaces))
+		}
+		resp.Replaces[trackID] = handle
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypePublishIntent, Data: data, Timestamp: time.Now(),
+	})
+}
+
+// bandwidthLimitRequest is the payload of a set-bandwidth-limit message.
+type bandwidthLimitRequest struct {
+	Bandwidth uint32 `json:"bandwidth"` // bits per second
+}
+
+// handleSetBandwidthLimitMessage sets the receiving bandwidth limit for a peer
+
+func (s *SFU) handleSetBandwidthLimitMessage(client *signaling.Client, message signaling.Message, msg bandwidthLimitRequest) {
+
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if p == nil {
+		client.SendError(404, "Peer not found")
+		return
+	}
+
+	p.SetBandwidthLimit(msg.Bandwidth)
+	if rm != nil {
+		for handle, rid := range rm.AllocateLayers(p.ID) {
+			s.subscriptionMgr.SetLayer(p.ID, handle, rid)
+		}
+	}
+
+	// Acknowledge the bandwidth limit
+	data, err := json.Marshal(signaling.BandwidthLimitAckMessage{
+		Success:   true,
+		Bandwidth: msg.Bandwidth,
+	})
+	if err != nil {
+		return
+	}
+
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypeSetBandwidthLimit, Data: data, Timestamp: time.Now(),
+	})
+}
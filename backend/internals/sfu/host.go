@@ -0,0 +1,127 @@
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// The room's host (see room/host.go) moderates like a moderator role, so
+// rooms without invites or an authorizer still have someone to anchor
+// moderation to. The host hands the role on with transfer-host; an admin
+// names any user with PATCH /api/rooms/{id}/host.
+
+// hostRequest is the body of PATCH /api/rooms/{id}/host.
+type hostRequest struct {
+	UserID string `json:"userId"`
+}
+
+// handleHostChanged announces a new host to the room and saves it with the
+// room's snapshot. It is called with the room locked.
+func (s *SFU) handleHostChanged(rm *room.Room, change room.HostChange) {
+	data, err := json.Marshal(signaling.HostChangedMessage{
+		HostUserID:     change.UserID,
+		HostPeerID:     change.PeerID,
+		PreviousUserID: change.Previous,
+		Reason:         change.Reason,
+	})
+	if err != nil {
+		s.logger.Error("Failed to marshal host change", zap.Error(err))
+		return
+	}
+	msg := signaling.Message{Type: signaling.MessageTypeHostChanged, Data: data, Timestamp: time.Now()}
+	s.broadcastToRoom(rm, msg, nil)
+	go s.saveRoomSnapshot(s.ctx, rm)
+}
+
+// sendHostChanged tells client the room's current host, who took over from
+// previous for reason.
+func (s *SFU) sendHostChanged(client *signaling.Client, rm *room.Room, previous, reason string) {
+	data, err := json.Marshal(signaling.HostChangedMessage{
+		HostUserID:     rm.Host(),
+		HostPeerID:     rm.HostPeerID(),
+		PreviousUserID: previous,
+		Reason:         reason,
+	})
+	if err != nil {
+		s.logger.Error("Failed to marshal host change", zap.Error(err))
+		return
+	}
+	client.SendMessage(signaling.Message{Type: signaling.MessageTypeHostChanged, Data: data, Timestamp: time.Now()})
+}
+
+// handleTransferHostMessage lets the host hand the role to another
+// participant.
+func (s *SFU) handleTransferHostMessage(client *signaling.Client, message signaling.Message, req signaling.TransferHostMessage) {
+	rm, p := s.roomService.RoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+	if !rm.IsHost(p.UserID) {
+		s.sessionService.Audit(client, auditRoomHost, req.PeerID, audit.ResultDenied, nil)
+		client.SendError(403, "Only the host can transfer the host role")
+		return
+	}
+	target, ok := rm.GetPeer(req.PeerID)
+	if !ok {
+		client.SendError(404, "Peer not found")
+		return
+	}
+	if _, err := rm.SetHost(target.UserID, room.HostChangeTransfer); err != nil {
+		client.SendError(400, err.Error())
+		return
+	}
+	s.sessionService.Audit(client, auditRoomHost, target.ID, audit.ResultSuccess, map[string]string{"host": target.UserID})
+}
+
+// handleRoomHostAPI serves /api/rooms/{id}/host: GET returns the host and
+// PATCH names a new one, who need not be in the room.
+func (s *SFU) handleRoomHostAPI(w http.ResponseWriter, r *http.Request, roomID string) {
+	s.roomsMu.RLock()
+	rm, exists := s.rooms[roomID]
+	s.roomsMu.RUnlock()
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		var req hostRequest
+		if !s.decodeJSONBody(w, r, &req) {
+			return
+		}
+		if err := s.validateID(req.UserID, s.config.Media.MaxUserIDLength, "userId"); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		previous := rm.Host()
+		if _, err := rm.SetHost(req.UserID, room.HostChangeTransfer); err != nil {
+			s.auditRequest(r, auditRoomHost, roomID, audit.ResultFailure, map[string]string{"reason": err.Error()})
+			status := http.StatusInternalServerError
+			if errors.Is(err, room.ErrCannotHost) {
+				status = http.StatusBadRequest
+			}
+			writeAPIError(w, status, err.Error())
+			return
+		}
+		s.auditRequest(r, auditRoomHost, roomID, audit.ResultSuccess, map[string]string{
+			"host":     req.UserID,
+			"previous": previous,
+		})
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPatch)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(signaling.HostChangedMessage{HostUserID: rm.Host(), HostPeerID: rm.HostPeerID()})
+}
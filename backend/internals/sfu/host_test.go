@@ -0,0 +1,122 @@
+package sfu
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+// hostAnnouncements collects the host-changed messages a session receives.
+type hostAnnouncements chan signaling.HostChangedMessage
+
+func (ch hostAnnouncements) next(t *testing.T) signaling.HostChangedMessage {
+	t.Helper()
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no host-changed")
+	}
+	return signaling.HostChangedMessage{}
+}
+
+func TestRoomHost(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	aliceHosts, bobHosts := make(hostAnnouncements, 10), make(hostAnnouncements, 10)
+	errs := make(chan int, 10)
+	states := make(chan signaling.RoomStateMessage, 2)
+	expectState := func(who, peerID string) {
+		t.Helper()
+		select {
+		case state := <-states:
+			if state.HostUserID != "alice" || state.HostPeerID != peerID {
+				t.Fatalf("%s's room-state names host %q, %q", who, state.HostUserID, state.HostPeerID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no room-state")
+		}
+	}
+
+	// The first participant becomes host and learns it from room-state and
+	// a host-changed of her own
+	alice := ts.join(t, "alice", "room-1", client.Handlers{
+		OnHostChanged: func(m signaling.HostChangedMessage) { aliceHosts <- m },
+		OnRoomState:   func(m signaling.RoomStateMessage) { states <- m },
+	}, client.JoinOptions{})
+	expectState("alice", alice.PeerID())
+	if m := aliceHosts.next(t); m.HostUserID != "alice" || m.HostPeerID != alice.PeerID() || m.Reason != "first-join" {
+		t.Fatalf("alice's join announced as %+v", m)
+	}
+	bob := ts.join(t, "bob", "room-1", client.Handlers{
+		OnHostChanged: func(m signaling.HostChangedMessage) { bobHosts <- m },
+		OnRoomState:   func(m signaling.RoomStateMessage) { states <- m },
+		OnError:       func(err *client.ServerError) { errs <- err.Code },
+	}, client.JoinOptions{})
+	expectState("bob", alice.PeerID())
+
+	// Only the host hands the role on
+	if err := bob.TransferHost(bob.PeerID()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case code := <-errs:
+		if code != http.StatusForbidden {
+			t.Fatalf("transfer by bob: %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("transfer by bob not refused")
+	}
+	if err := alice.TransferHost(bob.PeerID()); err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range []hostAnnouncements{aliceHosts, bobHosts} {
+		if m := ch.next(t); m.HostUserID != "bob" || m.PreviousUserID != "alice" || m.Reason != "transfer" {
+			t.Fatalf("transfer announced as %+v", m)
+		}
+	}
+
+	// The host moderates without a role
+	if err := bob.SetPeerMic(alice.PeerID(), false); err != nil {
+		t.Fatal(err)
+	}
+	_, p := ts.getRoomAndPeer("room-1", "alice")
+	eventually(t, "bob to mute alice", func() bool { return !p.GetMediaState().MicEnabled })
+
+	// Admins name any user, present or not
+	if code := ts.api(t, http.MethodPatch, "/api/rooms/room-1/host", `{"userId":""}`, testAdminKey, nil); code != http.StatusBadRequest {
+		t.Fatalf("PATCH without a user: %d", code)
+	}
+	var host signaling.HostChangedMessage
+	if code := ts.api(t, http.MethodPatch, "/api/rooms/room-1/host", `{"userId":"carol"}`, testAdminKey, &host); code != http.StatusOK {
+		t.Fatalf("PATCH host: %d", code)
+	}
+	if host.HostUserID != "carol" || host.HostPeerID != "" {
+		t.Fatalf("PATCH returned %+v", host)
+	}
+	if m := aliceHosts.next(t); m.HostUserID != "carol" || m.HostPeerID != "" {
+		t.Fatalf("alice told %+v", m)
+	}
+	rm := ts.lookupRoom("room-1")
+	if stats := rm.GetStats(); stats.HostUserID != "carol" {
+		t.Fatalf("stats name host %q", stats.HostUserID)
+	}
+
+	// Back with alice, her leaving hands the role to bob
+	if code := ts.api(t, http.MethodPatch, "/api/rooms/room-1/host", `{"userId":"alice"}`, testAdminKey, &host); code != http.StatusOK {
+		t.Fatalf("PATCH host: %d", code)
+	}
+	bobHosts.next(t)
+	bobHosts.next(t)
+	if err := alice.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	if m := bobHosts.next(t); m.HostUserID != "bob" || m.HostPeerID != bob.PeerID() || m.Reason != "host-left" {
+		t.Fatalf("bob told %+v", m)
+	}
+	if code := ts.api(t, http.MethodGet, "/api/rooms/room-1/host", "", testAdminKey, &host); code != http.StatusOK || host.HostUserID != "bob" {
+		t.Fatalf("GET host: %d, %+v", code, host)
+	}
+}
@@ -0,0 +1,75 @@
+package sfu
+
+import (
+	"errors"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// iceRestartBudget returns the configured limits on a peer's ICE restarts.
+func (s *SFU) iceRestartBudget() peer.ICERestartBudget {
+	return peer.ICERestartBudget{
+		MaxRestarts: s.config.Media.ICERestartMax,
+		Window:      s.config.Media.ICERestartWindow,
+		Cooldown:    s.config.Media.ICERestartCooldown,
+		MaxCooldown: s.config.Media.ICERestartMaxCooldown,
+	}
+}
+
+// refuseICERestart answers a restart p's budget refused. During the
+// cooldown the client is told when to ask again. Once the budget is
+// exhausted the peer is removed and the client's session suspended, as when
+// its connection drops, and the client is told to join again with a new
+// PeerConnection.
+func (s *SFU) refuseICERestart(client *signaling.Client, rm *room.Room, p *peer.Peer, initiator string, retryAfter time.Duration, err error) {
+	if !errors.Is(err, peer.ErrICERestartBudgetExhausted) {
+		client.SendErrorMessage(signaling.ErrorMessage{
+			Code:         429,
+			Message:      "ICE restart cooling down",
+			Retryable:    true,
+			RetryAfterMs: max(retryAfter.Milliseconds(), 1),
+			Reason:       signaling.ErrorReasonICERestartCooldown,
+		})
+		return
+	}
+
+	appmetrics.RecordICERestartAttempt(initiator, "budget-exhausted")
+	state := p.ICERestarts()
+	s.logger.Warn("ICE restart budget exhausted, removing peer",
+		zap.String("roomID", rm.ID),
+		zap.String("peerID", p.ID),
+		zap.String("initiator", initiator),
+		zap.Int("recentRestarts", state.Recent),
+	)
+	client.SendErrorMessage(signaling.ErrorMessage{
+		Code:      503,
+		Message:   "Connection could not be recovered, join again",
+		Retryable: true,
+		Reason:    signaling.ErrorReasonReconnectRequired,
+	})
+
+	rm.RemovePeerIfCurrent(p)
+	if client.RoomID() == rm.ID {
+		s.leaveRoom(client)
+		s.pruneMembership(client)
+	}
+}
+
+// handleICERestartEnded counts how an ICE restart ended.
+func (s *SFU) handleICERestartEnded(p *peer.Peer, initiator string, recovered bool) {
+	outcome := "failed"
+	if recovered {
+		outcome = "recovered"
+	}
+	appmetrics.RecordICERestartAttempt(initiator, outcome)
+	s.logger.Debug("ICE restart ended",
+		zap.String("peerID", p.ID),
+		zap.String("initiator", initiator),
+		zap.String("outcome", outcome),
+	)
+}
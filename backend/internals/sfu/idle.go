@@ -0,0 +1,123 @@
+package sfu
+
+import (
+	"encoding/json"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// maxIdleCheckInterval bounds how late an idle peer can be noticed.
+const maxIdleCheckInterval = 30 * time.Second
+
+// idlePeerLoop periodically warns and then disconnects peers that media is
+// forwarded to but that show no sign of consuming it.
+func (s *SFU) idlePeerLoop() {
+	timeout := s.config.Media.IdlePeerTimeout
+	if timeout <= 0 {
+		return
+	}
+	interval := timeout / 4
+	if interval > maxIdleCheckInterval {
+		interval = maxIdleCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.checkIdlePeers(now)
+		}
+	}
+}
+
+// checkIdlePeers warns peers that have just become idle and reaps those that
+// have stayed idle past the grace.
+func (s *SFU) checkIdlePeers(now time.Time) {
+	s.roomsMu.RLock()
+	rooms := make(map[string]*room.Room, len(s.rooms))
+	for id, rm := range s.rooms {
+		rooms[id] = rm
+	}
+	s.roomsMu.RUnlock()
+
+	for roomID, rm := range rooms {
+		clients := make(map[string]*signaling.Client)
+		for _, client := range s.signalingHub.GetClientsByRoom(roomID) {
+			clients[client.UserID] = client
+		}
+		for _, p := range rm.GetAllPeers() {
+			s.checkIdlePeer(now, rm, p, clients[p.UserID])
+		}
+	}
+}
+
+func (s *SFU) checkIdlePeer(now time.Time, rm *room.Room, p *peer.Peer, client *signaling.Client) {
+	var lastSignal time.Time
+	if client != nil {
+		lastSignal = client.LastActivity()
+	}
+
+	// A dropped connection is handled by the disconnect grace instead, as is
+	// a peer kept for a reattach once its signaling closed, which a reap
+	// leads to
+	if !p.IsConnected() || s.isDetached(p.ID) || !p.Idle(now, lastSignal, s.config.Media.IdlePeerTimeout) {
+		if p.ClearIdle() {
+			s.logger.Info("Idle peer active again", zap.String("peerID", p.ID), zap.String("userID", p.UserID))
+		}
+		return
+	}
+
+	since, newly := p.MarkIdle(now)
+	grace := s.config.Media.IdlePeerGrace
+	if newly {
+		s.logger.Warn("Peer idle",
+			zap.String("peerID", p.ID),
+			zap.String("userID", p.UserID),
+			zap.String("roomID", p.RoomID),
+			zap.Duration("grace", grace),
+		)
+		if client != nil {
+			s.sendIdleWarning(client, p, grace)
+		}
+	}
+	if now.Sub(since) < grace {
+		return
+	}
+
+	s.logger.Warn("Disconnecting idle peer",
+		zap.String("peerID", p.ID),
+		zap.String("userID", p.UserID),
+		zap.String("roomID", p.RoomID),
+		zap.Duration("idleFor", now.Sub(since)),
+	)
+	appmetrics.IdlePeersReapedTotal.Inc()
+
+	// Closing the WebSocket, or the membership, runs the normal disconnect,
+	// which suspends the session and removes the peer
+	if client != nil {
+		client.Close()
+		return
+	}
+	rm.RemovePeerIfCurrent(p)
+}
+
+func (s *SFU) sendIdleWarning(client *signaling.Client, p *peer.Peer, grace time.Duration) {
+	data, err := json.Marshal(signaling.IdleWarningMessage{
+		PeerID:         p.ID,
+		DisconnectInMs: grace.Milliseconds(),
+	})
+	if err != nil {
+		return
+	}
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypeIdleWarning, Data: data, Timestamp: time.Now(),
+	})
+}
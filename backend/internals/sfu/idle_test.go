@@ -0,0 +1,108 @@
+package sfu
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// silentAPI builds peer connections without interceptors, so they send no
+// RTCP receiver reports, like a player that is gone.
+func silentAPI(t *testing.T) *webrtc.API {
+	t.Helper()
+	me := &webrtc.MediaEngine{}
+	if err := me.RegisterDefaultCodecs(); err != nil {
+		t.Fatal(err)
+	}
+	return webrtc.NewAPI(webrtc.WithMediaEngine(me))
+}
+
+func TestIdlePeerReaped(t *testing.T) {
+	const (
+		timeout = 2 * time.Second // above the one-second report interval
+		grace   = time.Second
+	)
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.IdlePeerTimeout = timeout
+		cfg.Media.IdlePeerGrace = grace
+		cfg.Media.PeerDisconnectGrace = grace
+	})
+	reaped := testutil.ToFloat64(appmetrics.IdlePeersReapedTotal)
+
+	warnings := make(chan signaling.IdleWarningMessage, 8)
+	onWarning := func(m signaling.IdleWarningMessage) { warnings <- m }
+	dave := ts.join(t, "dave", "room-1", client.Handlers{OnIdleWarning: onWarning}, client.JoinOptions{})
+	publish(t, dave, "dave")
+
+	// Alice sends no reports either, but she publishes
+	alice := ts.join(t, "alice", "room-1", client.Handlers{OnIdleWarning: onWarning}, client.JoinOptions{
+		API: silentAPI(t), OnTrack: newTrackCounter().onTrack,
+	})
+	publish(t, alice, "alice")
+
+	// Carol watches; bob's player is gone
+	ts.join(t, "carol", "room-1", client.Handlers{OnIdleWarning: onWarning}, client.JoinOptions{
+		OnTrack: newTrackCounter().onTrack,
+	})
+	disconnected := make(chan struct{})
+	received := newTrackCounter()
+	bob := ts.join(t, "bob", "room-1", client.Handlers{
+		OnIdleWarning:  onWarning,
+		OnDisconnected: func(error) { close(disconnected) },
+	}, client.JoinOptions{API: silentAPI(t), OnTrack: received.onTrack})
+	eventually(t, "bob to receive the tracks", func() bool {
+		return received.receiving(dave.PeerID()) && received.receiving(alice.PeerID())
+	})
+
+	select {
+	case m := <-warnings:
+		if m.PeerID != bob.PeerID() || m.DisconnectInMs != grace.Milliseconds() {
+			t.Fatalf("idle-warning %+v, want bob's", m)
+		}
+	case <-time.After(2 * timeout):
+		t.Fatal("bob was not warned")
+	}
+	var peers struct {
+		Peers []roomPeerInfo `json:"peers"`
+	}
+	if code := ts.api(t, http.MethodGet, "/api/rooms/room-1/peers", "", testAdminKey, &peers); code != http.StatusOK {
+		t.Fatalf("GET peers: %d", code)
+	}
+	for _, p := range peers.Peers {
+		if idle := p.IdleSince != nil; idle != (p.PeerID == bob.PeerID()) {
+			t.Fatalf("%s listed with idleSince %v", p.UserID, p.IdleSince)
+		}
+	}
+
+	select {
+	case <-disconnected:
+	case <-time.After(2 * grace):
+		t.Fatal("bob was not disconnected")
+	}
+	// His peer is kept for the disconnect grace, then removed
+	eventually(t, "bob to leave the room", func() bool {
+		_, ok := ts.lookupRoom("room-1").GetPeer(bob.PeerID())
+		return !ok
+	})
+	sess, err := ts.sessionManager.Load().GetSession(context.Background(), bob.Info().SessionID)
+	if err != nil || sess == nil || !sess.Suspended {
+		t.Fatalf("bob's session after the reap: %+v, %v", sess, err)
+	}
+
+	select {
+	case m := <-warnings:
+		t.Fatalf("idle-warning %+v after bob's", m)
+	case <-time.After(timeout):
+	}
+	if got := testutil.ToFloat64(appmetrics.IdlePeersReapedTotal) - reaped; got != 1 {
+		t.Fatalf("%v reaps counted", got)
+	}
+}
@@ -0,0 +1,227 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"go.uber.org/zap"
+)
+
+// handleInvitesAPI serves /api/rooms/{id}/invites[/{token}].
+func (s *SFU) handleInvitesAPI(w http.ResponseWriter, r *http.Request, roomID, token string) {
+	if s.stateManager.Load() == nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "Invites require Redis")
+		return
+	}
+	if err := s.validateID(roomID, s.config.Media.MaxRoomIDLength, "roomId"); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch {
+	case token == "" && r.Method == http.MethodGet:
+		s.listInvites(w, r, roomID)
+	case token == "" && r.Method == http.MethodPost:
+		s.createInvite(w, r, roomID)
+	case token != "" && r.Method == http.MethodDelete:
+		s.revokeInvite(w, r, roomID, token)
+	case token == "":
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	default:
+		writeMethodNotAllowed(w, http.MethodDelete)
+	}
+}
+
+// createInviteRequest is the body of POST /api/rooms/{id}/invites.
+type createInviteRequest struct {
+	SingleUse  bool   `json:"singleUse"`
+	TTLSeconds int    `json:"ttlSeconds,omitempty"`
+	Role       string `json:"role,omitempty"`
+	Name       string `json:"name,omitempty"`
+	// The participant may only use TURN relay candidates
+	RelayOnly bool `json:"relayOnly,omitempty"`
+	// The participant may publish for this long after the invite is first
+	// redeemed, then is downgraded to a viewer
+	PublishForSec int `json:"publishForSec,omitempty"`
+}
+
+// inviteResponse is an invite as the REST API returns it.
+type inviteResponse struct {
+	Token     string `json:"token"`
+	RoomID    string `json:"roomId"`
+	SingleUse bool   `json:"singleUse"`
+	Role      string `json:"role,omitempty"`
+	Name      string `json:"name,omitempty"`
+	RelayOnly bool   `json:"relayOnly,omitempty"`
+	// The participant may publish for this long after joining
+	PublishForSec int       `json:"publishForSec,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	// Only with Server.LegacyFieldNames
+	*legacyInviteFields
+}
+
+// legacyInviteFields are the names invites had before schema version 2.
+type legacyInviteFields struct {
+	RoomID        string    `json:"room_id"`
+	SingleUse     bool      `json:"single_use"`
+	RelayOnly     bool      `json:"relay_only,omitempty"`
+	PublishForSec int       `json:"publish_for_sec,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// invitesResponse is the body of GET /api/rooms/{id}/invites.
+type invitesResponse struct {
+	Invites []inviteResponse `json:"invites"`
+	Total   int              `json:"total"`
+}
+
+// inviteResponse returns invite as the REST API presents it.
+func (s *SFU) inviteResponse(invite *state.InviteData) inviteResponse {
+	resp := inviteResponse{
+		Token:         invite.Token,
+		RoomID:        invite.RoomID,
+		SingleUse:     invite.SingleUse,
+		Role:          invite.Role,
+		Name:          invite.Name,
+		RelayOnly:     invite.RelayOnly,
+		PublishForSec: invite.PublishForSec,
+		CreatedAt:     invite.CreatedAt,
+		ExpiresAt:     invite.ExpiresAt,
+	}
+	if s.config.Server.LegacyFieldNames {
+		resp.legacyInviteFields = &legacyInviteFields{
+			RoomID:        invite.RoomID,
+			SingleUse:     invite.SingleUse,
+			RelayOnly:     invite.RelayOnly,
+			PublishForSec: invite.PublishForSec,
+			CreatedAt:     invite.CreatedAt,
+			ExpiresAt:     invite.ExpiresAt,
+		}
+	}
+	return resp
+}
+
+func (s *SFU) createInvite(w http.ResponseWriter, r *http.Request, roomID string) {
+	var req createInviteRequest
+	if !s.decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	ttl := s.config.Media.InviteDefaultTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if maxTTL := s.config.Media.InviteMaxTTL; maxTTL > 0 && ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	if req.PublishForSec < 0 {
+		writeAPIError(w, http.StatusBadRequest, "publishForSec must not be negative")
+		return
+	}
+	publishFor := time.Duration(req.PublishForSec) * time.Second
+
+	invite, err := s.stateManager.Load().CreateInvite(r.Context(), roomID, ttl, req.SingleUse, req.Role, req.Name, req.RelayOnly, publishFor)
+	if err != nil {
+		s.auditRequest(r, auditInviteCreate, roomID, audit.ResultFailure, nil)
+		writeAPIError(w, http.StatusInternalServerError, "Failed to create invite")
+		return
+	}
+	appmetrics.RecordInvite("created")
+	s.auditRequest(r, auditInviteCreate, roomID, audit.ResultSuccess, map[string]string{
+		"singleUse":  strconv.FormatBool(invite.SingleUse),
+		"role":       invite.Role,
+		"ttl":        ttl.String(),
+		"relayOnly":  strconv.FormatBool(invite.RelayOnly),
+		"publishFor": publishFor.String(),
+	})
+
+	s.logger.Info("Invite created",
+		zap.String("roomID", roomID),
+		zap.Bool("singleUse", invite.SingleUse),
+		zap.String("role", invite.Role),
+		zap.Duration("ttl", ttl),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", s.publicURL(r, "/api/rooms/"+roomID+"/invites/"+invite.Token, false))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s.inviteResponse(invite))
+}
+
+func (s *SFU) listInvites(w http.ResponseWriter, r *http.Request, roomID string) {
+	invites, err := s.stateManager.Load().ListInvites(r.Context(), roomID)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "Failed to list invites")
+		return
+	}
+
+	resp := invitesResponse{Invites: make([]inviteResponse, 0, len(invites)), Total: len(invites)}
+	for _, invite := range invites {
+		resp.Invites = append(resp.Invites, s.inviteResponse(invite))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *SFU) revokeInvite(w http.ResponseWriter, r *http.Request, roomID, token string) {
+	// Only a prefix of the token is recorded so the audit log cannot be used
+	// to redeem invites.
+	detail := map[string]string{"token": token[:min(len(token), 8)]}
+
+	revoked, err := s.stateManager.Load().RevokeInvite(r.Context(), roomID, token)
+	if err != nil {
+		s.auditRequest(r, auditInviteRevoke, roomID, audit.ResultFailure, detail)
+		writeAPIError(w, http.StatusInternalServerError, "Failed to revoke invite")
+		return
+	}
+	if !revoked {
+		detail["reason"] = "not_found"
+		s.auditRequest(r, auditInviteRevoke, roomID, audit.ResultFailure, detail)
+		writeAPIError(w, http.StatusNotFound, "Invite not found")
+		return
+	}
+	appmetrics.RecordInvite("revoked")
+	s.auditRequest(r, auditInviteRevoke, roomID, audit.ResultSuccess, detail)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// redeemInvite consumes an invite presented on join. Single-use invites are
+// deleted atomically, so only one of several racing joins can redeem one.
+func (s *SFU) redeemInvite(ctx context.Context, token, roomID string) (*state.InviteData, error) {
+	if s.stateManager.Load() == nil {
+		return nil, state.ErrInviteInvalid
+	}
+
+	invite, err := s.stateManager.Load().ConsumeInvite(ctx, token, roomID)
+	if err != nil {
+		appmetrics.RecordInvite("rejected")
+		return nil, err
+	}
+	appmetrics.RecordInvite("consumed")
+	return invite, nil
+}
+
+// returnInvite puts back a single-use invite redeemed by a join that was
+// turned away, so the participant can try again with it.
+func (s *SFU) returnInvite(invite *state.InviteData) {
+	sm := s.stateManager.Load()
+	if sm == nil || !invite.SingleUse {
+		return
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Second)
+	defer cancel()
+	if err := sm.RestoreInvite(ctx, invite); err != nil {
+		s.logger.Warn("Failed to return invite", zap.String("roomID", invite.RoomID), zap.Error(err))
+		return
+	}
+	appmetrics.RecordInvite("returned")
+}
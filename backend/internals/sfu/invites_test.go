@@ -0,0 +1,121 @@
+package sfu
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/authz"
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"github.com/alicebob/miniredis/v2"
+	"go.uber.org/zap"
+)
+
+// newInviteTest returns an SFU keeping its invites in a miniredis, with
+// adminKey guarding the admin routes.
+func newInviteTest(t *testing.T, adminKey string) *SFU {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	sm, err := state.NewManager(mr.Addr(), "", 0, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sm.Close() })
+	s := &SFU{
+		config: &config.Config{
+			Server: config.ServerConfig{AdminKey: adminKey},
+			Media:  config.MediaConfig{MaxRoomIDLength: 64, InviteDefaultTTL: time.Hour},
+		},
+		logger: zap.NewNop(),
+	}
+	s.stateManager.Store(sm)
+	return s
+}
+
+// roomAPI sends a request with body to handleRoomAPI, with key as the
+// X-API-Key when set.
+func roomAPI(s *SFU, method, path, body, key string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		r.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	s.handleRoomAPI(w, r)
+	return w
+}
+
+func TestInvitesRequireAdminKey(t *testing.T) {
+	s := newInviteTest(t, "admin-key")
+
+	for _, tc := range []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/api/rooms/room-1/invites", `{"role":"admin"}`},
+		{http.MethodGet, "/api/rooms/room-1/invites", ""},
+		{http.MethodDelete, "/api/rooms/room-1/invites/token", ""},
+	} {
+		for _, key := range []string{"", "wrong"} {
+			if w := roomAPI(s, tc.method, tc.path, tc.body, key); w.Code != http.StatusUnauthorized {
+				t.Fatalf("%s %s with key %q: status %d, want 401", tc.method, tc.path, key, w.Code)
+			}
+		}
+	}
+	if invites, err := s.stateManager.Load().ListInvites(context.Background(), "room-1"); err != nil || len(invites) != 0 {
+		t.Fatalf("invites created without the key: %v, %v", invites, err)
+	}
+
+	w := roomAPI(s, http.MethodPost, "/api/rooms/room-1/invites", `{"role":"admin"}`, "admin-key")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create with the key: status %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestRejectedJoinLeavesInviteUsable(t *testing.T) {
+	s := newInviteTest(t, "")
+	s.ctx = context.Background()
+	s.authorizer = authz.AllowAll{}
+	s.config.Media.MaxUserIDLength = 64
+	s.joinQueue = newJoinQueue(1, 0, 10)
+	locked := room.NewRoom("locked", 10, zap.NewNop())
+	locked.SetLock(&room.RoomLock{By: "host"})
+	s.rooms = map[string]*room.Room{locked.ID: locked}
+	sm := s.stateManager.Load()
+
+	for _, tc := range []struct {
+		name     string
+		roomID   string
+		relay    bool
+		wantCode int
+	}{
+		{"room locked", locked.ID, false, 403},
+		{"no relay for a relay-only invite", "room-1", true, 503},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			invite, err := sm.CreateInvite(context.Background(), tc.roomID, time.Hour, true, "", "", tc.relay, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := signaling.NewClient("c1", "alice", "Alice", nil, zap.NewNop())
+			s.handleJoinMessage(client, signaling.Message{Type: signaling.MessageTypeJoin}, joinRequest{
+				JoinMessage: signaling.JoinMessage{RoomID: tc.roomID, UserID: "alice", InviteToken: invite.Token},
+			})
+
+			errs := rejections(t, client)
+			if len(errs) != 1 || errs[0].Code != tc.wantCode {
+				t.Fatalf("errors %+v, want one %d", errs, tc.wantCode)
+			}
+			if _, err := sm.ConsumeInvite(context.Background(), invite.Token, tc.roomID); err != nil {
+				t.Fatalf("invite not usable after the join was turned away: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,602 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/authz"
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/session"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// joinRequest is the payload of a join message. A session ID and token
+// resume a suspended session instead of starting a new one.
+type joinRequest struct {
+	signaling.JoinMessage
+	SessionID    string `json:"sessionId,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+func (s *SFU) handleJoinMessage(client *signaling.Client, message signaling.Message, joinMsg joinRequest) {
+
+	if err := s.validateID(joinMsg.RoomID, s.config.Media.MaxRoomIDLength, "roomId"); err != nil {
+		client.SendError(400, err.Error())
+		return
+	}
+	if err := s.validateID(joinMsg.UserID, s.config.Media.MaxUserIDLength, "userId"); err != nil {
+		client.SendError(400, err.Error())
+		return
+	}
+
+	// Wait for a join slot so bursts of joins don't saturate the instance.
+	// No SFU-wide locks are held while queued.
+	release, ok := s.acquireJoinSlot(client, joinMsg.RoomID)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// The deadline starts once the join has a slot, so time spent queued
+	// does not count against it.
+	ctx, cancel := s.messageContext()
+	defer cancel()
+
+	// A room hosted elsewhere, or to be created in another region, is
+	// joined there (see region.go)
+	if target := s.routeRoom(ctx, joinMsg.RoomID, joinMsg.PreferredRegion); target != nil {
+		s.logger.Info("Redirecting join to another instance",
+			zap.String("roomID", joinMsg.RoomID),
+			zap.String("instanceID", target.InstanceID),
+			zap.String("region", target.Region),
+		)
+		client.SendErrorMessage(redirectError(target, 307))
+		return
+	}
+
+	// A valid invite binds the participant's role and, optionally, name.
+	// A one-time invite is taken now, so racing joins can't both use it,
+	// and put back if this join is turned away below.
+	var invite *state.InviteData
+	admitted := false
+	if joinMsg.InviteToken != "" {
+		var err error
+		invite, err = s.redeemInvite(ctx, joinMsg.InviteToken, joinMsg.RoomID)
+		if err != nil {
+			s.logger.Debug("Invite rejected", zap.String("roomID", joinMsg.RoomID), zap.Error(err))
+			client.SendError(403, "Invalid or expired invite")
+			return
+		}
+		defer func() {
+			if !admitted {
+				s.returnInvite(invite)
+			}
+		}()
+		if invite.Name != "" {
+			joinMsg.Name = invite.Name
+		}
+	}
+
+	// Try to resume existing session. Only a session of this user in this
+	// room resumes: what it carries, such as getting past a lock or an
+	// observer grant, must not travel to another room with a stolen token.
+	var sess *session.Session
+	var resumed bool
+	if s.sessionManager.Load() != nil && joinMsg.SessionID != "" && joinMsg.SessionToken != "" {
+		var err error
+		sess, err = s.sessionManager.Load().ResumeSession(ctx, joinMsg.SessionID, joinMsg.SessionToken, joinMsg.RoomID, joinMsg.UserID)
+		if err != nil {
+			s.logger.Debug("Session resume failed", zap.Error(err))
+			appmetrics.RecordSessionRecovery(false)
+		} else {
+			resumed = true
+			appmetrics.RecordSessionRecovery(true)
+			s.logger.Info("Session resumed",
+				zap.String("sessionID", sess.ID),
+				zap.String("userID", sess.UserID),
+			)
+			if joinMsg.Name == "" {
+				joinMsg.Name = sess.Name // keep a name changed during the call
+			}
+		}
+	}
+
+	// A locked room only takes back users who are already part of it
+	if rm := s.lookupRoom(joinMsg.RoomID); rm != nil && rm.IsLocked() && !s.mayJoinLocked(rm, joinMsg.UserID, resumed) {
+		appmetrics.RecordAdmissionRejection("join", signaling.ErrorReasonRoomLocked)
+		client.SendErrorMessage(signaling.ErrorMessage{
+			Code: 403, Message: "Room is locked", Reason: signaling.ErrorReasonRoomLocked,
+		})
+		return
+	}
+
+	// The authorizer has the last word on the join, and the role it grants
+	// replaces the invite's.
+	role := ""
+	if invite != nil {
+		role = invite.Role
+	}
+	decision, ok := s.authorizeJoin(ctx, client, authz.JoinRequest{
+		RoomID:   joinMsg.RoomID,
+		UserID:   joinMsg.UserID,
+		Name:     joinMsg.Name,
+		Token:    client.Token,
+		Role:     role,
+		Observer: joinMsg.Observer,
+		Resumed:  resumed,
+		Metadata: joinMsg.Metadata,
+	})
+	if !ok {
+		return
+	}
+	if decision.Role != "" {
+		role = decision.Role
+	}
+
+	// Hidden observers need an invite or authorizer role that grants it; a
+	// resumed session, which is always this user's in this room, keeps the
+	// grant.
+	observer := joinMsg.Observer || role == roleObserver
+	if observer && !canObserve(role) && !(resumed && sess.Observer) {
+		client.SendError(403, "Observer access requires an observer or admin invite")
+		return
+	}
+
+	// A client that kept its PeerConnection takes over the peer the SFU
+	// kept for it.
+	if resumed && joinMsg.Reattach && s.reattachPeer(client, sess, joinMsg.JoinMessage) {
+		admitted = true
+		return
+	}
+
+	// Relay-only is required by the invite or authorizer, or kept by a
+	// resumed session of this room; the client can only ask for it, never
+	// drop it.
+	relayOnly := joinMsg.RelayOnly || (invite != nil && invite.RelayOnly) || decision.RelayOnly || (resumed && sess.RelayOnly)
+	if relayOnly && !s.relayAvailable() {
+		client.SendErrorMessage(signaling.ErrorMessage{
+			Code:    503,
+			Message: "Relay-only peers need a TURN server and none is configured",
+			Reason:  signaling.ErrorReasonRelayUnavailable,
+		})
+		return
+	}
+
+	// Create new session if not resumed
+	if sess == nil && s.sessionManager.Load() != nil {
+		var err error
+		sess, err = s.sessionManager.Load().CreateSession(ctx, joinMsg.UserID, joinMsg.RoomID, joinMsg.Name)
+		if err != nil {
+			s.logger.Error("Failed to create session", zap.Error(err))
+		}
+		appmetrics.ActiveSessions.Inc()
+	}
+
+	rm, err := s.getOrCreateRoom(ctx, joinMsg.RoomID)
+	if errors.Is(err, ErrMaxRoomsReached) {
+		s.sendCapacityError(ctx, client, joinMsg.RoomID)
+		return
+	}
+	if errors.Is(err, ErrDraining) {
+		client.SendErrorMessage(s.drainingError())
+		return
+	}
+	var redirect *roomRedirectError
+	if errors.As(err, &redirect) {
+		client.SendErrorMessage(redirectError(redirect.target, 307))
+		return
+	}
+	var elsewhere *roomElsewhereError
+	if errors.As(err, &elsewhere) {
+		client.SendErrorMessage(s.roomElsewhereBody(elsewhere))
+		return
+	}
+	if rm == nil {
+		client.SendError(500, "Failed to create room")
+		return
+	}
+	s.subscribeRoomChannel(rm.ID)
+
+	// Observers and broadcast viewers never publish, so they don't count
+	// toward track projection.
+	viewer := !observer && rm.IsBroadcast() && !canPublish(role)
+	if !observer && !viewer {
+		if reason := s.admitJoin(rm, joinMsg.UserID); reason != "" {
+			appmetrics.RecordAdmissionRejection("join", reason)
+			client.SendError(503, "Room is at media track capacity")
+			return
+		}
+	}
+
+	// Evict old peer if same userId is already in the room (page refresh),
+	// unless the new one takes over its stable ID
+	peerID := s.stablePeerID(rm, joinMsg.UserID, sess)
+	oldPeer, hadPeer := rm.GetPeerByUserID(joinMsg.UserID)
+	replacing := hadPeer && peerID != "" && oldPeer.ID == peerID
+	if hadPeer {
+		s.takeDetachedPeer(oldPeer.ID)
+	}
+	if replacing {
+		// Closing the old connection must not take the peer's ID with it
+		s.signalingHub.DetachPeer(oldPeer.ID, client.ID)
+	} else if hadPeer {
+		s.logger.Info("Evicting stale peer for reconnecting user",
+			zap.String("userID", joinMsg.UserID),
+			zap.String("oldPeerID", oldPeer.ID),
+		)
+		rm.EvictPeer(oldPeer.ID)
+	}
+
+	// Evict old WS clients for this userId (stale connections from refresh)
+	s.signalingHub.DisconnectClientsByUserID(joinMsg.UserID, client.ID)
+
+	var p *peer.Peer
+	if peerID != "" {
+		p = peer.NewPeerWithID(peerID, joinMsg.RoomID, joinMsg.UserID, joinMsg.Name, s.logger)
+	} else {
+		p = peer.NewPeer(joinMsg.RoomID, joinMsg.UserID, joinMsg.Name, s.logger)
+	}
+	p.Observer = observer
+	p.ManualSubscribe = !s.subscriptionMgr.IsAutoSubscribe()
+	if joinMsg.AutoSubscribe != nil {
+		p.ManualSubscribe = !*joinMsg.AutoSubscribe
+	}
+	if joinMsg.NoTrickle {
+		p.DisableTrickle()
+	}
+	if err := p.CreatePeerConnection(s.webrtcAPI, s.peerConfiguration(relayOnly)); err != nil {
+		s.logger.Error("Failed to create peer connection", zap.Error(err))
+		client.SendError(500, "Failed to create peer connection")
+		return
+	}
+
+	p.OnICECandidateGenerated = s.handleServerICECandidate
+	p.OnTrackStalled = s.handleTrackStalled
+	p.OnICERestartEnded = s.handleICERestartEnded
+	p.SetICERestartBudget(s.iceRestartBudget())
+
+	// A publishing window that ended while the session was away makes the
+	// participant a viewer from the start
+	var publishUntil time.Time
+	if !observer && !viewer {
+		publishUntil = publishDeadline(invite, decision, sess)
+	}
+	if !publishUntil.IsZero() && !time.Now().Before(publishUntil) {
+		p.RevokePublish()
+		role = roleViewer
+	}
+	if role != "" {
+		p.SetMetadata("role", role)
+	}
+	p.MaxTracks = decision.MaxTracks
+	p.AuthToken = client.Token
+	p.Viewer = viewer
+	p.Resumed = resumed
+	s.applyEntryMediaState(ctx, rm, p, sess, resumed)
+
+	previousHost := rm.Host()
+	if replacing {
+		p.Reconnected = true
+		err = rm.ReplacePeer(oldPeer, p)
+	}
+	// Unless the old peer left in the meantime
+	if !replacing || errors.Is(err, room.ErrPeerNotFound) {
+		p.Reconnected = false
+		err = rm.AddPeer(p)
+	}
+	if err != nil {
+		s.logger.Error("Failed to add peer to room", zap.Error(err))
+		p.Close()
+		client.SendError(400, err.Error())
+		return
+	}
+	admitted = true
+
+	if !publishUntil.IsZero() {
+		p.SetPublishDeadline(publishUntil, func() { s.expirePublishWindow(rm, p) })
+	}
+
+	if decision.Host {
+		if _, err := rm.SetHost(joinMsg.UserID, room.HostChangeGranted); err != nil {
+			s.logger.Debug("Host grant ignored", zap.String("userID", joinMsg.UserID), zap.Error(err))
+		}
+	}
+
+	go s.publishRoomSummary(s.ctx, joinMsg.RoomID, rm)
+
+	// Link session to peer
+	var restored []string
+	if sess != nil {
+		s.sessionManager.Load().UpdatePeerID(ctx, sess.ID, p.ID)
+		// Talk time carries over a reconnect that outlived the room
+		if sess.TalkTime > 0 {
+			rm.RestoreTalkTime(joinMsg.UserID, sess.TalkTime)
+		}
+		if observer && !sess.Observer {
+			s.sessionManager.Load().SetObserver(ctx, sess.ID, true)
+		}
+		if relayOnly && !sess.RelayOnly {
+			s.sessionManager.Load().SetRelayOnly(ctx, sess.ID, true)
+		}
+		if !publishUntil.IsZero() && !publishUntil.Equal(sess.PublishUntil) {
+			s.sessionManager.Load().SetPublishUntil(ctx, sess.ID, publishUntil)
+		}
+		s.restoreReceivePreferences(ctx, rm, p, sess, resumed)
+		restored = s.restoreSubscriptions(ctx, rm, p, sess, resumed)
+	}
+
+	s.signalingHub.SetRoom(client, joinMsg.RoomID, p.ID)
+	client.SetLeft(false)
+	s.releaseUnjoined(client.ID)
+	// The hub reads the user ID of a connection it is registering, so it is
+	// only written when the join changes it
+	if client.UserID != joinMsg.UserID {
+		client.UserID = joinMsg.UserID
+	}
+	client.Name = joinMsg.Name
+
+	s.metrics.TotalConnections.Inc()
+	s.updateMetrics()
+
+	// Build response with session info
+	responseData := s.joinResponse(client, rm, p, sess, resumed)
+	responseData.Subscriptions = restored
+	if invite != nil {
+		responseData.Name = joinMsg.Name
+	}
+
+	data, err := json.Marshal(responseData)
+	if err != nil {
+		client.SendError(500, "Internal server error")
+		return
+	}
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypeJoin, Data: data, Timestamp: time.Now(),
+	})
+
+	appmetrics.JoinLatencyMs.Observe(float64(time.Since(message.Timestamp).Milliseconds()))
+
+	s.logger.Info("Peer joined",
+		zap.String("room", joinMsg.RoomID),
+		zap.String("peer", p.ID),
+		zap.String("name", joinMsg.Name),
+		zap.Bool("resumed", resumed),
+		zap.Bool("observer", observer),
+		zap.Bool("relayOnly", relayOnly),
+	)
+
+	// Send room state to the new peer
+	s.sendRoomState(client, rm, p.ID)
+	// The room announced a host change made by this join before the
+	// connection was in it
+	if rm.IsHost(joinMsg.UserID) && previousHost != joinMsg.UserID {
+		reason := room.HostChangeFirstJoin
+		if decision.Host {
+			reason = room.HostChangeGranted
+		}
+		s.sendHostChanged(client, rm, previousHost, reason)
+	}
+	s.sendDraining(client)
+	s.updateP2P(rm)
+}
+
+// joinResponse builds the join reply for p, with sess's credentials if the
+// participant has a session.
+func (s *SFU) joinResponse(client *signaling.Client, rm *room.Room, p *peer.Peer, sess *session.Session, resumed bool) signaling.JoinResponse {
+	resp := signaling.JoinResponse{
+		Success:         true,
+		PeerID:          p.ID,
+		RoomID:          rm.ID,
+		Resumed:         resumed,
+		Observer:        p.Observer,
+		Viewer:          p.Viewer,
+		ManualSubscribe: p.ManualSubscribe,
+		MicMuted:        p.MicMuted(),
+		Role:            peerRole(p),
+		MembershipID:    client.MembershipID(),
+		ICEServers:      s.withTURNCredentials(s.clientICEServers(), p.UserID),
+		WSURL:           client.WSURL,
+		APIURL:          client.APIURL,
+		Region:          rm.Region,
+		SchemaVersion:   signaling.SchemaVersion,
+	}
+	if p.ICETransportPolicy() == webrtc.ICETransportPolicyRelay {
+		resp.ICETransportPolicy = webrtc.ICETransportPolicyRelay.String()
+	}
+	if deadline := p.PublishDeadline(); !deadline.IsZero() {
+		resp.PublishUntil = &deadline
+	}
+	if sess != nil {
+		resp.SessionID = sess.ID
+		resp.SessionToken = sess.Token
+	}
+	return resp
+}
+
+// acquireJoinSlot waits in the join queue, keeping the client informed of its
+// position. It returns false after reporting the failure to the client, and
+// gives up quietly if the client goes away meanwhile.
+func (s *SFU) acquireJoinSlot(client *signaling.Client, roomID string) (func(), bool) {
+	ctx := s.joinContext(client)
+	if timeout := s.config.Media.JoinQueueTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	release, err := s.joinQueue.Acquire(ctx, roomID, func(position int) {
+		data, err := json.Marshal(signaling.JoinQueuedMessage{
+			RoomID:   roomID,
+			Position: position,
+		})
+		if err != nil {
+			return
+		}
+		client.SendMessage(signaling.Message{
+			Type: signaling.MessageTypeJoinQueued, Data: data, Timestamp: time.Now(),
+		})
+	})
+	if err == nil {
+		return release, true
+	}
+
+	retryAfter := s.config.Media.JoinRetryAfter
+	switch err {
+	case ErrJoinQueueFull:
+		appmetrics.RecordAdmissionRejection("join", "queue_full")
+		client.SendRetryableError(503, "Server busy, retry later", retryAfter)
+	case ErrJoinQueueDrained:
+		client.SendError(410, "Room closed")
+	case context.Canceled:
+		// The connection closed or the SFU is stopping
+	default:
+		appmetrics.RecordAdmissionRejection("join", "queue_timeout")
+		client.SendRetryableError(503, "Timed out waiting to join", retryAfter)
+	}
+	return nil, false
+}
+
+func (s *SFU) sendRoomState(client *signaling.Client, rm *room.Room, excludePeerID string) {
+	allPeers := rm.GetAllPeers()
+	peerList := make([]signaling.PeerInfo, 0, len(allPeers))
+	viewers := 0
+	for _, p := range allPeers {
+		if p.Viewer {
+			viewers++
+		}
+		if p.ID == excludePeerID || !announcesPeer(rm, p) {
+			continue
+		}
+		info := signaling.PeerInfo{
+			PeerID:   p.ID,
+			UserID:   p.UserID,
+			Name:     p.GetName(),
+			MicMuted: p.MicMuted(),
+			Role:     peerRole(p),
+		}
+		if change, ok := rm.PeerConnectionState(p.ID); ok {
+			info.ConnectionState = change.State
+			info.ConnectionStateMs = time.Since(change.Since).Milliseconds()
+		}
+		peerList = append(peerList, info)
+	}
+
+	state := signaling.RoomStateMessage{
+		Peers:      peerList,
+		Tracks:     rm.GetTrackList(),
+		HostUserID: rm.Host(),
+		HostPeerID: rm.HostPeerID(),
+	}
+	if m := rm.GetMuteAll(); m != nil {
+		muteAll := muteAllMessage(m, nil)
+		state.MuteAll = &muteAll
+	}
+	state.SpotlightUserID, state.SpotlightPeerID = rm.Spotlight()
+	state.Locked = rm.IsLocked()
+	// Only a reattached peer has anything forwarded yet
+	if p, ok := rm.GetPeer(excludePeerID); ok && p.HasNegotiated() {
+		state.Subscriptions = rm.SubscriptionSnapshot(p)
+	}
+	if rm.IsBroadcast() && !rm.AnnouncesViewers() {
+		state.Viewers = viewers
+	}
+	if limit, ok := rm.GetTimeLimit(); ok {
+		state.EndsAt = &limit.Deadline
+		state.TimeRemainingMs = limit.Remaining().Milliseconds()
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypeRoomState, Data: data, Timestamp: time.Now(),
+	})
+}
+
+// handleLeaveMessage ends the client's session for good: unlike a dropped
+// connection, an explicit leave cannot be resumed. A client closing its
+// socket right after sending leave is handled in that order, because both
+// run on its ReadPump, so the disconnect finds the room already left.
+func (s *SFU) handleLeaveMessage(client *signaling.Client) {
+	if client.RoomID() == "" {
+		return
+	}
+	client.SetLeft(true)
+	s.sessionService.Leave(client)
+}
+
+func (s *SFU) handleClientDisconnect(client *signaling.Client) {
+	// Closing Send ends the client's WritePump.
+	defer s.signalingHub.UnregisterClient(client)
+	s.endJoin(client.ID)
+	s.releaseUnjoined(client.ID)
+
+	// The connection's memberships are suspended along with it
+	for _, m := range client.Memberships() {
+		if m.EndMembership() {
+			s.handleClientDisconnect(m)
+		}
+	}
+
+	if client.RoomID() != "" {
+		s.leaveRoom(client)
+	}
+	s.removeClientRateLimiter(client.ID)
+}
+
+// leaveRoom takes the client out of its room. After an explicit leave its
+// session is deleted and its peer removed; otherwise the session is
+// suspended for a resume, and the peer kept for the grace to reattach.
+func (s *SFU) leaveRoom(client *signaling.Client) {
+	left := client.Left()
+	ended := false
+	// The session is found by the local index rather than the room's set in
+	// Redis, which the session's first write may not have reached yet when
+	// a client drops right after joining
+	if sm := s.sessionManager.Load(); sm != nil {
+		ctx, cancel := s.messageContext()
+		defer cancel()
+		sess, err := sm.GetSession(ctx, sm.UserSessionID(client.UserID, client.RoomID()))
+		if err == nil && sess != nil && !sess.Suspended {
+			if left {
+				sm.DeleteSession(ctx, sess.ID)
+				appmetrics.ActiveSessions.Dec()
+			} else {
+				if rm, _ := s.getRoomAndPeer(client.RoomID(), client.UserID); rm != nil {
+					sm.SetTalkTime(sess.ID, rm.TalkTime(client.UserID))
+				}
+				sm.SuspendSession(ctx, sess.ID)
+				appmetrics.ActiveSessions.Dec()
+				appmetrics.SuspendedSessions.Inc()
+			}
+			ended = true
+		}
+	}
+
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	// A stale connection closed by its user rejoining must not take the new
+	// peer with it
+	if p != nil && client.PeerID() != "" && p.ID != client.PeerID() {
+		p = nil
+	}
+	switch {
+	case p == nil:
+	case left:
+		p.SetLeaveReason(signaling.PeerLeftReasonLeft)
+		rm.RemovePeer(p.ID)
+	case ended && p.ID == client.PeerID() && s.config.Media.PeerDisconnectGrace > 0:
+		// A suspended session can reattach to its peer, so keep it for the grace
+		s.detachPeer(rm, p)
+	default:
+		rm.RemovePeer(p.ID)
+	}
+
+	s.signalingHub.SetRoom(client, "", "")
+}
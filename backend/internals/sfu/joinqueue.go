@@ -0,0 +1,207 @@
+package sfu
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrJoinQueueFull is returned when the join queue is at capacity; the
+	// client should retry after a backoff.
+	ErrJoinQueueFull = errors.New("join queue is full")
+	// ErrJoinQueueDrained is returned to queued joins whose room was closed.
+	ErrJoinQueueDrained = errors.New("room closed while join was queued")
+)
+
+// joinTicket is one join waiting for admission.
+type joinTicket struct {
+	roomID   string
+	ready    chan struct{}
+	err      error
+	elem     *list.Element
+	onQueued func(position int)
+}
+
+// joinQueue bounds how many joins run at once, globally and per room, so a
+// burst of joins (e.g. a webinar starting) is processed a few at a time
+// instead of saturating the instance. Waiting joins are admitted in FIFO
+// order, skipping over joins whose room is at its own limit so one busy room
+// cannot stall the rest.
+type joinQueue struct {
+	mu          sync.Mutex
+	globalLimit int // 0 = unlimited
+	roomLimit   int // 0 = unlimited
+	maxQueued   int
+
+	active     int
+	roomActive map[string]int
+	waiting    *list.List // of *joinTicket
+
+	onDepthChanged func(depth int)
+}
+
+func newJoinQueue(globalLimit, roomLimit, maxQueued int) *joinQueue {
+	return &joinQueue{
+		globalLimit: globalLimit,
+		roomLimit:   roomLimit,
+		maxQueued:   maxQueued,
+		roomActive:  make(map[string]int),
+		waiting:     list.New(),
+	}
+}
+
+// hasCapacity reports whether a join for roomID may start now.
+// MUST be called with q.mu held.
+func (q *joinQueue) hasCapacity(roomID string) bool {
+	if q.globalLimit > 0 && q.active >= q.globalLimit {
+		return false
+	}
+	if q.roomLimit > 0 && q.roomActive[roomID] >= q.roomLimit {
+		return false
+	}
+	return true
+}
+
+// admit marks a join as running. MUST be called with q.mu held.
+func (q *joinQueue) admit(roomID string) {
+	q.active++
+	q.roomActive[roomID]++
+}
+
+// Acquire blocks until the join may run and returns a release function that
+// MUST be called when the join finishes. onQueued is invoked with the 1-based
+// queue position whenever the join is queued or moves up.
+func (q *joinQueue) Acquire(ctx context.Context, roomID string, onQueued func(position int)) (func(), error) {
+	q.mu.Lock()
+	if q.waiting.Len() == 0 && q.hasCapacity(roomID) {
+		q.admit(roomID)
+		q.mu.Unlock()
+		return q.releaseFunc(roomID), nil
+	}
+	if q.waiting.Len() >= q.maxQueued {
+		q.mu.Unlock()
+		return nil, ErrJoinQueueFull
+	}
+
+	t := &joinTicket{
+		roomID:   roomID,
+		ready:    make(chan struct{}),
+		onQueued: onQueued,
+	}
+	t.elem = q.waiting.PushBack(t)
+	position := q.waiting.Len()
+	q.depthChanged()
+	// Joins ahead may be blocked only by their room's limit
+	q.dispatch()
+	queued := t.elem != nil
+	q.mu.Unlock()
+
+	if queued && onQueued != nil {
+		onQueued(position)
+	}
+
+	select {
+	case <-t.ready:
+		if t.err != nil {
+			return nil, t.err
+		}
+		return q.releaseFunc(roomID), nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		if t.elem != nil {
+			q.waiting.Remove(t.elem)
+			t.elem = nil
+			q.depthChanged()
+			q.mu.Unlock()
+			return nil, ctx.Err()
+		}
+		q.mu.Unlock()
+		// Admitted concurrently with cancellation; give the slot back.
+		if t.err == nil {
+			q.releaseFunc(roomID)()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (q *joinQueue) releaseFunc(roomID string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			q.active--
+			if q.roomActive[roomID]--; q.roomActive[roomID] <= 0 {
+				delete(q.roomActive, roomID)
+			}
+			q.dispatch()
+			q.mu.Unlock()
+		})
+	}
+}
+
+// dispatch admits waiting joins in order while capacity allows and tells the
+// rest their new position. MUST be called with q.mu held.
+func (q *joinQueue) dispatch() {
+	admitted := false
+	position := 0
+	for e := q.waiting.Front(); e != nil; {
+		next := e.Next()
+		t := e.Value.(*joinTicket)
+		if q.hasCapacity(t.roomID) {
+			q.waiting.Remove(e)
+			t.elem = nil
+			q.admit(t.roomID)
+			close(t.ready)
+			admitted = true
+		} else {
+			position++
+			if admitted && t.onQueued != nil {
+				t.onQueued(position)
+			}
+		}
+		e = next
+	}
+	if admitted {
+		q.depthChanged()
+	}
+}
+
+// DrainRoom fails every queued join for roomID, e.g. when the room closes.
+func (q *joinQueue) DrainRoom(roomID string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	drained := 0
+	for e := q.waiting.Front(); e != nil; {
+		next := e.Next()
+		t := e.Value.(*joinTicket)
+		if t.roomID == roomID {
+			q.waiting.Remove(e)
+			t.elem = nil
+			t.err = ErrJoinQueueDrained
+			close(t.ready)
+			drained++
+		}
+		e = next
+	}
+	if drained > 0 {
+		q.depthChanged()
+	}
+	return drained
+}
+
+// Depth returns the number of queued joins.
+func (q *joinQueue) Depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiting.Len()
+}
+
+// depthChanged reports the queue depth. MUST be called with q.mu held.
+func (q *joinQueue) depthChanged() {
+	if q.onDepthChanged != nil {
+		q.onDepthChanged(q.waiting.Len())
+	}
+}
@@ -0,0 +1,241 @@
+package sfu
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+)
+
+// queuedJoin is a join waiting in a joinQueue from its own goroutine.
+type queuedJoin struct {
+	done      chan struct{}
+	release   func()
+	err       error
+	mu        sync.Mutex
+	positions []int
+}
+
+// enqueue starts a join for roomID and waits until it is queued, so joins
+// enqueued one after another are queued in that order.
+func enqueue(t *testing.T, ctx context.Context, q *joinQueue, roomID string) *queuedJoin {
+	t.Helper()
+	depth := q.Depth()
+	j := &queuedJoin{done: make(chan struct{})}
+	go func() {
+		defer close(j.done)
+		j.release, j.err = q.Acquire(ctx, roomID, func(position int) {
+			j.mu.Lock()
+			j.positions = append(j.positions, position)
+			j.mu.Unlock()
+		})
+	}()
+	deadline := time.Now().Add(time.Second)
+	for q.Depth() == depth {
+		select {
+		case <-j.done:
+			t.Fatalf("join for %s was not queued: %v", roomID, j.err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("join for %s was not queued", roomID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return j
+}
+
+// admitted reports whether j has finished waiting.
+func (j *queuedJoin) admitted() bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait waits for j to finish waiting and returns its error.
+func (j *queuedJoin) wait(t *testing.T) error {
+	t.Helper()
+	select {
+	case <-j.done:
+		return j.err
+	case <-time.After(time.Second):
+		t.Fatal("join still queued")
+		return nil
+	}
+}
+
+func mustAcquire(t *testing.T, q *joinQueue, roomID string) func() {
+	t.Helper()
+	release, err := q.Acquire(context.Background(), roomID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return release
+}
+
+func TestJoinQueueFIFO(t *testing.T) {
+	q := newJoinQueue(1, 0, 10)
+	release := mustAcquire(t, q, "a")
+
+	joins := []*queuedJoin{
+		enqueue(t, context.Background(), q, "a"),
+		enqueue(t, context.Background(), q, "b"),
+		enqueue(t, context.Background(), q, "c"),
+	}
+	for i, j := range joins {
+		if j.admitted() {
+			t.Fatalf("join %d admitted over the limit", i)
+		}
+	}
+
+	for i, j := range joins {
+		release()
+		if err := j.wait(t); err != nil {
+			t.Fatal(err)
+		}
+		for _, later := range joins[i+1:] {
+			if later.admitted() {
+				t.Fatalf("a join behind join %d was admitted first", i)
+			}
+		}
+		release = j.release
+	}
+	release()
+
+	// Each moved up as the joins ahead were admitted
+	joins[2].mu.Lock()
+	defer joins[2].mu.Unlock()
+	if got, want := joins[2].positions, []int{3, 2, 1}; !slices.Equal(got, want) {
+		t.Fatalf("positions of the last join %v, want %v", got, want)
+	}
+}
+
+func TestJoinQueueSkipsBusyRoom(t *testing.T) {
+	q := newJoinQueue(2, 1, 10)
+	releaseA := mustAcquire(t, q, "a")
+
+	// The second join for a waits for its room; the join for b behind it
+	// takes the free global slot
+	waiting := enqueue(t, context.Background(), q, "a")
+	releaseB := mustAcquire(t, q, "b")
+	if waiting.admitted() {
+		t.Fatal("join admitted over the room limit")
+	}
+
+	releaseB()
+	if waiting.admitted() {
+		t.Fatal("join admitted when another room's join finished")
+	}
+	releaseA()
+	if err := waiting.wait(t); err != nil {
+		t.Fatal(err)
+	}
+	waiting.release()
+	if q.active != 0 || len(q.roomActive) != 0 {
+		t.Fatalf("active %d, by room %v after every release", q.active, q.roomActive)
+	}
+}
+
+func TestJoinQueueFull(t *testing.T) {
+	q := newJoinQueue(1, 0, 1)
+	release := mustAcquire(t, q, "a")
+	queued := enqueue(t, context.Background(), q, "a")
+
+	if _, err := q.Acquire(context.Background(), "b", nil); !errors.Is(err, ErrJoinQueueFull) {
+		t.Fatalf("err = %v, want %v", err, ErrJoinQueueFull)
+	}
+	release()
+	if err := queued.wait(t); err != nil {
+		t.Fatal(err)
+	}
+	queued.release()
+}
+
+func TestJoinQueueDrainRoom(t *testing.T) {
+	q := newJoinQueue(1, 0, 10)
+	release := mustAcquire(t, q, "a")
+	drainedFirst := enqueue(t, context.Background(), q, "closing")
+	other := enqueue(t, context.Background(), q, "b")
+	drainedLast := enqueue(t, context.Background(), q, "closing")
+
+	if n := q.DrainRoom("closing"); n != 2 {
+		t.Fatalf("drained %d joins, want 2", n)
+	}
+	for _, j := range []*queuedJoin{drainedFirst, drainedLast} {
+		if err := j.wait(t); !errors.Is(err, ErrJoinQueueDrained) {
+			t.Fatalf("err = %v, want %v", err, ErrJoinQueueDrained)
+		}
+	}
+	if q.Depth() != 1 || other.admitted() {
+		t.Fatalf("depth %d, other room's join admitted %v; want it still queued", q.Depth(), other.admitted())
+	}
+
+	release()
+	if err := other.wait(t); err != nil {
+		t.Fatal(err)
+	}
+	other.release()
+	if n := q.DrainRoom("closing"); n != 0 {
+		t.Fatalf("drained %d joins from an empty queue", n)
+	}
+}
+
+func TestJoinQueueCancel(t *testing.T) {
+	q := newJoinQueue(1, 0, 10)
+	var depths []int
+	q.onDepthChanged = func(depth int) { depths = append(depths, depth) }
+	release := mustAcquire(t, q, "a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := enqueue(t, ctx, q, "a")
+	next := enqueue(t, context.Background(), q, "b")
+	cancel()
+	if err := cancelled.wait(t); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+
+	release()
+	release() // releasing twice frees one slot
+	if err := next.wait(t); err != nil {
+		t.Fatal(err)
+	}
+	if q.active != 1 {
+		t.Fatalf("%d joins active, want 1", q.active)
+	}
+	next.release()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if want := []int{1, 2, 1, 0}; !slices.Equal(depths, want) {
+		t.Fatalf("depths %v, want %v", depths, want)
+	}
+}
+
+func TestCleanupDrainsJoinsForExpiredRoom(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.MaxConcurrentJoinsPerRoom = 1
+	})
+	if code := ts.api(t, http.MethodPost, "/api/rooms", `{"id":"room-1"}`, "", nil); code != http.StatusOK {
+		t.Fatalf("create room: status %d", code)
+	}
+	release := mustAcquire(t, ts.joinQueue, "room-1")
+	defer release()
+	queued := enqueue(t, context.Background(), ts.joinQueue, "room-1")
+
+	// The room is empty, so cleanup closes it and turns its queue away
+	ts.cleanupEmptyRooms()
+	if ts.lookupRoom("room-1") != nil {
+		t.Fatal("empty room not cleaned up")
+	}
+	if err := queued.wait(t); !errors.Is(err, ErrJoinQueueDrained) {
+		t.Fatalf("err = %v, want %v", err, ErrJoinQueueDrained)
+	}
+}
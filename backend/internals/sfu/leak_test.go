@@ -0,0 +1,44 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"go.uber.org/goleak"
+)
+
+func TestJoinPublishLeaveLeaksNoGoroutines(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	// The server's own loops run until the test ends
+	running := goleak.IgnoreCurrent()
+
+	// The subtest's cleanup closes the clients and stops publishing
+	t.Run("cycle", func(t *testing.T) {
+		received := newTrackCounter()
+		alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+		publish(t, alice, "alice")
+		bob := ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{OnTrack: received.onTrack})
+		eventually(t, "bob to receive alice's tracks", func() bool { return received.receiving(alice.PeerID()) })
+
+		for _, sess := range []*client.Session{alice, bob} {
+			if err := sess.Leave(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		eventually(t, "the room to empty", func() bool {
+			rm := ts.lookupRoom("room-1")
+			return rm == nil || len(rm.GetAllPeers()) == 0
+		})
+	})
+	ts.cleanupEmptyRooms()
+	if ts.lookupRoom("room-1") != nil {
+		t.Fatal("empty room not cleaned up")
+	}
+
+	// miniredis serves the Redis client's pooled connections, which stay
+	// open for reuse
+	goleak.VerifyNone(t, running,
+		goleak.IgnoreAnyFunction("github.com/alicebob/miniredis/v2/server.(*Server).servePeer"),
+		goleak.IgnoreAnyFunction("github.com/alicebob/miniredis/v2/server.(*Server).servePeer.func2"),
+	)
+}
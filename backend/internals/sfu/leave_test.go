@@ -0,0 +1,123 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+)
+
+// storedSession returns sessionID as kept in Redis, or nil once it is gone.
+func (ts *testServer) storedSession(t *testing.T, sessionID string) *state.SessionData {
+	t.Helper()
+	if !ts.redis.Exists(state.SessionKey(sessionID)) {
+		return nil
+	}
+	data, err := ts.redis.Get(state.SessionKey(sessionID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sess state.SessionData
+	if err := json.Unmarshal([]byte(data), &sess); err != nil {
+		t.Fatal(err)
+	}
+	return &sess
+}
+
+// sessionGone reports whether sessionID is neither in the session manager
+// nor in Redis.
+func (ts *testServer) sessionGone(t *testing.T, sessionID string) bool {
+	sess, err := ts.sessionManager.Load().GetSession(context.Background(), sessionID)
+	return err == nil && sess == nil && ts.storedSession(t, sessionID) == nil
+}
+
+// sessionSuspended reports whether sessionID is suspended in the state
+// manager and in Redis.
+func (ts *testServer) sessionSuspended(t *testing.T, sessionID string) bool {
+	sess, err := ts.stateManager.Load().GetSession(context.Background(), sessionID)
+	stored := ts.storedSession(t, sessionID)
+	return err == nil && sess != nil && sess.Suspended && stored != nil && stored.Suspended
+}
+
+// peerLeft reads sc's messages up to the next peer-left.
+func peerLeft(t *testing.T, sc *scriptedClient) signaling.PeerInfo {
+	t.Helper()
+	seen := sc.readUntil(t, signaling.MessageTypePeerLeft)
+	var info signaling.PeerInfo
+	if err := json.Unmarshal(seen[len(seen)-1].Data, &info); err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestExplicitLeaveDeletesSession(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.PeerDisconnectGrace = time.Minute
+	})
+	carol := ts.joinScripted(t, "carol", "room-1")
+
+	// A leave followed at once by the socket closing
+	alice := ts.dialScripted(t, "alice")
+	alice.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "alice"})
+	joined := joinResponse(t, alice.readUntil(t, signaling.MessageTypeJoin))
+	eventually(t, "alice's session to be stored", func() bool { return ts.storedSession(t, joined.SessionID) != nil })
+	alice.pipeline(t, signaling.MessageTypeLeave, struct{}{})
+	alice.hangUp()
+
+	if info := peerLeft(t, carol); info.PeerID != joined.PeerID || info.Reason != signaling.PeerLeftReasonLeft {
+		t.Fatalf("carol was sent %+v, want alice leaving", info)
+	}
+	eventually(t, "alice's session to be deleted", func() bool { return ts.sessionGone(t, joined.SessionID) })
+	if _, p := ts.getRoomAndPeer("room-1", "alice"); p != nil {
+		t.Fatal("alice's peer kept for a reattach")
+	}
+
+	// Her next join is a fresh session, which a later drop suspends
+	again := ts.dialScripted(t, "alice")
+	again.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "alice"})
+	rejoined := joinResponse(t, again.readUntil(t, signaling.MessageTypeJoin))
+	if rejoined.Resumed || rejoined.SessionID == joined.SessionID {
+		t.Fatalf("rejoin %+v after leaving session %s", rejoined, joined.SessionID)
+	}
+	again.pipeline(t, signaling.MessageTypeLeave, struct{}{})
+	if info := peerLeft(t, carol); info.Reason != signaling.PeerLeftReasonLeft {
+		t.Fatalf("second leave announced as %+v", info)
+	}
+	eventually(t, "the second session to be deleted", func() bool { return ts.sessionGone(t, rejoined.SessionID) })
+
+	// A join on the same connection clears the leave
+	again.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "alice"})
+	third := joinResponse(t, again.readUntil(t, signaling.MessageTypeJoin))
+	again.hangUp()
+	eventually(t, "the third session to be suspended", func() bool { return ts.sessionSuspended(t, third.SessionID) })
+}
+
+func TestDisconnectSuspendsSession(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.PeerDisconnectGrace = time.Minute
+	})
+	carol := ts.joinScripted(t, "carol", "room-1")
+	bob := ts.dialScripted(t, "bob")
+	bob.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "bob", Name: "bob"})
+	joined := joinResponse(t, bob.readUntil(t, signaling.MessageTypeJoin))
+	var carolSaw messageCounts
+	carolSaw.drain(carol)
+
+	bob.hangUp()
+	eventually(t, "bob's session to be suspended", func() bool { return ts.sessionSuspended(t, joined.SessionID) })
+	if ts.redis.TTL(state.SessionKey(joined.SessionID)) <= 0 {
+		t.Fatal("suspended session stored without a TTL")
+	}
+	// His peer waits out the grace for a reattach
+	if _, p := ts.getRoomAndPeer("room-1", "bob"); p == nil || p.ID != joined.PeerID {
+		t.Fatal("bob's peer removed on a dropped connection")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := carolSaw.get(signaling.MessageTypePeerLeft); n != 0 {
+		t.Fatalf("carol was sent %d peer-left for a dropped connection", n)
+	}
+}
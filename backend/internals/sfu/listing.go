@@ -0,0 +1,239 @@
+package sfu
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The room and peer listings are paginated, with limit and either offset or
+// the nextCursor of the previous page, and can be filtered and sorted. Each
+// entry is built from a snapshot taken without s.roomsMu, which is held only
+// to copy the rooms out.
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// listQuery is a listing request's page, filters and sort order.
+type listQuery struct {
+	limit  int
+	offset int
+
+	state        string
+	namePrefix   string
+	minPeers     int // -1 = no bound
+	maxPeers     int // -1 = no bound
+	createdAfter time.Time
+
+	sort string
+	desc bool
+}
+
+// listEntry is one item of a listing, with the fields it is filtered and
+// sorted by next to what is written out.
+type listEntry struct {
+	id        string
+	name      string
+	userID    string
+	state     string
+	peers     int
+	createdAt time.Time
+	value     interface{}
+}
+
+// listPage is the body of a listing, under the key of its items.
+type listPage struct {
+	items      []interface{}
+	total      int
+	limit      int
+	offset     int
+	nextCursor string
+}
+
+// parseListQuery reads a listing's query string. Only room listings take
+// the peer count and creation time filters. sortKeys are the keys the
+// listing sorts by, the first being the default.
+func parseListQuery(q url.Values, roomFilters bool, sortKeys ...string) (listQuery, error) {
+	lq := listQuery{limit: defaultListLimit, minPeers: -1, maxPeers: -1, sort: sortKeys[0]}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxListLimit {
+			return lq, errors.New("invalid limit: must be 1 to " + strconv.Itoa(maxListLimit))
+		}
+		lq.limit = n
+	}
+	offset, cursor := q.Get("offset"), q.Get("cursor")
+	switch {
+	case offset != "" && cursor != "":
+		return lq, errors.New("give offset or cursor, not both")
+	case offset != "":
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return lq, errors.New("invalid offset")
+		}
+		lq.offset = n
+	case cursor != "":
+		n, err := decodeListCursor(cursor)
+		if err != nil {
+			return lq, errors.New("invalid cursor")
+		}
+		lq.offset = n
+	}
+
+	lq.state = q.Get("state")
+	lq.namePrefix = q.Get("namePrefix")
+	if roomFilters {
+		for _, bound := range []struct {
+			name string
+			dst  *int
+		}{{"minPeers", &lq.minPeers}, {"maxPeers", &lq.maxPeers}} {
+			if v := q.Get(bound.name); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 {
+					return lq, errors.New("invalid " + bound.name)
+				}
+				*bound.dst = n
+			}
+		}
+		if v := q.Get("createdAfter"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return lq, errors.New("invalid createdAfter: must be an RFC 3339 time")
+			}
+			lq.createdAfter = t
+		}
+	}
+
+	if v := q.Get("sort"); v != "" {
+		valid := false
+		for _, key := range sortKeys {
+			valid = valid || v == key
+		}
+		if !valid {
+			return lq, errors.New("invalid sort: must be one of " + strings.Join(sortKeys, ", "))
+		}
+		lq.sort = v
+	}
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		lq.desc = true
+	default:
+		return lq, errors.New("invalid order: must be asc or desc")
+	}
+	return lq, nil
+}
+
+// matches reports whether e passes the query's filters.
+func (lq listQuery) matches(e listEntry) bool {
+	switch {
+	case lq.state != "" && e.state != lq.state:
+		return false
+	case lq.namePrefix != "" && !strings.HasPrefix(e.name, lq.namePrefix):
+		return false
+	case lq.minPeers >= 0 && e.peers < lq.minPeers:
+		return false
+	case lq.maxPeers >= 0 && e.peers > lq.maxPeers:
+		return false
+	case !lq.createdAfter.IsZero() && !e.createdAt.After(lq.createdAfter):
+		return false
+	}
+	return true
+}
+
+// less orders a before b by the query's sort key, then by ID so pages are
+// stable.
+func (lq listQuery) less(a, b listEntry) bool {
+	var c int
+	switch lq.sort {
+	case "createdAt":
+		c = a.createdAt.Compare(b.createdAt)
+	case "peerCount":
+		c = a.peers - b.peers
+	case "name":
+		c = strings.Compare(a.name, b.name)
+	case "userId":
+		c = strings.Compare(a.userID, b.userID)
+	}
+	if c == 0 {
+		c = strings.Compare(a.id, b.id)
+	}
+	if lq.desc {
+		return c > 0
+	}
+	return c < 0
+}
+
+// page filters and sorts entries and cuts out the requested page.
+func (lq listQuery) page(entries []listEntry) listPage {
+	matched := entries[:0]
+	for _, e := range entries {
+		if lq.matches(e) {
+			matched = append(matched, e)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return lq.less(matched[i], matched[j]) })
+
+	p := listPage{items: []interface{}{}, total: len(matched), limit: lq.limit, offset: lq.offset}
+	if lq.offset >= len(matched) {
+		return p
+	}
+	end := min(lq.offset+lq.limit, len(matched))
+	for _, e := range matched[lq.offset:end] {
+		p.items = append(p.items, e.value)
+	}
+	if end < len(matched) {
+		p.nextCursor = encodeListCursor(end)
+	}
+	return p
+}
+
+// writeListPage answers with p, its items under key, and the extra fields.
+func writeListPage(w http.ResponseWriter, key string, p listPage, extra map[string]interface{}) {
+	body := map[string]interface{}{
+		key:      p.items,
+		"total":  p.total,
+		"limit":  p.limit,
+		"offset": p.offset,
+	}
+	if p.nextCursor != "" {
+		body["nextCursor"] = p.nextCursor
+	}
+	for k, v := range extra {
+		body[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// A cursor is the offset of the page it starts, kept opaque so clients
+// do not build their own.
+
+func encodeListCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+func decodeListCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	v, ok := strings.CutPrefix(string(raw), "o:")
+	if !ok {
+		return 0, errors.New("malformed cursor")
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, errors.New("malformed cursor")
+	}
+	return n, nil
+}
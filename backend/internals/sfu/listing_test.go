@@ -0,0 +1,103 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+// roomsPage is a page of the room listing.
+type roomsPage struct {
+	Rooms []struct {
+		ID string `json:"id"`
+	} `json:"rooms"`
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextCursor string `json:"nextCursor"`
+}
+
+// listRooms fetches a page of the room listing, which must succeed.
+func (ts *testServer) listRooms(t *testing.T, query string) roomsPage {
+	t.Helper()
+	resp, data := ts.rawAPI(t, http.MethodGet, "/api/rooms"+query, "", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET rooms%s: %d %s", query, resp.StatusCode, data)
+	}
+	// An empty page lists no rooms rather than null
+	if !strings.Contains(string(data), `"rooms":[`) {
+		t.Fatalf("GET rooms%s: %s", query, data)
+	}
+	var page roomsPage
+	if err := json.Unmarshal(data, &page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func TestRoomListingPages(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	if page := ts.listRooms(t, ""); len(page.Rooms) != 0 || page.Total != 0 || page.Limit != defaultListLimit || page.NextCursor != "" {
+		t.Fatalf("listing without rooms: %+v", page)
+	}
+	for _, id := range []string{"room-b", "room-a", "room-c"} {
+		if code := ts.api(t, http.MethodPost, "/api/rooms", `{"id":"`+id+`"}`, testAdminKey, nil); code != http.StatusOK {
+			t.Fatalf("POST %s: %d", id, code)
+		}
+	}
+
+	// Pages follow one another by cursor, sorted by creation
+	first := ts.listRooms(t, "?limit=2")
+	if len(first.Rooms) != 2 || first.Total != 3 || first.Rooms[0].ID != "room-b" || first.Rooms[1].ID != "room-a" || first.NextCursor == "" {
+		t.Fatalf("first page %+v", first)
+	}
+	second := ts.listRooms(t, "?limit=2&cursor="+first.NextCursor)
+	if len(second.Rooms) != 1 || second.Rooms[0].ID != "room-c" || second.Offset != 2 || second.NextCursor != "" {
+		t.Fatalf("second page %+v", second)
+	}
+
+	// An offset past the end, or filters nothing passes, is an empty page
+	if page := ts.listRooms(t, "?offset=10"); len(page.Rooms) != 0 || page.Total != 3 || page.Offset != 10 || page.NextCursor != "" {
+		t.Fatalf("page past the end %+v", page)
+	}
+	if page := ts.listRooms(t, "?offset=3"); len(page.Rooms) != 0 || page.Total != 3 {
+		t.Fatalf("page at the end %+v", page)
+	}
+	if page := ts.listRooms(t, "?namePrefix=nothing"); len(page.Rooms) != 0 || page.Total != 0 {
+		t.Fatalf("filtered page %+v", page)
+	}
+}
+
+func TestListingQueryErrors(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+
+	for _, tc := range []struct {
+		name, path string
+	}{
+		{"sort key of another listing", "/api/rooms?sort=name"},
+		{"unknown sort key", "/api/rooms?sort=size"},
+		{"unknown peer sort key", "/api/rooms/room-1/peers?sort=createdAt"},
+		{"unknown order", "/api/rooms?order=up"},
+		{"zero limit", "/api/rooms?limit=0"},
+		{"limit over the maximum", "/api/rooms?limit=1001"},
+		{"negative offset", "/api/rooms?offset=-1"},
+		{"offset and cursor", "/api/rooms?offset=1&cursor=" + encodeListCursor(1)},
+		{"forged cursor", "/api/rooms?cursor=b2Zmc2V0"},
+		{"bad creation time", "/api/rooms?createdAfter=yesterday"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, data := ts.rawAPI(t, http.MethodGet, tc.path, "", "")
+			expectEnvelope(t, resp, data, http.StatusBadRequest, "bad_request")
+		})
+	}
+
+	// The message names the keys the listing does sort by
+	_, data := ts.rawAPI(t, http.MethodGet, "/api/rooms/room-1/peers?sort=createdAt", "", "")
+	if !strings.Contains(string(data), "name, userId") {
+		t.Fatalf("sort error %s", data)
+	}
+}
@@ -0,0 +1,181 @@
+package sfu
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"go.uber.org/zap"
+)
+
+// GET /api/rooms/{id}/live streams a room to dashboards as Server-Sent
+// Events: the room's recent events once, then a "sample" event on every
+// stats tick (see room/live.go) and a heartbeat comment in between. The
+// room is sampled only while someone watches it, and each sample is
+// serialized once however many watch. The stream ends with a
+// "room-closed" event when the room closes.
+
+// liveBuffer is how many samples a slow consumer may fall behind before
+// it misses some.
+const liveBuffer = 4
+
+// liveEventsFrame is the data of the "events" event a stream opens with.
+type liveEventsFrame struct {
+	RoomID string           `json:"roomId"`
+	Events []room.RoomEvent `json:"events"`
+}
+
+// liveConsumer is one open live stream.
+type liveConsumer struct {
+	frames chan []byte
+	closed chan struct{} // closed when the room closes
+}
+
+// liveStreams are the open live streams by room.
+type liveStreams struct {
+	byRoom map[*room.Room]map[*liveConsumer]struct{}
+	mu     sync.Mutex
+}
+
+// handleRoomLiveAPI serves GET /api/rooms/{id}/live.
+func (s *SFU) handleRoomLiveAPI(w http.ResponseWriter, r *http.Request, roomID string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	s.roomsMu.RLock()
+	rm, exists := s.rooms[roomID]
+	s.roomsMu.RUnlock()
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	c, ok := s.addLiveConsumer(rm)
+	if !ok {
+		writeAPIError(w, http.StatusTooManyRequests, "Too many live streams for this room")
+		return
+	}
+	defer s.removeLiveConsumer(rm, c)
+	// A room closed while the consumer was added has already ended its
+	// streams
+	s.roomsMu.RLock()
+	current := s.rooms[roomID]
+	s.roomsMu.RUnlock()
+	if current != rm {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	events, _ := rm.EventsSince(0)
+	data, _ := json.Marshal(liveEventsFrame{RoomID: roomID, Events: events})
+	if writeLiveEvent(w, "events", data) != nil || rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(s.config.Media.LiveHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case frame := <-c.frames:
+			err = writeLiveEvent(w, "sample", frame)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case <-c.closed:
+			data, _ := json.Marshal(map[string]string{"roomId": roomID})
+			writeLiveEvent(w, "room-closed", data)
+			rc.Flush()
+			return
+		case <-r.Context().Done():
+			return
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeLiveEvent writes one Server-Sent Event.
+func writeLiveEvent(w http.ResponseWriter, event string, data []byte) error {
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+// addLiveConsumer adds a live stream of rm, unless rm has
+// Media.LiveMaxConsumers already. The first one turns sampling on.
+func (s *SFU) addLiveConsumer(rm *room.Room) (*liveConsumer, bool) {
+	s.live.mu.Lock()
+	defer s.live.mu.Unlock()
+	consumers := s.live.byRoom[rm]
+	if len(consumers) >= s.config.Media.LiveMaxConsumers {
+		return nil, false
+	}
+	if consumers == nil {
+		consumers = make(map[*liveConsumer]struct{})
+		s.live.byRoom[rm] = consumers
+		rm.SetLiveSampling(true)
+	}
+	c := &liveConsumer{frames: make(chan []byte, liveBuffer), closed: make(chan struct{})}
+	consumers[c] = struct{}{}
+	return c, true
+}
+
+// removeLiveConsumer removes a live stream of rm. The last one turns
+// sampling off.
+func (s *SFU) removeLiveConsumer(rm *room.Room, c *liveConsumer) {
+	s.live.mu.Lock()
+	defer s.live.mu.Unlock()
+	consumers, ok := s.live.byRoom[rm]
+	if !ok {
+		return
+	}
+	delete(consumers, c)
+	if len(consumers) == 0 {
+		delete(s.live.byRoom, rm)
+		rm.SetLiveSampling(false)
+	}
+}
+
+// endLiveStreams ends the live streams of a closing room.
+func (s *SFU) endLiveStreams(rm *room.Room) {
+	s.live.mu.Lock()
+	defer s.live.mu.Unlock()
+	for c := range s.live.byRoom[rm] {
+		close(c.closed)
+	}
+	delete(s.live.byRoom, rm)
+	rm.SetLiveSampling(false)
+}
+
+// handleLiveSample hands a room's sample to its live streams. A stream
+// that has fallen liveBuffer samples behind misses this one.
+func (s *SFU) handleLiveSample(rm *room.Room, sample room.LiveSample) {
+	data, err := json.Marshal(sample)
+	if err != nil {
+		s.logger.Error("Failed to marshal live sample", zap.String("roomID", rm.ID), zap.Error(err))
+		return
+	}
+	s.live.mu.Lock()
+	defer s.live.mu.Unlock()
+	for c := range s.live.byRoom[rm] {
+		select {
+		case c.frames <- data:
+		default:
+		}
+	}
+}
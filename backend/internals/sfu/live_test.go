@@ -0,0 +1,199 @@
+package sfu
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+// sseEvent is one Server-Sent Event, or a comment when name is empty.
+type sseEvent struct {
+	name string
+	data string
+}
+
+// liveStream is an open GET /api/rooms/{id}/live.
+type liveStream struct {
+	resp   *http.Response
+	events chan sseEvent // closed when the stream ends
+}
+
+// openLive opens roomID's live stream, or returns the status it was refused
+// with.
+func (ts *testServer) openLive(t *testing.T, roomID, key string) (*liveStream, int) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.http.URL+"/api/rooms/"+roomID+"/live", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, resp.StatusCode
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("live stream served as %q", ct)
+	}
+	ls := &liveStream{resp: resp, events: make(chan sseEvent, 64)}
+	t.Cleanup(ls.close)
+	go func() {
+		defer close(ls.events)
+		scanner := bufio.NewScanner(resp.Body)
+		var ev sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				ls.events <- ev
+				ev = sseEvent{}
+			case strings.HasPrefix(line, ":"):
+				ev.data = strings.TrimSpace(line[1:])
+			case strings.HasPrefix(line, "event: "):
+				ev.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return ls, http.StatusOK
+}
+
+func (ls *liveStream) close() { ls.resp.Body.Close() }
+
+// next returns the stream's next event named name, skipping others.
+func (ls *liveStream) next(t *testing.T, name string) sseEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-ls.events:
+			if !ok {
+				t.Fatalf("stream ended waiting for %q", name)
+			}
+			if ev.name == name {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("no %q event", name)
+		}
+	}
+}
+
+func TestRoomLiveStream(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.StatsInterval = 200 * time.Millisecond
+		cfg.Media.LiveHeartbeatInterval = 150 * time.Millisecond
+		cfg.Media.LiveMaxConsumers = 2
+	})
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	publish(t, alice, "alice")
+	rm := ts.lookupRoom("room-1")
+	eventually(t, "alice to publish", func() bool { return rm.GetTrackCount() == 2 })
+
+	if _, code := ts.openLive(t, "room-1", ""); code != http.StatusUnauthorized {
+		t.Fatalf("live stream without a key: %d", code)
+	}
+	if _, code := ts.openLive(t, "no-such-room", testAdminKey); code != http.StatusNotFound {
+		t.Fatalf("live stream of an unknown room: %d", code)
+	}
+
+	// The stream opens with the room's recent events
+	stream, _ := ts.openLive(t, "room-1", testAdminKey)
+	var opening liveEventsFrame
+	if err := json.Unmarshal([]byte(stream.next(t, "events").data), &opening); err != nil {
+		t.Fatal(err)
+	}
+	types := make(map[string]int)
+	for _, ev := range opening.Events {
+		types[ev.Type]++
+	}
+	if opening.RoomID != "room-1" || types[room.EventPeerJoined] != 1 || types[room.EventTrackPublished] != 2 {
+		t.Fatalf("opening events %+v", opening)
+	}
+
+	// Samples follow each stats tick, with heartbeats in between, and carry
+	// each later event once
+	bob := ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{})
+	joined := 0
+	for seen := false; !seen; {
+		var sample room.LiveSample
+		if err := json.Unmarshal([]byte(stream.next(t, "sample").data), &sample); err != nil {
+			t.Fatal(err)
+		}
+		for _, ev := range sample.Events {
+			if ev.Type == room.EventPeerJoined {
+				if ev.PeerID != bob.PeerID() {
+					t.Fatalf("sample repeats the join of %s", ev.PeerID)
+				}
+				joined++
+			}
+		}
+		if sample.RoomID != "room-1" || sample.PeerCount < 1 || sample.PeerCount > 2 {
+			t.Fatalf("sample %+v", sample)
+		}
+		levels := make(map[string]string)
+		for _, p := range sample.Peers {
+			levels[p.PeerID] = p.Level
+		}
+		seen = sample.PeerCount == 2 && levels[alice.PeerID()] != "" && levels[bob.PeerID()] != ""
+	}
+	if joined != 1 {
+		t.Fatalf("bob's join sampled %d times", joined)
+	}
+	if ev := stream.next(t, ""); ev.data != "heartbeat" {
+		t.Fatalf("comment %q", ev.data)
+	}
+
+	// Streams of a room are limited; a closed one frees its place
+	second, _ := ts.openLive(t, "room-1", testAdminKey)
+	if _, code := ts.openLive(t, "room-1", testAdminKey); code != http.StatusTooManyRequests {
+		t.Fatalf("third live stream: %d", code)
+	}
+	second.close()
+	eventually(t, "the closed stream to free its place", func() bool {
+		ts.live.mu.Lock()
+		defer ts.live.mu.Unlock()
+		return len(ts.live.byRoom[rm]) == 1
+	})
+	third, code := ts.openLive(t, "room-1", testAdminKey)
+	if code != http.StatusOK {
+		t.Fatalf("live stream after one closed: %d", code)
+	}
+
+	// Closing the room ends its streams
+	if code := ts.api(t, http.MethodDelete, "/api/rooms/room-1", "", testAdminKey, nil); code != http.StatusNoContent {
+		t.Fatalf("delete room: %d", code)
+	}
+	for _, ls := range []*liveStream{stream, third} {
+		var closed map[string]string
+		if err := json.Unmarshal([]byte(ls.next(t, "room-closed").data), &closed); err != nil || closed["roomId"] != "room-1" {
+			t.Fatalf("room-closed %v (%v)", closed, err)
+		}
+		select {
+		case _, open := <-ls.events:
+			for open {
+				_, open = <-ls.events
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("stream still open after the room closed")
+		}
+	}
+	ts.live.mu.Lock()
+	defer ts.live.mu.Unlock()
+	if len(ts.live.byRoom) != 0 {
+		t.Fatalf("%d rooms still streamed", len(ts.live.byRoom))
+	}
+}
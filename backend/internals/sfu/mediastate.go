@@ -0,0 +1,260 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/session"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+)
+
+// isModerator reports whether p may moderate rm: it has a moderator role or
+// is the room's host.
+func isModerator(rm *room.Room, p *peer.Peer) bool {
+	role, _ := p.GetMetadata("role")
+	r, _ := role.(string)
+	return canModerate(r) || rm.IsHost(p.UserID)
+}
+
+// enforcesMute reports whether the room's mute settings apply to p.
+// Moderators and observers are exempt.
+func enforcesMute(rm *room.Room, settings room.RoomSettings, p *peer.Peer) bool {
+	return (settings.MuteOnEntry || settings.PushToTalk) && !p.Observer && !isModerator(rm, p)
+}
+
+// pushToTalkWindow is how long an unmute lasts in a push-to-talk room.
+func (s *SFU) pushToTalkWindow(settings room.RoomSettings) time.Duration {
+	if settings.PushToTalkMaxMs > 0 {
+		return time.Duration(settings.PushToTalkMaxMs) * time.Millisecond
+	}
+	return s.config.Media.PushToTalkMaxDuration
+}
+
+// applyEntryMediaState sets a joining peer's media state. A resumed session
+// keeps its devices' state; in a room that enforces muting the mic starts
+// off, unless the resumed session had been unmuted outside push-to-talk.
+// A mute-all in force mutes the peer the same way, and a hard one even if
+// the session had been unmuted.
+func (s *SFU) applyEntryMediaState(ctx context.Context, rm *room.Room, p *peer.Peer, sess *session.Session, resumed bool) {
+	settings := rm.GetSettings()
+	enforced := enforcesMute(rm, settings, p)
+	restore := resumed && sess != nil
+	muteAll, _ := rm.MutedByMuteAll(p.UserID)
+	muteAll = muteAll && !p.Observer
+	held := mutedByMuteAll(rm, p)
+
+	ms := p.UpdateMediaState(func(ms *peer.MediaState) {
+		if restore {
+			ms.CameraEnabled = sess.MediaState.CameraEnabled
+			ms.ScreenEnabled = sess.MediaState.ScreenEnabled
+		}
+		if enforced {
+			ms.MicEnabled = restore && sess.MediaState.MicEnabled && !settings.PushToTalk
+		}
+		if muteAll {
+			ms.MicEnabled = ms.MicEnabled && restore && sess.MediaState.MicEnabled && !held
+		}
+	})
+
+	if sess != nil && toStateMediaState(ms) != sess.MediaState {
+		s.sessionManager.Load().UpdateMediaState(ctx, sess.ID, toStateMediaState(ms))
+	}
+}
+
+func toStateMediaState(ms peer.MediaState) state.MediaState {
+	return state.MediaState{
+		MicEnabled:    ms.MicEnabled,
+		CameraEnabled: ms.CameraEnabled,
+		ScreenEnabled: ms.ScreenEnabled,
+	}
+}
+
+// handleMediaStateMessage applies a client's media-state report. In rooms
+// that enforce muting, a self-unmute may need a moderator's approval and
+// may be reverted by the push-to-talk timer; under a hard mute-all it is
+// refused. Moderators can also mute or
+// unmute another peer's mic by naming it.
+func (s *SFU) handleMediaStateMessage(client *signaling.Client, message signaling.Message, req signaling.MediaStateRequest) {
+
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+
+	target := p
+	if req.PeerID != "" && req.PeerID != p.ID {
+		if !isModerator(rm, p) {
+			s.auditClient(client, auditPeerMic, req.PeerID, audit.ResultDenied, nil)
+			client.SendError(403, "Moderator role required")
+			return
+		}
+		if req.MicEnabled == nil || req.CameraEnabled != nil || req.ScreenEnabled != nil {
+			client.SendError(400, "Only another peer's mic can be changed")
+			return
+		}
+		var ok bool
+		if target, ok = rm.GetPeer(req.PeerID); !ok {
+			client.SendError(404, "Peer not found")
+			return
+		}
+	}
+
+	settings := rm.GetSettings()
+	before := target.GetMediaState()
+	unmuting := req.MicEnabled != nil && *req.MicEnabled && !before.MicEnabled
+	if unmuting && target == p && mutedByMuteAll(rm, p) {
+		client.SendErrorMessage(signaling.ErrorMessage{
+			Code: 403, Message: "The host has muted everyone", Reason: signaling.ErrorReasonHardMuted,
+		})
+		return
+	}
+	if unmuting && target == p && enforcesMute(rm, settings, p) && settings.UnmuteRequiresApproval {
+		s.requestUnmuteApproval(rm, p)
+		client.SendError(403, "Unmute requires moderator approval")
+		return
+	}
+
+	ms := target.UpdateMediaState(func(ms *peer.MediaState) {
+		if req.MicEnabled != nil {
+			ms.MicEnabled = *req.MicEnabled
+		}
+		if req.CameraEnabled != nil {
+			ms.CameraEnabled = *req.CameraEnabled
+		}
+		if req.ScreenEnabled != nil {
+			ms.ScreenEnabled = *req.ScreenEnabled
+		}
+	})
+
+	reason := ""
+	if target != p {
+		reason = signaling.MediaStateModerator
+		s.auditClient(client, auditPeerMic, target.ID, audit.ResultSuccess, map[string]string{
+			"micEnabled": strconv.FormatBool(ms.MicEnabled),
+		})
+	}
+
+	// Any unmute by a participant the settings apply to (re)starts the
+	// push-to-talk window; a mute cancels it.
+	var window time.Duration
+	if ms.MicEnabled && settings.PushToTalk && enforcesMute(rm, settings, target) {
+		window = s.pushToTalkWindow(settings)
+	}
+	if window > 0 {
+		s.armPushToTalk(target, window)
+	} else {
+		s.disarmPushToTalk(target.ID)
+	}
+
+	if ms == before {
+		// Nothing changed; just confirm the state to the sender
+		s.sendMediaState(client, target, ms, reason, window)
+		return
+	}
+	s.publishMediaState(target, ms, reason, window)
+}
+
+// requestUnmuteApproval asks the room's moderators to approve p's unmute.
+// A moderator approves by unmuting p with a media-state naming it.
+func (s *SFU) requestUnmuteApproval(rm *room.Room, p *peer.Peer) {
+	data, err := json.Marshal(signaling.PeerInfo{
+		PeerID: p.ID, UserID: p.UserID, Name: p.GetName(), RoomID: p.RoomID, MicMuted: true,
+	})
+	if err != nil {
+		return
+	}
+	msg := signaling.Message{Type: signaling.MessageTypeUnmuteRequested, Data: data, Timestamp: time.Now()}
+	for _, client := range s.signalingHub.GetClientsByRoom(p.RoomID) {
+		if mod, ok := rm.GetPeerByUserID(client.UserID); ok && isModerator(rm, mod) {
+			client.SendMessage(msg)
+		}
+	}
+}
+
+// armPushToTalk (re)starts p's push-to-talk window; when it ends the mic is
+// muted again.
+func (s *SFU) armPushToTalk(p *peer.Peer, window time.Duration) {
+	s.pttMu.Lock()
+	defer s.pttMu.Unlock()
+
+	if t := s.pttTimers[p.ID]; t != nil {
+		t.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(window, func() {
+		s.pttMu.Lock()
+		current := s.pttTimers[p.ID] == t
+		if current {
+			delete(s.pttTimers, p.ID)
+		}
+		s.pttMu.Unlock()
+		if !current || p.Context().Err() != nil {
+			return
+		}
+
+		ms := p.UpdateMediaState(func(ms *peer.MediaState) { ms.MicEnabled = false })
+		s.publishMediaState(p, ms, signaling.MediaStatePushToTalkExpired, 0)
+	})
+	s.pttTimers[p.ID] = t
+}
+
+func (s *SFU) disarmPushToTalk(peerID string) {
+	s.pttMu.Lock()
+	defer s.pttMu.Unlock()
+	if t := s.pttTimers[peerID]; t != nil {
+		t.Stop()
+		delete(s.pttTimers, peerID)
+	}
+}
+
+// publishMediaState persists p's media state to its session and broadcasts
+// it to the room. Observers only hear back about their own state.
+func (s *SFU) publishMediaState(p *peer.Peer, ms peer.MediaState, reason string, window time.Duration) {
+	if s.sessionManager.Load() != nil {
+		if sessionID := s.sessionManager.Load().UserSessionID(p.UserID, p.RoomID); sessionID != "" {
+			ctx, cancel := s.messageContext()
+			s.sessionManager.Load().UpdateMediaState(ctx, sessionID, toStateMediaState(ms))
+			cancel()
+		}
+	}
+
+	msg, ok := mediaStateMessage(p, ms, reason, window)
+	if !ok {
+		return
+	}
+	rm := s.lookupRoom(p.RoomID)
+	if p.Observer || rm == nil {
+		s.sendToPeerClient(p, msg)
+		return
+	}
+	s.broadcastToRoom(rm, msg, nil)
+}
+
+func (s *SFU) sendMediaState(client *signaling.Client, p *peer.Peer, ms peer.MediaState, reason string, window time.Duration) {
+	if msg, ok := mediaStateMessage(p, ms, reason, window); ok {
+		client.SendMessage(msg)
+	}
+}
+
+func mediaStateMessage(p *peer.Peer, ms peer.MediaState, reason string, window time.Duration) (signaling.Message, bool) {
+	data, err := json.Marshal(signaling.MediaStateMessage{
+		PeerID:        p.ID,
+		UserID:        p.UserID,
+		MicEnabled:    ms.MicEnabled,
+		CameraEnabled: ms.CameraEnabled,
+		ScreenEnabled: ms.ScreenEnabled,
+		Reason:        reason,
+		PushToTalkMs:  window.Milliseconds(),
+	})
+	if err != nil {
+		return signaling.Message{}, false
+	}
+	return signaling.Message{Type: signaling.MessageTypeMediaState, Data: data, Timestamp: time.Now()}, true
+}
@@ -0,0 +1,216 @@
+package sfu
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+// mediaStates collects the media-state messages a session receives.
+type mediaStates chan signaling.MediaStateMessage
+
+func (ch mediaStates) record(m signaling.MediaStateMessage) { ch <- m }
+
+// next returns the next media-state about peerID, skipping others.
+func (ch mediaStates) next(t *testing.T, peerID string) signaling.MediaStateMessage {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m := <-ch:
+			if m.PeerID == peerID {
+				return m
+			}
+		case <-timeout:
+			t.Fatalf("no media-state for %s", peerID)
+		}
+	}
+}
+
+// none fails the test if a media-state about peerID arrives within d.
+func (ch mediaStates) none(t *testing.T, peerID string, d time.Duration) {
+	t.Helper()
+	timeout := time.After(d)
+	for {
+		select {
+		case m := <-ch:
+			if m.PeerID == peerID {
+				t.Fatalf("unexpected media-state %+v", m)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// count returns the packets of publisherID's track of kind received so far.
+func (tc *trackCounter) count(publisherID, kind string) int {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.packets[publisherID+"/"+kind]
+}
+
+// createRoomWithSettings creates room-1 hosted by "host", a moderator
+// exempt from the settings.
+func (ts *testServer) createRoomWithSettings(t *testing.T, settings string) {
+	t.Helper()
+	body := `{"id":"room-1","hostUserId":"host","settings":` + settings + `}`
+	if code := ts.api(t, http.MethodPost, "/api/rooms", body, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("POST room: %d", code)
+	}
+}
+
+func TestMuteOnEntry(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	ts.createRoomWithSettings(t, `{"muteOnEntry":true}`)
+
+	host := ts.join(t, "host", "room-1", client.Handlers{}, client.JoinOptions{})
+	if host.Info().MicMuted {
+		t.Fatal("the host joined muted")
+	}
+	received := newTrackCounter()
+	bobStates := make(mediaStates, 16)
+	ts.join(t, "bob", "room-1", client.Handlers{OnMediaState: bobStates.record}, client.JoinOptions{OnTrack: received.onTrack})
+
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	if !alice.Info().MicMuted {
+		t.Fatal("alice did not join muted")
+	}
+	sessionMicEnabled := func() bool {
+		sess, err := ts.sessionManager.Load().GetSession(context.Background(), alice.Info().SessionID)
+		if err != nil || sess == nil {
+			t.Fatalf("alice's session: %+v, %v", sess, err)
+		}
+		return sess.MediaState.MicEnabled
+	}
+	if sessionMicEnabled() {
+		t.Fatal("alice's session starts with the mic on")
+	}
+
+	// Her video is forwarded, her audio withheld
+	publish(t, alice, "alice")
+	eventually(t, "bob to receive alice's video", func() bool { return received.count(alice.PeerID(), "video") > 10 })
+	if n := received.count(alice.PeerID(), "audio"); n != 0 {
+		t.Fatalf("bob received %d packets of muted audio", n)
+	}
+
+	// A self-unmute is announced, saved and lets the audio through
+	if err := alice.SetMic(true); err != nil {
+		t.Fatal(err)
+	}
+	if m := bobStates.next(t, alice.PeerID()); !m.MicEnabled || m.Reason != "" || m.PushToTalkMs != 0 {
+		t.Fatalf("media-state %+v after alice unmuted", m)
+	}
+	eventually(t, "bob to receive alice's audio", func() bool { return received.count(alice.PeerID(), "audio") > 0 })
+	if !sessionMicEnabled() {
+		t.Fatal("the unmute is not saved in alice's session")
+	}
+}
+
+func TestUnmuteRequiresApproval(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	ts.createRoomWithSettings(t, `{"muteOnEntry":true,"unmuteRequiresApproval":true}`)
+
+	requests := make(chan signaling.PeerInfo, 4)
+	hostStates := make(mediaStates, 16)
+	host := ts.join(t, "host", "room-1", client.Handlers{
+		OnUnmuteRequested: func(p signaling.PeerInfo) { requests <- p },
+		OnMediaState:      hostStates.record,
+	}, client.JoinOptions{})
+	errs := make(chan *client.ServerError, 4)
+	alice := ts.join(t, "alice", "room-1", client.Handlers{
+		OnError: func(err *client.ServerError) { errs <- err },
+	}, client.JoinOptions{})
+
+	if err := alice.SetMic(true); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if err.Code != http.StatusForbidden {
+			t.Fatalf("self-unmute refused with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("self-unmute not refused")
+	}
+	select {
+	case p := <-requests:
+		if p.PeerID != alice.PeerID() || !p.MicMuted {
+			t.Fatalf("unmute-requested %+v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the host was not asked to approve")
+	}
+	hostStates.none(t, alice.PeerID(), 200*time.Millisecond)
+
+	// The host approves by unmuting her
+	if err := host.SetPeerMic(alice.PeerID(), true); err != nil {
+		t.Fatal(err)
+	}
+	if m := hostStates.next(t, alice.PeerID()); !m.MicEnabled || m.Reason != signaling.MediaStateModerator {
+		t.Fatalf("media-state %+v after the host's approval", m)
+	}
+
+	// Only a moderator may change someone else's mic
+	if err := alice.SetPeerMic(host.PeerID(), false); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if err.Code != http.StatusForbidden {
+			t.Fatalf("muting the host refused with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a participant muted the host")
+	}
+}
+
+func TestPushToTalkReverts(t *testing.T) {
+	const window = 300 * time.Millisecond
+	ts := newTestServer(t, nil, nil)
+	ts.createRoomWithSettings(t, `{"pushToTalk":true,"pushToTalkMaxMs":300}`)
+
+	states := make(mediaStates, 16)
+	alice := ts.join(t, "alice", "room-1", client.Handlers{OnMediaState: states.record}, client.JoinOptions{})
+	if !alice.Info().MicMuted {
+		t.Fatal("alice did not join muted")
+	}
+
+	unmute := func() time.Time {
+		t.Helper()
+		if err := alice.SetMic(true); err != nil {
+			t.Fatal(err)
+		}
+		if m := states.next(t, alice.PeerID()); !m.MicEnabled || m.PushToTalkMs != window.Milliseconds() {
+			t.Fatalf("media-state %+v after unmuting", m)
+		}
+		return time.Now()
+	}
+
+	// The unmute reverts once the window is over
+	start := unmute()
+	m := states.next(t, alice.PeerID())
+	if m.MicEnabled || m.Reason != signaling.MediaStatePushToTalkExpired {
+		t.Fatalf("media-state %+v at the end of the window", m)
+	}
+	if took := time.Since(start); took < window-50*time.Millisecond {
+		t.Fatalf("unmute reverted after %v, want %v", took, window)
+	}
+	if p, _ := ts.lookupRoom("room-1").GetPeer(alice.PeerID()); !p.MicMuted() {
+		t.Fatal("audio still forwarded after the window")
+	}
+
+	// A mute ends the window early, so nothing reverts later
+	unmute()
+	if err := alice.SetMic(false); err != nil {
+		t.Fatal(err)
+	}
+	if m := states.next(t, alice.PeerID()); m.MicEnabled || m.Reason != "" {
+		t.Fatalf("media-state %+v after muting", m)
+	}
+	states.none(t, alice.PeerID(), 2*window)
+}
@@ -0,0 +1,123 @@
+package sfu
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// A connection joins further rooms with "membership": true on join. Each
+// such join creates a membership (see signaling/membership.go) whose ID
+// comes back in the envelope's membershipId, and later messages for that
+// room carry it too. Memberships count against SFU_WS_MAX_MEMBERSHIPS and
+// share their connection's rate limits. A membership ends when it leaves,
+// its room closes or its join fails; closing the WebSocket suspends every
+// membership's session, like the connection's own.
+
+// routeMemberships hands messages that carry a membershipId to that
+// membership, and creates memberships for joins that ask for one. It runs
+// after rate limiting, which is per connection.
+func (s *SFU) routeMemberships(next messageHandler) messageHandler {
+	return func(client *signaling.Client, message signaling.Message) {
+		if message.MembershipID != "" {
+			m, ok := client.Membership(message.MembershipID)
+			if !ok {
+				client.SendError(404, "Membership not found")
+				return
+			}
+			if message.Type == signaling.MessageTypeJoin {
+				m.SendError(400, "A membership cannot join again; leave it and join a new one")
+				return
+			}
+			next(m, message)
+			s.pruneMembership(m)
+			return
+		}
+		if message.Type != signaling.MessageTypeJoin {
+			next(client, message)
+			return
+		}
+
+		var join joinRequest
+		if err := unmarshalMessageData(message.Data, &join); err != nil {
+			next(client, message) // reported by the join handler
+			return
+		}
+		if inRoom := s.connectionInRoom(client, join.RoomID); inRoom != nil && inRoom != client {
+			client.SendError(409, "Already in this room through a membership")
+			return
+		}
+		if !join.Membership {
+			next(client, message)
+			return
+		}
+		s.joinMembership(client, message, join)
+	}
+}
+
+// joinMembership runs a membership join on a new membership of client,
+// dropping it again if the join fails.
+func (s *SFU) joinMembership(client *signaling.Client, message signaling.Message, join joinRequest) {
+	if s.connectionInRoom(client, join.RoomID) != nil {
+		client.SendError(409, "Already in this room")
+		return
+	}
+	if max := s.config.Media.WSMaxMemberships; len(client.Memberships()) >= max {
+		client.SendError(409, "Too many room memberships on this connection")
+		return
+	}
+	if join.UserID != client.UserID {
+		client.SendError(400, "A membership must join as the connection's user")
+		return
+	}
+
+	b := make([]byte, 4)
+	rand.Read(b)
+	m := client.NewMembership("m_" + hex.EncodeToString(b))
+	s.signalingHub.RegisterClient(m)
+	s.dispatcher.route(m, message)
+	if s.pruneMembership(m) {
+		return
+	}
+
+	// The connection is in a room now, if not its own
+	s.releaseUnjoined(client.ID)
+	s.logger.Info("Membership joined",
+		zap.String("clientID", client.ID),
+		zap.String("membershipID", m.MembershipID()),
+		zap.String("roomID", m.RoomID()),
+	)
+}
+
+// connectionInRoom returns the client, the connection itself or one of its
+// memberships, that is in roomID.
+func (s *SFU) connectionInRoom(client *signaling.Client, roomID string) *signaling.Client {
+	if client.RoomID() == roomID {
+		return client
+	}
+	for _, m := range client.Memberships() {
+		if m.RoomID() == roomID {
+			return m
+		}
+	}
+	return nil
+}
+
+// pruneMembership ends m if it is a membership no longer in a room, as after
+// a leave, a failed join or its room closing. It reports whether m ended.
+func (s *SFU) pruneMembership(m *signaling.Client) bool {
+	if m.Parent() == nil || m.RoomID() != "" {
+		return false
+	}
+	if !m.EndMembership() {
+		return false
+	}
+	s.signalingHub.UnregisterClient(m)
+	s.logger.Debug("Membership ended",
+		zap.String("clientID", m.Parent().ID),
+		zap.String("membershipID", m.MembershipID()),
+	)
+	return true
+}
@@ -0,0 +1,182 @@
+package sfu
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/webrtc/v3"
+)
+
+// sendAs sends a message for membershipID, or for the connection's own room
+// when it is empty.
+func (sc *scriptedClient) sendAs(t *testing.T, membershipID string, typ signaling.MessageType, payload interface{}) {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.ws.WriteJSON(signaling.Message{Type: typ, Data: data, MembershipID: membershipID}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectError reads sc's messages up to the next error and checks its code.
+func expectError(t *testing.T, sc *scriptedClient, what string, code int) {
+	t.Helper()
+	seen := sc.readUntil(t, signaling.MessageTypeError)
+	var e signaling.ErrorMessage
+	if err := json.Unmarshal(seen[len(seen)-1].Data, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Code != code {
+		t.Fatalf("%s: error %d (%s), want %d", what, e.Code, e.Message, code)
+	}
+}
+
+// streams records the publishers whose tracks arrive on a PeerConnection.
+type streams struct {
+	mu   sync.Mutex
+	from map[string]bool
+}
+
+func (s *streams) watch(pc *webrtc.PeerConnection) {
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		s.mu.Lock()
+		s.from[track.StreamID()] = true
+		s.mu.Unlock()
+	})
+}
+
+func (s *streams) only(publisherID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.from) == 1 && s.from[publisherID]
+}
+
+// negotiate offers pc's receive-only audio for membershipID and applies the
+// answer, which must come back for the same membership.
+func negotiate(t *testing.T, sc *scriptedClient, membershipID string, pc *webrtc.PeerConnection) {
+	t.Helper()
+	offerAudio(t, pc)
+	<-webrtc.GatheringCompletePromise(pc)
+	sc.sendAs(t, membershipID, signaling.MessageTypeOffer, signaling.OfferMessage{SDP: pc.LocalDescription().SDP, Type: "offer"})
+	seen := sc.readUntil(t, signaling.MessageTypeAnswer)
+	answer := seen[len(seen)-1]
+	if answer.MembershipID != membershipID {
+		t.Fatalf("answer for membership %q, want %q", answer.MembershipID, membershipID)
+	}
+	var a signaling.AnswerMessage
+	if err := json.Unmarshal(answer.Data, &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: a.SDP}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMembershipsOnOneConnection(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.WSMaxMemberships = 1
+		cfg.Media.PeerDisconnectGrace = 0
+	})
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	publish(t, alice, "alice")
+	carol := ts.join(t, "carol", "room-2", client.Handlers{}, client.JoinOptions{})
+	publish(t, carol, "carol")
+	eventually(t, "both to publish", func() bool {
+		return ts.lookupRoom("room-1").GetTrackCount() == 2 && ts.lookupRoom("room-2").GetTrackCount() == 2
+	})
+
+	// bob's own room, then a membership in a second
+	bob := ts.dialScripted(t, "bob")
+	pc1, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc1.Close()
+	media1 := &streams{from: make(map[string]bool)}
+	media1.watch(pc1)
+	bob.sendAs(t, "", signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "bob", Name: "bob", NoTrickle: true})
+	own := joinResponse(t, bob.readUntil(t, signaling.MessageTypeJoin))
+	if own.MembershipID != "" {
+		t.Fatalf("own room joined as membership %q", own.MembershipID)
+	}
+	negotiate(t, bob, "", pc1)
+
+	bob.sendAs(t, "", signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "bob", Name: "bob", Membership: true})
+	expectError(t, bob, "membership in the connection's room", 409)
+	pc2, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc2.Close()
+	media2 := &streams{from: make(map[string]bool)}
+	media2.watch(pc2)
+	bob.sendAs(t, "", signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-2", UserID: "bob", Name: "bob", NoTrickle: true, Membership: true})
+	seen := bob.readUntil(t, signaling.MessageTypeJoin)
+	joined := joinResponse(t, seen)
+	membership := joined.MembershipID
+	if membership == "" || seen[len(seen)-1].MembershipID != membership {
+		t.Fatalf("membership join answered as %q in an envelope for %q", membership, seen[len(seen)-1].MembershipID)
+	}
+	negotiate(t, bob, membership, pc2)
+
+	// Each room's media arrives on its own PeerConnection
+	eventually(t, "alice's media in room-1 and carol's in room-2", func() bool {
+		return media1.only(alice.PeerID()) && media2.only(carol.PeerID())
+	})
+	room1, room2 := ts.lookupRoom("room-1"), ts.lookupRoom("room-2")
+	p1, ok1 := room1.GetPeerByUserID("bob")
+	p2, ok2 := room2.GetPeerByUserID("bob")
+	if !ok1 || !ok2 || p1.ID != own.PeerID || p2.ID != joined.PeerID || p1 == p2 {
+		t.Fatal("bob is not a separate peer in each room")
+	}
+
+	// A room the connection is already in, a membership over the limit and
+	// an unknown membership are refused
+	bob.sendAs(t, "", signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-2", UserID: "bob", Name: "bob"})
+	expectError(t, bob, "own join of the membership's room", 409)
+	bob.sendAs(t, "", signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-3", UserID: "bob", Name: "bob", Membership: true})
+	expectError(t, bob, "membership over the limit", 409)
+	bob.sendAs(t, "m_unknown", signaling.MessageTypeMediaState, signaling.MediaStateMessage{})
+	expectError(t, bob, "unknown membership", 404)
+
+	// Leaving the membership leaves only its room
+	bob.sendAs(t, membership, signaling.MessageTypeLeave, struct{}{})
+	eventually(t, "bob to leave room-2", func() bool {
+		_, in := room2.GetPeerByUserID("bob")
+		return !in
+	})
+	if _, in := room1.GetPeerByUserID("bob"); !in {
+		t.Fatal("leaving the membership took bob out of room-1")
+	}
+	bob.sendAs(t, membership, signaling.MessageTypeMediaState, signaling.MediaStateMessage{})
+	expectError(t, bob, "ended membership", 404)
+	if pc1.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		t.Fatal("room-1's PeerConnection closed")
+	}
+
+	// A new membership counts in place of the old, and closing the
+	// WebSocket takes bob out of both rooms and suspends both sessions
+	bob.sendAs(t, "", signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-2", UserID: "bob", Name: "bob", Membership: true})
+	again := joinResponse(t, bob.readUntil(t, signaling.MessageTypeJoin))
+	if again.MembershipID == "" || again.MembershipID == membership {
+		t.Fatalf("rejoined as membership %q", again.MembershipID)
+	}
+	bob.hangUp()
+	eventually(t, "bob to leave both rooms", func() bool {
+		_, in1 := room1.GetPeerByUserID("bob")
+		_, in2 := room2.GetPeerByUserID("bob")
+		return !in1 && !in2
+	})
+	eventually(t, "only alice and carol to be connected", func() bool { return ts.signalingHub.ClientCount() == 2 })
+	for _, id := range []string{own.SessionID, again.SessionID} {
+		if !ts.sessionSuspended(t, id) {
+			t.Errorf("session %s not suspended", id)
+		}
+	}
+}
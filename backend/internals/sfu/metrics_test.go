@@ -0,0 +1,85 @@
+package sfu
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// roomPeersGauge reads sfu_room_peers for roomID without creating the
+// series; ok is false when there is none.
+func roomPeersGauge(t *testing.T, roomID string) (value float64, ok bool) {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(appmetrics.RoomPeers)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "room" && label.GetValue() == roomID {
+					return m.GetGauge().GetValue(), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// hangUp drops the connection without a leave or a close frame, as a closed
+// tab or a dead network does.
+func (sc *scriptedClient) hangUp() {
+	sc.conn.Conn.Close()
+}
+
+func (ts *testServer) joinScripted(t *testing.T, userID, roomID string) *scriptedClient {
+	t.Helper()
+	sc := ts.dialScripted(t, userID)
+	sc.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: roomID, UserID: userID, Name: userID})
+	sc.readUntil(t, signaling.MessageTypeJoin)
+	return sc
+}
+
+func TestPeerGaugesAfterHardDisconnect(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Metrics.RoomPeers = true
+		cfg.Media.PeerDisconnectGrace = 200 * time.Millisecond
+	})
+
+	alice := ts.joinScripted(t, "alice", "room-1")
+	bob := ts.joinScripted(t, "bob", "room-1")
+	eventually(t, "two peers counted", func() bool {
+		n, _ := roomPeersGauge(t, "room-1")
+		return testutil.ToFloat64(ts.metrics.ActivePeers) == 2 && n == 2
+	})
+
+	// Neither sends a leave; the peers go when their grace runs out
+	alice.hangUp()
+	bob.hangUp()
+	eventually(t, "the peers to be removed", func() bool {
+		n, _ := roomPeersGauge(t, "room-1")
+		return testutil.ToFloat64(ts.metrics.ActivePeers) == 0 && n == 0
+	})
+	if rooms := testutil.ToFloat64(ts.metrics.ActiveRooms); rooms != 1 {
+		t.Fatalf("%v rooms counted, want the empty room", rooms)
+	}
+
+	// The series goes with the room
+	if code := ts.api(t, http.MethodDelete, "/api/rooms/room-1", "", testAdminKey, nil); code != http.StatusNoContent {
+		t.Fatalf("DELETE room: %d", code)
+	}
+	if _, ok := roomPeersGauge(t, "room-1"); ok {
+		t.Fatal("sfu_room_peers still has a series for the deleted room")
+	}
+	if rooms := testutil.ToFloat64(ts.metrics.ActiveRooms); rooms != 0 {
+		t.Fatalf("%v rooms counted after the delete", rooms)
+	}
+}
@@ -0,0 +1,101 @@
+package sfu
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+func TestSelfMonitorEchoesMedia(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) { cfg.Media.SelfMonitor = true })
+	echoed := make(chan []byte, 256)
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{
+		OnTrack: func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+			if track.StreamID() != room.MonitorStreamID {
+				return
+			}
+			for {
+				pkt, _, err := track.ReadRTP()
+				if err != nil {
+					return
+				}
+				select {
+				case echoed <- pkt.Payload:
+				default:
+				}
+			}
+		},
+	})
+
+	// Every sample carries its number, so what comes back can be matched
+	// to what was sent
+	mic, err := client.NewSampleTrack(webrtc.MimeTypeOpus, "alice-mic", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.PublishTrack(mic); err != nil {
+		t.Fatal(err)
+	}
+	publish(t, alice, "alice")
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for n := uint32(0); ; n++ {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				sample := []byte{0xfc, 0, 0, 0, 0, 0xa5, 0x5a}
+				binary.BigEndian.PutUint32(sample[1:], n)
+				mic.WriteSample(media.Sample{Data: sample, Duration: 20 * time.Millisecond})
+			}
+		}
+	}()
+	rm := ts.lookupRoom("room-1")
+	eventually(t, "alice's tracks", func() bool { return rm.GetTrackCount() == 3 })
+	handle, _ := rm.TrackHandle("alice-mic")
+	camera, _ := rm.TrackHandle("alice-vp8")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ack, err := alice.Subscribe(ctx, handle)
+	if err != nil || len(ack.Subscribed) != 1 {
+		t.Fatalf("monitoring the mic: %+v, %v", ack, err)
+	}
+	// One monitor at a time
+	if ack, err := alice.Subscribe(ctx, camera); err != nil || ack.Rejected[camera] != room.ErrMonitorLimit.Error() {
+		t.Fatalf("monitoring the camera too: %+v, %v", ack, err)
+	}
+
+	// The samples come back byte for byte, in the order they were sent
+	var last int64 = -1
+	for i := 0; i < 25; i++ {
+		select {
+		case payload := <-echoed:
+			if len(payload) != 7 || payload[0] != 0xfc || payload[5] != 0xa5 || payload[6] != 0x5a {
+				t.Fatalf("echoed payload %x is not a sample that was sent", payload)
+			}
+			n := int64(binary.BigEndian.Uint32(payload[1:]))
+			if n <= last {
+				t.Fatalf("sample %d echoed after sample %d", n, last)
+			}
+			last = n
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d samples echoed, want 25", i)
+		}
+	}
+}
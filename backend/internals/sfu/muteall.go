@@ -0,0 +1,169 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// The host mutes everyone with mute-all (see room/muteall.go): each
+// participant's mic is turned off as a moderator's mute would, and the room
+// is told with mute-all-changed. A hard mute-all also refuses self-unmutes
+// until it is lifted; moderators and exempt users are never held by it.
+// An admin does the same with /api/rooms/{id}/mute-all.
+
+// handleMuteAllMessage lets the host mute, or stop muting, the room.
+func (s *SFU) handleMuteAllMessage(client *signaling.Client, message signaling.Message, req signaling.MuteAllMessage) {
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+	if !isModerator(rm, p) {
+		s.auditClient(client, auditRoomMuteAll, rm.ID, audit.ResultDenied, nil)
+		client.SendError(403, "Moderator role required")
+		return
+	}
+	exempt, err := muteAllExempt(rm, req.ExemptPeerIDs)
+	if err != nil {
+		client.SendErrorMessage(signaling.ErrorMessage{
+			Code: 404, Message: err.Error(), Reason: signaling.ErrorReasonPeerNotFound,
+		})
+		return
+	}
+
+	ctx, cancel := s.messageContext()
+	defer cancel()
+	changed := s.applyMuteAll(ctx, rm, req, append(exempt, p.UserID), p.UserID)
+	s.auditClient(client, auditRoomMuteAll, rm.ID, audit.ResultSuccess, muteAllAuditDetails(changed))
+}
+
+// handleRoomMuteAllAPI serves /api/rooms/{id}/mute-all: GET returns the
+// room's mute-all and POST mutes all or lifts it.
+func (s *SFU) handleRoomMuteAllAPI(w http.ResponseWriter, r *http.Request, roomID string) {
+	rm := s.lookupRoom(roomID)
+	if rm == nil {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	var resp signaling.MuteAllChangedMessage
+	switch r.Method {
+	case http.MethodGet:
+		resp = muteAllMessage(rm.GetMuteAll(), nil)
+	case http.MethodPost:
+		var req signaling.MuteAllMessage
+		if !s.decodeJSONBody(w, r, &req) {
+			return
+		}
+		exempt, err := muteAllExempt(rm, req.ExemptPeerIDs)
+		if err != nil {
+			s.auditRequest(r, auditRoomMuteAll, roomID, audit.ResultFailure, map[string]string{"reason": err.Error()})
+			writeAPIError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		resp = s.applyMuteAll(r.Context(), rm, req, exempt, s.requestActor(r))
+		s.auditRequest(r, auditRoomMuteAll, roomID, audit.ResultSuccess, muteAllAuditDetails(resp))
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// muteAllExempt returns the user IDs of the exempt peers.
+func muteAllExempt(rm *room.Room, peerIDs []string) ([]string, error) {
+	exempt := make([]string, 0, len(peerIDs)+1)
+	for _, id := range peerIDs {
+		p, ok := rm.GetPeer(id)
+		if !ok {
+			return nil, fmt.Errorf("unknown peer: %s", id)
+		}
+		exempt = append(exempt, p.UserID)
+	}
+	return exempt, nil
+}
+
+// applyMuteAll puts req in force in rm, muting every participant but the
+// exempt users, announces it and saves it with the room's snapshot.
+func (s *SFU) applyMuteAll(ctx context.Context, rm *room.Room, req signaling.MuteAllMessage, exempt []string, by string) signaling.MuteAllChangedMessage {
+	if !req.Enabled {
+		rm.SetMuteAll(nil)
+		changed := muteAllMessage(nil, nil)
+		s.broadcastMuteAll(rm, changed)
+		s.saveRoomSnapshot(ctx, rm)
+		return changed
+	}
+
+	m := &room.MuteAll{Hard: req.Hard, Exempt: exempt, By: by, Since: time.Now()}
+	rm.SetMuteAll(m)
+	var muted []string
+	for _, p := range rm.GetAllPeers() {
+		if p.Observer || p.Viewer || m.Exempts(p.UserID) {
+			continue
+		}
+		s.disarmPushToTalk(p.ID)
+		if !p.GetMediaState().MicEnabled {
+			continue
+		}
+		ms := p.UpdateMediaState(func(ms *peer.MediaState) { ms.MicEnabled = false })
+		s.publishMediaState(p, ms, signaling.MediaStateMuteAll, 0)
+		muted = append(muted, p.ID)
+	}
+
+	changed := muteAllMessage(m, muted)
+	s.broadcastMuteAll(rm, changed)
+	s.saveRoomSnapshot(ctx, rm)
+	return changed
+}
+
+// mutedByMuteAll reports whether a mute-all in rm keeps p from unmuting
+// itself.
+func mutedByMuteAll(rm *room.Room, p *peer.Peer) bool {
+	muted, hard := rm.MutedByMuteAll(p.UserID)
+	return muted && hard && !p.Observer && !isModerator(rm, p)
+}
+
+func muteAllMessage(m *room.MuteAll, muted []string) signaling.MuteAllChangedMessage {
+	if m == nil {
+		return signaling.MuteAllChangedMessage{}
+	}
+	return signaling.MuteAllChangedMessage{
+		Active:        true,
+		Hard:          m.Hard,
+		ExemptUserIDs: m.Exempt,
+		By:            m.By,
+		Since:         &m.Since,
+		MutedPeerIDs:  muted,
+	}
+}
+
+func muteAllAuditDetails(changed signaling.MuteAllChangedMessage) map[string]string {
+	return map[string]string{
+		"enabled": strconv.FormatBool(changed.Active),
+		"hard":    strconv.FormatBool(changed.Hard),
+		"muted":   strconv.Itoa(len(changed.MutedPeerIDs)),
+	}
+}
+
+// broadcastMuteAll announces the room's mute-all.
+func (s *SFU) broadcastMuteAll(rm *room.Room, changed signaling.MuteAllChangedMessage) {
+	data, err := json.Marshal(changed)
+	if err != nil {
+		s.logger.Error("Failed to marshal mute-all", zap.Error(err))
+		return
+	}
+	msg := signaling.Message{Type: signaling.MessageTypeMuteAllChanged, Data: data, Timestamp: time.Now()}
+	s.broadcastToRoom(rm, msg, nil)
+}
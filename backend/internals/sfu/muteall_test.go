@@ -0,0 +1,193 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// readPayload reads sc's messages up to the next of type typ and decodes it
+// into v.
+func readPayload(t *testing.T, sc *scriptedClient, typ signaling.MessageType, v interface{}) {
+	t.Helper()
+	seen := sc.readUntil(t, typ)
+	if err := json.Unmarshal(seen[len(seen)-1].Data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setMic asks to turn the mic of peerID, or of sc's own peer when it is
+// empty, on or off.
+func setMic(t *testing.T, sc *scriptedClient, peerID string, on bool) {
+	t.Helper()
+	sc.sendAs(t, "", signaling.MessageTypeMediaState, signaling.MediaStateRequest{PeerID: peerID, MicEnabled: &on})
+}
+
+// expectMic reads sc's media-states up to the next about peerID and checks
+// its mic.
+func expectMic(t *testing.T, sc *scriptedClient, peerID string, on bool) signaling.MediaStateMessage {
+	t.Helper()
+	for {
+		var ms signaling.MediaStateMessage
+		readPayload(t, sc, signaling.MessageTypeMediaState, &ms)
+		if ms.PeerID != peerID {
+			continue
+		}
+		if ms.MicEnabled != on {
+			t.Fatalf("media-state %+v, want the mic on %v", ms, on)
+		}
+		return ms
+	}
+}
+
+func TestMuteAll(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	host := ts.joinScripted(t, "host", "room-1")
+	alice := ts.joinScripted(t, "alice", "room-1")
+	ts.joinScripted(t, "bob", "room-1")
+	carol := ts.joinScripted(t, "carol", "room-1")
+	mod := ts.joinScripted(t, "mod", "room-1")
+	rm, hostPeer := ts.getRoomAndPeer("room-1", "host")
+	_, alicePeer := ts.getRoomAndPeer("room-1", "alice")
+	_, bobPeer := ts.getRoomAndPeer("room-1", "bob")
+	_, carolPeer := ts.getRoomAndPeer("room-1", "carol")
+	_, modPeer := ts.getRoomAndPeer("room-1", "mod")
+	modPeer.SetMetadata("role", roleModerator)
+
+	// Only a moderator mutes the room
+	alice.sendAs(t, "", signaling.MessageTypeMuteAll, signaling.MuteAllMessage{Enabled: true})
+	expectError(t, alice, "mute-all by alice", http.StatusForbidden)
+	host.sendAs(t, "", signaling.MessageTypeMuteAll, signaling.MuteAllMessage{Enabled: true, ExemptPeerIDs: []string{"nobody"}})
+	expectError(t, host, "mute-all exempting an unknown peer", http.StatusNotFound)
+
+	// A soft mute-all mutes everyone but the host and the exempt, and lets
+	// them unmute themselves
+	host.sendAs(t, "", signaling.MessageTypeMuteAll, signaling.MuteAllMessage{Enabled: true, ExemptPeerIDs: []string{carolPeer.ID}})
+	var changed signaling.MuteAllChangedMessage
+	readPayload(t, alice, signaling.MessageTypeMuteAllChanged, &changed)
+	slices.Sort(changed.MutedPeerIDs)
+	want := []string{alicePeer.ID, bobPeer.ID, modPeer.ID}
+	slices.Sort(want)
+	if !changed.Active || changed.Hard || changed.By != "host" || !slices.Equal(changed.MutedPeerIDs, want) {
+		t.Fatalf("mute-all announced as %+v, want %v muted", changed, want)
+	}
+	if !slices.Contains(changed.ExemptUserIDs, "carol") || !slices.Contains(changed.ExemptUserIDs, "host") {
+		t.Fatalf("exempt %v", changed.ExemptUserIDs)
+	}
+	if !hostPeer.GetMediaState().MicEnabled || !carolPeer.GetMediaState().MicEnabled || alicePeer.GetMediaState().MicEnabled {
+		t.Fatal("mute-all muted the wrong peers")
+	}
+	setMic(t, alice, "", true)
+	expectMic(t, alice, alicePeer.ID, true)
+
+	// A hard one mutes alice again and holds her
+	host.sendAs(t, "", signaling.MessageTypeMuteAll, signaling.MuteAllMessage{Enabled: true, Hard: true})
+	var hard signaling.MuteAllChangedMessage
+	readPayload(t, alice, signaling.MessageTypeMuteAllChanged, &hard)
+	if !hard.Hard || !slices.Contains(hard.MutedPeerIDs, alicePeer.ID) {
+		t.Fatalf("hard mute-all announced as %+v", hard)
+	}
+	setMic(t, alice, "", true)
+	var refusal signaling.ErrorMessage
+	readPayload(t, alice, signaling.MessageTypeError, &refusal)
+	if refusal.Code != http.StatusForbidden || refusal.Reason != signaling.ErrorReasonHardMuted {
+		t.Fatalf("self-unmute refused with %+v", refusal)
+	}
+	if alicePeer.GetMediaState().MicEnabled {
+		t.Fatal("alice unmuted herself under a hard mute-all")
+	}
+
+	// Muting herself again is not an unmute, and is allowed
+	setMic(t, alice, "", false)
+	expectMic(t, alice, alicePeer.ID, false)
+
+	// This one exempts only the host: carol is held too, while a moderator
+	// may still unmute itself
+	expectMic(t, mod, modPeer.ID, false) // muted by the soft one
+	setMic(t, mod, "", true)
+	expectMic(t, mod, modPeer.ID, true)
+	setMic(t, carol, "", true)
+	var carolRefusal signaling.ErrorMessage
+	readPayload(t, carol, signaling.MessageTypeError, &carolRefusal)
+	if carolRefusal.Reason != signaling.ErrorReasonHardMuted {
+		t.Fatalf("carol's self-unmute refused with %+v", carolRefusal)
+	}
+
+	// A moderator may unmute a participant by name
+	setMic(t, mod, alicePeer.ID, true)
+	if ms := expectMic(t, alice, alicePeer.ID, true); ms.Reason != signaling.MediaStateModerator {
+		t.Fatalf("alice unmuted with %+v", ms)
+	}
+
+	// A participant joining meanwhile starts muted and is told why
+	dave := ts.dialScripted(t, "dave")
+	dave.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "dave", Name: "dave"})
+	seen := dave.readUntil(t, signaling.MessageTypeRoomState)
+	if !joinResponse(t, seen).MicMuted {
+		t.Fatal("dave joined unmuted under a hard mute-all")
+	}
+	var roomState signaling.RoomStateMessage
+	if err := json.Unmarshal(seen[len(seen)-1].Data, &roomState); err != nil {
+		t.Fatal(err)
+	}
+	if roomState.MuteAll == nil || !roomState.MuteAll.Hard {
+		t.Fatalf("dave's room-state has mute-all %+v", roomState.MuteAll)
+	}
+
+	// Lifted, everyone may unmute again
+	host.sendAs(t, "", signaling.MessageTypeMuteAll, signaling.MuteAllMessage{})
+	var lifted signaling.MuteAllChangedMessage
+	readPayload(t, carol, signaling.MessageTypeMuteAllChanged, &lifted)
+	if lifted.Active {
+		t.Fatalf("lifting announced as %+v", lifted)
+	}
+	setMic(t, carol, "", true)
+	expectMic(t, carol, carolPeer.ID, true)
+	if rm.GetMuteAll() != nil {
+		t.Fatal("the mute-all was not lifted")
+	}
+}
+
+func TestMuteAllAPI(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	host := ts.joinScripted(t, "host", "room-1")
+	alice := ts.joinScripted(t, "alice", "room-1")
+	_, hostPeer := ts.getRoomAndPeer("room-1", "host")
+	_, alicePeer := ts.getRoomAndPeer("room-1", "alice")
+
+	// An admin mutes everyone, the host included unless exempted
+	var changed signaling.MuteAllChangedMessage
+	if code := ts.api(t, http.MethodPost, "/api/rooms/room-1/mute-all", `{"enabled":true,"hard":true}`, testAdminKey, &changed); code != http.StatusOK {
+		t.Fatalf("POST mute-all: %d", code)
+	}
+	if len(changed.MutedPeerIDs) != 2 || hostPeer.GetMediaState().MicEnabled {
+		t.Fatalf("POST mute-all returned %+v", changed)
+	}
+	var state signaling.MuteAllChangedMessage
+	if code := ts.api(t, http.MethodGet, "/api/rooms/room-1/mute-all", "", testAdminKey, &state); code != http.StatusOK || !state.Active || !state.Hard {
+		t.Fatalf("GET mute-all: %d, %+v", code, state)
+	}
+
+	// The host, a moderator, may unmute itself; alice may not
+	expectMic(t, host, hostPeer.ID, false)
+	setMic(t, host, "", true)
+	expectMic(t, host, hostPeer.ID, true)
+	setMic(t, alice, "", true)
+	expectError(t, alice, "alice's self-unmute", http.StatusForbidden)
+	if alicePeer.GetMediaState().MicEnabled {
+		t.Fatal("alice unmuted herself")
+	}
+
+	if code := ts.api(t, http.MethodPost, "/api/rooms/room-1/mute-all", `{"enabled":true,"exemptPeerIds":["nobody"]}`, testAdminKey, nil); code != http.StatusNotFound {
+		t.Fatalf("POST exempting an unknown peer: %d", code)
+	}
+	if code := ts.api(t, http.MethodPost, "/api/rooms/room-2/mute-all", `{"enabled":true}`, testAdminKey, nil); code != http.StatusNotFound {
+		t.Fatalf("POST to an unknown room: %d", code)
+	}
+	if code := ts.api(t, http.MethodPost, "/api/rooms/room-1/mute-all", `{"enabled":false}`, testAdminKey, &state); code != http.StatusOK || state.Active {
+		t.Fatalf("lifting: %d, %+v", code, state)
+	}
+}
@@ -0,0 +1,232 @@
+package sfu
+
+import (
+	"encoding/json"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+func (s *SFU) handleOfferMessage(client *signaling.Client, message signaling.Message, offerMsg signaling.OfferMessage) {
+	received := time.Now()
+
+	s.logger.Info("Offer received",
+		zap.String("clientID", client.ID),
+		zap.String("roomID", client.RoomID()),
+		zap.String("userID", client.UserID),
+	)
+
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || p == nil {
+		s.logger.Error("Room or peer not found for offer",
+			zap.String("roomID", client.RoomID()),
+			zap.String("userID", client.UserID),
+		)
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+
+	if offerMsg.NoTrickle {
+		p.DisableTrickle()
+	}
+
+	isRenegotiation := p.Connection.RemoteDescription() != nil
+	s.logger.Info("Processing offer",
+		zap.String("peerID", p.ID),
+		zap.Bool("isRenegotiation", isRenegotiation),
+		zap.String("negotiationID", offerMsg.NegotiationID),
+	)
+
+	offer := webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offerMsg.SDP}
+	if s.config.Media.WebKitCompat {
+		offer = p.AdaptWebKitOffer(offer, s.config.Media.SimulcastEnabled)
+	}
+	if err := p.SetRemoteDescription(offer); err != nil {
+		s.logger.Error("Failed to set remote description", zap.Error(err))
+		if isRenegotiation {
+			// Typically an m-line count/order mismatch after track churn
+			s.requireReconnect(client, rm, p, "remote_description_failed")
+			return
+		}
+		client.SendError(500, "Failed to set remote description")
+		return
+	}
+	p.StartSSRCSimulcast()
+
+	// For initial connection, add existing tracks BEFORE creating the answer
+	// so they're included in the SDP. No renegotiation round-trip needed.
+	// Manually subscribing peers start with no tracks.
+	if !isRenegotiation && !p.ManualSubscribe {
+		rm.AddExistingTracksToPeer(p)
+	}
+
+	answer, err := p.Connection.CreateAnswer(nil)
+	if err != nil {
+		s.logger.Error("Failed to create answer", zap.Error(err))
+		if isRenegotiation {
+			s.requireReconnect(client, rm, p, "create_answer_failed")
+			return
+		}
+		client.SendError(500, "Failed to create answer")
+		return
+	}
+
+	if err := p.Connection.SetLocalDescription(answer); err != nil {
+		s.logger.Error("Failed to set local description", zap.Error(err))
+		if isRenegotiation {
+			s.requireReconnect(client, rm, p, "local_description_failed")
+			return
+		}
+		client.SendError(500, "Failed to set local description")
+		return
+	}
+	answer = s.completeLocalDescription(p, answer)
+	p.WatchIncomingTracks(s.config.Media.TrackStallTimeout)
+
+	answerData, err := json.Marshal(signaling.AnswerMessage{
+		SDP: answer.SDP, Type: answer.Type.String(), PeerID: p.ID,
+	})
+	if err != nil {
+		client.SendError(500, "Internal server error")
+		return
+	}
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypeAnswer, Data: answerData, Timestamp: time.Now(),
+	})
+	s.logger.Info("Answer sent",
+		zap.String("peerID", p.ID),
+		zap.String("clientID", client.ID),
+	)
+	// Only now, so what the first exchange queued is asked for after it
+	p.MarkNegotiated()
+	if isRenegotiation {
+		s.completeNegotiation(p, offerMsg.NegotiationID)
+	} else {
+		appmetrics.ObserveJoinAnswer(subscriptionMode(p), len(answer.SDP), time.Since(received))
+		if p.Resumed {
+			s.sendSubscriptionSnapshot(client, rm, p)
+		}
+	}
+}
+
+// sendSubscriptionSnapshot tells a resumed peer's client which publisher
+// and track each forwarded m-line of its new connection carries.
+func (s *SFU) sendSubscriptionSnapshot(client *signaling.Client, rm *room.Room, p *peer.Peer) {
+	data, err := json.Marshal(signaling.SubscriptionSnapshotMessage{Subscriptions: rm.SubscriptionSnapshot(p)})
+	if err != nil {
+		s.logger.Error("Failed to marshal subscription snapshot", zap.Error(err))
+		return
+	}
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypeSubscriptionSnapshot, Data: data, Timestamp: time.Now(),
+	})
+}
+
+func (s *SFU) handleAnswerMessage(client *signaling.Client, message signaling.Message, answerMsg signaling.AnswerMessage) {
+
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+
+	answer := webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answerMsg.SDP}
+	if err := p.SetRemoteDescription(answer); err != nil {
+		s.logger.Error("Failed to set remote description for answer", zap.Error(err))
+		s.requireReconnect(client, rm, p, "remote_answer_failed")
+		return
+	}
+	p.WatchIncomingTracks(s.config.Media.TrackStallTimeout)
+}
+
+// requireReconnect handles a negotiation failure the peer cannot recover from
+// in place: it tells the client to rejoin from scratch and tears down the
+// wedged peer so the rejoin starts with a fresh PeerConnection.
+func (s *SFU) requireReconnect(client *signaling.Client, rm *room.Room, p *peer.Peer, reason string) {
+	if err := p.RollbackRemoteDescription(); err != nil {
+		s.logger.Debug("Rollback failed", zap.String("peerID", p.ID), zap.Error(err))
+	}
+
+	s.logger.Warn("Negotiation unrecoverable, requiring client reconnect",
+		zap.String("peerID", p.ID),
+		zap.String("reason", reason),
+	)
+
+	data, err := json.Marshal(signaling.ReconnectRequiredMessage{
+		PeerID: p.ID,
+		Reason: reason,
+	})
+	if err == nil {
+		client.SendMessage(signaling.Message{
+			Type: signaling.MessageTypeReconnectRequired, Data: data, Timestamp: time.Now(),
+		})
+	}
+
+	if rm != nil {
+		rm.RemovePeer(p.ID)
+	}
+}
+
+func (s *SFU) handleICECandidateMessage(client *signaling.Client, message signaling.Message, iceMsg signaling.ICECandidateMessage) {
+
+	_, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+
+	candidate := webrtc.ICECandidateInit{
+		Candidate:     iceMsg.Candidate,
+		SDPMid:        &iceMsg.SDPMid,
+		SDPMLineIndex: func() *uint16 { v := uint16(iceMsg.SDPMLineIndex); return &v }(),
+	}
+
+	if err := p.AddICECandidate(candidate); err != nil {
+		s.logger.Debug("Failed to add ICE candidate", zap.Error(err))
+	}
+}
+
+func (s *SFU) handleICERestartRequest(client *signaling.Client) {
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if p == nil {
+		client.SendError(404, "Peer not found")
+		return
+	}
+
+	if err := s.sendICERestartOffer(client, rm, p, peer.ICERestartByClient); err != nil {
+		s.logger.Error("ICE restart failed", zap.Error(err))
+		client.SendError(500, "ICE restart failed")
+	}
+}
+
+// handleIsAllowRenegotiationMessage checks if client-initiated renegotiation is allowed
+// This prevents "glare" where both sides try to renegotiate simultaneously
+func (s *SFU) handleIsAllowRenegotiationMessage(client *signaling.Client) {
+	_, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if p == nil {
+		client.SendError(404, "Peer not found")
+		return
+	}
+
+	allowed := p.IsAllowNegotiation()
+
+	data, err := json.Marshal(signaling.AllowRenegotiationMessage{Allowed: allowed})
+	if err != nil {
+		client.SendError(500, "Internal server error")
+		return
+	}
+
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypeAllowRenegotiation, Data: data, Timestamp: time.Now(),
+	})
+
+	s.logger.Debug("IsAllowRenegotiation check",
+		zap.String("peerID", p.ID),
+		zap.Bool("allowed", allowed),
+	)
+}
@@ -0,0 +1,75 @@
+package sfu
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/netmark"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+// markedUDPSockets counts the process's UDP sockets whose traffic class is
+// tos and SO_PRIORITY is priority.
+func markedUDPSockets(t *testing.T, tos, priority int) int {
+	t.Helper()
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skipf("cannot list open files: %v", err)
+	}
+	marked := 0
+	for _, e := range entries {
+		fd, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		if typ, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TYPE); err != nil || typ != syscall.SOCK_DGRAM {
+			continue
+		}
+		v4, err4 := syscall.GetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_TOS)
+		v6, err6 := syscall.GetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS)
+		if (err4 != nil || v4 != tos) && (err6 != nil || v6 != tos) {
+			continue
+		}
+		if prio, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_PRIORITY); err == nil && prio == priority {
+			marked++
+		}
+	}
+	return marked
+}
+
+// packetMarking fetches the packetMarking section of /health.
+func (ts *testServer) packetMarking(t *testing.T) netmark.Status {
+	t.Helper()
+	var health struct {
+		PacketMarking netmark.Status `json:"packetMarking"`
+	}
+	if code := ts.api(t, http.MethodGet, "/health", "", "", &health); code != http.StatusOK {
+		t.Fatalf("GET /health: %d", code)
+	}
+	return health.PacketMarking
+}
+
+// The sockets ICE opens for a peer's media are marked as configured.
+func TestMediaSocketsMarked(t *testing.T) {
+	const tos, priority = 46 << 2, 5
+	if ts := newTestServer(t, nil, nil); ts.packetMarking(t) != (netmark.Status{}) {
+		t.Fatalf("marking reported without a DSCP: %+v", ts.packetMarking(t))
+	}
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.WebRTC.DSCP = "EF"
+		cfg.WebRTC.SocketPriority = priority
+	})
+	if status := ts.packetMarking(t); !status.Active || status.DSCP != 46 || status.Priority != priority {
+		t.Fatalf("packetMarking %+v", status)
+	}
+
+	before := markedUDPSockets(t, tos, priority)
+	ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	if after := markedUDPSockets(t, tos, priority); after <= before {
+		t.Fatalf("%d marked UDP sockets after alice joined, %d before", after, before)
+	}
+}
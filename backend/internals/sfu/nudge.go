@@ -0,0 +1,128 @@
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// Support can nudge a stuck peer without asking its user to reload:
+// POST /api/rooms/{id}/peers/{peerId}/renegotiate sends it a renegotiate at
+// once, bypassing the throttle, and .../ice-restart sends it an ICE restart
+// offer drawn from its restart budget. Both need the peer's signaling
+// connection and are recorded in the room's event ring (see room/nudge.go).
+
+// peerNudgeResponse is the body of a peer's renegotiate and ice-restart
+// actions. Queued is false when the message could not be queued on the
+// peer's signaling connection, or a renegotiation is held until the peer's
+// connection is restored.
+type peerNudgeResponse struct {
+	Queued          bool   `json:"queued"`
+	ConnectionState string `json:"connectionState"`
+}
+
+// handleRoomPeerActionAPI serves POST /api/rooms/{id}/peers/{peerId}/{action}.
+func (s *SFU) handleRoomPeerActionAPI(w http.ResponseWriter, r *http.Request, roomID, peerID, action string) {
+	auditAction := auditPeerNegotiate
+	switch action {
+	case "renegotiate":
+	case "ice-restart":
+		auditAction = auditPeerICERestart
+	default:
+		writeAPIError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	rm := s.lookupRoom(roomID)
+	if rm == nil {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+	p, ok := rm.GetPeer(peerID)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "Peer not found")
+		return
+	}
+	client := s.peerClient(p)
+	if client == nil {
+		s.auditPeerRequest(r, auditAction, roomID, peerID, audit.ResultFailure, map[string]string{"reason": "not_connected"})
+		writeAPIErrorCode(w, http.StatusConflict, "peer_not_connected", "Peer has no signaling connection", nil)
+		return
+	}
+
+	var queued bool
+	if action == "renegotiate" {
+		queued = rm.ForceRenegotiation(p)
+	} else {
+		var (
+			retryAfter time.Duration
+			err        error
+		)
+		queued, retryAfter, err = s.offerICERestart(client, p, peer.ICERestartByAdmin)
+		if err != nil {
+			s.refuseAdminICERestart(w, r, rm, p, retryAfter, err)
+			return
+		}
+		outcome := "sent"
+		if !queued {
+			outcome = "not-queued"
+		}
+		rm.RecordICERestart(p, outcome)
+	}
+
+	s.auditPeerRequest(r, auditAction, roomID, peerID, audit.ResultSuccess, map[string]string{
+		"userId": p.UserID,
+		"queued": strconv.FormatBool(queued),
+	})
+	s.logger.Info("Peer nudged through the admin API",
+		zap.String("roomID", roomID),
+		zap.String("peerID", peerID),
+		zap.String("action", action),
+		zap.Bool("queued", queued),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(peerNudgeResponse{
+		Queued:          queued,
+		ConnectionState: p.Connection.ConnectionState().String(),
+	})
+}
+
+// refuseAdminICERestart answers an ICE restart of p that failed or that its
+// budget refused. Unlike a refusal over signaling, the peer is left alone.
+func (s *SFU) refuseAdminICERestart(w http.ResponseWriter, r *http.Request, rm *room.Room, p *peer.Peer, retryAfter time.Duration, err error) {
+	outcome, reason := "failed", "failed"
+	switch {
+	case errors.Is(err, peer.ErrICERestartCooldown):
+		outcome, reason = "cooldown", signaling.ErrorReasonICERestartCooldown
+	case errors.Is(err, peer.ErrICERestartBudgetExhausted):
+		outcome, reason = "budget-exhausted", "ice_restart_budget_exhausted"
+	}
+	rm.RecordICERestart(p, outcome)
+	s.auditPeerRequest(r, auditPeerICERestart, rm.ID, p.ID, audit.ResultFailure, map[string]string{"reason": reason})
+
+	switch outcome {
+	case "cooldown":
+		writeAPIErrorCode(w, http.StatusTooManyRequests, reason, err.Error(), retryDetails{
+			Retryable:    true,
+			RetryAfterMs: max(retryAfter.Milliseconds(), 1),
+		})
+	case "budget-exhausted":
+		writeAPIErrorCode(w, http.StatusConflict, reason, err.Error(), nil)
+	default:
+		s.logger.Error("Admin ICE restart failed", zap.String("peerID", p.ID), zap.Error(err))
+		writeAPIError(w, http.StatusInternalServerError, "Failed to restart ICE")
+	}
+}
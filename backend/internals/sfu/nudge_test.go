@@ -0,0 +1,156 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestPeerNudgeAPI(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) { cfg.Media.PeerDisconnectGrace = 10 * time.Second })
+	alice := ts.joinScripted(t, "alice", "room-1")
+	ts.joinScripted(t, "bob", "room-1")
+	ts.joinScripted(t, "carol", "room-1")
+	dave := ts.joinScripted(t, "dave", "room-1")
+	rm, alicePeer := ts.getRoomAndPeer("room-1", "alice")
+	_, bobPeer := ts.getRoomAndPeer("room-1", "bob")
+	_, carolPeer := ts.getRoomAndPeer("room-1", "carol")
+	_, davePeer := ts.getRoomAndPeer("room-1", "dave")
+
+	type refusal struct {
+		Error struct {
+			Code    string       `json:"code"`
+			Details retryDetails `json:"details"`
+		} `json:"error"`
+	}
+	nudge := func(roomID, peerID, action string, wantStatus int) []byte {
+		t.Helper()
+		resp, data := ts.rawAPI(t, http.MethodPost, "/api/rooms/"+roomID+"/peers/"+peerID+"/"+action, "", "")
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("%s of %s in %s: %d %s, want %d", action, peerID, roomID, resp.StatusCode, data, wantStatus)
+		}
+		return data
+	}
+	refused := func(data []byte) refusal {
+		t.Helper()
+		var r refusal
+		if err := json.Unmarshal(data, &r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	// lastNudge returns the newest nudge of peerID in the event ring.
+	lastNudge := func(kind, peerID string) room.RoomEvent {
+		t.Helper()
+		events, _ := rm.EventsSince(0)
+		for i := len(events) - 1; i >= 0; i-- {
+			if events[i].Type == kind && events[i].PeerID == peerID {
+				return events[i]
+			}
+		}
+		t.Fatalf("no %s event for %s", kind, peerID)
+		return room.RoomEvent{}
+	}
+
+	nudge("room-2", alicePeer.ID, "renegotiate", http.StatusNotFound)
+	nudge("room-1", "peer-unknown", "renegotiate", http.StatusNotFound)
+	nudge("room-1", alicePeer.ID, "wiggle", http.StatusNotFound)
+
+	// A peer that never negotiated has no transport to restart. The failed
+	// restart still counts against its budget, so alice's has no cooldown
+	alicePeer.SetICERestartBudget(peer.ICERestartBudget{})
+	r := refused(nudge("room-1", alicePeer.ID, "ice-restart", http.StatusInternalServerError))
+	if e := lastNudge(room.EventICERestartForced, alicePeer.ID); e.Detail != "failed" || r.Error.Code != "internal" {
+		t.Fatalf("failed restart answered %+v, recorded as %+v", r, e)
+	}
+
+	// Once it has, an ICE restart offer reaches its signaling connection
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	offerAudio(t, pc)
+	alice.pipeline(t, signaling.MessageTypeOffer, signaling.OfferMessage{SDP: pc.LocalDescription().SDP, Type: "offer"})
+	readAnswer(t, alice, pc)
+	var nudged peerNudgeResponse
+	if err := json.Unmarshal(nudge("room-1", alicePeer.ID, "ice-restart", http.StatusOK), &nudged); err != nil {
+		t.Fatal(err)
+	}
+	if !nudged.Queued {
+		t.Fatal("the ICE restart offer was not queued")
+	}
+	alice.readUntil(t, signaling.MessageTypeICERestartOffer)
+	if e := lastNudge(room.EventICERestartForced, alicePeer.ID); e.Detail != "sent" || e.UserID != "alice" {
+		t.Fatalf("ICE restart recorded as %+v", e)
+	}
+
+	// A renegotiation is recorded with whether it went out or is held
+	if err := json.Unmarshal(nudge("room-1", alicePeer.ID, "renegotiate", http.StatusOK), &nudged); err != nil {
+		t.Fatal(err)
+	}
+	want := "held"
+	if nudged.Queued {
+		want = "sent"
+	}
+	if e := lastNudge(room.EventRenegotiationForced, alicePeer.ID); e.Detail != want {
+		t.Fatalf("renegotiation recorded as %+v, queued %v", e, nudged.Queued)
+	}
+
+	// During the cooldown the restart is refused with when to try again
+	bobPeer.SetICERestartBudget(peer.ICERestartBudget{Cooldown: time.Minute})
+	if _, err := bobPeer.BeginICERestart(peer.ICERestartByClient); err != nil {
+		t.Fatal(err)
+	}
+	r = refused(nudge("room-1", bobPeer.ID, "ice-restart", http.StatusTooManyRequests))
+	if r.Error.Code != signaling.ErrorReasonICERestartCooldown || !r.Error.Details.Retryable ||
+		r.Error.Details.RetryAfterMs <= 0 || r.Error.Details.RetryAfterMs > time.Minute.Milliseconds() {
+		t.Fatalf("cooldown refused with %+v", r)
+	}
+	if e := lastNudge(room.EventICERestartForced, bobPeer.ID); e.Detail != "cooldown" {
+		t.Fatalf("cooldown recorded as %+v", e)
+	}
+
+	// An exhausted budget refuses it for good, and leaves the peer in place
+	carolPeer.SetICERestartBudget(peer.ICERestartBudget{MaxRestarts: 1, Window: time.Minute})
+	if _, err := carolPeer.BeginICERestart(peer.ICERestartByClient); err != nil {
+		t.Fatal(err)
+	}
+	r = refused(nudge("room-1", carolPeer.ID, "ice-restart", http.StatusConflict))
+	if r.Error.Code != "ice_restart_budget_exhausted" || r.Error.Details.Retryable {
+		t.Fatalf("exhausted budget refused with %+v", r)
+	}
+	if e := lastNudge(room.EventICERestartForced, carolPeer.ID); e.Detail != "budget-exhausted" {
+		t.Fatalf("exhausted budget recorded as %+v", e)
+	}
+	if _, ok := rm.GetPeer(carolPeer.ID); !ok {
+		t.Fatal("carol removed for an operator's restart")
+	}
+
+	// A peer held for a resume has no signaling connection to nudge over,
+	// and nothing is recorded for it
+	dave.hangUp()
+	eventually(t, "dave to be detached", func() bool { return ts.isDetached(davePeer.ID) })
+	_, before := rm.EventsSince(0)
+	for _, action := range []string{"renegotiate", "ice-restart"} {
+		if r := refused(nudge("room-1", davePeer.ID, action, http.StatusConflict)); r.Error.Code != "peer_not_connected" {
+			t.Fatalf("%s of a detached peer refused with %+v", action, r)
+		}
+	}
+	events, _ := rm.EventsSince(before)
+	for _, e := range events {
+		if e.PeerID == davePeer.ID && (e.Type == room.EventRenegotiationForced || e.Type == room.EventICERestartForced) {
+			t.Fatalf("refused nudge recorded as %+v", e)
+		}
+	}
+	if got := davePeer.ICERestarts().Recent; got != 0 {
+		t.Fatalf("%d restarts drawn from dave's budget", got)
+	}
+}
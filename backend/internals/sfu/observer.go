@@ -0,0 +1,115 @@
+package sfu
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+)
+
+// Invite roles that grant hidden observer access.
+const (
+	roleObserver = "observer"
+	roleAdmin    = "admin"
+)
+
+func canObserve(role string) bool {
+	return role == roleObserver || role == roleAdmin
+}
+
+// roomPeerInfo is one entry of the admin peers listing.
+type roomPeerInfo struct {
+	PeerID    string      `json:"peerId"`
+	UserID    string      `json:"userId"`
+	Name      string      `json:"name"`
+	Observer  bool        `json:"observer"`
+	Viewer    bool        `json:"viewer,omitempty"`
+	Connected bool        `json:"connected"`
+	Role      interface{} `json:"role,omitempty"`
+	// Seconds spent speaking, carried across reconnects
+	TalkTimeSeconds float64 `json:"talkTimeSeconds"`
+	// Negotiated tracks that have not produced RTP
+	StalledTracks []peer.StalledTrack `json:"stalledTracks,omitempty"`
+	// Set while the peer is considered idle and due to be disconnected
+	IdleSince *time.Time `json:"idleSince,omitempty"`
+	// ICE candidate policy, "all" or "relay", and the pair in use once
+	// connected
+	TransportPolicy string             `json:"transportPolicy"`
+	CandidatePair   *candidatePairInfo `json:"candidatePair,omitempty"`
+	// Standing against the ICE restart budget
+	ICERestarts peer.ICERestartState `json:"iceRestarts"`
+	// Caps on the layers the peer receives, by track or group handle
+	ReceivePreferences map[string]room.ReceivePreference `json:"receivePreferences,omitempty"`
+}
+
+// handleRoomPeersAPI serves GET /api/rooms/{id}/peers. Unlike room-state it
+// lists every peer, including hidden observers, a page at a time (see
+// listing.go); state filters on "connected" or "disconnected". Renames go
+// to handleRoomPeerAPI.
+func (s *SFU) handleRoomPeersAPI(w http.ResponseWriter, r *http.Request, roomID string) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	lq, err := parseListQuery(r.URL.Query(), false, "name", "userId")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.roomsMu.RLock()
+	rm, exists := s.rooms[roomID]
+	s.roomsMu.RUnlock()
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	peers := rm.GetAllPeers()
+	entries := make([]listEntry, 0, len(peers))
+	for _, p := range peers {
+		info := s.roomPeerInfo(rm, p)
+		state := "disconnected"
+		if info.Connected {
+			state = "connected"
+		}
+		entries = append(entries, listEntry{
+			id: info.PeerID, name: info.Name, userID: info.UserID, state: state, value: info,
+		})
+	}
+
+	writeListPage(w, "peers", lq.page(entries), map[string]interface{}{
+		"peerCount":     rm.GetPeerCount(),
+		"observerCount": rm.GetObserverCount(),
+	})
+}
+
+func (s *SFU) roomPeerInfo(rm *room.Room, p *peer.Peer) roomPeerInfo {
+	role, _ := p.GetMetadata("role")
+	return roomPeerInfo{
+		PeerID:    p.ID,
+		UserID:    p.UserID,
+		Name:      p.GetName(),
+		Observer:  p.Observer,
+		Viewer:    p.Viewer,
+		Connected: p.IsConnected(),
+		Role:      role,
+
+		TalkTimeSeconds: rm.TalkTime(p.UserID).Seconds(),
+		StalledTracks:   p.StalledTracks(),
+		IdleSince:       idleSince(p),
+		TransportPolicy: p.ICETransportPolicy().String(),
+		CandidatePair:   selectedCandidatePair(p),
+		ICERestarts:     p.ICERestarts(),
+
+		ReceivePreferences: rm.ReceivePreferences(p.ID),
+	}
+}
+
+func idleSince(p *peer.Peer) *time.Time {
+	if t := p.IdleSince(); !t.IsZero() {
+		return &t
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package sfu
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+// messageLog records the signaling messages a session receives.
+type messageLog struct {
+	mu       sync.Mutex
+	messages []signaling.Message
+}
+
+func (l *messageLog) record(msg signaling.Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, msg)
+}
+
+// mentioning returns the types of the messages whose data contains s.
+func (l *messageLog) mentioning(s string) []signaling.MessageType {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var types []signaling.MessageType
+	for _, msg := range l.messages {
+		if strings.Contains(string(msg.Data), s) {
+			types = append(types, msg.Type)
+		}
+	}
+	return types
+}
+
+func TestObserverHiddenFromParticipants(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+
+	var seen messageLog
+	ts.join(t, "alice", "room-1", client.Handlers{OnMessage: seen.record}, client.JoinOptions{})
+	bob := ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{})
+	publish(t, bob, "bob")
+
+	var invite struct {
+		Token string `json:"token"`
+	}
+	if code := ts.api(t, http.MethodPost, "/api/rooms/room-1/invites", `{"role":"observer"}`, testAdminKey, &invite); code != http.StatusCreated {
+		t.Fatalf("create invite: status %d", code)
+	}
+	received := newTrackCounter()
+	observer := ts.join(t, "recorder", "room-1", client.Handlers{}, client.JoinOptions{
+		InviteToken: invite.Token,
+		Observer:    true,
+		OnTrack:     received.onTrack,
+	})
+	if !observer.Info().Observer {
+		t.Fatal("join reply does not mark the observer")
+	}
+
+	// The observer gets every track
+	eventually(t, "the observer to receive bob's tracks", func() bool {
+		return received.receiving(bob.PeerID())
+	})
+
+	// Alice hears of bob, never of the observer
+	time.Sleep(200 * time.Millisecond)
+	if got := seen.mentioning("bob"); len(got) == 0 {
+		t.Fatal("alice was not told about bob")
+	}
+	for _, id := range []string{"recorder", observer.PeerID()} {
+		if got := seen.mentioning(id); len(got) != 0 {
+			t.Fatalf("alice learned of the observer %s from %v", id, got)
+		}
+	}
+
+	// Over REST the room shows two participants; only the admin key counts
+	// and lists the observer
+	var info map[string]interface{}
+	if code := ts.api(t, http.MethodGet, "/api/rooms/room-1", "", "", &info); code != http.StatusOK {
+		t.Fatalf("room info: status %d", code)
+	}
+	if _, shown := info["observerCount"]; info["peerCount"] != float64(2) || shown {
+		t.Fatalf("room info without the admin key %v", info)
+	}
+	var rooms struct {
+		Rooms []map[string]interface{} `json:"rooms"`
+	}
+	for _, path := range []string{"/api/rooms", "/api/cluster/rooms"} {
+		if code := ts.api(t, http.MethodGet, path, "", "", &rooms); code != http.StatusOK || len(rooms.Rooms) != 1 {
+			t.Fatalf("%s: status %d, %v", path, code, rooms.Rooms)
+		}
+		if _, shown := rooms.Rooms[0]["observerCount"]; shown {
+			t.Fatalf("%s without the admin key counts the observer", path)
+		}
+	}
+	info = nil
+	if code := ts.api(t, http.MethodGet, "/api/rooms/room-1", "", testAdminKey, &info); code != http.StatusOK {
+		t.Fatalf("room info: status %d", code)
+	}
+	if info["observerCount"] != float64(1) {
+		t.Fatalf("room info with the admin key observerCount %v, want 1", info["observerCount"])
+	}
+	if code := ts.api(t, http.MethodGet, "/api/rooms/room-1/peers", "", "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("peers without the admin key: status %d, want 401", code)
+	}
+	var peers struct {
+		Peers []roomPeerInfo `json:"peers"`
+	}
+	if code := ts.api(t, http.MethodGet, "/api/rooms/room-1/peers", "", testAdminKey, &peers); code != http.StatusOK {
+		t.Fatalf("peers with the admin key: status %d", code)
+	}
+	observers := 0
+	for _, p := range peers.Peers {
+		if p.Observer {
+			observers++
+		}
+	}
+	if len(peers.Peers) != 3 || observers != 1 {
+		t.Fatalf("admin listing %+v, want 3 peers with the observer", peers.Peers)
+	}
+}
+
+// An observer grant is kept by a resumed session of the same room only, so
+// a session taken from one room does not make a hidden observer in another.
+func TestObserverGrantStaysInItsRoom(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	ts.joinScripted(t, "alice", "room-1")
+	granted := ts.dialScripted(t, "recorder")
+	granted.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{
+		RoomID: "room-2", UserID: "recorder", Name: "recorder", Observer: true,
+		InviteToken: ts.createInvite(t, "room-2", roleObserver),
+	})
+	info := joinResponse(t, granted.readUntil(t, signaling.MessageTypeJoin))
+	if !info.Observer {
+		t.Fatal("the invite did not grant observing room-2")
+	}
+
+	resume := func(roomID string) signaling.ErrorMessage {
+		t.Helper()
+		sc := ts.dialScripted(t, "recorder")
+		sc.pipeline(t, signaling.MessageTypeJoin, struct {
+			signaling.JoinMessage
+			SessionID    string `json:"sessionId"`
+			SessionToken string `json:"sessionToken"`
+		}{
+			JoinMessage:  signaling.JoinMessage{RoomID: roomID, UserID: "recorder", Name: "recorder", Observer: true},
+			SessionID:    info.SessionID,
+			SessionToken: info.SessionToken,
+		})
+		return joinReply(t, sc, "recorder's resume into "+roomID)
+	}
+	if e := resume("room-1"); e.Code != http.StatusForbidden {
+		t.Fatalf("observing room-1 with room-2's session answered %+v", e)
+	}
+	if _, ok := ts.lookupRoom("room-1").GetPeerByUserID("recorder"); ok {
+		t.Fatal("recorder is in room-1")
+	}
+	if e := resume("room-2"); e.Code != 0 {
+		t.Fatalf("resuming in room-2 answered %+v", e)
+	}
+}
@@ -0,0 +1,519 @@
+package sfu
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/netmark"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/version"
+	"github.com/adityaadpandey/sfu-go/internals/webhook"
+)
+
+// The OpenAPI 3 document served at /api/openapi.json is rendered once at
+// startup. Schemas of the request and response types are generated from the
+// Go types the handlers decode and encode, so they follow the code; paths
+// and the listing envelopes are described here by hand.
+
+type jsonObject = map[string]interface{}
+
+// openAPISchemaNames names the generated schemas of types whose Go names
+// would be unclear in the document.
+var openAPISchemaNames = map[reflect.Type]string{
+	reflect.TypeOf(createRoomRequest{}):                "CreateRoomRequest",
+	reflect.TypeOf(createInviteRequest{}):              "CreateInviteRequest",
+	reflect.TypeOf(roomMessageRequest{}):               "RoomMessageRequest",
+	reflect.TypeOf(drainRequest{}):                     "DrainRequest",
+	reflect.TypeOf(captureRequest{}):                   "CaptureRequest",
+	reflect.TypeOf(captureInfo{}):                      "Capture",
+	reflect.TypeOf(roomPeerInfo{}):                     "Peer",
+	reflect.TypeOf(stalledTrackInfo{}):                 "RoomStalledTrack",
+	reflect.TypeOf(inviteResponse{}):                   "Invite",
+	reflect.TypeOf(invitesResponse{}):                  "InviteList",
+	reflect.TypeOf(auditEventResponse{}):               "AuditEvent",
+	reflect.TypeOf(auditEventsResponse{}):              "AuditEventList",
+	reflect.TypeOf(capturesResponse{}):                 "CaptureList",
+	reflect.TypeOf(debugLogsResponse{}):                "LogEntryList",
+	reflect.TypeOf(signaling.TrackPrioritiesMessage{}): "TrackPriorities",
+	reflect.TypeOf(apiError{}):                         "APIError",
+	reflect.TypeOf(room.RoomStats{}):                   "Room",
+	reflect.TypeOf(roomDetail{}):                       "RoomDetail",
+	reflect.TypeOf(clusterRoom{}):                      "ClusterRoom",
+	reflect.TypeOf(remoteRoom{}):                       "RemoteRoom",
+	reflect.TypeOf(iceConfigResponse{}):                "ICEConfig",
+	reflect.TypeOf(statsResponse{}):                    "Stats",
+	reflect.TypeOf(drainStatusResponse{}):              "DrainStatus",
+	reflect.TypeOf(healthResponse{}):                   "Health",
+	reflect.TypeOf(readiness{}):                        "Readiness",
+	reflect.TypeOf(webhookStreamResponse{}):            "WebhookStream",
+	reflect.TypeOf(webhook.Recording{}):                "Recording",
+	reflect.TypeOf(peerNudgeResponse{}):                "PeerNudge",
+	reflect.TypeOf(netmark.Status{}):                   "PacketMarking",
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	jsonMarshaler  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler  = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// openAPISchemas collects the schemas referenced from the document.
+type openAPISchemas map[string]jsonObject
+
+// ref returns a reference to the schema of v's type, generating it first.
+func (g openAPISchemas) ref(v interface{}) jsonObject {
+	return g.schemaFor(reflect.TypeOf(v))
+}
+
+func (g openAPISchemas) schemaFor(t reflect.Type) jsonObject {
+	switch {
+	case t == timeType:
+		return jsonObject{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return jsonObject{}
+	case t.Kind() != reflect.Struct && t.Kind() != reflect.Pointer &&
+		(t.Implements(jsonMarshaler) || t.Implements(textMarshaler)):
+		return jsonObject{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaFor(t.Elem())
+	case reflect.Bool:
+		return jsonObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return jsonObject{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonObject{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return jsonObject{"type": "number"}
+	case reflect.String:
+		return jsonObject{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return jsonObject{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return jsonObject{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		name := openAPISchemaNames[t]
+		if name == "" {
+			name = strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		}
+		if _, done := g[name]; !done {
+			g[name] = nil // breaks cycles
+			g[name] = jsonObject{"type": "object", "properties": g.properties(t)}
+		}
+		return jsonObject{"$ref": "#/components/schemas/" + name}
+	}
+	return jsonObject{}
+}
+
+// properties lists the JSON fields of struct type t, flattening embedded
+// structs the way encoding/json does.
+func (g openAPISchemas) properties(t reflect.Type) jsonObject {
+	props := jsonObject{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for k, v := range g.properties(ft) {
+				props[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schemaFor(f.Type)
+	}
+	return props
+}
+
+// object is a hand-written object schema.
+func object(props jsonObject) jsonObject {
+	return jsonObject{"type": "object", "properties": props}
+}
+
+func arrayOf(items jsonObject) jsonObject {
+	return jsonObject{"type": "array", "items": items}
+}
+
+func schemaRef(name string) jsonObject {
+	return jsonObject{"$ref": "#/components/schemas/" + name}
+}
+
+var (
+	stringSchema   = jsonObject{"type": "string"}
+	integerSchema  = jsonObject{"type": "integer"}
+	dateTimeSchema = jsonObject{"type": "string", "format": "date-time"}
+)
+
+// openAPIOperation describes one method of a path.
+type openAPIOperation struct {
+	tag, summary string
+	params       []jsonObject
+	body         jsonObject // request body schema, if any
+	status       int        // success status
+	response     jsonObject // success body schema; nil for no content
+	errors       []int
+	admin        bool // guarded by Server.AdminKey
+}
+
+func (op openAPIOperation) render() jsonObject {
+	responses := jsonObject{}
+	success := jsonObject{"description": http.StatusText(op.status)}
+	if op.response != nil {
+		success["content"] = jsonObject{"application/json": jsonObject{"schema": op.response}}
+	}
+	responses[strconv.Itoa(op.status)] = success
+	for _, status := range op.errors {
+		responses[strconv.Itoa(status)] = jsonObject{"$ref": "#/components/responses/Error"}
+	}
+
+	out := jsonObject{
+		"tags":      []string{op.tag},
+		"summary":   op.summary,
+		"responses": responses,
+	}
+	if len(op.params) > 0 {
+		out["parameters"] = op.params
+	}
+	if op.body != nil {
+		out["requestBody"] = jsonObject{
+			"required": true,
+			"content":  jsonObject{"application/json": jsonObject{"schema": op.body}},
+		}
+	}
+	if op.admin {
+		out["security"] = []jsonObject{{"apiKey": []string{}}, {"bearer": []string{}}}
+	}
+	return out
+}
+
+func pathParam(name, description string) jsonObject {
+	return jsonObject{"name": name, "in": "path", "required": true, "description": description, "schema": stringSchema}
+}
+
+func queryParam(name, description string, schema jsonObject) jsonObject {
+	return jsonObject{"name": name, "in": "query", "description": description, "schema": schema}
+}
+
+// buildOpenAPI assembles the OpenAPI document of the REST API.
+func (s *SFU) buildOpenAPI() jsonObject {
+	g := openAPISchemas{}
+	roomID := pathParam("id", "Room ID")
+	const (
+		badRequest   = http.StatusBadRequest
+		unauthorized = http.StatusUnauthorized
+		notFound     = http.StatusNotFound
+		notAllowed   = http.StatusMethodNotAllowed
+		conflict     = http.StatusConflict
+		tooLarge     = http.StatusRequestEntityTooLarge
+		badType      = http.StatusUnsupportedMediaType
+		tooMany      = http.StatusTooManyRequests
+		internal     = http.StatusInternalServerError
+		unavailable  = http.StatusServiceUnavailable
+		noCapacity   = http.StatusInsufficientStorage
+		redirect     = http.StatusTemporaryRedirect
+	)
+	withBody := []int{badRequest, tooLarge, badType}
+
+	g["Error"] = object(jsonObject{"error": g.ref(apiError{})})
+
+	// Pagination, filters and sorting of the listings (see listing.go)
+	pageParams := []jsonObject{
+		queryParam("limit", "Most items returned (default 100, at most 1000)", jsonObject{"type": "integer", "minimum": 1, "maximum": maxListLimit}),
+		queryParam("offset", "Items to skip", jsonObject{"type": "integer", "minimum": 0}),
+		queryParam("cursor", "nextCursor of the previous page, instead of offset", stringSchema),
+		queryParam("order", "Sort order", jsonObject{"type": "string", "enum": []string{"asc", "desc"}}),
+		queryParam("namePrefix", "Only items whose name starts with this", stringSchema),
+	}
+	roomListParams := append([]jsonObject{
+		queryParam("sort", "Sort key (default createdAt)", jsonObject{"type": "string", "enum": []string{"createdAt", "peerCount"}}),
+		queryParam("state", "Only rooms in this state; rooms on other instances have none", stringSchema),
+		queryParam("minPeers", "Only rooms with at least this many peers", jsonObject{"type": "integer", "minimum": 0}),
+		queryParam("maxPeers", "Only rooms with at most this many peers", jsonObject{"type": "integer", "minimum": 0}),
+		queryParam("createdAfter", "Only rooms created after this time", dateTimeSchema),
+	}, pageParams...)
+	pageFields := func(key string, items jsonObject, extra jsonObject) jsonObject {
+		fields := jsonObject{
+			key:          arrayOf(items),
+			"total":      integerSchema,
+			"limit":      integerSchema,
+			"offset":     integerSchema,
+			"nextCursor": stringSchema,
+		}
+		for k, v := range extra {
+			fields[k] = v
+		}
+		return object(fields)
+	}
+
+	paths := map[string]map[string]openAPIOperation{
+		"/api/rooms": {
+			"get": {tag: "rooms", summary: "List a page of the rooms on this instance", status: 200,
+				params: roomListParams, errors: []int{badRequest},
+				response: pageFields("rooms", g.ref(room.RoomStats{}), nil)},
+			"post": {tag: "rooms", summary: "Create a room; idempotent when an id is given", status: 200,
+				body: g.ref(createRoomRequest{}), response: g.ref(room.RoomStats{}),
+				errors: append(withBody, redirect, conflict, tooMany, unavailable, noCapacity)},
+		},
+		"/api/rooms/{id}": {
+			"get": {tag: "rooms", summary: "Get a room with its tracks, settings and talk time; observerCount only with the admin key", status: 200,
+				params: []jsonObject{roomID}, response: g.ref(roomDetail{}), errors: []int{notFound}},
+			"patch": {tag: "rooms", summary: "Lock the room against new participants, or unlock it; the room is told with room-lock-changed", status: 200, admin: true,
+				params: []jsonObject{roomID}, body: g.ref(signaling.LockRoomMessage{}),
+				response: g.ref(room.RoomStats{}), errors: append(withBody, unauthorized, notFound)},
+			"delete": {tag: "rooms", summary: "Close a room", status: 204, admin: true,
+				params: []jsonObject{roomID, queryParam("reason", "host-ended to tell clients the host ended the room", stringSchema)},
+				errors: []int{unauthorized, notFound}},
+		},
+		"/api/rooms/{id}/peers": {
+			"get": {tag: "peers", summary: "List a page of every peer, including hidden observers", status: 200, admin: true,
+				params: append([]jsonObject{roomID,
+					queryParam("sort", "Sort key (default name)", jsonObject{"type": "string", "enum": []string{"name", "userId"}}),
+					queryParam("state", "Only peers in this state", jsonObject{"type": "string", "enum": []string{"connected", "disconnected"}}),
+				}, pageParams...),
+				errors: []int{badRequest, unauthorized, notFound},
+				response: pageFields("peers", g.ref(roomPeerInfo{}), jsonObject{
+					"peerCount":     integerSchema,
+					"observerCount": integerSchema,
+				})},
+		},
+		"/api/rooms/{id}/peers/{peerId}": {
+			"patch": {tag: "peers", summary: "Rename a peer; the room is told with peer-updated", status: 200, admin: true,
+				params: []jsonObject{roomID, pathParam("peerId", "Peer ID")}, body: g.ref(signaling.UpdateNameMessage{}),
+				response: g.ref(roomPeerInfo{}), errors: append(withBody, unauthorized, notFound)},
+		},
+		"/api/rooms/{id}/peers/{peerId}/renegotiate": {
+			"post": {tag: "peers", summary: "Send the peer a renegotiate at once, bypassing the throttle", status: 200, admin: true,
+				params: []jsonObject{roomID, pathParam("peerId", "Peer ID")}, response: g.ref(peerNudgeResponse{}),
+				errors: []int{unauthorized, notFound, conflict}},
+		},
+		"/api/rooms/{id}/peers/{peerId}/ice-restart": {
+			"post": {tag: "peers", summary: "Send the peer an ICE restart offer, drawn from its restart budget", status: 200, admin: true,
+				params: []jsonObject{roomID, pathParam("peerId", "Peer ID")}, response: g.ref(peerNudgeResponse{}),
+				errors: []int{unauthorized, notFound, conflict, tooMany, internal}},
+		},
+		"/api/rooms/{id}/priorities": {
+			"get": {tag: "rooms", summary: "Get simulcast layer priorities", status: 200, admin: true,
+				params: []jsonObject{roomID}, response: g.ref(signaling.TrackPrioritiesMessage{}), errors: []int{unauthorized, notFound}},
+			"put": {tag: "rooms", summary: "Replace simulcast layer priorities", status: 200, admin: true,
+				params: []jsonObject{roomID}, body: g.ref(signaling.TrackPrioritiesMessage{}),
+				response: g.ref(signaling.TrackPrioritiesMessage{}), errors: append(withBody, unauthorized, notFound)},
+			"patch": {tag: "rooms", summary: "Merge simulcast layer priorities", status: 200, admin: true,
+				params: []jsonObject{roomID}, body: g.ref(signaling.TrackPrioritiesMessage{}),
+				response: g.ref(signaling.TrackPrioritiesMessage{}), errors: append(withBody, unauthorized, notFound)},
+		},
+		"/api/rooms/{id}/settings": {
+			"get": {tag: "rooms", summary: "Get room settings", status: 200, admin: true,
+				params: []jsonObject{roomID}, response: g.ref(room.RoomSettings{}), errors: []int{unauthorized, notFound}},
+			"patch": {tag: "rooms", summary: "Merge room settings; the mode cannot change", status: 200, admin: true,
+				params: []jsonObject{roomID}, body: g.ref(room.RoomSettings{}),
+				response: g.ref(room.RoomSettings{}), errors: append(withBody, unauthorized, notFound)},
+		},
+		"/api/rooms/{id}/host": {
+			"get": {tag: "rooms", summary: "Get the room's host", status: 200, admin: true,
+				params: []jsonObject{roomID}, response: g.ref(signaling.HostChangedMessage{}), errors: []int{unauthorized, notFound}},
+			"patch": {tag: "rooms", summary: "Name a new host; the room is told with host-changed", status: 200, admin: true,
+				params: []jsonObject{roomID}, body: g.ref(hostRequest{}),
+				response: g.ref(signaling.HostChangedMessage{}), errors: append(withBody, unauthorized, notFound)},
+		},
+		"/api/rooms/{id}/mute-all": {
+			"get": {tag: "rooms", summary: "Get the room's mute-all", status: 200, admin: true,
+				params: []jsonObject{roomID}, response: g.ref(signaling.MuteAllChangedMessage{}), errors: []int{unauthorized, notFound}},
+			"post": {tag: "rooms", summary: "Mute every participant but the exempt peers, or lift the mute-all; the room is told with mute-all-changed", status: 200, admin: true,
+				params: []jsonObject{roomID}, body: g.ref(signaling.MuteAllMessage{}),
+				response: g.ref(signaling.MuteAllChangedMessage{}), errors: append(withBody, unauthorized, notFound)},
+		},
+		"/api/rooms/{id}/spotlight": {
+			"get": {tag: "rooms", summary: "Get the spotlighted participant", status: 200, admin: true,
+				params: []jsonObject{roomID}, response: g.ref(signaling.SpotlightChangedMessage{}), errors: []int{unauthorized, notFound}},
+			"put": {tag: "rooms", summary: "Spotlight a participant, or clear the spotlight with an empty peerId; the room is told with spotlight-changed", status: 200, admin: true,
+				params: []jsonObject{roomID}, body: g.ref(signaling.SpotlightMessage{}),
+				response: g.ref(signaling.SpotlightChangedMessage{}), errors: append(withBody, unauthorized, notFound)},
+		},
+		"/api/rooms/{id}/time-limit": {
+			"get": {tag: "rooms", summary: "Get the room's time limit", status: 200, admin: true,
+				params: []jsonObject{roomID}, response: g.ref(timeLimitResponse{}), errors: []int{unauthorized, notFound}},
+			"patch": {tag: "rooms", summary: "Extend the room's time limit", status: 200, admin: true,
+				params: []jsonObject{roomID}, body: g.ref(signaling.ExtendTimeLimitMessage{}),
+				response: g.ref(timeLimitResponse{}), errors: append(withBody, unauthorized, notFound, conflict)},
+		},
+		"/api/rooms/{id}/messages": {
+			"post": {tag: "rooms", summary: "Broadcast a payload to every peer's data channel", status: 200, admin: true,
+				params: []jsonObject{roomID}, body: g.ref(roomMessageRequest{}),
+				response: g.ref(room.BroadcastResult{}), errors: append(withBody, unauthorized, notFound, internal)},
+		},
+		"/api/rooms/{id}/capture": {
+			"post": {tag: "admin", summary: "Start a debug packet capture of a peer's or track's RTP", status: 201, admin: true,
+				params: []jsonObject{roomID}, body: g.ref(captureRequest{}), response: g.ref(captureInfo{}),
+				errors: append(withBody, unauthorized, notFound, conflict, internal, unavailable)},
+		},
+		"/api/rooms/{id}/live": {
+			"get": {tag: "admin", summary: "Stream the room's quality, speaker, bitrate and events as Server-Sent Events", status: 200, admin: true,
+				params: []jsonObject{roomID}, response: jsonObject{"type": "string"},
+				errors: []int{unauthorized, notFound, tooMany, unavailable}},
+		},
+		"/api/rooms/{id}/invites": {
+			"get": {tag: "invites", summary: "List outstanding invites", status: 200, admin: true,
+				params: []jsonObject{roomID}, errors: []int{badRequest, unauthorized, internal, unavailable},
+				response: g.ref(invitesResponse{})},
+			"post": {tag: "invites", summary: "Create an invite", status: 201, admin: true,
+				params: []jsonObject{roomID}, body: g.ref(createInviteRequest{}),
+				response: g.ref(inviteResponse{}), errors: append(withBody, unauthorized, internal, unavailable)},
+		},
+		"/api/rooms/{id}/invites/{token}": {
+			"delete": {tag: "invites", summary: "Revoke an invite", status: 204, admin: true,
+				params: []jsonObject{roomID, pathParam("token", "Invite token")},
+				errors: []int{badRequest, unauthorized, notFound, internal, unavailable}},
+		},
+		"/api/cluster/rooms": {
+			"get": {tag: "rooms", summary: "List a page of the rooms across every instance sharing Redis", status: 200,
+				params: roomListParams, errors: []int{badRequest},
+				response: pageFields("rooms", jsonObject{"oneOf": []jsonObject{g.ref(clusterRoom{}), g.ref(remoteRoom{})}},
+					jsonObject{"instanceId": stringSchema})},
+		},
+		"/api/audit": {
+			"get": {tag: "admin", summary: "Recent audited actions on this instance, newest first", status: 200, admin: true,
+				params: []jsonObject{
+					queryParam("roomId", "Only events of this room", stringSchema),
+					queryParam("limit", "Most events returned (default 100)", jsonObject{"type": "integer", "minimum": 1}),
+				},
+				response: g.ref(auditEventsResponse{}),
+				errors:   []int{badRequest, unauthorized, unavailable}},
+		},
+		"/api/captures": {
+			"get": {tag: "admin", summary: "Debug packet captures, newest first", status: 200, admin: true,
+				params:   []jsonObject{queryParam("roomId", "Only captures of this room started by this instance", stringSchema)},
+				response: g.ref(capturesResponse{}),
+				errors:   []int{unauthorized, unavailable}},
+		},
+		"/api/webhooks/stream": {
+			"get": {tag: "admin", summary: "The durable webhook stream and how far delivery is behind", status: 200, admin: true,
+				response: g.ref(webhookStreamResponse{}),
+				errors:   []int{unauthorized, unavailable}},
+			"post": {tag: "admin", summary: "Trim the durable webhook stream, undelivered events included", status: 200, admin: true,
+				body:     g.ref(webhookTrimRequest{}),
+				response: g.ref(webhookStreamResponse{}),
+				errors:   append(withBody, unauthorized, unavailable)},
+		},
+		"/api/captures/{captureId}": {
+			"get": {tag: "admin", summary: "Download a finished capture file (pcap or rtpdump)", status: 200, admin: true,
+				params:   []jsonObject{pathParam("captureId", "Capture ID")},
+				response: jsonObject{"type": "string", "format": "binary"},
+				errors:   []int{unauthorized, notFound, conflict, unavailable}},
+			"delete": {tag: "admin", summary: "Delete a capture, stopping it if running", status: 204, admin: true,
+				params: []jsonObject{pathParam("captureId", "Capture ID")},
+				errors: []int{unauthorized, notFound, internal, unavailable}},
+		},
+		"/api/recordings/{recordingId}": {
+			"get": {tag: "admin", summary: "The latest lifecycle state of a recording (a capture), to reconcile missed recording webhooks", status: 200, admin: true,
+				params:   []jsonObject{pathParam("recordingId", "Recording ID, the capture ID")},
+				response: g.ref(webhook.Recording{}),
+				errors:   []int{unauthorized, notFound, unavailable}},
+		},
+		"/api/ice-config": {
+			"get": {tag: "clients", summary: "ICE servers for clients, healthiest first", status: 200,
+				response: g.ref(iceConfigResponse{})},
+		},
+		"/api/stats": {
+			"get": {tag: "admin", summary: "Snapshot of the instance", status: 200, admin: true,
+				errors: []int{unauthorized}, response: g.ref(statsResponse{})},
+		},
+		"/api/config": {
+			"get": {tag: "admin", summary: "Effective configuration with secrets redacted", status: 200, admin: true,
+				errors:   []int{unauthorized},
+				response: object(jsonObject{"fingerprint": stringSchema, "config": jsonObject{"type": "object"}})},
+		},
+		"/api/openapi.json": {
+			"get": {tag: "clients", summary: "This document", status: 200, response: jsonObject{"type": "object"}},
+		},
+		"/drain": {
+			"get": {tag: "admin", summary: "Drain status", status: 200, admin: true,
+				errors: []int{unauthorized}, response: g.ref(drainStatusResponse{})},
+			"post": {tag: "admin", summary: "Start draining or move the deadline; the body is optional", status: 200, admin: true,
+				body: g.ref(drainRequest{}), errors: append(withBody, unauthorized), response: g.ref(drainStatusResponse{})},
+			"delete": {tag: "admin", summary: "Cancel draining", status: 200, admin: true,
+				errors: []int{unauthorized}, response: g.ref(drainStatusResponse{})},
+		},
+		"/debug/logs": {
+			"get": {tag: "admin", summary: "Recent log entries of every level from the in-memory ring, oldest first", status: 200, admin: true,
+				params: []jsonObject{
+					queryParam("roomId", "Only entries with this roomID field", stringSchema),
+					queryParam("peerId", "Only entries with this peerID field", stringSchema),
+					queryParam("sinceSec", "Only entries of the last this many seconds", jsonObject{"type": "integer", "minimum": 1}),
+					queryParam("limit", "Most entries returned, the newest (default 1000)", jsonObject{"type": "integer", "minimum": 1}),
+				},
+				errors:   []int{badRequest, unauthorized, unavailable},
+				response: g.ref(debugLogsResponse{})},
+		},
+		s.config.Server.HealthPath: {
+			"get": {tag: "probes", summary: "Liveness, Redis and drain status, build info", status: 200,
+				response: g.ref(healthResponse{})},
+		},
+		s.config.Server.ReadyPath: {
+			"get": {tag: "probes", summary: "Readiness; 503 at the room limit or while draining", status: 200,
+				response: g.ref(readiness{})},
+		},
+	}
+	renderedPaths := jsonObject{}
+	for path, methods := range paths {
+		item := jsonObject{}
+		for method, op := range methods {
+			// Every endpoint rejects other methods the same way.
+			op.errors = append(op.errors, notAllowed)
+			item[method] = op.render()
+		}
+		renderedPaths[path] = item
+	}
+
+	return jsonObject{
+		"openapi": "3.0.3",
+		"info": jsonObject{
+			"title":   "SFU REST API",
+			"version": version.Version,
+			"description": "Errors use one envelope, {\"error\":{\"code\",\"message\",\"details\"}}. " +
+				"Request bodies must be application/json.",
+		},
+		"servers": []jsonObject{{"url": s.config.Server.BasePath + "/"}},
+		"paths":   renderedPaths,
+		"components": jsonObject{
+			"schemas": g,
+			"responses": jsonObject{
+				"Error": jsonObject{
+					"description": "Error",
+					"content":     jsonObject{"application/json": jsonObject{"schema": schemaRef("Error")}},
+				},
+			},
+			"securitySchemes": jsonObject{
+				"apiKey": jsonObject{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer": jsonObject{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// handleOpenAPI serves GET /api/openapi.json.
+func (s *SFU) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.openAPI)
+}
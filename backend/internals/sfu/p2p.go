@@ -0,0 +1,186 @@
+package sfu
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// In a room that allows it (RoomSettings.P2PAllowed), two participants can
+// connect directly instead of through the SFU. As soon as a room has exactly
+// two participants, no observers and no recording, both get
+// p2p-offer-permitted naming the other; they negotiate their own
+// PeerConnection with p2p-relay messages, which the SFU forwards between the
+// two without reading them. When the room stops qualifying (a third
+// participant or an observer joins, one of the two leaves, or its settings
+// change) both get p2p-fallback and send media through the SFU again.
+//
+// The SFU stays authoritative throughout: both peers remain members of the
+// room with their sessions and SFU PeerConnections, so falling back is only
+// a matter of publishing there again.
+
+// p2pPair is a room's two participants while they may connect directly.
+type p2pPair struct {
+	peers    [2]*peer.Peer
+	limiters map[string]*rate.Limiter // by peer ID, for p2p-relay
+}
+
+// other returns the participant of the pair that is not peerID, or nil if
+// peerID is not in the pair.
+func (pair *p2pPair) other(peerID string) *peer.Peer {
+	switch peerID {
+	case pair.peers[0].ID:
+		return pair.peers[1]
+	case pair.peers[1].ID:
+		return pair.peers[0]
+	}
+	return nil
+}
+
+// p2pCandidates returns the two participants of rm if it qualifies for a
+// direct connection.
+func p2pCandidates(rm *room.Room) (a, b *peer.Peer, ok bool) {
+	settings := rm.GetSettings()
+	if !settings.P2PAllowed || settings.RecordingEnabled || settings.Mode == room.RoomModeBroadcast {
+		return nil, nil, false
+	}
+	peers := rm.GetAllPeers()
+	if len(peers) != 2 || peers[0].Observer || peers[1].Observer {
+		return nil, nil, false
+	}
+	if peers[1].ID < peers[0].ID {
+		peers[0], peers[1] = peers[1], peers[0]
+	}
+	return peers[0], peers[1], true
+}
+
+// updateP2P permits or ends the direct connection of rm's participants after
+// its membership or settings changed.
+func (s *SFU) updateP2P(rm *room.Room) {
+	a, b, ok := p2pCandidates(rm)
+
+	s.p2pMu.Lock()
+	defer s.p2pMu.Unlock()
+
+	current := s.p2pPairs[rm.ID]
+	if current != nil && ok && current.peers[0] == a && current.peers[1] == b {
+		return
+	}
+	if current != nil {
+		delete(s.p2pPairs, rm.ID)
+		reason := signaling.P2PFallbackSFURequired
+		switch n := rm.GetPeerCount(); {
+		case n > 2:
+			reason = signaling.P2PFallbackParticipantJoined
+		case n < 2:
+			reason = signaling.P2PFallbackPeerLeft
+		}
+		for i, p := range current.peers {
+			if _, ok := rm.GetPeer(p.ID); !ok {
+				continue // it left; there is no one to tell
+			}
+			s.sendP2PMessage(p, signaling.MessageTypeP2PFallback, signaling.P2PFallbackMessage{
+				Peer:   current.peers[1-i].ID,
+				Reason: reason,
+			})
+		}
+		s.logger.Info("Direct connection ended",
+			zap.String("roomID", rm.ID),
+			zap.String("reason", reason),
+		)
+	}
+	if !ok {
+		return
+	}
+
+	limit := rate.Limit(s.config.Media.P2PRelayRatePerSec)
+	burst := s.config.Media.P2PRelayRatePerSec
+	if burst <= 0 {
+		limit = rate.Inf // unlimited
+	}
+	pair := &p2pPair{
+		peers: [2]*peer.Peer{a, b},
+		limiters: map[string]*rate.Limiter{
+			a.ID: rate.NewLimiter(limit, burst),
+			b.ID: rate.NewLimiter(limit, burst),
+		},
+	}
+	s.p2pPairs[rm.ID] = pair
+	for i, p := range pair.peers {
+		other := pair.peers[1-i]
+		s.sendP2PMessage(p, signaling.MessageTypeP2POfferPermitted, signaling.P2POfferPermittedMessage{
+			Peer: signaling.PeerInfo{
+				PeerID: other.ID,
+				UserID: other.UserID,
+				Name:   other.GetName(),
+				RoomID: rm.ID,
+			},
+			Initiator: i == 0,
+		})
+	}
+	s.logger.Info("Direct connection permitted",
+		zap.String("roomID", rm.ID),
+		zap.String("initiator", a.ID),
+		zap.String("peer", b.ID),
+	)
+}
+
+// dropP2P forgets the pair of a room that was closed.
+func (s *SFU) dropP2P(roomID string) {
+	s.p2pMu.Lock()
+	delete(s.p2pPairs, roomID)
+	s.p2pMu.Unlock()
+}
+
+func (s *SFU) sendP2PMessage(p *peer.Peer, msgType signaling.MessageType, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	s.sendToPeerClient(p, signaling.Message{Type: msgType, Data: data, Timestamp: time.Now()})
+}
+
+// handleP2PRelayMessage forwards a p2p-relay message's payload to the other
+// participant of the sender's direct connection, named by To.
+func (s *SFU) handleP2PRelayMessage(client *signaling.Client, message signaling.Message) {
+	if message.To == "" || len(message.Data) == 0 {
+		client.SendError(400, "Invalid p2p-relay message")
+		return
+	}
+	if limit := s.config.Media.P2PRelayMaxBytes; limit > 0 && len(message.Data) > limit {
+		client.SendError(413, "p2p-relay payload too large")
+		return
+	}
+
+	s.p2pMu.Lock()
+	pair := s.p2pPairs[client.RoomID()]
+	var target *peer.Peer
+	var limiter *rate.Limiter
+	if pair != nil {
+		target = pair.other(client.PeerID())
+		limiter = pair.limiters[client.PeerID()]
+	}
+	s.p2pMu.Unlock()
+
+	if target == nil || target.ID != message.To {
+		client.SendError(409, "No direct connection with that peer")
+		return
+	}
+	if !limiter.Allow() {
+		client.SendError(429, "p2p-relay rate limit exceeded")
+		return
+	}
+
+	s.sendToPeerClient(target, signaling.Message{
+		Type:      signaling.MessageTypeP2PRelay,
+		Data:      message.Data,
+		Timestamp: time.Now(),
+		From:      client.PeerID(),
+		To:        target.ID,
+	})
+}
@@ -0,0 +1,199 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+// p2pEvents records what a participant is told about direct connections.
+type p2pEvents struct {
+	mu        sync.Mutex
+	permitted []signaling.P2POfferPermittedMessage
+	fallbacks []signaling.P2PFallbackMessage
+	relayed   []string // as from: payload
+	errors    []int
+}
+
+func (e *p2pEvents) handlers() client.Handlers {
+	return client.Handlers{
+		OnP2POfferPermitted: func(m signaling.P2POfferPermittedMessage) {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			e.permitted = append(e.permitted, m)
+		},
+		OnP2PFallback: func(m signaling.P2PFallbackMessage) {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			e.fallbacks = append(e.fallbacks, m)
+		},
+		OnP2PRelay: func(from string, payload json.RawMessage) {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			e.relayed = append(e.relayed, from+": "+string(payload))
+		},
+		OnError: func(err *client.ServerError) {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			e.errors = append(e.errors, err.Code)
+		},
+	}
+}
+
+func (e *p2pEvents) counts() (permitted, fallbacks, relayed, errors int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.permitted), len(e.fallbacks), len(e.relayed), len(e.errors)
+}
+
+func (e *p2pEvents) lastPermitted() signaling.P2POfferPermittedMessage {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.permitted[len(e.permitted)-1]
+}
+
+func (e *p2pEvents) lastFallback() signaling.P2PFallbackMessage {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.fallbacks[len(e.fallbacks)-1]
+}
+
+func (e *p2pEvents) lastError() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.errors[len(e.errors)-1]
+}
+
+func TestP2PUpgradeToThreeParticipants(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.P2PAllowed = true
+		cfg.Media.P2PRelayMaxBytes = 64
+		cfg.Media.P2PRelayRatePerSec = 3
+	})
+	var aliceEvents, bobEvents, carolEvents p2pEvents
+	alice := ts.join(t, "alice", "room-1", aliceEvents.handlers(), client.JoinOptions{})
+	bob := ts.join(t, "bob", "room-1", bobEvents.handlers(), client.JoinOptions{})
+
+	// The second participant makes a pair, each told of the other and
+	// exactly one of them the initiator
+	eventually(t, "both to be permitted", func() bool {
+		a, _, _, _ := aliceEvents.counts()
+		b, _, _, _ := bobEvents.counts()
+		return a == 1 && b == 1
+	})
+	toAlice, toBob := aliceEvents.lastPermitted(), bobEvents.lastPermitted()
+	if toAlice.Peer.PeerID != bob.PeerID() || toBob.Peer.PeerID != alice.PeerID() || toAlice.Peer.Name != "bob" {
+		t.Fatalf("alice told of %+v, bob of %+v", toAlice.Peer, toBob.Peer)
+	}
+	if toAlice.Initiator == toBob.Initiator {
+		t.Fatalf("alice initiator %v, bob initiator %v", toAlice.Initiator, toBob.Initiator)
+	}
+
+	// Signaling is relayed as sent, within the size and rate limits
+	if err := alice.RelayP2P(bob.PeerID(), map[string]string{"sdp": "offer"}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "bob to get alice's offer", func() bool { _, _, n, _ := bobEvents.counts(); return n == 1 })
+	bobEvents.mu.Lock()
+	got := bobEvents.relayed[0]
+	bobEvents.mu.Unlock()
+	if got != alice.PeerID()+`: {"sdp":"offer"}` {
+		t.Fatalf("bob got %s", got)
+	}
+	for _, tc := range []struct {
+		name    string
+		to      string
+		payload interface{}
+		code    int
+	}{
+		{"to a peer outside the pair", "someone", "hi", http.StatusConflict},
+		{"too large", bob.PeerID(), strings.Repeat("x", 64), http.StatusRequestEntityTooLarge},
+		{"over the rate", bob.PeerID(), "hi", http.StatusTooManyRequests},
+	} {
+		_, _, _, before := aliceEvents.counts()
+		// The first relay used up one of the three allowed; two more pass
+		// before the rate limit is hit
+		if tc.code == http.StatusTooManyRequests {
+			for i := 0; i < 2; i++ {
+				if err := alice.RelayP2P(bob.PeerID(), "candidate"); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err := alice.RelayP2P(tc.to, tc.payload); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, tc.name+" to be refused", func() bool { _, _, _, n := aliceEvents.counts(); return n > before })
+		if code := aliceEvents.lastError(); code != tc.code {
+			t.Fatalf("%s: error %d, want %d", tc.name, code, tc.code)
+		}
+	}
+	if _, _, n, _ := bobEvents.counts(); n != 3 {
+		t.Fatalf("bob got %d relayed messages, want 3", n)
+	}
+
+	// A third participant sends both back to the SFU, and is not offered a
+	// direct connection itself
+	carol := ts.join(t, "carol", "room-1", carolEvents.handlers(), client.JoinOptions{})
+	eventually(t, "both to fall back", func() bool {
+		_, a, _, _ := aliceEvents.counts()
+		_, b, _, _ := bobEvents.counts()
+		return a == 1 && b == 1
+	})
+	if fb := aliceEvents.lastFallback(); fb.Reason != signaling.P2PFallbackParticipantJoined || fb.Peer != bob.PeerID() {
+		t.Fatalf("alice fell back with %+v", fb)
+	}
+	if fb := bobEvents.lastFallback(); fb.Reason != signaling.P2PFallbackParticipantJoined || fb.Peer != alice.PeerID() {
+		t.Fatalf("bob fell back with %+v", fb)
+	}
+	if permitted, fallbacks, _, _ := carolEvents.counts(); permitted != 0 || fallbacks != 0 {
+		t.Fatalf("carol was permitted %d times, fell back %d", permitted, fallbacks)
+	}
+	_, _, _, before := bobEvents.counts()
+	if err := bob.RelayP2P(alice.PeerID(), "candidate"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "relay without a pair to be refused", func() bool { _, _, _, n := bobEvents.counts(); return n > before })
+	if code := bobEvents.lastError(); code != http.StatusConflict {
+		t.Fatalf("relay in a room of three: error %d", code)
+	}
+	if rm := ts.lookupRoom("room-1"); rm.GetPeerCount() != 3 {
+		t.Fatalf("%d peers in the room", rm.GetPeerCount())
+	}
+
+	// Once the third leaves, the two are paired again
+	if err := carol.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "both to be permitted again", func() bool {
+		a, _, _, _ := aliceEvents.counts()
+		b, _, _, _ := bobEvents.counts()
+		return a == 2 && b == 2
+	})
+
+	// Turning direct connections off ends the pair; so does one leaving
+	if code := ts.api(t, http.MethodPatch, "/api/rooms/room-1/settings", `{"p2pAllowed":false}`, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("PATCH settings: %d", code)
+	}
+	eventually(t, "the settings to end the pair", func() bool { _, n, _, _ := aliceEvents.counts(); return n == 2 })
+	if fb := aliceEvents.lastFallback(); fb.Reason != signaling.P2PFallbackSFURequired {
+		t.Fatalf("alice fell back with %+v", fb)
+	}
+	if code := ts.api(t, http.MethodPatch, "/api/rooms/room-1/settings", `{"p2pAllowed":true}`, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("PATCH settings: %d", code)
+	}
+	eventually(t, "the pair to be permitted again", func() bool { n, _, _, _ := aliceEvents.counts(); return n == 3 })
+	if err := bob.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "alice to fall back", func() bool { _, n, _, _ := aliceEvents.counts(); return n == 3 })
+	if fb := aliceEvents.lastFallback(); fb.Reason != signaling.P2PFallbackPeerLeft || fb.Peer != bob.PeerID() {
+		t.Fatalf("alice fell back with %+v", fb)
+	}
+}
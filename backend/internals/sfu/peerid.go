@@ -0,0 +1,55 @@
+package sfu
+
+import (
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/session"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/google/uuid"
+)
+
+// In a room with RoomSettings.StablePeerIDs a participant's peer ID is
+// derived from its session (its user ID without a session manager), so a
+// reconnect that resumes the session comes back under the same ID and
+// replaces its old peer in place (see room.ReplacePeer). The room ID goes
+// into the derivation too, keeping the ID of a user in two rooms apart.
+//
+// Without a session manager every device of a user derives the same ID.
+// They never hold it at once: a user has one connection, so connecting a
+// second device drops the first, whose peer leaves before the second joins
+// under the ID. Unlike a resume, that is a leave and a join.
+
+// peerIDNamespace is the UUID namespace of derived peer IDs.
+var peerIDNamespace = uuid.MustParse("5d1f3a0c-7b7e-4e38-9c55-2f0b6c1d8e41")
+
+// stablePeerID returns the peer ID of userID in rm, or "" for a random one:
+// when rm does not keep peer IDs, or another user's peer already has it.
+func (s *SFU) stablePeerID(rm *room.Room, userID string, sess *session.Session) string {
+	if !rm.GetSettings().StablePeerIDs {
+		return ""
+	}
+	seed := "user:" + userID
+	if sess != nil {
+		seed = "session:" + sess.ID
+	}
+	id := uuid.NewSHA1(peerIDNamespace, []byte(rm.ID+"\x00"+seed)).String()
+	if p, ok := rm.GetPeer(id); ok && p.UserID != userID {
+		return ""
+	}
+	return id
+}
+
+// handlePeerReplaced drops the SFU's state of a peer replaced by a
+// reconnect under its ID. Unlike a leave, the old peer is not announced;
+// the new peer's peer-joined says it is a reconnect.
+func (s *SFU) handlePeerReplaced(rm *room.Room, old, p *peer.Peer) {
+	if announcesPeer(rm, p) {
+		s.broadcastPeerEvent(rm, p, signaling.MessageTypePeerJoined)
+	}
+	s.disarmPushToTalk(old.ID)
+	s.dropNegotiations(old.ID)
+	s.subscriptionMgr.RemovePeer(old.ID)
+	// The callback fires under the room lock
+	go s.updateMetrics()
+	go s.publishRoomSummary(s.ctx, rm.ID, rm)
+}
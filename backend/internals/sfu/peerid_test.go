@@ -0,0 +1,161 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"go.uber.org/zap"
+)
+
+// peerEvent is a peer-joined or peer-left a session saw.
+type peerEvent struct {
+	typ  signaling.MessageType
+	info signaling.PeerInfo
+}
+
+// peerEvents records the peer-joined and peer-left events a session sees,
+// in order.
+type peerEvents chan peerEvent
+
+func (e peerEvents) handlers() client.Handlers {
+	return client.Handlers{
+		OnPeerJoined: func(info signaling.PeerInfo) { e <- peerEvent{signaling.MessageTypePeerJoined, info} },
+		OnPeerLeft:   func(info signaling.PeerInfo) { e <- peerEvent{signaling.MessageTypePeerLeft, info} },
+	}
+}
+
+// expect waits for the next event, which must be typ for peerID and, on a
+// peer-joined, a reconnect or not as given.
+func (e peerEvents) expect(t *testing.T, typ signaling.MessageType, peerID string, reconnect bool) {
+	t.Helper()
+	select {
+	case ev := <-e:
+		if ev.typ != typ || ev.info.PeerID != peerID || ev.info.Reconnect != reconnect {
+			t.Fatalf("%s %+v, want %s of %s (reconnect %v)", ev.typ, ev.info, typ, peerID, reconnect)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no %s for %s", typ, peerID)
+	}
+}
+
+func TestStablePeerIDAcrossResume(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.StablePeerIDs = true
+	})
+	events := make(peerEvents, 16)
+	alice := ts.join(t, "alice", "room-1", events.handlers(), client.JoinOptions{})
+	publish(t, alice, "alice")
+	rm := ts.lookupRoom("room-1")
+	eventually(t, "alice to publish", func() bool { return rm.GetTrackCount() == 2 })
+
+	bob := ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{})
+	aliceID, bobID := alice.PeerID(), bob.PeerID()
+	events.expect(t, signaling.MessageTypePeerJoined, bobID, false)
+	subscribed := func() bool {
+		_, p := ts.getRoomAndPeer("room-1", "bob")
+		if p == nil || p.ID != bobID {
+			return false
+		}
+		snapshot := rm.SubscriptionSnapshot(p)
+		for _, sub := range snapshot {
+			if sub.PeerID != aliceID {
+				return false
+			}
+		}
+		return len(snapshot) == 2
+	}
+	eventually(t, "bob to subscribe to alice", subscribed)
+	_, old := ts.getRoomAndPeer("room-1", "bob")
+
+	// Bob comes back on a new connection and resumes his session, offering
+	// afresh, while his peer is still kept. The new peer takes the old one's
+	// ID in place, so alice sees a reconnect rather than a leave and a join
+	info := bob.Info()
+	sc := ts.dialScripted(t, "bob")
+	sc.pipeline(t, signaling.MessageTypeJoin, struct {
+		signaling.JoinMessage
+		SessionID    string `json:"sessionId"`
+		SessionToken string `json:"sessionToken"`
+	}{
+		JoinMessage:  signaling.JoinMessage{RoomID: "room-1", UserID: "bob", Name: "bob"},
+		SessionID:    info.SessionID,
+		SessionToken: info.SessionToken,
+	}, signaling.MessageTypeOffer, signaling.OfferMessage{SDP: recvOnlyOffer(t).SDP, Type: "offer"})
+	var resumed signaling.JoinResponse
+	for _, m := range sc.readUntil(t, signaling.MessageTypeAnswer) {
+		if m.Type == signaling.MessageTypeJoin {
+			if err := json.Unmarshal(m.Data, &resumed); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if !resumed.Resumed || resumed.Reattached || resumed.PeerID != bobID {
+		t.Fatalf("resumed as %s (resumed %v, reattached %v), want %s", resumed.PeerID, resumed.Resumed, resumed.Reattached, bobID)
+	}
+	events.expect(t, signaling.MessageTypePeerJoined, bobID, true)
+
+	// His subscriptions to alice are keyed under the same ID
+	if _, p := ts.getRoomAndPeer("room-1", "bob"); p == old {
+		t.Fatal("bob's old peer is still in the room")
+	}
+	eventually(t, "bob's subscriptions under his ID", subscribed)
+	select {
+	case ev := <-events:
+		t.Fatalf("%s %+v after the reconnect", ev.typ, ev.info)
+	default:
+	}
+}
+
+func TestStablePeerIDWithoutSessions(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Redis.Addr = unusedAddr(t)
+		cfg.Redis.Required = false
+		cfg.Media.StablePeerIDs = true
+	})
+	if ts.sessionManager.Load() != nil {
+		t.Fatal("session manager without Redis")
+	}
+	events := make(peerEvents, 16)
+	ts.join(t, "bob", "room-1", events.handlers(), client.JoinOptions{})
+
+	// Without sessions the ID is the user's, so a second device of alice
+	// gets the first one's ID. Connecting it drops the first device, whose
+	// peer leaves before the second joins under the ID
+	first := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	firstID := first.PeerID()
+	events.expect(t, signaling.MessageTypePeerJoined, firstID, false)
+	second := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	if second.PeerID() != firstID {
+		t.Fatalf("alice's second device joined as %s, want %s", second.PeerID(), firstID)
+	}
+	events.expect(t, signaling.MessageTypePeerLeft, firstID, false)
+	events.expect(t, signaling.MessageTypePeerJoined, firstID, false)
+	rm := ts.lookupRoom("room-1")
+	if peers := rm.GetAllPeers(); len(peers) != 2 {
+		t.Fatalf("%d peers, want bob and one of alice", len(peers))
+	}
+
+	// The ID is derived per room, and not given to a user whose peer
+	// already has another user's ID
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	other, err := ts.getOrCreateRoom(ctx, "room-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := ts.stablePeerID(other, "alice", nil); id == "" || id == firstID {
+		t.Fatalf("alice's ID in room-2 is %q, want one other than %s", id, firstID)
+	}
+	if err := other.AddPeer(peer.NewPeerWithID(ts.stablePeerID(other, "alice", nil), "room-2", "mallory", "", zap.NewNop())); err != nil {
+		t.Fatal(err)
+	}
+	if id := ts.stablePeerID(other, "alice", nil); id != "" {
+		t.Fatalf("alice given %s, taken by mallory's peer", id)
+	}
+}
@@ -0,0 +1,183 @@
+package sfu
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// Clients send small app-specific events (a raised hand acknowledged, a
+// cursor position) to chosen peers of their room with relay. The SFU does
+// not look inside the data: it checks every target is in the sender's room,
+// sets From to the sender's peer ID and forwards it, through the hub to
+// peers connected here and through the room's pub/sub channel to peers
+// connected to another instance. Nothing is stored. A relay never goes back
+// to its sender, and one arriving over pub/sub is only delivered locally, so
+// relays cannot loop.
+
+// relayTargets returns the distinct peers msg names, leaving out the sender.
+func relayTargets(msg signaling.RelayMessage, senderID string) []string {
+	ids := msg.PeerIDs
+	if msg.PeerID != "" {
+		ids = append([]string{msg.PeerID}, ids...)
+	}
+	seen := make(map[string]bool, len(ids))
+	targets := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || id == senderID || seen[id] {
+			continue
+		}
+		seen[id] = true
+		targets = append(targets, id)
+	}
+	return targets
+}
+
+func (s *SFU) handleRelayMessage(client *signaling.Client, message signaling.Message, msg signaling.RelayMessage) {
+	if limit := s.config.Media.RelayMaxBytes; limit > 0 && len(msg.Data) > limit {
+		client.SendError(413, "Relay data too large")
+		return
+	}
+	rm, sender := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || sender == nil || sender.ID != client.PeerID() {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+	// A hidden observer would reveal itself
+	if sender.Observer {
+		client.SendError(403, "Observers cannot relay")
+		return
+	}
+
+	targets := relayTargets(msg, sender.ID)
+	if len(targets) == 0 {
+		client.SendError(400, "A relay needs a peer other than the sender")
+		return
+	}
+	if limit := s.config.Media.RelayMaxTargets; limit > 0 && len(targets) > limit {
+		client.SendError(400, fmt.Sprintf("A relay may name at most %d peers", limit))
+		return
+	}
+
+	// Every target is checked before the relay goes to any of them
+	local := make(map[string]*signaling.Client, len(targets))
+	var remote []string
+	for _, id := range targets {
+		target, found := s.relayTarget(rm, id)
+		switch {
+		case target != nil:
+			local[id] = target
+		case found:
+			client.SendErrorMessage(signaling.ErrorMessage{
+				Code:    409,
+				Message: "Peer " + id + " cannot be reached right now",
+				Reason:  signaling.ErrorReasonPeerUnavailable,
+			})
+			return
+		case s.remotePeerInRoom(rm, id):
+			remote = append(remote, id)
+		default:
+			client.SendErrorMessage(signaling.ErrorMessage{
+				Code:    404,
+				Message: "Peer " + id + " is not in this room",
+				Reason:  signaling.ErrorReasonPeerNotFound,
+			})
+			return
+		}
+	}
+
+	var ack signaling.RelayAckMessage
+	for _, id := range targets {
+		out := signaling.Message{
+			Type:      signaling.MessageTypeRelay,
+			Data:      msg.Data,
+			Timestamp: time.Now(),
+			From:      sender.ID,
+			To:        id,
+		}
+		if target, ok := local[id]; ok {
+			if target.TrySendMessage(out) {
+				ack.Delivered = append(ack.Delivered, id)
+			} else {
+				ack.Failed = append(ack.Failed, id)
+			}
+			continue
+		}
+		if err := s.pubsubManager.Load().PublishToRoom(rm.ID, out); err != nil {
+			ack.Failed = append(ack.Failed, id)
+		} else {
+			ack.Forwarded = append(ack.Forwarded, id)
+		}
+	}
+
+	s.logger.Debug("Relayed message",
+		zap.String("roomID", rm.ID),
+		zap.String("from", sender.ID),
+		zap.Int("local", len(local)),
+		zap.Int("remote", len(remote)),
+		zap.Int("failed", len(ack.Failed)),
+	)
+
+	if !msg.Reliable {
+		return
+	}
+	data, err := json.Marshal(ack)
+	if err != nil {
+		return
+	}
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypeRelayAck, Data: data, Timestamp: time.Now(), ClientTS: message.ClientTS,
+	})
+}
+
+// relayTarget returns the client of rm's peer peerID. found is set for a
+// peer of rm that has no client, one held after its connection dropped.
+// Hidden observers are not found.
+func (s *SFU) relayTarget(rm *room.Room, peerID string) (target *signaling.Client, found bool) {
+	p, ok := rm.GetPeer(peerID)
+	if !ok || p.Observer {
+		return nil, false
+	}
+	return s.peerClient(p), true
+}
+
+// peerClient returns the signaling client p joined through, or nil if it has
+// none right now.
+func (s *SFU) peerClient(p *peer.Peer) *signaling.Client {
+	for _, client := range s.signalingHub.GetClientsByRoom(p.RoomID) {
+		if client.PeerID() == p.ID {
+			return client
+		}
+	}
+	return nil
+}
+
+// remotePeerInRoom reports whether peerID is the peer of an active session
+// in rm that is connected to another instance. A peer of rm here, such as a
+// hidden observer, and an observer's session elsewhere are not.
+func (s *SFU) remotePeerInRoom(rm *room.Room, peerID string) bool {
+	sm := s.stateManager.Load()
+	if s.pubsubManager.Load() == nil || sm == nil {
+		return false
+	}
+	if _, ok := rm.GetPeer(peerID); ok {
+		return false
+	}
+	ctx, cancel := s.messageContext()
+	defer cancel()
+	sessions, err := sm.StoredRoomSessions(ctx, rm.ID)
+	if err != nil {
+		return false
+	}
+	for _, sess := range sessions {
+		if sess.PeerID == peerID {
+			return !sess.Observer
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// relayed is a relay a session received.
+type relayed struct {
+	from string
+	data string
+}
+
+// relayInbox collects the relays a session receives.
+type relayInbox chan relayed
+
+func (in relayInbox) handlers() client.Handlers {
+	return client.Handlers{OnRelay: func(from string, data json.RawMessage) { in <- relayed{from, string(data)} }}
+}
+
+func (in relayInbox) expect(t *testing.T, who, from, data string) {
+	t.Helper()
+	select {
+	case r := <-in:
+		if r.from != from || r.data != data {
+			t.Fatalf("%s got %s from %s, want %s from %s", who, r.data, r.from, data, from)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s got no relay", who)
+	}
+}
+
+func (in relayInbox) expectNone(t *testing.T, who string) {
+	t.Helper()
+	select {
+	case r := <-in:
+		t.Fatalf("%s got %s from %s", who, r.data, r.from)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestRelay(t *testing.T) {
+	mr := miniredis.RunT(t)
+	configure := func(cfg *config.Config) {
+		cfg.Media.RelayMaxBytes = 64
+		cfg.Media.RelayMaxTargets = 2
+		cfg.Media.PeerDisconnectGrace = 10 * time.Second
+	}
+	t.Setenv("INSTANCE_ID", "sfu-a")
+	a := newTestServer(t, mr, configure)
+	t.Setenv("INSTANCE_ID", "sfu-b")
+	b := newTestServer(t, mr, configure)
+	// b creates the room too while Redis is down, so it can neither claim it
+	// nor see a's summary, and once Redis is back the room is split across
+	// the two instances
+	a.joinScripted(t, "host", "room-1")
+	eventually(t, "a to be subscribed to the room", func() bool { return a.pubsubManager.Load().Health().LiveRooms == 1 })
+	mr.Close()
+	code := b.api(t, http.MethodPost, "/api/rooms", `{"id":"room-1"}`, testAdminKey, nil)
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK {
+		t.Fatalf("creating the room on b without Redis: %d", code)
+	}
+	for _, ts := range []*testServer{a, b} {
+		eventuallyWithin(t, "Redis to be reached again", 20*time.Second, func() bool { return ts.pubsubManager.Load().Ping() == nil })
+	}
+	eventuallyWithin(t, "a to subscribe to the room again", 20*time.Second, func() bool {
+		h := a.pubsubManager.Load().Health()
+		return h.Reconnects > 0 && h.LiveRooms == 1
+	})
+
+	aliceIn, carolIn, bobIn, observerIn := make(relayInbox, 8), make(relayInbox, 8), make(relayInbox, 8), make(relayInbox, 8)
+	acks := make(chan signaling.RelayAckMessage, 8)
+	errs := make(chan *client.ServerError, 8)
+	handlers := aliceIn.handlers()
+	handlers.OnRelayAck = func(m signaling.RelayAckMessage) { acks <- m }
+	handlers.OnError = func(err *client.ServerError) { errs <- err }
+	alice := a.join(t, "alice", "room-1", handlers, client.JoinOptions{})
+	carol := a.join(t, "carol", "room-1", carolIn.handlers(), client.JoinOptions{})
+	bob := b.join(t, "bob", "room-1", bobIn.handlers(), client.JoinOptions{})
+	observer := a.join(t, "recorder", "room-1", observerIn.handlers(), client.JoinOptions{
+		InviteToken: a.createInvite(t, "room-1", "observer"),
+		Observer:    true,
+	})
+	dave := a.joinScripted(t, "dave", "room-1")
+	_, davePeer := a.getRoomAndPeer("room-1", "dave")
+	dave.hangUp()
+	eventually(t, "dave to be held for a resume", func() bool { return a.isDetached(davePeer.ID) })
+
+	expectError := func(what string, code int, reason string) {
+		t.Helper()
+		select {
+		case err := <-errs:
+			if err.Code != code || err.Reason != reason {
+				t.Fatalf("%s: error %d (%s), want %d (%s)", what, err.Code, err.Reason, code, reason)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no error", what)
+		}
+	}
+	expectAck := func(want signaling.RelayAckMessage) {
+		t.Helper()
+		select {
+		case ack := <-acks:
+			if strings.Join(ack.Delivered, ",") != strings.Join(want.Delivered, ",") ||
+				strings.Join(ack.Forwarded, ",") != strings.Join(want.Forwarded, ",") || len(ack.Failed) != 0 {
+				t.Fatalf("relay-ack %+v, want %+v", ack, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no relay-ack")
+		}
+	}
+
+	// A targeted relay reaches its target only, stamped with the sender,
+	// and never goes back to the sender
+	if err := alice.Relay([]string{carol.PeerID()}, map[string]int{"hand": 1}, true); err != nil {
+		t.Fatal(err)
+	}
+	carolIn.expect(t, "carol", alice.PeerID(), `{"hand":1}`)
+	expectAck(signaling.RelayAckMessage{Delivered: []string{carol.PeerID()}})
+	if err := alice.Relay([]string{alice.PeerID(), carol.PeerID(), carol.PeerID()}, "cursor", false); err != nil {
+		t.Fatal(err)
+	}
+	carolIn.expect(t, "carol", alice.PeerID(), `"cursor"`)
+	carolIn.expectNone(t, "carol")
+	aliceIn.expectNone(t, "alice")
+	if err := alice.Relay([]string{alice.PeerID()}, "echo", false); err != nil {
+		t.Fatal(err)
+	}
+	expectError("relay to the sender only", http.StatusBadRequest, "")
+
+	// Oversized data and too many targets are refused outright
+	if err := alice.Relay([]string{carol.PeerID()}, strings.Repeat("x", 64), false); err != nil {
+		t.Fatal(err)
+	}
+	expectError("oversized relay", http.StatusRequestEntityTooLarge, "")
+	if err := alice.Relay([]string{carol.PeerID(), bob.PeerID(), "p-3"}, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	expectError("relay to three peers", http.StatusBadRequest, "")
+
+	// A target outside the room, a hidden observer or a peer held for a
+	// resume fails the whole relay
+	for _, tc := range []struct {
+		what, target string
+		code         int
+		reason       string
+	}{
+		{"unknown peer", "no-such-peer", http.StatusNotFound, signaling.ErrorReasonPeerNotFound},
+		{"observer", observer.PeerID(), http.StatusNotFound, signaling.ErrorReasonPeerNotFound},
+		{"held peer", davePeer.ID, http.StatusConflict, signaling.ErrorReasonPeerUnavailable},
+	} {
+		if err := alice.Relay([]string{carol.PeerID(), tc.target}, tc.what, true); err != nil {
+			t.Fatal(err)
+		}
+		expectError(tc.what, tc.code, tc.reason)
+	}
+	carolIn.expectNone(t, "carol")
+	observerIn.expectNone(t, "the observer")
+	select {
+	case ack := <-acks:
+		t.Fatalf("failed relay acknowledged: %+v", ack)
+	default:
+	}
+
+	// Peers of the room on another instance are reached over pub/sub, both ways
+	eventually(t, "bob's session to be known to a", func() bool {
+		return a.remotePeerInRoom(a.lookupRoom("room-1"), bob.PeerID())
+	})
+	if err := alice.Relay([]string{bob.PeerID(), carol.PeerID()}, "hi", true); err != nil {
+		t.Fatal(err)
+	}
+	bobIn.expect(t, "bob", alice.PeerID(), `"hi"`)
+	carolIn.expect(t, "carol", alice.PeerID(), `"hi"`)
+	expectAck(signaling.RelayAckMessage{Delivered: []string{carol.PeerID()}, Forwarded: []string{bob.PeerID()}})
+	eventually(t, "alice's session to be known to b", func() bool {
+		return b.remotePeerInRoom(b.lookupRoom("room-1"), alice.PeerID())
+	})
+	if err := bob.Relay([]string{alice.PeerID()}, "hello", false); err != nil {
+		t.Fatal(err)
+	}
+	aliceIn.expect(t, "alice", bob.PeerID(), `"hello"`)
+	carolIn.expectNone(t, "carol")
+
+	// An observer on the other instance is as hidden as one here
+	remoteObserver := b.join(t, "recorder-b", "room-1", client.Handlers{}, client.JoinOptions{
+		InviteToken: b.createInvite(t, "room-1", "observer"),
+		Observer:    true,
+	})
+	eventually(t, "the observer's session to be stored", func() bool {
+		sessions, err := a.stateManager.Load().StoredRoomSessions(context.Background(), "room-1")
+		for _, sess := range sessions {
+			if sess.PeerID == remoteObserver.PeerID() {
+				return true
+			}
+		}
+		return err != nil
+	})
+	if err := alice.Relay([]string{remoteObserver.PeerID()}, "psst", true); err != nil {
+		t.Fatal(err)
+	}
+	expectError("remote observer", http.StatusNotFound, signaling.ErrorReasonPeerNotFound)
+
+	// Relays are not kept
+	for _, k := range mr.Keys() {
+		if strings.Contains(k, "relay") {
+			t.Fatalf("relay stored under %s", k)
+		}
+	}
+}
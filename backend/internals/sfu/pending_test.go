@@ -0,0 +1,142 @@
+package sfu
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestTracksPublishedDuringInitialNegotiation(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+
+	// bob joins but holds back his offer while two publishers arrive
+	bob := ts.joinScripted(t, "bob", "room-1")
+	for _, user := range []string{"alice", "carol"} {
+		publish(t, ts.join(t, user, "room-1", client.Handlers{}, client.JoinOptions{}), user)
+	}
+	rm := ts.lookupRoom("room-1")
+	eventually(t, "both publishers' tracks", func() bool { return rm.GetTrackCount() == 4 })
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeVideo} {
+		if _, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var (
+		mu       sync.Mutex
+		received = make(map[string]bool)
+	)
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		mu.Lock()
+		received[track.StreamID()+"/"+track.Kind().String()] = true
+		mu.Unlock()
+	})
+	offer := func(negotiationID string) {
+		o, err := pc.CreateOffer(nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		gathered := webrtc.GatheringCompletePromise(pc)
+		if err := pc.SetLocalDescription(o); err != nil {
+			t.Error(err)
+			return
+		}
+		<-gathered
+		bob.pipeline(t, signaling.MessageTypeOffer, signaling.OfferMessage{
+			SDP: pc.LocalDescription().SDP, Type: "offer", NegotiationID: negotiationID,
+		})
+	}
+
+	// bob answers renegotiations like a client would, re-offering once any
+	// exchange in flight completes, and counts those that arrive after his
+	// first exchange and any that interrupt it
+	var (
+		answered              bool
+		early, renegotiations int
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		offer("")
+		inFlight, reoffer, pending := true, false, ""
+		for m := range bob.messages {
+			switch m.Type {
+			case signaling.MessageTypeAnswer:
+				var v signaling.AnswerMessage
+				if json.Unmarshal(m.Data, &v) == nil {
+					if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: v.SDP}); err != nil {
+						t.Error(err)
+					}
+				}
+				mu.Lock()
+				answered = true
+				mu.Unlock()
+				inFlight = false
+				if reoffer {
+					offer(pending)
+					inFlight, reoffer = true, false
+				}
+			case signaling.MessageTypeICECandidate:
+				var v signaling.ICECandidateMessage
+				if json.Unmarshal(m.Data, &v) == nil {
+					mid, index := v.SDPMid, uint16(v.SDPMLineIndex)
+					pc.AddICECandidate(webrtc.ICECandidateInit{Candidate: v.Candidate, SDPMid: &mid, SDPMLineIndex: &index})
+				}
+			case signaling.MessageTypeRenegotiate:
+				var v signaling.RenegotiateMessage
+				json.Unmarshal(m.Data, &v)
+				mu.Lock()
+				if answered {
+					renegotiations++
+				} else {
+					early++
+				}
+				mu.Unlock()
+				if inFlight {
+					reoffer, pending = true, v.NegotiationID
+					continue
+				}
+				offer(v.NegotiationID)
+				inFlight = true
+			}
+		}
+	}()
+	defer func() {
+		bob.ws.Close()
+		<-done
+	}()
+
+	eventually(t, "all four tracks at bob", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 4
+	})
+	time.Sleep(500 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	for _, user := range []string{"alice", "carol"} {
+		_, p := ts.getRoomAndPeer("room-1", user)
+		for _, kind := range []string{"audio", "video"} {
+			if !received[p.ID+"/"+kind] {
+				t.Errorf("bob did not receive %s's %s; got %v", user, kind, received)
+			}
+		}
+	}
+	if early != 0 {
+		t.Errorf("%d renegotiations before bob's first exchange completed", early)
+	}
+	if renegotiations > 1 {
+		t.Errorf("%d renegotiations after bob's first exchange, want at most one", renegotiations)
+	}
+}
@@ -0,0 +1,28 @@
+package sfu
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// handleBitratePolicing tells a publisher that it is being policed for
+// exceeding Media.PublisherMaxBitrateKbps, or that it no longer is.
+func (s *SFU) handleBitratePolicing(rm *room.Room, p *peer.Peer, state room.BitratePolicing) {
+	data, err := json.Marshal(signaling.BitratePolicingMessage{
+		PeerID:      p.ID,
+		Policing:    state.Policing,
+		BitrateKbps: state.BitrateKbps,
+		CapKbps:     state.CapKbps,
+		RemoveInMs:  state.RemoveIn.Milliseconds(),
+	})
+	if err != nil {
+		return
+	}
+	s.sendToPeerClient(p, signaling.Message{
+		Type: signaling.MessageTypeBitratePolicing, Data: data, Timestamp: time.Now(),
+	})
+}
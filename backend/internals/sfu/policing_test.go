@@ -0,0 +1,43 @@
+package sfu
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+func TestBitratePolicingWarnsPublisher(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.PublisherMaxBitrateKbps = 1500
+	})
+	alice := ts.joinScripted(t, "alice", "room-1")
+	bob := ts.joinScripted(t, "bob", "room-1")
+	var bobSaw messageCounts
+	bobSaw.drain(bob)
+
+	rm, p := ts.getRoomAndPeer("room-1", "alice")
+	rm.OnBitratePolicing(rm, p, room.BitratePolicing{Policing: true, BitrateKbps: 4000, CapKbps: 1500, RemoveIn: 15 * time.Second})
+	rm.OnBitratePolicing(rm, p, room.BitratePolicing{BitrateKbps: 900, CapKbps: 1500})
+
+	for _, want := range []signaling.BitratePolicingMessage{
+		{PeerID: p.ID, Policing: true, BitrateKbps: 4000, CapKbps: 1500, RemoveInMs: 15000},
+		{PeerID: p.ID, BitrateKbps: 900, CapKbps: 1500},
+	} {
+		seen := alice.readUntil(t, signaling.MessageTypeBitratePolicing)
+		var got signaling.BitratePolicingMessage
+		if err := json.Unmarshal(seen[len(seen)-1].Data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("alice was sent %+v, want %+v", got, want)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := bobSaw.get(signaling.MessageTypeBitratePolicing); n != 0 {
+		t.Fatalf("bob was sent %d policing messages meant for alice", n)
+	}
+}
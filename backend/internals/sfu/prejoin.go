@@ -0,0 +1,215 @@
+package sfu
+
+import (
+	"context"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// A join can wait in the join queue for up to SFU_JOIN_QUEUE_TIMEOUT_SEC, so
+// it runs off the connection's ReadPump, which meanwhile goes on reading and
+// answers pings. Clients pipeline their offer, ICE candidates and often a
+// leave or a membership join right behind the join, though, and those must
+// see the join's outcome: while a join runs, every other message of the
+// connection but its pings is held, and replayed in arrival order once it
+// finishes. A held join runs in turn, and what follows it waits for it too.
+// A held message that waits longer than preJoinHoldTimeout, or finds the
+// hold full, is dropped: a join with the 503 of a join that timed out in the
+// queue, anything else with the 404 its handler gives a client in no room.
+
+const (
+	// preJoinHoldSize bounds the messages held for one join.
+	preJoinHoldSize = 64
+	// preJoinHoldTimeout is how long a held message waits for its join.
+	preJoinHoldTimeout = 10 * time.Second
+)
+
+// pendingJoin is a join running for a connection, with the messages held
+// for it.
+type pendingJoin struct {
+	ctx    context.Context // cancelled when the connection goes away
+	cancel context.CancelFunc
+	done   chan struct{} // closed once the join and its replay are done
+
+	held  []heldMessage
+	timer *time.Timer // drops held messages as they expire
+}
+
+type heldMessage struct {
+	message signaling.Message
+	at      time.Time
+}
+
+// holdsForJoin reports whether message waits for a join running on its
+// connection. A connection's pings only echo timestamps, so they are
+// answered at once; a membership's ping may be for a membership the join
+// creates.
+func holdsForJoin(message signaling.Message) bool {
+	switch message.Type {
+	case signaling.MessageTypePing, signaling.MessageTypePong:
+		return message.MembershipID != ""
+	}
+	return true
+}
+
+// runJoins starts each join on its own goroutine and holds what arrives on
+// the connection while it runs, joins included. A connection runs one join
+// at a time, and ReadPump is the only caller, so no join can start between
+// the check for a running one and startJoin. It runs after rate limiting,
+// so replayed messages are not counted twice.
+func (s *SFU) runJoins(next messageHandler) messageHandler {
+	return func(client *signaling.Client, message signaling.Message) {
+		if holdsForJoin(message) && s.holdForJoin(client, message) {
+			return
+		}
+		if message.Type == signaling.MessageTypeJoin {
+			s.startJoin(client, message, next)
+			return
+		}
+		next(client, message)
+	}
+}
+
+// startJoin runs the join message through next on a new goroutine, then
+// replays what was held for it.
+func (s *SFU) startJoin(client *signaling.Client, message signaling.Message, next messageHandler) {
+	s.pendingJoinsMu.Lock()
+	ctx, cancel := context.WithCancel(s.ctx)
+	pj := &pendingJoin{ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	s.pendingJoins[client.ID] = pj
+	s.pendingJoinsMu.Unlock()
+
+	go func() {
+		defer close(pj.done)
+		defer cancel()
+		next(client, message)
+		s.replayHeld(client, pj, next)
+	}()
+}
+
+// holdForJoin holds message if a join is running on client, reporting
+// whether it did; a message the full hold turns away counts as held.
+func (s *SFU) holdForJoin(client *signaling.Client, message signaling.Message) bool {
+	s.pendingJoinsMu.Lock()
+	defer s.pendingJoinsMu.Unlock()
+	pj, running := s.pendingJoins[client.ID]
+	if !running {
+		return false
+	}
+	if len(pj.held) >= preJoinHoldSize {
+		s.logger.Debug("Dropping message held for a join",
+			zap.String("clientID", client.ID),
+			zap.String("type", string(message.Type)),
+		)
+		s.dropHeld(client, message)
+		return true
+	}
+	pj.held = append(pj.held, heldMessage{message: message, at: time.Now()})
+	if pj.timer == nil {
+		pj.timer = time.AfterFunc(preJoinHoldTimeout, func() { s.expireHeld(client, pj) })
+	}
+	return true
+}
+
+// replayHeld hands the messages held for pj to next in order, including
+// any held while replaying, and then ends the join. Once the connection has
+// gone away what is left is dropped unanswered.
+func (s *SFU) replayHeld(client *signaling.Client, pj *pendingJoin, next messageHandler) {
+	for {
+		s.pendingJoinsMu.Lock()
+		held := pj.held
+		pj.held = nil
+		if len(held) == 0 || pj.ctx.Err() != nil {
+			if pj.timer != nil {
+				pj.timer.Stop()
+			}
+			delete(s.pendingJoins, client.ID)
+			s.pendingJoinsMu.Unlock()
+			return
+		}
+		s.pendingJoinsMu.Unlock()
+
+		for _, h := range held {
+			if pj.ctx.Err() != nil {
+				break
+			}
+			next(client, h.message)
+		}
+	}
+}
+
+// expireHeld drops the messages held for pj that have waited too long, and
+// rearms its timer for the rest.
+func (s *SFU) expireHeld(client *signaling.Client, pj *pendingJoin) {
+	s.pendingJoinsMu.Lock()
+	defer s.pendingJoinsMu.Unlock()
+	if s.pendingJoins[client.ID] != pj {
+		return // the join has ended
+	}
+	now := time.Now()
+	expired := 0
+	for expired < len(pj.held) && now.Sub(pj.held[expired].at) >= preJoinHoldTimeout {
+		expired++
+	}
+	for _, h := range pj.held[:expired] {
+		s.dropHeld(client, h.message)
+	}
+	if expired > 0 {
+		s.logger.Debug("Dropped messages held for a slow join",
+			zap.String("clientID", client.ID),
+			zap.Int("messages", expired),
+		)
+	}
+	pj.held = pj.held[expired:]
+	if len(pj.held) == 0 {
+		pj.timer = nil
+		return
+	}
+	pj.timer = time.AfterFunc(pj.held[0].at.Add(preJoinHoldTimeout).Sub(now), func() { s.expireHeld(client, pj) })
+}
+
+// dropHeld answers a held message that will not be handled.
+func (s *SFU) dropHeld(client *signaling.Client, message signaling.Message) {
+	if message.MembershipID != "" {
+		if m, ok := client.Membership(message.MembershipID); ok {
+			client = m
+		}
+	}
+	if message.Type == signaling.MessageTypeJoin {
+		appmetrics.RecordAdmissionRejection("join", "queue_timeout")
+		client.SendRetryableError(503, "Timed out waiting to join", s.config.Media.JoinRetryAfter)
+		return
+	}
+	client.SendError(404, "Room or peer not found")
+}
+
+// joinContext returns the context of the join running on client, or on the
+// connection of a membership, which ends when the connection goes away.
+func (s *SFU) joinContext(client *signaling.Client) context.Context {
+	id := client.ID
+	if parent := client.Parent(); parent != nil {
+		id = parent.ID
+	}
+	s.pendingJoinsMu.Lock()
+	defer s.pendingJoinsMu.Unlock()
+	if pj, running := s.pendingJoins[id]; running {
+		return pj.ctx
+	}
+	return s.ctx
+}
+
+// endJoin stops the join running on a connection that went away, and waits
+// for it, so the disconnect sees the room it joined, if any.
+func (s *SFU) endJoin(clientID string) {
+	s.pendingJoinsMu.Lock()
+	pj, running := s.pendingJoins[clientID]
+	s.pendingJoinsMu.Unlock()
+	if !running {
+		return
+	}
+	pj.cancel()
+	<-pj.done
+}
@@ -0,0 +1,420 @@
+package sfu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// corkedConn holds what is written to it while corked, and sends it in one
+// write when uncorked.
+type corkedConn struct {
+	net.Conn
+	mu     sync.Mutex
+	corked bool
+	buf    bytes.Buffer
+}
+
+func (c *corkedConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.corked {
+		return c.buf.Write(p)
+	}
+	return c.Conn.Write(p)
+}
+
+func (c *corkedConn) cork() {
+	c.mu.Lock()
+	c.corked = true
+	c.mu.Unlock()
+}
+
+func (c *corkedConn) uncork() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.corked = false
+	_, err := c.Conn.Write(c.buf.Bytes())
+	c.buf.Reset()
+	return err
+}
+
+// scriptedClient is a raw signaling connection whose messages can be
+// pipelined into a single write.
+type scriptedClient struct {
+	ws       *websocket.Conn
+	conn     *corkedConn
+	messages chan signaling.Message
+}
+
+func (ts *testServer) dialScripted(t *testing.T, userID string) *scriptedClient {
+	t.Helper()
+	sc := &scriptedClient{messages: make(chan signaling.Message, 256)}
+	dialer := websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			sc.conn = &corkedConn{Conn: conn}
+			return sc.conn, nil
+		},
+	}
+	url := "ws" + strings.TrimPrefix(ts.http.URL, "http") + ts.config.Server.WSPath + "?userId=" + userID
+	ws, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.ws = ws
+	t.Cleanup(func() { ws.Close() })
+	go func() {
+		defer close(sc.messages)
+		for {
+			var m signaling.Message
+			if err := ws.ReadJSON(&m); err != nil {
+				return
+			}
+			sc.messages <- m
+		}
+	}()
+	return sc
+}
+
+// pipeline sends messages, given as type and payload pairs, in one write.
+func (sc *scriptedClient) pipeline(t *testing.T, messages ...interface{}) {
+	t.Helper()
+	sc.conn.cork()
+	for i := 0; i < len(messages); i += 2 {
+		data, err := json.Marshal(messages[i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sc.ws.WriteJSON(signaling.Message{Type: messages[i].(signaling.MessageType), Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sc.conn.uncork(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readUntil returns the messages received up to and including the first of
+// type typ.
+func (sc *scriptedClient) readUntil(t *testing.T, typ signaling.MessageType) []signaling.Message {
+	t.Helper()
+	var seen []signaling.Message
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m, ok := <-sc.messages:
+			if !ok {
+				t.Fatalf("connection closed waiting for %s; got %v", typ, seen)
+			}
+			seen = append(seen, m)
+			if m.Type == typ {
+				return seen
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s; got %v", typ, seen)
+		}
+	}
+}
+
+// recvOnlyOfferWithCandidates returns a receive-only audio offer and the
+// candidates gathered for it.
+func recvOnlyOfferWithCandidates(t *testing.T) (webrtc.SessionDescription, []webrtc.ICECandidateInit) {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var candidates []webrtc.ICECandidateInit
+	gathered := make(chan struct{})
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			close(gathered)
+			return
+		}
+		candidates = append(candidates, c.ToJSON())
+	})
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	if len(candidates) == 0 {
+		t.Fatal("no local candidates gathered")
+	}
+	return offer, candidates
+}
+
+// recvOnlyOffer returns a receive-only audio offer.
+func recvOnlyOffer(t *testing.T) webrtc.SessionDescription {
+	t.Helper()
+	offer, _ := recvOnlyOfferWithCandidates(t)
+	return offer
+}
+
+func TestPipelinedJoinOfferAndCandidates(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.MaxConcurrentJoinsPerRoom = 1
+	})
+
+	offer, candidates := recvOnlyOfferWithCandidates(t)
+
+	// The join waits behind a slot held for its room
+	release := mustAcquire(t, ts.joinQueue, "room-1")
+	defer release()
+
+	sc := ts.dialScripted(t, "alice")
+	script := []interface{}{
+		signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "Alice"},
+		signaling.MessageTypeOffer, signaling.OfferMessage{SDP: offer.SDP, Type: "offer"},
+	}
+	for _, c := range candidates {
+		script = append(script, signaling.MessageTypeICECandidate, signaling.ICECandidateMessage{
+			Candidate: c.Candidate, SDPMid: *c.SDPMid, SDPMLineIndex: int(*c.SDPMLineIndex),
+		})
+	}
+	script = append(script, signaling.MessageTypePing, struct{}{})
+	sc.pipeline(t, script...)
+
+	// The queued join does not keep the ping from being answered
+	for _, m := range sc.readUntil(t, signaling.MessageTypePong) {
+		if m.Type == signaling.MessageTypeJoin || m.Type == signaling.MessageTypeError {
+			t.Fatalf("%s before the join had a slot: %s", m.Type, m.Data)
+		}
+	}
+
+	release()
+	seen := sc.readUntil(t, signaling.MessageTypeAnswer)
+	eventually(t, "the held messages to be replayed", func() bool {
+		ts.pendingJoinsMu.Lock()
+		defer ts.pendingJoinsMu.Unlock()
+		return len(ts.pendingJoins) == 0
+	})
+	sc.pipeline(t, signaling.MessageTypePing, struct{}{})
+	seen = append(seen, sc.readUntil(t, signaling.MessageTypePong)...)
+
+	joined := false
+	for _, m := range seen {
+		switch m.Type {
+		case signaling.MessageTypeJoin:
+			joined = true
+		case signaling.MessageTypeAnswer:
+			if !joined {
+				t.Fatal("answer before the join response")
+			}
+		case signaling.MessageTypeError:
+			t.Fatalf("error after the join: %s", m.Data)
+		}
+	}
+
+	_, p := ts.getRoomAndPeer("room-1", "alice")
+	if p == nil || p.Connection.RemoteDescription() == nil {
+		t.Fatal("the SFU has no remote description for alice")
+	}
+}
+
+func TestPipelinedJoinOfferAndLeave(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.MaxConcurrentJoinsPerRoom = 1
+	})
+	offer := recvOnlyOffer(t)
+
+	release := mustAcquire(t, ts.joinQueue, "room-1")
+	defer release()
+	sc := ts.dialScripted(t, "alice")
+	sc.pipeline(t,
+		signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "Alice"},
+		signaling.MessageTypeOffer, signaling.OfferMessage{SDP: offer.SDP, Type: "offer"},
+		signaling.MessageTypeLeave, struct{}{},
+		signaling.MessageTypePing, struct{}{},
+	)
+	sc.readUntil(t, signaling.MessageTypePong)
+
+	// The leave waits for the join and the offer, so alice ends up out of
+	// the room instead of staying in it
+	release()
+	joined := false
+	for _, m := range sc.readUntil(t, signaling.MessageTypeAnswer) {
+		switch m.Type {
+		case signaling.MessageTypeJoin:
+			joined = true
+		case signaling.MessageTypeAnswer:
+			if !joined {
+				t.Fatal("answer before the join response")
+			}
+		case signaling.MessageTypeError:
+			t.Fatalf("error: %s", m.Data)
+		}
+	}
+	eventually(t, "the held leave to be replayed", func() bool {
+		ts.pendingJoinsMu.Lock()
+		defer ts.pendingJoinsMu.Unlock()
+		return len(ts.pendingJoins) == 0
+	})
+	if _, p := ts.getRoomAndPeer("room-1", "alice"); p != nil {
+		t.Fatal("alice is still in the room after her pipelined leave")
+	}
+}
+
+func TestPipelinedMembershipJoinWaits(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.MaxConcurrentJoinsPerRoom = 1
+		cfg.Media.WSMaxMemberships = 1
+	})
+	release := mustAcquire(t, ts.joinQueue, "room-1")
+	defer release()
+
+	// The membership join is queued behind the connection's own join
+	// rather than refused
+	sc := ts.dialScripted(t, "bob")
+	sc.pipeline(t,
+		signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "bob", Name: "Bob", NoTrickle: true},
+		signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-2", UserID: "bob", Name: "Bob", NoTrickle: true, Membership: true},
+	)
+	release()
+	var joins []signaling.Message
+	for len(joins) < 2 {
+		for _, m := range sc.readUntil(t, signaling.MessageTypeJoin) {
+			switch m.Type {
+			case signaling.MessageTypeJoin:
+				joins = append(joins, m)
+			case signaling.MessageTypeError:
+				t.Fatalf("error: %s", m.Data)
+			}
+		}
+	}
+	if joins[0].MembershipID != "" || joins[1].MembershipID == "" {
+		t.Fatalf("joins answered for memberships %q and %q", joins[0].MembershipID, joins[1].MembershipID)
+	}
+	if rm, _ := ts.getRoomAndPeer("room-2", "bob"); rm == nil {
+		t.Fatal("bob's membership is not in room-2")
+	}
+}
+
+func TestHeldMessagesForSlowJoin(t *testing.T) {
+	s := &SFU{
+		logger:       zap.NewNop(),
+		config:       &config.Config{},
+		ctx:          context.Background(),
+		pendingJoins: make(map[string]*pendingJoin),
+	}
+	client := signaling.NewClient("c1", "alice", "Alice", nil, zap.NewNop())
+
+	var (
+		mu        sync.Mutex
+		handled   []signaling.MessageType
+		cancelled bool
+	)
+	joining := make(chan struct{}, 2)
+	finish := make(chan struct{})
+	handle := s.runJoins(func(client *signaling.Client, message signaling.Message) {
+		if message.Type == signaling.MessageTypeJoin {
+			joining <- struct{}{}
+			wait := finish
+			if string(message.Data) == `"hang"` {
+				wait = nil
+			}
+			select {
+			case <-wait:
+			case <-s.joinContext(client).Done():
+				mu.Lock()
+				cancelled = true
+				mu.Unlock()
+				return
+			}
+		}
+		mu.Lock()
+		handled = append(handled, message.Type)
+		mu.Unlock()
+	})
+
+	// Everything but the ping waits for the join, a second join included
+	handle(client, signaling.Message{Type: signaling.MessageTypeJoin})
+	<-joining
+	handle(client, signaling.Message{Type: signaling.MessageTypeOffer})
+	handle(client, signaling.Message{Type: signaling.MessageTypeJoin})
+	handle(client, signaling.Message{Type: signaling.MessageTypeLeave})
+	handle(client, signaling.Message{Type: signaling.MessageTypePing})
+	if errs := rejections(t, client); len(errs) != 0 {
+		t.Fatalf("rejections %+v while a join runs", errs)
+	}
+
+	// The offer waited too long and is dropped; what is behind it still
+	// waits
+	s.pendingJoinsMu.Lock()
+	pj := s.pendingJoins[client.ID]
+	pj.held[0].at = time.Now().Add(-preJoinHoldTimeout)
+	s.pendingJoinsMu.Unlock()
+	s.expireHeld(client, pj)
+	if errs := rejections(t, client); len(errs) != 1 || errs[0].Code != 404 {
+		t.Fatalf("expired offer: rejections %+v, want one 404", errs)
+	}
+
+	// A full hold turns messages away
+	for i := 2; i < preJoinHoldSize; i++ {
+		handle(client, signaling.Message{Type: signaling.MessageTypeICECandidate})
+	}
+	handle(client, signaling.Message{Type: signaling.MessageTypeOffer})
+	if errs := rejections(t, client); len(errs) != 1 || errs[0].Code != 404 {
+		t.Fatalf("full hold: rejections %+v, want one 404", errs)
+	}
+
+	// The held join runs after the first, and the leave after it
+	close(finish)
+	<-pj.done
+	mu.Lock()
+	want := []signaling.MessageType{signaling.MessageTypePing, signaling.MessageTypeJoin, signaling.MessageTypeJoin, signaling.MessageTypeLeave}
+	if len(handled) != len(want)+preJoinHoldSize-2 {
+		t.Fatalf("handled %d messages, want %d", len(handled), len(want)+preJoinHoldSize-2)
+	}
+	for i, typ := range handled {
+		if i < len(want) && typ != want[i] || i >= len(want) && typ != signaling.MessageTypeICECandidate {
+			t.Fatalf("handled %v, want %v and then the held candidates", handled[:len(want)], want)
+		}
+	}
+	mu.Unlock()
+
+	// A dropped join is told to retry
+	s.dropHeld(client, signaling.Message{Type: signaling.MessageTypeJoin})
+	if errs := rejections(t, client); len(errs) != 1 || errs[0].Code != 503 {
+		t.Fatalf("dropped join: rejections %+v, want one 503", errs)
+	}
+
+	// A join still running when its connection goes away is stopped, and
+	// what was held behind it is not handled
+	handle(client, signaling.Message{Type: signaling.MessageTypeJoin, Data: json.RawMessage(`"hang"`)})
+	<-joining
+	handle(client, signaling.Message{Type: signaling.MessageTypeLeave})
+	s.endJoin(client.ID)
+	mu.Lock()
+	defer mu.Unlock()
+	if !cancelled {
+		t.Fatal("join not stopped when its connection went away")
+	}
+	if last := handled[len(handled)-1]; last != signaling.MessageTypeICECandidate {
+		t.Fatalf("%s handled after the connection went away", last)
+	}
+}
@@ -0,0 +1,105 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// roleModerator is the invite role allowed to steer room-wide settings such as
+// layer priorities. Admins may do the same.
+const roleModerator = "moderator"
+
+func canModerate(role string) bool {
+	return role == roleModerator || role == roleAdmin
+}
+
+// handleSetTrackPrioritiesMessage lets a moderator set the room's layer
+// priorities over signaling.
+func (s *SFU) handleSetTrackPrioritiesMessage(client *signaling.Client, message signaling.Message, msg signaling.TrackPrioritiesMessage) {
+
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+
+	if !isModerator(rm, p) {
+		s.auditClient(client, auditRoomPriorities, p.ID, audit.ResultDenied, nil)
+		client.SendError(403, "Moderator role required")
+		return
+	}
+
+	priorities, err := rm.SetTrackPriorities(msg.Priorities, msg.Replace)
+	if err != nil {
+		client.SendError(400, err.Error())
+		return
+	}
+
+	s.auditClient(client, auditRoomPriorities, p.ID, audit.ResultSuccess, nil)
+	s.broadcastTrackPriorities(rm, priorities)
+
+	ctx, cancel := s.messageContext()
+	defer cancel()
+	s.saveRoomSnapshot(ctx, rm)
+}
+
+// handleRoomPrioritiesAPI serves /api/rooms/{id}/priorities: GET returns the
+// current priorities, PUT replaces them and PATCH merges into them.
+func (s *SFU) handleRoomPrioritiesAPI(w http.ResponseWriter, r *http.Request, roomID string) {
+	s.roomsMu.RLock()
+	rm, exists := s.rooms[roomID]
+	s.roomsMu.RUnlock()
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	var priorities map[string]int
+	switch r.Method {
+	case http.MethodGet:
+		priorities = rm.GetTrackPriorities()
+	case http.MethodPut, http.MethodPatch:
+		var req signaling.TrackPrioritiesMessage
+		if !s.decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.Priorities == nil {
+			writeAPIError(w, http.StatusBadRequest, "priorities is required")
+			return
+		}
+		var err error
+		priorities, err = rm.SetTrackPriorities(req.Priorities, r.Method == http.MethodPut)
+		if err != nil {
+			s.auditRequest(r, auditRoomPriorities, roomID, audit.ResultFailure, map[string]string{"reason": err.Error()})
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.auditRequest(r, auditRoomPriorities, roomID, audit.ResultSuccess, nil)
+		s.broadcastTrackPriorities(rm, priorities)
+		s.saveRoomSnapshot(r.Context(), rm)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodPatch)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(signaling.TrackPrioritiesMessage{Priorities: priorities})
+}
+
+// broadcastTrackPriorities announces the room's current priorities.
+func (s *SFU) broadcastTrackPriorities(rm *room.Room, priorities map[string]int) {
+	data, err := json.Marshal(signaling.TrackPrioritiesMessage{Priorities: priorities})
+	if err != nil {
+		s.logger.Error("Failed to marshal track priorities", zap.Error(err))
+		return
+	}
+
+	msg := signaling.Message{Type: signaling.MessageTypeTrackPriorities, Data: data, Timestamp: time.Now()}
+	s.broadcastToRoom(rm, msg, nil)
+}
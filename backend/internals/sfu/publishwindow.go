@@ -0,0 +1,90 @@
+package sfu
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/authz"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/session"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"go.uber.org/zap"
+)
+
+// A guest may be allowed to publish for a while only: until the publishUntil
+// of its token or authorizer decision, or for an invite's publishForSec from
+// the invite's first redemption, which is kept in Redis beside the invite so
+// that leaving and joining again with it does not start the window over. The
+// earliest deadline applies and is kept in the session, so a resumed session
+// gets the time that is left. When the window ends the peer's tracks are
+// removed as if unpublished, new ones are rejected, the peer is told with
+// publish-expired, and the room sees its role change to viewer with
+// peer-updated.
+
+// roleViewer is the role of a participant whose publishing window ended.
+const roleViewer = "viewer"
+
+// publishDeadline returns when a joining participant's publishing window
+// ends, or the zero time if it may publish for as long as it stays.
+func publishDeadline(invite *state.InviteData, decision authz.Decision, sess *session.Session) time.Time {
+	var deadline time.Time
+	earliest := func(t time.Time) {
+		if !t.IsZero() && (deadline.IsZero() || t.Before(deadline)) {
+			deadline = t
+		}
+	}
+	if decision.PublishUntil > 0 {
+		earliest(time.Unix(decision.PublishUntil, 0))
+	}
+	if invite != nil && invite.PublishForSec > 0 {
+		start := invite.RedeemedAt
+		if start.IsZero() {
+			start = time.Now()
+		}
+		earliest(start.Add(time.Duration(invite.PublishForSec) * time.Second))
+	}
+	if sess != nil {
+		earliest(sess.PublishUntil)
+	}
+	return deadline
+}
+
+// expirePublishWindow downgrades p to a viewer once its publishing window
+// has ended.
+func (s *SFU) expirePublishWindow(rm *room.Room, p *peer.Peer) {
+	if current, ok := rm.GetPeer(p.ID); !ok || current != p {
+		return
+	}
+	p.SetMetadata("role", roleViewer)
+	removed := rm.StopPublishing(p)
+
+	s.logger.Info("Publishing window ended",
+		zap.String("roomID", p.RoomID),
+		zap.String("peerID", p.ID),
+		zap.String("userID", p.UserID),
+		zap.Int("removedTracks", len(removed)),
+	)
+
+	data, err := json.Marshal(signaling.PublishExpiredMessage{
+		PeerID:        p.ID,
+		Role:          roleViewer,
+		ExpiredAt:     p.PublishDeadline(),
+		RemovedTracks: removed,
+	})
+	if err == nil {
+		s.sendToPeerClient(p, signaling.Message{
+			Type: signaling.MessageTypePublishExpired, Data: data, Timestamp: time.Now(),
+		})
+	}
+	s.announcePeerUpdate(rm, p)
+}
+
+// peerRole returns the role p joined with, or roleViewer once its publishing
+// window has ended.
+func peerRole(p *peer.Peer) string {
+	role, _ := p.GetMetadata("role")
+	r, _ := role.(string)
+	return r
+}
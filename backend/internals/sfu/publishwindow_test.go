@@ -0,0 +1,157 @@
+package sfu
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+// forceRejoin has the SFU tell userID's client in roomID to rejoin on a
+// fresh PeerConnection, as after a negotiation it cannot recover from.
+func (ts *testServer) forceRejoin(t *testing.T, roomID, userID string) {
+	t.Helper()
+	rm, p := ts.getRoomAndPeer(roomID, userID)
+	for _, c := range ts.signalingHub.GetClientsByRoom(roomID) {
+		if p != nil && c.PeerID() == p.ID {
+			ts.requireReconnect(c, rm, p, "test")
+			return
+		}
+	}
+	t.Fatalf("%s has no connection in %s", userID, roomID)
+}
+
+func TestPublishWindow(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	var invite struct {
+		Token string `json:"token"`
+	}
+	if code := ts.api(t, http.MethodPost, "/api/rooms/room-1/invites", `{"publishForSec":-1}`, testAdminKey, nil); code != http.StatusBadRequest {
+		t.Fatalf("negative publishForSec: %d", code)
+	}
+	if code := ts.api(t, http.MethodPost, "/api/rooms/room-1/invites", `{"publishForSec":2}`, testAdminKey, &invite); code != http.StatusCreated {
+		t.Fatalf("create invite: %d", code)
+	}
+
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	publish(t, alice, "alice")
+	updates := make(chan signaling.PeerInfo, 16)
+	ts.join(t, "bob", "room-1", client.Handlers{
+		OnPeerUpdated: func(info signaling.PeerInfo) { updates <- info },
+	}, client.JoinOptions{})
+
+	var rejections trackRejections
+	handlers := rejections.handlers()
+	expired := make(chan signaling.PublishExpiredMessage, 4)
+	resumed := make(chan signaling.JoinResponse, 4)
+	handlers.OnPublishExpired = func(m signaling.PublishExpiredMessage) { expired <- m }
+	handlers.OnResumed = func(info signaling.JoinResponse) { resumed <- info }
+	received := newTrackCounter()
+	joined := time.Now()
+	guest := ts.join(t, "guest", "room-1", handlers, client.JoinOptions{InviteToken: invite.Token, OnTrack: received.onTrack})
+	deadline := guest.Info().PublishUntil
+	if deadline == nil || deadline.Sub(joined) < time.Second || deadline.Sub(joined) > 3*time.Second {
+		t.Fatalf("joined at %v with a window until %v", joined, deadline)
+	}
+	publish(t, guest, "guest")
+	rm := ts.lookupRoom("room-1")
+	eventually(t, "the guest to publish", func() bool { return rm.GetTrackCount() == 4 })
+
+	// Resuming within the window keeps its end
+	ts.forceRejoin(t, "room-1", "guest")
+	select {
+	case info := <-resumed:
+		if !info.Resumed || info.PublishUntil == nil || !info.PublishUntil.Equal(*deadline) {
+			t.Fatalf("resumed with a window until %v, want %v", info.PublishUntil, deadline)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("guest not resumed")
+	}
+	eventually(t, "the guest to publish again", func() bool { return rm.GetTrackCount() == 4 })
+
+	// At the end the guest's tracks go, it is told, and the room sees a viewer
+	var m signaling.PublishExpiredMessage
+	select {
+	case m = <-expired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no publish-expired")
+	}
+	if late := time.Since(*deadline); late < 0 || late > time.Second {
+		t.Fatalf("window ended %v after its deadline", late)
+	}
+	if m.PeerID != guest.PeerID() || m.Role != roleViewer || len(m.RemovedTracks) != 2 || !m.ExpiredAt.Equal(*deadline) {
+		t.Fatalf("publish-expired %+v", m)
+	}
+	if n := rm.GetTrackCount(); n != 2 {
+		t.Fatalf("%d tracks left after the guest's window ended", n)
+	}
+	for {
+		select {
+		case info := <-updates:
+			if info.PeerID != guest.PeerID() || info.Role != roleViewer {
+				continue
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("bob not told the guest is a viewer")
+		}
+		break
+	}
+
+	// New tracks are refused, while the guest keeps receiving
+	publish(t, guest, "guest-again")
+	eventually(t, "the new tracks to be rejected", func() bool { return len(rejections.get()) == 2 })
+	for _, reason := range rejections.get() {
+		if reason != room.RejectPublisherRoleRequired {
+			t.Fatalf("new track rejected for %s", reason)
+		}
+	}
+	received.mu.Lock()
+	before := received.packets[alice.PeerID()+"/audio"]
+	received.mu.Unlock()
+	eventually(t, "the guest to keep receiving alice", func() bool {
+		received.mu.Lock()
+		defer received.mu.Unlock()
+		return received.packets[alice.PeerID()+"/audio"] > before
+	})
+
+	// Others joining see the role, and resuming after the window stays a viewer
+	states := make(chan signaling.RoomStateMessage, 1)
+	ts.join(t, "carol", "room-1", client.Handlers{OnRoomState: func(s signaling.RoomStateMessage) { states <- s }}, client.JoinOptions{})
+	select {
+	case state := <-states:
+		roles := make(map[string]string)
+		for _, p := range state.Peers {
+			roles[p.UserID] = p.Role
+		}
+		if roles["guest"] != roleViewer || roles["alice"] != "" {
+			t.Fatalf("room-state roles %v", roles)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no room-state")
+	}
+	ts.forceRejoin(t, "room-1", "guest")
+	select {
+	case info := <-resumed:
+		if info.Role != roleViewer {
+			t.Fatalf("resumed after the window as %q", info.Role)
+		}
+		eventually(t, "the republished tracks to be rejected", func() bool { return len(rejections.get()) > 2 })
+	case <-time.After(5 * time.Second):
+		t.Fatal("guest not resumed")
+	}
+	select {
+	case m := <-expired:
+		t.Fatalf("publish-expired again after resuming: %+v", m)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// The window runs from the invite's first redemption, so a new session
+	// with the same invite does not get a fresh one
+	late := ts.join(t, "dave", "room-1", client.Handlers{}, client.JoinOptions{InviteToken: invite.Token})
+	if info := late.Info(); info.Role != roleViewer || info.PublishUntil == nil || !info.PublishUntil.Equal(*deadline) {
+		t.Fatalf("joined with the invite after its window as %q until %v", info.Role, info.PublishUntil)
+	}
+}
@@ -0,0 +1,158 @@
+package sfu
+
+import (
+	"fmt"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"golang.org/x/time/rate"
+)
+
+// Signaling messages are rate limited per client by cost class, each with
+// its own limiter, so a flood of cheap messages cannot use up the budget of
+// expensive ones:
+//
+//   - control: joins, offers and other messages that set up or change a
+//     session, which cost Redis work or a negotiation. Tightly limited.
+//   - media-signaling: answers and messages that adjust forwarding of
+//     existing tracks.
+//   - chatty: ICE candidates and keepalives, sent in bursts and nearly free.
+//
+// A message type missing from messageClasses counts as control.
+
+// messageClass is the cost class of a signaling message type.
+type messageClass int
+
+const (
+	classControl messageClass = iota
+	classMediaSignaling
+	classChatty
+	numMessageClasses
+)
+
+func (c messageClass) String() string {
+	switch c {
+	case classMediaSignaling:
+		return "media-signaling"
+	case classChatty:
+		return "chatty"
+	}
+	return "control"
+}
+
+var messageClasses = map[signaling.MessageType]messageClass{
+	signaling.MessageTypeJoin:                  classControl,
+	signaling.MessageTypeLeave:                 classControl,
+	signaling.MessageTypeOffer:                 classControl,
+	signaling.MessageTypeICERestartRequest:     classControl,
+	signaling.MessageTypeIsAllowRenegotiation:  classControl,
+	signaling.MessageTypePublishIntent:         classControl,
+	signaling.MessageTypeSubscribe:             classControl,
+	signaling.MessageTypeUnsubscribe:           classControl,
+	signaling.MessageTypeSetTrackPriorities:    classControl,
+	signaling.MessageTypeSetReceivePreferences: classControl,
+	signaling.MessageTypeSetBandwidthLimit:     classControl,
+	signaling.MessageTypeExtendTimeLimit:       classControl,
+	signaling.MessageTypeUpdateName:            classControl,
+	signaling.MessageTypeTransferHost:          classControl,
+	signaling.MessageTypeMuteAll:               classControl,
+	signaling.MessageTypeSpotlight:             classControl,
+	signaling.MessageTypeLockRoom:              classControl,
+	signaling.MessageTypeAnswer:                classMediaSignaling,
+	signaling.MessageTypeLayerSwitch:           classMediaSignaling,
+	signaling.MessageTypeRequestKeyframe:       classMediaSignaling,
+	signaling.MessageTypeMediaState:            classMediaSignaling,
+	signaling.MessageTypeDataBroadcast:         classMediaSignaling,
+	signaling.MessageTypeICECandidate:          classChatty,
+	signaling.MessageTypeP2PRelay:              classChatty,
+	signaling.MessageTypeRelay:                 classChatty,
+	signaling.MessageTypePing:                  classChatty,
+	signaling.MessageTypePong:                  classChatty,
+}
+
+// classOf returns the cost class of msgType.
+func classOf(msgType signaling.MessageType) messageClass {
+	if class, ok := messageClasses[msgType]; ok {
+		return class
+	}
+	return classControl
+}
+
+// clientLimiters are a client's rate limiters, one per class.
+type clientLimiters [numMessageClasses]*rate.Limiter
+
+// newClientLimiters returns limiters at the configured class rates. A rate
+// of 0 or less leaves the class unlimited.
+func (s *SFU) newClientLimiters() *clientLimiters {
+	media := s.config.Media
+	limits := [numMessageClasses]struct {
+		perSec float64
+		burst  int
+	}{
+		classControl:        {media.RateLimitControlPerSec, media.RateLimitControlBurst},
+		classMediaSignaling: {media.RateLimitPerSec, media.RateLimitBurst},
+		classChatty:         {media.RateLimitChattyPerSec, media.RateLimitChattyBurst},
+	}
+	var l clientLimiters
+	for class, limit := range limits {
+		if limit.perSec <= 0 {
+			l[class] = rate.NewLimiter(rate.Inf, 0)
+			continue
+		}
+		l[class] = rate.NewLimiter(rate.Limit(limit.perSec), max(limit.burst, 1))
+	}
+	return &l
+}
+
+// allow takes a token from class's limiter. If none is available it returns
+// false and how long until one is.
+func (l *clientLimiters) allow(class messageClass) (bool, time.Duration) {
+	r := l[class].Reserve()
+	if !r.OK() {
+		return false, time.Second
+	}
+	if delay := r.Delay(); delay > 0 {
+		r.Cancel()
+		return false, delay
+	}
+	return true, 0
+}
+
+func (s *SFU) getClientLimiters(clientID string) *clientLimiters {
+	s.rateLimitersMu.Lock()
+	defer s.rateLimitersMu.Unlock()
+	if limiters, ok := s.rateLimiters[clientID]; ok {
+		return limiters
+	}
+	limiters := s.newClientLimiters()
+	s.rateLimiters[clientID] = limiters
+	return limiters
+}
+
+func (s *SFU) removeClientRateLimiter(clientID string) {
+	s.rateLimitersMu.Lock()
+	delete(s.rateLimiters, clientID)
+	s.rateLimitersMu.Unlock()
+}
+
+// rateLimitMessages drops the messages of a client over the rate limit of
+// their class, answering with a retryable error naming the class.
+func (s *SFU) rateLimitMessages(next messageHandler) messageHandler {
+	return func(client *signaling.Client, message signaling.Message) {
+		class := classOf(message.Type)
+		if ok, retryAfter := s.getClientLimiters(client.ID).allow(class); !ok {
+			appmetrics.RecordRateLimitRejection(class.String())
+			client.SendErrorMessage(signaling.ErrorMessage{
+				Code:           429,
+				Message:        fmt.Sprintf("Rate limit exceeded for %s messages", class),
+				Retryable:      true,
+				RetryAfterMs:   max(retryAfter.Milliseconds(), 1),
+				Reason:         signaling.ErrorReasonRateLimited,
+				RateLimitClass: class.String(),
+			})
+			return
+		}
+		next(client, message)
+	}
+}
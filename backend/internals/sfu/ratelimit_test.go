@@ -0,0 +1,146 @@
+package sfu
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// rateLimitTest is an SFU whose rate limit middleware counts what it lets
+// through, by message type.
+type rateLimitTest struct {
+	s      *SFU
+	handle messageHandler
+	passed map[signaling.MessageType]int
+}
+
+func newRateLimitTest(media config.MediaConfig) *rateLimitTest {
+	rt := &rateLimitTest{
+		s: &SFU{
+			config:       &config.Config{Media: media},
+			rateLimiters: make(map[string]*clientLimiters),
+		},
+		passed: make(map[signaling.MessageType]int),
+	}
+	rt.handle = rt.s.rateLimitMessages(func(client *signaling.Client, message signaling.Message) {
+		rt.passed[message.Type]++
+	})
+	return rt
+}
+
+// send passes n messages of type typ from client through the middleware.
+func (rt *rateLimitTest) send(client *signaling.Client, typ signaling.MessageType, n int) {
+	for i := 0; i < n; i++ {
+		rt.handle(client, signaling.Message{Type: typ})
+	}
+}
+
+// rejections returns the errors sent to client, in order.
+func rejections(t *testing.T, client *signaling.Client) []signaling.ErrorMessage {
+	t.Helper()
+	var out []signaling.ErrorMessage
+	for {
+		select {
+		case m := <-client.Send:
+			var e signaling.ErrorMessage
+			if err := json.Unmarshal(m.Data, &e); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, e)
+		default:
+			return out
+		}
+	}
+}
+
+// slowLimits refill too slowly for a test to see, so only the bursts pass.
+var slowLimits = config.MediaConfig{
+	RateLimitControlPerSec: 0.001, RateLimitControlBurst: 3,
+	RateLimitPerSec: 0.001, RateLimitBurst: 5,
+	RateLimitChattyPerSec: 0.001, RateLimitChattyBurst: 20,
+}
+
+func TestRateLimitClassesAreIsolated(t *testing.T) {
+	rt := newRateLimitTest(slowLimits)
+	client := signaling.NewClient("c1", "alice", "Alice", nil, zap.NewNop())
+
+	// A candidate flood uses up the chatty budget only
+	rt.send(client, signaling.MessageTypeICECandidate, 50)
+	rt.send(client, signaling.MessageTypeJoin, 1)
+	rt.send(client, signaling.MessageTypeOffer, 5)
+	rt.send(client, signaling.MessageTypeAnswer, 10)
+	rt.send(client, signaling.MessageTypePing, 1)
+
+	for typ, want := range map[signaling.MessageType]int{
+		signaling.MessageTypeICECandidate: 20,
+		signaling.MessageTypeJoin:         1,
+		signaling.MessageTypeOffer:        2,
+		signaling.MessageTypeAnswer:       5,
+		signaling.MessageTypePing:         0,
+	} {
+		if got := rt.passed[typ]; got != want {
+			t.Errorf("%s: %d passed, want %d", typ, got, want)
+		}
+	}
+
+	byClass := map[string]int{}
+	for _, e := range rejections(t, client) {
+		if e.Code != 429 || !e.Retryable || e.Reason != signaling.ErrorReasonRateLimited || e.RetryAfterMs <= 0 {
+			t.Fatalf("rejection %+v", e)
+		}
+		byClass[e.RateLimitClass]++
+	}
+	if byClass["chatty"] != 31 || byClass["control"] != 3 || byClass["media-signaling"] != 5 {
+		t.Fatalf("rejections by class %v", byClass)
+	}
+}
+
+func TestRateLimitPerClient(t *testing.T) {
+	rt := newRateLimitTest(slowLimits)
+	alice := signaling.NewClient("c1", "alice", "Alice", nil, zap.NewNop())
+	bob := signaling.NewClient("c2", "bob", "Bob", nil, zap.NewNop())
+
+	rt.send(alice, signaling.MessageTypeJoin, 5)
+	rt.send(bob, signaling.MessageTypeJoin, 1)
+	if got := rt.passed[signaling.MessageTypeJoin]; got != 4 {
+		t.Fatalf("%d joins passed, want alice's burst of 3 and bob's", got)
+	}
+	if got := len(rejections(t, bob)); got != 0 {
+		t.Fatalf("bob got %d rejections", got)
+	}
+
+	// A client that reconnects starts with a fresh budget
+	rt.s.removeClientRateLimiter(alice.ID)
+	rt.send(alice, signaling.MessageTypeJoin, 1)
+	if got := rt.passed[signaling.MessageTypeJoin]; got != 5 {
+		t.Fatalf("%d joins passed after the limiter was removed, want 5", got)
+	}
+}
+
+func TestRateLimitUnlimitedClass(t *testing.T) {
+	media := slowLimits
+	media.RateLimitChattyPerSec = 0
+	rt := newRateLimitTest(media)
+	client := signaling.NewClient("c1", "alice", "Alice", nil, zap.NewNop())
+
+	rt.send(client, signaling.MessageTypeICECandidate, 1000)
+	if got := rt.passed[signaling.MessageTypeICECandidate]; got != 1000 {
+		t.Fatalf("%d candidates passed, want all", got)
+	}
+}
+
+func TestClassOf(t *testing.T) {
+	for typ, want := range map[signaling.MessageType]messageClass{
+		signaling.MessageTypeJoin:           classControl,
+		signaling.MessageTypeAnswer:         classMediaSignaling,
+		signaling.MessageTypeICECandidate:   classChatty,
+		signaling.MessageType("not-a-type"): classControl,
+	} {
+		if got := classOf(typ); got != want {
+			t.Errorf("classOf(%s) = %s, want %s", typ, got, want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/session"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// A network change on mobile typically kills the media path and the
+// WebSocket together. When the WebSocket of a peer with a session drops, the
+// peer is not removed at once but kept, detached, for the disconnect grace.
+// A resumed join that asks to reattach takes the peer over on the new
+// connection; if the PeerConnection failed meanwhile it gets the pending or
+// a new ICE restart offer, and the handshake completes on the same
+// PeerConnection instead of a new one.
+
+// detachPeer keeps p for the disconnect grace after its signaling connection
+// dropped. Renegotiations are held meanwhile. Unless a resumed join
+// reattaches it first, the peer is then removed.
+func (s *SFU) detachPeer(rm *room.Room, p *peer.Peer) {
+	grace := s.config.Media.PeerDisconnectGrace
+
+	s.detachedMu.Lock()
+	if timer := s.detached[p.ID]; timer != nil {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(grace, func() {
+		s.detachedMu.Lock()
+		current := s.detached[p.ID] == timer
+		if current {
+			delete(s.detached, p.ID)
+		}
+		s.detachedMu.Unlock()
+		if !current {
+			return
+		}
+
+		appmetrics.RecordPeerDetach("expired")
+		s.logger.Info("Detached peer was not reattached, removing",
+			zap.String("roomID", rm.ID),
+			zap.String("peerID", p.ID),
+			zap.Duration("grace", grace),
+		)
+		rm.RemovePeerIfCurrent(p)
+	})
+	s.detached[p.ID] = timer
+	s.detachedMu.Unlock()
+
+	rm.SetPeerDetached(p, true)
+	appmetrics.RecordPeerDetach("detached")
+	s.logger.Info("Signaling connection lost, keeping peer for reattach",
+		zap.String("roomID", rm.ID),
+		zap.String("peerID", p.ID),
+		zap.Duration("grace", grace),
+	)
+}
+
+// takeDetachedPeer cancels peerID's pending removal. It reports whether the
+// peer was detached.
+func (s *SFU) takeDetachedPeer(peerID string) bool {
+	s.detachedMu.Lock()
+	defer s.detachedMu.Unlock()
+	timer, ok := s.detached[peerID]
+	if ok {
+		timer.Stop()
+		delete(s.detached, peerID)
+	}
+	return ok
+}
+
+// isDetached reports whether peerID is being kept for a reattach.
+func (s *SFU) isDetached(peerID string) bool {
+	s.detachedMu.Lock()
+	defer s.detachedMu.Unlock()
+	_, ok := s.detached[peerID]
+	return ok
+}
+
+// reattachPeer hands the peer of a resumed session over to client. It
+// returns false, changing nothing, when there is no peer to take over; the
+// join then continues as a fresh one. The old connection may not have been
+// noticed as dead yet, in which case it is taken out of the room and closed.
+func (s *SFU) reattachPeer(client *signaling.Client, sess *session.Session, join signaling.JoinMessage) bool {
+	rm, p := s.getRoomAndPeer(join.RoomID, join.UserID)
+	if rm == nil || p == nil || p.ID != sess.PeerID || p.Connection == nil ||
+		p.Connection.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		return false
+	}
+
+	s.takeDetachedPeer(p.ID)
+	for _, old := range s.signalingHub.DetachPeer(p.ID, client.ID) {
+		s.pruneMembership(old)
+	}
+	s.signalingHub.DisconnectClientsByUserID(join.UserID, client.ID)
+
+	s.signalingHub.SetRoom(client, join.RoomID, p.ID)
+	client.SetLeft(false)
+	s.releaseUnjoined(client.ID)
+	if client.UserID != join.UserID { // see handleJoinMessage
+		client.UserID = join.UserID
+	}
+	client.Name = p.GetName()
+
+	responseData := s.joinResponse(client, rm, p, sess, true)
+	responseData.Reattached = true
+	data, err := json.Marshal(responseData)
+	if err != nil {
+		client.SendError(500, "Internal server error")
+		return true
+	}
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypeJoin, Data: data, Timestamp: time.Now(),
+	})
+	appmetrics.RecordPeerDetach("reattached")
+
+	state := p.Connection.ConnectionState()
+	s.logger.Info("Peer reattached",
+		zap.String("room", rm.ID),
+		zap.String("peer", p.ID),
+		zap.String("connectionState", state.String()),
+	)
+
+	s.sendRoomState(client, rm, p.ID)
+	s.sendDraining(client)
+
+	// A failed or disconnected connection is recovered on the same
+	// PeerConnection. Renegotiations stay held until it is restored.
+	if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateDisconnected ||
+		p.PendingOffer() != nil {
+		if err := s.sendICERestartOffer(client, rm, p, peer.ICERestartByServer); err != nil {
+			s.logger.Error("ICE restart after reattach failed", zap.String("peerID", p.ID), zap.Error(err))
+		}
+	}
+	rm.SetPeerDetached(p, false)
+	return true
+}
+
+// sendICERestartOffer sends p's ICE restart offer to client. An offer still
+// waiting for its answer, whose delivery was lost with the old connection,
+// is sent again rather than restarting ICE a second time. A new restart is
+// drawn from p's budget, asked for by initiator; a refusal is sent to the
+// client instead (see icerestart.go).
+func (s *SFU) sendICERestartOffer(client *signaling.Client, rm *room.Room, p *peer.Peer, initiator string) error {
+	_, retryAfter, err := s.offerICERestart(client, p, initiator)
+	if errors.Is(err, peer.ErrICERestartCooldown) || errors.Is(err, peer.ErrICERestartBudgetExhausted) {
+		s.refuseICERestart(client, rm, p, initiator, retryAfter, err)
+		return nil
+	}
+	return err
+}
+
+// offerICERestart is sendICERestartOffer without the refusal: p's budget
+// errors are returned with how long until a restart is allowed. It reports
+// whether the offer was queued on client.
+func (s *SFU) offerICERestart(client *signaling.Client, p *peer.Peer, initiator string) (bool, time.Duration, error) {
+	offer := p.PendingOffer()
+	if offer == nil {
+		if retryAfter, err := p.BeginICERestart(initiator); err != nil {
+			return false, retryAfter, err
+		}
+		var err error
+		if offer, err = p.RequestICERestart(); err != nil {
+			p.EndICERestart(false)
+			return false, 0, err
+		}
+		appmetrics.RecordICERestart()
+	}
+	*offer = s.completeLocalDescription(p, *offer)
+
+	data, err := json.Marshal(signaling.OfferMessage{
+		SDP:    offer.SDP,
+		Type:   webrtc.SDPTypeOffer.String(),
+		PeerID: p.ID,
+	})
+	if err != nil {
+		return false, 0, fmt.Errorf("encode offer: %w", err)
+	}
+
+	queued := client.TrySendMessage(signaling.Message{
+		Type: signaling.MessageTypeICERestartOffer, Data: data, Timestamp: time.Now(),
+	})
+	return queued, 0, nil
+}
@@ -0,0 +1,178 @@
+package sfu
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/pion/logging"
+	"github.com/pion/transport/v2/vnet"
+	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// link is a virtual network between the SFU and a client API whose packets
+// can be cut off and let through again. ICE fails soon after a cut.
+type link struct {
+	server, client *webrtc.API
+	cut            atomic.Bool
+}
+
+func newLink(t *testing.T) *link {
+	t.Helper()
+	router, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          "10.0.0.0/24",
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &link{}
+	router.AddChunkFilter(func(vnet.Chunk) bool { return !l.cut.Load() })
+
+	api := func(ip string) *webrtc.API {
+		n, err := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{ip}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := router.AddNet(n); err != nil {
+			t.Fatal(err)
+		}
+		var se webrtc.SettingEngine
+		se.SetVNet(n)
+		se.SetICETimeouts(300*time.Millisecond, time.Second, 100*time.Millisecond)
+		m := &webrtc.MediaEngine{}
+		if err := m.RegisterDefaultCodecs(); err != nil {
+			t.Fatal(err)
+		}
+		return webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithSettingEngine(se))
+	}
+	l.server, l.client = api("10.0.0.1"), api("10.0.0.2")
+	if err := router.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { router.Stop() })
+	return l
+}
+
+// waitState waits for state to report want.
+func waitState(t *testing.T, what string, state func() webrtc.PeerConnectionState, want webrtc.PeerConnectionState) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for state() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s is %s, want %s", what, state(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReattachFinishesICERestart(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.PeerDisconnectGrace = 10 * time.Second
+		cfg.Media.HoldTracksDuringGrace = true
+	})
+	link := newLink(t)
+	ts.webrtcAPI = link.server
+
+	// bob watches without media for alice leaving
+	bob := ts.joinScripted(t, "bob", "room-1")
+	var bobSaw messageCounts
+	bobSaw.drain(bob)
+
+	pc, err := link.client.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	alice := ts.dialScripted(t, "alice")
+	alice.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "alice", NoTrickle: true})
+	var info signaling.JoinResponse
+	for _, m := range alice.readUntil(t, signaling.MessageTypeJoin) {
+		if m.Type == signaling.MessageTypeJoin {
+			if err := json.Unmarshal(m.Data, &info); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	offerAudio(t, pc)
+	<-webrtc.GatheringCompletePromise(pc)
+	alice.pipeline(t, signaling.MessageTypeOffer, signaling.OfferMessage{SDP: pc.LocalDescription().SDP, Type: "offer"})
+	readAnswer(t, alice, pc)
+	_, p := ts.getRoomAndPeer("room-1", "alice")
+	if p == nil {
+		t.Fatal("alice has no peer")
+	}
+	serverPC := p.Connection
+	waitState(t, "alice's connection", serverPC.ConnectionState, webrtc.PeerConnectionStateConnected)
+
+	// The network change takes the media path and the WebSocket together
+	link.cut.Store(true)
+	waitState(t, "alice's connection", serverPC.ConnectionState, webrtc.PeerConnectionStateFailed)
+	waitState(t, "alice's PeerConnection", pc.ConnectionState, webrtc.PeerConnectionStateFailed)
+	alice.hangUp()
+	eventually(t, "alice to be detached", func() bool { return ts.isDetached(p.ID) })
+	reattached := testutil.ToFloat64(appmetrics.PeerDetachTotal.WithLabelValues("reattached"))
+
+	// The resumed join takes the peer over and gets a restart offer
+	alice = ts.dialScripted(t, "alice")
+	alice.pipeline(t, signaling.MessageTypeJoin, struct {
+		signaling.JoinMessage
+		SessionID    string `json:"sessionId"`
+		SessionToken string `json:"sessionToken"`
+	}{
+		JoinMessage:  signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "alice", NoTrickle: true, Reattach: true},
+		SessionID:    info.SessionID,
+		SessionToken: info.SessionToken,
+	})
+	var resumed signaling.JoinResponse
+	var offer signaling.OfferMessage
+	for _, m := range alice.readUntil(t, signaling.MessageTypeICERestartOffer) {
+		switch m.Type {
+		case signaling.MessageTypeJoin:
+			if err := json.Unmarshal(m.Data, &resumed); err != nil {
+				t.Fatal(err)
+			}
+		case signaling.MessageTypeICERestartOffer:
+			if err := json.Unmarshal(m.Data, &offer); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if !resumed.Reattached || resumed.PeerID != p.ID {
+		t.Fatalf("resumed as %s, reattached %v; want %s reattached", resumed.PeerID, resumed.Reattached, p.ID)
+	}
+	if ts.isDetached(p.ID) {
+		t.Fatal("alice still detached after reattaching")
+	}
+	if n := testutil.ToFloat64(appmetrics.PeerDetachTotal.WithLabelValues("reattached")) - reattached; n != 1 {
+		t.Fatalf("%v reattaches counted", n)
+	}
+
+	// The handshake completes on the PeerConnections both sides kept
+	link.cut.Store(false)
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer.SDP}); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	<-webrtc.GatheringCompletePromise(pc)
+	alice.pipeline(t, signaling.MessageTypeAnswer, signaling.AnswerMessage{SDP: pc.LocalDescription().SDP, Type: "answer", PeerID: p.ID})
+	waitState(t, "alice's connection", serverPC.ConnectionState, webrtc.PeerConnectionStateConnected)
+	waitState(t, "alice's PeerConnection", pc.ConnectionState, webrtc.PeerConnectionStateConnected)
+	if _, now := ts.getRoomAndPeer("room-1", "alice"); now != p || now.Connection != serverPC {
+		t.Fatal("alice's peer or PeerConnection was replaced")
+	}
+	if n := bobSaw.get(signaling.MessageTypePeerLeft); n != 0 {
+		t.Fatalf("bob was told %d times that alice left", n)
+	}
+}
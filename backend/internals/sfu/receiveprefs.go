@@ -0,0 +1,127 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/session"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"go.uber.org/zap"
+)
+
+// Receive preferences (see room/receiveprefs.go) are set with
+// set-receive-preferences or along with a subscribe, kept on the session and
+// reapplied when it resumes.
+
+// handleSetReceivePreferencesMessage sets the sender's receive preferences
+// and answers with the resulting ones.
+func (s *SFU) handleSetReceivePreferencesMessage(client *signaling.Client, message signaling.Message, msg signaling.ReceivePreferencesMessage) {
+
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+
+	prefs, err := rm.SetReceivePreferences(p, msg.Preferences, msg.Replace)
+	if err != nil {
+		client.SendError(400, err.Error())
+		return
+	}
+	s.recordReceivePreferences(p, prefs)
+
+	data, err := json.Marshal(signaling.ReceivePreferencesMessage{Preferences: prefs})
+	if err != nil {
+		return
+	}
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypeReceivePreferences, Data: data, Timestamp: time.Now(),
+	})
+}
+
+// applyReceivePreferences merges the preferences sent with a subscribe,
+// returning the refs that could not be applied and why.
+func (s *SFU) applyReceivePreferences(rm *room.Room, p *peer.Peer, prefs map[string]signaling.ReceivePreference) map[string]string {
+	if len(prefs) == 0 {
+		return nil
+	}
+	var rejected map[string]string
+	for ref, pref := range prefs {
+		if _, err := rm.SetReceivePreferences(p, map[string]room.ReceivePreference{ref: pref}, false); err != nil {
+			if rejected == nil {
+				rejected = make(map[string]string)
+			}
+			rejected[ref] = err.Error()
+		}
+	}
+	s.recordReceivePreferences(p, rm.ReceivePreferences(p.ID))
+	return rejected
+}
+
+// recordReceivePreferences keeps p's session in step with its receive
+// preferences.
+func (s *SFU) recordReceivePreferences(p *peer.Peer, prefs map[string]room.ReceivePreference) {
+	sm := s.sessionManager.Load()
+	if sm == nil {
+		return
+	}
+	sessionID := sm.UserSessionID(p.UserID, p.RoomID)
+	if sessionID == "" {
+		return
+	}
+	ctx, cancel := s.messageContext()
+	defer cancel()
+	sm.SetReceivePreferences(ctx, sessionID, toStateReceivePreferences(prefs))
+}
+
+// restoreReceivePreferences reapplies a resumed session's receive
+// preferences to p, dropping those of tracks that are gone. A fresh join
+// starts without any.
+func (s *SFU) restoreReceivePreferences(ctx context.Context, rm *room.Room, p *peer.Peer, sess *session.Session, resumed bool) {
+	if len(sess.ReceivePreferences) == 0 {
+		return
+	}
+	sm := s.sessionManager.Load()
+	if !resumed {
+		sm.SetReceivePreferences(ctx, sess.ID, nil)
+		return
+	}
+
+	for handle, pref := range sess.ReceivePreferences {
+		prefs := map[string]room.ReceivePreference{handle: fromStateReceivePreference(pref)}
+		if _, err := rm.SetReceivePreferences(p, prefs, false); err != nil {
+			s.logger.Debug("Dropped stale receive preference",
+				zap.String("peerID", p.ID),
+				zap.String("track", handle),
+			)
+		}
+	}
+	sm.SetReceivePreferences(ctx, sess.ID, toStateReceivePreferences(rm.ReceivePreferences(p.ID)))
+}
+
+func toStateReceivePreferences(prefs map[string]room.ReceivePreference) map[string]state.ReceivePreference {
+	if len(prefs) == 0 {
+		return nil
+	}
+	out := make(map[string]state.ReceivePreference, len(prefs))
+	for handle, pref := range prefs {
+		out[handle] = state.ReceivePreference{
+			MaxWidth:     pref.MaxWidth,
+			MaxHeight:    pref.MaxHeight,
+			MaxFramerate: pref.MaxFramerate,
+		}
+	}
+	return out
+}
+
+func fromStateReceivePreference(pref state.ReceivePreference) room.ReceivePreference {
+	return room.ReceivePreference{
+		MaxWidth:     pref.MaxWidth,
+		MaxHeight:    pref.MaxHeight,
+		MaxFramerate: pref.MaxFramerate,
+	}
+}
@@ -0,0 +1,184 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/capture"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/webhook"
+	"go.uber.org/zap"
+)
+
+// Captures are the SFU's recordings (the call summary lists them as such),
+// and their lifecycle is sent to the webhook for systems that file them:
+// recording.started when one starts, then recording.stopped, or
+// recording.failed if writing it failed, and recording.uploaded once a
+// stopped recording's file is complete on disk and can be downloaded from its
+// storageUrl. There is no remote storage: uploaded means the local file is
+// ready, and a recording deleted or whose file is gone stays stopped.
+// The events go through the webhook's queue with its signatures, retries and
+// dead-letter stream, and carry X-SFU-Event-ID so receivers can drop
+// repeats. GET /api/recordings/{id} returns a recording's latest state, so a
+// receiver that missed events can catch up.
+
+// recordingEventPrefix precedes the state in a recording event's type.
+const recordingEventPrefix = "recording."
+
+// recordingState is the lifecycle of a capture session as a recording.
+// Guarded by captureSession.mu.
+type recordingState struct {
+	state        string
+	storageURL   string
+	participants []string // user IDs, in the order they were seen
+}
+
+// addParticipant records that userID was in the room while cs ran.
+func (cs *captureSession) addParticipant(userID string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if userID != "" && !slices.Contains(cs.rec.participants, userID) {
+		cs.rec.participants = append(cs.rec.participants, userID)
+	}
+}
+
+// recording returns cs as a recording in its current state.
+func (cs *captureSession) recording() webhook.Recording {
+	info := cs.snapshot()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	rec := webhook.Recording{
+		ID:           info.ID,
+		RoomID:       info.RoomID,
+		State:        cs.rec.state,
+		StartedAt:    info.StartedAt,
+		StoppedAt:    info.StoppedAt,
+		Bytes:        info.Bytes,
+		StorageURL:   cs.rec.storageURL,
+		Participants: slices.Clone(cs.rec.participants),
+	}
+	end := time.Now()
+	if info.StoppedAt != nil {
+		end = *info.StoppedAt
+	}
+	rec.DurationMs = end.Sub(*info.StartedAt).Milliseconds()
+	if rec.State == webhook.RecordingFailed {
+		rec.Error = info.StopReason
+	}
+	return rec
+}
+
+// setRecordingState moves cs to state and sends the matching event.
+func (s *SFU) setRecordingState(cs *captureSession, state string) {
+	cs.mu.Lock()
+	cs.rec.state = state
+	cs.mu.Unlock()
+
+	rec := cs.recording()
+	s.webhooks.Send(webhook.Event{
+		Type:       recordingEventPrefix + state,
+		InstanceID: s.instanceID(),
+		RoomID:     rec.RoomID,
+		At:         time.Now(),
+		Recording:  &rec,
+	})
+}
+
+// startRecording begins the lifecycle of a capture just started in rm.
+func (s *SFU) startRecording(cs *captureSession, rm *room.Room, storageURL string) {
+	cs.mu.Lock()
+	cs.rec.storageURL = storageURL
+	cs.mu.Unlock()
+	for _, p := range rm.GetAllPeers() {
+		cs.addParticipant(p.UserID)
+	}
+	s.setRecordingState(cs, webhook.RecordingStarted)
+}
+
+// finishRecording ends the lifecycle of a capture that has stopped. It is
+// uploaded only if its file is there to fetch: one deleted while running, or
+// whose file was removed, is stopped but never available.
+func (s *SFU) finishRecording(cs *captureSession) {
+	if cs.c.Stats().StopReason == capture.StopError {
+		s.setRecordingState(cs, webhook.RecordingFailed)
+		return
+	}
+	s.setRecordingState(cs, webhook.RecordingStopped)
+
+	s.captures.mu.Lock()
+	deleted := s.captures.byID[cs.info.ID] != cs
+	s.captures.mu.Unlock()
+	if deleted {
+		return
+	}
+	// The file is closed once the capture is done, so what is on disk is all
+	// of it
+	if _, err := os.Stat(cs.path); err != nil {
+		s.logger.Warn("Recording file missing after capture stopped",
+			zap.String("captureID", cs.info.ID), zap.Error(err))
+		return
+	}
+	s.setRecordingState(cs, webhook.RecordingUploaded)
+}
+
+// recordParticipant adds a user joining a room to the room's running
+// recordings.
+func (s *SFU) recordParticipant(roomID, userID string) {
+	s.captures.mu.Lock()
+	defer s.captures.mu.Unlock()
+	for _, cs := range s.captures.byID {
+		if cs.info.RoomID != roomID {
+			continue
+		}
+		select {
+		case <-cs.c.Done():
+		default:
+			cs.addParticipant(userID)
+		}
+	}
+}
+
+// handleRecordingsAPI serves GET /api/recordings/{id}: the latest state of a
+// recording started by this instance, or of a file an earlier run left in
+// Capture.Dir, which is complete.
+func (s *SFU) handleRecordingsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	dir := s.config.Capture.Dir
+	if dir == "" {
+		writeAPIError(w, http.StatusServiceUnavailable, "Captures are disabled")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/recordings/")
+
+	s.captures.mu.Lock()
+	cs := s.captures.byID[id]
+	s.captures.mu.Unlock()
+	var rec webhook.Recording
+	if cs != nil {
+		rec = cs.recording()
+	} else {
+		info, _, ok := s.findCapture(dir, id)
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "Recording not found")
+			return
+		}
+		rec = webhook.Recording{
+			ID:           id,
+			State:        webhook.RecordingUploaded,
+			StoppedAt:    info.StoppedAt,
+			Bytes:        info.Bytes,
+			StorageURL:   s.publicURL(r, "/api/captures/"+id, false),
+			Participants: []string{},
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
@@ -0,0 +1,193 @@
+package sfu
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/capture"
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/webhook"
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+	"go.uber.org/zap"
+)
+
+// recordingReceiver is a webhook receiver that fails the first attempt at
+// every event with a 500.
+type recordingReceiver struct {
+	t      *testing.T
+	secret string
+
+	mu       sync.Mutex
+	attempts map[string]int // by X-SFU-Event-ID
+	events   []webhook.Event
+}
+
+func (rr *recordingReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	mac := hmac.New(sha256.New, []byte(rr.secret))
+	mac.Write(body)
+	if got, want := r.Header.Get("X-SFU-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		rr.t.Errorf("signature %q, want %q", got, want)
+	}
+	var ev webhook.Event
+	if err := json.Unmarshal(body, &ev); err != nil {
+		rr.t.Errorf("decode: %v", err)
+	}
+	id := r.Header.Get("X-SFU-Event-ID")
+	if id == "" || id != ev.ID {
+		rr.t.Errorf("X-SFU-Event-ID %q, body id %q", id, ev.ID)
+	}
+
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.attempts[id]++
+	if rr.attempts[id] == 1 {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if rr.attempts[id] > 2 {
+		rr.t.Errorf("event %s delivered again after it was accepted", id)
+	}
+	if strings.HasPrefix(ev.Type, recordingEventPrefix) {
+		rr.events = append(rr.events, ev)
+	}
+}
+
+func (rr *recordingReceiver) delivered() []webhook.Event {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return append([]webhook.Event(nil), rr.events...)
+}
+
+func TestRecordingLifecycle(t *testing.T) {
+	rr := &recordingReceiver{t: t, secret: "s3cret", attempts: make(map[string]int)}
+	srv := httptest.NewServer(rr)
+	defer srv.Close()
+
+	logger := zap.NewNop()
+	cfg := &config.Config{}
+	cfg.Capture.Dir = t.TempDir()
+	s := &SFU{
+		config:   cfg,
+		logger:   logger,
+		captures: captureSessions{byID: make(map[string]*captureSession)},
+		webhooks: webhook.NewSender(webhook.Options{URL: srv.URL, Secret: rr.secret}, nil, logger),
+	}
+	defer s.webhooks.Close()
+
+	rm := room.NewRoom("test", 10, logger)
+	defer rm.Close()
+	if err := rm.AddPeer(peer.NewPeer(rm.ID, "alice", "Alice", logger)); err != nil {
+		t.Fatal(err)
+	}
+
+	record := func() (string, string, *capture.Capture, *captureSession) {
+		t.Helper()
+		id := uuid.New().String()
+		path := filepath.Join(cfg.Capture.Dir, id+capture.FormatPcap.Ext())
+		c, err := capture.Start(path, capture.Options{Format: capture.FormatPcap, Duration: time.Minute, MaxBytes: 1 << 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		cs := &captureSession{
+			info:  captureInfo{ID: id, RoomID: rm.ID, Format: string(capture.FormatPcap), StartedAt: &now},
+			path:  path,
+			c:     c,
+			untap: func() {},
+			ended: make(chan struct{}),
+			rec:   recordingState{participants: []string{}},
+		}
+		s.captures.mu.Lock()
+		s.captures.byID[id] = cs
+		s.captures.mu.Unlock()
+		s.startRecording(cs, rm, "https://sfu.example.com/api/captures/"+id)
+		go s.awaitCapture(cs)
+		return id, path, c, cs
+	}
+	id, path, c, cs := record()
+
+	// A user joining while it runs is a participant too
+	s.handleRoomEvent(rm, room.RoomEvent{Type: room.EventPeerJoined, UserID: "bob"})
+	c.Write(&rtp.Packet{Header: rtp.Header{Version: 2, SSRC: 1}, Payload: []byte{1, 2, 3}})
+
+	get := func(id string) webhook.Recording {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.handleRecordingsAPI(w, httptest.NewRequest(http.MethodGet, "/api/recordings/"+id, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /api/recordings/%s: %d %s", id, w.Code, w.Body)
+		}
+		var rec webhook.Recording
+		if err := json.Unmarshal(w.Body.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+	if rec := get(id); rec.State != webhook.RecordingStarted || rec.RoomID != rm.ID {
+		t.Fatalf("running recording = %+v", rec)
+	}
+
+	c.Stop(capture.StopRequested)
+	<-cs.ended
+
+	deadline := time.Now().Add(10 * time.Second)
+	for len(rr.delivered()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("delivered %d events, want 3", len(rr.delivered()))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	events := rr.delivered()
+	for i, want := range []string{"recording.started", "recording.stopped", "recording.uploaded"} {
+		if events[i].Type != want || events[i].Recording == nil || recordingEventPrefix+events[i].Recording.State != want {
+			t.Fatalf("event %d = %+v, want %s", i, events[i], want)
+		}
+	}
+	last := events[2].Recording
+	if last.ID != id || last.RoomID != rm.ID || last.Bytes == 0 || last.StoppedAt == nil ||
+		last.StorageURL != "https://sfu.example.com/api/captures/"+id {
+		t.Fatalf("uploaded recording = %+v", last)
+	}
+	if len(last.Participants) != 2 || last.Participants[0] != "alice" || last.Participants[1] != "bob" {
+		t.Fatalf("participants = %v, want alice and bob", last.Participants)
+	}
+	if rec := get(id); rec.State != webhook.RecordingUploaded || rec.Bytes != last.Bytes {
+		t.Fatalf("finished recording = %+v", rec)
+	}
+
+	// After a restart the file alone is known
+	delete(s.captures.byID, id)
+	if rec := get(id); rec.State != webhook.RecordingUploaded || rec.Bytes != last.Bytes {
+		t.Fatalf("recording from an earlier run = %+v", rec)
+	}
+	os.Remove(path)
+	w := httptest.NewRecorder()
+	s.handleRecordingsAPI(w, httptest.NewRequest(http.MethodGet, "/api/recordings/"+id, nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("deleted recording: %d, want 404", w.Code)
+	}
+
+	// A recording whose file is gone when it stops is never uploaded
+	id, path, c, cs = record()
+	os.Remove(path)
+	c.Stop(capture.StopRequested)
+	<-cs.ended
+	if rec := get(id); rec.State != webhook.RecordingStopped {
+		t.Fatalf("recording without its file = %+v", rec)
+	}
+}
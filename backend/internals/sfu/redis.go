@@ -0,0 +1,140 @@
+package sfu
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/session"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"go.uber.org/zap"
+)
+
+// redisRetryState is what /health reports while Redis is being retried in
+// the background, and when it was finally reached.
+type redisRetryState struct {
+	mu          sync.Mutex
+	attempts    int
+	lastError   string
+	cause       string
+	nextAttempt time.Time
+	connectedAt time.Time
+}
+
+// attachRedis enables everything backed by Redis. The state manager is
+// stored last because it is what the rest of the SFU checks for.
+func (s *SFU) attachRedis(m *state.Manager) {
+	s.pubsubManager.Store(signaling.NewPubSubManager(m.GetRedisClient(), s.signalingHub, s.logger))
+
+	// Recover sessions from previous run
+	recovered, _ := m.RecoverSessions(s.ctx)
+	if len(recovered) > 0 {
+		s.logger.Info("Recovered sessions from Redis", zap.Int("count", len(recovered)))
+	}
+	s.sessionManager.Store(session.NewManager(m, s.logger))
+
+	s.stateManager.Store(m)
+}
+
+// redisReconnectLoop keeps trying to reach Redis after it was unreachable at
+// startup, backing off exponentially up to Redis.ReconnectMaxBackoff. The
+// audit stream sink is only set up at startup and is not enabled late.
+func (s *SFU) redisReconnectLoop() {
+	maxBackoff := s.config.Redis.ReconnectMaxBackoff
+	if maxBackoff < time.Second {
+		maxBackoff = time.Second
+	}
+	backoff := time.Second
+
+	for {
+		s.redisRetry.mu.Lock()
+		s.redisRetry.nextAttempt = time.Now().Add(backoff)
+		s.redisRetry.mu.Unlock()
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		m, err := state.NewManager(s.config.Redis.Addr, s.config.Redis.Password, s.config.Redis.DB, s.logger)
+		s.redisRetry.mu.Lock()
+		s.redisRetry.attempts++
+		if err != nil {
+			s.redisRetry.lastError = err.Error()
+			s.redisRetry.cause = state.ConnectErrorCause(err)
+			attempts := s.redisRetry.attempts
+			s.redisRetry.mu.Unlock()
+
+			s.logger.Debug("Redis still unreachable",
+				zap.String("addr", s.config.Redis.Addr),
+				zap.String("cause", state.ConnectErrorCause(err)),
+				zap.Int("attempts", attempts),
+				zap.Error(err),
+			)
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+		s.redisRetry.connectedAt = time.Now()
+		attempts := s.redisRetry.attempts
+		s.redisRetry.mu.Unlock()
+
+		if s.ctx.Err() != nil {
+			m.Close()
+			return
+		}
+		s.attachRedis(m)
+		s.logger.Info("Redis reachable, persistence enabled",
+			zap.String("addr", s.config.Redis.Addr),
+			zap.Int("attempts", attempts),
+		)
+		return
+	}
+}
+
+// redisReconnecting is the Redis section of /health while the SFU is
+// (re)connecting in the background.
+type redisReconnecting struct {
+	Status      string    `json:"status"`
+	Addr        string    `json:"addr"`
+	Attempts    int       `json:"attempts"`
+	Cause       string    `json:"cause"`
+	LastError   string    `json:"lastError"`
+	NextAttempt time.Time `json:"nextAttempt"`
+}
+
+// redisConnected is the Redis section of /health once a background
+// connection attempt has succeeded.
+type redisConnected struct {
+	Status      string    `json:"status"`
+	ConnectedAt time.Time `json:"connectedAt"`
+}
+
+// redisHealth is the Redis section of /health, a string when there is
+// nothing more to say, and whether it degrades the instance.
+func (s *SFU) redisHealth(ctx context.Context) (interface{}, bool) {
+	m := s.stateManager.Load()
+	if m == nil {
+		s.redisRetry.mu.Lock()
+		defer s.redisRetry.mu.Unlock()
+		return redisReconnecting{
+			Status:      "reconnecting",
+			Addr:        s.config.Redis.Addr,
+			Attempts:    s.redisRetry.attempts,
+			Cause:       s.redisRetry.cause,
+			LastError:   s.redisRetry.lastError,
+			NextAttempt: s.redisRetry.nextAttempt,
+		}, true
+	}
+
+	if err := m.Ping(ctx); err != nil {
+		return "error: " + err.Error(), true
+	}
+	s.redisRetry.mu.Lock()
+	defer s.redisRetry.mu.Unlock()
+	if !s.redisRetry.connectedAt.IsZero() {
+		return redisConnected{Status: "connected", ConnectedAt: s.redisRetry.connectedAt}, false
+	}
+	return "connected", false
+}
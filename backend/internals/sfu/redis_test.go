@@ -0,0 +1,133 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// unusedAddr returns a local address nothing listens on.
+func unusedAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestRequiredRedisFailsFast(t *testing.T) {
+	addr := unusedAddr(t)
+	cfg := config.LoadConfig()
+	cfg.Redis.Addr = addr
+	cfg.Redis.Required = true
+
+	start := time.Now()
+	_, err := NewSFU(cfg)
+	if err == nil {
+		t.Fatal("started without the Redis it requires")
+	}
+	if !strings.Contains(err.Error(), addr) || !strings.Contains(err.Error(), "refused") {
+		t.Fatalf("error %q does not name the address and the cause", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("took %v to fail", time.Since(start))
+	}
+}
+
+func TestRedisAttachedWhenItComesUp(t *testing.T) {
+	addr := unusedAddr(t)
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Redis.Addr = addr
+		cfg.Redis.Required = false
+	})
+
+	var health struct {
+		Status string          `json:"status"`
+		Redis  json.RawMessage `json:"redis"`
+		PubSub json.RawMessage `json:"pubsub"`
+	}
+	ts.api(t, "GET", ts.config.Server.HealthPath, "", "", &health)
+	var reconnecting redisReconnecting
+	if err := json.Unmarshal(health.Redis, &reconnecting); err != nil {
+		t.Fatalf("redis health %s: %v", health.Redis, err)
+	}
+	if health.Status != "degraded" || reconnecting.Status != "reconnecting" || reconnecting.Addr != addr || reconnecting.Cause != "refused" {
+		t.Fatalf("health without Redis: %s, redis %+v", health.Status, reconnecting)
+	}
+	if string(health.PubSub) != `"disabled"` {
+		t.Fatalf("pubsub health %s without Redis", health.PubSub)
+	}
+
+	mr := miniredis.NewMiniRedis()
+	if err := mr.StartAddr(addr); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	deadline := time.Now().Add(10 * time.Second)
+	for ts.stateManager.Load() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Redis never attached")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	ts.api(t, "GET", ts.config.Server.HealthPath, "", "", &health)
+	var connected redisConnected
+	if err := json.Unmarshal(health.Redis, &connected); err != nil {
+		t.Fatalf("redis health %s: %v", health.Redis, err)
+	}
+	if health.Status != "healthy" || connected.Status != "connected" || connected.ConnectedAt.IsZero() {
+		t.Fatalf("health with Redis: %s, redis %s", health.Status, health.Redis)
+	}
+	if ts.sessionManager.Load() == nil || ts.pubsubManager.Load() == nil {
+		t.Fatal("sessions and pub/sub not enabled with Redis")
+	}
+
+	// A join now keeps its session in Redis
+	ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	eventually(t, "the session to be stored", func() bool { return len(mr.Keys()) > 0 })
+}
+
+func TestStalledRedisBoundedByTimeouts(t *testing.T) {
+	const shutdownTimeout = time.Second
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Server.ShutdownTimeout = shutdownTimeout
+		cfg.Server.MessageTimeout = 300 * time.Millisecond
+	})
+	ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	ts.join(t, "bob", "room-2", client.Handlers{}, client.JoinOptions{})
+	invite, err := ts.stateManager.Load().CreateInvite(context.Background(), "room-1", time.Hour, true, "", "", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Redis stops answering; each call gives up at its context's deadline
+	// rather than the client's read timeout
+	ts.redis.Lock()
+	defer ts.redis.Unlock()
+
+	sc := ts.dialScripted(t, "carol")
+	start := time.Now()
+	sc.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "carol", Name: "carol", InviteToken: invite.Token})
+	sc.readUntil(t, signaling.MessageTypeError)
+	if took := time.Since(start); took > time.Second {
+		t.Fatalf("join with an invite answered after %v", took)
+	}
+
+	start = time.Now()
+	ts.Stop()
+	if took := time.Since(start); took > shutdownTimeout+time.Second {
+		t.Fatalf("Stop took %v", took)
+	}
+}
@@ -0,0 +1,158 @@
+package sfu
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"go.uber.org/zap"
+)
+
+// In a multi-region deployment each instance has a Server.Region and
+// advertises itself in the Redis instance registry with its region, URL and
+// load. A room lives on one instance: a join or room creation for a room
+// this instance does not host is sent on to the instance that does, as its
+// room summary records, and one for a room that does not exist yet goes to
+// the least loaded instance of the preferred region that has room for it.
+// When no instance there has, or the registry cannot be read, the room is
+// created here as without regions. Clients are sent on with an error of
+// reason redirect naming the instance, its URL and region.
+
+// instanceRecord describes this instance for the registry.
+func (s *SFU) instanceRecord() *state.InstanceRecord {
+	s.roomsMu.RLock()
+	rooms := len(s.rooms)
+	peers := 0
+	for _, rm := range s.rooms {
+		peers += rm.GetPeerCount()
+	}
+	s.roomsMu.RUnlock()
+
+	return &state.InstanceRecord{
+		InstanceID: s.instanceID(),
+		Region:     s.config.Server.Region,
+		URL:        s.config.Server.AdvertiseURL,
+		Rooms:      rooms,
+		MaxRooms:   s.config.Server.MaxRooms,
+		Peers:      peers,
+		Draining:   s.draining() != nil,
+	}
+}
+
+// registerInstance refreshes this instance's registry record. It is kept
+// as long as the room summaries.
+func (s *SFU) registerInstance(ctx context.Context) {
+	sm := s.stateManager.Load()
+	if sm == nil || s.instanceID() == "" {
+		return
+	}
+	record := s.instanceRecord()
+	record.UpdatedAt = time.Now()
+	if err := sm.SetInstance(ctx, record, s.roomSummaryTTL()); err != nil {
+		s.logger.Debug("Failed to register instance", zap.Error(err))
+	}
+}
+
+// unregisterInstance drops this instance from the registry on shutdown.
+func (s *SFU) unregisterInstance(ctx context.Context) {
+	sm := s.stateManager.Load()
+	if sm == nil || s.instanceID() == "" {
+		return
+	}
+	if err := sm.DeleteInstance(ctx, s.instanceID()); err != nil {
+		s.logger.Debug("Failed to unregister instance", zap.Error(err))
+	}
+}
+
+// routeRoom returns the instance a join or creation of roomID belongs on
+// when it is not this one, or nil to handle it here.
+func (s *SFU) routeRoom(ctx context.Context, roomID, preferredRegion string) *state.InstanceRecord {
+	sm := s.stateManager.Load()
+	if sm == nil || s.config.Server.Region == "" {
+		return nil
+	}
+	self := s.instanceID()
+
+	if roomID != "" {
+		if s.lookupRoom(roomID) != nil {
+			return nil
+		}
+		summary, err := sm.GetRoomSummary(ctx, roomID)
+		if err == nil && summary != nil && summary.InstanceID != self {
+			// An owner that is not registered has gone away, or predates
+			// the registry; the room is then routed as a new one
+			if owner, err := sm.GetInstance(ctx, summary.InstanceID); err == nil && owner != nil {
+				return owner
+			}
+		}
+	}
+
+	if preferredRegion == "" || (strings.EqualFold(preferredRegion, s.config.Server.Region) && !s.atRoomCapacity()) {
+		return nil
+	}
+	instances, err := sm.ListInstances(ctx)
+	if err != nil {
+		s.logger.Warn("Failed to list instances for region routing", zap.Error(err))
+		return nil
+	}
+	if target := pickRegionInstance(instances, preferredRegion, self); target != nil {
+		return target
+	}
+	s.logger.Info("No instance with capacity in the preferred region, creating the room here",
+		zap.String("roomID", roomID),
+		zap.String("preferredRegion", preferredRegion),
+		zap.String("region", s.config.Server.Region),
+	)
+	return nil
+}
+
+// pickRegionInstance returns the least loaded instance of region that can
+// take a room, other than self, or nil if there is none. Ties go to fewer
+// peers, then the lowest instance ID.
+func pickRegionInstance(instances []*state.InstanceRecord, region, self string) *state.InstanceRecord {
+	candidates := make([]*state.InstanceRecord, 0, len(instances))
+	for _, inst := range instances {
+		if inst.InstanceID != self && strings.EqualFold(inst.Region, region) && inst.HasCapacity() {
+			candidates = append(candidates, inst)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Load() != b.Load() {
+			return a.Load() < b.Load()
+		}
+		if a.Peers != b.Peers {
+			return a.Peers < b.Peers
+		}
+		return a.InstanceID < b.InstanceID
+	})
+	return candidates[0]
+}
+
+// redirectError sends a client on to target.
+func redirectError(target *state.InstanceRecord, code int) signaling.ErrorMessage {
+	return signaling.ErrorMessage{
+		Code:              code,
+		Message:           "Room is hosted by another instance",
+		Reason:            signaling.ErrorReasonRedirect,
+		AlternateInstance: target.InstanceID,
+		AlternateURL:      target.URL,
+		Region:            target.Region,
+	}
+}
+
+// writeRedirect answers a REST room creation that belongs on target with
+// 307, pointing Location at target's rooms API when it advertises a URL.
+func writeRedirect(w http.ResponseWriter, target *state.InstanceRecord) {
+	if target.URL != "" {
+		w.Header().Set("Location", strings.TrimSuffix(target.URL, "/")+"/api/rooms")
+	}
+	writeSignalingError(w, redirectError(target, http.StatusTemporaryRedirect))
+}
@@ -0,0 +1,171 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// joinRouted joins roomID from a new connection preferring region, and
+// returns the error the join was answered with, empty if it joined here.
+func (ts *testServer) joinRouted(t *testing.T, userID, roomID, region string) signaling.ErrorMessage {
+	t.Helper()
+	sc := ts.dialScripted(t, userID)
+	sc.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{
+		RoomID: roomID, UserID: userID, Name: userID, PreferredRegion: region,
+	})
+	return joinReply(t, sc, userID+"'s join of "+roomID)
+}
+
+// joinReply reads sc's messages up to the answer to its join, and returns
+// the error it was answered with, empty if it joined.
+func joinReply(t *testing.T, sc *scriptedClient, what string) signaling.ErrorMessage {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m := <-sc.messages:
+			switch m.Type {
+			case signaling.MessageTypeJoin:
+				return signaling.ErrorMessage{}
+			case signaling.MessageTypeError:
+				var e signaling.ErrorMessage
+				if err := json.Unmarshal(m.Data, &e); err != nil {
+					t.Fatal(err)
+				}
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("no reply to %s", what)
+		}
+	}
+}
+
+func TestRegionRouting(t *testing.T) {
+	mr := miniredis.RunT(t)
+	t.Setenv("INSTANCE_ID", "sfu-eu-1")
+	ts := newTestServer(t, mr, func(cfg *config.Config) {
+		cfg.Server.Region = "eu"
+		cfg.Server.AdvertiseURL = "https://eu-1.example.com"
+		cfg.Server.MaxRooms = 5
+	})
+	sm := ts.stateManager.Load()
+	ctx := context.Background()
+
+	// The instance registers itself on startup
+	self, err := sm.GetInstance(ctx, "sfu-eu-1")
+	if err != nil || self == nil || self.Region != "eu" || self.URL != "https://eu-1.example.com" || self.MaxRooms != 5 {
+		t.Fatalf("registered as %+v, %v", self, err)
+	}
+
+	register := func(record state.InstanceRecord) {
+		t.Helper()
+		if err := sm.SetInstance(ctx, &record, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	register(state.InstanceRecord{InstanceID: "sfu-eu-2", Region: "eu", URL: "https://eu-2.example.com", Rooms: 1, MaxRooms: 10})
+	register(state.InstanceRecord{InstanceID: "sfu-us-1", Region: "us", URL: "https://us-1.example.com", Rooms: 5, MaxRooms: 10, Peers: 40})
+	register(state.InstanceRecord{InstanceID: "sfu-us-2", Region: "us", URL: "https://us-2.example.com", Rooms: 2, MaxRooms: 10, Peers: 10})
+	if err := sm.SetRoomSummary(ctx, &state.RoomSummary{RoomID: "room-us", InstanceID: "sfu-us-1"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetRoomSummary(ctx, &state.RoomSummary{RoomID: "room-gone", InstanceID: "sfu-gone"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	route := func(what, roomID, region, want string) {
+		t.Helper()
+		e := ts.joinRouted(t, "user-"+roomID, roomID, region)
+		switch {
+		case want == "" && e.Code != 0:
+			t.Fatalf("%s: sent on with %+v, want it joined here", what, e)
+		case want == "" && ts.lookupRoom(roomID) == nil:
+			t.Fatalf("%s: joined, but the room is not here", what)
+		case want != "" && (e.Code != http.StatusTemporaryRedirect || e.Reason != signaling.ErrorReasonRedirect || e.AlternateInstance != want):
+			t.Fatalf("%s: answered %+v, want a redirect to %s", what, e, want)
+		case want != "" && ts.lookupRoom(roomID) != nil:
+			t.Fatalf("%s: sent on to %s, but the room was created here too", what, want)
+		}
+	}
+
+	// A new room goes to the least loaded instance of the preferred region
+	route("new room in us", "room-1", "us", "sfu-us-2")
+	if e := ts.joinRouted(t, "someone", "room-1", "us"); e.AlternateURL != "https://us-2.example.com" || e.Region != "us" {
+		t.Fatalf("redirect %+v without the instance's URL and region", e)
+	}
+	route("new room without a preference", "room-2", "", "")
+	route("new room in this region", "room-3", "EU", "")
+	route("new room in a region without instances", "room-4", "ap", "")
+
+	// An existing room is joined where it lives, whatever the preference
+	route("room hosted in us", "room-us", "eu", "sfu-us-1")
+	route("room of an instance that went away", "room-gone", "eu", "")
+	route("room hosted here", "room-2", "us", "")
+
+	// Draining or full instances are passed over
+	register(state.InstanceRecord{InstanceID: "sfu-us-2", Region: "us", Rooms: 2, MaxRooms: 10, Draining: true})
+	route("us-2 draining", "room-5", "us", "sfu-us-1")
+	register(state.InstanceRecord{InstanceID: "sfu-us-1", Region: "us", Rooms: 10, MaxRooms: 10})
+	route("no room left in us", "room-6", "us", "")
+
+	// Full here, a room for this region goes to another instance of it
+	if !ts.atRoomCapacity() {
+		t.Fatalf("%d rooms here, want the limit of 5", len(ts.rooms))
+	}
+	route("this instance full", "room-7", "eu", "sfu-eu-2")
+
+	// Creating a room over REST is redirected the same way
+	register(state.InstanceRecord{InstanceID: "sfu-us-2", Region: "us", URL: "https://us-2.example.com", Rooms: 2, MaxRooms: 10})
+	req, err := http.NewRequest(http.MethodPost, ts.http.URL+"/api/rooms", strings.NewReader(`{"id":"room-8","preferredRegion":"us"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", testAdminKey)
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noFollow.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTemporaryRedirect || resp.Header.Get("Location") != "https://us-2.example.com/api/rooms" {
+		t.Fatalf("POST room in us: %d, Location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+func TestPickRegionInstance(t *testing.T) {
+	instances := []*state.InstanceRecord{
+		{InstanceID: "self", Region: "eu", MaxRooms: 10},
+		{InstanceID: "eu-c", Region: "eu", Rooms: 2, MaxRooms: 10, Peers: 5},
+		{InstanceID: "eu-b", Region: "EU", Rooms: 2, MaxRooms: 10, Peers: 3},
+		{InstanceID: "eu-a", Region: "eu", Rooms: 2, MaxRooms: 10, Peers: 3},
+		{InstanceID: "eu-full", Region: "eu", Rooms: 4, MaxRooms: 4},
+		{InstanceID: "us-unlimited", Region: "us", Rooms: 50},
+		{InstanceID: "us-draining", Region: "us", Draining: true},
+	}
+	for _, tc := range []struct {
+		region, want string
+	}{
+		// Equal loads go to fewer peers, then the lowest instance ID
+		{"eu", "eu-a"},
+		{"Us", "us-unlimited"},
+		{"ap", ""},
+	} {
+		got := pickRegionInstance(instances, tc.region, "self")
+		if (got == nil && tc.want != "") || (got != nil && got.InstanceID != tc.want) {
+			t.Fatalf("%s: picked %+v, want %q", tc.region, got, tc.want)
+		}
+	}
+	if got := pickRegionInstance(instances[:1], "eu", "self"); got != nil {
+		t.Fatalf("picked itself: %+v", got)
+	}
+}
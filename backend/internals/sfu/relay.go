@@ -0,0 +1,106 @@
+package sfu
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/webrtc/v3"
+)
+
+// A relay-only peer (privacy mode) has its PeerConnection on both ends
+// restricted to TURN relay candidates, so neither the participant nor the SFU
+// host learns the other's addresses. With WebRTC.TURNSecret set, TURN
+// credentials are minted per user in the TURN REST API scheme instead of
+// handing every client the shared static ones.
+
+// turnUsername is the identity the SFU's own PeerConnections authenticate
+// to TURN with.
+const turnUsername = "sfu"
+
+func isTURNServer(server webrtc.ICEServer) bool {
+	for _, url := range server.URLs {
+		if strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:") {
+			return true
+		}
+	}
+	return false
+}
+
+// turnCredentials returns TURN REST API credentials for user that expire at
+// expires: the username carries the expiry and the password is its
+// HMAC-SHA1 under the shared secret.
+func turnCredentials(secret, user string, expires time.Time) (username, credential string) {
+	username = strconv.FormatInt(expires.Unix(), 10) + ":" + user
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// withTURNCredentials returns servers with credentials for user on the TURN
+// servers, or servers unchanged when no TURN secret is configured.
+func (s *SFU) withTURNCredentials(servers []webrtc.ICEServer, user string) []webrtc.ICEServer {
+	secret := s.config.WebRTC.TURNSecret
+	if secret == "" {
+		return servers
+	}
+	username, credential := turnCredentials(secret, user, time.Now().Add(s.config.WebRTC.TURNCredentialTTL))
+	out := make([]webrtc.ICEServer, len(servers))
+	for i, server := range servers {
+		if isTURNServer(server) {
+			server.Username = username
+			server.Credential = credential
+			server.CredentialType = webrtc.ICECredentialTypePassword
+		}
+		out[i] = server
+	}
+	return out
+}
+
+// relayAvailable reports whether a TURN server the SFU can authenticate to
+// is configured.
+func (s *SFU) relayAvailable() bool {
+	for _, server := range s.webrtcConfig.ICEServers {
+		if isTURNServer(server) && (s.config.WebRTC.TURNSecret != "" || server.Username != "") {
+			return true
+		}
+	}
+	return false
+}
+
+// peerConfiguration returns the configuration of a new peer's
+// PeerConnection. Every peer's connection gets the SFU's own TURN
+// credentials: with only a secret configured the TURN servers carry none,
+// and pion refuses to create a PeerConnection with them.
+func (s *SFU) peerConfiguration(relayOnly bool) webrtc.Configuration {
+	config := s.webrtcConfig
+	config.ICEServers = s.withTURNCredentials(config.ICEServers, turnUsername)
+	if relayOnly {
+		config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
+	return config
+}
+
+// candidatePairInfo is the candidate pair a peer's media flows over, for
+// auditing relay-only peers.
+type candidatePairInfo struct {
+	LocalType  string `json:"localType"`  // host, srflx, prflx or relay
+	RemoteType string `json:"remoteType"` // as seen by the SFU
+	Protocol   string `json:"protocol"`
+}
+
+func selectedCandidatePair(p *peer.Peer) *candidatePairInfo {
+	pair := p.SelectedCandidatePair()
+	if pair == nil || pair.Local == nil || pair.Remote == nil {
+		return nil
+	}
+	return &candidatePairInfo{
+		LocalType:  pair.Local.Typ.String(),
+		RemoteType: pair.Remote.Typ.String(),
+		Protocol:   pair.Local.Protocol.String(),
+	}
+}
@@ -0,0 +1,237 @@
+package sfu
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/turn/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+const testTURNSecret = "s3cret"
+
+// turnServer runs a local TURN server checking TURN REST API credentials
+// against testTURNSecret, and records the users that presented them.
+type turnServer struct {
+	addr string
+
+	mu    sync.Mutex
+	users map[string]bool
+}
+
+func newTURNServer(t *testing.T) *turnServer {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &turnServer{addr: conn.LocalAddr().String(), users: make(map[string]bool)}
+	s, err := turn.NewServer(turn.ServerConfig{
+		Realm: "sfu.test",
+		// coturn's use-auth-secret: the username is "<expiry>:<user>" and
+		// the password base64(HMAC-SHA1(secret, username))
+		AuthHandler: func(username, realm string, _ net.Addr) ([]byte, bool) {
+			expiry, user, _ := strings.Cut(username, ":")
+			if exp, err := strconv.ParseInt(expiry, 10, 64); err != nil || time.Now().Unix() > exp {
+				return nil, false
+			}
+			mac := hmac.New(sha1.New, []byte(testTURNSecret))
+			mac.Write([]byte(username))
+			ts.mu.Lock()
+			ts.users[user] = true
+			ts.mu.Unlock()
+			return turn.GenerateAuthKey(username, realm, base64.StdEncoding.EncodeToString(mac.Sum(nil))), true
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn: conn,
+			RelayAddressGenerator: &turn.RelayAddressGeneratorStatic{
+				RelayAddress: net.ParseIP("127.0.0.1"),
+				Address:      "127.0.0.1",
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return ts
+}
+
+func (ts *turnServer) authenticated(user string) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.users[user]
+}
+
+func TestTURNCredentials(t *testing.T) {
+	// coturn's use-auth-secret scheme: the password is
+	// base64(HMAC-SHA1(secret, "<expiry>:<user>"))
+	username, credential := turnCredentials(testTURNSecret, "alice", time.Unix(1700000000, 0))
+	if username != "1700000000:alice" || credential != "TtElzSjT0GdnTQ9xdcRNxx96yQs=" {
+		t.Fatalf("credentials %q %q", username, credential)
+	}
+}
+
+func TestRelayOnlyRefusedWithoutTURN(t *testing.T) {
+	for name, servers := range map[string][]config.ICEServer{
+		"STUN only":      {{URLs: []string{"stun:127.0.0.1:3478"}}},
+		"no ICE servers": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ts := newTestServer(t, nil, func(cfg *config.Config) {
+				cfg.WebRTC.ICEServers = servers
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			_, err := ts.connect(t, "alice", client.Handlers{}).JoinRoom(ctx, "room-1", client.JoinOptions{RelayOnly: true})
+			var serverErr *client.ServerError
+			if !errors.As(err, &serverErr) {
+				t.Fatalf("relay-only join: %v", err)
+			}
+			if e := serverErr.ErrorMessage; e.Code != http.StatusServiceUnavailable || e.Reason != signaling.ErrorReasonRelayUnavailable {
+				t.Fatalf("relay-only join refused with %+v", e)
+			}
+
+			// An invite requiring relay is refused the same way, whatever
+			// the join asks for
+			var invite struct {
+				Token string `json:"token"`
+			}
+			if code := ts.api(t, http.MethodPost, "/api/rooms/room-1/invites", `{"relayOnly":true}`, testAdminKey, &invite); code != http.StatusCreated {
+				t.Fatalf("create invite: status %d", code)
+			}
+			sc := ts.dialScripted(t, "bob")
+			sc.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "bob", Name: "bob", InviteToken: invite.Token})
+			refused := errorMessage(t, sc.readUntil(t, signaling.MessageTypeError))
+			if refused.Reason != signaling.ErrorReasonRelayUnavailable {
+				t.Fatalf("invited join refused with %+v", refused)
+			}
+			if rm := ts.lookupRoom("room-1"); rm != nil && rm.GetPeerCount() != 0 {
+				t.Fatalf("%d peers joined", rm.GetPeerCount())
+			}
+
+			// Anyone else joins as before
+			ts.join(t, "carol", "room-1", client.Handlers{}, client.JoinOptions{})
+		})
+	}
+}
+
+func errorMessage(t *testing.T, messages []signaling.Message) signaling.ErrorMessage {
+	t.Helper()
+	var e signaling.ErrorMessage
+	if err := json.Unmarshal(messages[len(messages)-1].Data, &e); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestRelayOnlyPeerConnectsOverTURN(t *testing.T) {
+	turnSrv := newTURNServer(t)
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.WebRTC.ICEServers = []config.ICEServer{{URLs: []string{"turn:" + turnSrv.addr + "?transport=udp"}}}
+		cfg.WebRTC.TURNSecret = testTURNSecret
+		cfg.WebRTC.TURNCredentialTTL = time.Hour
+		cfg.Media.PeerDisconnectGrace = 100 * time.Millisecond
+	})
+
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{RelayOnly: true})
+	bob := ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{})
+
+	// alice is handed TURN credentials of her own, valid for the TTL
+	info := alice.Info()
+	if info.ICETransportPolicy != "relay" || len(info.ICEServers) != 1 {
+		t.Fatalf("join reply policy %q with %d ICE servers", info.ICETransportPolicy, len(info.ICEServers))
+	}
+	server := info.ICEServers[0]
+	expiry, user, _ := strings.Cut(server.Username, ":")
+	exp, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || user != "alice" || time.Until(time.Unix(exp, 0)) < 59*time.Minute {
+		t.Fatalf("TURN username %q", server.Username)
+	}
+	if _, want := turnCredentials(testTURNSecret, "alice", time.Unix(exp, 0)); server.Credential != want {
+		t.Fatal("TURN credential is not the HMAC of the username")
+	}
+	if bob.Info().ICETransportPolicy != "" {
+		t.Fatalf("bob's policy %q", bob.Info().ICETransportPolicy)
+	}
+
+	waitState(t, "alice's PeerConnection", alice.PeerConnection().ConnectionState, webrtc.PeerConnectionStateConnected)
+	if !turnSrv.authenticated("alice") || !turnSrv.authenticated("sfu") {
+		t.Fatalf("TURN server authenticated %v, want alice and the SFU", turnSrv.users)
+	}
+
+	// The listing shows each peer's policy, and alice's relay/relay pair
+	var peers struct {
+		Peers []roomPeerInfo `json:"peers"`
+	}
+	eventually(t, "alice's candidate pair to be listed", func() bool {
+		if code := ts.api(t, http.MethodGet, "/api/rooms/room-1/peers", "", testAdminKey, &peers); code != http.StatusOK {
+			t.Fatalf("GET peers: %d", code)
+		}
+		for _, p := range peers.Peers {
+			if p.UserID == "alice" {
+				return p.CandidatePair != nil
+			}
+		}
+		return false
+	})
+	for _, p := range peers.Peers {
+		switch p.UserID {
+		case "alice":
+			if p.TransportPolicy != "relay" || p.CandidatePair.LocalType != "relay" || p.CandidatePair.RemoteType != "relay" {
+				t.Fatalf("alice listed with policy %s over %+v", p.TransportPolicy, p.CandidatePair)
+			}
+		case "bob":
+			if p.TransportPolicy != "all" {
+				t.Fatalf("bob listed with policy %s", p.TransportPolicy)
+			}
+		}
+	}
+}
+
+func TestResumedSessionStaysRelayOnly(t *testing.T) {
+	turnSrv := newTURNServer(t)
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.WebRTC.ICEServers = []config.ICEServer{{URLs: []string{"turn:" + turnSrv.addr}}}
+		cfg.WebRTC.TURNSecret = testTURNSecret
+		cfg.Media.PeerDisconnectGrace = 100 * time.Millisecond
+	})
+	sc := ts.dialScripted(t, "alice")
+	sc.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "alice", RelayOnly: true})
+	info := joinResponse(t, sc.readUntil(t, signaling.MessageTypeJoin))
+	sc.hangUp()
+	eventually(t, "alice's peer to be removed", func() bool { return ts.lookupRoom("room-1").IsEmpty() })
+
+	// The resumed join does not ask for relay and gets it anyway
+	sc = ts.dialScripted(t, "alice")
+	sc.pipeline(t, signaling.MessageTypeJoin, struct {
+		signaling.JoinMessage
+		SessionID    string `json:"sessionId"`
+		SessionToken string `json:"sessionToken"`
+	}{
+		JoinMessage:  signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "alice"},
+		SessionID:    info.SessionID,
+		SessionToken: info.SessionToken,
+	})
+	resumed := joinResponse(t, sc.readUntil(t, signaling.MessageTypeJoin))
+	if !resumed.Resumed || resumed.ICETransportPolicy != "relay" {
+		t.Fatalf("resumed %v with policy %q, want relay", resumed.Resumed, resumed.ICETransportPolicy)
+	}
+	if _, p := ts.getRoomAndPeer("room-1", "alice"); p == nil || p.ICETransportPolicy() != webrtc.ICETransportPolicyRelay {
+		t.Fatal("alice's PeerConnection is not relay-only after resuming")
+	}
+}
@@ -0,0 +1,154 @@
+package sfu
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// A participant renames itself with update-name; an admin renames anyone
+// with PATCH /api/rooms/{id}/peers/{peerId}. Either way the peer, its
+// signaling client and its session take the new name, so room-state, the
+// peers API and a resumed session all see it, and the room is told with
+// peer-updated.
+
+// validateName checks a display name. Unlike IDs, names may hold spaces and
+// any printable Unicode, up to maxLen characters.
+func validateName(name string, maxLen int) error {
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("name is not valid UTF-8")
+	}
+	if utf8.RuneCountInString(name) > maxLen {
+		return fmt.Errorf("name exceeds maximum length of %d", maxLen)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r) {
+			return fmt.Errorf("name contains invalid characters")
+		}
+	}
+	return nil
+}
+
+// handleUpdateNameMessage renames the sender's own peer.
+func (s *SFU) handleUpdateNameMessage(client *signaling.Client, message signaling.Message, req signaling.UpdateNameMessage) {
+	name := strings.TrimSpace(req.Name)
+	if err := validateName(name, s.config.Media.MaxNameLength); err != nil {
+		client.SendError(400, err.Error())
+		return
+	}
+
+	rm, p := s.roomService.RoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+	s.roomService.RenamePeer(rm, p, name)
+}
+
+// handleRoomPeerAPI serves PATCH /api/rooms/{id}/peers/{peerId}, which
+// renames the peer.
+func (s *SFU) handleRoomPeerAPI(w http.ResponseWriter, r *http.Request, roomID, peerID string) {
+	if r.Method != http.MethodPatch {
+		writeMethodNotAllowed(w, http.MethodPatch)
+		return
+	}
+
+	s.roomsMu.RLock()
+	rm, exists := s.rooms[roomID]
+	s.roomsMu.RUnlock()
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+	p, ok := rm.GetPeer(peerID)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "Peer not found")
+		return
+	}
+
+	var req signaling.UpdateNameMessage
+	if !s.decodeJSONBody(w, r, &req) {
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if err := validateName(name, s.config.Media.MaxNameLength); err != nil {
+		s.auditPeerRequest(r, auditPeerRename, roomID, peerID, audit.ResultFailure, map[string]string{"reason": err.Error()})
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	previous := s.renamePeer(rm, p, name)
+	s.auditPeerRequest(r, auditPeerRename, roomID, peerID, audit.ResultSuccess, map[string]string{
+		"userId":   p.UserID,
+		"previous": previous,
+		"name":     name,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.roomPeerInfo(rm, p))
+}
+
+// renamePeer gives p its new name everywhere it is kept and announces it,
+// returning the previous name.
+func (s *SFU) renamePeer(rm *room.Room, p *peer.Peer, name string) string {
+	previous := p.GetName()
+	p.SetName(name)
+	for _, client := range s.signalingHub.GetClientsByRoom(p.RoomID) {
+		if client.UserID == p.UserID {
+			client.Name = name
+		}
+	}
+
+	if sm := s.sessionManager.Load(); sm != nil {
+		if sessionID := sm.UserSessionID(p.UserID, p.RoomID); sessionID != "" {
+			ctx, cancel := s.messageContext()
+			sm.UpdateName(ctx, sessionID, name)
+			cancel()
+		}
+	}
+
+	s.logger.Info("Peer renamed",
+		zap.String("roomID", p.RoomID),
+		zap.String("peerID", p.ID),
+		zap.String("name", name),
+	)
+
+	s.announcePeerUpdate(rm, p)
+	return previous
+}
+
+// announcePeerUpdate sends p's current details to the room with
+// peer-updated. A hidden peer only hears back itself.
+func (s *SFU) announcePeerUpdate(rm *room.Room, p *peer.Peer) {
+	data, err := json.Marshal(signaling.PeerInfo{
+		PeerID:   p.ID,
+		UserID:   p.UserID,
+		Name:     p.GetName(),
+		RoomID:   p.RoomID,
+		MicMuted: p.MicMuted(),
+		Role:     peerRole(p),
+	})
+	if err != nil {
+		s.logger.Error("Failed to marshal peer update", zap.Error(err))
+		return
+	}
+	msg := signaling.Message{Type: signaling.MessageTypePeerUpdated, Data: data, Timestamp: time.Now()}
+	if !announcesPeer(rm, p) {
+		s.sendToPeerClient(p, msg)
+		return
+	}
+	s.broadcastToRoom(rm, msg, nil)
+}
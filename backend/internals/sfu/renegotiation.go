@@ -0,0 +1,85 @@
+package sfu
+
+import (
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// maxPendingNegotiations bounds the renegotiate requests remembered per peer
+// for a client that never answers them.
+const maxPendingNegotiations = 8
+
+// pendingNegotiation is a renegotiate request still waiting for the client's
+// offer.
+type pendingNegotiation struct {
+	id     string
+	reason string
+	sentAt time.Time
+}
+
+// beginNegotiation records a renegotiate request sent to p and returns the
+// negotiation ID to include in it.
+func (s *SFU) beginNegotiation(p *peer.Peer, reason string) string {
+	n := pendingNegotiation{id: uuid.New().String(), reason: reason, sentAt: time.Now()}
+	appmetrics.RecordRenegotiation(reason)
+
+	s.negotiationsMu.Lock()
+	defer s.negotiationsMu.Unlock()
+	pending := append(s.negotiations[p.ID], n)
+	if len(pending) > maxPendingNegotiations {
+		pending = pending[len(pending)-maxPendingNegotiations:]
+	}
+	s.negotiations[p.ID] = pending
+	return n.id
+}
+
+// completeNegotiation is called once p's offer has been answered. An offer
+// echoing a known negotiation ID completes that request and any earlier one;
+// requests sent after it stay pending. Otherwise the offer is taken to
+// answer every outstanding request and is timed from the oldest.
+func (s *SFU) completeNegotiation(p *peer.Peer, negotiationID string) {
+	s.negotiationsMu.Lock()
+	pending := s.negotiations[p.ID]
+	if len(pending) == 0 {
+		s.negotiationsMu.Unlock()
+		return
+	}
+
+	match, correlation := 0, "next_offer"
+	if negotiationID != "" {
+		for i, n := range pending {
+			if n.id == negotiationID {
+				match, correlation = i, "id"
+				break
+			}
+		}
+	}
+	n := pending[match]
+	if rest := pending[match+1:]; correlation == "id" && len(rest) > 0 {
+		s.negotiations[p.ID] = append([]pendingNegotiation(nil), rest...)
+	} else {
+		delete(s.negotiations, p.ID)
+	}
+	s.negotiationsMu.Unlock()
+
+	elapsed := time.Since(n.sentAt)
+	appmetrics.ObserveRenegotiation(n.reason, correlation, elapsed)
+	s.logger.Info("Renegotiation completed",
+		zap.String("peerID", p.ID),
+		zap.String("negotiationID", n.id),
+		zap.String("reason", n.reason),
+		zap.String("correlation", correlation),
+		zap.Duration("duration", elapsed),
+	)
+}
+
+// dropNegotiations forgets a departed peer's outstanding requests.
+func (s *SFU) dropNegotiations(peerID string) {
+	s.negotiationsMu.Lock()
+	defer s.negotiationsMu.Unlock()
+	delete(s.negotiations, peerID)
+}
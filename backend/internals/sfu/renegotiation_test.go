@@ -0,0 +1,175 @@
+package sfu
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var renegotiationReasons = []string{
+	room.RenegotiateTrackChange, room.RenegotiateScheduled, room.RenegotiateRetry, room.RenegotiatePeerLeft,
+	room.RenegotiateResume, room.RenegotiateTrackRemoved, room.RenegotiateAdmin,
+}
+
+// renegotiationTimings returns the number and the sum of the renegotiation
+// durations observed for reason and correlation.
+func renegotiationTimings(t *testing.T, reason, correlation string) (uint64, time.Duration) {
+	t.Helper()
+	var m dto.Metric
+	if err := appmetrics.RenegotiationDurationMs.WithLabelValues(reason, correlation).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount(), time.Duration(m.GetHistogram().GetSampleSum()) * time.Millisecond
+}
+
+// renegotiationTimingsByReason snapshots renegotiationTimings for every
+// reason.
+func renegotiationTimingsByReason(t *testing.T, correlation string) map[string]uint64 {
+	t.Helper()
+	counts := make(map[string]uint64)
+	for _, reason := range renegotiationReasons {
+		counts[reason], _ = renegotiationTimings(t, reason, correlation)
+	}
+	return counts
+}
+
+// readRenegotiates reads sc's renegotiate messages until none has come for
+// settle, longer than the throttle delay, and returns them.
+func readRenegotiates(t *testing.T, sc *scriptedClient, settle time.Duration) []signaling.RenegotiateMessage {
+	t.Helper()
+	var (
+		got   []signaling.RenegotiateMessage
+		quiet <-chan time.Time
+	)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m := <-sc.messages:
+			if m.Type != signaling.MessageTypeRenegotiate {
+				continue
+			}
+			var v signaling.RenegotiateMessage
+			if err := json.Unmarshal(m.Data, &v); err != nil {
+				t.Fatal(err)
+			}
+			if v.NegotiationID == "" {
+				t.Fatalf("renegotiate without a negotiation ID: %+v", v)
+			}
+			got = append(got, v)
+			// Other messages, like dominant speaker changes, keep coming
+			quiet = time.After(settle)
+		case <-quiet:
+			return got
+		case <-timeout:
+			t.Fatal("no renegotiate")
+		}
+	}
+}
+
+func TestRenegotiationRoundTrip(t *testing.T) {
+	const wait = 100 * time.Millisecond
+	ts := newTestServer(t, nil, nil)
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	alice := ts.dialScripted(t, "alice")
+	alice.pipeline(t,
+		signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "alice"},
+		signaling.MessageTypeOffer, signaling.OfferMessage{SDP: offerAudio(t, pc).SDP, Type: "offer"},
+	)
+	readAnswer(t, alice, pc)
+	renegotiated := func() float64 {
+		total := 0.0
+		for _, reason := range renegotiationReasons {
+			total += testutil.ToFloat64(appmetrics.RenegotiationsTotal.WithLabelValues(reason))
+		}
+		return total
+	}
+	requested := renegotiated()
+
+	// offer re-offers with a receiver for every track the SFU sends,
+	// echoing negotiationID
+	offer := func(negotiationID string) {
+		t.Helper()
+		for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+			if _, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		o, err := pc.CreateOffer(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pc.SetLocalDescription(o); err != nil {
+			t.Fatal(err)
+		}
+		alice.pipeline(t, signaling.MessageTypeOffer, signaling.OfferMessage{SDP: o.SDP, Type: "offer", NegotiationID: negotiationID})
+		readAnswer(t, alice, pc)
+	}
+
+	// A conforming client echoes the ID; its latest request is timed
+	byID := renegotiationTimingsByReason(t, "id")
+	publish(t, ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{}), "bob")
+	requests := readRenegotiates(t, alice, time.Second)
+	last := requests[len(requests)-1]
+	_, sumBefore := renegotiationTimings(t, last.Reason, "id")
+	time.Sleep(wait)
+	offer(last.NegotiationID)
+	for reason, before := range byID {
+		count, _ := renegotiationTimings(t, reason, "id")
+		want := before
+		if reason == last.Reason {
+			want++
+		}
+		if count != want {
+			t.Fatalf("%d id-matched %s renegotiations timed, want %d", count-before, reason, want-before)
+		}
+	}
+	if _, sum := renegotiationTimings(t, last.Reason, "id"); sum-sumBefore < wait || sum-sumBefore > 5*time.Second {
+		t.Fatalf("renegotiation timed at %v, want a little over %v", sum-sumBefore, wait)
+	}
+	if got := renegotiated() - requested; got < float64(len(requests)) {
+		t.Fatalf("%v renegotiations counted, alice alone was sent %d", got, len(requests))
+	}
+
+	// An offer without one answers every outstanding request, timed from
+	// the oldest
+	nextOffer := renegotiationTimingsByReason(t, "next_offer")
+	publish(t, ts.join(t, "carol", "room-1", client.Handlers{}, client.JoinOptions{}), "carol")
+	requests = readRenegotiates(t, alice, time.Second)
+	first := requests[0]
+	offer("")
+	for reason, before := range nextOffer {
+		count, _ := renegotiationTimings(t, reason, "next_offer")
+		want := before
+		if reason == first.Reason {
+			want++
+		}
+		if count != want {
+			t.Fatalf("%d next-offer %s renegotiations timed, want %d", count-before, reason, want-before)
+		}
+	}
+
+	// Nothing is outstanding, so a further offer times nothing
+	offer("")
+	for reason, before := range nextOffer {
+		want := before
+		if reason == first.Reason {
+			want++
+		}
+		if count, _ := renegotiationTimings(t, reason, "next_offer"); count != want {
+			t.Fatalf("an offer with nothing outstanding was timed as %s", reason)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package sfu
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// videoArrivals records the video packets a session receives: when each
+// arrived and its sequence number and timestamp, and how many video tracks
+// it was given.
+type videoArrivals struct {
+	mu     sync.Mutex
+	tracks int
+	at     []time.Time
+	seqs   []uint16
+	stamps []uint32
+}
+
+func (va *videoArrivals) onTrack(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+	if track.Kind() != webrtc.RTPCodecTypeVideo {
+		return
+	}
+	va.mu.Lock()
+	va.tracks++
+	va.mu.Unlock()
+	go func() {
+		for {
+			pkt, _, err := track.ReadRTP()
+			if err != nil {
+				return
+			}
+			va.mu.Lock()
+			va.at = append(va.at, time.Now())
+			va.seqs = append(va.seqs, pkt.SequenceNumber)
+			va.stamps = append(va.stamps, pkt.Timestamp)
+			va.mu.Unlock()
+		}
+	}()
+}
+
+func (va *videoArrivals) count() (tracks, packets int) {
+	va.mu.Lock()
+	defer va.mu.Unlock()
+	return va.tracks, len(va.at)
+}
+
+// since returns the longest gap between packets arriving from the nth on,
+// and whether their sequence numbers ran on by one and timestamps never
+// went back.
+func (va *videoArrivals) since(n int) (gap time.Duration, continuous bool) {
+	va.mu.Lock()
+	defer va.mu.Unlock()
+	continuous = true
+	for i := n + 1; i < len(va.at); i++ {
+		gap = max(gap, va.at[i].Sub(va.at[i-1]))
+		if va.seqs[i] != va.seqs[i-1]+1 || int32(va.stamps[i]-va.stamps[i-1]) < 0 {
+			continuous = false
+		}
+	}
+	return gap, continuous
+}
+
+// sendVideo writes a sample to track every 20ms until the test ends.
+func sendVideo(t *testing.T, track *webrtc.TrackLocalStaticSample) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				track.WriteSample(media.Sample{Data: []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a}, Duration: 20 * time.Millisecond})
+			}
+		}
+	}()
+}
+
+func TestReplaceTrack(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	senders := publish(t, alice, "alice")
+	rm := ts.lookupRoom("room-1")
+	eventually(t, "alice's tracks", func() bool { return rm.GetTrackCount() == 2 })
+	handle, _ := rm.TrackHandle("alice-vp8")
+
+	var (
+		mu               sync.Mutex
+		published, ended int
+	)
+	received := &videoArrivals{}
+	ts.join(t, "bob", "room-1", client.Handlers{
+		OnTrackPublished: func(signaling.TrackInfo) { mu.Lock(); published++; mu.Unlock() },
+		OnTrackRemoved:   func(signaling.TrackInfo) { mu.Lock(); ended++; mu.Unlock() },
+	}, client.JoinOptions{OnTrack: received.onTrack})
+	eventually(t, "bob to receive alice's video", func() bool { _, n := received.count(); return n > 20 })
+
+	// The back camera takes over alice's video under the same handle
+	back, err := client.NewSampleTrack(webrtc.MimeTypeVP8, "alice-vp8-back", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, before := received.count()
+	if _, err := alice.ReplaceTrack(context.Background(), senders[1], back); err != nil {
+		t.Fatal(err)
+	}
+	sendVideo(t, back)
+	_, p := ts.getRoomAndPeer("room-1", "alice")
+	eventually(t, "the replacement to feed the track", func() bool {
+		_, old := p.GetTrackInfo("alice-vp8")
+		return !old
+	})
+	_, switched := received.count()
+	eventually(t, "bob to receive the back camera", func() bool { _, n := received.count(); return n > switched+50 })
+
+	// Bob sees one uninterrupted track
+	gap, continuous := received.since(before)
+	t.Logf("longest gap across the switch %v", gap)
+	if tracks, _ := received.count(); tracks != 1 || !continuous {
+		t.Fatalf("bob was given %d video tracks, continuous %v", tracks, continuous)
+	}
+	if gap > 500*time.Millisecond {
+		t.Fatalf("bob's video stopped for %v", gap)
+	}
+	mu.Lock()
+	if published != 0 || ended != 0 {
+		t.Fatalf("bob was told of %d tracks published and %d removed", published, ended)
+	}
+	mu.Unlock()
+	if rm.GetTrackCount() != 2 {
+		t.Fatalf("%d tracks after the switch", rm.GetTrackCount())
+	}
+
+	// Only a published track of alice's own can be replaced
+	_, bob := ts.getRoomAndPeer("room-1", "bob")
+	for _, tc := range []struct {
+		name, newID, ref string
+	}{
+		{"unknown track", "cam-2", "nope"},
+		{"another peer's", "cam-2", handle},
+		{"a published replacement", "alice-vp8-back", handle},
+	} {
+		who := p
+		if tc.name == "another peer's" {
+			who = bob
+		}
+		if _, err := rm.DeclareReplacement(who, tc.newID, tc.ref); err == nil {
+			t.Errorf("%s: declared", tc.name)
+		}
+	}
+}
+
+// Without the hint, or once the track it names is gone, the new track is
+// published as one of its own.
+func TestReplaceTrackFallsBack(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	senders := publish(t, alice, "alice")
+	rm := ts.lookupRoom("room-1")
+	eventually(t, "alice's tracks", func() bool { return rm.GetTrackCount() == 2 })
+	handle, _ := rm.TrackHandle("alice-vp8")
+	_, p := ts.getRoomAndPeer("room-1", "alice")
+
+	// The declared track is removed before the replacement arrives
+	if _, err := rm.DeclareReplacement(p, "alice-vp8-back", handle); err != nil {
+		t.Fatal(err)
+	}
+	mt, _ := rm.ResolveTrackFor(handle, "")
+	if err := p.RemoveTrack(mt.ID); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "alice's video to be removed", func() bool { return rm.GetTrackCount() == 1 })
+	if err := alice.UnpublishTrack(senders[1]); err != nil {
+		t.Fatal(err)
+	}
+	back, err := client.NewSampleTrack(webrtc.MimeTypeVP8, "alice-vp8-back", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.PublishTrack(back); err != nil {
+		t.Fatal(err)
+	}
+	sendVideo(t, back)
+	eventually(t, "the back camera to be published", func() bool {
+		newHandle, ok := rm.TrackHandle("alice-vp8-back")
+		return ok && newHandle != handle && rm.GetTrackCount() == 2
+	})
+	if _, err := rm.DeclareReplacement(p, "cam-3", handle); !errors.Is(err, room.ErrTrackNotFound) {
+		t.Fatalf("replacing a removed track: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package sfu
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+func TestModerationRoutesRequireAdminKey(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	peerPath := "/api/rooms/room-1/peers/" + alice.PeerID()
+
+	routes := []struct {
+		method, path, body string
+	}{
+		{http.MethodPatch, peerPath, `{"name":"Mallory"}`},
+		{http.MethodGet, "/api/rooms/room-1/priorities", ""},
+		{http.MethodPut, "/api/rooms/room-1/priorities", `{}`},
+		{http.MethodPatch, "/api/rooms/room-1/settings", `{"videoEnabled":false}`},
+		{http.MethodPatch, "/api/rooms/room-1/host", `{"userId":"mallory"}`},
+		{http.MethodPost, "/api/rooms/room-1/mute-all", `{"enabled":true}`},
+		{http.MethodPut, "/api/rooms/room-1/spotlight", `{"peerId":"` + alice.PeerID() + `"}`},
+		{http.MethodPatch, "/api/rooms/room-1/time-limit", `{"extendSec":60}`},
+		{http.MethodPatch, "/api/rooms/room-1", `{"locked":true}`},
+		{http.MethodDelete, "/api/rooms/room-1", ""},
+	}
+	for _, route := range routes {
+		for _, key := range []string{"", "wrong"} {
+			if code := ts.api(t, route.method, route.path, route.body, key, nil); code != http.StatusUnauthorized {
+				t.Errorf("%s %s with key %q: status %d, want 401", route.method, route.path, key, code)
+			}
+		}
+	}
+
+	// Nothing changed, and the room is still there to read
+	rm := ts.lookupRoom("room-1")
+	if rm == nil {
+		t.Fatal("room deleted without the key")
+	}
+	if p, ok := rm.GetPeerByUserID("alice"); !ok || p.GetName() != "alice" || rm.IsLocked() || rm.IsHost("mallory") {
+		t.Fatal("a refused request changed the room")
+	}
+	if code := ts.api(t, http.MethodGet, "/api/rooms/room-1", "", "", nil); code != http.StatusOK {
+		t.Fatalf("room info without the key: status %d, want 200", code)
+	}
+
+	for _, route := range routes {
+		if code := ts.api(t, route.method, route.path, route.body, testAdminKey, nil); code == http.StatusUnauthorized {
+			t.Errorf("%s %s with the key: status %d", route.method, route.path, code)
+		}
+	}
+}
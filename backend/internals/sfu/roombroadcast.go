@@ -0,0 +1,42 @@
+package sfu
+
+import (
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// Everything announced to a whole room (peers joining and leaving, track
+// events, the dominant speaker, host and media state changes) goes through
+// the room's ordered dispatch (see room.Dispatch) and carries its roomSeq.
+// peer-joined is dispatched from the room's own callback as the peer is
+// added, so it precedes anything about the peer's tracks.
+
+// broadcastToRoom sends msg to rm's clients that include accepts, or to all
+// of them with a nil include, in the room's broadcast order. include must
+// not take the room's lock.
+func (s *SFU) broadcastToRoom(rm *room.Room, msg signaling.Message, include func(*signaling.Client) bool) {
+	rm.Dispatch(func(seq uint64) {
+		msg.RoomSeq = seq
+		for _, client := range s.signalingHub.GetClientsByRoom(rm.ID) {
+			if include == nil || include(client) {
+				client.SendMessage(msg)
+			}
+		}
+	})
+}
+
+// lookupRoom returns the local room roomID, or nil.
+func (s *SFU) lookupRoom(roomID string) *room.Room {
+	s.roomsMu.RLock()
+	defer s.roomsMu.RUnlock()
+	return s.rooms[roomID]
+}
+
+// handlePeerJoined announces a new peer to the room. It is called with the
+// room locked.
+func (s *SFU) handlePeerJoined(rm *room.Room, p *peer.Peer) {
+	if announcesPeer(rm, p) {
+		s.broadcastPeerEvent(rm, p, signaling.MessageTypePeerJoined)
+	}
+}
@@ -0,0 +1,82 @@
+package sfu
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+// trackEvents are the broadcasts about a peer's tracks.
+var trackEvents = map[signaling.MessageType]bool{
+	signaling.MessageTypeTrackAdded:     true,
+	signaling.MessageTypeTrackPublished: true,
+	signaling.MessageTypeTrackRemoved:   true,
+	signaling.MessageTypeTrackPaused:    true,
+	signaling.MessageTypeTrackResumed:   true,
+}
+
+func TestPeerJoinedBeforeItsTracks(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	watcher := ts.joinScripted(t, "watcher", "room-1")
+
+	// The watcher checks every broadcast as it arrives: in room order, and
+	// nothing about a peer's tracks before its peer-joined
+	published := make(chan string, 16)
+	go func() {
+		joined := make(map[string]bool)
+		var last uint64
+		for m := range watcher.messages {
+			if m.RoomSeq != 0 {
+				if m.RoomSeq <= last {
+					t.Errorf("%s numbered %d after %d", m.Type, m.RoomSeq, last)
+				}
+				last = m.RoomSeq
+			}
+			var about struct {
+				PeerID string `json:"peerId"`
+			}
+			if m.Type != signaling.MessageTypePeerJoined && !trackEvents[m.Type] {
+				continue
+			}
+			if err := json.Unmarshal(m.Data, &about); err != nil {
+				t.Errorf("%s: %v", m.Type, err)
+				continue
+			}
+			switch {
+			case m.Type == signaling.MessageTypePeerJoined:
+				joined[about.PeerID] = true
+			case !joined[about.PeerID]:
+				t.Errorf("%s for %s before its peer-joined", m.Type, about.PeerID)
+			case m.Type == signaling.MessageTypeTrackPublished:
+				published <- about.PeerID
+			}
+		}
+	}()
+
+	// Each publisher publishes as soon as it has joined
+	for i := 0; i < 100; i++ {
+		user := fmt.Sprintf("pub-%d", i)
+		sess := ts.join(t, user, "room-1", client.Handlers{}, client.JoinOptions{})
+		publish(t, sess, user)
+		deadline := time.After(5 * time.Second)
+	wait:
+		for {
+			select {
+			case peerID := <-published:
+				if peerID == sess.PeerID() {
+					break wait
+				}
+			case <-deadline:
+				t.Fatalf("no track-published for %s", user)
+			}
+		}
+		sess.Leave()
+		if t.Failed() {
+			return
+		}
+	}
+}
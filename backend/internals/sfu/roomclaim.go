@@ -0,0 +1,180 @@
+package sfu
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"go.uber.org/zap"
+)
+
+// Without sticky routing two users can join the same new room on two
+// instances at once, each creating its own copy. Before creating a room an
+// instance therefore claims its creation in Redis (see state/roomclaim.go)
+// and checks the room summary; the winner publishes the summary as soon as
+// the room exists. An instance that loses the claim waits for that summary,
+// taking the claim over if the winner releases it or lets it lapse. A
+// summary naming another registered instance means the room lives there:
+// the conflict is logged with both instance IDs and counted, and the join
+// is sent on to that instance when regions are enabled. Otherwise, as there
+// is no media cascading between instances, it is refused with a retryable
+// error rather than split, so a retry can land on the owner. A summary of
+// an instance that is no longer registered is stale and the room is created
+// here. The claim is released when creation fails and otherwise lapses
+// after roomClaimTTL. Joins of a room that already exists here never touch
+// Redis.
+
+const (
+	// roomClaimTTL is how long a creation claim is held.
+	roomClaimTTL = 5 * time.Second
+	// roomClaimWait is how long the loser of a claim waits for the
+	// winner's room summary, polling every roomClaimPoll. It outlasts the
+	// claim, so a winner that never publishes is taken over.
+	roomClaimWait = roomClaimTTL + time.Second
+	roomClaimPoll = 100 * time.Millisecond
+)
+
+// roomRedirectError is returned by getOrCreateRoom when the room is hosted
+// by another instance the client should be sent to.
+type roomRedirectError struct {
+	target *state.InstanceRecord
+}
+
+func (e *roomRedirectError) Error() string {
+	return "room is hosted by instance " + e.target.InstanceID
+}
+
+// roomElsewhereError is returned by getOrCreateRoom when another instance
+// hosts or is creating the room and the client cannot be sent to it.
+type roomElsewhereError struct {
+	owner string
+}
+
+func (e *roomElsewhereError) Error() string {
+	return "room is hosted by instance " + e.owner
+}
+
+// claimRoomCreation claims the creation of roomID. It returns a function
+// that releases the claim, to be called if the room is not created, or an
+// error redirecting or refusing the join because another instance hosts
+// the room. A claim that cannot be made for want of Redis does not stop
+// the creation.
+func (s *SFU) claimRoomCreation(ctx context.Context, roomID string) (func(), error) {
+	noop := func() {}
+	sm := s.stateManager.Load()
+	self := s.instanceID()
+	if sm == nil || self == "" {
+		return noop, nil
+	}
+
+	deadline := time.Now().Add(roomClaimWait)
+	for {
+		claimed, holder, err := sm.ClaimRoomCreate(ctx, roomID, self, roomClaimTTL)
+		if err != nil {
+			s.logger.Debug("Failed to claim room creation", zap.String("roomID", roomID), zap.Error(err))
+			return noop, nil
+		}
+		release := noop
+		if claimed {
+			release = func() {
+				if err := sm.ReleaseRoomCreate(context.Background(), roomID, self); err != nil {
+					s.logger.Debug("Failed to release room creation claim", zap.String("roomID", roomID), zap.Error(err))
+				}
+			}
+		}
+
+		if owner := s.roomOwner(ctx, roomID); owner != "" && owner != self {
+			if err := s.roomCreateConflict(ctx, roomID, owner); err != nil {
+				release()
+				return noop, err
+			}
+			return release, nil
+		}
+		if claimed {
+			return release, nil
+		}
+		if holder == "" {
+			// Released in between; claim it again at once
+			continue
+		}
+		if time.Now().After(deadline) || ctx.Err() != nil {
+			appmetrics.RecordRoomCreateConflict("pending")
+			s.logger.Warn("Room creation claimed by another instance that published no room",
+				zap.String("roomID", roomID),
+				zap.String("instanceID", self),
+				zap.String("otherInstanceID", holder),
+			)
+			return noop, &roomElsewhereError{owner: holder}
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(roomClaimPoll):
+		}
+	}
+}
+
+// roomOwner returns the instance roomID's summary names, if any.
+func (s *SFU) roomOwner(ctx context.Context, roomID string) string {
+	summary, err := s.stateManager.Load().GetRoomSummary(ctx, roomID)
+	if err != nil || summary == nil {
+		return ""
+	}
+	return summary.InstanceID
+}
+
+// roomCreateConflict handles roomID being hosted by owner. It returns a
+// redirect to owner when regions are enabled, a refusal when they are not,
+// and nil to create the room here when owner is no longer registered.
+func (s *SFU) roomCreateConflict(ctx context.Context, roomID, owner string) error {
+	record, err := s.stateManager.Load().GetInstance(ctx, owner)
+	if err == nil && record == nil {
+		s.logger.Debug("Room summary names an instance that is gone",
+			zap.String("roomID", roomID),
+			zap.String("otherInstanceID", owner),
+		)
+		return nil
+	}
+
+	outcome := "refused"
+	if record != nil && s.config.Server.Region != "" {
+		outcome = "redirect"
+	}
+	appmetrics.RecordRoomCreateConflict(outcome)
+	s.logger.Warn("Room is being created on two instances",
+		zap.String("roomID", roomID),
+		zap.String("instanceID", s.instanceID()),
+		zap.String("otherInstanceID", owner),
+		zap.String("outcome", outcome),
+	)
+	if outcome == "redirect" {
+		return &roomRedirectError{target: record}
+	}
+	return &roomElsewhereError{owner: owner}
+}
+
+// roomElsewhereBody describes a join or room creation refused because
+// another instance hosts the room. A retry may reach the owner through the
+// load balancer.
+func (s *SFU) roomElsewhereBody(e *roomElsewhereError) signaling.ErrorMessage {
+	return signaling.ErrorMessage{
+		Code:              http.StatusServiceUnavailable,
+		Message:           "Room is hosted by another instance",
+		Retryable:         true,
+		RetryAfterMs:      s.config.Media.JoinRetryAfter.Milliseconds(),
+		Reason:            signaling.ErrorReasonRoomElsewhere,
+		AlternateInstance: e.owner,
+	}
+}
+
+// writeRoomElsewhere answers a REST room creation refused because another
+// instance hosts the room.
+func (s *SFU) writeRoomElsewhere(w http.ResponseWriter, e *roomElsewhereError) {
+	if retryAfter := s.config.Media.JoinRetryAfter; retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+	}
+	writeSignalingError(w, s.roomElsewhereBody(e))
+}
@@ -0,0 +1,156 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// racingServers starts instances sfu-a and sfu-b on mr.
+func racingServers(t *testing.T, mr *miniredis.Miniredis, configure func(*config.Config)) (*testServer, *testServer) {
+	t.Helper()
+	t.Setenv("INSTANCE_ID", "sfu-a")
+	a := newTestServer(t, mr, configure)
+	t.Setenv("INSTANCE_ID", "sfu-b")
+	b := newTestServer(t, mr, configure)
+	return a, b
+}
+
+// race has a and b create roomID at once, and returns the instance that
+// hosts it and the error the other was answered with.
+func race(t *testing.T, a, b *testServer, roomID string) (*testServer, error) {
+	t.Helper()
+	servers := []*testServer{a, b}
+	rooms := make([]*room.Room, 2)
+	errs := make([]error, 2)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, ts := range servers {
+		wg.Add(1)
+		go func(i int, ts *testServer) {
+			defer wg.Done()
+			<-start
+			rooms[i], errs[i] = ts.getOrCreateRoom(context.Background(), roomID)
+		}(i, ts)
+	}
+	close(start)
+	wg.Wait()
+
+	if (rooms[0] == nil) == (rooms[1] == nil) {
+		t.Fatalf("%s created %v, %v with %v, %v; want it on one instance", roomID, rooms[0] != nil, rooms[1] != nil, errs[0], errs[1])
+	}
+	winner, loser := 0, 1
+	if rooms[0] == nil {
+		winner, loser = 1, 0
+	}
+	if servers[loser].lookupRoom(roomID) != nil {
+		t.Fatalf("%s also created on the loser", roomID)
+	}
+	summary, err := servers[winner].stateManager.Load().GetRoomSummary(context.Background(), roomID)
+	if err != nil || summary == nil || summary.InstanceID != servers[winner].instanceID() {
+		t.Fatalf("%s summary %+v, %v", roomID, summary, err)
+	}
+	return servers[winner], errs[loser]
+}
+
+func TestRoomCreationRace(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a, b := racingServers(t, mr, nil)
+
+	// Without regions the loser refuses, naming the winner, and a join of
+	// the room there is refused the same way
+	for i := 0; i < 10; i++ {
+		roomID := fmt.Sprintf("room-%d", i)
+		winner, err := race(t, a, b, roomID)
+		var elsewhere *roomElsewhereError
+		if !errors.As(err, &elsewhere) || elsewhere.owner != winner.instanceID() {
+			t.Fatalf("%s: loser answered %v", roomID, err)
+		}
+	}
+	if a.lookupRoom("room-0") == nil {
+		a, b = b, a
+	}
+	e := b.joinRouted(t, "bob", "room-0", "")
+	if e.Code != http.StatusServiceUnavailable || !e.Retryable || e.Reason != signaling.ErrorReasonRoomElsewhere || e.AlternateInstance != a.instanceID() {
+		t.Fatalf("join on the loser answered %+v", e)
+	}
+	if e := a.joinRouted(t, "alice", "room-0", ""); e.Code != 0 {
+		t.Fatalf("join on the winner answered %+v", e)
+	}
+	var refused struct {
+		Error struct {
+			Code    string       `json:"code"`
+			Details retryDetails `json:"details"`
+		} `json:"error"`
+	}
+	resp, data := b.rawAPI(t, http.MethodPost, "/api/rooms", "application/json", `{"id":"room-0"}`)
+	if err := json.Unmarshal(data, &refused); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" ||
+		refused.Error.Code != signaling.ErrorReasonRoomElsewhere || refused.Error.Details.AlternateInstance != a.instanceID() {
+		t.Fatalf("POST on the loser: %d, %s", resp.StatusCode, data)
+	}
+}
+
+func TestRoomCreationRaceRedirects(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a, b := racingServers(t, mr, func(cfg *config.Config) { cfg.Server.Region = "eu" })
+	for i := 0; i < 5; i++ {
+		roomID := fmt.Sprintf("room-%d", i)
+		winner, err := race(t, a, b, roomID)
+		var redirect *roomRedirectError
+		if !errors.As(err, &redirect) || redirect.target.InstanceID != winner.instanceID() {
+			t.Fatalf("%s: loser answered %v", roomID, err)
+		}
+	}
+}
+
+func TestRoomCreationClaimTakeover(t *testing.T) {
+	mr := miniredis.RunT(t)
+	t.Setenv("INSTANCE_ID", "sfu-a")
+	ts := newTestServer(t, mr, nil)
+	sm := ts.stateManager.Load()
+	ctx := context.Background()
+	claim := func(roomID, instanceID string) {
+		t.Helper()
+		if ok, _, err := sm.ClaimRoomCreate(ctx, roomID, instanceID, roomClaimTTL); !ok || err != nil {
+			t.Fatalf("claiming %s for %s: %v, %v", roomID, instanceID, ok, err)
+		}
+	}
+
+	// A winner that releases its claim without creating the room, and one
+	// that lets it lapse, are taken over
+	claim("room-released", "sfu-b")
+	time.AfterFunc(300*time.Millisecond, func() { sm.ReleaseRoomCreate(ctx, "room-released", "sfu-b") })
+	claim("room-lapsed", "sfu-b")
+	time.AfterFunc(300*time.Millisecond, func() { mr.FastForward(roomClaimTTL) })
+	for _, roomID := range []string{"room-released", "room-lapsed"} {
+		started := time.Now()
+		if _, err := ts.getOrCreateRoom(ctx, roomID); err != nil {
+			t.Fatalf("%s: %v", roomID, err)
+		}
+		if waited := time.Since(started); waited > roomClaimTTL {
+			t.Fatalf("%s created after %v", roomID, waited)
+		}
+	}
+
+	// The summary of an instance that is gone does not keep the room away
+	if err := sm.SetRoomSummary(ctx, &state.RoomSummary{RoomID: "room-stale", InstanceID: "sfu-gone"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.getOrCreateRoom(ctx, "room-stale"); err != nil {
+		t.Fatalf("room-stale: %v", err)
+	}
+}
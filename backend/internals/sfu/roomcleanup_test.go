@@ -0,0 +1,112 @@
+package sfu
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// joinResponse decodes the join reply among messages.
+func joinResponse(t *testing.T, messages []signaling.Message) signaling.JoinResponse {
+	t.Helper()
+	for _, m := range messages {
+		if m.Type != signaling.MessageTypeJoin {
+			continue
+		}
+		var resp signaling.JoinResponse
+		if err := json.Unmarshal(m.Data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	t.Fatalf("no join reply in %v", messages)
+	return signaling.JoinResponse{}
+}
+
+// suspend joins userID to roomID and drops the connection, leaving a
+// suspended session once the peer's grace has run out.
+func (ts *testServer) suspend(t *testing.T, userID, roomID string) signaling.JoinResponse {
+	t.Helper()
+	sc := ts.dialScripted(t, userID)
+	sc.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: roomID, UserID: userID, Name: userID})
+	info := joinResponse(t, sc.readUntil(t, signaling.MessageTypeJoin))
+	sc.hangUp()
+	eventually(t, userID+"'s session to be suspended", func() bool {
+		until := ts.sessionManager.Load().SuspendedUntil(roomID, ts.config.Media.SessionTTL)
+		return !until.IsZero() && ts.lookupRoom(roomID).IsEmpty()
+	})
+	return info
+}
+
+func TestEmptyRoomKeptForResume(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.PeerDisconnectGrace = 100 * time.Millisecond
+		cfg.Media.SessionTTL = 2 * time.Minute
+	})
+	info := ts.suspend(t, "alice", "room-1")
+	rm := ts.lookupRoom("room-1")
+	settings := rm.GetSettings()
+	settings.MuteOnEntry = true
+	settings.MaxVideoBitrate = 750_000
+	rm.UpdateSettings(&settings)
+
+	// The cleanup ticks at 30 and 60 seconds leave the room for the session
+	ts.cleanupEmptyRooms()
+	ts.cleanupEmptyRooms()
+	if ts.lookupRoom("room-1") != rm {
+		t.Fatal("empty room cleaned up while a session can resume into it")
+	}
+
+	sc := ts.dialScripted(t, "alice")
+	sc.pipeline(t, signaling.MessageTypeJoin, struct {
+		signaling.JoinMessage
+		SessionID    string `json:"sessionId"`
+		SessionToken string `json:"sessionToken"`
+	}{
+		JoinMessage:  signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "alice"},
+		SessionID:    info.SessionID,
+		SessionToken: info.SessionToken,
+	})
+	resumed := joinResponse(t, sc.readUntil(t, signaling.MessageTypeJoin))
+	if !resumed.Resumed || resumed.SessionID != info.SessionID {
+		t.Fatalf("rejoined as %+v, want session %s resumed", resumed, info.SessionID)
+	}
+	if ts.lookupRoom("room-1") != rm {
+		t.Fatal("resumed into a new room")
+	}
+	if got := rm.GetSettings(); !got.MuteOnEntry || got.MaxVideoBitrate != 750_000 {
+		t.Fatalf("settings after the resume: %+v", got)
+	}
+}
+
+func TestEmptyRoomCleanedUpAfterSessionTTL(t *testing.T) {
+	const ttl = 1500 * time.Millisecond
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.PeerDisconnectGrace = 100 * time.Millisecond
+		cfg.Media.SessionTTL = ttl
+	})
+	ts.suspend(t, "alice", "room-1")
+	ts.suspend(t, "bob", "room-2")
+	rm := ts.lookupRoom("room-2")
+	settings := rm.GetSettings()
+	settings.RecordingEnabled = true
+	rm.UpdateSettings(&settings)
+
+	ts.cleanupEmptyRooms()
+	if ts.lookupRoom("room-1") == nil {
+		t.Fatal("room cleaned up before its session expired")
+	}
+
+	// Once no session can resume, only a recording keeps the room
+	time.Sleep(ttl)
+	ts.cleanupEmptyRooms()
+	if ts.lookupRoom("room-1") != nil {
+		t.Fatal("room outlived its suspended session")
+	}
+	if ts.lookupRoom("room-2") != rm {
+		t.Fatal("room cleaned up while recording")
+	}
+}
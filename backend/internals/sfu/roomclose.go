@@ -0,0 +1,76 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// closeRoom closes a room that has already been removed from s.rooms. Its
+// clients are told why and taken out of the room, and its sessions are
+// suspended, and its snapshot saved, when the server is shutting down;
+// otherwise both are deleted. The room falls silent first, so room-closed is
+// the last its clients hear of it.
+func (s *SFU) closeRoom(ctx context.Context, roomID string, rm *room.Room, reason string) {
+	rm.BeginClose()
+	clients := s.signalingHub.DetachRoom(roomID)
+	data, err := json.Marshal(signaling.RoomClosedMessage{RoomID: roomID, Reason: reason})
+	if err == nil {
+		for _, client := range clients {
+			client.SendMessage(signaling.Message{
+				Type: signaling.MessageTypeRoomClosed, Data: data, Timestamp: time.Now(),
+			})
+		}
+	}
+	for _, client := range clients {
+		s.pruneMembership(client)
+	}
+
+	// A shutdown leaves sessions resumable on another instance; any other
+	// closure ends them along with the room's membership set.
+	suspend := reason == signaling.RoomClosedServerShutdown
+	// Saved while the room still has its peers, whose priorities it keeps
+	if suspend {
+		s.saveRoomSnapshot(ctx, rm)
+	} else {
+		s.deleteRoomSnapshot(ctx, roomID)
+	}
+
+	rm.Close()
+	s.endLiveStreams(rm)
+	s.unsubscribeRoomChannel(roomID)
+	s.recordTalkTimeSummary(roomID, rm)
+	s.recordCallSummary(ctx, rm, reason)
+
+	sessions := 0
+	if s.sessionManager.Load() != nil {
+		sessions = s.sessionManager.Load().CloseRoomSessions(ctx, roomID, suspend, rm.TalkTimes())
+	}
+	if !suspend && s.stateManager.Load() != nil {
+		s.stateManager.Load().DeleteRoomPeers(ctx, roomID)
+	}
+
+	s.logger.Info("Room closed",
+		zap.String("roomID", roomID),
+		zap.String("reason", reason),
+		zap.Int("clients", len(clients)),
+		zap.Int("sessions", sessions),
+	)
+	s.auditLogger.Log(audit.Event{
+		Actor:  "system",
+		Action: auditRoomClose,
+		RoomID: roomID,
+		Result: audit.ResultSuccess,
+		Detail: map[string]string{
+			"reason":   reason,
+			"clients":  strconv.Itoa(len(clients)),
+			"sessions": strconv.Itoa(sessions),
+		},
+	})
+}
@@ -0,0 +1,263 @@
+package sfu
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+)
+
+// closeReason returns the reason of roomID's room.close audit event, or ""
+// before there is one.
+func (ts *testServer) closeReason(roomID string) string {
+	for _, ev := range ts.auditLogger.Query(roomID, 0) {
+		if ev.Action == auditRoomClose {
+			return ev.Detail["reason"]
+		}
+	}
+	return ""
+}
+
+// joinToClose joins userID to roomID, returning the session's ID and a
+// channel of the room-closed messages it receives.
+func (ts *testServer) joinToClose(t *testing.T, userID, roomID string) (string, <-chan signaling.RoomClosedMessage) {
+	t.Helper()
+	closed := make(chan signaling.RoomClosedMessage, 1)
+	sess := ts.join(t, userID, roomID, client.Handlers{
+		OnRoomClosed: func(m signaling.RoomClosedMessage) { closed <- m },
+	}, client.JoinOptions{})
+	return sess.Info().SessionID, closed
+}
+
+func receiveRoomClosed(t *testing.T, closed <-chan signaling.RoomClosedMessage, roomID, reason string) {
+	t.Helper()
+	select {
+	case m := <-closed:
+		if m.RoomID != roomID || m.Reason != reason {
+			t.Fatalf("room-closed %+v, want %s closed as %s", m, roomID, reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no room-closed for %s", roomID)
+	}
+}
+
+func TestRoomClosedByDelete(t *testing.T) {
+	for _, tc := range []struct {
+		query, reason string
+	}{
+		{"", signaling.RoomClosedDeleted},
+		{"?reason=" + signaling.RoomClosedHostEnded, signaling.RoomClosedHostEnded},
+	} {
+		t.Run(tc.reason, func(t *testing.T) {
+			ts := newTestServer(t, nil, nil)
+			sessionID, closed := ts.joinToClose(t, "alice", "room-1")
+			if !ts.redis.Exists(state.RoomPeersKey("room-1")) {
+				t.Fatal("no peers set while the room is open")
+			}
+
+			if code := ts.api(t, http.MethodDelete, "/api/rooms/room-1"+tc.query, "", testAdminKey, nil); code != http.StatusNoContent {
+				t.Fatalf("DELETE room: %d", code)
+			}
+			receiveRoomClosed(t, closed, "room-1", tc.reason)
+			if got := ts.closeReason("room-1"); got != tc.reason {
+				t.Fatalf("audited reason %q", got)
+			}
+
+			// The session ends with the room, and the connection stays open
+			// outside of it
+			if len(ts.signalingHub.GetClientsByRoom("room-1")) != 0 || ts.signalingHub.ClientCount() != 1 {
+				t.Fatalf("%d clients still in the closed room, %d connected",
+					len(ts.signalingHub.GetClientsByRoom("room-1")), ts.signalingHub.ClientCount())
+			}
+			if sess, _ := ts.sessionManager.Load().GetSession(context.Background(), sessionID); sess != nil {
+				t.Fatalf("session kept as %+v", sess)
+			}
+			eventually(t, "the room's Redis state to be removed", func() bool {
+				return !ts.redis.Exists(state.SessionKey(sessionID)) && !ts.redis.Exists(state.RoomPeersKey("room-1"))
+			})
+		})
+	}
+}
+
+func TestRoomClosedWhenExpired(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	if code := ts.api(t, http.MethodPost, "/api/rooms", `{"id":"room-1"}`, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("POST room: %d", code)
+	}
+	ts.redis.SAdd(state.RoomPeersKey("room-1"), "stale-session")
+
+	ts.cleanupEmptyRooms()
+	if ts.lookupRoom("room-1") != nil {
+		t.Fatal("empty room kept")
+	}
+	if got := ts.closeReason("room-1"); got != signaling.RoomClosedExpired {
+		t.Fatalf("audited reason %q", got)
+	}
+	if ts.redis.Exists(state.RoomPeersKey("room-1")) {
+		t.Fatal("peers set kept")
+	}
+}
+
+func TestRoomClosedByShutdown(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	sessionID, closed := ts.joinToClose(t, "alice", "room-1")
+
+	ts.Stop()
+	receiveRoomClosed(t, closed, "room-1", signaling.RoomClosedServerShutdown)
+	if got := ts.closeReason("room-1"); got != signaling.RoomClosedServerShutdown {
+		t.Fatalf("audited reason %q", got)
+	}
+
+	// The session is left for another instance to resume
+	sess, err := ts.stateManager.Load().GetSession(context.Background(), sessionID)
+	if err != nil || sess == nil || !sess.Suspended {
+		t.Fatalf("session after shutdown: %+v, %v", sess, err)
+	}
+	if ts.redis.TTL(state.SessionKey(sessionID)) == 0 {
+		t.Fatal("suspended session stored without a TTL")
+	}
+}
+
+// closeCount returns how many times roomID's room was closed.
+func (ts *testServer) closeCount(roomID string) int {
+	n := 0
+	for _, ev := range ts.auditLogger.Query(roomID, 0) {
+		if ev.Action == auditRoomClose {
+			n++
+		}
+	}
+	return n
+}
+
+// withoutSessions runs the server without a session manager and with fast
+// room loops, so a room empties as soon as its peers' grace runs out and
+// is not kept for a resume.
+func withoutSessions(t *testing.T) func(*config.Config) {
+	addr := unusedAddr(t)
+	return func(cfg *config.Config) {
+		cfg.Redis.Addr = addr
+		cfg.Redis.Required = false
+		cfg.Media.PeerDisconnectGrace = 10 * time.Millisecond
+		cfg.Media.SpeakerDetectionInterval = 5 * time.Millisecond
+		cfg.Media.StatsInterval = 5 * time.Millisecond
+		cfg.Media.PublisherMaxBitrateKbps = 10_000
+	}
+}
+
+// Run with -race: a room deleted over the API, cleaned up once empty and
+// left by its peers all at once is closed once, and Close returns.
+func TestRoomCloseRaces(t *testing.T) {
+	ts := newTestServer(t, nil, withoutSessions(t))
+	for i := 0; i < 20; i++ {
+		roomID := fmt.Sprintf("room-%d", i)
+		var clients []*scriptedClient
+		for _, user := range []string{"alice", "bob", "carol"} {
+			clients = append(clients, ts.joinScripted(t, fmt.Sprintf("%s-%d", user, i), roomID))
+		}
+		rm := ts.lookupRoom(roomID)
+
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			<-start
+			for _, sc := range clients {
+				sc.hangUp()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			ts.deleteRoom(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/api/rooms/"+roomID, nil), roomID)
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			for j := 0; j < 5; j++ {
+				ts.cleanupEmptyRooms()
+			}
+		}()
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		close(start)
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("closing %s deadlocked", roomID)
+		}
+
+		if !rm.Closing() || ts.lookupRoom(roomID) != nil {
+			t.Fatalf("%s still open", roomID)
+		}
+		if n := ts.closeCount(roomID); n != 1 {
+			t.Fatalf("%s closed %d times", roomID, n)
+		}
+	}
+}
+
+// Close waits for the room's loops, so a loop that reached Close through
+// one of the callbacks it fires would deadlock. None of the SFU's handlers
+// of those callbacks closes the room, even once it is empty: only the
+// cleanup ticker, the API, shutdown and the time limit, which runs outside
+// the loops, do.
+func TestRoomLoopsNeverCloseTheRoom(t *testing.T) {
+	ts := newTestServer(t, nil, withoutSessions(t))
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	publish(t, alice, "alice")
+	rm, p := ts.getRoomAndPeer("room-1", "alice")
+	eventually(t, "alice to publish", func() bool { return rm.GetTrackCount() == 2 })
+	mt, ok := rm.ResolveTrack(rm.GetTrackList()[0].TrackID)
+	if !ok {
+		t.Fatal("no track")
+	}
+	alice.Leave()
+	eventually(t, "the room to empty", rm.IsEmpty)
+
+	// What the speaker, stats and policing loops fire
+	fired := map[string]func(){
+		"dominant speaker": func() { rm.OnDominantSpeakerChanged(rm.ID, p.ID, "") },
+		"quality stats":    func() { rm.OnQualityStats(rm, p, &room.PeerQuality{Level: "poor"}) },
+		"quality summary":  func() { rm.OnQualitySummary(rm, room.QualitySummary{}) },
+		"live sample":      func() { rm.OnLiveSample(rm, room.LiveSample{}) },
+		"layers in use":    func() { rm.OnLayersInUse(rm, p, mt, nil, []string{"f"}) },
+		"track paused":     func() { rm.OnTrackPaused(rm, p, mt, true) },
+		"bitrate policing": func() { rm.OnBitratePolicing(rm, p, room.BitratePolicing{Policing: true}) },
+		"track removed":    func() { rm.OnTrackRemoved(rm, p, mt) },
+		"track rejected":   func() { rm.OnTrackRejected(rm, p, mt.ID, room.RejectBitrateCapExceeded) },
+		"renegotiate":      func() { rm.OnRenegotiateNeeded(p, room.RenegotiateTrackRemoved) },
+		"event":            func() { rm.OnEvent(rm, room.RoomEvent{Type: room.EventTrackRemoved, PeerID: p.ID}) },
+	}
+	for name, fire := range fired {
+		fire()
+		if rm.Closing() || ts.lookupRoom("room-1") != rm {
+			t.Fatalf("the %s callback closed the room", name)
+		}
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		ts.cleanupEmptyRooms()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	if ts.lookupRoom("room-1") != nil {
+		t.Fatal("empty room kept")
+	}
+}
@@ -0,0 +1,180 @@
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/room"
+)
+
+var errInvalidRoomSettings = errors.New("invalid room settings")
+
+// roomOptions are the per-room overrides a room is created with. Rooms
+// created by a join use the defaults; POST /api/rooms may set any of them.
+type roomOptions struct {
+	Name     string
+	MaxPeers int
+	Settings room.RoomSettings
+	// MaxDuration closes the room that long after creation (0 = no limit)
+	MaxDuration time.Duration
+	// Host is the user ID of the room's host; the first participant to
+	// join becomes host if it is empty
+	Host string
+}
+
+// defaultRoomOptions returns the options of a room created by joining id.
+func (s *SFU) defaultRoomOptions(id string) roomOptions {
+	opts := roomOptions{
+		Name:     id,
+		MaxPeers: s.config.Server.MaxPeersPerRoom,
+		Settings: *room.DefaultSettings(),
+	}
+	opts.Settings.P2PAllowed = s.config.Media.P2PAllowed
+	opts.Settings.StablePeerIDs = s.config.Media.StablePeerIDs
+	opts.Settings.SelfMonitor = s.config.Media.SelfMonitor
+	return opts
+}
+
+// createRoomRequest is the body of POST /api/rooms. Omitted fields take the
+// defaults, and settings are merged over the default settings.
+type createRoomRequest struct {
+	ID       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	MaxPeers int             `json:"maxPeers,omitempty"`
+	Settings json.RawMessage `json:"settings,omitempty"`
+	// Seconds until the room is closed with reason time-limit
+	MaxDurationSec int `json:"maxDurationSec,omitempty"`
+	// User ID of the host, who need not have joined yet
+	HostUserID string `json:"hostUserId,omitempty"`
+	// Region the room should be created in; see routeRoom
+	PreferredRegion string `json:"preferredRegion,omitempty"`
+}
+
+// options resolves the request against the server defaults.
+func (req createRoomRequest) options(s *SFU) (roomOptions, error) {
+	opts := s.defaultRoomOptions(req.ID)
+	if req.Name != "" {
+		opts.Name = req.Name
+	}
+	if req.MaxPeers > 0 {
+		opts.MaxPeers = req.MaxPeers
+	}
+	if req.MaxDurationSec < 0 {
+		return roomOptions{}, errInvalidRoomSettings
+	}
+	opts.MaxDuration = time.Duration(req.MaxDurationSec) * time.Second
+	opts.Host = req.HostUserID
+	if len(req.Settings) > 0 {
+		if err := json.Unmarshal(req.Settings, &opts.Settings); err != nil {
+			return roomOptions{}, errInvalidRoomSettings
+		}
+	}
+	if !validSettings(&opts.Settings) {
+		return roomOptions{}, errInvalidRoomSettings
+	}
+	opts.Settings.TrackPriorities = nil
+	return opts, nil
+}
+
+// validSettings checks the settings a room is created or patched with.
+func validSettings(settings *room.RoomSettings) bool {
+	if settings.PushToTalkMaxMs < 0 {
+		return false
+	}
+	if settings.Mode != "" && settings.Mode != room.RoomModeBroadcast {
+		return false
+	}
+	return settings.ViewerStatsSamplePercent >= 0 && settings.ViewerStatsSamplePercent <= 100
+}
+
+// matches reports whether rm was created with opts, so that creating it
+// again is a no-op.
+func (opts roomOptions) matches(rm *room.Room) bool {
+	settings := rm.GetSettings()
+	settings.TrackPriorities = nil
+	limit, _ := rm.GetTimeLimit()
+	return rm.Name == opts.Name && rm.MaxPeers == opts.MaxPeers && limit.MaxDuration == opts.MaxDuration &&
+		reflect.DeepEqual(settings, opts.Settings)
+}
+
+// newConfiguredRoom builds a room with the server's configuration, the
+// given options and every SFU callback, and starts its background loops.
+// Both join-created and API-created rooms come from here. An empty id
+// keeps the room's generated ID. The caller registers the room.
+func (s *SFU) newConfiguredRoom(id string, opts roomOptions) *room.Room {
+	r := room.NewRoom(opts.Name, opts.MaxPeers, s.logger)
+	if id != "" {
+		r.ID = id
+	}
+	settings := opts.Settings
+	r.UpdateSettings(&settings)
+	r.RestoreHost(opts.Host)
+	r.AllowedCodecs = s.allowedCodecs
+	r.Region = s.config.Server.Region
+
+	if s.config.Media.RenegotiationDelay > 0 {
+		r.SetRenegotiationDelay(s.config.Media.RenegotiationDelay)
+	}
+	if s.config.Media.MaxRTPErrors > 0 {
+		r.SetMaxRTPErrors(s.config.Media.MaxRTPErrors)
+	}
+
+	r.OnRenegotiateNeeded = s.handleRenegotiationNeeded
+	r.OnPeerJoined = s.handlePeerJoined
+	r.OnPeerLeft = s.handlePeerLeft
+	r.OnPeerReplaced = s.handlePeerReplaced
+	r.OnDominantSpeakerChanged = s.handleDominantSpeakerChanged
+	r.OnQualityStats = s.handleQualityStats
+	r.OnTrackRejected = s.handleTrackRejected
+	r.OnTrackPaused = s.handleTrackPaused
+	r.OnLayersInUse = s.handleLayersInUse
+	r.OnQualitySummary = s.handleQualitySummary
+	r.OnBitratePolicing = s.handleBitratePolicing
+	r.OnTrackAdded = s.handleTrackPublished
+	r.OnTrackRemoved = s.handleTrackUnpublished
+	r.AdmitTrack = s.admitTrack
+	r.AdmitSubscriber = s.admitSubscriber
+	r.OnTimeLimitWarning = s.handleTimeLimitWarning
+	r.OnTimeLimitReached = s.handleTimeLimitReached
+	r.OnHostChanged = s.handleHostChanged
+	r.OnSpotlightChanged = s.handleSpotlightChanged
+	r.OnPeerConnectionState = s.handlePeerConnectionState
+	r.OnCodecMismatch = s.handleCodecMismatch
+	r.OnLiveSample = s.handleLiveSample
+	r.OnEvent = s.handleRoomEvent
+	r.SetMaxTracks(s.config.Media.MaxTracksPerRoom)
+	r.SetMaxObservers(s.config.Server.MaxObserversPerRoom)
+	r.SetDisconnectGrace(s.config.Media.PeerDisconnectGrace, s.config.Media.HoldTracksDuringGrace)
+	r.SetConnectionStateDebounce(s.config.Media.ConnectionStateDebounce)
+	r.SetKeyframeRequestInterval(s.config.Media.KeyframeRequestInterval)
+	r.SetLatencySampling(s.config.Media.LatencySampleEvery, s.forwardingDelays)
+	r.SetDataChannelOptions(s.config.Media.DataChannelHistorySize, s.config.Media.DataChannelQueueSize, s.config.Media.DataChannelQueueTTL)
+
+	r.SetRoomMetrics(s.config.Metrics.RoomPeers)
+	r.SetConsistencyChecks(s.config.Media.CheckRoomConsistency)
+	r.SetSimulcastEnabled(s.config.Media.SimulcastEnabled)
+	r.SetLayerIdleWindow(s.config.Media.SimulcastLayerIdleWindow)
+	r.SetParallelFanOut(s.config.Media.ParallelFanOutThreshold, s.config.Media.ParallelFanOutShards)
+	r.SetJoinAttach(s.config.Media.JoinAttachWorkers, s.config.Media.JoinAttachTimeout)
+	r.SetViewerStatsSample(s.config.Media.BroadcastViewerStatsPercent)
+	r.SetBitratePolicing(s.config.Media.PublisherMaxBitrateKbps, s.config.Media.BitratePolicingDelay, s.config.Media.BitratePolicingRemoveAfter)
+	if s.config.Media.SpeakerDetectionInterval > 0 {
+		r.SetSpeakerDetectionInterval(s.config.Media.SpeakerDetectionInterval)
+	}
+	if s.config.Media.SpeakerActivityThreshold > 0 {
+		r.SetSpeakerActivityThreshold(s.config.Media.SpeakerActivityThreshold)
+	}
+	if s.config.Media.StatsInterval > 0 {
+		r.SetStatsInterval(s.config.Media.StatsInterval)
+	}
+
+	// Broadcast rooms have a fixed presenter; there is no speaker to pick
+	if !r.IsBroadcast() {
+		r.StartDominantSpeakerDetection()
+	}
+	r.StartStatsCollection()
+	r.SetTimeLimit(opts.MaxDuration, s.config.Media.RoomTimeWarnings)
+	return r
+}
@@ -0,0 +1,135 @@
+package sfu
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+)
+
+// compareRoomConfig fails the test unless a and b were configured alike:
+// the same scalar fields, settings and codecs, and the same callbacks, all
+// of them set. Identity fields are not compared.
+func compareRoomConfig(t *testing.T, a, b *room.Room) {
+	t.Helper()
+	if !reflect.DeepEqual(a.GetSettings(), b.GetSettings()) || !reflect.DeepEqual(a.AllowedCodecs, b.AllowedCodecs) {
+		t.Fatalf("settings or codecs differ:\n%+v %v\n%+v %v", a.GetSettings(), a.AllowedCodecs, b.GetSettings(), b.AllowedCodecs)
+	}
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for i := 0; i < va.NumField(); i++ {
+		name := va.Type().Field(i).Name
+		fa, fb := va.Field(i), vb.Field(i)
+		switch fa.Kind() {
+		case reflect.Func:
+			if fa.IsNil() || fb.IsNil() || fa.Pointer() != fb.Pointer() {
+				t.Errorf("callback %s not wired alike", name)
+			}
+		case reflect.Bool:
+			if fa.Bool() != fb.Bool() {
+				t.Errorf("%s: %v and %v", name, fa.Bool(), fb.Bool())
+			}
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			if fa.Int() != fb.Int() {
+				t.Errorf("%s: %v and %v", name, fa.Int(), fb.Int())
+			}
+		case reflect.Float64:
+			if fa.Float() != fb.Float() {
+				t.Errorf("%s: %v and %v", name, fa.Float(), fb.Float())
+			}
+		case reflect.String:
+			if name != "ID" && name != "Name" && fa.String() != fb.String() {
+				t.Errorf("%s: %q and %q", name, fa.String(), fb.String())
+			}
+		}
+	}
+}
+
+func TestRoomCreationPathsMatch(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		// Every setter the rooms get, away from its default
+		cfg.Server.Region = "eu-west"
+		cfg.Server.MaxObserversPerRoom = 3
+		cfg.Media.RenegotiationDelay = 123 * time.Millisecond
+		cfg.Media.MaxRTPErrors = 7
+		cfg.Media.StatsInterval = 3 * time.Second
+		cfg.Media.SpeakerDetectionInterval = 450 * time.Millisecond
+		cfg.Media.SpeakerActivityThreshold = 9
+		cfg.Media.SimulcastEnabled = true
+		cfg.Media.SimulcastLayerIdleWindow = 4 * time.Second
+		cfg.Media.MaxTracksPerRoom = 11
+		cfg.Media.PeerDisconnectGrace = 2 * time.Second
+		cfg.Media.HoldTracksDuringGrace = true
+		cfg.Media.ConnectionStateDebounce = 300 * time.Millisecond
+		cfg.Media.KeyframeRequestInterval = 700 * time.Millisecond
+		cfg.Media.LatencySampleEvery = 5
+		cfg.Media.ParallelFanOutThreshold = 20
+		cfg.Media.ParallelFanOutShards = 3
+		cfg.Media.JoinAttachWorkers = 2
+		cfg.Media.JoinAttachTimeout = time.Second
+		cfg.Media.BroadcastViewerStatsPercent = 25
+		cfg.Media.PublisherMaxBitrateKbps = 900
+		cfg.Media.DataChannelHistorySize = 12
+		cfg.Media.P2PAllowed = true
+		cfg.Metrics.RoomPeers = true
+		cfg.Media.CheckRoomConsistency = true
+	})
+
+	joined, err := ts.getOrCreateRoom(context.Background(), "joined")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := ts.api(t, http.MethodPost, "/api/rooms", `{"id":"created"}`, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("POST room: %d", code)
+	}
+	compareRoomConfig(t, joined, ts.lookupRoom("created"))
+}
+
+func TestCreateRoomIdempotent(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	const body = `{"id":"room-1","maxPeers":5,"settings":{"muteOnEntry":true}}`
+	var first struct {
+		ID string `json:"id"`
+	}
+	if code := ts.api(t, http.MethodPost, "/api/rooms", body, testAdminKey, &first); code != http.StatusOK || first.ID != "room-1" {
+		t.Fatalf("POST room: %d, %+v", code, first)
+	}
+	rm := ts.lookupRoom("room-1")
+
+	// The same options again return the existing room
+	var again struct {
+		ID string `json:"id"`
+	}
+	if code := ts.api(t, http.MethodPost, "/api/rooms", body, testAdminKey, &again); code != http.StatusOK || again.ID != "room-1" {
+		t.Fatalf("POST room again: %d, %+v", code, again)
+	}
+	if ts.lookupRoom("room-1") != rm {
+		t.Fatal("the room was created anew")
+	}
+
+	// Different ones conflict, and leave the room as it was
+	for _, conflicting := range []string{
+		`{"id":"room-1","maxPeers":6,"settings":{"muteOnEntry":true}}`,
+		`{"id":"room-1","maxPeers":5,"settings":{"pushToTalk":true}}`,
+		`{"id":"room-1","maxPeers":5,"settings":{"muteOnEntry":true},"maxDurationSec":60}`,
+		`{"id":"room-1"}`,
+	} {
+		if code := ts.api(t, http.MethodPost, "/api/rooms", conflicting, testAdminKey, nil); code != http.StatusConflict {
+			t.Errorf("POST %s: %d, want 409", conflicting, code)
+		}
+	}
+	if settings := rm.GetSettings(); rm.MaxPeers != 5 || !settings.MuteOnEntry || settings.PushToTalk {
+		t.Fatalf("a conflicting POST changed the room: %d peers, %+v", rm.MaxPeers, settings)
+	}
+
+	// A room created by a join has the default options
+	if _, err := ts.getOrCreateRoom(context.Background(), "room-2"); err != nil {
+		t.Fatal(err)
+	}
+	if code := ts.api(t, http.MethodPost, "/api/rooms", `{"id":"room-2"}`, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("POST a joined room with the defaults: %d", code)
+	}
+}
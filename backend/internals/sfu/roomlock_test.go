@@ -0,0 +1,163 @@
+package sfu
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRoomLockAdmission(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) { cfg.Media.PeerDisconnectGrace = 10 * time.Second })
+	ts.joinScripted(t, "host", "room-1")
+	alice := ts.dialScripted(t, "alice")
+	alice.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "alice"})
+	info := joinResponse(t, alice.readUntil(t, signaling.MessageTypeJoin))
+	rm, alicePeer := ts.getRoomAndPeer("room-1", "alice")
+	if code := ts.api(t, http.MethodPatch, "/api/rooms/room-1", `{"locked":true}`, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("PATCH locked: %d", code)
+	}
+	refusals := func() float64 {
+		return testutil.ToFloat64(appmetrics.AdmissionRejectionsTotal.WithLabelValues("join", signaling.ErrorReasonRoomLocked))
+	}
+	before := refusals()
+
+	// An outsider is refused, and not held anywhere for later: there is no
+	// lobby
+	if e := ts.joinRouted(t, "mallory", "room-1", ""); e.Code != http.StatusForbidden || e.Reason != signaling.ErrorReasonRoomLocked {
+		t.Fatalf("mallory's join answered %+v", e)
+	}
+	if _, ok := rm.GetPeerByUserID("mallory"); ok || rm.GetPeerCount() != 2 {
+		t.Fatalf("mallory in the room with %d peers", rm.GetPeerCount())
+	}
+	if got := refusals() - before; got != 1 {
+		t.Fatalf("%v locked joins counted", got)
+	}
+
+	// A dropped participant resumes its session while the room is locked
+	alice.hangUp()
+	eventually(t, "alice to be held for a resume", func() bool { return ts.isDetached(alicePeer.ID) })
+	alice = ts.dialScripted(t, "alice")
+	alice.pipeline(t, signaling.MessageTypeJoin, struct {
+		signaling.JoinMessage
+		SessionID    string `json:"sessionId"`
+		SessionToken string `json:"sessionToken"`
+	}{
+		JoinMessage:  signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "alice"},
+		SessionID:    info.SessionID,
+		SessionToken: info.SessionToken,
+	})
+	if e := joinReply(t, alice, "alice's resume"); e.Code != 0 {
+		t.Fatalf("alice's resume answered %+v", e)
+	}
+	// Any resumed session gets in: resuming already checked that it is of
+	// this room and user
+	if !ts.mayJoinLocked(rm, "stranger", true) || ts.mayJoinLocked(rm, "stranger", false) {
+		t.Fatal("a resumed session is not what lets a stranger in")
+	}
+
+	// Without an authorizer the user ID is taken on trust, so a claim to be
+	// the host gets in too (see roomlock.go)
+	if e := ts.joinRouted(t, "host", "room-1", ""); e.Code != 0 {
+		t.Fatalf("a join as the host answered %+v", e)
+	}
+
+	// Unlocked, the outsider just joins again
+	if code := ts.api(t, http.MethodPatch, "/api/rooms/room-1", `{"locked":false}`, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("PATCH unlocked: %d", code)
+	}
+	if e := ts.joinRouted(t, "mallory", "room-1", ""); e.Code != 0 {
+		t.Fatalf("mallory's join of the unlocked room answered %+v", e)
+	}
+}
+
+// A session only resumes into its own room, so one taken from an open room
+// does not get past another room's lock.
+func TestRoomLockRefusesForeignSession(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	ts.joinScripted(t, "host", "room-1")
+	if code := ts.api(t, http.MethodPatch, "/api/rooms/room-1", `{"locked":true}`, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("PATCH locked: %d", code)
+	}
+	open := ts.dialScripted(t, "mallory")
+	open.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-2", UserID: "mallory", Name: "mallory"})
+	info := joinResponse(t, open.readUntil(t, signaling.MessageTypeJoin))
+
+	mallory := ts.dialScripted(t, "mallory")
+	mallory.pipeline(t, signaling.MessageTypeJoin, struct {
+		signaling.JoinMessage
+		SessionID    string `json:"sessionId"`
+		SessionToken string `json:"sessionToken"`
+	}{
+		JoinMessage:  signaling.JoinMessage{RoomID: "room-1", UserID: "mallory", Name: "mallory"},
+		SessionID:    info.SessionID,
+		SessionToken: info.SessionToken,
+	})
+	if e := joinReply(t, mallory, "mallory's resume into room-1"); e.Code != http.StatusForbidden || e.Reason != signaling.ErrorReasonRoomLocked {
+		t.Fatalf("a session of room-2 resuming into room-1 answered %+v", e)
+	}
+	if _, ok := ts.lookupRoom("room-1").GetPeerByUserID("mallory"); ok {
+		t.Fatal("mallory got into the locked room")
+	}
+}
+
+// With the jwt authorizer a claimed user ID must match the token, so the
+// lock cannot be passed by claiming to be someone in the room.
+func TestRoomLockVerifiedIdentity(t *testing.T) {
+	const secret = "secret"
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Authz.Mode = "jwt"
+		cfg.Authz.JWTSecret = secret
+	})
+	url := "ws" + strings.TrimPrefix(ts.http.URL, "http") + ts.config.Server.WSPath
+	join := func(userID, subject string) error {
+		t.Helper()
+		c, err := client.Connect(url, signJWT(secret, `{"sub":"`+subject+`","room":"room-1"}`), client.Options{UserID: userID, Name: userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err = c.JoinRoom(ctx, "room-1", client.JoinOptions{})
+		return err
+	}
+	refusedFor := func(err error) string {
+		var serverErr *client.ServerError
+		if !errors.As(err, &serverErr) {
+			t.Fatalf("join answered %v", err)
+		}
+		return serverErr.Reason
+	}
+
+	if err := join("host", "host"); err != nil {
+		t.Fatal(err)
+	}
+	rm, hostPeer := ts.getRoomAndPeer("room-1", "host")
+	if code := ts.api(t, http.MethodPatch, "/api/rooms/room-1", `{"locked":true}`, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("PATCH locked: %d", code)
+	}
+
+	if reason := refusedFor(join("mallory", "mallory")); reason != signaling.ErrorReasonRoomLocked {
+		t.Fatalf("mallory refused with %q", reason)
+	}
+	if reason := refusedFor(join("host", "mallory")); reason != signaling.ErrorReasonNotAuthorized {
+		t.Fatalf("mallory claiming to be the host refused with %q", reason)
+	}
+	if p, ok := rm.GetPeerByUserID("host"); !ok || p != hostPeer {
+		t.Fatal("the impostor took the host's peer")
+	}
+
+	// The host's own token still gets it back in
+	if err := join("host", "host"); err != nil {
+		t.Fatalf("the host rejoining: %v", err)
+	}
+}
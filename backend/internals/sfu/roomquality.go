@@ -0,0 +1,38 @@
+package sfu
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// handleQualitySummary sends a room's quality summary to its moderators when
+// Media.RoomQualityEvents is on.
+func (s *SFU) handleQualitySummary(rm *room.Room, summary room.QualitySummary) {
+	if !s.config.Media.RoomQualityEvents {
+		return
+	}
+	data, err := json.Marshal(signaling.RoomQualityMessage{
+		RoomID:          rm.ID,
+		Participants:    summary.Peers,
+		Levels:          summary.Levels,
+		PoorPercent:     summary.PoorPercent,
+		AvgPacketLoss:   summary.AvgPacketLoss,
+		WorstPeerID:     summary.WorstPeerID,
+		WorstPacketLoss: summary.WorstPacketLoss,
+	})
+	if err != nil {
+		return
+	}
+
+	msg := signaling.Message{
+		Type: signaling.MessageTypeRoomQuality, Data: data, Timestamp: time.Now(),
+	}
+	for _, client := range s.signalingHub.GetClientsByRoom(rm.ID) {
+		if p, ok := rm.GetPeerByUserID(client.UserID); ok && isModerator(rm, p) {
+			client.SendMessage(msg)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package sfu
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+func TestRoomQualityToModeratorsOnly(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		ts := newTestServer(t, nil, func(cfg *config.Config) {
+			cfg.Media.RoomQualityEvents = enabled
+		})
+		ts.createRoomWithSettings(t, `{}`)
+		host := ts.joinScripted(t, "host", "room-1")
+		moderator := ts.dialScripted(t, "mod")
+		moderator.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{
+			RoomID: "room-1", UserID: "mod", Name: "mod", InviteToken: ts.createInvite(t, "room-1", roleModerator),
+		})
+		moderator.readUntil(t, signaling.MessageTypeJoin)
+		guest := ts.joinScripted(t, "guest", "room-1")
+
+		// The room hands the SFU its summary as the counts change
+		rm := ts.lookupRoom("room-1")
+		summary := room.QualitySummary{
+			Peers:           3,
+			Levels:          map[string]int{"excellent": 1, "good": 0, "poor": 1, "critical": 1},
+			PoorPercent:     200.0 / 3,
+			AvgPacketLoss:   9,
+			WorstPeerID:     "peer-c",
+			WorstPacketLoss: 22,
+		}
+		rm.OnQualitySummary(rm, summary)
+
+		want := signaling.RoomQualityMessage{
+			RoomID: "room-1", Participants: 3, Levels: summary.Levels, PoorPercent: summary.PoorPercent,
+			AvgPacketLoss: 9, WorstPeerID: "peer-c", WorstPacketLoss: 22,
+		}
+		received := func(sc *scriptedClient) *signaling.RoomQualityMessage {
+			timeout := time.After(500 * time.Millisecond)
+			for {
+				select {
+				case m := <-sc.messages:
+					if m.Type != signaling.MessageTypeRoomQuality {
+						continue
+					}
+					var got signaling.RoomQualityMessage
+					if err := json.Unmarshal(m.Data, &got); err != nil {
+						t.Fatal(err)
+					}
+					return &got
+				case <-timeout:
+					return nil
+				}
+			}
+		}
+		for name, sc := range map[string]*scriptedClient{"host": host, "moderator": moderator} {
+			got := received(sc)
+			if !enabled {
+				if got != nil {
+					t.Fatalf("the %s got room-quality with the events off", name)
+				}
+				continue
+			}
+			if got == nil || !reflect.DeepEqual(*got, want) {
+				t.Fatalf("the %s got %+v, want %+v", name, got, want)
+			}
+		}
+		if got := received(guest); got != nil {
+			t.Fatalf("a guest got room-quality: %+v", got)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"go.uber.org/zap"
+)
+
+// Rooms only live in memory, so after a restart the sessions that resume
+// into a room would find it recreated with the defaults. A snapshot of each
+// room's configuration (settings, allowed codecs, priorities, host, mute-all,
+// lock and spotlight) is kept in Redis instead: written when the room is created
+// through the API or any of these change, refreshed with the room heartbeat, and
+// written once more when a shutdown closes the room. A room created by a
+// join starts from its snapshot when there is one.
+//
+// Snapshots are deleted when a room is closed for good and otherwise expire
+// RoomTTL plus the session TTL after they were last written, once no
+// session can resume into the room anymore.
+
+// roomSnapshotTTL is how long a snapshot outlives its last write.
+func (s *SFU) roomSnapshotTTL() time.Duration {
+	return time.Duration(state.RoomTTL)*time.Second + s.config.Media.SessionTTL
+}
+
+// saveRoomSnapshot writes the snapshot of a local room.
+func (s *SFU) saveRoomSnapshot(ctx context.Context, rm *room.Room) {
+	if s.stateManager.Load() == nil || rm == nil {
+		return
+	}
+
+	settings := rm.GetSettings()
+	settings.TrackPriorities = nil
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return
+	}
+	var muteAll json.RawMessage
+	if m := rm.GetMuteAll(); m != nil {
+		if muteAll, err = json.Marshal(m); err != nil {
+			return
+		}
+	}
+	var lock json.RawMessage
+	if l := rm.GetLock(); l != nil {
+		if lock, err = json.Marshal(l); err != nil {
+			return
+		}
+	}
+	spotlight, _ := rm.Spotlight()
+	codecs := make([]string, 0, len(rm.AllowedCodecs))
+	for codec := range rm.AllowedCodecs {
+		codecs = append(codecs, codec)
+	}
+	sort.Strings(codecs)
+
+	snapshot := &state.RoomSnapshot{
+		RoomID:        rm.ID,
+		Name:          rm.Name,
+		MaxPeers:      rm.MaxPeers,
+		Settings:      data,
+		AllowedCodecs: codecs,
+		Priorities:    rm.UserPriorities(),
+		Host:          rm.Host(),
+		MuteAll:       muteAll,
+		Lock:          lock,
+		Spotlight:     spotlight,
+		InstanceID:    s.instanceID(),
+		SavedAt:       time.Now(),
+	}
+	if err := s.stateManager.Load().SetRoomSnapshot(ctx, snapshot, s.roomSnapshotTTL()); err != nil {
+		s.logger.Debug("Failed to save room snapshot",
+			zap.String("roomID", rm.ID),
+			zap.Error(err),
+		)
+	}
+}
+
+// deleteRoomSnapshot drops the snapshot of a room that was closed for good.
+func (s *SFU) deleteRoomSnapshot(ctx context.Context, roomID string) {
+	if s.stateManager.Load() == nil {
+		return
+	}
+	if err := s.stateManager.Load().DeleteRoomSnapshot(ctx, roomID); err != nil {
+		s.logger.Debug("Failed to delete room snapshot",
+			zap.String("roomID", roomID),
+			zap.Error(err),
+		)
+	}
+}
+
+// loadRoomSnapshot returns the stored snapshot of a room, or nil if there is
+// none or it cannot be read.
+func (s *SFU) loadRoomSnapshot(ctx context.Context, roomID string) *state.RoomSnapshot {
+	if s.stateManager.Load() == nil {
+		return nil
+	}
+	snapshot, err := s.stateManager.Load().GetRoomSnapshot(ctx, roomID)
+	if err != nil {
+		s.logger.Warn("Failed to load room snapshot",
+			zap.String("roomID", roomID),
+			zap.Error(err),
+		)
+		return nil
+	}
+	return snapshot
+}
+
+// snapshotOptions returns the options of a room recreated from snapshot, or
+// false if the snapshot holds invalid settings.
+func (s *SFU) snapshotOptions(roomID string, snapshot *state.RoomSnapshot) (roomOptions, bool) {
+	opts := s.defaultRoomOptions(roomID)
+	if snapshot.Name != "" {
+		opts.Name = snapshot.Name
+	}
+	if snapshot.MaxPeers > 0 {
+		opts.MaxPeers = snapshot.MaxPeers
+	}
+	opts.Host = snapshot.Host
+	if len(snapshot.Settings) > 0 {
+		if err := json.Unmarshal(snapshot.Settings, &opts.Settings); err != nil {
+			return roomOptions{}, false
+		}
+	}
+	if !validSettings(&opts.Settings) {
+		return roomOptions{}, false
+	}
+	opts.Settings.TrackPriorities = nil
+	return opts, true
+}
+
+// restoreRoomSnapshot applies the parts of snapshot that are not room
+// options to rm, which is not registered yet.
+func restoreRoomSnapshot(rm *room.Room, snapshot *state.RoomSnapshot) {
+	if len(snapshot.AllowedCodecs) > 0 {
+		codecs := make(map[string]bool, len(snapshot.AllowedCodecs))
+		for _, codec := range snapshot.AllowedCodecs {
+			codecs[codec] = true
+		}
+		rm.AllowedCodecs = codecs
+	}
+	rm.RestoreUserPriorities(snapshot.Priorities)
+	var muteAll room.MuteAll
+	if len(snapshot.MuteAll) > 0 && json.Unmarshal(snapshot.MuteAll, &muteAll) == nil {
+		rm.SetMuteAll(&muteAll)
+	}
+	var lock room.RoomLock
+	if len(snapshot.Lock) > 0 && json.Unmarshal(snapshot.Lock, &lock) == nil {
+		rm.SetLock(&lock)
+	}
+	if snapshot.Spotlight != "" {
+		rm.RestoreSpotlight(snapshot.Spotlight)
+	}
+}
@@ -0,0 +1,96 @@
+package sfu
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRoomSnapshotSurvivesRestart(t *testing.T) {
+	mr := miniredis.RunT(t)
+	configure := func(cfg *config.Config) { cfg.Media.SessionTTL = 2 * time.Minute }
+	first := newTestServer(t, mr, configure)
+	body := `{"id":"room-1","name":"Standup","maxPeers":7,"hostUserId":"host","settings":{"muteOnEntry":true}}`
+	if code := first.api(t, http.MethodPost, "/api/rooms", body, testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("POST room: %d", code)
+	}
+	if !mr.Exists(state.RoomSnapshotKey("room-1")) {
+		t.Fatal("no snapshot of the created room")
+	}
+
+	// Settings, priorities and the lock change while the room is in use
+	first.joinScripted(t, "host", "room-1")
+	_, host := first.getRoomAndPeer("room-1", "host")
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodPatch, "/api/rooms/room-1/settings", `{"maxVideoBitrate":750000}`},
+		{http.MethodPut, "/api/rooms/room-1/priorities", `{"priorities":{"` + host.ID + `":5}}`},
+		{http.MethodPatch, "/api/rooms/room-1", `{"locked":true}`},
+	} {
+		if code := first.api(t, req.method, req.path, req.body, testAdminKey, nil); code != http.StatusOK {
+			t.Fatalf("%s %s: %d", req.method, req.path, code)
+		}
+	}
+	want := time.Duration(state.RoomTTL)*time.Second + 2*time.Minute
+	if ttl := mr.TTL(state.RoomSnapshotKey("room-1")); ttl != want {
+		t.Fatalf("snapshot TTL %v, want %v", ttl, want)
+	}
+
+	// The restarted instance recreates the room as it was
+	first.Stop()
+	second := newTestServer(t, mr, configure)
+	rm, err := second.getOrCreateRoom(context.Background(), "room-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := rm.GetSettings()
+	if rm.Name != "Standup" || rm.MaxPeers != 7 || !settings.MuteOnEntry || settings.MaxVideoBitrate != 750000 {
+		t.Fatalf("restored %q for %d with settings %+v", rm.Name, rm.MaxPeers, settings)
+	}
+	if rm.Host() != "host" || rm.GetLock() == nil || rm.UserPriorities()["host"] != 5 {
+		t.Fatalf("restored host %q, lock %+v, priorities %v", rm.Host(), rm.GetLock(), rm.UserPriorities())
+	}
+
+	// The host's priority goes to their new peer; nobody else gets past
+	// the lock
+	second.joinScripted(t, "host", "room-1")
+	_, host = second.getRoomAndPeer("room-1", "host")
+	if prio := rm.GetTrackPriorities()[host.ID]; prio != 5 {
+		t.Fatalf("host rejoined with priority %d", prio)
+	}
+	bob := second.dialScripted(t, "bob")
+	bob.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "bob", Name: "bob"})
+	if seen := bob.readUntil(t, signaling.MessageTypeError); len(seen) == 0 {
+		t.Fatal("bob joined the locked room")
+	}
+
+	// A room closed for good leaves no snapshot to come back from
+	if code := second.api(t, http.MethodDelete, "/api/rooms/room-1", "", testAdminKey, nil); code != http.StatusNoContent {
+		t.Fatalf("DELETE room: %d", code)
+	}
+	if mr.Exists(state.RoomSnapshotKey("room-1")) {
+		t.Fatal("snapshot kept after the room was deleted")
+	}
+	rm, err = second.getOrCreateRoom(context.Background(), "room-1")
+	if err != nil || rm.Name == "Standup" || rm.GetSettings().MuteOnEntry {
+		t.Fatalf("room recreated as %q with %+v, %v", rm.Name, rm.GetSettings(), err)
+	}
+}
+
+// A snapshot that cannot be used is ignored for the defaults.
+func TestInvalidRoomSnapshotIgnored(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	ts.redis.Set(state.RoomSnapshotKey("room-1"), `{"room_id":"room-1","name":"Old","settings":{"mode":"webinar"}}`)
+	ts.redis.Set(state.RoomSnapshotKey("room-2"), `not json`)
+	for _, id := range []string{"room-1", "room-2"} {
+		rm, err := ts.getOrCreateRoom(context.Background(), id)
+		if err != nil || rm.Name == "Old" {
+			t.Fatalf("%s created as %q, %v", id, rm.Name, err)
+		}
+	}
+}
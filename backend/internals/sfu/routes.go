@@ -0,0 +1,163 @@
+package sfu
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Every route is served under Server.BasePath, so the SFU can sit behind a
+// proxy that forwards /sfu/... unchanged. The WebSocket and probe routes
+// are configurable; the REST API is always under /api. URLs handed to
+// clients are built from the request, honoring X-Forwarded-Proto and
+// X-Forwarded-Host only with Server.TrustProxyHeaders.
+
+// validateRoutes checks that the base path and routes are normalized: a
+// leading slash, no trailing slash, and no two routes the same.
+func validateRoutes(cfg *config.Config) error {
+	if base := cfg.Server.BasePath; base != "" {
+		if err := checkRoutePath(base); err != nil {
+			return fmt.Errorf("base path %q: %w", base, err)
+		}
+	}
+	routes := map[string]string{
+		"ws path":     cfg.Server.WSPath,
+		"health path": cfg.Server.HealthPath,
+		"ready path":  cfg.Server.ReadyPath,
+	}
+	if cfg.Metrics.Enabled {
+		routes["metrics path"] = cfg.Metrics.Path
+	}
+	seen := map[string]string{"/drain": "drain path", "/debug/logs": "debug logs path"}
+	for name, path := range routes {
+		if err := checkRoutePath(path); err != nil {
+			return fmt.Errorf("%s %q: %w", name, path, err)
+		}
+		if path == "/api" || strings.HasPrefix(path, "/api/") {
+			return fmt.Errorf("%s %q: /api is reserved for the REST API", name, path)
+		}
+		if other, dup := seen[path]; dup {
+			return fmt.Errorf("%s %q is also the %s", name, path, other)
+		}
+		seen[path] = name
+	}
+	return nil
+}
+
+func checkRoutePath(path string) error {
+	switch {
+	case path == "" || path[0] != '/':
+		return fmt.Errorf("must start with a slash")
+	case path == "/" || strings.HasSuffix(path, "/"):
+		return fmt.Errorf("must not end with a slash")
+	case strings.ContainsAny(path, "?#") || strings.Contains(path, "//"):
+		return fmt.Errorf("must be a plain path")
+	}
+	return nil
+}
+
+// routes returns the handler of every HTTP route.
+func (s *SFU) routes() http.Handler {
+	server := s.config.Server
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(server.WSPath, s.handleWebSocket)
+	mux.HandleFunc("/api/rooms", s.corsMiddleware(s.handleRoomsAPI))
+	mux.HandleFunc("/api/rooms/", s.corsMiddleware(s.handleRoomAPI))
+	mux.HandleFunc("/api/cluster/rooms", s.corsMiddleware(s.handleClusterRoomsAPI))
+	mux.HandleFunc("/api/audit", s.corsMiddleware(s.requireAdminKey(s.handleAuditAPI)))
+	mux.HandleFunc("/api/ice-config", s.corsMiddleware(s.handleICEConfigAPI))
+	mux.HandleFunc("/api/stats", s.corsMiddleware(s.requireAdminKey(s.handleStatsAPI)))
+	mux.HandleFunc("/api/config", s.corsMiddleware(s.requireAdminKey(s.handleConfigAPI)))
+	mux.HandleFunc("/api/captures", s.corsMiddleware(s.requireAdminKey(s.handleCapturesAPI)))
+	mux.HandleFunc("/api/captures/", s.corsMiddleware(s.requireAdminKey(s.handleCapturesAPI)))
+	mux.HandleFunc("/api/recordings/", s.corsMiddleware(s.requireAdminKey(s.handleRecordingsAPI)))
+	mux.HandleFunc("/api/webhooks/stream", s.corsMiddleware(s.requireAdminKey(s.handleWebhookStreamAPI)))
+	mux.HandleFunc("/api/openapi.json", s.corsMiddleware(s.handleOpenAPI))
+	mux.HandleFunc("/api/", s.corsMiddleware(s.handleAPINotFound))
+	mux.HandleFunc(server.HealthPath, s.handleHealth)
+	mux.HandleFunc(server.ReadyPath, s.handleReady)
+	mux.HandleFunc("/drain", s.requireAdminKey(s.handleDrain))
+	mux.HandleFunc("/debug/logs", s.requireAdminKey(s.handleDebugLogs))
+
+	if s.config.Metrics.Enabled {
+		mux.Handle(s.config.Metrics.Path, s.metricsAuth(promhttp.Handler()))
+	}
+
+	if server.BasePath == "" {
+		return mux
+	}
+	// Handlers parse paths relative to the base, so it is stripped once here
+	root := http.NewServeMux()
+	root.Handle(server.BasePath+"/", http.StripPrefix(server.BasePath, mux))
+	return root
+}
+
+// publicURL returns the absolute URL of path, relative to the base path, as
+// the client that sent r reaches it. With websocket the scheme is ws or wss.
+func (s *SFU) publicURL(r *http.Request, path string, websocket bool) string {
+	secure := r.TLS != nil
+	host := r.Host
+	if s.config.Server.TrustProxyHeaders {
+		if proto := firstHeaderValue(r, "X-Forwarded-Proto"); proto != "" {
+			secure = strings.EqualFold(proto, "https") || strings.EqualFold(proto, "wss")
+		}
+		if fwdHost := firstHeaderValue(r, "X-Forwarded-Host"); fwdHost != "" {
+			host = fwdHost
+		}
+	}
+	scheme := "http"
+	switch {
+	case websocket && secure:
+		scheme = "wss"
+	case websocket:
+		scheme = "ws"
+	case secure:
+		scheme = "https"
+	}
+	return scheme + "://" + host + s.config.Server.BasePath + path
+}
+
+// requestIP returns the client's IP address: with trusted proxy headers,
+// the X-Forwarded-For entry appended by the outermost trusted proxy,
+// Server.TrustedProxyHops from the right; the peer address otherwise.
+// Entries further left are whatever the client sent and are never used.
+func (s *SFU) requestIP(r *http.Request) string {
+	if s.config.Server.TrustProxyHeaders {
+		if ip := forwardedFor(r, s.config.Server.TrustedProxyHops); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// forwardedFor returns the X-Forwarded-For entry hops from the right, over
+// every X-Forwarded-For header of r, or "" if there are fewer entries.
+func forwardedFor(r *http.Request, hops int) string {
+	hops = max(hops, 1)
+	var entries []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(header, ",") {
+			entries = append(entries, strings.TrimSpace(entry))
+		}
+	}
+	if len(entries) < hops {
+		return ""
+	}
+	return entries[len(entries)-hops]
+}
+
+// firstHeaderValue returns the first of a comma-separated header's values,
+// the one set by the proxy closest to the client.
+func firstHeaderValue(r *http.Request, name string) string {
+	value, _, _ := strings.Cut(r.Header.Get(name), ",")
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,196 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/gorilla/websocket"
+)
+
+func TestRequestIP(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		trust bool
+		hops  int
+		xff   []string
+		want  string
+	}{
+		{"untrusted", false, 1, []string{"198.51.100.7"}, "192.0.2.1"},
+		{"no header", true, 1, nil, "192.0.2.1"},
+		{"single proxy", true, 1, []string{"198.51.100.7"}, "198.51.100.7"},
+		{"spoofed entry ignored", true, 1, []string{"10.0.0.1, 198.51.100.7"}, "198.51.100.7"},
+		{"two proxies", true, 2, []string{"10.0.0.1, 198.51.100.7, 203.0.113.9"}, "198.51.100.7"},
+		{"repeated headers", true, 2, []string{"10.0.0.1", "198.51.100.7", "203.0.113.9"}, "198.51.100.7"},
+		{"fewer entries than hops", true, 3, []string{"198.51.100.7, 203.0.113.9"}, "192.0.2.1"},
+		{"hops unset", true, 0, []string{"10.0.0.1, 198.51.100.7"}, "198.51.100.7"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &SFU{config: &config.Config{Server: config.ServerConfig{TrustProxyHeaders: tc.trust, TrustedProxyHops: tc.hops}}}
+			r := httptest.NewRequest(http.MethodGet, "/api/rooms", nil)
+			r.RemoteAddr = "192.0.2.1:4242"
+			for _, v := range tc.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := s.requestIP(r); got != tc.want {
+				t.Fatalf("requestIP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateRoutes(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		configure func(*config.Config)
+		ok        bool
+	}{
+		{"defaults", func(*config.Config) {}, true},
+		{"base path", func(cfg *config.Config) { cfg.Server.BasePath = "/sfu" }, true},
+		{"nested base path", func(cfg *config.Config) { cfg.Server.BasePath = "/apps/sfu" }, true},
+		{"base path without leading slash", func(cfg *config.Config) { cfg.Server.BasePath = "sfu" }, false},
+		{"base path with trailing slash", func(cfg *config.Config) { cfg.Server.BasePath = "/sfu/" }, false},
+		{"root base path", func(cfg *config.Config) { cfg.Server.BasePath = "/" }, false},
+		{"base path with a query", func(cfg *config.Config) { cfg.Server.BasePath = "/sfu?x=1" }, false},
+		{"empty ws path", func(cfg *config.Config) { cfg.Server.WSPath = "" }, false},
+		{"ws path with trailing slash", func(cfg *config.Config) { cfg.Server.WSPath = "/signal/" }, false},
+		{"ws path with double slash", func(cfg *config.Config) { cfg.Server.WSPath = "/a//b" }, false},
+		{"ws path under /api", func(cfg *config.Config) { cfg.Server.WSPath = "/api/ws" }, false},
+		{"health path on /api", func(cfg *config.Config) { cfg.Server.HealthPath = "/api" }, false},
+		{"ready path on health", func(cfg *config.Config) { cfg.Server.ReadyPath = cfg.Server.HealthPath }, false},
+		{"health path on drain", func(cfg *config.Config) { cfg.Server.HealthPath = "/drain" }, false},
+		{"metrics path on ws", func(cfg *config.Config) { cfg.Metrics.Path = cfg.Server.WSPath }, false},
+		{"metrics path on ws, metrics off", func(cfg *config.Config) {
+			cfg.Metrics.Enabled = false
+			cfg.Metrics.Path = cfg.Server.WSPath
+		}, true},
+	} {
+		cfg := config.LoadConfig()
+		tc.configure(cfg)
+		if err := validateRoutes(cfg); (err == nil) != tc.ok {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+}
+
+// dialJoin opens the signaling WebSocket at url with header, joins roomID
+// as userID and returns the join reply.
+func dialJoin(t *testing.T, url string, header http.Header, userID, roomID string) signaling.JoinResponse {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(url+"?userId="+userID, header)
+	if err != nil {
+		t.Fatalf("dialing %s: %v", url, err)
+	}
+	defer ws.Close()
+	data, _ := json.Marshal(signaling.JoinMessage{RoomID: roomID, UserID: userID, Name: userID})
+	if err := ws.WriteJSON(signaling.Message{Type: signaling.MessageTypeJoin, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var m signaling.Message
+		if err := ws.ReadJSON(&m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Type == signaling.MessageTypeJoin {
+			return joinResponse(t, []signaling.Message{m})
+		}
+	}
+}
+
+func TestRoutesUnderBasePath(t *testing.T) {
+	for _, base := range []string{"", "/sfu"} {
+		t.Run("base="+base, func(t *testing.T) {
+			ts := newTestServer(t, nil, func(cfg *config.Config) {
+				cfg.Server.BasePath = base
+				cfg.Server.WSPath = "/signal"
+				cfg.Server.HealthPath = "/healthz"
+				cfg.Server.ReadyPath = "/readyz"
+				cfg.Metrics.Enabled = true
+				cfg.Metrics.Path = "/prom"
+			})
+			get := func(path string) int {
+				t.Helper()
+				return ts.api(t, http.MethodGet, path, "", testAdminKey, nil)
+			}
+			for _, path := range []string{"/healthz", "/readyz", "/prom", "/api/rooms", "/api/openapi.json"} {
+				if status := get(base + path); status != http.StatusOK {
+					t.Errorf("GET %s: %d", base+path, status)
+				}
+			}
+			for _, path := range []string{"/health", "/ready", "/metrics", "/ws"} {
+				if status := get(base + path); status != http.StatusNotFound {
+					t.Errorf("GET %s: %d, want 404 for a renamed route", base+path, status)
+				}
+			}
+			if base != "" {
+				for _, path := range []string{"/healthz", "/api/rooms", "/prom"} {
+					if status := get(path); status != http.StatusNotFound {
+						t.Errorf("GET %s without the base: %d", path, status)
+					}
+				}
+			}
+
+			// Clients learn the URLs as they reached the server
+			host := strings.TrimPrefix(ts.http.URL, "http://")
+			joined := dialJoin(t, "ws://"+host+base+"/signal", nil, "alice", "room-1")
+			if joined.WSURL != "ws://"+host+base+"/signal" || joined.APIURL != "http://"+host+base+"/api" {
+				t.Fatalf("join reply URLs %q, %q", joined.WSURL, joined.APIURL)
+			}
+			var spec struct {
+				Servers []struct{ URL string }
+				Paths   map[string]json.RawMessage
+			}
+			ts.api(t, http.MethodGet, base+"/api/openapi.json", "", "", &spec)
+			if len(spec.Servers) != 1 || spec.Servers[0].URL != base+"/" || spec.Paths["/healthz"] == nil || spec.Paths["/health"] != nil {
+				t.Fatalf("spec servers %+v, probe paths %v", spec.Servers, spec.Paths["/healthz"] != nil)
+			}
+		})
+	}
+}
+
+func TestPublicURLs(t *testing.T) {
+	forwarded := http.Header{}
+	forwarded.Set("X-Forwarded-Proto", "https, http")
+	forwarded.Set("X-Forwarded-Host", "meet.example.com, proxy.internal")
+	for _, trust := range []bool{false, true} {
+		ts := newTestServer(t, nil, func(cfg *config.Config) {
+			cfg.Server.BasePath = "/sfu"
+			cfg.Server.TrustProxyHeaders = trust
+		})
+		host := strings.TrimPrefix(ts.http.URL, "http://")
+		wantWS, wantAPI := "ws://"+host+"/sfu/ws", "http://"+host+"/sfu/api"
+		if trust {
+			wantWS, wantAPI = "wss://meet.example.com/sfu/ws", "https://meet.example.com/sfu/api"
+		}
+		joined := dialJoin(t, "ws://"+host+"/sfu/ws", forwarded, "alice", "room-1")
+		if joined.WSURL != wantWS || joined.APIURL != wantAPI {
+			t.Fatalf("trusted %v: join reply URLs %q, %q", trust, joined.WSURL, joined.APIURL)
+		}
+
+		// Created resources are located the same way
+		req, err := http.NewRequest(http.MethodPost, ts.http.URL+"/sfu/api/rooms/room-1/invites", strings.NewReader(`{"role":"participant"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = forwarded.Clone()
+		req.Header.Set("X-API-Key", testAdminKey)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var invite struct{ Token string }
+		json.NewDecoder(resp.Body).Decode(&invite)
+		resp.Body.Close()
+		want := strings.TrimSuffix(wantAPI, "/api") + "/api/rooms/room-1/invites/" + invite.Token
+		if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != want {
+			t.Fatalf("trusted %v: invite %d at %q, want %q", trust, resp.StatusCode, resp.Header.Get("Location"), want)
+		}
+	}
+}
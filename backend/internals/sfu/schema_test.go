@@ -0,0 +1,193 @@
+package sfu
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/state"
+	"github.com/adityaadpandey/sfu-go/internals/webhook"
+)
+
+// The golden files under testdata/schema pin the wire format of every
+// payload the server sends, webhook events included. A failure means a client-visible field was
+// added, renamed or removed: if that was intended, raise
+// signaling.SchemaVersion where needed and rerun with -update.
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files under testdata/schema")
+
+var goldenTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// signalingPayloads are the payloads of the signaling protocol.
+var signalingPayloads = []interface{}{
+	signaling.JoinResponse{}, signaling.PeerInfo{}, signaling.TrackInfo{},
+	signaling.RoomStateMessage{}, signaling.SubscriptionInfo{}, signaling.SubscriptionSnapshotMessage{},
+	signaling.TransferHostMessage{}, signaling.HostChangedMessage{}, signaling.MuteAllMessage{},
+	signaling.MuteAllChangedMessage{}, signaling.LockRoomMessage{}, signaling.RoomLockChangedMessage{},
+	signaling.SpotlightMessage{}, signaling.SpotlightChangedMessage{}, signaling.PublishExpiredMessage{},
+	signaling.ParticipantCountMessage{}, signaling.RoomQualityMessage{}, signaling.RenegotiateMessage{},
+	signaling.DominantSpeakerMessage{}, signaling.QualityStatsMessage{}, signaling.ReconnectRequiredMessage{},
+	signaling.RoomClosedMessage{}, signaling.TimeLimitMessage{}, signaling.ExtendTimeLimitMessage{},
+	signaling.TrackRejectedMessage{}, signaling.BitratePolicingMessage{}, signaling.TrackPausedMessage{},
+	signaling.MediaStateRequest{}, signaling.MediaStateMessage{}, signaling.UpdateNameMessage{},
+	signaling.SubscribeMessage{}, signaling.ReceivePreference{}, signaling.ReceivePreferencesMessage{},
+	signaling.SubscriptionAckMessage{}, signaling.DrainingMessage{}, signaling.IdleWarningMessage{},
+	signaling.PeerDrowsyMessage{}, signaling.PeerConnectionStateMessage{}, signaling.TrackStalledMessage{},
+	signaling.LayersInUseMessage{}, signaling.PublishIntentMessage{}, signaling.CodecGroupInfo{},
+	signaling.PublishIntentResponse{}, signaling.TrackPrioritiesMessage{}, signaling.DataBroadcastMessage{},
+	signaling.DataBroadcastAckMessage{}, signaling.RelayMessage{}, signaling.RelayAckMessage{},
+	signaling.P2POfferPermittedMessage{}, signaling.P2PFallbackMessage{}, signaling.RequestKeyframeMessage{},
+	signaling.TimeSyncMessage{}, signaling.JoinQueuedMessage{}, signaling.AllowRenegotiationMessage{},
+	signaling.BandwidthLimitAckMessage{},
+}
+
+func TestPayloadSchemas(t *testing.T) {
+	for _, v := range signalingPayloads {
+		typ := reflect.TypeOf(v)
+		checkGolden(t, "signaling."+typ.Name(), filled(typ))
+	}
+	checkGolden(t, "webhook.Event", filled(reflect.TypeOf(webhook.Event{})))
+	// The REST bodies, named as in the OpenAPI document
+	for typ, name := range openAPISchemaNames {
+		checkGolden(t, name, filled(typ))
+	}
+	// Embedded unexported structs are left out by filled
+	checkGolden(t, "DrainStatus.draining", drainStatusResponse{Draining: true, drainStatusDetail: &drainStatusDetail{
+		StartedAt:    goldenTime,
+		Deadline:     goldenTime.Add(time.Minute),
+		RemainingMs:  60000,
+		AlternateURL: "https://sfu-2.example.com",
+	}})
+}
+
+func TestLegacyFieldNames(t *testing.T) {
+	invite := &state.InviteData{
+		Token:         "token",
+		RoomID:        "room-1",
+		SingleUse:     true,
+		Role:          "viewer",
+		Name:          "Alice",
+		RelayOnly:     true,
+		PublishForSec: 30,
+		CreatedAt:     goldenTime,
+		ExpiresAt:     goldenTime.Add(time.Hour),
+	}
+	ev := audit.Event{
+		Time:       goldenTime,
+		InstanceID: "sfu-1",
+		Actor:      "key:0123456789ab",
+		Action:     auditInviteCreate,
+		RoomID:     "room-1",
+		PeerID:     "peer-1",
+		Result:     audit.ResultSuccess,
+		Detail:     map[string]string{"singleUse": "true"},
+	}
+	for _, legacy := range []bool{false, true} {
+		s := &SFU{config: &config.Config{Server: config.ServerConfig{LegacyFieldNames: legacy}}}
+		suffix := ".example"
+		if legacy {
+			suffix += ".legacy"
+		}
+		checkGolden(t, "Invite"+suffix, s.inviteResponse(invite))
+		checkGolden(t, "AuditEvent"+suffix, s.auditEventResponse(ev))
+	}
+}
+
+// checkGolden compares v marshaled against testdata/schema/name.json.
+func checkGolden(t *testing.T, name string, v interface{}) {
+	t.Helper()
+	got, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	got = append(got, '\n')
+	path := filepath.Join("testdata", "schema", name+".json")
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s: %v (run the test with -update to create it)", name, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: the wire format changed\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// filled returns a value of type t with every exported field set, so
+// that omitempty fields are marshaled too.
+func filled(t reflect.Type) interface{} {
+	v := reflect.New(t).Elem()
+	fill(v, t.Name(), 0)
+	return v.Interface()
+}
+
+func fill(v reflect.Value, name string, depth int) {
+	if depth > 4 {
+		return
+	}
+	switch {
+	case v.Type() == timeType:
+		v.Set(reflect.ValueOf(goldenTime))
+		return
+	case v.Type() == rawMessageType:
+		v.Set(reflect.ValueOf(json.RawMessage(`{}`)))
+		return
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(name)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1.5)
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(name))
+	case reflect.Pointer:
+		p := reflect.New(v.Type().Elem())
+		fill(p.Elem(), name, depth+1)
+		v.Set(p)
+	case reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), 1, 1)
+		fill(s.Index(0), name, depth+1)
+		v.Set(s)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fill(v.Index(i), name, depth+1)
+		}
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		key := reflect.New(v.Type().Key()).Elem()
+		fill(key, "key", depth+1)
+		elem := reflect.New(v.Type().Elem()).Elem()
+		fill(elem, name, depth+1)
+		m.SetMapIndex(key, elem)
+		v.Set(m)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !v.Field(i).CanSet() {
+				continue
+			}
+			fill(v.Field(i), f.Name, depth+1)
+		}
+	}
+}
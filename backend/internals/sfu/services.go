@@ -0,0 +1,76 @@
+package sfu
+
+import (
+	"context"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// The room-scoped signaling handlers (leave, update-name, lock-room,
+// spotlight, transfer-host, extend-time-limit) reach the rest of the SFU
+// only through RoomService and SessionService, so they can be tested
+// against fakes without Pion, Redis or a hub. Rooms and peers themselves are
+// plain values and used as they are. New handlers should take what they
+// need through these interfaces too, widening them as needed.
+
+// RoomService is what signaling handlers need of the SFU's rooms.
+type RoomService interface {
+	// RoomAndPeer returns the room and the user's peer in it, nil if the
+	// room or the peer is not found
+	RoomAndPeer(roomID, userID string) (*room.Room, *peer.Peer)
+	// LockRoom locks or unlocks rm, announces it and saves it with the
+	// room's snapshot
+	LockRoom(ctx context.Context, rm *room.Room, locked bool, by string)
+	// RenamePeer renames p everywhere it is kept and announces it,
+	// returning the previous name
+	RenamePeer(rm *room.Room, p *peer.Peer, name string) string
+	// AnnounceTimeLimit sends every client in rm its time limit
+	AnnounceTimeLimit(rm *room.Room, limit room.TimeLimit, reason string)
+}
+
+// SessionService is what signaling handlers need of the sender's session.
+type SessionService interface {
+	// Leave takes the client out of its room, ending its session if it left
+	// for good
+	Leave(client *signaling.Client)
+	// Audit records an action the client took
+	Audit(client *signaling.Client, action, peerID, result string, detail map[string]string)
+	// MessageContext bounds the work done for one message
+	MessageContext() (context.Context, context.CancelFunc)
+}
+
+// sfuRooms is the SFU's RoomService.
+type sfuRooms struct{ s *SFU }
+
+func (r sfuRooms) RoomAndPeer(roomID, userID string) (*room.Room, *peer.Peer) {
+	return r.s.getRoomAndPeer(roomID, userID)
+}
+
+func (r sfuRooms) LockRoom(ctx context.Context, rm *room.Room, locked bool, by string) {
+	r.s.applyRoomLock(ctx, rm, locked, by)
+}
+
+func (r sfuRooms) RenamePeer(rm *room.Room, p *peer.Peer, name string) string {
+	return r.s.renamePeer(rm, p, name)
+}
+
+func (r sfuRooms) AnnounceTimeLimit(rm *room.Room, limit room.TimeLimit, reason string) {
+	r.s.broadcastTimeLimit(rm, limit, reason)
+}
+
+// sfuSessions is the SFU's SessionService.
+type sfuSessions struct{ s *SFU }
+
+func (ss sfuSessions) Leave(client *signaling.Client) {
+	ss.s.leaveRoom(client)
+}
+
+func (ss sfuSessions) Audit(client *signaling.Client, action, peerID, result string, detail map[string]string) {
+	ss.s.auditClient(client, action, peerID, result, detail)
+}
+
+func (ss sfuSessions) MessageContext() (context.Context, context.CancelFunc) {
+	return ss.s.messageContext()
+}
@@ -0,0 +1,55 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+)
+
+// handleRoomSettingsAPI serves /api/rooms/{id}/settings: GET returns the
+// room's settings and PATCH merges the fields in the body into them. Track
+// priorities have their own endpoint and are ignored here.
+func (s *SFU) handleRoomSettingsAPI(w http.ResponseWriter, r *http.Request, roomID string) {
+	s.roomsMu.RLock()
+	rm, exists := s.rooms[roomID]
+	s.roomsMu.RUnlock()
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		settings := rm.GetSettings()
+		mode := settings.Mode
+		if !s.decodeJSONBody(w, r, &settings) {
+			return
+		}
+		if !validSettings(&settings) {
+			writeAPIError(w, http.StatusBadRequest, "Invalid room settings")
+			return
+		}
+		// Viewers are told apart when they join, so the mode stays fixed
+		if settings.Mode != mode {
+			writeAPIError(w, http.StatusBadRequest, "Room mode cannot be changed")
+			return
+		}
+		settings.TrackPriorities = nil
+		rm.UpdateSettings(&settings)
+		s.saveRoomSnapshot(r.Context(), rm)
+		s.updateP2P(rm)
+		s.auditRequest(r, auditRoomSettings, roomID, audit.ResultSuccess, map[string]string{
+			"muteOnEntry": strconv.FormatBool(settings.MuteOnEntry),
+			"pushToTalk":  strconv.FormatBool(settings.PushToTalk),
+		})
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPatch)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rm.GetSettings())
+}
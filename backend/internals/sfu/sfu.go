@@ -3,12 +3,20 @@ package sfu
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/authz"
+	"github.com/adityaadpandey/sfu-go/internals/icehealth"
+	"github.com/adityaadpandey/sfu-go/internals/netmark"
 	"github.com/adityaadpandey/sfu-go/internals/config"
 	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
 	"github.com/adityaadpandey/sfu-go/internals/peer"
@@ -18,13 +26,15 @@ import (
 	"github.com/adityaadpandey/sfu-go/internals/state"
 	"github.com/adityaadpandey/sfu-go/internals/subscription"
 	"github.com/adityaadpandey/sfu-go/internals/utils"
+	"github.com/adityaadpandey/sfu-go/internals/version"
+	"github.com/adityaadpandey/sfu-go/internals/webhook"
 	"github.com/gorilla/websocket"
 	"github.com/pion/interceptor"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v3"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
-	"golang.org/x/time/rate"
 )
 
 var safeIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_\-\.]+$`)
@@ -40,18 +50,88 @@ type SFU struct {
 	roomsMu sync.RWMutex
 
 	signalingHub *signaling.Hub
-	pubsubManager *signaling.PubSubManager // Redis pub/sub for horizontal scaling
 	httpServer   *http.Server
 
 	metrics *Metrics
 
-	stateManager    *state.Manager
-	sessionManager  *session.Manager
+	// Redis-backed managers. They are nil while Redis is unreachable and are
+	// set once, at startup or by redisReconnectLoop, and never cleared, so a
+	// nil check followed by a second Load is safe.
+	stateManager    atomic.Pointer[state.Manager]
+	sessionManager  atomic.Pointer[session.Manager]
+	pubsubManager   atomic.Pointer[signaling.PubSubManager] // Redis pub/sub for horizontal scaling
+	redisRetry      redisRetryState
 	subscriptionMgr *subscription.Manager
 
-	rateLimiters   map[string]*rate.Limiter
+	// Orders room summary writes against their removal; see
+	// publishRoomSummary
+	summaryMu sync.Mutex
+
+	rateLimiters   map[string]*clientLimiters
 	rateLimitersMu sync.Mutex
 
+	// Connections that have not joined a room yet, with their join
+	// timeouts; see reserveUnjoined
+	unjoined   map[string]*time.Timer
+	unjoinedMu sync.Mutex
+
+	// Peers kept after their signaling connection dropped, with their
+	// removal timers, by peer ID; see detachPeer
+	detached   map[string]*time.Timer
+	detachedMu sync.Mutex
+
+	joinQueue *joinQueue
+
+	// Joins running off their connection's ReadPump, by client ID; see
+	// runJoins
+	pendingJoins   map[string]*pendingJoin
+	pendingJoinsMu sync.Mutex
+
+	// Push-to-talk windows by peer ID; see armPushToTalk
+	pttTimers map[string]*time.Timer
+	pttMu     sync.Mutex
+
+	// Renegotiate requests awaiting the client's offer, by peer ID; see
+	// beginNegotiation
+	negotiations   map[string][]pendingNegotiation
+	negotiationsMu sync.Mutex
+
+	// Two-participant rooms whose peers may connect directly, by room ID;
+	// see updateP2P
+	p2pPairs map[string]*p2pPair
+	p2pMu    sync.Mutex
+
+	drain atomic.Pointer[drainState] // nil unless draining; see handleDrain
+
+	auditLogger *audit.Logger
+	webhooks    *webhook.Sender // nil unless Webhook.URL is set; see webhook.go
+
+	authorizer authz.Authorizer // see authz.go
+
+	captures captureSessions // debug packet captures; see capture.go
+	live     liveStreams     // live room streams; see live.go
+
+	distRefusals distRefusals // shared rate limits refused recently; see distlimit.go
+
+	dispatcher *dispatcher // routes signaling messages; see dispatcher.go
+	// What the room-scoped signaling handlers use of the SFU; see
+	// services.go
+	roomService    RoomService
+	sessionService SessionService
+
+	iceChecker *icehealth.Checker // nil when ICE health checks are disabled
+	netMark    *netmark.Net       // nil when media packets are not marked
+
+	startedAt time.Time
+	// Sampled forwarding delays of all the instance's rooms; see /stats
+	forwardingDelays *room.DelaySamples
+	// Hash of the redacted effective config, to spot drifted instances
+	configFingerprint string
+	// The codecs rooms accept, from the media engine's codecs
+	allowedCodecs map[string]bool
+	// OpenAPI document of the REST API; see buildOpenAPI
+	openAPI []byte
+
 	ctx    context.Context
 	cancel context.CancelFunc
 }
@@ -78,6 +158,12 @@ func unmarshalMessageData[T any](data json.RawMessage, out *T) error {
 }
 
 func NewSFU(cfg *config.Config) (*SFU, error) {
+	if err := validateRoutes(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
 	logger := utils.GetLogger()
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -88,20 +174,30 @@ func NewSFU(cfg *config.Config) (*SFU, error) {
 		cfg.Redis.DB,
 		logger,
 	)
+	var redisCause, redisError string
 	if err != nil {
-		logger.Warn("Redis connection failed, running without persistence", zap.Error(err))
+		cause := state.ConnectErrorCause(err)
+		if cfg.Redis.Required {
+			cancel()
+			return nil, fmt.Errorf("redis is required but the connection to %s failed (%s): %w", cfg.Redis.Addr, cause, err)
+		}
+		logger.Warn("Redis connection failed, running without persistence and retrying in the background",
+			zap.String("addr", cfg.Redis.Addr),
+			zap.String("cause", cause),
+			zap.Error(err),
+		)
 		stateManager = nil
+		redisCause, redisError = cause, err.Error()
 	}
 
-	// Initialize session manager
-	var sessionManager *session.Manager
-	if stateManager != nil {
-		sessionManager = session.NewManager(stateManager, logger)
-		// Recover sessions from previous run
-		recovered, _ := stateManager.RecoverSessions()
-		if len(recovered) > 0 {
-			logger.Info("Recovered sessions from Redis", zap.Int("count", len(recovered)))
-		}
+	// A peer held past its session's TTL could no longer resume that session
+	// by rejoining, so the grace must not outlive the session.
+	if ttl := cfg.Media.SessionTTL; ttl > 0 && cfg.Media.PeerDisconnectGrace > ttl {
+		logger.Warn("Peer disconnect grace exceeds session TTL, clamping",
+			zap.Duration("grace", cfg.Media.PeerDisconnectGrace),
+			zap.Duration("sessionTTL", ttl),
+		)
+		cfg.Media.PeerDisconnectGrace = ttl
 	}
 
 	sfu := &SFU{
@@ -109,39 +205,120 @@ func NewSFU(cfg *config.Config) (*SFU, error) {
 		logger:          logger,
 		rooms:           make(map[string]*room.Room),
 		signalingHub:    signaling.NewHub(logger),
-		stateManager:    stateManager,
-		sessionManager:  sessionManager,
 		subscriptionMgr: subscription.NewManager(cfg.Media.AutoSubscribe),
-		rateLimiters:    make(map[string]*rate.Limiter),
-		ctx:             ctx,
-		cancel:          cancel,
+		rateLimiters:    make(map[string]*clientLimiters),
+		unjoined:        make(map[string]*time.Timer),
+		pendingJoins:    make(map[string]*pendingJoin),
+		detached:        make(map[string]*time.Timer),
+		pttTimers:       make(map[string]*time.Timer),
+		negotiations:    make(map[string][]pendingNegotiation),
+		p2pPairs:        make(map[string]*p2pPair),
+		captures:        captureSessions{byID: make(map[string]*captureSession)},
+		live:            liveStreams{byRoom: make(map[*room.Room]map[*liveConsumer]struct{})},
+		distRefusals:    distRefusals{until: make(map[string]time.Time)},
+		joinQueue: newJoinQueue(
+			cfg.Media.MaxConcurrentJoins,
+			cfg.Media.MaxConcurrentJoinsPerRoom,
+			cfg.Media.JoinQueueSize,
+		),
+		startedAt:        time.Now(),
+		forwardingDelays: room.NewDelaySamples(),
+		ctx:              ctx,
+		cancel:           cancel,
+	}
+
+	// Sessions, pub/sub and the room directory need Redis; without it they
+	// are attached later by redisReconnectLoop
+	if stateManager != nil {
+		sfu.attachRedis(stateManager)
+	} else {
+		sfu.redisRetry.cause, sfu.redisRetry.lastError = redisCause, redisError
 	}
 
-	// Initialize pub/sub manager for horizontal scaling
-	if stateManager != nil {
-		sfu.pubsubManager = signaling.NewPubSubManager(
-			stateManager.GetRedisClient(),
-			sfu.signalingHub,
-			logger,
-		)
+	sfu.roomService, sfu.sessionService = sfuRooms{sfu}, sfuSessions{sfu}
+	sfu.dispatcher = sfu.newSignalingDispatcher()
+
+	if sfu.authorizer, err = newAuthorizer(cfg.Authz); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to set up authorizer: %w", err)
 	}
 
-	sfu.setupWebRTCConfig()
+	sfu.joinQueue.onDepthChanged = func(depth int) {
+		appmetrics.JoinQueueDepth.Set(float64(depth))
+	}
+
+	if cfg.Audit.Enabled {
+		var redisClient *redis.Client
+		if stateManager != nil {
+			redisClient = stateManager.GetRedisClient()
+		}
+		auditLogger, err := audit.NewLogger(audit.Options{
+			FilePath:       cfg.Audit.FilePath,
+			RingSize:       cfg.Audit.RingSize,
+			RedisStream:    cfg.Audit.RedisStream,
+			RedisStreamMax: cfg.Audit.RedisStreamMax,
+			InstanceID:     sfu.instanceID(),
+		}, redisClient, logger)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		sfu.auditLogger = auditLogger
+	}
+
+	if cfg.Webhook.URL != "" {
+		var redisClient *redis.Client
+		if stateManager != nil {
+			redisClient = stateManager.GetRedisClient()
+		}
+		sfu.webhooks = webhook.NewSender(webhook.Options{
+			URL:         cfg.Webhook.URL,
+			Secret:      cfg.Webhook.Secret,
+			Timeout:     cfg.Webhook.Timeout,
+			QueueSize:   cfg.Webhook.QueueSize,
+			RetryMax:    cfg.Webhook.RetryMax,
+			MaxAttempts: cfg.Webhook.MaxAttempts,
+			Durable:     cfg.Webhook.Durable,
+			Stream:      cfg.Webhook.StreamPrefix + sfu.instanceID(),
+			StreamMax:   cfg.Webhook.StreamMax,
+			Group:       webhookGroup,
+			Consumer:    sfu.instanceID(),
+		}, redisClient, logger)
+	}
+
+	sfu.configFingerprint = cfg.Fingerprint()
+	if sfu.openAPI, err = json.Marshal(sfu.buildOpenAPI()); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to render OpenAPI document: %w", err)
+	}
+	if err := sfu.setupWebRTCConfig(); err != nil {
+		cancel()
+		return nil, err
+	}
 	sfu.setupMetrics()
+	appmetrics.SetBuildInfo(version.Version, version.Commit, version.BuildDate, version.GoVersion(), sfu.configFingerprint)
 
-	// Start session cleanup loop
-	if sessionManager != nil {
-		go sfu.sessionCleanupLoop()
+	if cfg.WebRTC.ICEHealthInterval > 0 && len(sfu.webrtcConfig.ICEServers) > 0 {
+		sfu.iceChecker = icehealth.NewChecker(sfu.webrtcConfig.ICEServers, icehealth.Options{
+			Interval:  cfg.WebRTC.ICEHealthInterval,
+			Timeout:   cfg.WebRTC.ICEHealthTimeout,
+			DownAfter: cfg.WebRTC.ICEHealthDownAfter,
+		}, logger)
+		sfu.iceChecker.Start(ctx)
 	}
 
+	// Start session cleanup loop; it idles until sessions are available
+	go sfu.sessionCleanupLoop()
+
 	return sfu, nil
 }
 
-func (s *SFU) setupWebRTCConfig() {
+func (s *SFU) setupWebRTCConfig() error {
 	mediaEngine := &webrtc.MediaEngine{}
-	if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
-		s.logger.Error("Failed to register default codecs", zap.Error(err))
+	if err := s.registerCodecs(mediaEngine); err != nil {
+		return err
 	}
+	s.allowedCodecs = s.codecsAllowed()
 
 	// Only register simulcast header extensions if simulcast is enabled.
 	// Without these, Pion won't attempt simulcast SSRC probing, avoiding
@@ -158,6 +335,16 @@ func (s *SFU) setupWebRTCConfig() {
 		}
 	}
 
+	// abs-send-time lets sampled packets be timed from their publisher (see
+	// room/latency.go)
+	if s.config.Media.LatencySampleEvery > 0 {
+		for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+			if err := mediaEngine.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: sdp.ABSSendTimeURI}, kind); err != nil {
+				s.logger.Error("Failed to register header extension", zap.String("uri", sdp.ABSSendTimeURI), zap.Error(err))
+			}
+		}
+	}
+
 	i := &interceptor.Registry{}
 	if err := webrtc.RegisterDefaultInterceptors(mediaEngine, i); err != nil {
 		s.logger.Error("Failed to register default interceptors", zap.Error(err))
@@ -172,6 +359,9 @@ func (s *SFU) setupWebRTCConfig() {
 	if s.config.WebRTC.PublicIP != "" {
 		settingEngine.SetNAT1To1IPs([]string{s.config.WebRTC.PublicIP}, webrtc.ICECandidateTypeHost)
 	}
+	if s.config.WebRTC.DSCP != "" || s.config.WebRTC.SocketPriority > 0 {
+		s.setupPacketMarking(&settingEngine)
+	}
 
 	s.webrtcAPI = webrtc.NewAPI(
 		webrtc.WithMediaEngine(mediaEngine),
@@ -184,11 +374,73 @@ func (s *SFU) setupWebRTCConfig() {
 	}
 	for idx, iceServer := range s.config.WebRTC.ICEServers {
 		s.webrtcConfig.ICEServers[idx] = webrtc.ICEServer{
-			URLs:       iceServer.URLs,
-			Username:   iceServer.Username,
-			Credential: iceServer.Credential,
+			URLs:     iceServer.URLs,
+			Username: iceServer.Username,
 		}
+		if iceServer.Credential != "" {
+			s.webrtcConfig.ICEServers[idx].Credential = iceServer.Credential
+		}
+	}
+	return nil
+}
+
+// setupPacketMarking has the sockets ICE opens marked with the configured
+// DSCP and socket priority. A bad value or a failure leaves media unmarked.
+func (s *SFU) setupPacketMarking(settingEngine *webrtc.SettingEngine) {
+	dscp := 0
+	if s.config.WebRTC.DSCP != "" {
+		var err error
+		if dscp, err = netmark.ParseDSCP(s.config.WebRTC.DSCP); err != nil {
+			s.logger.Error("Media packets will not be marked", zap.Error(err))
+			return
+		}
+	}
+	n, err := netmark.New(dscp, s.config.WebRTC.SocketPriority, s.logger)
+	if err != nil {
+		s.logger.Error("Media packets will not be marked", zap.Error(err))
+		return
+	}
+	settingEngine.SetNet(n)
+	s.netMark = n
+}
+
+// packetMarkingStatus reports whether media packets are being marked.
+func (s *SFU) packetMarkingStatus() netmark.Status {
+	if s.netMark == nil {
+		return netmark.Status{}
+	}
+	return s.netMark.Status()
+}
+
+// clientICEServers returns the ICE servers to hand to clients, ordered and
+// filtered by health when checks are enabled.
+func (s *SFU) clientICEServers() []webrtc.ICEServer {
+	if s.iceChecker != nil {
+		return s.iceChecker.ICEServers()
+	}
+	return s.webrtcConfig.ICEServers
+}
+
+func (s *SFU) iceServerHealth() interface{} {
+	if s.iceChecker == nil {
+		return "disabled"
 	}
+	return s.iceChecker.Statuses()
+}
+
+// iceConfigResponse is the body of GET /api/ice-config.
+type iceConfigResponse struct {
+	ICEServers []webrtc.ICEServer `json:"iceServers"`
+}
+
+// handleICEConfigAPI serves GET /api/ice-config with the client ICE servers.
+func (s *SFU) handleICEConfigAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(iceConfigResponse{ICEServers: s.clientICEServers()})
 }
 
 func (s *SFU) setupMetrics() {
@@ -215,13 +467,26 @@ func (s *SFU) setupMetrics() {
 		}),
 	}
 
-	prometheus.MustRegister(
-		s.metrics.ActiveRooms,
-		s.metrics.ActivePeers,
-		s.metrics.TotalConnections,
-		s.metrics.MessagesSent,
-		s.metrics.MessagesReceived,
-	)
+	// A second SFU in the same process, as in tests, shares the first one's
+	// collectors
+	s.metrics.ActiveRooms = registerCollector(s.metrics.ActiveRooms)
+	s.metrics.ActivePeers = registerCollector(s.metrics.ActivePeers)
+	s.metrics.TotalConnections = registerCollector(s.metrics.TotalConnections)
+	s.metrics.MessagesSent = registerCollector(s.metrics.MessagesSent)
+	s.metrics.MessagesReceived = registerCollector(s.metrics.MessagesReceived)
+}
+
+// registerCollector registers c, or returns the collector already
+// registered under its name.
+func registerCollector[C prometheus.Collector](c C) C {
+	if err := prometheus.Register(c); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if errors.As(err, &registered) {
+			return registered.ExistingCollector.(C)
+		}
+		panic(err)
+	}
+	return c
 }
 
 func (s *SFU) Start() error {
@@ -230,54 +495,83 @@ func (s *SFU) Start() error {
 		zap.Int("port", s.config.Server.Port),
 	)
 
-	go s.signalingHub.Run()
-	go s.roomCleanupLoop()
-
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/ws", s.handleWebSocket)
-	mux.HandleFunc("/api/rooms", s.corsMiddleware(s.handleRoomsAPI))
-	mux.HandleFunc("/api/rooms/", s.corsMiddleware(s.handleRoomAPI))
-	mux.HandleFunc("/health", s.handleHealth)
-
-	if s.config.Metrics.Enabled {
-		mux.Handle(s.config.Metrics.Path, promhttp.Handler())
-	}
+	s.startLoops()
 
 	s.httpServer = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.Port),
-		Handler:      mux,
+		Handler:      s.routes(),
 		ReadTimeout:  s.config.Server.ReadTimeout,
 		WriteTimeout: s.config.Server.WriteTimeout,
+		// Request contexts end when the SFU stops, so handlers blocked on
+		// Redis abort instead of running past the shutdown deadline.
+		BaseContext: func(net.Listener) context.Context { return s.ctx },
 	}
 
-	go func() {
-		<-s.ctx.Done()
-		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), s.config.Server.ShutdownTimeout)
-		defer shutdownCancel()
-		s.httpServer.Shutdown(shutdownCtx)
-	}()
-
 	s.logger.Info("SFU server started successfully")
-	return s.httpServer.ListenAndServe()
+	if err := s.httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// startLoops starts the signaling hub and the background loops, and
+// registers the instance.
+func (s *SFU) startLoops() {
+	s.updateMetrics()
+	go s.signalingHub.Run()
+	go s.roomCleanupLoop()
+	go s.idlePeerLoop()
+	s.registerInstance(s.ctx)
+	go s.roomHeartbeatLoop()
+	go s.participantCountLoop()
+	go s.mapSizeLoop()
+	if s.stateManager.Load() == nil {
+		go s.redisReconnectLoop()
+	}
 }
 
 func (s *SFU) Stop() {
 	s.logger.Info("Stopping SFU server")
+	// Redis cleanup must not hold up shutdown past its deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Server.ShutdownTimeout)
+	defer cancel()
+
 	s.roomsMu.Lock()
-	for _, rm := range s.rooms {
-		rm.Close()
-	}
+	closing := s.rooms
 	s.rooms = make(map[string]*room.Room)
 	s.roomsMu.Unlock()
+
+	closed := make([]string, 0, len(closing))
+	for id, rm := range closing {
+		s.closeRoom(ctx, id, rm, signaling.RoomClosedServerShutdown)
+		s.joinQueue.DrainRoom(id)
+		s.removeRoomSummary(ctx, id)
+		closed = append(closed, id)
+	}
+	s.roomsRemoved(closed...)
+	s.unregisterInstance(ctx)
+	if s.pubsubManager.Load() != nil {
+		s.pubsubManager.Load().Close()
+	}
+	s.stopCaptures()
+
+	// The audit and webhook sinks close last, once no request is left to
+	// record an event
 	s.cancel()
+	if s.httpServer != nil {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), s.config.Server.ShutdownTimeout)
+		defer shutdownCancel()
+		s.httpServer.Shutdown(shutdownCtx)
+	}
+	s.auditLogger.Close()
+	s.webhooks.Close()
 }
 
 func (s *SFU) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -286,7 +580,8 @@ func (s *SFU) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// roomCleanupLoop periodically removes empty inactive rooms.
+// roomCleanupLoop periodically removes empty inactive rooms and puts rooms
+// whose peers are all disconnected to sleep.
 func (s *SFU) roomCleanupLoop() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
@@ -297,21 +592,51 @@ func (s *SFU) roomCleanupLoop() {
 			return
 		case <-ticker.C:
 			s.cleanupEmptyRooms()
+			s.checkDormantRooms()
 		}
 	}
 }
 
 func (s *SFU) cleanupEmptyRooms() {
 	s.roomsMu.Lock()
-	defer s.roomsMu.Unlock()
-
+	expired := make(map[string]*room.Room)
 	for id, rm := range s.rooms {
-		if rm.IsEmpty() {
-			rm.Close()
+		if rm.IsEmpty() && !s.retainEmptyRoom(id, rm) {
 			delete(s.rooms, id)
-			s.logger.Debug("Cleaned up empty room", zap.String("roomID", id))
+			expired[id] = rm
 		}
 	}
+	s.roomsMu.Unlock()
+
+	removed := make([]string, 0, len(expired))
+	for id, rm := range expired {
+		s.closeRoom(s.ctx, id, rm, signaling.RoomClosedExpired)
+		s.joinQueue.DrainRoom(id)
+		s.removeRoomSummary(s.ctx, id)
+		removed = append(removed, id)
+		s.logger.Debug("Cleaned up empty room", zap.String("roomID", id))
+	}
+	s.roomsRemoved(removed...)
+}
+
+// checkDormantRooms puts rooms whose peers have all been disconnected for
+// Media.DormantRoomAfter to sleep (see room/dormant.go).
+func (s *SFU) checkDormantRooms() {
+	after := s.config.Media.DormantRoomAfter
+	if after <= 0 {
+		return
+	}
+	s.roomsMu.RLock()
+	rooms := make([]*room.Room, 0, len(s.rooms))
+	for _, rm := range s.rooms {
+		rooms = append(rooms, rm)
+	}
+	s.roomsMu.RUnlock()
+
+	now := time.Now()
+	for _, rm := range rooms {
+		rm.CheckDormant(now, after)
+	}
 }
 
 // sessionCleanupLoop periodically removes expired suspended sessions.
@@ -324,8 +649,8 @@ func (s *SFU) sessionCleanupLoop() {
 		case <-s.ctx.Done():
 			return
 		case <-ticker.C:
-			if s.sessionManager != nil {
-				removed := s.sessionManager.CleanupExpiredSessions(s.config.Media.SessionTTL)
+			if s.sessionManager.Load() != nil {
+				removed := s.sessionManager.Load().CleanupExpiredSessions(s.config.Media.SessionTTL)
 				if removed > 0 {
 					appmetrics.SuspendedSessions.Sub(float64(removed))
 				}
@@ -334,58 +659,15 @@ func (s *SFU) sessionCleanupLoop() {
 	}
 }
 
-func (s *SFU) getClientRateLimiter(clientID string) *rate.Limiter {
-	s.rateLimitersMu.Lock()
-	defer s.rateLimitersMu.Unlock()
-	if limiter, ok := s.rateLimiters[clientID]; ok {
-		return limiter
-	}
-	limiter := rate.NewLimiter(rate.Limit(s.config.Media.RateLimitPerSec), s.config.Media.RateLimitBurst)
-	s.rateLimiters[clientID] = limiter
-	return limiter
-}
-
-func (s *SFU) removeClientRateLimiter(clientID string) {
-	s.rateLimitersMu.Lock()
-	delete(s.rateLimiters, clientID)
-	s.rateLimitersMu.Unlock()
-}
-
 // --- Signaling message handling ---
 
+// handleSignalingMessage is called from the client's ReadPump, so one
+// client's messages are handled one at a time in arrival order. Joins are
+// the exception: they run on their own goroutine, and the messages that
+// follow them, later joins included, wait for the join's outcome (see
+// prejoin.go).
 func (s *SFU) handleSignalingMessage(client *signaling.Client, message signaling.Message) {
-	s.metrics.MessagesReceived.Inc()
-
-	limiter := s.getClientRateLimiter(client.ID)
-	if !limiter.Allow() {
-		client.SendError(429, "Rate limit exceeded")
-		return
-	}
-
-	switch message.Type {
-	case signaling.MessageTypeJoin:
-		s.handleJoinMessage(client, message)
-	case signaling.MessageTypeLeave:
-		s.handleLeaveMessage(client)
-	case signaling.MessageTypeOffer:
-		s.handleOfferMessage(client, message)
-	case signaling.MessageTypeAnswer:
-		s.handleAnswerMessage(client, message)
-	case signaling.MessageTypeICECandidate:
-		s.handleICECandidateMessage(client, message)
-	case signaling.MessageTypeLayerSwitch:
-		s.handleLayerSwitchMessage(client, message)
-	case signaling.MessageTypeICERestartRequest:
-		s.handleICERestartRequest(client)
-	case signaling.MessageTypeIsAllowRenegotiation:
-		s.handleIsAllowRenegotiationMessage(client)
-	case signaling.MessageTypeSetBandwidthLimit:
-		s.handleSetBandwidthLimitMessage(client, message)
-	case signaling.MessageTypePong:
-		// no-op
-	default:
-		s.logger.Debug("Unknown message type", zap.String("type", string(message.Type)))
-	}
+	s.dispatcher.dispatch(client, message)
 }
 
 func (s *SFU) validateID(id string, maxLen int, fieldName string) error {
@@ -401,515 +683,263 @@ func (s *SFU) validateID(id string, maxLen int, fieldName string) error {
 	return nil
 }
 
-func (s *SFU) handleJoinMessage(client *signaling.Client, message signaling.Message) {
-	var joinMsg struct {
-		signaling.JoinMessage
-		SessionID    string `json:"sessionId,omitempty"`
-		SessionToken string `json:"sessionToken,omitempty"`
-	}
-	if err := unmarshalMessageData(message.Data, &joinMsg); err != nil {
-		client.SendError(400, "Invalid join message format")
-		return
+// messageContext bounds the Redis work done for one signaling message. It
+// also ends when the SFU stops.
+func (s *SFU) messageContext() (context.Context, context.CancelFunc) {
+	if timeout := s.config.Server.MessageTimeout; timeout > 0 {
+		return context.WithTimeout(s.ctx, timeout)
 	}
+	return context.WithCancel(s.ctx)
+}
 
-	if err := s.validateID(joinMsg.RoomID, s.config.Media.MaxRoomIDLength, "roomId"); err != nil {
-		client.SendError(400, err.Error())
+func (s *SFU) handleDominantSpeakerChanged(roomID, oldPeerID, newPeerID string) {
+	rm := s.lookupRoom(roomID)
+	if rm == nil {
 		return
 	}
-	if err := s.validateID(joinMsg.UserID, s.config.Media.MaxUserIDLength, "userId"); err != nil {
-		client.SendError(400, err.Error())
+	data, err := json.Marshal(signaling.DominantSpeakerMessage{
+		OldPeerID: oldPeerID,
+		NewPeerID: newPeerID,
+	})
+	if err != nil {
 		return
 	}
 
-	// Try to resume existing session
-	var sess *session.Session
-	var resumed bool
-	if s.sessionManager != nil && joinMsg.SessionID != "" && joinMsg.SessionToken != "" {
-		var err error
-		sess, err = s.sessionManager.ResumeSession(joinMsg.SessionID, joinMsg.SessionToken)
-		if err != nil {
-			s.logger.Debug("Session resume failed", zap.Error(err))
-			appmetrics.RecordSessionRecovery(false)
-		} else {
-			resumed = true
-			appmetrics.RecordSessionRecovery(true)
-			s.logger.Info("Session resumed",
-				zap.String("sessionID", sess.ID),
-				zap.String("userID", sess.UserID),
-			)
-		}
-	}
-
-	// Create new session if not resumed
-	if sess == nil && s.sessionManager != nil {
-		var err error
-		sess, err = s.sessionManager.CreateSession(joinMsg.UserID, joinMsg.RoomID, joinMsg.Name)
-		if err != nil {
-			s.logger.Error("Failed to create session", zap.Error(err))
-		}
-		appmetrics.ActiveSessions.Inc()
+	msg := signaling.Message{
+		Type: signaling.MessageTypeDominantSpeaker, Data: data, Timestamp: time.Now(),
 	}
+	s.broadcastToRoom(rm, msg, nil)
+}
 
-	rm := s.getOrCreateRoom(joinMsg.RoomID)
-	if rm == nil {
-		client.SendError(500, "Failed to create room")
+func (s *SFU) handleQualityStats(rm *room.Room, p *peer.Peer, quality *room.PeerQuality) {
+	data, err := json.Marshal(signaling.QualityStatsMessage{
+		PeerID:     p.ID,
+		Level:      quality.Level,
+		PacketLoss: quality.PacketLoss,
+	})
+	if err != nil {
 		return
 	}
 
-	// Evict old peer if same userId is already in the room (page refresh)
-	if oldPeer, ok := rm.GetPeerByUserID(joinMsg.UserID); ok {
-		s.logger.Info("Evicting stale peer for reconnecting user",
-			zap.String("userID", joinMsg.UserID),
-			zap.String("oldPeerID", oldPeer.ID),
-		)
-		rm.RemovePeer(oldPeer.ID)
+	msg := signaling.Message{
+		Type: signaling.MessageTypeQualityStats, Data: data, Timestamp: time.Now(),
 	}
 
-	// Evict old WS clients for this userId (stale connections from refresh)
-	s.signalingHub.DisconnectClientsByUserID(joinMsg.UserID, client.ID)
-
-	p := peer.NewPeer(joinMsg.RoomID, joinMsg.UserID, joinMsg.Name, s.logger)
-	if err := p.CreatePeerConnection(s.webrtcAPI, s.webrtcConfig); err != nil {
-		s.logger.Error("Failed to create peer connection", zap.Error(err))
-		client.SendError(500, "Failed to create peer connection")
+	// A broadcast viewer's stats go to the viewer alone, not to the
+	// publishers and the rest of the audience
+	if p.Viewer {
+		s.sendToPeerClient(p, msg)
 		return
 	}
-
-	p.OnICECandidateGenerated = s.handleServerICECandidate
-
-	if err := rm.AddPeer(p); err != nil {
-		s.logger.Error("Failed to add peer to room", zap.Error(err))
-		client.SendError(400, err.Error())
-		return
-	}
-
-	// Link session to peer
-	if sess != nil {
-		s.sessionManager.UpdatePeerID(sess.ID, p.ID)
-	}
-
-	client.RoomID = joinMsg.RoomID
-	client.UserID = joinMsg.UserID
-	client.Name = joinMsg.Name
-
-	s.metrics.TotalConnections.Inc()
-	s.updateMetrics()
-
-	// Build response with session info
-	responseData := map[string]interface{}{
-		"success": true,
-		"peerId":  p.ID,
-		"roomId":  rm.ID,
-		"resumed": resumed,
-	}
-	if sess != nil {
-		responseData["sessionId"] = sess.ID
-		responseData["sessionToken"] = sess.Token
-	}
-
-	data, err := json.Marshal(responseData)
-	if err != nil {
-		client.SendError(500, "Internal server error")
-		return
+	for _, client := range s.signalingHub.GetClientsByRoom(p.RoomID) {
+		client.SendMessage(msg)
 	}
-	client.SendMessage(signaling.Message{
-		Type: signaling.MessageTypeJoin, Data: data, Timestamp: time.Now(),
-	})
-
-	s.logger.Info("Peer joined",
-		zap.String("room", joinMsg.RoomID),
-		zap.String("peer", p.ID),
-		zap.String("name", joinMsg.Name),
-		zap.Bool("resumed", resumed),
-	)
-
-	// Notify other peers
-	s.broadcastPeerEvent(joinMsg.RoomID, p, signaling.MessageTypePeerJoined, client.ID)
-
-	// Send room state to the new peer
-	s.sendRoomState(client, rm, p.ID)
 }
 
-func (s *SFU) sendRoomState(client *signaling.Client, rm *room.Room, excludePeerID string) {
-	allPeers := rm.GetAllPeers()
-	peerList := make([]map[string]interface{}, 0, len(allPeers))
-	for _, p := range allPeers {
-		if p.ID == excludePeerID {
-			continue
-		}
-		peerList = append(peerList, map[string]interface{}{
-			"peerId": p.ID,
-			"userId": p.UserID,
-			"name":   p.Name,
-		})
-	}
-
-	data, err := json.Marshal(map[string]interface{}{"peers": peerList})
-	if err != nil {
-		return
+// retainEmptyRoom reports whether an empty room must be kept: a recording
+// is in progress, or a suspended session may still resume into it and should
+// find the same room, settings included.
+func (s *SFU) retainEmptyRoom(roomID string, rm *room.Room) bool {
+	if rm.GetSettings().RecordingEnabled {
+		s.logger.Debug("Keeping empty room, recording in progress", zap.String("roomID", roomID))
+		return true
+	}
+	if s.sessionManager.Load() == nil {
+		return false
+	}
+	if until := s.sessionManager.Load().SuspendedUntil(roomID, s.config.Media.SessionTTL); !until.IsZero() {
+		s.logger.Debug("Keeping empty room for suspended sessions",
+			zap.String("roomID", roomID),
+			zap.Time("until", until),
+		)
+		return true
 	}
-	client.SendMessage(signaling.Message{
-		Type: signaling.MessageTypeRoomState, Data: data, Timestamp: time.Now(),
-	})
+	return false
 }
 
-func (s *SFU) handleLeaveMessage(client *signaling.Client) {
-	if client.RoomID == "" {
-		return
-	}
+// --- Room management ---
 
+// getOrCreateRoom returns the local room roomID, creating it from its
+// snapshot (see roomsnapshot.go) or the defaults if it does not exist. A
+// room another instance is creating or hosts may instead be answered with
+// a *roomRedirectError or *roomElsewhereError (see roomclaim.go). A new
+// room's summary is published before it is returned, so an instance that
+// lost the creation claim finds it.
+func (s *SFU) getOrCreateRoom(ctx context.Context, roomID string) (*room.Room, error) {
 	s.roomsMu.RLock()
-	rm, exists := s.rooms[client.RoomID]
+	r, exists := s.rooms[roomID]
 	s.roomsMu.RUnlock()
-
 	if exists {
-		if p, ok := rm.GetPeerByUserID(client.UserID); ok {
-			rm.RemovePeer(p.ID)
-		}
+		return r, nil
 	}
-
-	client.RoomID = ""
-	s.updateMetrics()
-}
-
-func (s *SFU) handleOfferMessage(client *signaling.Client, message signaling.Message) {
-	var offerMsg signaling.OfferMessage
-	if err := unmarshalMessageData(message.Data, &offerMsg); err != nil {
-		client.SendError(400, "Invalid offer message format")
-		return
+	// A room that could not be created here is refused before it is
+	// claimed, and checked again below
+	if s.draining() != nil {
+		return nil, ErrDraining
 	}
-
-	s.logger.Info("Offer received",
-		zap.String("clientID", client.ID),
-		zap.String("roomID", client.RoomID),
-		zap.String("userID", client.UserID),
-	)
-
-	rm, p := s.getRoomAndPeer(client.RoomID, client.UserID)
-	if rm == nil || p == nil {
-		s.logger.Error("Room or peer not found for offer",
-			zap.String("roomID", client.RoomID),
-			zap.String("userID", client.UserID),
-		)
-		client.SendError(404, "Room or peer not found")
-		return
+	if s.atRoomCapacity() {
+		return nil, ErrMaxRoomsReached
 	}
+	// Claim and read before taking roomsMu so no other room waits on Redis
+	release, err := s.claimRoomCreation(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	created := false
+	var fresh *room.Room
+	defer func() {
+		if !created {
+			release()
+		} else if fresh != nil {
+			s.publishRoomSummary(ctx, roomID, fresh)
+		}
+	}()
+	snapshot := s.loadRoomSnapshot(ctx, roomID)
 
-	isRenegotiation := p.Connection.RemoteDescription() != nil
-	s.logger.Info("Processing offer",
-		zap.String("peerID", p.ID),
-		zap.Bool("isRenegotiation", isRenegotiation),
-	)
+	s.roomsMu.Lock()
+	defer s.roomsMu.Unlock()
 
-	offer := webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offerMsg.SDP}
-	if err := p.SetRemoteDescription(offer); err != nil {
-		s.logger.Error("Failed to set remote description", zap.Error(err))
-		client.SendError(500, "Failed to set remote description")
-		return
+	if r, exists := s.rooms[roomID]; exists {
+		created = true
+		return r, nil
 	}
-
-	// For initial connection, add existing tracks BEFORE creating the answer
-	// so they're included in the SDP. No renegotiation round-trip needed.
-	if !isRenegotiation {
-		rm.AddExistingTracksToPeer(p)
+	if s.draining() != nil {
+		return nil, ErrDraining
 	}
-
-	answer, err := p.Connection.CreateAnswer(nil)
-	if err != nil {
-		s.logger.Error("Failed to create answer", zap.Error(err))
-		client.SendError(500, "Failed to create answer")
-		return
+	if s.roomsRemaining() == 0 {
+		return nil, ErrMaxRoomsReached
 	}
 
-	if err := p.Connection.SetLocalDescription(answer); err != nil {
-		s.logger.Error("Failed to set local description", zap.Error(err))
-		client.SendError(500, "Failed to set local description")
-		return
+	opts := s.defaultRoomOptions(roomID)
+	if snapshot != nil {
+		restored, ok := s.snapshotOptions(roomID, snapshot)
+		if ok {
+			opts = restored
+		} else {
+			s.logger.Warn("Ignoring invalid room snapshot", zap.String("roomID", roomID))
+			snapshot = nil
+		}
 	}
 
-	answerData, err := json.Marshal(signaling.AnswerMessage{
-		SDP: answer.SDP, Type: answer.Type.String(), PeerID: p.ID,
-	})
-	if err != nil {
-		client.SendError(500, "Internal server error")
-		return
+	r = s.newConfiguredRoom(roomID, opts)
+	if snapshot != nil {
+		restoreRoomSnapshot(r, snapshot)
+		s.logger.Info("Room restored from snapshot",
+			zap.String("roomID", roomID),
+			zap.String("savedBy", snapshot.InstanceID),
+			zap.Time("savedAt", snapshot.SavedAt),
+		)
 	}
-	client.SendMessage(signaling.Message{
-		Type: signaling.MessageTypeAnswer, Data: answerData, Timestamp: time.Now(),
-	})
-	s.logger.Info("Answer sent",
-		zap.String("peerID", p.ID),
-		zap.String("clientID", client.ID),
-	)
+	s.rooms[roomID] = r
+	created = true
+	fresh = r
+	return r, nil
 }
 
-func (s *SFU) handleAnswerMessage(client *signaling.Client, message signaling.Message) {
-	var answerMsg signaling.AnswerMessage
-	if err := unmarshalMessageData(message.Data, &answerMsg); err != nil {
-		client.SendError(400, "Invalid answer message format")
-		return
-	}
-
-	_, p := s.getRoomAndPeer(client.RoomID, client.UserID)
-	if p == nil {
-		client.SendError(404, "Room or peer not found")
-		return
-	}
+// totalTrackCount sums published tracks across every local room.
+func (s *SFU) totalTrackCount() int {
+	s.roomsMu.RLock()
+	defer s.roomsMu.RUnlock()
 
-	answer := webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answerMsg.SDP}
-	if err := p.SetRemoteDescription(answer); err != nil {
-		s.logger.Error("Failed to set remote description for answer", zap.Error(err))
-		client.SendError(500, "Failed to set remote description")
+	total := 0
+	for _, rm := range s.rooms {
+		total += rm.GetTrackCount()
 	}
+	return total
 }
 
-func (s *SFU) handleICECandidateMessage(client *signaling.Client, message signaling.Message) {
-	var iceMsg signaling.ICECandidateMessage
-	if err := unmarshalMessageData(message.Data, &iceMsg); err != nil {
-		client.SendError(400, "Invalid ICE candidate message format")
-		return
+// admitTrack enforces the per-instance track cap; the per-room cap is checked
+// by the room itself.
+func (s *SFU) admitTrack(rm *room.Room, p *peer.Peer, track *webrtc.TrackRemote) string {
+	limit := s.config.Media.MaxTracksPerInstance
+	if limit > 0 && s.totalTrackCount() >= limit {
+		return "instance_track_limit"
 	}
+	return s.authorizePublish(rm, p, track.Kind().String())
+}
 
-	_, p := s.getRoomAndPeer(client.RoomID, client.UserID)
-	if p == nil {
-		client.SendError(404, "Room or peer not found")
-		return
+// admitJoin rejects a join when the room's projected track count (peers ×
+// expected tracks per peer) would exceed its track cap.
+func (s *SFU) admitJoin(rm *room.Room, userID string) string {
+	factor := s.config.Media.JoinTrackProjection
+	maxTracks := rm.GetMaxTracks()
+	if factor <= 0 || maxTracks <= 0 {
+		return ""
 	}
 
-	candidate := webrtc.ICECandidateInit{
-		Candidate:     iceMsg.Candidate,
-		SDPMid:        &iceMsg.SDPMid,
-		SDPMLineIndex: func() *uint16 { v := uint16(iceMsg.SDPMLineIndex); return &v }(),
+	peers := rm.GetPeerCount()
+	if _, rejoining := rm.GetPeerByUserID(userID); !rejoining {
+		peers++
 	}
-
-	if err := p.AddICECandidate(candidate); err != nil {
-		s.logger.Debug("Failed to add ICE candidate", zap.Error(err))
+	if peers*factor > maxTracks {
+		return "projected_track_limit"
 	}
+	return ""
 }
 
-func (s *SFU) handleClientDisconnect(client *signaling.Client) {
-	if client.RoomID == "" {
-		s.removeClientRateLimiter(client.ID)
-		return
-	}
-
-	// Suspend session instead of deleting
-	if s.sessionManager != nil {
-		sessions, err := s.sessionManager.GetRoomSessions(client.RoomID)
-		if err == nil {
-			for _, sess := range sessions {
-				if sess.UserID == client.UserID {
-					s.sessionManager.SuspendSession(sess.ID)
-					appmetrics.ActiveSessions.Dec()
-					appmetrics.SuspendedSessions.Inc()
-					break
-				}
-			}
-		}
-	}
-
-	s.handleLeaveMessage(client)
-	s.removeClientRateLimiter(client.ID)
+// handleTrackPublished announces a newly accepted track, addressed by its
+// handle, to everyone in the room including the publisher.
+func (s *SFU) handleTrackPublished(rm *room.Room, p *peer.Peer, mt *room.MediaTrack) {
+	s.broadcastTrackEvent(rm, signaling.MessageTypeTrackPublished, mt.Summary())
 }
 
-func (s *SFU) handleICERestartRequest(client *signaling.Client) {
-	_, p := s.getRoomAndPeer(client.RoomID, client.UserID)
-	if p == nil {
-		client.SendError(404, "Peer not found")
-		return
-	}
-
-	offer, err := p.RequestICERestart()
-	if err != nil {
-		s.logger.Error("ICE restart failed", zap.Error(err))
-		client.SendError(500, "ICE restart failed")
-		return
-	}
-
-	appmetrics.RecordICERestart()
-
-	data, err := json.Marshal(map[string]interface{}{
-		"sdp":    offer.SDP,
-		"type":   "offer",
-		"peerId": p.ID,
-	})
-	if err != nil {
-		return
-	}
-
-	client.SendMessage(signaling.Message{
-		Type: signaling.MessageTypeICERestartOffer, Data: data, Timestamp: time.Now(),
-	})
+func (s *SFU) handleTrackUnpublished(rm *room.Room, p *peer.Peer, mt *room.MediaTrack) {
+	s.dropSubscriptions(rm, mt)
+	s.broadcastTrackEvent(rm, signaling.MessageTypeTrackRemoved, mt.Summary())
 }
 
-func (s *SFU) handleLayerSwitchMessage(client *signaling.Client, message signaling.Message) {
-	var msg struct {
-		TrackID   string `json:"trackId"`
-		TargetRID string `json:"targetRid"`
-	}
-	if err := unmarshalMessageData(message.Data, &msg); err != nil {
-		client.SendError(400, "Invalid layer-switch message")
-		return
-	}
-
-	rm, p := s.getRoomAndPeer(client.RoomID, client.UserID)
-	if rm == nil || p == nil {
-		client.SendError(404, "Room or peer not found")
-		return
-	}
-
-	if err := rm.SwitchLayer(msg.TrackID, p.ID, msg.TargetRID); err != nil {
-		client.SendError(400, err.Error())
-	}
+// handleTrackPaused tells the room a track stopped or resumed because its
+// publisher's connection dropped or recovered within the disconnect grace.
+func (s *SFU) handleTrackPaused(rm *room.Room, p *peer.Peer, mt *room.MediaTrack, paused bool) {
+	msgType := signaling.MessageTypeTrackResumed
+	reason := ""
+	if paused {
+		msgType = signaling.MessageTypeTrackPaused
+		reason = "publisher_disconnected"
+	}
+	s.broadcastTrackEvent(rm, msgType, signaling.TrackPausedMessage{
+		TrackID: mt.Handle,
+		PeerID:  p.ID,
+		Reason:  reason,
+	})
 }
 
-// handleIsAllowRenegotiationMessage checks if client-initiated renegotiation is allowed
-// This prevents "glare" where both sides try to renegotiate simultaneously
-func (s *SFU) handleIsAllowRenegotiationMessage(client *signaling.Client) {
-	_, p := s.getRoomAndPeer(client.RoomID, client.UserID)
-	if p == nil {
-		client.SendError(404, "Peer not found")
-		return
-	}
-
-	allowed := p.IsAllowNegotiation()
-
-	data, err := json.Marshal(map[string]interface{}{
-		"allowed": allowed,
-	})
+func (s *SFU) broadcastTrackEvent(rm *room.Room, msgType signaling.MessageType, payload interface{}) {
+	data, err := json.Marshal(payload)
 	if err != nil {
-		client.SendError(500, "Internal server error")
+		s.logger.Error("Failed to marshal track event", zap.Error(err))
 		return
 	}
 
-	client.SendMessage(signaling.Message{
-		Type: signaling.MessageTypeAllowRenegotiation, Data: data, Timestamp: time.Now(),
-	})
-
-	s.logger.Debug("IsAllowRenegotiation check",
-		zap.String("peerID", p.ID),
-		zap.Bool("allowed", allowed),
-	)
+	msg := signaling.Message{Type: msgType, Data: data, Timestamp: time.Now()}
+	s.broadcastToRoom(rm, msg, nil)
 }
 
-// handleSetBandwidthLimitMessage sets the receiving bandwidth limit for a peer
-func (s *SFU) handleSetBandwidthLimitMessage(client *signaling.Client, message signaling.Message) {
-	var msg struct {
-		Bandwidth uint32 `json:"bandwidth"` // bits per second
-	}
-	if err := unmarshalMessageData(message.Data, &msg); err != nil {
-		client.SendError(400, "Invalid bandwidth limit message")
-		return
-	}
-
-	_, p := s.getRoomAndPeer(client.RoomID, client.UserID)
-	if p == nil {
-		client.SendError(404, "Peer not found")
-		return
-	}
-
-	p.SetBandwidthLimit(msg.Bandwidth)
+func (s *SFU) handleTrackRejected(rm *room.Room, p *peer.Peer, trackID, reason string) {
+	appmetrics.RecordAdmissionRejection("track", reason)
 
-	// Acknowledge the bandwidth limit
-	data, err := json.Marshal(map[string]interface{}{
-		"success":   true,
-		"bandwidth": msg.Bandwidth,
+	data, err := json.Marshal(signaling.TrackRejectedMessage{
+		TrackID: trackID,
+		PeerID:  p.ID,
+		Reason:  reason,
 	})
 	if err != nil {
 		return
 	}
 
-	client.SendMessage(signaling.Message{
-		Type: signaling.MessageTypeSetBandwidthLimit, Data: data, Timestamp: time.Now(),
+	s.sendToPeerClient(p, signaling.Message{
+		Type: signaling.MessageTypeTrackRejected, Data: data, Timestamp: time.Now(),
 	})
 }
 
-func (s *SFU) handleDominantSpeakerChanged(roomID, oldPeerID, newPeerID string) {
-	data, err := json.Marshal(map[string]interface{}{
-		"oldPeerId": oldPeerID,
-		"newPeerId": newPeerID,
-	})
-	if err != nil {
-		return
-	}
-
-	msg := signaling.Message{
-		Type: signaling.MessageTypeDominantSpeaker, Data: data, Timestamp: time.Now(),
-	}
-
-	roomClients := s.signalingHub.GetClientsByRoom(roomID)
-	for _, client := range roomClients {
-		client.SendMessage(msg)
-	}
-}
-
-func (s *SFU) handleQualityStats(peerID string, quality *room.PeerQuality) {
-	data, err := json.Marshal(map[string]interface{}{
-		"peerId":     peerID,
-		"level":      quality.Level,
-		"packetLoss": quality.PacketLoss,
-	})
-	if err != nil {
-		return
-	}
-
-	msg := signaling.Message{
-		Type: signaling.MessageTypeQualityStats, Data: data, Timestamp: time.Now(),
-	}
-
-	// Send stats to the peer themselves
-	s.roomsMu.RLock()
-	for _, rm := range s.rooms {
-		if p, ok := rm.GetPeer(peerID); ok {
-			roomClients := s.signalingHub.GetClientsByRoom(p.RoomID)
-			for _, client := range roomClients {
-				client.SendMessage(msg)
-			}
-			break
+// sendToPeerClient delivers a message to the signaling client that owns p.
+func (s *SFU) sendToPeerClient(p *peer.Peer, msg signaling.Message) {
+	for _, client := range s.signalingHub.GetClientsByRoom(p.RoomID) {
+		if client.UserID == p.UserID {
+			client.SendMessage(msg)
+			return
 		}
 	}
-	s.roomsMu.RUnlock()
-}
-
-// --- Room management ---
-
-func (s *SFU) getOrCreateRoom(roomID string) *room.Room {
-	s.roomsMu.Lock()
-	defer s.roomsMu.Unlock()
-
-	if r, exists := s.rooms[roomID]; exists {
-		return r
-	}
-	if len(s.rooms) >= s.config.Server.MaxRooms {
-		return nil
-	}
-
-	r := room.NewRoom(roomID, s.config.Server.MaxPeersPerRoom, s.logger)
-	if s.config.Media.RenegotiationDelay > 0 {
-		r.SetRenegotiationDelay(s.config.Media.RenegotiationDelay)
-	}
-	if s.config.Media.MaxRTPErrors > 0 {
-		r.SetMaxRTPErrors(s.config.Media.MaxRTPErrors)
-	}
-
-	r.OnRenegotiateNeeded = s.handleRenegotiationNeeded
-	r.OnPeerLeft = s.handlePeerLeft
-	r.OnDominantSpeakerChanged = s.handleDominantSpeakerChanged
-	r.OnQualityStats = s.handleQualityStats
-
-	r.SetSimulcastEnabled(s.config.Media.SimulcastEnabled)
-	if s.config.Media.SpeakerDetectionInterval > 0 {
-		r.SetSpeakerDetectionInterval(s.config.Media.SpeakerDetectionInterval)
-	}
-	if s.config.Media.StatsInterval > 0 {
-		r.SetStatsInterval(s.config.Media.StatsInterval)
-	}
-
-	r.StartDominantSpeakerDetection()
-	r.StartStatsCollection()
-
-	s.rooms[roomID] = r
-	return r
 }
 
 func (s *SFU) getRoomAndPeer(roomID, userID string) (*room.Room, *peer.Peer) {
@@ -928,50 +958,92 @@ func (s *SFU) getRoomAndPeer(roomID, userID string) (*room.Room, *peer.Peer) {
 	return r, p
 }
 
+// updateMetrics recomputes the room and peer gauges from the room map. It
+// takes each room's lock, so it must not be called from room callbacks
+// directly.
 func (s *SFU) updateMetrics() {
 	s.roomsMu.RLock()
 	activeRooms := len(s.rooms)
 	activePeers := 0
-	for _, rm := range s.rooms {
-		activePeers += rm.GetPeerCount()
+	for id, rm := range s.rooms {
+		n := rm.GetPeerCount() + rm.GetObserverCount()
+		activePeers += n
+		// Set under roomsMu so a concurrent removal can't resurrect the series.
+		if s.config.Metrics.RoomPeers {
+			appmetrics.SetRoomPeers(id, n)
+		}
 	}
+	remaining := s.roomsRemaining()
 	s.roomsMu.RUnlock()
 
 	s.metrics.ActiveRooms.Set(float64(activeRooms))
+	appmetrics.RoomsRemaining.Set(float64(remaining))
 	s.metrics.ActivePeers.Set(float64(activePeers))
 }
 
+// roomsRemoved refreshes the gauges after rooms were dropped from s.rooms.
+func (s *SFU) roomsRemoved(roomIDs ...string) {
+	for _, id := range roomIDs {
+		s.dropP2P(id)
+	}
+	if s.config.Metrics.RoomPeers {
+		for _, id := range roomIDs {
+			appmetrics.DeleteRoomPeers(id)
+		}
+	}
+	s.updateMetrics()
+}
+
 // --- Peer event broadcasting ---
 
 func (s *SFU) handlePeerLeft(rm *room.Room, leftPeer *peer.Peer) {
-	s.broadcastPeerEvent(leftPeer.RoomID, leftPeer, signaling.MessageTypePeerLeft, "")
-	s.updateMetrics()
+	if announcesPeer(rm, leftPeer) {
+		s.broadcastPeerEvent(rm, leftPeer, signaling.MessageTypePeerLeft)
+	}
+	s.disarmPushToTalk(leftPeer.ID)
+	s.dropNegotiations(leftPeer.ID)
+	s.subscriptionMgr.RemovePeer(leftPeer.ID)
+	// Every removal (leave, disconnect, forced reconnect) ends up here. The
+	// callback fires under the room lock, so gauges and the summary are
+	// refreshed once it is released.
+	go s.updateMetrics()
+	go s.publishRoomSummary(s.ctx, leftPeer.RoomID, rm)
+	go s.updateP2P(rm)
 }
 
-func (s *SFU) broadcastPeerEvent(roomID string, p *peer.Peer, msgType signaling.MessageType, excludeClientID string) {
-	roomClients := s.signalingHub.GetClientsByRoom(roomID)
-
-	data, err := json.Marshal(map[string]interface{}{
-		"peerId": p.ID,
-		"userId": p.UserID,
-		"name":   p.Name,
-		"roomId": roomID,
-	})
+// broadcastPeerEvent announces p to the rest of the room, its own user's
+// connections excepted.
+func (s *SFU) broadcastPeerEvent(rm *room.Room, p *peer.Peer, msgType signaling.MessageType) {
+	info := signaling.PeerInfo{
+		PeerID:   p.ID,
+		UserID:   p.UserID,
+		Name:     p.GetName(),
+		RoomID:   rm.ID,
+		MicMuted: p.MicMuted(),
+		Role:     peerRole(p),
+	}
+	if msgType == signaling.MessageTypePeerLeft {
+		info.Reason = p.LeaveReason()
+	}
+	if msgType == signaling.MessageTypePeerJoined {
+		info.Reconnect = p.Reconnected
+	}
+	data, err := json.Marshal(info)
 	if err != nil {
 		s.logger.Error("Failed to marshal peer event", zap.Error(err))
 		return
 	}
 
 	msg := signaling.Message{Type: msgType, Data: data, Timestamp: time.Now()}
-
-	for _, client := range roomClients {
-		if client.ID != excludeClientID && client.UserID != p.UserID {
-			client.SendMessage(msg)
-		}
-	}
+	s.broadcastToRoom(rm, msg, func(client *signaling.Client) bool {
+		return client.UserID != p.UserID
+	})
 }
 
 func (s *SFU) handleServerICECandidate(p *peer.Peer, candidate *webrtc.ICECandidate) {
+	if p.TrickleDisabled() {
+		return // candidates go out inside the SDP
+	}
 	candidateInit := candidate.ToJSON()
 
 	sdpMid := ""
@@ -983,11 +1055,11 @@ func (s *SFU) handleServerICECandidate(p *peer.Peer, candidate *webrtc.ICECandid
 		sdpMLineIndex = int(*candidateInit.SDPMLineIndex)
 	}
 
-	data, err := json.Marshal(map[string]interface{}{
-		"candidate":     candidateInit.Candidate,
-		"sdpMid":        sdpMid,
-		"sdpMLineIndex": sdpMLineIndex,
-		"peerId":        p.ID,
+	data, err := json.Marshal(signaling.ICECandidateMessage{
+		Candidate:     candidateInit.Candidate,
+		SDPMid:        sdpMid,
+		SDPMLineIndex: sdpMLineIndex,
+		PeerID:        p.ID,
 	})
 	if err != nil {
 		return
@@ -1007,21 +1079,25 @@ func (s *SFU) handleServerICECandidate(p *peer.Peer, candidate *webrtc.ICECandid
 func (s *SFU) handleRenegotiationNeeded(targetPeer *peer.Peer, reason string) {
 	roomClients := s.signalingHub.GetClientsByRoom(targetPeer.RoomID)
 
-	// Count how many tracks the server has added to this peer so the client
-	// can ensure enough recvonly transceivers before creating an offer.
-	trackCount := 0
-	if targetPeer.Connection != nil {
-		for _, sender := range targetPeer.Connection.GetSenders() {
-			if sender.Track() != nil {
-				trackCount++
-			}
-		}
-	}
-
-	data, err := json.Marshal(map[string]interface{}{
-		"reason":     reason,
-		"peerId":     targetPeer.ID,
-		"trackCount": trackCount,
+	// Tell the client what it will receive so it can ensure enough recvonly
+	// transceivers of each kind before creating an offer.
+	var hint room.NegotiationHint
+	s.roomsMu.RLock()
+	rm := s.rooms[targetPeer.RoomID]
+	s.roomsMu.RUnlock()
+	if rm != nil {
+		hint = rm.NegotiationHint(targetPeer)
+	}
+
+	negotiationID := s.beginNegotiation(targetPeer, reason)
+	data, err := json.Marshal(signaling.RenegotiateMessage{
+		Reason:        reason,
+		PeerID:        targetPeer.ID,
+		TrackCount:    hint.TrackCount,
+		AudioCount:    hint.AudioCount,
+		VideoCount:    hint.VideoCount,
+		NewTracks:     hint.NewTracks,
+		NegotiationID: negotiationID,
 	})
 	if err != nil {
 		return
@@ -1035,6 +1111,12 @@ func (s *SFU) handleRenegotiationNeeded(targetPeer *peer.Peer, reason string) {
 			break
 		}
 	}
+	s.logger.Debug("Renegotiation requested",
+		zap.String("peerID", targetPeer.ID),
+		zap.String("negotiationID", negotiationID),
+		zap.String("reason", reason),
+		zap.Int("trackCount", hint.TrackCount),
+	)
 }
 
 // --- REST API ---
@@ -1042,83 +1124,254 @@ func (s *SFU) handleRenegotiationNeeded(targetPeer *peer.Peer, reason string) {
 func (s *SFU) handleRoomsAPI(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		s.listRooms(w)
+		s.listRooms(w, r)
 	case http.MethodPost:
 		s.createRoom(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
 	}
 }
 
 func (s *SFU) handleRoomAPI(w http.ResponseWriter, r *http.Request) {
 	roomID := r.URL.Path[len("/api/rooms/"):]
+	if parts := strings.SplitN(roomID, "/", 3); len(parts) > 1 {
+		if parts[1] == "peers" && len(parts) == 2 {
+			s.requireAdminKey(func(w http.ResponseWriter, r *http.Request) {
+				s.handleRoomPeersAPI(w, r, parts[0])
+			})(w, r)
+			return
+		}
+		if parts[1] == "peers" && parts[2] != "" {
+			peerID, action, ok := strings.Cut(parts[2], "/")
+			s.requireAdminKey(func(w http.ResponseWriter, r *http.Request) {
+				if ok {
+					s.handleRoomPeerActionAPI(w, r, parts[0], peerID, action)
+				} else {
+					s.handleRoomPeerAPI(w, r, parts[0], peerID)
+				}
+			})(w, r)
+			return
+		}
+		if handler, ok := s.roomAdminRoutes()[parts[1]]; ok && len(parts) == 2 {
+			s.requireAdminKey(func(w http.ResponseWriter, r *http.Request) {
+				handler(w, r, parts[0])
+			})(w, r)
+			return
+		}
+		if parts[1] != "invites" {
+			writeAPIError(w, http.StatusNotFound, "Not found")
+			return
+		}
+		token := ""
+		if len(parts) == 3 {
+			token = parts[2]
+		}
+		s.requireAdminKey(func(w http.ResponseWriter, r *http.Request) {
+			s.handleInvitesAPI(w, r, parts[0], token)
+		})(w, r)
+		return
+	}
 	switch r.Method {
 	case http.MethodGet:
-		s.getRoomInfo(w, roomID)
+		s.getRoomInfo(w, r, roomID)
+	case http.MethodPatch:
+		s.requireAdminKey(func(w http.ResponseWriter, r *http.Request) {
+			s.patchRoom(w, r, roomID)
+		})(w, r)
 	case http.MethodDelete:
-		s.deleteRoom(w, roomID)
+		s.requireAdminKey(func(w http.ResponseWriter, r *http.Request) {
+			s.deleteRoom(w, r, roomID)
+		})(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPatch, http.MethodDelete)
+	}
+}
+
+// roomAdminRoutes are the /api/rooms/{id}/... routes that moderate the
+// room, all behind the admin key.
+func (s *SFU) roomAdminRoutes() map[string]func(http.ResponseWriter, *http.Request, string) {
+	return map[string]func(http.ResponseWriter, *http.Request, string){
+		"priorities": s.handleRoomPrioritiesAPI,
+		"settings":   s.handleRoomSettingsAPI,
+		"host":       s.handleRoomHostAPI,
+		"mute-all":   s.handleRoomMuteAllAPI,
+		"spotlight":  s.handleRoomSpotlightAPI,
+		"time-limit": s.handleRoomTimeLimitAPI,
+		"capture":    s.handleRoomCaptureAPI,
+		"live":       s.handleRoomLiveAPI,
+		"messages":   s.handleRoomMessagesAPI,
 	}
 }
 
-func (s *SFU) listRooms(w http.ResponseWriter) {
+// listRooms serves GET /api/rooms, a page of the instance's rooms (see
+// listing.go).
+func (s *SFU) listRooms(w http.ResponseWriter, r *http.Request) {
+	lq, err := parseListQuery(r.URL.Query(), true, "createdAt", "peerCount")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries := make([]listEntry, 0)
+	for _, rm := range s.roomSnapshot() {
+		stats := s.visibleRoomStats(r, rm)
+		entries = append(entries, roomListEntry(stats, stats))
+	}
+	writeListPage(w, "rooms", lq.page(entries), nil)
+}
+
+// visibleRoomStats returns rm's stats for an open endpoint, without the
+// observer count unless r carries the admin key: hidden observers are only
+// for admins to see.
+func (s *SFU) visibleRoomStats(r *http.Request, rm *room.Room) room.RoomStats {
+	stats := rm.GetStats()
+	if !s.hasAdminKey(r) {
+		stats.ObserverCount = nil
+	}
+	return stats
+}
+
+// roomSnapshot copies out the instance's rooms.
+func (s *SFU) roomSnapshot() []*room.Room {
 	s.roomsMu.RLock()
-	rooms := make([]map[string]interface{}, 0, len(s.rooms))
+	defer s.roomsMu.RUnlock()
+	rooms := make([]*room.Room, 0, len(s.rooms))
 	for _, rm := range s.rooms {
-		rooms = append(rooms, rm.GetStats())
+		rooms = append(rooms, rm)
 	}
-	s.roomsMu.RUnlock()
+	return rooms
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"rooms": rooms, "total": len(rooms)})
+// roomListEntry makes a listing entry writing value, filtered and sorted by
+// the room's stats.
+func roomListEntry(value interface{}, stats room.RoomStats) listEntry {
+	return listEntry{
+		id:        stats.ID,
+		name:      stats.Name,
+		state:     string(stats.State),
+		peers:     stats.PeerCount,
+		createdAt: stats.CreatedAt,
+		value:     value,
+	}
 }
 
+// createRoom serves POST /api/rooms. With an id it is idempotent: creating
+// an existing room again with the same options returns it, and with
+// different options fails with 409.
 func (s *SFU) createRoom(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Name     string `json:"name"`
-		MaxPeers int    `json:"maxPeers,omitempty"`
+	if !s.allowRoomCreation(w, r) {
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req createRoomRequest
+	if !s.decodeJSONBody(w, r, &req) {
 		return
 	}
-
-	maxPeers := req.MaxPeers
-	if maxPeers == 0 {
-		maxPeers = s.config.Server.MaxPeersPerRoom
+	if req.ID != "" {
+		if err := s.validateID(req.ID, s.config.Media.MaxRoomIDLength, "id"); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.HostUserID != "" {
+		if err := s.validateID(req.HostUserID, s.config.Media.MaxUserIDLength, "hostUserId"); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	opts, err := req.options(s)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Invalid room settings")
+		return
+	}
+	if target := s.routeRoom(r.Context(), req.ID, req.PreferredRegion); target != nil {
+		writeRedirect(w, target)
+		return
+	}
+	release := func() {}
+	if req.ID != "" && s.lookupRoom(req.ID) == nil {
+		var redirect *roomRedirectError
+		var elsewhere *roomElsewhereError
+		release, err = s.claimRoomCreation(r.Context(), req.ID)
+		if errors.As(err, &redirect) {
+			writeRedirect(w, redirect.target)
+			return
+		}
+		if errors.As(err, &elsewhere) {
+			s.writeRoomElsewhere(w, elsewhere)
+			return
+		}
 	}
-
-	rm := room.NewRoom(req.Name, maxPeers, s.logger)
-	rm.OnRenegotiateNeeded = s.handleRenegotiationNeeded
-	rm.OnPeerLeft = s.handlePeerLeft
-	rm.OnDominantSpeakerChanged = s.handleDominantSpeakerChanged
-	rm.OnQualityStats = s.handleQualityStats
-	rm.StartDominantSpeakerDetection()
-	rm.StartStatsCollection()
 
 	s.roomsMu.Lock()
+	if existing, ok := s.rooms[req.ID]; ok && req.ID != "" {
+		s.roomsMu.Unlock()
+		if !opts.matches(existing) {
+			writeAPIError(w, http.StatusConflict, "Room already exists with different options")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(existing.GetStats())
+		return
+	}
+	if s.draining() != nil {
+		s.roomsMu.Unlock()
+		release()
+		s.auditRequest(r, auditRoomCreate, req.ID, audit.ResultFailure, map[string]string{"reason": signaling.ErrorReasonDraining})
+		s.writeDrainingError(w)
+		return
+	}
+	if s.roomsRemaining() == 0 {
+		s.roomsMu.Unlock()
+		release()
+		s.auditRequest(r, auditRoomCreate, req.ID, audit.ResultFailure, map[string]string{"reason": signaling.ErrorReasonCapacityExceeded})
+		s.writeCapacityError(w, r, req.ID)
+		return
+	}
+	rm := s.newConfiguredRoom(req.ID, opts)
 	s.rooms[rm.ID] = rm
 	s.roomsMu.Unlock()
 
+	s.updateMetrics()
+	s.publishRoomSummary(r.Context(), rm.ID, rm)
+	s.saveRoomSnapshot(r.Context(), rm)
+	s.auditRequest(r, auditRoomCreate, rm.ID, audit.ResultSuccess, map[string]string{"name": opts.Name})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(rm.GetStats())
 }
 
-func (s *SFU) getRoomInfo(w http.ResponseWriter, roomID string) {
+// roomDetail is the body of GET /api/rooms/{id}.
+type roomDetail struct {
+	room.RoomStats
+	Tracks          []room.TrackSummary `json:"tracks"`
+	Settings        room.RoomSettings   `json:"settings"`
+	TalkTimeSeconds map[string]float64  `json:"talkTimeSeconds"`
+	StalledTracks   []stalledTrackInfo  `json:"stalledTracks"`
+}
+
+// getRoomInfo serves GET /api/rooms/{id}. It is open, so how many hidden
+// observers the room has is only shown with the admin key.
+func (s *SFU) getRoomInfo(w http.ResponseWriter, r *http.Request, roomID string) {
 	s.roomsMu.RLock()
 	rm, exists := s.rooms[roomID]
 	s.roomsMu.RUnlock()
 
 	if !exists {
-		http.Error(w, "Room not found", http.StatusNotFound)
+		writeAPIError(w, http.StatusNotFound, "Room not found")
 		return
 	}
+	detail := roomDetail{
+		RoomStats:       s.visibleRoomStats(r, rm),
+		Tracks:          rm.GetTrackList(),
+		Settings:        rm.GetSettings(),
+		TalkTimeSeconds: talkTimeSeconds(rm.TalkTimes()),
+		StalledTracks:   stalledTracks(rm),
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(rm.GetStats())
+	json.NewEncoder(w).Encode(detail)
 }
 
-func (s *SFU) deleteRoom(w http.ResponseWriter, roomID string) {
+func (s *SFU) deleteRoom(w http.ResponseWriter, r *http.Request, roomID string) {
 	s.roomsMu.Lock()
 	rm, exists := s.rooms[roomID]
 	if exists {
@@ -1127,13 +1380,57 @@ func (s *SFU) deleteRoom(w http.ResponseWriter, roomID string) {
 	s.roomsMu.Unlock()
 
 	if !exists {
-		http.Error(w, "Room not found", http.StatusNotFound)
+		s.auditRequest(r, auditRoomDelete, roomID, audit.ResultFailure, map[string]string{"reason": "not_found"})
+		writeAPIError(w, http.StatusNotFound, "Room not found")
 		return
 	}
-	rm.Close()
+	reason := signaling.RoomClosedDeleted
+	if r.URL.Query().Get("reason") == signaling.RoomClosedHostEnded {
+		reason = signaling.RoomClosedHostEnded
+	}
+	s.closeRoom(r.Context(), roomID, rm, reason)
+	s.joinQueue.DrainRoom(roomID)
+	s.removeRoomSummary(r.Context(), roomID)
+	s.roomsRemoved(roomID)
+	s.auditRequest(r, auditRoomDelete, roomID, audit.ResultSuccess, map[string]string{"reason": reason})
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// healthResponse is the body of the health probe. Redis, PubSub and
+// ICEServers are "disabled" (or a Redis error) when not an object.
+type healthResponse struct {
+	Status            string              `json:"status"` // healthy or degraded
+	SchemaVersion     int                 `json:"schemaVersion"`
+	Timestamp         time.Time           `json:"timestamp"`
+	Version           string              `json:"version"`
+	Commit            string              `json:"commit"`
+	BuildDate         string              `json:"buildDate"`
+	ConfigFingerprint string              `json:"configFingerprint"`
+	InstanceID        string              `json:"instanceId"`
+	Region            string              `json:"region"`
+	Redis             interface{}         `json:"redis"`
+	PubSub            interface{}         `json:"pubsub"`
+	Rooms             int                 `json:"rooms"`
+	Peers             int                 `json:"peers"`
+	Tracks            int                 `json:"tracks"`
+	JoinQueue         int                 `json:"joinQueue"`
+	ICEServers        interface{}         `json:"iceServers"`
+	PacketMarking     netmark.Status      `json:"packetMarking"`
+	RoomLimit         healthRoomLimit     `json:"roomLimit"`
+	TrackLimits       healthTrackLimits   `json:"trackLimits"`
+	Drain             drainStatusResponse `json:"drain"`
+}
+
+type healthRoomLimit struct {
+	Max       int `json:"max"`
+	Remaining int `json:"remaining"`
+}
+
+type healthTrackLimits struct {
+	PerRoom     int `json:"perRoom"`
+	PerInstance int `json:"perInstance"`
+}
+
 func (s *SFU) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -1141,37 +1438,54 @@ func (s *SFU) handleHealth(w http.ResponseWriter, r *http.Request) {
 	s.roomsMu.RLock()
 	roomCount := len(s.rooms)
 	peerCount := 0
+	trackCount := 0
 	for _, rm := range s.rooms {
 		peerCount += len(rm.GetAllPeers())
+		trackCount += rm.GetTrackCount()
 	}
+	roomsRemaining := s.roomsRemaining()
 	s.roomsMu.RUnlock()
 
 	// Check Redis health
-	redisStatus := "connected"
-	if s.stateManager == nil {
-		redisStatus = "disabled"
-	} else if err := s.stateManager.Ping(); err != nil {
-		redisStatus = "error: " + err.Error()
-	}
+	redisStatus, redisDegraded := s.redisHealth(r.Context())
 
-	// Get instance ID
+	// Get instance ID and cross-instance subscription health
 	instanceID := ""
-	if s.pubsubManager != nil {
-		instanceID = s.pubsubManager.GetInstanceID()
+	var pubsubHealth interface{} = "disabled"
+	if s.pubsubManager.Load() != nil {
+		instanceID = s.pubsubManager.Load().GetInstanceID()
+		pubsubHealth = s.pubsubManager.Load().Health()
 	}
 
 	status := "healthy"
-	if redisStatus != "connected" && redisStatus != "disabled" {
+	if redisDegraded {
 		status = "degraded"
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":     status,
-		"timestamp":  time.Now(),
-		"instanceId": instanceID,
-		"redis":      redisStatus,
-		"rooms":      roomCount,
-		"peers":      peerCount,
+	json.NewEncoder(w).Encode(healthResponse{
+		Status:            status,
+		SchemaVersion:     signaling.SchemaVersion,
+		Timestamp:         time.Now(),
+		Version:           version.Version,
+		Commit:            version.Commit,
+		BuildDate:         version.BuildDate,
+		ConfigFingerprint: s.configFingerprint,
+		InstanceID:        instanceID,
+		Region:            s.config.Server.Region,
+		Redis:             redisStatus,
+		PubSub:            pubsubHealth,
+		Rooms:             roomCount,
+		Peers:             peerCount,
+		Tracks:            trackCount,
+		JoinQueue:         s.joinQueue.Depth(),
+		ICEServers:        s.iceServerHealth(),
+		PacketMarking:     s.packetMarkingStatus(),
+		RoomLimit:         healthRoomLimit{Max: s.config.Server.MaxRooms, Remaining: roomsRemaining},
+		TrackLimits: healthTrackLimits{
+			PerRoom:     s.config.Media.MaxTracksPerRoom,
+			PerInstance: s.config.Media.MaxTracksPerInstance,
+		},
+		Drain: s.drainStatus(),
 	})
 }
 
@@ -1193,8 +1507,18 @@ func (s *SFU) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	// Refuse before upgrading, so a flood of connections that never join
+	// costs no goroutines
+	clientID := fmt.Sprintf("client_%d", time.Now().UnixNano())
+	if !s.reserveUnjoined(clientID) {
+		appmetrics.RecordUnjoinedClosed("limit")
+		http.Error(w, "Too many connections waiting to join", http.StatusServiceUnavailable)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		s.releaseUnjoined(clientID)
 		return
 	}
 
@@ -1202,23 +1526,28 @@ func (s *SFU) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	name := r.URL.Query().Get("name")
 
 	if userID == "" {
+		s.releaseUnjoined(clientID)
 		conn.WriteMessage(websocket.CloseMessage, []byte("Missing userId"))
 		conn.Close()
 		return
 	}
 
-	client := signaling.NewClient(
-		fmt.Sprintf("client_%d", time.Now().UnixNano()),
-		userID, name, conn, s.logger,
-	)
+	client := signaling.NewClient(clientID, userID, name, conn, s.logger)
+	client.WSURL = s.publicURL(r, s.config.Server.WSPath, true)
+	client.APIURL = s.publicURL(r, "/api", false)
+	client.Token = handshakeToken(r)
+	client.RemoteIP = s.requestIP(r)
 	client.OnMessage = s.handleSignalingMessage
 	client.OnDisconnect = s.handleClientDisconnect
+	client.OnDrowsy = s.handleClientDrowsy
+	client.SetDrowsiness(s.config.Media.WSDrowsyAfter, s.config.Media.WSDrowsyGrace)
 
 	// Evict stale WS clients for same userId BEFORE registering the new one.
 	// This handles page refreshes where the old connection hasn't closed yet.
 	s.signalingHub.DisconnectClientsByUserID(userID, client.ID)
 
 	s.signalingHub.RegisterClient(client)
+	s.armJoinTimeout(client)
 
 	go client.WritePump()
 	go client.ReadPump()
@@ -0,0 +1,105 @@
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// The host spotlights a participant with spotlight (see room/spotlight.go),
+// pinning its video to the top layer for everyone; spotlight-changed tells
+// clients to switch layouts. An admin does the same with
+// /api/rooms/{id}/spotlight.
+
+// handleSpotlightChanged announces the spotlighted participant to the room
+// and saves it with the room's snapshot. It is called with the room locked.
+func (s *SFU) handleSpotlightChanged(rm *room.Room, change room.SpotlightChange) {
+	data, err := json.Marshal(signaling.SpotlightChangedMessage{
+		UserID:         change.UserID,
+		PeerID:         change.PeerID,
+		PreviousUserID: change.Previous,
+		Reason:         change.Reason,
+	})
+	if err != nil {
+		s.logger.Error("Failed to marshal spotlight change", zap.Error(err))
+		return
+	}
+	msg := signaling.Message{Type: signaling.MessageTypeSpotlightChanged, Data: data, Timestamp: time.Now()}
+	s.broadcastToRoom(rm, msg, nil)
+	go s.saveRoomSnapshot(s.ctx, rm)
+}
+
+// handleSpotlightMessage lets the host spotlight a participant or clear the
+// spotlight.
+func (s *SFU) handleSpotlightMessage(client *signaling.Client, message signaling.Message, req signaling.SpotlightMessage) {
+	rm, p := s.roomService.RoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+	if !isModerator(rm, p) {
+		s.sessionService.Audit(client, auditRoomSpotlight, req.PeerID, audit.ResultDenied, nil)
+		client.SendError(403, "Moderator role required")
+		return
+	}
+	if _, err := rm.SetSpotlight(req.PeerID); err != nil {
+		if errors.Is(err, room.ErrPeerNotFound) {
+			client.SendErrorMessage(signaling.ErrorMessage{
+				Code: 404, Message: "Peer not found", Reason: signaling.ErrorReasonPeerNotFound,
+			})
+			return
+		}
+		client.SendError(400, err.Error())
+		return
+	}
+	userID, _ := rm.Spotlight()
+	s.sessionService.Audit(client, auditRoomSpotlight, req.PeerID, audit.ResultSuccess, map[string]string{"spotlight": userID})
+}
+
+// handleRoomSpotlightAPI serves /api/rooms/{id}/spotlight: GET returns the
+// spotlighted participant and PUT spotlights one, or clears the spotlight
+// with an empty peerId.
+func (s *SFU) handleRoomSpotlightAPI(w http.ResponseWriter, r *http.Request, roomID string) {
+	rm := s.lookupRoom(roomID)
+	if rm == nil {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req signaling.SpotlightMessage
+		if !s.decodeJSONBody(w, r, &req) {
+			return
+		}
+		previous, _ := rm.Spotlight()
+		if _, err := rm.SetSpotlight(req.PeerID); err != nil {
+			s.auditRequest(r, auditRoomSpotlight, roomID, audit.ResultFailure, map[string]string{"reason": err.Error()})
+			status := http.StatusBadRequest
+			if errors.Is(err, room.ErrPeerNotFound) {
+				status = http.StatusNotFound
+			}
+			writeAPIError(w, status, err.Error())
+			return
+		}
+		userID, _ := rm.Spotlight()
+		s.auditRequest(r, auditRoomSpotlight, roomID, audit.ResultSuccess, map[string]string{
+			"spotlight": userID,
+			"previous":  previous,
+		})
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPut)
+		return
+	}
+
+	userID, peerID := rm.Spotlight()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(signaling.SpotlightChangedMessage{UserID: userID, PeerID: peerID})
+}
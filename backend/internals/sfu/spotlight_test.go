@@ -0,0 +1,74 @@
+package sfu
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+func TestSpotlight(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	host := ts.joinScripted(t, "host", "room-1")
+	alice := ts.joinScripted(t, "alice", "room-1")
+	bob := ts.joinScripted(t, "bob", "room-1")
+	rm, _ := ts.getRoomAndPeer("room-1", "host")
+	_, alicePeer := ts.getRoomAndPeer("room-1", "alice")
+	_, bobPeer := ts.getRoomAndPeer("room-1", "bob")
+
+	// Only a moderator spotlights, and only a peer in the room
+	bob.sendAs(t, "", signaling.MessageTypeSpotlight, signaling.SpotlightMessage{PeerID: bobPeer.ID})
+	expectError(t, bob, "spotlight by bob", http.StatusForbidden)
+	host.sendAs(t, "", signaling.MessageTypeSpotlight, signaling.SpotlightMessage{PeerID: "nobody"})
+	var refusal signaling.ErrorMessage
+	readPayload(t, host, signaling.MessageTypeError, &refusal)
+	if refusal.Code != http.StatusNotFound || refusal.Reason != signaling.ErrorReasonPeerNotFound {
+		t.Fatalf("spotlighting an unknown peer refused with %+v", refusal)
+	}
+
+	// Everyone is told, the spotlighted participant too
+	host.sendAs(t, "", signaling.MessageTypeSpotlight, signaling.SpotlightMessage{PeerID: alicePeer.ID})
+	want := signaling.SpotlightChangedMessage{UserID: "alice", PeerID: alicePeer.ID, Reason: "set"}
+	for _, sc := range []*scriptedClient{host, alice, bob} {
+		var changed signaling.SpotlightChangedMessage
+		readPayload(t, sc, signaling.MessageTypeSpotlightChanged, &changed)
+		if changed != want {
+			t.Fatalf("spotlight announced as %+v", changed)
+		}
+	}
+
+	// A participant joining later learns it from room-state
+	carol := ts.dialScripted(t, "carol")
+	carol.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "carol", Name: "carol"})
+	var roomState signaling.RoomStateMessage
+	readPayload(t, carol, signaling.MessageTypeRoomState, &roomState)
+	if roomState.SpotlightUserID != "alice" || roomState.SpotlightPeerID != alicePeer.ID {
+		t.Fatalf("carol's room-state spotlights %q, %q", roomState.SpotlightUserID, roomState.SpotlightPeerID)
+	}
+
+	// An admin moves it, and it is cleared when its participant leaves
+	var current signaling.SpotlightChangedMessage
+	if code := ts.api(t, http.MethodGet, "/api/rooms/room-1/spotlight", "", testAdminKey, &current); code != http.StatusOK || current.UserID != "alice" {
+		t.Fatalf("GET spotlight: %d, %+v", code, current)
+	}
+	if code := ts.api(t, http.MethodPut, "/api/rooms/room-1/spotlight", `{"peerId":"nobody"}`, testAdminKey, nil); code != http.StatusNotFound {
+		t.Fatalf("PUT an unknown peer: %d", code)
+	}
+	if code := ts.api(t, http.MethodPut, "/api/rooms/room-1/spotlight", `{"peerId":"`+bobPeer.ID+`"}`, testAdminKey, &current); code != http.StatusOK || current.UserID != "bob" {
+		t.Fatalf("PUT spotlight: %d, %+v", code, current)
+	}
+	var changed signaling.SpotlightChangedMessage
+	readPayload(t, carol, signaling.MessageTypeSpotlightChanged, &changed)
+	if changed.UserID != "bob" || changed.PreviousUserID != "alice" {
+		t.Fatalf("the move announced as %+v", changed)
+	}
+	bob.sendAs(t, "", signaling.MessageTypeLeave, struct{}{})
+	var cleared signaling.SpotlightChangedMessage
+	readPayload(t, carol, signaling.MessageTypeSpotlightChanged, &cleared)
+	if cleared != (signaling.SpotlightChangedMessage{PreviousUserID: "bob", Reason: "peer-left"}) {
+		t.Fatalf("bob leaving announced as %+v", cleared)
+	}
+	if user, _ := rm.Spotlight(); user != "" {
+		t.Fatalf("%s still spotlighted", user)
+	}
+}
@@ -0,0 +1,182 @@
+package sfu
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/version"
+)
+
+// secretEqual compares secrets in constant time.
+func secretEqual(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+// requireAdminKey guards an admin-only endpoint with Server.AdminKey, given
+// as X-API-Key or a bearer token. Without a configured key the endpoint is
+// open, like the rest of the REST API.
+func (s *SFU) requireAdminKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.hasAdminKey(r) {
+			writeAPIError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// hasAdminKey reports whether r would pass requireAdminKey, for open
+// endpoints that show admins more.
+func (s *SFU) hasAdminKey(r *http.Request) bool {
+	key := s.config.Server.AdminKey
+	if key == "" {
+		return true
+	}
+	given := r.Header.Get("X-API-Key")
+	if given == "" {
+		given = bearerToken(r)
+	}
+	return secretEqual(given, key)
+}
+
+// metricsAuth protects the metrics handler with the configured bearer token
+// and/or basic auth credentials.
+func (s *SFU) metricsAuth(next http.Handler) http.Handler {
+	auth := s.config.Metrics.Auth
+	if auth.BearerToken == "" && auth.Username == "" && auth.Password == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.BearerToken != "" && secretEqual(bearerToken(r), auth.BearerToken) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if auth.Username != "" || auth.Password != "" {
+			if user, pass, ok := r.BasicAuth(); ok &&
+				secretEqual(user, auth.Username) && secretEqual(pass, auth.Password) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// configResponse is the body of GET /api/config.
+type configResponse struct {
+	Fingerprint string        `json:"fingerprint"`
+	Config      config.Config `json:"config"`
+}
+
+// handleConfigAPI serves GET /api/config, the effective configuration after
+// environment overrides with secrets redacted, for support.
+func (s *SFU) handleConfigAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(configResponse{
+		Fingerprint: s.configFingerprint,
+		Config:      s.config.Redacted(),
+	})
+}
+
+// statsResponse is the body of GET /api/stats.
+type statsResponse struct {
+	Timestamp         time.Time                      `json:"timestamp"`
+	InstanceID        string                         `json:"instanceId"`
+	Version           string                         `json:"version"`
+	Commit            string                         `json:"commit"`
+	BuildDate         string                         `json:"buildDate"`
+	GoVersion         string                         `json:"goVersion"`
+	ConfigFingerprint string                         `json:"configFingerprint"`
+	UptimeSeconds     int64                          `json:"uptimeSeconds"`
+	Rooms             int                            `json:"rooms"`
+	Peers             int                            `json:"peers"`
+	Observers         int                            `json:"observers"`
+	Tracks            int                            `json:"tracks"`
+	Forwarded         room.ForwardingStats           `json:"forwarded"`
+	ForwardingDelay   map[string]room.DelayQuantiles `json:"forwardingDelay"`
+	Goroutines        int                            `json:"goroutines"`
+	Memory            memoryStats                    `json:"memory"`
+}
+
+type memoryStats struct {
+	HeapAllocBytes uint64 `json:"heapAllocBytes"`
+	HeapInuseBytes uint64 `json:"heapInuseBytes"`
+	SysBytes       uint64 `json:"sysBytes"`
+	NumGC          uint64 `json:"numGC"`
+}
+
+// handleStatsAPI serves GET /api/stats, a JSON snapshot of the instance for
+// deployments without Prometheus.
+func (s *SFU) handleStatsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	s.roomsMu.RLock()
+	rooms := make([]*room.Room, 0, len(s.rooms))
+	for _, rm := range s.rooms {
+		rooms = append(rooms, rm)
+	}
+	s.roomsMu.RUnlock()
+
+	peers, observers, tracks := 0, 0, 0
+	var forwarded room.ForwardingStats
+	for _, rm := range rooms {
+		peers += rm.GetPeerCount()
+		observers += rm.GetObserverCount()
+		tracks += rm.GetTrackCount()
+		fs := rm.GetForwardingStats()
+		forwarded.BytesTotal += fs.BytesTotal
+		forwarded.PacketsTotal += fs.PacketsTotal
+		forwarded.BitrateBps += fs.BitrateBps
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statsResponse{
+		Timestamp:         time.Now(),
+		InstanceID:        s.instanceID(),
+		Version:           version.Version,
+		Commit:            version.Commit,
+		BuildDate:         version.BuildDate,
+		GoVersion:         version.GoVersion(),
+		ConfigFingerprint: s.configFingerprint,
+		UptimeSeconds:     int64(time.Since(s.startedAt).Seconds()),
+		Rooms:             len(rooms),
+		Peers:             peers,
+		Observers:         observers,
+		Tracks:            tracks,
+		Forwarded:         forwarded,
+		ForwardingDelay:   s.forwardingDelays.Quantiles(),
+		Goroutines:        runtime.NumGoroutine(),
+		Memory: memoryStats{
+			HeapAllocBytes: mem.HeapAlloc,
+			HeapInuseBytes: mem.HeapInuse,
+			SysBytes:       mem.Sys,
+			NumGC:          uint64(mem.NumGC),
+		},
+	})
+}
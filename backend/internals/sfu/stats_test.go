@@ -0,0 +1,186 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"go.uber.org/zap"
+)
+
+// okHandler answers 200, standing in for a guarded handler.
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func TestRequireAdminKey(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		key     string
+		headers map[string]string
+		want    int
+	}{
+		{"no key configured", "", nil, http.StatusOK},
+		{"missing", "admin-key", nil, http.StatusUnauthorized},
+		{"api key", "admin-key", map[string]string{"X-API-Key": "admin-key"}, http.StatusOK},
+		{"bearer", "admin-key", map[string]string{"Authorization": "Bearer admin-key"}, http.StatusOK},
+		{"lower-case bearer", "admin-key", map[string]string{"Authorization": "bearer admin-key"}, http.StatusOK},
+		{"wrong api key", "admin-key", map[string]string{"X-API-Key": "admin"}, http.StatusUnauthorized},
+		{"wrong bearer", "admin-key", map[string]string{"Authorization": "Bearer admin-key2"}, http.StatusUnauthorized},
+		{"basic", "admin-key", map[string]string{"Authorization": "Basic admin-key"}, http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &SFU{config: &config.Config{Server: config.ServerConfig{AdminKey: tc.key}}}
+			r := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			s.requireAdminKey(okHandler)(w, r)
+			if w.Code != tc.want {
+				t.Fatalf("status %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestMetricsAuth(t *testing.T) {
+	bearer := config.MetricsAuthConfig{BearerToken: "token"}
+	basic := config.MetricsAuthConfig{Username: "prom", Password: "pass"}
+	both := config.MetricsAuthConfig{BearerToken: "token", Username: "prom", Password: "pass"}
+
+	for _, tc := range []struct {
+		name      string
+		auth      config.MetricsAuthConfig
+		bearer    string
+		user      string
+		pass      string
+		want      int
+		challenge bool // WWW-Authenticate sent with the 401
+	}{
+		{"open", config.MetricsAuthConfig{}, "", "", "", http.StatusOK, false},
+		{"bearer", bearer, "token", "", "", http.StatusOK, false},
+		{"bearer missing", bearer, "", "", "", http.StatusUnauthorized, false},
+		{"bearer wrong", bearer, "other", "", "", http.StatusUnauthorized, false},
+		{"bearer given basic", bearer, "", "prom", "pass", http.StatusUnauthorized, false},
+		{"basic", basic, "", "prom", "pass", http.StatusOK, false},
+		{"basic missing", basic, "", "", "", http.StatusUnauthorized, true},
+		{"basic wrong password", basic, "", "prom", "wrong", http.StatusUnauthorized, true},
+		{"basic wrong user", basic, "", "root", "pass", http.StatusUnauthorized, true},
+		{"either: bearer", both, "token", "", "", http.StatusOK, false},
+		{"either: basic", both, "", "prom", "pass", http.StatusOK, false},
+		{"either: neither", both, "other", "", "", http.StatusUnauthorized, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &SFU{config: &config.Config{Metrics: config.MetricsConfig{Auth: tc.auth}}}
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+tc.bearer)
+			}
+			if tc.user != "" {
+				r.SetBasicAuth(tc.user, tc.pass)
+			}
+			w := httptest.NewRecorder()
+			s.metricsAuth(okHandler).ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Fatalf("status %d, want %d", w.Code, tc.want)
+			}
+			if got := w.Header().Get("WWW-Authenticate") != ""; got != tc.challenge {
+				t.Fatalf("WWW-Authenticate sent: %v, want %v", got, tc.challenge)
+			}
+		})
+	}
+}
+
+func TestStatsAPI(t *testing.T) {
+	logger := zap.NewNop()
+	rooms := map[string]*room.Room{}
+	for _, name := range []string{"a", "b"} {
+		rm := room.NewRoom(name, 10, logger)
+		rooms[rm.ID] = rm
+	}
+	var peers int
+	for _, rm := range rooms {
+		for _, user := range []string{"alice", "bob"} {
+			if err := rm.AddPeer(peer.NewPeer(rm.ID, user, user, logger)); err != nil {
+				t.Fatal(err)
+			}
+			peers++
+		}
+	}
+	s := &SFU{
+		config:           &config.Config{Server: config.ServerConfig{AdminKey: "admin-key"}},
+		rooms:            rooms,
+		forwardingDelays: room.NewDelaySamples(),
+	}
+	handler := s.requireAdminKey(s.handleStatsAPI)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("without key: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/stats", nil)
+	r.Header.Set("X-API-Key", "admin-key")
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST: status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+	r.Header.Set("X-API-Key", "admin-key")
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusOK)
+	}
+	var stats statsResponse
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Rooms != len(rooms) || stats.Peers != peers {
+		t.Errorf("rooms %d, peers %d; want %d, %d", stats.Rooms, stats.Peers, len(rooms), peers)
+	}
+	if stats.Goroutines == 0 || stats.Memory.SysBytes == 0 || stats.GoVersion == "" {
+		t.Errorf("runtime stats missing: %+v", stats)
+	}
+}
+
+func TestConfigAPI(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{AdminKey: "admin-key"},
+		Redis:  config.RedisConfig{Password: "redis-password"},
+	}
+	s := &SFU{config: cfg, configFingerprint: cfg.Fingerprint()}
+	handler := s.requireAdminKey(s.handleConfigAPI)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("without key: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+	r.Header.Set("X-API-Key", "admin-key")
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "admin-key") || strings.Contains(body, "redis-password") {
+		t.Fatalf("secret in response: %s", body)
+	}
+	var got configResponse
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Fingerprint != cfg.Fingerprint() || got.Config.Redis.Password != "[redacted]" {
+		t.Fatalf("response %+v", got)
+	}
+}
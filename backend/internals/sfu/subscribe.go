@@ -0,0 +1,212 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/session"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+func subscriptionMode(p *peer.Peer) string {
+	if p.ManualSubscribe {
+		return "manual"
+	}
+	return "auto"
+}
+
+// handleSubscribeMessage starts or stops forwarding the listed tracks to the
+// sender. Peers in manual subscription mode receive nothing else; automatic
+// peers may use it to drop and re-add tracks. All changes in one message are
+// applied together and answered with one ack.
+func (s *SFU) handleSubscribeMessage(client *signaling.Client, message signaling.Message, req signaling.SubscribeMessage) {
+
+	rm, p := s.getRoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+
+	subscribe, unsubscribe := req.Subscribe, req.Unsubscribe
+	if message.Type == signaling.MessageTypeSubscribe {
+		subscribe = append(append([]string(nil), req.TrackIDs...), subscribe...)
+	} else {
+		unsubscribe = append(append([]string(nil), req.TrackIDs...), unsubscribe...)
+	}
+
+	// Preferences first, so new subscriptions start within them
+	prefsRejected := s.applyReceivePreferences(rm, p, req.Preferences)
+	res := rm.UpdateSubscriptions(p, subscribe, unsubscribe)
+
+	ack := signaling.SubscriptionAckMessage{
+		Action:       string(message.Type),
+		TrackIDs:     []string{},
+		Subscribed:   []string{},
+		Unsubscribed: []string{},
+	}
+	for _, ref := range res.Unsubscribed {
+		s.subscriptionMgr.Unsubscribe(p.ID, ref)
+		appmetrics.RecordSubscription(string(signaling.MessageTypeUnsubscribe))
+		ack.Unsubscribed = append(ack.Unsubscribed, ref)
+		ack.TrackIDs = append(ack.TrackIDs, ref)
+	}
+	for _, ref := range res.Subscribed {
+		kind := ""
+		if mt, ok := rm.ResolveTrackFor(ref, p.ID); ok {
+			kind = mt.Kind
+		}
+		s.subscriptionMgr.Subscribe(p.ID, ref, kind, "")
+		appmetrics.RecordSubscription(string(signaling.MessageTypeSubscribe))
+		ack.Subscribed = append(ack.Subscribed, ref)
+		ack.TrackIDs = append(ack.TrackIDs, ref)
+	}
+	s.recordSubscriptions(p, ack.Subscribed, ack.Unsubscribed)
+	for ref, err := range res.Rejected {
+		if ack.Rejected == nil {
+			ack.Rejected = make(map[string]string)
+		}
+		ack.Rejected[ref] = err.Error()
+		if errors.Is(err, room.ErrCodecMismatch) {
+			appmetrics.RecordAdmissionRejection("subscription", signaling.ErrorReasonCodecMismatch)
+			if ack.RejectedReasons == nil {
+				ack.RejectedReasons = make(map[string]string)
+			}
+			ack.RejectedReasons[ref] = signaling.ErrorReasonCodecMismatch
+		}
+	}
+	for ref, reason := range prefsRejected {
+		if ack.Rejected == nil {
+			ack.Rejected = make(map[string]string)
+		}
+		if _, ok := ack.Rejected[ref]; !ok {
+			ack.Rejected[ref] = reason
+		}
+	}
+
+	s.logger.Debug("Subscriptions changed",
+		zap.String("peerID", p.ID),
+		zap.String("action", ack.Action),
+		zap.Strings("subscribed", ack.Subscribed),
+		zap.Strings("unsubscribed", ack.Unsubscribed),
+		zap.Int("rejected", len(ack.Rejected)),
+	)
+
+	data, err := json.Marshal(ack)
+	if err != nil {
+		return
+	}
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypeSubscriptionAck, Data: data, Timestamp: time.Now(),
+	})
+}
+
+// handleCodecMismatch tells a peer that a track was not forwarded to it
+// because its audio codec would play back broken (see room/audiocodec.go).
+func (s *SFU) handleCodecMismatch(rm *room.Room, p *peer.Peer, mismatch *room.CodecMismatchError) {
+	appmetrics.RecordAdmissionRejection("subscription", signaling.ErrorReasonCodecMismatch)
+	s.logger.Warn("Audio track not forwarded for a codec mismatch",
+		zap.String("roomID", rm.ID),
+		zap.String("peerID", p.ID),
+		zap.String("track", mismatch.TrackID),
+		zap.Error(mismatch),
+	)
+	if client := s.peerClient(p); client != nil {
+		client.SendErrorMessage(signaling.ErrorMessage{
+			Code:    415,
+			Message: mismatch.Error(),
+			Reason:  signaling.ErrorReasonCodecMismatch,
+			TrackID: mismatch.TrackID,
+		})
+	}
+}
+
+// recordSubscriptions keeps p's session in step with its subscriptions, so
+// a resume can restore them.
+func (s *SFU) recordSubscriptions(p *peer.Peer, subscribed, unsubscribed []string) {
+	sm := s.sessionManager.Load()
+	if sm == nil {
+		return
+	}
+	sessionID := sm.UserSessionID(p.UserID, p.RoomID)
+	if sessionID == "" {
+		return
+	}
+	ctx, cancel := s.messageContext()
+	defer cancel()
+	sm.ChangeSubscriptions(ctx, sessionID, subscribed, unsubscribed)
+}
+
+// dropSubscriptions forgets every subscription to mt, which was unpublished,
+// and to its codec group once the group is gone too. Sessions in the room
+// are pruned together, so a resume never asks for a track that is gone.
+func (s *SFU) dropSubscriptions(rm *room.Room, mt *room.MediaTrack) {
+	refs := []string{mt.Handle}
+	if group := mt.GroupHandle(); group != "" && !rm.HasTrackRef(group) {
+		refs = append(refs, group)
+	}
+	for _, ref := range refs {
+		s.subscriptionMgr.RemoveTrack(ref)
+	}
+	if sm := s.sessionManager.Load(); sm != nil {
+		sm.PruneSubscriptions(s.ctx, rm.ID, refs...)
+	}
+}
+
+// restoreSubscriptions subscribes a resumed manual-subscribe peer to the
+// tracks its session recorded and returns them. Tracks that went away in
+// the meantime, or are refused now, are dropped from the session without
+// telling the client. A fresh join starts with no recorded subscriptions.
+func (s *SFU) restoreSubscriptions(ctx context.Context, rm *room.Room, p *peer.Peer, sess *session.Session, resumed bool) []string {
+	stored := sess.Subscriptions()
+	if len(stored) == 0 {
+		return nil
+	}
+	sm := s.sessionManager.Load()
+	if !resumed {
+		sm.UpdateSubscriptions(ctx, sess.ID, nil)
+		return nil
+	}
+	if !p.ManualSubscribe {
+		return nil
+	}
+
+	var refs, stale []string
+	for ref := range stored {
+		if rm.HasTrackRef(ref) {
+			refs = append(refs, ref)
+		} else {
+			stale = append(stale, ref)
+		}
+	}
+	var restored []string
+	if len(refs) > 0 {
+		res := rm.UpdateSubscriptions(p, refs, nil)
+		for _, ref := range res.Subscribed {
+			kind := ""
+			if mt, ok := rm.ResolveTrackFor(ref, p.ID); ok {
+				kind = mt.Kind
+			}
+			s.subscriptionMgr.Subscribe(p.ID, ref, kind, "")
+			restored = append(restored, ref)
+		}
+		for ref := range res.Rejected {
+			stale = append(stale, ref)
+		}
+	}
+	if len(stale) > 0 {
+		sm.ChangeSubscriptions(ctx, sess.ID, nil, stale)
+	}
+
+	s.logger.Debug("Subscriptions restored",
+		zap.String("peerID", p.ID),
+		zap.Strings("restored", restored),
+		zap.Int("dropped", len(stale)),
+	)
+	return restored
+}
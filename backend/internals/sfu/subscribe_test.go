@@ -0,0 +1,412 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/webrtc/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// joinAnswerSizes returns the number of first answers sent in mode and
+// their total size in bytes.
+func joinAnswerSizes(t *testing.T, mode string) (uint64, float64) {
+	t.Helper()
+	var m dto.Metric
+	if err := appmetrics.JoinAnswerSDPBytes.WithLabelValues(mode).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+// subscriptions lists the handles of the tracks rm forwards to userID.
+func (ts *testServer) subscriptions(t *testing.T, roomID, userID string) []string {
+	t.Helper()
+	rm, p := ts.getRoomAndPeer(roomID, userID)
+	if p == nil {
+		t.Fatalf("%s is not in %s", userID, roomID)
+	}
+	var handles []string
+	for _, info := range rm.SubscriptionSnapshot(p) {
+		handles = append(handles, info.TrackID)
+	}
+	return handles
+}
+
+func TestManualSubscription(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	publish(t, alice, "alice")
+	rm := ts.lookupRoom("room-1")
+	eventually(t, "alice's tracks", func() bool { return rm.GetTrackCount() == 2 })
+	audio, _ := rm.TrackHandle("alice-opus")
+	video, _ := rm.TrackHandle("alice-vp8")
+
+	autoJoins, autoBytes := joinAnswerSizes(t, "auto")
+	manualJoins, manualBytes := joinAnswerSizes(t, "manual")
+	ts.join(t, "carol", "room-1", client.Handlers{}, client.JoinOptions{OnTrack: newTrackCounter().onTrack})
+	manual := false
+	received := newTrackCounter()
+	bob := ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{AutoSubscribe: &manual, OnTrack: received.onTrack})
+	if !bob.Info().ManualSubscribe {
+		t.Fatal("bob's join response does not report manual subscription")
+	}
+
+	// Each mode's first answer is measured, and bob's carries no tracks
+	n, size := joinAnswerSizes(t, "auto")
+	if n != autoJoins+1 {
+		t.Fatalf("%d automatic first answers measured, want 1", n-autoJoins)
+	}
+	autoSize := size - autoBytes
+	if n, size = joinAnswerSizes(t, "manual"); n != manualJoins+1 {
+		t.Fatalf("%d manual first answers measured, want 1", n-manualJoins)
+	}
+	if manualSize := size - manualBytes; manualSize >= autoSize {
+		t.Fatalf("manual first answer of %v bytes, automatic one of %v", manualSize, autoSize)
+	}
+
+	// Nothing reaches bob unasked, whether published before or after he
+	// joined
+	publish(t, ts.join(t, "dave", "room-1", client.Handlers{}, client.JoinOptions{}), "dave")
+	eventually(t, "dave's tracks", func() bool { return rm.GetTrackCount() == 4 })
+	time.Sleep(500 * time.Millisecond)
+	if got := ts.subscriptions(t, "room-1", "bob"); len(got) != 0 {
+		t.Fatalf("bob is forwarded %v before subscribing", got)
+	}
+	for _, kind := range []string{"audio", "video"} {
+		if n := received.count(alice.PeerID(), kind); n != 0 {
+			t.Fatalf("bob received %d %s packets before subscribing", n, kind)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ack, err := bob.Subscribe(ctx, audio, video, "nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ack.Subscribed) != 2 || ack.Rejected["nope"] == "" {
+		t.Fatalf("subscription-ack %+v", ack)
+	}
+	eventually(t, "bob to receive alice's tracks", func() bool { return received.receiving(alice.PeerID()) })
+	if ids := ts.subscriptionMgr.GetPeerSubscriptions(bob.PeerID()); len(ids) != 2 {
+		t.Fatalf("%d subscriptions recorded for bob", len(ids))
+	}
+	if _, p := ts.getRoomAndPeer("room-1", "dave"); received.count(p.ID, "audio") != 0 || received.count(p.ID, "video") != 0 {
+		t.Fatal("bob received dave's tracks without subscribing")
+	}
+
+	// Unsubscribing frees the transceiver
+	if ack, err = bob.Unsubscribe(ctx, video); err != nil || len(ack.Unsubscribed) != 1 {
+		t.Fatalf("unsubscribe: %+v, %v", ack, err)
+	}
+	if got := ts.subscriptions(t, "room-1", "bob"); len(got) != 1 || got[0] != audio {
+		t.Fatalf("bob is forwarded %v after unsubscribing from video", got)
+	}
+	if ids := ts.subscriptionMgr.GetPeerSubscriptions(bob.PeerID()); len(ids) != 1 {
+		t.Fatalf("%d subscriptions recorded for bob after unsubscribing", len(ids))
+	}
+
+	// The manager forgets bob when he leaves
+	bobID := bob.PeerID()
+	if err := bob.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "bob's subscriptions to go", func() bool {
+		return len(ts.subscriptionMgr.GetPeerSubscriptions(bobID)) == 0
+	})
+}
+
+func TestManualSubscriptionDuringInitialNegotiation(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	publish(t, alice, "alice")
+	rm := ts.lookupRoom("room-1")
+	eventually(t, "alice's tracks", func() bool { return rm.GetTrackCount() == 2 })
+	audio, _ := rm.TrackHandle("alice-opus")
+
+	// bob subscribes once joined, before making his first offer
+	manual := false
+	bob := ts.dialScripted(t, "bob")
+	bob.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "bob", Name: "bob", AutoSubscribe: &manual})
+	bob.readUntil(t, signaling.MessageTypeJoin)
+	bob.pipeline(t, signaling.MessageTypeSubscribe, signaling.SubscribeMessage{TrackIDs: []string{audio}})
+	messages := bob.readUntil(t, signaling.MessageTypeSubscriptionAck)
+	var ack signaling.SubscriptionAckMessage
+	if err := json.Unmarshal(messages[len(messages)-1].Data, &ack); err != nil {
+		t.Fatal(err)
+	}
+	if len(ack.Subscribed) != 1 || ack.Subscribed[0] != audio {
+		t.Fatalf("subscription-ack %+v", ack)
+	}
+	if got := ts.subscriptions(t, "room-1", "bob"); len(got) != 0 {
+		t.Fatalf("%v attached before bob's first exchange", got)
+	}
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	tracks := make(chan string, 4)
+	pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		tracks <- track.StreamID() + "/" + track.Kind().String()
+	})
+	bob.pipeline(t, signaling.MessageTypeOffer, signaling.OfferMessage{SDP: offerAudio(t, pc).SDP, Type: "offer"})
+	// The renegotiation for the queued subscription follows the answer
+	for _, m := range bob.readUntil(t, signaling.MessageTypeAnswer) {
+		if m.Type == signaling.MessageTypeRenegotiate {
+			t.Fatal("renegotiate sent ahead of bob's first answer")
+		}
+		if m.Type == signaling.MessageTypeAnswer {
+			var answer signaling.AnswerMessage
+			if err := json.Unmarshal(m.Data, &answer); err != nil {
+				t.Fatal(err)
+			}
+			if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer.SDP}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if sdp := pc.RemoteDescription().SDP; strings.Contains(sdp, alice.PeerID()) {
+		t.Fatalf("bob's first answer carries alice's track:\n%s", sdp)
+	}
+
+	// The queued subscription is attached once the exchange completes
+	requests := readRenegotiates(t, bob, time.Second)
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	bob.pipeline(t, signaling.MessageTypeOffer, signaling.OfferMessage{
+		SDP: offer.SDP, Type: "offer", NegotiationID: requests[len(requests)-1].NegotiationID,
+	})
+	readAnswer(t, bob, pc)
+	select {
+	case got := <-tracks:
+		if got != alice.PeerID()+"/audio" {
+			t.Fatalf("bob received %s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("bob did not receive alice's audio")
+	}
+	if got := ts.subscriptions(t, "room-1", "bob"); len(got) != 1 || got[0] != audio {
+		t.Fatalf("bob is forwarded %v", got)
+	}
+}
+
+// settled waits until counter has stayed put for quiet and returns it.
+func settled(counter *atomic.Int64, quiet time.Duration) int64 {
+	for {
+		n := counter.Load()
+		time.Sleep(quiet)
+		if counter.Load() == n {
+			return n
+		}
+	}
+}
+
+func TestSubscriptionBatchRenegotiatesOnce(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	for i := 0; i < 10; i++ {
+		publish(t, alice, fmt.Sprintf("alice-%d", i))
+	}
+	rm := ts.lookupRoom("room-1")
+	eventually(t, "alice's tracks", func() bool { return rm.GetTrackCount() == 20 })
+	var gallery []string
+	for i := 0; i < 10; i++ {
+		for _, kind := range []string{"opus", "vp8"} {
+			handle, _ := rm.TrackHandle(fmt.Sprintf("alice-%d-%s", i, kind))
+			gallery = append(gallery, handle)
+		}
+	}
+
+	var renegotiations atomic.Int64
+	manual := false
+	bob := ts.join(t, "bob", "room-1", client.Handlers{OnMessage: func(m signaling.Message) {
+		if m.Type == signaling.MessageTypeRenegotiate {
+			renegotiations.Add(1)
+		}
+	}}, client.JoinOptions{AutoSubscribe: &manual, OnTrack: newTrackCounter().onTrack})
+	sessionID := bob.Info().SessionID
+
+	// update applies a batch and checks it took one renegotiation, and that
+	// bob is then forwarded, and recorded as subscribed to, want
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	const quiet = time.Second
+	update := func(subscribe, unsubscribe, want []string) signaling.SubscriptionAckMessage {
+		t.Helper()
+		before := settled(&renegotiations, quiet)
+		ack, err := bob.UpdateSubscriptions(ctx, subscribe, unsubscribe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := settled(&renegotiations, quiet) - before; n != 1 {
+			t.Fatalf("%d renegotiations for a batch of %d subscribes and %d unsubscribes", n, len(subscribe), len(unsubscribe))
+		}
+		eventually(t, "the batch to be negotiated", func() bool {
+			_, p := ts.getRoomAndPeer("room-1", "bob")
+			forwarded := rm.SubscriptionSnapshot(p)
+			for _, info := range forwarded {
+				if info.Mid == "" {
+					return false
+				}
+			}
+			return len(forwarded) == len(want)
+		})
+		if got := ts.subscriptions(t, "room-1", "bob"); !sameRefs(got, want) {
+			t.Fatalf("bob is forwarded %v, want %v", got, want)
+		}
+		var recorded []string
+		for _, s := range ts.subscriptionMgr.GetPeerSubscriptions(bob.PeerID()) {
+			recorded = append(recorded, s.TrackID)
+		}
+		if !sameRefs(recorded, want) {
+			t.Fatalf("subscriptions recorded as %v, want %v", recorded, want)
+		}
+		sess, err := ts.sessionManager.Load().GetSession(ctx, sessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored := sess.Subscriptions(); len(stored) != len(want) {
+			t.Fatalf("session stores %d subscriptions, want %d", len(stored), len(want))
+		}
+		return ack
+	}
+
+	// Gallery and speaker view, back and forth
+	speaker := gallery[:2]
+	for round := 0; round < 2; round++ {
+		if ack := update(gallery, nil, gallery); len(ack.Subscribed) != len(gallery) {
+			t.Fatalf("subscription-ack %+v", ack)
+		}
+		if ack := update(nil, gallery[2:], speaker); len(ack.Unsubscribed) != len(gallery)-2 {
+			t.Fatalf("subscription-ack %+v", ack)
+		}
+		update(nil, speaker, nil)
+	}
+
+	// Additions and removals in one batch, with a track that is gone
+	// rejected on its own
+	ack := update(append([]string{"t_gone"}, gallery[10:]...), gallery[:10], gallery[10:])
+	if _, ok := ack.Rejected["t_gone"]; !ok || len(ack.Rejected) != 1 || len(ack.Subscribed) != 10 || len(ack.Unsubscribed) != 10 {
+		t.Fatalf("subscription-ack %+v", ack)
+	}
+}
+
+// sameRefs reports whether a and b hold the same track references.
+func sameRefs(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// storedSubscriptions returns the subscriptions sessionID has in Redis.
+func (ts *testServer) storedSubscriptions(t *testing.T, sessionID string) []string {
+	t.Helper()
+	stored := ts.storedSession(t, sessionID)
+	if stored == nil {
+		return nil
+	}
+	var refs []string
+	for ref := range stored.Subscriptions {
+		refs = append(refs, ref)
+	}
+	slices.Sort(refs)
+	return refs
+}
+
+func TestSubscriptionsFollowUnpublishedTracks(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.PeerDisconnectGrace = 100 * time.Millisecond
+	})
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	senders := publish(t, alice, "alice")
+	rm := ts.lookupRoom("room-1")
+	eventually(t, "alice's tracks", func() bool { return rm.GetTrackCount() == 2 })
+	audio, _ := rm.TrackHandle("alice-opus")
+	video, _ := rm.TrackHandle("alice-vp8")
+
+	// Bob's subscriptions are recorded in his session
+	manual := false
+	bob := ts.dialScripted(t, "bob")
+	bob.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "bob", Name: "bob", AutoSubscribe: &manual})
+	joined := joinResponse(t, bob.readUntil(t, signaling.MessageTypeJoin))
+	bob.pipeline(t, signaling.MessageTypeSubscribe, signaling.SubscribeMessage{Subscribe: []string{audio, video}})
+	bob.readUntil(t, signaling.MessageTypeSubscriptionAck)
+	both := []string{audio, video}
+	slices.Sort(both)
+	eventually(t, "bob's subscriptions to be stored", func() bool {
+		return slices.Equal(ts.storedSubscriptions(t, joined.SessionID), both)
+	})
+
+	// Alice's video goes, and with it every record of bob's subscription
+	for _, sender := range senders {
+		if sender.Track().ID() == "alice-vp8" {
+			if err := alice.UnpublishTrack(sender); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	eventually(t, "alice's video to be unpublished", func() bool { return rm.GetTrackCount() == 1 })
+	eventually(t, "bob's session to drop the video", func() bool {
+		return slices.Equal(ts.storedSubscriptions(t, joined.SessionID), []string{audio})
+	})
+	if ts.subscriptionMgr.IsSubscribed(joined.PeerID, video) || !ts.subscriptionMgr.IsSubscribed(joined.PeerID, audio) {
+		t.Fatalf("subscription manager holds %v for bob", ts.subscriptionMgr.GetPeerSubscriptions(joined.PeerID))
+	}
+
+	// A stale entry the session kept, as if the track went while no
+	// instance was watching, is dropped quietly on resume
+	if err := ts.sessionManager.Load().SetSubscribed(context.Background(), joined.SessionID, "t_gone", true); err != nil {
+		t.Fatal(err)
+	}
+	bob.hangUp()
+	eventually(t, "bob's peer to be removed", func() bool {
+		_, p := ts.getRoomAndPeer("room-1", "bob")
+		return p == nil && len(ts.subscriptionMgr.GetPeerSubscriptions(joined.PeerID)) == 0
+	})
+	bob = ts.dialScripted(t, "bob")
+	bob.pipeline(t, signaling.MessageTypeJoin, struct {
+		signaling.JoinMessage
+		SessionID    string `json:"sessionId"`
+		SessionToken string `json:"sessionToken"`
+	}{
+		JoinMessage:  signaling.JoinMessage{RoomID: "room-1", UserID: "bob", Name: "bob", AutoSubscribe: &manual},
+		SessionID:    joined.SessionID,
+		SessionToken: joined.SessionToken,
+	})
+	var bobSaw messageCounts
+	resumed := joinResponse(t, bob.readUntil(t, signaling.MessageTypeJoin))
+	if !resumed.Resumed || !slices.Equal(resumed.Subscriptions, []string{audio}) {
+		t.Fatalf("resumed %v with subscriptions %v, want %s", resumed.Resumed, resumed.Subscriptions, audio)
+	}
+	eventually(t, "the stale entry to be dropped", func() bool {
+		return slices.Equal(ts.storedSubscriptions(t, joined.SessionID), []string{audio})
+	})
+	if subs := ts.subscriptionMgr.GetPeerSubscriptions(resumed.PeerID); len(subs) != 1 || subs[0].TrackID != audio {
+		t.Fatalf("subscription manager holds %v for bob", subs)
+	}
+	bobSaw.drain(bob)
+	time.Sleep(200 * time.Millisecond)
+	if n := bobSaw.get(signaling.MessageTypeError, signaling.MessageTypeSubscriptionAck); n != 0 {
+		t.Fatalf("bob was sent %d errors or acks for the ghost", n)
+	}
+}
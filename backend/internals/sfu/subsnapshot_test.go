@@ -0,0 +1,178 @@
+package sfu
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/webrtc/v3"
+)
+
+// mlineTracks records what arrives on each receiver of a session, as
+// "publisher/handle".
+type mlineTracks struct {
+	mu     sync.Mutex
+	tracks map[*webrtc.RTPReceiver]string
+}
+
+// onTrack is a JoinOptions.OnTrack reading track to its end.
+func (m *mlineTracks) onTrack(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+	m.mu.Lock()
+	m.tracks[receiver] = track.StreamID() + "/" + track.ID()
+	m.mu.Unlock()
+	for {
+		if _, _, err := track.ReadRTP(); err != nil {
+			return
+		}
+	}
+}
+
+// byMid maps the mids of pc's transceivers to the track arriving on each.
+func (m *mlineTracks) byMid(pc *webrtc.PeerConnection) map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mids := make(map[string]string)
+	for _, t := range pc.GetTransceivers() {
+		if track, ok := m.tracks[t.Receiver()]; ok && t.Mid() != "" {
+			mids[t.Mid()] = track
+		}
+	}
+	return mids
+}
+
+// checkSnapshot compares a subscription snapshot with what sess receives:
+// every forwarded track is listed once, on the m-line it arrives on, and
+// the tracks of each kind come in publish order.
+func checkSnapshot(t *testing.T, what string, subs []signaling.SubscriptionInfo, received *mlineTracks, sess *client.Session, publishers ...string) {
+	t.Helper()
+	mids := received.byMid(sess.PeerConnection())
+	if len(subs) != 2*len(publishers) || len(mids) != len(subs) {
+		t.Fatalf("%s lists %d tracks; %d arrive on %v", what, len(subs), len(mids), mids)
+	}
+	order := make(map[string][]string) // kind -> publishers
+	for _, sub := range subs {
+		if got := mids[sub.Mid]; got != sub.PeerID+"/"+sub.TrackID {
+			t.Fatalf("%s puts %s/%s on mid %q, which carries %q", what, sub.PeerID, sub.TrackID, sub.Mid, got)
+		}
+		if sub.MediaType != sub.Kind {
+			t.Errorf("%s: track %s has media type %q", what, sub.TrackID, sub.MediaType)
+		}
+		order[sub.Kind] = append(order[sub.Kind], sub.PeerID)
+	}
+	for _, kind := range []string{"audio", "video"} {
+		if strings.Join(order[kind], ",") != strings.Join(publishers, ",") {
+			t.Errorf("%s lists %s from %v, want %v", what, kind, order[kind], publishers)
+		}
+	}
+}
+
+func TestSubscriptionSnapshotOnResume(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.JoinAttachWorkers = 1
+		cfg.Media.PeerDisconnectGrace = 10 * time.Second
+	})
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	publish(t, alice, "alice")
+	time.Sleep(10 * time.Millisecond) // publish order is by time
+	carol := ts.join(t, "carol", "room-1", client.Handlers{}, client.JoinOptions{})
+	publish(t, carol, "carol")
+	publishers := []string{alice.PeerID(), carol.PeerID()}
+	rm := ts.lookupRoom("room-1")
+	eventually(t, "both to publish", func() bool { return rm.GetTrackCount() == 4 })
+
+	snapshots := make(chan signaling.SubscriptionSnapshotMessage, 4)
+	states := make(chan signaling.RoomStateMessage, 4)
+	resumes := make(chan signaling.JoinResponse, 4)
+	received := &mlineTracks{tracks: make(map[*webrtc.RTPReceiver]string)}
+	url := "ws" + strings.TrimPrefix(ts.http.URL, "http") + ts.config.Server.WSPath
+	c, err := client.Connect(url, "", client.Options{
+		UserID: "bob", Name: "bob", AutoReconnect: true, ReconnectMinBackoff: 50 * time.Millisecond,
+		Handlers: client.Handlers{
+			OnSubscriptionSnapshot: func(m signaling.SubscriptionSnapshotMessage) { snapshots <- m },
+			OnRoomState:            func(m signaling.RoomStateMessage) { states <- m },
+			OnResumed:              func(info signaling.JoinResponse) { resumes <- info },
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	bob, err := c.JoinRoom(ctx, "room-1", client.JoinOptions{OnTrack: received.onTrack})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "bob to receive four tracks", func() bool { return len(received.byMid(bob.PeerConnection())) == 4 })
+
+	// A first join is not told; its room-state carries nothing forwarded yet
+	select {
+	case state := <-states:
+		if len(state.Subscriptions) != 0 {
+			t.Fatalf("first room-state lists %v", state.Subscriptions)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no room-state")
+	}
+	select {
+	case m := <-snapshots:
+		t.Fatalf("first join sent a snapshot: %+v", m)
+	default:
+	}
+
+	// Resumed on a fresh PeerConnection, bob learns what each m-line carries
+	var server *signaling.Client
+	for _, sc := range ts.signalingHub.GetClientsByRoom("room-1") {
+		if sc.PeerID() == bob.PeerID() {
+			server = sc
+		}
+	}
+	p, _ := rm.GetPeer(bob.PeerID())
+	if server == nil || p == nil {
+		t.Fatal("bob has no connection or peer")
+	}
+	old := bob.PeerConnection()
+	received.mu.Lock()
+	received.tracks = make(map[*webrtc.RTPReceiver]string)
+	received.mu.Unlock()
+	ts.requireReconnect(server, rm, p, "test")
+	var snapshot signaling.SubscriptionSnapshotMessage
+	select {
+	case snapshot = <-snapshots:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no subscription snapshot after resuming")
+	}
+	<-states
+	if info := <-resumes; info.Reattached || bob.PeerConnection() == old {
+		t.Fatal("bob resumed on his old PeerConnection")
+	}
+	eventually(t, "bob to receive four tracks again", func() bool { return len(received.byMid(bob.PeerConnection())) == 4 })
+	checkSnapshot(t, "subscription-snapshot", snapshot.Subscriptions, received, bob, publishers...)
+
+	// Reattached to the same PeerConnection, the room-state tells him again
+	pc := bob.PeerConnection()
+	for _, sc := range ts.signalingHub.GetClientsByRoom("room-1") {
+		if sc.PeerID() == bob.PeerID() {
+			sc.CloseWithCode(4000, "test")
+		}
+	}
+	select {
+	case state := <-states:
+		if info := <-resumes; !info.Reattached || bob.PeerConnection() != pc {
+			t.Fatal("bob did not reattach to his PeerConnection")
+		}
+		checkSnapshot(t, "room-state", state.Subscriptions, received, bob, publishers...)
+	case <-time.After(10 * time.Second):
+		t.Fatal("no room-state after reattaching")
+	}
+	select {
+	case m := <-snapshots:
+		t.Fatalf("reattach sent a snapshot: %+v", m)
+	default:
+	}
+}
@@ -0,0 +1,44 @@
+package sfu
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+)
+
+// talkTimeSeconds converts a room's talk time to seconds per userID.
+func talkTimeSeconds(talkTime map[string]time.Duration) map[string]float64 {
+	out := make(map[string]float64, len(talkTime))
+	for userID, d := range talkTime {
+		out[userID] = d.Seconds()
+	}
+	return out
+}
+
+// recordTalkTimeSummary emits the talk time of everyone who spoke in a room
+// that has just been closed. Detail keys are "user:<userID>" plus
+// "total", each in seconds.
+func (s *SFU) recordTalkTimeSummary(roomID string, rm *room.Room) {
+	talkTime := rm.TalkTimes()
+	if len(talkTime) == 0 {
+		return
+	}
+
+	detail := make(map[string]string, len(talkTime)+1)
+	var total time.Duration
+	for userID, d := range talkTime {
+		detail["user:"+userID] = strconv.FormatFloat(d.Seconds(), 'f', 1, 64)
+		total += d
+	}
+	detail["total"] = strconv.FormatFloat(total.Seconds(), 'f', 1, 64)
+
+	s.auditLogger.Log(audit.Event{
+		Actor:  "system",
+		Action: auditRoomTalkTime,
+		RoomID: roomID,
+		Result: audit.ResultSuccess,
+		Detail: detail,
+	})
+}
@@ -0,0 +1,214 @@
+package sfu
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/utils"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"go.uber.org/zap"
+)
+
+// testAdminKey guards the admin routes of every testServer.
+const testAdminKey = "admin-key"
+
+// testServer is an SFU serving its routes over httptest, keeping its state
+// in a miniredis.
+type testServer struct {
+	*SFU
+	http  *httptest.Server
+	redis *miniredis.Miniredis
+}
+
+// newTestServer starts an SFU on mr, or on a miniredis of its own when mr is
+// nil. configure, if set, adjusts the configuration first.
+func newTestServer(t *testing.T, mr *miniredis.Miniredis, configure func(*config.Config)) *testServer {
+	t.Helper()
+	if utils.Logger == nil {
+		utils.Logger = zap.NewNop()
+	}
+	if mr == nil {
+		mr = miniredis.RunT(t)
+	}
+	cfg := config.LoadConfig()
+	cfg.Server.AdminKey = testAdminKey
+	cfg.Redis.Addr = mr.Addr()
+	cfg.Redis.Required = true
+	if configure != nil {
+		configure(cfg)
+	}
+
+	s, err := NewSFU(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.startLoops()
+	ts := &testServer{SFU: s, http: httptest.NewServer(s.routes()), redis: mr}
+	t.Cleanup(func() {
+		s.Stop()
+		ts.http.Close()
+	})
+	return ts
+}
+
+// connect opens a signaling connection for userID.
+func (ts *testServer) connect(t *testing.T, userID string, handlers client.Handlers) *client.Client {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(ts.http.URL, "http") + ts.config.Server.WSPath
+	c, err := client.Connect(url, "", client.Options{UserID: userID, Name: userID, Handlers: handlers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// join connects userID and joins roomID.
+func (ts *testServer) join(t *testing.T, userID, roomID string, handlers client.Handlers, opts client.JoinOptions) *client.Session {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sess, err := ts.connect(t, userID, handlers).JoinRoom(ctx, roomID, opts)
+	if err != nil {
+		t.Fatalf("%s joining %s: %v", userID, roomID, err)
+	}
+	return sess
+}
+
+// api sends a REST request, with key as the X-API-Key when set, and decodes
+// the JSON response into out when it is not nil.
+func (ts *testServer) api(t *testing.T, method, path, body, key string, out interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.http.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, data)
+		}
+	}
+	return resp.StatusCode
+}
+
+// eventually fails the test unless cond holds within five seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	eventuallyWithin(t, what, 5*time.Second, cond)
+}
+
+// eventuallyWithin is eventually with a deadline of timeout.
+func eventuallyWithin(t *testing.T, what string, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// publish sends an Opus and a VP8 track from sess, writing a sample to
+// each every 20ms until the test ends.
+func publish(t *testing.T, sess *client.Session, streamID string) []*webrtc.RTPSender {
+	t.Helper()
+	var (
+		tracks  []*webrtc.TrackLocalStaticSample
+		senders []*webrtc.RTPSender
+	)
+	for _, mime := range []string{webrtc.MimeTypeOpus, webrtc.MimeTypeVP8} {
+		kind := strings.ToLower(strings.SplitN(mime, "/", 2)[1])
+		track, err := client.NewSampleTrack(mime, streamID+"-"+kind, streamID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sender, err := sess.PublishTrack(track)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tracks = append(tracks, track)
+		senders = append(senders, sender)
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, track := range tracks {
+					track.WriteSample(media.Sample{Data: []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a}, Duration: 20 * time.Millisecond})
+				}
+			}
+		}
+	}()
+	return senders
+}
+
+// trackCounter counts the RTP packets a session receives, by publisher
+// (the stream ID the SFU forwards with) and kind.
+type trackCounter struct {
+	mu      sync.Mutex
+	packets map[string]int
+}
+
+func newTrackCounter() *trackCounter {
+	return &trackCounter{packets: make(map[string]int)}
+}
+
+// onTrack is a JoinOptions.OnTrack reading track to its end.
+func (tc *trackCounter) onTrack(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+	key := track.StreamID() + "/" + track.Kind().String()
+	for {
+		if _, _, err := track.ReadRTP(); err != nil {
+			return
+		}
+		tc.mu.Lock()
+		tc.packets[key]++
+		tc.mu.Unlock()
+	}
+}
+
+// receiving reports whether packets of publisherID's audio and video have
+// arrived.
+func (tc *trackCounter) receiving(publisherID string) bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.packets[publisherID+"/audio"] > 0 && tc.packets[publisherID+"/video"] > 0
+}
@@ -0,0 +1,158 @@
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// A room created with maxDurationSec warns its participants with time-limit
+// messages as the end nears and is then closed with reason time-limit.
+// Moderators extend it with extend-time-limit, operators with PATCH
+// /api/rooms/{id}/time-limit; either way every client is told the new end.
+
+// timeLimitResponse is the body of /api/rooms/{id}/time-limit.
+type timeLimitResponse struct {
+	RoomID           string    `json:"roomId"`
+	MaxDurationSec   int       `json:"maxDurationSec"`
+	EndsAt           time.Time `json:"endsAt"`
+	TimeRemainingSec int       `json:"timeRemainingSec"`
+}
+
+// handleTimeLimitWarning tells the room's clients how long is left.
+func (s *SFU) handleTimeLimitWarning(rm *room.Room, limit room.TimeLimit) {
+	s.broadcastTimeLimit(rm, limit, signaling.TimeLimitWarning)
+}
+
+// handleTimeLimitReached closes a room whose time ran out, as long as it is
+// still the one registered under its ID.
+func (s *SFU) handleTimeLimitReached(rm *room.Room) {
+	s.roomsMu.Lock()
+	current, exists := s.rooms[rm.ID]
+	if exists && current == rm {
+		delete(s.rooms, rm.ID)
+	}
+	s.roomsMu.Unlock()
+	if current != rm {
+		return
+	}
+
+	s.closeRoom(s.ctx, rm.ID, rm, signaling.RoomClosedTimeLimit)
+	s.joinQueue.DrainRoom(rm.ID)
+	s.removeRoomSummary(s.ctx, rm.ID)
+	s.roomsRemoved(rm.ID)
+}
+
+// handleExtendTimeLimitMessage lets a moderator extend the room's time limit
+// over signaling.
+func (s *SFU) handleExtendTimeLimitMessage(client *signaling.Client, message signaling.Message, msg signaling.ExtendTimeLimitMessage) {
+	rm, p := s.roomService.RoomAndPeer(client.RoomID(), client.UserID)
+	if rm == nil || p == nil {
+		client.SendError(404, "Room or peer not found")
+		return
+	}
+
+	if !isModerator(rm, p) {
+		s.sessionService.Audit(client, auditRoomTimeLimit, p.ID, audit.ResultDenied, nil)
+		client.SendError(403, "Moderator role required")
+		return
+	}
+
+	extend := time.Duration(msg.ExtendSec) * time.Second
+	limit, err := rm.ExtendTimeLimit(extend)
+	if err != nil {
+		client.SendError(409, "Room has no time limit")
+		return
+	}
+
+	s.sessionService.Audit(client, auditRoomTimeLimit, p.ID, audit.ResultSuccess, timeLimitDetail(extend, limit))
+	s.roomService.AnnounceTimeLimit(rm, limit, signaling.TimeLimitExtended)
+}
+
+// handleRoomTimeLimitAPI serves /api/rooms/{id}/time-limit: GET returns the
+// room's time limit and PATCH extends it by extendSec.
+func (s *SFU) handleRoomTimeLimitAPI(w http.ResponseWriter, r *http.Request, roomID string) {
+	s.roomsMu.RLock()
+	rm, exists := s.rooms[roomID]
+	s.roomsMu.RUnlock()
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+
+	var limit room.TimeLimit
+	switch r.Method {
+	case http.MethodGet:
+		var ok bool
+		if limit, ok = rm.GetTimeLimit(); !ok {
+			writeAPIError(w, http.StatusNotFound, "Room has no time limit")
+			return
+		}
+	case http.MethodPatch:
+		var req signaling.ExtendTimeLimitMessage
+		if !s.decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.ExtendSec <= 0 {
+			writeAPIError(w, http.StatusBadRequest, "extendSec must be positive")
+			return
+		}
+		extend := time.Duration(req.ExtendSec) * time.Second
+		var err error
+		if limit, err = rm.ExtendTimeLimit(extend); err != nil {
+			if errors.Is(err, room.ErrNoTimeLimit) {
+				s.auditRequest(r, auditRoomTimeLimit, roomID, audit.ResultFailure, map[string]string{"reason": err.Error()})
+				writeAPIError(w, http.StatusConflict, "Room has no time limit")
+				return
+			}
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.auditRequest(r, auditRoomTimeLimit, roomID, audit.ResultSuccess, timeLimitDetail(extend, limit))
+		s.broadcastTimeLimit(rm, limit, signaling.TimeLimitExtended)
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPatch)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timeLimitResponse{
+		RoomID:           roomID,
+		MaxDurationSec:   int(limit.MaxDuration / time.Second),
+		EndsAt:           limit.Deadline,
+		TimeRemainingSec: int(limit.Remaining() / time.Second),
+	})
+}
+
+func timeLimitDetail(extend time.Duration, limit room.TimeLimit) map[string]string {
+	return map[string]string{
+		"extendSec": strconv.Itoa(int(extend / time.Second)),
+		"endsAt":    limit.Deadline.UTC().Format(time.RFC3339),
+	}
+}
+
+// broadcastTimeLimit sends every client in the room its time limit.
+func (s *SFU) broadcastTimeLimit(rm *room.Room, limit room.TimeLimit, reason string) {
+	data, err := json.Marshal(signaling.TimeLimitMessage{
+		RoomID:      rm.ID,
+		Reason:      reason,
+		EndsAt:      limit.Deadline,
+		RemainingMs: limit.Remaining().Milliseconds(),
+	})
+	if err != nil {
+		s.logger.Error("Failed to marshal time limit", zap.Error(err))
+		return
+	}
+
+	msg := signaling.Message{Type: signaling.MessageTypeTimeLimit, Data: data, Timestamp: time.Now()}
+	for _, client := range s.signalingHub.GetClientsByRoom(rm.ID) {
+		client.SendMessage(msg)
+	}
+}
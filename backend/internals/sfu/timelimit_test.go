@@ -0,0 +1,168 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// createTimedRoom creates roomID hosted by "host" and closed after
+// maxDurationSec.
+func (ts *testServer) createTimedRoom(t *testing.T, roomID string, maxDurationSec int) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{"id": roomID, "hostUserId": "host", "maxDurationSec": maxDurationSec})
+	if code := ts.api(t, http.MethodPost, "/api/rooms", string(body), testAdminKey, nil); code != http.StatusOK {
+		t.Fatalf("POST room: %d", code)
+	}
+}
+
+// nextTimeLimit reads sc's messages up to the next time-limit.
+func nextTimeLimit(t *testing.T, sc *scriptedClient) signaling.TimeLimitMessage {
+	t.Helper()
+	seen := sc.readUntil(t, signaling.MessageTypeTimeLimit)
+	var m signaling.TimeLimitMessage
+	if err := json.Unmarshal(seen[len(seen)-1].Data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// timeLimitAudits counts roomID's room.time_limit events by result.
+func (ts *testServer) timeLimitAudits(roomID string) map[string]int {
+	results := make(map[string]int)
+	for _, ev := range ts.auditLogger.Query(roomID, 0) {
+		if ev.Action == auditRoomTimeLimit {
+			results[ev.Result]++
+		}
+	}
+	return results
+}
+
+func TestRoomTimeLimit(t *testing.T) {
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.RoomTimeWarnings = []time.Duration{time.Second, time.Hour}
+	})
+	ts.createTimedRoom(t, "room-1", 2)
+
+	// Joining clients are given the countdown
+	host := ts.dialScripted(t, "host")
+	host.pipeline(t, signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "host", Name: "host"})
+	seen := host.readUntil(t, signaling.MessageTypeRoomState)
+	var state signaling.RoomStateMessage
+	if err := json.Unmarshal(seen[len(seen)-1].Data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.EndsAt == nil || state.TimeRemainingMs <= 0 || state.TimeRemainingMs > 2000 {
+		t.Fatalf("room-state ends at %v, %dms left", state.EndsAt, state.TimeRemainingMs)
+	}
+	bob := ts.joinScripted(t, "bob", "room-1")
+
+	// Only moderators extend it
+	bob.pipeline(t, signaling.MessageTypeExtendTimeLimit, signaling.ExtendTimeLimitMessage{ExtendSec: 60})
+	if replies := bob.readUntil(t, signaling.MessageTypeError); len(replies) == 0 {
+		t.Fatal("no error for bob's extension")
+	}
+
+	// The warning beyond the limit is never given, the one ahead of it is
+	warning := nextTimeLimit(t, bob)
+	if warning.Reason != signaling.TimeLimitWarning || warning.RemainingMs > 1000 || !warning.EndsAt.Equal(*state.EndsAt) {
+		t.Fatalf("first warning %+v", warning)
+	}
+	host.pipeline(t, signaling.MessageTypeExtendTimeLimit, signaling.ExtendTimeLimitMessage{ExtendSec: 1})
+	for _, sc := range []*scriptedClient{host, bob} {
+		for {
+			m := nextTimeLimit(t, sc)
+			if m.Reason == signaling.TimeLimitWarning {
+				continue // the host's copy of the first warning
+			}
+			if m.Reason != signaling.TimeLimitExtended || !m.EndsAt.Equal(state.EndsAt.Add(time.Second)) {
+				t.Fatalf("extension announced as %+v", m)
+			}
+			break
+		}
+	}
+
+	// The extension rearms the warning, then the room closes at the new end
+	rm := ts.lookupRoom("room-1")
+	if stats := rm.GetStats(); stats.MaxDurationSec != 2 || stats.TimeRemainingSec > 2 || !stats.EndsAt.Equal(state.EndsAt.Add(time.Second)) {
+		t.Fatalf("stats %+v", stats)
+	}
+	if again := nextTimeLimit(t, bob); again.Reason != signaling.TimeLimitWarning || again.RemainingMs > 1000 {
+		t.Fatalf("second warning %+v", again)
+	}
+	seen = bob.readUntil(t, signaling.MessageTypeRoomClosed)
+	var closed signaling.RoomClosedMessage
+	if err := json.Unmarshal(seen[len(seen)-1].Data, &closed); err != nil {
+		t.Fatal(err)
+	}
+	if closed.Reason != signaling.RoomClosedTimeLimit {
+		t.Fatalf("room closed as %+v", closed)
+	}
+	if time.Now().Before(state.EndsAt.Add(time.Second)) {
+		t.Fatal("room closed before its extended end")
+	}
+	eventually(t, "the room's close to be audited", func() bool { return ts.closeReason("room-1") != "" })
+	if reason := ts.closeReason("room-1"); reason != signaling.RoomClosedTimeLimit || ts.lookupRoom("room-1") != nil {
+		t.Fatalf("room closed as %q, left registered: %v", reason, ts.lookupRoom("room-1") != nil)
+	}
+	if results := ts.timeLimitAudits("room-1"); results[audit.ResultSuccess] != 1 || results[audit.ResultDenied] != 1 {
+		t.Fatalf("audited extensions %v", results)
+	}
+}
+
+func TestRoomTimeLimitAPI(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+	ts.createTimedRoom(t, "room-1", 600)
+	alice := ts.joinScripted(t, "alice", "room-1")
+	var before timeLimitResponse
+	if code := ts.api(t, http.MethodGet, "/api/rooms/room-1/time-limit", "", testAdminKey, &before); code != http.StatusOK ||
+		before.MaxDurationSec != 600 || before.TimeRemainingSec < 590 {
+		t.Fatalf("GET time-limit: %d %+v", code, before)
+	}
+
+	// An extension moves the end for the API and the room's clients
+	var after timeLimitResponse
+	if code := ts.api(t, http.MethodPatch, "/api/rooms/room-1/time-limit", `{"extendSec":300}`, testAdminKey, &after); code != http.StatusOK ||
+		!after.EndsAt.Equal(before.EndsAt.Add(5*time.Minute)) || after.MaxDurationSec != 600 {
+		t.Fatalf("PATCH time-limit: %d %+v", code, after)
+	}
+	if m := nextTimeLimit(t, alice); m.Reason != signaling.TimeLimitExtended || !m.EndsAt.Equal(after.EndsAt) {
+		t.Fatalf("alice was sent %+v", m)
+	}
+	if results := ts.timeLimitAudits("room-1"); results[audit.ResultSuccess] != 1 {
+		t.Fatalf("audited extensions %v", results)
+	}
+
+	// The limit outlives the room standing empty
+	alice.pipeline(t, signaling.MessageTypeLeave, struct{}{})
+	alice.hangUp()
+	eventually(t, "the room to empty", func() bool { return ts.lookupRoom("room-1").IsEmpty() })
+	ts.joinScripted(t, "bob", "room-1")
+	if limit, ok := ts.lookupRoom("room-1").GetTimeLimit(); !ok || !limit.Deadline.Equal(after.EndsAt) {
+		t.Fatalf("limit after the room emptied: %+v, %v", limit, ok)
+	}
+
+	if code := ts.api(t, http.MethodPost, "/api/rooms", `{"id":"room-2","maxDurationSec":-1}`, testAdminKey, nil); code != http.StatusBadRequest {
+		t.Fatalf("negative maxDurationSec: %d", code)
+	}
+	ts.joinScripted(t, "carol", "room-3")
+	for _, tc := range []struct {
+		name, method, path, body string
+		status                   int
+	}{
+		{"no time limit", http.MethodGet, "/api/rooms/room-3/time-limit", "", http.StatusNotFound},
+		{"extending no time limit", http.MethodPatch, "/api/rooms/room-3/time-limit", `{"extendSec":60}`, http.StatusConflict},
+		{"no extension", http.MethodPatch, "/api/rooms/room-1/time-limit", `{"extendSec":0}`, http.StatusBadRequest},
+		{"unknown room", http.MethodGet, "/api/rooms/room-4/time-limit", "", http.StatusNotFound},
+		{"wrong method", http.MethodPost, "/api/rooms/room-1/time-limit", `{}`, http.StatusMethodNotAllowed},
+	} {
+		if code := ts.api(t, tc.method, tc.path, tc.body, testAdminKey, nil); code != tc.status {
+			t.Errorf("%s: %d, want %d", tc.name, code, tc.status)
+		}
+	}
+}
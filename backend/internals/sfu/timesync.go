@@ -0,0 +1,26 @@
+package sfu
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// handlePingMessage answers a client ping with a pong carrying server time,
+// so the client can estimate its clock offset instead of trusting message
+// timestamps blindly.
+func (s *SFU) handlePingMessage(client *signaling.Client, message signaling.Message) {
+	now := time.Now()
+	data, err := json.Marshal(signaling.TimeSyncMessage{
+		ClientTS:         message.ClientTS,
+		ServerReceivedTS: message.ServerTS,
+		ServerTS:         now.UnixMilli(),
+	})
+	if err != nil {
+		return
+	}
+	client.SendMessage(signaling.Message{
+		Type: signaling.MessageTypePong, Data: data, Timestamp: now, ClientTS: message.ClientTS,
+	})
+}
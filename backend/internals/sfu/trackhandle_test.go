@@ -0,0 +1,72 @@
+package sfu
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestTracksAddressedByHandle(t *testing.T) {
+	ts := newTestServer(t, nil, nil)
+
+	var (
+		mu        sync.Mutex
+		published = make(map[string]signaling.TrackInfo) // by handle
+		received  = make(map[string]bool)                // forwarded track IDs
+	)
+	alice := ts.join(t, "alice", "room-1", client.Handlers{}, client.JoinOptions{})
+	publish(t, alice, "alice")
+	ts.join(t, "bob", "room-1", client.Handlers{
+		OnTrackPublished: func(info signaling.TrackInfo) {
+			mu.Lock()
+			published[info.TrackID] = info
+			mu.Unlock()
+		},
+		OnRoomState: func(state signaling.RoomStateMessage) {
+			mu.Lock()
+			for _, info := range state.Tracks {
+				published[info.TrackID] = info
+			}
+			mu.Unlock()
+		},
+	}, client.JoinOptions{OnTrack: func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		mu.Lock()
+		received[track.ID()] = true
+		mu.Unlock()
+	}})
+	eventually(t, "bob to receive alice's tracks", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 2 && len(published) == 2
+	})
+
+	rm := ts.lookupRoom("room-1")
+	mu.Lock()
+	defer mu.Unlock()
+	for handle, info := range published {
+		// What bob is told and what his transceivers carry agree
+		if !received[handle] {
+			t.Errorf("track %s announced, but bob receives %v", handle, received)
+		}
+		if raw := map[string]string{"audio": "alice-opus", "video": "alice-vp8"}[info.Kind]; info.RawTrackID != raw {
+			t.Errorf("track %s has raw ID %q, want %q", handle, info.RawTrackID, raw)
+		}
+
+		// Either form finds the same track, as does the old forwarded ID
+		byHandle, ok := rm.ResolveTrack(handle)
+		if !ok || byHandle.Handle != handle {
+			t.Fatalf("handle %s does not resolve", handle)
+		}
+		for _, ref := range []string{info.RawTrackID, info.RawTrackID + "_to_" + info.PeerID} {
+			if mt, ok := rm.ResolveTrack(ref); !ok || mt != byHandle {
+				t.Errorf("%s does not resolve to track %s", ref, handle)
+			}
+		}
+		if h, ok := rm.TrackHandle(info.RawTrackID); !ok || h != handle {
+			t.Errorf("TrackHandle(%s) = %s, want %s", info.RawTrackID, h, handle)
+		}
+	}
+}
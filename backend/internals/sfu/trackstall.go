@@ -0,0 +1,65 @@
+package sfu
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+)
+
+// stalledTrackInfo is a stalled track as listed in the room stats API.
+type stalledTrackInfo struct {
+	PeerID string `json:"peerId"`
+	UserID string `json:"userId"`
+	peer.StalledTrack
+}
+
+// handleTrackStalled tells a publisher that one of its tracks has produced
+// no RTP, or has started to after being reported stalled.
+func (s *SFU) handleTrackStalled(p *peer.Peer, trackID, kind string, stalled bool) {
+	data, err := json.Marshal(signaling.TrackStalledMessage{
+		TrackID:  trackID,
+		Kind:     kind,
+		Stalled:  stalled,
+		WindowMs: s.config.Media.TrackStallTimeout.Milliseconds(),
+	})
+	if err != nil {
+		return
+	}
+	msg := signaling.Message{Type: signaling.MessageTypeTrackStalled, Data: data, Timestamp: time.Now()}
+
+	for _, client := range s.signalingHub.GetClientsByRoom(p.RoomID) {
+		if client.UserID == p.UserID {
+			client.SendMessage(msg)
+			break
+		}
+	}
+}
+
+// stalledTracks lists every stalled track in the room.
+func stalledTracks(rm *room.Room) []stalledTrackInfo {
+	out := make([]stalledTrackInfo, 0)
+	for _, p := range rm.GetAllPeers() {
+		for _, st := range p.StalledTracks() {
+			out = append(out, stalledTrackInfo{PeerID: p.ID, UserID: p.UserID, StalledTrack: st})
+		}
+	}
+	return out
+}
+
+// handleLayersInUse tells a publisher which simulcast layers of one of its
+// tracks subscribers need, so it can pause the others.
+func (s *SFU) handleLayersInUse(rm *room.Room, p *peer.Peer, mt *room.MediaTrack, needed, paused []string) {
+	data, err := json.Marshal(signaling.LayersInUseMessage{
+		TrackID: mt.ID,
+		Handle:  mt.Handle,
+		RIDs:    needed,
+		Paused:  paused,
+	})
+	if err != nil {
+		return
+	}
+	s.sendToPeerClient(p, signaling.Message{Type: signaling.MessageTypeLayersInUse, Data: data, Timestamp: time.Now()})
+}
@@ -0,0 +1,237 @@
+package sfu
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+// publishConnected publishes flowing tracks from sess, as publish does, and
+// waits for them to reach the room. Windows started after this do not
+// include connection setup.
+func (ts *testServer) publishConnected(t *testing.T, sess *client.Session, streamID string) {
+	t.Helper()
+	publish(t, sess, streamID)
+	eventually(t, streamID+" to arrive", func() bool {
+		n := 0
+		for _, track := range ts.lookupRoom("room-1").GetTrackList() {
+			if strings.HasPrefix(track.RawTrackID, streamID+"-") {
+				n++
+			}
+		}
+		return n == 2
+	})
+}
+
+// cameraStalls is an OnTrackStalled passing on the camera's messages. The
+// others' tracks may be reported while their connection is set up.
+func cameraStalls(stalls chan<- signaling.TrackStalledMessage) func(signaling.TrackStalledMessage) {
+	return func(m signaling.TrackStalledMessage) {
+		if m.TrackID == "camera" {
+			stalls <- m
+		}
+	}
+}
+
+func TestSilentTrackReportedStalled(t *testing.T) {
+	const window = 300 * time.Millisecond
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.TrackStallTimeout = window
+	})
+	stalls := make(chan signaling.TrackStalledMessage, 8)
+	alice := ts.join(t, "alice", "room-1", client.Handlers{
+		OnTrackStalled: cameraStalls(stalls),
+	}, client.JoinOptions{})
+	bobStalls := make(chan signaling.TrackStalledMessage, 8)
+	ts.join(t, "bob", "room-1", client.Handlers{
+		OnTrackStalled: func(m signaling.TrackStalledMessage) { bobStalls <- m },
+	}, client.JoinOptions{})
+
+	// The microphone works; the camera was never opened
+	ts.publishConnected(t, alice, "alice-mic")
+	camera, err := client.NewSampleTrack(webrtc.MimeTypeVP8, "camera", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.PublishTrack(camera); err != nil {
+		t.Fatal(err)
+	}
+
+	receive := func(stalled bool) {
+		t.Helper()
+		select {
+		case m := <-stalls:
+			if m.TrackID != "camera" || m.Kind != "video" || m.Stalled != stalled || m.WindowMs != window.Milliseconds() {
+				t.Fatalf("track-stalled %+v, want camera stalled=%v", m, stalled)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no track-stalled with stalled=%v", stalled)
+		}
+	}
+	stalledInStats := func() []stalledTrackInfo {
+		t.Helper()
+		var detail struct {
+			StalledTracks []stalledTrackInfo `json:"stalledTracks"`
+		}
+		if code := ts.api(t, http.MethodGet, "/api/rooms/room-1", "", testAdminKey, &detail); code != http.StatusOK {
+			t.Fatalf("GET room: %d", code)
+		}
+		return detail.StalledTracks
+	}
+
+	receive(true)
+	stalled := stalledInStats()
+	if len(stalled) != 1 || stalled[0].TrackID != "camera" || stalled[0].PeerID != alice.PeerID() || stalled[0].UserID != "alice" {
+		t.Fatalf("stalled tracks in the stats: %+v", stalled)
+	}
+
+	// Permission granted: the first packet clears the condition
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				camera.WriteSample(media.Sample{Data: []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a}, Duration: 20 * time.Millisecond})
+			}
+		}
+	}()
+	receive(false)
+	if stalled := stalledInStats(); len(stalled) != 0 {
+		t.Fatalf("stalled tracks after the first packet: %+v", stalled)
+	}
+
+	select {
+	case m := <-stalls:
+		t.Fatalf("unexpected track-stalled %+v", m)
+	case m := <-bobStalls:
+		t.Fatalf("track-stalled sent to a subscriber: %+v", m)
+	case <-time.After(2 * window):
+	}
+}
+
+// simulcastAPI negotiates the header extensions that carry RIDs, as
+// browsers do.
+func simulcastAPI(t *testing.T) *webrtc.API {
+	t.Helper()
+	me := &webrtc.MediaEngine{}
+	if err := me.RegisterDefaultCodecs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, uri := range simulcastExtensions {
+		if err := me.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: uri}, webrtc.RTPCodecTypeVideo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return webrtc.NewAPI(webrtc.WithMediaEngine(me))
+}
+
+// simulcastExtensions are registered by simulcastAPI in this order, so
+// they are negotiated with IDs 1 and 2.
+var simulcastExtensions = []string{sdp.SDESMidURI, sdp.SDESRTPStreamIDURI}
+
+func TestSimulcastTrackStalledUntilAnyLayerFlows(t *testing.T) {
+	const window = 300 * time.Millisecond
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.TrackStallTimeout = window
+		cfg.Media.SimulcastEnabled = true
+	})
+	stalls := make(chan signaling.TrackStalledMessage, 8)
+	alice := ts.join(t, "alice", "room-1", client.Handlers{
+		OnTrackStalled: cameraStalls(stalls),
+	}, client.JoinOptions{API: simulcastAPI(t)})
+
+	// A simulcast camera, which is stalled until its first layer flows
+	var layers []*webrtc.TrackLocalStaticRTP
+	for _, rid := range []string{"q", "h", "f"} {
+		layer, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+			"camera", "alice", webrtc.WithRTPStreamID(rid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers = append(layers, layer)
+	}
+	ts.publishConnected(t, alice, "alice-mic")
+	sender, err := alice.PeerConnection().AddTrack(layers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, layer := range layers[1:] {
+		if err := sender.AddEncoding(layer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publish(t, alice, "alice-screen") // negotiates the camera along with it
+	var mid string
+	for _, tr := range alice.PeerConnection().GetTransceivers() {
+		if tr.Sender() == sender {
+			mid = tr.Mid()
+		}
+	}
+
+	select {
+	case m := <-stalls:
+		if !m.Stalled {
+			t.Fatalf("track-stalled %+v before any layer flowed", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("simulcast track with no layers flowing not reported")
+	}
+
+	// The browser only sends the lowest of the three layers. pion does not
+	// write the RID of a layer it sends, so the packets carry it themselves
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		pkt := &rtp.Packet{Header: rtp.Header{Version: 2, Marker: true}, Payload: []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a}}
+		pkt.Header.SetExtension(1, []byte(mid))
+		pkt.Header.SetExtension(2, []byte("q"))
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				pkt.SequenceNumber++
+				pkt.Timestamp += 1800
+				layers[0].WriteRTP(pkt)
+			}
+		}
+	}()
+	eventually(t, "the camera's layer to arrive", func() bool {
+		for _, track := range ts.lookupRoom("room-1").GetTrackList() {
+			if track.RawTrackID == "camera" && track.IsSimulcast {
+				return true
+			}
+		}
+		return false
+	})
+
+	select {
+	case m := <-stalls:
+		if m.Stalled {
+			t.Fatalf("track-stalled %+v with a layer flowing", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stall not cleared by the first layer")
+	}
+	select {
+	case m := <-stalls:
+		t.Fatalf("track-stalled %+v after it was cleared", m)
+	case <-time.After(3 * window):
+	}
+}
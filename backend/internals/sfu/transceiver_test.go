@@ -0,0 +1,104 @@
+package sfu
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/pion/webrtc/v3"
+)
+
+func TestTenTrackRoomSendsOnSendonlyMLines(t *testing.T) {
+	const publishers = 5
+	ts := newTestServer(t, nil, nil)
+	var peerIDs []string
+	for i := 0; i < publishers; i++ {
+		user := fmt.Sprintf("publisher-%d", i)
+		sess := ts.join(t, user, "room-1", client.Handlers{}, client.JoinOptions{})
+		publish(t, sess, user)
+		peerIDs = append(peerIDs, sess.PeerID())
+	}
+	received := newTrackCounter()
+	bob := ts.join(t, "bob", "room-1", client.Handlers{}, client.JoinOptions{OnTrack: received.onTrack})
+	eventually(t, "bob to receive every publisher", func() bool {
+		for _, id := range peerIDs {
+			if !received.receiving(id) {
+				return false
+			}
+		}
+		return true
+	})
+	_, p := ts.getRoomAndPeer("room-1", "bob")
+	if p == nil || p.ID != bob.PeerID() {
+		t.Fatal("bob has no peer")
+	}
+
+	// Every m-line of the SFU's answers declares a direction the client's
+	// offer allows: recvonly against sendonly, never sendrecv against
+	// recvonly. bob only receives, so all his are sendonly.
+	rm := ts.lookupRoom("room-1")
+	for _, member := range rm.GetAllPeers() {
+		local := mlineDirections(t, member.Connection.CurrentLocalDescription())
+		remote := mlineDirections(t, member.Connection.CurrentRemoteDescription())
+		for mid, dir := range local {
+			if !directionAllowed(remote[mid], dir) {
+				t.Fatalf("%s answered %s to a %s m-line", member.UserID, dir, remote[mid])
+			}
+		}
+		if member.ID == p.ID {
+			sendonly := 0
+			for _, dir := range local {
+				if dir == webrtc.RTPTransceiverDirectionSendonly {
+					sendonly++
+				}
+			}
+			if sendonly != 2*publishers || len(local) != 2*publishers {
+				t.Fatalf("bob has %d m-lines, %d sendonly; want %d sendonly", len(local), sendonly, 2*publishers)
+			}
+			t.Logf("SFU answer for %d forwarded tracks: %d bytes", 2*publishers, len(member.Connection.CurrentLocalDescription().SDP))
+		}
+	}
+	for _, tr := range p.Connection.GetTransceivers() {
+		if tr.Sender() != nil && tr.Direction() != webrtc.RTPTransceiverDirectionSendonly {
+			t.Fatalf("bob's %s transceiver %s is %s", tr.Kind(), tr.Mid(), tr.Direction())
+		}
+	}
+}
+
+// mlineDirections maps the mids of desc's media sections to the direction
+// each declares. A copy is parsed, as pion reads its own concurrently.
+func mlineDirections(t *testing.T, desc *webrtc.SessionDescription) map[string]webrtc.RTPTransceiverDirection {
+	t.Helper()
+	if desc == nil {
+		t.Fatal("no description")
+	}
+	parsed, err := (&webrtc.SessionDescription{Type: desc.Type, SDP: desc.SDP}).Unmarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirs := make(map[string]webrtc.RTPTransceiverDirection)
+	for _, media := range parsed.MediaDescriptions {
+		mid, _ := media.Attribute("mid")
+		dirs[mid] = webrtc.RTPTransceiverDirectionSendrecv
+		for _, attr := range media.Attributes {
+			if dir := webrtc.NewRTPTransceiverDirection(attr.Key); dir != webrtc.RTPTransceiverDirection(webrtc.Unknown) {
+				dirs[mid] = dir
+			}
+		}
+	}
+	return dirs
+}
+
+// directionAllowed reports whether answer is a valid answer direction to an
+// m-line offered as offer.
+func directionAllowed(offer, answer webrtc.RTPTransceiverDirection) bool {
+	switch offer {
+	case webrtc.RTPTransceiverDirectionSendonly:
+		return answer == webrtc.RTPTransceiverDirectionRecvonly || answer == webrtc.RTPTransceiverDirectionInactive
+	case webrtc.RTPTransceiverDirectionRecvonly:
+		return answer == webrtc.RTPTransceiverDirectionSendonly || answer == webrtc.RTPTransceiverDirectionInactive
+	case webrtc.RTPTransceiverDirectionInactive:
+		return answer == webrtc.RTPTransceiverDirectionInactive
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package sfu
+
+import (
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/peer"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// completeLocalDescription returns the description to send to p after desc
+// has been applied locally. Clients that cannot trickle get it once ICE
+// gathering completes, with every candidate inlined; if gathering outlasts
+// Media.NonTrickleGatherTimeout, whatever has been gathered is sent.
+func (s *SFU) completeLocalDescription(p *peer.Peer, desc webrtc.SessionDescription) webrtc.SessionDescription {
+	if !p.TrickleDisabled() {
+		return desc
+	}
+
+	pc := p.Connection
+	gathered := webrtc.GatheringCompletePromise(pc)
+	timeout := s.config.Media.NonTrickleGatherTimeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	select {
+	case <-gathered:
+	case <-time.After(timeout):
+		s.logger.Warn("ICE gathering incomplete, sending partial candidates",
+			zap.String("peerID", p.ID),
+			zap.Duration("timeout", timeout),
+		)
+	}
+
+	if local := pc.LocalDescription(); local != nil {
+		return *local
+	}
+	return desc
+}
@@ -0,0 +1,136 @@
+package sfu
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/pion/webrtc/v3"
+)
+
+// offerAudio adds a receive-only audio transceiver to pc and returns the
+// offer for it.
+func offerAudio(t *testing.T, pc *webrtc.PeerConnection) webrtc.SessionDescription {
+	t.Helper()
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	return offer
+}
+
+// readAnswer reads up to sc's next answer, applies it to pc and returns the
+// number of candidates in it and of ice-candidate messages before it.
+func readAnswer(t *testing.T, sc *scriptedClient, pc *webrtc.PeerConnection) (inline, trickled int) {
+	t.Helper()
+	for _, m := range sc.readUntil(t, signaling.MessageTypeAnswer) {
+		switch m.Type {
+		case signaling.MessageTypeICECandidate:
+			trickled++
+		case signaling.MessageTypeError:
+			t.Fatalf("error: %s", m.Data)
+		case signaling.MessageTypeAnswer:
+			var answer signaling.AnswerMessage
+			if err := json.Unmarshal(m.Data, &answer); err != nil {
+				t.Fatal(err)
+			}
+			if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer.SDP}); err != nil {
+				t.Fatal(err)
+			}
+			inline = strings.Count(answer.SDP, "a=candidate:")
+		}
+	}
+	return inline, trickled
+}
+
+func TestNonTrickleAnswers(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		join, offer   bool
+		wantNoTrickle bool
+	}{
+		{name: "trickle"},
+		{name: "join flag", join: true, wantNoTrickle: true},
+		{name: "offer flag", offer: true, wantNoTrickle: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t, nil, nil)
+			pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pc.Close()
+
+			sc := ts.dialScripted(t, "alice")
+			sc.pipeline(t,
+				signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "Alice", NoTrickle: tc.join},
+				signaling.MessageTypeOffer, signaling.OfferMessage{SDP: offerAudio(t, pc).SDP, Type: "offer", NoTrickle: tc.offer},
+			)
+			inline, trickled := readAnswer(t, sc, pc)
+
+			if !tc.wantNoTrickle {
+				if inline != 0 {
+					t.Fatalf("trickling client's answer has %d candidates", inline)
+				}
+				sc.readUntil(t, signaling.MessageTypeICECandidate)
+				return
+			}
+			if inline == 0 || trickled != 0 {
+				t.Fatalf("answer has %d candidates, %d trickled", inline, trickled)
+			}
+
+			// The flag holds for a renegotiation that does not repeat it
+			sc.pipeline(t, signaling.MessageTypeOffer, signaling.OfferMessage{SDP: offerAudio(t, pc).SDP, Type: "offer"})
+			inline, trickled = readAnswer(t, sc, pc)
+			sc.pipeline(t, signaling.MessageTypePing, struct{}{})
+			for _, m := range sc.readUntil(t, signaling.MessageTypePong) {
+				if m.Type == signaling.MessageTypeICECandidate {
+					trickled++
+				}
+			}
+			if inline == 0 || trickled != 0 {
+				t.Fatalf("renegotiated answer has %d candidates, %d trickled", inline, trickled)
+			}
+		})
+	}
+}
+
+func TestNonTrickleGatherTimeout(t *testing.T) {
+	const timeout = 300 * time.Millisecond
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		// A STUN server that never answers keeps gathering from completing
+		cfg.WebRTC.ICEServers = []config.ICEServer{{URLs: []string{"stun:192.0.2.1:3478"}}}
+		cfg.Media.NonTrickleGatherTimeout = timeout
+	})
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	sc := ts.dialScripted(t, "alice")
+	start := time.Now()
+	sc.pipeline(t,
+		signaling.MessageTypeJoin, signaling.JoinMessage{RoomID: "room-1", UserID: "alice", Name: "Alice", NoTrickle: true},
+		signaling.MessageTypeOffer, signaling.OfferMessage{SDP: offerAudio(t, pc).SDP, Type: "offer"},
+	)
+	inline, trickled := readAnswer(t, sc, pc)
+	if took := time.Since(start); took < timeout || took > timeout+time.Second {
+		t.Fatalf("answered after %v, want about %v", took, timeout)
+	}
+	// The host candidates gathered by then are in the answer
+	if inline == 0 || trickled != 0 {
+		t.Fatalf("answer has %d candidates, %d trickled", inline, trickled)
+	}
+}
@@ -0,0 +1,128 @@
+package sfu
+
+import (
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"go.uber.org/zap"
+)
+
+// closeJoinTimeout is the WebSocket close code sent to a connection that
+// did not join a room within SFU_WS_JOIN_TIMEOUT_SEC.
+const closeJoinTimeout = 4408
+
+// mapSizeInterval is how often the sizes of long-lived maps are exported.
+const mapSizeInterval = 15 * time.Second
+
+// reserveUnjoined admits a new connection as unjoined, unless the cap on
+// connections waiting to join is reached. The caller arms the timeout with
+// armJoinTimeout once the client exists, or calls releaseUnjoined to drop
+// the reservation if the upgrade fails.
+func (s *SFU) reserveUnjoined(clientID string) bool {
+	s.unjoinedMu.Lock()
+	defer s.unjoinedMu.Unlock()
+	if max := s.config.Media.WSMaxUnjoined; max > 0 && len(s.unjoined) >= max {
+		return false
+	}
+	s.unjoined[clientID] = nil
+	return true
+}
+
+// armJoinTimeout closes client if it has not joined a room in time.
+func (s *SFU) armJoinTimeout(client *signaling.Client) {
+	timeout := s.config.Media.WSJoinTimeout
+	if timeout <= 0 {
+		return
+	}
+	s.unjoinedMu.Lock()
+	defer s.unjoinedMu.Unlock()
+	if _, ok := s.unjoined[client.ID]; !ok {
+		return // joined or gone already
+	}
+	s.unjoined[client.ID] = time.AfterFunc(timeout, func() {
+		s.unjoinedMu.Lock()
+		_, waiting := s.unjoined[client.ID]
+		delete(s.unjoined, client.ID)
+		s.unjoinedMu.Unlock()
+		if !waiting {
+			return
+		}
+
+		appmetrics.RecordUnjoinedClosed("timeout")
+		s.logger.Debug("Closing connection that never joined",
+			zap.String("clientID", client.ID),
+			zap.String("userID", client.UserID),
+		)
+		client.CloseWithCode(closeJoinTimeout, "join timeout")
+	})
+}
+
+// releaseUnjoined ends a connection's unjoined state, when it joins a room,
+// goes away or fails to upgrade.
+func (s *SFU) releaseUnjoined(clientID string) {
+	s.unjoinedMu.Lock()
+	defer s.unjoinedMu.Unlock()
+	if timer := s.unjoined[clientID]; timer != nil {
+		timer.Stop()
+	}
+	delete(s.unjoined, clientID)
+}
+
+// mapSizeLoop exports the sizes of maps that grow with connections, peers
+// and sessions, so entries that are never cleaned up show as a rising gauge.
+func (s *SFU) mapSizeLoop() {
+	ticker := time.NewTicker(mapSizeInterval)
+	defer ticker.Stop()
+	for {
+		s.recordMapSizes()
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *SFU) recordMapSizes() {
+	appmetrics.SetMapEntries("hub_clients", s.signalingHub.ClientCount())
+
+	s.unjoinedMu.Lock()
+	appmetrics.SetMapEntries("unjoined_clients", len(s.unjoined))
+	s.unjoinedMu.Unlock()
+
+	s.detachedMu.Lock()
+	appmetrics.SetMapEntries("detached_peers", len(s.detached))
+	s.detachedMu.Unlock()
+
+	s.rateLimitersMu.Lock()
+	appmetrics.SetMapEntries("rate_limiters", len(s.rateLimiters))
+	s.rateLimitersMu.Unlock()
+
+	s.pendingJoinsMu.Lock()
+	appmetrics.SetMapEntries("pending_joins", len(s.pendingJoins))
+	s.pendingJoinsMu.Unlock()
+
+	s.negotiationsMu.Lock()
+	appmetrics.SetMapEntries("pending_negotiations", len(s.negotiations))
+	s.negotiationsMu.Unlock()
+
+	s.pttMu.Lock()
+	appmetrics.SetMapEntries("ptt_timers", len(s.pttTimers))
+	s.pttMu.Unlock()
+
+	s.roomsMu.RLock()
+	renegotiation := 0
+	for _, rm := range s.rooms {
+		renegotiation += rm.RenegotiationStates()
+	}
+	s.roomsMu.RUnlock()
+	appmetrics.SetMapEntries("room_renegotiation", renegotiation)
+
+	if sm := s.sessionManager.Load(); sm != nil {
+		sessions, users, tokens := sm.Sizes()
+		appmetrics.SetMapEntries("sessions", sessions)
+		appmetrics.SetMapEntries("session_users", users)
+		appmetrics.SetMapEntries("session_tokens", tokens)
+	}
+}
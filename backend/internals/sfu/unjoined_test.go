@@ -0,0 +1,175 @@
+package sfu
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/goleak"
+)
+
+var trackedMaps = []string{
+	"hub_clients", "unjoined_clients", "detached_peers", "rate_limiters", "pending_joins",
+	"pending_negotiations", "ptt_timers", "room_renegotiation", "sessions", "session_users", "session_tokens",
+}
+
+// mapSizes samples the map size gauges.
+func (ts *testServer) mapSizes() map[string]float64 {
+	ts.recordMapSizes()
+	sizes := make(map[string]float64)
+	for _, name := range trackedMaps {
+		sizes[name] = testutil.ToFloat64(appmetrics.MapEntries.WithLabelValues(name))
+	}
+	return sizes
+}
+
+// dialUnjoined opens a signaling connection for userID that never joins.
+func (ts *testServer) dialUnjoined(userID string) (*websocket.Conn, *http.Response, error) {
+	url := "ws" + strings.TrimPrefix(ts.http.URL, "http") + ts.config.Server.WSPath + "?userId=" + userID
+	return websocket.DefaultDialer.Dial(url, nil)
+}
+
+// closeCode reads from ws until the server closes it, and returns the close
+// code.
+func closeCode(ws *websocket.Conn) int {
+	ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			var closed *websocket.CloseError
+			if errors.As(err, &closed) {
+				return closed.Code
+			}
+			return -1
+		}
+	}
+}
+
+func TestAbandonedConnectionsReturnToBaseline(t *testing.T) {
+	const (
+		connections = 1000
+		workers     = 100
+	)
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.WSJoinTimeout = 300 * time.Millisecond
+		cfg.Media.WSMaxUnjoined = connections
+	})
+	baseline := ts.mapSizes()
+	timeouts := testutil.ToFloat64(appmetrics.UnjoinedClosedTotal.WithLabelValues("timeout"))
+	running := goleak.IgnoreCurrent()
+
+	// Half send a message first, so they have rate limiters to clean up
+	ping := signaling.Message{Type: signaling.MessageTypePing, ClientTS: 1}
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		codes = make(map[int]int)
+	)
+	next := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				code := -1
+				if ws, _, err := ts.dialUnjoined(fmt.Sprintf("probe-%d", i)); err == nil {
+					if i%2 == 0 {
+						ws.WriteJSON(ping)
+					}
+					code = closeCode(ws)
+					ws.Close()
+				}
+				mu.Lock()
+				codes[code]++
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < connections; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	if codes[closeJoinTimeout] != connections {
+		t.Fatalf("connections closed with %v, want %d with %d", codes, connections, closeJoinTimeout)
+	}
+	if n := testutil.ToFloat64(appmetrics.UnjoinedClosedTotal.WithLabelValues("timeout")) - timeouts; n != connections {
+		t.Fatalf("%v join timeouts counted", n)
+	}
+
+	// Every map and goroutine the connections had is gone
+	eventually(t, "the maps to return to baseline", func() bool {
+		sizes := ts.mapSizes()
+		for name, n := range baseline {
+			if sizes[name] != n {
+				return false
+			}
+		}
+		return true
+	})
+	goleak.VerifyNone(t, running,
+		goleak.IgnoreAnyFunction("github.com/alicebob/miniredis/v2/server.(*Server).servePeer"),
+		goleak.IgnoreAnyFunction("github.com/alicebob/miniredis/v2/server.(*Server).servePeer.func2"),
+	)
+}
+
+func TestUnjoinedCap(t *testing.T) {
+	const timeout = 500 * time.Millisecond
+	ts := newTestServer(t, nil, func(cfg *config.Config) {
+		cfg.Media.WSJoinTimeout = timeout
+		cfg.Media.WSMaxUnjoined = 2
+	})
+	alice := ts.joinScripted(t, "alice", "room-1")
+
+	// Joined connections do not count against the cap
+	var probes []*websocket.Conn
+	for i := 0; i < 2; i++ {
+		ws, _, err := ts.dialUnjoined(fmt.Sprintf("probe-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+		probes = append(probes, ws)
+	}
+	if sizes := ts.mapSizes(); sizes["unjoined_clients"] != 2 || sizes["hub_clients"] != 3 {
+		t.Fatalf("%v unjoined and %v hub clients, want 2 and 3", sizes["unjoined_clients"], sizes["hub_clients"])
+	}
+	refused := testutil.ToFloat64(appmetrics.UnjoinedClosedTotal.WithLabelValues("limit"))
+	if _, resp, err := ts.dialUnjoined("probe-2"); err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("connection over the cap: %v, %v", resp, err)
+	}
+	if n := testutil.ToFloat64(appmetrics.UnjoinedClosedTotal.WithLabelValues("limit")) - refused; n != 1 {
+		t.Fatalf("%v refusals counted", n)
+	}
+
+	// Timed out connections free their places
+	for _, ws := range probes {
+		if code := closeCode(ws); code != closeJoinTimeout {
+			t.Fatalf("probe closed with %d", code)
+		}
+	}
+	eventually(t, "the probes to be released", func() bool { return ts.mapSizes()["unjoined_clients"] == 0 })
+	ws, _, err := ts.dialUnjoined("probe-2")
+	if err != nil {
+		t.Fatalf("connection after the probes timed out: %v", err)
+	}
+	ws.Close()
+
+	// alice joined, and is still connected well past the timeout
+	select {
+	case _, ok := <-alice.messages:
+		if !ok {
+			t.Fatal("alice's connection closed")
+		}
+	default:
+	}
+	eventually(t, "alice to be the only client", func() bool { return ts.signalingHub.ClientCount() == 1 })
+}
@@ -0,0 +1,102 @@
+package sfu
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/adityaadpandey/sfu-go/internals/audit"
+	"github.com/adityaadpandey/sfu-go/internals/room"
+	"github.com/adityaadpandey/sfu-go/internals/webhook"
+)
+
+// Every event a room records (see room/events.go) is also sent to the
+// webhook, when one is configured, as are recording events (see
+// recording.go). In durable mode the stream behind it is inspected and
+// trimmed with /api/webhooks/stream.
+
+// webhookGroup is the consumer group that keeps the webhook cursor.
+const webhookGroup = "sfu-webhook"
+
+// handleRoomEvent sends a room event to the webhook. It may be called with
+// the room locked and does not block.
+func (s *SFU) handleRoomEvent(rm *room.Room, ev room.RoomEvent) {
+	if ev.Type == room.EventPeerJoined {
+		s.recordParticipant(rm.ID, ev.UserID)
+	}
+	s.webhooks.Send(webhook.Event{
+		Type:       ev.Type,
+		InstanceID: s.instanceID(),
+		RoomID:     rm.ID,
+		Seq:        ev.Seq,
+		PeerID:     ev.PeerID,
+		UserID:     ev.UserID,
+		TrackID:    ev.TrackID,
+		Detail:     ev.Detail,
+		At:         ev.At,
+	})
+}
+
+// webhookTrimRequest is the body of POST /api/webhooks/stream: keep the
+// newest maxLen entries, or those from minId on.
+type webhookTrimRequest struct {
+	MaxLen *int64 `json:"maxLen,omitempty"`
+	MinID  string `json:"minId,omitempty"`
+}
+
+// webhookStreamResponse is the body of /api/webhooks/stream. Trimmed, the
+// number of entries removed, is only set by POST.
+type webhookStreamResponse struct {
+	Trimmed *int64              `json:"trimmed,omitempty"`
+	Stream  *webhook.StreamInfo `json:"stream"`
+}
+
+// handleWebhookStreamAPI serves /api/webhooks/stream: GET describes the
+// durable stream and how far delivery is behind, POST trims it.
+func (s *SFU) handleWebhookStreamAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+	if !s.webhooks.Durable() {
+		writeAPIError(w, http.StatusServiceUnavailable, "Durable webhooks are disabled")
+		return
+	}
+
+	var response webhookStreamResponse
+	if r.Method == http.MethodPost {
+		var req webhookTrimRequest
+		if !s.decodeJSONBody(w, r, &req) {
+			return
+		}
+		if (req.MaxLen == nil) == (req.MinID == "") || (req.MaxLen != nil && *req.MaxLen < 0) {
+			writeAPIError(w, http.StatusBadRequest, "Exactly one of maxLen (>= 0) or minId is required")
+			return
+		}
+		var maxLen int64
+		if req.MaxLen != nil {
+			maxLen = *req.MaxLen
+		}
+		trimmed, err := s.webhooks.Trim(r.Context(), maxLen, req.MinID)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.auditRequest(r, auditWebhookTrim, "", audit.ResultSuccess, map[string]string{
+			"maxLen":  strconv.FormatInt(maxLen, 10),
+			"minId":   req.MinID,
+			"trimmed": strconv.FormatInt(trimmed, 10),
+		})
+		response.Trimmed = &trimmed
+	}
+
+	info, err := s.webhooks.Info(r.Context())
+	if err != nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "Failed to read the webhook stream")
+		return
+	}
+	response.Stream = info
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,59 @@
+package sfu
+
+import (
+	"fmt"
+
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// webkitH264 are the H264 configurations Safari offers beyond Pion's
+// defaults: Constrained High in both packetization modes and High in
+// packetization mode 0. Pion only answers with payload types it has
+// registered, so without them a Safari publisher on one of these profiles
+// falls back to a profile it encodes worse, or to no video at all.
+var webkitH264 = []struct {
+	payloadType, rtxPayloadType webrtc.PayloadType
+	fmtp                        string
+}{
+	{114, 115, "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=640c1f"},
+	{116, 117, "level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=640c1f"},
+	{118, 119, "level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=64001f"},
+}
+
+var webkitVideoFeedback = []webrtc.RTCPFeedback{
+	{Type: "goog-remb"},
+	{Type: "ccm", Parameter: "fir"},
+	{Type: "nack"},
+	{Type: "nack", Parameter: "pli"},
+	{Type: "transport-cc"},
+}
+
+// registerWebKitCodecs adds webkitH264, with RTX, to a media engine that
+// already holds the default codecs.
+func (s *SFU) registerWebKitCodecs(m *webrtc.MediaEngine) {
+	for _, c := range webkitH264 {
+		codecs := []webrtc.RTPCodecParameters{
+			{
+				RTPCodecCapability: webrtc.RTPCodecCapability{
+					MimeType: webrtc.MimeTypeH264, ClockRate: 90000, SDPFmtpLine: c.fmtp, RTCPFeedback: webkitVideoFeedback,
+				},
+				PayloadType: c.payloadType,
+			},
+			{
+				RTPCodecCapability: webrtc.RTPCodecCapability{
+					MimeType: "video/rtx", ClockRate: 90000, SDPFmtpLine: fmt.Sprintf("apt=%d", c.payloadType),
+				},
+				PayloadType: c.rtxPayloadType,
+			},
+		}
+		for _, codec := range codecs {
+			if err := m.RegisterCodec(codec, webrtc.RTPCodecTypeVideo); err != nil {
+				s.logger.Error("Failed to register WebKit codec",
+					zap.String("fmtp", codec.SDPFmtpLine),
+					zap.Error(err),
+				)
+			}
+		}
+	}
+}
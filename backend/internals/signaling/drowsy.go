@@ -0,0 +1,183 @@
+package signaling
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// A backgrounded mobile tab stops running timers, so its client misses the
+// hub's pings, though the user means to come back. A connection silent for
+// its drowsy threshold is marked drowsy rather than dropped: low-priority
+// messages to it are discarded, everything else is held until it wakes, and
+// its read deadline is extended once by the grace. Pongs at the WebSocket
+// level no longer extend it; the next message from the client wakes it and
+// flushes what was held, and otherwise the deadline closes it as usual.
+
+const (
+	// pongWait is how long the read deadline runs from the last message or
+	// WebSocket pong.
+	pongWait = 60 * time.Second
+	// drowsyCheckInterval is how often the write pump looks for silence, or
+	// half the drowsy threshold when that is shorter.
+	drowsyCheckInterval = 5 * time.Second
+	// maxHeldMessages bounds what is held for a drowsy client; beyond it
+	// messages are dropped as for a full send channel.
+	maxHeldMessages = 256
+)
+
+// lowPriorityMessages are discarded rather than held while a client is
+// drowsy: they are superseded by the next one and only keep a tab awake.
+var lowPriorityMessages = map[MessageType]bool{
+	MessageTypeDominantSpeaker: true,
+	MessageTypeQualityStats:    true,
+	MessageTypeRoomQuality:     true,
+}
+
+// drowsiness is a connection's drowsy state.
+type drowsiness struct {
+	after time.Duration // 0 = never drowsy
+	grace time.Duration
+
+	// Unix nanoseconds of the last message from the client, keepalives
+	// included
+	lastMessage atomic.Int64
+	// Mirrors drowsy, for a send that need not lock
+	flag atomic.Bool
+
+	mu     sync.Mutex
+	drowsy bool
+	held   []Message
+}
+
+// SetDrowsiness makes the connection drowsy after after without a message
+// from the client, and closes it grace later unless one arrives. It must be
+// called before the pumps start; after == 0 disables it.
+func (c *Client) SetDrowsiness(after, grace time.Duration) {
+	c.drowsiness.after = after
+	c.drowsiness.grace = grace
+}
+
+// Drowsy reports whether the connection, or a membership's connection, is
+// drowsy.
+func (c *Client) Drowsy() bool {
+	if c.parent != nil {
+		return c.parent.Drowsy()
+	}
+	c.drowsiness.mu.Lock()
+	defer c.drowsiness.mu.Unlock()
+	return c.drowsiness.drowsy
+}
+
+// heard records a message from the client at now, extends the read deadline
+// and wakes the connection if it was drowsy.
+func (c *Client) heard(now time.Time) {
+	c.drowsiness.lastMessage.Store(now.UnixNano())
+	c.Conn.SetReadDeadline(now.Add(pongWait))
+	c.wake(now)
+}
+
+// heardPong extends the read deadline for a WebSocket pong, unless the
+// connection is drowsy: a sleeping tab's browser may still answer those.
+func (c *Client) heardPong() {
+	if c.drowsiness.flag.Load() {
+		return
+	}
+	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+}
+
+// checkDrowsy makes the connection drowsy if it has been silent for its
+// threshold at now.
+func (c *Client) checkDrowsy(now time.Time) {
+	d := &c.drowsiness
+	last := d.lastMessage.Load()
+	if d.after <= 0 || now.Sub(time.Unix(0, last)) < d.after {
+		return
+	}
+
+	d.mu.Lock()
+	if d.drowsy {
+		d.mu.Unlock()
+		return
+	}
+	// Raised before looking at lastMessage again, so a message arriving
+	// meanwhile either is seen here or finds the flag and wakes
+	d.flag.Store(true)
+	if d.lastMessage.Load() != last {
+		d.flag.Store(false)
+		d.mu.Unlock()
+		return
+	}
+	d.drowsy = true
+	deadline := time.Unix(0, last).Add(pongWait)
+	if extended := now.Add(d.grace); extended.After(deadline) {
+		deadline = extended
+	}
+	c.Conn.SetReadDeadline(deadline)
+	d.mu.Unlock()
+
+	c.logger.Info("Client drowsy",
+		zap.String("clientID", c.ID),
+		zap.Duration("silentFor", now.Sub(time.Unix(0, last))),
+		zap.Time("disconnectAt", deadline),
+	)
+	if c.OnDrowsy != nil {
+		c.OnDrowsy(c, true, deadline.Sub(now))
+	}
+}
+
+// wake ends the drowsy state, queueing what was held in order before
+// anything sent after it.
+func (c *Client) wake(now time.Time) {
+	d := &c.drowsiness
+	if !d.flag.Load() {
+		return
+	}
+	d.mu.Lock()
+	if !d.drowsy {
+		d.mu.Unlock()
+		return
+	}
+	held := d.held
+	d.held = nil
+	for _, msg := range held {
+		if !c.closed.Load() {
+			c.enqueue(msg)
+		}
+	}
+	d.drowsy = false
+	d.flag.Store(false)
+	c.Conn.SetReadDeadline(now.Add(pongWait))
+	d.mu.Unlock()
+
+	c.logger.Info("Client awake", zap.String("clientID", c.ID), zap.Int("flushed", len(held)))
+	if c.OnDrowsy != nil {
+		c.OnDrowsy(c, false, 0)
+	}
+}
+
+// holdIfDrowsy discards or holds message while the connection is drowsy. It
+// reports whether it did either, and if so whether the message was kept.
+func (c *Client) holdIfDrowsy(message Message) (handled, kept bool) {
+	d := &c.drowsiness
+	if !d.flag.Load() {
+		return false, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case !d.drowsy:
+		return false, false
+	case lowPriorityMessages[message.Type]:
+		return true, false
+	case len(d.held) >= maxHeldMessages:
+		c.logger.Warn("Drowsy client holding too many messages, dropping message",
+			zap.String("clientID", c.ID),
+		)
+		return true, false
+	}
+	d.held = append(d.held, message)
+	return true, true
+}
@@ -0,0 +1,148 @@
+package signaling
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Outgoing messages are encoded by hand rather than with WriteJSON. A
+// broadcast marshals its Data once and hands the same bytes to every client,
+// but the envelope carries each client's own Seq and ServerTS and is
+// encoded per write; through encoding/json that meant reflecting over the
+// Message and re-validating Data every time. appendMessage produces the
+// same bytes as json.NewEncoder(w).Encode(message) into a pooled buffer.
+
+// maxPooledBuffer bounds the buffers kept for reuse, so one large room-state
+// does not pin its buffer forever.
+const maxPooledBuffer = 64 << 10
+
+var encodeBuffers = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
+// encodeMessage encodes m into a pooled buffer. The caller returns the
+// buffer with releaseBuffer once it has been written.
+func encodeMessage(m *Message) (*[]byte, error) {
+	buf := encodeBuffers.Get().(*[]byte)
+	b, err := appendMessage((*buf)[:0], m)
+	if err != nil {
+		releaseBuffer(buf)
+		return nil, err
+	}
+	*buf = b
+	return buf, nil
+}
+
+func releaseBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBuffer {
+		return
+	}
+	encodeBuffers.Put(buf)
+}
+
+// appendMessage appends the JSON encoding of m, followed by a newline, to b.
+func appendMessage(b []byte, m *Message) ([]byte, error) {
+	b = append(b, `{"type":`...)
+	b = appendString(b, string(m.Type))
+	if len(m.Data) > 0 {
+		b = append(b, `,"data":`...)
+		var err error
+		if b, err = appendRaw(b, m.Data); err != nil {
+			return b, err
+		}
+	}
+	b = append(b, `,"timestamp":"`...)
+	b = m.Timestamp.AppendFormat(b, time.RFC3339Nano)
+	b = append(b, '"')
+	if m.From != "" {
+		b = append(b, `,"from":`...)
+		b = appendString(b, m.From)
+	}
+	if m.To != "" {
+		b = append(b, `,"to":`...)
+		b = appendString(b, m.To)
+	}
+	if m.ServerTS != 0 {
+		b = append(b, `,"serverTs":`...)
+		b = strconv.AppendInt(b, m.ServerTS, 10)
+	}
+	if m.ClientTS != 0 {
+		b = append(b, `,"clientTs":`...)
+		b = strconv.AppendInt(b, m.ClientTS, 10)
+	}
+	if m.Seq != 0 {
+		b = append(b, `,"seq":`...)
+		b = strconv.AppendUint(b, m.Seq, 10)
+	}
+	if m.RoomSeq != 0 {
+		b = append(b, `,"roomSeq":`...)
+		b = strconv.AppendUint(b, m.RoomSeq, 10)
+	}
+	if m.MembershipID != "" {
+		b = append(b, `,"membershipId":`...)
+		b = appendString(b, m.MembershipID)
+	}
+	return append(b, '}', '\n'), nil
+}
+
+// appendString appends s as a JSON string. Strings that need escaping go
+// through encoding/json.
+func appendString(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x7f || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			quoted, _ := json.Marshal(s)
+			return append(b, quoted...)
+		}
+	}
+	b = append(b, '"')
+	b = append(b, s...)
+	return append(b, '"')
+}
+
+// appendRaw appends raw JSON as encoding/json would: compacted, with HTML
+// characters escaped. Payloads marshaled by this package are already in that
+// form and are copied as they are.
+func appendRaw(b []byte, raw json.RawMessage) ([]byte, error) {
+	if !needsCompacting(raw) {
+		return append(b, raw...), nil
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		return b, err
+	}
+	var escaped bytes.Buffer
+	json.HTMLEscape(&escaped, compact.Bytes())
+	return append(b, escaped.Bytes()...), nil
+}
+
+// needsCompacting reports whether raw contains whitespace between tokens,
+// HTML characters or the start of U+2028/U+2029, any of which encoding/json
+// would rewrite.
+func needsCompacting(raw []byte) bool {
+	inString, escaped := false, false
+	for _, c := range raw {
+		switch {
+		case c == '<' || c == '>' || c == '&' || c == 0xe2:
+			return true
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			return true
+		}
+	}
+	return false
+}
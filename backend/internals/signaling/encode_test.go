@@ -0,0 +1,116 @@
+package signaling
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// encodeWithJSON is what WritePump sent before encodeMessage: the output of
+// WriteJSON.
+func encodeWithJSON(t testing.TB, m *Message) []byte {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodeMessage(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 600700800, time.FixedZone("", 2*3600))
+	stats, err := json.Marshal(QualityStatsMessage{PeerID: "peer-1", Level: "good", PacketLoss: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		m    Message
+		want string // the exact bytes on the wire, when pinned
+	}{
+		{
+			name: "quality stats",
+			m:    Message{Type: MessageTypeQualityStats, Data: stats, Timestamp: at, ServerTS: 1767315845600, Seq: 42, RoomSeq: 7},
+			want: `{"type":"quality-stats","data":{"peerId":"peer-1","level":"good","packetLoss":0.5},"timestamp":"2026-01-02T03:04:05.6007008+02:00","serverTs":1767315845600,"seq":42,"roomSeq":7}` + "\n",
+		},
+		{
+			name: "no data",
+			m:    Message{Type: MessageTypePong, Timestamp: at.UTC()},
+			want: `{"type":"pong","timestamp":"2026-01-02T01:04:05.6007008Z"}` + "\n",
+		},
+		{name: "zero timestamp", m: Message{Type: MessageTypePing}},
+		{
+			name: "every field",
+			m: Message{
+				Type: MessageTypeOffer, Data: json.RawMessage(`{"sdp":"v=0\r\n","type":"offer"}`), Timestamp: at,
+				From: "peer-1", To: "peer-2", ServerTS: 1, ClientTS: 2, Seq: 3, RoomSeq: 4, MembershipID: "m-1",
+			},
+		},
+		{name: "whitespace in data", m: Message{Type: MessageTypeDataBroadcast, Data: json.RawMessage("{ \"text\" :\n\t\"hi\" }"), Timestamp: at}},
+		{name: "html in data", m: Message{Type: MessageTypeDataBroadcast, Data: json.RawMessage(`{"text":"<b>&amp;</b>"}`), Timestamp: at}},
+		{name: "line separator in data", m: Message{Type: MessageTypeDataBroadcast, Data: json.RawMessage("{\"text\":\"a\u2028b\u2029c\"}"), Timestamp: at}},
+		{name: "escaped quote in data", m: Message{Type: MessageTypeDataBroadcast, Data: json.RawMessage(`{"text":"say \"hi\" \\ bye"}`), Timestamp: at}},
+		{name: "strings to escape", m: Message{Type: "odd\"type", Timestamp: at, From: "<peer>", To: "tab\there", MembershipID: "é "}},
+		{name: "data that is not an object", m: Message{Type: MessageTypeDataBroadcast, Data: json.RawMessage(`"text"`), Timestamp: at}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			buf, err := encodeMessage(&tc.m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer releaseBuffer(buf)
+			if want := encodeWithJSON(t, &tc.m); !bytes.Equal(*buf, want) {
+				t.Fatalf("encoded\n%s\nencoding/json gives\n%s", *buf, want)
+			}
+			if tc.want != "" && string(*buf) != tc.want {
+				t.Fatalf("encoded\n%s\nwant\n%s", *buf, tc.want)
+			}
+		})
+	}
+}
+
+func TestEncodeMessageRejectsInvalidData(t *testing.T) {
+	if _, err := encodeMessage(&Message{Type: MessageTypeDataBroadcast, Data: json.RawMessage(`{"text": }`)}); err == nil {
+		t.Fatal("invalid data encoded")
+	}
+}
+
+// BenchmarkBroadcastQualityStats encodes one quality-stats broadcast for
+// each of 200 clients, which differ only in their Seq.
+func BenchmarkBroadcastQualityStats(b *testing.B) {
+	const clients = 200
+	data, err := json.Marshal(QualityStatsMessage{PeerID: "3f0c1d52-8a6e-4d7b-9f21-6c0e4b7a9d13", Level: "fair", PacketLoss: 2.75})
+	if err != nil {
+		b.Fatal(err)
+	}
+	m := Message{Type: MessageTypeQualityStats, Data: data, Timestamp: time.Now(), ServerTS: time.Now().UnixMilli()}
+
+	b.Run("encoding-json", func(b *testing.B) {
+		b.ReportAllocs()
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for i := 0; i < b.N; i++ {
+			for c := 0; c < clients; c++ {
+				buf.Reset()
+				m.Seq = uint64(c + 1)
+				if err := enc.Encode(&m); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("encodeMessage", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for c := 0; c < clients; c++ {
+				m.Seq = uint64(c + 1)
+				buf, err := encodeMessage(&m)
+				if err != nil {
+					b.Fatal(err)
+				}
+				releaseBuffer(buf)
+			}
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package signaling
+
+import (
+	"strings"
+	"time"
+)
+
+// A connection is in at most one room of its own, but may hold further
+// memberships, each in another room with its own peer. A membership is a
+// Client of its own, registered with the hub, so room broadcasts and
+// handlers treat it like any connection; it shares its parent's WebSocket,
+// and everything it sends carries its ID in the envelope's membershipId.
+// Messages from the client that carry a membershipId are handled as the
+// membership's.
+
+// membershipSeparator joins a membership's ID to its parent's client ID.
+const membershipSeparator = "/"
+
+// NewMembership creates membership id of c. The caller registers it with the
+// hub. A membership has no memberships of its own.
+func (c *Client) NewMembership(id string) *Client {
+	m := &Client{
+		ID:           c.ID + membershipSeparator + id,
+		UserID:       c.UserID,
+		Name:         c.Name,
+		Conn:         c.Conn,
+		WSURL:        c.WSURL,
+		APIURL:       c.APIURL,
+		Token:        c.Token,
+		RemoteIP:     c.RemoteIP,
+		Connected:    true,
+		LastPing:     time.Now(),
+		logger:       c.logger,
+		OnMessage:    c.OnMessage,
+		OnDisconnect: c.OnDisconnect,
+		parent:       c,
+		membershipID: id,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.memberships == nil {
+		c.memberships = make(map[string]*Client)
+	}
+	c.memberships[id] = m
+	return m
+}
+
+// Membership returns c's membership id.
+func (c *Client) Membership(id string) (*Client, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m, ok := c.memberships[id]
+	return m, ok
+}
+
+// Memberships returns c's memberships.
+func (c *Client) Memberships() []*Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	list := make([]*Client, 0, len(c.memberships))
+	for _, m := range c.memberships {
+		list = append(list, m)
+	}
+	return list
+}
+
+// MembershipID returns the ID of the membership c is, or "" for a
+// connection.
+func (c *Client) MembershipID() string {
+	return c.membershipID
+}
+
+// Parent returns the connection a membership belongs to, or nil for a
+// connection.
+func (c *Client) Parent() *Client {
+	return c.parent
+}
+
+// EndMembership takes membership c off its parent. It reports whether c
+// was still a membership.
+func (c *Client) EndMembership() bool {
+	if c.parent == nil {
+		return false
+	}
+	p := c.parent
+	p.mu.Lock()
+	_, ok := p.memberships[c.membershipID]
+	delete(p.memberships, c.membershipID)
+	p.mu.Unlock()
+	return ok
+}
+
+// Close closes the connection. For a membership only the membership ends,
+// with its disconnect handled as a connection's would be.
+func (c *Client) Close() {
+	if c.parent == nil {
+		c.Conn.Close()
+		return
+	}
+	if c.EndMembership() && c.OnDisconnect != nil {
+		c.OnDisconnect(c)
+	}
+}
+
+// connectionID returns the client ID of the connection clientID, a
+// connection or a membership, belongs to.
+func connectionID(clientID string) string {
+	id, _, _ := strings.Cut(clientID, membershipSeparator)
+	return id
+}
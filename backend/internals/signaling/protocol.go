@@ -0,0 +1,623 @@
+package signaling
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Payloads the SFU sends to clients. The server marshals these types and the
+// Go client SDK (pkg/client) unmarshals them, so both sides always agree on
+// the wire format.
+
+// SchemaVersion is the version of the payloads in this package and of the
+// REST responses. It is raised when a field is renamed or removed or changes
+// meaning; added optional fields leave it alone. Clients read it from the
+// join reply and /health.
+const SchemaVersion = 2
+
+// JoinResponse is the data of the join reply.
+type JoinResponse struct {
+	Success      bool   `json:"success"`
+	PeerID       string `json:"peerId"`
+	RoomID       string `json:"roomId"`
+	Resumed      bool   `json:"resumed"`
+	SessionID    string `json:"sessionId,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+	Role         string `json:"role,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Observer     bool   `json:"observer,omitempty"`
+	// A viewer in a broadcast room; its tracks are rejected
+	Viewer bool `json:"viewer,omitempty"`
+	// Tracks are only forwarded once subscribed to
+	ManualSubscribe bool `json:"manualSubscribe,omitempty"`
+	// Tracks a resumed manual-subscribe session was subscribed to again
+	Subscriptions []string `json:"subscriptions,omitempty"`
+	// The SFU is withholding the participant's audio until it unmutes
+	MicMuted bool `json:"micMuted,omitempty"`
+	// The resumed session kept its peer and the client's PeerConnection;
+	// no new negotiation follows
+	Reattached bool `json:"reattached,omitempty"`
+	// Set when the join created a membership; later messages for the room
+	// carry it as membershipId
+	MembershipID string `json:"membershipId,omitempty"`
+	// When the participant stops being allowed to publish and becomes a
+	// viewer; a resumed session keeps its original deadline
+	PublishUntil *time.Time `json:"publishUntil,omitempty"`
+
+	// ICE servers for the client's PeerConnection, healthiest first
+	ICEServers []webrtc.ICEServer `json:"iceServers,omitempty"`
+	// "relay" for relay-only peers, whose client should use the same policy
+	ICETransportPolicy string `json:"iceTransportPolicy,omitempty"`
+
+	// The signaling WebSocket and REST API of this instance, as the client
+	// reached it, so clients need not hardcode paths
+	WSURL  string `json:"wsUrl,omitempty"`
+	APIURL string `json:"apiUrl,omitempty"`
+	// The region the room is hosted in, when instances have regions
+	Region string `json:"region,omitempty"`
+
+	// SchemaVersion of the server's payloads
+	SchemaVersion int `json:"schemaVersion"`
+}
+
+// PeerInfo describes a participant in peer-joined, peer-left and room-state.
+type PeerInfo struct {
+	PeerID string `json:"peerId"`
+	UserID string `json:"userId"`
+	Name   string `json:"name"`
+	RoomID string `json:"roomId,omitempty"`
+	// The participant's audio is muted and not being forwarded
+	MicMuted bool `json:"micMuted,omitempty"`
+	// Why a peer-left peer left; PeerLeftReasonLeft for an explicit leave,
+	// empty otherwise
+	Reason string `json:"reason,omitempty"`
+	// The role the participant joined with, or "viewer" once its publishing
+	// window has ended
+	Role string `json:"role,omitempty"`
+	// A peer-joined peer is a reconnect that kept its peer ID, replacing
+	// the peer of that ID without a peer-left
+	Reconnect bool `json:"reconnect,omitempty"`
+	// In room-state, the peer's media connection is down: "disconnected"
+	// or "failed" for ConnectionStateMs (see PeerConnectionStateMessage)
+	ConnectionState   string `json:"connectionState,omitempty"`
+	ConnectionStateMs int64  `json:"connectionStateMs,omitempty"`
+}
+
+// PeerLeftReasonLeft means the participant left on purpose rather than
+// losing its connection.
+const PeerLeftReasonLeft = "left"
+
+// TrackInfo describes a published track. TrackID is the SFU-assigned handle.
+type TrackInfo struct {
+	TrackID       string `json:"trackId"`
+	RawTrackID    string `json:"rawTrackId"`
+	PeerID        string `json:"peerId"`
+	Kind          string `json:"kind"`
+	MediaType     string `json:"mediaType"`
+	IsSimulcast   bool   `json:"isSimulcast"`
+	SimulcastMode string `json:"simulcastMode,omitempty"` // "rid" or "ssrc-group"
+	Paused        bool   `json:"paused,omitempty"`
+	Codec         string `json:"codec,omitempty"`
+
+	// For audio, the publisher's clock rate and channels (for Opus, 2 only
+	// when it sends stereo), so a subscriber that negotiated other channels
+	// can adjust its playout
+	ClockRate uint32 `json:"clockRate,omitempty"`
+	Channels  uint16 `json:"channels,omitempty"`
+
+	// Set for codec alternatives: subscribers receive one alternative per
+	// group, under the group ID, in one of the listed codecs
+	GroupID string   `json:"groupId,omitempty"`
+	Codecs  []string `json:"codecs,omitempty"`
+}
+
+// RoomStateMessage is sent to a peer after it joins. In a broadcast room
+// that only counts its viewers, Peers lists the publishers and Viewers says
+// how many viewers there are.
+type RoomStateMessage struct {
+	Peers   []PeerInfo  `json:"peers"`
+	Tracks  []TrackInfo `json:"tracks"`
+	Viewers int         `json:"viewers,omitempty"`
+	// Set when the room has a time limit, for a countdown
+	EndsAt          *time.Time `json:"endsAt,omitempty"`
+	TimeRemainingMs int64      `json:"timeRemainingMs,omitempty"`
+	// The room's host, if it has one; HostPeerID is empty while the host
+	// is not in the room
+	HostUserID string `json:"hostUserId,omitempty"`
+	HostPeerID string `json:"hostPeerId,omitempty"`
+	// The host controls in force: the mute-all and the spotlighted
+	// participant
+	MuteAll         *MuteAllChangedMessage `json:"muteAll,omitempty"`
+	SpotlightUserID string                 `json:"spotlightUserId,omitempty"`
+	SpotlightPeerID string                 `json:"spotlightPeerId,omitempty"`
+	// Set while the host keeps new participants out
+	Locked bool `json:"locked,omitempty"`
+	// What is already forwarded to the peer, when it reattached to its
+	// PeerConnection
+	Subscriptions []SubscriptionInfo `json:"subscriptions,omitempty"`
+}
+
+// SubscriptionInfo is one track forwarded to a peer and the m-line it is
+// on. TrackID is the track handle, or the group ID for codec alternatives;
+// Layer is the simulcast layer selected for the peer.
+type SubscriptionInfo struct {
+	Mid       string `json:"mid"`
+	PeerID    string `json:"peerId"`
+	TrackID   string `json:"trackId"`
+	Kind      string `json:"kind"`
+	MediaType string `json:"mediaType"`
+	Layer     string `json:"layer,omitempty"`
+}
+
+// SubscriptionSnapshotMessage is sent to a resumed peer after its first
+// answer, listing its forwarded tracks in m-line order.
+type SubscriptionSnapshotMessage struct {
+	Subscriptions []SubscriptionInfo `json:"subscriptions"`
+}
+
+// TransferHostMessage is sent by the host to hand the role to another
+// participant.
+type TransferHostMessage struct {
+	PeerID string `json:"peerId"`
+}
+
+// HostChangedMessage announces a new host to the room, and is the body of
+// /api/rooms/{id}/host. An empty HostUserID means the room has no host.
+type HostChangedMessage struct {
+	HostUserID     string `json:"hostUserId"`
+	HostPeerID     string `json:"hostPeerId,omitempty"`
+	PreviousUserID string `json:"previousUserId,omitempty"`
+	Reason         string `json:"reason,omitempty"` // first-join, host-left, transfer or granted
+}
+
+// MuteAllMessage is sent by the host to mute every participant but itself
+// and the exempt peers, or with Enabled false to lift the mute-all. With
+// Hard set participants cannot unmute themselves until it is lifted. It is
+// also the body of POST /api/rooms/{id}/mute-all.
+type MuteAllMessage struct {
+	Enabled       bool     `json:"enabled"`
+	Hard          bool     `json:"hard,omitempty"`
+	ExemptPeerIDs []string `json:"exemptPeerIds,omitempty"`
+}
+
+// MuteAllChangedMessage announces the room's mute-all, and is the body of
+// /api/rooms/{id}/mute-all. MutedPeerIDs are the peers the change muted.
+type MuteAllChangedMessage struct {
+	Active        bool       `json:"active"`
+	Hard          bool       `json:"hard,omitempty"`
+	ExemptUserIDs []string   `json:"exemptUserIds,omitempty"`
+	By            string     `json:"by,omitempty"`
+	Since         *time.Time `json:"since,omitempty"`
+	MutedPeerIDs  []string   `json:"mutedPeerIds,omitempty"`
+}
+
+// LockRoomMessage is sent by the host to lock the room against new
+// participants, or with Locked false to unlock it. It is also the body of
+// PATCH /api/rooms/{id}.
+type LockRoomMessage struct {
+	Locked bool `json:"locked"`
+}
+
+// RoomLockChangedMessage announces the room's lock.
+type RoomLockChangedMessage struct {
+	Locked bool       `json:"locked"`
+	By     string     `json:"by,omitempty"`
+	Since  *time.Time `json:"since,omitempty"`
+}
+
+// SpotlightMessage is sent by the host to spotlight a participant, or with
+// an empty PeerID to clear the spotlight. It is also the body of PUT
+// /api/rooms/{id}/spotlight.
+type SpotlightMessage struct {
+	PeerID string `json:"peerId"`
+}
+
+// SpotlightChangedMessage announces the spotlighted participant, and is the
+// body of /api/rooms/{id}/spotlight. An empty UserID means there is none.
+type SpotlightChangedMessage struct {
+	UserID         string `json:"userId"`
+	PeerID         string `json:"peerId,omitempty"`
+	PreviousUserID string `json:"previousUserId,omitempty"`
+	Reason         string `json:"reason,omitempty"` // set, cleared or peer-left
+}
+
+// PublishExpiredMessage tells a peer its publishing window ended: the
+// tracks it published were removed, new ones are rejected, and its role is
+// now viewer.
+type PublishExpiredMessage struct {
+	PeerID        string    `json:"peerId"`
+	Role          string    `json:"role"`
+	ExpiredAt     time.Time `json:"expiredAt"`
+	RemovedTracks []string  `json:"removedTracks,omitempty"`
+}
+
+// ParticipantCountMessage is sent to a broadcast room in place of peer-joined
+// and peer-left for viewers, at most once per count interval.
+type ParticipantCountMessage struct {
+	Publishers int `json:"publishers"`
+	Viewers    int `json:"viewers"`
+}
+
+// RoomQualityMessage summarizes the connection quality of a room's
+// participants for moderators. Levels counts participants per quality level;
+// loss figures are percentages.
+type RoomQualityMessage struct {
+	RoomID          string         `json:"roomId"`
+	Participants    int            `json:"participants"`
+	Levels          map[string]int `json:"levels"`
+	PoorPercent     float64        `json:"poorPercent"`
+	AvgPacketLoss   float64        `json:"avgPacketLoss"`
+	WorstPeerID     string         `json:"worstPeerId,omitempty"`
+	WorstPacketLoss float64        `json:"worstPacketLoss,omitempty"`
+}
+
+// RenegotiateMessage asks the client to send a new offer. TrackCount is the
+// number of tracks the server is sending, so the client can make sure it has
+// enough recvonly transceivers first. Clients should echo NegotiationID in
+// the offer they send in response.
+type RenegotiateMessage struct {
+	Reason string `json:"reason"`
+	PeerID string `json:"peerId"`
+	// Tracks the peer receives once the exchange completes, in total and
+	// by kind, and the handles of those not yet on a negotiated m-line
+	TrackCount    int      `json:"trackCount"`
+	AudioCount    int      `json:"audioCount"`
+	VideoCount    int      `json:"videoCount"`
+	NewTracks     []string `json:"newTracks,omitempty"`
+	NegotiationID string   `json:"negotiationId,omitempty"`
+}
+
+// DominantSpeakerMessage announces a change of active speaker.
+type DominantSpeakerMessage struct {
+	OldPeerID string `json:"oldPeerId"`
+	NewPeerID string `json:"newPeerId"`
+}
+
+// QualityStatsMessage reports a participant's connection quality; PacketLoss
+// is a percentage.
+type QualityStatsMessage struct {
+	PeerID     string  `json:"peerId"`
+	Level      string  `json:"level"`
+	PacketLoss float64 `json:"packetLoss"`
+}
+
+// ReconnectRequiredMessage tells the client to rejoin with a fresh
+// PeerConnection.
+type ReconnectRequiredMessage struct {
+	PeerID string `json:"peerId"`
+	Reason string `json:"reason"`
+}
+
+// Reasons carried by room-closed.
+const (
+	RoomClosedDeleted        = "deleted"         // removed through the REST API
+	RoomClosedHostEnded      = "host-ended"      // ended for everyone by its host
+	RoomClosedExpired        = "expired"         // cleaned up after standing empty
+	RoomClosedServerShutdown = "server-shutdown" // the SFU is stopping; rejoin elsewhere
+	RoomClosedTimeLimit      = "time-limit"      // its maximum duration ran out
+)
+
+// RoomClosedMessage tells a client its room has been closed. The connection
+// stays open but is no longer in a room.
+type RoomClosedMessage struct {
+	RoomID string `json:"roomId"`
+	Reason string `json:"reason"`
+}
+
+// Reasons carried by time-limit.
+const (
+	TimeLimitWarning  = "warning"  // a warning point before the end passed
+	TimeLimitExtended = "extended" // the limit was moved
+)
+
+// TimeLimitMessage tells a room how long it has left before it is closed
+// with RoomClosedTimeLimit.
+type TimeLimitMessage struct {
+	RoomID      string    `json:"roomId"`
+	Reason      string    `json:"reason"`
+	EndsAt      time.Time `json:"endsAt"`
+	RemainingMs int64     `json:"remainingMs"`
+}
+
+// ExtendTimeLimitMessage asks to move a room's time limit.
+type ExtendTimeLimitMessage struct {
+	ExtendSec int `json:"extendSec"`
+}
+
+// TrackRejectedMessage tells a publisher one of its tracks was not accepted.
+type TrackRejectedMessage struct {
+	TrackID string `json:"trackId"`
+	PeerID  string `json:"peerId"`
+	Reason  string `json:"reason"`
+}
+
+// BitratePolicingMessage warns a publisher that it is sending more than the
+// bitrate cap and packets are being dropped, or that it no longer is. While
+// policing, its busiest track is removed after RemoveInMs unless the rate
+// falls back under the cap.
+type BitratePolicingMessage struct {
+	PeerID      string `json:"peerId"`
+	Policing    bool   `json:"policing"`
+	BitrateKbps int    `json:"bitrateKbps"`
+	CapKbps     int    `json:"capKbps"`
+	RemoveInMs  int64  `json:"removeInMs,omitempty"`
+}
+
+// TrackPausedMessage reports that a track stopped or resumed flowing because
+// its publisher's connection was interrupted. It is the payload of both
+// track-paused and track-resumed.
+type TrackPausedMessage struct {
+	TrackID string `json:"trackId"`
+	PeerID  string `json:"peerId"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Reasons a media-state change was made by the SFU rather than the
+// participant.
+const (
+	MediaStatePushToTalkExpired = "push-to-talk-expired"
+	MediaStateModerator         = "moderator"
+	MediaStateMuteAll           = "mute-all"
+)
+
+// MediaStateRequest reports a client's own media state. A moderator may set
+// PeerID to mute or unmute someone else's mic. Omitted fields are unchanged.
+type MediaStateRequest struct {
+	PeerID        string `json:"peerId,omitempty"`
+	MicEnabled    *bool  `json:"micEnabled,omitempty"`
+	CameraEnabled *bool  `json:"cameraEnabled,omitempty"`
+	ScreenEnabled *bool  `json:"screenEnabled,omitempty"`
+}
+
+// MediaStateMessage is broadcast when a participant's media state changes.
+// PushToTalkMs is how long an unmute lasts before the SFU reverts it.
+type MediaStateMessage struct {
+	PeerID        string `json:"peerId"`
+	UserID        string `json:"userId"`
+	MicEnabled    bool   `json:"micEnabled"`
+	CameraEnabled bool   `json:"cameraEnabled"`
+	ScreenEnabled bool   `json:"screenEnabled"`
+	Reason        string `json:"reason,omitempty"`
+	PushToTalkMs  int64  `json:"pushToTalkMs,omitempty"`
+}
+
+// UpdateNameMessage changes a participant's display name: sent by a client
+// as update-name for itself, or to PATCH /api/rooms/{id}/peers/{peerId}.
+// The rename is announced as peer-updated with the peer's PeerInfo.
+type UpdateNameMessage struct {
+	Name string `json:"name"`
+}
+
+// SubscribeMessage is sent by the client, as subscribe or unsubscribe, with
+// track or codec group handles. TrackIDs is applied as the message type
+// says; Subscribe and Unsubscribe may be used with either type to change
+// several subscriptions at once, with a single renegotiation.
+type SubscribeMessage struct {
+	TrackIDs    []string `json:"trackIds,omitempty"`
+	Subscribe   []string `json:"subscribe,omitempty"`
+	Unsubscribe []string `json:"unsubscribe,omitempty"`
+	// Receive preferences of subscribed tracks, by handle, applied as with
+	// set-receive-preferences before subscribing
+	Preferences map[string]ReceivePreference `json:"preferences,omitempty"`
+}
+
+// ReceivePreference caps what a subscriber receives of a track: simulcast
+// layers larger than it are not picked. Zero fields are unlimited.
+type ReceivePreference struct {
+	MaxWidth     int `json:"maxWidth,omitempty"`
+	MaxHeight    int `json:"maxHeight,omitempty"`
+	MaxFramerate int `json:"maxFramerate,omitempty"`
+}
+
+// IsZero reports whether the preference sets no limit.
+func (p ReceivePreference) IsZero() bool {
+	return p.MaxWidth <= 0 && p.MaxHeight <= 0 && p.MaxFramerate <= 0
+}
+
+// ReceivePreferencesMessage sets (set-receive-preferences) or reports
+// (receive-preferences) the sender's receive preferences, by track or codec
+// group handle. A zero preference clears the track's entry; with Replace,
+// tracks left out are cleared too.
+type ReceivePreferencesMessage struct {
+	Preferences map[string]ReceivePreference `json:"preferences"`
+	Replace     bool                         `json:"replace,omitempty"`
+}
+
+// SubscriptionAckMessage answers subscribe and unsubscribe. TrackIDs lists
+// every change accepted, Subscribed and Unsubscribed split them by
+// direction, and Rejected maps the others to why; a subscribed track
+// arrives with the renegotiation that follows.
+type SubscriptionAckMessage struct {
+	Action       string            `json:"action"` // subscribe or unsubscribe
+	TrackIDs     []string          `json:"trackIds"`
+	Subscribed   []string          `json:"subscribed"`
+	Unsubscribed []string          `json:"unsubscribed"`
+	Rejected     map[string]string `json:"rejected,omitempty"`
+	// Machine-readable causes of rejections that have one, e.g.
+	// ErrorReasonCodecMismatch
+	RejectedReasons map[string]string `json:"rejectedReasons,omitempty"`
+}
+
+// DrainingMessage tells clients the instance is draining and will shut down
+// around Deadline. Clients should keep their session ID and token ready to
+// resume, on AlternateURL when it is set.
+type DrainingMessage struct {
+	Deadline     time.Time `json:"deadline"`
+	AlternateURL string    `json:"alternateUrl,omitempty"`
+}
+
+// IdleWarningMessage tells a peer it looks idle: media is forwarded to it
+// but it has sent no receiver reports, media or signaling for the idle
+// timeout. Any of those clears it; otherwise it is disconnected after
+// DisconnectInMs.
+type IdleWarningMessage struct {
+	PeerID         string `json:"peerId"`
+	DisconnectInMs int64  `json:"disconnectInMs"`
+}
+
+// PeerDrowsyMessage tells the room a peer's connection has gone silent, as
+// a backgrounded tab's does, and is closed after DisconnectInMs unless the
+// client wakes; it is sent again with Drowsy false when it does. UIs may
+// dim the peer's tile meanwhile.
+type PeerDrowsyMessage struct {
+	PeerID         string `json:"peerId"`
+	Drowsy         bool   `json:"drowsy"`
+	DisconnectInMs int64  `json:"disconnectInMs,omitempty"`
+}
+
+// PeerConnectionStateMessage tells the room a peer's media connection has
+// been disconnected or failed for DurationMs since Since, so UIs may show
+// it as reconnecting, or with State "connected" that it came back after an
+// outage of OutageMs.
+type PeerConnectionStateMessage struct {
+	PeerID     string    `json:"peerId"`
+	State      string    `json:"state"`
+	Since      time.Time `json:"since"`
+	DurationMs int64     `json:"durationMs"`
+	OutageMs   int64     `json:"outageMs,omitempty"`
+}
+
+// TrackStalledMessage tells a publisher that one of its negotiated tracks
+// has produced no RTP within the stall window. It is sent again with
+// Stalled false once the track's first packet arrives.
+type TrackStalledMessage struct {
+	TrackID  string `json:"trackId"`
+	Kind     string `json:"kind"`
+	Stalled  bool   `json:"stalled"`
+	WindowMs int64  `json:"windowMs"`
+}
+
+// LayersInUseMessage tells a publisher which simulcast layers of one of its
+// tracks subscribers need. Layers in Paused may be disabled (encoding
+// active=false) until a later message lists them as needed again.
+type LayersInUseMessage struct {
+	TrackID string   `json:"trackId"` // the publisher's own track ID
+	Handle  string   `json:"handle"`
+	RIDs    []string `json:"rids"`
+	Paused  []string `json:"paused"`
+}
+
+// PublishIntentMessage declares, before publishing, which of the client's
+// WebRTC track IDs carry the same source in different codecs, and which
+// replace an already published track (new track ID -> handle or raw track
+// ID of the replaced one).
+type PublishIntentMessage struct {
+	Alternatives [][]string        `json:"alternatives"`
+	Replaces     map[string]string `json:"replaces,omitempty"`
+}
+
+// CodecGroupInfo is one declared group in the publish-intent ack.
+type CodecGroupInfo struct {
+	GroupID  string   `json:"groupId"`
+	TrackIDs []string `json:"trackIds"`
+}
+
+// PublishIntentResponse acknowledges a publish-intent.
+type PublishIntentResponse struct {
+	Groups   []CodecGroupInfo  `json:"groups"`
+	Replaces map[string]string `json:"replaces,omitempty"` // new track ID -> handle it is forwarded under
+}
+
+// TrackPrioritiesMessage sets (set-track-priorities) or announces
+// (track-priorities) the room's layer priorities, keyed by peer ID or track
+// handle. Positive values are favoured, negative demoted, 0 clears an entry.
+type TrackPrioritiesMessage struct {
+	Priorities map[string]int `json:"priorities"`
+	Replace    bool           `json:"replace,omitempty"`
+}
+
+// DataBroadcastMessage is sent by a client to relay Payload to the room's
+// data channels.
+type DataBroadcastMessage struct {
+	Payload     json.RawMessage `json:"payload"`
+	ExcludeSelf bool            `json:"excludeSelf,omitempty"`
+}
+
+// DataBroadcastAckMessage answers data-broadcast with the broadcast's
+// sequence number and how many peers it reached.
+type DataBroadcastAckMessage struct {
+	Seq    uint64 `json:"seq"`
+	Sent   int    `json:"sent"`
+	Queued int    `json:"queued"`
+	Failed int    `json:"failed"`
+}
+
+// RelayMessage is sent by a client to relay Data, which the SFU does not
+// interpret, to PeerID and/or PeerIDs in its room. A reliable relay is
+// answered with relay-ack.
+type RelayMessage struct {
+	PeerID   string          `json:"peerId,omitempty"`
+	PeerIDs  []string        `json:"peerIds,omitempty"`
+	Data     json.RawMessage `json:"data"`
+	Reliable bool            `json:"reliable,omitempty"`
+}
+
+// RelayAckMessage tells the sender of a reliable relay what became of it.
+// Delivered targets had it queued on their connection, forwarded ones were
+// handed to the instance they are connected to, and failed ones could not
+// take it.
+type RelayAckMessage struct {
+	Delivered []string `json:"delivered,omitempty"`
+	Forwarded []string `json:"forwarded,omitempty"`
+	Failed    []string `json:"failed,omitempty"`
+}
+
+// P2POfferPermittedMessage tells each participant of a two-participant room
+// that it may connect directly to Peer. The Initiator sends the first offer.
+type P2POfferPermittedMessage struct {
+	Peer      PeerInfo `json:"peer"`
+	Initiator bool     `json:"initiator"`
+}
+
+// Reasons carried by p2p-fallback.
+const (
+	P2PFallbackParticipantJoined = "participant-joined" // a third participant joined
+	P2PFallbackPeerLeft          = "peer-left"          // the other participant left
+	P2PFallbackSFURequired       = "sfu-required"       // the room needs media to go through the SFU
+)
+
+// P2PFallbackMessage tells the participants of a direct connection to close
+// it and send media through the SFU again.
+type P2PFallbackMessage struct {
+	Peer   string `json:"peerId"` // the other participant of the connection
+	Reason string `json:"reason"`
+}
+
+// RequestKeyframeMessage asks the SFU to request a keyframe from a track's
+// publisher.
+type RequestKeyframeMessage struct {
+	TrackID string `json:"trackId"`
+	FIR     bool   `json:"fir,omitempty"`
+}
+
+// TimeSyncMessage is the data of the pong sent in reply to a client ping.
+// With ClientTS taken when the ping was sent and the pong's arrival time, a
+// client can estimate its clock offset as
+// ((ServerReceivedTS - ClientTS) + (ServerTS - arrival)) / 2.
+// All values are Unix milliseconds.
+type TimeSyncMessage struct {
+	ClientTS         int64 `json:"clientTs,omitempty"`
+	ServerReceivedTS int64 `json:"serverReceivedTs"`
+	ServerTS         int64 `json:"serverTs"`
+}
+
+// JoinQueuedMessage tells a client its join is waiting for the room's
+// earlier joins, and its place in line.
+type JoinQueuedMessage struct {
+	RoomID   string `json:"roomId"`
+	Position int    `json:"position"`
+}
+
+// AllowRenegotiationMessage answers is-allow-renegotiation.
+type AllowRenegotiationMessage struct {
+	Allowed bool `json:"allowed"`
+}
+
+// BandwidthLimitAckMessage acknowledges set-bandwidth-limit with the limit
+// now in force, in bits per second.
+type BandwidthLimitAckMessage struct {
+	Success   bool   `json:"success"`
+	Bandwidth uint32 `json:"bandwidth"`
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
@@ -22,6 +24,41 @@ type PubSubMessage struct {
 	Message    Message `json:"message"`
 }
 
+// Subscription tuning
+const (
+	// pubsubChannelSize is the go-redis buffer between the socket reader and
+	// our consumer.
+	pubsubChannelSize = 256
+	// pubsubHealthCheckInterval is how often go-redis pings an idle
+	// subscription connection so a dead connection is noticed and redialled.
+	pubsubHealthCheckInterval = 15 * time.Second
+	// localDeliveryBuffer bounds messages waiting for delivery to local
+	// clients; beyond it messages are dropped rather than stalling Redis.
+	localDeliveryBuffer = 256
+
+	resubscribeMinBackoff   = 500 * time.Millisecond
+	resubscribeMaxBackoff   = 30 * time.Second
+	subscribeConfirmTimeout = 5 * time.Second
+)
+
+// roomSubscription is the Redis subscription and local delivery queue for
+// one room.
+type roomSubscription struct {
+	sub     *redis.PubSub
+	deliver chan Message
+	live    bool // SUBSCRIBE confirmed on the current connection
+	cancel  context.CancelFunc
+}
+
+// PubSubHealth describes the state of cross-instance signaling.
+type PubSubHealth struct {
+	SubscribedRooms int     `json:"subscribedRooms"`
+	LiveRooms       int     `json:"liveRooms"`
+	LastMessageAge  float64 `json:"lastMessageAgeSec"` // -1 if none received yet
+	Reconnects      uint64  `json:"reconnects"`
+	Dropped         uint64  `json:"dropped"`
+}
+
 // PubSubManager handles Redis pub/sub for cross-instance signaling
 type PubSubManager struct {
 	redis      *redis.Client
@@ -30,7 +67,11 @@ type PubSubManager struct {
 	logger     *zap.Logger
 
 	mu   sync.RWMutex
-	subs map[string]*redis.PubSub // roomID -> subscription
+	subs map[string]*roomSubscription // roomID -> subscription
+
+	lastMessage atomic.Int64 // unix nanos of the last message from Redis
+	reconnects  atomic.Uint64
+	dropped     atomic.Uint64
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -56,7 +97,7 @@ func NewPubSubManager(redisClient *redis.Client, hub *Hub, logger *zap.Logger) *
 		hub:        hub,
 		instanceID: instanceID,
 		logger:     logger,
-		subs:       make(map[string]*redis.PubSub),
+		subs:       make(map[string]*roomSubscription),
 		ctx:        ctx,
 		cancel:     cancel,
 	}
@@ -112,18 +153,22 @@ func (p *PubSubManager) SubscribeToRoom(roomID string) {
 		return // Already subscribed
 	}
 
-	channel := RoomChannel(roomID)
-	sub := p.redis.Subscribe(p.ctx, channel)
-	p.subs[roomID] = sub
+	ctx, cancel := context.WithCancel(p.ctx)
+	rs := &roomSubscription{
+		sub:     p.redis.Subscribe(ctx, RoomChannel(roomID)),
+		deliver: make(chan Message, localDeliveryBuffer),
+		cancel:  cancel,
+	}
+	p.subs[roomID] = rs
 	p.mu.Unlock()
 
 	p.logger.Info("Subscribed to room channel",
 		zap.String("room_id", roomID),
-		zap.String("channel", channel),
+		zap.String("channel", RoomChannel(roomID)),
 	)
 
-	// Start listening in a goroutine
-	go p.listenToChannel(roomID, sub)
+	go p.deliverLoop(ctx, roomID, rs.deliver)
+	go p.listenToChannel(ctx, roomID, rs)
 }
 
 // UnsubscribeFromRoom stops listening to a room's Redis channel
@@ -131,12 +176,13 @@ func (p *PubSubManager) UnsubscribeFromRoom(roomID string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	sub, exists := p.subs[roomID]
+	rs, exists := p.subs[roomID]
 	if !exists {
 		return
 	}
 
-	if err := sub.Close(); err != nil {
+	rs.cancel()
+	if err := rs.sub.Close(); err != nil {
 		p.logger.Warn("Error closing subscription",
 			zap.String("room_id", roomID),
 			zap.Error(err),
@@ -150,37 +196,158 @@ func (p *PubSubManager) UnsubscribeFromRoom(roomID string) {
 	)
 }
 
-// listenToChannel processes messages from a room's Redis channel
-func (p *PubSubManager) listenToChannel(roomID string, sub *redis.PubSub) {
-	ch := sub.Channel()
+// listenToChannel processes messages from a room's Redis channel. go-redis
+// redials a broken connection and re-subscribes on its own; each fresh
+// SUBSCRIBE confirmation after the first is counted as a reconnect. If the
+// channel closes while the room is still subscribed, the subscription is
+// recreated with exponential backoff.
+func (p *PubSubManager) listenToChannel(ctx context.Context, roomID string, rs *roomSubscription) {
+	backoff := resubscribeMinBackoff
+	confirmed := false
+
+	for {
+		ch := rs.sub.ChannelWithSubscriptions(
+			redis.WithChannelSize(pubsubChannelSize),
+			redis.WithChannelHealthCheckInterval(pubsubHealthCheckInterval),
+		)
+
+		for item := range ch {
+			switch v := item.(type) {
+			case *redis.Subscription:
+				live := v.Kind == "subscribe"
+				if live {
+					if confirmed {
+						p.reconnects.Add(1)
+						appmetrics.RecordPubSubReconnect()
+						p.logger.Info("Room channel resubscribed",
+							zap.String("room_id", roomID),
+						)
+					}
+					confirmed = true
+					backoff = resubscribeMinBackoff
+				}
+				p.setLive(roomID, rs, live)
+			case *redis.Message:
+				p.lastMessage.Store(time.Now().UnixNano())
+				p.enqueue(roomID, rs, v)
+			}
+		}
+
+		p.setLive(roomID, rs, false)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// The channel closed underneath us; back off and resubscribe.
+		sub := p.resubscribe(ctx, roomID, &backoff)
+		if sub == nil {
+			return
+		}
+
+		p.mu.Lock()
+		if p.subs[roomID] != rs {
+			p.mu.Unlock()
+			sub.Close()
+			return
+		}
+		rs.sub = sub
+		rs.live = true
+		p.mu.Unlock()
+
+		p.reconnects.Add(1)
+		appmetrics.RecordPubSubReconnect()
+		backoff = resubscribeMinBackoff
+	}
+}
+
+// resubscribe creates a new subscription for a room, retrying with
+// exponential backoff until SUBSCRIBE is confirmed. It returns nil once ctx
+// is cancelled.
+func (p *PubSubManager) resubscribe(ctx context.Context, roomID string, backoff *time.Duration) *redis.PubSub {
+	for {
+		p.logger.Warn("Room channel subscription lost, resubscribing",
+			zap.String("room_id", roomID),
+			zap.Duration("backoff", *backoff),
+		)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*backoff):
+		}
+		*backoff = min(*backoff*2, resubscribeMaxBackoff)
+
+		sub := p.redis.Subscribe(ctx, RoomChannel(roomID))
+		confirmCtx, cancel := context.WithTimeout(ctx, subscribeConfirmTimeout)
+		_, err := sub.Receive(confirmCtx)
+		cancel()
+		if err == nil {
+			return sub
+		}
+
+		sub.Close()
+		p.logger.Warn("Failed to resubscribe to room channel",
+			zap.String("room_id", roomID),
+			zap.Error(err),
+		)
+	}
+}
+
+// setLive records whether a room's subscription is confirmed.
+func (p *PubSubManager) setLive(roomID string, rs *roomSubscription, live bool) {
+	p.mu.Lock()
+	if p.subs[roomID] == rs {
+		rs.live = live
+	}
+	p.mu.Unlock()
+}
+
+// enqueue hands a message to the room's delivery goroutine, dropping it if
+// local delivery is behind so the Redis reader never blocks.
+func (p *PubSubManager) enqueue(roomID string, rs *roomSubscription, redisMsg *redis.Message) {
+	msg, ok := p.decodePubSubMessage(roomID, redisMsg)
+	if !ok {
+		return
+	}
+
+	select {
+	case rs.deliver <- msg:
+	default:
+		p.dropped.Add(1)
+		appmetrics.RecordPubSubDropped()
+		p.logger.Debug("Dropped cross-instance message, local delivery is slow",
+			zap.String("room_id", roomID),
+			zap.String("type", string(msg.Type)),
+		)
+	}
+}
 
+// deliverLoop delivers queued cross-instance messages to local clients.
+func (p *PubSubManager) deliverLoop(ctx context.Context, roomID string, deliver <-chan Message) {
 	for {
 		select {
-		case <-p.ctx.Done():
+		case <-ctx.Done():
 			return
-		case msg, ok := <-ch:
-			if !ok {
-				return
-			}
-			p.handlePubSubMessage(roomID, msg)
+		case msg := <-deliver:
+			p.deliverToLocalClients(roomID, msg)
 		}
 	}
 }
 
-// handlePubSubMessage processes an incoming message from Redis pub/sub
-func (p *PubSubManager) handlePubSubMessage(roomID string, redisMsg *redis.Message) {
+// decodePubSubMessage parses an incoming Redis message, returning false for
+// malformed messages and messages published by this instance
+func (p *PubSubManager) decodePubSubMessage(roomID string, redisMsg *redis.Message) (Message, bool) {
 	var pubMsg PubSubMessage
 	if err := json.Unmarshal([]byte(redisMsg.Payload), &pubMsg); err != nil {
 		p.logger.Warn("Failed to unmarshal pub/sub message",
 			zap.String("room_id", roomID),
 			zap.Error(err),
 		)
-		return
+		return Message{}, false
 	}
 
 	// Ignore messages from this instance (we already handled them locally)
 	if pubMsg.InstanceID == p.instanceID {
-		return
+		return Message{}, false
 	}
 
 	p.logger.Debug("Received cross-instance message",
@@ -189,8 +356,7 @@ func (p *PubSubManager) handlePubSubMessage(roomID string, redisMsg *redis.Messa
 		zap.String("type", string(pubMsg.Message.Type)),
 	)
 
-	// Deliver to local clients in this room
-	p.deliverToLocalClients(roomID, pubMsg.Message)
+	return pubMsg.Message, true
 }
 
 // deliverToLocalClients sends a message to all local clients in a room
@@ -198,8 +364,9 @@ func (p *PubSubManager) deliverToLocalClients(roomID string, msg Message) {
 	clients := p.hub.GetClientsByRoom(roomID)
 
 	for _, client := range clients {
-		// If the message has a specific recipient, only send to them
-		if msg.To != "" && client.ID != msg.To {
+		// If the message has a specific recipient, named by client or peer
+		// ID, only send to them
+		if msg.To != "" && client.ID != msg.To && client.PeerID() != msg.To {
 			continue
 		}
 
@@ -219,8 +386,8 @@ func (p *PubSubManager) Close() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	for roomID, sub := range p.subs {
-		if err := sub.Close(); err != nil {
+	for roomID, rs := range p.subs {
+		if err := rs.sub.Close(); err != nil {
 			p.logger.Warn("Error closing subscription during shutdown",
 				zap.String("room_id", roomID),
 				zap.Error(err),
@@ -228,7 +395,7 @@ func (p *PubSubManager) Close() error {
 		}
 	}
 
-	p.subs = make(map[string]*redis.PubSub)
+	p.subs = make(map[string]*roomSubscription)
 	p.logger.Info("PubSub manager closed")
 
 	return nil
@@ -240,3 +407,23 @@ func (p *PubSubManager) Ping() error {
 	defer cancel()
 	return p.redis.Ping(ctx).Err()
 }
+
+// Health reports subscription liveness and delivery counters
+func (p *PubSubManager) Health() PubSubHealth {
+	p.mu.RLock()
+	health := PubSubHealth{SubscribedRooms: len(p.subs)}
+	for _, rs := range p.subs {
+		if rs.live {
+			health.LiveRooms++
+		}
+	}
+	p.mu.RUnlock()
+
+	health.LastMessageAge = -1
+	if last := p.lastMessage.Load(); last > 0 {
+		health.LastMessageAge = time.Since(time.Unix(0, last)).Seconds()
+	}
+	health.Reconnects = p.reconnects.Load()
+	health.Dropped = p.dropped.Load()
+	return health
+}
@@ -0,0 +1,127 @@
+package signaling
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// newTestPubSub returns a pub/sub manager for instanceID on mr, whose hub
+// has a client in roomID.
+func newTestPubSub(t *testing.T, mr *miniredis.Miniredis, instanceID, roomID string) (*PubSubManager, *Client) {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	hub := NewHub(zap.NewNop())
+	client := NewClient(instanceID+"-client", "user", "User", nil, zap.NewNop())
+	hub.clients[client.ID] = client
+	hub.SetRoom(client, roomID, "peer-"+instanceID)
+
+	pm := NewPubSubManager(rdb, hub, zap.NewNop())
+	pm.instanceID = instanceID
+	t.Cleanup(func() {
+		pm.Close()
+		rdb.Close()
+	})
+	return pm, client
+}
+
+// received reports whether client has been sent a message of type typ.
+func received(client *Client, typ MessageType) bool {
+	for {
+		select {
+		case m := <-client.Send:
+			if m.Type == typ {
+				return true
+			}
+		default:
+			return false
+		}
+	}
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestPubSubResumesAfterRedisRestart(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a, _ := newTestPubSub(t, mr, "a", "room-1")
+	b, bob := newTestPubSub(t, mr, "b", "room-1")
+	b.SubscribeToRoom("room-1")
+
+	// Publishes until one gets through, since a SUBSCRIBE is only live once
+	// Redis has confirmed it
+	deliveredTo := func(c *Client) func() bool {
+		return func() bool {
+			a.PublishToRoom("room-1", Message{Type: MessageTypePeerJoined})
+			return received(c, MessageTypePeerJoined)
+		}
+	}
+	eventually(t, "the first message", deliveredTo(bob))
+	if h := b.Health(); h.LiveRooms != 1 || h.Reconnects != 0 || h.LastMessageAge < 0 {
+		t.Fatalf("health before the restart: %+v", h)
+	}
+
+	mr.Close()
+	eventually(t, "Redis to go away", func() bool { return b.Ping() != nil })
+	for received(bob, MessageTypePeerJoined) {
+		// drop the extra copies delivered before the restart
+	}
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, "delivery to resume", deliveredTo(bob))
+	h := b.Health()
+	if h.SubscribedRooms != 1 || h.LiveRooms != 1 || h.Reconnects == 0 {
+		t.Fatalf("health after the restart: %+v", h)
+	}
+}
+
+func TestPubSubDropsWhenDeliveryIsSlow(t *testing.T) {
+	mr := miniredis.RunT(t)
+	pm, _ := newTestPubSub(t, mr, "a", "room-1")
+	rs := &roomSubscription{deliver: make(chan Message, 2)}
+
+	payload, err := json.Marshal(PubSubMessage{InstanceID: "b", Message: Message{Type: MessageTypePeerJoined}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			pm.enqueue("room-1", rs, &redis.Message{Payload: string(payload)})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the Redis reader blocked on local delivery")
+	}
+	if len(rs.deliver) != 2 || pm.Health().Dropped != 3 {
+		t.Fatalf("%d queued and %d dropped, want 2 and 3", len(rs.deliver), pm.Health().Dropped)
+	}
+
+	// A message this instance published is not delivered again
+	own, err := json.Marshal(PubSubMessage{InstanceID: "a", Message: Message{Type: MessageTypePeerJoined}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-rs.deliver
+	pm.enqueue("room-1", rs, &redis.Message{Payload: string(own)})
+	if len(rs.deliver) != 1 {
+		t.Fatal("own message queued for delivery")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
@@ -31,6 +32,7 @@ const (
 	MessageTypePong             MessageType = "pong"
 	MessageTypeLayerSwitch      MessageType = "layer-switch"
 	MessageTypeLayerAvailable   MessageType = "layer-available"
+	MessageTypeRequestKeyframe  MessageType = "request-keyframe"
 	MessageTypeDominantSpeaker  MessageType = "dominant-speaker"
 	MessageTypeQualityStats     MessageType = "quality-stats"
 	MessageTypeICERestartRequest MessageType = "ice-restart-request"
@@ -39,6 +41,113 @@ const (
 	MessageTypeSubscribe        MessageType = "subscribe"
 	MessageTypeUnsubscribe      MessageType = "unsubscribe"
 	MessageTypeSubscriptionAck  MessageType = "subscription-ack"
+	MessageTypeTrackRejected    MessageType = "track-rejected"
+
+	// Sent when renegotiation cannot recover; the client must rejoin from scratch
+	MessageTypeReconnectRequired MessageType = "reconnect-required"
+
+	// Publisher connection interrupted / recovered within the disconnect grace
+	MessageTypeTrackPaused  MessageType = "track-paused"
+	MessageTypeTrackResumed MessageType = "track-resumed"
+
+	// A published track negotiated but produced no RTP, or has since started
+	MessageTypeTrackStalled MessageType = "track-stalled"
+
+	// Tells a publisher which simulcast layers of a track are in use
+	MessageTypeLayersInUse MessageType = "layers-in-use"
+
+	// Declares codec alternatives before publishing; acked with the group IDs
+	MessageTypePublishIntent MessageType = "publish-intent"
+
+	// Room-wide simulcast layer priorities (moderators only)
+	MessageTypeSetTrackPriorities MessageType = "set-track-priorities"
+	MessageTypeTrackPriorities    MessageType = "track-priorities"
+
+	// Join admission progress while waiting in the join queue
+	MessageTypeJoinQueued MessageType = "join-queued"
+
+	// Mic, camera and screen state: reported by clients, broadcast on change.
+	// unmute-requested asks moderators to approve a self-unmute.
+	MessageTypeMediaState       MessageType = "media-state"
+	MessageTypeUnmuteRequested MessageType = "unmute-requested"
+
+	// Display name changes: update-name renames the sender's own peer and
+	// peer-updated announces a rename to the room
+	MessageTypeUpdateName  MessageType = "update-name"
+	MessageTypePeerUpdated MessageType = "peer-updated"
+
+	// The room's host: transfer-host is sent by the host to hand the role
+	// on, host-changed announces every change
+	MessageTypeTransferHost MessageType = "transfer-host"
+	MessageTypeHostChanged  MessageType = "host-changed"
+
+	// Host controls: mute-all mutes every participant but the exempt ones
+	// and spotlight pins one participant's video; the *-changed messages
+	// announce the room's state to everyone
+	MessageTypeMuteAll          MessageType = "mute-all"
+	MessageTypeMuteAllChanged   MessageType = "mute-all-changed"
+	MessageTypeSpotlight        MessageType = "spotlight"
+	MessageTypeSpotlightChanged MessageType = "spotlight-changed"
+
+	// The host locks the room against new participants with lock-room;
+	// room-lock-changed announces every change
+	MessageTypeLockRoom        MessageType = "lock-room"
+	MessageTypeRoomLockChanged MessageType = "room-lock-changed"
+
+	// Sent to a resumed peer after its first answer: which publisher and
+	// track each forwarded m-line carries
+	MessageTypeSubscriptionSnapshot MessageType = "subscription-snapshot"
+
+	// Sent to a peer whose publishing window ended: its tracks were removed
+	// and it stays as a viewer
+	MessageTypePublishExpired MessageType = "publish-expired"
+
+	// Sent to every client when the instance starts draining for shutdown
+	MessageTypeDraining MessageType = "draining"
+
+	// Publisher and viewer counts of a broadcast room, sent as they change
+	MessageTypeParticipantCount MessageType = "participant-count"
+
+	// Connection quality of the room's participants (moderators only), sent
+	// as the number of peers at a level changes
+	MessageTypeRoomQuality MessageType = "room-quality"
+
+	// Sent to a publisher when policing for exceeding the bitrate cap starts
+	// and ends
+	MessageTypeBitratePolicing MessageType = "bitrate-policing"
+
+	// Sent to a peer found idle, before it is disconnected
+	MessageTypeIdleWarning MessageType = "idle-warning"
+
+	// A peer's connection went silent, as a backgrounded tab does, or woke
+	MessageTypePeerDrowsy MessageType = "peer-drowsy"
+
+	// A peer's media connection dropped, or came back after dropping
+	MessageTypePeerConnectionState MessageType = "peer-connection-state"
+
+	// Sent to every client in a room before the room is closed
+	MessageTypeRoomClosed MessageType = "room-closed"
+
+	// A room's time limit is near or was extended; extend-time-limit moves
+	// it (moderators only)
+	MessageTypeTimeLimit       MessageType = "time-limit"
+	MessageTypeExtendTimeLimit MessageType = "extend-time-limit"
+
+	// Low-latency messages relayed to the room over data channels
+	MessageTypeDataBroadcast MessageType = "data-broadcast"
+
+	// App-specific events a client sends to chosen peers of its room; the
+	// SFU forwards the opaque data with From set. relay-ack answers a
+	// reliable relay
+	MessageTypeRelay    MessageType = "relay"
+	MessageTypeRelayAck MessageType = "relay-ack"
+
+	// Direct connections in two-participant rooms: permitted and ended by
+	// the SFU, negotiated with p2p-relay messages it forwards between the
+	// two (To names the other peer, From is set by the SFU)
+	MessageTypeP2POfferPermitted MessageType = "p2p-offer-permitted"
+	MessageTypeP2PFallback       MessageType = "p2p-fallback"
+	MessageTypeP2PRelay          MessageType = "p2p-relay"
 
 	// Renegotiation coordination (inLive SFU pattern)
 	MessageTypeIsAllowRenegotiation MessageType = "is-allow-renegotiation"
@@ -47,27 +156,80 @@ const (
 	// Network and bandwidth management
 	MessageTypeNetworkCondition  MessageType = "network-condition"
 	MessageTypeSetBandwidthLimit MessageType = "set-bandwidth-limit"
+
+	// The largest picture a client wants of each track it receives;
+	// receive-preferences answers with the resulting preferences
+	MessageTypeSetReceivePreferences MessageType = "set-receive-preferences"
+	MessageTypeReceivePreferences    MessageType = "receive-preferences"
 )
 
+// Message is the signaling envelope. Timestamp is server time, kept for older
+// clients. ServerTS (Unix milliseconds) is stamped when a message is written
+// or read, and Seq numbers outgoing messages in the order they are written.
+// RoomSeq numbers a room's broadcasts in the order the room dispatched them;
+// it survives pub/sub, so clients on any instance can order by it.
+// ClientTS is the sender's own clock, echoed back on replies that carry it.
 type Message struct {
 	Type      MessageType     `json:"type"`
 	Data      json.RawMessage `json:"data,omitempty"`
 	Timestamp time.Time       `json:"timestamp"`
 	From      string          `json:"from,omitempty"`
 	To        string          `json:"to,omitempty"`
+	ServerTS  int64           `json:"serverTs,omitempty"`
+	ClientTS  int64           `json:"clientTs,omitempty"`
+	Seq       uint64          `json:"seq,omitempty"`
+	RoomSeq   uint64          `json:"roomSeq,omitempty"`
+	// The membership the message is for, when not the connection's own
+	// room (see membership.go)
+	MembershipID string `json:"membershipId,omitempty"`
 }
 
+// outgoingSeq numbers every message written by this instance. It is shared
+// by all connections, so a client that reconnects keeps seeing it increase.
+var outgoingSeq atomic.Uint64
+
 type JoinMessage struct {
-	RoomID   string                 `json:"roomId"`
-	UserID   string                 `json:"userId"`
-	Name     string                 `json:"name"`
-	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	RoomID      string                 `json:"roomId"`
+	UserID      string                 `json:"userId"`
+	Name        string                 `json:"name"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	InviteToken string                 `json:"inviteToken,omitempty"`
+	// Observer joins hidden and receive-only; requires an observer or admin
+	// invite (or a resumed observer session).
+	Observer bool `json:"observer,omitempty"`
+	// NoTrickle is for clients that cannot trickle ICE: answers and server
+	// offers carry every candidate and no ice-candidate messages are sent.
+	NoTrickle bool `json:"noTrickle,omitempty"`
+	// AutoSubscribe overrides the server's SFU_AUTO_SUBSCRIBE default. When
+	// false the first answer carries no forwarded tracks and the client
+	// sends subscribe for the ones it wants.
+	AutoSubscribe *bool `json:"autoSubscribe,omitempty"`
+	// Reattach asks, on a resumed session, to keep the PeerConnection the
+	// client still holds. If the SFU kept the peer across the reconnect the
+	// new connection takes it over, and a failed connection gets an
+	// ice-restart-offer instead of a fresh negotiation.
+	Reattach bool `json:"reattach,omitempty"`
+	// RelayOnly restricts the peer's ICE to TURN relay candidates, so
+	// neither side's addresses are exposed. The join is refused when no
+	// TURN server is configured.
+	RelayOnly bool `json:"relayOnly,omitempty"`
+	// Membership joins the room as a further membership of the connection,
+	// keeping the room it is already in
+	Membership bool `json:"membership,omitempty"`
+	// PreferredRegion asks for the room, if it does not exist yet, to be
+	// created on an instance in this region
+	PreferredRegion string `json:"preferredRegion,omitempty"`
 }
 
 type OfferMessage struct {
 	SDP    string `json:"sdp"`
 	Type   string `json:"type"`
 	PeerID string `json:"peerId"`
+	// NoTrickle asks for an answer carrying every candidate instead of
+	// trickled ice-candidate messages, for this and later negotiations
+	NoTrickle bool `json:"noTrickle,omitempty"`
+	// Echoes the renegotiate message this offer responds to, if any
+	NegotiationID string `json:"negotiationId,omitempty"`
 }
 
 type AnswerMessage struct {
@@ -86,29 +248,139 @@ type ICECandidateMessage struct {
 type ErrorMessage struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+
+	// Set for transient failures the client should retry after a backoff
+	Retryable    bool  `json:"retryable,omitempty"`
+	RetryAfterMs int64 `json:"retryAfterMs,omitempty"`
+
+	// Machine-readable cause, e.g. ErrorReasonCapacityExceeded
+	Reason string `json:"reason,omitempty"`
+	// Cluster instance that already hosts the room, if any
+	AlternateInstance string `json:"alternateInstance,omitempty"`
+	// Where a draining instance sends clients, if configured
+	AlternateURL string `json:"alternateUrl,omitempty"`
+	// Region of the instance a redirect points at
+	Region string `json:"region,omitempty"`
+	// Message class whose rate limit was exceeded, with ErrorReasonRateLimited
+	RateLimitClass string `json:"rateLimitClass,omitempty"`
+	// Track the error is about, with ErrorReasonCodecMismatch
+	TrackID string `json:"trackId,omitempty"`
 }
 
+// ErrorReasonCapacityExceeded means the instance cannot host another room.
+const ErrorReasonCapacityExceeded = "capacity_exceeded"
+
+// ErrorReasonDraining means the instance is draining and creates no rooms.
+const ErrorReasonDraining = "draining"
+
+// ErrorReasonRelayUnavailable means a relay-only join was refused because no
+// TURN server is configured.
+const ErrorReasonRelayUnavailable = "relay_unavailable"
+
+// ErrorReasonNotAuthorized means the authorizer refused a join.
+const ErrorReasonNotAuthorized = "not_authorized"
+
+// ErrorReasonPeerNotFound means a message named a peer that is not in the
+// sender's room.
+const ErrorReasonPeerNotFound = "peer_not_found"
+
+// ErrorReasonPeerUnavailable means a message named a peer of the room that
+// cannot be reached right now, such as one whose connection dropped and is
+// held for a resume.
+const ErrorReasonPeerUnavailable = "peer_unavailable"
+
+// ErrorReasonRateLimited means a message was dropped for exceeding the rate
+// limit of its class, named in RateLimitClass.
+const ErrorReasonRateLimited = "rate_limited"
+
+// ErrorReasonICERestartCooldown means an ICE restart was refused because the
+// previous one is too recent; RetryAfterMs says when to ask again.
+const ErrorReasonICERestartCooldown = "ice_restart_cooldown"
+
+// ErrorReasonReconnectRequired means the peer's connection cannot be
+// recovered in place: the client has to drop it and join again.
+const ErrorReasonReconnectRequired = "reconnect_required"
+
+// ErrorReasonHardMuted means a self-unmute was refused because the host
+// muted everyone and did not let participants unmute themselves.
+const ErrorReasonHardMuted = "hard_muted"
+
+// ErrorReasonRedirect means the room is hosted, or is to be created, on
+// another instance: join again at AlternateURL, or at AlternateInstance
+// through the load balancer.
+const ErrorReasonRedirect = "redirect"
+
+// ErrorReasonRoomElsewhere means the room is hosted, or being created, by
+// another instance the client cannot be sent to, named in
+// AlternateInstance. Joining again after RetryAfterMs may reach it through
+// the load balancer.
+const ErrorReasonRoomElsewhere = "room_elsewhere"
+
+// ErrorReasonRoomLocked means a join was refused because the host locked the
+// room and the user was not in it.
+const ErrorReasonRoomLocked = "room_locked"
+
+// ErrorReasonCodecMismatch means a track was not forwarded because the
+// subscriber negotiated its audio codec only at another clock rate, which it
+// would play back broken; TrackID names the track.
+const ErrorReasonCodecMismatch = "codec_mismatch"
+
 type Client struct {
 	ID     string          `json:"id"`
 	UserID string          `json:"userId"`
-	RoomID string          `json:"roomId"`
 	Name   string          `json:"name"`
 	Conn   *websocket.Conn `json:"-"`
 	Send   chan Message     `json:"-"`
 
+	// The instance's URLs as the client reached them; see JoinResponse
+	WSURL  string `json:"-"`
+	APIURL string `json:"-"`
+	// Bearer token from the handshake, handed to the authorizer
+	Token string `json:"-"`
+	// The client's IP address, from X-Forwarded-For with trusted proxy
+	// headers (see SFU.requestIP)
+	RemoteIP string `json:"-"`
+
 	// State
 	Connected bool      `json:"connected"`
 	LastPing  time.Time `json:"lastPing"`
 
+	// The room and the peer this connection joined as, set through the
+	// hub and read through RoomID and PeerID
+	bindingMu sync.RWMutex
+	roomID    string
+	peerID    string
+
+	// Unix nanoseconds of the last message other than a keepalive
+	lastActivity atomic.Int64
+
+	// Set by an explicit leave, until the client joins again
+	left atomic.Bool
+
+	// Silence from a sleeping tab (see drowsy.go)
+	drowsiness drowsiness
+
+	// Memberships in further rooms, or, for a membership, its connection
+	// and ID (see membership.go); memberships is guarded by mu
+	memberships  map[string]*Client
+	parent       *Client
+	membershipID string
+
 	// Synchronization
 	mu        sync.RWMutex
 	closeOnce sync.Once
 	closed    atomic.Bool
 	logger    *zap.Logger
 
+	// Held to send on Send from outside the hub, and to close it
+	sendMu sync.RWMutex
+
 	// Callbacks
 	OnMessage    func(*Client, Message)
 	OnDisconnect func(*Client)
+	// OnDrowsy fires on the connection becoming drowsy, with the time left
+	// before it is closed, and on it waking
+	OnDrowsy func(c *Client, drowsy bool, disconnectIn time.Duration)
 }
 
 type Hub struct {
@@ -170,6 +442,9 @@ func (h *Hub) Run() {
 		case message := <-h.broadcast:
 			h.mu.RLock()
 			for _, client := range h.clients {
+				if client.parent != nil {
+					continue // reached through its connection
+				}
 				if message.To == "" || message.To == client.ID {
 					select {
 					case client.Send <- message:
@@ -194,7 +469,9 @@ func (h *Hub) pingClients() {
 	h.mu.RLock()
 	clients := make([]*Client, 0, len(h.clients))
 	for _, client := range h.clients {
-		clients = append(clients, client)
+		if client.parent == nil {
+			clients = append(clients, client)
+		}
 	}
 	h.mu.RUnlock()
 
@@ -232,6 +509,13 @@ func (h *Hub) SendToClient(clientID string, message Message) {
 	h.broadcast <- message
 }
 
+// ClientCount returns the number of registered clients.
+func (h *Hub) ClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
 func (h *Hub) GetClient(clientID string) (*Client, bool) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -246,7 +530,49 @@ func (h *Hub) GetClientsByRoom(roomID string) []*Client {
 
 	clients := make([]*Client, 0)
 	for _, client := range h.clients {
-		if client.RoomID == roomID {
+		if client.RoomID() == roomID {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// SetRoom binds client to peerID in roomID, or unbinds it given empty IDs.
+// The hub reads the binding while routing, so it is set under the hub's
+// lock.
+func (h *Hub) SetRoom(client *Client, roomID, peerID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	client.bind(roomID, peerID)
+}
+
+// DetachRoom takes every client in roomID out of the room, leaving their
+// connections open, and returns them.
+func (h *Hub) DetachRoom(roomID string) []*Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	clients := make([]*Client, 0)
+	for _, client := range h.clients {
+		if client.RoomID() == roomID {
+			client.bind("", "")
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// DetachPeer takes every client bound to peerID, except excludeClientID, out
+// of its room, leaving their connections open, and returns them. Closing
+// them afterwards does not take the peer with them.
+func (h *Hub) DetachPeer(peerID, excludeClientID string) []*Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	clients := make([]*Client, 0)
+	for _, client := range h.clients {
+		if client.PeerID() == peerID && client.ID != excludeClientID {
+			client.bind("", "")
 			clients = append(clients, client)
 		}
 	}
@@ -254,26 +580,28 @@ func (h *Hub) GetClientsByRoom(roomID string) []*Client {
 }
 
 // DisconnectClientsByUserID closes and unregisters all existing clients for a
-// given userID, except the one with excludeClientID. This handles the page-refresh
-// scenario where a new WS connection arrives before the old one is cleaned up.
+// given userID, except the connection of excludeClientID and its memberships.
+// This handles the page-refresh scenario where a new WS connection arrives
+// before the old one is cleaned up.
 func (h *Hub) DisconnectClientsByUserID(userID, excludeClientID string) {
+	keep := connectionID(excludeClientID)
 	h.mu.RLock()
 	var stale []*Client
 	for _, c := range h.clients {
-		if c.UserID == userID && c.ID != excludeClientID {
+		if c.UserID == userID && connectionID(c.ID) != keep {
 			stale = append(stale, c)
 		}
 	}
 	h.mu.RUnlock()
 
 	for _, c := range stale {
-		c.Conn.Close()
+		c.Close()
 		h.unregister <- c
 	}
 }
 
 func NewClient(id, userID, name string, conn *websocket.Conn, logger *zap.Logger) *Client {
-	return &Client{
+	c := &Client{
 		ID:        id,
 		UserID:    userID,
 		Name:      name,
@@ -283,12 +611,20 @@ func NewClient(id, userID, name string, conn *websocket.Conn, logger *zap.Logger
 		LastPing:  time.Now(),
 		logger:    logger,
 	}
+	c.lastActivity.Store(c.LastPing.UnixNano())
+	c.drowsiness.lastMessage.Store(c.LastPing.UnixNano())
+	return c
 }
 
 func (c *Client) closeSend() {
 	c.closeOnce.Do(func() {
+		c.sendMu.Lock()
+		defer c.sendMu.Unlock()
 		c.closed.Store(true)
-		close(c.Send)
+		// A membership sends through its connection
+		if c.parent == nil {
+			close(c.Send)
+		}
 	})
 }
 
@@ -301,9 +637,9 @@ func (c *Client) ReadPump() {
 	}()
 
 	c.Conn.SetReadLimit(524288) // 512KB — SDP with multiple transceivers can be large
-	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.Conn.SetPongHandler(func(string) error {
-		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		c.heardPong()
 		return nil
 	})
 
@@ -322,6 +658,12 @@ func (c *Client) ReadPump() {
 
 		message.From = c.ID
 		message.Timestamp = time.Now()
+		message.ServerTS = message.Timestamp.UnixMilli()
+		message.Seq = 0
+		c.heard(message.Timestamp)
+		if message.Type != MessageTypePing && message.Type != MessageTypePong {
+			c.lastActivity.Store(message.Timestamp.UnixNano())
+		}
 
 		if c.OnMessage != nil {
 			c.OnMessage(c, message)
@@ -331,6 +673,16 @@ func (c *Client) ReadPump() {
 
 func (c *Client) WritePump() {
 	ticker := time.NewTicker(54 * time.Second)
+	var drowsyCheck <-chan time.Time
+	if c.drowsiness.after > 0 {
+		interval := drowsyCheckInterval
+		if half := c.drowsiness.after / 2; half > 0 && half < interval {
+			interval = half
+		}
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		drowsyCheck = t.C
+	}
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
@@ -345,7 +697,25 @@ func (c *Client) WritePump() {
 				return
 			}
 
-			if err := c.Conn.WriteJSON(message); err != nil {
+			now := time.Now()
+			if message.Timestamp.IsZero() {
+				message.Timestamp = now
+			}
+			message.ServerTS = now.UnixMilli()
+			message.Seq = outgoingSeq.Add(1)
+			buf, err := encodeMessage(&message)
+			if err != nil {
+				c.logger.Error("Failed to encode message",
+					zap.String("clientID", c.ID),
+					zap.String("type", string(message.Type)),
+					zap.Error(err),
+				)
+				continue
+			}
+			err = c.Conn.WriteMessage(websocket.TextMessage, *buf)
+			appmetrics.RecordSignalingSent(string(message.Type), len(*buf))
+			releaseBuffer(buf)
+			if err != nil {
 				c.logger.Error("Failed to write message",
 					zap.String("clientID", c.ID),
 					zap.Error(err),
@@ -358,20 +728,95 @@ func (c *Client) WritePump() {
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+
+		case now := <-drowsyCheck:
+			c.checkDrowsy(now)
 		}
 	}
 }
 
+// CloseWithCode sends a close frame with code and reason and closes the
+// connection; the read pump then unregisters the client as usual.
+func (c *Client) CloseWithCode(code int, reason string) {
+	c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	c.Conn.Close()
+}
+
+// SetLeft records whether the client left its room explicitly.
+func (c *Client) SetLeft(left bool) {
+	c.left.Store(left)
+}
+
+// Left reports whether the client sent a leave since its last join.
+func (c *Client) Left() bool {
+	return c.left.Load()
+}
+
+// RoomID returns the room the client is in, or "" outside of one.
+func (c *Client) RoomID() string {
+	c.bindingMu.RLock()
+	defer c.bindingMu.RUnlock()
+	return c.roomID
+}
+
+// PeerID returns the peer the client joined as, or "" outside of a room.
+func (c *Client) PeerID() string {
+	c.bindingMu.RLock()
+	defer c.bindingMu.RUnlock()
+	return c.peerID
+}
+
+func (c *Client) bind(roomID, peerID string) {
+	c.bindingMu.Lock()
+	defer c.bindingMu.Unlock()
+	c.roomID = roomID
+	c.peerID = peerID
+}
+
+// LastActivity returns when the client, or a membership's connection, last
+// sent a message other than a keepalive.
+func (c *Client) LastActivity() time.Time {
+	if c.parent != nil {
+		return c.parent.LastActivity()
+	}
+	return time.Unix(0, c.lastActivity.Load())
+}
+
 func (c *Client) SendMessage(message Message) {
+	c.TrySendMessage(message)
+}
+
+// TrySendMessage queues message like SendMessage and reports whether it was
+// queued; it is not when the client is closed or its send channel is full.
+func (c *Client) TrySendMessage(message Message) bool {
 	if c.closed.Load() {
-		return
+		return false
+	}
+	if c.parent != nil {
+		message.MembershipID = c.membershipID
+		return c.parent.TrySendMessage(message)
+	}
+	if handled, kept := c.holdIfDrowsy(message); handled {
+		return kept
+	}
+	return c.enqueue(message)
+}
+
+// enqueue puts message on the send channel unless it is full or closed.
+func (c *Client) enqueue(message Message) bool {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+	if c.closed.Load() {
+		return false
 	}
 	select {
 	case c.Send <- message:
+		return true
 	default:
 		c.logger.Warn("Client send channel full, dropping message",
 			zap.String("clientID", c.ID),
 		)
+		return false
 	}
 }
 
@@ -396,6 +841,31 @@ func (c *Client) SendError(code int, msg string) {
 	c.SendMessage(message)
 }
 
+// SendRetryableError sends an error the client should retry after retryAfter.
+func (c *Client) SendRetryableError(code int, msg string, retryAfter time.Duration) {
+	c.SendErrorMessage(ErrorMessage{
+		Code:         code,
+		Message:      msg,
+		Retryable:    true,
+		RetryAfterMs: retryAfter.Milliseconds(),
+	})
+}
+
+// SendErrorMessage sends a fully populated error message.
+func (c *Client) SendErrorMessage(errorMsg ErrorMessage) {
+	data, err := json.Marshal(errorMsg)
+	if err != nil {
+		c.logger.Error("Failed to marshal error message", zap.Error(err))
+		return
+	}
+
+	c.SendMessage(Message{
+		Type:      MessageTypeError,
+		Data:      data,
+		Timestamp: time.Now(),
+	})
+}
+
 func HandleWebSocket(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
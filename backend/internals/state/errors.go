@@ -0,0 +1,37 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// ConnectErrorCause classifies a failed Redis connection for logs and
+// health reports: "auth", "dns", "timeout", "refused" or "other".
+func ConnectErrorCause(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	msg := err.Error()
+	for _, marker := range []string{"NOAUTH", "WRONGPASS", "ERR AUTH", "invalid password", "invalid username-password"} {
+		if strings.Contains(msg, marker) {
+			return "auth"
+		}
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return "dns"
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return "refused"
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return "timeout"
+	}
+	return "other"
+}
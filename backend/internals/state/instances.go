@@ -0,0 +1,111 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// InstanceRecord is an SFU instance as advertised in the cluster registry:
+// where it runs, how clients reach it and how loaded it is. Instances
+// refresh their record with the room heartbeat, so a crashed instance's
+// record expires with its TTL.
+type InstanceRecord struct {
+	InstanceID string    `json:"instance_id"`
+	Region     string    `json:"region,omitempty"`
+	URL        string    `json:"url,omitempty"` // base URL clients reach it at
+	Rooms      int       `json:"rooms"`
+	MaxRooms   int       `json:"max_rooms"`
+	Peers      int       `json:"peers"`
+	Draining   bool      `json:"draining,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// HasCapacity reports whether the instance can take another room.
+func (r *InstanceRecord) HasCapacity() bool {
+	return !r.Draining && (r.MaxRooms <= 0 || r.Rooms < r.MaxRooms)
+}
+
+// Load is the share of its room limit the instance uses.
+func (r *InstanceRecord) Load() float64 {
+	if r.MaxRooms <= 0 {
+		return 0
+	}
+	return float64(r.Rooms) / float64(r.MaxRooms)
+}
+
+// SetInstance writes an instance record with the given TTL
+func (m *Manager) SetInstance(ctx context.Context, record *InstanceRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := m.redis.Set(ctx, InstanceKey(record.InstanceID), data, ttl).Err(); err != nil {
+		m.logger.Error("Failed to register instance",
+			zap.String("instance_id", record.InstanceID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// DeleteInstance removes an instance from the registry
+func (m *Manager) DeleteInstance(ctx context.Context, instanceID string) error {
+	return m.redis.Del(ctx, InstanceKey(instanceID)).Err()
+}
+
+// GetInstance returns an instance's record, or nil if it is not registered
+func (m *Manager) GetInstance(ctx context.Context, instanceID string) (*InstanceRecord, error) {
+	data, err := m.redis.Get(ctx, InstanceKey(instanceID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var record InstanceRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ListInstances scans Redis for every registered instance
+func (m *Manager) ListInstances(ctx context.Context) ([]*InstanceRecord, error) {
+	var records []*InstanceRecord
+	var cursor uint64
+
+	for {
+		keys, nextCursor, err := m.redis.Scan(ctx, cursor, KeyPrefixInstance+"*", 100).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			data, err := m.redis.Get(ctx, key).Bytes()
+			if err != nil {
+				if err != redis.Nil {
+					m.logger.Warn("Failed to get instance record", zap.String("key", key), zap.Error(err))
+				}
+				continue
+			}
+			var record InstanceRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				m.logger.Warn("Failed to unmarshal instance record", zap.String("key", key), zap.Error(err))
+				continue
+			}
+			records = append(records, &record)
+		}
+
+		cursor = nextCursor
+		if cursor == 0 {
+			break
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,203 @@
+package state
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// ErrInviteInvalid is returned when an invite token is unknown, expired,
+// already used, or issued for a different room.
+var ErrInviteInvalid = errors.New("invite is invalid or expired")
+
+// InviteData is a room invite stored in Redis under InviteKey(token).
+type InviteData struct {
+	Token     string `json:"token"`
+	RoomID    string `json:"room_id"`
+	SingleUse bool   `json:"single_use"`
+	Role      string `json:"role,omitempty"`
+	Name      string `json:"name,omitempty"`
+	RelayOnly bool   `json:"relay_only,omitempty"` // the participant may only use TURN relay
+	// PublishForSec limits publishing to this many seconds after the
+	// invite is first redeemed; the participant then stays as a viewer
+	PublishForSec int       `json:"publish_for_sec,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	// RedeemedAt is when an invite with a publishing window was first
+	// redeemed, as ConsumeInvite found it; it is kept beside the invite
+	RedeemedAt time.Time `json:"-"`
+}
+
+// consumeInviteScript atomically reads an invite, checks it belongs to the
+// room and deletes it if it is single-use, so that when clients race on the
+// same one-time token (even across instances) exactly one of them gets it.
+// For an invite with a publishing window it also records the first
+// redemption, ARGV[2], unless one is recorded already, and keeps it until the
+// invite has expired and the window has ended. It returns the invite and the
+// first redemption.
+var consumeInviteScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if not v then
+	return false
+end
+local d = cjson.decode(v)
+if d['room_id'] ~= ARGV[1] then
+	return false
+end
+local redeemed = false
+local window = tonumber(d['publish_for_sec']) or 0
+if window > 0 then
+	local ttl = math.max(redis.call('PTTL', KEYS[1]), 0) + window * 1000
+	redis.call('SET', KEYS[3], ARGV[2], 'NX', 'PX', ttl)
+	redeemed = redis.call('GET', KEYS[3])
+end
+if d['single_use'] then
+	redis.call('DEL', KEYS[1])
+	redis.call('SREM', KEYS[2], d['token'])
+end
+return {v, redeemed}
+`)
+
+// CreateInvite stores a new invite for a room that expires after ttl
+func (m *Manager) CreateInvite(ctx context.Context, roomID string, ttl time.Duration, singleUse bool, role, name string, relayOnly bool, publishFor time.Duration) (*InviteData, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	invite := &InviteData{
+		Token:         hex.EncodeToString(b),
+		RoomID:        roomID,
+		SingleUse:     singleUse,
+		Role:          role,
+		Name:          name,
+		RelayOnly:     relayOnly,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(ttl),
+		PublishForSec: int(publishFor / time.Second),
+	}
+
+	data, err := json.Marshal(invite)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := m.redis.TxPipeline()
+	pipe.Set(ctx, InviteKey(invite.Token), data, ttl)
+	pipe.SAdd(ctx, RoomInvitesKey(roomID), invite.Token)
+	if _, err := pipe.Exec(ctx); err != nil {
+		m.logger.Error("Failed to persist invite",
+			zap.String("room_id", roomID),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+// ConsumeInvite validates an invite for roomID, deleting it if single-use
+func (m *Manager) ConsumeInvite(ctx context.Context, token, roomID string) (*InviteData, error) {
+	res, err := consumeInviteScript.Run(ctx, m.redis,
+		[]string{InviteKey(token), RoomInvitesKey(roomID), InviteRedeemedKey(token)},
+		roomID, time.Now().UnixMilli()).Slice()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrInviteInvalid
+		}
+		return nil, err
+	}
+
+	data, _ := res[0].(string)
+	var invite InviteData
+	if err := json.Unmarshal([]byte(data), &invite); err != nil {
+		return nil, err
+	}
+	if redeemed, ok := res[1].(string); ok {
+		if ms, err := strconv.ParseInt(redeemed, 10, 64); err == nil {
+			invite.RedeemedAt = time.UnixMilli(ms)
+		}
+	}
+	return &invite, nil
+}
+
+// RestoreInvite puts back a single-use invite taken by ConsumeInvite for a
+// join that was then turned away, unless it has expired meanwhile. Its
+// publishing window starts again with the next redemption
+func (m *Manager) RestoreInvite(ctx context.Context, invite *InviteData) error {
+	ttl := time.Until(invite.ExpiresAt)
+	if !invite.SingleUse || ttl <= 0 {
+		return nil
+	}
+	data, err := json.Marshal(invite)
+	if err != nil {
+		return err
+	}
+
+	pipe := m.redis.TxPipeline()
+	pipe.SetNX(ctx, InviteKey(invite.Token), data, ttl)
+	pipe.SAdd(ctx, RoomInvitesKey(invite.RoomID), invite.Token)
+	pipe.Del(ctx, InviteRedeemedKey(invite.Token))
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// ListInvites returns the outstanding invites for a room, pruning tokens
+// whose keys have already expired
+func (m *Manager) ListInvites(ctx context.Context, roomID string) ([]*InviteData, error) {
+	setKey := RoomInvitesKey(roomID)
+	tokens, err := m.redis.SMembers(ctx, setKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	invites := make([]*InviteData, 0, len(tokens))
+	for _, token := range tokens {
+		data, err := m.redis.Get(ctx, InviteKey(token)).Bytes()
+		if err != nil {
+			if err == redis.Nil {
+				m.redis.SRem(ctx, setKey, token)
+				continue
+			}
+			return nil, err
+		}
+
+		var invite InviteData
+		if err := json.Unmarshal(data, &invite); err != nil {
+			m.logger.Warn("Failed to unmarshal invite",
+				zap.String("room_id", roomID),
+				zap.Error(err),
+			)
+			continue
+		}
+		invites = append(invites, &invite)
+	}
+
+	return invites, nil
+}
+
+// RevokeInvite deletes an invite; it reports false if the invite did not
+// exist or belongs to another room
+func (m *Manager) RevokeInvite(ctx context.Context, roomID, token string) (bool, error) {
+	removed, err := m.redis.SRem(ctx, RoomInvitesKey(roomID), token).Result()
+	if err != nil {
+		return false, err
+	}
+	if removed == 0 {
+		return false, nil
+	}
+
+	deleted, err := m.redis.Del(ctx, InviteKey(token)).Result()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
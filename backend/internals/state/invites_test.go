@@ -0,0 +1,189 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConsumeInviteRace(t *testing.T) {
+	m, _ := newTestManager(t)
+	ctx := context.Background()
+	invite, err := m.CreateInvite(ctx, "room-1", time.Hour, true, "", "", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const clients = 20
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		won     int
+		invalid int
+	)
+	start := make(chan struct{})
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := m.ConsumeInvite(ctx, invite.Token, "room-1")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				won++
+			case errors.Is(err, ErrInviteInvalid):
+				invalid++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if won != 1 || invalid != clients-1 {
+		t.Fatalf("%d clients got the one-time invite and %d were refused, want 1 and %d", won, invalid, clients-1)
+	}
+	if invites, err := m.ListInvites(ctx, "room-1"); err != nil || len(invites) != 0 {
+		t.Fatalf("used invite still listed: %v, %v", invites, err)
+	}
+}
+
+func TestConsumeInvite(t *testing.T) {
+	m, mr := newTestManager(t)
+	ctx := context.Background()
+	reusable, err := m.CreateInvite(ctx, "room-1", time.Minute, false, "viewer", "Guest", true, 90*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oneTime, err := m.CreateInvite(ctx, "room-1", time.Minute, true, "", "", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An invite for another room is refused and left for its own room
+	if _, err := m.ConsumeInvite(ctx, oneTime.Token, "room-2"); !errors.Is(err, ErrInviteInvalid) {
+		t.Fatalf("other room: err = %v, want %v", err, ErrInviteInvalid)
+	}
+	if _, err := m.ConsumeInvite(ctx, oneTime.Token, "room-1"); err != nil {
+		t.Fatalf("one-time invite refused after a try for another room: %v", err)
+	}
+	if _, err := m.ConsumeInvite(ctx, "unknown", "room-1"); !errors.Is(err, ErrInviteInvalid) {
+		t.Fatalf("unknown token: err = %v, want %v", err, ErrInviteInvalid)
+	}
+
+	// Every use of an invite with a publishing window gets its first
+	// redemption, kept until the invite is gone and the window is over
+	var first time.Time
+	for i := 0; i < 3; i++ {
+		got, err := m.ConsumeInvite(ctx, reusable.Token, "room-1")
+		if err != nil {
+			t.Fatalf("use %d of a reusable invite: %v", i+1, err)
+		}
+		if got.Role != "viewer" || got.Name != "Guest" || !got.RelayOnly || got.PublishForSec != 90 {
+			t.Fatalf("invite %+v", got)
+		}
+		if i == 0 {
+			first = got.RedeemedAt
+		}
+		if got.RedeemedAt.IsZero() || !got.RedeemedAt.Equal(first) {
+			t.Fatalf("use %d redeemed at %v, first at %v", i+1, got.RedeemedAt, first)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if ttl := mr.TTL(InviteRedeemedKey(reusable.Token)); ttl <= 90*time.Second || ttl > time.Minute+90*time.Second {
+		t.Fatalf("first redemption kept for %v", ttl)
+	}
+	if mr.Exists(InviteRedeemedKey(oneTime.Token)) {
+		t.Fatal("redemption of an invite without a window kept")
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if _, err := m.ConsumeInvite(ctx, reusable.Token, "room-1"); !errors.Is(err, ErrInviteInvalid) {
+		t.Fatalf("expired: err = %v, want %v", err, ErrInviteInvalid)
+	}
+}
+
+func TestListAndRevokeInvites(t *testing.T) {
+	m, mr := newTestManager(t)
+	ctx := context.Background()
+	short, err := m.CreateInvite(ctx, "room-1", time.Minute, true, "", "", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, err := m.CreateInvite(ctx, "room-1", time.Hour, true, "", "", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateInvite(ctx, "room-2", time.Hour, true, "", "", false, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	invites, err := m.ListInvites(ctx, "room-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invites) != 1 || invites[0].Token != long.Token {
+		t.Fatalf("listed %v, want only the unexpired invite", invites)
+	}
+	if members, err := mr.Members(RoomInvitesKey("room-1")); err != nil || len(members) != 1 {
+		t.Fatalf("expired token %s not pruned: %v, %v", short.Token, members, err)
+	}
+
+	if ok, err := m.RevokeInvite(ctx, "room-2", long.Token); err != nil || ok {
+		t.Fatalf("revoked from another room: %v, %v", ok, err)
+	}
+	if ok, err := m.RevokeInvite(ctx, "room-1", long.Token); err != nil || !ok {
+		t.Fatalf("revoke: %v, %v", ok, err)
+	}
+	if ok, err := m.RevokeInvite(ctx, "room-1", long.Token); err != nil || ok {
+		t.Fatalf("revoked twice: %v, %v", ok, err)
+	}
+	if _, err := m.ConsumeInvite(ctx, long.Token, "room-1"); !errors.Is(err, ErrInviteInvalid) {
+		t.Fatalf("revoked invite: err = %v, want %v", err, ErrInviteInvalid)
+	}
+}
+
+func TestRestoreInvite(t *testing.T) {
+	m, mr := newTestManager(t)
+	ctx := context.Background()
+	invite, err := m.CreateInvite(ctx, "room-1", time.Minute, true, "moderator", "", false, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taken, err := m.ConsumeInvite(ctx, invite.Token, "room-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RestoreInvite(ctx, taken); err != nil {
+		t.Fatal(err)
+	}
+	// The turned-away join did not start its publishing window
+	if mr.Exists(InviteRedeemedKey(invite.Token)) {
+		t.Fatal("returned invite still redeemed")
+	}
+	if invites, err := m.ListInvites(ctx, "room-1"); err != nil || len(invites) != 1 || invites[0].Role != "moderator" {
+		t.Fatalf("restored invite not listed: %v, %v", invites, err)
+	}
+	if ttl := mr.TTL(InviteKey(invite.Token)); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("restored invite expires in %s, want within its minute", ttl)
+	}
+	if _, err := m.ConsumeInvite(ctx, invite.Token, "room-1"); err != nil {
+		t.Fatalf("restored invite refused: %v", err)
+	}
+
+	// One that expired while the join was being turned away stays gone
+	taken.ExpiresAt = time.Now().Add(-time.Second)
+	if err := m.RestoreInvite(ctx, taken); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(InviteKey(invite.Token)) {
+		t.Fatal("expired invite restored")
+	}
+}
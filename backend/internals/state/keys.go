@@ -1,11 +1,17 @@
 package state
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 const (
-	KeyPrefixSession = "session:"
-	KeyPrefixRoom    = "room:"
-	KeyPrefixPeer    = "peer:"
+	KeyPrefixSession  = "session:"
+	KeyPrefixRoom     = "room:"
+	KeyPrefixPeer     = "peer:"
+	KeyPrefixInvite   = "invite:"
+	KeyPrefixLimit    = "ratelimit:"
+	KeyPrefixInstance = "instance:"
 
 	SessionTTL = 30  // seconds after disconnect
 	RoomTTL    = 300 // 5 minutes after empty
@@ -19,6 +25,21 @@ func RoomMetaKey(roomID string) string {
 	return fmt.Sprintf("%s%s:meta", KeyPrefixRoom, roomID)
 }
 
+// RoomCreateKey holds the instance creating roomID (see roomclaim.go).
+func RoomCreateKey(roomID string) string {
+	return fmt.Sprintf("%s%s:create", KeyPrefixRoom, roomID)
+}
+
+func RoomSnapshotKey(roomID string) string {
+	return fmt.Sprintf("%s%s:snapshot", KeyPrefixRoom, roomID)
+}
+
+// CallSummaryKey is where the summary of a room's call that started at
+// startedAt is kept, under a configured prefix.
+func CallSummaryKey(prefix, roomID string, startedAt time.Time) string {
+	return fmt.Sprintf("%s%s:%d", prefix, roomID, startedAt.UnixMilli())
+}
+
 func RoomPeersKey(roomID string) string {
 	return fmt.Sprintf("%s%s:peers", KeyPrefixRoom, roomID)
 }
@@ -26,3 +47,28 @@ func RoomPeersKey(roomID string) string {
 func PeerTracksKey(peerID string) string {
 	return fmt.Sprintf("%s%s:tracks", KeyPrefixPeer, peerID)
 }
+
+// InstanceKey is where an instance's registry record is kept.
+func InstanceKey(instanceID string) string {
+	return fmt.Sprintf("%s%s", KeyPrefixInstance, instanceID)
+}
+
+func InviteKey(token string) string {
+	return fmt.Sprintf("%s%s", KeyPrefixInvite, token)
+}
+
+// InviteRedeemedKey holds when an invite with a publishing window was first
+// redeemed, in Unix milliseconds.
+func InviteRedeemedKey(token string) string {
+	return fmt.Sprintf("%s%s:redeemed", KeyPrefixInvite, token)
+}
+
+func RoomInvitesKey(roomID string) string {
+	return fmt.Sprintf("%s%s:invites", KeyPrefixRoom, roomID)
+}
+
+// RateLimitKey is the counter of a distributed rate limit key in the
+// window with the given index.
+func RateLimitKey(key string, window int64) string {
+	return fmt.Sprintf("%s%s:%d", KeyPrefixLimit, key, window)
+}
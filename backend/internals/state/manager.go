@@ -17,10 +17,19 @@ type MediaState struct {
 	ScreenEnabled bool `json:"screen_enabled"`
 }
 
+// ReceivePreference caps the resolution and frame rate a peer receives of
+// a track; zero means no limit.
+type ReceivePreference struct {
+	MaxWidth     int `json:"max_width,omitempty"`
+	MaxHeight    int `json:"max_height,omitempty"`
+	MaxFramerate int `json:"max_framerate,omitempty"`
+}
+
 // SessionData represents a peer's session information
 type SessionData struct {
 	ID            string            `json:"id"`
 	UserID        string            `json:"user_id"`
+	PeerID        string            `json:"peer_id,omitempty"`
 	RoomID        string            `json:"room_id"`
 	Name          string            `json:"name"`
 	MediaState    MediaState        `json:"media_state"`
@@ -28,6 +37,13 @@ type SessionData struct {
 	CreatedAt     time.Time         `json:"created_at"`
 	LastSeen      time.Time         `json:"last_seen"`
 	Suspended     bool              `json:"suspended"`
+	Observer      bool              `json:"observer,omitempty"`
+	RelayOnly     bool              `json:"relay_only,omitempty"`
+	TalkTimeMs    int64             `json:"talk_time_ms,omitempty"`
+	PublishUntil  time.Time         `json:"publish_until,omitzero"`
+
+	// Track or codec group handle -> receive preference
+	ReceivePreferences map[string]ReceivePreference `json:"receive_preferences,omitempty"`
 }
 
 // Manager handles session state with local cache and Redis persistence
@@ -37,6 +53,10 @@ type Manager struct {
 	logger *zap.Logger
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	// Orders session writes to Redis, so a background write that lost its
+	// place to a newer one never lands after it
+	persistMu sync.Mutex
 }
 
 // NewManager creates a new state manager with Redis connection
@@ -52,11 +72,14 @@ func NewManager(redisAddr, redisPassword string, redisDB int, logger *zap.Logger
 		DialTimeout:  5 * time.Second,
 		ReadTimeout:  3 * time.Second,
 		WriteTimeout: 3 * time.Second,
+		// Callers' deadlines cut a call short of the timeouts above
+		ContextTimeoutEnabled: true,
 	})
 
 	// Test connection
 	if err := client.Ping(ctx).Err(); err != nil {
 		cancel()
+		client.Close()
 		return nil, err
 	}
 
@@ -75,21 +98,31 @@ func NewManager(redisAddr, redisPassword string, redisDB int, logger *zap.Logger
 }
 
 // SetSession stores a session with write-through caching
-// Writes to local map immediately, then persists to Redis asynchronously
-func (m *Manager) SetSession(session *SessionData) error {
+// Writes to local map immediately, then persists to Redis asynchronously.
+// The background write outlives ctx and is bounded by the manager instead.
+func (m *Manager) SetSession(ctx context.Context, session *SessionData) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	session.LastSeen = time.Now()
 
 	// Store in local cache immediately
 	m.local.Store(session.ID, session)
 
-	// Persist to Redis asynchronously
+	// Persist to Redis asynchronously, from a snapshot taken now so later
+	// changes by the caller cannot race the write
+	data, err := json.Marshal(session)
+	if err != nil {
+		m.logger.Error("Failed to marshal session",
+			zap.String("session_id", session.ID),
+			zap.Error(err),
+		)
+		return err
+	}
 	go func() {
-		data, err := json.Marshal(session)
-		if err != nil {
-			m.logger.Error("Failed to marshal session",
-				zap.String("session_id", session.ID),
-				zap.Error(err),
-			)
+		m.persistMu.Lock()
+		defer m.persistMu.Unlock()
+		if !m.isCurrent(session) {
 			return
 		}
 
@@ -116,8 +149,65 @@ func (m *Manager) SetSession(session *SessionData) error {
 	return nil
 }
 
+// SetSessions stores several sessions like SetSession, persisting them to
+// Redis in one pipelined round trip.
+func (m *Manager) SetSessions(ctx context.Context, sessions []*SessionData) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	payloads := make([][]byte, len(sessions))
+	for i, session := range sessions {
+		session.LastSeen = now
+		m.local.Store(session.ID, session)
+		data, err := json.Marshal(session)
+		if err != nil {
+			m.logger.Error("Failed to marshal session",
+				zap.String("session_id", session.ID),
+				zap.Error(err),
+			)
+			return err
+		}
+		payloads[i] = data
+	}
+	go func() {
+		m.persistMu.Lock()
+		defer m.persistMu.Unlock()
+		pipe := m.redis.Pipeline()
+		for i, session := range sessions {
+			if !m.isCurrent(session) {
+				continue
+			}
+			pipe.Set(m.ctx, SessionKey(session.ID), payloads[i], 0)
+			pipe.SAdd(m.ctx, RoomPeersKey(session.RoomID), session.ID)
+		}
+		if pipe.Len() == 0 {
+			return
+		}
+		if _, err := pipe.Exec(m.ctx); err != nil {
+			m.logger.Error("Failed to persist sessions to Redis",
+				zap.Int("count", len(sessions)),
+				zap.Error(err),
+			)
+		}
+	}()
+
+	return nil
+}
+
+// isCurrent reports whether session is still the cached state of its
+// session, i.e. no later write or delete has replaced it.
+func (m *Manager) isCurrent(session *SessionData) bool {
+	val, ok := m.local.Load(session.ID)
+	return ok && val.(*SessionData) == session
+}
+
 // GetSession retrieves a session from local cache, falling back to Redis
-func (m *Manager) GetSession(sessionID string) (*SessionData, error) {
+func (m *Manager) GetSession(ctx context.Context, sessionID string) (*SessionData, error) {
 	// Try local cache first
 	if val, ok := m.local.Load(sessionID); ok {
 		return val.(*SessionData), nil
@@ -125,7 +215,7 @@ func (m *Manager) GetSession(sessionID string) (*SessionData, error) {
 
 	// Fallback to Redis
 	key := SessionKey(sessionID)
-	data, err := m.redis.Get(m.ctx, key).Bytes()
+	data, err := m.redis.Get(ctx, key).Bytes()
 	if err != nil {
 		if err == redis.Nil {
 			return nil, nil // Session not found
@@ -144,30 +234,27 @@ func (m *Manager) GetSession(sessionID string) (*SessionData, error) {
 	return &session, nil
 }
 
-// SuspendSession marks a session as suspended with TTL for reconnection window
-func (m *Manager) SuspendSession(sessionID string) error {
-	session, err := m.GetSession(sessionID)
-	if err != nil {
-		return err
-	}
-	if session == nil {
-		return nil
-	}
+// SuspendSession stores the final state of a session as suspended, with a
+// TTL for the reconnection window
+func (m *Manager) SuspendSession(ctx context.Context, session *SessionData) error {
+	sessionID := session.ID
 
 	session.Suspended = true
 	session.LastSeen = time.Now()
-
-	// Update local cache
-	m.local.Store(sessionID, session)
-
-	// Update Redis with TTL
 	data, err := json.Marshal(session)
 	if err != nil {
 		return err
 	}
 
+	// Update local cache, superseding any pending background write
+	m.persistMu.Lock()
+	defer m.persistMu.Unlock()
+	m.local.Store(sessionID, session)
+
+	// Update Redis with TTL
+
 	key := SessionKey(sessionID)
-	if err := m.redis.Set(m.ctx, key, data, time.Duration(SessionTTL)*time.Second).Err(); err != nil {
+	if err := m.redis.Set(ctx, key, data, time.Duration(SessionTTL)*time.Second).Err(); err != nil {
 		m.logger.Error("Failed to suspend session in Redis",
 			zap.String("session_id", sessionID),
 			zap.Error(err),
@@ -184,16 +271,18 @@ func (m *Manager) SuspendSession(sessionID string) error {
 }
 
 // DeleteSession removes a session from both local cache and Redis
-func (m *Manager) DeleteSession(sessionID string) error {
+func (m *Manager) DeleteSession(ctx context.Context, sessionID string) error {
 	// Get session to find room ID
-	session, _ := m.GetSession(sessionID)
+	session, _ := m.GetSession(ctx, sessionID)
 
-	// Remove from local cache
+	// Remove from local cache, superseding any pending background write
+	m.persistMu.Lock()
+	defer m.persistMu.Unlock()
 	m.local.Delete(sessionID)
 
 	// Remove from Redis
 	key := SessionKey(sessionID)
-	if err := m.redis.Del(m.ctx, key).Err(); err != nil {
+	if err := m.redis.Del(ctx, key).Err(); err != nil {
 		m.logger.Error("Failed to delete session from Redis",
 			zap.String("session_id", sessionID),
 			zap.Error(err),
@@ -204,7 +293,7 @@ func (m *Manager) DeleteSession(sessionID string) error {
 	// Remove from room's peer set
 	if session != nil && session.RoomID != "" {
 		roomPeersKey := RoomPeersKey(session.RoomID)
-		if err := m.redis.SRem(m.ctx, roomPeersKey, sessionID).Err(); err != nil {
+		if err := m.redis.SRem(ctx, roomPeersKey, sessionID).Err(); err != nil {
 			m.logger.Error("Failed to remove session from room peers set",
 				zap.String("session_id", sessionID),
 				zap.String("room_id", session.RoomID),
@@ -219,18 +308,18 @@ func (m *Manager) DeleteSession(sessionID string) error {
 }
 
 // GetRoomSessions returns all non-suspended sessions for a room
-func (m *Manager) GetRoomSessions(roomID string) ([]*SessionData, error) {
+func (m *Manager) GetRoomSessions(ctx context.Context, roomID string) ([]*SessionData, error) {
 	roomPeersKey := RoomPeersKey(roomID)
 
 	// Get all session IDs in the room
-	sessionIDs, err := m.redis.SMembers(m.ctx, roomPeersKey).Result()
+	sessionIDs, err := m.redis.SMembers(ctx, roomPeersKey).Result()
 	if err != nil {
 		return nil, err
 	}
 
 	var sessions []*SessionData
 	for _, sessionID := range sessionIDs {
-		session, err := m.GetSession(sessionID)
+		session, err := m.GetSession(ctx, sessionID)
 		if err != nil {
 			m.logger.Warn("Failed to get session",
 				zap.String("session_id", sessionID),
@@ -246,20 +335,47 @@ func (m *Manager) GetRoomSessions(roomID string) ([]*SessionData, error) {
 	return sessions, nil
 }
 
+// StoredRoomSessions returns the non-suspended sessions of a room as kept in
+// Redis. Unlike GetRoomSessions it skips the local cache, whose copies of
+// sessions other instances own are not updated when those instances change
+// them.
+func (m *Manager) StoredRoomSessions(ctx context.Context, roomID string) ([]*SessionData, error) {
+	sessionIDs, err := m.redis.SMembers(ctx, RoomPeersKey(roomID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*SessionData
+	for _, sessionID := range sessionIDs {
+		data, err := m.redis.Get(ctx, SessionKey(sessionID)).Bytes()
+		if err != nil {
+			continue
+		}
+		var session SessionData
+		if err := json.Unmarshal(data, &session); err != nil {
+			continue
+		}
+		if !session.Suspended {
+			sessions = append(sessions, &session)
+		}
+	}
+	return sessions, nil
+}
+
 // RecoverSessions scans Redis keys on startup to recover sessions
 // Returns sessions that can be resumed (within TTL)
-func (m *Manager) RecoverSessions() ([]*SessionData, error) {
+func (m *Manager) RecoverSessions(ctx context.Context) ([]*SessionData, error) {
 	var recovered []*SessionData
 	var cursor uint64
 
 	for {
-		keys, nextCursor, err := m.redis.Scan(m.ctx, cursor, KeyPrefixSession+"*", 100).Result()
+		keys, nextCursor, err := m.redis.Scan(ctx, cursor, KeyPrefixSession+"*", 100).Result()
 		if err != nil {
 			return nil, err
 		}
 
 		for _, key := range keys {
-			data, err := m.redis.Get(m.ctx, key).Bytes()
+			data, err := m.redis.Get(ctx, key).Bytes()
 			if err != nil {
 				if err == redis.Nil {
 					continue
@@ -299,8 +415,8 @@ func (m *Manager) RecoverSessions() ([]*SessionData, error) {
 }
 
 // Ping checks Redis connection health
-func (m *Manager) Ping() error {
-	return m.redis.Ping(m.ctx).Err()
+func (m *Manager) Ping(ctx context.Context) error {
+	return m.redis.Ping(ctx).Err()
 }
 
 // GetRedisClient returns the underlying Redis client for pub/sub operations
@@ -0,0 +1,83 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDeadlineAbortsSlowRedis(t *testing.T) {
+	m, mr := newTestManager(t)
+	if err := m.SetRoomSummary(context.Background(), &RoomSummary{RoomID: "room-1"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// Redis stalls; the call gives up at its deadline rather than the
+	// client's read timeout
+	mr.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := m.GetRoomSummary(ctx, "room-1")
+	took := time.Since(start)
+	mr.Unlock()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the deadline", err)
+	}
+	if took > time.Second {
+		t.Fatalf("call returned after %v", took)
+	}
+
+	if summary, err := m.GetRoomSummary(context.Background(), "room-1"); err != nil || summary == nil {
+		t.Fatalf("after Redis recovers: %v, %v", summary, err)
+	}
+}
+
+func TestBackgroundWriteDoesNotOutliveLaterOnes(t *testing.T) {
+	m, mr := newTestManager(t)
+	ctx := context.Background()
+
+	// Each background write of a new session is overtaken by a
+	// synchronous suspend or delete
+	for i := 0; i < 50; i++ {
+		suspended := &SessionData{ID: fmt.Sprintf("suspended-%d", i), RoomID: "room-1"}
+		if err := m.SetSession(ctx, suspended); err != nil {
+			t.Fatal(err)
+		}
+		final := *suspended
+		final.TalkTimeMs = 42_300
+		if err := m.SuspendSession(ctx, &final); err != nil {
+			t.Fatal(err)
+		}
+
+		deleted := &SessionData{ID: fmt.Sprintf("deleted-%d", i), RoomID: "room-1"}
+		if err := m.SetSession(ctx, deleted); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.DeleteSession(ctx, deleted.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 50; i++ {
+		if mr.Exists(SessionKey(fmt.Sprintf("deleted-%d", i))) {
+			t.Fatalf("deleted-%d written back after its delete", i)
+		}
+		key := SessionKey(fmt.Sprintf("suspended-%d", i))
+		var stored SessionData
+		data, err := mr.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(data), &stored); err != nil {
+			t.Fatal(err)
+		}
+		if !stored.Suspended || stored.TalkTimeMs != 42_300 || mr.TTL(key) == 0 {
+			t.Fatalf("suspended-%d stored as %+v, TTL %v", i, stored, mr.TTL(key))
+		}
+	}
+}
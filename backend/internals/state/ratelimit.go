@@ -0,0 +1,47 @@
+package state
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Distributed rate limits count attempts shared by all instances with a
+// sliding-window counter: a counter per fixed window, with the previous
+// window's count weighted by how much of it the sliding window still
+// covers. Rejected attempts count too, so hammering keeps a key limited.
+
+// slidingWindowScript counts an attempt in the current window and returns
+// the estimate of attempts in the sliding window ending now.
+// KEYS: current window, previous window. ARGV: weight of the previous
+// window in thousandths, window length in milliseconds.
+var slidingWindowScript = redis.NewScript(`
+local current = redis.call('INCR', KEYS[1])
+if current == 1 then
+	redis.call('PEXPIRE', KEYS[1], 2 * tonumber(ARGV[2]))
+end
+local previous = tonumber(redis.call('GET', KEYS[2]) or '0')
+return current * 1000 + previous * tonumber(ARGV[1])
+`)
+
+// HitRateLimit counts an attempt under key, limited to limit attempts per
+// window, and reports whether it is within the limit. A rejected attempt
+// also gets how long until the estimate falls back under the limit.
+func (m *Manager) HitRateLimit(ctx context.Context, key string, limit int, window time.Duration, now time.Time) (bool, time.Duration, error) {
+	index := now.UnixMilli() / window.Milliseconds()
+	elapsed := time.Duration(now.UnixMilli()%window.Milliseconds()) * time.Millisecond
+	weight := 1000 - elapsed*1000/window
+
+	scaled, err := slidingWindowScript.Run(ctx, m.redis,
+		[]string{RateLimitKey(key, index), RateLimitKey(key, index-1)},
+		int64(weight), window.Milliseconds()).Int64()
+	if err != nil {
+		return false, 0, err
+	}
+	if scaled <= int64(limit)*1000 {
+		return true, 0, nil
+	}
+	// The previous window's share shrinks until the current one ends
+	return false, window - elapsed, nil
+}
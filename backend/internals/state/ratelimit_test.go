@@ -0,0 +1,74 @@
+package state
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"go.uber.org/zap"
+)
+
+func newTestManager(t *testing.T) (*Manager, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	m, err := NewManager(mr.Addr(), "", 0, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m, mr
+}
+
+func TestHitRateLimitWindowRollover(t *testing.T) {
+	m, mr := newTestManager(t)
+	ctx := context.Background()
+	const window = 10 * time.Second
+	start := time.UnixMilli(1_700_000_000_000).Truncate(window)
+
+	hit := func(at time.Duration) (bool, time.Duration) {
+		t.Helper()
+		ok, retryAfter, err := m.HitRateLimit(ctx, "join:user:u1", 3, window, start.Add(at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok, retryAfter
+	}
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := hit(time.Duration(i) * time.Second); !ok {
+			t.Fatalf("attempt %d refused", i+1)
+		}
+	}
+	if ok, retryAfter := hit(4 * time.Second); ok || retryAfter != 6*time.Second {
+		t.Fatalf("4th attempt: ok=%v retryAfter=%v, want refused for 6s", ok, retryAfter)
+	}
+	// Other keys are counted apart
+	if ok, _, _ := m.HitRateLimit(ctx, "join:user:u2", 3, window, start); !ok {
+		t.Fatal("other key refused")
+	}
+
+	// Just after the rollover the previous window still counts in full:
+	// 1 + 4 attempts
+	if ok, retryAfter := hit(window); ok || retryAfter != window {
+		t.Fatalf("after rollover: ok=%v retryAfter=%v, want refused for %v", ok, retryAfter, window)
+	}
+	// Late in the window only a tenth of it does: 2 + 0.4 attempts
+	if ok, _ := hit(window + 9*time.Second); !ok {
+		t.Fatal("attempt late in the next window refused")
+	}
+	// Two windows on, the first no longer counts at all: 1 + 2 attempts
+	if ok, _ := hit(2 * window); !ok {
+		t.Fatal("attempt two windows on refused")
+	}
+
+	// Counters expire once they can no longer be the previous window
+	key := RateLimitKey("join:user:u1", start.UnixMilli()/window.Milliseconds())
+	if ttl := mr.TTL(key); ttl <= 0 || ttl > 2*window {
+		t.Fatalf("TTL of %s = %v, want within %v", key, ttl, 2*window)
+	}
+	mr.FastForward(2 * window)
+	if mr.Exists(key) {
+		t.Fatalf("%s outlived two windows", key)
+	}
+}
@@ -0,0 +1,49 @@
+package state
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// A room is created by one instance at a time: the creator claims
+// RoomCreateKey with SET NX for a short TTL, so two instances racing to
+// create the same new room see each other.
+
+// releaseClaimScript deletes a claim only if it is still held by ARGV[1].
+var releaseClaimScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// ClaimRoomCreate claims the creation of roomID for instanceID for ttl. It
+// reports whether the claim is instanceID's (a claim it already held
+// counts) and, when it is not, the instance holding it.
+func (m *Manager) ClaimRoomCreate(ctx context.Context, roomID, instanceID string, ttl time.Duration) (bool, string, error) {
+	key := RoomCreateKey(roomID)
+	ok, err := m.redis.SetNX(ctx, key, instanceID, ttl).Result()
+	if err != nil || ok {
+		return ok, "", err
+	}
+	holder, err := m.redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		// Released in between; the next attempt decides
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	if holder == instanceID {
+		return true, "", nil
+	}
+	return false, holder, nil
+}
+
+// ReleaseRoomCreate drops instanceID's claim on roomID, leaving a claim
+// another instance has since taken alone.
+func (m *Manager) ReleaseRoomCreate(ctx context.Context, roomID, instanceID string) error {
+	return releaseClaimScript.Run(ctx, m.redis, []string{RoomCreateKey(roomID)}, instanceID).Err()
+}
@@ -0,0 +1,219 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// RoomSummary is the lightweight, cluster-visible view of a room hosted by
+// one SFU instance. It is refreshed on join/leave and by a periodic heartbeat
+// so entries from crashed instances disappear once their TTL runs out.
+type RoomSummary struct {
+	RoomID     string    `json:"roomId"`
+	Name       string    `json:"name"`
+	InstanceID string    `json:"instanceId"`
+	Region     string    `json:"region,omitempty"`
+	PeerCount  int       `json:"peerCount"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// SetRoomSummary writes a room summary with the given TTL
+func (m *Manager) SetRoomSummary(ctx context.Context, summary *RoomSummary, ttl time.Duration) error {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	key := RoomMetaKey(summary.RoomID)
+	if err := m.redis.Set(ctx, key, data, ttl).Err(); err != nil {
+		m.logger.Error("Failed to persist room summary",
+			zap.String("room_id", summary.RoomID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteRoomSummary removes a room summary, but only if it is still owned by
+// instanceID. This keeps an instance that closed its local copy of a room
+// from erasing the entry another instance has since taken over.
+func (m *Manager) DeleteRoomSummary(ctx context.Context, roomID, instanceID string) error {
+	summary, err := m.GetRoomSummary(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	if summary == nil || summary.InstanceID != instanceID {
+		return nil
+	}
+
+	if err := m.redis.Del(ctx, RoomMetaKey(roomID)).Err(); err != nil {
+		m.logger.Error("Failed to delete room summary",
+			zap.String("room_id", roomID),
+			zap.Error(err),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// RoomSnapshot is the configuration a room is recreated with after the
+// instance hosting it restarts, while its sessions can still resume. Settings
+// are stored as the room package encodes them.
+type RoomSnapshot struct {
+	RoomID        string          `json:"room_id"`
+	Name          string          `json:"name"`
+	MaxPeers      int             `json:"max_peers"`
+	Settings      json.RawMessage `json:"settings"`
+	AllowedCodecs []string        `json:"allowed_codecs,omitempty"`
+	Priorities    map[string]int  `json:"priorities,omitempty"` // by user ID
+	Host          string          `json:"host,omitempty"`       // user ID
+	MuteAll       json.RawMessage `json:"mute_all,omitempty"`
+	Lock          json.RawMessage `json:"lock,omitempty"`
+	Spotlight     string          `json:"spotlight,omitempty"` // user ID
+	InstanceID    string          `json:"instance_id"`         // the instance that saved it
+	SavedAt       time.Time       `json:"saved_at"`
+}
+
+// SetRoomSnapshot writes a room snapshot with the given TTL
+func (m *Manager) SetRoomSnapshot(ctx context.Context, snapshot *RoomSnapshot, ttl time.Duration) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	if err := m.redis.Set(ctx, RoomSnapshotKey(snapshot.RoomID), data, ttl).Err(); err != nil {
+		m.logger.Error("Failed to persist room snapshot",
+			zap.String("room_id", snapshot.RoomID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// GetRoomSnapshot returns the snapshot of a room, or nil if none is stored
+func (m *Manager) GetRoomSnapshot(ctx context.Context, roomID string) (*RoomSnapshot, error) {
+	data, err := m.redis.Get(ctx, RoomSnapshotKey(roomID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snapshot RoomSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// DeleteRoomSnapshot removes a room's snapshot once the room is closed for
+// good
+func (m *Manager) DeleteRoomSnapshot(ctx context.Context, roomID string) error {
+	if err := m.redis.Del(ctx, RoomSnapshotKey(roomID)).Err(); err != nil {
+		m.logger.Error("Failed to delete room snapshot",
+			zap.String("room_id", roomID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// SetCallSummary writes an encoded call summary under key with the given TTL
+func (m *Manager) SetCallSummary(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	if err := m.redis.Set(ctx, key, data, ttl).Err(); err != nil {
+		m.logger.Error("Failed to persist call summary",
+			zap.String("key", key),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// DeleteRoomPeers removes a room's session membership set
+func (m *Manager) DeleteRoomPeers(ctx context.Context, roomID string) error {
+	if err := m.redis.Del(ctx, RoomPeersKey(roomID)).Err(); err != nil {
+		m.logger.Error("Failed to delete room peers set",
+			zap.String("room_id", roomID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// GetRoomSummary returns the summary for a room, or nil if none is stored
+func (m *Manager) GetRoomSummary(ctx context.Context, roomID string) (*RoomSummary, error) {
+	data, err := m.redis.Get(ctx, RoomMetaKey(roomID)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var summary RoomSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// ListRoomSummaries scans Redis for every live room summary in the cluster
+func (m *Manager) ListRoomSummaries(ctx context.Context) ([]*RoomSummary, error) {
+	var summaries []*RoomSummary
+	var cursor uint64
+
+	for {
+		keys, nextCursor, err := m.redis.Scan(ctx, cursor, KeyPrefixRoom+"*:meta", 100).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			data, err := m.redis.Get(ctx, key).Bytes()
+			if err != nil {
+				if err == redis.Nil {
+					continue // expired between SCAN and GET
+				}
+				m.logger.Warn("Failed to get room summary",
+					zap.String("key", key),
+					zap.Error(err),
+				)
+				continue
+			}
+
+			var summary RoomSummary
+			if err := json.Unmarshal(data, &summary); err != nil {
+				m.logger.Warn("Failed to unmarshal room summary",
+					zap.String("key", key),
+					zap.Error(err),
+				)
+				continue
+			}
+			if summary.RoomID == "" {
+				summary.RoomID = strings.TrimSuffix(strings.TrimPrefix(key, KeyPrefixRoom), ":meta")
+			}
+			summaries = append(summaries, &summary)
+		}
+
+		cursor = nextCursor
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return summaries, nil
+}
@@ -6,14 +6,14 @@ import (
 
 type Subscription struct {
 	PeerID  string `json:"peerId"`
-	TrackID string `json:"trackId"`
+	TrackID string `json:"trackId"` // SFU-assigned track handle, not the publisher's WebRTC track ID
 	Kind    string `json:"kind"`
 	Layer   string `json:"layer"` // simulcast layer
 	Active  bool   `json:"active"`
 }
 
 type Manager struct {
-	// peerID -> trackID -> Subscription
+	// peerID -> track handle -> Subscription
 	subscriptions map[string]map[string]*Subscription
 	mu            sync.RWMutex
 
@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Turning on debug logging to look into one room floods the disk from the
+// fan-out and ICE paths. A LogRing instead keeps every entry, debug level
+// included, in memory for a short window whatever the configured level, for
+// support to read back filtered by room and peer. Entries go to shards in
+// turn, each with its own lock, so concurrent writers rarely meet; the
+// oldest entry of a shard is overwritten when it is full.
+
+// logRingShards is how many shards a LogRing spreads its entries over.
+const logRingShards = 16
+
+// LogEntry is one log entry kept by a LogRing.
+type LogEntry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Logger  string                 `json:"logger,omitempty"`
+	Message string                 `json:"message"`
+	Caller  string                 `json:"caller,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+
+	seq    uint64
+	roomID string
+	peerID string
+}
+
+// LogFilter selects entries from a LogRing. Empty fields match anything.
+type LogFilter struct {
+	RoomID string
+	PeerID string
+	Since  time.Time
+	Limit  int // newest entries returned, 0 = all
+}
+
+// LogRing keeps the most recent log entries of the last window.
+type LogRing struct {
+	window time.Duration
+	seq    atomic.Uint64
+	shards [logRingShards]logShard
+}
+
+type logShard struct {
+	mu      sync.Mutex
+	entries []LogEntry
+	next    int
+	_       [24]byte // keeps shards on separate cache lines
+}
+
+// DebugRing is the LogRing the logger writes to, if one is attached.
+var DebugRing *LogRing
+
+// NewLogRing returns a ring of capacity entries that are kept for at most
+// window (0 = until overwritten).
+func NewLogRing(capacity int, window time.Duration) *LogRing {
+	r := &LogRing{window: window}
+	perShard := (capacity + logRingShards - 1) / logRingShards
+	for i := range r.shards {
+		r.shards[i].entries = make([]LogEntry, 0, perShard)
+	}
+	return r
+}
+
+// AttachLogRing makes the logger also write every entry, whatever its
+// level, to ring.
+func AttachLogRing(ring *LogRing) {
+	DebugRing = ring
+	Logger = GetLogger().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, ring.Core())
+	}))
+}
+
+// Core returns a zap core writing to the ring.
+func (r *LogRing) Core() zapcore.Core {
+	return &ringCore{ring: r}
+}
+
+func (r *LogRing) add(e LogEntry) {
+	e.seq = r.seq.Add(1)
+	s := &r.shards[e.seq%logRingShards]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) < cap(s.entries) {
+		s.entries = append(s.entries, e)
+		return
+	}
+	if len(s.entries) == 0 {
+		return
+	}
+	s.entries[s.next] = e
+	s.next = (s.next + 1) % len(s.entries)
+}
+
+// Query returns the entries of the window that match f, oldest first.
+func (r *LogRing) Query(f LogFilter) []LogEntry {
+	since := f.Since
+	if r.window > 0 {
+		if cutoff := time.Now().Add(-r.window); cutoff.After(since) {
+			since = cutoff
+		}
+	}
+
+	var out []LogEntry
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.Lock()
+		for _, e := range s.entries {
+			if e.Time.Before(since) ||
+				(f.RoomID != "" && e.roomID != f.RoomID) ||
+				(f.PeerID != "" && e.peerID != f.PeerID) {
+				continue
+			}
+			out = append(out, e)
+		}
+		s.mu.Unlock()
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].seq < out[j].seq })
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[len(out)-f.Limit:]
+	}
+	return out
+}
+
+// ringCore is the zap core of a LogRing, carrying the fields added with
+// With.
+type ringCore struct {
+	ring   *LogRing
+	fields []zapcore.Field
+}
+
+func (c *ringCore) Enabled(zapcore.Level) bool {
+	return true
+}
+
+func (c *ringCore) With(fields []zapcore.Field) zapcore.Core {
+	merged := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	merged = append(merged, c.fields...)
+	merged = append(merged, fields...)
+	return &ringCore{ring: c.ring, fields: merged}
+}
+
+func (c *ringCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, c)
+}
+
+func (c *ringCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	e := LogEntry{
+		Time:    ent.Time,
+		Level:   ent.Level.String(),
+		Logger:  ent.LoggerName,
+		Message: ent.Message,
+		Fields:  enc.Fields,
+		roomID:  stringField(enc.Fields, "roomID", "roomId", "room_id"),
+		peerID:  stringField(enc.Fields, "peerID", "peerId", "peer_id"),
+	}
+	if ent.Caller.Defined {
+		e.Caller = ent.Caller.TrimmedPath()
+	}
+	c.ring.add(e)
+	return nil
+}
+
+func (c *ringCore) Sync() error {
+	return nil
+}
+
+// stringField returns the first of keys that is a string field.
+func stringField(fields map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if v, ok := fields[key].(string); ok {
+			return v
+		}
+	}
+	return ""
+}
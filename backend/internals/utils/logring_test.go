@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// messages returns the messages of entries.
+func messages(entries []LogEntry) []string {
+	out := make([]string, len(entries))
+	for i, e := range entries {
+		out[i] = e.Message
+	}
+	return out
+}
+
+func TestLogRingFilters(t *testing.T) {
+	ring := NewLogRing(256, 0)
+	logger := zap.New(ring.Core())
+
+	logger.Debug("debug", zap.String("roomID", "r1"))
+	logger.With(zap.String("roomId", "r1")).Info("with", zap.String("peerId", "p1"))
+	logger.Warn("snake", zap.String("room_id", "r2"), zap.String("peer_id", "p2"))
+	logger.Error("other peer", zap.String("roomID", "r1"), zap.String("peerID", "p2"))
+	logger.Info("no room")
+
+	for _, tc := range []struct {
+		name   string
+		filter LogFilter
+		want   []string
+	}{
+		{"all", LogFilter{}, []string{"debug", "with", "snake", "other peer", "no room"}},
+		{"room", LogFilter{RoomID: "r1"}, []string{"debug", "with", "other peer"}},
+		{"peer", LogFilter{PeerID: "p2"}, []string{"snake", "other peer"}},
+		{"room and peer", LogFilter{RoomID: "r1", PeerID: "p1"}, []string{"with"}},
+		{"unknown room", LogFilter{RoomID: "r3"}, []string{}},
+		{"limit keeps the newest", LogFilter{Limit: 2}, []string{"other peer", "no room"}},
+		{"since", LogFilter{Since: time.Now().Add(time.Minute)}, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := messages(ring.Query(tc.filter))
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	entries := ring.Query(LogFilter{RoomID: "r1", PeerID: "p1"})
+	if e := entries[0]; e.Level != "info" || e.Fields["roomId"] != "r1" || e.Fields["peerId"] != "p1" {
+		t.Fatalf("entry %+v", e)
+	}
+}
+
+func TestLogRingOverwritesOldest(t *testing.T) {
+	ring := NewLogRing(logRingShards, 0)
+	logger := zap.New(ring.Core())
+	for i := 0; i < 3*logRingShards; i++ {
+		logger.Info(fmt.Sprint(i))
+	}
+
+	got := messages(ring.Query(LogFilter{}))
+	if len(got) != logRingShards {
+		t.Fatalf("kept %d entries, want %d", len(got), logRingShards)
+	}
+	for i, msg := range got {
+		if want := fmt.Sprint(2*logRingShards + i); msg != want {
+			t.Fatalf("entry %d is %q, want %q", i, msg, want)
+		}
+	}
+}
+
+func TestLogRingWindow(t *testing.T) {
+	ring := NewLogRing(64, time.Minute)
+	core := ring.Core()
+	now := time.Now()
+	for _, e := range []zapcore.Entry{
+		{Time: now.Add(-2 * time.Minute), Message: "expired"},
+		{Time: now.Add(-30 * time.Second), Message: "kept"},
+		{Time: now, Message: "new"},
+	} {
+		core.Write(e, nil)
+	}
+
+	if got := messages(ring.Query(LogFilter{})); fmt.Sprint(got) != "[kept new]" {
+		t.Fatalf("got %q, want entries of the last minute", got)
+	}
+	got := messages(ring.Query(LogFilter{Since: now.Add(-10 * time.Second)}))
+	if fmt.Sprint(got) != "[new]" {
+		t.Fatalf("got %q, want entries since 10s ago", got)
+	}
+}
+
+func TestLogRingConcurrentWriters(t *testing.T) {
+	ring := NewLogRing(1024, 0)
+	logger := zap.New(ring.Core())
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			room := zap.String("roomID", fmt.Sprint("r", w))
+			for i := 0; i < 100; i++ {
+				logger.Debug("entry", room)
+				ring.Query(LogFilter{RoomID: "r0", Limit: 10})
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if got := len(ring.Query(LogFilter{})); got != 800 {
+		t.Fatalf("kept %d entries, want 800", got)
+	}
+	if got := len(ring.Query(LogFilter{RoomID: "r3"})); got != 100 {
+		t.Fatalf("kept %d entries of r3, want 100", got)
+	}
+}
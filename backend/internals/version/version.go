@@ -0,0 +1,22 @@
+// Package version holds build metadata injected at link time:
+//
+//	go build -ldflags "-X github.com/adityaadpandey/sfu-go/internals/version.Version=v1.2.0 \
+//	  -X github.com/adityaadpandey/sfu-go/internals/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/adityaadpandey/sfu-go/internals/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/sfu
+package version
+
+import "runtime"
+
+var (
+	// Version is the release version, "dev" for local builds.
+	Version = "dev"
+	// Commit is the git commit the binary was built from.
+	Commit = "unknown"
+	// BuildDate is when the binary was built, in RFC 3339.
+	BuildDate = "unknown"
+)
+
+// GoVersion is the Go toolchain the binary was built with.
+func GoVersion() string {
+	return runtime.Version()
+}
@@ -0,0 +1,565 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	appmetrics "github.com/adityaadpandey/sfu-go/internals/metrics"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Room events are POSTed to a webhook URL one at a time, in the order they
+// happened. By default they wait in a bounded in-memory queue, so events
+// raised while the sink is down for long, or before a restart, are lost.
+// In durable mode they are appended to a Redis Stream per instance and
+// delivered through a consumer group, which keeps the cursor: an event is
+// acknowledged only once the sink accepted it and retried until then, and
+// after a restart delivery resumes with the events still pending. Delivery
+// is at least once; receivers drop repeats by the X-SFU-Event-ID header,
+// which every attempt at an event carries: the stream entry ID in durable
+// mode, an ID given on Send in memory.
+//
+// An event the sink rejects for good (a 4xx other than 408 and 429), or that
+// still fails after MaxAttempts, is given up on so it does not hold back the
+// events behind it: it is logged and counted and, in durable mode, moved to
+// the dead-letter stream, Stream+DeadLetterSuffix, and acknowledged.
+
+// Event is a room or recording event as delivered to the webhook.
+type Event struct {
+	ID         string    `json:"id,omitempty"` // stream entry ID in durable mode, else set by Send
+	Type       string    `json:"type"`
+	InstanceID string    `json:"instanceId,omitempty"`
+	RoomID     string    `json:"roomId"`
+	Seq        uint64    `json:"seq"` // the event's number within its room
+	PeerID     string    `json:"peerId,omitempty"`
+	UserID     string    `json:"userId,omitempty"`
+	TrackID    string    `json:"trackId,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	At         time.Time `json:"at"`
+	// Only in recording.* events
+	Recording *Recording `json:"recording,omitempty"`
+}
+
+// Recording states, the suffixes of the recording.* event types
+const (
+	RecordingStarted  = "started"
+	RecordingStopped  = "stopped"
+	RecordingFailed   = "failed"
+	RecordingUploaded = "uploaded" // the local file is complete and can be downloaded
+)
+
+// Recording is the state of a recording as of a recording.* event.
+type Recording struct {
+	ID         string     `json:"id"`
+	RoomID     string     `json:"roomId,omitempty"`
+	State      string     `json:"state"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	StoppedAt  *time.Time `json:"stoppedAt,omitempty"`
+	DurationMs int64      `json:"durationMs"`
+	Bytes      int64      `json:"bytes"`
+	// Where the finished file is downloaded from
+	StorageURL string `json:"storageUrl,omitempty"`
+	// User IDs of the participants in the room while it ran
+	Participants []string `json:"participants"`
+	// Why a failed recording stopped
+	Error string `json:"error,omitempty"`
+}
+
+// Options configures webhook delivery.
+type Options struct {
+	URL       string
+	Secret    string        // signs bodies in X-SFU-Signature when set
+	Timeout   time.Duration // per request
+	QueueSize int           // events waiting to be delivered or appended
+	RetryMax  time.Duration // longest wait between attempts
+	// Attempts per event before it is given up on; 0 means DefaultMaxAttempts
+	MaxAttempts int
+
+	// Durable mode: the stream key, its approximate MAXLEN, and the consumer
+	// group and consumer name that keep the cursor
+	Durable   bool
+	Stream    string
+	StreamMax int64
+	Group     string
+	Consumer  string
+}
+
+// retryMin is the wait after a first failed attempt, doubled per attempt up
+// to RetryMax.
+const retryMin = 500 * time.Millisecond
+
+// readBatch is how many stream entries the consumer reads at once.
+const readBatch = 100
+
+// DefaultMaxAttempts is Options.MaxAttempts when unset.
+const DefaultMaxAttempts = 10
+
+// DeadLetterSuffix follows the stream key in the key of the stream holding
+// the events given up on in durable mode.
+const DeadLetterSuffix = ":dead"
+
+// StatusError is a non-2xx answer of the webhook.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook answered %d", e.StatusCode)
+}
+
+// permanent reports whether err means the sink will never accept the event:
+// a 4xx answer other than 408 Request Timeout and 429 Too Many Requests.
+func permanent(err error) bool {
+	var status *StatusError
+	if !errors.As(err, &status) {
+		return false
+	}
+	code := status.StatusCode
+	return code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+}
+
+// Sender delivers room events to the webhook. Send never blocks the caller:
+// events go through a bounded queue, and events it cannot take are counted
+// in metrics instead.
+type Sender struct {
+	opts   Options
+	client *http.Client
+	redis  *redis.Client
+	logger *zap.Logger
+
+	// mu guards sends on events against Close closing it
+	mu     sync.RWMutex
+	closed bool
+	events chan Event
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	closeOnce sync.Once
+}
+
+// NewSender starts delivering to opts.URL. Durable mode needs redisClient;
+// without it events are queued in memory.
+func NewSender(opts Options, redisClient *redis.Client, logger *zap.Logger) *Sender {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1024
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.RetryMax < retryMin {
+		opts.RetryMax = retryMin
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.Durable && redisClient == nil {
+		logger.Warn("Durable webhooks need Redis, queueing webhook events in memory")
+		opts.Durable = false
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Sender{
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		logger: logger,
+		events: make(chan Event, opts.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if opts.Durable {
+		s.redis = redisClient
+		s.wg.Add(3)
+		go s.appendLoop()
+		go s.consumeLoop()
+		go s.lagLoop()
+	} else {
+		s.wg.Add(1)
+		go s.deliverLoop()
+	}
+	return s
+}
+
+// Durable reports whether events go through the Redis Stream. It is safe to
+// call on a nil Sender.
+func (s *Sender) Durable() bool {
+	return s != nil && s.redis != nil
+}
+
+// Send queues an event for delivery. It is safe to call on a nil Sender,
+// and events sent after Close are dropped.
+func (s *Sender) Send(ev Event) {
+	if s == nil {
+		return
+	}
+	if ev.At.IsZero() {
+		ev.At = time.Now()
+	}
+	if ev.ID == "" && !s.Durable() {
+		ev.ID = uuid.New().String()
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		appmetrics.RecordWebhookDropped("closed")
+		return
+	}
+	select {
+	case s.events <- ev:
+	default:
+		appmetrics.RecordWebhookDropped("queue")
+	}
+}
+
+// Close stops delivery. Queued events are appended to the stream first in
+// durable mode; in memory they are lost, as are any being retried.
+func (s *Sender) Close() {
+	if s == nil {
+		return
+	}
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		close(s.events)
+		s.mu.Unlock()
+		if !s.Durable() {
+			s.cancel()
+		}
+		s.wg.Wait()
+		s.cancel()
+	})
+}
+
+// deliverLoop delivers queued events in memory mode.
+func (s *Sender) deliverLoop() {
+	defer s.wg.Done()
+	for ev := range s.events {
+		if err := s.deliverWithRetry(ev); err != nil {
+			if s.ctx.Err() != nil {
+				appmetrics.RecordWebhookDropped("stopped")
+				continue
+			}
+			s.giveUp(ev, err)
+		}
+	}
+}
+
+// appendLoop appends queued events to the stream in durable mode.
+func (s *Sender) appendLoop() {
+	defer s.wg.Done()
+	for ev := range s.events {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			appmetrics.RecordWebhookDropped("encode")
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err = s.redis.XAdd(ctx, &redis.XAddArgs{
+			Stream: s.opts.Stream,
+			MaxLen: s.opts.StreamMax,
+			Approx: s.opts.StreamMax > 0,
+			Values: map[string]interface{}{"event": data},
+		}).Err()
+		cancel()
+		if err != nil {
+			appmetrics.RecordWebhookDropped("stream")
+			s.logger.Warn("Failed to append webhook event", zap.String("type", ev.Type), zap.Error(err))
+		}
+	}
+	// Everything queued is in the stream; the consumer can stop
+	s.cancel()
+}
+
+// consumeLoop delivers the stream's events in order through the consumer
+// group: first those read but never acknowledged, from before a restart,
+// then new ones.
+func (s *Sender) consumeLoop() {
+	defer s.wg.Done()
+	if !s.ensureGroup() {
+		return
+	}
+
+	cursor := "0" // this consumer's pending entries
+	for s.ctx.Err() == nil {
+		args := &redis.XReadGroupArgs{
+			Group:    s.opts.Group,
+			Consumer: s.opts.Consumer,
+			Streams:  []string{s.opts.Stream, cursor},
+			Count:    readBatch,
+			Block:    -1,
+		}
+		if cursor == ">" {
+			args.Block = 2 * time.Second
+		}
+		streams, err := s.redis.XReadGroup(s.ctx, args).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			if s.ctx.Err() != nil {
+				return
+			}
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				s.ensureGroup()
+				continue
+			}
+			s.logger.Warn("Failed to read webhook stream", zap.Error(err))
+			s.sleep(time.Second)
+			continue
+		}
+
+		var messages []redis.XMessage
+		if len(streams) > 0 {
+			messages = streams[0].Messages
+		}
+		if cursor != ">" && len(messages) == 0 {
+			cursor = ">"
+		}
+		for _, msg := range messages {
+			if cursor != ">" {
+				cursor = msg.ID
+			}
+			if !s.deliverEntry(msg) {
+				return
+			}
+		}
+	}
+}
+
+// ensureGroup creates the consumer group, reading from the start of the
+// stream, if it does not exist.
+func (s *Sender) ensureGroup() bool {
+	for s.ctx.Err() == nil {
+		err := s.redis.XGroupCreateMkStream(s.ctx, s.opts.Stream, s.opts.Group, "0").Err()
+		if err == nil || strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return true
+		}
+		s.logger.Warn("Failed to create webhook consumer group", zap.Error(err))
+		s.sleep(time.Second)
+	}
+	return false
+}
+
+// deliverEntry delivers one stream entry and acknowledges it. It returns
+// false when the sender stopped first, leaving the entry pending.
+func (s *Sender) deliverEntry(msg redis.XMessage) bool {
+	var ev Event
+	raw, _ := msg.Values["event"].(string)
+	if err := json.Unmarshal([]byte(raw), &ev); err != nil {
+		appmetrics.RecordWebhookDropped("encode")
+		s.logger.Warn("Dropping malformed webhook stream entry", zap.String("id", msg.ID), zap.Error(err))
+	} else {
+		ev.ID = msg.ID
+		if err := s.deliverWithRetry(ev); err != nil {
+			if s.ctx.Err() != nil {
+				return false
+			}
+			s.giveUp(ev, err)
+			s.deadLetter(raw, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.redis.XAck(ctx, s.opts.Stream, s.opts.Group, msg.ID).Err(); err != nil {
+		// It stays pending and is delivered again after a restart
+		s.logger.Warn("Failed to acknowledge webhook event", zap.String("id", msg.ID), zap.Error(err))
+	}
+	return true
+}
+
+// deliverWithRetry posts ev until the sink accepts it, waiting longer after
+// each failure. It gives up when the sender stops, the sink rejects the
+// event for good or MaxAttempts have failed, and returns the last error.
+func (s *Sender) deliverWithRetry(ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	wait := retryMin
+	for attempt := 1; ; attempt++ {
+		err := s.post(ev, body)
+		if err == nil {
+			appmetrics.RecordWebhookDelivery("delivered")
+			return nil
+		}
+		appmetrics.RecordWebhookDelivery("failed")
+		if permanent(err) || attempt >= s.opts.MaxAttempts {
+			return err
+		}
+		if attempt == 1 || attempt%10 == 0 {
+			s.logger.Warn("Webhook delivery failed, retrying",
+				zap.String("type", ev.Type),
+				zap.String("roomID", ev.RoomID),
+				zap.Int("attempt", attempt),
+				zap.Error(err),
+			)
+		}
+		if !s.sleep(wait) {
+			return s.ctx.Err()
+		}
+		if wait *= 2; wait > s.opts.RetryMax {
+			wait = s.opts.RetryMax
+		}
+	}
+}
+
+// post sends one event; any 2xx answer accepts it.
+func (s *Sender) post(ev Event, body []byte) error {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-SFU-Event", ev.Type)
+	if ev.ID != "" {
+		req.Header.Set("X-SFU-Event-ID", ev.ID)
+	}
+	if s.opts.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.opts.Secret))
+		mac.Write(body)
+		req.Header.Set("X-SFU-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// giveUp logs and counts an event that will not be delivered.
+func (s *Sender) giveUp(ev Event, err error) {
+	reason := "attempts"
+	if permanent(err) {
+		reason = "rejected"
+	}
+	appmetrics.RecordWebhookDropped(reason)
+	s.logger.Error("Giving up on webhook event",
+		zap.String("type", ev.Type),
+		zap.String("roomID", ev.RoomID),
+		zap.String("id", ev.ID),
+		zap.String("reason", reason),
+		zap.Error(err),
+	)
+}
+
+// deadLetter appends a stream entry given up on to the dead-letter stream,
+// with the error that ended its delivery. The caller acknowledges it either
+// way.
+func (s *Sender) deadLetter(raw string, cause error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err := s.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.opts.Stream + DeadLetterSuffix,
+		MaxLen: s.opts.StreamMax,
+		Approx: s.opts.StreamMax > 0,
+		Values: map[string]interface{}{"event": raw, "error": cause.Error()},
+	}).Err()
+	if err != nil {
+		s.logger.Warn("Failed to dead-letter webhook event", zap.Error(err))
+	}
+}
+
+// sleep waits for d, returning false if the sender stopped first.
+func (s *Sender) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-s.ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// StreamInfo describes the durable stream and the group's progress.
+type StreamInfo struct {
+	Stream          string `json:"stream"`
+	Group           string `json:"group"`
+	Length          int64  `json:"length"`
+	Pending         int64  `json:"pending"` // read but not yet acknowledged
+	Lag             int64  `json:"lag"`     // not yet read, -1 when unknown
+	LastDeliveredID string `json:"lastDeliveredId,omitempty"`
+	FirstEntryID    string `json:"firstEntryId,omitempty"`
+	LastEntryID     string `json:"lastEntryId,omitempty"`
+}
+
+// Info returns the durable stream's state.
+func (s *Sender) Info(ctx context.Context) (*StreamInfo, error) {
+	info := &StreamInfo{Stream: s.opts.Stream, Group: s.opts.Group, Lag: -1}
+	stream, err := s.redis.XInfoStream(ctx, s.opts.Stream).Result()
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "ERR no such key") {
+			return info, nil
+		}
+		return nil, err
+	}
+	info.Length = stream.Length
+	info.FirstEntryID = stream.FirstEntry.ID
+	info.LastEntryID = stream.LastEntry.ID
+
+	groups, err := s.redis.XInfoGroups(ctx, s.opts.Stream).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g.Name == s.opts.Group {
+			info.Pending = g.Pending
+			info.Lag = g.Lag
+			info.LastDeliveredID = g.LastDeliveredID
+		}
+	}
+	return info, nil
+}
+
+// Trim drops entries from the durable stream, keeping the newest maxLen or,
+// with minID, those from minID on. Entries not yet delivered are dropped
+// too. It returns the number removed.
+func (s *Sender) Trim(ctx context.Context, maxLen int64, minID string) (int64, error) {
+	if minID != "" {
+		return s.redis.XTrimMinID(ctx, s.opts.Stream, minID).Result()
+	}
+	return s.redis.XTrimMaxLen(ctx, s.opts.Stream, maxLen).Result()
+}
+
+// lagInterval is how often the delivery lag is exported.
+const lagInterval = 5 * time.Second
+
+// lagLoop exports the delivery lag until the sender stops, including while
+// the consumer is stuck retrying an event.
+func (s *Sender) lagLoop() {
+	defer s.wg.Done()
+	for s.sleep(lagInterval) {
+		s.updateLag()
+	}
+}
+
+// updateLag exports the events waiting for delivery: read but not yet
+// acknowledged, plus not yet read when Redis reports it.
+func (s *Sender) updateLag() {
+	ctx, cancel := context.WithTimeout(s.ctx, 2*time.Second)
+	defer cancel()
+	info, err := s.Info(ctx)
+	if err != nil {
+		return
+	}
+	waiting := info.Pending
+	if info.Lag > 0 {
+		waiting += info.Lag
+	}
+	appmetrics.WebhookPendingEvents.Set(float64(waiting))
+}
@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// sink records the events it is sent and answers with status(ev).
+type sink struct {
+	mu       sync.Mutex
+	received []Event
+	ids      []string
+	status   func(Event) int
+}
+
+func newSink(t *testing.T, status func(Event) int) (*sink, *httptest.Server) {
+	k := &sink{status: status}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		k.mu.Lock()
+		k.received = append(k.received, ev)
+		k.ids = append(k.ids, r.Header.Get("X-SFU-Event-ID"))
+		k.mu.Unlock()
+		w.WriteHeader(k.status(ev))
+	}))
+	t.Cleanup(srv.Close)
+	return k, srv
+}
+
+func (k *sink) count(typ string) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	n := 0
+	for _, ev := range k.received {
+		if typ == "" || ev.Type == typ {
+			n++
+		}
+	}
+	return n
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	cases := map[error]bool{
+		&StatusError{StatusCode: 400}:                            true,
+		&StatusError{StatusCode: 404}:                            true,
+		&StatusError{StatusCode: 408}:                            false,
+		&StatusError{StatusCode: 429}:                            false,
+		&StatusError{StatusCode: 500}:                            false,
+		&StatusError{StatusCode: 503}:                            false,
+		fmt.Errorf("wrapped: %w", &StatusError{StatusCode: 410}): true,
+		context.DeadlineExceeded:                                 false,
+	}
+	for err, want := range cases {
+		if got := permanent(err); got != want {
+			t.Errorf("permanent(%v) = %v, want %v", err, got, want)
+		}
+	}
+}
+
+func TestSendAfterClose(t *testing.T) {
+	_, srv := newSink(t, func(Event) int { return http.StatusOK })
+	s := NewSender(Options{URL: srv.URL}, nil, zap.NewNop())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Send(Event{Type: "peer-joined", RoomID: "r"})
+			}
+		}()
+	}
+	s.Close()
+	wg.Wait()
+	s.Send(Event{Type: "peer-left", RoomID: "r"})
+}
+
+func TestRejectedEventDoesNotBlock(t *testing.T) {
+	k, srv := newSink(t, func(ev Event) int {
+		if ev.Type == "bad" {
+			return http.StatusBadRequest
+		}
+		return http.StatusOK
+	})
+	s := NewSender(Options{URL: srv.URL}, nil, zap.NewNop())
+	defer s.Close()
+
+	s.Send(Event{Type: "bad", RoomID: "r"})
+	s.Send(Event{Type: "good", RoomID: "r"})
+	waitFor(t, "the event behind the rejected one", func() bool { return k.count("good") == 1 })
+	if n := k.count("bad"); n != 1 {
+		t.Fatalf("rejected event attempted %d times, want 1", n)
+	}
+}
+
+func TestGivesUpAfterMaxAttempts(t *testing.T) {
+	k, srv := newSink(t, func(ev Event) int {
+		if ev.Type == "flaky" {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	s := NewSender(Options{URL: srv.URL, MaxAttempts: 3}, nil, zap.NewNop())
+	defer s.Close()
+
+	s.Send(Event{Type: "flaky", RoomID: "r"})
+	s.Send(Event{Type: "good", RoomID: "r"})
+	waitFor(t, "the event behind the failing one", func() bool { return k.count("good") == 1 })
+	if n := k.count("flaky"); n != 3 {
+		t.Fatalf("failing event attempted %d times, want 3", n)
+	}
+}
+
+func durableOptions(url string) Options {
+	return Options{
+		URL:         url,
+		MaxAttempts: 1000,
+		Durable:     true,
+		Stream:      "webhook:events:test",
+		Group:       "sfu-webhook",
+		Consumer:    "test",
+	}
+}
+
+func TestDurableReplayAfterRestart(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	var mu sync.Mutex
+	up := false
+	k, srv := newSink(t, func(Event) int {
+		mu.Lock()
+		defer mu.Unlock()
+		if up {
+			return http.StatusOK
+		}
+		return http.StatusInternalServerError
+	})
+
+	first := NewSender(durableOptions(srv.URL), rdb, zap.NewNop())
+	for i := 0; i < 3; i++ {
+		first.Send(Event{Type: "peer-joined", RoomID: "r", Seq: uint64(i + 1)})
+	}
+	waitFor(t, "a delivery attempt", func() bool { return k.count("") > 0 })
+	first.Close()
+
+	mu.Lock()
+	up = true
+	mu.Unlock()
+	before := k.count("")
+
+	second := NewSender(durableOptions(srv.URL), rdb, zap.NewNop())
+	defer second.Close()
+	waitFor(t, "the replay", func() bool { return k.count("") >= before+3 })
+
+	k.mu.Lock()
+	replayed := k.received[before:]
+	ids := k.ids[before:]
+	k.mu.Unlock()
+	for i, ev := range replayed[:3] {
+		if ev.Seq != uint64(i+1) {
+			t.Fatalf("event %d replayed with seq %d, want them in order", i, ev.Seq)
+		}
+		if ids[i] == "" || ids[i] != ev.ID {
+			t.Fatalf("event %d has X-SFU-Event-ID %q and id %q", i, ids[i], ev.ID)
+		}
+	}
+
+	waitFor(t, "the acknowledgements", func() bool {
+		info, err := second.Info(context.Background())
+		return err == nil && info.Pending == 0
+	})
+}
+
+func TestDurableDeadLetter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	k, srv := newSink(t, func(ev Event) int {
+		if ev.Type == "bad" {
+			return http.StatusUnprocessableEntity
+		}
+		return http.StatusOK
+	})
+	opts := durableOptions(srv.URL)
+	s := NewSender(opts, rdb, zap.NewNop())
+	defer s.Close()
+
+	s.Send(Event{Type: "bad", RoomID: "r"})
+	s.Send(Event{Type: "good", RoomID: "r"})
+	waitFor(t, "the event behind the rejected one", func() bool { return k.count("good") == 1 })
+
+	dead, err := rdb.XRange(context.Background(), opts.Stream+DeadLetterSuffix, "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].Values["error"] != "webhook answered 422" {
+		t.Fatalf("dead-letter stream holds %+v", dead)
+	}
+	waitFor(t, "the acknowledgements", func() bool {
+		info, err := s.Info(context.Background())
+		return err == nil && info.Pending == 0
+	})
+}
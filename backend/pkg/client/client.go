@@ -0,0 +1,626 @@
+// Package client is a Go client for the SFU's WebSocket signaling protocol.
+//
+// It is meant for bots, integration tests and backend services that need to
+// join rooms without re-implementing the offer/answer/ICE exchange:
+//
+//	c, err := client.Connect("ws://localhost:8080/ws", token, client.Options{UserID: "bot-1"})
+//	sess, err := c.JoinRoom(ctx, "room-123", client.JoinOptions{Name: "Recorder"})
+//	sess.PublishTrack(track)
+//
+// Message structs are shared with internals/signaling, so the client always
+// speaks the same wire format as the server.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrClosed is returned when using a client after Close.
+	ErrClosed = errors.New("client is closed")
+	// ErrAlreadyJoined is returned by JoinRoom when the client is already in
+	// a room; the server supports one room per connection.
+	ErrAlreadyJoined = errors.New("client has already joined a room")
+	// ErrNotConnected is returned when sending while the WebSocket is down.
+	ErrNotConnected = errors.New("signaling connection is down")
+)
+
+// ServerError is an error reported by the SFU in an error message.
+type ServerError struct {
+	signaling.ErrorMessage
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("sfu error %d: %s", e.Code, e.Message)
+}
+
+// Handlers receive room events. All fields are optional. Handlers are called
+// from the client's read goroutine and should not block.
+type Handlers struct {
+	OnPeerJoined      func(signaling.PeerInfo)
+	OnPeerLeft        func(signaling.PeerInfo)
+	OnRoomState       func(signaling.RoomStateMessage)
+	OnTrackPublished  func(signaling.TrackInfo)
+	OnTrackRemoved    func(signaling.TrackInfo)
+	OnTrackPaused     func(signaling.TrackPausedMessage)
+	OnTrackResumed    func(signaling.TrackPausedMessage)
+	OnTrackPriorities func(signaling.TrackPrioritiesMessage)
+	OnDominantSpeaker func(signaling.DominantSpeakerMessage)
+	OnError           func(*ServerError)
+	// OnRoomClosed is called when the server closes the room; the session
+	// has already ended and will not be resumed.
+	OnRoomClosed func(signaling.RoomClosedMessage)
+	// OnTrackStalled is called when a published track has produced no RTP
+	// within the server's window, and again once it starts.
+	OnTrackStalled func(signaling.TrackStalledMessage)
+	// OnLayersInUse is called when the simulcast layers subscribers need
+	// from a published track change; paused layers can be disabled.
+	OnLayersInUse func(signaling.LayersInUseMessage)
+	// OnBitratePolicing is called when the server starts or stops dropping
+	// packets because the session publishes more than the bitrate cap.
+	OnBitratePolicing func(signaling.BitratePolicingMessage)
+	// OnDraining is called when the server starts draining for shutdown;
+	// reconnect before the deadline, to the alternate URL if one is given.
+	OnDraining func(signaling.DrainingMessage)
+	// OnIdleWarning is called when the server considers the session idle
+	// and will disconnect it unless media or signaling activity resumes.
+	OnIdleWarning func(signaling.IdleWarningMessage)
+	// OnParticipantCount is called in broadcast rooms when the number of
+	// publishers or viewers changes; viewers are not announced one by one.
+	OnParticipantCount func(signaling.ParticipantCountMessage)
+	// OnMediaState is called when a participant's mic, camera or screen
+	// state changes, including mutes imposed by the room.
+	OnMediaState func(signaling.MediaStateMessage)
+	// OnUnmuteRequested is called on moderators when a participant asks
+	// to unmute; approve with Session.SetPeerMic.
+	OnUnmuteRequested func(signaling.PeerInfo)
+	// OnPeerUpdated is called when a participant, possibly this session,
+	// changes its display name or is renamed by an admin, or becomes a
+	// viewer when its publishing window ends.
+	OnPeerUpdated func(signaling.PeerInfo)
+	// OnHostChanged is called when the room's host changes, including
+	// when this session joins an empty room and becomes host.
+	OnHostChanged func(signaling.HostChangedMessage)
+	// OnSubscriptionSnapshot is called after the first answer of a resumed
+	// session with the publisher and track on each forwarded m-line.
+	OnSubscriptionSnapshot func(signaling.SubscriptionSnapshotMessage)
+	// OnPublishExpired is called when this session's publishing window
+	// ends; its tracks were removed and it stays as a viewer.
+	OnPublishExpired func(signaling.PublishExpiredMessage)
+	// OnTimeLimit is called as a time-limited room nears its end and when
+	// the limit is extended; the room then closes with reason time-limit.
+	OnTimeLimit func(signaling.TimeLimitMessage)
+	// OnP2POfferPermitted is called when the session and the room's other
+	// participant may connect directly; the initiator offers first, over
+	// Session.RelayP2P. OnP2PFallback ends that connection: media goes
+	// through the SFU again.
+	OnP2POfferPermitted func(signaling.P2POfferPermittedMessage)
+	OnP2PFallback       func(signaling.P2PFallbackMessage)
+	// OnP2PRelay receives what the other participant sent with RelayP2P.
+	OnP2PRelay func(from string, payload json.RawMessage)
+	// OnRelay receives what a peer of the room sent this session with
+	// Session.Relay; OnRelayAck answers this session's reliable relays.
+	OnRelay    func(from string, data json.RawMessage)
+	OnRelayAck func(signaling.RelayAckMessage)
+
+	// OnDisconnected is called when the signaling connection drops.
+	OnDisconnected func(error)
+	// OnResumed is called after a reconnect once the room has been rejoined.
+	// Reattached is set when the PeerConnection was kept across it.
+	OnResumed func(signaling.JoinResponse)
+
+	// OnMessage sees every message before the built-in handling.
+	OnMessage func(signaling.Message)
+}
+
+// Options configures Connect.
+type Options struct {
+	UserID string // required
+	Name   string
+
+	// Extra headers for the WebSocket handshake
+	Header http.Header
+	Dialer *websocket.Dialer
+
+	// AutoReconnect redials after the connection drops and resumes the
+	// room session with the session credentials from the join reply.
+	AutoReconnect       bool
+	ReconnectMinBackoff time.Duration // default 500ms
+	ReconnectMaxBackoff time.Duration // default 30s
+
+	// RequestTimeout bounds waiting for replies such as the join response
+	// when the caller's context has no deadline. Default 15s.
+	RequestTimeout time.Duration
+
+	Handlers Handlers
+	Logger   *zap.Logger
+}
+
+// Client is a signaling connection to the SFU.
+type Client struct {
+	url    string
+	header http.Header
+	opts   Options
+	logger *zap.Logger
+
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	waiters []*waiter
+	session *Session
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// waiter receives the next message of one of its types.
+type waiter struct {
+	types []signaling.MessageType
+	ch    chan signaling.Message
+}
+
+// Connect dials the SFU's signaling endpoint. token, if set, is sent as a
+// bearer token in the handshake.
+func Connect(rawURL, token string, opts Options) (*Client, error) {
+	if opts.UserID == "" {
+		return nil, errors.New("client: Options.UserID is required")
+	}
+	if opts.ReconnectMinBackoff <= 0 {
+		opts.ReconnectMinBackoff = 500 * time.Millisecond
+	}
+	if opts.ReconnectMaxBackoff <= 0 {
+		opts.ReconnectMaxBackoff = 30 * time.Second
+	}
+	if opts.RequestTimeout <= 0 {
+		opts.RequestTimeout = 15 * time.Second
+	}
+	if opts.Dialer == nil {
+		opts.Dialer = websocket.DefaultDialer
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("userId", opts.UserID)
+	if opts.Name != "" {
+		q.Set("name", opts.Name)
+	}
+	u.RawQuery = q.Encode()
+
+	header := http.Header{}
+	for k, v := range opts.Header {
+		header[k] = v
+	}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	c := &Client{
+		url:    u.String(),
+		header: header,
+		opts:   opts,
+		logger: logger,
+		closed: make(chan struct{}),
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	go c.readLoop(conn)
+
+	return c, nil
+}
+
+func (c *Client) dial() (*websocket.Conn, error) {
+	conn, _, err := c.opts.Dialer.Dial(c.url, c.header)
+	return conn, err
+}
+
+// Send sends a message whose data is marshalled from data.
+func (c *Client) Send(msgType signaling.MessageType, data interface{}) error {
+	var raw json.RawMessage
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		raw = b
+	}
+	return c.write(signaling.Message{Type: msgType, Data: raw})
+}
+
+// write stamps msg with the local time and sends it.
+func (c *Client) write(msg signaling.Message) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	now := time.Now()
+	msg.Timestamp, msg.ClientTS = now, now.UnixMilli()
+	return conn.WriteJSON(msg)
+}
+
+// SyncTime pings the server and estimates the local clock's offset from
+// server time (server minus local) and the round-trip time.
+func (c *Client) SyncTime(ctx context.Context) (offset, rtt time.Duration, err error) {
+	msg, err := c.request(ctx, signaling.MessageTypePing, nil, signaling.MessageTypePong)
+	if err != nil {
+		return 0, 0, err
+	}
+	arrived := time.Now().UnixMilli()
+	var v signaling.TimeSyncMessage
+	if !decode(msg, &v) || v.ClientTS == 0 || v.ServerTS == 0 {
+		return 0, 0, errors.New("client: invalid pong")
+	}
+	offsetMs := ((v.ServerReceivedTS - v.ClientTS) + (v.ServerTS - arrived)) / 2
+	rttMs := (arrived - v.ClientTS) - (v.ServerTS - v.ServerReceivedTS)
+	return time.Duration(offsetMs) * time.Millisecond, time.Duration(rttMs) * time.Millisecond, nil
+}
+
+// request sends a message and waits for the first reply of one of the given
+// types, turning an error message into a *ServerError.
+func (c *Client) request(ctx context.Context, msgType signaling.MessageType, data interface{}, replies ...signaling.MessageType) (signaling.Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.RequestTimeout)
+		defer cancel()
+	}
+
+	w := &waiter{
+		types: append(replies, signaling.MessageTypeError),
+		ch:    make(chan signaling.Message, 1),
+	}
+	c.mu.Lock()
+	c.waiters = append(c.waiters, w)
+	c.mu.Unlock()
+	defer c.removeWaiter(w)
+
+	if err := c.Send(msgType, data); err != nil {
+		return signaling.Message{}, err
+	}
+
+	select {
+	case msg := <-w.ch:
+		if msg.Type == signaling.MessageTypeError {
+			return msg, decodeServerError(msg)
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return signaling.Message{}, ctx.Err()
+	case <-c.closed:
+		return signaling.Message{}, ErrClosed
+	}
+}
+
+func (c *Client) removeWaiter(w *waiter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.waiters {
+		if other == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// notifyWaiters hands msg to the oldest waiter expecting its type.
+func (c *Client) notifyWaiters(msg signaling.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, w := range c.waiters {
+		for _, t := range w.types {
+			if t == msg.Type {
+				w.ch <- msg
+				c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) readLoop(conn *websocket.Conn) {
+	for {
+		var msg signaling.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			c.handleDisconnect(conn, err)
+			return
+		}
+		c.dispatch(msg)
+	}
+}
+
+func (c *Client) handleDisconnect(conn *websocket.Conn, err error) {
+	select {
+	case <-c.closed:
+		return
+	default:
+	}
+
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	c.mu.Unlock()
+	conn.Close()
+
+	c.logger.Warn("Signaling connection lost", zap.Error(err))
+	if h := c.opts.Handlers.OnDisconnected; h != nil {
+		h(err)
+	}
+
+	if c.opts.AutoReconnect {
+		go c.reconnectLoop()
+	}
+}
+
+// reconnectLoop redials with exponential backoff and resumes the session.
+func (c *Client) reconnectLoop() {
+	backoff := c.opts.ReconnectMinBackoff
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-time.After(backoff):
+		}
+
+		conn, err := c.dial()
+		if err != nil {
+			c.logger.Debug("Reconnect failed", zap.Error(err), zap.Duration("backoff", backoff))
+			backoff = min(backoff*2, c.opts.ReconnectMaxBackoff)
+			continue
+		}
+
+		c.mu.Lock()
+		c.conn = conn
+		sess := c.session
+		c.mu.Unlock()
+		go c.readLoop(conn)
+
+		c.logger.Info("Signaling connection re-established")
+		if sess != nil {
+			if err := sess.resume(context.Background()); err != nil {
+				c.logger.Warn("Failed to resume room session", zap.Error(err))
+			}
+		}
+		return
+	}
+}
+
+func (c *Client) dispatch(msg signaling.Message) {
+	h := c.opts.Handlers
+	if h.OnMessage != nil {
+		h.OnMessage(msg)
+	}
+	c.notifyWaiters(msg)
+
+	c.mu.Lock()
+	sess := c.session
+	c.mu.Unlock()
+
+	switch msg.Type {
+	case signaling.MessageTypePeerJoined:
+		var v signaling.PeerInfo
+		if decode(msg, &v) && h.OnPeerJoined != nil {
+			h.OnPeerJoined(v)
+		}
+	case signaling.MessageTypePeerLeft:
+		var v signaling.PeerInfo
+		if decode(msg, &v) && h.OnPeerLeft != nil {
+			h.OnPeerLeft(v)
+		}
+	case signaling.MessageTypeRoomState:
+		var v signaling.RoomStateMessage
+		if decode(msg, &v) && h.OnRoomState != nil {
+			h.OnRoomState(v)
+		}
+	case signaling.MessageTypeTrackPublished:
+		var v signaling.TrackInfo
+		if decode(msg, &v) && h.OnTrackPublished != nil {
+			h.OnTrackPublished(v)
+		}
+	case signaling.MessageTypeTrackRemoved:
+		var v signaling.TrackInfo
+		if decode(msg, &v) && h.OnTrackRemoved != nil {
+			h.OnTrackRemoved(v)
+		}
+	case signaling.MessageTypeTrackPaused:
+		var v signaling.TrackPausedMessage
+		if decode(msg, &v) && h.OnTrackPaused != nil {
+			h.OnTrackPaused(v)
+		}
+	case signaling.MessageTypeTrackResumed:
+		var v signaling.TrackPausedMessage
+		if decode(msg, &v) && h.OnTrackResumed != nil {
+			h.OnTrackResumed(v)
+		}
+	case signaling.MessageTypeTrackPriorities:
+		var v signaling.TrackPrioritiesMessage
+		if decode(msg, &v) && h.OnTrackPriorities != nil {
+			h.OnTrackPriorities(v)
+		}
+	case signaling.MessageTypeDominantSpeaker:
+		var v signaling.DominantSpeakerMessage
+		if decode(msg, &v) && h.OnDominantSpeaker != nil {
+			h.OnDominantSpeaker(v)
+		}
+	case signaling.MessageTypeRoomClosed:
+		var v signaling.RoomClosedMessage
+		if decode(msg, &v) && h.OnRoomClosed != nil {
+			h.OnRoomClosed(v)
+		}
+	case signaling.MessageTypeDraining:
+		var v signaling.DrainingMessage
+		if decode(msg, &v) && h.OnDraining != nil {
+			h.OnDraining(v)
+		}
+	case signaling.MessageTypeIdleWarning:
+		var v signaling.IdleWarningMessage
+		if decode(msg, &v) && h.OnIdleWarning != nil {
+			h.OnIdleWarning(v)
+		}
+	case signaling.MessageTypeParticipantCount:
+		var v signaling.ParticipantCountMessage
+		if decode(msg, &v) && h.OnParticipantCount != nil {
+			h.OnParticipantCount(v)
+		}
+	case signaling.MessageTypeMediaState:
+		var v signaling.MediaStateMessage
+		if decode(msg, &v) && h.OnMediaState != nil {
+			h.OnMediaState(v)
+		}
+	case signaling.MessageTypeUnmuteRequested:
+		var v signaling.PeerInfo
+		if decode(msg, &v) && h.OnUnmuteRequested != nil {
+			h.OnUnmuteRequested(v)
+		}
+	case signaling.MessageTypePeerUpdated:
+		var v signaling.PeerInfo
+		if decode(msg, &v) && h.OnPeerUpdated != nil {
+			h.OnPeerUpdated(v)
+		}
+	case signaling.MessageTypeHostChanged:
+		var v signaling.HostChangedMessage
+		if decode(msg, &v) && h.OnHostChanged != nil {
+			h.OnHostChanged(v)
+		}
+	case signaling.MessageTypeSubscriptionSnapshot:
+		var v signaling.SubscriptionSnapshotMessage
+		if decode(msg, &v) && h.OnSubscriptionSnapshot != nil {
+			h.OnSubscriptionSnapshot(v)
+		}
+	case signaling.MessageTypePublishExpired:
+		var v signaling.PublishExpiredMessage
+		if decode(msg, &v) && h.OnPublishExpired != nil {
+			h.OnPublishExpired(v)
+		}
+	case signaling.MessageTypeTimeLimit:
+		var v signaling.TimeLimitMessage
+		if decode(msg, &v) && h.OnTimeLimit != nil {
+			h.OnTimeLimit(v)
+		}
+	case signaling.MessageTypeP2POfferPermitted:
+		var v signaling.P2POfferPermittedMessage
+		if decode(msg, &v) && h.OnP2POfferPermitted != nil {
+			h.OnP2POfferPermitted(v)
+		}
+	case signaling.MessageTypeP2PFallback:
+		var v signaling.P2PFallbackMessage
+		if decode(msg, &v) && h.OnP2PFallback != nil {
+			h.OnP2PFallback(v)
+		}
+	case signaling.MessageTypeP2PRelay:
+		if h.OnP2PRelay != nil {
+			h.OnP2PRelay(msg.From, msg.Data)
+		}
+	case signaling.MessageTypeRelay:
+		if h.OnRelay != nil {
+			h.OnRelay(msg.From, msg.Data)
+		}
+	case signaling.MessageTypeRelayAck:
+		var v signaling.RelayAckMessage
+		if decode(msg, &v) && h.OnRelayAck != nil {
+			h.OnRelayAck(v)
+		}
+	case signaling.MessageTypeTrackStalled:
+		var v signaling.TrackStalledMessage
+		if decode(msg, &v) && h.OnTrackStalled != nil {
+			h.OnTrackStalled(v)
+		}
+	case signaling.MessageTypeLayersInUse:
+		var v signaling.LayersInUseMessage
+		if decode(msg, &v) && h.OnLayersInUse != nil {
+			h.OnLayersInUse(v)
+		}
+	case signaling.MessageTypeBitratePolicing:
+		var v signaling.BitratePolicingMessage
+		if decode(msg, &v) && h.OnBitratePolicing != nil {
+			h.OnBitratePolicing(v)
+		}
+	case signaling.MessageTypeError:
+		if h.OnError != nil {
+			var serr *ServerError
+			if errors.As(decodeServerError(msg), &serr) {
+				h.OnError(serr)
+			}
+		}
+	case signaling.MessageTypePing:
+		c.Send(signaling.MessageTypePong, nil)
+	}
+
+	if sess != nil {
+		sess.handleMessage(msg)
+	}
+}
+
+// Close leaves the room, if any, and closes the connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	sess := c.session
+	c.mu.Unlock()
+	if sess != nil {
+		sess.Leave()
+	}
+
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.mu.Lock()
+		conn := c.conn
+		c.conn = nil
+		c.mu.Unlock()
+		if conn != nil {
+			c.writeMu.Lock()
+			conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			c.writeMu.Unlock()
+			err = conn.Close()
+		}
+	})
+	return err
+}
+
+// decode unmarshals a message's data, accepting both object and
+// string-encoded JSON like the server does.
+func decode(msg signaling.Message, out interface{}) bool {
+	if err := json.Unmarshal(msg.Data, out); err == nil {
+		return true
+	}
+	var s string
+	if err := json.Unmarshal(msg.Data, &s); err != nil {
+		return false
+	}
+	return json.Unmarshal([]byte(s), out) == nil
+}
+
+func decodeServerError(msg signaling.Message) error {
+	var em signaling.ErrorMessage
+	if !decode(msg, &em) {
+		return fmt.Errorf("sfu error: %s", string(msg.Data))
+	}
+	return &ServerError{ErrorMessage: em}
+}
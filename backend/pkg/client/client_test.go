@@ -0,0 +1,326 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/config"
+	"github.com/adityaadpandey/sfu-go/internals/sfu"
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/adityaadpandey/sfu-go/internals/utils"
+	"github.com/adityaadpandey/sfu-go/pkg/client"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"go.uber.org/zap"
+)
+
+// startSFU runs an SFU on a free local port, with its state in a miniredis,
+// and returns its signaling URL.
+func startSFU(t *testing.T) string {
+	t.Helper()
+	if utils.Logger == nil {
+		utils.Logger = zap.NewNop()
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	cfg := config.LoadConfig()
+	cfg.Server.Host = "127.0.0.1"
+	cfg.Server.Port = port
+	cfg.Redis.Addr = miniredis.RunT(t).Addr()
+	cfg.Redis.Required = true
+	s, err := sfu.NewSFU(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	t.Cleanup(s.Stop)
+
+	base := fmt.Sprintf("127.0.0.1:%d", port)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get("http://" + base + cfg.Server.HealthPath)
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("SFU not serving: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return "ws://" + base + cfg.Server.WSPath
+}
+
+func connect(t *testing.T, url, userID string, opts client.Options) *client.Client {
+	t.Helper()
+	opts.UserID = userID
+	c, err := client.Connect(url, "", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func joinRoom(t *testing.T, c *client.Client, roomID string, opts client.JoinOptions) *client.Session {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sess, err := c.JoinRoom(ctx, roomID, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+// sendSamples writes a sample to track every 20ms until the test ends.
+func sendSamples(t *testing.T, track *webrtc.TrackLocalStaticSample) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				track.WriteSample(media.Sample{Data: []byte{0xf8, 0xff, 0xfe}, Duration: 20 * time.Millisecond})
+			}
+		}
+	}()
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPublishAndReceive(t *testing.T) {
+	url := startSFU(t)
+
+	var joined sync.Map
+	alice := joinRoom(t, connect(t, url, "alice", client.Options{Handlers: client.Handlers{
+		OnPeerJoined: func(p signaling.PeerInfo) { joined.Store(p.UserID, p.PeerID) },
+	}}), "room-1", client.JoinOptions{Name: "Alice"})
+	track, err := client.NewSampleTrack(webrtc.MimeTypeOpus, "alice-audio", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.PublishTrack(track); err != nil {
+		t.Fatal(err)
+	}
+	sendSamples(t, track)
+
+	var (
+		published atomic.Value
+		packets   atomic.Int64
+		streamID  atomic.Value
+	)
+	bob := joinRoom(t, connect(t, url, "bob", client.Options{Handlers: client.Handlers{
+		OnTrackPublished: func(info signaling.TrackInfo) { published.Store(info.Kind) },
+	}}), "room-1", client.JoinOptions{
+		Name: "Bob",
+		OnTrack: func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+			streamID.Store(remote.StreamID())
+			for {
+				if _, _, err := remote.ReadRTP(); err != nil {
+					return
+				}
+				packets.Add(1)
+			}
+		},
+	})
+
+	eventually(t, "bob to receive alice's audio", func() bool { return packets.Load() > 10 })
+	if got := streamID.Load(); got != alice.PeerID() {
+		t.Fatalf("track forwarded with stream %v, want alice's peer %s", got, alice.PeerID())
+	}
+	eventually(t, "alice to hear of bob", func() bool {
+		id, ok := joined.Load("bob")
+		return ok && id == bob.PeerID()
+	})
+	if bob.Info().RoomID != "room-1" || bob.Info().SessionID == "" {
+		t.Fatalf("join reply %+v", bob.Info())
+	}
+}
+
+// cuttingDialer keeps the raw connections it dials, so a test can cut them.
+type cuttingDialer struct {
+	conns sync.Map // dial number -> net.Conn
+	dials atomic.Int32
+}
+
+func (d *cuttingDialer) websocket() *websocket.Dialer {
+	return &websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err == nil {
+				d.conns.Store(d.dials.Add(1), conn)
+			}
+			return conn, err
+		},
+	}
+}
+
+// cut closes the nth connection dialed.
+func (d *cuttingDialer) cut(n int32) {
+	if conn, ok := d.conns.Load(n); ok {
+		conn.(net.Conn).Close()
+	}
+}
+
+func TestResumeAfterReconnect(t *testing.T) {
+	url := startSFU(t)
+
+	dialer := &cuttingDialer{}
+	resumed := make(chan signaling.JoinResponse, 1)
+	c := connect(t, url, "alice", client.Options{
+		Dialer:              dialer.websocket(),
+		AutoReconnect:       true,
+		ReconnectMinBackoff: 10 * time.Millisecond,
+		Handlers: client.Handlers{
+			OnResumed: func(info signaling.JoinResponse) { resumed <- info },
+		},
+	})
+	sess := joinRoom(t, c, "room-1", client.JoinOptions{Name: "Alice"})
+	first := sess.Info()
+
+	dialer.cut(1)
+
+	select {
+	case info := <-resumed:
+		if !info.Resumed || info.SessionID != first.SessionID {
+			t.Fatalf("rejoined as %+v, want session %s resumed", info, first.SessionID)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("session not resumed")
+	}
+	if n := dialer.dials.Load(); n != 2 {
+		t.Fatalf("%d dials, want the first and one reconnect", n)
+	}
+}
+
+func TestJoinRoomTwice(t *testing.T) {
+	url := startSFU(t)
+	c := connect(t, url, "alice", client.Options{})
+	joinRoom(t, c, "room-1", client.JoinOptions{})
+	if _, err := c.JoinRoom(context.Background(), "room-2", client.JoinOptions{}); err != client.ErrAlreadyJoined {
+		t.Fatalf("second join: err = %v, want %v", err, client.ErrAlreadyJoined)
+	}
+}
+
+func TestSeqMonotonicAcrossReconnects(t *testing.T) {
+	url := startSFU(t)
+	dialer := &cuttingDialer{}
+	var (
+		mu       sync.Mutex
+		messages []signaling.Message
+		acked    atomic.Int32
+	)
+	resumed := make(chan signaling.JoinResponse, 1)
+	c := connect(t, url, "alice", client.Options{
+		Dialer:              dialer.websocket(),
+		AutoReconnect:       true,
+		ReconnectMinBackoff: 10 * time.Millisecond,
+		Handlers: client.Handlers{
+			OnResumed: func(info signaling.JoinResponse) { resumed <- info },
+			OnMessage: func(m signaling.Message) {
+				mu.Lock()
+				messages = append(messages, m)
+				mu.Unlock()
+				if m.Type == signaling.MessageTypeDataBroadcast {
+					acked.Add(1)
+				}
+			},
+		},
+	})
+	sess := joinRoom(t, c, "room-1", client.JoinOptions{})
+
+	// Another connection's messages share the counter without reordering
+	// alice's
+	bob := joinRoom(t, connect(t, url, "bob", client.Options{}), "room-1", client.JoinOptions{})
+	for cut := int32(1); cut <= 3; cut++ {
+		if err := sess.Broadcast(map[string]int32{"before": cut}, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := bob.Broadcast(map[string]int32{"bob": cut}, false); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, "the broadcast's ack", func() bool { return acked.Load() == cut })
+		dialer.cut(cut)
+		select {
+		case <-resumed:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("not resumed after cut %d", cut)
+		}
+	}
+	if err := sess.Broadcast(map[string]string{"after": "all"}, false); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the last broadcast's ack", func() bool { return acked.Load() == 4 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	var last uint64
+	acks := 0
+	for _, m := range messages {
+		if m.Seq <= last {
+			t.Fatalf("%s with seq %d after %d", m.Type, m.Seq, last)
+		}
+		last = m.Seq
+		if m.Timestamp.IsZero() || m.ServerTS == 0 {
+			t.Fatalf("%s without server time: %+v", m.Type, m)
+		}
+		if m.Type == signaling.MessageTypeDataBroadcast {
+			// The ack echoes the client's clock
+			if m.ClientTS == 0 {
+				t.Fatalf("data-broadcast ack without clientTs")
+			}
+			acks++
+		}
+	}
+	if acks != 4 {
+		t.Fatalf("%d data-broadcast acks, want 4", acks)
+	}
+}
+
+func TestSyncTime(t *testing.T) {
+	url := startSFU(t)
+	c := connect(t, url, "alice", client.Options{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Client and server share a clock here
+	offset, rtt, err := c.SyncTime(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset < -time.Second || offset > time.Second || rtt < 0 || rtt > time.Second {
+		t.Fatalf("offset %v, round trip %v", offset, rtt)
+	}
+}
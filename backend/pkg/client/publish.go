@@ -0,0 +1,260 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/pion/webrtc/v3"
+)
+
+// NewSampleTrack creates a track that media can be written to with
+// WriteSample, e.g. from pion's media readers (ivfreader, oggreader) or an
+// encoder. mimeType is a codec such as webrtc.MimeTypeOpus or
+// webrtc.MimeTypeVP8; streamID groups tracks of one participant. Track IDs
+// must be unique within a room.
+func NewSampleTrack(mimeType, trackID, streamID string) (*webrtc.TrackLocalStaticSample, error) {
+	capability := webrtc.RTPCodecCapability{MimeType: mimeType}
+	if strings.EqualFold(mimeType, webrtc.MimeTypeOpus) {
+		capability.ClockRate = 48000
+		capability.Channels = 2
+	} else {
+		capability.ClockRate = 90000
+	}
+	return webrtc.NewTrackLocalStaticSample(capability, trackID, streamID)
+}
+
+// PublishTrack sends track to the SFU and renegotiates. The track is
+// republished automatically if the session is rejoined.
+func (s *Session) PublishTrack(track webrtc.TrackLocal) (*webrtc.RTPSender, error) {
+	s.mu.Lock()
+	pc := s.pc
+	s.mu.Unlock()
+
+	sender, err := pc.AddTrack(track)
+	if err != nil {
+		return nil, err
+	}
+	go drainRTCP(sender)
+
+	s.mu.Lock()
+	s.published = append(s.published, track)
+	s.mu.Unlock()
+
+	return sender, s.negotiate()
+}
+
+// UnpublishTrack stops sending a track previously published with
+// PublishTrack and renegotiates.
+func (s *Session) UnpublishTrack(sender *webrtc.RTPSender) error {
+	track := sender.Track()
+
+	s.mu.Lock()
+	pc := s.pc
+	for i, t := range s.published {
+		if t == track {
+			s.published = append(s.published[:i], s.published[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if err := pc.RemoveTrack(sender); err != nil {
+		return err
+	}
+	return s.negotiate()
+}
+
+// ReplaceTrack swaps a track previously published with PublishTrack for
+// another of the same kind and codec, e.g. after switching cameras.
+// Subscribers keep receiving it under the same handle without
+// renegotiating. It returns the new track's sender.
+func (s *Session) ReplaceTrack(ctx context.Context, old *webrtc.RTPSender, track webrtc.TrackLocal) (*webrtc.RTPSender, error) {
+	prev := old.Track()
+	if prev == nil {
+		return nil, errors.New("client: sender has no track")
+	}
+	msg, err := s.c.request(ctx, signaling.MessageTypePublishIntent, signaling.PublishIntentMessage{
+		Replaces: map[string]string{track.ID(): prev.ID()},
+	}, signaling.MessageTypePublishIntent)
+	if err != nil {
+		return nil, err
+	}
+	var resp signaling.PublishIntentResponse
+	if !decode(msg, &resp) || resp.Replaces[track.ID()] == "" {
+		return nil, errors.New("client: invalid publish-intent response")
+	}
+
+	s.mu.Lock()
+	pc := s.pc
+	s.mu.Unlock()
+
+	if err := pc.RemoveTrack(old); err != nil {
+		return nil, err
+	}
+	sender, err := pc.AddTrack(track)
+	if err != nil {
+		return nil, err
+	}
+	go drainRTCP(sender)
+
+	s.mu.Lock()
+	for i, t := range s.published {
+		if t == prev {
+			s.published[i] = track
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	return sender, s.negotiate()
+}
+
+// DeclareCodecAlternatives tells the SFU that the given track IDs carry the
+// same source in different codecs, so each subscriber receives only the one
+// it supports best. Call it before publishing the tracks. It returns the
+// group ID subscribers see as the track ID.
+func (s *Session) DeclareCodecAlternatives(ctx context.Context, trackIDs ...string) (string, error) {
+	msg, err := s.c.request(ctx, signaling.MessageTypePublishIntent, signaling.PublishIntentMessage{
+		Alternatives: [][]string{trackIDs},
+	}, signaling.MessageTypePublishIntent)
+	if err != nil {
+		return "", err
+	}
+	var resp signaling.PublishIntentResponse
+	if !decode(msg, &resp) || len(resp.Groups) == 0 {
+		return "", errors.New("client: invalid publish-intent response")
+	}
+	return resp.Groups[0].GroupID, nil
+}
+
+// Subscribe asks the SFU to forward the given track or codec group handles,
+// as listed in room-state and track-published. The tracks arrive through
+// OnTrack after the renegotiation that follows.
+func (s *Session) Subscribe(ctx context.Context, trackIDs ...string) (signaling.SubscriptionAckMessage, error) {
+	return s.changeSubscriptions(ctx, signaling.MessageTypeSubscribe, signaling.SubscribeMessage{TrackIDs: trackIDs})
+}
+
+// Unsubscribe stops forwarding the given track or codec group handles.
+func (s *Session) Unsubscribe(ctx context.Context, trackIDs ...string) (signaling.SubscriptionAckMessage, error) {
+	return s.changeSubscriptions(ctx, signaling.MessageTypeUnsubscribe, signaling.SubscribeMessage{TrackIDs: trackIDs})
+}
+
+// UpdateSubscriptions drops and adds several subscriptions in one request,
+// which the SFU follows with a single renegotiation.
+func (s *Session) UpdateSubscriptions(ctx context.Context, subscribe, unsubscribe []string) (signaling.SubscriptionAckMessage, error) {
+	return s.changeSubscriptions(ctx, signaling.MessageTypeSubscribe, signaling.SubscribeMessage{
+		Subscribe:   subscribe,
+		Unsubscribe: unsubscribe,
+	})
+}
+
+func (s *Session) changeSubscriptions(ctx context.Context, msgType signaling.MessageType, req signaling.SubscribeMessage) (signaling.SubscriptionAckMessage, error) {
+	var ack signaling.SubscriptionAckMessage
+	msg, err := s.c.request(ctx, msgType, req, signaling.MessageTypeSubscriptionAck)
+	if err != nil {
+		return ack, err
+	}
+	if !decode(msg, &ack) {
+		return ack, errors.New("client: invalid subscription-ack")
+	}
+	return ack, nil
+}
+
+// SwitchLayer selects the simulcast layer (RID) received for a track handle.
+func (s *Session) SwitchLayer(trackID, rid string) error {
+	return s.c.Send(signaling.MessageTypeLayerSwitch, map[string]string{
+		"trackId":   trackID,
+		"targetRid": rid,
+	})
+}
+
+// RequestKeyframe asks the SFU to request a keyframe from a track's
+// publisher, with FIR instead of PLI if fir is set.
+func (s *Session) RequestKeyframe(trackID string, fir bool) error {
+	return s.c.Send(signaling.MessageTypeRequestKeyframe, signaling.RequestKeyframeMessage{
+		TrackID: trackID,
+		FIR:     fir,
+	})
+}
+
+// SetMic reports the local mic state. In rooms that enforce muting the SFU
+// withholds audio while the mic is off, and an unmute may be refused or
+// reverted; OnMediaState reports the outcome.
+func (s *Session) SetMic(enabled bool) error {
+	return s.c.Send(signaling.MessageTypeMediaState, signaling.MediaStateRequest{MicEnabled: &enabled})
+}
+
+// SetPeerMic mutes or unmutes another participant's mic. It requires the
+// moderator role.
+func (s *Session) SetPeerMic(peerID string, enabled bool) error {
+	return s.c.Send(signaling.MessageTypeMediaState, signaling.MediaStateRequest{PeerID: peerID, MicEnabled: &enabled})
+}
+
+// SetName changes the session's display name for the rest of the call;
+// OnPeerUpdated confirms it.
+func (s *Session) SetName(name string) error {
+	return s.c.Send(signaling.MessageTypeUpdateName, signaling.UpdateNameMessage{Name: name})
+}
+
+// TransferHost hands the host role to another participant. Only the host
+// may; OnHostChanged confirms it.
+func (s *Session) TransferHost(peerID string) error {
+	return s.c.Send(signaling.MessageTypeTransferHost, signaling.TransferHostMessage{PeerID: peerID})
+}
+
+// ExtendTimeLimit moves the room's time limit by d, rounded down to whole
+// seconds. It requires the moderator role; OnTimeLimit reports the new end.
+func (s *Session) ExtendTimeLimit(d time.Duration) error {
+	return s.c.Send(signaling.MessageTypeExtendTimeLimit, signaling.ExtendTimeLimitMessage{ExtendSec: int(d / time.Second)})
+}
+
+// Broadcast relays payload to the data channels of the room's peers.
+func (s *Session) Broadcast(payload interface{}, excludeSelf bool) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.c.Send(signaling.MessageTypeDataBroadcast, signaling.DataBroadcastMessage{
+		Payload:     data,
+		ExcludeSelf: excludeSelf,
+	})
+}
+
+// RelayP2P sends payload, e.g. an SDP or ICE candidate, to peerID through
+// the SFU while the two may connect directly (see
+// Handlers.OnP2POfferPermitted).
+func (s *Session) RelayP2P(peerID string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.c.write(signaling.Message{Type: signaling.MessageTypeP2PRelay, Data: data, To: peerID})
+}
+
+// Relay sends payload to peers of the room, which receive it in
+// Handlers.OnRelay. A reliable relay is answered in Handlers.OnRelayAck.
+func (s *Session) Relay(peerIDs []string, payload interface{}, reliable bool) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.c.Send(signaling.MessageTypeRelay, signaling.RelayMessage{
+		PeerIDs:  peerIDs,
+		Data:     data,
+		Reliable: reliable,
+	})
+}
+
+// drainRTCP reads RTCP from a sender so pion's interceptors keep running.
+func drainRTCP(sender *webrtc.RTPSender) {
+	buf := make([]byte, 1500)
+	for {
+		if _, _, err := sender.Read(buf); err != nil {
+			return
+		}
+	}
+}
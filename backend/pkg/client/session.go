@@ -0,0 +1,612 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/adityaadpandey/sfu-go/internals/signaling"
+	"github.com/pion/webrtc/v3"
+	"go.uber.org/zap"
+)
+
+// ErrNoPeerConnectionFactory is returned when a session that was joined with
+// a caller-supplied PeerConnection must be re-established but
+// JoinOptions.NewPeerConnection is not set.
+var ErrNoPeerConnectionFactory = errors.New("client: cannot rejoin without JoinOptions.NewPeerConnection")
+
+// JoinOptions configures JoinRoom.
+type JoinOptions struct {
+	Name        string
+	InviteToken string
+	Metadata    map[string]interface{}
+	// Observer joins hidden from other participants and receive-only. The
+	// first join needs an invite with the observer or admin role.
+	Observer bool
+	// AutoSubscribe overrides the server's default subscription mode. With
+	// false no tracks are received until Subscribe asks for them. A resumed
+	// session is subscribed again to the tracks that still exist, listed in
+	// Info().Subscriptions.
+	AutoSubscribe *bool
+	// RelayOnly restricts ICE to TURN relay candidates on both sides. The
+	// SFU refuses the join if it has no TURN server. PeerConnections created
+	// internally then use the ICE servers from the join reply.
+	RelayOnly bool
+
+	// PeerConnection, if set, is used for the first join instead of one
+	// created internally. The server always receives the offer, so the
+	// PeerConnection must not be negotiated elsewhere.
+	PeerConnection *webrtc.PeerConnection
+	// NewPeerConnection creates the PeerConnection when the session has to
+	// be re-established (reconnect, reconnect-required). Required for
+	// resume when PeerConnection is set; otherwise API/Configuration are
+	// used.
+	NewPeerConnection func() (*webrtc.PeerConnection, error)
+
+	API           *webrtc.API // defaults to webrtc.NewPeerConnection
+	Configuration webrtc.Configuration
+
+	// Receive transceivers allocated up front (default 4 each). More are
+	// added when the server asks to renegotiate for more tracks.
+	RecvVideo int
+	RecvAudio int
+
+	// OnTrack is called for each track the SFU forwards to this session.
+	OnTrack func(*webrtc.TrackRemote, *webrtc.RTPReceiver)
+	// OnData, if set, opens a data channel and receives room broadcasts
+	// (see Session.Broadcast), including history replayed on join.
+	OnData func([]byte)
+}
+
+// Session is a joined room. It owns the PeerConnection negotiation with the
+// SFU: the client always sends the offer, and the server asks for a new offer
+// with a renegotiate message whenever its set of forwarded tracks changes.
+type Session struct {
+	c      *Client
+	roomID string
+	opts   JoinOptions
+
+	mu                sync.Mutex
+	pc                *webrtc.PeerConnection
+	info              signaling.JoinResponse
+	negotiating       bool
+	pendingNegotiate  bool
+	negotiationID     string // from the last renegotiate, echoed in the next offer
+	pendingCandidates []webrtc.ICECandidateInit
+	published         []webrtc.TrackLocal // re-added when the session is rejoined
+	answered          chan struct{}
+	left              bool
+}
+
+// JoinRoom joins roomID, negotiates media with the SFU and returns once the
+// first answer has been applied.
+func (c *Client) JoinRoom(ctx context.Context, roomID string, opts JoinOptions) (*Session, error) {
+	if opts.RecvVideo <= 0 {
+		opts.RecvVideo = 4
+	}
+	if opts.RecvAudio <= 0 {
+		opts.RecvAudio = 4
+	}
+
+	c.mu.Lock()
+	if c.session != nil {
+		c.mu.Unlock()
+		return nil, ErrAlreadyJoined
+	}
+	s := &Session{c: c, roomID: roomID, opts: opts}
+	c.session = s
+	c.mu.Unlock()
+
+	if err := s.join(ctx, opts.PeerConnection, nil); err != nil {
+		c.mu.Lock()
+		c.session = nil
+		c.mu.Unlock()
+		return nil, err
+	}
+	return s, nil
+}
+
+// join sends the join request (resuming with prev's session credentials if
+// given), sets up a PeerConnection and completes the first negotiation. When
+// resuming with pc, the SFU is asked to reattach pc's peer; if it does, pc is
+// kept as is and no negotiation is needed.
+func (s *Session) join(ctx context.Context, pc *webrtc.PeerConnection, prev *signaling.JoinResponse) error {
+	req := struct {
+		signaling.JoinMessage
+		SessionID    string `json:"sessionId,omitempty"`
+		SessionToken string `json:"sessionToken,omitempty"`
+	}{
+		JoinMessage: signaling.JoinMessage{
+			RoomID:        s.roomID,
+			UserID:        s.c.opts.UserID,
+			Name:          s.opts.Name,
+			Metadata:      s.opts.Metadata,
+			InviteToken:   s.opts.InviteToken,
+			Observer:      s.opts.Observer,
+			AutoSubscribe: s.opts.AutoSubscribe,
+			RelayOnly:     s.opts.RelayOnly,
+		},
+	}
+	if prev != nil {
+		req.SessionID = prev.SessionID
+		req.SessionToken = prev.SessionToken
+		// Invites are single-use; a resumed session does not need it again.
+		req.InviteToken = ""
+		req.Reattach = pc != nil
+	}
+	if req.Name == "" {
+		req.Name = s.c.opts.Name
+	}
+
+	reply, err := s.c.request(ctx, signaling.MessageTypeJoin, req, signaling.MessageTypeJoin)
+	if err != nil {
+		return err
+	}
+	var info signaling.JoinResponse
+	if !decode(reply, &info) {
+		return errors.New("client: malformed join response")
+	}
+
+	if info.Reattached {
+		s.mu.Lock()
+		s.info = info
+		s.mu.Unlock()
+		return nil
+	}
+	if prev != nil && pc != nil {
+		// The SFU did not keep the peer; start over on a fresh connection.
+		pc.Close()
+		pc = nil
+	}
+
+	if pc == nil {
+		if pc, err = s.newPeerConnection(info); err != nil {
+			return err
+		}
+	}
+
+	answered := make(chan struct{})
+	s.mu.Lock()
+	s.info = info
+	s.pc = pc
+	s.negotiating = false
+	s.pendingNegotiate = false
+	s.negotiationID = ""
+	s.pendingCandidates = nil
+	s.answered = answered
+	published := append([]webrtc.TrackLocal(nil), s.published...)
+	s.mu.Unlock()
+
+	if err := s.setupPeerConnection(pc, published); err != nil {
+		return err
+	}
+	if err := s.negotiate(); err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.c.opts.RequestTimeout)
+		defer cancel()
+	}
+	select {
+	case <-answered:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.c.closed:
+		return ErrClosed
+	}
+}
+
+func (s *Session) newPeerConnection(info signaling.JoinResponse) (*webrtc.PeerConnection, error) {
+	if s.opts.NewPeerConnection != nil {
+		return s.opts.NewPeerConnection()
+	}
+	if s.opts.PeerConnection != nil {
+		return nil, ErrNoPeerConnectionFactory
+	}
+	config := s.opts.Configuration
+	if info.ICETransportPolicy == webrtc.ICETransportPolicyRelay.String() {
+		config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+		config.ICEServers = info.ICEServers
+	}
+	if s.opts.API != nil {
+		return s.opts.API.NewPeerConnection(config)
+	}
+	return webrtc.NewPeerConnection(config)
+}
+
+func (s *Session) setupPeerConnection(pc *webrtc.PeerConnection, published []webrtc.TrackLocal) error {
+	for _, track := range published {
+		sender, err := pc.AddTrack(track)
+		if err != nil {
+			return err
+		}
+		go drainRTCP(sender)
+	}
+	if err := addRecvTransceivers(pc, webrtc.RTPCodecTypeVideo, s.opts.RecvVideo); err != nil {
+		return err
+	}
+	if err := addRecvTransceivers(pc, webrtc.RTPCodecTypeAudio, s.opts.RecvAudio); err != nil {
+		return err
+	}
+
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		init := candidate.ToJSON()
+		msg := signaling.ICECandidateMessage{
+			Candidate: init.Candidate,
+			PeerID:    s.PeerID(),
+		}
+		if init.SDPMid != nil {
+			msg.SDPMid = *init.SDPMid
+		}
+		if init.SDPMLineIndex != nil {
+			msg.SDPMLineIndex = int(*init.SDPMLineIndex)
+		}
+		s.c.Send(signaling.MessageTypeICECandidate, msg)
+	})
+
+	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		if s.opts.OnTrack != nil {
+			s.opts.OnTrack(track, receiver)
+		}
+	})
+
+	if s.opts.OnData != nil {
+		dc, err := pc.CreateDataChannel("sfu-data", nil)
+		if err != nil {
+			return err
+		}
+		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+			s.opts.OnData(msg.Data)
+		})
+	}
+	return nil
+}
+
+func addRecvTransceivers(pc *webrtc.PeerConnection, kind webrtc.RTPCodecType, n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// negotiate sends a new offer, or marks one as pending if an offer is
+// already awaiting its answer.
+func (s *Session) negotiate() error {
+	s.mu.Lock()
+	if s.negotiating {
+		s.pendingNegotiate = true
+		s.mu.Unlock()
+		return nil
+	}
+	s.negotiating = true
+	pc := s.pc
+	peerID := s.info.PeerID
+	negotiationID := s.negotiationID
+	s.negotiationID = ""
+	s.mu.Unlock()
+
+	err := func() error {
+		offer, err := pc.CreateOffer(nil)
+		if err != nil {
+			return err
+		}
+		if err := pc.SetLocalDescription(offer); err != nil {
+			return err
+		}
+		return s.c.Send(signaling.MessageTypeOffer, signaling.OfferMessage{
+			SDP: offer.SDP, Type: offer.Type.String(), PeerID: peerID,
+			NegotiationID: negotiationID,
+		})
+	}()
+	if err != nil {
+		s.mu.Lock()
+		s.negotiating = false
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *Session) handleMessage(msg signaling.Message) {
+	s.mu.Lock()
+	ready := s.pc != nil
+	s.mu.Unlock()
+	if !ready {
+		return
+	}
+
+	switch msg.Type {
+	case signaling.MessageTypeAnswer:
+		var v signaling.AnswerMessage
+		if decode(msg, &v) {
+			s.handleAnswer(v)
+		}
+	case signaling.MessageTypeOffer, signaling.MessageTypeICERestartOffer:
+		var v signaling.OfferMessage
+		if decode(msg, &v) {
+			s.handleServerOffer(v)
+		}
+	case signaling.MessageTypeICECandidate:
+		var v signaling.ICECandidateMessage
+		if decode(msg, &v) {
+			s.addRemoteCandidate(v)
+		}
+	case signaling.MessageTypeRenegotiate:
+		var v signaling.RenegotiateMessage
+		if decode(msg, &v) {
+			s.mu.Lock()
+			s.negotiationID = v.NegotiationID
+			s.mu.Unlock()
+			s.ensureRecvTransceivers(v)
+			if err := s.negotiate(); err != nil {
+				s.c.logger.Warn("Renegotiation failed", zap.Error(err))
+			}
+		}
+	case signaling.MessageTypeRoomClosed:
+		go s.end()
+	case signaling.MessageTypeReconnectRequired:
+		go func() {
+			if err := s.rejoin(context.Background()); err != nil {
+				s.c.logger.Warn("Failed to rejoin after reconnect-required", zap.Error(err))
+			}
+		}()
+	}
+}
+
+func (s *Session) handleAnswer(answer signaling.AnswerMessage) {
+	s.mu.Lock()
+	pc := s.pc
+	s.mu.Unlock()
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeAnswer, SDP: answer.SDP,
+	}); err != nil {
+		s.c.logger.Warn("Failed to apply answer", zap.Error(err))
+	}
+	s.flushCandidates(pc)
+
+	s.mu.Lock()
+	s.negotiating = false
+	pending := s.pendingNegotiate
+	s.pendingNegotiate = false
+	select {
+	case <-s.answered:
+	default:
+		close(s.answered)
+	}
+	s.mu.Unlock()
+
+	if pending {
+		if err := s.negotiate(); err != nil {
+			s.c.logger.Warn("Renegotiation failed", zap.Error(err))
+		}
+	}
+}
+
+// handleServerOffer answers an SFU-initiated offer (e.g. an ICE restart).
+// The client is the polite side and rolls back its own pending offer.
+func (s *Session) handleServerOffer(offer signaling.OfferMessage) {
+	s.mu.Lock()
+	pc := s.pc
+	peerID := s.info.PeerID
+	s.mu.Unlock()
+
+	if pc.SignalingState() != webrtc.SignalingStateStable {
+		pc.SetLocalDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeRollback})
+		s.mu.Lock()
+		s.negotiating = false
+		s.pendingNegotiate = true
+		s.mu.Unlock()
+	}
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer, SDP: offer.SDP,
+	}); err != nil {
+		s.c.logger.Warn("Failed to apply server offer", zap.Error(err))
+		return
+	}
+	s.flushCandidates(pc)
+
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		s.c.logger.Warn("Failed to create answer", zap.Error(err))
+		return
+	}
+	if err := pc.SetLocalDescription(answer); err != nil {
+		s.c.logger.Warn("Failed to set local answer", zap.Error(err))
+		return
+	}
+	s.c.Send(signaling.MessageTypeAnswer, signaling.AnswerMessage{
+		SDP: answer.SDP, Type: answer.Type.String(), PeerID: peerID,
+	})
+}
+
+func (s *Session) addRemoteCandidate(msg signaling.ICECandidateMessage) {
+	idx := uint16(msg.SDPMLineIndex)
+	candidate := webrtc.ICECandidateInit{
+		Candidate:     msg.Candidate,
+		SDPMid:        &msg.SDPMid,
+		SDPMLineIndex: &idx,
+	}
+
+	s.mu.Lock()
+	pc := s.pc
+	if pc.RemoteDescription() == nil {
+		s.pendingCandidates = append(s.pendingCandidates, candidate)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	if err := pc.AddICECandidate(candidate); err != nil {
+		s.c.logger.Debug("Failed to add ICE candidate", zap.Error(err))
+	}
+}
+
+func (s *Session) flushCandidates(pc *webrtc.PeerConnection) {
+	s.mu.Lock()
+	pending := s.pendingCandidates
+	s.pendingCandidates = nil
+	s.mu.Unlock()
+
+	for _, candidate := range pending {
+		if err := pc.AddICECandidate(candidate); err != nil {
+			s.c.logger.Debug("Failed to add buffered ICE candidate", zap.Error(err))
+		}
+	}
+}
+
+// ensureRecvTransceivers makes sure there are enough receive transceivers
+// of each kind for the tracks a renegotiate announces. Servers that only
+// send trackCount get an even audio/video split.
+func (s *Session) ensureRecvTransceivers(v signaling.RenegotiateMessage) {
+	if v.TrackCount <= 0 {
+		return
+	}
+	s.mu.Lock()
+	pc := s.pc
+	s.mu.Unlock()
+
+	var video, audio int
+	for _, t := range pc.GetTransceivers() {
+		if d := t.Direction(); d != webrtc.RTPTransceiverDirectionRecvonly && d != webrtc.RTPTransceiverDirectionSendrecv {
+			continue
+		}
+		if t.Kind() == webrtc.RTPCodecTypeAudio {
+			audio++
+		} else {
+			video++
+		}
+	}
+
+	wantVideo, wantAudio := v.VideoCount, v.AudioCount
+	if wantVideo+wantAudio == 0 {
+		wantVideo = (v.TrackCount + 1) / 2
+		wantAudio = wantVideo
+	}
+	addRecvTransceivers(pc, webrtc.RTPCodecTypeVideo, wantVideo-video)
+	addRecvTransceivers(pc, webrtc.RTPCodecTypeAudio, wantAudio-audio)
+}
+
+// rejoin re-establishes the session on a fresh PeerConnection, resuming the
+// server-side session and republishing tracks.
+func (s *Session) rejoin(ctx context.Context) error {
+	s.mu.Lock()
+	if s.left {
+		s.mu.Unlock()
+		return nil
+	}
+	old := s.pc
+	prev := s.info
+	s.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	if err := s.join(ctx, nil, &prev); err != nil {
+		return err
+	}
+
+	if h := s.c.opts.Handlers.OnResumed; h != nil {
+		h(s.Info())
+	}
+	return nil
+}
+
+// resume re-establishes the session after the signaling connection was
+// redialed. If the SFU kept the peer, the current PeerConnection is kept and
+// an ICE restart recovers it if needed; otherwise the session is rejoined on
+// a fresh PeerConnection.
+func (s *Session) resume(ctx context.Context) error {
+	s.mu.Lock()
+	if s.left {
+		s.mu.Unlock()
+		return nil
+	}
+	pc := s.pc
+	prev := s.info
+	s.mu.Unlock()
+
+	if err := s.join(ctx, pc, &prev); err != nil {
+		return err
+	}
+
+	if h := s.c.opts.Handlers.OnResumed; h != nil {
+		h(s.Info())
+	}
+	return nil
+}
+
+// Info returns the latest join response.
+func (s *Session) Info() signaling.JoinResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.info
+}
+
+// PeerID returns the SFU-assigned peer ID.
+func (s *Session) PeerID() string {
+	return s.Info().PeerID
+}
+
+// PeerConnection returns the current PeerConnection. It changes when the
+// session is rejoined.
+func (s *Session) PeerConnection() *webrtc.PeerConnection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pc
+}
+
+// Leave leaves the room and closes the PeerConnection.
+func (s *Session) Leave() error {
+	s.mu.Lock()
+	if s.left {
+		s.mu.Unlock()
+		return nil
+	}
+	s.left = true
+	pc := s.pc
+	s.mu.Unlock()
+
+	err := s.c.Send(signaling.MessageTypeLeave, nil)
+	s.detach(pc)
+	return err
+}
+
+// end finishes a session the server has already closed.
+func (s *Session) end() {
+	s.mu.Lock()
+	if s.left {
+		s.mu.Unlock()
+		return
+	}
+	s.left = true
+	pc := s.pc
+	s.mu.Unlock()
+
+	s.detach(pc)
+}
+
+// detach unlinks the session from its client, so it is not resumed after a
+// reconnect, and closes its PeerConnection.
+func (s *Session) detach(pc *webrtc.PeerConnection) {
+	s.c.mu.Lock()
+	if s.c.session == s {
+		s.c.session = nil
+	}
+	s.c.mu.Unlock()
+
+	if pc != nil {
+		pc.Close()
+	}
+}